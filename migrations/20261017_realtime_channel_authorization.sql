@@ -0,0 +1,33 @@
+-- Supabase Realtime channel authorization
+-- Run against the Supabase project once SUPABASE_JWT_SECRET is configured, then set SUPABASE_REALTIME_PRIVATE=true.
+-- Clients connect with the token from GET /api/v1/auth/supabase-token (supabase.realtime.setAuth(token)) and join
+-- channels with { config: { private: true } }. A join is only allowed for topics listed in the token's
+-- realtime_topics claim; the API publishes with the service role, which bypasses these policies.
+--
+-- The tokens carry their own role, letrents_realtime, rather than `authenticated`. It holds no grants outside
+-- realtime.messages and is not granted to the authenticator or storage roles, so PostgREST and Storage refuse it.
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'letrents_realtime') THEN
+    CREATE ROLE letrents_realtime NOLOGIN NOINHERIT;
+  END IF;
+END
+$$;
+
+-- Realtime assumes the token's role to check channel joins
+GRANT letrents_realtime TO supabase_realtime_admin;
+GRANT USAGE ON SCHEMA realtime TO letrents_realtime;
+GRANT SELECT ON realtime.messages TO letrents_realtime;
+
+ALTER TABLE realtime.messages ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "letrents_realtime_receive" ON realtime.messages;
+CREATE POLICY "letrents_realtime_receive" ON realtime.messages
+  FOR SELECT TO letrents_realtime
+  USING (
+    realtime.topic() IN (SELECT jsonb_array_elements_text(COALESCE(auth.jwt() -> 'realtime_topics', '[]'::jsonb)))
+  );
+
+-- Presence and typing are relayed through the API so membership is checked there; clients never broadcast directly
+DROP POLICY IF EXISTS "letrents_realtime_send" ON realtime.messages;
@@ -0,0 +1,5 @@
+-- Add WhatsApp as a communication channel on tenant preferences.
+
+ALTER TABLE "tenant_preferences"
+  ADD COLUMN IF NOT EXISTS "enable_whatsapp" BOOLEAN NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS "whatsapp_number" VARCHAR(20);
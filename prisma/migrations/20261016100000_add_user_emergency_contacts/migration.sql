@@ -0,0 +1,51 @@
+-- CreateTable
+CREATE TABLE "user_emergency_contacts" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "user_id" UUID NOT NULL,
+    "company_id" UUID,
+    "name" VARCHAR(200) NOT NULL,
+    "relationship" VARCHAR(100) NOT NULL,
+    "phone" VARCHAR(20) NOT NULL,
+    "alternate_phone" VARCHAR(20),
+    "email" VARCHAR(255),
+    "address" TEXT,
+    "priority" INTEGER NOT NULL DEFAULT 1,
+    "is_next_of_kin" BOOLEAN NOT NULL DEFAULT false,
+    "notes" TEXT,
+    "created_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "user_emergency_contacts_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "user_emergency_contacts_user_id_idx" ON "user_emergency_contacts"("user_id");
+
+-- CreateIndex
+CREATE INDEX "user_emergency_contacts_company_id_idx" ON "user_emergency_contacts"("company_id");
+
+-- AddForeignKey
+ALTER TABLE "user_emergency_contacts" ADD CONSTRAINT "user_emergency_contacts_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "user_emergency_contacts" ADD CONSTRAINT "user_emergency_contacts_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "user_emergency_contacts" ADD CONSTRAINT "user_emergency_contacts_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+
+-- Backfill from the legacy single-contact columns on users (staff/caretakers)
+INSERT INTO "user_emergency_contacts" ("user_id", "company_id", "name", "relationship", "phone", "email", "priority", "is_next_of_kin")
+SELECT u."id", u."company_id", u."emergency_contact_name", COALESCE(u."emergency_relationship", 'Other'),
+       u."emergency_contact_phone", u."emergency_contact_email", 1, false
+FROM "users" u
+WHERE u."emergency_contact_name" IS NOT NULL AND u."emergency_contact_phone" IS NOT NULL;
+
+-- Backfill from tenant_profiles where the user has no contact yet
+INSERT INTO "user_emergency_contacts" ("user_id", "company_id", "name", "relationship", "phone", "priority", "is_next_of_kin")
+SELECT tp."user_id", u."company_id", tp."emergency_contact_name", COALESCE(tp."emergency_contact_relationship", 'Other'),
+       tp."emergency_contact_phone", 1, false
+FROM "tenant_profiles" tp
+JOIN "users" u ON u."id" = tp."user_id"
+WHERE tp."emergency_contact_name" IS NOT NULL AND tp."emergency_contact_phone" IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM "user_emergency_contacts" c WHERE c."user_id" = tp."user_id");
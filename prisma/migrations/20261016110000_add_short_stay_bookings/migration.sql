@@ -0,0 +1,54 @@
+-- AlterEnum
+ALTER TYPE "lease_type" ADD VALUE IF NOT EXISTS 'short_stay';
+
+-- AlterTable
+ALTER TABLE "units" ADD COLUMN IF NOT EXISTS "short_stay_enabled" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "units" ADD COLUMN IF NOT EXISTS "nightly_rate" DECIMAL(12,2);
+ALTER TABLE "units" ADD COLUMN IF NOT EXISTS "weekly_rate" DECIMAL(12,2);
+ALTER TABLE "units" ADD COLUMN IF NOT EXISTS "cleaning_fee" DECIMAL(10,2);
+ALTER TABLE "units" ADD COLUMN IF NOT EXISTS "min_stay_nights" INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE "units" ADD COLUMN IF NOT EXISTS "ical_import_url" TEXT;
+
+-- AlterTable
+ALTER TABLE "leases" ADD COLUMN IF NOT EXISTS "nightly_rate" DECIMAL(12,2);
+ALTER TABLE "leases" ADD COLUMN IF NOT EXISTS "weekly_rate" DECIMAL(12,2);
+ALTER TABLE "leases" ADD COLUMN IF NOT EXISTS "cleaning_fee" DECIMAL(10,2);
+ALTER TABLE "leases" ADD COLUMN IF NOT EXISTS "guest_count" INTEGER;
+
+-- CreateTable
+CREATE TABLE "unit_bookings" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "unit_id" UUID NOT NULL,
+    "lease_id" UUID,
+    "check_in" DATE NOT NULL,
+    "check_out" DATE NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'confirmed',
+    "source" VARCHAR(30) NOT NULL DEFAULT 'direct',
+    "external_uid" VARCHAR(255),
+    "guest_name" VARCHAR(200),
+    "notes" TEXT,
+    "created_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "unit_bookings_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX "unit_bookings_unit_id_external_uid_key" ON "unit_bookings"("unit_id", "external_uid");
+
+-- CreateIndex
+CREATE INDEX "unit_bookings_unit_id_check_in_check_out_idx" ON "unit_bookings"("unit_id", "check_in", "check_out");
+
+-- CreateIndex
+CREATE INDEX "unit_bookings_company_id_idx" ON "unit_bookings"("company_id");
+
+-- AddForeignKey
+ALTER TABLE "unit_bookings" ADD CONSTRAINT "unit_bookings_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "unit_bookings" ADD CONSTRAINT "unit_bookings_unit_id_fkey" FOREIGN KEY ("unit_id") REFERENCES "units"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "unit_bookings" ADD CONSTRAINT "unit_bookings_lease_id_fkey" FOREIGN KEY ("lease_id") REFERENCES "leases"("id") ON DELETE SET NULL ON UPDATE CASCADE;
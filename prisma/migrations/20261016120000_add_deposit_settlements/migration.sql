@@ -0,0 +1,53 @@
+-- AlterTable
+ALTER TABLE "inspection_items" ADD COLUMN IF NOT EXISTS "deduction_amount" DECIMAL(12,2);
+
+-- CreateTable
+CREATE TABLE "deposit_settlements" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "lease_id" UUID NOT NULL,
+    "tenant_id" UUID NOT NULL,
+    "unit_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "inspection_id" UUID,
+    "move_out_date" DATE NOT NULL,
+    "currency" VARCHAR(3) NOT NULL DEFAULT 'KES',
+    "deposit_held" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "outstanding_invoices_total" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "prorated_rent_adjustment" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "inspection_deductions_total" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "other_deductions_total" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "refund_amount" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "balance_due" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "line_items" JSONB NOT NULL DEFAULT '[]',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'draft',
+    "notes" TEXT,
+    "settlement_invoice_id" UUID,
+    "refund_payment_id" UUID,
+    "calculated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "approved_by" UUID,
+    "approved_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "deposit_settlements_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX "deposit_settlements_lease_id_key" ON "deposit_settlements"("lease_id");
+
+-- CreateIndex
+CREATE INDEX "deposit_settlements_company_id_idx" ON "deposit_settlements"("company_id");
+
+-- CreateIndex
+CREATE INDEX "deposit_settlements_tenant_id_idx" ON "deposit_settlements"("tenant_id");
+
+-- CreateIndex
+CREATE INDEX "deposit_settlements_status_idx" ON "deposit_settlements"("status");
+
+-- AddForeignKey
+ALTER TABLE "deposit_settlements" ADD CONSTRAINT "deposit_settlements_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "deposit_settlements" ADD CONSTRAINT "deposit_settlements_lease_id_fkey" FOREIGN KEY ("lease_id") REFERENCES "leases"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,41 @@
+-- AlterTable
+ALTER TABLE "tenant_profiles" ADD COLUMN IF NOT EXISTS "date_of_birth" DATE;
+
+-- CreateTable
+CREATE TABLE "kyc_verifications" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "tenant_id" UUID NOT NULL,
+    "document_id" UUID NOT NULL,
+    "document_type" VARCHAR(30),
+    "status" VARCHAR(20) NOT NULL DEFAULT 'processing',
+    "extracted_name" VARCHAR(200),
+    "extracted_id_number" VARCHAR(50),
+    "extracted_dob" DATE,
+    "extracted_data" JSONB NOT NULL DEFAULT '{}',
+    "mismatches" JSONB NOT NULL DEFAULT '[]',
+    "prefilled_fields" TEXT[] DEFAULT ARRAY[]::TEXT[],
+    "error_message" TEXT,
+    "reviewed_by" UUID,
+    "reviewed_at" TIMESTAMPTZ(6),
+    "review_notes" TEXT,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "kyc_verifications_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "kyc_verifications_company_id_idx" ON "kyc_verifications"("company_id");
+
+-- CreateIndex
+CREATE INDEX "kyc_verifications_tenant_id_idx" ON "kyc_verifications"("tenant_id");
+
+-- CreateIndex
+CREATE INDEX "kyc_verifications_status_idx" ON "kyc_verifications"("status");
+
+-- AddForeignKey
+ALTER TABLE "kyc_verifications" ADD CONSTRAINT "kyc_verifications_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "kyc_verifications" ADD CONSTRAINT "kyc_verifications_document_id_fkey" FOREIGN KEY ("document_id") REFERENCES "tenant_documents"("id") ON DELETE CASCADE ON UPDATE CASCADE;
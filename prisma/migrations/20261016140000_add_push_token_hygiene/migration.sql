@@ -0,0 +1,7 @@
+-- AlterTable
+ALTER TABLE "push_notification_tokens" ADD COLUMN IF NOT EXISTS "failure_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "push_notification_tokens" ADD COLUMN IF NOT EXISTS "last_error" TEXT;
+ALTER TABLE "push_notification_tokens" ADD COLUMN IF NOT EXISTS "deactivated_reason" VARCHAR(50);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "push_notification_tokens_token_idx" ON "push_notification_tokens"("token");
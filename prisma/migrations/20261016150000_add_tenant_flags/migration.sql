@@ -0,0 +1,46 @@
+-- CreateTable
+CREATE TABLE "tenant_flags" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "tenant_id" UUID,
+    "tenant_name" VARCHAR(200) NOT NULL,
+    "tenant_email" VARCHAR(255),
+    "tenant_phone" VARCHAR(20),
+    "tenant_id_number" VARCHAR(50),
+    "category" VARCHAR(30) NOT NULL,
+    "severity" VARCHAR(20) NOT NULL DEFAULT 'medium',
+    "reason" TEXT NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'active',
+    "flagged_by" UUID NOT NULL,
+    "expires_at" TIMESTAMPTZ(6),
+    "dispute_reason" TEXT,
+    "disputed_at" TIMESTAMPTZ(6),
+    "resolution_notes" TEXT,
+    "resolved_by" UUID,
+    "resolved_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "tenant_flags_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "tenant_flags_company_id_idx" ON "tenant_flags"("company_id");
+
+-- CreateIndex
+CREATE INDEX "tenant_flags_tenant_id_idx" ON "tenant_flags"("tenant_id");
+
+-- CreateIndex
+CREATE INDEX "tenant_flags_tenant_email_idx" ON "tenant_flags"("tenant_email");
+
+-- CreateIndex
+CREATE INDEX "tenant_flags_tenant_phone_idx" ON "tenant_flags"("tenant_phone");
+
+-- CreateIndex
+CREATE INDEX "tenant_flags_tenant_id_number_idx" ON "tenant_flags"("tenant_id_number");
+
+-- CreateIndex
+CREATE INDEX "tenant_flags_status_idx" ON "tenant_flags"("status");
+
+-- AddForeignKey
+ALTER TABLE "tenant_flags" ADD CONSTRAINT "tenant_flags_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
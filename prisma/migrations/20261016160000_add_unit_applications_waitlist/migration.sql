@@ -0,0 +1,95 @@
+-- CreateTable
+CREATE TABLE "unit_applications" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "unit_id" UUID NOT NULL,
+    "waitlist_entry_id" UUID,
+    "applicant_id" UUID,
+    "first_name" VARCHAR(100) NOT NULL,
+    "last_name" VARCHAR(100) NOT NULL,
+    "email" VARCHAR(255) NOT NULL,
+    "phone_number" VARCHAR(20) NOT NULL,
+    "id_number" VARCHAR(50),
+    "occupation" VARCHAR(100),
+    "employer" VARCHAR(200),
+    "monthly_income" DECIMAL(12,2),
+    "household_size" INTEGER,
+    "desired_move_in" DATE,
+    "message" TEXT,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "review_notes" TEXT,
+    "reviewed_by" UUID,
+    "reviewed_at" TIMESTAMPTZ(6),
+    "tenant_id" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "unit_applications_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE "property_waitlist_entries" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "applicant_id" UUID,
+    "first_name" VARCHAR(100) NOT NULL,
+    "last_name" VARCHAR(100) NOT NULL,
+    "email" VARCHAR(255) NOT NULL,
+    "phone_number" VARCHAR(20) NOT NULL,
+    "unit_type" VARCHAR(50),
+    "min_bedrooms" INTEGER,
+    "max_rent" DECIMAL(12,2),
+    "notes" TEXT,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    "offered_unit_id" UUID,
+    "offered_at" TIMESTAMPTZ(6),
+    "offer_expires_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "property_waitlist_entries_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "unit_applications_company_id_idx" ON "unit_applications"("company_id");
+
+-- CreateIndex
+CREATE INDEX "unit_applications_property_id_idx" ON "unit_applications"("property_id");
+
+-- CreateIndex
+CREATE INDEX "unit_applications_unit_id_idx" ON "unit_applications"("unit_id");
+
+-- CreateIndex
+CREATE INDEX "unit_applications_email_idx" ON "unit_applications"("email");
+
+-- CreateIndex
+CREATE INDEX "unit_applications_status_idx" ON "unit_applications"("status");
+
+-- CreateIndex
+CREATE INDEX "property_waitlist_entries_company_id_idx" ON "property_waitlist_entries"("company_id");
+
+-- CreateIndex
+CREATE INDEX "property_waitlist_entries_property_id_status_idx" ON "property_waitlist_entries"("property_id", "status");
+
+-- CreateIndex
+CREATE INDEX "property_waitlist_entries_email_idx" ON "property_waitlist_entries"("email");
+
+-- AddForeignKey
+ALTER TABLE "unit_applications" ADD CONSTRAINT "unit_applications_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "unit_applications" ADD CONSTRAINT "unit_applications_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "unit_applications" ADD CONSTRAINT "unit_applications_unit_id_fkey" FOREIGN KEY ("unit_id") REFERENCES "units"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "property_waitlist_entries" ADD CONSTRAINT "property_waitlist_entries_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "property_waitlist_entries" ADD CONSTRAINT "property_waitlist_entries_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "property_waitlist_entries" ADD CONSTRAINT "property_waitlist_entries_offered_unit_id_fkey" FOREIGN KEY ("offered_unit_id") REFERENCES "units"("id") ON DELETE SET NULL ON UPDATE CASCADE;
@@ -0,0 +1,33 @@
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "assigned_at" TIMESTAMPTZ(6);
+
+-- CreateTable
+CREATE TABLE "maintenance_comments" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "request_id" UUID NOT NULL,
+    "author_id" UUID NOT NULL,
+    "comment_type" VARCHAR(20) NOT NULL DEFAULT 'comment',
+    "comment" TEXT NOT NULL,
+    "is_internal" BOOLEAN NOT NULL DEFAULT false,
+    "from_status" VARCHAR(20),
+    "to_status" VARCHAR(20),
+    "attachments" JSONB NOT NULL DEFAULT '[]',
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "maintenance_comments_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "maintenance_requests_company_id_status_idx" ON "maintenance_requests"("company_id", "status");
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "maintenance_requests_assigned_to_idx" ON "maintenance_requests"("assigned_to");
+
+-- CreateIndex
+CREATE INDEX "maintenance_comments_request_id_idx" ON "maintenance_comments"("request_id");
+
+-- AddForeignKey
+ALTER TABLE "maintenance_comments" ADD CONSTRAINT "maintenance_comments_request_id_fkey" FOREIGN KEY ("request_id") REFERENCES "maintenance_requests"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "maintenance_comments" ADD CONSTRAINT "maintenance_comments_author_id_fkey" FOREIGN KEY ("author_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
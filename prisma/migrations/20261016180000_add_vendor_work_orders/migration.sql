@@ -0,0 +1,36 @@
+-- AlterTable
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "contact_person" VARCHAR(200);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "alternate_phone" VARCHAR(50);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "hourly_rate" DECIMAL(12,2);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "callout_fee" DECIMAL(12,2);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "currency" VARCHAR(3) NOT NULL DEFAULT 'KES';
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "license_number" VARCHAR(100);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "insurance_provider" VARCHAR(200);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "insurance_policy_number" VARCHAR(100);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "insurance_expiry" DATE;
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "rating" DECIMAL(3,2);
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "rating_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "status" VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE "vendors" ADD COLUMN IF NOT EXISTS "notes" TEXT;
+
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "vendor_id" UUID;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "vendor_token_hash" VARCHAR(64);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "vendor_token_expires_at" TIMESTAMPTZ(6);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "vendor_rating" INTEGER;
+
+-- AlterTable
+ALTER TABLE "maintenance_comments" ALTER COLUMN "author_id" DROP NOT NULL;
+ALTER TABLE "maintenance_comments" ADD COLUMN IF NOT EXISTS "vendor_id" UUID;
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "maintenance_requests_vendor_id_idx" ON "maintenance_requests"("vendor_id");
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "maintenance_requests_vendor_token_hash_key" ON "maintenance_requests"("vendor_token_hash");
+
+-- AddForeignKey
+ALTER TABLE "maintenance_requests" ADD CONSTRAINT "maintenance_requests_vendor_id_fkey" FOREIGN KEY ("vendor_id") REFERENCES "vendors"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "maintenance_comments" ADD CONSTRAINT "maintenance_comments_vendor_id_fkey" FOREIGN KEY ("vendor_id") REFERENCES "vendors"("id") ON DELETE SET NULL ON UPDATE CASCADE;
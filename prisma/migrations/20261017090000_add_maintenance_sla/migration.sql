@@ -0,0 +1,12 @@
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "first_response_at" TIMESTAMPTZ(6);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "response_due_at" TIMESTAMPTZ(6);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "resolution_due_at" TIMESTAMPTZ(6);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "response_breached" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "resolution_breached" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "escalation_level" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "escalated_at" TIMESTAMPTZ(6);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "resolved_at" TIMESTAMPTZ(6);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "maintenance_requests_status_resolution_due_at_idx" ON "maintenance_requests"("status", "resolution_due_at");
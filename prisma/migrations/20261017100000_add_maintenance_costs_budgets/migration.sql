@@ -0,0 +1,36 @@
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "cost_approval_status" VARCHAR(20);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "cost_approved_by" UUID;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "cost_approved_at" TIMESTAMPTZ(6);
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "cost_approval_notes" TEXT;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "receipts" JSONB NOT NULL DEFAULT '[]';
+
+-- CreateTable
+CREATE TABLE "property_maintenance_budgets" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "year" INTEGER NOT NULL,
+    "amount" DECIMAL(12,2) NOT NULL,
+    "notes" TEXT,
+    "created_by" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "property_maintenance_budgets_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "maintenance_requests_property_id_completed_date_idx" ON "maintenance_requests"("property_id", "completed_date");
+
+-- CreateIndex
+CREATE UNIQUE INDEX "property_maintenance_budgets_property_id_year_key" ON "property_maintenance_budgets"("property_id", "year");
+
+-- CreateIndex
+CREATE INDEX "property_maintenance_budgets_company_id_year_idx" ON "property_maintenance_budgets"("company_id", "year");
+
+-- AddForeignKey
+ALTER TABLE "property_maintenance_budgets" ADD CONSTRAINT "property_maintenance_budgets_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "property_maintenance_budgets" ADD CONSTRAINT "property_maintenance_budgets_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
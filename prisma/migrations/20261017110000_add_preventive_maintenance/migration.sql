@@ -0,0 +1,57 @@
+-- CreateTable
+CREATE TABLE "preventive_maintenance_schedules" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "unit_id" UUID,
+    "title" VARCHAR(255) NOT NULL,
+    "description" TEXT,
+    "category" VARCHAR(50) NOT NULL DEFAULT 'general',
+    "priority" VARCHAR(20) NOT NULL DEFAULT 'medium',
+    "frequency" VARCHAR(20) NOT NULL,
+    "interval_count" INTEGER NOT NULL DEFAULT 1,
+    "next_due_date" DATE NOT NULL,
+    "lead_days" INTEGER NOT NULL DEFAULT 3,
+    "reminder_days" INTEGER NOT NULL DEFAULT 1,
+    "output_type" VARCHAR(20) NOT NULL DEFAULT 'task',
+    "assigned_to" UUID,
+    "vendor_id" UUID,
+    "estimated_cost" DECIMAL(12,2),
+    "is_active" BOOLEAN NOT NULL DEFAULT true,
+    "last_generated_at" TIMESTAMPTZ(6),
+    "created_by" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "preventive_maintenance_schedules_pkey" PRIMARY KEY ("id")
+);
+
+-- AlterTable
+ALTER TABLE "tasks" ADD COLUMN IF NOT EXISTS "preventive_schedule_id" UUID;
+
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "preventive_schedule_id" UUID;
+
+-- CreateIndex
+CREATE INDEX "preventive_maintenance_schedules_company_id_idx" ON "preventive_maintenance_schedules"("company_id");
+
+-- CreateIndex
+CREATE INDEX "preventive_maintenance_schedules_is_active_next_due_date_idx" ON "preventive_maintenance_schedules"("is_active", "next_due_date");
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "tasks_preventive_schedule_id_idx" ON "tasks"("preventive_schedule_id");
+
+-- AddForeignKey
+ALTER TABLE "preventive_maintenance_schedules" ADD CONSTRAINT "preventive_maintenance_schedules_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "preventive_maintenance_schedules" ADD CONSTRAINT "preventive_maintenance_schedules_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "preventive_maintenance_schedules" ADD CONSTRAINT "preventive_maintenance_schedules_unit_id_fkey" FOREIGN KEY ("unit_id") REFERENCES "units"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "tasks" ADD CONSTRAINT "tasks_preventive_schedule_id_fkey" FOREIGN KEY ("preventive_schedule_id") REFERENCES "preventive_maintenance_schedules"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "maintenance_requests" ADD CONSTRAINT "maintenance_requests_preventive_schedule_id_fkey" FOREIGN KEY ("preventive_schedule_id") REFERENCES "preventive_maintenance_schedules"("id") ON DELETE SET NULL ON UPDATE CASCADE;
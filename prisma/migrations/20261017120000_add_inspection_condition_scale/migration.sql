@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "checklist_templates" ADD COLUMN IF NOT EXISTS "condition_scale" JSONB;
+
+-- AlterTable
+ALTER TABLE "inspections" ADD COLUMN IF NOT EXISTS "score" DECIMAL(5,2);
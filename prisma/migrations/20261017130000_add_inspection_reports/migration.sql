@@ -0,0 +1,29 @@
+-- AlterTable
+ALTER TABLE "inspections" ADD COLUMN IF NOT EXISTS "report_generated_at" TIMESTAMPTZ(6);
+
+-- CreateTable
+CREATE TABLE "inspection_report_shares" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "inspection_id" UUID NOT NULL,
+    "token_hash" VARCHAR(64) NOT NULL,
+    "recipient_type" VARCHAR(20) NOT NULL,
+    "recipient_email" VARCHAR(255) NOT NULL,
+    "recipient_name" VARCHAR(255),
+    "expires_at" TIMESTAMPTZ(6) NOT NULL,
+    "revoked_at" TIMESTAMPTZ(6),
+    "access_count" INTEGER NOT NULL DEFAULT 0,
+    "last_accessed_at" TIMESTAMPTZ(6),
+    "created_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "inspection_report_shares_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX "inspection_report_shares_token_hash_key" ON "inspection_report_shares"("token_hash");
+
+-- CreateIndex
+CREATE INDEX "inspection_report_shares_inspection_id_idx" ON "inspection_report_shares"("inspection_id");
+
+-- AddForeignKey
+ALTER TABLE "inspection_report_shares" ADD CONSTRAINT "inspection_report_shares_inspection_id_fkey" FOREIGN KEY ("inspection_id") REFERENCES "inspections"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,12 @@
+-- AlterTable
+ALTER TABLE "inspections" ADD COLUMN IF NOT EXISTS "duration_minutes" INTEGER NOT NULL DEFAULT 60;
+ALTER TABLE "inspections" ADD COLUMN IF NOT EXISTS "reminder_sent_at" TIMESTAMPTZ(6);
+
+-- AlterTable
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "calendar_feed_token" VARCHAR(64);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "users_calendar_feed_token_key" ON "users"("calendar_feed_token");
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "inspections_inspector_id_scheduled_date_idx" ON "inspections"("inspector_id", "scheduled_date");
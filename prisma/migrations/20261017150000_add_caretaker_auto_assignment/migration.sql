@@ -0,0 +1,6 @@
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "auto_assigned" BOOLEAN NOT NULL DEFAULT false;
+
+-- AlterTable
+ALTER TABLE "tasks" ADD COLUMN IF NOT EXISTS "source" VARCHAR(30);
+ALTER TABLE "tasks" ADD COLUMN IF NOT EXISTS "auto_assigned" BOOLEAN NOT NULL DEFAULT false;
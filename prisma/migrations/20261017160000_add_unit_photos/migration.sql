@@ -0,0 +1,34 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "unit_photos" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "unit_id" UUID NOT NULL,
+    "company_id" UUID NOT NULL,
+    "file_id" VARCHAR(100) NOT NULL,
+    "url" VARCHAR(500) NOT NULL,
+    "thumbnail_url" VARCHAR(500),
+    "name" VARCHAR(255),
+    "caption" TEXT,
+    "category" VARCHAR(50),
+    "is_primary" BOOLEAN NOT NULL DEFAULT false,
+    "file_size" INTEGER,
+    "mime_type" VARCHAR(50),
+    "uploaded_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "unit_photos_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "unit_photos_unit_id_idx" ON "unit_photos"("unit_id");
+
+-- AddForeignKey
+ALTER TABLE "unit_photos" ADD CONSTRAINT "unit_photos_unit_id_fkey" FOREIGN KEY ("unit_id") REFERENCES "units"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- Backfill rows for images already stored on units.images
+INSERT INTO "unit_photos" ("unit_id", "company_id", "file_id", "url", "thumbnail_url", "name", "is_primary", "created_at")
+SELECT u."id", u."company_id", img->>'fileId', img->>'url', (img->>'url') || '?tr=w-320,h-320,c-at_max', img->>'name',
+       COALESCE((img->>'isPrimary')::boolean, false), u."updated_at"
+FROM "units" u
+CROSS JOIN LATERAL jsonb_array_elements(CASE WHEN jsonb_typeof(u."images") = 'array' THEN u."images" ELSE '[]'::jsonb END) AS img
+WHERE img->>'fileId' IS NOT NULL AND img->>'url' IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM "unit_photos" p WHERE p."unit_id" = u."id" AND p."file_id" = img->>'fileId');
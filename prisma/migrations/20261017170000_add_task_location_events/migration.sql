@@ -0,0 +1,33 @@
+-- AlterTable
+ALTER TABLE "properties" ADD COLUMN IF NOT EXISTS "geofence_radius_meters" INTEGER;
+
+-- AlterTable
+ALTER TABLE "tasks" ADD COLUMN IF NOT EXISTS "location_flagged" BOOLEAN NOT NULL DEFAULT false;
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "task_location_events" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "task_id" UUID NOT NULL,
+    "company_id" UUID NOT NULL,
+    "user_id" UUID NOT NULL,
+    "event_type" VARCHAR(20) NOT NULL,
+    "latitude" DECIMAL(10,8) NOT NULL,
+    "longitude" DECIMAL(11,8) NOT NULL,
+    "accuracy_meters" DOUBLE PRECISION,
+    "distance_meters" DOUBLE PRECISION,
+    "within_geofence" BOOLEAN,
+    "flagged" BOOLEAN NOT NULL DEFAULT false,
+    "reason" TEXT,
+    "recorded_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "task_location_events_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "task_location_events_task_id_idx" ON "task_location_events"("task_id");
+CREATE INDEX IF NOT EXISTS "task_location_events_user_id_recorded_at_idx" ON "task_location_events"("user_id", "recorded_at");
+CREATE INDEX IF NOT EXISTS "task_location_events_company_id_flagged_idx" ON "task_location_events"("company_id", "flagged");
+
+-- AddForeignKey
+ALTER TABLE "task_location_events" ADD CONSTRAINT "task_location_events_task_id_fkey" FOREIGN KEY ("task_id") REFERENCES "tasks"("id") ON DELETE CASCADE ON UPDATE CASCADE;
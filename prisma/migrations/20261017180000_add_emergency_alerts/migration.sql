@@ -0,0 +1,51 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "emergency_alerts" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "unit_id" UUID,
+    "reported_by" UUID NOT NULL,
+    "emergency_type" VARCHAR(30) NOT NULL,
+    "description" TEXT NOT NULL,
+    "latitude" DECIMAL(10,8),
+    "longitude" DECIMAL(11,8),
+    "status" VARCHAR(20) NOT NULL DEFAULT 'open',
+    "escalation_level" INTEGER NOT NULL DEFAULT 0,
+    "last_notified_at" TIMESTAMPTZ(6),
+    "acknowledged_by" UUID,
+    "acknowledged_at" TIMESTAMPTZ(6),
+    "resolved_by" UUID,
+    "resolved_at" TIMESTAMPTZ(6),
+    "resolution_notes" TEXT,
+    "maintenance_request_id" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "emergency_alerts_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "emergency_alert_recipients" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "alert_id" UUID NOT NULL,
+    "user_id" UUID,
+    "contact_id" UUID,
+    "name" VARCHAR(200),
+    "phone" VARCHAR(20),
+    "reason" VARCHAR(50) NOT NULL,
+    "escalation_level" INTEGER NOT NULL DEFAULT 0,
+    "channels" JSONB NOT NULL DEFAULT '[]',
+    "notified_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "acknowledged_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "emergency_alert_recipients_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "emergency_alerts_company_id_status_idx" ON "emergency_alerts"("company_id", "status");
+CREATE INDEX IF NOT EXISTS "emergency_alerts_property_id_idx" ON "emergency_alerts"("property_id");
+CREATE INDEX IF NOT EXISTS "emergency_alert_recipients_alert_id_idx" ON "emergency_alert_recipients"("alert_id");
+CREATE INDEX IF NOT EXISTS "emergency_alert_recipients_user_id_idx" ON "emergency_alert_recipients"("user_id");
+
+-- AddForeignKey
+ALTER TABLE "emergency_alert_recipients" ADD CONSTRAINT "emergency_alert_recipients_alert_id_fkey" FOREIGN KEY ("alert_id") REFERENCES "emergency_alerts"("id") ON DELETE CASCADE ON UPDATE CASCADE;
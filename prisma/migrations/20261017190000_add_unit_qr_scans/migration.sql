@@ -0,0 +1,33 @@
+-- AlterTable
+ALTER TABLE "units" ADD COLUMN IF NOT EXISTS "qr_token" VARCHAR(64);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "units_qr_token_key" ON "units"("qr_token");
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "unit_qr_scans" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "unit_id" UUID NOT NULL,
+    "company_id" UUID NOT NULL,
+    "scanned_by" UUID NOT NULL,
+    "purpose" VARCHAR(30) NOT NULL,
+    "latitude" DECIMAL(10,8),
+    "longitude" DECIMAL(11,8),
+    "accuracy_meters" DOUBLE PRECISION,
+    "distance_meters" DOUBLE PRECISION,
+    "within_geofence" BOOLEAN,
+    "inspection_id" UUID,
+    "task_id" UUID,
+    "notes" TEXT,
+    "device_info" VARCHAR(255),
+    "scanned_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "unit_qr_scans_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "unit_qr_scans_unit_id_scanned_at_idx" ON "unit_qr_scans"("unit_id", "scanned_at");
+CREATE INDEX IF NOT EXISTS "unit_qr_scans_scanned_by_idx" ON "unit_qr_scans"("scanned_by");
+
+-- AddForeignKey
+ALTER TABLE "unit_qr_scans" ADD CONSTRAINT "unit_qr_scans_unit_id_fkey" FOREIGN KEY ("unit_id") REFERENCES "units"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,61 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "staff_shifts" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "name" VARCHAR(100) NOT NULL,
+    "start_time" VARCHAR(5) NOT NULL,
+    "end_time" VARCHAR(5) NOT NULL,
+    "color" VARCHAR(20),
+    "is_active" BOOLEAN NOT NULL DEFAULT true,
+    "created_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "staff_shifts_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "staff_roster_entries" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "staff_id" UUID NOT NULL,
+    "shift_id" UUID NOT NULL,
+    "date" DATE NOT NULL,
+    "notes" TEXT,
+    "created_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "staff_roster_entries_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "staff_leaves" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "staff_id" UUID NOT NULL,
+    "leave_type" VARCHAR(20) NOT NULL,
+    "start_date" DATE NOT NULL,
+    "end_date" DATE NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "reason" TEXT,
+    "requested_by" UUID NOT NULL,
+    "decided_by" UUID,
+    "decided_at" TIMESTAMPTZ(6),
+    "decision_notes" TEXT,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "staff_leaves_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "staff_shifts_company_id_idx" ON "staff_shifts"("company_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "staff_roster_entries_staff_id_date_shift_id_key" ON "staff_roster_entries"("staff_id", "date", "shift_id");
+CREATE INDEX IF NOT EXISTS "staff_roster_entries_property_id_date_idx" ON "staff_roster_entries"("property_id", "date");
+CREATE INDEX IF NOT EXISTS "staff_roster_entries_company_id_date_idx" ON "staff_roster_entries"("company_id", "date");
+CREATE INDEX IF NOT EXISTS "staff_leaves_staff_id_start_date_idx" ON "staff_leaves"("staff_id", "start_date");
+CREATE INDEX IF NOT EXISTS "staff_leaves_company_id_status_idx" ON "staff_leaves"("company_id", "status");
+
+-- AddForeignKey
+ALTER TABLE "staff_roster_entries" ADD CONSTRAINT "staff_roster_entries_shift_id_fkey" FOREIGN KEY ("shift_id") REFERENCES "staff_shifts"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "tenant_rating" INTEGER;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "tenant_feedback" TEXT;
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "tenant_rated_at" TIMESTAMPTZ(6);
+
@@ -0,0 +1,52 @@
+-- AlterTable
+ALTER TABLE "maintenance_requests" ADD COLUMN IF NOT EXISTS "material_cost" DECIMAL(12,2) NOT NULL DEFAULT 0;
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "inventory_items" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID,
+    "name" VARCHAR(255) NOT NULL,
+    "sku" VARCHAR(100),
+    "category" VARCHAR(50) NOT NULL DEFAULT 'other',
+    "unit" VARCHAR(20) NOT NULL DEFAULT 'pcs',
+    "quantity" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "reorder_level" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "unit_cost" DECIMAL(12,2) NOT NULL DEFAULT 0,
+    "location" VARCHAR(255),
+    "is_active" BOOLEAN NOT NULL DEFAULT true,
+    "low_stock_alerted_at" TIMESTAMPTZ(6),
+    "created_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "inventory_items_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "inventory_movements" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "item_id" UUID NOT NULL,
+    "company_id" UUID NOT NULL,
+    "movement_type" VARCHAR(20) NOT NULL,
+    "quantity" DECIMAL(12,2) NOT NULL,
+    "unit_cost" DECIMAL(12,2) NOT NULL,
+    "quantity_after" DECIMAL(12,2) NOT NULL,
+    "maintenance_request_id" UUID,
+    "source_movement_id" UUID,
+    "notes" TEXT,
+    "performed_by" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "inventory_movements_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "inventory_items_company_id_property_id_idx" ON "inventory_items"("company_id", "property_id");
+CREATE INDEX IF NOT EXISTS "inventory_items_company_id_is_active_idx" ON "inventory_items"("company_id", "is_active");
+CREATE INDEX IF NOT EXISTS "inventory_movements_item_id_created_at_idx" ON "inventory_movements"("item_id", "created_at");
+CREATE INDEX IF NOT EXISTS "inventory_movements_maintenance_request_id_idx" ON "inventory_movements"("maintenance_request_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "inventory_movements_source_movement_id_key" ON "inventory_movements"("source_movement_id");
+
+-- AddForeignKey
+ALTER TABLE "inventory_movements" ADD CONSTRAINT "inventory_movements_item_id_fkey" FOREIGN KEY ("item_id") REFERENCES "inventory_items"("id") ON DELETE CASCADE ON UPDATE CASCADE;
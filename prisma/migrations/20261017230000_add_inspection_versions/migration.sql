@@ -0,0 +1,19 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "inspection_versions" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "inspection_id" UUID NOT NULL,
+    "version" INTEGER NOT NULL,
+    "reason" VARCHAR(20) NOT NULL,
+    "snapshot" JSONB NOT NULL,
+    "created_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "inspection_versions_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "inspection_versions_inspection_id_version_key" ON "inspection_versions"("inspection_id", "version");
+
+-- AddForeignKey
+ALTER TABLE "inspection_versions" ADD CONSTRAINT "inspection_versions_inspection_id_fkey" FOREIGN KEY ("inspection_id") REFERENCES "inspections"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "push_notification_tokens" ADD COLUMN IF NOT EXISTS "topics" TEXT[] NOT NULL DEFAULT ARRAY[]::TEXT[];
@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "conversation_participants" ADD COLUMN IF NOT EXISTS "archived_at" TIMESTAMPTZ(6);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "conversation_participants_user_id_left_at_idx" ON "conversation_participants"("user_id", "left_at");
@@ -0,0 +1,35 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "sms_messages" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID,
+    "recipient_id" UUID,
+    "phone" VARCHAR(20) NOT NULL,
+    "sender_id" VARCHAR(20),
+    "body" TEXT NOT NULL,
+    "message_type" VARCHAR(50) NOT NULL DEFAULT 'general',
+    "provider" VARCHAR(20) NOT NULL,
+    "provider_message_id" VARCHAR(100),
+    "status" VARCHAR(20) NOT NULL DEFAULT 'queued',
+    "segments" INTEGER NOT NULL DEFAULT 1,
+    "cost" DECIMAL(10,4),
+    "currency" VARCHAR(3),
+    "failure_reason" TEXT,
+    "sent_at" TIMESTAMPTZ(6),
+    "delivered_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "sms_messages_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "sms_messages_company_id_created_at_idx" ON "sms_messages"("company_id", "created_at");
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "sms_messages_provider_provider_message_id_idx" ON "sms_messages"("provider", "provider_message_id");
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "sms_messages_recipient_id_idx" ON "sms_messages"("recipient_id");
+
+-- AddForeignKey
+ALTER TABLE "sms_messages" ADD CONSTRAINT "sms_messages_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE SET NULL ON UPDATE CASCADE;
@@ -0,0 +1,10 @@
+-- Full-text search over message subjects and bodies. The 'simple' configuration does no
+-- stemming or stop-word removal, so English, Swahili and mixed messages are matched alike.
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS "search_vector" tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce("subject", '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce("content", '')), 'B')
+    ) STORED;
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "messages_search_vector_idx" ON "messages" USING GIN ("search_vector");
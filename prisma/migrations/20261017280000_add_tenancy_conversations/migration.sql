@@ -0,0 +1,9 @@
+-- AlterTable
+ALTER TABLE "conversations" ADD COLUMN IF NOT EXISTS "lease_id" UUID;
+ALTER TABLE "conversations" ADD COLUMN IF NOT EXISTS "archived_at" TIMESTAMPTZ(6);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "conversations_lease_id_key" ON "conversations"("lease_id");
+
+-- AddForeignKey
+ALTER TABLE "conversations" ADD CONSTRAINT "conversations_lease_id_fkey" FOREIGN KEY ("lease_id") REFERENCES "leases"("id") ON DELETE SET NULL ON UPDATE CASCADE;
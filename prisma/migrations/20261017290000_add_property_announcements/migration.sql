@@ -0,0 +1,44 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "property_announcements" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "created_by" UUID NOT NULL,
+    "title" VARCHAR(200) NOT NULL,
+    "message" TEXT NOT NULL,
+    "category" VARCHAR(30) NOT NULL DEFAULT 'general',
+    "priority" VARCHAR(20) NOT NULL DEFAULT 'medium',
+    "requires_acknowledgement" BOOLEAN NOT NULL DEFAULT true,
+    "starts_at" TIMESTAMPTZ(6),
+    "ends_at" TIMESTAMPTZ(6),
+    "status" VARCHAR(20) NOT NULL DEFAULT 'published',
+    "recipients_count" INTEGER NOT NULL DEFAULT 0,
+    "withdrawn_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "property_announcements_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "property_announcement_recipients" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "announcement_id" UUID NOT NULL,
+    "user_id" UUID NOT NULL,
+    "unit_id" UUID,
+    "channels" JSONB NOT NULL DEFAULT '[]',
+    "notified_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "read_at" TIMESTAMPTZ(6),
+    "acknowledged_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "property_announcement_recipients_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "property_announcements_company_id_created_at_idx" ON "property_announcements"("company_id", "created_at");
+CREATE INDEX IF NOT EXISTS "property_announcements_property_id_status_idx" ON "property_announcements"("property_id", "status");
+CREATE UNIQUE INDEX IF NOT EXISTS "property_announcement_recipients_announcement_id_user_id_key" ON "property_announcement_recipients"("announcement_id", "user_id");
+CREATE INDEX IF NOT EXISTS "property_announcement_recipients_user_id_idx" ON "property_announcement_recipients"("user_id");
+
+-- AddForeignKey
+ALTER TABLE "property_announcement_recipients" ADD CONSTRAINT "property_announcement_recipients_announcement_id_fkey" FOREIGN KEY ("announcement_id") REFERENCES "property_announcements"("id") ON DELETE CASCADE ON UPDATE CASCADE;
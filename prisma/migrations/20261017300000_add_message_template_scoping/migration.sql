@@ -0,0 +1,7 @@
+-- AlterTable
+ALTER TABLE "message_templates" ADD COLUMN IF NOT EXISTS "agency_id" UUID;
+ALTER TABLE "message_templates" ADD COLUMN IF NOT EXISTS "usage_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "message_templates" ADD COLUMN IF NOT EXISTS "last_used_at" TIMESTAMPTZ(6);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "message_templates_company_id_template_type_idx" ON "message_templates"("company_id", "template_type");
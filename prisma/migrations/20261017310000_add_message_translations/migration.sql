@@ -0,0 +1,21 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "message_translations" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "message_id" UUID NOT NULL,
+    "language" VARCHAR(5) NOT NULL,
+    "source_language" VARCHAR(5),
+    "subject" VARCHAR(255),
+    "content" TEXT NOT NULL,
+    "provider" VARCHAR(20) NOT NULL,
+    "model" VARCHAR(100),
+    "requested_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "message_translations_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "message_translations_message_id_language_key" ON "message_translations"("message_id", "language");
+
+-- AddForeignKey
+ALTER TABLE "message_translations" ADD CONSTRAINT "message_translations_message_id_fkey" FOREIGN KEY ("message_id") REFERENCES "messages"("id") ON DELETE CASCADE ON UPDATE CASCADE;
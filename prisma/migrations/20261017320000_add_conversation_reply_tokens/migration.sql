@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "conversation_participants" ADD COLUMN IF NOT EXISTS "reply_token" VARCHAR(32);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "conversation_participants_reply_token_key" ON "conversation_participants"("reply_token");
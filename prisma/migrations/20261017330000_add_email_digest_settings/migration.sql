@@ -0,0 +1,14 @@
+-- AlterTable
+ALTER TABLE "user_preferences" ADD COLUMN IF NOT EXISTS "email_digest_frequency" VARCHAR(20) NOT NULL DEFAULT 'off';
+ALTER TABLE "user_preferences" ADD COLUMN IF NOT EXISTS "email_digest_sent_at" TIMESTAMPTZ(6);
+ALTER TABLE "user_preferences" ADD COLUMN IF NOT EXISTS "email_digest_token" VARCHAR(64);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "user_preferences_email_digest_token_key" ON "user_preferences"("email_digest_token");
+
+-- Carry over tenants who already chose a daily or weekly digest in their notification settings
+INSERT INTO "user_preferences" ("user_id", "email_digest_frequency")
+SELECT "user_id", "email_digest_frequency"
+FROM "tenant_notification_settings"
+WHERE "email_digest_frequency" IN ('daily', 'weekly')
+ON CONFLICT ("user_id") DO UPDATE SET "email_digest_frequency" = EXCLUDED."email_digest_frequency";
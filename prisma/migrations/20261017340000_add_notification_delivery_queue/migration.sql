@@ -0,0 +1,8 @@
+-- AlterTable
+ALTER TABLE "notification_delivery_log" ADD COLUMN IF NOT EXISTS "attempts" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "notification_delivery_log" ADD COLUMN IF NOT EXISTS "max_attempts" INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE "notification_delivery_log" ADD COLUMN IF NOT EXISTS "next_attempt_at" TIMESTAMPTZ(6);
+ALTER TABLE "notification_delivery_log" ADD COLUMN IF NOT EXISTS "last_attempt_at" TIMESTAMPTZ(6);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "notification_delivery_log_status_next_attempt_at_idx" ON "notification_delivery_log"("status", "next_attempt_at");
@@ -0,0 +1,45 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "message_escalation_rules" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "agency_id" UUID,
+    "name" VARCHAR(100) NOT NULL,
+    "priorities" TEXT[] NOT NULL DEFAULT ARRAY['urgent']::TEXT[],
+    "sender_role" VARCHAR(30) NOT NULL DEFAULT 'tenant',
+    "unanswered_minutes" INTEGER NOT NULL,
+    "target" VARCHAR(30) NOT NULL,
+    "channels" JSONB NOT NULL DEFAULT '["app", "sms"]',
+    "is_active" BOOLEAN NOT NULL DEFAULT true,
+    "created_by" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "message_escalation_rules_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "message_escalations" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "rule_id" UUID NOT NULL,
+    "company_id" UUID NOT NULL,
+    "conversation_id" UUID NOT NULL,
+    "message_id" UUID NOT NULL,
+    "target_user_id" UUID,
+    "notification_id" UUID,
+    "channels" JSONB NOT NULL DEFAULT '[]',
+    "status" VARCHAR(20) NOT NULL,
+    "error" TEXT,
+    "waited_minutes" INTEGER NOT NULL,
+    "escalated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "message_escalations_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "message_escalation_rules_company_id_is_active_idx" ON "message_escalation_rules"("company_id", "is_active");
+CREATE INDEX IF NOT EXISTS "message_escalations_rule_id_conversation_id_idx" ON "message_escalations"("rule_id", "conversation_id");
+CREATE INDEX IF NOT EXISTS "message_escalations_company_id_escalated_at_idx" ON "message_escalations"("company_id", "escalated_at");
+CREATE INDEX IF NOT EXISTS "message_escalations_message_id_idx" ON "message_escalations"("message_id");
+
+-- AddForeignKey
+ALTER TABLE "message_escalations" ADD CONSTRAINT "message_escalations_rule_id_fkey" FOREIGN KEY ("rule_id") REFERENCES "message_escalation_rules"("id") ON DELETE CASCADE ON UPDATE CASCADE;
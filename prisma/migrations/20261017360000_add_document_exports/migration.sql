@@ -0,0 +1,29 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "document_exports" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID,
+    "requested_by" UUID NOT NULL,
+    "document_type" VARCHAR(30) NOT NULL,
+    "report_type" VARCHAR(50),
+    "entity_id" UUID,
+    "filters" JSONB NOT NULL DEFAULT '{}',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'queued',
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "file_name" VARCHAR(255),
+    "file_size" INTEGER,
+    "download_url" TEXT,
+    "file_id" VARCHAR(255),
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "document_exports_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "document_exports_requested_by_created_at_idx" ON "document_exports"("requested_by", "created_at");
+CREATE INDEX IF NOT EXISTS "document_exports_status_created_at_idx" ON "document_exports"("status", "created_at");
+
+-- AddForeignKey
+ALTER TABLE "document_exports" ADD CONSTRAINT "document_exports_requested_by_fkey" FOREIGN KEY ("requested_by") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,53 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "scheduled_reports" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID,
+    "created_by" UUID NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "report_type" VARCHAR(50) NOT NULL,
+    "format" VARCHAR(10) NOT NULL DEFAULT 'pdf',
+    "filters" JSONB NOT NULL DEFAULT '{}',
+    "frequency" VARCHAR(20) NOT NULL,
+    "day_of_week" INTEGER,
+    "day_of_month" INTEGER,
+    "hour" INTEGER NOT NULL DEFAULT 7,
+    "timezone" VARCHAR(50) NOT NULL DEFAULT 'Africa/Nairobi',
+    "recipients" TEXT[] NOT NULL DEFAULT ARRAY[]::TEXT[],
+    "is_active" BOOLEAN NOT NULL DEFAULT true,
+    "next_run_at" TIMESTAMPTZ(6) NOT NULL,
+    "last_run_at" TIMESTAMPTZ(6),
+    "last_status" VARCHAR(20),
+    "consecutive_failures" INTEGER NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "scheduled_reports_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "scheduled_report_runs" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "schedule_id" UUID NOT NULL,
+    "trigger" VARCHAR(20) NOT NULL DEFAULT 'schedule',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'running',
+    "file_name" VARCHAR(255),
+    "file_size" INTEGER,
+    "download_url" TEXT,
+    "file_id" VARCHAR(255),
+    "recipient_count" INTEGER NOT NULL DEFAULT 0,
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "completed_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "scheduled_report_runs_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "scheduled_reports_company_id_idx" ON "scheduled_reports"("company_id");
+CREATE INDEX IF NOT EXISTS "scheduled_reports_is_active_next_run_at_idx" ON "scheduled_reports"("is_active", "next_run_at");
+CREATE INDEX IF NOT EXISTS "scheduled_report_runs_schedule_id_started_at_idx" ON "scheduled_report_runs"("schedule_id", "started_at");
+CREATE INDEX IF NOT EXISTS "scheduled_report_runs_status_started_at_idx" ON "scheduled_report_runs"("status", "started_at");
+
+-- AddForeignKey
+ALTER TABLE "scheduled_reports" ADD CONSTRAINT "scheduled_reports_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "scheduled_report_runs" ADD CONSTRAINT "scheduled_report_runs_schedule_id_fkey" FOREIGN KEY ("schedule_id") REFERENCES "scheduled_reports"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,38 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "expenses" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID,
+    "vendor_id" UUID,
+    "category" VARCHAR(50) NOT NULL,
+    "description" VARCHAR(500) NOT NULL,
+    "amount" DECIMAL(12,2) NOT NULL,
+    "currency" VARCHAR(3) NOT NULL DEFAULT 'KES',
+    "expense_date" DATE NOT NULL,
+    "payment_method" VARCHAR(50),
+    "reference" VARCHAR(100),
+    "receipt_url" TEXT,
+    "receipt_file_id" VARCHAR(255),
+    "recurrence" VARCHAR(20) NOT NULL DEFAULT 'none',
+    "next_occurrence_date" DATE,
+    "recurrence_end_date" DATE,
+    "parent_expense_id" UUID,
+    "notes" TEXT,
+    "created_by" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "expenses_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "expenses_company_id_expense_date_idx" ON "expenses"("company_id", "expense_date");
+CREATE INDEX IF NOT EXISTS "expenses_property_id_expense_date_idx" ON "expenses"("property_id", "expense_date");
+CREATE INDEX IF NOT EXISTS "expenses_recurrence_next_occurrence_date_idx" ON "expenses"("recurrence", "next_occurrence_date");
+
+-- AddForeignKey
+ALTER TABLE "expenses" ADD CONSTRAINT "expenses_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "expenses" ADD CONSTRAINT "expenses_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+ALTER TABLE "expenses" ADD CONSTRAINT "expenses_vendor_id_fkey" FOREIGN KEY ("vendor_id") REFERENCES "vendors"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+ALTER TABLE "expenses" ADD CONSTRAINT "expenses_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE RESTRICT ON UPDATE CASCADE;
+ALTER TABLE "expenses" ADD CONSTRAINT "expenses_parent_expense_id_fkey" FOREIGN KEY ("parent_expense_id") REFERENCES "expenses"("id") ON DELETE SET NULL ON UPDATE CASCADE;
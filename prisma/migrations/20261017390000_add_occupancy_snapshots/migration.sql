@@ -0,0 +1,23 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "occupancy_snapshots" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "month" DATE NOT NULL,
+    "total_units" INTEGER NOT NULL,
+    "occupied_units" INTEGER NOT NULL,
+    "occupancy_rate" DECIMAL(5,2) NOT NULL,
+    "leased_rent" DECIMAL(14,2) NOT NULL DEFAULT 0,
+    "source" VARCHAR(20) NOT NULL DEFAULT 'snapshot',
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "occupancy_snapshots_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "occupancy_snapshots_property_id_month_key" ON "occupancy_snapshots"("property_id", "month");
+CREATE INDEX IF NOT EXISTS "occupancy_snapshots_company_id_month_idx" ON "occupancy_snapshots"("company_id", "month");
+
+-- AddForeignKey
+ALTER TABLE "occupancy_snapshots" ADD CONSTRAINT "occupancy_snapshots_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
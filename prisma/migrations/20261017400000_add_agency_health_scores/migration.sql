@@ -0,0 +1,20 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "agency_health_scores" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "agency_id" UUID NOT NULL,
+    "company_id" UUID NOT NULL,
+    "score" DECIMAL(5,2) NOT NULL,
+    "grade" VARCHAR(2) NOT NULL,
+    "components" JSONB NOT NULL DEFAULT '{}',
+    "window_start" TIMESTAMPTZ(6) NOT NULL,
+    "window_end" TIMESTAMPTZ(6) NOT NULL,
+    "computed_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "agency_health_scores_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "agency_health_scores_agency_id_computed_at_idx" ON "agency_health_scores"("agency_id", "computed_at");
+
+-- AddForeignKey
+ALTER TABLE "agency_health_scores" ADD CONSTRAINT "agency_health_scores_agency_id_fkey" FOREIGN KEY ("agency_id") REFERENCES "agencies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
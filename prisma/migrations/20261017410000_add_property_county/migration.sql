@@ -0,0 +1,116 @@
+-- AlterTable
+ALTER TABLE "properties" ADD COLUMN IF NOT EXISTS "county" VARCHAR(100);
+
+-- Backfill from region, then city, where either already names a county
+UPDATE "properties" p
+SET "county" = c.name
+FROM (VALUES
+    ('Baringo'),
+    ('Bomet'),
+    ('Bungoma'),
+    ('Busia'),
+    ('Elgeyo-Marakwet'),
+    ('Embu'),
+    ('Garissa'),
+    ('Homa Bay'),
+    ('Isiolo'),
+    ('Kajiado'),
+    ('Kakamega'),
+    ('Kericho'),
+    ('Kiambu'),
+    ('Kilifi'),
+    ('Kirinyaga'),
+    ('Kisii'),
+    ('Kisumu'),
+    ('Kitui'),
+    ('Kwale'),
+    ('Laikipia'),
+    ('Lamu'),
+    ('Machakos'),
+    ('Makueni'),
+    ('Mandera'),
+    ('Marsabit'),
+    ('Meru'),
+    ('Migori'),
+    ('Mombasa'),
+    ('Murang''a'),
+    ('Nairobi'),
+    ('Nakuru'),
+    ('Nandi'),
+    ('Narok'),
+    ('Nyamira'),
+    ('Nyandarua'),
+    ('Nyeri'),
+    ('Samburu'),
+    ('Siaya'),
+    ('Taita-Taveta'),
+    ('Tana River'),
+    ('Tharaka-Nithi'),
+    ('Trans Nzoia'),
+    ('Turkana'),
+    ('Uasin Gishu'),
+    ('Vihiga'),
+    ('Wajir'),
+    ('West Pokot')
+) AS c(name)
+WHERE p."county" IS NULL
+  AND p."country" ILIKE 'kenya'
+  AND regexp_replace(lower(regexp_replace(p."region", '\m(county|city)\M', '', 'gi')), '[^a-z]', '', 'g') = regexp_replace(lower(c.name), '[^a-z]', '', 'g');
+
+UPDATE "properties" p
+SET "county" = c.name
+FROM (VALUES
+    ('Baringo'),
+    ('Bomet'),
+    ('Bungoma'),
+    ('Busia'),
+    ('Elgeyo-Marakwet'),
+    ('Embu'),
+    ('Garissa'),
+    ('Homa Bay'),
+    ('Isiolo'),
+    ('Kajiado'),
+    ('Kakamega'),
+    ('Kericho'),
+    ('Kiambu'),
+    ('Kilifi'),
+    ('Kirinyaga'),
+    ('Kisii'),
+    ('Kisumu'),
+    ('Kitui'),
+    ('Kwale'),
+    ('Laikipia'),
+    ('Lamu'),
+    ('Machakos'),
+    ('Makueni'),
+    ('Mandera'),
+    ('Marsabit'),
+    ('Meru'),
+    ('Migori'),
+    ('Mombasa'),
+    ('Murang''a'),
+    ('Nairobi'),
+    ('Nakuru'),
+    ('Nandi'),
+    ('Narok'),
+    ('Nyamira'),
+    ('Nyandarua'),
+    ('Nyeri'),
+    ('Samburu'),
+    ('Siaya'),
+    ('Taita-Taveta'),
+    ('Tana River'),
+    ('Tharaka-Nithi'),
+    ('Trans Nzoia'),
+    ('Turkana'),
+    ('Uasin Gishu'),
+    ('Vihiga'),
+    ('Wajir'),
+    ('West Pokot')
+) AS c(name)
+WHERE p."county" IS NULL
+  AND p."country" ILIKE 'kenya'
+  AND regexp_replace(lower(regexp_replace(p."city", '\m(county|city)\M', '', 'gi')), '[^a-z]', '', 'g') = regexp_replace(lower(c.name), '[^a-z]', '', 'g');
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "properties_county_idx" ON "properties"("county");
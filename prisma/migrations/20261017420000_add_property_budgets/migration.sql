@@ -0,0 +1,27 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "property_budgets" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID NOT NULL,
+    "property_id" UUID NOT NULL,
+    "year" INTEGER NOT NULL,
+    "kind" VARCHAR(10) NOT NULL,
+    "category" VARCHAR(50) NOT NULL,
+    "amount" DECIMAL(14,2) NOT NULL,
+    "monthly_amounts" JSONB NOT NULL DEFAULT '[]',
+    "notes" TEXT,
+    "last_alert_period" VARCHAR(7),
+    "created_by" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "property_budgets_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "property_budgets_property_id_year_kind_category_key" ON "property_budgets"("property_id", "year", "kind", "category");
+CREATE INDEX IF NOT EXISTS "property_budgets_company_id_year_idx" ON "property_budgets"("company_id", "year");
+
+-- AddForeignKey
+ALTER TABLE "property_budgets" ADD CONSTRAINT "property_budgets_company_id_fkey" FOREIGN KEY ("company_id") REFERENCES "companies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "property_budgets" ADD CONSTRAINT "property_budgets_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "property_budgets" ADD CONSTRAINT "property_budgets_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE RESTRICT ON UPDATE CASCADE;
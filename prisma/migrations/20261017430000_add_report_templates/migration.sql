@@ -0,0 +1,27 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "report_templates" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID,
+    "created_by" UUID NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "description" TEXT,
+    "entity" VARCHAR(30) NOT NULL,
+    "columns" TEXT[] DEFAULT ARRAY[]::TEXT[],
+    "filters" JSONB NOT NULL DEFAULT '{}',
+    "group_by" VARCHAR(50),
+    "sort_by" VARCHAR(50),
+    "sort_direction" VARCHAR(4) NOT NULL DEFAULT 'asc',
+    "is_shared" BOOLEAN NOT NULL DEFAULT false,
+    "last_run_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "report_templates_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "report_templates_company_id_idx" ON "report_templates"("company_id");
+CREATE INDEX IF NOT EXISTS "report_templates_created_by_idx" ON "report_templates"("created_by");
+
+-- AddForeignKey
+ALTER TABLE "report_templates" ADD CONSTRAINT "report_templates_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
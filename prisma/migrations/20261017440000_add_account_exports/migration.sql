@@ -0,0 +1,29 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "account_exports" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID,
+    "requested_by" UUID NOT NULL,
+    "format" VARCHAR(10) NOT NULL DEFAULT 'csv',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'queued',
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "record_counts" JSONB NOT NULL DEFAULT '{}',
+    "file_name" VARCHAR(255),
+    "file_size" INTEGER,
+    "file_url" TEXT,
+    "file_id" VARCHAR(255),
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "expires_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "account_exports_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "account_exports_requested_by_created_at_idx" ON "account_exports"("requested_by", "created_at");
+CREATE INDEX IF NOT EXISTS "account_exports_status_created_at_idx" ON "account_exports"("status", "created_at");
+CREATE INDEX IF NOT EXISTS "account_exports_status_expires_at_idx" ON "account_exports"("status", "expires_at");
+
+-- AddForeignKey
+ALTER TABLE "account_exports" ADD CONSTRAINT "account_exports_requested_by_fkey" FOREIGN KEY ("requested_by") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "user_preferences" ADD COLUMN IF NOT EXISTS "dashboard_widgets" TEXT[] DEFAULT ARRAY[]::TEXT[];
@@ -0,0 +1,53 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "kpi_alert_rules" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID,
+    "created_by" UUID NOT NULL,
+    "property_id" UUID,
+    "name" VARCHAR(255) NOT NULL,
+    "metric" VARCHAR(30) NOT NULL,
+    "operator" VARCHAR(10) NOT NULL,
+    "threshold" DECIMAL(14,2) NOT NULL,
+    "is_active" BOOLEAN NOT NULL DEFAULT true,
+    "is_breached" BOOLEAN NOT NULL DEFAULT false,
+    "last_value" DECIMAL(14,2),
+    "last_evaluated_at" TIMESTAMPTZ(6),
+    "last_triggered_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "kpi_alert_rules_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "kpi_alerts" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "rule_id" UUID NOT NULL,
+    "company_id" UUID,
+    "property_id" UUID,
+    "metric" VARCHAR(30) NOT NULL,
+    "operator" VARCHAR(10) NOT NULL,
+    "threshold" DECIMAL(14,2) NOT NULL,
+    "value" DECIMAL(14,2) NOT NULL,
+    "message" TEXT NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'open',
+    "triggered_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "resolved_at" TIMESTAMPTZ(6),
+    "resolved_value" DECIMAL(14,2),
+    "acknowledged_at" TIMESTAMPTZ(6),
+    "acknowledged_by" UUID,
+
+    CONSTRAINT "kpi_alerts_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "kpi_alert_rules_company_id_idx" ON "kpi_alert_rules"("company_id");
+CREATE INDEX IF NOT EXISTS "kpi_alert_rules_created_by_idx" ON "kpi_alert_rules"("created_by");
+CREATE INDEX IF NOT EXISTS "kpi_alert_rules_is_active_idx" ON "kpi_alert_rules"("is_active");
+CREATE INDEX IF NOT EXISTS "kpi_alerts_rule_id_status_idx" ON "kpi_alerts"("rule_id", "status");
+CREATE INDEX IF NOT EXISTS "kpi_alerts_company_id_triggered_at_idx" ON "kpi_alerts"("company_id", "triggered_at");
+
+-- AddForeignKey
+ALTER TABLE "kpi_alert_rules" ADD CONSTRAINT "kpi_alert_rules_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "kpi_alert_rules" ADD CONSTRAINT "kpi_alert_rules_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "kpi_alerts" ADD CONSTRAINT "kpi_alerts_rule_id_fkey" FOREIGN KEY ("rule_id") REFERENCES "kpi_alert_rules"("id") ON DELETE CASCADE ON UPDATE CASCADE;
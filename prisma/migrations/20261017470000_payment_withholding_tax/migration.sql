@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "payments" ADD COLUMN IF NOT EXISTS "withholding_tax" DECIMAL(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE "payments" ADD COLUMN IF NOT EXISTS "withholding_certificate" VARCHAR(100);
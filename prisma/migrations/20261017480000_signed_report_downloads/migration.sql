@@ -0,0 +1,21 @@
+-- Generated files move to private storage with an expiry; links are signed on request.
+-- Files already stored keep their URL and expire on the same timetable as new ones.
+
+-- AlterTable
+ALTER TABLE "document_exports" ADD COLUMN IF NOT EXISTS "file_url" TEXT;
+ALTER TABLE "document_exports" ADD COLUMN IF NOT EXISTS "expires_at" TIMESTAMPTZ(6);
+UPDATE "document_exports"
+SET "file_url" = "download_url", "expires_at" = COALESCE("completed_at", "created_at") + INTERVAL '7 days'
+WHERE "download_url" IS NOT NULL AND "file_url" IS NULL;
+ALTER TABLE "document_exports" DROP COLUMN IF EXISTS "download_url";
+
+ALTER TABLE "scheduled_report_runs" ADD COLUMN IF NOT EXISTS "file_url" TEXT;
+ALTER TABLE "scheduled_report_runs" ADD COLUMN IF NOT EXISTS "expires_at" TIMESTAMPTZ(6);
+UPDATE "scheduled_report_runs"
+SET "file_url" = "download_url", "expires_at" = COALESCE("completed_at", "started_at") + INTERVAL '30 days'
+WHERE "download_url" IS NOT NULL AND "file_url" IS NULL;
+ALTER TABLE "scheduled_report_runs" DROP COLUMN IF EXISTS "download_url";
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "document_exports_status_expires_at_idx" ON "document_exports"("status", "expires_at");
+CREATE INDEX IF NOT EXISTS "scheduled_report_runs_expires_at_idx" ON "scheduled_report_runs"("expires_at");
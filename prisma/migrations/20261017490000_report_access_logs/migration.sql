@@ -0,0 +1,27 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "report_access_logs" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "company_id" UUID,
+    "user_id" UUID,
+    "user_email" VARCHAR(255),
+    "user_role" VARCHAR(30),
+    "action" VARCHAR(30) NOT NULL,
+    "report_type" VARCHAR(50) NOT NULL,
+    "format" VARCHAR(10),
+    "parameters" JSONB NOT NULL DEFAULT '{}',
+    "resource_type" VARCHAR(50),
+    "resource_id" UUID,
+    "ip_address" VARCHAR(45),
+    "user_agent" TEXT,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "report_access_logs_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "report_access_logs_company_id_created_at_idx" ON "report_access_logs"("company_id", "created_at");
+CREATE INDEX IF NOT EXISTS "report_access_logs_user_id_created_at_idx" ON "report_access_logs"("user_id", "created_at");
+CREATE INDEX IF NOT EXISTS "report_access_logs_report_type_created_at_idx" ON "report_access_logs"("report_type", "created_at");
+
+-- AddForeignKey
+ALTER TABLE "report_access_logs" ADD CONSTRAINT "report_access_logs_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE;
@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "properties" ADD COLUMN IF NOT EXISTS "commission_rate" DECIMAL(5,2);
@@ -0,0 +1,27 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "platform_analytics_snapshots" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "snapshot_date" DATE NOT NULL,
+    "total_companies" INTEGER NOT NULL DEFAULT 0,
+    "total_agencies" INTEGER NOT NULL DEFAULT 0,
+    "total_landlords" INTEGER NOT NULL DEFAULT 0,
+    "total_agents" INTEGER NOT NULL DEFAULT 0,
+    "total_properties" INTEGER NOT NULL DEFAULT 0,
+    "total_units" INTEGER NOT NULL DEFAULT 0,
+    "occupied_units" INTEGER NOT NULL DEFAULT 0,
+    "occupancy_rate" DECIMAL(5,2) NOT NULL DEFAULT 0,
+    "active_tenants" INTEGER NOT NULL DEFAULT 0,
+    "active_users" INTEGER NOT NULL DEFAULT 0,
+    "active_subscriptions" INTEGER NOT NULL DEFAULT 0,
+    "monthly_recurring_revenue" DECIMAL(14,2) NOT NULL DEFAULT 0,
+    "monthly_rent_roll" DECIMAL(14,2) NOT NULL DEFAULT 0,
+    "rental_revenue" DECIMAL(14,2) NOT NULL DEFAULT 0,
+    "subscription_revenue" DECIMAL(14,2) NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "platform_analytics_snapshots_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "platform_analytics_snapshots_snapshot_date_key" ON "platform_analytics_snapshots"("snapshot_date");
@@ -0,0 +1,24 @@
+-- AlterTable
+ALTER TABLE "agencies" ADD COLUMN IF NOT EXISTS "suspended_at" TIMESTAMPTZ(6);
+ALTER TABLE "agencies" ADD COLUMN IF NOT EXISTS "suspension_reason" TEXT;
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "agency_status_changes" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "agency_id" UUID NOT NULL,
+    "from_status" VARCHAR(20) NOT NULL,
+    "to_status" VARCHAR(20) NOT NULL,
+    "reason" TEXT,
+    "changed_by" UUID,
+    "affected_users" JSONB NOT NULL DEFAULT '[]',
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "agency_status_changes_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "agency_status_changes_agency_id_created_at_idx" ON "agency_status_changes"("agency_id", "created_at");
+
+-- AddForeignKey
+ALTER TABLE "agency_status_changes" ADD CONSTRAINT "agency_status_changes_agency_id_fkey" FOREIGN KEY ("agency_id") REFERENCES "agencies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "agency_status_changes" ADD CONSTRAINT "agency_status_changes_changed_by_fkey" FOREIGN KEY ("changed_by") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE;
@@ -0,0 +1,18 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "agency_onboarding" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "agency_id" UUID NOT NULL,
+    "steps" JSONB NOT NULL DEFAULT '{}',
+    "completed_at" TIMESTAMPTZ(6),
+    "completed_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "agency_onboarding_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "agency_onboarding_agency_id_key" ON "agency_onboarding"("agency_id");
+
+-- AddForeignKey
+ALTER TABLE "agency_onboarding" ADD CONSTRAINT "agency_onboarding_agency_id_fkey" FOREIGN KEY ("agency_id") REFERENCES "agencies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
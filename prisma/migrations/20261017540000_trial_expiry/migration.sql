@@ -0,0 +1,10 @@
+-- AlterEnum
+ALTER TYPE "subscription_status" ADD VALUE IF NOT EXISTS 'expired';
+
+-- AlterTable
+ALTER TABLE "subscriptions" ADD COLUMN IF NOT EXISTS "payment_method_added_at" TIMESTAMPTZ(6);
+ALTER TABLE "subscriptions" ADD COLUMN IF NOT EXISTS "expired_at" TIMESTAMPTZ(6);
+ALTER TABLE "subscriptions" ADD COLUMN IF NOT EXISTS "trial_reminders_sent" JSONB NOT NULL DEFAULT '[]';
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "subscriptions_status_trial_end_date_idx" ON "subscriptions"("status", "trial_end_date");
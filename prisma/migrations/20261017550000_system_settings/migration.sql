@@ -0,0 +1,41 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "system_settings" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "key" VARCHAR(100) NOT NULL,
+    "value" TEXT NOT NULL,
+    "data_type" VARCHAR(20) NOT NULL DEFAULT 'string',
+    "category" VARCHAR(50) NOT NULL,
+    "description" TEXT,
+    "is_public" BOOLEAN NOT NULL DEFAULT false,
+    "updated_by" UUID,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "system_settings_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "system_setting_changes" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "setting_id" UUID,
+    "key" VARCHAR(100) NOT NULL,
+    "old_value" TEXT,
+    "new_value" TEXT,
+    "changed_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "system_setting_changes_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "system_settings_key_key" ON "system_settings"("key");
+CREATE INDEX IF NOT EXISTS "system_settings_category_idx" ON "system_settings"("category");
+CREATE INDEX IF NOT EXISTS "system_settings_key_idx" ON "system_settings"("key");
+CREATE INDEX IF NOT EXISTS "system_setting_changes_key_created_at_idx" ON "system_setting_changes"("key", "created_at");
+CREATE INDEX IF NOT EXISTS "system_setting_changes_created_at_idx" ON "system_setting_changes"("created_at");
+
+-- AddForeignKey
+ALTER TABLE "system_settings" DROP CONSTRAINT IF EXISTS "system_settings_updated_by_fkey";
+ALTER TABLE "system_settings" ADD CONSTRAINT "system_settings_updated_by_fkey" FOREIGN KEY ("updated_by") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+ALTER TABLE "system_setting_changes" ADD CONSTRAINT "system_setting_changes_setting_id_fkey" FOREIGN KEY ("setting_id") REFERENCES "system_settings"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+ALTER TABLE "system_setting_changes" ADD CONSTRAINT "system_setting_changes_changed_by_fkey" FOREIGN KEY ("changed_by") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE;
@@ -0,0 +1,32 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "property_delegations" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "property_id" UUID NOT NULL,
+    "landlord_id" UUID NOT NULL,
+    "agency_id" UUID NOT NULL,
+    "scope" VARCHAR(30) NOT NULL DEFAULT 'full_management',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+    "start_date" DATE NOT NULL,
+    "end_date" DATE,
+    "terms" TEXT,
+    "created_by" UUID NOT NULL,
+    "ended_at" TIMESTAMPTZ(6),
+    "ended_by" UUID,
+    "end_reason" TEXT,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "property_delegations_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "property_delegations_property_id_status_idx" ON "property_delegations"("property_id", "status");
+CREATE INDEX IF NOT EXISTS "property_delegations_agency_id_status_idx" ON "property_delegations"("agency_id", "status");
+CREATE INDEX IF NOT EXISTS "property_delegations_landlord_id_idx" ON "property_delegations"("landlord_id");
+CREATE INDEX IF NOT EXISTS "property_delegations_status_start_date_idx" ON "property_delegations"("status", "start_date");
+
+-- AddForeignKey
+ALTER TABLE "property_delegations" ADD CONSTRAINT "property_delegations_property_id_fkey" FOREIGN KEY ("property_id") REFERENCES "properties"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "property_delegations" ADD CONSTRAINT "property_delegations_landlord_id_fkey" FOREIGN KEY ("landlord_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "property_delegations" ADD CONSTRAINT "property_delegations_agency_id_fkey" FOREIGN KEY ("agency_id") REFERENCES "agencies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE "property_delegations" ADD CONSTRAINT "property_delegations_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE RESTRICT ON UPDATE CASCADE;
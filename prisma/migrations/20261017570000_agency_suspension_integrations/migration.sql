@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "agency_status_changes" ADD COLUMN IF NOT EXISTS "disabled_integrations" JSONB NOT NULL DEFAULT '[]';
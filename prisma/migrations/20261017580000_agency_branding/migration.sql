@@ -0,0 +1,24 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "agency_branding" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "agency_id" UUID NOT NULL,
+    "logo_url" VARCHAR(500),
+    "logo_file_id" VARCHAR(255),
+    "primary_color" VARCHAR(7),
+    "secondary_color" VARCHAR(7),
+    "sender_name" VARCHAR(100),
+    "sender_email" VARCHAR(255),
+    "sms_sender_name" VARCHAR(11),
+    "invoice_footer" TEXT,
+    "updated_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "agency_branding_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "agency_branding_agency_id_key" ON "agency_branding"("agency_id");
+
+-- AddForeignKey
+ALTER TABLE "agency_branding" ADD CONSTRAINT "agency_branding_agency_id_fkey" FOREIGN KEY ("agency_id") REFERENCES "agencies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
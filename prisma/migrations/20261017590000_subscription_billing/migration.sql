@@ -0,0 +1,9 @@
+-- AlterTable
+ALTER TABLE "billing_invoices" ADD COLUMN IF NOT EXISTS "attempt_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "billing_invoices" ADD COLUMN IF NOT EXISTS "last_attempt_at" TIMESTAMPTZ(6);
+ALTER TABLE "billing_invoices" ADD COLUMN IF NOT EXISTS "next_retry_at" TIMESTAMPTZ(6);
+ALTER TABLE "billing_invoices" ADD COLUMN IF NOT EXISTS "last_error" TEXT;
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "billing_invoices_status_next_retry_at_idx" ON "billing_invoices"("status", "next_retry_at");
+CREATE INDEX IF NOT EXISTS "billing_invoices_company_id_created_at_idx" ON "billing_invoices"("company_id", "created_at");
@@ -0,0 +1,21 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "agency_usage" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "agency_id" UUID NOT NULL,
+    "usage_date" DATE NOT NULL,
+    "api_calls" INTEGER NOT NULL DEFAULT 0,
+    "sms_sent" INTEGER NOT NULL DEFAULT 0,
+    "documents_generated" INTEGER NOT NULL DEFAULT 0,
+    "storage_bytes" BIGINT NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "agency_usage_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "agency_usage_agency_id_usage_date_key" ON "agency_usage"("agency_id", "usage_date");
+CREATE INDEX IF NOT EXISTS "agency_usage_usage_date_idx" ON "agency_usage"("usage_date");
+
+-- AddForeignKey
+ALTER TABLE "agency_usage" ADD CONSTRAINT "agency_usage_agency_id_fkey" FOREIGN KEY ("agency_id") REFERENCES "agencies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,27 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "system_logs" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "level" VARCHAR(10) NOT NULL,
+    "service" VARCHAR(100) NOT NULL,
+    "event" VARCHAR(50) NOT NULL,
+    "message" TEXT NOT NULL,
+    "method" VARCHAR(10),
+    "path" VARCHAR(255),
+    "status_code" INTEGER,
+    "duration_ms" INTEGER,
+    "user_id" UUID,
+    "user_email" VARCHAR(255),
+    "user_role" VARCHAR(30),
+    "company_id" UUID,
+    "ip_address" VARCHAR(45),
+    "metadata" JSONB NOT NULL DEFAULT '{}',
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "system_logs_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "system_logs_created_at_idx" ON "system_logs"("created_at");
+CREATE INDEX IF NOT EXISTS "system_logs_level_created_at_idx" ON "system_logs"("level", "created_at");
+CREATE INDEX IF NOT EXISTS "system_logs_service_created_at_idx" ON "system_logs"("service", "created_at");
+CREATE INDEX IF NOT EXISTS "system_logs_event_created_at_idx" ON "system_logs"("event", "created_at");
@@ -0,0 +1,37 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "retention_policies" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "key" VARCHAR(50) NOT NULL,
+    "retention_days" INTEGER NOT NULL,
+    "is_enabled" BOOLEAN NOT NULL DEFAULT true,
+    "last_run_at" TIMESTAMPTZ(6),
+    "last_affected" INTEGER,
+    "updated_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "retention_policies_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "retention_runs" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "policy_key" VARCHAR(50) NOT NULL,
+    "action" VARCHAR(20) NOT NULL,
+    "dry_run" BOOLEAN NOT NULL DEFAULT false,
+    "retention_days" INTEGER NOT NULL,
+    "cutoff" TIMESTAMPTZ(6) NOT NULL,
+    "affected" INTEGER NOT NULL DEFAULT 0,
+    "oldest_at" TIMESTAMPTZ(6),
+    "error" TEXT,
+    "triggered_by" UUID,
+    "started_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "finished_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "retention_runs_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "retention_policies_key_key" ON "retention_policies"("key");
+CREATE INDEX IF NOT EXISTS "retention_runs_policy_key_started_at_idx" ON "retention_runs"("policy_key", "started_at");
+CREATE INDEX IF NOT EXISTS "retention_runs_started_at_idx" ON "retention_runs"("started_at");
@@ -0,0 +1,27 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "data_erasure_requests" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "subject_id" UUID NOT NULL,
+    "company_id" UUID,
+    "mode" VARCHAR(20) NOT NULL DEFAULT 'anonymize',
+    "reason" TEXT NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "requested_by" UUID NOT NULL,
+    "requested_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "reviewed_by" UUID,
+    "reviewed_at" TIMESTAMPTZ(6),
+    "review_note" TEXT,
+    "completed_at" TIMESTAMPTZ(6),
+    "certificate" JSONB,
+    "certificate_hash" VARCHAR(64),
+    "error" TEXT,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "data_erasure_requests_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "data_erasure_requests_subject_id_idx" ON "data_erasure_requests"("subject_id");
+CREATE INDEX IF NOT EXISTS "data_erasure_requests_company_id_status_idx" ON "data_erasure_requests"("company_id", "status");
+CREATE INDEX IF NOT EXISTS "data_erasure_requests_status_requested_at_idx" ON "data_erasure_requests"("status", "requested_at");
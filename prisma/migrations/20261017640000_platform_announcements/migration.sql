@@ -0,0 +1,44 @@
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "platform_announcements" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "title" VARCHAR(200) NOT NULL,
+    "message" TEXT NOT NULL,
+    "type" VARCHAR(30) NOT NULL DEFAULT 'release_notes',
+    "severity" VARCHAR(20) NOT NULL DEFAULT 'info',
+    "target_plans" TEXT[] DEFAULT ARRAY[]::TEXT[],
+    "target_roles" TEXT[] DEFAULT ARRAY[]::TEXT[],
+    "target_regions" TEXT[] DEFAULT ARRAY[]::TEXT[],
+    "dismissible" BOOLEAN NOT NULL DEFAULT true,
+    "send_email" BOOLEAN NOT NULL DEFAULT false,
+    "action_url" VARCHAR(500),
+    "starts_at" TIMESTAMPTZ(6),
+    "ends_at" TIMESTAMPTZ(6),
+    "status" VARCHAR(20) NOT NULL DEFAULT 'draft',
+    "published_at" TIMESTAMPTZ(6),
+    "emailed_at" TIMESTAMPTZ(6),
+    "emailed_count" INTEGER NOT NULL DEFAULT 0,
+    "created_by" UUID NOT NULL,
+    "updated_by" UUID,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "platform_announcements_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "platform_announcement_dismissals" (
+    "id" UUID NOT NULL DEFAULT uuid_generate_v4(),
+    "announcement_id" UUID NOT NULL,
+    "user_id" UUID NOT NULL,
+    "dismissed_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "platform_announcement_dismissals_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "platform_announcements_status_starts_at_idx" ON "platform_announcements"("status", "starts_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "platform_announcement_dismissals_announcement_id_user_id_key" ON "platform_announcement_dismissals"("announcement_id", "user_id");
+CREATE INDEX IF NOT EXISTS "platform_announcement_dismissals_user_id_idx" ON "platform_announcement_dismissals"("user_id");
+
+-- AddForeignKey
+ALTER TABLE "platform_announcement_dismissals" ADD CONSTRAINT "platform_announcement_dismissals_announcement_id_fkey" FOREIGN KEY ("announcement_id") REFERENCES "platform_announcements"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,9 @@
+-- AlterTable
+ALTER TABLE "unit_applications" ADD COLUMN IF NOT EXISTS "manage_token_hash" VARCHAR(64);
+ALTER TABLE "property_waitlist_entries" ADD COLUMN IF NOT EXISTS "manage_token_hash" VARCHAR(64);
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "unit_applications_manage_token_hash_key" ON "unit_applications"("manage_token_hash");
+
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "property_waitlist_entries_manage_token_hash_key" ON "property_waitlist_entries"("manage_token_hash");
@@ -0,0 +1,4 @@
+-- Store calendar feed tokens as SHA-256 hashes; existing subscription URLs keep working
+UPDATE "users"
+SET "calendar_feed_token" = encode(sha256(convert_to("calendar_feed_token", 'UTF8')), 'hex')
+WHERE "calendar_feed_token" IS NOT NULL AND length("calendar_feed_token") = 48;
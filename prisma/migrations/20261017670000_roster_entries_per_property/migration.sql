@@ -0,0 +1,3 @@
+-- A staff member may be rostered on the same shift at more than one property
+DROP INDEX IF EXISTS "staff_roster_entries_staff_id_date_shift_id_key";
+CREATE UNIQUE INDEX IF NOT EXISTS "staff_roster_entries_staff_id_date_shift_id_property_id_key" ON "staff_roster_entries"("staff_id", "date", "shift_id", "property_id");
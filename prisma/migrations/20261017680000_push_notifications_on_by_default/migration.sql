@@ -0,0 +1,7 @@
+-- Push is on unless the user turns it off; registering a device no longer switches it on.
+ALTER TABLE "tenant_preferences" ALTER COLUMN "enable_push_notifications" SET DEFAULT true;
+
+-- Rows never changed since they were created still hold the old default rather than a choice
+UPDATE "tenant_preferences"
+SET "enable_push_notifications" = true
+WHERE "enable_push_notifications" = false AND "updated_at" = "created_at";
@@ -0,0 +1,2 @@
+-- Invoices settled from a security deposit get a payment row so the ledger reconciles
+ALTER TYPE "payment_method" ADD VALUE IF NOT EXISTS 'deposit_offset';
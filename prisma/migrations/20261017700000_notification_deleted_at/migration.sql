@@ -0,0 +1,17 @@
+-- When a notification was deleted for everyone or by its last participant; retention purges from here
+ALTER TABLE "notifications" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ(6);
+CREATE INDEX IF NOT EXISTS "notifications_deleted_at_idx" ON "notifications"("deleted_at");
+
+-- Rows already gone for everyone; their last change is the closest record of when
+UPDATE "notifications"
+SET "deleted_at" = "updated_at"
+WHERE "deleted_at" IS NULL
+  AND (
+    "deleted_for_everyone" = true
+    OR (
+      "deleted_by_users" IS NOT NULL
+      AND jsonb_typeof("deleted_by_users"::jsonb) = 'array'
+      AND "deleted_by_users"::jsonb ? "recipient_id"::text
+      AND ("sender_id" IS NULL OR "deleted_by_users"::jsonb ? "sender_id"::text)
+    )
+  );
@@ -12,6 +12,7 @@ import { env } from './config/env.js';
 import { errorHandler } from './utils/response.js';
 import routes from './routes/index.js';
 import { routeAliasMiddleware, deprecationWarningMiddleware } from './middleware/route-aliases.js';
+import { logRequests } from './middleware/request-log.js';
 import { supabaseRealtimeService } from './services/supabase-realtime.service.js';
 
 const __filename = fileURLToPath(import.meta.url);
@@ -60,6 +61,7 @@ app.use(cors({
 }));
 app.use(express.json({ limit: '2mb' }));
 app.use(morgan('dev'));
+app.use('/api/v1', logRequests); // Errors, slow requests and admin writes go to the system log
 
 // Route aliases for backward compatibility
 app.use('/api/v1', routeAliasMiddleware);
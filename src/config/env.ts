@@ -43,6 +43,64 @@ export const env = {
 		fromAddress: process.env.EMAIL_FROM_ADDRESS || 'noreply@letrents.com',
 		fromName: process.env.EMAIL_FROM_NAME || 'LetRents',
 	},
+	ocr: {
+		// OpenAI-compatible vision endpoint used to read ID documents for KYC
+		apiUrl: process.env.OCR_API_URL || 'https://api.openai.com/v1/chat/completions',
+		apiKey: process.env.OCR_API_KEY || '',
+		model: process.env.OCR_MODEL || 'gpt-4o-mini',
+	},
+	maps: {
+		// Google Distance Matrix for road travel times in caretaker routes; straight-line estimates without it
+		distanceMatrixUrl: process.env.DISTANCE_MATRIX_URL || 'https://maps.googleapis.com/maps/api/distancematrix/json',
+		apiKey: process.env.GOOGLE_MAPS_API_KEY || '',
+	},
+	realtime: {
+		// Supabase project JWT secret; when set, clients get per-user realtime tokens limited to their own channels
+		jwtSecret: process.env.SUPABASE_JWT_SECRET || '',
+		// Publish on private channels so the realtime.messages policy is enforced for subscribers
+		privateChannels: (process.env.SUPABASE_REALTIME_PRIVATE ?? 'false') === 'true',
+		tokenTtlMinutes: Number(process.env.REALTIME_TOKEN_TTL_MINUTES || 15),
+	},
+	sms: {
+		provider: process.env.SMS_PROVIDER || '', // 'africastalking' or 'twilio'; empty disables SMS
+		// Shared secret expected as ?token= on delivery report callbacks
+		callbackToken: process.env.SMS_CALLBACK_TOKEN || '',
+		defaultSenderId: process.env.SMS_SENDER_ID || '',
+		africastalking: {
+			username: process.env.AFRICASTALKING_USERNAME || '',
+			apiKey: process.env.AFRICASTALKING_API_KEY || '',
+		},
+		twilio: {
+			accountSid: process.env.TWILIO_ACCOUNT_SID || '',
+			authToken: process.env.TWILIO_AUTH_TOKEN || '',
+			fromNumber: process.env.TWILIO_FROM_NUMBER || '',
+			messagingServiceSid: process.env.TWILIO_MESSAGING_SERVICE_SID || '',
+		},
+	},
+	attachments: {
+		// Antivirus for uploaded message attachments: 'clamav' (clamd over TCP) or empty to skip scanning
+		scanner: process.env.ATTACHMENT_SCANNER || '',
+		clamavHost: process.env.CLAMAV_HOST || '127.0.0.1',
+		clamavPort: Number(process.env.CLAMAV_PORT || 3310),
+		// Reject uploads when the scanner is configured but unreachable
+		failClosed: (process.env.ATTACHMENT_SCAN_FAIL_CLOSED ?? 'true') === 'true',
+	},
+	inboundEmail: {
+		// Conversation reply addresses are reply+<token>@<domain>; MX for the domain points at Mailgun or SES
+		domain: process.env.INBOUND_EMAIL_DOMAIN || '',
+		mailgunSigningKey: process.env.MAILGUN_WEBHOOK_SIGNING_KEY || '',
+		// SNS topic the SES receipt rule publishes to; other topics are ignored
+		sesTopicArn: process.env.SES_INBOUND_TOPIC_ARN || '',
+	},
+	translation: {
+		// On-demand message translation: 'ai' (OpenAI-compatible chat model), 'google' (Cloud Translation) or empty to disable
+		provider: process.env.TRANSLATION_PROVIDER || '',
+		apiUrl: process.env.TRANSLATION_API_URL || 'https://api.openai.com/v1/chat/completions',
+		// Falls back to the OCR key, which points at the same kind of endpoint
+		apiKey: process.env.TRANSLATION_API_KEY || process.env.OCR_API_KEY || '',
+		model: process.env.TRANSLATION_MODEL || 'gpt-4o-mini',
+		googleApiKey: process.env.GOOGLE_TRANSLATE_API_KEY || '',
+	},
 	slack: {
 		devSignupWebhookUrl: process.env.SLACK_DEV_SIGNUP_WEBHOOK_URL || '',
 		prodSignupWebhookUrl: process.env.SLACK_PROD_SIGNUP_WEBHOOK_URL || '',
@@ -1,7 +1,14 @@
 import { PrismaClient } from '@prisma/client';
+import { invalidateAnalyticsCache } from '../utils/analytics-cache.js';
+import { currentTenancyScope, runScoped, tenancyExtension } from '../utils/tenancy-scope.js';
+import type { JWTClaims } from '../types/index.js';
 
 let prisma: PrismaClient | null = null;
 
+// Writes that change dashboard and revenue figures
+const ANALYTICS_MODELS = ['Payment', 'Unit'];
+const WRITE_OPERATIONS = ['create', 'createMany', 'update', 'updateMany', 'upsert', 'delete', 'deleteMany'];
+
 export const getPrisma = (): PrismaClient => {
 	if (!prisma) {
 		// Get DATABASE_URL and add connection pool parameters if not present
@@ -16,7 +23,7 @@ export const getPrisma = (): PrismaClient => {
 			connectionUrl = `${connectionUrl}${separator}connection_limit=20&pool_timeout=30`;
 		}
 		
-		prisma = new PrismaClient({
+		const client = new PrismaClient({
 			log: process.env.NODE_ENV === 'development' ? ['query', 'error', 'warn'] : ['error'],
 			// Disable schema validation to prevent runtime introspection issues
 			// The schema is validated at build time via prisma generate
@@ -26,10 +33,40 @@ export const getPrisma = (): PrismaClient => {
 				},
 			},
 		});
+		// Queries made while handling a request are held to the caller's tenancy scope (see
+		// utils/tenancy-scope), except writes a service makes through runAsSystem. Drop cached
+		// analytics when payments or unit statuses change; single-row writes return the row, so only
+		// its company's entries go
+		prisma = client.$extends({
+			query: {
+				$allModels: {
+					async $allOperations({ model, operation, args, query }) {
+						const scope = currentTenancyScope();
+						const result = scope ? await runScoped(client, scope, model, operation, args, query) : await query(args);
+						if (ANALYTICS_MODELS.includes(model) && WRITE_OPERATIONS.includes(operation)) {
+							invalidateAnalyticsCache((result as any)?.company_id);
+						}
+						return result;
+					},
+				},
+			},
+		}) as unknown as PrismaClient;
 		// Force connection to validate schema
-		prisma.$connect().catch((e) => {
+		client.$connect().catch((e) => {
 			console.error('Prisma connection error:', e);
 		});
 	}
 	return prisma;
 };
+
+/**
+ * The client narrowed to what the caller may touch: queries on agency-scoped models (properties,
+ * units, leases, maintenance, invoices, payments, tenants, delegations, agency settings) carry the
+ * caller's agency_id or ownership filter, and writes into another agency throw. Super admins get
+ * the plain client. Inside an authenticated request the shared client already does this; this is
+ * for work done for a user outside one.
+ */
+export const getScopedPrisma = (user: JWTClaims): PrismaClient => {
+	if (user.role === 'super_admin') return getPrisma();
+	return getPrisma().$extends(tenancyExtension(user)) as unknown as PrismaClient;
+};
@@ -0,0 +1,51 @@
+import { Request, Response } from 'express';
+import { accountExportsService } from '../services/account-exports.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+// Background build: returns at once; poll the export for its signed download_url
+export const requestAccountExport = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const exportJob = await accountExportsService.request(req.body || {}, user);
+    writeSuccess(res, 202, 'Account export queued', exportJob);
+  } catch (error: any) {
+    const message = error.message || 'Failed to queue account export';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const listAccountExports = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const exports = await accountExportsService.list(user, Number(req.query.limit) || 20);
+    writeSuccess(res, 200, 'Account exports retrieved successfully', exports);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve account exports';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getAccountExport = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const exportJob = await accountExportsService.get(req.params.id as string, user);
+    writeSuccess(res, 200, 'Account export retrieved successfully', exportJob);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve account export';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const issueAccountExportLink = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const expiresIn = req.body?.expires_in ?? req.query.expires_in;
+    const link = await accountExportsService.issueLink(req.params.id as string, user, expiresIn === undefined ? undefined : Number(expiresIn));
+    writeSuccess(res, 200, 'Download link issued', link);
+  } catch (error: any) {
+    const message = error.message || 'Failed to issue download link';
+    writeError(res, statusFor(message), message);
+  }
+};
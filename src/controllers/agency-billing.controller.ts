@@ -0,0 +1,59 @@
+import { Request, Response } from 'express';
+import { subscriptionBillingService } from '../services/subscription-billing.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const getBillingOverview = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const overview = await subscriptionBillingService.getOverview(user);
+    writeSuccess(res, 200, 'Billing overview retrieved successfully', overview);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve billing overview';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const listInvoices = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await subscriptionBillingService.listForCompany(user, {
+      status: req.query.status as string | undefined,
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+      limit: parseInt(req.query.limit as string) || undefined,
+      offset: parseInt(req.query.offset as string) || undefined,
+    });
+    writeSuccess(res, 200, 'Billing invoices retrieved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve billing invoices';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getInvoice = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const invoice = await subscriptionBillingService.getForCompany(user, req.params.id);
+    writeSuccess(res, 200, 'Billing invoice retrieved successfully', invoice);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve billing invoice';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const payInvoice = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await subscriptionBillingService.payForCompany(user, req.params.id);
+    const message = result.status === 'paid' ? 'Invoice paid successfully'
+      : result.status === 'processing' ? 'Payment started; approve it on your phone'
+      : `Payment failed: ${result.message}`;
+    writeSuccess(res, 200, message, result);
+  } catch (error: any) {
+    console.error('Error paying billing invoice:', error);
+    const message = error.message || 'Failed to pay billing invoice';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -0,0 +1,68 @@
+import { Request, Response, NextFunction } from 'express';
+import multer from 'multer';
+import { agencyBrandingService, LOGO_MAX_BYTES } from '../services/agency-branding.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+// Super admins name the agency with ?agency_id=; agency admins brand their own
+const agencyIdFrom = (req: Request) => (req.query.agency_id as string | undefined) || req.body?.agency_id;
+
+// The service checks the type and size too; the limit here stops oversized uploads early
+const upload = multer({
+  storage: multer.memoryStorage(),
+  limits: { fileSize: LOGO_MAX_BYTES },
+});
+
+export const logoUploadMiddleware = (req: Request, res: Response, next: NextFunction) =>
+  upload.single('logo')(req, res, (error: any) => {
+    if (error) {
+      return writeError(res, 400, error.code === 'LIMIT_FILE_SIZE' ? 'logo must be at most 2 MB' : error.message);
+    }
+    next();
+  });
+
+export const getBranding = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const branding = await agencyBrandingService.get(user, agencyIdFrom(req));
+    writeSuccess(res, 200, 'Agency branding retrieved successfully', branding);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve agency branding';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updateBranding = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const branding = await agencyBrandingService.update(user, agencyIdFrom(req), req.body || {});
+    writeSuccess(res, 200, 'Agency branding updated successfully', branding);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update agency branding';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const uploadLogo = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const branding = await agencyBrandingService.uploadLogo(user, agencyIdFrom(req), req.file);
+    writeSuccess(res, 200, 'Logo uploaded successfully', branding);
+  } catch (error: any) {
+    console.error('Error uploading agency logo:', error);
+    const message = error.message || 'Failed to upload logo';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const removeLogo = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const branding = await agencyBrandingService.removeLogo(user, agencyIdFrom(req));
+    writeSuccess(res, 200, 'Logo removed successfully', branding);
+  } catch (error: any) {
+    const message = error.message || 'Failed to remove logo';
+    writeError(res, statusFor(message), message);
+  }
+};
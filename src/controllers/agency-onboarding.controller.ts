@@ -0,0 +1,96 @@
+import { Request, Response } from 'express';
+import { agencyOnboardingService } from '../services/agency-onboarding.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+// Super admins name the agency with ?agency_id= (or in the body); agency admins onboard their own
+const agencyIdFrom = (req: Request) => (req.query.agency_id as string | undefined) || req.body?.agency_id;
+
+export const getOnboardingStatus = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const status = await agencyOnboardingService.getStatus(user, agencyIdFrom(req));
+    writeSuccess(res, 200, 'Onboarding status retrieved successfully', status);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve onboarding status';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const saveCompanyProfile = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const status = await agencyOnboardingService.saveCompanyProfile(user, agencyIdFrom(req), req.body || {});
+    writeSuccess(res, 200, 'Company profile saved successfully', status);
+  } catch (error: any) {
+    const message = error.message || 'Failed to save company profile';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const saveBranding = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const status = await agencyOnboardingService.saveBranding(user, agencyIdFrom(req), req.body || {});
+    writeSuccess(res, 200, 'Branding saved successfully', status);
+  } catch (error: any) {
+    const message = error.message || 'Failed to save branding';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const saveBilling = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const status = await agencyOnboardingService.saveBilling(user, agencyIdFrom(req), req.body || {});
+    writeSuccess(res, 200, 'Billing details saved successfully', status);
+  } catch (error: any) {
+    const message = error.message || 'Failed to save billing details';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const inviteAdmin = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await agencyOnboardingService.inviteAdmin(user, agencyIdFrom(req), req.body || {});
+    writeSuccess(res, 201, result.invitation_sent ? 'Agency admin invited successfully' : 'Agency admin created; the invitation email could not be sent', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to invite agency admin';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const importProperties = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await agencyOnboardingService.importProperties(user, agencyIdFrom(req), req.body?.properties);
+    writeSuccess(res, 200, `Imported ${result.created.length} of ${result.created.length + result.failed.length} properties`, result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to import properties';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const skipStep = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const status = await agencyOnboardingService.skipStep(user, agencyIdFrom(req), req.params.step as string);
+    writeSuccess(res, 200, 'Onboarding step skipped', status);
+  } catch (error: any) {
+    const message = error.message || 'Failed to skip onboarding step';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const completeOnboarding = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const status = await agencyOnboardingService.complete(user, agencyIdFrom(req));
+    writeSuccess(res, 200, 'Agency onboarding completed', status);
+  } catch (error: any) {
+    const message = error.message || 'Failed to complete onboarding';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -0,0 +1,123 @@
+import { Request, Response } from 'express';
+import { agencyStaffService } from '../services/agency-staff.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+// Super admins name the agency with ?agency_id=; agency admins manage their own
+const agencyIdFrom = (req: Request) => (req.query.agency_id as string | undefined) || req.body?.agency_id;
+
+export const listStaff = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const staff = await agencyStaffService.list(user, agencyIdFrom(req), {
+      role: req.query.role as string | undefined,
+      status: req.query.status as string | undefined,
+      search: req.query.search as string | undefined,
+    });
+    writeSuccess(res, 200, 'Agency staff retrieved successfully', staff);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve agency staff';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getStaffMember = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const member = await agencyStaffService.get(user, agencyIdFrom(req), req.params.id);
+    writeSuccess(res, 200, 'Staff member retrieved successfully', member);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve staff member';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const createStaffMember = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const member = await agencyStaffService.create(user, agencyIdFrom(req), req.body || {});
+    writeSuccess(res, 201, 'Staff member created successfully', member);
+  } catch (error: any) {
+    const message = error.message || 'Failed to create staff member';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const changeStaffRole = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const member = await agencyStaffService.changeRole(user, agencyIdFrom(req), req.params.id, req.body?.role);
+    writeSuccess(res, 200, 'Staff role updated successfully', member);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update staff role';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const setStaffPortfolio = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const portfolio = await agencyStaffService.setPortfolio(user, agencyIdFrom(req), req.params.id, req.body?.property_ids);
+    writeSuccess(res, 200, 'Portfolio updated successfully', portfolio);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update portfolio';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const addPortfolioProperty = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const portfolio = await agencyStaffService.addToPortfolio(user, agencyIdFrom(req), req.params.id, req.params.propertyId);
+    writeSuccess(res, 200, 'Property added to portfolio', portfolio);
+  } catch (error: any) {
+    const message = error.message || 'Failed to add property to portfolio';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const removePortfolioProperty = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const portfolio = await agencyStaffService.removeFromPortfolio(user, agencyIdFrom(req), req.params.id, req.params.propertyId);
+    writeSuccess(res, 200, 'Property removed from portfolio', portfolio);
+  } catch (error: any) {
+    const message = error.message || 'Failed to remove property from portfolio';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const deactivateStaffMember = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const member = await agencyStaffService.deactivate(user, agencyIdFrom(req), req.params.id, req.body?.reason);
+    writeSuccess(res, 200, 'Staff member deactivated successfully', member);
+  } catch (error: any) {
+    const message = error.message || 'Failed to deactivate staff member';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const reactivateStaffMember = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const member = await agencyStaffService.reactivate(user, agencyIdFrom(req), req.params.id);
+    writeSuccess(res, 200, 'Staff member reactivated successfully', member);
+  } catch (error: any) {
+    const message = error.message || 'Failed to reactivate staff member';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getStaffActivity = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const days = parseInt(req.query.days as string) || undefined;
+    const activity = await agencyStaffService.getActivity(user, agencyIdFrom(req), req.params.id, days);
+    writeSuccess(res, 200, 'Staff activity retrieved successfully', activity);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve staff activity';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -0,0 +1,20 @@
+import { Request, Response } from 'express';
+import { usageMeteringService } from '../services/usage-metering.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const getUsage = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    // Super admins name the agency with ?agency_id=; agency admins see their own
+    const usage = await usageMeteringService.getUsage(user, req.query.agency_id as string | undefined, {
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+    });
+    writeSuccess(res, 200, 'Agency usage retrieved successfully', usage);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve agency usage';
+    writeError(res, statusFor(message), message);
+  }
+};
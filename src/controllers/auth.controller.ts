@@ -1,6 +1,7 @@
 import { Request, Response } from 'express';
 import { AuthService } from '../services/auth.service.js';
 import { getPrisma } from '../config/prisma.js';
+import { systemLogsService } from '../services/system-logs.service.js';
 
 const service = new AuthService();
 const prisma = getPrisma();
@@ -29,6 +30,15 @@ export const login = async (req: Request, res: Response) => {
 		const ip = req.headers['x-forwarded-for']?.toString().split(',')[0] || req.ip;
 		const ua = req.headers['user-agent'] || '';
 		const result = await service.login({ email, password, remember_me, device_info }, ip, ua);
+		void systemLogsService.record({
+			level: 'info',
+			service: 'auth',
+			event: 'login',
+			message: `${result.user.email} signed in`,
+			user: { user_id: result.user.id, email: result.user.email, role: result.user.role, company_id: result.user.company_id || undefined },
+			ip_address: ip,
+			metadata: { user_agent: ua },
+		});
 		return res.status(200).json({ success: true, message: 'Login successful', data: result });
 	} catch (err: any) {
 		const msg = err?.message || 'An error occurred during authentication';
@@ -39,6 +49,17 @@ export const login = async (req: Request, res: Response) => {
 			'user account is not verified': 403,
 		};
 		const status = map[msg] || 500;
+		if (map[msg]) {
+			void systemLogsService.record({
+				level: 'warn',
+				service: 'auth',
+				event: 'login_failed',
+				message: `Failed sign-in for ${req.body?.email || 'unknown email'}: ${msg}`,
+				user_email: typeof req.body?.email === 'string' ? req.body.email : null,
+				ip_address: req.headers['x-forwarded-for']?.toString().split(',')[0] || req.ip,
+				metadata: { reason: msg, user_agent: req.headers['user-agent'] || '' },
+			});
+		}
 		return res.status(status).json({ success: false, message: msg });
 	}
 };
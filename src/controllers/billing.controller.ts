@@ -5,6 +5,8 @@ import { writeSuccess, writeError } from '../utils/response.js';
 import crypto from 'crypto';
 import { emailService } from '../services/email.service.js';
 import { getPrisma } from '../config/prisma.js';
+import { planLimitsService } from '../services/plan-limits.service.js';
+import { trialsService } from '../services/trials.service.js';
 
 const service = new PaystackService();
 const prisma = getPrisma();
@@ -127,6 +129,62 @@ export const getCompanySubscription = async (req: Request, res: Response) => {
   }
 };
 
+// Usage against the plan's limits; super admins can ask for any agency_id or company_id
+export const getPlanUsage = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const usage = await planLimitsService.getUsageFor(user, {
+      agency_id: req.query.agency_id as string | undefined,
+      company_id: req.query.company_id as string | undefined,
+    });
+    writeSuccess(res, 200, 'Plan usage retrieved successfully', usage);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve plan usage';
+    const status = message.includes('permissions') ? 403 :
+                  message.includes('not found') ? 404 :
+                  message.includes('required') ? 400 : 500;
+    writeError(res, status, message);
+  }
+};
+
+// Trial days left, payment method on file and whether the account is read-only
+export const getTrialStatus = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const status = await trialsService.getTrialStatus(user);
+    writeSuccess(res, 200, 'Trial status retrieved successfully', status);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve trial status';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('must belong') ? 403 : 500;
+    writeError(res, status, message);
+  }
+};
+
+// Record a payment method from a verified Paystack charge; reactivates an expired trial
+export const addPaymentMethod = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { reference } = req.body;
+
+    if (!reference) {
+      return writeError(res, 400, 'Payment reference is required');
+    }
+    if (!user.company_id) {
+      return writeError(res, 403, 'User must belong to a company');
+    }
+
+    const details = await service.verifyPaymentMethod(reference);
+    const result = await trialsService.recordPaymentMethod(user.company_id, details);
+    writeSuccess(res, 200, result.reactivated ? 'Payment method added and subscription reactivated' : 'Payment method added successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to add payment method';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('verification failed') || message.includes('cannot be charged') ? 400 : 500;
+    writeError(res, status, message);
+  }
+};
+
 export const cancelSubscription = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
@@ -399,6 +457,23 @@ export const verifySubscription = async (req: Request, res: Response) => {
       return writeError(res, 400, `Payment not successful. Status: ${transaction.status}. ${transaction.gateway_response || ''}`);
     }
 
+    // A reusable authorization is the company's payment method; it converts a trial and lifts an expiry
+    if (transaction.authorization?.reusable) {
+      try {
+        await trialsService.recordPaymentMethod(user.company_id, {
+          channel: transaction.authorization.channel,
+          brand: transaction.authorization.brand,
+          last4: transaction.authorization.last4,
+          reference,
+          authorization_code: transaction.authorization.authorization_code,
+          email: transaction.customer?.email,
+        });
+      } catch (error: any) {
+        // New registrations have no subscription yet; it is created below
+        console.warn('⚠️ Could not record payment method:', error.message);
+      }
+    }
+
     // Check if this transaction is for a subscription
     const metadata = transaction.metadata || {};
     // Try multiple ways to get plan code: metadata, transaction plan, or authorization
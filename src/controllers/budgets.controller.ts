@@ -0,0 +1,50 @@
+import { Request, Response } from 'express';
+import { budgetsService, BUDGET_KINDS, INCOME_CATEGORIES } from '../services/budgets.service.js';
+import { EXPENSE_CATEGORIES } from '../services/expenses.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const listBudgets = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await budgetsService.list(user, {
+      year: Number(req.query.year) || undefined,
+      property_id: req.query.property_id as string,
+    });
+    writeSuccess(res, 200, 'Budgets retrieved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve budgets';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getBudgetOptions = async (req: Request, res: Response) => {
+  writeSuccess(res, 200, 'Budget options retrieved successfully', {
+    kinds: BUDGET_KINDS,
+    income_categories: INCOME_CATEGORIES,
+    expense_categories: EXPENSE_CATEGORIES,
+  });
+};
+
+export const setPropertyBudget = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await budgetsService.setBudget(req.params.propertyId as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Budget saved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to save budget';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const deleteBudgetLine = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await budgetsService.deleteLine(req.params.id as string, user);
+    writeSuccess(res, 200, 'Budget line deleted successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to delete budget line';
+    writeError(res, statusFor(message), message);
+  }
+};
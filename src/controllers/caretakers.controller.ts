@@ -2,6 +2,18 @@ import { Request, Response } from 'express';
 import { careteakersService, staffService } from '../services/staff.service.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 import { JWTClaims } from '../types/index.js';
+import { caretakerAssignmentService } from '../services/caretaker-assignment.service.js';
+import { staffRosterService } from '../services/staff-roster.service.js';
+import { caretakerPerformanceService } from '../services/caretaker-performance.service.js';
+import { caretakerPayrollService } from '../services/caretaker-payroll.service.js';
+import { caretakerRouteService } from '../services/caretaker-route.service.js';
+import { EXCEL_CONTENT_TYPE, EXCEL_FILE_EXTENSION } from '../utils/excel-export.js';
+
+const assignmentStatusFor = (message: string) =>
+  message.includes('not found') ? 404 :
+  message.includes('permission') ? 403 :
+  message.includes('conflict') || message.includes('already') ? 409 :
+  message.includes('required') || message.includes('must be') ? 400 : 500;
 
 export const careteakersController = {
   getCaretakers: async (req: Request, res: Response) => {
@@ -44,8 +56,13 @@ export const careteakersController = {
       if (!caretaker) {
         return writeError(res, 404, 'Caretaker not found');
       }
+
+      const performance_metrics = await caretakerPerformanceService.getMetrics(
+        id,
+        caretakerPerformanceService.resolvePeriod(req.query as Record<string, string>),
+      );
       
-      writeSuccess(res, 200, 'Caretaker retrieved successfully', caretaker);
+      writeSuccess(res, 200, 'Caretaker retrieved successfully', { ...caretaker, performance_metrics });
     } catch (error: any) {
       writeError(res, 500, error.message);
     }
@@ -95,4 +112,275 @@ export const careteakersController = {
       writeError(res, 500, error.message);
     }
   },
+
+  getAssignmentSuggestions: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const suggestions = await caretakerAssignmentService.getSuggestions({
+        property_id: req.query.property_id as string,
+        category: req.query.category as string,
+        date: req.query.date as string,
+      }, user);
+      writeSuccess(res, 200, 'Caretaker suggestions retrieved successfully', suggestions);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get caretaker suggestions';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getAutoAssignmentSettings: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const settings = await caretakerAssignmentService.getSettings(user);
+      writeSuccess(res, 200, 'Auto-assignment settings retrieved successfully', settings);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get auto-assignment settings';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  updateAutoAssignmentSettings: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const settings = await caretakerAssignmentService.updateSettings(req.body || {}, user);
+      writeSuccess(res, 200, 'Auto-assignment settings updated successfully', settings);
+    } catch (error: any) {
+      const message = error.message || 'Failed to update auto-assignment settings';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getPerformance: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const performance = await caretakerPerformanceService.getCaretakerPerformance(req.params.id, req.query as Record<string, string>, user);
+      writeSuccess(res, 200, 'Caretaker performance retrieved successfully', performance);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get caretaker performance';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getPerformanceLeaderboard: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const leaderboard = await caretakerPerformanceService.getLeaderboard(req.query as Record<string, string>, user);
+      writeSuccess(res, 200, 'Caretaker performance retrieved successfully', leaderboard);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get caretaker performance';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getRoute: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const query = { ...(req.query as Record<string, string>), ...(req.params.id ? { staff_id: req.params.id } : {}) };
+      const route = await caretakerRouteService.getDailyRoute(query, user);
+      writeSuccess(res, 200, 'Route retrieved successfully', route);
+    } catch (error: any) {
+      const message = error.message || 'Failed to plan route';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getPayroll: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const query = req.query as Record<string, string>;
+      const format = query.format || 'json';
+      if (format === 'json') {
+        const payroll = await caretakerPayrollService.getPayroll(query, user);
+        return writeSuccess(res, 200, 'Payroll retrieved successfully', payroll);
+      }
+
+      const exportData = await caretakerPayrollService.exportPayroll(query, format, user);
+      const isExcel = ['xlsx', 'excel'].includes(format);
+      const filename = `payroll_${query.month || 'last-month'}.${isExcel ? EXCEL_FILE_EXTENSION : 'csv'}`;
+      res.setHeader('Content-Disposition', `attachment; filename="${filename}"`);
+      res.setHeader('Content-Type', isExcel ? EXCEL_CONTENT_TYPE : 'text/csv');
+      return res.send(exportData);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get payroll';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getPayrollSettings: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const settings = await caretakerPayrollService.getPayrollSettings(user);
+      writeSuccess(res, 200, 'Payroll settings retrieved successfully', settings);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get payroll settings';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  updatePayrollSettings: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const settings = await caretakerPayrollService.updatePayrollSettings(req.body || {}, user);
+      writeSuccess(res, 200, 'Payroll settings updated successfully', settings);
+    } catch (error: any) {
+      const message = error.message || 'Failed to update payroll settings';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getPayslip: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const month = req.query.month as string | undefined;
+      const pdf = await caretakerPayrollService.getPayslipPdf(req.params.id, month, user);
+      res.setHeader('Content-Type', 'application/pdf');
+      res.setHeader('Content-Disposition', `attachment; filename="payslip_${req.params.id}_${month || 'last-month'}.pdf"`);
+      res.status(200).send(pdf);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate payslip';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getAvailability: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const availability = await staffRosterService.getAvailability({
+        date: req.query.date as string,
+        property_id: req.query.property_id as string,
+      }, user);
+      writeSuccess(res, 200, 'Caretaker availability retrieved successfully', availability);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get caretaker availability';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getShifts: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const shifts = await staffRosterService.listShifts(user, req.query.include_inactive === 'true');
+      writeSuccess(res, 200, 'Shifts retrieved successfully', shifts);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get shifts';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  createShift: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const shift = await staffRosterService.createShift(req.body || {}, user);
+      writeSuccess(res, 201, 'Shift created successfully', shift);
+    } catch (error: any) {
+      const message = error.message || 'Failed to create shift';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  updateShift: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const shift = await staffRosterService.updateShift(req.params.shiftId as string, req.body || {}, user);
+      writeSuccess(res, 200, 'Shift updated successfully', shift);
+    } catch (error: any) {
+      const message = error.message || 'Failed to update shift';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  deleteShift: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await staffRosterService.deleteShift(req.params.shiftId as string, user);
+      writeSuccess(res, 200, result.deleted ? 'Shift deleted successfully' : 'Shift is on upcoming rosters and has been deactivated', result);
+    } catch (error: any) {
+      const message = error.message || 'Failed to delete shift';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getRoster: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const roster = await staffRosterService.getRoster({
+        property_id: req.query.property_id as string,
+        staff_id: req.query.staff_id as string,
+        week_start: req.query.week_start as string,
+      }, user);
+      writeSuccess(res, 200, 'Roster retrieved successfully', roster);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get roster';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  saveRoster: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const roster = await staffRosterService.saveRosterWeek(req.body || {}, user);
+      writeSuccess(res, 200, 'Roster saved successfully', roster);
+    } catch (error: any) {
+      const message = error.message || 'Failed to save roster';
+      if (error.conflicts) {
+        return res.status(409).json({ success: false, message, data: { conflicts: error.conflicts } });
+      }
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  getLeave: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const leave = await staffRosterService.listLeave(req.query as Record<string, string>, user);
+      writeSuccess(res, 200, 'Leave retrieved successfully', leave);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get leave';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  requestLeave: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const leave = await staffRosterService.requestLeave(req.body || {}, user);
+      writeSuccess(res, 201, leave.status === 'approved' ? 'Leave recorded successfully' : 'Leave requested successfully', leave);
+    } catch (error: any) {
+      const message = error.message || 'Failed to request leave';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  decideLeave: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const leave = await staffRosterService.decideLeave(req.params.leaveId as string, req.body || {}, user);
+      writeSuccess(res, 200, `Leave ${leave.status}`, leave);
+    } catch (error: any) {
+      const message = error.message || 'Failed to decide leave request';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  cancelLeave: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const leave = await staffRosterService.cancelLeave(req.params.leaveId as string, user);
+      writeSuccess(res, 200, 'Leave cancelled', leave);
+    } catch (error: any) {
+      const message = error.message || 'Failed to cancel leave';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
+
+  updateOffDays: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await staffRosterService.updateOffDays(req.params.id as string, req.body?.off_days ?? [], user);
+      writeSuccess(res, 200, 'Off days updated successfully', result);
+    } catch (error: any) {
+      const message = error.message || 'Failed to update off days';
+      writeError(res, assignmentStatusFor(message), message);
+    }
+  },
 };
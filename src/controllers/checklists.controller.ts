@@ -4,6 +4,7 @@
 
 import { Request, Response } from 'express';
 import { ChecklistsService } from '../services/checklists.service.js';
+import { inspectionVersionsService } from '../services/inspection-versions.service.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 import { JWTClaims } from '../types/index.js';
 
@@ -78,7 +79,7 @@ export class ChecklistsController {
       writeSuccess(res, 200, 'Template updated successfully', template);
     } catch (error: any) {
       console.error('❌ Error updating template:', error);
-      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('permissions') ? 403 : 400;
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('permissions') ? 403 : error.message.includes('already used') ? 409 : 400;
       writeError(res, statusCode, error.message || 'Failed to update template');
     }
   };
@@ -99,6 +100,22 @@ export class ChecklistsController {
     }
   };
 
+  /**
+   * POST /api/v1/checklists/templates/:id/duplicate
+   * Copy a template so it can be edited without affecting past inspections
+   */
+  duplicateTemplate = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const template = await checklistsService.duplicateTemplate(req.params.id, req.body || {}, user);
+      writeSuccess(res, 201, 'Template duplicated successfully', template);
+    } catch (error: any) {
+      console.error('❌ Error duplicating template:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('permissions') ? 403 : 400;
+      writeError(res, statusCode, error.message || 'Failed to duplicate template');
+    }
+  };
+
   // ============================================================================
   // INSPECTION ENDPOINTS
   // ============================================================================
@@ -202,7 +219,7 @@ export class ChecklistsController {
       writeSuccess(res, 200, 'Inspection item recorded successfully', item);
     } catch (error: any) {
       console.error('❌ Error recording inspection item:', error);
-      const statusCode = error.message.includes('not found') ? 404 : 400;
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('already') ? 409 : 400;
       writeError(res, statusCode, error.message || 'Failed to record inspection item');
     }
   };
@@ -222,5 +239,191 @@ export class ChecklistsController {
       writeError(res, statusCode, error.message || 'Failed to upload photo');
     }
   };
-}
 
+  // ============================================================================
+  // INSPECTION REPORT ENDPOINTS
+  // ============================================================================
+
+  /**
+   * POST /api/v1/checklists/inspections/:id/report
+   * Regenerate the stored PDF report of a completed inspection
+   */
+  generateInspectionReport = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const report = await checklistsService.generateReport(req.params.id, user);
+      writeSuccess(res, 200, 'Inspection report generated successfully', report);
+    } catch (error: any) {
+      console.error('❌ Error generating inspection report:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('only available') ? 409 : 500;
+      writeError(res, statusCode, error.message || 'Failed to generate inspection report');
+    }
+  };
+
+  /**
+   * GET /api/v1/checklists/inspections/:id/report
+   * Download the PDF report of a completed inspection
+   */
+  downloadInspectionReport = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const { pdf, filename } = await checklistsService.getReportPdf(req.params.id, user);
+      res.setHeader('Content-Type', 'application/pdf');
+      res.setHeader('Content-Disposition', `inline; filename="${filename}"`);
+      res.status(200).send(pdf);
+    } catch (error: any) {
+      console.error('❌ Error downloading inspection report:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('only available') ? 409 : 500;
+      writeError(res, statusCode, error.message || 'Failed to download inspection report');
+    }
+  };
+
+  /**
+   * GET /api/v1/checklists/inspections/:id/versions
+   * Immutable versions recorded each time the inspection was completed or amended
+   */
+  getInspectionVersions = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const versions = await inspectionVersionsService.listVersions(req.params.id, user);
+      writeSuccess(res, 200, 'Inspection versions retrieved successfully', versions);
+    } catch (error: any) {
+      console.error('❌ Error getting inspection versions:', error);
+      const statusCode = error.message.includes('not found') ? 404 : 500;
+      writeError(res, statusCode, error.message || 'Failed to retrieve inspection versions');
+    }
+  };
+
+  /**
+   * POST /api/v1/checklists/inspections/versions/backfill
+   * Record a first version for completed inspections that have none
+   */
+  backfillInspectionVersions = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const result = await inspectionVersionsService.backfill(user);
+      writeSuccess(res, 200, 'Inspection versions backfilled successfully', result);
+    } catch (error: any) {
+      console.error('❌ Error backfilling inspection versions:', error);
+      const statusCode = error.message.includes('permissions') ? 403 : 500;
+      writeError(res, statusCode, error.message || 'Failed to backfill inspection versions');
+    }
+  };
+
+  /**
+   * GET /api/v1/checklists/inspections/:id/versions/:version
+   */
+  getInspectionVersion = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const version = await inspectionVersionsService.getVersion(req.params.id, parseInt(req.params.version, 10), user);
+      writeSuccess(res, 200, 'Inspection version retrieved successfully', version);
+    } catch (error: any) {
+      console.error('❌ Error getting inspection version:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('must be') ? 400 : 500;
+      writeError(res, statusCode, error.message || 'Failed to retrieve inspection version');
+    }
+  };
+
+  /**
+   * GET /api/v1/checklists/inspections/compare?base_id=&target_id=[&base_version=&target_version=]
+   * Per-area, per-item differences between two condition reports for the same unit
+   */
+  compareInspections = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const diff = await inspectionVersionsService.compare(req.query as Record<string, string>, user);
+      writeSuccess(res, 200, 'Inspections compared successfully', diff);
+    } catch (error: any) {
+      console.error('❌ Error comparing inspections:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('required') || error.message.includes('must be') ? 400 : 500;
+      writeError(res, statusCode, error.message || 'Failed to compare inspections');
+    }
+  };
+
+  /**
+   * GET /api/v1/checklists/units/:unitId/condition-diff
+   * Latest move-in against latest move-out for a unit
+   */
+  compareUnitMoveInOut = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const diff = await inspectionVersionsService.compareMoveInOut(req.params.unitId, user);
+      writeSuccess(res, 200, 'Move-in and move-out compared successfully', diff);
+    } catch (error: any) {
+      console.error('❌ Error comparing move-in and move-out:', error);
+      const statusCode = error.message.includes('not found') ? 404 : 500;
+      writeError(res, statusCode, error.message || 'Failed to compare move-in and move-out');
+    }
+  };
+
+  /**
+   * POST /api/v1/checklists/inspections/:id/report/shares
+   * Email expiring report links to the tenant, landlord or other recipients
+   */
+  shareInspectionReport = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const shares = await checklistsService.shareReport(req.params.id, req.body || {}, user);
+      writeSuccess(res, 201, 'Inspection report shared successfully', shares);
+    } catch (error: any) {
+      console.error('❌ Error sharing inspection report:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('permissions') ? 403 : error.message.includes('only available') ? 409 : 400;
+      writeError(res, statusCode, error.message || 'Failed to share inspection report');
+    }
+  };
+
+  /**
+   * GET /api/v1/checklists/inspections/:id/report/shares
+   * List the report links sent for an inspection
+   */
+  getInspectionReportShares = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const shares = await checklistsService.getReportShares(req.params.id, user);
+      writeSuccess(res, 200, 'Report links retrieved successfully', shares);
+    } catch (error: any) {
+      console.error('❌ Error getting report links:', error);
+      const statusCode = error.message.includes('not found') ? 404 : 500;
+      writeError(res, statusCode, error.message || 'Failed to retrieve report links');
+    }
+  };
+
+  /**
+   * DELETE /api/v1/checklists/inspections/:id/report/shares/:shareId
+   * Revoke a report link before it expires
+   */
+  revokeInspectionReportShare = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      await checklistsService.revokeReportShare(req.params.id, req.params.shareId, user);
+      writeSuccess(res, 200, 'Report link revoked successfully', null);
+    } catch (error: any) {
+      console.error('❌ Error revoking report link:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('permissions') ? 403 : 400;
+      writeError(res, statusCode, error.message || 'Failed to revoke report link');
+    }
+  };
+
+  /**
+   * GET /api/v1/inspection-reports/:token
+   * Public download through a shared report link
+   */
+  getSharedInspectionReport = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const report = await checklistsService.getSharedReport(req.params.token);
+      res.setHeader('Cache-Control', 'private, no-store');
+      if ('download_url' in report) {
+        res.redirect(302, report.download_url);
+        return;
+      }
+      res.setHeader('Content-Type', 'application/pdf');
+      res.setHeader('Content-Disposition', `inline; filename="${report.filename}"`);
+      res.status(200).send(report.pdf);
+    } catch (error: any) {
+      console.error('❌ Error getting shared inspection report:', error);
+      const statusCode = error.message.includes('not found') ? 404 : error.message.includes('expired') ? 410 : 500;
+      writeError(res, statusCode, error.message || 'Failed to retrieve inspection report');
+    }
+  };
+}
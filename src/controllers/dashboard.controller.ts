@@ -2,6 +2,9 @@ import { Request, Response } from 'express';
 import { DashboardService } from '../services/dashboard.service.js';
 import { JWTClaims } from '../types/index.js';
 import { writeSuccess, writeError } from '../utils/response.js';
+import { invalidateAnalyticsCache } from '../utils/analytics-cache.js';
+import { parseChartPeriod } from '../utils/chart-period.js';
+import { chartDataService } from '../services/chart-data.service.js';
 
 const service = new DashboardService();
 
@@ -20,6 +23,59 @@ export const getDashboardStats = async (req: Request, res: Response) => {
   }
 };
 
+export const getDashboardOverview = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const ownerId = req.query.owner_id as string | undefined;
+    // ?widgets=a,b overrides the saved layout for this request
+    const widgets = req.query.widgets
+      ? String(req.query.widgets).split(',').map(id => id.trim()).filter(id => id.length > 0)
+      : undefined;
+
+    const overview = await service.getDashboardOverview(user, ownerId, widgets);
+    writeSuccess(res, 200, 'Dashboard overview retrieved successfully', overview);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get dashboard overview';
+    writeError(res, 500, message);
+  }
+};
+
+export const getDashboardWidgets = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const preferences = await service.getWidgetPreferences(user);
+    writeSuccess(res, 200, 'Dashboard widgets retrieved successfully', preferences);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get dashboard widgets';
+    writeError(res, 500, message);
+  }
+};
+
+export const updateDashboardWidgets = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const preferences = await service.updateWidgetPreferences(user, req.body?.widgets);
+    // Cached dashboards were built with the old layout
+    invalidateAnalyticsCache(user.company_id);
+    writeSuccess(res, 200, 'Dashboard widgets updated successfully', preferences);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update dashboard widgets';
+    writeError(res, message.includes('must') ? 400 : 500, message);
+  }
+};
+
+export const getDashboardChart = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const period = parseChartPeriod(req.query as Record<string, any>);
+    const chart = await chartDataService.getChart(user, req.params.chartType as string, period);
+    writeSuccess(res, 200, 'Chart data retrieved successfully', chart);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get chart data';
+    writeError(res, message.includes('permission') ? 403 : message.includes('must') || message.includes('required') ? 400 : 500, message);
+  }
+};
+
 export const getOnboardingStatus = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
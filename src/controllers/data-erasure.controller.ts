@@ -0,0 +1,68 @@
+import { Request, Response } from 'express';
+import { dataErasureService } from '../services/data-erasure.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const createRequest = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const request = await dataErasureService.request(user, req.body || {});
+    writeSuccess(res, 201, 'Erasure request submitted for review', request);
+  } catch (error: any) {
+    const message = error.message || 'Failed to submit erasure request';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const listRequests = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const requests = await dataErasureService.list(user, {
+      status: req.query.status as string | undefined,
+      subject_id: req.query.subject_id as string | undefined,
+      page: parseInt(req.query.page as string) || 1,
+      limit: parseInt(req.query.limit as string) || 50,
+    });
+    writeSuccess(res, 200, 'Erasure requests retrieved successfully', requests);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve erasure requests';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getRequest = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const request = await dataErasureService.get(user, req.params.id);
+    writeSuccess(res, 200, 'Erasure request retrieved successfully', request);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve erasure request';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const cancelRequest = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const request = await dataErasureService.cancel(user, req.params.id);
+    writeSuccess(res, 200, 'Erasure request cancelled', request);
+  } catch (error: any) {
+    const message = error.message || 'Failed to cancel erasure request';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+/**
+ * Approve (which carries the request out) or reject. Super admins only.
+ */
+export const reviewRequest = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const request = await dataErasureService.review(user, req.params.id, req.body || {});
+    writeSuccess(res, 200, request.status === 'completed' ? 'Erasure completed' : 'Erasure request rejected', request);
+  } catch (error: any) {
+    const message = error.message || 'Failed to review erasure request';
+    writeError(res, statusFor(message), message);
+  }
+};
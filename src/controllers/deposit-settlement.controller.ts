@@ -0,0 +1,81 @@
+import { Request, Response } from 'express';
+import { DepositSettlementService } from '../services/deposit-settlement.service.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { JWTClaims } from '../types/index.js';
+import { statusFor } from '../utils/error-status.js';
+
+export class DepositSettlementController {
+  private depositSettlementService = new DepositSettlementService();
+
+  /**
+   * GET /api/v1/leases/:id/settlement
+   */
+  getSettlement = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const settlement = await this.depositSettlementService.getSettlement(req.params.id as string, user);
+      writeSuccess(res, 200, 'Deposit settlement retrieved successfully', settlement);
+    } catch (error: any) {
+      console.error('Error getting deposit settlement:', error);
+      writeError(res, statusFor(error.message || ''), error.message || 'Failed to retrieve deposit settlement');
+    }
+  };
+
+  /**
+   * POST /api/v1/leases/:id/settlement/calculate
+   */
+  calculateSettlement = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const settlement = await this.depositSettlementService.calculateSettlement(req.params.id as string, req.body || {}, user);
+      writeSuccess(res, 200, 'Deposit settlement calculated successfully', settlement);
+    } catch (error: any) {
+      console.error('Error calculating deposit settlement:', error);
+      writeError(res, statusFor(error.message || ''), error.message || 'Failed to calculate deposit settlement');
+    }
+  };
+
+  /**
+   * POST /api/v1/leases/:id/settlement/approve
+   */
+  approveSettlement = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const settlement = await this.depositSettlementService.approveSettlement(req.params.id as string, user);
+      writeSuccess(res, 200, 'Deposit settlement approved successfully', settlement);
+    } catch (error: any) {
+      console.error('Error approving deposit settlement:', error);
+      writeError(res, statusFor(error.message || ''), error.message || 'Failed to approve deposit settlement');
+    }
+  };
+
+  /**
+   * POST /api/v1/leases/:id/settlement/refund
+   */
+  recordRefund = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const settlement = await this.depositSettlementService.recordRefund(req.params.id as string, req.body || {}, user);
+      writeSuccess(res, 200, 'Deposit refund recorded successfully', settlement);
+    } catch (error: any) {
+      console.error('Error recording deposit refund:', error);
+      writeError(res, statusFor(error.message || ''), error.message || 'Failed to record deposit refund');
+    }
+  };
+
+  /**
+   * GET /api/v1/leases/:id/settlement/statement
+   */
+  getStatement = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const pdf = await this.depositSettlementService.getStatementPdf(req.params.id as string, user);
+      res.setHeader('Content-Type', 'application/pdf');
+      res.setHeader('Content-Disposition', `attachment; filename="deposit_settlement_${req.params.id}.pdf"`);
+      res.status(200).send(pdf);
+    } catch (error: any) {
+      console.error('Error generating settlement statement:', error);
+      writeError(res, statusFor(error.message || ''), error.message || 'Failed to generate settlement statement');
+    }
+  };
+}
@@ -0,0 +1,93 @@
+import { Request, Response } from 'express';
+import { digestService } from '../services/digest.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { env } from '../config/env.js';
+import { statusFor } from '../utils/error-status.js';
+
+const unsubscribePage = (title: string, body: string, form: string = '') => `<!DOCTYPE html>
+<html>
+  <head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>${title}</title></head>
+  <body style="font-family: Arial, sans-serif; max-width: 480px; margin: 60px auto; color: #374151;">
+    <h2>${title}</h2>
+    <p>${body}</p>
+    ${form}
+    <p><a href="${env.appUrl}">Open LetRents</a></p>
+  </body>
+</html>`;
+
+// Posts back to the same link; the hidden field tells a person confirming apart from a mail client
+const confirmForm = `<form method="post">
+      <input type="hidden" name="confirm" value="yes">
+      <button type="submit" style="background: #14b8a6; color: #fff; border: 0; border-radius: 6px; padding: 10px 18px; cursor: pointer;">Unsubscribe</button>
+    </form>`;
+
+export const getDigestSettings = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const settings = await digestService.getSettings(user);
+    writeSuccess(res, 200, 'Digest settings retrieved successfully', settings);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get digest settings';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updateDigestSettings = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const settings = await digestService.updateSettings(user, req.body.frequency);
+    writeSuccess(res, 200, 'Digest settings updated successfully', settings);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update digest settings';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const previewDigest = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const summary = await digestService.preview(user, req.query.frequency as string | undefined);
+    writeSuccess(res, 200, 'Digest preview generated successfully', summary);
+  } catch (error: any) {
+    const message = error.message || 'Failed to preview digest';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+/**
+ * Link in the digest footer. Opening it (GET) only shows a confirmation form, so link scanners
+ * and prefetching mail clients cannot unsubscribe anyone; the form and mail clients' one-click
+ * unsubscribe (RFC 8058) POST to the same URL.
+ */
+export const unsubscribeDigest = async (req: Request, res: Response) => {
+  const fromForm = req.method === 'POST' && req.body?.confirm === 'yes';
+  try {
+    if (req.method === 'GET') {
+      const { subscribed } = await digestService.checkUnsubscribeToken(req.params.token as string);
+      res.status(200).type('html').send(subscribed
+        ? unsubscribePage('Unsubscribe from summary emails?', 'You will no longer receive LetRents summary emails. You can turn them back on from your notification settings.', confirmForm)
+        : unsubscribePage('Already unsubscribed', 'You are not receiving LetRents summary emails. You can turn them back on from your notification settings.'));
+      return;
+    }
+    await digestService.unsubscribe(req.params.token as string);
+    if (!fromForm) {
+      writeSuccess(res, 200, 'Unsubscribed from email digests', { unsubscribed: true });
+      return;
+    }
+    res.status(200).type('html').send(unsubscribePage(
+      'You have been unsubscribed',
+      'You will no longer receive LetRents summary emails. You can turn them back on from your notification settings.'
+    ));
+  } catch (error: any) {
+    const message = error.message || 'Failed to unsubscribe';
+    if (req.method === 'POST' && !fromForm) {
+      writeError(res, statusFor(message), message);
+      return;
+    }
+    res.status(statusFor(message)).type('html').send(unsubscribePage(
+      'Link not recognised',
+      'This unsubscribe link is invalid or has been replaced. You can change summary emails from your notification settings.'
+    ));
+  }
+};
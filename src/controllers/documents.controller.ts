@@ -6,6 +6,8 @@ import { TenantsService } from '../services/tenants.service.js';
 import { UnitsService } from '../services/units.service.js';
 import { PropertiesService } from '../services/properties.service.js';
 import { UnitActivityService } from '../services/unit-activity.service.js';
+import { KycService } from '../services/kyc.service.js';
+import { ocrService } from '../services/ocr.service.js';
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import { writeSuccess, writeError } from '../utils/response.js';
@@ -14,6 +16,7 @@ const tenantsService = new TenantsService();
 const unitsService = new UnitsService();
 const propertiesService = new PropertiesService();
 const unitActivityService = new UnitActivityService();
+const kycService = new KycService();
 const prisma = getPrisma();
 
 const upload = multer({
@@ -83,6 +86,14 @@ export const uploadTenantDocuments = async (req: Request, res: Response) => {
           },
         });
 
+        // ID documents are read by OCR in the background for KYC pre-fill and mismatch checks
+        const runKyc = kycService.isIdDocument(document.category, file.mimetype) && ocrService.isConfigured();
+        if (runKyc) {
+          kycService
+            .processDocument(document.id, user, { buffer: file.buffer, mimeType: file.mimetype })
+            .catch(err => console.error('KYC processing failed:', err.message));
+        }
+
         return {
           id: document.id,
           name: document.name,
@@ -91,6 +102,7 @@ export const uploadTenantDocuments = async (req: Request, res: Response) => {
           size: `${(document.size / 1024 / 1024).toFixed(2)} MB`,
           uploadDate: document.created_at.toISOString(),
           url: document.url,
+          ...(runKyc && { kyc_status: 'processing' }),
         };
       })
     );
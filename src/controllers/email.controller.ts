@@ -1,6 +1,8 @@
 import { Request, Response } from 'express';
 import { emailService } from '../services/email.service.js';
+import { emailTemplatesService } from '../services/email-templates.service.js';
 import { JWTClaims } from '../types/index.js';
+import { statusFor } from '../utils/error-status.js';
 
 export const emailController = {
   // Test email endpoint
@@ -145,4 +147,86 @@ export const emailController = {
       });
     }
   },
+
+  // List built-in email templates with their variables and locales
+  async listTemplates(req: Request, res: Response) {
+    res.json({
+      success: true,
+      templates: emailTemplatesService.listTemplates(),
+    });
+  },
+
+  // Render a template with sample or supplied variables without sending it
+  async previewTemplate(req: Request, res: Response) {
+    try {
+      const user = req.user as JWTClaims;
+      const preview = await emailTemplatesService.preview(req.params.key, req.body || {}, user);
+      res.json({
+        success: true,
+        preview,
+      });
+    } catch (error) {
+      const message = error instanceof Error ? error.message : 'Unknown error occurred';
+      res.status(statusFor(message)).json({
+        success: false,
+        error: message,
+      });
+    }
+  },
+
+  // Send a rendered template to the caller (or a given address) marked as a test
+  async testSendTemplate(req: Request, res: Response) {
+    try {
+      const user = req.user as JWTClaims;
+      const result = await emailTemplatesService.testSend(req.params.key, req.body || {}, user);
+      res.json({
+        success: true,
+        message: 'Test email sent successfully',
+        ...result,
+      });
+    } catch (error) {
+      const message = error instanceof Error ? error.message : 'Unknown error occurred';
+      res.status(statusFor(message)).json({
+        success: false,
+        error: message,
+      });
+    }
+  },
+
+  // Get the company's email branding
+  async getBranding(req: Request, res: Response) {
+    try {
+      const user = req.user as JWTClaims;
+      const branding = await emailTemplatesService.getCompanyBranding(user, req.query.company_id as string | undefined);
+      res.json({
+        success: true,
+        branding,
+      });
+    } catch (error) {
+      const message = error instanceof Error ? error.message : 'Unknown error occurred';
+      res.status(statusFor(message)).json({
+        success: false,
+        error: message,
+      });
+    }
+  },
+
+  // Update the company's email branding
+  async updateBranding(req: Request, res: Response) {
+    try {
+      const user = req.user as JWTClaims;
+      const branding = await emailTemplatesService.updateBranding(req.body || {}, user);
+      res.json({
+        success: true,
+        message: 'Email branding updated successfully',
+        branding,
+      });
+    } catch (error) {
+      const message = error instanceof Error ? error.message : 'Unknown error occurred';
+      res.status(statusFor(message)).json({
+        success: false,
+        error: message,
+      });
+    }
+  },
 };
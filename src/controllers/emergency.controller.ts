@@ -0,0 +1,83 @@
+import { Request, Response } from 'express';
+import { emergencyService } from '../services/emergency.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const reportEmergency = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const alert = await emergencyService.reportEmergency(req.body || {}, user);
+    writeSuccess(res, 201, 'Emergency reported; responders have been alerted', alert);
+  } catch (error: any) {
+    console.error('❌ Error reporting emergency:', error);
+    const message = error.message || 'Failed to report emergency';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const listEmergencies = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await emergencyService.listEmergencies(req.query as Record<string, string>, user);
+    writeSuccess(res, 200, 'Emergencies retrieved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve emergencies';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getEmergency = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const alert = await emergencyService.getEmergency(req.params.id as string, user);
+    writeSuccess(res, 200, 'Emergency retrieved successfully', alert);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve emergency';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const acknowledgeEmergency = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const alert = await emergencyService.acknowledgeEmergency(req.params.id as string, user);
+    writeSuccess(res, 200, 'Emergency acknowledged', alert);
+  } catch (error: any) {
+    const message = error.message || 'Failed to acknowledge emergency';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const resolveEmergency = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const alert = await emergencyService.resolveEmergency(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Emergency resolved', alert);
+  } catch (error: any) {
+    const message = error.message || 'Failed to resolve emergency';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getEmergencySettings = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const settings = await emergencyService.getEscalationSettings(user);
+    writeSuccess(res, 200, 'Emergency escalation settings retrieved successfully', settings);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve emergency escalation settings';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updateEmergencySettings = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const settings = await emergencyService.updateEscalationSettings(req.body || {}, user);
+    writeSuccess(res, 200, 'Emergency escalation settings updated successfully', settings);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update emergency escalation settings';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
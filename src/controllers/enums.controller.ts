@@ -86,7 +86,8 @@ export const enumsController = {
         leaseTypes: [
           'fixed_term',
           'month_to_month',
-          'yearly'
+          'yearly',
+          'short_stay'
         ],
         leaseStatuses: [
           'draft',
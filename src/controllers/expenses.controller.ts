@@ -0,0 +1,108 @@
+import { Request, Response } from 'express';
+import multer from 'multer';
+import { expensesService, EXPENSE_CATEGORIES, EXPENSE_RECURRENCES } from '../services/expenses.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+// Receipts: a photo or a PDF
+const upload = multer({
+  storage: multer.memoryStorage(),
+  limits: {
+    fileSize: 10 * 1024 * 1024, // 10MB limit
+  },
+  fileFilter: (req, file, cb) => {
+    if (file.mimetype.startsWith('image/') || file.mimetype === 'application/pdf') {
+      cb(null, true);
+    } else {
+      cb(new Error('Only image and PDF receipts are allowed'));
+    }
+  },
+});
+
+export const receiptUploadMiddleware = upload.single('receipt');
+
+export const listExpenses = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const propertyIds = req.query.property_ids
+      ? String(req.query.property_ids).split(',').map(id => id.trim()).filter(id => id.length > 0)
+      : undefined;
+    const result = await expensesService.list({
+      property_id: req.query.property_id as string,
+      property_ids: propertyIds,
+      vendor_id: req.query.vendor_id as string,
+      category: req.query.category as string,
+      start_date: req.query.start_date as string,
+      end_date: req.query.end_date as string,
+      page: Number(req.query.page) || 1,
+      limit: Number(req.query.limit) || 20,
+    }, user);
+    writeSuccess(res, 200, 'Expenses retrieved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve expenses';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getExpenseOptions = async (req: Request, res: Response) => {
+  writeSuccess(res, 200, 'Expense options retrieved successfully', {
+    categories: EXPENSE_CATEGORIES,
+    recurrences: EXPENSE_RECURRENCES,
+  });
+};
+
+export const getExpense = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const expense = await expensesService.get(req.params.id as string, user);
+    writeSuccess(res, 200, 'Expense retrieved successfully', expense);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve expense';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const createExpense = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const expense = await expensesService.create(req.body || {}, user, req.file);
+    writeSuccess(res, 201, 'Expense recorded successfully', expense);
+  } catch (error: any) {
+    const message = error.message || 'Failed to record expense';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updateExpense = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const expense = await expensesService.update(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Expense updated successfully', expense);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update expense';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const deleteExpense = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await expensesService.delete(req.params.id as string, user);
+    writeSuccess(res, 200, 'Expense deleted successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to delete expense';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const uploadExpenseReceipt = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const expense = await expensesService.uploadReceipt(req.params.id as string, req.file, user);
+    writeSuccess(res, 200, 'Receipt uploaded successfully', expense);
+  } catch (error: any) {
+    const message = error.message || 'Failed to upload receipt';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -2,12 +2,11 @@ import { Request, Response } from 'express';
 import multer from 'multer';
 import { imagekitService } from '../services/imagekit.service.js';
 import { PropertiesService } from '../services/properties.service.js';
-import { UnitsService } from '../services/units.service.js';
+import { unitPhotosService } from '../services/unit-photos.service.js';
 import { JWTClaims } from '../types/index.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 
 const propertiesService = new PropertiesService();
-const unitsService = new UnitsService();
 
 // Configure multer for memory storage
 const upload = multer({
@@ -133,6 +132,24 @@ export const deletePropertyImage = async (req: Request, res: Response) => {
   }
 };
 
+const unitPhotoStatus = (message: string): number => {
+  if (message.includes('not found') || message.includes('access denied')) return 404;
+  if (message.includes('permission')) return 403;
+  if (message.includes('required')) return 400;
+  return 500;
+};
+
+export const listUnitImages = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const photos = await unitPhotosService.listPhotos(req.params.id, user);
+    writeSuccess(res, 200, 'Unit images retrieved successfully', photos);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve images';
+    writeError(res, unitPhotoStatus(message), message);
+  }
+};
+
 export const uploadUnitImages = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
@@ -142,59 +159,44 @@ export const uploadUnitImages = async (req: Request, res: Response) => {
       return writeError(res, 400, 'Unit ID is required');
     }
 
-    // Verify unit exists and user has access
-    try {
-      await unitsService.getUnit(unitId, user);
-    } catch (error) {
-      return writeError(res, 404, 'Unit not found or access denied');
-    }
-
     const files = req.files as Express.Multer.File[];
     if (!files || files.length === 0) {
       return writeError(res, 400, 'No images provided');
     }
 
-    // Upload images to ImageKit
-    const uploadPromises = files.map(async (file, index) => {
-      const fileName = `unit-${unitId}-${Date.now()}-${index}`;
-      const uploadResult = await imagekitService.uploadFile(
-        file.buffer,
-        fileName,
-        `units/${unitId}`
-      );
-      
-      return {
-        url: uploadResult.url,
-        fileId: uploadResult.fileId,
-        name: uploadResult.name,
-        isPrimary: index === 0, // First image is primary
-      };
-    });
-
-    const uploadedImages = await Promise.all(uploadPromises);
-
-    // Get current unit to merge with existing images
-    const unit = await unitsService.getUnit(unitId, user);
-    const currentImages = Array.isArray(unit.images) ? unit.images : [];
-    
-    // Add new images to existing ones
-    const updatedImages = [...currentImages, ...uploadedImages];
-
-    // Update unit with new images
-    await unitsService.updateUnit(
+    const { photos, total } = await unitPhotosService.uploadPhotos(
       unitId,
-      { images: updatedImages },
+      files,
+      { caption: req.body?.caption, category: req.body?.category },
       user
     );
 
     writeSuccess(res, 200, 'Images uploaded successfully', {
-      images: uploadedImages,
-      totalImages: updatedImages.length,
+      images: photos.map((photo) => ({
+        id: photo.id,
+        url: photo.url,
+        thumbnailUrl: photo.thumbnail_url,
+        fileId: photo.file_id,
+        name: photo.name,
+        isPrimary: photo.is_primary,
+      })),
+      totalImages: total,
     });
   } catch (error: any) {
     console.error('Error uploading unit images:', error);
     const message = error.message || 'Failed to upload images';
-    writeError(res, 500, message);
+    writeError(res, unitPhotoStatus(message), message);
+  }
+};
+
+export const setPrimaryUnitImage = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const photo = await unitPhotosService.setPrimaryPhoto(req.params.id, req.params.imageId, user);
+    writeSuccess(res, 200, 'Primary image updated successfully', photo);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update primary image';
+    writeError(res, unitPhotoStatus(message), message);
   }
 };
 
@@ -207,37 +209,32 @@ export const deleteUnitImage = async (req: Request, res: Response) => {
       return writeError(res, 400, 'Unit ID and Image ID are required');
     }
 
-    // Verify unit exists and user has access
-    const unit = await unitsService.getUnit(unitId, user);
-    const currentImages = Array.isArray(unit.images) ? unit.images : [];
-
-    // Find and remove the image
-    const imageToDelete = currentImages.find((img: any) => img.fileId === imageId);
-    if (!imageToDelete) {
-      return writeError(res, 404, 'Image not found');
-    }
-
-    // Delete from ImageKit
-    await imagekitService.deleteFile(imageId);
-
-    // Remove from unit images array
-    const updatedImages = currentImages.filter((img: any) => img.fileId !== imageId);
-
-    // Update unit
-    await unitsService.updateUnit(
-      unitId,
-      { images: updatedImages },
-      user
-    );
+    const result = await unitPhotosService.deletePhoto(unitId, imageId, user);
 
     writeSuccess(res, 200, 'Image deleted successfully', {
       deletedImageId: imageId,
-      remainingImages: updatedImages.length,
+      remainingImages: result.remaining,
     });
   } catch (error: any) {
     console.error('Error deleting unit image:', error);
     const message = error.message || 'Failed to delete image';
-    writeError(res, 500, message);
+    writeError(res, unitPhotoStatus(message), message);
+  }
+};
+
+export const deleteUnitImages = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await unitPhotosService.deletePhotos(req.params.id, req.body?.image_ids, user);
+
+    writeSuccess(res, 200, 'Images deleted successfully', {
+      deletedImageIds: result.deleted,
+      remainingImages: result.remaining,
+    });
+  } catch (error: any) {
+    console.error('Error deleting unit images:', error);
+    const message = error.message || 'Failed to delete images';
+    writeError(res, unitPhotoStatus(message), message);
   }
 };
 
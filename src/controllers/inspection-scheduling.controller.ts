@@ -0,0 +1,80 @@
+import { Request, Response } from 'express';
+import { inspectionSchedulingService } from '../services/inspection-scheduling.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const scheduleInspection = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const inspection = await inspectionSchedulingService.scheduleInspection(req.params.id as string, req.body, user);
+    writeSuccess(res, 200, 'Inspection scheduled successfully', inspection);
+  } catch (error: any) {
+    const message = error.message || 'Failed to schedule inspection';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getInspectionSchedule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const schedule = await inspectionSchedulingService.getSchedule({
+      from: req.query.from as string,
+      to: req.query.to as string,
+      inspector_id: req.query.inspector_id as string,
+      property_id: req.query.property_id as string,
+    }, user);
+    writeSuccess(res, 200, 'Inspection schedule retrieved successfully', schedule);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get inspection schedule';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const checkInspectionConflicts = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const conflicts = await inspectionSchedulingService.checkConflicts(req.query as Record<string, string>, user);
+    writeSuccess(res, 200, 'Scheduling conflicts checked successfully', { has_conflicts: conflicts.length > 0, conflicts });
+  } catch (error: any) {
+    const message = error.message || 'Failed to check scheduling conflicts';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getCalendarFeedUrl = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const feed = await inspectionSchedulingService.getFeedUrl(user);
+    const message = feed.url
+      ? 'Calendar feed URL retrieved successfully'
+      : 'Calendar feed is already set up; reset it to get a new URL';
+    writeSuccess(res, 200, message, feed);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get calendar feed URL';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const rotateCalendarFeedUrl = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const feed = await inspectionSchedulingService.getFeedUrl(user, true);
+    writeSuccess(res, 200, 'Calendar feed URL reset successfully', feed);
+  } catch (error: any) {
+    const message = error.message || 'Failed to reset calendar feed URL';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const exportInspectionFeed = async (req: Request, res: Response) => {
+  try {
+    const ics = await inspectionSchedulingService.exportFeed(req.params.token as string);
+    res.setHeader('Content-Type', 'text/calendar; charset=utf-8');
+    res.setHeader('Content-Disposition', 'inline; filename="inspections.ics"');
+    res.status(200).send(ics);
+  } catch (error: any) {
+    const message = error.message || 'Failed to export calendar feed';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -0,0 +1,115 @@
+import { Request, Response } from 'express';
+import { inventoryService } from '../services/inventory.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const listInventoryItems = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const items = await inventoryService.listItems(req.query as Record<string, string>, user);
+    writeSuccess(res, 200, 'Inventory retrieved successfully', items);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve inventory';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getInventoryItem = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const item = await inventoryService.getItem(req.params.id as string, user);
+    writeSuccess(res, 200, 'Inventory item retrieved successfully', item);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve inventory item';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const createInventoryItem = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const item = await inventoryService.createItem(req.body || {}, user);
+    writeSuccess(res, 201, 'Inventory item created successfully', item);
+  } catch (error: any) {
+    const message = error.message || 'Failed to create inventory item';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updateInventoryItem = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const item = await inventoryService.updateItem(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Inventory item updated successfully', item);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update inventory item';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const deleteInventoryItem = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await inventoryService.deactivateItem(req.params.id as string, user);
+    writeSuccess(res, 200, 'Inventory item removed successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to remove inventory item';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const restockInventoryItem = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const item = await inventoryService.restock(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Stock received successfully', item);
+  } catch (error: any) {
+    const message = error.message || 'Failed to restock inventory item';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const adjustInventoryItem = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const item = await inventoryService.adjust(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Stock adjusted successfully', item);
+  } catch (error: any) {
+    const message = error.message || 'Failed to adjust stock';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getMaintenanceMaterials = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const materials = await inventoryService.getRequestMaterials(req.params.id as string, user);
+    writeSuccess(res, 200, 'Materials retrieved successfully', materials);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve materials';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const consumeMaintenanceMaterials = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const materials = await inventoryService.consumeForRequest(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Materials recorded successfully', materials);
+  } catch (error: any) {
+    const message = error.message || 'Failed to record materials';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const returnMaintenanceMaterial = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const materials = await inventoryService.returnToStock(req.params.id as string, req.params.movementId as string, user);
+    writeSuccess(res, 200, 'Material returned to stock successfully', materials);
+  } catch (error: any) {
+    const message = error.message || 'Failed to return material';
+    writeError(res, statusFor(message), message);
+  }
+};
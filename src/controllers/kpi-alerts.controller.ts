@@ -0,0 +1,84 @@
+import { Request, Response } from 'express';
+import { kpiAlertsService } from '../services/kpi-alerts.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { invalidateAnalyticsCache } from '../utils/analytics-cache.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const getAlertFeed = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const feed = await kpiAlertsService.getFeed(user, {
+      status: req.query.status as string,
+      limit: Number(req.query.limit) || undefined,
+      offset: Number(req.query.offset) || undefined,
+    });
+    writeSuccess(res, 200, 'Alerts retrieved successfully', feed);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve alerts';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const acknowledgeAlert = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const alert = await kpiAlertsService.acknowledge(req.params.id as string, user);
+    writeSuccess(res, 200, 'Alert acknowledged successfully', alert);
+  } catch (error: any) {
+    const message = error.message || 'Failed to acknowledge alert';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getAlertRuleOptions = async (req: Request, res: Response) => {
+  writeSuccess(res, 200, 'Alert rule options retrieved successfully', kpiAlertsService.getOptions());
+};
+
+export const listAlertRules = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const rules = await kpiAlertsService.listRules(user);
+    writeSuccess(res, 200, 'Alert rules retrieved successfully', rules);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve alert rules';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const createAlertRule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const rule = await kpiAlertsService.createRule(req.body || {}, user);
+    // The alerts widget may have a new entry
+    invalidateAnalyticsCache(user.company_id);
+    writeSuccess(res, 201, 'Alert rule created successfully', rule);
+  } catch (error: any) {
+    const message = error.message || 'Failed to create alert rule';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updateAlertRule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const rule = await kpiAlertsService.updateRule(req.params.id as string, req.body || {}, user);
+    invalidateAnalyticsCache(user.company_id);
+    writeSuccess(res, 200, 'Alert rule updated successfully', rule);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update alert rule';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const deleteAlertRule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await kpiAlertsService.deleteRule(req.params.id as string, user);
+    invalidateAnalyticsCache(user.company_id);
+    writeSuccess(res, 200, 'Alert rule deleted successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to delete alert rule';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -0,0 +1,46 @@
+import { Request, Response } from 'express';
+import { KycService, ReviewKycRequest } from '../services/kyc.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+const kycService = new KycService();
+
+export const getTenantKycVerifications = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const verifications = await kycService.getVerifications(req.params.id as string, user);
+    writeSuccess(res, 200, 'KYC verifications retrieved successfully', verifications);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve KYC verifications';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const processTenantKycDocument = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const verification = await kycService.reprocessDocument(req.params.id as string, req.params.documentId as string, user);
+    writeSuccess(res, 200, 'KYC document processed', verification);
+  } catch (error: any) {
+    const message = error.message || 'Failed to process KYC document';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const reviewTenantKycVerification = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const reviewData: ReviewKycRequest = req.body;
+    const verification = await kycService.reviewVerification(
+      req.params.id as string,
+      req.params.verificationId as string,
+      reviewData,
+      user
+    );
+    writeSuccess(res, 200, 'KYC verification reviewed successfully', verification);
+  } catch (error: any) {
+    const message = error.message || 'Failed to review KYC verification';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
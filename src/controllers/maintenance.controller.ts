@@ -1,15 +1,41 @@
 import { Request, Response } from 'express';
+import multer from 'multer';
 import { 
   MaintenanceService, 
   MaintenanceFilters, 
   CreateMaintenanceRequest, 
-  UpdateMaintenanceRequest 
+  UpdateMaintenanceRequest,
+  AssignMaintenanceRequest,
+  CreateMaintenanceComment,
+  VendorStatusUpdate,
+  ATTACHMENT_MIME_PREFIXES
 } from '../services/maintenance.service.js';
+import { maintenanceSlaService } from '../services/maintenance-sla.service.js';
+import { maintenanceCostsService } from '../services/maintenance-costs.service.js';
 import { JWTClaims } from '../types/index.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 
 const service = new MaintenanceService();
 
+// Photos, voice notes and short videos as evidence on requests
+const upload = multer({
+  storage: multer.memoryStorage(),
+  limits: {
+    fileSize: 50 * 1024 * 1024, // 50MB limit (video)
+  },
+  fileFilter: (req, file, cb) => {
+    if (ATTACHMENT_MIME_PREFIXES.some(prefix => file.mimetype.startsWith(prefix))) {
+      cb(null, true);
+    } else {
+      cb(new Error('Only photo, audio and video files are allowed'));
+    }
+  },
+});
+
+export const attachmentUploadMiddleware = upload.array('attachments', 5);
+
+const uploadedFiles = (req: Request) => ((req.files as Express.Multer.File[]) || []);
+
 export const createMaintenanceRequest = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
@@ -20,11 +46,14 @@ export const createMaintenanceRequest = async (req: Request, res: Response) => {
       return writeError(res, 400, 'Title and description are required');
     }
 
-    const maintenanceRequest = await service.createMaintenanceRequest(requestData, user);
+    const maintenanceRequest = await service.createMaintenanceRequest(requestData, user, uploadedFiles(req));
     writeSuccess(res, 201, 'Maintenance request created successfully', maintenanceRequest);
   } catch (error: any) {
     const message = error.message || 'Failed to create maintenance request';
-    writeError(res, 500, message);
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permissions') ? 403 :
+                  message.includes('required') || message.includes('must be') ? 400 : 500;
+    writeError(res, status, message);
   }
 };
 
@@ -41,7 +70,8 @@ export const getMaintenanceRequest = async (req: Request, res: Response) => {
     writeSuccess(res, 200, 'Maintenance request retrieved successfully', maintenanceRequest);
   } catch (error: any) {
     const message = error.message || 'Failed to get maintenance request';
-    const status = message.includes('not found') ? 404 : 500;
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 500;
     writeError(res, status, message);
   }
 };
@@ -63,6 +93,8 @@ export const listMaintenanceRequests = async (req: Request, res: Response) => {
       property_ids: propertyIds, // Add property_ids array
       unit_id: req.query.unit_id as string,
       tenant_id: req.query.tenant_id as string,
+      assigned_to: req.query.assigned_to as string,
+      vendor_id: req.query.vendor_id as string,
       category: req.query.category as string,
       priority: req.query.priority as string,
       status: req.query.status as string,
@@ -97,7 +129,172 @@ export const updateMaintenanceRequest = async (req: Request, res: Response) => {
   } catch (error: any) {
     const message = error.message || 'Failed to update maintenance request';
     const status = message.includes('not found') ? 404 :
-                  message.includes('permissions') ? 403 : 500;
+                  message.includes('permission') ? 403 :
+                  message.includes('invalid status transition') || message.includes('awaiting approval') ? 409 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const assignMaintenanceRequest = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { id } = req.params;
+    const assignData: AssignMaintenanceRequest = req.body;
+
+    if (assignData.assigned_to === undefined && assignData.vendor_id === undefined) {
+      return writeError(res, 400, 'assigned_to or vendor_id is required (use null to unassign)');
+    }
+
+    const maintenanceRequest = await service.assignMaintenanceRequest(id as string, assignData, user);
+    writeSuccess(res, 200, 'Maintenance request assigned successfully', maintenanceRequest);
+  } catch (error: any) {
+    const message = error.message || 'Failed to assign maintenance request';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 :
+                  message.includes('cannot assign') || message.includes('cannot be assigned') ||
+                  message.includes('insurance has expired') ? 409 :
+                  message.includes('not both') ? 400 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const autoAssignMaintenanceRequest = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const maintenanceRequest = await service.autoAssignMaintenanceRequest(req.params.id as string, user, {
+      reassign: true,
+      note: req.body?.note,
+    });
+    writeSuccess(res, 200, 'Maintenance request reassigned successfully', maintenanceRequest);
+  } catch (error: any) {
+    const message = error.message || 'Failed to reassign maintenance request';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 :
+                  message.includes('cannot assign') ? 409 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const rateMaintenanceVendor = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const maintenanceRequest = await service.rateVendor(req.params.id as string, Number(req.body.rating), user);
+    writeSuccess(res, 200, 'Vendor rated successfully', maintenanceRequest);
+  } catch (error: any) {
+    const message = error.message || 'Failed to rate vendor';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 :
+                  message.includes('already') ? 409 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const rateMaintenanceService = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const maintenanceRequest = await service.rateService(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Thank you for rating this request', maintenanceRequest);
+  } catch (error: any) {
+    const message = error.message || 'Failed to rate maintenance request';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') || message.includes('only the tenant') ? 403 :
+                  message.includes('already') ? 409 : 400;
+    writeError(res, status, message);
+  }
+};
+
+// Vendor magic-link endpoints (no login; the token identifies the work order)
+
+export const getVendorWorkOrder = async (req: Request, res: Response) => {
+  try {
+    const workOrder = await service.getVendorView(req.params.token as string);
+    writeSuccess(res, 200, 'Work order retrieved successfully', workOrder);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get work order';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('expired') ? 410 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const updateVendorWorkOrder = async (req: Request, res: Response) => {
+  try {
+    const updateData: VendorStatusUpdate = req.body;
+    const workOrder = await service.vendorUpdate(req.params.token as string, updateData);
+    writeSuccess(res, 200, 'Work order updated successfully', workOrder);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update work order';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('expired') ? 410 :
+                  message.includes('already') || message.includes('invalid status transition') ? 409 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const getMaintenanceComments = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const comments = await service.getComments(req.params.id as string, user);
+    writeSuccess(res, 200, 'Comments retrieved successfully', comments);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get comments';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const getMaintenanceTimeline = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const timeline = await service.getTimeline(req.params.id as string, user);
+    writeSuccess(res, 200, 'Maintenance timeline retrieved successfully', timeline);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get maintenance timeline';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const addMaintenanceComment = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const commentData: CreateMaintenanceComment = req.body;
+    const comment = await service.addComment(req.params.id as string, commentData, user);
+    writeSuccess(res, 201, 'Comment added successfully', comment);
+  } catch (error: any) {
+    const message = error.message || 'Failed to add comment';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 :
+                  message.includes('required') ? 400 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const addMaintenanceAttachments = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const comment = await service.addAttachments(req.params.id as string, uploadedFiles(req), req.body.comment, user);
+    writeSuccess(res, 201, 'Attachments uploaded successfully', comment);
+  } catch (error: any) {
+    const message = error.message || 'Failed to upload attachments';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 :
+                  message.includes('required') || message.includes('must be') ? 400 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const removeMaintenanceAttachment = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await service.removeAttachment(req.params.id as string, req.params.fileId as string, user);
+    writeSuccess(res, 200, 'Attachment removed successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to remove attachment';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 500;
     writeError(res, status, message);
   }
 };
@@ -124,10 +321,185 @@ export const deleteMaintenanceRequest = async (req: Request, res: Response) => {
 export const getMaintenanceOverview = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
-    const overview = await service.getMaintenanceOverview(user);
+    const overview = await service.getMaintenanceOverview(user, req.query as Record<string, string>);
     writeSuccess(res, 200, 'Maintenance overview retrieved successfully', overview);
   } catch (error: any) {
     const message = error.message || 'Failed to get maintenance overview';
     writeError(res, 500, message);
   }
 };
+
+export const getMaintenanceSlaPolicy = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const policy = await maintenanceSlaService.getSlaPolicy(user);
+    writeSuccess(res, 200, 'SLA policy retrieved successfully', policy);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get SLA policy';
+    writeError(res, message.includes('company') ? 403 : 500, message);
+  }
+};
+
+export const updateMaintenanceSlaPolicy = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const policy = await maintenanceSlaService.updateSlaPolicy(req.body, user);
+    writeSuccess(res, 200, 'SLA policy updated successfully', policy);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update SLA policy';
+    const status = message.includes('permission') || message.includes('company') ? 403 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const getMaintenanceSlaReport = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const report = await maintenanceSlaService.getComplianceReport({
+      from: req.query.from as string,
+      to: req.query.to as string,
+      property_id: req.query.property_id as string,
+    }, user);
+    writeSuccess(res, 200, 'SLA compliance report retrieved successfully', report);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get SLA compliance report';
+    const status = message.includes('permission') ? 403 :
+                  message.includes('valid dates') ? 400 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const getMaintenanceCostSettings = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const settings = await maintenanceCostsService.getCostSettings(user);
+    writeSuccess(res, 200, 'Cost settings retrieved successfully', settings);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get cost settings';
+    writeError(res, message.includes('company') ? 403 : 500, message);
+  }
+};
+
+export const updateMaintenanceCostSettings = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const settings = await maintenanceCostsService.updateCostSettings(req.body.approval_threshold, user);
+    writeSuccess(res, 200, 'Cost settings updated successfully', settings);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update cost settings';
+    const status = message.includes('permission') || message.includes('company') ? 403 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const listPendingCostApprovals = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const requests = await maintenanceCostsService.listPendingApprovals(user);
+    writeSuccess(res, 200, 'Pending cost approvals retrieved successfully', requests);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get pending cost approvals';
+    writeError(res, message.includes('permission') ? 403 : 500, message);
+  }
+};
+
+export const requestMaintenanceCostApproval = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const request = await maintenanceCostsService.requestApproval(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, request.approval_required ? 'Cost submitted for approval' : 'Cost recorded successfully', request);
+  } catch (error: any) {
+    const message = error.message || 'Failed to submit cost for approval';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 :
+                  message.includes('already') ? 409 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const decideMaintenanceCost = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const request = await maintenanceCostsService.decideCost(req.params.id as string, req.body, user);
+    writeSuccess(res, 200, `Cost ${req.body.decision === 'approve' ? 'approved' : 'rejected'} successfully`, request);
+  } catch (error: any) {
+    const message = error.message || 'Failed to record cost decision';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 :
+                  message.includes('no cost awaiting') ? 409 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const addMaintenanceReceipt = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const receipts = await maintenanceCostsService.addReceipt(req.params.id as string, req.body, user);
+    writeSuccess(res, 201, 'Receipt added successfully', receipts);
+  } catch (error: any) {
+    const message = error.message || 'Failed to add receipt';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const removeMaintenanceReceipt = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const receipts = await maintenanceCostsService.removeReceipt(req.params.id as string, req.params.receiptId as string, user);
+    writeSuccess(res, 200, 'Receipt removed successfully', receipts);
+  } catch (error: any) {
+    const message = error.message || 'Failed to remove receipt';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 500;
+    writeError(res, status, message);
+  }
+};
+
+export const listMaintenanceBudgets = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const year = req.query.year ? parseInt(req.query.year as string) : new Date().getFullYear();
+    const budgets = await maintenanceCostsService.listBudgets(year, user);
+    writeSuccess(res, 200, 'Maintenance budgets retrieved successfully', budgets);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get maintenance budgets';
+    writeError(res, message.includes('permission') ? 403 : 500, message);
+  }
+};
+
+export const upsertMaintenanceBudget = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const budget = await maintenanceCostsService.upsertBudget(
+      req.params.propertyId as string,
+      parseInt(req.params.year as string),
+      req.body,
+      user
+    );
+    writeSuccess(res, 200, 'Maintenance budget saved successfully', budget);
+  } catch (error: any) {
+    const message = error.message || 'Failed to save maintenance budget';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 400;
+    writeError(res, status, message);
+  }
+};
+
+export const getMaintenanceBudgetBurnDown = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const report = await maintenanceCostsService.getBurnDown(
+      req.params.propertyId as string,
+      parseInt(req.params.year as string),
+      user
+    );
+    writeSuccess(res, 200, 'Budget burn-down retrieved successfully', report);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get budget burn-down';
+    const status = message.includes('not found') ? 404 :
+                  message.includes('permission') ? 403 : 500;
+    writeError(res, status, message);
+  }
+};
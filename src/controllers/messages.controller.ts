@@ -2,6 +2,7 @@ import { Request, Response } from 'express';
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import { writeSuccess, writeError } from '../utils/response.js';
+import { deletedAtFor } from '../services/notifications.service.js';
 
 const prisma = getPrisma();
 
@@ -444,7 +445,9 @@ export const messagesController = {
           await prisma.notification.update({
             where: { id },
             data: {
-              deleted_by_users: deletedByUsers
+              deleted_by_users: deletedByUsers,
+              deleted_at: deletedAtFor(message, deletedByUsers),
+              updated_at: new Date(),
             }
           });
         }
@@ -1,21 +1,43 @@
 import { Request, Response } from 'express';
+import multer from 'multer';
 import { messagingService } from '../services/messaging.service.js';
+import { messageTemplatesService } from '../services/message-templates.service.js';
+import { messageEscalationService } from '../services/message-escalation.service.js';
+import { communicationAnalyticsService } from '../services/communication-analytics.service.js';
+import {
+  messageAttachmentsService,
+  MAX_ATTACHMENT_BYTES,
+  MAX_ATTACHMENTS_PER_MESSAGE,
+} from '../services/message-attachments.service.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 import { JWTClaims } from '../types/index.js';
 import { getPrisma } from '../config/prisma.js';
+import { statusFor } from '../utils/error-status.js';
 
 const prisma = getPrisma();
 
+// Chat attachments; per-kind size limits are enforced by the service, this is only the hard cap
+const upload = multer({
+  storage: multer.memoryStorage(),
+  limits: {
+    fileSize: MAX_ATTACHMENT_BYTES,
+    files: MAX_ATTACHMENTS_PER_MESSAGE,
+  },
+});
+
+export const messageAttachmentUploadMiddleware = upload.array('attachments', MAX_ATTACHMENTS_PER_MESSAGE);
+
 export const messagingController = {
   getConversations: async (req: Request, res: Response) => {
     try {
       const user = (req as any).user as JWTClaims;
-      const { limit = 50, offset = 0 } = req.query;
+      const { limit = 50, offset = 0, archived } = req.query;
       
       const conversations = await messagingService.getConversations(
         user,
         Number(limit),
-        Number(offset)
+        Number(offset),
+        archived === 'true'
       );
       
       writeSuccess(res, 200, 'Conversations retrieved successfully', conversations);
@@ -27,7 +49,7 @@ export const messagingController = {
   createConversation: async (req: Request, res: Response) => {
     try {
       const user = (req as any).user as JWTClaims;
-      const { participantIds, isGroup, groupName } = req.body;
+      const { participantIds, isGroup, groupName, title } = req.body;
       
       if (!participantIds || !Array.isArray(participantIds) || participantIds.length === 0) {
         return writeError(res, 400, 'participantIds array is required');
@@ -37,7 +59,7 @@ export const messagingController = {
         user,
         participantIds,
         isGroup || false,
-        groupName
+        title || groupName
       );
       
       writeSuccess(res, 201, 'Conversation created successfully', conversation);
@@ -56,11 +78,13 @@ export const messagingController = {
         where: {
           conversation_id: id,
           user_id: user.user_id,
+          left_at: null,
         },
         include: {
           conversation: {
             include: {
               participants: {
+                where: { left_at: null },
                 include: {
                   user: {
                     select: {
@@ -105,7 +129,7 @@ export const messagingController = {
       
       writeSuccess(res, 200, 'Messages retrieved successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -122,27 +146,43 @@ export const messagingController = {
         replyToMessageId,
         attachments,
         metadata,
+        templateId,
+        templateVariables,
       } = req.body;
       
-      if (!content || !content.trim()) {
+      if (!templateId && (!content || !content.trim())) {
         return writeError(res, 400, 'Message content is required');
       }
       
       const message = await messagingService.createMessage(user, {
         conversationId,
         recipientIds: recipientIds || [],
-        content: content.trim(),
+        content: typeof content === 'string' ? content.trim() : '',
         subject,
         messageType,
         priority,
         replyToMessageId,
         attachments,
         metadata,
+        templateId,
+        templateVariables,
       });
       
       writeSuccess(res, 201, 'Message sent successfully', message);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  uploadAttachments: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const files = (req.files as Express.Multer.File[]) || [];
+      const conversationId = (req.body?.conversationId || req.query.conversationId) as string | undefined;
+      const attachments = await messageAttachmentsService.upload(files, user, conversationId);
+      writeSuccess(res, 201, 'Attachments uploaded successfully', { attachments });
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -163,7 +203,7 @@ export const messagingController = {
       
       writeSuccess(res, 200, 'Message updated successfully', message);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -188,7 +228,7 @@ export const messagingController = {
         result
       );
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -205,7 +245,7 @@ export const messagingController = {
       const result = await messagingService.addReaction(user, id, reactionType);
       writeSuccess(res, 200, 'Reaction added successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -217,7 +257,7 @@ export const messagingController = {
       const result = await messagingService.removeReaction(user, id, reactionType);
       writeSuccess(res, 200, 'Reaction removed successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -235,7 +275,7 @@ export const messagingController = {
       );
       writeSuccess(res, 200, 'Message pinned successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -247,29 +287,29 @@ export const messagingController = {
       const result = await messagingService.unpinMessage(user, conversationId, messageId);
       writeSuccess(res, 200, 'Message unpinned successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
   searchMessages: async (req: Request, res: Response) => {
     try {
       const user = (req as any).user as JWTClaims;
-      const { q, conversationId, limit = 50 } = req.query;
+      const { q, conversationId, limit = 20, offset = 0, sort } = req.query;
       
       if (!q || typeof q !== 'string') {
         return writeError(res, 400, 'Search query (q) is required');
       }
       
-      const messages = await messagingService.searchMessages(
-        user,
-        q,
-        conversationId as string | undefined,
-        Number(limit)
-      );
+      const result = await messagingService.searchMessages(user, q, {
+        conversationId: conversationId as string | undefined,
+        limit: Number(limit),
+        offset: Number(offset),
+        sort: sort as string | undefined,
+      });
       
-      writeSuccess(res, 200, 'Messages found successfully', messages);
+      writeSuccess(res, 200, 'Messages found successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -285,7 +325,29 @@ export const messagingController = {
       const result = await messagingService.updatePresence(user, status, message);
       writeSuccess(res, 200, 'Presence updated successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  getPresence: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const conversationId = req.query.conversation_id as string | undefined;
+      const propertyId = req.query.property_id as string | undefined;
+      if (conversationId || propertyId) {
+        const online = await messagingService.getOnlinePresence(user, { conversationId, propertyId });
+        return writeSuccess(res, 200, 'Presence retrieved successfully', online);
+      }
+
+      const userIds = String(req.query.userIds || '').split(',').map(id => id.trim()).filter(Boolean);
+      if (userIds.length === 0) {
+        return writeError(res, 400, 'userIds, conversation_id or property_id query parameter is required');
+      }
+
+      const result = await messagingService.getPresence(user, userIds);
+      writeSuccess(res, 200, 'Presence retrieved successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -305,7 +367,7 @@ export const messagingController = {
       );
       writeSuccess(res, 200, 'Typing indicator updated successfully', result);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, statusFor(error.message), error.message);
     }
   },
 
@@ -322,5 +384,262 @@ export const messagingController = {
       writeError(res, 500, error.message);
     }
   },
-};
 
+  markDelivered: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messagingService.markDelivered(user, req.body?.messageIds);
+      writeSuccess(res, 200, 'Messages marked as delivered', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  markConversationRead: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messagingService.markConversationRead(user, req.params.id, req.body?.upToMessageId);
+      writeSuccess(res, 200, 'Conversation marked as read', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  getMessageReceipts: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const receipts = await messagingService.getMessageReceipts(user, req.params.id);
+      writeSuccess(res, 200, 'Message receipts retrieved successfully', receipts);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  getUnreadCounts: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const counts = await messagingService.getUnreadCounts(user);
+      writeSuccess(res, 200, 'Unread counts retrieved successfully', counts);
+    } catch (error: any) {
+      writeError(res, 500, error.message);
+    }
+  },
+
+  updateConversation: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const conversation = await messagingService.updateConversation(user, req.params.id, req.body?.title);
+      writeSuccess(res, 200, 'Conversation updated successfully', conversation);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  addParticipants: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { userIds, role } = req.body || {};
+      const result = await messagingService.addParticipants(user, req.params.id, userIds, role);
+      writeSuccess(res, 200, 'Participants added successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  updateParticipantRole: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const participant = await messagingService.updateParticipantRole(user, req.params.id, req.params.userId, req.body?.role);
+      writeSuccess(res, 200, 'Participant role updated successfully', participant);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  removeParticipant: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messagingService.removeParticipant(user, req.params.id, req.params.userId);
+      writeSuccess(res, 200, 'Participant removed successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  leaveConversation: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messagingService.removeParticipant(user, req.params.id, user.user_id);
+      writeSuccess(res, 200, 'Left conversation', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  archiveConversation: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messagingService.setArchived(user, req.params.id, true);
+      writeSuccess(res, 200, 'Conversation archived', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  unarchiveConversation: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messagingService.setArchived(user, req.params.id, false);
+      writeSuccess(res, 200, 'Conversation unarchived', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  translateMessage: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const targetLanguage = req.body?.target_language || req.body?.targetLanguage || req.query.target_language;
+      const translation = await messagingService.translateMessage(user, req.params.id, targetLanguage as string);
+      writeSuccess(res, 200, 'Message translated successfully', translation);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  getTemplates: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messageTemplatesService.listTemplates(user, {
+        category: req.query.category as string,
+        search: req.query.search as string,
+      });
+      writeSuccess(res, 200, 'Templates retrieved successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  getTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const template = await messageTemplatesService.getTemplate(req.params.id, user);
+      writeSuccess(res, 200, 'Template retrieved successfully', template);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  createTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const template = await messageTemplatesService.createTemplate(req.body || {}, user);
+      writeSuccess(res, 201, 'Template created successfully', template);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  updateTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const template = await messageTemplatesService.updateTemplate(req.params.id, req.body || {}, user);
+      writeSuccess(res, 200, 'Template updated successfully', template);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  deleteTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      await messageTemplatesService.deleteTemplate(req.params.id, user);
+      writeSuccess(res, 200, 'Template deleted successfully');
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  // Composer preview: the template filled in for a recipient, before sending
+  renderTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { recipientId, variables } = req.body || {};
+      const result = await messageTemplatesService.render(req.params.id, user, recipientId, variables);
+      writeSuccess(res, 200, 'Template rendered successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+  getEscalationRules: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messageEscalationService.listRules(user);
+      writeSuccess(res, 200, 'Escalation rules retrieved successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  createEscalationRule: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const rule = await messageEscalationService.createRule(req.body || {}, user);
+      writeSuccess(res, 201, 'Escalation rule created successfully', rule);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  updateEscalationRule: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const rule = await messageEscalationService.updateRule(req.params.id, req.body || {}, user);
+      writeSuccess(res, 200, 'Escalation rule updated successfully', rule);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  deleteEscalationRule: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      await messageEscalationService.deleteRule(req.params.id, user);
+      writeSuccess(res, 200, 'Escalation rule deleted successfully');
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  // Audit trail of escalations the rules have fired
+  getEscalations: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await messageEscalationService.listEscalations(user, {
+        rule_id: req.query.rule_id as string,
+        conversation_id: req.query.conversation_id as string,
+        limit: req.query.limit ? parseInt(req.query.limit as string) : undefined,
+        offset: req.query.offset ? parseInt(req.query.offset as string) : undefined,
+      });
+      writeSuccess(res, 200, 'Escalations retrieved successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  // Volumes, first-response times, channels and busiest hours for a period
+  getAnalytics: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const analytics = await communicationAnalyticsService.getAnalytics(user, {
+        period: req.query.period as string,
+        from: req.query.from as string,
+        to: req.query.to as string,
+        timezone: req.query.timezone as string,
+      });
+      writeSuccess(res, 200, 'Communication analytics retrieved successfully', analytics);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+};
@@ -1,5 +1,7 @@
 import { Request, Response } from 'express';
 import { notificationsService } from '../services/notifications.service.js';
+import { notificationPreferencesService } from '../services/notification-preferences.service.js';
+import { notificationDeliveryService } from '../services/notification-delivery.service.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 import { JWTClaims } from '../types/index.js';
 
@@ -7,7 +9,7 @@ export const notificationsController = {
   getNotifications: async (req: Request, res: Response) => {
     try {
       const user = (req as any).user as JWTClaims;
-      const { limit = 10, offset = 0, category, status, priority, property_ids, notification_type } = req.query;
+      const { limit = 10, offset = 0, category, status, priority, property_ids, notification_type, types, unread_only } = req.query;
       
       // Parse property_ids (comma-separated) for super-admin filtering
       let propertyIds: string[] | undefined = undefined;
@@ -23,6 +25,8 @@ export const notificationsController = {
         ...(priority && { priority: priority as string }),
         ...(notification_type && { notification_type: notification_type as string }),
         ...(propertyIds && { property_ids: propertyIds }),
+        ...(types && { notification_types: (types as string).split(',').map(type => type.trim()).filter(Boolean) }),
+        ...(unread_only === 'true' && { unread_only: true }),
       };
 
       const notifications = await notificationsService.getNotifications(
@@ -104,8 +108,8 @@ export const notificationsController = {
   getUnreadCount: async (req: Request, res: Response) => {
     try {
       const user = (req as any).user as JWTClaims;
-      const count = await notificationsService.getUnreadCount(user);
-      writeSuccess(res, 200, 'Unread count retrieved successfully', { unreadCount: count });
+      const counts = await notificationsService.getUnreadCounts(user);
+      writeSuccess(res, 200, 'Unread count retrieved successfully', counts);
     } catch (error: any) {
       writeError(res, 500, error.message);
     }
@@ -114,7 +118,8 @@ export const notificationsController = {
   markAllAsRead: async (req: Request, res: Response) => {
     try {
       const user = (req as any).user as JWTClaims;
-      const result = await notificationsService.markAllAsRead(user);
+      const { notification_type, category } = { ...req.query, ...req.body } as { notification_type?: string; category?: string };
+      const result = await notificationsService.markAllAsRead(user, { notification_type, category });
       writeSuccess(res, 200, 'All notifications marked as read', result);
     } catch (error: any) {
       writeError(res, 500, error.message);
@@ -147,4 +152,103 @@ export const notificationsController = {
       writeError(res, 500, error.message);
     }
   },
+
+  createPropertyAnnouncement: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await notificationsService.createPropertyAnnouncement(user, req.params.propertyId, req.body || {});
+      writeSuccess(res, 201, 'Announcement sent successfully', result);
+    } catch (error: any) {
+      const message = error.message || 'Failed to send announcement';
+      const status = message.includes('not found') ? 404 :
+        message.includes('permission') ? 403 :
+        message.includes('required') || message.includes('must be') ? 400 : 500;
+      writeError(res, status, message);
+    }
+  },
+
+  getPreferences: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const matrix = await notificationPreferencesService.getMatrix(user.user_id);
+      writeSuccess(res, 200, 'Notification preferences retrieved successfully', matrix);
+    } catch (error: any) {
+      writeError(res, 500, error.message);
+    }
+  },
+
+  updatePreferences: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const matrix = await notificationPreferencesService.updateMatrix(user.user_id, req.body?.preferences);
+      writeSuccess(res, 200, 'Notification preferences updated successfully', matrix);
+    } catch (error: any) {
+      const message = error.message || 'Failed to update notification preferences';
+      const status = message.includes('must be') || message.includes('unknown') || message.includes('cannot') ? 400 : 500;
+      writeError(res, status, message);
+    }
+  },
+
+  resetPreference: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const matrix = await notificationPreferencesService.resetPreference(user.user_id, req.params.type);
+      writeSuccess(res, 200, 'Notification preference reset to default', matrix);
+    } catch (error: any) {
+      const message = error.message || 'Failed to reset notification preference';
+      writeError(res, message.includes('not found') ? 404 : 500, message);
+    }
+  },
+
+  getDeliveryStatus: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const status = await notificationDeliveryService.getDeliveryStatus(req.params.id as string, user);
+      writeSuccess(res, 200, 'Delivery status retrieved successfully', status);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get delivery status';
+      writeError(res, message.includes('not found') ? 404 : 500, message);
+    }
+  },
+
+  getDeadLetters: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { channel, limit, offset } = req.query;
+      const deadLetters = await notificationDeliveryService.listDeadLetters(user, {
+        channel: channel as string | undefined,
+        limit: limit ? Number(limit) : undefined,
+        offset: offset ? Number(offset) : undefined,
+      });
+      writeSuccess(res, 200, 'Dead-lettered deliveries retrieved successfully', deadLetters);
+    } catch (error: any) {
+      const message = error.message || 'Failed to get dead-lettered deliveries';
+      writeError(res, message.includes('permission') ? 403 : 500, message);
+    }
+  },
+
+  requeueDelivery: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const delivery = await notificationDeliveryService.requeue(req.params.deliveryId as string, user);
+      writeSuccess(res, 200, 'Delivery requeued successfully', delivery);
+    } catch (error: any) {
+      const message = error.message || 'Failed to requeue delivery';
+      const status = message.includes('not found') ? 404 :
+        message.includes('permission') ? 403 :
+        message.startsWith('Only') ? 409 : 500;
+      writeError(res, status, message);
+    }
+  },
+
+  requeueDeadLetters: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await notificationDeliveryService.requeueDeadLetters(user, req.body?.channel);
+      writeSuccess(res, 200, 'Dead-lettered deliveries requeued successfully', result);
+    } catch (error: any) {
+      const message = error.message || 'Failed to requeue dead-lettered deliveries';
+      writeError(res, message.includes('permission') ? 403 : 500, message);
+    }
+  },
 };
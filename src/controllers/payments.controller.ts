@@ -9,6 +9,7 @@ import { PaystackService } from '../services/paystack.service.js';
 import { JWTClaims } from '../types/index.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 import { getPrisma } from '../config/prisma.js';
+import { EXCEL_CONTENT_TYPE, EXCEL_FILE_EXTENSION } from '../utils/excel-export.js';
 
 const service = new PaymentsService();
 const paystackService = new PaystackService();
@@ -34,6 +35,24 @@ export const listPayments = async (req: Request, res: Response) => {
   }
 };
 
+export const exportPayments = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { format = 'xlsx', page, limit, ...filters } = req.query as Record<string, string>;
+
+    const exportData = await service.exportPayments(filters as PaymentFilters, user, format);
+    const isExcel = ['xlsx', 'excel'].includes(format);
+    const filename = `payments_${new Date().toISOString().split('T')[0]}.${isExcel ? EXCEL_FILE_EXTENSION : 'csv'}`;
+    res.setHeader('Content-Disposition', `attachment; filename="${filename}"`);
+    res.setHeader('Content-Type', isExcel ? EXCEL_CONTENT_TYPE : 'text/csv');
+    res.send(exportData);
+  } catch (error: any) {
+    const message = error.message || 'Failed to export payments';
+    const status = message.includes('permissions') ? 403 : message.includes('must be') ? 400 : 500;
+    writeError(res, status, message);
+  }
+};
+
 export const getPayment = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
@@ -68,7 +87,8 @@ export const createPayment = async (req: Request, res: Response) => {
   } catch (error: any) {
     const message = error.message || 'Failed to create payment';
     const status = message.includes('permissions') ? 403 :
-                  message.includes('not found') ? 404 : 500;
+                  message.includes('not found') ? 404 :
+                  message.includes('must') ? 400 : 500;
     writeError(res, status, message);
   }
 };
@@ -88,7 +108,8 @@ export const updatePayment = async (req: Request, res: Response) => {
   } catch (error: any) {
     const message = error.message || 'Failed to update payment';
     const status = message.includes('not found') ? 404 :
-                  message.includes('permissions') ? 403 : 500;
+                  message.includes('permissions') ? 403 :
+                  message.includes('must') ? 400 : 500;
     writeError(res, status, message);
   }
 };
@@ -2,6 +2,7 @@ import type { Request, Response } from 'express';
 import type { JWTClaims } from '../types/index.js';
 import { documentService } from '../modules/documents/document-service.js';
 import { reportsService } from '../services/reports.service.js';
+import { documentExportsService } from '../services/document-exports.service.js';
 
 function sendPdf(res: Response, filename: string, pdf: Buffer) {
   res.setHeader('Content-Type', 'application/pdf');
@@ -77,63 +78,8 @@ export const pdfDocumentsController = {
       const filters = req.query as any;
 
       // Use the existing reports service to generate data; then render via the central PDF system.
-      let reportData: any;
-      switch (type) {
-        case 'property':
-          reportData = await reportsService.getPropertyReport(user, filters);
-          break;
-        case 'financial': {
-          // Parse property_ids for services expecting array
-          const property_ids = filters.property_ids;
-          const propertyIdsArray =
-            typeof property_ids === 'string'
-              ? property_ids.split(',').map((id: string) => id.trim()).filter(Boolean)
-              : Array.isArray(property_ids)
-                ? property_ids.map((id: any) => String(id)).filter(Boolean)
-                : undefined;
-          reportData = await reportsService.getFinancialReport(user, filters.type || 'revenue', filters.period || 'monthly', propertyIdsArray);
-          break;
-        }
-        case 'occupancy': {
-          const property_ids = filters.property_ids;
-          const propertyIdsArray =
-            typeof property_ids === 'string'
-              ? property_ids.split(',').map((id: string) => id.trim()).filter(Boolean)
-              : Array.isArray(property_ids)
-                ? property_ids.map((id: any) => String(id)).filter(Boolean)
-                : undefined;
-          reportData = await reportsService.getOccupancyReport(user, filters.period || 'monthly', propertyIdsArray);
-          break;
-        }
-        case 'rent-collection':
-          reportData = await reportsService.getRentCollectionReport(user, filters);
-          break;
-        case 'maintenance': {
-          const property_ids = filters.property_ids;
-          const propertyIdsArray =
-            typeof property_ids === 'string'
-              ? property_ids.split(',').map((id: string) => id.trim()).filter(Boolean)
-              : Array.isArray(property_ids)
-                ? property_ids.map((id: any) => String(id)).filter(Boolean)
-                : undefined;
-          reportData = await reportsService.getMaintenanceReport(user, filters.period || 'monthly', filters, propertyIdsArray);
-          break;
-        }
-        default:
-          return res.status(400).json({ success: false, message: 'Invalid report type' });
-      }
-
-      const summary = reportData?.summary || reportData?.overview || {};
-      const rows =
-        reportData?.properties ||
-        reportData?.invoices ||
-        reportData?.requests ||
-        reportData?.unitDetails ||
-        reportData?.availableReports ||
-        [];
-
-      const title = String(type).replaceAll('-', ' ').toUpperCase();
-      const pdf = await documentService.getReportPdf(type, `LetRents — ${title} Report`, Array.isArray(rows) ? rows : [], summary, user, 1);
+      const report = await reportsService.getReportDocument(user, type, filters);
+      const pdf = await documentService.getReportPdf(type, report.title, report.rows, report.summary, user, 1, report.charts);
       sendPdf(res, `${type}_report.pdf`, pdf);
     } catch (error: any) {
       res.status(400).json({ success: false, message: error.message || 'Failed to generate report PDF' });
@@ -163,5 +109,49 @@ export const pdfDocumentsController = {
       res.status(400).json({ success: false, message: error.message || 'Failed to render report PDF' });
     }
   },
-};
 
+  // Background generation: returns at once; poll the export for its signed download_url
+  requestExport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const exportJob = await documentExportsService.request(req.body || {}, user);
+      res.status(202).json({ success: true, message: 'Export queued', data: exportJob });
+    } catch (error: any) {
+      const status = /not found/i.test(error.message) ? 404 : /permission/.test(error.message) ? 403 : 400;
+      res.status(status).json({ success: false, message: error.message || 'Failed to queue export' });
+    }
+  },
+
+  getExport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const exportJob = await documentExportsService.get(req.params.exportId, user);
+      res.status(200).json({ success: true, data: exportJob });
+    } catch (error: any) {
+      res.status(404).json({ success: false, message: error.message || 'Export not found' });
+    }
+  },
+
+  // A new signed link for a finished export; ?expires_in or body.expires_in in seconds
+  issueExportLink: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const expiresIn = req.body?.expires_in ?? req.query.expires_in;
+      const link = await documentExportsService.issueLink(req.params.exportId, user, expiresIn === undefined ? undefined : Number(expiresIn));
+      res.status(200).json({ success: true, message: 'Download link issued', data: link });
+    } catch (error: any) {
+      const status = /not found/i.test(error.message) ? 404 : /expired/.test(error.message) ? 410 : /not ready/.test(error.message) ? 409 : 400;
+      res.status(status).json({ success: false, message: error.message || 'Failed to issue download link' });
+    }
+  },
+
+  listExports: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const exports = await documentExportsService.list(user, parseInt(String(req.query.limit || '20'), 10) || 20);
+      res.status(200).json({ success: true, data: exports });
+    } catch (error: any) {
+      res.status(500).json({ success: false, message: error.message || 'Failed to list exports' });
+    }
+  },
+};
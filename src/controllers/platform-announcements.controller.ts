@@ -0,0 +1,30 @@
+import { Request, Response } from 'express';
+import { platformAnnouncementsService } from '../services/platform-announcements.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+/**
+ * Banners for the signed-in user: live, aimed at them and not yet dismissed
+ */
+export const getActiveAnnouncements = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const announcements = await platformAnnouncementsService.activeFor(user);
+    writeSuccess(res, 200, 'Announcements retrieved successfully', announcements);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve announcements';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const dismissAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const dismissal = await platformAnnouncementsService.dismiss(req.params.id, user);
+    writeSuccess(res, 200, 'Announcement dismissed', dismissal);
+  } catch (error: any) {
+    const message = error.message || 'Failed to dismiss announcement';
+    writeError(res, statusFor(message), message);
+  }
+};
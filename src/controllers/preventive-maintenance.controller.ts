@@ -0,0 +1,74 @@
+import { Request, Response } from 'express';
+import { preventiveMaintenanceService } from '../services/preventive-maintenance.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const listPreventiveSchedules = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const schedules = await preventiveMaintenanceService.listSchedules({
+      property_id: req.query.property_id as string,
+      is_active: req.query.is_active as string,
+    }, user);
+    writeSuccess(res, 200, 'Preventive maintenance schedules retrieved successfully', schedules);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get preventive maintenance schedules';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const createPreventiveSchedule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const schedule = await preventiveMaintenanceService.createSchedule(req.body, user);
+    writeSuccess(res, 201, 'Preventive maintenance schedule created successfully', schedule);
+  } catch (error: any) {
+    const message = error.message || 'Failed to create preventive maintenance schedule';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updatePreventiveSchedule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const schedule = await preventiveMaintenanceService.updateSchedule(req.params.id as string, req.body, user);
+    writeSuccess(res, 200, 'Preventive maintenance schedule updated successfully', schedule);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update preventive maintenance schedule';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const deletePreventiveSchedule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await preventiveMaintenanceService.deleteSchedule(req.params.id as string, user);
+    writeSuccess(res, 200, 'Preventive maintenance schedule deleted successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to delete preventive maintenance schedule';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getPreventiveScheduleHistory = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const history = await preventiveMaintenanceService.getHistory(req.params.id as string, user);
+    writeSuccess(res, 200, 'Preventive maintenance history retrieved successfully', history);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get preventive maintenance history';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const runPreventiveSchedule = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const occurrence = await preventiveMaintenanceService.runNow(req.params.id as string, user);
+    writeSuccess(res, 201, 'Preventive maintenance generated successfully', occurrence);
+  } catch (error: any) {
+    const message = error.message || 'Failed to generate preventive maintenance';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -24,7 +24,7 @@ export const createProperty = async (req: Request, res: Response) => {
   } catch (error: any) {
     const message = error.message || 'Failed to create property';
     const status = message.includes('permissions') ? 403 : 
-                  message.includes('company') ? 400 : 500;
+                  message.includes('company') || message.includes('must') ? 400 : 500;
     writeError(res, status, message);
   }
 };
@@ -63,7 +63,8 @@ export const updateProperty = async (req: Request, res: Response) => {
   } catch (error: any) {
     const message = error.message || 'Failed to update property';
     const status = message.includes('not found') ? 404 :
-                  message.includes('permissions') ? 403 : 500;
+                  message.includes('permissions') ? 403 :
+                  message.includes('must') ? 400 : 500;
     writeError(res, status, message);
   }
 };
@@ -102,6 +103,7 @@ export const listProperties = async (req: Request, res: Response) => {
       status: req.query.status as string,
       city: req.query.city as string,
       region: req.query.region as string,
+      county: req.query.county as string,
       country: req.query.country as string,
       min_units: req.query.min_units ? parseInt(req.query.min_units as string) : undefined,
       max_units: req.query.max_units ? parseInt(req.query.max_units as string) : undefined,
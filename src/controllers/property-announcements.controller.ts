@@ -0,0 +1,72 @@
+import { Request, Response } from 'express';
+import { propertyAnnouncementsService } from '../services/property-announcements.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const createAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const announcement = await propertyAnnouncementsService.createAnnouncement(req.body || {}, user);
+    writeSuccess(res, 201, 'Announcement posted to the property\'s tenants', announcement);
+  } catch (error: any) {
+    console.error('❌ Error posting property announcement:', error);
+    const message = error.message || 'Failed to post announcement';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const listAnnouncements = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await propertyAnnouncementsService.listAnnouncements(req.query as Record<string, string>, user);
+    writeSuccess(res, 200, 'Announcements retrieved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve announcements';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const announcement = await propertyAnnouncementsService.getAnnouncement(req.params.id as string, user);
+    writeSuccess(res, 200, 'Announcement retrieved successfully', announcement);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve announcement';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const acknowledgeAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const receipt = await propertyAnnouncementsService.acknowledgeAnnouncement(req.params.id as string, user);
+    writeSuccess(res, 200, 'Announcement acknowledged', receipt);
+  } catch (error: any) {
+    const message = error.message || 'Failed to acknowledge announcement';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getAcknowledgements = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await propertyAnnouncementsService.getAcknowledgements(req.params.id as string, user);
+    writeSuccess(res, 200, 'Acknowledgements retrieved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve acknowledgements';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const withdrawAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const announcement = await propertyAnnouncementsService.withdrawAnnouncement(req.params.id as string, user);
+    writeSuccess(res, 200, 'Announcement withdrawn', announcement);
+  } catch (error: any) {
+    const message = error.message || 'Failed to withdraw announcement';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -0,0 +1,65 @@
+import { Request, Response } from 'express';
+import { propertyDelegationsService } from '../services/property-delegations.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const listDelegations = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const delegations = await propertyDelegationsService.list(user, {
+      status: req.query.status as string | undefined,
+      property_id: req.query.property_id as string | undefined,
+      agency_id: req.query.agency_id as string | undefined,
+      landlord_id: req.query.landlord_id as string | undefined,
+    });
+    writeSuccess(res, 200, 'Property delegations retrieved successfully', delegations);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve property delegations';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getDelegation = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const delegation = await propertyDelegationsService.get(user, req.params.id);
+    writeSuccess(res, 200, 'Property delegation retrieved successfully', delegation);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve property delegation';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const createDelegation = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const delegations = await propertyDelegationsService.create(user, req.body || {});
+    writeSuccess(res, 201, 'Properties delegated successfully', delegations);
+  } catch (error: any) {
+    const message = error.message || 'Failed to delegate properties';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const updateDelegation = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const delegation = await propertyDelegationsService.update(user, req.params.id, req.body || {});
+    writeSuccess(res, 200, 'Property delegation updated successfully', delegation);
+  } catch (error: any) {
+    const message = error.message || 'Failed to update property delegation';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const endDelegation = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const delegation = await propertyDelegationsService.end(user, req.params.id, req.body?.reason);
+    writeSuccess(res, 200, 'Property delegation ended successfully', delegation);
+  } catch (error: any) {
+    const message = error.message || 'Failed to end property delegation';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -3,6 +3,14 @@ import { reportsService } from '../services/reports.service.js';
 import { writeSuccess, writeError } from '../utils/response.js';
 import { JWTClaims } from '../types/index.js';
 import { documentService } from '../modules/documents/document-service.js';
+import { EXCEL_CONTENT_TYPE, EXCEL_FILE_EXTENSION } from '../utils/excel-export.js';
+import { scheduledReportsService } from '../services/scheduled-reports.service.js';
+import { occupancyHistoryService } from '../services/occupancy-history.service.js';
+import { reportBuilderService } from '../services/report-builder.service.js';
+import { portfolioBenchmarksService } from '../services/portfolio-benchmarks.service.js';
+import { reportAuditService } from '../services/report-audit.service.js';
+import { agencyReportsService } from '../services/agency-reports.service.js';
+import { statusFor } from '../utils/error-status.js';
 
 export const reportsController = {
   getReports: async (req: Request, res: Response) => {
@@ -101,6 +109,158 @@ export const reportsController = {
     }
   },
 
+  getArrearsAgingReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { property_ids, ...filters } = req.query as Record<string, any>;
+
+      let propertyIdsArray: string[] | undefined = undefined;
+      if (property_ids) {
+        propertyIdsArray = String(property_ids).split(',').map(id => id.trim()).filter(id => id.length > 0);
+      }
+
+      const report = await reportsService.getArrearsAgingReport(user, { ...filters, property_ids: propertyIdsArray });
+      writeSuccess(res, 200, 'Arrears aging report generated successfully', report);
+    } catch (error: any) {
+      writeError(res, 500, error.message);
+    }
+  },
+
+  getRentRollReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { property_ids, ...filters } = req.query as Record<string, any>;
+
+      let propertyIdsArray: string[] | undefined = undefined;
+      if (property_ids) {
+        propertyIdsArray = String(property_ids).split(',').map(id => id.trim()).filter(id => id.length > 0);
+      }
+
+      const report = await reportsService.getRentRollReport(user, { ...filters, property_ids: propertyIdsArray });
+      writeSuccess(res, 200, 'Rent roll report generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate rent roll report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getProfitLossReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { property_ids, ...filters } = req.query as Record<string, any>;
+
+      let propertyIdsArray: string[] | undefined = undefined;
+      if (property_ids) {
+        propertyIdsArray = String(property_ids).split(',').map(id => id.trim()).filter(id => id.length > 0);
+      }
+
+      const report = await reportsService.getProfitLossReport(user, { ...filters, property_ids: propertyIdsArray });
+      writeSuccess(res, 200, 'Profit and loss statement generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate profit and loss statement';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getBudgetVarianceReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const report = await reportsService.getReportData(user, 'budget-variance', req.query as Record<string, any>);
+      writeSuccess(res, 200, 'Budget variance report generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate budget variance report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getTaxSummaryReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const report = await reportsService.getReportData(user, 'tax-summary', req.query as Record<string, any>);
+      writeSuccess(res, 200, 'Tax summary report generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate tax summary report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getBenchmarkingReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { property_ids } = req.query as Record<string, any>;
+
+      let propertyIdsArray: string[] | undefined = undefined;
+      if (property_ids) {
+        propertyIdsArray = String(property_ids).split(',').map(id => id.trim()).filter(id => id.length > 0);
+      }
+
+      const report = await portfolioBenchmarksService.getBenchmarks(user, { property_ids: propertyIdsArray });
+      writeSuccess(res, 200, 'Benchmarking report generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate benchmarking report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getAgencyRollupReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { start_date, end_date, agency_id, company_id, property_ids } = req.query as Record<string, any>;
+      const report = await agencyReportsService.getRollup(user, {
+        start_date,
+        end_date,
+        agency_id,
+        company_id,
+        property_ids: property_ids ? String(property_ids).split(',').map(id => id.trim()).filter(id => id.length > 0) : undefined,
+      });
+      writeSuccess(res, 200, 'Agency report generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate agency report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getAgencyLandlordReport: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { start_date, end_date, agency_id, company_id } = req.query as Record<string, any>;
+      const report = await agencyReportsService.getLandlordDetail(user, req.params.ownerId as string, { start_date, end_date, agency_id, company_id });
+      writeSuccess(res, 200, 'Agency landlord report generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to generate agency landlord report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getOccupancyTrend: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { property_ids, months } = req.query as Record<string, any>;
+
+      let propertyIdsArray: string[] | undefined = undefined;
+      if (property_ids) {
+        propertyIdsArray = String(property_ids).split(',').map(id => id.trim()).filter(id => id.length > 0);
+      }
+
+      const trend = await occupancyHistoryService.getTrend(user, { months: Number(months) || 12, property_ids: propertyIdsArray });
+      writeSuccess(res, 200, 'Occupancy trend retrieved successfully', trend);
+    } catch (error: any) {
+      const message = error.message || 'Failed to retrieve occupancy trend';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  backfillOccupancy: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await occupancyHistoryService.backfill(user, Number(req.body?.months) || 24);
+      writeSuccess(res, 200, 'Occupancy history backfilled successfully', result);
+    } catch (error: any) {
+      const message = error.message || 'Failed to backfill occupancy history';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
   getMaintenanceReport: async (req: Request, res: Response) => {
     try {
       const user = (req as any).user as JWTClaims;
@@ -136,64 +296,9 @@ export const reportsController = {
 
       // PDF export is handled by the centralized document renderer for uniform output.
       if (String(format) === 'pdf') {
-        // Convert property_ids query param to string array (consistent with other report endpoints)
-        let propertyIdsArray: string[] | undefined = undefined;
-        const property_ids = (filters as any).property_ids;
-        if (property_ids) {
-          if (typeof property_ids === 'string') {
-            propertyIdsArray = property_ids.split(',').map((id: string) => id.trim()).filter((id: string) => id.length > 0);
-          } else if (Array.isArray(property_ids)) {
-            propertyIdsArray = property_ids.map((id: any) => String(id)).filter((id: string) => id.length > 0);
-          }
-        }
-
-        // Reuse the same data selection logic as the report endpoints.
-        let reportData: any;
-        switch (type) {
-          case 'property':
-            reportData = await reportsService.getPropertyReport(user, filters);
-            break;
-          case 'financial': {
-            const period = (filters as any).period || 'monthly';
-            const kind = (filters as any).type || 'revenue';
-            // reports.service already parses property_ids in some places; allow both string and array.
-            reportData = await reportsService.getFinancialReport(user, kind, period, propertyIdsArray);
-            break;
-          }
-          case 'occupancy': {
-            const period = (filters as any).period || 'monthly';
-            reportData = await reportsService.getOccupancyReport(user, period, propertyIdsArray);
-            break;
-          }
-          case 'rent-collection':
-            reportData = await reportsService.getRentCollectionReport(user, filters);
-            break;
-          case 'maintenance': {
-            const period = (filters as any).period || 'monthly';
-            reportData = await reportsService.getMaintenanceReport(user, period, filters, propertyIdsArray);
-            break;
-          }
-          default:
-            return writeError(res, 400, 'Invalid report type for export');
-        }
-
-        const summary = reportData?.summary || reportData?.overview || {};
-        const rows =
-          reportData?.properties ||
-          reportData?.invoices ||
-          reportData?.requests ||
-          reportData?.unitDetails ||
-          reportData?.availableReports ||
-          [];
-        const title = String(type).replaceAll('-', ' ').toUpperCase();
-        const pdf = await documentService.getReportPdf(
-          type,
-          `LetRents — ${title} Report`,
-          Array.isArray(rows) ? rows : [],
-          summary,
-          user,
-          1
-        );
+        // Same data selection as the report endpoints, plus the charts drawn from it
+        const report = await reportsService.getReportDocument(user, type, filters);
+        const pdf = await documentService.getReportPdf(type, report.title, report.rows, report.summary, user, 1, report.charts);
 
         const filename = `${type}_report_${new Date().toISOString().split('T')[0]}.pdf`;
         res.setHeader('Content-Disposition', `attachment; filename="${filename}"`);
@@ -204,13 +309,189 @@ export const reportsController = {
       const exportData = await reportsService.exportReport(user, type, String(format), filters);
 
       // Set appropriate headers for file download
-      const filename = `${type}_report_${new Date().toISOString().split('T')[0]}.${format}`;
+      const isExcel = ['xlsx', 'excel'].includes(String(format));
+      const extension = isExcel ? EXCEL_FILE_EXTENSION : format;
+      const filename = `${type}_report_${new Date().toISOString().split('T')[0]}.${extension}`;
       res.setHeader('Content-Disposition', `attachment; filename="${filename}"`);
-      res.setHeader('Content-Type', String(format) === 'csv' ? 'text/csv' : 'application/json');
+      res.setHeader('Content-Type', isExcel ? EXCEL_CONTENT_TYPE : String(format) === 'csv' ? 'text/csv' : 'application/json');
 
       return res.send(exportData);
     } catch (error: any) {
-      writeError(res, 500, error.message);
+      writeError(res, error.message?.startsWith('Invalid report type') ? 400 : 500, error.message);
+    }
+  },
+
+  getSchedules: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const schedules = await scheduledReportsService.list(user);
+      writeSuccess(res, 200, 'Scheduled reports retrieved successfully', schedules);
+    } catch (error: any) {
+      const message = error.message || 'Failed to retrieve scheduled reports';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  createSchedule: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const schedule = await scheduledReportsService.create(req.body || {}, user);
+      writeSuccess(res, 201, 'Scheduled report created successfully', schedule);
+    } catch (error: any) {
+      const message = error.message || 'Failed to create scheduled report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  updateSchedule: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const schedule = await scheduledReportsService.update(req.params.id, req.body || {}, user);
+      writeSuccess(res, 200, 'Scheduled report updated successfully', schedule);
+    } catch (error: any) {
+      const message = error.message || 'Failed to update scheduled report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  deleteSchedule: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      await scheduledReportsService.delete(req.params.id, user);
+      writeSuccess(res, 200, 'Scheduled report deleted successfully', null);
+    } catch (error: any) {
+      const message = error.message || 'Failed to delete scheduled report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getScheduleRuns: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const limit = req.query.limit ? parseInt(req.query.limit as string) || 20 : 20;
+      const runs = await scheduledReportsService.listRuns(req.params.id, user, limit);
+      writeSuccess(res, 200, 'Scheduled report runs retrieved successfully', runs);
+    } catch (error: any) {
+      const message = error.message || 'Failed to retrieve scheduled report runs';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  issueScheduleRunLink: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const expiresIn = req.body?.expires_in ?? req.query.expires_in;
+      const link = await scheduledReportsService.issueRunLink(
+        req.params.id as string,
+        req.params.runId as string,
+        user,
+        expiresIn === undefined ? undefined : Number(expiresIn),
+      );
+      writeSuccess(res, 200, 'Download link issued', link);
+    } catch (error: any) {
+      const message = error.message || 'Failed to issue download link';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  runSchedule: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const run = await scheduledReportsService.runNow(req.params.id, user);
+      writeSuccess(res, 200, run.status === 'success' ? 'Scheduled report sent successfully' : 'Scheduled report run failed', run);
+    } catch (error: any) {
+      const message = error.message || 'Failed to run scheduled report';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getTemplateOptions: async (req: Request, res: Response) => {
+    writeSuccess(res, 200, 'Report builder options retrieved successfully', reportBuilderService.getOptions());
+  },
+
+  getTemplates: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const templates = await reportBuilderService.list(user);
+      writeSuccess(res, 200, 'Report templates retrieved successfully', templates);
+    } catch (error: any) {
+      const message = error.message || 'Failed to retrieve report templates';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  getTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const template = await reportBuilderService.get(req.params.id as string, user);
+      writeSuccess(res, 200, 'Report template retrieved successfully', template);
+    } catch (error: any) {
+      const message = error.message || 'Failed to retrieve report template';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  createTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const template = await reportBuilderService.create(req.body || {}, user);
+      writeSuccess(res, 201, 'Report template created successfully', template);
+    } catch (error: any) {
+      const message = error.message || 'Failed to create report template';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  updateTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const template = await reportBuilderService.update(req.params.id as string, req.body || {}, user);
+      writeSuccess(res, 200, 'Report template updated successfully', template);
+    } catch (error: any) {
+      const message = error.message || 'Failed to update report template';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  deleteTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      await reportBuilderService.delete(req.params.id as string, user);
+      writeSuccess(res, 200, 'Report template deleted successfully', null);
+    } catch (error: any) {
+      const message = error.message || 'Failed to delete report template';
+      writeError(res, statusFor(message), message);
+    }
+  },
+
+  runTemplate: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const report = await reportBuilderService.run(req.params.id as string, user, req.query as Record<string, any>);
+      writeSuccess(res, 200, 'Report generated successfully', report);
+    } catch (error: any) {
+      const message = error.message || 'Failed to run report template';
+      writeError(res, statusFor(message), message);
+    }
+  },
+  getReportAuditTrail: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const { company_id, user_id, report_type, action, start_date, end_date, page, limit } = req.query as Record<string, any>;
+      const trail = await reportAuditService.list(user, {
+        company_id,
+        user_id,
+        report_type,
+        action,
+        start_date,
+        end_date,
+        page: Number(page) || undefined,
+        limit: Number(limit) || undefined,
+      });
+      writeSuccess(res, 200, 'Report audit trail retrieved successfully', trail);
+    } catch (error: any) {
+      const message = error.message || 'Failed to retrieve report audit trail';
+      writeError(res, statusFor(message), message);
     }
   },
 };
@@ -0,0 +1,106 @@
+import { Request, Response } from 'express';
+import { ShortStayService, CreateBookingRequest } from '../services/short-stay.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+const service = new ShortStayService();
+
+export const getUnitCalendar = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const calendar = await service.getCalendar(
+      req.params.id as string,
+      user,
+      req.query.from as string | undefined,
+      req.query.to as string | undefined
+    );
+    writeSuccess(res, 200, 'Unit calendar retrieved successfully', calendar);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve unit calendar';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getUnitAvailability = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { check_in, check_out } = req.query as Record<string, string>;
+    if (!check_in || !check_out) {
+      return writeError(res, 400, 'check_in and check_out are required');
+    }
+
+    const availability = await service.checkAvailability(req.params.id as string, check_in, check_out, user);
+    writeSuccess(res, 200, 'Availability retrieved successfully', availability);
+  } catch (error: any) {
+    const message = error.message || 'Failed to check availability';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getShortStayQuote = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { check_in, check_out } = req.query as Record<string, string>;
+    if (!check_in || !check_out) {
+      return writeError(res, 400, 'check_in and check_out are required');
+    }
+
+    const quote = await service.getQuote(req.params.id as string, check_in, check_out, user);
+    writeSuccess(res, 200, 'Short-stay quote calculated successfully', quote);
+  } catch (error: any) {
+    const message = error.message || 'Failed to calculate quote';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const createUnitBooking = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const bookingData: CreateBookingRequest = req.body;
+    if (!bookingData.check_in || !bookingData.check_out) {
+      return writeError(res, 400, 'check_in and check_out are required');
+    }
+
+    const booking = await service.createBooking(req.params.id as string, bookingData, user);
+    writeSuccess(res, 201, 'Booking created successfully', booking);
+  } catch (error: any) {
+    const message = error.message || 'Failed to create booking';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const cancelUnitBooking = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await service.cancelBooking(req.params.id as string, req.params.bookingId as string, user);
+    writeSuccess(res, 200, 'Booking cancelled successfully', null);
+  } catch (error: any) {
+    const message = error.message || 'Failed to cancel booking';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const exportUnitICal = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const ics = await service.exportICal(req.params.id as string, user);
+    res.setHeader('Content-Type', 'text/calendar; charset=utf-8');
+    res.setHeader('Content-Disposition', `attachment; filename="unit-${req.params.id}.ics"`);
+    res.status(200).send(ics);
+  } catch (error: any) {
+    const message = error.message || 'Failed to export calendar';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const syncUnitExternalCalendar = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await service.syncExternalCalendar(req.params.id as string, user);
+    writeSuccess(res, 200, 'External calendar synced successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to sync external calendar';
+    writeError(res, statusFor(message), message);
+  }
+};
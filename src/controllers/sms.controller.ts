@@ -0,0 +1,57 @@
+import { Request, Response } from 'express';
+import { smsService } from '../services/sms.service.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { JWTClaims } from '../types/index.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const smsController = {
+  getMessages: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await smsService.getMessages(req.query as any, user);
+      writeSuccess(res, 200, 'SMS messages retrieved successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  getUsage: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const usage = await smsService.getUsage(req.query as any, user);
+      writeSuccess(res, 200, 'SMS usage retrieved successfully', usage);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  getSettings: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const settings = await smsService.getSettings(user, req.query.company_id as string | undefined);
+      writeSuccess(res, 200, 'SMS settings retrieved successfully', settings);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  updateSettings: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const settings = await smsService.updateSettings(req.body || {}, user);
+      writeSuccess(res, 200, 'SMS settings updated successfully', settings);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+
+  sendTest: async (req: Request, res: Response) => {
+    try {
+      const user = (req as any).user as JWTClaims;
+      const result = await smsService.sendTestSms(req.body || {}, user);
+      writeSuccess(res, 200, 'Test SMS sent successfully', result);
+    } catch (error: any) {
+      writeError(res, statusFor(error.message), error.message);
+    }
+  },
+};
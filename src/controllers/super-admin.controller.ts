@@ -4,35 +4,21 @@ import { writeSuccess, writeError } from '../utils/response.js';
 import bcrypt from 'bcryptjs';
 import { JWTClaims } from '../types/index.js';
 import { getPrisma } from '../config/prisma.js';
+import { platformAnalyticsService, resolveAnalyticsRange, RegionGrouping } from '../services/platform-analytics.service.js';
+import { agencyHealthService } from '../services/agency-health.service.js';
+import { chartDataService } from '../services/chart-data.service.js';
+import { parseChartPeriod } from '../utils/chart-period.js';
 
 const prisma = getPrisma();
 
 // Dashboard and Analytics
 export const getDashboardData = async (req: Request, res: Response) => {
   try {
-    // Extract date range filter from query parameters
-    const dateRange = req.query.date_range as string || '30d';
-    
-    // Calculate start date based on date range filter
-    const now = new Date();
-    let startDate: Date;
-    
-    switch (dateRange) {
-      case '7d':
-        startDate = new Date(now.getTime() - 7 * 24 * 60 * 60 * 1000);
-        break;
-      case '30d':
-        startDate = new Date(now.getTime() - 30 * 24 * 60 * 60 * 1000);
-        break;
-      case '90d':
-        startDate = new Date(now.getTime() - 90 * 24 * 60 * 60 * 1000);
-        break;
-      case '1y':
-        startDate = new Date(now.getTime() - 365 * 24 * 60 * 60 * 1000);
-        break;
-      default:
-        startDate = new Date(now.getTime() - 30 * 24 * 60 * 60 * 1000); // Default to 30 days
-    }
+    // Date range filter: a preset (7d, 30d, 90d, 1y, ytd) or start_date/end_date
+    const range = resolveAnalyticsRange(req.query as Record<string, any>);
+    const dateRange = range.label;
+    const startDate = range.start;
+    const endDate = range.end;
     
     // Get system-wide statistics using raw SQL to avoid enum issues
     const [
@@ -59,6 +45,7 @@ export const getDashboardData = async (req: Request, res: Response) => {
         FROM payments 
         WHERE status IN ('approved'::payment_status, 'completed'::payment_status)
           AND payment_date >= ${startDate}::timestamp
+          AND payment_date <= ${endDate}::timestamp
       `,
       // Subscription Revenue: Sum of subscription payments platform receives from landlords/agencies
       // This includes:
@@ -73,6 +60,7 @@ export const getDashboardData = async (req: Request, res: Response) => {
             WHERE status = 'paid'
               AND paid_at IS NOT NULL
               AND paid_at >= ${startDate}::timestamp
+              AND paid_at <= ${endDate}::timestamp
           ) +
           (
             SELECT COALESCE(SUM(amount), 0)::numeric 
@@ -80,6 +68,7 @@ export const getDashboardData = async (req: Request, res: Response) => {
             WHERE status IN ('active'::subscription_status, 'trial'::subscription_status)
               AND metadata->>'created_from_payment' = 'true'
               AND created_at >= ${startDate}::timestamp
+              AND created_at <= ${endDate}::timestamp
           ),
           0
         )::numeric as total
@@ -118,6 +107,10 @@ export const getDashboardData = async (req: Request, res: Response) => {
     const debug = Array.isArray(debugBillingInvoices) ? debugBillingInvoices[0] : {};
     
     const monthlyRevenue = rentRevenue + subscriptionRevenue;
+    const [ytdRevenue, byRegion] = await Promise.all([
+      platformAnalyticsService.getYearToDateRevenue(),
+      platformAnalyticsService.getByRegion(range),
+    ]);
     
     // Debug logging to verify calculations
     console.log('📊 Revenue Calculations:', {
@@ -214,9 +207,11 @@ export const getDashboardData = async (req: Request, res: Response) => {
         monthly_revenue: monthlyRevenue, // Total revenue (for backward compatibility)
         subscription_revenue: subscriptionRevenue, // Subscription revenue
         rental_revenue: rentRevenue, // Rental revenue from occupied units
-        ytd_revenue: monthlyRevenue * 12, // Simplified calculation
+        ytd_revenue: ytdRevenue.total,
         occupancy_rate: totalUnits > 0 ? Math.round((Number(occupiedUnits) / totalUnits) * 100) : 0,
       },
+      date_range: { label: dateRange, start: startDate.toISOString(), end: endDate.toISOString() },
+      by_region: byRegion,
       recent_activities: recentActivities,
       system_alerts: systemAlerts,
     };
@@ -224,113 +219,20 @@ export const getDashboardData = async (req: Request, res: Response) => {
     writeSuccess(res, 200, 'Dashboard data retrieved successfully', dashboardData);
   } catch (err: any) {
     console.error('Error fetching dashboard data:', err);
-    writeError(res, 500, 'Failed to fetch dashboard data', err.message);
+    writeError(res, err.message?.includes('must') ? 400 : 500, 'Failed to fetch dashboard data', err.message);
   }
 };
 
 export const getKPIMetrics = async (req: Request, res: Response) => {
   try {
-    const [
-      rentRevenue,
-      subscriptionRevenue,
-      totalProperties,
-      totalTenants,
-      occupancyData
-    ] = await Promise.all([
-      // Rental Revenue: Sum of ALL payments landlords/agencies receive from tenants
-      // Includes: rent, utilities, maintenance, late fees, penalties, security deposits, etc.
-      // This is all tenant-to-landlord/agency payments (all payment types)
-      prisma.$queryRaw`
-        SELECT COALESCE(SUM(amount), 0)::numeric as total 
-        FROM payments 
-        WHERE status IN ('approved'::payment_status, 'completed'::payment_status)
-      `,
-      // Subscription Revenue: Sum of subscription payments platform receives from landlords/agencies
-      // This includes:
-      // 1. Paid billing_invoices (recurring subscription payments)
-      // 2. Subscriptions created from direct payments (initial subscription payments)
-      prisma.$queryRaw`
-        SELECT COALESCE(
-          (
-            SELECT COALESCE(SUM(amount), 0)::numeric 
-            FROM billing_invoices 
-            WHERE status = 'paid'
-              AND paid_at IS NOT NULL
-          ) +
-          (
-            SELECT COALESCE(SUM(amount), 0)::numeric 
-            FROM subscriptions 
-            WHERE status IN ('active'::subscription_status, 'trial'::subscription_status)
-              AND metadata->>'created_from_payment' = 'true'
-          ),
-          0
-        )::numeric as total
-      `,
-      prisma.$queryRaw`SELECT COUNT(*)::int as count FROM properties`,
-      prisma.$queryRaw`SELECT COUNT(*)::int as count FROM users WHERE role = 'tenant'::user_role AND status = 'active'::user_status`,
-      prisma.$queryRaw`SELECT COUNT(*)::int as total, SUM(CASE WHEN status = 'occupied' THEN 1 ELSE 0 END)::int as occupied FROM units`
-    ]);
-
-    const rentRev = Array.isArray(rentRevenue) ? Number((rentRevenue[0] as any)?.total || 0) : 0;
-    const subRev = Array.isArray(subscriptionRevenue) ? Number((subscriptionRevenue[0] as any)?.total || 0) : 0;
-    const revenue = rentRev + subRev; // Total revenue (for backward compatibility)
-    const properties = Array.isArray(totalProperties) ? Number((totalProperties[0] as any)?.count || 0) : 0;
-    const tenants = Array.isArray(totalTenants) ? Number((totalTenants[0] as any)?.count || 0) : 0;
-    const occupancy = Array.isArray(occupancyData) ? occupancyData[0] as any : { total: 0, occupied: 0 };
-    const occupancyRate = occupancy.total > 0 ? Math.round((occupancy.occupied / occupancy.total) * 100) : 0;
-
-    const kpis = [
-      {
-        id: '1',
-        title: 'Subscription Revenue',
-        value: subRev,
-        format: 'currency',
-        change: '+15.8%',
-        trend: 'up' as const,
-        period: 'vs last month'
-      },
-      {
-        id: '2',
-        title: 'Total Rental Revenue',
-        value: rentRev,
-        format: 'currency',
-        change: '+12.5%',
-        trend: 'up' as const,
-        period: 'vs last month'
-      },
-      {
-        id: '3',
-        title: 'Properties',
-        value: properties,
-        format: 'number',
-        change: '+2',
-        trend: 'up' as const,
-        period: 'vs last month'
-      },
-      {
-        id: '4',
-        title: 'Active Tenants',
-        value: tenants,
-        format: 'number',
-        change: '+8.3%',
-        trend: 'up' as const,
-        period: 'vs last month'
-      },
-      {
-        id: '5',
-        title: 'Occupancy Rate',
-        value: occupancyRate,
-        format: 'percentage',
-        change: '+2.1%',
-        trend: 'up' as const,
-        period: 'vs last month'
-      }
-    ];
+    // Each KPI is compared with the window of the same length before the range
+    const range = resolveAnalyticsRange(req.query as Record<string, any>);
+    const kpis = await platformAnalyticsService.getKpis(range);
 
     writeSuccess(res, 200, 'KPI metrics retrieved successfully', kpis);
   } catch (err: any) {
     console.error('Error fetching KPI metrics:', err);
-    writeError(res, 500, 'Failed to fetch KPI metrics', err.message);
+    writeError(res, err.message?.includes('must') ? 400 : 500, 'Failed to fetch KPI metrics', err.message);
   }
 };
 
@@ -656,190 +558,57 @@ export const getAuditLogs = async (req: Request, res: Response) => {
 
 export const getAnalyticsChart = async (req: Request, res: Response) => {
   try {
+    const user = (req as any).user as JWTClaims;
     const { chartType } = req.params;
-    const period = req.query.period as string || '30d';
-
-    // Calculate date range based on period
-    let days = 30;
-    if (period === '7d') days = 7;
-    else if (period === '90d') days = 90;
-    else if (period === '1y') days = 365;
-
-    const labels: string[] = [];
-    const data: number[] = [];
-    const startDate = new Date();
-    startDate.setDate(startDate.getDate() - days);
-
-    // Generate date labels
-    for (let i = days - 1; i >= 0; i--) {
-      const date = new Date();
-      date.setDate(date.getDate() - i);
-      labels.push(date.toISOString().split('T')[0]);
-    }
-
-    // Fetch real data based on chart type
-    switch (chartType) {
-      case 'revenue': {
-        // Get daily revenue from billing invoices and rental revenue
-        // Query subscription revenue separately
-        const subscriptionRevenueData = await prisma.$queryRaw<any[]>`
-          SELECT 
-            date.date::date as date,
-            COALESCE(SUM(bi.amount), 0)::numeric as subscription_revenue
-          FROM generate_series(${startDate}::date, CURRENT_DATE, '1 day'::interval) as date
-          LEFT JOIN billing_invoices bi ON DATE(bi.paid_at) = date.date::date AND bi.status = 'paid'
-          GROUP BY date.date::date
-          ORDER BY date.date::date
-        `;
-
-        // Query subscription revenue from direct payments
-        const directSubscriptionRevenueData = await prisma.$queryRaw<any[]>`
-          SELECT 
-            date.date::date as date,
-            COALESCE(SUM(s.amount), 0)::numeric as direct_subscription_revenue
-          FROM generate_series(${startDate}::date, CURRENT_DATE, '1 day'::interval) as date
-          LEFT JOIN subscriptions s ON DATE(s.created_at) = date.date::date 
-            AND s.status IN ('active', 'trial')
-            AND (s.metadata->>'created_from_payment')::boolean = true
-            AND NOT EXISTS (
-              SELECT 1 FROM billing_invoices bi2 
-              WHERE bi2.subscription_id = s.id 
-              AND DATE(bi2.paid_at) = date.date::date
-            )
-          GROUP BY date.date::date
-          ORDER BY date.date::date
-        `;
-
-        // Query rental revenue
-        const rentalRevenueData = await prisma.$queryRaw<any[]>`
-          SELECT 
-            date.date::date as date,
-            COALESCE(SUM(u.rent_amount), 0)::numeric as rental_revenue
-          FROM generate_series(${startDate}::date, CURRENT_DATE, '1 day'::interval) as date
-          LEFT JOIN units u ON DATE(u.updated_at) = date.date::date AND u.status = 'occupied'
-          GROUP BY date.date::date
-          ORDER BY date.date::date
-        `;
-
-        // Combine all revenue sources
-        const revenueMap = new Map<string, number>();
-        
-        subscriptionRevenueData.forEach((row: any) => {
-          const dateStr = row.date ? new Date(row.date).toISOString().split('T')[0] : null;
-          if (dateStr) {
-            revenueMap.set(dateStr, Number(row.subscription_revenue || 0));
-          }
-        });
-
-        directSubscriptionRevenueData.forEach((row: any) => {
-          const dateStr = row.date ? new Date(row.date).toISOString().split('T')[0] : null;
-          if (dateStr) {
-            const current = revenueMap.get(dateStr) || 0;
-            revenueMap.set(dateStr, current + Number(row.direct_subscription_revenue || 0));
-          }
-        });
-
-        rentalRevenueData.forEach((row: any) => {
-          const dateStr = row.date ? new Date(row.date).toISOString().split('T')[0] : null;
-          if (dateStr) {
-            const current = revenueMap.get(dateStr) || 0;
-            revenueMap.set(dateStr, current + Number(row.rental_revenue || 0));
-          }
-        });
-
-        labels.forEach(label => {
-          data.push(revenueMap.get(label) || 0);
-        });
-        break;
-      }
-      case 'occupancy': {
-        // Get daily occupancy rates - get current total units and occupied units per day
-        const occupancyData = await prisma.$queryRaw<any[]>`
-          SELECT 
-            date.date::date as date,
-            COUNT(*) FILTER (WHERE u.status = 'occupied')::numeric as occupied,
-            COUNT(*)::numeric as total
-          FROM generate_series(${startDate}::date, CURRENT_DATE, '1 day'::interval) as date
-          LEFT JOIN units u ON u.updated_at <= date.date::date + INTERVAL '1 day'
-            AND (u.created_at <= date.date::date + INTERVAL '1 day' OR u.status = 'occupied')
-          GROUP BY date.date::date
-          ORDER BY date.date::date
-        `;
-
-        const occupancyMap = new Map<string, number>();
-        occupancyData.forEach((row: any) => {
-          const dateStr = row.date ? new Date(row.date).toISOString().split('T')[0] : null;
-          if (dateStr) {
-            const total = Number(row.total || 0);
-            const occupied = Number(row.occupied || 0);
-            if (total > 0) {
-              occupancyMap.set(dateStr, (occupied / total) * 100);
-            } else {
-              occupancyMap.set(dateStr, 0);
-            }
-          }
-        });
-
-        labels.forEach(label => {
-          data.push(occupancyMap.get(label) || 0);
-        });
-        break;
-      }
-      case 'tenants': {
-        // Get daily tenant counts
-        const tenantData = await prisma.$queryRaw<any[]>`
-          SELECT 
-            DATE(created_at) as date,
-            COUNT(*)::numeric as count
-          FROM users
-          WHERE role = 'tenant'
-            AND created_at >= ${startDate}::timestamp
-          GROUP BY DATE(created_at)
-          ORDER BY DATE(created_at)
-        `;
-
-        const tenantMap = new Map();
-        let cumulative = 0;
-        tenantData.forEach((row: any) => {
-          const dateStr = row.date ? new Date(row.date).toISOString().split('T')[0] : null;
-          if (dateStr) {
-            cumulative += Number(row.count || 0);
-            tenantMap.set(dateStr, cumulative);
-          }
-        });
-
-        // Get total tenants before start date
-        const initialCount = await prisma.user.count({
-          where: {
-            role: 'tenant',
-            created_at: { lt: startDate }
-          }
-        });
-
-        labels.forEach(label => {
-          const count = tenantMap.get(label);
-          data.push(count !== undefined ? initialCount + count : initialCount);
-        });
-        break;
-      }
-      default:
-        labels.forEach(() => data.push(0));
-    }
-
-    const chartData = { labels, data };
+    // Real series bucketed over a validated period; unknown chart types and periods are rejected
+    const period = parseChartPeriod(req.query as Record<string, any>);
+    const chartData = await chartDataService.getChart(user, chartType as string, period);
 
     writeSuccess(res, 200, `${chartType} chart data retrieved successfully`, chartData);
   } catch (err: any) {
+    if (err.message?.includes('must') || err.message?.includes('required')) {
+      return writeError(res, 400, err.message);
+    }
     console.error('Error fetching analytics chart:', err);
     writeError(res, 500, 'Failed to fetch analytics chart', err.message);
   }
 };
 
+export const getAnalyticsHistory = async (req: Request, res: Response) => {
+  try {
+    // Defaults to a year of monthly points
+    const query = req.query as Record<string, any>;
+    const period = parseChartPeriod(query.period || query.date_range || query.from || query.start_date ? query : { ...query, period: 'last_12m' });
+    const history = await platformAnalyticsService.getHistory(period);
+    writeSuccess(res, 200, 'Analytics history retrieved successfully', history);
+  } catch (err: any) {
+    if (err.message?.includes('must') || err.message?.includes('required')) {
+      return writeError(res, 400, err.message);
+    }
+    console.error('Error fetching analytics history:', err);
+    writeError(res, 500, 'Failed to fetch analytics history', err.message);
+  }
+};
+
+export const captureAnalyticsSnapshot = async (req: Request, res: Response) => {
+  try {
+    // The nightly job does this; capturing now replaces today's row
+    const snapshot = await platformAnalyticsService.captureSnapshot();
+    writeSuccess(res, 200, 'Analytics snapshot captured successfully', snapshot);
+  } catch (err: any) {
+    console.error('Error capturing analytics snapshot:', err);
+    writeError(res, 500, 'Failed to capture analytics snapshot', err.message);
+  }
+};
+
 // System Settings
+const settingStatusFor = (message: string) =>
+  message.includes('not found') ? 404 :
+  message.includes('Invalid') ? 400 : 500;
+
 export const getSystemSettings = async (req: Request, res: Response) => {
   try {
-    const { SystemSettingsService } = await import('../services/system-settings.service.js');
-    const service = new SystemSettingsService();
+    const { systemSettingsService: service } = await import('../services/system-settings.service.js');
     const user = (req as any).user;
     
     const category = req.query.category as string | undefined;
@@ -861,8 +630,7 @@ export const getSystemSettings = async (req: Request, res: Response) => {
 
 export const updateSystemSettings = async (req: Request, res: Response) => {
   try {
-    const { SystemSettingsService } = await import('../services/system-settings.service.js');
-    const service = new SystemSettingsService();
+    const { systemSettingsService: service } = await import('../services/system-settings.service.js');
     const user = (req as any).user;
     
     const { key } = req.params;
@@ -881,14 +649,13 @@ export const updateSystemSettings = async (req: Request, res: Response) => {
     writeSuccess(res, 200, 'System setting updated successfully', updatedSetting);
   } catch (err: any) {
     console.error('Error updating system setting:', err);
-    writeError(res, 500, 'Failed to update system setting', err.message);
+    writeError(res, settingStatusFor(err.message || ''), 'Failed to update system setting', err.message);
   }
 };
 
 export const bulkUpdateSystemSettings = async (req: Request, res: Response) => {
   try {
-    const { SystemSettingsService } = await import('../services/system-settings.service.js');
-    const service = new SystemSettingsService();
+    const { systemSettingsService: service } = await import('../services/system-settings.service.js');
     const user = (req as any).user;
     
     const settings = req.body;
@@ -902,14 +669,13 @@ export const bulkUpdateSystemSettings = async (req: Request, res: Response) => {
     writeSuccess(res, 200, 'System settings updated successfully', updatedSettings);
   } catch (err: any) {
     console.error('Error bulk updating system settings:', err);
-    writeError(res, 500, 'Failed to update system settings', err.message);
+    writeError(res, settingStatusFor(err.message || ''), 'Failed to update system settings', err.message);
   }
 };
 
 export const initializeSystemSettings = async (req: Request, res: Response) => {
   try {
-    const { SystemSettingsService } = await import('../services/system-settings.service.js');
-    const service = new SystemSettingsService();
+    const { systemSettingsService: service } = await import('../services/system-settings.service.js');
     const user = (req as any).user;
     
     await service.initializeDefaultSettings(user);
@@ -922,37 +688,328 @@ export const initializeSystemSettings = async (req: Request, res: Response) => {
   }
 };
 
-// Security Logs
-export const getSecurityLogs = async (req: Request, res: Response) => {
+// Who changed which setting; ?key= narrows to one setting
+export const getSystemSettingHistory = async (req: Request, res: Response) => {
   try {
-    const page = parseInt(req.query.page as string) || 1;
-    const limit = parseInt(req.query.limit as string) || 50;
+    const { systemSettingsService } = await import('../services/system-settings.service.js');
+    const history = await systemSettingsService.getChangeHistory({
+      key: (req.params.key || req.query.key) as string | undefined,
+      page: parseInt(req.query.page as string) || 1,
+      limit: parseInt(req.query.limit as string) || 50,
+    });
 
-    // Mock security logs for now
-    const logs = [
-      {
-        id: '1',
-        event_type: 'login_success',
-        user_email: 'admin@letrents.com',
-        ip_address: '192.168.1.1',
-        user_agent: 'Mozilla/5.0...',
-        timestamp: new Date().toISOString(),
-        details: { method: 'email_password' }
-      }
-    ];
+    writeSuccess(res, 200, 'System setting history retrieved successfully', history);
+  } catch (err: any) {
+    console.error('Error fetching system setting history:', err);
+    writeError(res, 500, 'Failed to fetch system setting history', err.message);
+  }
+};
 
-    const securityData = {
-      logs: logs,
-      total: 1,
-      page: page,
-      limit: limit,
-      pages: 1
-    };
+// Settings flagged public, as typed values; served without authentication
+export const getPublicSystemSettings = async (req: Request, res: Response) => {
+  try {
+    const { systemSettingsService } = await import('../services/system-settings.service.js');
+    const settings = await systemSettingsService.getPublicSettings();
+
+    writeSuccess(res, 200, 'Public settings retrieved successfully', settings);
+  } catch (err: any) {
+    console.error('Error fetching public system settings:', err);
+    writeError(res, 500, 'Failed to fetch public settings', err.message);
+  }
+};
+
+// Platform-wide search for support staff: ?q=0712&types=users,invoices&limit=10
+export const platformSearch = async (req: Request, res: Response) => {
+  try {
+    const { adminSearchService } = await import('../services/admin-search.service.js');
+    const user = (req as any).user;
+    const types = req.query.types ? String(req.query.types).split(',').map(type => type.trim()).filter(Boolean) : undefined;
+
+    const results = await adminSearchService.search(user, {
+      q: req.query.q as string | undefined,
+      types,
+      limit: parseInt(req.query.limit as string) || undefined,
+    });
+
+    writeSuccess(res, 200, 'Search completed successfully', results);
+  } catch (err: any) {
+    const message = err.message || '';
+    const status = message.includes('permissions') ? 403 :
+                  message.includes('at least') || message.includes('invalid') ? 400 : 500;
+    writeError(res, status, 'Failed to search platform', message);
+  }
+};
+
+// Tenant directory across every company: ?agency_id=&company_id=&property_id=&status=&in_arrears=&flagged=&search=
+const tenantDirectoryFilters = (req: Request) => {
+  const flag = (value: unknown) => (value === 'true' ? true : value === 'false' ? false : undefined);
+  return {
+    agency_id: req.query.agency_id as string | undefined,
+    company_id: req.query.company_id as string | undefined,
+    property_id: req.query.property_id as string | undefined,
+    status: req.query.status as string | undefined,
+    in_arrears: flag(req.query.in_arrears),
+    flagged: flag(req.query.flagged),
+    search: req.query.search as string | undefined,
+    page: parseInt(req.query.page as string) || 1,
+    limit: parseInt(req.query.limit as string) || 25,
+  };
+};
+
+export const getAllTenants = async (req: Request, res: Response) => {
+  try {
+    const { tenantDirectoryService } = await import('../services/tenant-directory.service.js');
+    const user = (req as any).user;
+    const directory = await tenantDirectoryService.list(user, tenantDirectoryFilters(req));
+
+    writeSuccess(res, 200, 'Tenants retrieved successfully', directory);
+  } catch (err: any) {
+    console.error('Error fetching tenant directory:', err);
+    writeError(res, err.message?.includes('permissions') ? 403 : 500, 'Failed to fetch tenants', err.message);
+  }
+};
+
+export const exportAllTenants = async (req: Request, res: Response) => {
+  try {
+    const { tenantDirectoryService } = await import('../services/tenant-directory.service.js');
+    const { EXCEL_CONTENT_TYPE, EXCEL_FILE_EXTENSION } = await import('../utils/excel-export.js');
+    const user = (req as any).user;
+    const format = (req.query.format as string) || 'xlsx';
+
+    const exportData = await tenantDirectoryService.export(user, tenantDirectoryFilters(req), format);
+    const isExcel = ['xlsx', 'excel'].includes(format);
+    const filename = `platform_tenants_${new Date().toISOString().split('T')[0]}.${isExcel ? EXCEL_FILE_EXTENSION : 'csv'}`;
+    res.setHeader('Content-Disposition', `attachment; filename="${filename}"`);
+    res.setHeader('Content-Type', isExcel ? EXCEL_CONTENT_TYPE : 'text/csv');
+    res.send(exportData);
+  } catch (err: any) {
+    console.error('Error exporting tenant directory:', err);
+    const status = err.message?.includes('permissions') ? 403 : err.message?.includes('must be') ? 400 : 500;
+    writeError(res, status, 'Failed to export tenants', err.message);
+  }
+};
+
+// Security Logs
+export const getSecurityLogs = async (req: Request, res: Response) => {
+  try {
+    // Sign-ins and failed sign-ins from the system log
+    const { systemLogsService } = await import('../services/system-logs.service.js');
+    const event = req.query.event as string | undefined;
+    const securityData = await systemLogsService.list({
+      events: event === 'login' || event === 'login_failed' ? [event] : ['login', 'login_failed'],
+      user_id: req.query.user_id as string | undefined,
+      search: req.query.search as string | undefined,
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+      page: parseInt(req.query.page as string) || 1,
+      limit: parseInt(req.query.limit as string) || 50,
+    });
 
     writeSuccess(res, 200, 'Security logs retrieved successfully', securityData);
   } catch (err: any) {
     console.error('Error fetching security logs:', err);
-    writeError(res, 500, 'Failed to fetch security logs', err.message);
+    writeError(res, err.message?.includes('must be') ? 400 : 500, 'Failed to fetch security logs', err.message);
+  }
+};
+
+/**
+ * Structured application logs: request errors, slow requests, sign-ins and admin actions
+ */
+export const getSystemLogs = async (req: Request, res: Response) => {
+  try {
+    const { systemLogsService } = await import('../services/system-logs.service.js');
+    const logs = await systemLogsService.list({
+      level: req.query.level as string | undefined,
+      service: req.query.service as string | undefined,
+      event: req.query.event as string | undefined,
+      user_id: req.query.user_id as string | undefined,
+      status_code: req.query.status_code as string | undefined,
+      search: req.query.search as string | undefined,
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+      page: parseInt(req.query.page as string) || 1,
+      limit: parseInt(req.query.limit as string) || 50,
+    });
+    writeSuccess(res, 200, 'System logs retrieved successfully', logs);
+  } catch (err: any) {
+    console.error('Error fetching system logs:', err);
+    writeError(res, err.message?.includes('must be') ? 400 : 500, 'Failed to fetch system logs', err.message);
+  }
+};
+
+/**
+ * Errors by service, failed sign-in spikes and slow endpoints over a period (the last day by default)
+ */
+export const getOperationsDashboard = async (req: Request, res: Response) => {
+  try {
+    const { systemLogsService } = await import('../services/system-logs.service.js');
+    const overview = await systemLogsService.getOperationsOverview({
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+    });
+    writeSuccess(res, 200, 'Operations dashboard retrieved successfully', overview);
+  } catch (err: any) {
+    console.error('Error fetching operations dashboard:', err);
+    writeError(res, err.message?.includes('must be') ? 400 : 500, 'Failed to fetch operations dashboard', err.message);
+  }
+};
+
+/**
+ * Writes made by super admins, newest first
+ */
+export const getAdminActivity = async (req: Request, res: Response) => {
+  try {
+    const { systemLogsService } = await import('../services/system-logs.service.js');
+    const activity = await systemLogsService.listAdminActivity({
+      user_id: req.query.user_id as string | undefined,
+      service: req.query.service as string | undefined,
+      search: req.query.search as string | undefined,
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+      page: parseInt(req.query.page as string) || 1,
+      limit: parseInt(req.query.limit as string) || 50,
+    });
+    writeSuccess(res, 200, 'Admin activity retrieved successfully', activity);
+  } catch (err: any) {
+    console.error('Error fetching admin activity:', err);
+    writeError(res, err.message?.includes('must be') ? 400 : 500, 'Failed to fetch admin activity', err.message);
+  }
+};
+
+export const getRetentionPolicies = async (req: Request, res: Response) => {
+  try {
+    const { dataRetentionService } = await import('../services/data-retention.service.js');
+    const policies = await dataRetentionService.listPolicies();
+    writeSuccess(res, 200, 'Retention policies retrieved successfully', policies);
+  } catch (err: any) {
+    console.error('Error fetching retention policies:', err);
+    writeError(res, 500, 'Failed to fetch retention policies', err.message);
+  }
+};
+
+export const updateRetentionPolicy = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { dataRetentionService } = await import('../services/data-retention.service.js');
+    const policy = await dataRetentionService.updatePolicy(user, req.params.key, req.body || {});
+    writeSuccess(res, 200, 'Retention policy updated successfully', policy);
+  } catch (err: any) {
+    const status = err.message?.includes('not found') ? 404 : err.message?.includes('must') || err.message?.includes('required') ? 400 : 500;
+    writeError(res, status, 'Failed to update retention policy', err.message);
+  }
+};
+
+/**
+ * Apply retention now. Dry run unless dry_run is false, so the report can be checked first.
+ */
+export const runRetentionPolicies = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { dataRetentionService } = await import('../services/data-retention.service.js');
+    const keys = req.body?.policies;
+    if (keys !== undefined && (!Array.isArray(keys) || keys.some((key: unknown) => typeof key !== 'string'))) {
+      return writeError(res, 400, 'policies must be a list of policy keys');
+    }
+    const report = await dataRetentionService.run({ dryRun: req.body?.dry_run !== false, keys, user });
+    writeSuccess(res, 200, report.dry_run ? 'Retention dry run completed' : 'Retention policies applied', report);
+  } catch (err: any) {
+    console.error('Error running retention policies:', err);
+    writeError(res, err.message?.includes('unknown') ? 400 : 500, 'Failed to run retention policies', err.message);
+  }
+};
+
+export const getRetentionRuns = async (req: Request, res: Response) => {
+  try {
+    const { dataRetentionService } = await import('../services/data-retention.service.js');
+    const runs = await dataRetentionService.listRuns({
+      policy_key: req.query.policy_key as string | undefined,
+      dry_run: req.query.dry_run as string | undefined,
+      page: parseInt(req.query.page as string) || 1,
+      limit: parseInt(req.query.limit as string) || 50,
+    });
+    writeSuccess(res, 200, 'Retention runs retrieved successfully', runs);
+  } catch (err: any) {
+    console.error('Error fetching retention runs:', err);
+    writeError(res, 500, 'Failed to fetch retention runs', err.message);
+  }
+};
+
+const announcementStatusFor = (message: string) =>
+  message.includes('not found') ? 404 :
+  message.includes('only draft') || message.includes('already') || message.includes('archived') ? 409 :
+  message.includes('must') || message.includes('required') ? 400 : 500;
+
+export const getPlatformAnnouncements = async (req: Request, res: Response) => {
+  try {
+    const { platformAnnouncementsService } = await import('../services/platform-announcements.service.js');
+    const announcements = await platformAnnouncementsService.list({
+      status: req.query.status as string | undefined,
+      type: req.query.type as string | undefined,
+      page: parseInt(req.query.page as string) || 1,
+      limit: parseInt(req.query.limit as string) || 50,
+    });
+    writeSuccess(res, 200, 'Platform announcements retrieved successfully', announcements);
+  } catch (err: any) {
+    console.error('Error fetching platform announcements:', err);
+    writeError(res, 500, 'Failed to fetch platform announcements', err.message);
+  }
+};
+
+/**
+ * One announcement with how many users it reaches and how many dismissed it
+ */
+export const getPlatformAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const { platformAnnouncementsService } = await import('../services/platform-announcements.service.js');
+    const announcement = await platformAnnouncementsService.get(req.params.id);
+    writeSuccess(res, 200, 'Platform announcement retrieved successfully', announcement);
+  } catch (err: any) {
+    writeError(res, announcementStatusFor(err.message || ''), 'Failed to fetch platform announcement', err.message);
+  }
+};
+
+export const createPlatformAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { platformAnnouncementsService } = await import('../services/platform-announcements.service.js');
+    const announcement = await platformAnnouncementsService.create(req.body || {}, user);
+    writeSuccess(res, 201, 'Platform announcement created as a draft', announcement);
+  } catch (err: any) {
+    writeError(res, announcementStatusFor(err.message || ''), 'Failed to create platform announcement', err.message);
+  }
+};
+
+export const updatePlatformAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { platformAnnouncementsService } = await import('../services/platform-announcements.service.js');
+    const announcement = await platformAnnouncementsService.update(req.params.id, req.body || {}, user);
+    writeSuccess(res, 200, 'Platform announcement updated successfully', announcement);
+  } catch (err: any) {
+    writeError(res, announcementStatusFor(err.message || ''), 'Failed to update platform announcement', err.message);
+  }
+};
+
+export const publishPlatformAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { platformAnnouncementsService } = await import('../services/platform-announcements.service.js');
+    const announcement = await platformAnnouncementsService.publish(req.params.id, user);
+    writeSuccess(res, 200, 'Platform announcement published', announcement);
+  } catch (err: any) {
+    console.error('Error publishing platform announcement:', err);
+    writeError(res, announcementStatusFor(err.message || ''), 'Failed to publish platform announcement', err.message);
+  }
+};
+
+export const archivePlatformAnnouncement = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { platformAnnouncementsService } = await import('../services/platform-announcements.service.js');
+    const announcement = await platformAnnouncementsService.archive(req.params.id, user);
+    writeSuccess(res, 200, 'Platform announcement archived', announcement);
+  } catch (err: any) {
+    writeError(res, announcementStatusFor(err.message || ''), 'Failed to archive platform announcement', err.message);
   }
 };
 
@@ -1462,208 +1519,105 @@ export const deleteCompany = async (req: Request, res: Response) => {
 };
 
 // Agency Management
+const agencyStatusFor = (message: string) =>
+  message.includes('not found') ? 404 :
+  message.includes('already') || message.includes('must') || message.includes('required') ? 400 : 500;
+
 export const getAgencyManagement = async (req: Request, res: Response) => {
   try {
-    const status = req.query.status as string | undefined;
-    const limitVal = parseInt(req.query.limit as string);
-    const limit = req.query.limit != null && !isNaN(limitVal) ? Math.min(limitVal, 100) : undefined;
-    const offset = Math.max(0, parseInt(req.query.offset as string) || 0);
-    const search = (req.query.search as string)?.trim();
-
-    console.log('🔍 getAgencyManagement called', { status, limit, offset, search });
-
-    const where: any = {};
-    if (status && status !== 'all') {
-      where.status = status;
-    }
-    if (search) {
-      where.OR = [
-        { name: { contains: search, mode: 'insensitive' } },
-        { email: { contains: search, mode: 'insensitive' } },
-        { address: { contains: search, mode: 'insensitive' } },
-      ];
-    }
-
-    const [agencies, total] = await Promise.all([
-      prisma.agency.findMany({
-        where,
-        include: {
-          company: {
-            select: {
-              id: true,
-              name: true
-            }
-          }
-        },
-        orderBy: { created_at: 'desc' },
-        ...(limit !== undefined && { take: limit, skip: offset }),
-      }),
-      prisma.agency.count({ where }),
-    ]);
-
-    // Transform to match expected format
-    const agenciesData = agencies.map(agency => ({
-      id: agency.id,
-      name: agency.name,
-      email: agency.email,
-      phone_number: agency.phone_number,
-      address: agency.address,
-      status: agency.status,
-      created_at: agency.created_at,
-      updated_at: agency.updated_at,
-      company_id: agency.company_id || null,
-      company_name: agency.company?.name || null
-    }));
-
-    writeSuccess(res, 200, 'Agencies retrieved successfully', {
-      agencies: agenciesData,
-      total,
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const result = await agenciesService.list({
+      status: req.query.status as string | undefined,
+      search: req.query.search as string | undefined,
+      company_id: req.query.company_id as string | undefined,
+      limit: req.query.limit != null ? parseInt(req.query.limit as string) : undefined,
+      offset: parseInt(req.query.offset as string) || 0,
     });
+    writeSuccess(res, 200, 'Agencies retrieved successfully', result);
   } catch (err: any) {
     console.error('Error fetching agencies:', err);
-    writeError(res, 500, 'Failed to fetch agencies', err.message);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to fetch agencies', err.message);
   }
 };
 
-export const createAgency = async (req: Request, res: Response) => {
-  try {
-    const { name, email, phone_number, address, company_id, created_by } = req.body;
-
-    const newAgency = await prisma.$queryRaw`
-      INSERT INTO agencies (name, email, phone_number, address, company_id, created_by, status)
-      VALUES (${name}, ${email}, ${phone_number}, ${address}, ${company_id}::uuid, ${created_by}::uuid, 'pending')
-      RETURNING id, name, email, phone_number, address, status, created_at
-    `;
-
-    writeSuccess(res, 201, 'Agency created successfully', newAgency);
+export const createAgency = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const agency = await agenciesService.create(req.body || {}, user);
+    writeSuccess(res, 201, 'Agency created successfully', agency);
   } catch (err: any) {
     console.error('Error creating agency:', err);
-    writeError(res, 500, 'Failed to create agency', err.message);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to create agency', err.message);
   }
 };
 
 export const getAgencyById = async (req: Request, res: Response) => {
   try {
-    console.log('🔍 getAgencyById called with ID:', req.params.id);
-    const { id } = req.params;
-
-    const agency = await prisma.agency.findUnique({
-      where: { id },
-      include: {
-        company: {
-          select: {
-            id: true,
-            name: true
-          }
-        }
-      }
-    });
-
-    if (!agency) {
-      return writeError(res, 404, 'Agency not found');
-    }
-
-    // Get counts of properties and units for this agency
-    const [propertiesCount, unitsCount, landlordsCount, agentsCount] = await Promise.all([
-      prisma.property.count({ where: { agency_id: id } }),
-      prisma.unit.count({ 
-        where: { 
-          property: { agency_id: id } 
-        } 
-      }),
-      agency.company_id ? prisma.user.count({ 
-        where: { 
-          role: 'landlord',
-          company_id: agency.company_id 
-        } 
-      }) : Promise.resolve(0),
-      agency.company_id ? prisma.user.count({ 
-        where: { 
-          role: 'agent',
-          OR: [
-            { agency_id: id },
-            { company_id: agency.company_id }
-          ]
-        } 
-      }) : prisma.user.count({ 
-        where: { 
-          role: 'agent',
-          agency_id: id 
-        } 
-      })
-    ]);
-
-    // Calculate monthly revenue from occupied units
-    const occupiedUnits = await prisma.unit.findMany({
-      where: {
-        status: 'occupied',
-        property: { agency_id: id }
-      },
-      select: {
-        rent_amount: true
-      }
-    });
-
-    const monthlyRevenue = occupiedUnits.reduce((sum, unit) => {
-      return sum + (Number(unit.rent_amount) || 0);
-    }, 0);
-
-    // Combine agency data with statistics
-    const agencyWithStats = {
-      ...agency,
-      total_properties: propertiesCount,
-      total_units: unitsCount,
-      total_landlords: landlordsCount,
-      total_agents: agentsCount,
-      monthly_revenue: monthlyRevenue
-    };
-
-    console.log('✅ Agency stats:', {
-      id,
-      properties: propertiesCount,
-      units: unitsCount,
-      landlords: landlordsCount,
-      agents: agentsCount,
-      revenue: monthlyRevenue
-    });
-
-    writeSuccess(res, 200, 'Agency retrieved successfully', agencyWithStats);
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const agency = await agenciesService.get(req.params.id as string);
+    writeSuccess(res, 200, 'Agency retrieved successfully', agency);
   } catch (err: any) {
     console.error('Error fetching agency:', err);
-    writeError(res, 500, 'Failed to fetch agency', err.message);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to fetch agency', err.message);
   }
 };
 
 export const updateAgency = async (req: Request, res: Response) => {
   try {
-    const { id } = req.params;
-    const { name, email, phone_number, address, status } = req.body;
-
-    const updatedAgency = await prisma.$queryRaw`
-      UPDATE agencies 
-      SET name = ${name}, email = ${email}, phone_number = ${phone_number}, 
-          address = ${address}, status = ${status}
-      WHERE id = ${id}::uuid
-      RETURNING id, name, email, phone_number, address, status, updated_at
-    `;
-
-    writeSuccess(res, 200, 'Agency updated successfully', updatedAgency);
+    const user = (req as any).user as JWTClaims;
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const agency = await agenciesService.update(req.params.id as string, req.body || {}, user);
+    writeSuccess(res, 200, 'Agency updated successfully', agency);
   } catch (err: any) {
     console.error('Error updating agency:', err);
-    writeError(res, 500, 'Failed to update agency', err.message);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to update agency', err.message);
   }
 };
 
 export const deleteAgency = async (req: Request, res: Response) => {
   try {
-    const { id } = req.params;
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const result = await agenciesService.delete(req.params.id as string);
+    writeSuccess(res, 200, 'Agency deleted successfully', result);
+  } catch (err: any) {
+    console.error('Error deleting agency:', err);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to delete agency', err.message);
+  }
+};
+
+export const suspendAgency = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const result = await agenciesService.suspend(req.params.id as string, req.body?.reason, user);
+    writeSuccess(res, 200, 'Agency suspended successfully', result);
+  } catch (err: any) {
+    console.error('Error suspending agency:', err);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to suspend agency', err.message);
+  }
+};
 
-    await prisma.$queryRaw`DELETE FROM agencies WHERE id = ${id}::uuid`;
+export const reactivateAgency = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const result = await agenciesService.reactivate(req.params.id as string, req.body?.reason, user);
+    writeSuccess(res, 200, 'Agency reactivated successfully', result);
+  } catch (err: any) {
+    console.error('Error reactivating agency:', err);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to reactivate agency', err.message);
+  }
+};
 
-    writeSuccess(res, 200, 'Agency deleted successfully', { id });
+export const getAgencyStatusHistory = async (req: Request, res: Response) => {
+  try {
+    const { agenciesService } = await import('../services/agencies.service.js');
+    const history = await agenciesService.getStatusHistory(req.params.id as string);
+    writeSuccess(res, 200, 'Agency status history retrieved successfully', history);
   } catch (err: any) {
-    console.error('Error deleting agency:', err);
-    writeError(res, 500, 'Failed to delete agency', err.message);
+    console.error('Error fetching agency status history:', err);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to fetch agency status history', err.message);
   }
 };
 
@@ -1793,12 +1747,15 @@ export const getAgencyUnits = async (req: Request, res: Response) => {
 // Additional endpoints for frontend compatibility
 export const getPlatformAnalytics = async (req: Request, res: Response) => {
   try {
+    const range = resolveAnalyticsRange(req.query as Record<string, any>);
     const [
       totalAgencies,
       totalProperties,
       unitsResult,
-      rentRevenue,
-      subscriptionRevenue,
+      rentRoll,
+      revenue,
+      ytdRevenue,
+      byRegion,
       activeTenantsResult,
       independentLandlordsResult,
       agentsResult,
@@ -1808,7 +1765,9 @@ export const getPlatformAnalytics = async (req: Request, res: Response) => {
       prisma.$queryRaw`SELECT COUNT(*)::int as count FROM properties`,
       prisma.$queryRaw`SELECT COUNT(*)::int as count, status FROM units GROUP BY status`,
       prisma.$queryRaw`SELECT COALESCE(SUM(rent_amount), 0)::numeric as total FROM units WHERE status = 'occupied'`,
-      prisma.$queryRaw`SELECT COALESCE(SUM(amount), 0)::numeric as total FROM billing_invoices WHERE status = 'paid' AND paid_at >= NOW() - INTERVAL '30 days'`,
+      platformAnalyticsService.getRevenue(range.start, range.end),
+      platformAnalyticsService.getYearToDateRevenue(),
+      platformAnalyticsService.getByRegion(range),
       prisma.$queryRaw`SELECT COUNT(*)::int as count FROM users WHERE role = 'tenant'::user_role AND status = 'active'::user_status`,
       prisma.$queryRaw`SELECT COUNT(*)::int as count FROM users WHERE role = 'landlord'::user_role`,
       prisma.$queryRaw`SELECT COUNT(*)::int as count FROM users WHERE role = 'agent'::user_role`,
@@ -1824,9 +1783,9 @@ export const getPlatformAnalytics = async (req: Request, res: Response) => {
     const activeUnits = Number(unitsData.find(item => item.status === 'occupied')?.count || 0);
     const vacantUnits = Number(unitsData.find(item => item.status === 'vacant')?.count || 0);
     
-    const rentRev = Array.isArray(rentRevenue) ? Number((rentRevenue[0] as any)?.total || 0) : 0;
-    const subRev = Array.isArray(subscriptionRevenue) ? Number((subscriptionRevenue[0] as any)?.total || 0) : 0;
-    const monthlyRevenue = rentRev + subRev;
+    // Rent due each month on occupied units, against what the ledger shows was collected in the range
+    const monthlyRentRoll = Array.isArray(rentRoll) ? Number((rentRoll[0] as any)?.total || 0) : 0;
+    const monthlyRevenue = revenue.total;
     const activeTenants = Array.isArray(activeTenantsResult) ? Number((activeTenantsResult[0] as any)?.count || 0) : 0;
     const totalLandlords = Array.isArray(independentLandlordsResult) ? Number((independentLandlordsResult[0] as any)?.count || 0) : 0;
     const agents = Array.isArray(agentsResult) ? Number((agentsResult[0] as any)?.count || 0) : 0;
@@ -1868,9 +1827,14 @@ export const getPlatformAnalytics = async (req: Request, res: Response) => {
       total_landlords: totalLandlords, // New field name
       agents: agents,
       monthly_revenue: monthlyRevenue,
-      ytd_revenue: monthlyRevenue * 12, // Year-to-date estimate
+      rental_revenue: revenue.rental,
+      subscription_revenue: revenue.subscription,
+      monthly_rent_roll: monthlyRentRoll,
+      ytd_revenue: ytdRevenue.total,
       occupancy_rate: occupancyRate,
       average_rent: averageRent,
+      date_range: { label: range.label, start: range.start.toISOString(), end: range.end.toISOString() },
+      by_region: byRegion,
       system_performance: {
         uptime_percentage: uptimePercentage,
         active_users: activeUsers,
@@ -1882,56 +1846,82 @@ export const getPlatformAnalytics = async (req: Request, res: Response) => {
     writeSuccess(res, 200, 'Platform analytics retrieved successfully', platformData);
   } catch (err: any) {
     console.error('Error fetching platform analytics:', err);
-    writeError(res, 500, 'Failed to fetch platform analytics', err.message);
+    writeError(res, err.message?.includes('must') ? 400 : 500, 'Failed to fetch platform analytics', err.message);
+  }
+};
+
+export const getRegionalAnalytics = async (req: Request, res: Response) => {
+  try {
+    const range = resolveAnalyticsRange(req.query as Record<string, any>);
+    const groupBy = (req.query.group_by as RegionGrouping) || 'region';
+    const regions = await platformAnalyticsService.getByRegion(range, groupBy);
+    const totals = regions.reduce((acc, row) => ({
+      units: acc.units + row.units,
+      occupied_units: acc.occupied_units + row.occupied_units,
+      rent_collected: acc.rent_collected + row.rent_collected,
+      arrears: acc.arrears + row.arrears,
+    }), { units: 0, occupied_units: 0, rent_collected: 0, arrears: 0 });
+
+    writeSuccess(res, 200, 'Regional analytics retrieved successfully', {
+      group_by: groupBy,
+      regions,
+      totals: {
+        ...totals,
+        occupancy_rate: totals.units > 0 ? Math.round((totals.occupied_units / totals.units) * 10000) / 100 : 0,
+      },
+      date_range: { label: range.label, start: range.start.toISOString(), end: range.end.toISOString() },
+    });
+  } catch (err: any) {
+    console.error('Error fetching regional analytics:', err);
+    writeError(res, err.message?.includes('must') ? 400 : 500, 'Failed to fetch regional analytics', err.message);
   }
 };
 
 export const getRevenueDashboard = async (req: Request, res: Response) => {
   try {
-    const period = req.query.period as string || '30d';
+    const range = resolveAnalyticsRange(req.query as Record<string, any>);
     
     const [
-      rentRevenue,
-      subscriptionRevenue,
-      monthlyRentRevenue,
-      monthlySubscriptionRevenue,
-      revenueByProperty
+      allTime,
+      comparison,
+      ytdRevenue,
+      revenueByProperty,
+      byRegion
     ] = await Promise.all([
-      prisma.$queryRaw`SELECT COALESCE(SUM(rent_amount), 0)::numeric as total FROM units WHERE status = 'occupied'`,
-      prisma.$queryRaw`SELECT COALESCE(SUM(amount), 0)::numeric as total FROM billing_invoices WHERE status = 'paid'`,
-      prisma.$queryRaw`SELECT COALESCE(SUM(rent_amount), 0)::numeric as monthly FROM units WHERE status = 'occupied'`,
-      prisma.$queryRaw`SELECT COALESCE(SUM(amount), 0)::numeric as monthly FROM billing_invoices WHERE status = 'paid' AND paid_at >= NOW() - INTERVAL '30 days'`,
-      prisma.$queryRaw`
-        SELECT p.name, COALESCE(SUM(u.rent_amount), 0)::numeric as revenue
+      platformAnalyticsService.getRevenue(new Date(0), new Date()),
+      platformAnalyticsService.getRevenueComparison(range),
+      platformAnalyticsService.getYearToDateRevenue(),
+      prisma.$queryRaw<any[]>`
+        SELECT p.name, COALESCE(SUM(pay.amount), 0)::float as revenue
         FROM properties p
-        LEFT JOIN units u ON p.id = u.property_id AND u.status = 'occupied'
+        LEFT JOIN payments pay ON pay.property_id = p.id
+          AND pay.status IN ('approved'::payment_status, 'completed'::payment_status)
+          AND pay.payment_date >= ${range.start} AND pay.payment_date <= ${range.end}
         GROUP BY p.id, p.name
         ORDER BY revenue DESC
         LIMIT 10
-      `
+      `,
+      platformAnalyticsService.getByRegion(range)
     ]);
 
-    const rentRev = Array.isArray(rentRevenue) ? Number((rentRevenue[0] as any)?.total || 0) : 0;
-    const subRev = Array.isArray(subscriptionRevenue) ? Number((subscriptionRevenue[0] as any)?.total || 0) : 0;
-    const total = rentRev + subRev;
-    
-    const monthlyRent = Array.isArray(monthlyRentRevenue) ? Number((monthlyRentRevenue[0] as any)?.monthly || 0) : 0;
-    const monthlySub = Array.isArray(monthlySubscriptionRevenue) ? Number((monthlySubscriptionRevenue[0] as any)?.monthly || 0) : 0;
-    const monthly = monthlyRent + monthlySub;
-
     const revenueData = {
-      total_revenue: total,
-      monthly_revenue: monthly,
-      ytd_revenue: monthly * 12,
-      revenue_by_property: revenueByProperty,
-      growth_rate: 8.5,
-      period: period
+      total_revenue: allTime.total,
+      monthly_revenue: comparison.current.total,
+      rental_revenue: comparison.current.rental,
+      subscription_revenue: comparison.current.subscription,
+      previous_period_revenue: comparison.previous.total,
+      ytd_revenue: ytdRevenue.total,
+      revenue_by_property: revenueByProperty.map((row: any) => ({ name: row.name, revenue: Number(row.revenue || 0) })),
+      revenue_by_region: byRegion.map(row => ({ region: row.region, revenue: row.rent_collected })),
+      growth_rate: comparison.change.total,
+      period: range.label,
+      date_range: { start: range.start.toISOString(), end: range.end.toISOString() }
     };
 
     writeSuccess(res, 200, 'Revenue dashboard retrieved successfully', revenueData);
   } catch (err: any) {
     console.error('Error fetching revenue dashboard:', err);
-    writeError(res, 500, 'Failed to fetch revenue dashboard', err.message);
+    writeError(res, err.message?.includes('must') ? 400 : 500, 'Failed to fetch revenue dashboard', err.message);
   }
 };
 
@@ -1956,6 +1946,9 @@ export const getAgencyPerformance = async (req: Request, res: Response) => {
       LIMIT ${limit}
     `;
 
+    // Latest scheduled health score for each agency
+    const healthScores = new Map((await agencyHealthService.listLatest()).map(row => [row.agency_id, row]));
+
     // Transform the data to ensure proper field names
     const agencies = Array.isArray(agencyPerformance) 
       ? agencyPerformance.map((agency: any) => ({
@@ -1965,7 +1958,9 @@ export const getAgencyPerformance = async (req: Request, res: Response) => {
           total_properties: Number(agency.total_properties || 0),
           total_units: Number(agency.total_units || 0),
           occupied_units: Number(agency.occupied_units || 0),
-          revenue: Number(agency.revenue || 0)
+          revenue: Number(agency.revenue || 0),
+          health_score: healthScores.get(agency.id)?.score ?? null,
+          health_grade: healthScores.get(agency.id)?.grade ?? null
         }))
       : [];
 
@@ -1976,6 +1971,48 @@ export const getAgencyPerformance = async (req: Request, res: Response) => {
   }
 };
 
+export const getAgencyHealthScores = async (req: Request, res: Response) => {
+  try {
+    const scores = await agencyHealthService.listLatest();
+    writeSuccess(res, 200, 'Agency health scores retrieved successfully', scores);
+  } catch (err: any) {
+    console.error('Error fetching agency health scores:', err);
+    writeError(res, 500, 'Failed to fetch agency health scores', err.message);
+  }
+};
+
+export const getAgencyHealth = async (req: Request, res: Response) => {
+  try {
+    const health = await agencyHealthService.getForAgency(req.params.id as string, parseInt(req.query.limit as string) || 30);
+    writeSuccess(res, 200, 'Agency health retrieved successfully', health);
+  } catch (err: any) {
+    console.error('Error fetching agency health:', err);
+    writeError(res, err.message?.includes('not found') ? 404 : 500, 'Failed to fetch agency health', err.message);
+  }
+};
+
+export const getAgencyPlanUsage = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { planLimitsService } = await import('../services/plan-limits.service.js');
+    const usage = await planLimitsService.getUsageFor(user, { agency_id: req.params.id as string });
+    writeSuccess(res, 200, 'Agency plan usage retrieved successfully', usage);
+  } catch (err: any) {
+    console.error('Error fetching agency plan usage:', err);
+    writeError(res, err.message?.includes('not found') ? 404 : 500, 'Failed to fetch agency plan usage', err.message);
+  }
+};
+
+export const recomputeAgencyHealth = async (req: Request, res: Response) => {
+  try {
+    const result = await agencyHealthService.computeAll();
+    writeSuccess(res, 200, 'Agency health scores recomputed successfully', result);
+  } catch (err: any) {
+    console.error('Error recomputing agency health scores:', err);
+    writeError(res, 500, 'Failed to recompute agency health scores', err.message);
+  }
+};
+
 // Additional missing endpoints
 export const getUserMetrics = async (req: Request, res: Response) => {
   try {
@@ -2152,14 +2189,14 @@ export const getRevenueSummary = async (req: Request, res: Response) => {
     // Get current period revenue (subscription + rental)
     const [currentSubRevenue, currentRentRevenue, currentAgencies] = await Promise.all([
       prisma.$queryRaw<any[]>`SELECT COALESCE(SUM(amount), 0)::numeric as total FROM billing_invoices WHERE status = 'paid' AND paid_at >= ${currentStart}::timestamp AND paid_at <= ${currentEnd}::timestamp`,
-      prisma.$queryRaw<any[]>`SELECT COALESCE(SUM(rent_amount), 0)::numeric as total FROM units WHERE status = 'occupied' AND updated_at >= ${currentStart}::timestamp AND updated_at <= ${currentEnd}::timestamp`,
+      prisma.$queryRaw<any[]>`SELECT COALESCE(SUM(amount), 0)::numeric as total FROM payments WHERE status IN ('approved'::payment_status, 'completed'::payment_status) AND payment_date >= ${currentStart}::timestamp AND payment_date <= ${currentEnd}::timestamp`,
       prisma.$queryRaw<any[]>`SELECT COUNT(DISTINCT a.id)::numeric as count FROM agencies a WHERE a.created_at <= ${currentEnd}::timestamp`
     ]);
 
     // Get previous period revenue
     const [previousSubRevenue, previousRentRevenue, previousAgencies] = await Promise.all([
       prisma.$queryRaw<any[]>`SELECT COALESCE(SUM(amount), 0)::numeric as total FROM billing_invoices WHERE status = 'paid' AND paid_at >= ${previousStart}::timestamp AND paid_at <= ${previousEnd}::timestamp`,
-      prisma.$queryRaw<any[]>`SELECT COALESCE(SUM(rent_amount), 0)::numeric as total FROM units WHERE status = 'occupied' AND updated_at >= ${previousStart}::timestamp AND updated_at <= ${previousEnd}::timestamp`,
+      prisma.$queryRaw<any[]>`SELECT COALESCE(SUM(amount), 0)::numeric as total FROM payments WHERE status IN ('approved'::payment_status, 'completed'::payment_status) AND payment_date >= ${previousStart}::timestamp AND payment_date <= ${previousEnd}::timestamp`,
       prisma.$queryRaw<any[]>`SELECT COUNT(DISTINCT a.id)::numeric as count FROM agencies a WHERE a.created_at <= ${previousEnd}::timestamp`
     ]);
 
@@ -2173,6 +2210,13 @@ export const getRevenueSummary = async (req: Request, res: Response) => {
     const previousTotal = previousSub + previousRent;
     const previousAgenciesCount = Array.isArray(previousAgencies) ? Number((previousAgencies[0] as any)?.count || 0) : 0;
 
+    // Recurring subscription revenue as it stood at the end of each period (or now, for the current one)
+    const { subscriptionAnalyticsService } = await import('../services/subscription-analytics.service.js');
+    const [currentRecurring, previousRecurring] = await Promise.all([
+      subscriptionAnalyticsService.getRecurringRevenue(currentEnd < now ? currentEnd : now),
+      subscriptionAnalyticsService.getRecurringRevenue(previousEnd),
+    ]);
+
     const revenueGrowth = previousTotal > 0 ? ((currentTotal - previousTotal) / previousTotal * 100) : 0;
     const agenciesGrowth = previousAgenciesCount > 0 ? ((currentAgenciesCount - previousAgenciesCount) / previousAgenciesCount * 100) : 0;
     const avgRevenuePerAgencyCurrent = currentAgenciesCount > 0 ? currentTotal / currentAgenciesCount : 0;
@@ -2183,17 +2227,24 @@ export const getRevenueSummary = async (req: Request, res: Response) => {
       current_period: {
         total_revenue: currentTotal,
         active_agencies: currentAgenciesCount,
-        average_revenue_per_agency: avgRevenuePerAgencyCurrent
+        average_revenue_per_agency: avgRevenuePerAgencyCurrent,
+        mrr: currentRecurring.mrr,
+        arr: currentRecurring.arr,
+        paying_customers: currentRecurring.paying_customers
       },
       previous_period: {
         total_revenue: previousTotal,
         active_agencies: previousAgenciesCount,
-        average_revenue_per_agency: avgRevenuePerAgencyPrevious
+        average_revenue_per_agency: avgRevenuePerAgencyPrevious,
+        mrr: previousRecurring.mrr,
+        arr: previousRecurring.arr,
+        paying_customers: previousRecurring.paying_customers
       },
       growth: {
         revenue: revenueGrowth,
         agencies: agenciesGrowth,
-        avg_revenue_per_agency: avgRevenueGrowth
+        avg_revenue_per_agency: avgRevenueGrowth,
+        mrr: previousRecurring.mrr > 0 ? ((currentRecurring.mrr - previousRecurring.mrr) / previousRecurring.mrr * 100) : 0
       },
       period: period
     };
@@ -2648,7 +2699,7 @@ export const rejectApplication = async (req: Request, res: Response) => {
   }
 };
 
-// Estimate recipients count for a broadcast based on target audience
+// Estimate recipients count for a broadcast based on target audience and filters
 export const estimateBroadcastRecipients = async (req: Request, res: Response) => {
   try {
     const { target_audience } = req.query;
@@ -2657,59 +2708,14 @@ export const estimateBroadcastRecipients = async (req: Request, res: Response) =
       return writeError(res, 400, 'target_audience is required');
     }
 
-    // Parse target audience (can be string or comma-separated)
-    const targetAudiences = typeof target_audience === 'string'
-      ? target_audience.split(',').map((a: string) => a.trim())
-      : Array.isArray(target_audience)
-      ? target_audience
-      : ['all_users'];
-
-    // Build role filter - include all user roles when "all_users" is selected
-    const roles: string[] = [];
-    if (targetAudiences.includes('all_users')) {
-      // Include all user roles
-      roles.push(
-        'agency_admin',
-        'agent',
-        'landlord',
-        'tenant',
-        'caretaker',
-        'cleaner',
-        'security',
-        'maintenance',
-        'receptionist',
-        'accountant',
-        'manager'
-      );
-    } else {
-      if (targetAudiences.includes('agency_admins')) roles.push('agency_admin');
-      if (targetAudiences.includes('agents')) roles.push('agent');
-      if (targetAudiences.includes('landlords')) roles.push('landlord');
-      if (targetAudiences.includes('tenants')) roles.push('tenant');
-      if (targetAudiences.includes('caretakers')) roles.push('caretaker');
-      // Add support for staff roles
-      if (targetAudiences.includes('staff') || targetAudiences.includes('cleaners')) roles.push('cleaner');
-      if (targetAudiences.includes('security')) roles.push('security');
-      if (targetAudiences.includes('maintenance')) roles.push('maintenance');
-      if (targetAudiences.includes('receptionists')) roles.push('receptionist');
-      if (targetAudiences.includes('accountants')) roles.push('accountant');
-      if (targetAudiences.includes('managers')) roles.push('manager');
-    }
-
-    // Count users based on target audience
-    const count = await prisma.user.count({
-      where: {
-        role: { in: roles as any }, // Cast to any to handle enum types
-        status: 'active', // Only count active users
-        company_id: { not: null }, // Only count users with company_id
-      },
+    const { broadcastService } = await import('../services/broadcast.service.js');
+    const estimate = await broadcastService.estimate(target_audience as string | string[], {
+      company_ids: req.query.company_ids,
+      agency_ids: req.query.agency_ids,
+      property_ids: req.query.property_ids,
     });
 
-    writeSuccess(res, 200, 'Recipient count estimated successfully', {
-      estimated_count: count,
-      target_audience: targetAudiences,
-      roles: roles,
-    });
+    writeSuccess(res, 200, 'Recipient count estimated successfully', estimate);
   } catch (err: any) {
     console.error('Error estimating broadcast recipients:', err);
     writeError(res, 500, 'Failed to estimate recipients', err.message);
@@ -2992,257 +2998,76 @@ export const updateNotificationTemplate = async (req: Request, res: Response) =>
   }
 };
 
+const broadcastStatusFor = (message: string) =>
+  message.includes('not found') ? 404 :
+  message.includes('already') || message.includes('Only') || message.includes('must') ? 400 : 500;
+
 // Send broadcast message
 export const sendBroadcastMessage = async (req: Request, res: Response) => {
   try {
-    const messageId = req.params.id;
     const user = (req as any).user;
-    
-    // Get broadcast from database
-    const broadcast = await prisma.broadcastMessage.findUnique({
-      where: { id: messageId },
-    });
-
-    if (!broadcast) {
-      return writeError(res, 404, 'Broadcast message not found');
-    }
-
-    if (broadcast.status === 'sent') {
-      return writeError(res, 400, 'Broadcast message has already been sent');
-    }
-
-    // Parse target audience (can be string or comma-separated)
-    const targetAudiences = typeof broadcast.target_audience === 'string'
-      ? broadcast.target_audience.split(',').map((a: string) => a.trim())
-      : Array.isArray(broadcast.target_audience)
-      ? broadcast.target_audience
-      : ['all_users'];
-
-    // Build role filter - include all user roles when "all_users" is selected
-    const roles: string[] = [];
-    if (targetAudiences.includes('all_users')) {
-      // Include all user roles: agency_admin, agent, landlord, tenant, caretaker, cleaner, security, maintenance, receptionist, accountant, manager
-      roles.push(
-        'agency_admin',
-        'agent',
-        'landlord',
-        'tenant',
-        'caretaker',
-        'cleaner',
-        'security',
-        'maintenance',
-        'receptionist',
-        'accountant',
-        'manager'
-      );
-    } else {
-      if (targetAudiences.includes('agency_admins')) roles.push('agency_admin');
-      if (targetAudiences.includes('agents')) roles.push('agent');
-      if (targetAudiences.includes('landlords')) roles.push('landlord');
-      if (targetAudiences.includes('tenants')) roles.push('tenant');
-      if (targetAudiences.includes('caretakers')) roles.push('caretaker');
-      // Add support for staff roles
-      if (targetAudiences.includes('staff') || targetAudiences.includes('cleaners')) roles.push('cleaner');
-      if (targetAudiences.includes('security')) roles.push('security');
-      if (targetAudiences.includes('maintenance')) roles.push('maintenance');
-      if (targetAudiences.includes('receptionists')) roles.push('receptionist');
-      if (targetAudiences.includes('accountants')) roles.push('accountant');
-      if (targetAudiences.includes('managers')) roles.push('manager');
-    }
-
-    // Get users based on target audience
-    const whereClause: any = {
-      role: { in: roles },
-      status: 'active', // Only send to active users
-    };
-
-    const recipients = await prisma.user.findMany({
-      where: {
-        ...whereClause,
-        company_id: { not: null }, // Only get users with company_id
-      },
-      select: {
-        id: true,
-        email: true,
-        first_name: true,
-        last_name: true,
-        role: true,
-        company_id: true,
-      },
-    });
-
-    console.log(`📢 Sending broadcast to ${recipients.length} recipients`);
-
-    // Helper function to escape HTML to prevent XSS
-    const escapeHtml = (text: string): string => {
-      if (!text) return text;
-      return text
-        .replace(/&/g, '&amp;')
-        .replace(/</g, '&lt;')
-        .replace(/>/g, '&gt;')
-        .replace(/"/g, '&quot;')
-        .replace(/'/g, '&#039;');
-    };
-
-    // Helper function to replace template variables with user data
-    const replaceTemplateVariables = (text: string, recipient: any): string => {
-      if (!text) return text;
-      
-      const userFullName = `${recipient.first_name} ${recipient.last_name}`.trim();
-      
-      // Replace common template variables
-      let replaced = text
-        .replace(/\{\{user_name\}\}/gi, userFullName)
-        .replace(/\{\{user_first_name\}\}/gi, recipient.first_name || '')
-        .replace(/\{\{user_last_name\}\}/gi, recipient.last_name || '')
-        .replace(/\{\{first_name\}\}/gi, recipient.first_name || '')
-        .replace(/\{\{last_name\}\}/gi, recipient.last_name || '')
-        .replace(/\{\{name\}\}/gi, userFullName)
-        .replace(/\{\{email\}\}/gi, recipient.email || '')
-        .replace(/\{\{user_email\}\}/gi, recipient.email || '')
-        .replace(/\{\{role\}\}/gi, recipient.role || '');
-      
-      return replaced;
-    };
-
-    // Import email service
-    const { emailService } = await import('../services/email.service.js');
-
-    let deliveredCount = 0;
-    let emailSentCount = 0;
-    let notificationCreatedCount = 0;
-
-    // Send to each recipient
-    for (const recipient of recipients) {
-      try {
-        // Replace template variables for this recipient
-        const personalizedTitle = replaceTemplateVariables(broadcast.title, recipient);
-        const personalizedMessage = replaceTemplateVariables(broadcast.message, recipient);
-
-        // Create in-app notification
-        if (broadcast.send_push !== false) {
-          try {
-            // Create notification directly using Prisma (bypass service for cross-company broadcasts)
-            // Only create notification if recipient has a company_id
-            if (recipient.company_id) {
-              await prisma.notification.create({
-                data: {
-                  title: personalizedTitle,
-                  message: personalizedMessage,
-                  notification_type: broadcast.type || 'info',
-                  category: broadcast.type || 'general',
-                  priority: broadcast.type === 'alert' ? 'high' : 'medium',
-                  sender_id: user?.user_id || null,
-                  recipient_id: recipient.id,
-                  company_id: recipient.company_id,
-                  is_read: false,
-                  status: 'unread',
-                },
-              });
-              notificationCreatedCount++;
-            }
-          } catch (notifError) {
-            console.error(`Failed to create notification for user ${recipient.id}:`, notifError);
-          }
-        }
-
-        // Send email if requested
-        if (broadcast.send_email && recipient.email) {
-          try {
-            await emailService.sendEmail({
-              to: recipient.email,
-              subject: personalizedTitle,
-              html: `
-                <div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto;">
-                  <h2 style="color: #14b8a6;">${escapeHtml(personalizedTitle)}</h2>
-                  <div style="background-color: #f9fafb; padding: 20px; border-radius: 8px; margin: 20px 0;">
-                    <p style="color: #374151; line-height: 1.6; white-space: pre-wrap;">${escapeHtml(personalizedMessage).replace(/\n/g, '<br>')}</p>
-                  </div>
-                  <p style="color: #6b7280; font-size: 12px; margin-top: 20px;">
-                    This is an automated message from LetRents System.
-                  </p>
-                </div>
-              `,
-              text: personalizedMessage,
-            });
-            emailSentCount++;
-          } catch (emailError) {
-            console.error(`Failed to send email to ${recipient.email}:`, emailError);
-          }
-        }
-
-        deliveredCount++;
-      } catch (error) {
-        console.error(`Error sending to recipient ${recipient.id}:`, error);
-      }
-    }
-
-    // Update broadcast status in database
-    const updatedBroadcast = await prisma.broadcastMessage.update({
-      where: { id: messageId },
-      data: {
-        status: 'sent',
-        sent_at: new Date(),
-        recipients_count: recipients.length,
-        delivered_count: deliveredCount,
-        updated_at: new Date(),
-      },
-    });
-
-    console.log(`✅ Broadcast sent: ${notificationCreatedCount} notifications, ${emailSentCount} emails`);
+    const { broadcastService } = await import('../services/broadcast.service.js');
+    const result = await broadcastService.send(req.params.id as string, user?.user_id || null);
 
     writeSuccess(res, 200, 'Broadcast message sent successfully', {
-      id: messageId,
-      status: 'sent',
-      sent_at: updatedBroadcast.sent_at?.toISOString(),
-      recipients_count: recipients.length,
-      delivered_count: deliveredCount,
-      notifications_created: notificationCreatedCount,
-      emails_sent: emailSentCount,
+      ...result,
+      sent_at: result.sent_at?.toISOString(),
     });
   } catch (err: any) {
     console.error('Error sending broadcast message:', err);
-    writeError(res, 500, 'Failed to send broadcast message', err.message);
+    writeError(res, broadcastStatusFor(err.message), 'Failed to send broadcast message', err.message);
   }
 };
 
 // Schedule broadcast message
 export const scheduleBroadcastMessage = async (req: Request, res: Response) => {
   try {
-    const messageId = req.params.id;
     const { scheduled_for } = req.body;
     
     if (!scheduled_for) {
       return writeError(res, 400, 'scheduled_for is required');
     }
 
-    // Get broadcast from database
-    const broadcast = await prisma.broadcastMessage.findUnique({
-      where: { id: messageId },
-    });
-
-    if (!broadcast) {
-      return writeError(res, 404, 'Broadcast message not found');
-    }
-
-    // Update broadcast with scheduled time
-    const updatedBroadcast = await prisma.broadcastMessage.update({
-      where: { id: messageId },
-      data: {
-        status: 'scheduled',
-        scheduled_for: new Date(scheduled_for),
-        updated_at: new Date(),
-      },
-    });
+    const { broadcastService } = await import('../services/broadcast.service.js');
+    const updatedBroadcast = await broadcastService.schedule(req.params.id as string, scheduled_for);
     
     writeSuccess(res, 200, 'Broadcast message scheduled successfully', { 
-      id: messageId,
-      status: 'scheduled',
+      id: updatedBroadcast.id,
+      status: updatedBroadcast.status,
       scheduled_for: updatedBroadcast.scheduled_for?.toISOString(),
     });
   } catch (err: any) {
     console.error('Error scheduling broadcast message:', err);
-    writeError(res, 500, 'Failed to schedule broadcast message', err.message);
+    writeError(res, broadcastStatusFor(err.message), 'Failed to schedule broadcast message', err.message);
+  }
+};
+
+// Return a scheduled broadcast to draft
+export const unscheduleBroadcastMessage = async (req: Request, res: Response) => {
+  try {
+    const { broadcastService } = await import('../services/broadcast.service.js');
+    const updatedBroadcast = await broadcastService.unschedule(req.params.id as string);
+
+    writeSuccess(res, 200, 'Broadcast message unscheduled successfully', {
+      id: updatedBroadcast.id,
+      status: updatedBroadcast.status,
+    });
+  } catch (err: any) {
+    console.error('Error unscheduling broadcast message:', err);
+    writeError(res, broadcastStatusFor(err.message), 'Failed to unschedule broadcast message', err.message);
+  }
+};
+
+// Delivery and open stats for a broadcast
+export const getBroadcastStats = async (req: Request, res: Response) => {
+  try {
+    const { broadcastService } = await import('../services/broadcast.service.js');
+    const stats = await broadcastService.getStats(req.params.id as string);
+
+    writeSuccess(res, 200, 'Broadcast stats retrieved successfully', stats);
+  } catch (err: any) {
+    console.error('Error fetching broadcast stats:', err);
+    writeError(res, broadcastStatusFor(err.message), 'Failed to fetch broadcast stats', err.message);
   }
 };
 
@@ -3939,7 +3764,12 @@ export const getBillingSubscriptions = async (req: Request, res: Response) => {
       take: limit
     });
 
-    const total = await prisma.subscription.count();
+    const [total, statusCounts] = await Promise.all([
+      prisma.subscription.count(),
+      prisma.subscription.groupBy({ by: ['status'], _count: { status: true } }),
+    ]);
+    const { subscriptionAnalyticsService } = await import('../services/subscription-analytics.service.js');
+    const recurring = await subscriptionAnalyticsService.getRecurringRevenue();
 
     // Transform to match expected format
     const transformedSubscriptions = await Promise.all(
@@ -3985,15 +3815,12 @@ export const getBillingSubscriptions = async (req: Request, res: Response) => {
       total,
       limit,
       offset,
+      // Platform-wide, not just this page
       summary: {
-        active: transformedSubscriptions.filter(s => s.status === 'active').length,
-        cancelled: transformedSubscriptions.filter(s => s.status === 'canceled').length,
-        total_mrr: transformedSubscriptions
-          .filter(s => s.status === 'active' && s.billing_cycle === 'monthly')
-          .reduce((sum, s) => sum + s.plan_price, 0),
-        total_arr: transformedSubscriptions
-          .filter(s => s.status === 'active')
-          .reduce((sum, s) => sum + (s.billing_cycle === 'monthly' ? s.plan_price * 12 : s.plan_price), 0)
+        active: statusCounts.find(row => row.status === 'active')?._count.status || 0,
+        cancelled: statusCounts.find(row => row.status === 'canceled')?._count.status || 0,
+        total_mrr: recurring.mrr,
+        total_arr: recurring.arr
       }
     };
 
@@ -4004,107 +3831,83 @@ export const getBillingSubscriptions = async (req: Request, res: Response) => {
   }
 };
 
-export const getBillingInvoices = async (req: Request, res: Response) => {
+/**
+ * MRR, ARR, churn, upgrades and downgrades by month, and cohort retention, from the subscription records
+ */
+export const getSubscriptionAnalytics = async (req: Request, res: Response) => {
   try {
-    const limit = parseInt(req.query.limit as string) || 20;
-    const offset = parseInt(req.query.offset as string) || 0;
-    const status = req.query.status as string;
+    const { subscriptionAnalyticsService } = await import('../services/subscription-analytics.service.js');
+    const analytics = await subscriptionAnalyticsService.getAnalytics({ months: req.query.months as string | undefined });
+    writeSuccess(res, 200, 'Subscription analytics retrieved successfully', analytics);
+  } catch (err: any) {
+    console.error('Error fetching subscription analytics:', err);
+    writeError(res, err.message?.includes('must be') ? 400 : 500, 'Failed to fetch subscription analytics', err.message);
+  }
+};
 
-    // Mock invoice data
-    const allInvoices = [
-      {
-        id: 'INV-001',
-        invoice_number: 'INV-2025-001',
-        customer_name: 'FairDeal Company',
-        customer_email: 'landlord@letrents.com',
-        amount: 79.00,
-        currency: 'USD',
-        status: 'paid',
-        due_date: new Date('2025-09-21T00:00:00Z'),
-        paid_date: new Date('2025-09-20T00:00:00Z'),
-        created_at: new Date('2025-08-21T00:00:00Z'),
-        plan_name: 'Professional',
-        billing_period: 'September 2025'
-      },
-      {
-        id: 'INV-002',
-        invoice_number: 'INV-2025-002',
-        customer_name: 'Fanaka Properties Agency',
-        customer_email: 'agencyadmin@letrents.com',
-        amount: 1990.00,
-        currency: 'USD',
-        status: 'paid',
-        due_date: new Date('2025-09-15T00:00:00Z'),
-        paid_date: new Date('2025-09-14T00:00:00Z'),
-        created_at: new Date('2025-08-15T00:00:00Z'),
-        plan_name: 'Enterprise',
-        billing_period: 'Annual 2025-2026'
-      },
-      {
-        id: 'INV-003',
-        invoice_number: 'INV-2025-003',
-        customer_name: 'FairDeal Company',
-        customer_email: 'landlord@letrents.com',
-        amount: 79.00,
-        currency: 'USD',
-        status: 'pending',
-        due_date: new Date('2025-10-21T00:00:00Z'),
-        paid_date: null,
-        created_at: new Date('2025-09-21T00:00:00Z'),
-        plan_name: 'Professional',
-        billing_period: 'October 2025'
-      },
-      {
-        id: 'INV-004',
-        invoice_number: 'INV-2025-004',
-        customer_name: 'Demo Property Co.',
-        customer_email: 'demo@example.com',
-        amount: 29.00,
-        currency: 'USD',
-        status: 'overdue',
-        due_date: new Date('2025-08-10T00:00:00Z'),
-        paid_date: null,
-        created_at: new Date('2025-07-10T00:00:00Z'),
-        plan_name: 'Starter',
-        billing_period: 'August 2025'
-      }
-    ];
+export const getBillingInvoices = async (req: Request, res: Response) => {
+  try {
+    const { subscriptionBillingService } = await import('../services/subscription-billing.service.js');
+    const result = await subscriptionBillingService.list({
+      status: req.query.status as string | undefined,
+      company_id: req.query.company_id as string | undefined,
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+      limit: parseInt(req.query.limit as string) || 20,
+      offset: parseInt(req.query.offset as string) || 0,
+    });
 
-    // Filter by status if provided
-    let filteredInvoices = allInvoices;
-    if (status && status !== 'all') {
-      filteredInvoices = allInvoices.filter(inv => inv.status === status);
-    }
+    writeSuccess(res, 200, 'Billing invoices retrieved successfully', result);
+  } catch (err: any) {
+    console.error('Error fetching billing invoices:', err);
+    writeError(res, err.message?.includes('must be') ? 400 : 500, 'Failed to fetch billing invoices', err.message);
+  }
+};
 
-    // Apply pagination
-    const invoices = filteredInvoices.slice(offset, offset + limit);
-    const total = filteredInvoices.length;
+/**
+ * Charge a failed or written-off subscription invoice again now
+ */
+export const retryBillingInvoice = async (req: Request, res: Response) => {
+  try {
+    const { subscriptionBillingService } = await import('../services/subscription-billing.service.js');
+    const result = await subscriptionBillingService.charge(req.params.id);
+    writeSuccess(res, 200, `Billing invoice ${result.status}`, result);
+  } catch (err: any) {
+    console.error('Error retrying billing invoice:', err);
+    const status = err.message === 'invoice not found' ? 404 : err.message?.includes('already') ? 400 : 500;
+    writeError(res, status, 'Failed to retry billing invoice', err.message);
+  }
+};
 
-    const result = {
-      invoices,
-      total,
-      limit,
-      offset,
-      summary: {
-        paid: allInvoices.filter(i => i.status === 'paid').length,
-        pending: allInvoices.filter(i => i.status === 'pending').length,
-        overdue: allInvoices.filter(i => i.status === 'overdue').length,
-        total_paid: allInvoices
-          .filter(i => i.status === 'paid')
-          .reduce((sum, i) => sum + i.amount, 0),
-        total_pending: allInvoices
-          .filter(i => i.status === 'pending')
-          .reduce((sum, i) => sum + i.amount, 0),
-        total_overdue: allInvoices
-          .filter(i => i.status === 'overdue')
-          .reduce((sum, i) => sum + i.amount, 0)
-      }
-    };
+/**
+ * Run invoice generation and dunning now instead of waiting for the nightly job
+ */
+export const runSubscriptionBilling = async (req: Request, res: Response) => {
+  try {
+    const { subscriptionBillingService } = await import('../services/subscription-billing.service.js');
+    const invoices = await subscriptionBillingService.generateDueInvoices();
+    const dunning = await subscriptionBillingService.runDunning();
+    writeSuccess(res, 200, 'Subscription billing run completed', { invoices, dunning });
+  } catch (err: any) {
+    console.error('Error running subscription billing:', err);
+    writeError(res, 500, 'Failed to run subscription billing', err.message);
+  }
+};
 
-    writeSuccess(res, 200, 'Billing invoices retrieved successfully', result);
+/**
+ * Usage of every agency over a period (this month by default)
+ */
+export const getPlatformUsage = async (req: Request, res: Response) => {
+  try {
+    const { usageMeteringService } = await import('../services/usage-metering.service.js');
+    const usage = await usageMeteringService.getPlatformUsage({
+      from: req.query.from as string | undefined,
+      to: req.query.to as string | undefined,
+    });
+    writeSuccess(res, 200, 'Platform usage retrieved successfully', usage);
   } catch (err: any) {
-    console.error('Error fetching billing invoices:', err);
-    writeError(res, 500, 'Failed to fetch billing invoices', err.message);
+    console.error('Error fetching platform usage:', err);
+    writeError(res, err.message?.includes('must be') ? 400 : 500, 'Failed to fetch platform usage', err.message);
   }
 };
 
@@ -4141,20 +3944,16 @@ export const activateEntity = async (req: Request, res: Response) => {
       });
       writeSuccess(res, 200, 'Company activated successfully', company);
     } else if (entityType === 'agency') {
-      const agency = await prisma.agency.update({
-        where: { id: entityId },
-        data: { 
-          status: 'active',
-          updated_at: new Date()
-        }
-      });
-      writeSuccess(res, 200, 'Agency activated successfully', agency);
+      // Agencies take their users with them, so they go through the agencies service
+      const { agenciesService } = await import('../services/agencies.service.js');
+      const result = await agenciesService.reactivate(entityId as string, reason, (req as any).user);
+      writeSuccess(res, 200, 'Agency activated successfully', result);
     } else {
       writeError(res, 400, 'Invalid entity type');
     }
   } catch (err: any) {
     console.error('Error activating entity:', err);
-    writeError(res, 500, 'Failed to activate entity', err.message);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to activate entity', err.message);
   }
 };
 
@@ -4187,20 +3986,16 @@ export const deactivateEntity = async (req: Request, res: Response) => {
       });
       writeSuccess(res, 200, 'Company deactivated successfully', company);
     } else if (entityType === 'agency') {
-      const agency = await prisma.agency.update({
-        where: { id: entityId },
-        data: { 
-          status: 'inactive',
-          updated_at: new Date()
-        }
-      });
-      writeSuccess(res, 200, 'Agency deactivated successfully', agency);
+      // Agencies take their users with them, so they go through the agencies service
+      const { agenciesService } = await import('../services/agencies.service.js');
+      const result = await agenciesService.deactivate(entityId as string, reason, (req as any).user);
+      writeSuccess(res, 200, 'Agency deactivated successfully', result);
     } else {
       writeError(res, 400, 'Invalid entity type');
     }
   } catch (err: any) {
     console.error('Error deactivating entity:', err);
-    writeError(res, 500, 'Failed to deactivate entity', err.message);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to deactivate entity', err.message);
   }
 };
 
@@ -4233,20 +4028,16 @@ export const suspendEntity = async (req: Request, res: Response) => {
       });
       writeSuccess(res, 200, 'Company suspended successfully', company);
     } else if (entityType === 'agency') {
-      const agency = await prisma.agency.update({
-        where: { id: entityId },
-        data: { 
-          status: 'suspended',
-          updated_at: new Date()
-        }
-      });
-      writeSuccess(res, 200, 'Agency suspended successfully', agency);
+      // Agencies take their users with them, so they go through the agencies service
+      const { agenciesService } = await import('../services/agencies.service.js');
+      const result = await agenciesService.suspend(entityId as string, reason, (req as any).user);
+      writeSuccess(res, 200, 'Agency suspended successfully', result);
     } else {
       writeError(res, 400, 'Invalid entity type');
     }
   } catch (err: any) {
     console.error('Error suspending entity:', err);
-    writeError(res, 500, 'Failed to suspend entity', err.message);
+    writeError(res, agencyStatusFor(err.message || ''), 'Failed to suspend entity', err.message);
   }
 };
 
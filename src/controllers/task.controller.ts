@@ -1,5 +1,7 @@
 import { Request, Response } from 'express';
 import * as taskService from '../services/task.service.js';
+import { caretakerAssignmentService } from '../services/caretaker-assignment.service.js';
+import { taskLocationService } from '../services/task-location.service.js';
 
 /**
  * Create a new task
@@ -201,6 +203,161 @@ export const updateTask = async (req: Request, res: Response) => {
   }
 };
 
+/**
+ * Reassign a task to a given staff member, or to the next best caretaker when none is given
+ * PUT /api/v1/tasks/:id/reassign
+ */
+export const reassignTask = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user;
+    const task = await caretakerAssignmentService.reassignTask(req.params.id as string, req.body || {}, user);
+
+    res.status(200).json({
+      success: true,
+      message: 'Task reassigned successfully',
+      data: task,
+    });
+  } catch (error: any) {
+    console.error('Error in reassignTask controller:', error);
+    const message = error.message || 'Failed to reassign task';
+    res.status(
+      message.includes('not found') ? 404 :
+      message.includes('permission') ? 403 :
+      message.includes('already') ? 409 :
+      message.includes('required') ? 400 : 500
+    ).json({
+      success: false,
+      message,
+    });
+  }
+};
+
+const locationStatus = (message: string): number =>
+  message.includes('not found') ? 404 :
+  message.includes('permission') ? 403 :
+  message.includes('already') ? 409 :
+  message.includes('required') || message.includes('must be') ? 400 : 500;
+
+/**
+ * Check in to a task at the property; outside the geofence a reason is required
+ * POST /api/v1/tasks/:id/check-in
+ */
+export const checkInTask = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user;
+    const result = await taskLocationService.checkIn(req.params.id as string, req.body || {}, user);
+
+    res.status(200).json({
+      success: true,
+      message: result.event.flagged ? 'Checked in (outside the property geofence)' : 'Checked in successfully',
+      data: result,
+    });
+  } catch (error: any) {
+    console.error('Error in checkInTask controller:', error);
+    const message = error.message || 'Failed to check in';
+    res.status(locationStatus(message)).json({
+      success: false,
+      message,
+    });
+  }
+};
+
+/**
+ * Check out of a task, optionally completing it
+ * POST /api/v1/tasks/:id/check-out
+ */
+export const checkOutTask = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user;
+    const result = await taskLocationService.checkOut(req.params.id as string, req.body || {}, user);
+
+    res.status(200).json({
+      success: true,
+      message: result.event.flagged ? 'Checked out (outside the property geofence)' : 'Checked out successfully',
+      data: result,
+    });
+  } catch (error: any) {
+    console.error('Error in checkOutTask controller:', error);
+    const message = error.message || 'Failed to check out';
+    res.status(locationStatus(message)).json({
+      success: false,
+      message,
+    });
+  }
+};
+
+/**
+ * Check-in/out and update locations recorded for a task
+ * GET /api/v1/tasks/:id/location-events
+ */
+export const getTaskLocationEvents = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user;
+    const result = await taskLocationService.getTaskLocationEvents(req.params.id as string, user);
+
+    res.status(200).json({
+      success: true,
+      message: 'Task location events retrieved successfully',
+      data: result,
+    });
+  } catch (error: any) {
+    console.error('Error in getTaskLocationEvents controller:', error);
+    const message = error.message || 'Failed to retrieve location events';
+    res.status(locationStatus(message)).json({
+      success: false,
+      message,
+    });
+  }
+};
+
+/**
+ * Working and travel time for a staff member (defaults to the caller, last 7 days)
+ * GET /api/v1/tasks/time-summary
+ */
+export const getTaskTimeSummary = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user;
+    const summary = await taskLocationService.getTimeSummary(req.query as any, user);
+
+    res.status(200).json({
+      success: true,
+      message: 'Time summary retrieved successfully',
+      data: summary,
+    });
+  } catch (error: any) {
+    console.error('Error in getTaskTimeSummary controller:', error);
+    const message = error.message || 'Failed to retrieve time summary';
+    res.status(locationStatus(message)).json({
+      success: false,
+      message,
+    });
+  }
+};
+
+/**
+ * Task locations recorded away from the property
+ * GET /api/v1/tasks/location-flags
+ */
+export const getTaskLocationFlags = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user;
+    const events = await taskLocationService.getFlaggedEvents(req.query as any, user);
+
+    res.status(200).json({
+      success: true,
+      message: 'Location flags retrieved successfully',
+      data: events,
+    });
+  } catch (error: any) {
+    console.error('Error in getTaskLocationFlags controller:', error);
+    const message = error.message || 'Failed to retrieve location flags';
+    res.status(locationStatus(message)).json({
+      success: false,
+      message,
+    });
+  }
+};
+
 /**
  * Delete a task
  * DELETE /api/v1/tasks/:id
@@ -0,0 +1,108 @@
+import { Request, Response } from 'express';
+import {
+  TenantFlagsService,
+  CreateTenantFlagRequest,
+  ReviewDisputeRequest,
+} from '../services/tenant-flags.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+const service = new TenantFlagsService();
+
+export const screenTenant = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await service.screenProspect(
+      {
+        email: req.query.email as string,
+        phone: req.query.phone as string,
+        id_number: req.query.id_number as string,
+      },
+      user
+    );
+    writeSuccess(res, 200, result.flagged ? 'Tenant has active flags' : 'No active flags found', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to screen tenant';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const getTenantFlags = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const flags = await service.getTenantFlags(req.params.id as string, user);
+    writeSuccess(res, 200, 'Tenant flags retrieved successfully', flags);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve tenant flags';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const flagTenant = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const flagData: CreateTenantFlagRequest = req.body;
+    const flag = await service.flagTenant(req.params.id as string, flagData, user);
+    writeSuccess(res, 201, 'Tenant flagged successfully', flag);
+  } catch (error: any) {
+    const message = error.message || 'Failed to flag tenant';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const resolveTenantFlag = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const flag = await service.resolveFlag(req.params.id as string, req.params.flagId as string, req.body?.notes, user);
+    writeSuccess(res, 200, 'Tenant flag resolved successfully', flag);
+  } catch (error: any) {
+    const message = error.message || 'Failed to resolve tenant flag';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const listTenantFlagDisputes = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const disputes = await service.listDisputes(user);
+    writeSuccess(res, 200, 'Flag disputes retrieved successfully', disputes);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve flag disputes';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const reviewTenantFlagDispute = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const reviewData: ReviewDisputeRequest = req.body;
+    const flag = await service.reviewDispute(req.params.flagId as string, reviewData, user);
+    writeSuccess(res, 200, 'Flag dispute reviewed successfully', flag);
+  } catch (error: any) {
+    const message = error.message || 'Failed to review flag dispute';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const getMyTenantFlags = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const flags = await service.getMyFlags(user);
+    writeSuccess(res, 200, 'Flags retrieved successfully', flags);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve flags';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const disputeTenantFlag = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const flag = await service.disputeFlag(req.params.flagId as string, req.body?.reason, user);
+    writeSuccess(res, 200, 'Dispute submitted successfully', flag);
+  } catch (error: any) {
+    const message = error.message || 'Failed to submit dispute';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
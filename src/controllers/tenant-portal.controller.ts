@@ -4,6 +4,7 @@ import { JWTClaims } from '../types/index.js';
 import { notificationsService } from '../services/notifications.service.js';
 import { emailService } from '../services/email.service.js';
 import { pushNotificationService } from '../services/push-notification.service.js';
+import { maintenanceSlaService } from '../services/maintenance-sla.service.js';
 
 const prisma = getPrisma();
 
@@ -1171,6 +1172,9 @@ export const createMaintenanceRequest = async (req: Request, res: Response) => {
       ? `${description}\n\nPreferred time: ${preferred_time}`
       : description;
 
+    const requestedAt = new Date();
+    const slaDueDates = await maintenanceSlaService.computeDueDates(user.company_id!, priority || 'medium', requestedAt);
+
     const maintenanceRequest = await prisma.maintenanceRequest.create({
       data: {
         company_id: user.company_id!,
@@ -1182,7 +1186,8 @@ export const createMaintenanceRequest = async (req: Request, res: Response) => {
         priority: priority || 'medium',
         status: 'pending',
         requested_by: user.user_id,
-        requested_date: new Date(),
+        requested_date: requestedAt,
+        ...slaDueDates,
         images: normalizedImages.length > 0 ? normalizedImages : undefined,
       },
       include: {
@@ -1210,6 +1215,25 @@ export const createMaintenanceRequest = async (req: Request, res: Response) => {
       }
     });
 
+    // Photos/voice notes/video sent with the report go onto the request timeline
+    const files = (req.files as Express.Multer.File[]) || [];
+    if (files.length > 0) {
+      try {
+        const { MaintenanceService } = await import('../services/maintenance.service.js');
+        await new MaintenanceService().addAttachments(maintenanceRequest.id, files, 'Attached when reporting the issue', user);
+      } catch (uploadError: any) {
+        console.error('❌ Error uploading maintenance attachments:', uploadError.message);
+      }
+    }
+
+    // Hand the request to the best available caretaker
+    try {
+      const { MaintenanceService } = await import('../services/maintenance.service.js');
+      await new MaintenanceService().autoAssignMaintenanceRequest(maintenanceRequest.id, user);
+    } catch (assignError: any) {
+      console.error('⚠️ Caretaker auto-assignment failed:', assignError.message);
+    }
+
     // ✅ Create notification for landlord/property owner
     try {
       const requesterName = requesterUser ? `${requesterUser.first_name} ${requesterUser.last_name}` : 'Tenant';
@@ -2078,7 +2102,7 @@ export const cleanupDuplicatePayment = async (req: Request, res: Response) => {
 export const registerPushToken = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
-    const { token, platform = 'web', device_id, device_info } = req.body;
+    const { token, platform = 'web', device_id, device_info, enable_push_notifications } = req.body;
 
     if (!token) {
       return res.status(400).json({
@@ -2099,7 +2123,8 @@ export const registerPushToken = async (req: Request, res: Response) => {
       token,
       platform as 'web' | 'ios' | 'android',
       device_id,
-      device_info
+      device_info,
+      { optIn: enable_push_notifications === true }
     );
 
     if (success) {
@@ -10,7 +10,9 @@ import {
 } from '../services/tenants.service.js';
 import { JWTClaims } from '../types/index.js';
 import { writeSuccess, writeError } from '../utils/response.js';
+import { inspectionReportLink } from '../services/checklists.service.js';
 import { getPrisma } from '../config/prisma.js';
+import { EXCEL_CONTENT_TYPE, EXCEL_FILE_EXTENSION } from '../utils/excel-export.js';
 
 const service = new TenantsService();
 const prisma = getPrisma();
@@ -163,6 +165,36 @@ export const listTenants = async (req: Request, res: Response) => {
   }
 };
 
+export const exportTenants = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const format = (req.query.format as string) || 'xlsx';
+    const propertyIds = req.query.property_ids
+      ? (req.query.property_ids as string).split(',').map(id => id.trim()).filter(id => id.length > 0)
+      : undefined;
+
+    const filters: TenantFilters = {
+      property_id: req.query.property_id as string,
+      property_ids: propertyIds,
+      unit_id: req.query.unit_id as string,
+      status: req.query.status as string,
+      search_query: req.query.search as string,
+      sort_by: req.query.sort_by as string,
+      sort_order: req.query.sort_order as string,
+    };
+
+    const exportData = await service.exportTenants(filters, user, format);
+    const isExcel = ['xlsx', 'excel'].includes(format);
+    const filename = `tenants_${new Date().toISOString().split('T')[0]}.${isExcel ? EXCEL_FILE_EXTENSION : 'csv'}`;
+    res.setHeader('Content-Disposition', `attachment; filename="${filename}"`);
+    res.setHeader('Content-Type', isExcel ? EXCEL_CONTENT_TYPE : 'text/csv');
+    res.send(exportData);
+  } catch (error: any) {
+    const message = error.message || 'Failed to export tenants';
+    writeError(res, message.includes('must be') ? 400 : 500, message);
+  }
+};
+
 export const assignUnit = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
@@ -315,7 +347,7 @@ export const getTenantDocuments = async (req: Request, res: Response) => {
       category: doc.category,
       size: `${(doc.size / 1024 / 1024).toFixed(2)} MB`,
       uploadDate: doc.created_at.toISOString(),
-      url: doc.url,
+      url: doc.category === 'inspection_report' ? inspectionReportLink(doc.url).report_url : doc.url,
     }));
 
     writeSuccess(res, 200, 'Tenant documents retrieved successfully', formatted);
@@ -0,0 +1,134 @@
+import { Request, Response } from 'express';
+import {
+  UnitApplicationsService,
+  SubmitApplicationRequest,
+  JoinWaitlistRequest,
+  ReviewApplicationRequest,
+  ApplicationFilters,
+} from '../services/unit-applications.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+const service = new UnitApplicationsService();
+
+// Public endpoints
+
+export const getPropertyVacancies = async (req: Request, res: Response) => {
+  try {
+    const vacancies = await service.getPublicVacancies(req.params.propertyId as string);
+    writeSuccess(res, 200, 'Vacant units retrieved successfully', vacancies);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve vacant units';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const submitUnitApplication = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims | undefined;
+    const applicationData: SubmitApplicationRequest = req.body;
+    const application = await service.submitApplication(req.params.unitId as string, applicationData, user);
+    writeSuccess(res, 201, 'Application submitted successfully', application);
+  } catch (error: any) {
+    const message = error.message || 'Failed to submit application';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const withdrawUnitApplication = async (req: Request, res: Response) => {
+  try {
+    const application = await service.withdrawApplication(req.params.id as string, req.body?.token);
+    writeSuccess(res, 200, 'Application withdrawn successfully', application);
+  } catch (error: any) {
+    const message = error.message || 'Failed to withdraw application';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const joinPropertyWaitlist = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims | undefined;
+    const entryData: JoinWaitlistRequest = req.body;
+    const entry = await service.joinWaitlist(req.params.propertyId as string, entryData, user);
+    writeSuccess(res, 201, 'Added to waiting list successfully', entry);
+  } catch (error: any) {
+    const message = error.message || 'Failed to join waiting list';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const leavePropertyWaitlist = async (req: Request, res: Response) => {
+  try {
+    await service.leaveWaitlist(req.params.entryId as string, req.body?.token);
+    writeSuccess(res, 200, 'Removed from waiting list successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to leave waiting list';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+// Agent / landlord endpoints
+
+export const listUnitApplications = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const filters: ApplicationFilters = {
+      status: req.query.status as string,
+      property_id: req.query.property_id as string,
+      unit_id: req.query.unit_id as string,
+      page: req.query.page ? parseInt(req.query.page as string) : undefined,
+      limit: req.query.limit ? parseInt(req.query.limit as string) : undefined,
+    };
+    const result = await service.listApplications(filters, user);
+    writeSuccess(res, 200, 'Applications retrieved successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve applications';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getUnitApplication = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const application = await service.getApplication(req.params.id as string, user);
+    writeSuccess(res, 200, 'Application retrieved successfully', application);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve application';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const reviewUnitApplication = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const reviewData: ReviewApplicationRequest = req.body;
+    const application = await service.reviewApplication(req.params.id as string, reviewData, user);
+    writeSuccess(res, 200, 'Application reviewed successfully', application);
+  } catch (error: any) {
+    const message = error.message || 'Failed to review application';
+    writeError(res, statusFor(message, 400), message);
+  }
+};
+
+export const getPropertyWaitlist = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const entries = await service.getWaitlist(req.params.propertyId as string, user);
+    writeSuccess(res, 200, 'Waiting list retrieved successfully', entries);
+  } catch (error: any) {
+    const message = error.message || 'Failed to retrieve waiting list';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const removeWaitlistEntry = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await service.removeWaitlistEntry(req.params.entryId as string, user);
+    writeSuccess(res, 200, 'Waiting list entry removed successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to remove waiting list entry';
+    writeError(res, statusFor(message), message);
+  }
+};
@@ -0,0 +1,49 @@
+import { Request, Response } from 'express';
+import { unitQrService } from '../services/unit-qr.service.js';
+import { JWTClaims } from '../types/index.js';
+import { writeError, writeSuccess } from '../utils/response.js';
+import { statusFor } from '../utils/error-status.js';
+
+export const getUnitQrCode = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const qr = await unitQrService.getUnitQr(req.params.id as string, user);
+    writeSuccess(res, 200, 'Unit QR code retrieved successfully', qr);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get unit QR code';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const rotateUnitQrCode = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const qr = await unitQrService.getUnitQr(req.params.id as string, user, true);
+    writeSuccess(res, 200, 'Unit QR code regenerated; previously printed codes no longer work', qr);
+  } catch (error: any) {
+    const message = error.message || 'Failed to regenerate unit QR code';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const processUnitQrScan = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const result = await unitQrService.processUnitQr(req.body || {}, user);
+    writeSuccess(res, 201, 'Scan recorded successfully', result);
+  } catch (error: any) {
+    const message = error.message || 'Failed to process unit QR scan';
+    writeError(res, statusFor(message), message);
+  }
+};
+
+export const getUnitQrScans = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const history = await unitQrService.getScanHistory(req.params.id as string, req.query as Record<string, string>, user);
+    writeSuccess(res, 200, 'Unit scan history retrieved successfully', history);
+  } catch (error: any) {
+    const message = error.message || 'Failed to get unit scan history';
+    writeError(res, statusFor(message), message);
+  }
+};
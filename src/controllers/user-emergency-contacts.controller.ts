@@ -0,0 +1,98 @@
+import { Request, Response } from 'express';
+import { UserEmergencyContactsService } from '../services/user-emergency-contacts.service.js';
+import { writeSuccess, writeError } from '../utils/response.js';
+import { JWTClaims } from '../types/index.js';
+import { statusFor } from '../utils/error-status.js';
+
+const userEmergencyContactsService = new UserEmergencyContactsService();
+
+/**
+ * Resolve the target user: /me routes act on the caller, /:userId routes on the given user
+ */
+const targetUserId = (req: Request): string => (req.params.userId as string) || (req.user as JWTClaims).user_id;
+
+export class UserEmergencyContactsController {
+  /**
+   * GET /api/v1/users/me/emergency-contacts
+   * GET /api/v1/users/:userId/emergency-contacts
+   */
+  getContacts = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const contacts = await userEmergencyContactsService.getContacts(targetUserId(req), user);
+      writeSuccess(res, 200, 'Emergency contacts retrieved successfully', contacts);
+    } catch (error: any) {
+      console.error('❌ Error getting user emergency contacts:', error);
+      writeError(res, statusFor(error.message || '', 500), error.message || 'Failed to retrieve emergency contacts');
+    }
+  };
+
+  /**
+   * POST /api/v1/users/me/emergency-contacts
+   * POST /api/v1/users/:userId/emergency-contacts
+   */
+  createContact = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const contact = await userEmergencyContactsService.createContact(targetUserId(req), req.body, user);
+      writeSuccess(res, 201, 'Emergency contact created successfully', contact);
+    } catch (error: any) {
+      console.error('❌ Error creating user emergency contact:', error);
+      writeError(res, statusFor(error.message || '', 400), error.message || 'Failed to create emergency contact');
+    }
+  };
+
+  /**
+   * PUT /api/v1/users/me/emergency-contacts/:contactId
+   * PUT /api/v1/users/:userId/emergency-contacts/:contactId
+   */
+  updateContact = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const contact = await userEmergencyContactsService.updateContact(
+        targetUserId(req),
+        req.params.contactId as string,
+        req.body,
+        user
+      );
+      writeSuccess(res, 200, 'Emergency contact updated successfully', contact);
+    } catch (error: any) {
+      console.error('❌ Error updating user emergency contact:', error);
+      writeError(res, statusFor(error.message || '', 400), error.message || 'Failed to update emergency contact');
+    }
+  };
+
+  /**
+   * PUT /api/v1/users/me/emergency-contacts/reorder
+   * PUT /api/v1/users/:userId/emergency-contacts/reorder
+   */
+  reorderContacts = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      const contacts = await userEmergencyContactsService.reorderContacts(
+        targetUserId(req),
+        req.body.contact_ids,
+        user
+      );
+      writeSuccess(res, 200, 'Emergency contacts reordered successfully', contacts);
+    } catch (error: any) {
+      console.error('❌ Error reordering user emergency contacts:', error);
+      writeError(res, statusFor(error.message || '', 400), error.message || 'Failed to reorder emergency contacts');
+    }
+  };
+
+  /**
+   * DELETE /api/v1/users/me/emergency-contacts/:contactId
+   * DELETE /api/v1/users/:userId/emergency-contacts/:contactId
+   */
+  deleteContact = async (req: Request, res: Response): Promise<void> => {
+    try {
+      const user = req.user as JWTClaims;
+      await userEmergencyContactsService.deleteContact(targetUserId(req), req.params.contactId as string, user);
+      writeSuccess(res, 200, 'Emergency contact deleted successfully', null);
+    } catch (error: any) {
+      console.error('❌ Error deleting user emergency contact:', error);
+      writeError(res, statusFor(error.message || '', 500), error.message || 'Failed to delete emergency contact');
+    }
+  };
+}
@@ -96,6 +96,45 @@ export const getUserNotificationSettings = async (req: Request, res: Response) =
   }
 };
 
+/**
+ * Get any user's resolved communication channels (email/SMS/push/WhatsApp,
+ * language and quiet hours) as used by the notification service
+ */
+export const getUserChannelPreferences = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const { userId } = req.params;
+
+    if (!userId) {
+      return res.status(400).json({
+        success: false,
+        message: 'User ID is required',
+      });
+    }
+
+    const hasPermission = await (settingsService as any).checkPermission(user, userId);
+    if (!hasPermission) {
+      return res.status(403).json({
+        success: false,
+        message: 'Permission denied: You do not have access to view this user\'s communication preferences',
+      });
+    }
+
+    const preferences = await settingsService.getChannelPreferences(userId);
+
+    res.json({
+      success: true,
+      data: preferences,
+    });
+  } catch (error: any) {
+    console.error('Error getting user channel preferences:', error);
+    res.status(500).json({
+      success: false,
+      message: error.message || 'Failed to retrieve communication preferences',
+    });
+  }
+};
+
 /**
  * Get security activity for any user (for landlords/staff/admins)
  * Requires appropriate permissions
@@ -179,6 +218,7 @@ export const getTenantsCommunicationPreferences = async (req: Request, res: Resp
             enable_email: true,
             enable_sms: true,
             enable_push_notifications: true,
+            enable_whatsapp: true,
             language: true,
           },
         },
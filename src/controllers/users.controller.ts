@@ -327,7 +327,7 @@ export const upgradeToAgency = async (req: Request, res: Response) => {
 export const registerPushToken = async (req: Request, res: Response) => {
   try {
     const user = (req as any).user as JWTClaims;
-    const { token, platform = 'web', device_id, device_info } = req.body;
+    const { token, platform = 'web', device_id, device_info, enable_push_notifications } = req.body;
 
     if (!token) {
       return writeError(res, 400, 'Push token is required');
@@ -342,7 +342,8 @@ export const registerPushToken = async (req: Request, res: Response) => {
       token,
       platform as 'web' | 'ios' | 'android',
       device_id,
-      device_info
+      device_info,
+      { optIn: enable_push_notifications === true }
     );
 
     if (success) {
@@ -377,3 +378,25 @@ export const unregisterPushToken = async (req: Request, res: Response) => {
     return writeError(res, 500, error.message || 'Failed to unregister push token');
   }
 };
+
+export const getPushDevices = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    const devices = await pushNotificationService.getUserDevices(user.user_id);
+    writeSuccess(res, 200, 'Registered devices retrieved successfully', devices);
+  } catch (error: any) {
+    console.error('Error retrieving push devices:', error);
+    writeError(res, 500, error.message || 'Failed to retrieve registered devices');
+  }
+};
+
+export const removePushDevice = async (req: Request, res: Response) => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    await pushNotificationService.unregisterDevice(user.user_id, req.params.deviceId as string);
+    writeSuccess(res, 200, 'Device unregistered successfully');
+  } catch (error: any) {
+    const message = error.message || 'Failed to unregister device';
+    writeError(res, message.includes('not found') ? 404 : 500, message);
+  }
+};
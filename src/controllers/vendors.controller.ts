@@ -5,6 +5,74 @@ import { writeSuccess, writeError } from '../utils/response.js';
 
 const prisma = getPrisma();
 
+const VENDOR_STATUSES = ['active', 'inactive', 'blacklisted'];
+const INSURANCE_WARNING_DAYS = 30;
+
+const toVendorResponse = (v: any) => {
+  const now = new Date();
+  const warnBefore = new Date(now.getTime() + INSURANCE_WARNING_DAYS * 24 * 60 * 60 * 1000);
+  return {
+    id: v.id,
+    name: v.name,
+    category: v.category ?? v.service_type,
+    service_type: v.service_type ?? v.category,
+    contact_person: v.contact_person,
+    phone: v.phone,
+    alternate_phone: v.alternate_phone,
+    email: v.email,
+    address: v.address,
+    hourly_rate: v.hourly_rate != null ? Number(v.hourly_rate) : null,
+    callout_fee: v.callout_fee != null ? Number(v.callout_fee) : null,
+    currency: v.currency,
+    license_number: v.license_number,
+    insurance_provider: v.insurance_provider,
+    insurance_policy_number: v.insurance_policy_number,
+    insurance_expiry: v.insurance_expiry,
+    insurance_expired: !!v.insurance_expiry && v.insurance_expiry < now,
+    insurance_expiring_soon: !!v.insurance_expiry && v.insurance_expiry >= now && v.insurance_expiry <= warnBefore,
+    rating: v.rating != null ? Number(v.rating) : null,
+    rating_count: v.rating_count,
+    status: v.status,
+    notes: v.notes,
+    created_at: v.created_at,
+    updated_at: v.updated_at,
+  };
+};
+
+const optionalText = (value: any) => (value == null ? null : String(value).trim() || null);
+const optionalAmount = (value: any) => {
+  if (value === null || value === '') return null;
+  const amount = Number(value);
+  if (isNaN(amount) || amount < 0) throw new Error('rates must be positive numbers');
+  return amount;
+};
+const optionalDate = (value: any) => {
+  if (!value) return null;
+  const date = new Date(value);
+  if (isNaN(date.getTime())) throw new Error('insurance_expiry must be a valid date');
+  return date;
+};
+
+// Fields shared by create and update; only keys present in the body are returned
+const vendorDetails = (body: any) => {
+  if (body.status !== undefined && !VENDOR_STATUSES.includes(body.status)) {
+    throw new Error(`status must be one of: ${VENDOR_STATUSES.join(', ')}`);
+  }
+  return {
+    ...(body.contact_person !== undefined && { contact_person: optionalText(body.contact_person) }),
+    ...(body.alternate_phone !== undefined && { alternate_phone: optionalText(body.alternate_phone) }),
+    ...(body.hourly_rate !== undefined && { hourly_rate: optionalAmount(body.hourly_rate) }),
+    ...(body.callout_fee !== undefined && { callout_fee: optionalAmount(body.callout_fee) }),
+    ...(body.currency && { currency: String(body.currency).trim().toUpperCase().slice(0, 3) }),
+    ...(body.license_number !== undefined && { license_number: optionalText(body.license_number) }),
+    ...(body.insurance_provider !== undefined && { insurance_provider: optionalText(body.insurance_provider) }),
+    ...(body.insurance_policy_number !== undefined && { insurance_policy_number: optionalText(body.insurance_policy_number) }),
+    ...(body.insurance_expiry !== undefined && { insurance_expiry: optionalDate(body.insurance_expiry) }),
+    ...(body.status !== undefined && { status: body.status }),
+    ...(body.notes !== undefined && { notes: optionalText(body.notes) }),
+  };
+};
+
 export const listVendors = async (req: Request, res: Response): Promise<void> => {
   try {
     const user = (req as any).user as JWTClaims;
@@ -20,23 +88,29 @@ export const listVendors = async (req: Request, res: Response): Promise<void> =>
         { category: { contains: search, mode: 'insensitive' } },
         { service_type: { contains: search, mode: 'insensitive' } },
         { email: { contains: search, mode: 'insensitive' } },
+        { contact_person: { contains: search, mode: 'insensitive' } },
       ];
     }
+    const trade = (req.query.category as string)?.trim();
+    if (trade) {
+      where.AND = [{ OR: [{ category: trade }, { service_type: trade }] }];
+    }
+    if (req.query.status) {
+      where.status = req.query.status as string;
+    }
+    if (req.query.insurance === 'expired') {
+      where.insurance_expiry = { lt: new Date() };
+    } else if (req.query.insurance === 'expiring') {
+      where.insurance_expiry = {
+        gte: new Date(),
+        lte: new Date(Date.now() + INSURANCE_WARNING_DAYS * 24 * 60 * 60 * 1000),
+      };
+    }
     const vendors = await prisma.vendor.findMany({
       where,
       orderBy: { name: 'asc' },
     });
-    const data = vendors.map((v) => ({
-      id: v.id,
-      name: v.name,
-      category: v.category ?? v.service_type,
-      service_type: v.service_type ?? v.category,
-      phone: v.phone,
-      email: v.email,
-      address: v.address,
-      created_at: v.created_at,
-      updated_at: v.updated_at,
-    }));
+    const data = vendors.map(toVendorResponse);
     writeSuccess(res, 200, 'Vendors retrieved successfully', data);
   } catch (error: any) {
     console.error('Vendors list error:', error);
@@ -44,6 +118,53 @@ export const listVendors = async (req: Request, res: Response): Promise<void> =>
   }
 };
 
+export const getVendor = async (req: Request, res: Response): Promise<void> => {
+  try {
+    const user = (req as any).user as JWTClaims;
+    if (!user.company_id) {
+      writeError(res, 403, 'User must be associated with a company');
+      return;
+    }
+    const vendor = await prisma.vendor.findFirst({
+      where: { id: req.params.id as string, company_id: user.company_id },
+    });
+    if (!vendor) {
+      writeError(res, 404, 'Vendor not found');
+      return;
+    }
+    const [workOrders, openCount, completedCount] = await Promise.all([
+      prisma.maintenanceRequest.findMany({
+        where: { vendor_id: vendor.id },
+        select: {
+          id: true,
+          title: true,
+          status: true,
+          priority: true,
+          actual_cost: true,
+          vendor_rating: true,
+          requested_date: true,
+          completed_date: true,
+          property: { select: { id: true, name: true } },
+          unit: { select: { id: true, unit_number: true } },
+        },
+        orderBy: { created_at: 'desc' },
+        take: 50,
+      }),
+      prisma.maintenanceRequest.count({ where: { vendor_id: vendor.id, status: { in: ['pending', 'in_progress'] } } }),
+      prisma.maintenanceRequest.count({ where: { vendor_id: vendor.id, status: 'completed' } }),
+    ]);
+    writeSuccess(res, 200, 'Vendor retrieved successfully', {
+      ...toVendorResponse(vendor),
+      open_work_orders: openCount,
+      completed_work_orders: completedCount,
+      work_orders: workOrders,
+    });
+  } catch (error: any) {
+    console.error('Vendor get error:', error);
+    writeError(res, 500, error.message || 'Failed to retrieve vendor');
+  }
+};
+
 export const createVendor = async (req: Request, res: Response): Promise<void> => {
   try {
     const user = (req as any).user as JWTClaims;
@@ -51,12 +172,24 @@ export const createVendor = async (req: Request, res: Response): Promise<void> =
       writeError(res, 403, 'User must be associated with a company');
       return;
     }
+    // Tenants share the maintenance permissions to raise and edit requests, not to manage vendors
+    if (user.role === 'tenant') {
+      writeError(res, 403, 'insufficient permissions to manage vendors');
+      return;
+    }
     const body = req.body;
     const name = (body.name || '').toString().trim();
     if (!name) {
       writeError(res, 400, 'Vendor name is required');
       return;
     }
+    let details;
+    try {
+      details = vendorDetails(body);
+    } catch (validationError: any) {
+      writeError(res, 400, validationError.message);
+      return;
+    }
     const vendor = await prisma.vendor.create({
       data: {
         company_id: user.company_id,
@@ -66,19 +199,10 @@ export const createVendor = async (req: Request, res: Response): Promise<void> =
         phone: body.phone?.trim() || null,
         email: body.email?.trim() || null,
         address: body.address?.trim() || null,
+        ...details,
       },
     });
-    const data = {
-      id: vendor.id,
-      name: vendor.name,
-      category: vendor.category ?? vendor.service_type,
-      service_type: vendor.service_type ?? vendor.category,
-      phone: vendor.phone,
-      email: vendor.email,
-      address: vendor.address,
-      created_at: vendor.created_at,
-      updated_at: vendor.updated_at,
-    };
+    const data = toVendorResponse(vendor);
     writeSuccess(res, 201, 'Vendor created successfully', data);
   } catch (error: any) {
     console.error('Vendor create error:', error);
@@ -93,6 +217,10 @@ export const updateVendor = async (req: Request, res: Response): Promise<void> =
       writeError(res, 403, 'User must be associated with a company');
       return;
     }
+    if (user.role === 'tenant') {
+      writeError(res, 403, 'insufficient permissions to manage vendors');
+      return;
+    }
     const id = req.params.id;
     const existing = await prisma.vendor.findFirst({
       where: { id, company_id: user.company_id },
@@ -102,6 +230,13 @@ export const updateVendor = async (req: Request, res: Response): Promise<void> =
       return;
     }
     const body = req.body;
+    let details;
+    try {
+      details = vendorDetails(body);
+    } catch (validationError: any) {
+      writeError(res, 400, validationError.message);
+      return;
+    }
     const vendor = await prisma.vendor.update({
       where: { id },
       data: {
@@ -111,20 +246,11 @@ export const updateVendor = async (req: Request, res: Response): Promise<void> =
         ...(body.phone !== undefined && { phone: body.phone?.trim() || null }),
         ...(body.email !== undefined && { email: body.email?.trim() || null }),
         ...(body.address !== undefined && { address: body.address?.trim() || null }),
+        ...details,
         updated_at: new Date(),
       },
     });
-    const data = {
-      id: vendor.id,
-      name: vendor.name,
-      category: vendor.category ?? vendor.service_type,
-      service_type: vendor.service_type ?? vendor.category,
-      phone: vendor.phone,
-      email: vendor.email,
-      address: vendor.address,
-      created_at: vendor.created_at,
-      updated_at: vendor.updated_at,
-    };
+    const data = toVendorResponse(vendor);
     writeSuccess(res, 200, 'Vendor updated successfully', data);
   } catch (error: any) {
     console.error('Vendor update error:', error);
@@ -466,3 +466,46 @@ export const handlePaystackWebhook = async (req: Request, res: Response) => {
   }
 };
 
+
+/**
+ * SMS delivery reports from Africa's Talking or Twilio, authenticated by the shared ?token=
+ */
+export const handleSmsDeliveryReport = async (req: Request, res: Response) => {
+  try {
+    const { smsService } = await import('../services/sms.service.js');
+    await smsService.handleDeliveryReport(req.params.provider as string, req.body || {}, req.query.token as string | undefined);
+    return res.status(200).json({ success: true });
+  } catch (error: any) {
+    console.error('❌ SMS delivery report error:', error.message);
+    const status = error.message.includes('token') ? 401
+      : error.message.includes('not found') ? 404
+      : error.message.includes('missing') ? 400 : 500;
+    return res.status(status).json({ success: false, error: error.message });
+  }
+};
+
+/**
+ * Inbound email replies to conversations. Mail we decline (unknown address, spoofed sender,
+ * archived chat) still gets a 200 so the provider doesn't keep retrying it.
+ */
+export const handleInboundEmail = async (req: Request, res: Response) => {
+  try {
+    const { messageEmailService } = await import('../services/message-email.service.js');
+    const provider = req.params.provider as string;
+    let result;
+    if (provider === 'mailgun') {
+      result = await messageEmailService.handleMailgun(req.body || {}, (req.files as Express.Multer.File[]) || []);
+    } else if (provider === 'ses') {
+      result = await messageEmailService.handleSes(typeof req.body === 'string' ? req.body : JSON.stringify(req.body || {}));
+    } else {
+      return res.status(404).json({ success: false, error: `Inbound email provider not found: ${provider}` });
+    }
+    return res.status(200).json({ success: true, ...result });
+  } catch (error: any) {
+    console.error('❌ Inbound email error:', error.message);
+    const status = error.message.includes('signature') || error.message.includes('topic') ? 401
+      : error.message.includes('not configured') ? 503
+      : error.message.includes('missing') ? 400 : 500;
+    return res.status(status).json({ success: false, error: error.message });
+  }
+};
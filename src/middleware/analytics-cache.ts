@@ -0,0 +1,41 @@
+import { Request, Response, NextFunction } from 'express';
+import { getCachedAnalytics, setCachedAnalytics } from '../utils/analytics-cache.js';
+
+/**
+ * Cache successful GET responses of heavy analytics endpoints for a short time.
+ * Entries are per user (figures are role-scoped); clients can force a fresh result
+ * by sending `Cache-Control: no-cache`.
+ */
+export function cacheAnalytics(ttlSeconds: number = 60) {
+  return (req: Request, res: Response, next: NextFunction) => {
+    const user = (req as any).user;
+    if (req.method !== 'GET' || !user) {
+      return next();
+    }
+
+    const key = `${user.user_id}:${user.role}:${req.originalUrl}`;
+    const bypass = String(req.headers['cache-control'] || '').includes('no-cache');
+    const cached = bypass ? null : getCachedAnalytics(key);
+    if (cached) {
+      const remaining = Math.max(0, Math.ceil((cached.expiresAt - Date.now()) / 1000));
+      res.setHeader('Cache-Control', `private, max-age=${remaining}`);
+      res.setHeader('X-Cache', 'HIT');
+      return res.status(200).json(cached.body);
+    }
+
+    res.setHeader('Cache-Control', `private, max-age=${ttlSeconds}`);
+    res.setHeader('X-Cache', 'MISS');
+    const json = res.json.bind(res);
+    res.json = (body: any) => {
+      if (res.statusCode === 200 && body?.success !== false) {
+        // Platform-wide figures are not tied to a company
+        const companyId = user.role === 'super_admin' ? null : user.company_id || null;
+        setCachedAnalytics(key, body, ttlSeconds * 1000, companyId);
+      } else {
+        res.setHeader('Cache-Control', 'no-store');
+      }
+      return json(body);
+    };
+    next();
+  };
+}
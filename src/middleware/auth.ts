@@ -2,6 +2,8 @@ import { Request, Response, NextFunction } from 'express';
 import jwt from 'jsonwebtoken';
 import { env } from '../config/env.js';
 import { JWTClaims, UserRole } from '../types/index.js';
+import { usageMeteringService } from '../services/usage-metering.service.js';
+import { runAsUser } from '../utils/request-context.js';
 
 export const requireAuth = (req: Request, res: Response, next: NextFunction) => {
 	const header = req.headers.authorization || '';
@@ -21,7 +23,19 @@ export const requireAuth = (req: Request, res: Response, next: NextFunction) =>
 		}
 		
 		(req as any).user = claims;
-		return next();
+		// Everything after this runs with the caller on record, which scopes the shared Prisma client
+		return runAsUser(claims, () => {
+			// Access tokens outlive an agency suspension, so agency users are checked on each request
+			if (claims.agency_id && claims.role !== 'super_admin') {
+				// Routers that repeat requireAuth would otherwise count the call twice
+				if (!(req as any).usageMetered) {
+					(req as any).usageMetered = true;
+					usageMeteringService.record({ agencyId: claims.agency_id }, 'api_calls');
+				}
+				return rejectSuspendedAgency(claims.agency_id, res, next);
+			}
+			return next();
+		});
 	} catch (e: any) {
 		// ✅ SECURITY: Provide specific error for expired tokens
 		if (e.name === 'TokenExpiredError') {
@@ -39,6 +53,24 @@ export const requireAuth = (req: Request, res: Response, next: NextFunction) =>
 	}
 };
 
+const rejectSuspendedAgency = async (agencyId: string, res: Response, next: NextFunction) => {
+	try {
+		const { agenciesService } = await import('../services/agencies.service.js');
+		if (await agenciesService.isSuspended(agencyId)) {
+			return res.status(403).json({
+				success: false,
+				message: 'Your agency has been suspended. Contact support for help.',
+				code: 'AGENCY_SUSPENDED'
+			});
+		}
+		return next();
+	} catch (error: any) {
+		console.error('Error checking agency suspension:', error);
+		// On error, allow access but log it
+		return next();
+	}
+};
+
 export const requireRole = (roles: UserRole[]) => (req: Request, res: Response, next: NextFunction) => {
 	const user = (req as any).user as JWTClaims | undefined;
 	if (!user) return res.status(401).json({ success: false, message: 'Unauthorized' });
@@ -0,0 +1,49 @@
+import { Request, Response, NextFunction } from 'express';
+import { JWTClaims } from '../types/index.js';
+import { planLimitsService, PlanLimitError, PlanResource } from '../services/plan-limits.service.js';
+
+const UNCOUNTED_ROLES = ['tenant', 'landlord'];
+
+/**
+ * Refuse a create that would take the caller's company past its subscription plan, with 402 and
+ * what upgrading would allow. `count` says how many the request adds (a batch of units, say);
+ * super admins are not limited.
+ */
+export function enforcePlanLimit(resource: PlanResource, count: (req: Request) => number = () => 1) {
+  return async (req: Request, res: Response, next: NextFunction) => {
+    const user = (req as any).user as JWTClaims | undefined;
+    if (!user || user.role === 'super_admin' || !user.company_id) {
+      return next();
+    }
+
+    try {
+      await planLimitsService.check(user.company_id, resource, count(req));
+      next();
+    } catch (error: any) {
+      if (error instanceof PlanLimitError) {
+        return res.status(402).json({
+          success: false,
+          message: `${error.message}. Upgrade your plan to add more.`,
+          error_code: 'PLAN_LIMIT_REACHED',
+          data: {
+            resource: error.resource,
+            plan: error.plan,
+            limit: error.limit,
+            usage: error.usage,
+            requested: error.requested,
+            upgrade: error.upgrade,
+            upgrade_url: '/settings?tab=subscription',
+          },
+        });
+      }
+      // A failed check must not block the create
+      console.error('Error checking plan limits:', error);
+      next();
+    }
+  };
+}
+
+/**
+ * Staff-like users count against the plan; tenants and landlords don't
+ */
+export const countsAsPlanUser = (req: Request) => (UNCOUNTED_ROLES.includes(req.body?.role) ? 0 : 1);
@@ -11,6 +11,8 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		agents: ['*'],
 		dashboard: ['*'],
 		financial: ['*'],
+		expenses: ['*'],
+		budgets: ['*'],
 		invoices: ['*'],
 		maintenance: ['*'],
 		inspections: ['*'],
@@ -40,6 +42,8 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		agents: ['create', 'read', 'update', 'delete', 'assign'],
 		dashboard: ['read', 'kpis', 'charts'],
 		financial: ['read', 'overview', 'payments', 'rent-collection'],
+		expenses: ['create', 'read', 'update', 'delete'],
+		budgets: ['create', 'read', 'update', 'delete'],
 		invoices: ['create', 'read', 'update', 'delete', 'send', 'mark-paid', 'export', 'bulk', 'stats'],
 		maintenance: ['create', 'read', 'update', 'delete', 'overview'],
 		inspections: ['create', 'read', 'update', 'delete', 'overview', 'schedule'],
@@ -70,6 +74,8 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		agents: ['create', 'read', 'update', 'delete', 'assign'],
 		dashboard: ['read', 'update', 'kpis', 'charts'],
 		financial: ['read', 'overview', 'payments', 'rent-collection'],
+		expenses: ['create', 'read', 'update', 'delete'],
+		budgets: ['create', 'read', 'update', 'delete'],
 		invoices: ['create', 'read', 'update', 'delete', 'send', 'mark-paid', 'export', 'bulk', 'stats'],
 		maintenance: ['create', 'read', 'update', 'delete', 'overview'],
 		inspections: ['create', 'read', 'update', 'delete', 'overview', 'schedule'],
@@ -106,7 +112,7 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		leases: ['create', 'read'],
 		assignments: ['read'],
 		checklists: ['create', 'read', 'update'],
-		emergency: ['read'],
+		emergency: ['create', 'read', 'update'], // Raise and acknowledge; resolving and settings check roles
 		documents: ['read'],
 	},
 	caretaker: {
@@ -127,12 +133,12 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		payments: ['create', 'read'],
 		assignments: ['read'],
 		checklists: ['create', 'read', 'update'],
-		emergency: ['read'],
+		emergency: ['create', 'read', 'update'], // Raise and acknowledge; resolving and settings check roles
 		documents: ['read'],
 	},
 	tenant: {
 		units: ['read'],
-		maintenance: ['create', 'read'],
+		maintenance: ['create', 'read', 'update'], // Edit or cancel their own pending requests; other updates check roles
 		invoices: ['read'],
 		payments: ['read', 'create'], // Allow tenants to read and create (cancel) their own payments
 		notifications: ['create', 'read', 'update', 'delete'], // Allow tenants to delete their own notifications
@@ -185,7 +191,7 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		payments: ['create', 'read'],
 		assignments: ['read'],
 		checklists: ['create', 'read', 'update'],
-		emergency: ['read'],
+		emergency: ['create', 'read', 'update'], // Raise and acknowledge; resolving and settings check roles
 		documents: ['read'],
 	},
 	receptionist: {
@@ -205,10 +211,13 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		tenants: ['read'], // Read-only, no editing
 		dashboard: ['read'],
 		financial: ['read', 'overview', 'payments', 'rent-collection'],
+		expenses: ['create', 'read', 'update'],
+		budgets: ['read'],
 		invoices: ['read', 'update', 'export', 'stats'],
 		payments: ['read', 'update', 'approve'],
 		reports: ['read', 'generate'],
 		leases: ['read'],
+		notifications: ['read'],
 		documents: ['read'],
 	},
 	admin: {
@@ -217,6 +226,8 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		tenants: ['read', 'update'],
 		dashboard: ['read', 'kpis', 'charts'],
 		financial: ['read', 'overview'],
+		expenses: ['read'],
+		budgets: ['read'],
 		invoices: ['read', 'update'],
 		maintenance: ['read', 'update'],
 		inspections: ['read', 'update'],
@@ -237,6 +248,8 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		tenants: ['read', 'update'],
 		dashboard: ['read', 'kpis', 'charts'],
 		financial: ['read', 'overview'],
+		expenses: ['read'],
+		budgets: ['read'],
 		invoices: ['read', 'update'],
 		maintenance: ['read', 'update', 'overview'],
 		inspections: ['read', 'update', 'schedule'],
@@ -288,10 +301,13 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		tenants: ['read'], // Read-only, no editing
 		dashboard: ['read'],
 		financial: ['read', 'overview', 'payments', 'rent-collection'],
+		expenses: ['create', 'read', 'update', 'delete'],
+		budgets: ['read'],
 		invoices: ['read', 'update', 'export', 'stats'],
 		payments: ['read', 'update', 'approve'],
 		reports: ['read', 'generate'],
 		leases: ['read'],
+		notifications: ['read'],
 		documents: ['read'],
 	},
 	sales: {
@@ -345,11 +361,14 @@ const permissions: Record<UserRole, Record<string, string[]>> = {
 		tenants: ['read'],
 		dashboard: ['read'],
 		financial: ['read'],
+		expenses: ['read'],
+		budgets: ['read'],
 		invoices: ['read'],
 		payments: ['read'],
 		reports: ['read', 'generate'],
 		leases: ['read'],
 		users: ['read'],
+		notifications: ['read'],
 		// Read-only access to everything for auditing
 		documents: ['read'],
 	},
@@ -0,0 +1,53 @@
+import { Request, Response, NextFunction } from 'express';
+import { reportAuditService } from '../services/report-audit.service.js';
+
+type FromRequest = string | ((req: Request) => string | undefined);
+
+interface AuditOptions {
+  reportType?: FromRequest;
+  format?: FromRequest;
+  resourceType?: string;
+  resourceParam?: string;
+}
+
+// Request body fields worth keeping as parameters; anything else (report rows, summaries) is not stored
+const BODY_PARAMETERS = ['report_type', 'document_type', 'invoice_id', 'filters', 'format', 'expires_in', 'company_id', 'title', 'reportType'];
+
+const resolve = (value: FromRequest | undefined, req: Request) => (typeof value === 'function' ? value(req) : value);
+
+/**
+ * Record a report view, export or download link once the response succeeded.
+ * Without a report type option, the last path segment names the report (/reports/rent-roll -> rent-roll).
+ */
+export function auditReportAccess(action: string, options: AuditOptions = {}) {
+  return (req: Request, res: Response, next: NextFunction) => {
+    // Route params and path are only reliable while the route is matched
+    const reportType = resolve(options.reportType, req) || req.path.split('/').filter(Boolean).pop() || 'overview';
+    const format = resolve(options.format, req) || (req.query.format as string) || null;
+    const resourceId = options.resourceParam ? (req.params[options.resourceParam] as string) : null;
+
+    res.on('finish', () => {
+      const user = (req as any).user;
+      if (!user || res.statusCode >= 400) return;
+
+      const body = req.body && typeof req.body === 'object' ? req.body : {};
+      const parameters = {
+        ...req.query,
+        ...Object.fromEntries(BODY_PARAMETERS.filter(key => body[key] !== undefined).map(key => [key, body[key]])),
+      };
+
+      void reportAuditService.record({
+        user,
+        action,
+        report_type: String(reportType),
+        format,
+        parameters,
+        resource_type: options.resourceType,
+        resource_id: resourceId,
+        ip_address: req.ip || null,
+        user_agent: req.get('user-agent') || null,
+      });
+    });
+    next();
+  };
+}
@@ -0,0 +1,91 @@
+import { Request, Response, NextFunction } from 'express';
+import { systemLogsService } from '../services/system-logs.service.js';
+
+// Requests slower than this are logged for the slow endpoints view
+export const SLOW_REQUEST_MS = 2000;
+const ID_SEGMENT = /\/(?:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|\d+)(?=\/|$)/gi;
+// Request body fields never copied into an admin action entry
+const SECRET_FIELDS = /password|token|secret|key|pin/i;
+
+/**
+ * Record server errors, slow requests and super admin writes to the system log once the
+ * response is sent. Successful, quick requests are left to the access log.
+ */
+export function logRequests(req: Request, res: Response, next: NextFunction) {
+  const started = process.hrtime.bigint();
+  // Controllers answer failures with writeError rather than throwing, so the message is taken from the body
+  const json = res.json.bind(res);
+  res.json = (body: any) => {
+    if (res.statusCode >= 500 && body && typeof body === 'object') {
+      res.locals.errorMessage = body.message;
+    }
+    return json(body);
+  };
+
+  res.on('finish', () => {
+    const duration = Number((process.hrtime.bigint() - started) / 1_000_000n);
+    const user = (req as any).user;
+    const path = routeOf(req);
+    const base = {
+      service: serviceOf(req),
+      method: req.method,
+      path,
+      status_code: res.statusCode,
+      duration_ms: duration,
+      user,
+      ip_address: req.headers['x-forwarded-for']?.toString().split(',')[0] || req.ip || null,
+    };
+
+    if (res.statusCode >= 500) {
+      const error = res.locals.error;
+      void systemLogsService.record({
+        ...base,
+        level: 'error',
+        event: 'request_error',
+        message: error?.message || res.locals.errorMessage || `${req.method} ${path} failed with ${res.statusCode}`,
+        metadata: error?.stack ? { stack: String(error.stack).split('\n').slice(0, 10).join('\n') } : {},
+      });
+    } else if (duration >= SLOW_REQUEST_MS) {
+      void systemLogsService.record({
+        ...base,
+        level: 'warn',
+        event: 'slow_request',
+        message: `${req.method} ${path} took ${duration} ms`,
+      });
+    }
+
+    if (user?.role === 'super_admin' && req.method !== 'GET' && req.method !== 'HEAD' && req.method !== 'OPTIONS') {
+      const body = req.body && typeof req.body === 'object' && !Array.isArray(req.body) ? req.body : {};
+      void systemLogsService.record({
+        ...base,
+        level: 'info',
+        event: 'admin_action',
+        message: `${req.method} ${req.originalUrl.split('?')[0]}`,
+        metadata: {
+          params: req.params,
+          fields: Object.keys(body).filter(key => !SECRET_FIELDS.test(key)),
+        },
+      });
+    }
+  });
+  next();
+}
+
+// The matched route's pattern (/properties/:id) so one endpoint's requests group together;
+// unmatched requests keep their path with ids blanked out
+function routeOf(req: Request) {
+  if (req.route?.path && typeof req.route.path === 'string') {
+    return `${req.baseUrl}${req.route.path}`.replace(ID_SEGMENT, '/:id');
+  }
+  return req.originalUrl.split('?')[0].replace(ID_SEGMENT, '/:id');
+}
+
+// The area of the API a request went to, which stands in for the service that handled it
+function serviceOf(req: Request) {
+  const segments = req.originalUrl.split('?')[0].replace(/^\/api\/v1/, '').split('/').filter(Boolean);
+  if (segments.length === 0) {
+    return 'api';
+  }
+  // Agency features are mounted a level down (/agency/billing, /agency/staff)
+  return segments[0] === 'agency' && segments[1] ? `agency/${segments[1]}` : segments[0];
+}
@@ -76,3 +76,36 @@ export const requireSubscription = async (req: Request, res: Response, next: Nex
     next();
   }
 };
+
+/**
+ * Keep a company whose trial expired without a payment method read-only: reads go through,
+ * writes are refused until a payment method is added. Tenants aren't held to their landlord's
+ * subscription.
+ */
+export const blockWritesWhenExpired = async (req: Request, res: Response, next: NextFunction) => {
+  const user = (req as any).user as JWTClaims;
+
+  if (!user || !user.company_id || ['super_admin', 'tenant'].includes(user.role)) {
+    return next();
+  }
+  if (['GET', 'HEAD', 'OPTIONS'].includes(req.method)) {
+    return next();
+  }
+
+  try {
+    const { trialsService } = await import('../services/trials.service.js');
+    if (await trialsService.isReadOnly(user.company_id)) {
+      return res.status(402).json({
+        success: false,
+        message: 'Your trial has ended and your account is read-only. Add a payment method to restore full access.',
+        error_code: 'SUBSCRIPTION_EXPIRED',
+        redirect_to: '/landlord/settings?tab=subscription'
+      });
+    }
+    next();
+  } catch (error: any) {
+    console.error('Error checking subscription expiry:', error);
+    // On error, allow access but log it
+    next();
+  }
+};
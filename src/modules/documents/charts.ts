@@ -0,0 +1,126 @@
+/**
+ * Report charts drawn as standalone SVG and embedded as images, so they print identically
+ * in Chromium's PDF output without scripts or web fonts.
+ */
+
+export interface ChartPoint {
+  label: string;
+  value: number;
+}
+
+export interface ReportChart {
+  title: string;
+  kind: 'bar' | 'donut';
+  points: ChartPoint[];
+  /** Prefix for value labels, e.g. a currency code */
+  unit?: string;
+}
+
+const WIDTH = 640;
+const HEIGHT = 260;
+const PALETTE = ['#14b8a6', '#0ea5e9', '#6366f1', '#f59e0b', '#ef4444', '#22c55e', '#a855f7', '#64748b'];
+
+const escapeXml = (s: string) =>
+  String(s).replaceAll('&', '&amp;').replaceAll('<', '&lt;').replaceAll('>', '&gt;').replaceAll('"', '&quot;');
+
+const truncate = (s: string, max: number) => (s.length > max ? `${s.slice(0, max - 1)}…` : s);
+
+// 1234567 -> 1.2M; keeps axis labels short
+const compact = (value: number) => {
+  const abs = Math.abs(value);
+  if (abs >= 1e9) return `${Math.round(value / 1e8) / 10}B`;
+  if (abs >= 1e6) return `${Math.round(value / 1e5) / 10}M`;
+  if (abs >= 1e4) return `${Math.round(value / 1e2) / 10}K`;
+  return String(Math.round(value * 100) / 100);
+};
+
+const svg = (body: string) =>
+  `<svg xmlns="http://www.w3.org/2000/svg" width="${WIDTH}" height="${HEIGHT}" viewBox="0 0 ${WIDTH} ${HEIGHT}" ` +
+  `font-family="Helvetica, Arial, sans-serif">${body}</svg>`;
+
+function barChart(points: ChartPoint[], unit = ''): string {
+  const top = 16;
+  const bottom = 48;
+  const left = 56;
+  const plotWidth = WIDTH - left - 12;
+  const plotHeight = HEIGHT - top - bottom;
+  const max = Math.max(...points.map(p => p.value), 0) || 1;
+  const slot = plotWidth / points.length;
+  const barWidth = Math.min(48, slot * 0.7);
+
+  const grid = [0, 0.25, 0.5, 0.75, 1].map(f => {
+    const y = top + plotHeight * (1 - f);
+    return `<line x1="${left}" x2="${WIDTH - 12}" y1="${y}" y2="${y}" stroke="#e5e7eb"/>` +
+      `<text x="${left - 6}" y="${y + 3}" font-size="9" fill="#6b7280" text-anchor="end">${escapeXml(compact(max * f))}</text>`;
+  }).join('');
+
+  const bars = points.map((p, i) => {
+    const h = Math.max((Math.max(p.value, 0) / max) * plotHeight, p.value > 0 ? 1 : 0);
+    const x = left + slot * i + (slot - barWidth) / 2;
+    const y = top + plotHeight - h;
+    const cx = x + barWidth / 2;
+    return `<rect x="${x}" y="${y}" width="${barWidth}" height="${h}" rx="2" fill="${PALETTE[0]}"/>` +
+      `<text x="${cx}" y="${y - 4}" font-size="9" fill="#111827" text-anchor="middle">${escapeXml(`${unit}${compact(p.value)}`)}</text>` +
+      `<text x="${cx}" y="${HEIGHT - bottom + 14}" font-size="9" fill="#374151" text-anchor="middle">${escapeXml(truncate(p.label, Math.max(Math.floor(slot / 6), 4)))}</text>`;
+  }).join('');
+
+  return svg(`${grid}${bars}<line x1="${left}" x2="${WIDTH - 12}" y1="${top + plotHeight}" y2="${top + plotHeight}" stroke="#9ca3af"/>`);
+}
+
+function donutChart(points: ChartPoint[], unit = ''): string {
+  const cx = 130;
+  const cy = HEIGHT / 2;
+  const r = 90;
+  const inner = 52;
+  const total = points.reduce((sum, p) => sum + Math.max(p.value, 0), 0);
+
+  let angle = -Math.PI / 2;
+  const arc = (from: number, to: number) => {
+    const large = to - from > Math.PI ? 1 : 0;
+    const p = (a: number, radius: number) => `${cx + radius * Math.cos(a)} ${cy + radius * Math.sin(a)}`;
+    return `M ${p(from, r)} A ${r} ${r} 0 ${large} 1 ${p(to, r)} L ${p(to, inner)} A ${inner} ${inner} 0 ${large} 0 ${p(from, inner)} Z`;
+  };
+  const slices = total > 0
+    ? points.map((pt, i) => {
+      const share = Math.max(pt.value, 0) / total;
+      if (share === 0) return '';
+      // A full ring can't be drawn as one arc; split it in two
+      if (share >= 0.9999) {
+        const from = angle;
+        angle += 2 * Math.PI;
+        return `<path d="${arc(from, from + Math.PI)}" fill="${PALETTE[i % PALETTE.length]}"/>` +
+          `<path d="${arc(from + Math.PI, angle - 0.0001)}" fill="${PALETTE[i % PALETTE.length]}"/>`;
+      }
+      const from = angle;
+      angle += share * 2 * Math.PI;
+      return `<path d="${arc(from, angle)}" fill="${PALETTE[i % PALETTE.length]}"/>`;
+    }).join('')
+    : `<circle cx="${cx}" cy="${cy}" r="${(r + inner) / 2}" fill="none" stroke="#e5e7eb" stroke-width="${r - inner}"/>`;
+
+  const legend = points.slice(0, 10).map((pt, i) => {
+    const y = 30 + i * 20;
+    const share = total > 0 ? Math.round((Math.max(pt.value, 0) / total) * 1000) / 10 : 0;
+    return `<rect x="280" y="${y - 9}" width="10" height="10" rx="2" fill="${PALETTE[i % PALETTE.length]}"/>` +
+      `<text x="296" y="${y}" font-size="10" fill="#111827">${escapeXml(truncate(pt.label, 28))}</text>` +
+      `<text x="${WIDTH - 12}" y="${y}" font-size="10" fill="#374151" text-anchor="end">${escapeXml(`${unit}${compact(pt.value)} (${share}%)`)}</text>`;
+  }).join('');
+
+  return svg(`${slices}<text x="${cx}" y="${cy + 4}" font-size="12" font-weight="bold" fill="#111827" text-anchor="middle">` +
+    `${escapeXml(`${unit}${compact(total)}`)}</text>${legend}`);
+}
+
+/**
+ * One chart as an <img> figure for the report template
+ */
+export function renderChart(chart: ReportChart): string {
+  const points = chart.points.slice(0, chart.kind === 'donut' ? 8 : 12);
+  if (!points.length) return '';
+  const unit = chart.unit ? `${chart.unit} ` : '';
+  const image = chart.kind === 'donut' ? donutChart(points, unit) : barChart(points, unit);
+  return `
+    <figure class="chart">
+      <figcaption>${escapeXml(chart.title)}</figcaption>
+      <img src="data:image/svg+xml;base64,${Buffer.from(image).toString('base64')}" alt="${escapeXml(chart.title)}" />
+    </figure>
+  `;
+}
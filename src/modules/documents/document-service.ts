@@ -5,7 +5,10 @@ import { TemplateRegistry } from './template-registry.js';
 import { renderTemplate } from './simple-template.js';
 import { HtmlToPdfRenderer } from './html-to-pdf-renderer.js';
 import { formatDate, formatDateTime, formatMoney } from './formatters.js';
+import { renderChart, type ReportChart } from './charts.js';
 import { verificationService } from '../../services/verification.service.js';
+import { agencyBrandingService, type AgencyBrand } from '../../services/agency-branding.service.js';
+import { usageMeteringService, type UsageOwner } from '../../services/usage-metering.service.js';
 import { toShortReference } from '../../utils/format-payment-display.js';
 import crypto from 'crypto';
 
@@ -22,6 +25,46 @@ function escapeAttr(s: string): string {
   return String(s).replaceAll('"', '&quot;');
 }
 
+// Free text typed by users (inspection notes, captions) must not be able to inject markup
+function escapeText(s: string): string {
+  return String(s)
+    .replaceAll('&', '&amp;')
+    .replaceAll('<', '&lt;')
+    .replaceAll('>', '&gt;')
+    .replaceAll('"', '&quot;');
+}
+
+/**
+ * An agency's logo, colours and invoice footer as template fragments. The templates carry the
+ * LetRents navy; the colours here override it.
+ */
+function brandingSections(brand: AgencyBrand | null): Record<string, string> {
+  if (!brand) return { css: '', logoHtml: '', footerHtml: '' };
+  const primary = brand.primary_color;
+  const secondary = brand.secondary_color || primary;
+  const css = primary ? `
+    .company-name, .brand-name, .doc-title, .doc-title h1, .doc-number, .amount-value, .grand-total, .section h2 { color: ${primary}; }
+    .header { border-bottom-color: ${primary}; }
+    .company-brand { border-left-color: ${primary}; }
+    .grand-total { border-top-color: ${primary}; }
+    .doc-title-accent, .table thead, .table thead th, .breakdown-table thead { background: ${primary}; }
+    .header::after { background: linear-gradient(90deg, ${secondary} 0%, transparent 100%); }
+  ` : '';
+  return {
+    css,
+    logoHtml: brand.logo_url
+      ? `<img class="brand-logo" src="${escapeAttr(brand.logo_url)}" alt="${escapeAttr(brand.agency_name)}" style="display:block;max-height:48px;max-width:180px;margin-bottom:6px;">`
+      : '',
+    footerHtml: brand.invoice_footer
+      ? `<div class="brand-footer" style="margin-top:6px;white-space:pre-line;">${escapeText(brand.invoice_footer)}</div>`
+      : '',
+  };
+}
+
+function isImageSource(value: string): boolean {
+  return /^(data:image\/|https?:\/\/)/.test(value);
+}
+
 function buildLineItemsTable(items: Array<{ description: string; quantity?: number; unit_price?: number; total_price?: number }>, currency: string): string {
   const rows = items.map((it) => {
     const qty = it.quantity ?? 1;
@@ -112,8 +155,13 @@ export class DocumentService {
     documentType: DocumentType,
     version: TemplateVersion,
     context: Record<string, unknown>,
-    cacheKey: string
+    cacheKey: string,
+    usageOwner?: UsageOwner
   ): Promise<PdfBuffer> {
+    // Every document handed out counts towards the agency's usage, cached or not
+    if (usageOwner) {
+      usageMeteringService.record(usageOwner, 'documents_generated');
+    }
     const cached = this.getCached(cacheKey);
     if (cached) return cached;
 
@@ -913,8 +961,9 @@ export class DocumentService {
     
     await this.createSnapshotIfMissing('invoice', 'invoice', invoiceId, invoice.invoice_number, templateVersion, context, user);
 
-    const ck = this.cacheKey({ t: 'invoice', id: invoiceId, v: templateVersion, updated: invoice.updated_at?.toISOString?.() });
-    return this.renderDocument('invoice', templateVersion, renderContext, ck);
+    const brand = await agencyBrandingService.resolve({ agencyId: invoice.property?.agency_id, companyId: invoice.company_id });
+    const ck = this.cacheKey({ t: 'invoice', id: invoiceId, v: templateVersion, updated: invoice.updated_at?.toISOString?.(), brand: brand?.updated_at?.toISOString() });
+    return this.renderDocument('invoice', templateVersion, { ...renderContext, branding: brandingSections(brand) }, ck, { agencyId: invoice.property?.agency_id, companyId: invoice.company_id });
   }
 
   async getPaymentReceiptPdf(paymentId: string, user: JWTClaims, version: TemplateVersion = 1): Promise<PdfBuffer> {
@@ -995,8 +1044,9 @@ export class DocumentService {
     
     await this.createSnapshotIfMissing('payment_receipt', 'payment', paymentId, payment.receipt_number, templateVersion, context, user);
 
-    const ck = this.cacheKey({ t: 'payment_receipt', id: paymentId, v: templateVersion, updated: payment.updated_at?.toISOString?.() });
-    return this.renderDocument('payment_receipt', templateVersion, renderContext, ck);
+    const brand = await agencyBrandingService.resolve({ agencyId: payment.property?.agency_id, companyId: payment.company_id });
+    const ck = this.cacheKey({ t: 'payment_receipt', id: paymentId, v: templateVersion, updated: payment.updated_at?.toISOString?.(), brand: brand?.updated_at?.toISOString() });
+    return this.renderDocument('payment_receipt', templateVersion, { ...renderContext, branding: brandingSections(brand) }, ck, { agencyId: payment.property?.agency_id, companyId: payment.company_id });
   }
 
   async getRefundReceiptPdf(paymentId: string, user: JWTClaims, version: TemplateVersion = 1): Promise<PdfBuffer> {
@@ -1034,8 +1084,9 @@ export class DocumentService {
     
     await this.createSnapshotIfMissing('refund_receipt', 'payment', paymentId, payment.receipt_number, templateVersion, context, user);
 
-    const ck = this.cacheKey({ t: 'refund_receipt', id: paymentId, v: templateVersion, updated: payment.updated_at?.toISOString?.() });
-    return this.renderDocument('refund_receipt', templateVersion, renderContext, ck);
+    const brand = await agencyBrandingService.resolve({ agencyId: payment.property?.agency_id, companyId: payment.company_id });
+    const ck = this.cacheKey({ t: 'refund_receipt', id: paymentId, v: templateVersion, updated: payment.updated_at?.toISOString?.(), brand: brand?.updated_at?.toISOString() });
+    return this.renderDocument('refund_receipt', templateVersion, { ...renderContext, branding: brandingSections(brand) }, ck, { agencyId: payment.property?.agency_id, companyId: payment.company_id });
   }
 
   async getLeasePdf(leaseId: string, user: JWTClaims, version: TemplateVersion = 1): Promise<PdfBuffer> {
@@ -1062,8 +1113,9 @@ export class DocumentService {
     const renderContext = snapshot?.render_context ?? context;
     await this.createSnapshotIfMissing('lease', 'lease', leaseId, lease.lease_number, templateVersion, context, user);
 
-    const ck = this.cacheKey({ t: 'lease', id: leaseId, v: templateVersion, updated: lease.updated_at?.toISOString?.() });
-    return this.renderDocument('lease', templateVersion, renderContext, ck);
+    const brand = await agencyBrandingService.resolve({ agencyId: lease.property?.agency_id, companyId: lease.company_id });
+    const ck = this.cacheKey({ t: 'lease', id: leaseId, v: templateVersion, updated: lease.updated_at?.toISOString?.(), brand: brand?.updated_at?.toISOString() });
+    return this.renderDocument('lease', templateVersion, { ...(renderContext as Record<string, unknown>), branding: brandingSections(brand) }, ck, { agencyId: lease.property?.agency_id, companyId: lease.company_id });
   }
 
   async getTenantStatementPdf(
@@ -1201,8 +1253,139 @@ export class DocumentService {
       },
     };
 
-    const ck = this.cacheKey({ t: 'statement', id: tenantId, start: startIso, end: endIso, v: version, updated: tenant.updated_at?.toISOString?.() });
-    return this.renderDocument('statement', version, context, ck);
+    const agencyId = invoices.find(inv => inv.property?.agency_id)?.property?.agency_id;
+    const brand = await agencyBrandingService.resolve({ agencyId, companyId: tenant.company_id });
+    const ck = this.cacheKey({ t: 'statement', id: tenantId, start: startIso, end: endIso, v: version, updated: tenant.updated_at?.toISOString?.(), brand: brand?.updated_at?.toISOString() });
+    return this.renderDocument('statement', version, { ...context, branding: brandingSections(brand) }, ck, { agencyId, companyId: tenant.company_id });
+  }
+
+  /**
+   * Inspection report with scores, room-by-room results, photos and signatures.
+   * Access is enforced by the caller (checklists service or a report share token).
+   */
+  async getInspectionReportPdf(inspectionId: string, version: TemplateVersion = 1): Promise<PdfBuffer> {
+    const inspection = await this.prisma.inspection.findUnique({
+      where: { id: inspectionId },
+      include: {
+        company: true,
+        template: {
+          include: {
+            categories: {
+              include: { items: { orderBy: { display_order: 'asc' } } },
+              orderBy: { display_order: 'asc' },
+            },
+          },
+        },
+        property: { select: { name: true, street: true, city: true, agency_id: true } },
+        unit: { select: { unit_number: true } },
+        tenant: { select: { first_name: true, last_name: true } },
+        inspector: { select: { first_name: true, last_name: true } },
+        items: true,
+        photos: { orderBy: { created_at: 'asc' } },
+      },
+    });
+    if (!inspection) throw new Error('Inspection not found');
+
+    const { company } = inspection;
+    const { conditionScaleOf } = await import('../../services/checklists.service.js');
+    const scale = conditionScaleOf(inspection.template);
+    const labelFor = (condition: string | null) =>
+      condition ? scale.find(entry => entry.value === condition)?.label || condition.replaceAll('_', ' ') : 'Not recorded';
+    const typeLabel = inspection.inspection_type.replaceAll('_', ' ').replace(/^./, c => c.toUpperCase());
+    const personName = (p: { first_name: string; last_name: string } | null) => (p ? `${p.first_name} ${p.last_name}` : '');
+
+    const resultsByItem = new Map(inspection.items.map(item => [item.checklist_item_id, item]));
+    const rooms = inspection.template.categories.map(category => {
+      const rows = category.items.map(checklistItem => {
+        const result = resultsByItem.get(checklistItem.id);
+        const photos = (Array.isArray(result?.photo_urls) ? (result!.photo_urls as string[]) : [])
+          .filter(url => typeof url === 'string' && isImageSource(url))
+          .map(url => `<img src="${escapeAttr(url.startsWith('http') ? `${url}?tr=w-160,h-160,c-at_max` : url)}" />`)
+          .join('');
+        const deduction = toNumber(result?.deduction_amount);
+        return `
+          <tr class="${result?.has_issue ? 'issue' : ''}">
+            <td>${escapeText(checklistItem.name)}</td>
+            <td class="${result?.is_critical ? 'critical' : ''}">${escapeText(labelFor(result?.condition || null))}</td>
+            <td>
+              ${escapeText(result?.notes || '')}
+              ${photos ? `<div class="item-photos">${photos}</div>` : ''}
+            </td>
+            <td class="num">${deduction > 0 ? formatMoney(deduction, 'KES') : ''}</td>
+          </tr>`;
+      }).join('\n');
+      return `
+        <div class="section room">
+          <h2>${escapeText(category.name)}</h2>
+          <table class="table">
+            <thead><tr><th>Item</th><th>Condition</th><th>Notes &amp; photos</th><th class="num">Deduction</th></tr></thead>
+            <tbody>${rows}</tbody>
+          </table>
+        </div>`;
+    }).join('\n');
+
+    const photoFigures = inspection.photos
+      .filter(photo => isImageSource(photo.photo_url))
+      .map(photo => `
+        <figure>
+          <img src="${escapeAttr(photo.thumbnail_url || `${photo.photo_url}?tr=w-320,h-240,c-at_max`)}" />
+          <figcaption>${escapeText([photo.category, photo.caption].filter(Boolean).join(' — '))}</figcaption>
+        </figure>`)
+      .join('\n');
+
+    const signature = (label: string, value: string | null, name: string) => `
+      <div class="signature">
+        ${value
+          ? isImageSource(value) ? `<img src="${escapeAttr(value)}" />` : `<div class="signature-text">${escapeText(value)}</div>`
+          : '<div class="muted">Not signed</div>'}
+        <div class="kv-label">${escapeText(label)}${name ? ` — ${escapeText(name)}` : ''}</div>
+      </div>`;
+
+    const context = {
+      meta: {
+        documentTitle: `${typeLabel} Inspection Report`,
+        generatedAt: formatDateTime(new Date()),
+        systemName: 'LetRents',
+      },
+      company: {
+        name: company?.name || 'LetRents',
+        address: company?.address || [company?.street, company?.city, company?.region, company?.country].filter(Boolean).join(', '),
+        email: company?.email || '',
+        phone: company?.phone_number || '',
+      },
+      inspection: {
+        reference: inspection.id.slice(0, 8).toUpperCase(),
+        type: `${typeLabel} inspection`,
+        status: inspection.status.replaceAll('_', ' ').toUpperCase(),
+        score: inspection.score != null ? `${toNumber(inspection.score)}%` : '—',
+        overallCondition: inspection.overall_condition || '—',
+        totalIssues: inspection.total_issues,
+        criticalIssues: inspection.critical_issues,
+      },
+      sections: {
+        detailRows: buildKeyValueRows([
+          { label: 'Property', value: [inspection.property.name, inspection.property.street, inspection.property.city].filter(Boolean).join(', ') },
+          { label: 'Unit', value: inspection.unit.unit_number },
+          { label: 'Tenant', value: personName(inspection.tenant) || '—' },
+          { label: 'Inspector', value: personName(inspection.inspector) },
+          { label: 'Template', value: inspection.template.name },
+          { label: 'Scheduled', value: inspection.scheduled_date ? formatDate(inspection.scheduled_date) : '—' },
+          { label: 'Completed', value: inspection.completed_at ? formatDateTime(inspection.completed_at) : '—' },
+        ]),
+        rooms,
+        notes: inspection.overall_notes
+          ? `<div class="section"><h2>Inspector notes</h2><div class="panel">${escapeText(inspection.overall_notes)}</div></div>`
+          : '',
+        photos: photoFigures ? `<div class="section"><h2>Photos</h2><div class="photo-grid">${photoFigures}</div></div>` : '',
+        signatures: [
+          signature('Inspector', inspection.inspector_signature, personName(inspection.inspector)),
+          signature('Tenant', inspection.tenant_signature, personName(inspection.tenant)),
+        ].join('\n'),
+      },
+    };
+
+    const ck = this.cacheKey({ t: 'inspection', id: inspectionId, v: version, updated: inspection.updated_at.toISOString() });
+    return this.renderDocument('inspection_report', version, context, ck, { agencyId: inspection.property?.agency_id, companyId: inspection.company_id });
   }
 
   async getReportPdf(
@@ -1211,7 +1394,8 @@ export class DocumentService {
     rows: Array<Record<string, any>>,
     summary: Record<string, any>,
     user: JWTClaims,
-    version: TemplateVersion = 1
+    version: TemplateVersion = 1,
+    charts: ReportChart[] = []
   ): Promise<PdfBuffer> {
     // report access is enforced by /reports RBAC; we assume controller calls this.
     const company = user.company_id
@@ -1248,6 +1432,7 @@ export class DocumentService {
       },
       sections: {
         summaryRows: buildKeyValueRows(summaryRows),
+        charts: charts.length ? `<div class="charts">${charts.map(renderChart).join('\n')}</div>` : '',
         table: `
           <table class="table">
             <thead><tr>${header || '<th>Data</th>'}</tr></thead>
@@ -1259,8 +1444,13 @@ export class DocumentService {
       },
     };
 
-    const ck = this.cacheKey({ t: 'report', rt: reportType, v: version });
-    return this.renderDocument('report', version, context, ck);
+    // Reports are generated from live data, so the cache is keyed on the content itself
+    const digest = crypto
+      .createHash('sha256')
+      .update(JSON.stringify({ company: user.company_id, title, rows, summary, charts }))
+      .digest('hex');
+    const ck = this.cacheKey({ t: 'report', rt: reportType, v: version, d: digest });
+    return this.renderDocument('report', version, context, ck, { agencyId: user.agency_id, companyId: user.company_id });
   }
 }
 
@@ -4,7 +4,8 @@ export type DocumentType =
   | 'refund_receipt'
   | 'lease'
   | 'statement'
-  | 'report';
+  | 'report'
+  | 'inspection_report';
 
 export type TemplateVersion = number;
 
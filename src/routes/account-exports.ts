@@ -0,0 +1,13 @@
+import { Router } from 'express';
+import { auditReportAccess } from '../middleware/report-audit.js';
+import * as accountExportsController from '../controllers/account-exports.controller.js';
+
+const router = Router();
+
+// Landlords, agency admins and super admins; the service checks the role
+router.get('/', accountExportsController.listAccountExports);
+router.post('/', auditReportAccess('export', { reportType: 'account-export', format: req => req.body?.format || 'csv' }), accountExportsController.requestAccountExport);
+router.get('/:id', auditReportAccess('download_link', { reportType: 'account-export', resourceType: 'account_export', resourceParam: 'id' }), accountExportsController.getAccountExport);
+router.post('/:id/link', auditReportAccess('download_link', { reportType: 'account-export', resourceType: 'account_export', resourceParam: 'id' }), accountExportsController.issueAccountExportLink);
+
+export default router;
@@ -0,0 +1,12 @@
+import { Router } from 'express';
+import * as agencyBillingController from '../controllers/agency-billing.controller.js';
+
+const router = Router();
+
+// Landlords and agency admins see and pay their own company's platform invoices
+router.get('/', agencyBillingController.getBillingOverview);
+router.get('/invoices', agencyBillingController.listInvoices);
+router.get('/invoices/:id', agencyBillingController.getInvoice);
+router.post('/invoices/:id/pay', agencyBillingController.payInvoice);
+
+export default router;
@@ -0,0 +1,12 @@
+import { Router } from 'express';
+import * as agencyBrandingController from '../controllers/agency-branding.controller.js';
+
+const router = Router();
+
+// Agency admins and super admins; the service checks the role and the agency
+router.get('/', agencyBrandingController.getBranding);
+router.put('/', agencyBrandingController.updateBranding);
+router.post('/logo', agencyBrandingController.logoUploadMiddleware, agencyBrandingController.uploadLogo);
+router.delete('/logo', agencyBrandingController.removeLogo);
+
+export default router;
@@ -0,0 +1,16 @@
+import { Router } from 'express';
+import * as agencyOnboardingController from '../controllers/agency-onboarding.controller.js';
+
+const router = Router();
+
+// Agency admins and super admins; the service checks the role and the agency
+router.get('/status', agencyOnboardingController.getOnboardingStatus);
+router.put('/company-profile', agencyOnboardingController.saveCompanyProfile);
+router.put('/branding', agencyOnboardingController.saveBranding);
+router.put('/billing', agencyOnboardingController.saveBilling);
+router.post('/admin-invite', agencyOnboardingController.inviteAdmin);
+router.post('/property-import', agencyOnboardingController.importProperties);
+router.post('/steps/:step/skip', agencyOnboardingController.skipStep);
+router.post('/complete', agencyOnboardingController.completeOnboarding);
+
+export default router;
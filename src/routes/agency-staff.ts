@@ -0,0 +1,19 @@
+import { Router } from 'express';
+import * as agencyStaffController from '../controllers/agency-staff.controller.js';
+import { enforcePlanLimit } from '../middleware/plan-limits.js';
+
+const router = Router();
+
+// Agency admins and super admins; the service checks the role and the agency
+router.get('/', agencyStaffController.listStaff);
+router.post('/', enforcePlanLimit('users'), agencyStaffController.createStaffMember);
+router.get('/:id', agencyStaffController.getStaffMember);
+router.get('/:id/activity', agencyStaffController.getStaffActivity);
+router.put('/:id/role', agencyStaffController.changeStaffRole);
+router.put('/:id/portfolio', agencyStaffController.setStaffPortfolio);
+router.post('/:id/portfolio/:propertyId', agencyStaffController.addPortfolioProperty);
+router.delete('/:id/portfolio/:propertyId', agencyStaffController.removePortfolioProperty);
+router.post('/:id/deactivate', agencyStaffController.deactivateStaffMember);
+router.post('/:id/reactivate', agencyStaffController.reactivateStaffMember);
+
+export default router;
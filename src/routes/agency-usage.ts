@@ -0,0 +1,9 @@
+import { Router } from 'express';
+import * as agencyUsageController from '../controllers/agency-usage.controller.js';
+
+const router = Router();
+
+// Agency admins and super admins; the service checks the role and the agency
+router.get('/', agencyUsageController.getUsage);
+
+export default router;
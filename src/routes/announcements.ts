@@ -0,0 +1,22 @@
+import { Router } from 'express';
+import {
+  createAnnouncement,
+  listAnnouncements,
+  getAnnouncement,
+  acknowledgeAnnouncement,
+  getAcknowledgements,
+  withdrawAnnouncement,
+} from '../controllers/property-announcements.controller.js';
+import { rbacResource } from '../middleware/rbac.js';
+
+const router = Router();
+
+// Property notice board: staff post, tenants read and acknowledge
+router.post('/', rbacResource('communications', 'create'), createAnnouncement);
+router.get('/', rbacResource('communications', 'read'), listAnnouncements);
+router.get('/:id', rbacResource('communications', 'read'), getAnnouncement);
+router.post('/:id/acknowledge', rbacResource('communications', 'read'), acknowledgeAnnouncement);
+router.get('/:id/acknowledgements', rbacResource('communications', 'read'), getAcknowledgements);
+router.post('/:id/withdraw', rbacResource('communications', 'create'), withdrawAnnouncement);
+
+export default router;
@@ -1,6 +1,9 @@
 import { Router } from 'express';
 import { login, register, refresh, verifyEmail, requestPasswordReset, resetPassword, resendVerificationEmail, verifyInvitation, setupPassword } from '../controllers/auth.controller.js';
 import { requireAuth } from '../middleware/auth.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { realtimeAuthService } from '../services/realtime-auth.service.js';
 
 const router = Router();
 
@@ -36,11 +39,23 @@ router.get('/supabase-token', requireAuth, async (req, res) => {
 			});
 		}
 
+		// With a JWT secret configured the client also gets a token limited to its own channels,
+		// to pass to supabase.realtime.setAuth() and refresh before it expires
+		const realtime = env.realtime.jwtSecret
+			? await realtimeAuthService.issueToken((req as any).user as JWTClaims)
+			: null;
+
 		return res.json({ 
 			success: true, 
 			data: { 
 				url: supabaseUrl,
 				anonKey: supabaseAnonKey,
+				...(realtime && {
+					accessToken: realtime.token,
+					expiresAt: realtime.expires_at,
+					topics: realtime.topics,
+					privateChannels: realtime.private_channels,
+				}),
 			} 
 		});
 	} catch (error: any) {
@@ -8,7 +8,10 @@ import {
   paystackWebhook,
   getPublicSubscriptionStatus,
   verifySubscription,
-  getAvailablePaymentGateways
+  getAvailablePaymentGateways,
+  getPlanUsage,
+  getTrialStatus,
+  addPaymentMethod
 } from '../controllers/billing.controller.js';
 import { rbacResource } from '../middleware/rbac.js';
 import { optionalAuth } from '../middleware/auth.js';
@@ -21,6 +24,9 @@ const router = Router();
 router.post('/subscription', rbacResource('billing', 'create'), createSubscription);
 // Note: /subscription/verify is handled in main router as a public endpoint
 router.get('/subscription', rbacResource('billing', 'read'), getCompanySubscription);
+router.get('/usage', rbacResource('billing', 'read'), getPlanUsage);
+router.get('/trial', rbacResource('billing', 'read'), getTrialStatus);
+router.post('/payment-method', rbacResource('billing', 'update'), addPaymentMethod);
 router.post('/subscription/cancel', rbacResource('billing', 'update'), cancelSubscription);
 router.get('/gateways', rbacResource('billing', 'read'), getAvailablePaymentGateways);
 
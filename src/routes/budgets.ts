@@ -0,0 +1,12 @@
+import { Router } from 'express';
+import * as budgetsController from '../controllers/budgets.controller.js';
+import { rbacResource } from '../middleware/rbac.js';
+
+const router = Router();
+
+router.get('/', rbacResource('budgets', 'read'), budgetsController.listBudgets);
+router.get('/options', rbacResource('budgets', 'read'), budgetsController.getBudgetOptions);
+router.put('/properties/:propertyId', rbacResource('budgets', 'update'), budgetsController.setPropertyBudget);
+router.delete('/:id', rbacResource('budgets', 'delete'), budgetsController.deleteBudgetLine);
+
+export default router;
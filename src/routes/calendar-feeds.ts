@@ -0,0 +1,13 @@
+import { Router } from 'express';
+import { exportInspectionFeed } from '../controllers/inspection-scheduling.controller.js';
+import { rateLimitVerification } from '../middleware/rate-limit.js';
+
+const router = Router();
+
+// Limits: 60 requests per 15 minutes per IP (calendar apps poll hourly)
+router.use(rateLimitVerification(15 * 60 * 1000, 60));
+
+// Public iCal subscriptions (no authentication; the feed token identifies the user)
+router.get('/:token/inspections.ics', exportInspectionFeed);
+
+export default router;
@@ -1,6 +1,7 @@
 import { Router } from 'express';
 import { requireAuth } from '../middleware/auth.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { enforcePlanLimit } from '../middleware/plan-limits.js';
 import { careteakersController } from '../controllers/caretakers.controller.js';
 import { requireCompanyContext } from '../middleware/companyContext.js';
 
@@ -9,10 +10,40 @@ const router = Router();
 // Apply authentication to all caretaker routes
 router.use(requireAuth);
 
+// Auto-assignment engine (must come before /:id)
+router.get('/assignment-suggestions', rbacResource('caretakers', 'read'), careteakersController.getAssignmentSuggestions);
+router.get('/auto-assignment/settings', rbacResource('caretakers', 'read'), careteakersController.getAutoAssignmentSettings);
+router.put('/auto-assignment/settings', rbacResource('caretakers', 'update'), careteakersController.updateAutoAssignmentSettings);
+
+// Performance leaderboard (must come before /:id)
+router.get('/performance', rbacResource('caretakers', 'read'), careteakersController.getPerformanceLeaderboard);
+
+// Daily route across properties; caretakers get their own, managers may pass staff_id (must come before /:id)
+router.get('/route', careteakersController.getRoute);
+
+// Payroll (must come before /:id)
+router.get('/payroll', rbacResource('caretakers', 'read'), careteakersController.getPayroll);
+router.get('/payroll/settings', rbacResource('caretakers', 'read'), careteakersController.getPayrollSettings);
+router.put('/payroll/settings', rbacResource('caretakers', 'update'), careteakersController.updatePayrollSettings);
+
+// Shifts, rosters and leave (must come before /:id)
+router.get('/availability', rbacResource('caretakers', 'read'), careteakersController.getAvailability);
+router.get('/shifts', rbacResource('caretakers', 'read'), careteakersController.getShifts);
+router.post('/shifts', rbacResource('caretakers', 'update'), careteakersController.createShift);
+router.put('/shifts/:shiftId', rbacResource('caretakers', 'update'), careteakersController.updateShift);
+router.delete('/shifts/:shiftId', rbacResource('caretakers', 'update'), careteakersController.deleteShift);
+// Staff without caretaker management rights only see their own roster and leave
+router.get('/roster', careteakersController.getRoster);
+router.put('/roster', rbacResource('caretakers', 'update'), careteakersController.saveRoster);
+router.get('/leave', careteakersController.getLeave);
+router.post('/leave', careteakersController.requestLeave);
+router.post('/leave/:leaveId/decision', rbacResource('caretakers', 'update'), careteakersController.decideLeave);
+router.post('/leave/:leaveId/cancel', careteakersController.cancelLeave);
+
 // CRUD operations
 router.get('/', rbacResource('caretakers', 'read'), careteakersController.getCaretakers);
 // Require company context for creating staff members
-router.post('/', requireCompanyContext, rbacResource('caretakers', 'create'), careteakersController.createCaretaker);
+router.post('/', requireCompanyContext, rbacResource('caretakers', 'create'), enforcePlanLimit('users'), careteakersController.createCaretaker);
 router.get('/:id', rbacResource('caretakers', 'read'), careteakersController.getCaretaker);
 router.put('/:id', rbacResource('caretakers', 'update'), careteakersController.updateCaretaker);
 router.delete('/:id', rbacResource('caretakers', 'delete'), careteakersController.deleteCaretaker);
@@ -20,5 +51,9 @@ router.delete('/:id', rbacResource('caretakers', 'delete'), careteakersControlle
 // Additional actions
 router.post('/:id/invite', rbacResource('caretakers', 'update'), careteakersController.inviteCaretaker);
 router.post('/:id/reset-password', rbacResource('caretakers', 'update'), careteakersController.resetPassword);
+router.get('/:id/performance', careteakersController.getPerformance);
+router.get('/:id/payslip', careteakersController.getPayslip);
+router.get('/:id/route', careteakersController.getRoute);
+router.put('/:id/off-days', rbacResource('caretakers', 'update'), careteakersController.updateOffDays);
 
 export default router;
@@ -4,6 +4,13 @@
 
 import { Router } from 'express';
 import { ChecklistsController } from '../controllers/checklists.controller.js';
+import {
+  scheduleInspection,
+  getInspectionSchedule,
+  checkInspectionConflicts,
+  getCalendarFeedUrl,
+  rotateCalendarFeedUrl,
+} from '../controllers/inspection-scheduling.controller.js';
 import { requireAuth } from '../middleware/auth.js';
 import { rbacResource } from '../middleware/rbac.js';
 
@@ -45,6 +52,13 @@ router.put(
   checklistsController.updateTemplate
 );
 
+// Duplicate a template
+router.post(
+  '/templates/:id/duplicate',
+  rbacResource('checklists', 'create'),
+  checklistsController.duplicateTemplate
+);
+
 // Delete a template
 router.delete(
   '/templates/:id',
@@ -70,6 +84,45 @@ router.get(
   checklistsController.getInspections
 );
 
+// Inspection calendar and conflict checks (must come before /inspections/:id)
+router.get(
+  '/inspections/schedule',
+  rbacResource('checklists', 'read'),
+  getInspectionSchedule
+);
+
+router.get(
+  '/inspections/schedule/conflicts',
+  rbacResource('checklists', 'read'),
+  checkInspectionConflicts
+);
+
+// Diff two condition reports for the same unit (must come before /inspections/:id)
+router.get(
+  '/inspections/compare',
+  rbacResource('checklists', 'read'),
+  checklistsController.compareInspections
+);
+
+router.get(
+  '/units/:unitId/condition-diff',
+  rbacResource('checklists', 'read'),
+  checklistsController.compareUnitMoveInOut
+);
+
+// Personal iCal feed URL for calendar apps
+router.get(
+  '/calendar-feed',
+  rbacResource('checklists', 'read'),
+  getCalendarFeedUrl
+);
+
+router.post(
+  '/calendar-feed/reset',
+  rbacResource('checklists', 'read'),
+  rotateCalendarFeedUrl
+);
+
 // Get a single inspection by ID
 router.get(
   '/inspections/:id',
@@ -84,6 +137,13 @@ router.put(
   checklistsController.updateInspection
 );
 
+// Assign an inspector and time slot
+router.put(
+  '/inspections/:id/schedule',
+  rbacResource('checklists', 'update'),
+  scheduleInspection
+);
+
 // Delete an inspection
 router.delete(
   '/inspections/:id',
@@ -105,5 +165,58 @@ router.post(
   checklistsController.uploadInspectionPhoto
 );
 
+// Immutable versions of the condition report
+router.get(
+  '/inspections/:id/versions',
+  rbacResource('checklists', 'read'),
+  checklistsController.getInspectionVersions
+);
+
+router.get(
+  '/inspections/:id/versions/:version',
+  rbacResource('checklists', 'read'),
+  checklistsController.getInspectionVersion
+);
+
+// First versions for inspections completed before versioning
+router.post(
+  '/inspections/versions/backfill',
+  rbacResource('checklists', 'update'),
+  checklistsController.backfillInspectionVersions
+);
+
+// Download the PDF report of a completed inspection
+router.get(
+  '/inspections/:id/report',
+  rbacResource('checklists', 'read'),
+  checklistsController.downloadInspectionReport
+);
+
+// Regenerate the stored PDF report
+router.post(
+  '/inspections/:id/report',
+  rbacResource('checklists', 'update'),
+  checklistsController.generateInspectionReport
+);
+
+// Expiring report links
+router.get(
+  '/inspections/:id/report/shares',
+  rbacResource('checklists', 'read'),
+  checklistsController.getInspectionReportShares
+);
+
+router.post(
+  '/inspections/:id/report/shares',
+  rbacResource('checklists', 'update'),
+  checklistsController.shareInspectionReport
+);
+
+router.delete(
+  '/inspections/:id/report/shares/:shareId',
+  rbacResource('checklists', 'update'),
+  checklistsController.revokeInspectionReportShare
+);
+
 export default router;
 
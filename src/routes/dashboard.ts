@@ -1,27 +1,57 @@
 import { Router } from 'express';
 import { 
   getDashboardStats,
+  getDashboardOverview,
+  getDashboardWidgets,
+  updateDashboardWidgets,
+  getDashboardChart,
   getOnboardingStatus
 } from '../controllers/dashboard.controller.js';
+import {
+  getAlertFeed,
+  acknowledgeAlert,
+  getAlertRuleOptions,
+  listAlertRules,
+  createAlertRule,
+  updateAlertRule,
+  deleteAlertRule
+} from '../controllers/kpi-alerts.controller.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { cacheAnalytics } from '../middleware/analytics-cache.js';
 
 const router = Router();
 
 // Super Admin Dashboard (system-wide)
-router.get('/', async (req, res) => {
+router.get('/', cacheAnalytics(60), async (req, res) => {
   const user = (req as any).user;
   
   if (user?.role === 'super_admin') {
     const { getDashboardData } = await import('../controllers/super-admin.controller.js');
     await getDashboardData(req, res);
   } else {
-    // Regular dashboard stats for other roles
-    await getDashboardStats(req, res);
+    // Other roles get the widgets they chose
+    await getDashboardOverview(req, res);
   }
 });
 
 // Dashboard stats
-router.get('/stats', rbacResource('dashboard', 'read'), getDashboardStats);
+router.get('/stats', rbacResource('dashboard', 'read'), cacheAnalytics(60), getDashboardStats);
+
+// Widget layout preferences (per user)
+router.get('/widgets', rbacResource('dashboard', 'read'), getDashboardWidgets);
+router.put('/widgets', rbacResource('dashboard', 'read'), updateDashboardWidgets);
+
+// Chart series: ?period=last_7d|last_30d|last_90d|last_12m|mtd|ytd or custom with from/to, optional interval=day|week|month
+router.get('/charts/:chartType', rbacResource('dashboard', 'read'), cacheAnalytics(300), getDashboardChart);
+
+// KPI threshold alerts: the feed, and the rules that raise them
+router.get('/alerts', rbacResource('dashboard', 'read'), getAlertFeed);
+router.post('/alerts/:id/acknowledge', rbacResource('dashboard', 'read'), acknowledgeAlert);
+router.get('/alert-rules/options', rbacResource('dashboard', 'read'), getAlertRuleOptions);
+router.get('/alert-rules', rbacResource('dashboard', 'read'), listAlertRules);
+router.post('/alert-rules', rbacResource('dashboard', 'read'), createAlertRule);
+router.put('/alert-rules/:id', rbacResource('dashboard', 'read'), updateAlertRule);
+router.delete('/alert-rules/:id', rbacResource('dashboard', 'read'), deleteAlertRule);
 
 // Onboarding status
 router.get('/onboarding/status', rbacResource('dashboard', 'read'), getOnboardingStatus);
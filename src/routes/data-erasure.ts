@@ -0,0 +1,13 @@
+import { Router } from 'express';
+import * as dataErasureController from '../controllers/data-erasure.controller.js';
+
+const router = Router();
+
+// Landlords and agency admins request for their former tenants; super admins review
+router.get('/', dataErasureController.listRequests);
+router.post('/', dataErasureController.createRequest);
+router.get('/:id', dataErasureController.getRequest);
+router.post('/:id/cancel', dataErasureController.cancelRequest);
+router.post('/:id/review', dataErasureController.reviewRequest);
+
+export default router;
@@ -0,0 +1,15 @@
+import express, { Router } from 'express';
+import { unsubscribeDigest } from '../controllers/digest.controller.js';
+import { rateLimitVerification } from '../middleware/rate-limit.js';
+
+const router = Router();
+
+// Limits: 30 requests per 15 minutes per IP
+router.use(rateLimitVerification(15 * 60 * 1000, 30));
+
+// Public unsubscribe links from digest emails (no authentication; the token identifies the user)
+router.get('/unsubscribe/:token', unsubscribeDigest); // Confirmation page only
+// Confirmation form and RFC 8058 one-click unsubscribe, both form-encoded
+router.post('/unsubscribe/:token', express.urlencoded({ extended: false }), unsubscribeDigest);
+
+export default router;
@@ -1,6 +1,7 @@
 import { Router } from 'express';
 import { requireAuth } from '../middleware/auth.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { auditReportAccess } from '../middleware/report-audit.js';
 import { pdfDocumentsController } from '../controllers/pdf-documents.controller.js';
 
 const router = Router();
@@ -15,8 +16,14 @@ router.get('/leases/:leaseId.pdf', rbacResource('documents', 'read'), pdfDocumen
 router.get('/statements/tenants/:tenantId.pdf', rbacResource('documents', 'read'), pdfDocumentsController.tenantStatementPdf);
 
 // Report exports (PDF)
-router.get('/reports/:type.pdf', rbacResource('documents', 'read'), pdfDocumentsController.reportPdf);
-router.post('/reports/render.pdf', rbacResource('documents', 'read'), pdfDocumentsController.renderReportPdf);
+router.get('/reports/:type.pdf', rbacResource('documents', 'read'), auditReportAccess('export', { reportType: req => req.params.type as string, format: 'pdf' }), pdfDocumentsController.reportPdf);
+router.post('/reports/render.pdf', rbacResource('documents', 'read'), auditReportAccess('export', { reportType: req => req.body?.reportType || 'custom', format: 'pdf' }), pdfDocumentsController.renderReportPdf);
+
+// Background exports: queue a report or invoice PDF, then fetch it from the export's signed download_url
+router.post('/exports', rbacResource('documents', 'read'), auditReportAccess('export', { reportType: req => req.body?.report_type || req.body?.document_type || 'report', format: 'pdf' }), pdfDocumentsController.requestExport);
+router.get('/exports', rbacResource('documents', 'read'), pdfDocumentsController.listExports);
+router.get('/exports/:exportId', rbacResource('documents', 'read'), auditReportAccess('download_link', { reportType: 'document-export', resourceType: 'document_export', resourceParam: 'exportId' }), pdfDocumentsController.getExport);
+router.post('/exports/:exportId/link', rbacResource('documents', 'read'), auditReportAccess('download_link', { reportType: 'document-export', resourceType: 'document_export', resourceParam: 'exportId' }), pdfDocumentsController.issueExportLink);
 
 export default router;
 
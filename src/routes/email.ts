@@ -16,4 +16,13 @@ router.post('/send', emailController.sendCustomEmail);
 // Get email provider status
 router.get('/status', emailController.getEmailStatus);
 
+// Email templates: list, preview and test-send
+router.get('/templates', emailController.listTemplates);
+router.post('/templates/:key/preview', emailController.previewTemplate);
+router.post('/templates/:key/test', emailController.testSendTemplate);
+
+// Per-company email branding
+router.get('/branding', emailController.getBranding);
+router.put('/branding', emailController.updateBranding);
+
 export default router;
@@ -0,0 +1,26 @@
+import { Router } from 'express';
+import {
+  reportEmergency,
+  listEmergencies,
+  getEmergency,
+  acknowledgeEmergency,
+  resolveEmergency,
+  getEmergencySettings,
+  updateEmergencySettings,
+} from '../controllers/emergency.controller.js';
+import { rbacResource } from '../middleware/rbac.js';
+
+const router = Router();
+
+// Escalation settings (must come before /:id)
+router.get('/settings', rbacResource('emergency', 'read'), getEmergencySettings);
+router.put('/settings', rbacResource('emergency', 'update'), updateEmergencySettings);
+
+// Emergency reports
+router.post('/', rbacResource('emergency', 'create'), reportEmergency);
+router.get('/', rbacResource('emergency', 'read'), listEmergencies);
+router.get('/:id', rbacResource('emergency', 'read'), getEmergency);
+router.post('/:id/acknowledge', rbacResource('emergency', 'update'), acknowledgeEmergency);
+router.post('/:id/resolve', rbacResource('emergency', 'update'), resolveEmergency);
+
+export default router;
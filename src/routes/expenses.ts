@@ -0,0 +1,15 @@
+import { Router } from 'express';
+import * as expensesController from '../controllers/expenses.controller.js';
+import { rbacResource } from '../middleware/rbac.js';
+
+const router = Router();
+
+router.get('/', rbacResource('expenses', 'read'), expensesController.listExpenses);
+router.get('/options', rbacResource('expenses', 'read'), expensesController.getExpenseOptions);
+router.get('/:id', rbacResource('expenses', 'read'), expensesController.getExpense);
+router.post('/', rbacResource('expenses', 'create'), expensesController.receiptUploadMiddleware, expensesController.createExpense);
+router.put('/:id', rbacResource('expenses', 'update'), expensesController.updateExpense);
+router.delete('/:id', rbacResource('expenses', 'delete'), expensesController.deleteExpense);
+router.post('/:id/receipt', rbacResource('expenses', 'update'), expensesController.receiptUploadMiddleware, expensesController.uploadExpenseReceipt);
+
+export default router;
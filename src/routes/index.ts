@@ -27,6 +27,7 @@ import documents from './documents.js';
 import superAdmin from './super-admin.js';
 import enums from './enums.js';
 import email from './email.js';
+import sms from './sms.js';
 import setup from './setup.js';
 import testEmail from './test-email.js';
 import checklists from './checklists.js';
@@ -34,11 +35,32 @@ import cleanup from './cleanup.js';
 import tasks from './task.routes.js';
 import webhooks from './webhooks.js';
 import emergencyContacts from './emergency-contacts.js';
+import emergencies from './emergencies.js';
+import announcements from './announcements.js';
+import inventory from './inventory.js';
 import vendors from './vendors.js';
+import expenses from './expenses.js';
+import budgets from './budgets.js';
+import accountExports from './account-exports.js';
 import marketing from './marketing.js';
 import verification from './verification.js';
+import unitApplications from './unit-applications.js';
+import vendorPortal from './vendor-portal.js';
+import inspectionReports from './inspection-reports.js';
+import calendarFeeds from './calendar-feeds.js';
+import digest from './digest.js';
+import agencyOnboarding from './agency-onboarding.js';
+import agencyStaff from './agency-staff.js';
+import agencyBranding from './agency-branding.js';
+import agencyBilling from './agency-billing.js';
+import agencyUsage from './agency-usage.js';
+import dataErasure from './data-erasure.js';
+import platformAnnouncements from './platform-announcements.js';
+import propertyDelegations from './property-delegations.js';
 import { requireAuth } from '../middleware/auth.js';
+import { blockWritesWhenExpired } from '../middleware/subscriptionValidation.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { cacheAnalytics } from '../middleware/analytics-cache.js';
 
 const router = Router();
 
@@ -58,6 +80,18 @@ router.use('/webhooks', webhooks);
 // Public verification endpoints (NO AUTH - token-validated)
 router.use('/verify', verification);
 
+// Vendor work-order links (NO AUTH - token-validated)
+router.use('/vendor-portal', vendorPortal);
+
+// Shared inspection report links (NO AUTH - token-validated, expiring)
+router.use('/inspection-reports', inspectionReports);
+
+// Personal iCal subscription feeds (NO AUTH - token-validated)
+router.use('/calendar-feeds', calendarFeeds);
+
+// Digest email unsubscribe links (NO AUTH - token-validated)
+router.use('/digest', digest);
+
 router.use('/auth', auth);
 
 // Invitations endpoints (public - for invitation verification and setup)
@@ -71,21 +105,21 @@ router.post('/invitations/setup-password', async (req, res) => {
 	return setupPassword(req, res);
 });
 
-router.use('/properties', requireAuth, properties);
-router.use('/units', requireAuth, units);
-router.use('/tenants', requireAuth, tenants);
+router.use('/properties', requireAuth, blockWritesWhenExpired, properties);
+router.use('/units', requireAuth, blockWritesWhenExpired, units);
+router.use('/tenants', requireAuth, blockWritesWhenExpired, tenants);
 router.use('/tenant-portal', requireAuth, tenantPortal);
-router.use('/maintenance', requireAuth, maintenance);
-router.use('/invoices', requireAuth, invoices);
+router.use('/maintenance', requireAuth, blockWritesWhenExpired, maintenance);
+router.use('/invoices', requireAuth, blockWritesWhenExpired, invoices);
 router.use('/dashboard', requireAuth, dashboard);
-router.use('/users', requireAuth, users);
+router.use('/users', requireAuth, blockWritesWhenExpired, users);
 router.use('/rbac', requireAuth, rbac);
-router.use('/staff', requireAuth, staff); // Primary staff endpoint (all roles)
-router.use('/caretakers', requireAuth, caretakers); // Legacy alias for backward compatibility
-  router.use('/property-caretakers', requireAuth, propertyCaretakers);
+router.use('/staff', requireAuth, blockWritesWhenExpired, staff); // Primary staff endpoint (all roles)
+router.use('/caretakers', requireAuth, blockWritesWhenExpired, caretakers); // Legacy alias for backward compatibility
+  router.use('/property-caretakers', requireAuth, blockWritesWhenExpired, propertyCaretakers);
   router.use('/properties', requireAuth, propertyFinancials);
   router.use('/properties', requireAuth, propertyStaff);
-router.use('/leases', requireAuth, leases);
+router.use('/leases', requireAuth, blockWritesWhenExpired, leases);
 
 // Notification templates routes (must be before /notifications router)
 router.get('/notifications/templates', requireAuth, requireSuperAdmin, async (req, res) => {
@@ -110,7 +144,13 @@ router.use('/reports', requireAuth, reports);
 router.use('/payments', requireAuth, payments);
 router.use('/payment', requireAuth, payment); // legacy alias for subaccount endpoints
 router.use('/mpesa', requireAuth, mpesa); // M-Pesa management needs auth
-router.use('/documents', requireAuth, documents);
+router.use('/documents', requireAuth, blockWritesWhenExpired, documents);
+
+// Public system settings (site name, feature flags) for the login and registration pages
+router.get('/settings/public', async (req, res) => {
+  const { getPublicSystemSettings } = await import('../controllers/super-admin.controller.js');
+  return getPublicSystemSettings(req, res);
+});
 
 // Public billing endpoints (no authentication required) - must come before authenticated routes
 router.get('/billing/plans', async (req, res) => {
@@ -137,7 +177,8 @@ router.get('/billing/subscription/status/:companyId', async (req, res) => {
 
 router.use('/billing', requireAuth, billing); // Billing management needs auth
 router.use('/email', email); // Email endpoints (auth handled within routes)
-router.use('/tasks', requireAuth, tasks); // Task management (auth required)
+router.use('/sms', requireAuth, sms);
+router.use('/tasks', requireAuth, blockWritesWhenExpired, tasks); // Task management (auth required)
 
 // M-Pesa C2B callbacks (no authentication required)
 router.post('/mpesa/c2b/validation', async (req, res) => {
@@ -152,14 +193,29 @@ router.post('/mpesa/c2b/confirmation', async (req, res) => {
 router.use('/enums', enums);
 router.use('/setup', setup);
 router.use('/test-email', testEmail);
-router.use('/checklists', requireAuth, checklists);
+router.use('/checklists', requireAuth, blockWritesWhenExpired, checklists);
 router.use('/cleanup', requireAuth, cleanup);
-router.use('/emergency-contacts', requireAuth, emergencyContacts);
-router.use('/vendors', requireAuth, vendors);
+router.use('/emergency-contacts', requireAuth, blockWritesWhenExpired, emergencyContacts);
+router.use('/emergencies', requireAuth, emergencies);
+router.use('/announcements', requireAuth, blockWritesWhenExpired, announcements); // Property notice board
+router.use('/inventory', requireAuth, blockWritesWhenExpired, inventory);
+router.use('/vendors', requireAuth, blockWritesWhenExpired, vendors);
+router.use('/expenses', requireAuth, blockWritesWhenExpired, expenses);
+router.use('/budgets', requireAuth, blockWritesWhenExpired, budgets);
+router.use('/account-exports', requireAuth, accountExports); // Full data export (ZIP) for backup or migration
+router.use('/agency-onboarding', requireAuth, agencyOnboarding); // Guided setup of a new agency, resumable
+router.use('/agency/staff', requireAuth, blockWritesWhenExpired, agencyStaff); // Agency admins manage agents, roles and portfolios
+router.use('/agency/branding', requireAuth, blockWritesWhenExpired, agencyBranding); // Logo, colours and sender names on PDFs, emails and listings
+router.use('/agency/billing', requireAuth, agencyBilling); // Platform subscription invoices; open even when read-only so they can be paid
+router.use('/agency/usage', requireAuth, agencyUsage); // API calls, SMS, documents and storage against the plan allowance
+router.use('/data-erasure', requireAuth, dataErasure); // Anonymize or erase a former tenant's personal data after super admin review
+router.use('/platform-announcements', requireAuth, platformAnnouncements); // Release notes, maintenance windows and policy updates from the platform
+router.use('/property-delegations', requireAuth, blockWritesWhenExpired, propertyDelegations); // Landlords hand properties to agencies
 router.use('/marketing', marketing); // Marketing routes (some public, some protected)
+router.use('/unit-applications', unitApplications); // Unit applications & waiting lists (some public, some protected)
 
 // Super Admin specific endpoints that frontend calls directly
-router.get('/kpis', requireAuth, requireSuperAdmin, async (req, res) => {
+router.get('/kpis', requireAuth, requireSuperAdmin, cacheAnalytics(60), async (req, res) => {
 	const { getKPIMetrics } = await import('../controllers/super-admin.controller.js');
 	await getKPIMetrics(req, res);
 });
@@ -174,85 +230,35 @@ router.get('/audit-logs', requireAuth, requireSuperAdmin, async (req, res) => {
 	await getAuditLogs(req, res);
 });
 
-router.get('/analytics/:chartType', requireAuth, requireSuperAdmin, async (req, res) => {
+router.get('/analytics/history', requireAuth, requireSuperAdmin, cacheAnalytics(300), async (req, res) => {
+	const { getAnalyticsHistory } = await import('../controllers/super-admin.controller.js');
+	await getAnalyticsHistory(req, res);
+});
+
+router.get('/analytics/:chartType', requireAuth, requireSuperAdmin, cacheAnalytics(300), async (req, res) => {
 	const { getAnalyticsChart } = await import('../controllers/super-admin.controller.js');
 	await getAnalyticsChart(req, res);
 });
 
 // Additional super-admin endpoints
-router.get('/platform-analytics', requireAuth, requireSuperAdmin, async (req, res) => {
+router.get('/platform-analytics', requireAuth, requireSuperAdmin, cacheAnalytics(300), async (req, res) => {
 	const { getPlatformAnalytics } = await import('../controllers/super-admin.controller.js');
 	await getPlatformAnalytics(req, res);
 });
 
-router.get('/revenue/dashboard', requireAuth, requireSuperAdmin, async (req, res) => {
+router.get('/revenue/dashboard', requireAuth, requireSuperAdmin, cacheAnalytics(300), async (req, res) => {
 	const { getRevenueDashboard } = await import('../controllers/super-admin.controller.js');
 	await getRevenueDashboard(req, res);
 });
 
 // Removed duplicate /agencies routes - they're now in /super-admin/agencies
 
-// Add proper users/metrics endpoint
-router.get('/users/metrics', requireAuth, requireSuperAdmin, (req, res) => {
-	try {
-		console.log('Users/metrics endpoint hit by user:', (req as any).user);
-		const role = req.query.role as string;
-	
-		let metrics;
-	
-		if (role === 'landlord') {
-			metrics = {
-				total_users: 1,
-				active_users: 1,
-				inactive_users: 0,
-				users_by_role: [
-					{ role: 'landlord', count: 1 }
-				],
-				growth_rate: 0
-			};
-		} else if (role === 'tenant') {
-			metrics = {
-				total_users: 3,
-				active_users: 3,
-				inactive_users: 0,
-				users_by_role: [
-					{ role: 'tenant', count: 3 }
-				],
-				growth_rate: 15.2
-			};
-		} else {
-			// All users
-			metrics = {
-				total_users: 6,
-				active_users: 6,
-				inactive_users: 0,
-				users_by_role: [
-					{ role: 'super_admin', count: 1 },
-					{ role: 'landlord', count: 1 },
-					{ role: 'tenant', count: 3 },
-					{ role: 'caretaker', count: 1 },
-					{ role: 'agent', count: 1 }
-				],
-				growth_rate: 8.5
-			};
-		}
-
-		res.status(200).json({ 
-			success: true, 
-			message: 'User metrics retrieved successfully', 
-			data: metrics 
-		});
-	} catch (error) {
-		console.error('Error in users/metrics endpoint:', error);
-		res.status(500).json({ 
-			success: false, 
-			message: 'Internal server error', 
-			error: error instanceof Error ? error.message : String(error) 
-		});
-	}
+router.get('/users/metrics', requireAuth, requireSuperAdmin, cacheAnalytics(60), async (req, res) => {
+	const { getUserMetrics } = await import('../controllers/super-admin.controller.js');
+	await getUserMetrics(req, res);
 });
 
-router.get('/revenue/summary', requireAuth, requireSuperAdmin, async (req, res) => {
+router.get('/revenue/summary', requireAuth, requireSuperAdmin, cacheAnalytics(300), async (req, res) => {
 	const { getRevenueSummary } = await import('../controllers/super-admin.controller.js');
 	await getRevenueSummary(req, res);
 });
@@ -267,11 +273,26 @@ router.get('/billing/subscriptions', requireAuth, requireSuperAdmin, async (req,
 	await getBillingSubscriptions(req, res);
 });
 
+router.get('/billing/analytics', requireAuth, requireSuperAdmin, cacheAnalytics(300), async (req, res) => {
+	const { getSubscriptionAnalytics } = await import('../controllers/super-admin.controller.js');
+	await getSubscriptionAnalytics(req, res);
+});
+
 router.get('/billing/invoices', requireAuth, requireSuperAdmin, async (req, res) => {
 	const { getBillingInvoices } = await import('../controllers/super-admin.controller.js');
 	await getBillingInvoices(req, res);
 });
 
+router.post('/billing/invoices/:id/retry', requireAuth, requireSuperAdmin, async (req, res) => {
+	const { retryBillingInvoice } = await import('../controllers/super-admin.controller.js');
+	await retryBillingInvoice(req, res);
+});
+
+router.post('/billing/run', requireAuth, requireSuperAdmin, async (req, res) => {
+	const { runSubscriptionBilling } = await import('../controllers/super-admin.controller.js');
+	await runSubscriptionBilling(req, res);
+});
+
 router.get('/applications', requireAuth, requireSuperAdmin, async (req, res) => {
 	const { getApplications } = await import('../controllers/super-admin.controller.js');
 	await getApplications(req, res);
@@ -317,6 +338,16 @@ router.post('/messaging/broadcasts/:id/schedule', requireAuth, requireSuperAdmin
 	await scheduleBroadcastMessage(req, res);
 });
 
+router.delete('/messaging/broadcasts/:id/schedule', requireAuth, requireSuperAdmin, async (req, res) => {
+	const { unscheduleBroadcastMessage } = await import('../controllers/super-admin.controller.js');
+	await unscheduleBroadcastMessage(req, res);
+});
+
+router.get('/messaging/broadcasts/:id/stats', requireAuth, requireSuperAdmin, async (req, res) => {
+	const { getBroadcastStats } = await import('../controllers/super-admin.controller.js');
+	await getBroadcastStats(req, res);
+});
+
 // Debug logging for super-admin routes
 router.use('/super-admin', (req, res, next) => {
 	console.log(`📍 Main router /super-admin: ${req.method} ${req.path}`);
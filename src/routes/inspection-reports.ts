@@ -0,0 +1,14 @@
+import { Router } from 'express';
+import { ChecklistsController } from '../controllers/checklists.controller.js';
+import { rateLimitVerification } from '../middleware/rate-limit.js';
+
+const router = Router();
+const checklistsController = new ChecklistsController();
+
+// Limits: 30 requests per 15 minutes per IP
+router.use(rateLimitVerification(15 * 60 * 1000, 30));
+
+// Public report download (no authentication; the expiring share token identifies the report)
+router.get('/:token', checklistsController.getSharedInspectionReport);
+
+export default router;
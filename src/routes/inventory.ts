@@ -0,0 +1,24 @@
+import { Router } from 'express';
+import {
+  listInventoryItems,
+  getInventoryItem,
+  createInventoryItem,
+  updateInventoryItem,
+  deleteInventoryItem,
+  restockInventoryItem,
+  adjustInventoryItem,
+} from '../controllers/inventory.controller.js';
+import { rbacResource } from '../middleware/rbac.js';
+
+const router = Router();
+
+// Spare parts and consumables; stock is drawn for work orders under /maintenance/requests/:id/materials
+router.get('/', rbacResource('maintenance', 'read'), listInventoryItems);
+router.post('/', rbacResource('maintenance', 'update'), createInventoryItem);
+router.get('/:id', rbacResource('maintenance', 'read'), getInventoryItem);
+router.put('/:id', rbacResource('maintenance', 'update'), updateInventoryItem);
+router.delete('/:id', rbacResource('maintenance', 'update'), deleteInventoryItem);
+router.post('/:id/restock', rbacResource('maintenance', 'update'), restockInventoryItem);
+router.post('/:id/adjust', rbacResource('maintenance', 'update'), adjustInventoryItem);
+
+export default router;
@@ -1,10 +1,12 @@
 import { Router } from 'express';
 import { LeasesController } from '../controllers/leases.controller.js';
+import { DepositSettlementController } from '../controllers/deposit-settlement.controller.js';
 import { requireAuth } from '../middleware/auth.js';
 import { rbacResource } from '../middleware/rbac.js';
 
 const router = Router();
 const leasesController = new LeasesController();
+const depositSettlementController = new DepositSettlementController();
 
 // Apply authentication to all routes
 router.use(requireAuth);
@@ -41,6 +43,32 @@ router.post('/:id/renew',
   leasesController.renewLease
 );
 
+// Deposit settlement at move-out
+router.get('/:id/settlement', 
+  rbacResource('leases', 'read'), 
+  depositSettlementController.getSettlement
+);
+
+router.get('/:id/settlement/statement', 
+  rbacResource('leases', 'read'), 
+  depositSettlementController.getStatement
+);
+
+router.post('/:id/settlement/calculate', 
+  rbacResource('leases', 'update'), 
+  depositSettlementController.calculateSettlement
+);
+
+router.post('/:id/settlement/approve', 
+  rbacResource('leases', 'update'), 
+  depositSettlementController.approveSettlement
+);
+
+router.post('/:id/settlement/refund', 
+  rbacResource('leases', 'update'), 
+  depositSettlementController.recordRefund
+);
+
 // Utility endpoints
 router.get('/unit/:unit_id/history', 
   rbacResource('leases', 'read'), 
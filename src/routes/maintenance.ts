@@ -5,20 +5,96 @@ import {
   listMaintenanceRequests, 
   updateMaintenanceRequest, 
   deleteMaintenanceRequest,
-  getMaintenanceOverview
+  assignMaintenanceRequest,
+  autoAssignMaintenanceRequest,
+  getMaintenanceComments,
+  getMaintenanceTimeline,
+  addMaintenanceComment,
+  rateMaintenanceVendor,
+  addMaintenanceAttachments,
+  removeMaintenanceAttachment,
+  attachmentUploadMiddleware,
+  getMaintenanceOverview,
+  getMaintenanceSlaPolicy,
+  updateMaintenanceSlaPolicy,
+  getMaintenanceSlaReport,
+  getMaintenanceCostSettings,
+  updateMaintenanceCostSettings,
+  listPendingCostApprovals,
+  requestMaintenanceCostApproval,
+  decideMaintenanceCost,
+  addMaintenanceReceipt,
+  removeMaintenanceReceipt,
+  listMaintenanceBudgets,
+  upsertMaintenanceBudget,
+  getMaintenanceBudgetBurnDown
 } from '../controllers/maintenance.controller.js';
+import {
+  listPreventiveSchedules,
+  createPreventiveSchedule,
+  updatePreventiveSchedule,
+  deletePreventiveSchedule,
+  getPreventiveScheduleHistory,
+  runPreventiveSchedule
+} from '../controllers/preventive-maintenance.controller.js';
+import {
+  getMaintenanceMaterials,
+  consumeMaintenanceMaterials,
+  returnMaintenanceMaterial
+} from '../controllers/inventory.controller.js';
 import { rbacResource } from '../middleware/rbac.js';
 
 const router = Router();
 
 // Maintenance requests CRUD
-router.post('/requests', rbacResource('maintenance', 'create'), createMaintenanceRequest);
+router.post('/requests', rbacResource('maintenance', 'create'), attachmentUploadMiddleware, createMaintenanceRequest);
 router.get('/requests', rbacResource('maintenance', 'read'), listMaintenanceRequests);
 router.get('/requests/:id', rbacResource('maintenance', 'read'), getMaintenanceRequest);
 router.put('/requests/:id', rbacResource('maintenance', 'update'), updateMaintenanceRequest);
 router.delete('/requests/:id', rbacResource('maintenance', 'delete'), deleteMaintenanceRequest);
 
+// Assignment and comments
+router.post('/requests/:id/assign', rbacResource('maintenance', 'update'), assignMaintenanceRequest);
+// Let the caretaker assignment engine pick the next best caretaker
+router.post('/requests/:id/auto-assign', rbacResource('maintenance', 'update'), autoAssignMaintenanceRequest);
+router.get('/requests/:id/comments', rbacResource('maintenance', 'read'), getMaintenanceComments);
+router.get('/requests/:id/timeline', rbacResource('maintenance', 'read'), getMaintenanceTimeline);
+router.post('/requests/:id/comments', rbacResource('maintenance', 'read'), addMaintenanceComment);
+router.post('/requests/:id/attachments', rbacResource('maintenance', 'read'), attachmentUploadMiddleware, addMaintenanceAttachments);
+router.delete('/requests/:id/attachments/:fileId', rbacResource('maintenance', 'read'), removeMaintenanceAttachment);
+router.post('/requests/:id/vendor-rating', rbacResource('maintenance', 'update'), rateMaintenanceVendor);
+
+// Costs: approval of estimates above the threshold, receipts and materials drawn from inventory
+router.post('/requests/:id/cost-approval', rbacResource('maintenance', 'update'), requestMaintenanceCostApproval);
+router.post('/requests/:id/cost-decision', rbacResource('maintenance', 'update'), decideMaintenanceCost);
+router.post('/requests/:id/receipts', rbacResource('maintenance', 'update'), addMaintenanceReceipt);
+router.delete('/requests/:id/receipts/:receiptId', rbacResource('maintenance', 'update'), removeMaintenanceReceipt);
+router.get('/requests/:id/materials', rbacResource('maintenance', 'read'), getMaintenanceMaterials);
+router.post('/requests/:id/materials', rbacResource('maintenance', 'update'), consumeMaintenanceMaterials);
+router.post('/requests/:id/materials/:movementId/return', rbacResource('maintenance', 'update'), returnMaintenanceMaterial);
+router.get('/costs/pending-approvals', rbacResource('maintenance', 'read'), listPendingCostApprovals);
+router.get('/costs/settings', rbacResource('maintenance', 'read'), getMaintenanceCostSettings);
+router.put('/costs/settings', rbacResource('maintenance', 'update'), updateMaintenanceCostSettings);
+
+// Per-property annual budgets
+router.get('/budgets', rbacResource('maintenance', 'overview'), listMaintenanceBudgets);
+router.put('/budgets/:propertyId/:year', rbacResource('maintenance', 'update'), upsertMaintenanceBudget);
+router.get('/budgets/:propertyId/:year/burn-down', rbacResource('maintenance', 'overview'), getMaintenanceBudgetBurnDown);
+
 // Maintenance overview
 router.get('/overview', rbacResource('maintenance', 'overview'), getMaintenanceOverview);
 
+// SLA targets and compliance
+router.get('/sla/policy', rbacResource('maintenance', 'read'), getMaintenanceSlaPolicy);
+router.put('/sla/policy', rbacResource('maintenance', 'update'), updateMaintenanceSlaPolicy);
+router.get('/sla/report', rbacResource('maintenance', 'overview'), getMaintenanceSlaReport);
+
+// Recurring preventive maintenance
+router.get('/preventive-schedules', rbacResource('maintenance', 'read'), listPreventiveSchedules);
+router.post('/preventive-schedules', rbacResource('maintenance', 'create'), createPreventiveSchedule);
+router.put('/preventive-schedules/:id', rbacResource('maintenance', 'update'), updatePreventiveSchedule);
+router.delete('/preventive-schedules/:id', rbacResource('maintenance', 'delete'), deletePreventiveSchedule);
+router.get('/preventive-schedules/:id/history', rbacResource('maintenance', 'read'), getPreventiveScheduleHistory);
+router.post('/preventive-schedules/:id/run', rbacResource('maintenance', 'create'), runPreventiveSchedule);
+
 export default router;
@@ -1,7 +1,7 @@
 import { Router } from 'express';
 import { requireAuth } from '../middleware/auth.js';
 import { rbacResource } from '../middleware/rbac.js';
-import { messagingController } from '../controllers/messaging.controller.js';
+import { messagingController, messageAttachmentUploadMiddleware } from '../controllers/messaging.controller.js';
 
 const router = Router();
 
@@ -9,14 +9,29 @@ const router = Router();
 router.use(requireAuth);
 
 // Conversations
+router.get('/unread-counts', rbacResource('messages', 'read'), messagingController.getUnreadCounts);
 router.get('/conversations', rbacResource('messages', 'read'), messagingController.getConversations);
 router.post('/conversations', rbacResource('messages', 'create'), messagingController.createConversation);
 router.get('/conversations/:id', rbacResource('messages', 'read'), messagingController.getConversation);
 router.delete('/conversations/:id', rbacResource('messages', 'delete'), messagingController.deleteConversation);
+router.put('/conversations/:id', rbacResource('messages', 'update'), messagingController.updateConversation);
+router.post('/conversations/:id/archive', rbacResource('messages', 'update'), messagingController.archiveConversation);
+router.delete('/conversations/:id/archive', rbacResource('messages', 'update'), messagingController.unarchiveConversation);
+
+// Participants
+router.post('/conversations/:id/participants', rbacResource('messages', 'update'), messagingController.addParticipants);
+router.put('/conversations/:id/participants/:userId', rbacResource('messages', 'update'), messagingController.updateParticipantRole);
+router.delete('/conversations/:id/participants/:userId', rbacResource('messages', 'update'), messagingController.removeParticipant);
+router.post('/conversations/:id/leave', rbacResource('messages', 'update'), messagingController.leaveConversation);
 
 // Messages
 router.get('/conversations/:id/messages', rbacResource('messages', 'read'), messagingController.getMessages);
 router.post('/conversations/:id/messages', rbacResource('messages', 'create'), messagingController.createMessage);
+router.post('/conversations/:id/read', rbacResource('messages', 'update'), messagingController.markConversationRead);
+router.post('/attachments', rbacResource('messages', 'create'), messageAttachmentUploadMiddleware, messagingController.uploadAttachments);
+router.post('/messages/delivered', rbacResource('messages', 'update'), messagingController.markDelivered);
+router.get('/messages/:id/receipts', rbacResource('messages', 'read'), messagingController.getMessageReceipts);
+router.post('/messages/:id/translate', rbacResource('messages', 'read'), messagingController.translateMessage);
 router.put('/messages/:id', rbacResource('messages', 'update'), messagingController.updateMessage);
 router.delete('/messages/:id', rbacResource('messages', 'delete'), messagingController.deleteMessage);
 
@@ -26,10 +41,29 @@ router.delete('/messages/:id/reactions/:reactionType', rbacResource('messages',
 router.post('/conversations/:id/pin/:messageId', rbacResource('messages', 'update'), messagingController.pinMessage);
 router.delete('/conversations/:id/pin/:messageId', rbacResource('messages', 'update'), messagingController.unpinMessage);
 
+// Templates
+router.get('/templates', rbacResource('messages', 'read'), messagingController.getTemplates);
+router.post('/templates', rbacResource('messages', 'create'), messagingController.createTemplate);
+router.get('/templates/:id', rbacResource('messages', 'read'), messagingController.getTemplate);
+router.put('/templates/:id', rbacResource('messages', 'update'), messagingController.updateTemplate);
+router.delete('/templates/:id', rbacResource('messages', 'delete'), messagingController.deleteTemplate);
+router.post('/templates/:id/render', rbacResource('messages', 'read'), messagingController.renderTemplate);
+
 // Search
 router.get('/search', rbacResource('messages', 'read'), messagingController.searchMessages);
 
-// Presence & Typing
+// Analytics
+router.get('/analytics', rbacResource('messages', 'read'), messagingController.getAnalytics);
+
+// Escalation rules for unanswered messages, and their audit trail
+router.get('/escalation-rules', rbacResource('messages', 'read'), messagingController.getEscalationRules);
+router.post('/escalation-rules', rbacResource('messages', 'create'), messagingController.createEscalationRule);
+router.put('/escalation-rules/:id', rbacResource('messages', 'update'), messagingController.updateEscalationRule);
+router.delete('/escalation-rules/:id', rbacResource('messages', 'delete'), messagingController.deleteEscalationRule);
+router.get('/escalations', rbacResource('messages', 'read'), messagingController.getEscalations);
+
+// Presence & Typing (ephemeral: relayed over realtime channels, never stored)
+router.get('/presence', rbacResource('messages', 'read'), messagingController.getPresence);
 router.post('/presence', rbacResource('messages', 'update'), messagingController.updatePresence);
 router.post('/typing', rbacResource('messages', 'update'), messagingController.updateTypingIndicator);
 
@@ -10,8 +10,17 @@ router.use(requireAuth);
 
 // Specific routes (must come before parameterized routes)
 router.get('/unread-count', rbacResource('notifications', 'read'), notificationsController.getUnreadCount);
-router.post('/mark-all-read', rbacResource('notifications', 'update'), notificationsController.markAllAsRead);
+// Every role reads its own inbox, so read access is enough to mark notifications read
+router.post('/mark-all-read', rbacResource('notifications', 'read'), notificationsController.markAllAsRead);
+router.get('/preferences', rbacResource('notifications', 'read'), notificationsController.getPreferences);
+router.put('/preferences', rbacResource('notifications', 'read'), notificationsController.updatePreferences);
+router.delete('/preferences/:type', rbacResource('notifications', 'read'), notificationsController.resetPreference);
 router.post('/bulk', rbacResource('notifications', 'update'), notificationsController.bulkUpdateNotifications);
+router.post('/properties/:propertyId/announcements', rbacResource('notifications', 'create'), notificationsController.createPropertyAnnouncement);
+// Delivery queue: dead letters and requeueing (admin roles, checked in the service)
+router.get('/deliveries/dead-letters', rbacResource('notifications', 'read'), notificationsController.getDeadLetters);
+router.post('/deliveries/dead-letters/requeue', rbacResource('notifications', 'update'), notificationsController.requeueDeadLetters);
+router.post('/deliveries/:deliveryId/requeue', rbacResource('notifications', 'update'), notificationsController.requeueDelivery);
 
 // CRUD operations
 router.get('/', rbacResource('notifications', 'read'), notificationsController.getNotifications);
@@ -21,7 +30,8 @@ router.put('/:id', rbacResource('notifications', 'update'), notificationsControl
 router.delete('/:id', rbacResource('notifications', 'delete'), notificationsController.deleteNotification);
 
 // Notification actions
-router.post('/:id/read', rbacResource('notifications', 'update'), notificationsController.markAsRead);
+router.post('/:id/read', rbacResource('notifications', 'read'), notificationsController.markAsRead);
 router.post('/:id/archive', rbacResource('notifications', 'update'), notificationsController.archiveNotification);
+router.get('/:id/deliveries', rbacResource('notifications', 'read'), notificationsController.getDeliveryStatus);
 
 export default router;
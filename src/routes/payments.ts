@@ -1,6 +1,7 @@
 import { Router } from 'express';
 import { 
   listPayments,
+  exportPayments,
   getPayment,
   createPayment,
   updatePayment,
@@ -31,6 +32,7 @@ router.post('/rent-routing', getRentRoutingContext); // Tenant endpoint, no subs
 // Payments CRUD
 router.post('/', rbacResource('payments', 'create'), createPayment);
 router.get('/', rbacResource('payments', 'read'), listPayments);
+router.get('/export', rbacResource('payments', 'read'), exportPayments);
 router.get('/:id', rbacResource('payments', 'read'), getPayment);
 router.put('/:id', rbacResource('payments', 'update'), updatePayment);
 router.delete('/:id', rbacResource('payments', 'delete'), deletePayment);
@@ -0,0 +1,10 @@
+import { Router } from 'express';
+import * as platformAnnouncementsController from '../controllers/platform-announcements.controller.js';
+
+const router = Router();
+
+// Platform banners for agency and landlord users; super admins publish them under /super-admin/announcements
+router.get('/', platformAnnouncementsController.getActiveAnnouncements);
+router.post('/:id/dismiss', platformAnnouncementsController.dismissAnnouncement);
+
+export default router;
@@ -22,11 +22,12 @@ import {
   documentUploadMiddleware 
 } from '../controllers/documents.controller.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { enforcePlanLimit } from '../middleware/plan-limits.js';
 
 const router = Router();
 
 // Properties CRUD
-router.post('/', rbacResource('properties', 'create'), createProperty);
+router.post('/', rbacResource('properties', 'create'), enforcePlanLimit('properties'), createProperty);
 router.get('/', rbacResource('properties', 'read'), listProperties);
 router.get('/:id', rbacResource('properties', 'read'), getProperty);
 router.put('/:id', rbacResource('properties', 'update'), updateProperty);
@@ -45,7 +46,7 @@ router.post('/:id/documents', rbacResource('properties', 'update'), documentUplo
 router.get('/:id/documents', rbacResource('properties', 'read'), getPropertyDocuments);
 
 // Property management actions
-router.post('/:id/duplicate', rbacResource('properties', 'duplicate'), duplicateProperty);
+router.post('/:id/duplicate', rbacResource('properties', 'duplicate'), enforcePlanLimit('properties'), duplicateProperty);
 router.patch('/:id/status', rbacResource('properties', 'update'), updatePropertyStatus);
 router.patch('/:id/archive', rbacResource('properties', 'archive'), archiveProperty);
 
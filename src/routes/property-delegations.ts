@@ -0,0 +1,13 @@
+import { Router } from 'express';
+import * as propertyDelegationsController from '../controllers/property-delegations.controller.js';
+
+const router = Router();
+
+// Landlords delegate and change; agency admins see theirs and can end them; the service checks
+router.get('/', propertyDelegationsController.listDelegations);
+router.post('/', propertyDelegationsController.createDelegation);
+router.get('/:id', propertyDelegationsController.getDelegation);
+router.put('/:id', propertyDelegationsController.updateDelegation);
+router.post('/:id/end', propertyDelegationsController.endDelegation);
+
+export default router;
@@ -1,6 +1,7 @@
 import { Router } from 'express';
 import { requireAuth } from '../middleware/auth.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { auditReportAccess } from '../middleware/report-audit.js';
 import { reportsController } from '../controllers/reports.controller.js';
 
 const router = Router();
@@ -9,18 +10,51 @@ const router = Router();
 router.use(requireAuth);
 
 // General reports
-router.get('/', rbacResource('reports', 'read'), reportsController.getReports);
+router.get('/', rbacResource('reports', 'read'), auditReportAccess('view', { reportType: req => (req.query.type as string) || 'overview' }), reportsController.getReports);
 
 // Specific report types
-router.get('/property', rbacResource('reports', 'read'), reportsController.getPropertyReport);
-router.get('/financial', rbacResource('reports', 'read'), reportsController.getFinancialReport);
-router.get('/occupancy', rbacResource('reports', 'read'), reportsController.getOccupancyReport);
-router.get('/rent-collection', rbacResource('reports', 'read'), reportsController.getRentCollectionReport);
-router.get('/maintenance', rbacResource('reports', 'read'), reportsController.getMaintenanceReport);
+router.get('/property', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getPropertyReport);
+router.get('/financial', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getFinancialReport);
+router.get('/occupancy', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getOccupancyReport);
+router.get('/occupancy/trend', rbacResource('reports', 'read'), auditReportAccess('view', { reportType: 'occupancy-trend' }), reportsController.getOccupancyTrend);
+router.post('/occupancy/backfill', rbacResource('reports', 'read'), reportsController.backfillOccupancy);
+router.get('/rent-collection', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getRentCollectionReport);
+router.get('/maintenance', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getMaintenanceReport);
+router.get('/arrears-aging', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getArrearsAgingReport);
+router.get('/rent-roll', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getRentRollReport);
+router.get('/profit-loss', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getProfitLossReport);
+router.get('/budget-variance', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getBudgetVarianceReport);
+router.get('/tax-summary', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getTaxSummaryReport);
+router.get('/benchmarking', rbacResource('reports', 'read'), auditReportAccess('view'), reportsController.getBenchmarkingReport);
+// Agency roll-ups across the landlords an agency manages, with a drill-down per landlord
+router.get('/agency', rbacResource('reports', 'read'), auditReportAccess('view', { reportType: 'agency-rollup' }), reportsController.getAgencyRollupReport);
+router.get('/agency/landlords/:ownerId', rbacResource('reports', 'read'), auditReportAccess('view', { reportType: 'agency-rollup', resourceType: 'landlord', resourceParam: 'ownerId' }), reportsController.getAgencyLandlordReport);
+
+// Scheduled reports (must be registered before /:type/export)
+router.get('/schedules', rbacResource('reports', 'read'), reportsController.getSchedules);
+router.post('/schedules', rbacResource('reports', 'read'), reportsController.createSchedule);
+router.put('/schedules/:id', rbacResource('reports', 'read'), reportsController.updateSchedule);
+router.delete('/schedules/:id', rbacResource('reports', 'read'), reportsController.deleteSchedule);
+router.get('/schedules/:id/runs', rbacResource('reports', 'read'), reportsController.getScheduleRuns);
+router.post('/schedules/:id/runs/:runId/link', rbacResource('reports', 'read'), auditReportAccess('download_link', { reportType: 'scheduled-report', resourceType: 'scheduled_report_run', resourceParam: 'runId' }), reportsController.issueScheduleRunLink);
+router.post('/schedules/:id/run', rbacResource('reports', 'read'), auditReportAccess('export', { reportType: 'scheduled-report', resourceType: 'scheduled_report', resourceParam: 'id' }), reportsController.runSchedule);
+
+// Custom report builder (saved templates; export or schedule them as report type "custom" with template_id)
+router.get('/templates/options', rbacResource('reports', 'read'), reportsController.getTemplateOptions);
+router.get('/templates', rbacResource('reports', 'read'), reportsController.getTemplates);
+router.post('/templates', rbacResource('reports', 'generate'), reportsController.createTemplate);
+router.get('/templates/:id', rbacResource('reports', 'read'), reportsController.getTemplate);
+router.put('/templates/:id', rbacResource('reports', 'generate'), reportsController.updateTemplate);
+router.delete('/templates/:id', rbacResource('reports', 'generate'), reportsController.deleteTemplate);
+router.get('/templates/:id/run', rbacResource('reports', 'read'), auditReportAccess('view', { reportType: 'custom', resourceType: 'report_template', resourceParam: 'id' }), reportsController.runTemplate);
+
+// Who viewed, exported or fetched links to which reports (agency admins see their company)
+router.get('/audit', rbacResource('reports', 'read'), reportsController.getReportAuditTrail);
 
 // Export functionality
-router.get('/export/:type', rbacResource('reports', 'read'), reportsController.exportReport);
+const auditExport = auditReportAccess('export', { reportType: req => req.params.type as string, format: req => String(req.query.format || 'csv') });
+router.get('/export/:type', rbacResource('reports', 'read'), auditExport, reportsController.exportReport);
 // Backward/alternate path used by some clients: /reports/:type/export
-router.get('/:type/export', rbacResource('reports', 'read'), reportsController.exportReport);
+router.get('/:type/export', rbacResource('reports', 'read'), auditExport, reportsController.exportReport);
 
 export default router;
@@ -0,0 +1,16 @@
+import { Router } from 'express';
+import { smsController } from '../controllers/sms.controller.js';
+
+const router = Router();
+
+// Sent messages with delivery status, and usage for billing
+router.get('/messages', smsController.getMessages);
+router.get('/usage', smsController.getUsage);
+
+// Per-company sender ID
+router.get('/settings', smsController.getSettings);
+router.put('/settings', smsController.updateSettings);
+
+router.post('/test', smsController.sendTest);
+
+export default router;
@@ -1,6 +1,7 @@
 import { Router } from 'express';
 import { requireAuth } from '../middleware/auth.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { enforcePlanLimit } from '../middleware/plan-limits.js';
 import { staffController } from '../controllers/staff.controller.js';
 import { requireCompanyContext } from '../middleware/companyContext.js';
 
@@ -12,7 +13,7 @@ router.use(requireAuth);
 // CRUD operations for staff (all roles: caretaker, cleaner, security, etc.)
 router.get('/', rbacResource('staff', 'read'), staffController.getStaff);
 // Require company context for creating staff members
-router.post('/', requireCompanyContext, rbacResource('staff', 'create'), staffController.createStaff);
+router.post('/', requireCompanyContext, rbacResource('staff', 'create'), enforcePlanLimit('users'), staffController.createStaff);
 router.get('/:id', rbacResource('staff', 'read'), staffController.getStaffMember);
 router.put('/:id', rbacResource('staff', 'update'), staffController.updateStaff);
 router.delete('/:id', rbacResource('staff', 'delete'), staffController.deleteStaff);
@@ -1,15 +1,35 @@
 import { Router, Request, Response, NextFunction } from 'express';
 import { requireAuth } from '../middleware/auth.js';
+import { cacheAnalytics } from '../middleware/analytics-cache.js';
 import {
   getDashboardData,
   getKPIMetrics,
   getSystemHealth,
   getAuditLogs,
+  getSystemLogs,
+  getOperationsDashboard,
+  getAdminActivity,
+  getRetentionPolicies,
+  updateRetentionPolicy,
+  runRetentionPolicies,
+  getRetentionRuns,
+  getPlatformAnnouncements,
+  getPlatformAnnouncement,
+  createPlatformAnnouncement,
+  updatePlatformAnnouncement,
+  publishPlatformAnnouncement,
+  archivePlatformAnnouncement,
   getAnalyticsChart,
+  getAnalyticsHistory,
+  captureAnalyticsSnapshot,
   getSystemSettings,
   updateSystemSettings,
   bulkUpdateSystemSettings,
   initializeSystemSettings,
+  getSystemSettingHistory,
+  platformSearch,
+  getAllTenants,
+  exportAllTenants,
   getSecurityLogs,
   getUserManagement,
   getUserById,
@@ -27,6 +47,10 @@ import {
   createAgency,
   updateAgency,
   deleteAgency,
+  suspendAgency,
+  getAgencyPlanUsage,
+  reactivateAgency,
+  getAgencyStatusHistory,
   activateEntity,
   deactivateEntity,
   suspendEntity,
@@ -38,10 +62,18 @@ import {
   getAgencyBilling,
   getLandlordBilling,
   getAgencyPerformance,
+  getAgencyHealthScores,
+  getAgencyHealth,
+  recomputeAgencyHealth,
   getBillingPlans,
   getBillingSubscriptions,
+  getSubscriptionAnalytics,
   getBillingInvoices,
+  retryBillingInvoice,
+  runSubscriptionBilling,
+  getPlatformUsage,
   getPlatformAnalytics,
+  getRegionalAnalytics,
   getRevenueDashboard,
   checkCompanyIntegrity,
   getPaymentGateways,
@@ -51,6 +83,7 @@ import {
   togglePaymentGatewayStatus,
   getUserMetrics
 } from '../controllers/super-admin.controller.js';
+import { listTenantFlagDisputes, reviewTenantFlagDispute } from '../controllers/tenant-flags.controller.js';
 
 const router = Router();
 
@@ -81,23 +114,57 @@ router.put('/companies/:id', updateCompany);
 router.use(requireSuperAdmin);
 
 // Dashboard and Analytics
-router.get('/dashboard', getDashboardData);
-router.get('/kpis', getKPIMetrics);
-router.get('/analytics/:chartType', getAnalyticsChart);
-router.get('/platform-analytics', getPlatformAnalytics);
-router.get('/revenue-dashboard', getRevenueDashboard);
+router.get('/dashboard', cacheAnalytics(60), getDashboardData);
+router.get('/kpis', cacheAnalytics(60), getKPIMetrics);
+// Platform growth from nightly snapshots (registered before /analytics/:chartType)
+router.get('/analytics/history', cacheAnalytics(300), getAnalyticsHistory);
+router.post('/analytics/history/snapshot', captureAnalyticsSnapshot);
+router.get('/analytics/:chartType', cacheAnalytics(300), getAnalyticsChart);
+router.get('/platform-analytics', cacheAnalytics(300), getPlatformAnalytics);
+router.get('/platform-analytics/regions', cacheAnalytics(300), getRegionalAnalytics);
+router.get('/revenue-dashboard', cacheAnalytics(300), getRevenueDashboard);
 
 // System Management
 router.get('/system/health', getSystemHealth);
 router.get('/system/company-integrity', checkCompanyIntegrity);
 router.get('/system/settings', getSystemSettings);
 router.post('/system/settings/initialize', initializeSystemSettings);
+router.get('/system/settings/history', getSystemSettingHistory);
+router.get('/system/settings/:key/history', getSystemSettingHistory);
 router.put('/system/settings/:key', updateSystemSettings);
 router.post('/system/settings/bulk', bulkUpdateSystemSettings);
 
 // Audit and Security
 router.get('/audit-logs', getAuditLogs);
 router.get('/security-logs', getSecurityLogs);
+router.get('/system/logs', getSystemLogs);
+router.get('/system/operations', getOperationsDashboard);
+router.get('/admin-activity', getAdminActivity);
+
+// Data retention
+router.get('/retention/policies', getRetentionPolicies);
+router.put('/retention/policies/:key', updateRetentionPolicy);
+router.post('/retention/run', runRetentionPolicies);
+router.get('/retention/runs', getRetentionRuns);
+
+// Platform announcements (banners and emails to agencies and landlords)
+router.get('/announcements', getPlatformAnnouncements);
+router.post('/announcements', createPlatformAnnouncement);
+router.get('/announcements/:id', getPlatformAnnouncement);
+router.put('/announcements/:id', updatePlatformAnnouncement);
+router.post('/announcements/:id/publish', publishPlatformAnnouncement);
+router.post('/announcements/:id/archive', archivePlatformAnnouncement);
+
+// Tenant directory (platform-wide)
+router.get('/tenants', getAllTenants);
+router.get('/tenants/export', exportAllTenants);
+
+// Tenant flag disputes (platform-wide)
+router.get('/tenant-flags/disputes', listTenantFlagDisputes);
+router.post('/tenant-flags/:flagId/review', reviewTenantFlagDispute);
+
+// Platform-wide search across agencies, users, properties and invoices
+router.get('/search', platformSearch);
 
 // User Management
 router.get('/users', getUserManagement);
@@ -117,9 +184,16 @@ router.delete('/companies/:id', deleteCompany);
 // Agency Management
 router.get('/agencies', getAgencyManagement);
 router.get('/agencies/performance', getAgencyPerformance);
+router.get('/agencies/health', getAgencyHealthScores);
+router.post('/agencies/health/recompute', recomputeAgencyHealth);
+router.get('/agencies/:id/health', getAgencyHealth);
 router.get('/agencies/:id', getAgencyById);
 router.get('/agencies/:id/properties', getAgencyProperties);
 router.get('/agencies/:id/units', getAgencyUnits);
+router.get('/agencies/:id/status-history', getAgencyStatusHistory);
+router.get('/agencies/:id/usage', getAgencyPlanUsage);
+router.post('/agencies/:id/suspend', suspendAgency);
+router.post('/agencies/:id/reactivate', reactivateAgency);
 router.post('/agencies', createAgency);
 router.put('/agencies/:id', updateAgency);
 router.delete('/agencies/:id', deleteAgency);
@@ -149,7 +223,11 @@ router.get('/billing/agencies', getAgencyBilling);
 router.get('/billing/landlords', getLandlordBilling);
 router.get('/billing/plans', getBillingPlans);
 router.get('/billing/subscriptions', getBillingSubscriptions);
+router.get('/billing/analytics', getSubscriptionAnalytics);
 router.get('/billing/invoices', getBillingInvoices);
+router.post('/billing/invoices/:id/retry', retryBillingInvoice);
+router.post('/billing/run', runSubscriptionBilling);
+router.get('/usage', getPlatformUsage);
 
 // Payment Gateway Management
 router.get('/billing/gateways', getPaymentGateways);
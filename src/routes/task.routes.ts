@@ -1,5 +1,6 @@
 import express from 'express';
 import { requireAuth } from '../middleware/auth.js';
+import { rbacResource } from '../middleware/rbac.js';
 import * as taskController from '../controllers/task.controller.js';
 
 const router = express.Router();
@@ -10,11 +11,19 @@ router.use(requireAuth);
 // Task statistics
 router.get('/stats', taskController.getTaskStats);
 
+// Field time tracking
+router.get('/time-summary', taskController.getTaskTimeSummary);
+router.get('/location-flags', taskController.getTaskLocationFlags);
+
 // CRUD operations
 router.post('/', taskController.createTask);
 router.get('/', taskController.getTasks);
 router.get('/:id', taskController.getTaskById);
 router.put('/:id', taskController.updateTask);
+router.put('/:id/reassign', rbacResource('tasks', 'update'), taskController.reassignTask);
+router.post('/:id/check-in', taskController.checkInTask);
+router.post('/:id/check-out', taskController.checkOutTask);
+router.get('/:id/location-events', taskController.getTaskLocationEvents);
 router.delete('/:id', taskController.deleteTask);
 
 export default router;
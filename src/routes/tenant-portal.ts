@@ -28,6 +28,17 @@ import {
   unregisterPushToken,
   testPushNotification
 } from '../controllers/tenant-portal.controller.js';
+import { getMyTenantFlags, disputeTenantFlag } from '../controllers/tenant-flags.controller.js';
+import {
+  addMaintenanceAttachments,
+  removeMaintenanceAttachment,
+  attachmentUploadMiddleware,
+  getMaintenanceTimeline,
+  getMaintenanceComments,
+  addMaintenanceComment,
+  rateMaintenanceService
+} from '../controllers/maintenance.controller.js';
+import { reportEmergency, listEmergencies, getEmergency } from '../controllers/emergency.controller.js';
 
 import {
   getTenantPreferences,
@@ -96,8 +107,19 @@ router.get('/pending-payables', getTenantPendingPayables);
 
 // Maintenance requests
 router.get('/maintenance', getTenantMaintenance);
-router.post('/maintenance', createMaintenanceRequest);
+router.post('/maintenance', attachmentUploadMiddleware, createMaintenanceRequest);
 router.put('/maintenance/:id', updateTenantMaintenanceRequest);
+router.get('/maintenance/:id/timeline', getMaintenanceTimeline);
+router.get('/maintenance/:id/comments', getMaintenanceComments);
+router.post('/maintenance/:id/comments', addMaintenanceComment);
+router.post('/maintenance/:id/rating', rateMaintenanceService);
+router.post('/maintenance/:id/attachments', attachmentUploadMiddleware, addMaintenanceAttachments);
+router.delete('/maintenance/:id/attachments/:fileId', removeMaintenanceAttachment);
+
+// Emergencies (reported for the tenant's current unit)
+router.get('/emergencies', listEmergencies);
+router.post('/emergencies', reportEmergency);
+router.get('/emergencies/:id', getEmergency);
 
 // Messages/Chat (separate from notifications)
 router.get('/messages', getTenantMessages);
@@ -126,6 +148,10 @@ router.get('/settings/security/2fa', get2FASettings);
 router.post('/settings/security/2fa/enable', enable2FA);
 router.post('/settings/security/2fa/disable', disable2FA);
 
+// Flags on the tenant's record and disputes
+router.get('/flags', getMyTenantFlags);
+router.post('/flags/:flagId/dispute', disputeTenantFlag);
+
 // Push Notifications - Supabase Push Token Registration
 router.post('/push-token', registerPushToken);
 router.delete('/push-token', unregisterPushToken);
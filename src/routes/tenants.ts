@@ -6,6 +6,7 @@ import {
   deleteTenant, 
   checkTenantDeletable,
   listTenants,
+  exportTenants,
   assignUnit,
   releaseUnit,
   terminateTenant,
@@ -23,6 +24,19 @@ import {
   updateTenantNotes
 } from '../controllers/tenants.controller.js';
 import { uploadTenantDocuments, documentUploadMiddleware } from '../controllers/documents.controller.js';
+import {
+  getTenantKycVerifications,
+  processTenantKycDocument,
+  reviewTenantKycVerification
+} from '../controllers/kyc.controller.js';
+import {
+  screenTenant,
+  getTenantFlags,
+  flagTenant,
+  resolveTenantFlag,
+  listTenantFlagDisputes,
+  reviewTenantFlagDispute
+} from '../controllers/tenant-flags.controller.js';
 import { 
   createTenantPayment
 } from '../controllers/payments.controller.js';
@@ -33,6 +47,13 @@ const router = Router();
 // Tenants CRUD
 router.post('/', rbacResource('tenants', 'create'), createTenant);
 router.get('/', rbacResource('tenants', 'read'), listTenants);
+router.get('/export', rbacResource('tenants', 'read'), exportTenants);
+
+// Tenant screening and flag disputes (must be registered before /:id)
+router.get('/screening', rbacResource('tenants', 'read'), screenTenant);
+router.get('/flags/disputes', rbacResource('tenants', 'update'), listTenantFlagDisputes);
+router.post('/flags/:flagId/review', rbacResource('tenants', 'update'), reviewTenantFlagDispute);
+
 router.get('/:id', rbacResource('tenants', 'read'), getTenant);
 router.get('/:id/check-deletable', rbacResource('tenants', 'read'), checkTenantDeletable);
 router.put('/:id', rbacResource('tenants', 'update'), updateTenant);
@@ -59,6 +80,14 @@ router.post(
   documentUploadMiddleware,
   uploadTenantDocuments
 );
+// KYC from uploaded ID documents
+router.get('/:id/kyc', rbacResource('tenants', 'read'), getTenantKycVerifications);
+router.post('/:id/kyc/documents/:documentId/process', rbacResource('tenants', 'update'), processTenantKycDocument);
+router.post('/:id/kyc/:verificationId/review', rbacResource('tenants', 'update'), reviewTenantKycVerification);
+// Tenant flags / blacklist
+router.get('/:id/flags', rbacResource('tenants', 'read'), getTenantFlags);
+router.post('/:id/flags', rbacResource('tenants', 'update'), flagTenant);
+router.post('/:id/flags/:flagId/resolve', rbacResource('tenants', 'update'), resolveTenantFlag);
 router.get('/:id/activity', rbacResource('tenants', 'read'), getTenantActivity);
 router.get('/:id/maintenance', rbacResource('tenants', 'read'), getTenantMaintenance);
 router.post('/:id/maintenance', rbacResource('maintenance', 'create'), createTenantMaintenance);
@@ -0,0 +1,33 @@
+import { Router } from 'express';
+import { requireAuth, optionalAuth } from '../middleware/auth.js';
+import { rbacResource } from '../middleware/rbac.js';
+import {
+  getPropertyVacancies,
+  submitUnitApplication,
+  withdrawUnitApplication,
+  joinPropertyWaitlist,
+  leavePropertyWaitlist,
+  listUnitApplications,
+  getUnitApplication,
+  reviewUnitApplication,
+  getPropertyWaitlist,
+  removeWaitlistEntry
+} from '../controllers/unit-applications.controller.js';
+
+const router = Router();
+
+// Public routes (no auth required; signed-in applicants are linked to their account)
+router.get('/properties/:propertyId/vacancies', getPropertyVacancies);
+router.post('/units/:unitId/apply', optionalAuth, submitUnitApplication);
+router.post('/properties/:propertyId/waitlist', optionalAuth, joinPropertyWaitlist);
+router.post('/waitlist/:entryId/leave', leavePropertyWaitlist);
+router.post('/:id/withdraw', withdrawUnitApplication);
+
+// Protected routes (agents, landlords, agency admins)
+router.get('/', requireAuth, rbacResource('tenants', 'read'), listUnitApplications);
+router.get('/properties/:propertyId/waitlist', requireAuth, rbacResource('tenants', 'read'), getPropertyWaitlist);
+router.delete('/waitlist/:entryId', requireAuth, rbacResource('tenants', 'update'), removeWaitlistEntry);
+router.get('/:id', requireAuth, rbacResource('tenants', 'read'), getUnitApplication);
+router.post('/:id/review', requireAuth, rbacResource('tenants', 'create'), reviewUnitApplication);
+
+export default router;
@@ -13,22 +13,43 @@ import {
   searchAvailableUnits,
   cleanupDuplicateTenantAssignments
 } from '../controllers/units.controller.js';
-import { uploadUnitImages, deleteUnitImage, uploadMiddleware } from '../controllers/images.controller.js';
+import {
+  listUnitImages,
+  uploadUnitImages,
+  setPrimaryUnitImage,
+  deleteUnitImage,
+  deleteUnitImages,
+  uploadMiddleware
+} from '../controllers/images.controller.js';
 import { getUnitDocuments, uploadUnitDocuments, documentUploadMiddleware } from '../controllers/documents.controller.js';
 import { getUnitActivity } from '../controllers/unit-activity.controller.js';
+import { getUnitQrCode, rotateUnitQrCode, processUnitQrScan, getUnitQrScans } from '../controllers/unit-qr.controller.js';
+import {
+  getUnitCalendar,
+  getUnitAvailability,
+  getShortStayQuote,
+  createUnitBooking,
+  cancelUnitBooking,
+  exportUnitICal,
+  syncUnitExternalCalendar
+} from '../controllers/short-stay.controller.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { enforcePlanLimit } from '../middleware/plan-limits.js';
 
 const router = Router();
 
 // Units CRUD
-router.post('/', rbacResource('units', 'create'), createUnit);
-router.post('/batch', rbacResource('units', 'create'), createUnits);
+router.post('/', rbacResource('units', 'create'), enforcePlanLimit('units'), createUnit);
+router.post('/batch', rbacResource('units', 'create'), enforcePlanLimit('units', req => (Array.isArray(req.body?.units) ? req.body.units.length : 0)), createUnits);
 router.get('/', rbacResource('units', 'read'), listUnits);
 router.get('/available', searchAvailableUnits); // Public endpoint for searching available units
 router.get('/:id/financials', rbacResource('units', 'read'), getUnitFinancials); // Must come before /:id route
 
 // Unit images management (must come before /:id route)
+router.get('/:id/images', rbacResource('units', 'read'), listUnitImages);
 router.post('/:id/images', rbacResource('units', 'photos'), uploadMiddleware, uploadUnitImages);
+router.put('/:id/images/:imageId/primary', rbacResource('units', 'photos'), setPrimaryUnitImage);
+router.delete('/:id/images', rbacResource('units', 'photos'), deleteUnitImages);
 router.delete('/:id/images/:imageId', rbacResource('units', 'photos'), deleteUnitImage);
 router.get('/:id/documents', rbacResource('units', 'read'), getUnitDocuments);
 router.post(
@@ -39,6 +60,21 @@ router.post(
 );
 router.get('/:id/history', rbacResource('units', 'read'), getUnitActivity);
 
+// Unit QR codes and scan audit trail (must come before /:id route)
+router.post('/qr-scans', rbacResource('units', 'read'), processUnitQrScan);
+router.get('/:id/qr', rbacResource('units', 'read'), getUnitQrCode);
+router.post('/:id/qr/rotate', rbacResource('units', 'update'), rotateUnitQrCode);
+router.get('/:id/qr-scans', rbacResource('units', 'read'), getUnitQrScans);
+
+// Short-stay booking calendar (must come before /:id route)
+router.get('/:id/calendar', rbacResource('units', 'read'), getUnitCalendar);
+router.get('/:id/calendar.ics', rbacResource('units', 'read'), exportUnitICal);
+router.post('/:id/calendar/sync', rbacResource('units', 'update'), syncUnitExternalCalendar);
+router.get('/:id/availability', rbacResource('units', 'read'), getUnitAvailability);
+router.get('/:id/short-stay-quote', rbacResource('units', 'read'), getShortStayQuote);
+router.post('/:id/bookings', rbacResource('units', 'update'), createUnitBooking);
+router.delete('/:id/bookings/:bookingId', rbacResource('units', 'update'), cancelUnitBooking);
+
 router.get('/:id', rbacResource('units', 'read'), getUnit);
 router.put('/:id', rbacResource('units', 'update'), updateUnit);
 router.delete('/:id', rbacResource('units', 'delete'), deleteUnit);
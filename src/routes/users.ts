@@ -15,7 +15,9 @@ import {
   uploadProfilePicture,
   upgradeToAgency,
   registerPushToken,
-  unregisterPushToken
+  unregisterPushToken,
+  getPushDevices,
+  removePushDevice
 } from '../controllers/users.controller.js';
 import multer from 'multer';
 
@@ -37,14 +39,19 @@ import {
   getUserPreferences,
   getUserNotificationSettings,
   getUserSecurityActivity,
+  getUserChannelPreferences,
   getTenantsCommunicationPreferences
 } from '../controllers/user-settings.controller.js';
+import { getDigestSettings, updateDigestSettings, previewDigest } from '../controllers/digest.controller.js';
+import { UserEmergencyContactsController } from '../controllers/user-emergency-contacts.controller.js';
 import { rbacResource } from '../middleware/rbac.js';
+import { enforcePlanLimit, countsAsPlanUser } from '../middleware/plan-limits.js';
 
 const router = Router();
+const userEmergencyContactsController = new UserEmergencyContactsController();
 
 // User CRUD operations
-router.post('/', rbacResource('users', 'create'), createUser);
+router.post('/', rbacResource('users', 'create'), enforcePlanLimit('users', countsAsPlanUser), createUser);
 router.get('/', rbacResource('users', 'read'), listUsers);
 router.get('/me', getCurrentUser); // No RBAC needed - users can always access their own profile
 router.put('/me', updateCurrentUser); // No RBAC needed - users can always update their own profile
@@ -53,11 +60,25 @@ router.post('/me/profile-picture', upload.single('file'), uploadProfilePicture);
 router.post('/me/upgrade-to-agency', upgradeToAgency);
 router.post('/me/push-token', registerPushToken);
 router.post('/me/push-token/unregister', unregisterPushToken);
+router.get('/me/push-devices', getPushDevices);
+router.delete('/me/push-devices/:deviceId', removePushDevice);
 
 // User Preferences
 router.get('/me/preferences', getCurrentUserPreferences); // No RBAC needed - users can access their own preferences
 router.put('/me/preferences', updateCurrentUserPreferences); // No RBAC needed - users can update their own preferences
 
+// Daily/weekly email digest (frequency, and a preview of the next one)
+router.get('/me/digest', getDigestSettings);
+router.put('/me/digest', updateDigestSettings);
+router.get('/me/digest/preview', previewDigest);
+
+// Personal emergency contacts / next-of-kin (access checked in the service)
+router.get('/me/emergency-contacts', userEmergencyContactsController.getContacts);
+router.post('/me/emergency-contacts', userEmergencyContactsController.createContact);
+router.put('/me/emergency-contacts/reorder', userEmergencyContactsController.reorderContacts);
+router.put('/me/emergency-contacts/:contactId', userEmergencyContactsController.updateContact);
+router.delete('/me/emergency-contacts/:contactId', userEmergencyContactsController.deleteContact);
+
 router.get('/:id', rbacResource('users', 'read'), getUser);
 router.put('/:id', rbacResource('users', 'update'), updateUser);
 router.delete('/:id', rbacResource('users', 'delete'), deleteUser);
@@ -71,6 +92,12 @@ router.put('/:id/deactivate', rbacResource('users', 'deactivate'), deactivateUse
 router.get('/tenants/communication-preferences', getTenantsCommunicationPreferences); // Get all tenants' communication preferences
 router.get('/:userId/preferences', getUserPreferences); // Get specific user's preferences
 router.get('/:userId/notification-settings', getUserNotificationSettings); // Get specific user's notification settings
+router.get('/:userId/channel-preferences', getUserChannelPreferences); // Get specific user's resolved communication channels
 router.get('/:userId/security-activity', getUserSecurityActivity); // Get specific user's security activity
+router.get('/:userId/emergency-contacts', userEmergencyContactsController.getContacts);
+router.post('/:userId/emergency-contacts', userEmergencyContactsController.createContact);
+router.put('/:userId/emergency-contacts/reorder', userEmergencyContactsController.reorderContacts);
+router.put('/:userId/emergency-contacts/:contactId', userEmergencyContactsController.updateContact);
+router.delete('/:userId/emergency-contacts/:contactId', userEmergencyContactsController.deleteContact);
 
 export default router;
@@ -0,0 +1,14 @@
+import { Router } from 'express';
+import { getVendorWorkOrder, updateVendorWorkOrder } from '../controllers/maintenance.controller.js';
+import { rateLimitVerification } from '../middleware/rate-limit.js';
+
+const router = Router();
+
+// Limits: 60 requests per 15 minutes per IP
+router.use(rateLimitVerification(15 * 60 * 1000, 60));
+
+// Public vendor endpoints (no authentication; the magic-link token identifies the work order)
+router.get('/work-orders/:token', getVendorWorkOrder);
+router.post('/work-orders/:token/updates', updateVendorWorkOrder);
+
+export default router;
@@ -6,6 +6,7 @@ const router = Router();
 
 // Use maintenance read for list (vendors are used in maintenance)
 router.get('/', rbacResource('maintenance', 'read'), vendorsController.listVendors);
+router.get('/:id', rbacResource('maintenance', 'read'), vendorsController.getVendor);
 router.post('/', rbacResource('maintenance', 'create'), vendorsController.createVendor);
 router.put('/:id', rbacResource('maintenance', 'update'), vendorsController.updateVendor);
 router.delete('/:id', rbacResource('maintenance', 'delete'), vendorsController.deleteVendor);
@@ -1,5 +1,7 @@
-import { Router } from 'express';
-import { handlePaystackWebhook } from '../controllers/webhooks.controller.js';
+import express, { Router } from 'express';
+import multer from 'multer';
+import { handlePaystackWebhook, handleSmsDeliveryReport, handleInboundEmail } from '../controllers/webhooks.controller.js';
+import { MAX_ATTACHMENT_BYTES, MAX_ATTACHMENTS_PER_MESSAGE } from '../services/message-attachments.service.js';
 
 const router = Router();
 
@@ -17,5 +19,34 @@ const router = Router();
  */
 router.post('/paystack', handlePaystackWebhook);
 
+/**
+ * SMS delivery reports (NO AUTH - shared token in the query string)
+ *
+ * Africa's Talking: set the delivery reports callback URL in the dashboard to
+ *   https://your-domain.com/api/v1/webhooks/sms/africastalking?token=<SMS_CALLBACK_TOKEN>
+ * Twilio: the status callback URL is sent with each message
+ */
+router.post('/sms/:provider', express.urlencoded({ extended: false }), handleSmsDeliveryReport);
+
+/**
+ * Inbound email replies to conversations (NO AUTH - verified by provider signature)
+ *
+ * Mailgun: a route matching reply+.*@<INBOUND_EMAIL_DOMAIN> that forwards to
+ *   https://your-domain.com/api/v1/webhooks/email/mailgun
+ * SES: a receipt rule with an SNS action (topic SES_INBOUND_TOPIC_ARN) subscribed over HTTPS to
+ *   https://your-domain.com/api/v1/webhooks/email/ses
+ */
+const inboundEmailUpload = multer({
+  storage: multer.memoryStorage(),
+  limits: { fileSize: MAX_ATTACHMENT_BYTES, files: MAX_ATTACHMENTS_PER_MESSAGE },
+});
+router.post(
+  '/email/:provider',
+  express.urlencoded({ extended: false, limit: '10mb' }),
+  express.text({ type: 'text/plain', limit: '40mb' }), // SNS posts JSON as text/plain
+  inboundEmailUpload.any(),
+  handleInboundEmail
+);
+
 export default router;
 
@@ -0,0 +1,365 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { sheetToCsv, zip } from '../utils/excel-export.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+import { signedLink } from './document-exports.service.js';
+
+export interface AccountExportRequest {
+  format?: string;
+  company_id?: string;
+}
+
+const FORMATS = ['csv', 'json'];
+// Roles that own a portfolio: landlords export their properties, agency and company admins everything they manage
+const EXPORT_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const MAX_ATTEMPTS = 3;
+// A build still "processing" after this long died with its server and is picked up again
+const PROCESSING_TIMEOUT_MS = 30 * 60 * 1000;
+// Archives are deleted from storage once they expire
+const RETENTION_DAYS = 7;
+// Signed download links stay valid for an hour at most, and never past the archive's expiry
+const LINK_TTL_SECONDS = 60 * 60;
+const BATCH_SIZE = 2;
+const DAY = 24 * 60 * 60 * 1000;
+
+// Tokens and secrets that must not leave the platform
+const OMITTED_FIELDS = ['verification_token', 'qr_token', 'vendor_token_hash', 'ical_import_url'];
+
+/**
+ * Plain values for an archive: decimals as numbers, dates as ISO strings, and JSON columns
+ * kept as objects (JSON) or serialised into one cell (CSV)
+ */
+const plain = (value: any, forCsv: boolean): any => {
+  if (value === null || value === undefined) return null;
+  if (value instanceof Date) return value.toISOString();
+  if (typeof value === 'object' && typeof value.toNumber === 'function') return value.toNumber();
+  if (Array.isArray(value)) return forCsv ? value.map(v => (typeof v === 'object' ? JSON.stringify(v) : v)).join('; ') : value;
+  if (typeof value === 'object') return forCsv ? JSON.stringify(value) : value;
+  return value;
+};
+
+const toRows = (records: any[], forCsv: boolean) =>
+  records.map(record => Object.fromEntries(
+    Object.entries(record)
+      .filter(([key]) => !OMITTED_FIELDS.includes(key))
+      .map(([key, value]) => [key, plain(value, forCsv)])
+  ));
+
+/**
+ * Full account data export: a ZIP of a landlord's or agency's properties, units, tenants, leases,
+ * invoices, payments and document metadata as CSV or JSON, built in the background and downloaded
+ * through short-lived signed links until the archive expires
+ */
+export class AccountExportsService {
+  private prisma = getPrisma();
+
+  async request(req: AccountExportRequest, user: JWTClaims) {
+    if (!EXPORT_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to export account data');
+    }
+    const format = req.format || 'csv';
+    if (!FORMATS.includes(format)) {
+      throw new Error(`format must be one of: ${FORMATS.join(', ')}`);
+    }
+    // Super admins export one company at a time
+    const companyId = user.role === 'super_admin' ? req.company_id || user.company_id : user.company_id;
+    if (!companyId) {
+      throw new Error(user.role === 'super_admin' ? 'company_id is required' : 'User must be associated with a company');
+    }
+    if (user.role === 'super_admin') {
+      const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { id: true } });
+      if (!company) throw new Error('Company not found');
+    }
+
+    const running = await this.prisma.accountExport.findFirst({
+      where: { requested_by: user.user_id, status: { in: ['queued', 'processing'] } },
+      select: { id: true },
+    });
+    if (running) {
+      throw new Error('an account export is already in progress; wait for it to finish before requesting another');
+    }
+
+    const exportRow = await this.prisma.accountExport.create({
+      data: { company_id: companyId, requested_by: user.user_id, format },
+    });
+    this.process(exportRow.id).catch(error => {
+      console.error(`❌ Account export ${exportRow.id} failed to start:`, error.message);
+    });
+    return this.present(exportRow);
+  }
+
+  async get(exportId: string, user: JWTClaims) {
+    return this.present(await this.getOwn(exportId, user));
+  }
+
+  private async getOwn(exportId: string, user: JWTClaims) {
+    const exportRow = await this.prisma.accountExport.findFirst({ where: { id: exportId, requested_by: user.user_id } });
+    if (!exportRow) {
+      throw new Error('Export not found');
+    }
+    return exportRow;
+  }
+
+  /**
+   * A fresh signed link, for when the last one has run out; `expiresIn` is in seconds. Expired
+   * exports have no file left and need a new export.
+   */
+  async issueLink(exportId: string, user: JWTClaims, expiresIn?: number) {
+    const exportRow = await this.getOwn(exportId, user);
+    // An expired export's file has been purged; there is nothing left to link to
+    if (exportRow.status === 'expired') {
+      throw new Error('export has expired; request a new one');
+    }
+    if (exportRow.status !== 'ready') {
+      throw new Error('The file is not ready yet');
+    }
+    return signedLink(exportRow, expiresIn, LINK_TTL_SECONDS);
+  }
+
+  async list(user: JWTClaims, limit: number = 20) {
+    const exports = await this.prisma.accountExport.findMany({
+      where: { requested_by: user.user_id },
+      orderBy: { created_at: 'desc' },
+      take: Math.min(Math.max(limit, 1), 100),
+    });
+    return Promise.all(exports.map(exportRow => this.present(exportRow)));
+  }
+
+  /**
+   * Scheduled run: queued exports, failures with attempts left and builds that stalled
+   */
+  async processPending(now = new Date()) {
+    const due = await this.prisma.accountExport.findMany({
+      where: {
+        attempts: { lt: MAX_ATTEMPTS },
+        OR: [
+          { status: 'queued' },
+          { status: 'processing', started_at: { lt: new Date(now.getTime() - PROCESSING_TIMEOUT_MS) } },
+        ],
+      },
+      orderBy: { created_at: 'asc' },
+      take: BATCH_SIZE,
+      select: { id: true },
+    });
+    let ready = 0;
+    for (const { id } of due) {
+      if ((await this.process(id)) === 'ready') ready++;
+    }
+    return { processed: due.length, ready };
+  }
+
+  /**
+   * Delete archives past their expiry from storage
+   */
+  async purgeExpired(now = new Date()) {
+    const expired = await this.prisma.accountExport.findMany({
+      where: { status: 'ready', expires_at: { lte: now } },
+      select: { id: true, file_id: true },
+      take: 50,
+    });
+    const { imagekitService } = await import('./imagekit.service.js');
+    for (const exportRow of expired) {
+      try {
+        if (exportRow.file_id) await imagekitService.deleteFile(exportRow.file_id);
+      } catch (error: any) {
+        console.error(`⚠️ Failed to delete expired account export ${exportRow.id}:`, error.message);
+        continue;
+      }
+      await this.prisma.accountExport.update({
+        where: { id: exportRow.id },
+        data: { status: 'expired', file_url: null, file_id: null },
+      });
+    }
+    return { expired: expired.length };
+  }
+
+  /**
+   * Build one archive; the status update doubles as a claim so it is only built once at a time
+   */
+  async process(exportId: string) {
+    const now = new Date();
+    const claimed = await this.prisma.accountExport.updateMany({
+      where: {
+        id: exportId,
+        attempts: { lt: MAX_ATTEMPTS },
+        OR: [
+          { status: 'queued' },
+          { status: 'processing', started_at: { lt: new Date(now.getTime() - PROCESSING_TIMEOUT_MS) } },
+        ],
+      },
+      data: { status: 'processing', started_at: now, attempts: { increment: 1 } },
+    });
+    if (!claimed.count) return null;
+
+    const exportRow = await this.prisma.accountExport.findUniqueOrThrow({
+      where: { id: exportId },
+      include: {
+        requester: { select: { id: true, email: true, phone_number: true, role: true, company_id: true, agency_id: true, landlord_id: true, status: true } },
+      },
+    });
+
+    try {
+      if (exportRow.requester.status !== 'active') {
+        throw new Error('Requesting user is no longer active');
+      }
+      // Built with the requester's current access; super admins get the company they asked for
+      const user = {
+        user_id: exportRow.requester.id,
+        email: exportRow.requester.email || '',
+        phone_number: exportRow.requester.phone_number || '',
+        role: exportRow.requester.role,
+        company_id: exportRow.company_id || exportRow.requester.company_id || undefined,
+        agency_id: exportRow.requester.agency_id || undefined,
+        landlord_id: exportRow.requester.landlord_id || undefined,
+      } as JWTClaims;
+
+      const datasets = await this.collect(user);
+      const { archive, counts } = this.buildArchive(datasets, exportRow.format, {
+        export_id: exportRow.id,
+        company_id: exportRow.company_id,
+        requested_by: exportRow.requested_by,
+        generated_at: new Date().toISOString(),
+      });
+      const fileName = `letrents_account_export_${new Date().toISOString().split('T')[0]}.zip`;
+
+      const { imagekitService } = await import('./imagekit.service.js');
+      const upload = await imagekitService.uploadFile(archive, fileName, `account-exports/${exportRow.company_id || 'system'}`, { isPrivate: true });
+
+      const completed = new Date();
+      const ready = await this.prisma.accountExport.update({
+        where: { id: exportId },
+        data: {
+          status: 'ready',
+          record_counts: counts,
+          file_name: fileName,
+          file_size: archive.length,
+          file_url: upload.url,
+          file_id: upload.fileId,
+          error: null,
+          completed_at: completed,
+          expires_at: new Date(completed.getTime() + RETENTION_DAYS * DAY),
+        },
+      });
+      await this.notifyReady(ready);
+      return 'ready';
+    } catch (error: any) {
+      // Retried by the scheduler until the attempts run out
+      const final = exportRow.attempts >= MAX_ATTEMPTS;
+      await this.prisma.accountExport.update({
+        where: { id: exportId },
+        data: {
+          status: final ? 'failed' : 'queued',
+          error: error.message || 'Unknown error',
+          ...(final && { completed_at: new Date() }),
+        },
+      });
+      return final ? 'failed' : 'queued';
+    }
+  }
+
+  /**
+   * Everything in the user's portfolio, keyed by dataset name
+   */
+  private async collect(user: JWTClaims): Promise<Record<string, any[]>> {
+    // Super admins are not company-scoped by role, so the export's company is applied explicitly
+    const properties = await this.prisma.property.findMany({
+      where: { ...buildWhereClause(user), ...(user.company_id && { company_id: user.company_id }) },
+      orderBy: { created_at: 'asc' },
+    });
+    const propertyIds = properties.map(p => p.id);
+
+    const [units, leases, invoices, payments] = await Promise.all([
+      this.prisma.unit.findMany({ where: { property_id: { in: propertyIds } }, orderBy: [{ property_id: 'asc' }, { unit_number: 'asc' }] }),
+      this.prisma.lease.findMany({ where: { property_id: { in: propertyIds } }, orderBy: { start_date: 'asc' } }),
+      this.prisma.invoice.findMany({
+        where: { OR: [{ property_id: { in: propertyIds } }, { property_id: null, unit: { property_id: { in: propertyIds } } }] },
+        orderBy: { created_at: 'asc' },
+      }),
+      this.prisma.payment.findMany({
+        where: { OR: [{ property_id: { in: propertyIds } }, { property_id: null, unit: { property_id: { in: propertyIds } } }] },
+        orderBy: { payment_date: 'asc' },
+      }),
+    ]);
+
+    // Tenants are everyone with a lease or payment in the portfolio
+    const tenantIds = [...new Set([...leases.map(l => l.tenant_id), ...payments.map(p => p.tenant_id)])];
+    const [tenants, documents] = await Promise.all([
+      this.prisma.user.findMany({
+        where: { id: { in: tenantIds } },
+        select: { id: true, first_name: true, last_name: true, email: true, phone_number: true, status: true, created_at: true },
+        orderBy: { created_at: 'asc' },
+      }),
+      // Metadata only; the files stay at their URLs
+      this.prisma.tenantDocument.findMany({
+        where: { tenant_id: { in: tenantIds }, ...(user.company_id && { company_id: user.company_id }) },
+        select: {
+          id: true, tenant_id: true, name: true, type: true, category: true, size: true, url: true,
+          description: true, tags: true, expiry_date: true, status: true, uploaded_by: true, created_at: true,
+        },
+        orderBy: { created_at: 'asc' },
+      }),
+    ]);
+
+    return { properties, units, tenants, leases, invoices, payments, documents };
+  }
+
+  private buildArchive(datasets: Record<string, any[]>, format: string, manifest: Record<string, any>) {
+    const counts: Record<string, number> = {};
+    const entries: Array<{ name: string; data: Buffer }> = [];
+    for (const [name, records] of Object.entries(datasets)) {
+      counts[name] = records.length;
+      if (format === 'json') {
+        entries.push({ name: `${name}.json`, data: Buffer.from(JSON.stringify(toRows(records, false), null, 2), 'utf-8') });
+        continue;
+      }
+      const rows = toRows(records, true);
+      const columns = rows.length ? Object.keys(rows[0]) : [];
+      entries.push({ name: `${name}.csv`, data: Buffer.from(sheetToCsv({ name, columns, rows: rows.map(row => columns.map(c => row[c])) }), 'utf-8') });
+    }
+    entries.unshift({ name: 'manifest.json', data: Buffer.from(JSON.stringify({ ...manifest, format, record_counts: counts }, null, 2), 'utf-8') });
+    return { archive: zip(entries), counts };
+  }
+
+  private async notifyReady(exportRow: any) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: exportRow.company_id,
+        recipient_id: exportRow.requested_by,
+        title: 'Your account export is ready',
+        message: `Your data export is ready to download until ${exportRow.expires_at.toISOString().split('T')[0]}.`,
+        notification_type: 'account_export_ready',
+        category: 'general',
+        priority: 'medium',
+        action_url: `/account-exports/${exportRow.id}`,
+        related_entity_type: 'account_export',
+        related_entity_id: exportRow.id,
+        metadata: { export_id: exportRow.id, record_counts: exportRow.record_counts },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify about account export:', error.message);
+    }
+  }
+
+  private async present(exportRow: any) {
+    const link = exportRow.status === 'ready' ? await signedLink(exportRow, undefined, LINK_TTL_SECONDS).catch(() => null) : null;
+    return {
+      id: exportRow.id,
+      company_id: exportRow.company_id,
+      format: exportRow.format,
+      status: exportRow.status,
+      record_counts: exportRow.record_counts,
+      file_name: exportRow.file_name,
+      file_size: exportRow.file_size,
+      download_url: link?.download_url || null,
+      download_url_expires_at: link?.download_url_expires_at || null,
+      error: exportRow.status === 'failed' ? exportRow.error : null,
+      attempts: exportRow.attempts,
+      created_at: exportRow.created_at,
+      completed_at: exportRow.completed_at,
+      expires_at: exportRow.expires_at,
+    };
+  }
+}
+
+export const accountExportsService = new AccountExportsService();
@@ -0,0 +1,262 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export const SEARCH_TYPES = ['agencies', 'users', 'properties', 'invoices'] as const;
+export type SearchType = typeof SEARCH_TYPES[number];
+
+const MIN_QUERY_LENGTH = 2;
+const DEFAULT_LIMIT = 10;
+const MAX_LIMIT = 50;
+const UUID_PATTERN = /^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/i;
+
+export interface AdminSearchOptions {
+  q?: string;
+  types?: string[];
+  limit?: number;
+}
+
+/**
+ * One search box for support staff across every company: agencies, users, properties and
+ * invoices, with a count per type so the client can show facets.
+ */
+export class AdminSearchService {
+  private prisma = getPrisma();
+
+  async search(user: JWTClaims, options: AdminSearchOptions) {
+    if (user.role !== 'super_admin') {
+      throw new Error('insufficient permissions to search the platform');
+    }
+    const q = (options.q || '').trim();
+    if (q.length < MIN_QUERY_LENGTH) {
+      throw new Error(`search query must be at least ${MIN_QUERY_LENGTH} characters`);
+    }
+    const unknown = (options.types || []).filter(type => !SEARCH_TYPES.includes(type as SearchType));
+    if (unknown.length > 0) {
+      throw new Error(`invalid search type: ${unknown.join(', ')} (expected ${SEARCH_TYPES.join(', ')})`);
+    }
+    const types = options.types?.length ? (options.types as SearchType[]) : [...SEARCH_TYPES];
+    const limit = Math.min(MAX_LIMIT, Math.max(1, options.limit || DEFAULT_LIMIT));
+    const terms = this.termsFor(q);
+
+    const searches: Record<SearchType, () => Promise<{ total: number; items: any[] }>> = {
+      agencies: () => this.searchAgencies(terms, limit),
+      users: () => this.searchUsers(terms, limit),
+      properties: () => this.searchProperties(terms, limit),
+      invoices: () => this.searchInvoices(terms, limit),
+    };
+    const found = await Promise.all(types.map(type => searches[type]()));
+
+    const results: Partial<Record<SearchType, any[]>> = {};
+    const facets: Partial<Record<SearchType, number>> = {};
+    types.forEach((type, i) => {
+      results[type] = found[i].items;
+      facets[type] = found[i].total;
+    });
+
+    return {
+      query: q,
+      types,
+      total: Object.values(facets).reduce((sum, count) => sum + (count || 0), 0),
+      facets,
+      results,
+    };
+  }
+
+  private async searchAgencies(terms: SearchTerms, limit: number) {
+    const where: Prisma.AgencyWhereInput = {
+      OR: [
+        ...(terms.id ? [{ id: terms.id }] : []),
+        { name: { contains: terms.text, mode: 'insensitive' } },
+        { email: { contains: terms.text, mode: 'insensitive' } },
+        ...(terms.phone ? [{ phone_number: { contains: terms.phone } }] : []),
+      ],
+    };
+    const [total, agencies] = await Promise.all([
+      this.prisma.agency.count({ where }),
+      this.prisma.agency.findMany({
+        where,
+        take: limit,
+        orderBy: { created_at: 'desc' },
+        select: { id: true, company_id: true, name: true, email: true, phone_number: true, status: true, created_at: true },
+      }),
+    ]);
+    return {
+      total,
+      items: agencies.map(agency => ({
+        type: 'agency',
+        id: agency.id,
+        title: agency.name,
+        subtitle: [agency.email, agency.phone_number].filter(Boolean).join(' · '),
+        status: agency.status,
+        company_id: agency.company_id,
+        created_at: agency.created_at,
+      })),
+    };
+  }
+
+  private async searchUsers(terms: SearchTerms, limit: number) {
+    const [first, ...rest] = terms.text.split(/\s+/);
+    const where: Prisma.UserWhereInput = {
+      OR: [
+        ...(terms.id ? [{ id: terms.id }] : []),
+        { email: { contains: terms.text, mode: 'insensitive' } },
+        { first_name: { contains: terms.text, mode: 'insensitive' } },
+        { last_name: { contains: terms.text, mode: 'insensitive' } },
+        // "Jane Wanjiku" matches on first and last name together
+        ...(rest.length > 0 ? [{
+          first_name: { contains: first, mode: 'insensitive' as const },
+          last_name: { contains: rest.join(' '), mode: 'insensitive' as const },
+        }] : []),
+        ...(terms.phone ? [{ phone_number: { contains: terms.phone } }] : []),
+      ],
+    };
+    const [total, users] = await Promise.all([
+      this.prisma.user.count({ where }),
+      this.prisma.user.findMany({
+        where,
+        take: limit,
+        orderBy: { created_at: 'desc' },
+        select: {
+          id: true,
+          first_name: true,
+          last_name: true,
+          email: true,
+          phone_number: true,
+          role: true,
+          status: true,
+          company_id: true,
+          agency_id: true,
+          created_at: true,
+        },
+      }),
+    ]);
+    return {
+      total,
+      items: users.map(user => ({
+        type: 'user',
+        id: user.id,
+        title: `${user.first_name} ${user.last_name}`.trim(),
+        subtitle: [user.email, user.phone_number].filter(Boolean).join(' · '),
+        role: user.role,
+        status: user.status,
+        company_id: user.company_id,
+        agency_id: user.agency_id,
+        created_at: user.created_at,
+      })),
+    };
+  }
+
+  private async searchProperties(terms: SearchTerms, limit: number) {
+    const where: Prisma.PropertyWhereInput = {
+      OR: [
+        ...(terms.id ? [{ id: terms.id }] : []),
+        { name: { contains: terms.text, mode: 'insensitive' } },
+        { street: { contains: terms.text, mode: 'insensitive' } },
+        { city: { contains: terms.text, mode: 'insensitive' } },
+        { county: { contains: terms.text, mode: 'insensitive' } },
+      ],
+    };
+    const [total, properties] = await Promise.all([
+      this.prisma.property.count({ where }),
+      this.prisma.property.findMany({
+        where,
+        take: limit,
+        orderBy: { created_at: 'desc' },
+        select: {
+          id: true,
+          name: true,
+          street: true,
+          city: true,
+          status: true,
+          company_id: true,
+          agency_id: true,
+          owner: { select: { id: true, first_name: true, last_name: true } },
+          created_at: true,
+        },
+      }),
+    ]);
+    return {
+      total,
+      items: properties.map(property => ({
+        type: 'property',
+        id: property.id,
+        title: property.name,
+        subtitle: [property.street, property.city].filter(Boolean).join(', '),
+        status: property.status,
+        company_id: property.company_id,
+        agency_id: property.agency_id,
+        owner: property.owner ? { id: property.owner.id, name: `${property.owner.first_name} ${property.owner.last_name}`.trim() } : null,
+        created_at: property.created_at,
+      })),
+    };
+  }
+
+  private async searchInvoices(terms: SearchTerms, limit: number) {
+    const where: Prisma.InvoiceWhereInput = {
+      OR: [
+        ...(terms.id ? [{ id: terms.id }] : []),
+        { invoice_number: { contains: terms.text, mode: 'insensitive' } },
+        { recipient: { email: { contains: terms.text, mode: 'insensitive' } } },
+        ...(terms.phone ? [{ recipient: { phone_number: { contains: terms.phone } } }] : []),
+      ],
+    };
+    const [total, invoices] = await Promise.all([
+      this.prisma.invoice.count({ where }),
+      this.prisma.invoice.findMany({
+        where,
+        take: limit,
+        orderBy: { created_at: 'desc' },
+        select: {
+          id: true,
+          invoice_number: true,
+          total_amount: true,
+          status: true,
+          due_date: true,
+          company_id: true,
+          recipient: { select: { id: true, first_name: true, last_name: true } },
+          property: { select: { id: true, name: true } },
+          created_at: true,
+        },
+      }),
+    ]);
+    return {
+      total,
+      items: invoices.map(invoice => ({
+        type: 'invoice',
+        id: invoice.id,
+        title: invoice.invoice_number,
+        subtitle: [
+          `${invoice.recipient.first_name} ${invoice.recipient.last_name}`.trim(),
+          invoice.property?.name,
+        ].filter(Boolean).join(' · '),
+        status: invoice.status,
+        total_amount: Number(invoice.total_amount),
+        due_date: invoice.due_date,
+        company_id: invoice.company_id,
+        created_at: invoice.created_at,
+      })),
+    };
+  }
+
+  /**
+   * The query as text, as an id when it is one, and as a phone fragment when it is mostly digits.
+   * Phones are stored as 07..., 2547... and +254 7..., so the fragment drops the leading 0 or 254.
+   */
+  private termsFor(q: string): SearchTerms {
+    const digits = q.replace(/[\s()+-]/g, '');
+    let phone: string | null = null;
+    if (/^\d{3,}$/.test(digits)) {
+      phone = digits.startsWith('254') ? digits.slice(3) : digits.startsWith('0') ? digits.slice(1) : digits;
+    }
+    return { text: q, id: UUID_PATTERN.test(q) ? q : null, phone: phone || null };
+  }
+}
+
+interface SearchTerms {
+  text: string;
+  id: string | null;
+  phone: string | null;
+}
+
+export const adminSearchService = new AdminSearchService();
@@ -0,0 +1,500 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+interface AgencyFilters {
+  status?: string;
+  search?: string;
+  company_id?: string;
+  limit?: number;
+  offset?: number;
+}
+
+interface AgencyInput {
+  name?: string;
+  email?: string;
+  phone_number?: string | null;
+  address?: string | null;
+  company_id?: string;
+  status?: string;
+}
+
+// Statuses an agency can be created or edited into; suspension goes through suspend()
+const EDITABLE_STATUSES = ['active', 'inactive', 'pending', 'pending_setup'];
+const AGENCY_STATUSES = [...EDITABLE_STATUSES, 'suspended'];
+const MAX_LIMIT = 100;
+const EMAIL_PATTERN = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
+// Suspension checks run on every request from agency users, so an agency's status is held briefly
+const SUSPENDED_CACHE_MS = 60 * 1000;
+
+/**
+ * Properties whose vacancies can be listed publicly: the managing agency, if any, must not be
+ * suspended or deactivated
+ */
+export const listedPropertyWhere: Prisma.PropertyWhereInput = {
+  OR: [{ agency_id: null }, { agency: { status: { notIn: ['suspended', 'inactive'] } } }],
+};
+
+const agencyInclude = {
+  company: { select: { id: true, name: true } },
+  _count: { select: { properties: true, users: true } },
+} satisfies Prisma.AgencyInclude;
+
+type AgencyWithCounts = Prisma.AgencyGetPayload<{ include: typeof agencyInclude }>;
+
+const present = ({ _count, company, ...agency }: AgencyWithCounts) => ({
+  ...agency,
+  company_id: agency.company_id || null,
+  company_name: company?.name || null,
+  total_properties: _count.properties,
+  total_users: _count.users,
+});
+
+/**
+ * Agencies as super admins manage them. Suspending an agency suspends its active users (and ends
+ * their sessions), switches off the company's M-Pesa paybill integration when nobody else collects
+ * rent through it, and takes its vacancies off the public listings; reactivating restores the users and integrations that suspension affected.
+ * Tenants and landlords of the agency's properties are told either way. Every status change is
+ * kept with its reason.
+ */
+export class AgenciesService {
+  private prisma = getPrisma();
+  private suspendedCache = new Map<string, { suspended: boolean; at: number }>();
+
+  async list(filters: AgencyFilters = {}) {
+    if (filters.status && filters.status !== 'all' && !AGENCY_STATUSES.includes(filters.status)) {
+      throw new Error(`status must be one of: ${AGENCY_STATUSES.join(', ')}`);
+    }
+    const search = filters.search?.trim();
+    const where: Prisma.AgencyWhereInput = {
+      ...(filters.status && filters.status !== 'all' && { status: filters.status as any }),
+      ...(filters.company_id && { company_id: filters.company_id }),
+      ...(search && {
+        OR: [
+          { name: { contains: search, mode: 'insensitive' } },
+          { email: { contains: search, mode: 'insensitive' } },
+          { phone_number: { contains: search } },
+          { address: { contains: search, mode: 'insensitive' } },
+          { company: { name: { contains: search, mode: 'insensitive' } } },
+        ],
+      }),
+    };
+    const limit = filters.limit !== undefined && !isNaN(filters.limit) ? Math.min(Math.max(filters.limit, 1), MAX_LIMIT) : undefined;
+    const offset = Math.max(0, Number(filters.offset) || 0);
+
+    const [agencies, total] = await Promise.all([
+      this.prisma.agency.findMany({
+        where,
+        include: agencyInclude,
+        orderBy: { created_at: 'desc' },
+        ...(limit !== undefined && { take: limit, skip: offset }),
+      }),
+      this.prisma.agency.count({ where }),
+    ]);
+
+    return { agencies: agencies.map(present), total };
+  }
+
+  async get(id: string) {
+    const agency = await this.prisma.agency.findUnique({ where: { id }, include: agencyInclude });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    return { ...present(agency), ...(await this.getStats(id)) };
+  }
+
+  /**
+   * Counts across the agency's properties and people, and the rent roll of its occupied units
+   */
+  async getStats(id: string) {
+    const [properties, units, users, landlords, occupiedRent] = await Promise.all([
+      this.prisma.property.groupBy({ by: ['status'], where: { agency_id: id }, _count: { _all: true } }),
+      this.prisma.unit.groupBy({ by: ['status'], where: { property: { agency_id: id } }, _count: { _all: true } }),
+      this.prisma.user.groupBy({ by: ['role', 'status'], where: { agency_id: id }, _count: { _all: true } }),
+      this.prisma.property.findMany({ where: { agency_id: id }, distinct: ['owner_id'], select: { owner_id: true } }),
+      this.prisma.unit.aggregate({
+        where: { status: { in: ['occupied', 'arrears'] }, property: { agency_id: id } },
+        _sum: { rent_amount: true },
+      }),
+    ]);
+
+    const count = <T extends { _count: { _all: number } }>(groups: T[], match: (group: T) => boolean = () => true) =>
+      groups.filter(match).reduce((sum, group) => sum + group._count._all, 0);
+    const totalUnits = count(units);
+    const occupiedUnits = count(units, g => g.status === 'occupied' || g.status === 'arrears');
+
+    return {
+      total_properties: count(properties),
+      active_properties: count(properties, g => g.status === 'active'),
+      total_units: totalUnits,
+      occupied_units: occupiedUnits,
+      vacant_units: count(units, g => g.status === 'vacant'),
+      occupancy_rate: totalUnits > 0 ? Math.round((occupiedUnits / totalUnits) * 10000) / 100 : 0,
+      total_landlords: landlords.length,
+      total_agents: count(users, g => g.role === 'agent'),
+      total_users: count(users),
+      active_users: count(users, g => g.status === 'active'),
+      suspended_users: count(users, g => g.status === 'suspended'),
+      monthly_revenue: Number(occupiedRent._sum.rent_amount || 0),
+    };
+  }
+
+  async create(input: AgencyInput, actor: JWTClaims) {
+    const name = input.name?.trim();
+    const email = input.email?.trim().toLowerCase();
+    if (!name) {
+      throw new Error('name is required');
+    }
+    if (!email || !EMAIL_PATTERN.test(email)) {
+      throw new Error('email must be a valid email address');
+    }
+    if (!input.company_id) {
+      throw new Error('company_id is required');
+    }
+    const status = input.status || 'pending';
+    if (!EDITABLE_STATUSES.includes(status)) {
+      throw new Error(`status must be one of: ${EDITABLE_STATUSES.join(', ')}`);
+    }
+    const company = await this.prisma.company.findUnique({ where: { id: input.company_id }, select: { id: true } });
+    if (!company) {
+      throw new Error('company not found');
+    }
+    await this.assertEmailFree(email);
+
+    const agency = await this.prisma.agency.create({
+      data: {
+        name,
+        email,
+        phone_number: input.phone_number?.trim() || null,
+        address: input.address?.trim() || null,
+        company_id: company.id,
+        status: status as any,
+        created_by: actor.user_id,
+      },
+      include: agencyInclude,
+    });
+    return present(agency);
+  }
+
+  /**
+   * Only the fields given change. A status change to or from suspended goes through suspend()
+   * and reactivate(), so the agency's users follow it.
+   */
+  async update(id: string, input: AgencyInput, actor: JWTClaims) {
+    const agency = await this.prisma.agency.findUnique({ where: { id } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    const data: Prisma.AgencyUpdateInput = {};
+    if (input.name !== undefined) {
+      if (!input.name?.trim()) throw new Error('name must not be empty');
+      data.name = input.name.trim();
+    }
+    if (input.email !== undefined) {
+      const email = input.email?.trim().toLowerCase();
+      if (!email || !EMAIL_PATTERN.test(email)) throw new Error('email must be a valid email address');
+      if (email !== agency.email) await this.assertEmailFree(email);
+      data.email = email;
+    }
+    if (input.phone_number !== undefined) data.phone_number = input.phone_number?.trim() || null;
+    if (input.address !== undefined) data.address = input.address?.trim() || null;
+
+    if (input.status !== undefined && input.status !== agency.status) {
+      if (input.status === 'suspended') {
+        throw new Error('agency must be suspended through the suspend action, with a reason');
+      }
+      if (agency.status === 'suspended') {
+        throw new Error('agency must be reactivated through the reactivate action');
+      }
+      if (!EDITABLE_STATUSES.includes(input.status)) {
+        throw new Error(`status must be one of: ${EDITABLE_STATUSES.join(', ')}`);
+      }
+      await this.setStatus(agency, input.status, null, actor);
+    }
+
+    const updated = await this.prisma.agency.update({
+      where: { id },
+      data: { ...data, updated_at: new Date() },
+      include: agencyInclude,
+    });
+    return present(updated);
+  }
+
+  async suspend(id: string, reason: string | undefined, actor: JWTClaims) {
+    if (!reason?.trim()) {
+      throw new Error('reason is required to suspend an agency');
+    }
+    const agency = await this.prisma.agency.findUnique({ where: { id } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    if (agency.status === 'suspended') {
+      throw new Error('agency is already suspended');
+    }
+    return this.setStatus(agency, 'suspended', reason.trim(), actor);
+  }
+
+  async reactivate(id: string, reason: string | undefined, actor: JWTClaims) {
+    const agency = await this.prisma.agency.findUnique({ where: { id } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    if (agency.status === 'active') {
+      throw new Error('agency is already active');
+    }
+    return this.setStatus(agency, 'active', reason?.trim() || null, actor);
+  }
+
+  async deactivate(id: string, reason: string | undefined, actor: JWTClaims) {
+    const agency = await this.prisma.agency.findUnique({ where: { id } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    if (agency.status === 'inactive') {
+      throw new Error('agency is already inactive');
+    }
+    return this.setStatus(agency, 'inactive', reason?.trim() || null, actor);
+  }
+
+  async getStatusHistory(id: string) {
+    const agency = await this.prisma.agency.findUnique({
+      where: { id },
+      select: { id: true, name: true, status: true, suspended_at: true, suspension_reason: true },
+    });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    const changes = await this.prisma.agencyStatusChange.findMany({
+      where: { agency_id: id },
+      include: { changer: { select: { id: true, first_name: true, last_name: true, email: true } } },
+      orderBy: { created_at: 'desc' },
+    });
+    return {
+      agency,
+      changes: changes.map(({ changer, affected_users, disabled_integrations, ...change }) => ({
+        ...change,
+        affected_user_count: Array.isArray(affected_users) ? affected_users.length : 0,
+        disabled_integration_count: Array.isArray(disabled_integrations) ? disabled_integrations.length : 0,
+        changed_by_name: changer ? `${changer.first_name} ${changer.last_name}`.trim() : null,
+        changed_by_email: changer?.email || null,
+      })),
+    };
+  }
+
+  /**
+   * An agency that still manages properties can't be deleted: they must be moved or removed first.
+   * Its users lose their agency and are deactivated, since their accounts belong to it.
+   */
+  async delete(id: string) {
+    const agency = await this.prisma.agency.findUnique({ where: { id }, include: agencyInclude });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    if (agency._count.properties > 0) {
+      throw new Error(`agency still manages ${agency._count.properties} properties; they must be reassigned before it is deleted`);
+    }
+
+    const users = await this.prisma.user.findMany({ where: { agency_id: id }, select: { id: true } });
+    const userIds = users.map(u => u.id);
+    await this.prisma.$transaction([
+      this.prisma.user.updateMany({
+        where: { id: { in: userIds } },
+        data: { agency_id: null, status: 'inactive', updated_at: new Date() },
+      }),
+      this.prisma.refreshToken.updateMany({
+        where: { user_id: { in: userIds }, is_revoked: false },
+        data: { is_revoked: true, revoked_at: new Date() },
+      }),
+      this.prisma.agency.delete({ where: { id } }),
+    ]);
+    return { id, deactivated_users: userIds.length };
+  }
+
+  private async assertEmailFree(email: string) {
+    const existing = await this.prisma.agency.findUnique({ where: { email }, select: { id: true } });
+    if (existing) {
+      throw new Error('an agency with this email already exists');
+    }
+  }
+
+  /**
+   * Move the agency to a new status with its users and integrations: suspending or deactivating
+   * takes down the users and paybill settings that are active now (the paybill belongs to the
+   * company, so only when the agency is its only operator), and coming back to active
+   * restores the ones the last suspension or deactivation took down (users suspended or paybills
+   * switched off on their own stay that way). It all commits together or not at all.
+   */
+  private async setStatus(agency: { id: string; status: string; company_id: string }, status: string, reason: string | null, actor: JWTClaims) {
+    const now = new Date();
+    let affected: string[] = [];
+    let integrations: string[] = [];
+    const updates: Prisma.PrismaPromise<any>[] = [];
+    const takingDown = status === 'suspended' || status === 'inactive';
+    const restoring = status === 'active' && (agency.status === 'suspended' || agency.status === 'inactive');
+
+    if (takingDown) {
+      const [users, otherOperators, paybills] = await Promise.all([
+        this.prisma.user.findMany({ where: { agency_id: agency.id, status: 'active' }, select: { id: true } }),
+        this.countOtherOperators(agency),
+        this.prisma.paybillSettings.findMany({ where: { company_id: agency.company_id, is_active: true }, select: { id: true } }),
+      ]);
+      affected = users.map(u => u.id);
+      integrations = otherOperators === 0 ? paybills.map(p => p.id) : [];
+      updates.push(
+        this.prisma.user.updateMany({ where: { id: { in: affected } }, data: { status: status as any, updated_at: now } }),
+        this.prisma.refreshToken.updateMany({
+          where: { user_id: { in: affected }, is_revoked: false },
+          data: { is_revoked: true, revoked_at: now },
+        }),
+        // M-Pesa callbacks only match active settings, so payments stop reaching the agency
+        this.prisma.paybillSettings.updateMany({ where: { id: { in: integrations } }, data: { is_active: false, updated_at: now } }),
+      );
+    } else if (restoring) {
+      const takenDown = await this.prisma.agencyStatusChange.findFirst({
+        where: { agency_id: agency.id, to_status: agency.status },
+        orderBy: { created_at: 'desc' },
+      });
+      const userIds = Array.isArray(takenDown?.affected_users) ? (takenDown!.affected_users as string[]) : [];
+      const paybillIds = Array.isArray(takenDown?.disabled_integrations) ? (takenDown!.disabled_integrations as string[]) : [];
+      const [users, paybills] = await Promise.all([
+        this.prisma.user.findMany({
+          where: { id: { in: userIds }, agency_id: agency.id, status: agency.status as any },
+          select: { id: true },
+        }),
+        this.prisma.paybillSettings.findMany({
+          where: { id: { in: paybillIds }, company_id: agency.company_id, is_active: false },
+          select: { id: true },
+        }),
+      ]);
+      affected = users.map(u => u.id);
+      integrations = paybills.map(p => p.id);
+      updates.push(
+        this.prisma.user.updateMany({ where: { id: { in: affected } }, data: { status: 'active', updated_at: now } }),
+        this.prisma.paybillSettings.updateMany({ where: { id: { in: integrations } }, data: { is_active: true, updated_at: now } }),
+      );
+    }
+
+    const [updated] = await this.prisma.$transaction([
+      this.prisma.agency.update({
+        where: { id: agency.id },
+        data: {
+          status: status as any,
+          suspended_at: status === 'suspended' ? now : null,
+          suspension_reason: status === 'suspended' ? reason : null,
+          updated_at: now,
+        },
+        include: agencyInclude,
+      }),
+      ...updates,
+      this.prisma.agencyStatusChange.create({
+        data: {
+          agency_id: agency.id,
+          from_status: agency.status,
+          to_status: status,
+          reason,
+          changed_by: actor.user_id,
+          affected_users: affected,
+          disabled_integrations: takingDown ? integrations : [],
+        },
+      }),
+    ]);
+    this.suspendedCache.delete(agency.id);
+
+    if (takingDown || restoring) {
+      try {
+        await this.notifyClients(agency.id, updated.name, takingDown, integrations.length > 0);
+      } catch (error: any) {
+        console.error(`❌ Failed to notify clients of agency ${agency.id} status change:`, error.message);
+      }
+    }
+
+    return {
+      agency: present(updated as AgencyWithCounts),
+      affected_users: affected.length,
+      [takingDown ? 'disabled_integrations' : 'restored_integrations']: integrations.length,
+    };
+  }
+
+  /**
+   * Other agencies and independent landlords still active in the agency's company, who collect
+   * rent through the same paybill
+   */
+  private async countOtherOperators(agency: { id: string; company_id: string }) {
+    const [agencies, landlords] = await Promise.all([
+      this.prisma.agency.count({ where: { company_id: agency.company_id, id: { not: agency.id }, status: 'active' } }),
+      this.prisma.user.count({ where: { company_id: agency.company_id, role: 'landlord', agency_id: null, status: 'active' } }),
+    ]);
+    return agencies + landlords;
+  }
+
+  /**
+   * Whether the agency is suspended or deactivated, so sessions issued before the change stop
+   * working. Checked on every request, so the answer is held briefly.
+   */
+  async isSuspended(agencyId: string) {
+    const cached = this.suspendedCache.get(agencyId);
+    if (cached && Date.now() - cached.at < SUSPENDED_CACHE_MS) {
+      return cached.suspended;
+    }
+    const agency = await this.prisma.agency.findUnique({ where: { id: agencyId }, select: { status: true } });
+    const suspended = agency?.status === 'suspended' || agency?.status === 'inactive';
+    this.suspendedCache.set(agencyId, { suspended, at: Date.now() });
+    return suspended;
+  }
+
+  /**
+   * Tell the tenants living in the agency's properties, and the landlords who own them or have
+   * delegated them to it, that the agency has been taken down or is back
+   */
+  private async notifyClients(agencyId: string, agencyName: string, takenDown: boolean, paybillChanged: boolean) {
+    const { notificationsService } = await import('./notifications.service.js');
+    const [properties, delegations] = await Promise.all([
+      this.prisma.property.findMany({ where: { agency_id: agencyId }, select: { id: true, owner_id: true } }),
+      this.prisma.propertyDelegation.findMany({
+        where: { agency_id: agencyId, status: { in: ['scheduled', 'active'] } },
+        select: { landlord_id: true },
+      }),
+    ]);
+    const landlordIds = [...new Set([...properties.map(p => p.owner_id), ...delegations.map(d => d.landlord_id)])];
+    const recipients = await this.prisma.user.findMany({
+      where: {
+        status: 'active',
+        company_id: { not: null },
+        OR: [
+          { id: { in: landlordIds }, role: 'landlord' },
+          { role: 'tenant', tenant_profile: { current_property_id: { in: properties.map(p => p.id) } } },
+        ],
+      },
+      select: { id: true, role: true, company_id: true },
+    });
+
+    const priority = takenDown ? 'high' : 'medium';
+    for (const recipient of recipients) {
+      const tenant = recipient.role === 'tenant';
+      const message = takenDown
+        ? tenant
+          ? paybillChanged
+            ? `${agencyName}, the agency managing your home, has been suspended on LetRents. Do not send rent to the agency's paybill until you hear from your landlord.`
+            : `${agencyName}, the agency managing your home, has been suspended on LetRents. Your landlord will be in touch about who manages your home.`
+          : `${agencyName} has been suspended on LetRents. Its staff can no longer act on your properties${paybillChanged ? ' and rent collection through its paybill has stopped' : ''}.`
+        : tenant
+          ? `${agencyName}, the agency managing your home, is active on LetRents again. You can pay rent as before.`
+          : `${agencyName} is active on LetRents again and can resume managing your properties.`;
+      const channels = await notificationsService.resolveChannels(recipient.id, 'agency_status', ['email'], 'general', priority);
+      await notificationsService.notify({
+        company_id: recipient.company_id!,
+        recipient_id: recipient.id,
+        title: takenDown ? `${agencyName} has been suspended` : `${agencyName} is active again`,
+        message,
+        notification_type: 'agency_status',
+        category: 'general',
+        priority,
+        related_entity_type: 'agency',
+        related_entity_id: agencyId,
+        metadata: { agency_id: agencyId, suspended: takenDown },
+      }, channels);
+    }
+  }
+}
+
+export const agenciesService = new AgenciesService();
@@ -0,0 +1,238 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { imagekitService } from './imagekit.service.js';
+
+const BRANDING_ROLES = ['super_admin', 'agency_admin'];
+const LOGO_MIME_TYPES = ['image/png', 'image/jpeg', 'image/webp', 'image/svg+xml'];
+export const LOGO_MAX_BYTES = 2 * 1024 * 1024;
+const HEX_COLOR = /^#[0-9a-f]{6}$/i;
+const EMAIL_PATTERN = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
+// Alphanumeric SMS sender ids are at most 11 characters, letters, digits and spaces
+const SMS_SENDER_PATTERN = /^[a-z0-9 ]{3,11}$/i;
+// Every PDF, email and SMS looks its sender up, so branding is held briefly
+const BRANDING_CACHE_MS = 5 * 60 * 1000;
+
+export interface AgencyBrandingFile {
+  buffer: Buffer;
+  originalname: string;
+  mimetype: string;
+  size: number;
+}
+
+export interface AgencyBrandingInput {
+  logo_url?: string | null;
+  primary_color?: string | null;
+  secondary_color?: string | null;
+  sender_name?: string | null;
+  sender_email?: string | null;
+  sms_sender_name?: string | null;
+  invoice_footer?: string | null;
+}
+
+/**
+ * An agency's branding as documents, emails and listings use it; null fields mean "use the
+ * default"
+ */
+export interface AgencyBrand {
+  agency_id: string;
+  agency_name: string;
+  logo_url: string | null;
+  primary_color: string | null;
+  secondary_color: string | null;
+  sender_name: string | null;
+  sender_email: string | null;
+  sms_sender_name: string | null;
+  invoice_footer: string | null;
+  updated_at: Date | null;
+}
+
+const FIELDS = ['logo_url', 'primary_color', 'secondary_color', 'sender_name', 'sender_email', 'sms_sender_name', 'invoice_footer'] as const;
+
+/**
+ * White-labelling for agencies: the logo, colours, sender names and invoice footer their
+ * tenants see on PDFs, emails, SMS and the public listings
+ */
+export class AgencyBrandingService {
+  private prisma = getPrisma();
+  private cache = new Map<string, { brand: AgencyBrand | null; at: number }>();
+
+  async get(user: JWTClaims, agencyId?: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    return (await this.forAgency(agency.id))!;
+  }
+
+  async update(user: JWTClaims, agencyId: string | undefined, input: AgencyBrandingInput) {
+    const agency = await this.agencyFor(user, agencyId);
+    const data: Record<string, string | null> = {};
+    for (const field of FIELDS) {
+      if (input[field] === undefined) continue;
+      data[field] = input[field] === null ? null : String(input[field]).trim() || null;
+    }
+    this.validate(data);
+
+    const existing = await this.prisma.agencyBranding.findUnique({ where: { agency_id: agency.id } });
+    // A logo URL typed in replaces an uploaded logo, so the uploaded file goes
+    const replacesUpload = data.logo_url !== undefined && existing?.logo_file_id && data.logo_url !== existing.logo_url;
+    const now = new Date();
+    await this.prisma.agencyBranding.upsert({
+      where: { agency_id: agency.id },
+      create: { agency_id: agency.id, ...data, updated_by: user.user_id },
+      update: { ...data, ...(replacesUpload && { logo_file_id: null }), updated_by: user.user_id, updated_at: now },
+    });
+    if (replacesUpload) {
+      await this.deleteLogoFile(existing!.logo_file_id!);
+    }
+    this.cache.delete(agency.id);
+    return (await this.forAgency(agency.id))!;
+  }
+
+  /**
+   * Upload a logo (PNG, JPEG, WebP or SVG, at most 2 MB) and make it the agency's logo
+   */
+  async uploadLogo(user: JWTClaims, agencyId: string | undefined, file: AgencyBrandingFile | undefined) {
+    const agency = await this.agencyFor(user, agencyId);
+    if (!file) {
+      throw new Error('logo file is required');
+    }
+    if (!LOGO_MIME_TYPES.includes(file.mimetype)) {
+      throw new Error('logo must be a PNG, JPEG, WebP or SVG image');
+    }
+    if (file.size > LOGO_MAX_BYTES) {
+      throw new Error('logo must be at most 2 MB');
+    }
+    if (file.mimetype === 'image/svg+xml' && /<script|on\w+\s*=|javascript:/i.test(file.buffer.toString('utf8'))) {
+      throw new Error('logo must not contain scripts');
+    }
+
+    const existing = await this.prisma.agencyBranding.findUnique({ where: { agency_id: agency.id } });
+    const uploaded = await imagekitService.uploadFile(file.buffer, `logo-${agency.id}-${Date.now()}`, `agencies/${agency.id}/branding`);
+    const now = new Date();
+    await this.prisma.agencyBranding.upsert({
+      where: { agency_id: agency.id },
+      create: { agency_id: agency.id, logo_url: uploaded.url, logo_file_id: uploaded.fileId, updated_by: user.user_id },
+      update: { logo_url: uploaded.url, logo_file_id: uploaded.fileId, updated_by: user.user_id, updated_at: now },
+    });
+    if (existing?.logo_file_id) {
+      await this.deleteLogoFile(existing.logo_file_id);
+    }
+    this.cache.delete(agency.id);
+    return (await this.forAgency(agency.id))!;
+  }
+
+  async removeLogo(user: JWTClaims, agencyId?: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    const existing = await this.prisma.agencyBranding.findUnique({ where: { agency_id: agency.id } });
+    if (!existing?.logo_url) {
+      throw new Error('agency has no logo');
+    }
+    await this.prisma.agencyBranding.update({
+      where: { agency_id: agency.id },
+      data: { logo_url: null, logo_file_id: null, updated_by: user.user_id, updated_at: new Date() },
+    });
+    if (existing.logo_file_id) {
+      await this.deleteLogoFile(existing.logo_file_id);
+    }
+    this.cache.delete(agency.id);
+    return (await this.forAgency(agency.id))!;
+  }
+
+  /**
+   * The agency's branding with its name; null when the agency does not exist
+   */
+  async forAgency(agencyId: string): Promise<AgencyBrand | null> {
+    const cached = this.cache.get(agencyId);
+    if (cached && Date.now() - cached.at < BRANDING_CACHE_MS) {
+      return cached.brand;
+    }
+    const agency = await this.prisma.agency.findUnique({
+      where: { id: agencyId },
+      select: { id: true, name: true, branding: true },
+    });
+    const brand: AgencyBrand | null = agency
+      ? {
+          agency_id: agency.id,
+          agency_name: agency.name,
+          logo_url: agency.branding?.logo_url || null,
+          primary_color: agency.branding?.primary_color || null,
+          secondary_color: agency.branding?.secondary_color || null,
+          sender_name: agency.branding?.sender_name || null,
+          sender_email: agency.branding?.sender_email || null,
+          sms_sender_name: agency.branding?.sms_sender_name || null,
+          invoice_footer: agency.branding?.invoice_footer || null,
+          updated_at: agency.branding?.updated_at || null,
+        }
+      : null;
+    this.cache.set(agencyId, { brand, at: Date.now() });
+    return brand;
+  }
+
+  /**
+   * Branding for something sent on behalf of a company: the agency managing the property when
+   * there is one, otherwise the company's own agency. Null when neither has set any branding.
+   */
+  async resolve(options: { agencyId?: string | null; companyId?: string | null }): Promise<AgencyBrand | null> {
+    let agencyId = options.agencyId || null;
+    if (!agencyId && options.companyId) {
+      const agency = await this.prisma.agency.findFirst({
+        where: { company_id: options.companyId },
+        orderBy: { created_at: 'asc' },
+        select: { id: true },
+      });
+      agencyId = agency?.id || null;
+    }
+    if (!agencyId) return null;
+    const brand = await this.forAgency(agencyId);
+    return brand?.updated_at ? brand : null;
+  }
+
+  private validate(data: Record<string, string | null>) {
+    if (data.logo_url && !/^https:\/\//i.test(data.logo_url)) {
+      throw new Error('logo_url must be an https URL');
+    }
+    for (const field of ['primary_color', 'secondary_color']) {
+      if (data[field] && !HEX_COLOR.test(data[field]!)) {
+        throw new Error(`${field} must be a hex colour such as #2563eb`);
+      }
+    }
+    if (data.sender_name && data.sender_name.length > 100) {
+      throw new Error('sender_name must be at most 100 characters');
+    }
+    if (data.sender_email && !EMAIL_PATTERN.test(data.sender_email)) {
+      throw new Error('sender_email must be a valid email address');
+    }
+    if (data.sms_sender_name && !SMS_SENDER_PATTERN.test(data.sms_sender_name)) {
+      throw new Error('sms_sender_name must be 3 to 11 letters, digits or spaces');
+    }
+    if (data.invoice_footer && data.invoice_footer.length > 500) {
+      throw new Error('invoice_footer must be at most 500 characters');
+    }
+  }
+
+  private async deleteLogoFile(fileId: string) {
+    try {
+      await imagekitService.deleteFile(fileId);
+    } catch (error: any) {
+      console.error(`❌ Failed to delete replaced agency logo ${fileId}:`, error.message);
+    }
+  }
+
+  private async agencyFor(user: JWTClaims, agencyId?: string) {
+    if (!BRANDING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage agency branding');
+    }
+    const id = user.role === 'super_admin' ? agencyId : user.agency_id;
+    if (!id) {
+      throw new Error(user.role === 'super_admin' ? 'agency_id is required' : 'user must be associated with an agency');
+    }
+    if (user.role === 'agency_admin' && agencyId && agencyId !== user.agency_id) {
+      throw new Error('insufficient permissions to manage another agency\'s branding');
+    }
+    const agency = await this.prisma.agency.findUnique({ where: { id }, select: { id: true } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    return agency;
+  }
+}
+
+export const agencyBrandingService = new AgencyBrandingService();
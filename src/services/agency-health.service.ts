@@ -0,0 +1,253 @@
+import { getPrisma } from '../config/prisma.js';
+
+const WINDOW_DAYS = 90;
+
+/**
+ * Share of the score each signal carries. Signals an agency has no data for (no invoices due,
+ * no maintenance requests, no leases) are left out and the rest are scaled up.
+ */
+export const HEALTH_WEIGHTS = {
+  collection: 0.3,
+  occupancy: 0.25,
+  complaints: 0.15,
+  response_time: 0.15,
+  churn: 0.15,
+};
+
+type HealthComponent = keyof typeof HEALTH_WEIGHTS;
+
+export interface AgencySignals {
+  invoiced: number;
+  collected: number;
+  units: number;
+  occupied_units: number;
+  requests: number;
+  complaints: number;
+  median_response_hours: number | null;
+  leases_at_start: number;
+  leases_ended: number;
+}
+
+const clamp = (n: number) => Math.max(0, Math.min(100, n));
+const round = (n: number) => Math.round(n * 100) / 100;
+
+/**
+ * Turn raw signals into 0-100 component scores and a weighted total:
+ * - collection: share of invoiced rent that was paid
+ * - occupancy: share of units occupied
+ * - complaints: escalated or poorly rated requests per 10 units; 5 or more scores 0
+ * - response_time: median hours to first response; 4h or less scores 100, 72h or more 0
+ * - churn: leases ended without renewal as a share of those running at the window start; 40% or more scores 0
+ */
+export function scoreAgency(signals: AgencySignals) {
+  const complaintsPer10 = signals.units > 0 ? (signals.complaints / signals.units) * 10 : 0;
+  const churnPct = signals.leases_at_start > 0 ? (signals.leases_ended / signals.leases_at_start) * 100 : 0;
+  const hours = signals.median_response_hours;
+
+  const components: Record<HealthComponent, { value: number | null; score: number; weight: number; available: boolean }> = {
+    collection: {
+      value: signals.invoiced > 0 ? round((signals.collected / signals.invoiced) * 100) : null,
+      score: signals.invoiced > 0 ? clamp((signals.collected / signals.invoiced) * 100) : 0,
+      weight: HEALTH_WEIGHTS.collection,
+      available: signals.invoiced > 0,
+    },
+    occupancy: {
+      value: signals.units > 0 ? round((signals.occupied_units / signals.units) * 100) : null,
+      score: signals.units > 0 ? clamp((signals.occupied_units / signals.units) * 100) : 0,
+      weight: HEALTH_WEIGHTS.occupancy,
+      available: signals.units > 0,
+    },
+    complaints: {
+      value: signals.units > 0 ? round(complaintsPer10) : null,
+      score: clamp(100 - complaintsPer10 * 20),
+      weight: HEALTH_WEIGHTS.complaints,
+      available: signals.units > 0,
+    },
+    response_time: {
+      value: hours !== null ? round(hours) : null,
+      score: hours !== null ? clamp(100 - (Math.max(0, hours - 4) / 68) * 100) : 0,
+      weight: HEALTH_WEIGHTS.response_time,
+      available: hours !== null,
+    },
+    churn: {
+      value: signals.leases_at_start > 0 ? round(churnPct) : null,
+      score: clamp(100 - churnPct * 2.5),
+      weight: HEALTH_WEIGHTS.churn,
+      available: signals.leases_at_start > 0,
+    },
+  };
+
+  const available = Object.values(components).filter(c => c.available);
+  const totalWeight = available.reduce((acc, c) => acc + c.weight, 0);
+  const score = totalWeight > 0 ? round(available.reduce((acc, c) => acc + c.score * c.weight, 0) / totalWeight) : 0;
+  for (const component of Object.values(components)) {
+    component.score = round(component.score);
+  }
+  return { score, grade: gradeFor(score), components };
+}
+
+export function gradeFor(score: number) {
+  return score >= 85 ? 'A' : score >= 70 ? 'B' : score >= 55 ? 'C' : score >= 40 ? 'D' : 'E';
+}
+
+/**
+ * Agency health scores, computed on a schedule over the last 90 days and kept as history
+ */
+export class AgencyHealthService {
+  private prisma = getPrisma();
+
+  /**
+   * Score every agency and store the results
+   */
+  async computeAll(now = new Date()) {
+    const windowStart = new Date(now.getTime() - WINDOW_DAYS * 24 * 60 * 60 * 1000);
+    const agencies = await this.prisma.agency.findMany({ select: { id: true, company_id: true } });
+    if (agencies.length === 0) return { scored: 0 };
+
+    const signals = await this.collectSignals(windowStart, now);
+    await this.prisma.agencyHealthScore.createMany({
+      data: agencies.map(agency => {
+        const result = scoreAgency(signals.get(agency.id) || emptySignals());
+        return {
+          agency_id: agency.id,
+          company_id: agency.company_id,
+          score: result.score,
+          grade: result.grade,
+          components: result.components as any,
+          window_start: windowStart,
+          window_end: now,
+          computed_at: now,
+        };
+      }),
+    });
+    return { scored: agencies.length };
+  }
+
+  /**
+   * Latest score per agency, best first
+   */
+  async listLatest() {
+    const rows = await this.prisma.agencyHealthScore.findMany({
+      distinct: ['agency_id'],
+      orderBy: [{ agency_id: 'asc' }, { computed_at: 'desc' }],
+      include: { agency: { select: { id: true, name: true, email: true, status: true } } },
+    });
+    return rows
+      .map(row => ({ ...row, score: Number(row.score) }))
+      .sort((a, b) => b.score - a.score);
+  }
+
+  /**
+   * Latest breakdown for one agency with its score history
+   */
+  async getForAgency(agencyId: string, historyLimit: number = 30) {
+    const agency = await this.prisma.agency.findUnique({ where: { id: agencyId }, select: { id: true, name: true } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    const history = await this.prisma.agencyHealthScore.findMany({
+      where: { agency_id: agencyId },
+      orderBy: { computed_at: 'desc' },
+      take: Math.min(Math.max(historyLimit, 1), 365),
+    });
+    const [latest, previous] = history;
+    return {
+      agency,
+      latest: latest ? { ...latest, score: Number(latest.score) } : null,
+      change: latest && previous ? round(Number(latest.score) - Number(previous.score)) : null,
+      weights: HEALTH_WEIGHTS,
+      history: history.reverse().map(row => ({ computed_at: row.computed_at, score: Number(row.score), grade: row.grade })),
+    };
+  }
+
+  /**
+   * Raw signals for every agency in one grouped query per signal
+   */
+  private async collectSignals(start: Date, end: Date): Promise<Map<string, AgencySignals>> {
+    const [collections, units, maintenance, churn] = await Promise.all([
+      this.prisma.$queryRaw<Array<{ agency_id: string; invoiced: number; collected: number }>>`
+        SELECT p.agency_id::text AS agency_id,
+          COALESCE(SUM(i.total_amount), 0)::float AS invoiced,
+          COALESCE(SUM(i.total_amount) FILTER (WHERE i.status = 'paid'::invoice_status), 0)::float AS collected
+        FROM invoices i
+        JOIN properties p ON p.id = i.property_id
+        WHERE p.agency_id IS NOT NULL
+          AND i.status IN ('sent'::invoice_status, 'paid'::invoice_status, 'overdue'::invoice_status)
+          AND i.due_date >= ${start}::date AND i.due_date <= ${end}::date
+        GROUP BY p.agency_id
+      `,
+      this.prisma.$queryRaw<Array<{ agency_id: string; units: number; occupied_units: number }>>`
+        SELECT p.agency_id::text AS agency_id,
+          COUNT(u.id)::int AS units,
+          COUNT(u.id) FILTER (WHERE u.status = 'occupied'::unit_status)::int AS occupied_units
+        FROM units u
+        JOIN properties p ON p.id = u.property_id
+        WHERE p.agency_id IS NOT NULL
+        GROUP BY p.agency_id
+      `,
+      // Complaints are requests that were escalated or rated 1-2 by the tenant
+      this.prisma.$queryRaw<Array<{ agency_id: string; requests: number; complaints: number; median_response_hours: number | null }>>`
+        SELECT p.agency_id::text AS agency_id,
+          COUNT(m.id)::int AS requests,
+          COUNT(m.id) FILTER (WHERE m.escalated_at IS NOT NULL OR m.tenant_rating <= 2)::int AS complaints,
+          (PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM (m.first_response_at - m.created_at)) / 3600)
+            FILTER (WHERE m.first_response_at IS NOT NULL))::float AS median_response_hours
+        FROM maintenance_requests m
+        JOIN properties p ON p.id = m.property_id
+        WHERE p.agency_id IS NOT NULL
+          AND m.created_at >= ${start} AND m.created_at <= ${end}
+        GROUP BY p.agency_id
+      `,
+      // Leases running at the window start, and how many of them ended in the window without a renewal
+      this.prisma.$queryRaw<Array<{ agency_id: string; leases_at_start: number; leases_ended: number }>>`
+        SELECT p.agency_id::text AS agency_id,
+          COUNT(l.id)::int AS leases_at_start,
+          COUNT(l.id) FILTER (WHERE l.status <> 'renewed'::lease_status AND (
+            (l.terminated_at IS NOT NULL AND l.terminated_at <= ${end})
+            OR (l.move_out_date IS NOT NULL AND l.move_out_date <= ${end}::date)
+            OR (l.status = 'expired'::lease_status AND l.end_date <= ${end}::date)
+          ))::int AS leases_ended
+        FROM leases l
+        JOIN properties p ON p.id = l.property_id
+        WHERE p.agency_id IS NOT NULL
+          AND l.status IN ('active'::lease_status, 'expired'::lease_status, 'terminated'::lease_status, 'renewed'::lease_status)
+          AND l.start_date <= ${start}::date
+          AND (l.end_date >= ${start}::date OR l.status = 'active'::lease_status)
+          AND (l.terminated_at IS NULL OR l.terminated_at > ${start})
+          AND (l.move_out_date IS NULL OR l.move_out_date > ${start}::date)
+        GROUP BY p.agency_id
+      `,
+    ]);
+
+    const signals = new Map<string, AgencySignals>();
+    const entry = (agencyId: string) => {
+      if (!signals.has(agencyId)) signals.set(agencyId, emptySignals());
+      return signals.get(agencyId)!;
+    };
+    for (const row of collections) Object.assign(entry(row.agency_id), { invoiced: Number(row.invoiced), collected: Number(row.collected) });
+    for (const row of units) Object.assign(entry(row.agency_id), { units: Number(row.units), occupied_units: Number(row.occupied_units) });
+    for (const row of maintenance) {
+      Object.assign(entry(row.agency_id), {
+        requests: Number(row.requests),
+        complaints: Number(row.complaints),
+        median_response_hours: row.median_response_hours === null ? null : Number(row.median_response_hours),
+      });
+    }
+    for (const row of churn) Object.assign(entry(row.agency_id), { leases_at_start: Number(row.leases_at_start), leases_ended: Number(row.leases_ended) });
+    return signals;
+  }
+}
+
+const emptySignals = (): AgencySignals => ({
+  invoiced: 0,
+  collected: 0,
+  units: 0,
+  occupied_units: 0,
+  requests: 0,
+  complaints: 0,
+  median_response_hours: null,
+  leases_at_start: 0,
+  leases_ended: 0,
+});
+
+export const agencyHealthService = new AgencyHealthService();
@@ -0,0 +1,426 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { normalizeCounty } from '../utils/counties.js';
+import { emailTemplatesService, EmailBranding } from './email-templates.service.js';
+import { planLimitsService } from './plan-limits.service.js';
+
+export const ONBOARDING_STEPS = ['company_profile', 'branding', 'billing', 'admin_invite', 'property_import'] as const;
+export type OnboardingStep = typeof ONBOARDING_STEPS[number];
+
+// Steps an agency can skip and come back to from its settings later
+const OPTIONAL_STEPS: OnboardingStep[] = ['branding', 'property_import'];
+const ONBOARDING_ROLES = ['super_admin', 'agency_admin'];
+const PROFILE_FIELDS = [
+  'name', 'business_type', 'registration_number', 'tax_id', 'email', 'phone_number', 'website',
+  'street', 'city', 'region', 'country', 'postal_code', 'industry', 'company_size',
+] as const;
+const PLANS = ['starter', 'professional', 'enterprise'];
+const BILLING_CYCLES = ['monthly', 'annual'];
+const PAYMENT_METHODS = ['mpesa', 'card', 'bank_transfer'];
+const PROPERTY_TYPES = ['residential', 'commercial', 'industrial', 'mixed_use', 'institutional', 'vacant_land', 'hospitality', 'recreational'];
+const MAX_IMPORT_ROWS = 200;
+const EMAIL_PATTERN = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
+
+type StepRecord = { completed_at?: string; skipped?: boolean; [key: string]: any };
+type StepRecords = Partial<Record<OnboardingStep, StepRecord>>;
+
+interface PropertyImportRow {
+  name?: string;
+  type?: string;
+  street?: string;
+  city?: string;
+  region?: string;
+  county?: string;
+  country?: string;
+  number_of_units?: number;
+  owner_id?: string;
+  owner_email?: string;
+  commission_rate?: number;
+}
+
+const text = (value: any) => (value === undefined || value === null ? undefined : String(value).trim());
+
+/**
+ * The guided setup of a new agency: company profile, branding, billing details, inviting its first
+ * admin and importing its first properties. Progress is kept per agency so the wizard resumes at
+ * the first step not yet done; super admins can run it for any agency, agency admins for their own.
+ */
+export class AgencyOnboardingService {
+  private prisma = getPrisma();
+
+  async getStatus(user: JWTClaims, agencyId?: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    const onboarding = await this.prisma.agencyOnboarding.findUnique({ where: { agency_id: agency.id } });
+    const steps = (onboarding?.steps || {}) as StepRecords;
+    const [company, admins, properties] = await Promise.all([
+      this.prisma.company.findUnique({ where: { id: agency.company_id } }),
+      this.prisma.user.findMany({
+        where: { agency_id: agency.id, role: 'agency_admin' },
+        select: { id: true, first_name: true, last_name: true, email: true, status: true },
+        orderBy: { created_at: 'asc' },
+      }),
+      this.prisma.property.count({ where: { agency_id: agency.id } }),
+    ]);
+    const settings = (company?.settings as any) || {};
+
+    const done = (step: OnboardingStep) => Boolean(steps[step]?.completed_at);
+    const state: Record<OnboardingStep, { completed: boolean; skipped: boolean; optional: boolean; completed_at: string | null; data: any }> = {
+      company_profile: {
+        completed: done('company_profile'),
+        skipped: false,
+        optional: false,
+        completed_at: steps.company_profile?.completed_at || null,
+        data: company ? Object.fromEntries(PROFILE_FIELDS.map(field => [field, (company as any)[field] ?? null])) : null,
+      },
+      branding: {
+        completed: done('branding'),
+        skipped: Boolean(steps.branding?.skipped),
+        optional: true,
+        completed_at: steps.branding?.completed_at || null,
+        data: settings.email_branding || null,
+      },
+      billing: {
+        completed: done('billing'),
+        skipped: false,
+        optional: false,
+        completed_at: steps.billing?.completed_at || null,
+        data: settings.billing ? { ...settings.billing, plan: company?.subscription_plan, tax_id: company?.tax_id } : null,
+      },
+      // An agency that already has an admin (say one who signed up themselves) has nobody to invite
+      admin_invite: {
+        completed: done('admin_invite') || admins.length > 0,
+        skipped: false,
+        optional: false,
+        completed_at: steps.admin_invite?.completed_at || null,
+        data: admins[0] || null,
+      },
+      property_import: {
+        completed: done('property_import') || properties > 0,
+        skipped: Boolean(steps.property_import?.skipped),
+        optional: true,
+        completed_at: steps.property_import?.completed_at || null,
+        data: { properties, last_import: steps.property_import?.last_import || null },
+      },
+    };
+
+    const finished = ONBOARDING_STEPS.filter(step => state[step].completed || state[step].skipped);
+    const nextStep = ONBOARDING_STEPS.find(step => !state[step].completed && !state[step].skipped) || null;
+    return {
+      agency_id: agency.id,
+      agency_name: agency.name,
+      agency_status: agency.status,
+      onboarding_complete: Boolean(onboarding?.completed_at),
+      completed_at: onboarding?.completed_at || null,
+      current_step: onboarding?.completed_at ? null : nextStep || 'review',
+      can_complete: ONBOARDING_STEPS.every(step => state[step].completed || (state[step].optional && state[step].skipped)),
+      completion_percentage: Math.round((finished.length / ONBOARDING_STEPS.length) * 100),
+      steps: ONBOARDING_STEPS.map(step => ({ step, ...state[step] })),
+    };
+  }
+
+  async saveCompanyProfile(user: JWTClaims, agencyId: string | undefined, req: Record<string, any>) {
+    const agency = await this.agencyFor(user, agencyId);
+    const data: Record<string, any> = {};
+    for (const field of PROFILE_FIELDS) {
+      const value = text(req[field]);
+      if (value !== undefined) data[field] = value || null;
+    }
+    const company = await this.prisma.company.findUnique({ where: { id: agency.company_id } });
+    const merged = { ...company, ...data } as Record<string, any>;
+    if (!merged.name) throw new Error('name is required');
+    if (!merged.phone_number) throw new Error('phone_number is required');
+    if (!merged.city) throw new Error('city is required');
+    if (merged.email && !EMAIL_PATTERN.test(merged.email)) throw new Error('email must be a valid email address');
+    if (merged.website && !/^https?:\/\//i.test(merged.website)) throw new Error('website must start with http:// or https://');
+    if (data.country === null) delete data.country;
+
+    await this.prisma.$transaction([
+      this.prisma.company.update({ where: { id: agency.company_id }, data: { ...data, updated_at: new Date() } }),
+      // The agency's own contact details follow its company profile where it has none yet
+      this.prisma.agency.update({
+        where: { id: agency.id },
+        data: {
+          ...(!agency.phone_number && { phone_number: merged.phone_number }),
+          ...(!agency.address && { address: [merged.street, merged.city, merged.region].filter(Boolean).join(', ') || null }),
+          updated_at: new Date(),
+        },
+      }),
+    ]);
+    await this.markStep(agency.id, 'company_profile');
+    return this.getStatus(user, agency.id);
+  }
+
+  async saveBranding(user: JWTClaims, agencyId: string | undefined, req: Partial<EmailBranding>) {
+    const agency = await this.agencyFor(user, agencyId);
+    await emailTemplatesService.updateBranding({ ...req, company_id: agency.company_id }, user);
+    await this.markStep(agency.id, 'branding');
+    return this.getStatus(user, agency.id);
+  }
+
+  /**
+   * Who pays and how; the plan goes on the company, the contact details under its settings
+   */
+  async saveBilling(user: JWTClaims, agencyId: string | undefined, req: Record<string, any>) {
+    const agency = await this.agencyFor(user, agencyId);
+    const billingEmail = text(req.billing_email)?.toLowerCase();
+    if (!billingEmail || !EMAIL_PATTERN.test(billingEmail)) {
+      throw new Error('billing_email must be a valid email address');
+    }
+    const plan = text(req.plan) || 'starter';
+    if (!PLANS.includes(plan)) throw new Error(`plan must be one of: ${PLANS.join(', ')}`);
+    const cycle = text(req.billing_cycle) || 'monthly';
+    if (!BILLING_CYCLES.includes(cycle)) throw new Error(`billing_cycle must be one of: ${BILLING_CYCLES.join(', ')}`);
+    const method = text(req.payment_method) || 'mpesa';
+    if (!PAYMENT_METHODS.includes(method)) throw new Error(`payment_method must be one of: ${PAYMENT_METHODS.join(', ')}`);
+
+    const company = await this.prisma.company.findUnique({ where: { id: agency.company_id }, select: { settings: true, tax_id: true } });
+    const billing = {
+      billing_email: billingEmail,
+      billing_contact_name: text(req.billing_contact_name) || null,
+      billing_phone: text(req.billing_phone) || null,
+      billing_address: text(req.billing_address) || null,
+      billing_cycle: cycle,
+      payment_method: method,
+    };
+    await this.prisma.company.update({
+      where: { id: agency.company_id },
+      data: {
+        subscription_plan: plan,
+        tax_id: text(req.tax_id) || company?.tax_id || null,
+        settings: { ...((company?.settings as any) || {}), billing },
+        updated_at: new Date(),
+      },
+    });
+    await this.markStep(agency.id, 'billing');
+    return this.getStatus(user, agency.id);
+  }
+
+  /**
+   * Create the agency's first admin and email them a link to set their password. Inviting the
+   * same person again resends the link.
+   */
+  async inviteAdmin(user: JWTClaims, agencyId: string | undefined, req: Record<string, any>) {
+    const agency = await this.agencyFor(user, agencyId);
+    const email = text(req.email)?.toLowerCase();
+    const firstName = text(req.first_name);
+    const lastName = text(req.last_name);
+    if (!email || !EMAIL_PATTERN.test(email)) throw new Error('email must be a valid email address');
+    if (!firstName || !lastName) throw new Error('first_name and last_name are required');
+
+    let admin = await this.prisma.user.findUnique({ where: { email } });
+    if (admin && (admin.role !== 'agency_admin' || admin.agency_id !== agency.id)) {
+      throw new Error('a user with this email already exists');
+    }
+    if (admin && admin.status === 'active') {
+      throw new Error('this admin has already set up their account');
+    }
+    if (!admin) {
+      if (user.role !== 'super_admin') {
+        await planLimitsService.check(agency.company_id, 'users');
+      }
+      admin = await this.prisma.user.create({
+        data: {
+          email,
+          first_name: firstName,
+          last_name: lastName,
+          phone_number: text(req.phone_number) || null,
+          role: 'agency_admin',
+          status: 'pending',
+          // The invitation goes to this address, so it is verified once they follow it
+          email_verified: true,
+          company_id: agency.company_id,
+          agency_id: agency.id,
+          created_by: user.user_id,
+        },
+      });
+    }
+
+    const setupUrl = `${env.appUrl}/account/setup?token=invitation-${admin.id}&email=${encodeURIComponent(email)}&first_name=${encodeURIComponent(admin.first_name)}&last_name=${encodeURIComponent(admin.last_name)}`;
+    const result = await emailTemplatesService.send('agency_admin_invitation', {
+      to: email,
+      recipientId: admin.id,
+      companyId: agency.company_id,
+      variables: { admin_name: `${admin.first_name} ${admin.last_name}`.trim(), agency_name: agency.name, setup_url: setupUrl },
+    });
+    if (!result.success) {
+      console.error(`❌ Failed to send agency admin invitation to ${email}:`, result.error);
+    }
+
+    await this.markStep(agency.id, 'admin_invite', { admin_id: admin.id, invited_at: new Date().toISOString() });
+    return {
+      admin: { id: admin.id, email, first_name: admin.first_name, last_name: admin.last_name, status: admin.status },
+      invitation_sent: result.success,
+      status: await this.getStatus(user, agency.id),
+    };
+  }
+
+  /**
+   * Create the agency's first properties from rows as the frontend parsed them from a spreadsheet.
+   * Each row stands alone: rows that fail are reported and the rest are created.
+   */
+  async importProperties(user: JWTClaims, agencyId: string | undefined, rows: PropertyImportRow[]) {
+    const agency = await this.agencyFor(user, agencyId);
+    if (!Array.isArray(rows) || rows.length === 0) {
+      throw new Error('properties must be a non-empty list');
+    }
+    if (rows.length > MAX_IMPORT_ROWS) {
+      throw new Error(`properties must have at most ${MAX_IMPORT_ROWS} rows per import`);
+    }
+    if (user.role !== 'super_admin') {
+      await planLimitsService.check(agency.company_id, 'properties', rows.length);
+    }
+
+    // Rows without an owner are held by the agency's admin until the landlord is added
+    const defaultOwner = user.role === 'agency_admin'
+      ? user.user_id
+      : (await this.prisma.user.findFirst({ where: { agency_id: agency.id, role: 'agency_admin' }, select: { id: true }, orderBy: { created_at: 'asc' } }))?.id;
+    const ownerEmails = [...new Set(rows.map(row => text(row.owner_email)?.toLowerCase()).filter(Boolean))] as string[];
+    const owners = await this.prisma.user.findMany({
+      where: {
+        company_id: agency.company_id,
+        role: { in: ['landlord', 'agency_admin'] },
+        OR: [{ email: { in: ownerEmails } }, { id: { in: rows.map(row => text(row.owner_id)).filter(Boolean) as string[] } }],
+      },
+      select: { id: true, email: true },
+    });
+    const ownerByEmail = new Map(owners.map(o => [(o.email || '').toLowerCase(), o.id]));
+    const ownerIds = new Set(owners.map(o => o.id));
+
+    const created: Array<{ row: number; id: string; name: string }> = [];
+    const failed: Array<{ row: number; name: string | null; error: string }> = [];
+    for (const [index, row] of rows.entries()) {
+      const rowNumber = index + 1;
+      try {
+        const name = text(row.name);
+        const type = text(row.type) || 'residential';
+        const units = Number(row.number_of_units ?? 1);
+        const commission = row.commission_rate === undefined || row.commission_rate === null ? null : Number(row.commission_rate);
+        if (!name) throw new Error('name is required');
+        if (!PROPERTY_TYPES.includes(type)) throw new Error(`type must be one of: ${PROPERTY_TYPES.join(', ')}`);
+        if (!text(row.street) || !text(row.city) || !text(row.region)) throw new Error('street, city and region are required');
+        if (!Number.isInteger(units) || units < 1) throw new Error('number_of_units must be a whole number of at least 1');
+        if (commission !== null && (!Number.isFinite(commission) || commission < 0 || commission > 100)) {
+          throw new Error('commission_rate must be a percentage between 0 and 100');
+        }
+
+        let ownerId = defaultOwner;
+        if (text(row.owner_email)) {
+          ownerId = ownerByEmail.get(text(row.owner_email)!.toLowerCase());
+          if (!ownerId) throw new Error(`owner ${row.owner_email} not found in this agency's company`);
+        } else if (text(row.owner_id)) {
+          if (!ownerIds.has(text(row.owner_id)!)) throw new Error('owner not found in this agency\'s company');
+          ownerId = text(row.owner_id);
+        }
+        if (!ownerId) throw new Error('owner_email is required until the agency has an admin');
+
+        const property = await this.prisma.property.create({
+          data: {
+            name,
+            type: type as any,
+            street: text(row.street)!,
+            city: text(row.city)!,
+            region: text(row.region)!,
+            county: normalizeCounty(row.county) || normalizeCounty(row.city) || normalizeCounty(row.region) || text(row.county) || null,
+            country: text(row.country) || 'Kenya',
+            ownership_type: 'individual',
+            owner_id: ownerId,
+            agency_id: agency.id,
+            company_id: agency.company_id,
+            number_of_units: units,
+            commission_rate: commission,
+            status: 'active',
+            created_by: user.user_id,
+          },
+        });
+        created.push({ row: rowNumber, id: property.id, name: property.name });
+      } catch (error: any) {
+        failed.push({ row: rowNumber, name: text(row.name) || null, error: error.message });
+      }
+    }
+
+    if (created.length > 0) {
+      await this.markStep(agency.id, 'property_import', {
+        last_import: { at: new Date().toISOString(), created: created.length, failed: failed.length },
+      });
+    }
+    return { created, failed, status: await this.getStatus(user, agency.id) };
+  }
+
+  async skipStep(user: JWTClaims, agencyId: string | undefined, step: string) {
+    if (!ONBOARDING_STEPS.includes(step as OnboardingStep)) {
+      throw new Error(`step must be one of: ${ONBOARDING_STEPS.join(', ')}`);
+    }
+    if (!OPTIONAL_STEPS.includes(step as OnboardingStep)) {
+      throw new Error(`only ${OPTIONAL_STEPS.join(' and ')} can be skipped`);
+    }
+    const agency = await this.agencyFor(user, agencyId);
+    await this.updateSteps(agency.id, steps => ({ ...steps, [step]: { ...steps[step as OnboardingStep], skipped: true } }));
+    return this.getStatus(user, agency.id);
+  }
+
+  /**
+   * Finish the wizard once every required step is done; a pending agency becomes active
+   */
+  async complete(user: JWTClaims, agencyId?: string) {
+    const status = await this.getStatus(user, agencyId);
+    if (status.onboarding_complete) {
+      throw new Error('onboarding is already complete');
+    }
+    if (!status.can_complete) {
+      const missing = status.steps.filter(s => !s.completed && !(s.optional && s.skipped)).map(s => s.step);
+      throw new Error(`onboarding steps must be completed or skipped first: ${missing.join(', ')}`);
+    }
+
+    await this.prisma.agencyOnboarding.update({
+      where: { agency_id: status.agency_id },
+      data: { completed_at: new Date(), completed_by: user.user_id, updated_at: new Date() },
+    });
+    if (status.agency_status === 'pending' || status.agency_status === 'pending_setup') {
+      const { agenciesService } = await import('./agencies.service.js');
+      await agenciesService.update(status.agency_id, { status: 'active' }, user);
+    }
+    return this.getStatus(user, status.agency_id);
+  }
+
+  private async agencyFor(user: JWTClaims, agencyId?: string) {
+    if (!ONBOARDING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to onboard agencies');
+    }
+    const id = user.role === 'super_admin' ? agencyId : user.agency_id;
+    if (!id) {
+      throw new Error(user.role === 'super_admin' ? 'agency_id is required' : 'user must be associated with an agency');
+    }
+    if (user.role === 'agency_admin' && agencyId && agencyId !== user.agency_id) {
+      throw new Error('insufficient permissions to onboard another agency');
+    }
+    const agency = await this.prisma.agency.findUnique({ where: { id } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    if (agency.status === 'suspended') {
+      throw new Error('agency is suspended and must be reactivated before onboarding');
+    }
+    return agency;
+  }
+
+  private async markStep(agencyId: string, step: OnboardingStep, details: Record<string, any> = {}) {
+    await this.updateSteps(agencyId, steps => ({
+      ...steps,
+      [step]: { ...steps[step], ...details, skipped: false, completed_at: new Date().toISOString() },
+    }));
+  }
+
+  private async updateSteps(agencyId: string, change: (steps: StepRecords) => StepRecords) {
+    const existing = await this.prisma.agencyOnboarding.findUnique({ where: { agency_id: agencyId } });
+    const steps = change((existing?.steps || {}) as StepRecords) as Prisma.InputJsonValue;
+    await this.prisma.agencyOnboarding.upsert({
+      where: { agency_id: agencyId },
+      create: { agency_id: agencyId, steps },
+      update: { steps, updated_at: new Date() },
+    });
+  }
+}
+
+export const agencyOnboardingService = new AgencyOnboardingService();
@@ -0,0 +1,271 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+
+interface AgencyReportFilters {
+  start_date?: string;
+  end_date?: string;
+  agency_id?: string;
+  company_id?: string;
+  property_ids?: string[];
+}
+
+interface PropertyTotals {
+  units: number;
+  occupied: number;
+  invoiced: number;
+  collected: number;
+  rent_collected: number;
+  arrears: number;
+  commission: number;
+}
+
+const AGENCY_REPORT_ROLES = ['super_admin', 'agency_admin'];
+// Units with a tenant, including those flagged for arrears
+const OCCUPIED_STATUSES = ['occupied', 'arrears'];
+
+const round = (n: number) => Math.round(n * 100) / 100;
+const rate = (part: number, whole: number) => (whole > 0 ? round((part / whole) * 100) : null);
+const monthKey = (date: Date) => `${date.getFullYear()}-${String(date.getMonth() + 1).padStart(2, '0')}`;
+const emptyTotals = (): PropertyTotals => ({ units: 0, occupied: 0, invoiced: 0, collected: 0, rent_collected: 0, arrears: 0, commission: 0 });
+
+function addTotals(target: PropertyTotals, source: PropertyTotals) {
+  (Object.keys(target) as Array<keyof PropertyTotals>).forEach(key => {
+    target[key] += source[key];
+  });
+}
+
+function present(totals: PropertyTotals) {
+  return {
+    units: totals.units,
+    occupied_units: totals.occupied,
+    occupancy_rate: rate(totals.occupied, totals.units),
+    invoiced: round(totals.invoiced),
+    collected: round(totals.collected),
+    rent_collected: round(totals.rent_collected),
+    collection_rate: rate(totals.collected, totals.invoiced),
+    arrears: round(totals.arrears),
+    commission: round(totals.commission),
+  };
+}
+
+/**
+ * Agency roll-ups across the landlords an agency manages: collections, occupancy and the
+ * commission the agency earned (each property's commission_rate applied to rent collected),
+ * with a drill-down into one landlord's properties. Landlord-scoped reports stay as they are.
+ */
+export class AgencyReportsService {
+  private prisma = getPrisma();
+
+  async getRollup(user: JWTClaims, filters: AgencyReportFilters = {}) {
+    const { period, properties, totals } = await this.collect(user, filters);
+
+    const landlords = new Map<string, { owner: any; properties: number; without_rate: number; totals: PropertyTotals }>();
+    for (const property of properties) {
+      const entry = landlords.get(property.owner.id) || { owner: property.owner, properties: 0, without_rate: 0, totals: emptyTotals() };
+      entry.properties++;
+      if (property.commission_rate === null) entry.without_rate++;
+      addTotals(entry.totals, totals.get(property.id)!);
+      landlords.set(property.owner.id, entry);
+    }
+    const overall = emptyTotals();
+    landlords.forEach(entry => addTotals(overall, entry.totals));
+
+    return {
+      report_name: 'agency roll-up',
+      period,
+      summary: {
+        landlords: landlords.size,
+        properties: properties.length,
+        ...present(overall),
+        properties_without_commission_rate: properties.filter(p => p.commission_rate === null).length,
+      },
+      landlords: [...landlords.values()]
+        .map(({ owner, properties: count, without_rate, totals: t }) => ({
+          owner_id: owner.id,
+          landlord_name: `${owner.first_name} ${owner.last_name}`.trim(),
+          email: owner.email,
+          properties: count,
+          ...present(t),
+          properties_without_commission_rate: without_rate,
+        }))
+        .sort((a, b) => b.collected - a.collected || a.landlord_name.localeCompare(b.landlord_name)),
+      generatedAt: new Date().toISOString(),
+    };
+  }
+
+  /**
+   * One landlord's properties, monthly collections and open arrears within the agency's scope
+   */
+  async getLandlordDetail(user: JWTClaims, ownerId: string, filters: AgencyReportFilters = {}) {
+    const { period, properties, totals, months, arrears } = await this.collect(user, filters, ownerId);
+    if (properties.length === 0) {
+      throw new Error('landlord not found');
+    }
+    const { owner } = properties[0];
+    const overall = emptyTotals();
+    properties.forEach(p => addTotals(overall, totals.get(p.id)!));
+
+    return {
+      report_name: 'agency landlord',
+      period,
+      landlord: {
+        owner_id: owner.id,
+        landlord_name: `${owner.first_name} ${owner.last_name}`.trim(),
+        email: owner.email,
+        phone_number: owner.phone_number,
+      },
+      summary: { properties: properties.length, ...present(overall) },
+      properties: properties.map(p => ({
+        property_id: p.id,
+        property_name: p.name,
+        agency_name: p.agency?.name || null,
+        commission_rate: p.commission_rate === null ? null : Number(p.commission_rate),
+        ...present(totals.get(p.id)!),
+      })),
+      months: [...months.entries()].sort(([a], [b]) => a.localeCompare(b)).map(([month, m]) => ({
+        month,
+        collected: round(m.collected),
+        rent_collected: round(m.rent_collected),
+        commission: round(m.commission),
+      })),
+      arrears,
+      generatedAt: new Date().toISOString(),
+    };
+  }
+
+  private async collect(user: JWTClaims, filters: AgencyReportFilters, ownerId?: string) {
+    if (!AGENCY_REPORT_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view agency reports');
+    }
+    const now = new Date();
+    const start = filters.start_date ? new Date(filters.start_date) : new Date(now.getFullYear(), now.getMonth(), 1);
+    const end = filters.end_date ? new Date(filters.end_date) : now;
+    if (isNaN(start.getTime()) || isNaN(end.getTime())) {
+      throw new Error('start_date and end_date must be valid dates');
+    }
+    if (filters.end_date && !String(filters.end_date).includes('T')) {
+      end.setHours(23, 59, 59, 999);
+    }
+    if (start > end) {
+      throw new Error('start_date must be before end_date');
+    }
+
+    const properties = await this.prisma.property.findMany({
+      where: {
+        ...buildWhereClause(user),
+        // Super admins pick the agency (or company) to roll up; agency admins are held to their own
+        ...(user.role === 'super_admin' && filters.company_id && { company_id: filters.company_id }),
+        ...(user.role === 'super_admin' && filters.agency_id && { agency_id: filters.agency_id }),
+        ...(ownerId && { owner_id: ownerId }),
+        ...(filters.property_ids?.length && { id: { in: filters.property_ids } }),
+      },
+      select: {
+        id: true,
+        name: true,
+        commission_rate: true,
+        agency: { select: { id: true, name: true } },
+        owner: { select: { id: true, first_name: true, last_name: true, email: true, phone_number: true } },
+      },
+      orderBy: { name: 'asc' },
+    });
+    const propertyIds = properties.map(p => p.id);
+    const inScope = { OR: [{ property_id: { in: propertyIds } }, { property_id: null, unit: { property_id: { in: propertyIds } } }] };
+
+    const [units, invoices, payments, overdue] = await Promise.all([
+      this.prisma.unit.groupBy({
+        by: ['property_id', 'status'],
+        where: { property_id: { in: propertyIds } },
+        _count: { _all: true },
+      }),
+      this.prisma.invoice.findMany({
+        where: { ...inScope, status: { in: ['sent', 'paid', 'overdue'] }, due_date: { gte: start, lte: end } },
+        select: { total_amount: true, property_id: true, unit: { select: { property_id: true } } },
+      }),
+      this.prisma.payment.findMany({
+        where: {
+          ...inScope,
+          status: { in: ['completed', 'approved'] },
+          payment_type: { not: 'security_deposit' },
+          payment_date: { gte: start, lte: end },
+        },
+        select: { amount: true, withholding_tax: true, payment_type: true, payment_date: true, property_id: true, unit: { select: { property_id: true } } },
+      }),
+      // Arrears are what is open and past due today, whatever the period
+      this.prisma.invoice.findMany({
+        where: { AND: [inScope, { OR: [{ status: 'overdue' }, { status: 'sent', due_date: { lt: now } }] }] },
+        select: {
+          id: true,
+          invoice_number: true,
+          total_amount: true,
+          due_date: true,
+          property_id: true,
+          unit: { select: { property_id: true, unit_number: true } },
+          recipient: { select: { first_name: true, last_name: true } },
+        },
+        orderBy: { due_date: 'asc' },
+      }),
+    ]);
+
+    const totals = new Map(properties.map(p => [p.id, emptyTotals()]));
+    const commissionRates = new Map(properties.map(p => [p.id, Number(p.commission_rate || 0) / 100]));
+    const months = new Map<string, { collected: number; rent_collected: number; commission: number }>();
+
+    for (const group of units) {
+      const t = totals.get(group.property_id)!;
+      t.units += group._count._all;
+      if (OCCUPIED_STATUSES.includes(group.status)) t.occupied += group._count._all;
+    }
+    for (const invoice of invoices) {
+      const t = totals.get((invoice.property_id || invoice.unit?.property_id)!);
+      if (t) t.invoiced += Number(invoice.total_amount);
+    }
+    for (const payment of payments) {
+      const propertyId = (payment.property_id || payment.unit?.property_id)!;
+      const t = totals.get(propertyId);
+      if (!t) continue;
+      // Tax a tenant withheld still settles the rent, so it counts as collected
+      const amount = Number(payment.amount) + Number(payment.withholding_tax || 0);
+      const isRent = payment.payment_type === 'rent';
+      const commission = isRent ? amount * commissionRates.get(propertyId)! : 0;
+      t.collected += amount;
+      if (isRent) t.rent_collected += amount;
+      t.commission += commission;
+
+      const key = monthKey(payment.payment_date);
+      const month = months.get(key) || { collected: 0, rent_collected: 0, commission: 0 };
+      month.collected += amount;
+      if (isRent) month.rent_collected += amount;
+      month.commission += commission;
+      months.set(key, month);
+    }
+    const propertyNames = new Map(properties.map(p => [p.id, p.name]));
+    const arrears: any[] = [];
+    for (const invoice of overdue) {
+      const propertyId = (invoice.property_id || invoice.unit?.property_id)!;
+      const t = totals.get(propertyId);
+      if (!t) continue;
+      t.arrears += Number(invoice.total_amount);
+      arrears.push({
+        invoice_id: invoice.id,
+        invoice_number: invoice.invoice_number,
+        property_name: propertyNames.get(propertyId),
+        unit_number: invoice.unit?.unit_number || null,
+        tenant_name: invoice.recipient ? `${invoice.recipient.first_name} ${invoice.recipient.last_name}`.trim() : null,
+        amount: round(Number(invoice.total_amount)),
+        due_date: invoice.due_date.toISOString().split('T')[0],
+        days_overdue: Math.max(0, Math.floor((now.getTime() - invoice.due_date.getTime()) / 86400000)),
+      });
+    }
+
+    return {
+      period: { start_date: start.toISOString(), end_date: end.toISOString() },
+      properties,
+      totals,
+      months,
+      arrears,
+    };
+  }
+}
+
+export const agencyReportsService = new AgencyReportsService();
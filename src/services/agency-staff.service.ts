@@ -0,0 +1,392 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { staffService } from './staff.service.js';
+
+// Roles an agency admin can give its own people; agency_admin and manager are assigned elsewhere
+export const AGENCY_STAFF_ROLES = ['agent', 'caretaker', 'cleaner', 'security', 'maintenance', 'receptionist', 'accountant'] as const;
+export type AgencyStaffRole = typeof AGENCY_STAFF_ROLES[number];
+
+const DEFAULT_ACTIVITY_DAYS = 30;
+
+const staffSelect = {
+  id: true,
+  first_name: true,
+  last_name: true,
+  email: true,
+  phone_number: true,
+  role: true,
+  status: true,
+  staff_number: true,
+  position: true,
+  agency_id: true,
+  company_id: true,
+  last_login_at: true,
+  created_at: true,
+} as const;
+
+/**
+ * An agency's own staff: agents and the people working its properties. Agents only see the
+ * properties in their portfolio (their active staff property assignments), so assigning a
+ * portfolio here is what scopes an agent's access everywhere else.
+ */
+export class AgencyStaffService {
+  private prisma = getPrisma();
+
+  async list(user: JWTClaims, agencyId: string | undefined, filters: { role?: string; status?: string; search?: string } = {}) {
+    const agency = await this.agencyFor(user, agencyId);
+    if (filters.role) this.assertRole(filters.role);
+
+    const members = await this.prisma.user.findMany({
+      where: {
+        agency_id: agency.id,
+        role: filters.role ? (filters.role as any) : { in: AGENCY_STAFF_ROLES as any },
+        ...(filters.status && { status: filters.status as any }),
+        ...(filters.search && {
+          OR: [
+            { first_name: { contains: filters.search, mode: 'insensitive' as const } },
+            { last_name: { contains: filters.search, mode: 'insensitive' as const } },
+            { email: { contains: filters.search, mode: 'insensitive' as const } },
+            { phone_number: { contains: filters.search } },
+          ],
+        }),
+      },
+      orderBy: [{ role: 'asc' }, { first_name: 'asc' }],
+      select: {
+        ...staffSelect,
+        property_assignments: { where: { status: 'active' }, select: { property_id: true } },
+      },
+    });
+
+    return members.map(({ property_assignments, ...member }) => ({
+      ...member,
+      portfolio_size: property_assignments.length,
+    }));
+  }
+
+  async get(user: JWTClaims, agencyId: string | undefined, staffId: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    const member = await this.memberOf(agency.id, staffId);
+    return { ...member, portfolio: await this.portfolioOf(staffId) };
+  }
+
+  /**
+   * Create a staff member in the agency and optionally hand them a portfolio; an invitation to set
+   * their password goes out unless send_invitation is false
+   */
+  async create(user: JWTClaims, agencyId: string | undefined, data: any) {
+    const agency = await this.agencyFor(user, agencyId);
+    const role = data.role || 'agent';
+    this.assertRole(role);
+    if (!data.first_name || !data.last_name || !data.email) {
+      throw new Error('first_name, last_name and email are required');
+    }
+    const propertyIds: string[] = Array.isArray(data.property_ids) ? data.property_ids : [];
+    await this.assertAgencyProperties(agency.id, propertyIds);
+
+    // Super admins act for the agency's company; staffService scopes everyone else from their claims
+    const created = await staffService.createStaffMember(user, role, {
+      ...data,
+      company_id: agency.company_id,
+      assigned_properties: propertyIds,
+    });
+    if (created.agency_id !== agency.id) {
+      await this.prisma.user.update({ where: { id: created.id }, data: { agency_id: agency.id } });
+    }
+
+    if (data.send_invitation !== false) {
+      try {
+        await staffService.inviteStaffMember(user, created.id, role);
+      } catch (error: any) {
+        console.error(`❌ Failed to send invitation to agency staff ${created.id}:`, error.message);
+      }
+    }
+    return this.get(user, agency.id, created.id);
+  }
+
+  async changeRole(user: JWTClaims, agencyId: string | undefined, staffId: string, role: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    this.assertRole(role);
+    const member = await this.memberOf(agency.id, staffId);
+    if (member.role === role) {
+      return this.get(user, agency.id, staffId);
+    }
+    await this.prisma.user.update({
+      where: { id: staffId },
+      data: { role: role as any, updated_at: new Date() },
+    });
+    // Claims carry the role, so existing sessions must sign in again to pick up the new one
+    await this.prisma.refreshToken.updateMany({
+      where: { user_id: staffId, is_revoked: false },
+      data: { is_revoked: true, revoked_at: new Date() },
+    });
+    return this.get(user, agency.id, staffId);
+  }
+
+  /**
+   * Replace a staff member's portfolio with the given properties; the first is their primary
+   */
+  async setPortfolio(user: JWTClaims, agencyId: string | undefined, staffId: string, propertyIds: string[]) {
+    const agency = await this.agencyFor(user, agencyId);
+    await this.memberOf(agency.id, staffId);
+    if (!Array.isArray(propertyIds)) {
+      throw new Error('property_ids must be an array');
+    }
+    const ids = [...new Set(propertyIds)];
+    await this.assertAgencyProperties(agency.id, ids);
+
+    await this.prisma.$transaction(async (tx) => {
+      await tx.staffPropertyAssignment.deleteMany({
+        where: { staff_id: staffId, property_id: { notIn: ids } },
+      });
+      for (const [index, propertyId] of ids.entries()) {
+        await tx.staffPropertyAssignment.upsert({
+          where: { staff_id_property_id: { staff_id: staffId, property_id: propertyId } },
+          update: { is_primary: index === 0, status: 'active' },
+          create: {
+            staff_id: staffId,
+            property_id: propertyId,
+            assigned_by: user.user_id,
+            is_primary: index === 0,
+            status: 'active',
+          },
+        });
+      }
+    });
+    await this.syncTopics(staffId);
+    return this.portfolioOf(staffId);
+  }
+
+  async addToPortfolio(user: JWTClaims, agencyId: string | undefined, staffId: string, propertyId: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    await this.memberOf(agency.id, staffId);
+    await this.assertAgencyProperties(agency.id, [propertyId]);
+
+    const hasPrimary = await this.prisma.staffPropertyAssignment.count({
+      where: { staff_id: staffId, status: 'active', is_primary: true },
+    });
+    await this.prisma.staffPropertyAssignment.upsert({
+      where: { staff_id_property_id: { staff_id: staffId, property_id: propertyId } },
+      update: { status: 'active' },
+      create: {
+        staff_id: staffId,
+        property_id: propertyId,
+        assigned_by: user.user_id,
+        is_primary: hasPrimary === 0,
+        status: 'active',
+      },
+    });
+    await this.syncTopics(staffId);
+    return this.portfolioOf(staffId);
+  }
+
+  async removeFromPortfolio(user: JWTClaims, agencyId: string | undefined, staffId: string, propertyId: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    await this.memberOf(agency.id, staffId);
+    const { count } = await this.prisma.staffPropertyAssignment.deleteMany({
+      where: { staff_id: staffId, property_id: propertyId },
+    });
+    if (count === 0) {
+      throw new Error('property is not in this staff member\'s portfolio');
+    }
+    await this.syncTopics(staffId);
+    return this.portfolioOf(staffId);
+  }
+
+  /**
+   * Deactivate a staff member: they are signed out and their portfolio is suspended, so they lose
+   * access to the agency's properties until reactivated
+   */
+  async deactivate(user: JWTClaims, agencyId: string | undefined, staffId: string, reason?: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    const member = await this.memberOf(agency.id, staffId);
+    if (staffId === user.user_id) {
+      throw new Error('you cannot deactivate your own account');
+    }
+    if (member.status === 'inactive') {
+      throw new Error('staff member is already inactive');
+    }
+
+    const now = new Date();
+    await this.prisma.$transaction([
+      this.prisma.user.update({
+        where: { id: staffId },
+        data: { status: 'inactive', terminated_at: now, updated_at: now },
+      }),
+      this.prisma.staffPropertyAssignment.updateMany({
+        where: { staff_id: staffId, status: 'active' },
+        data: { status: 'inactive' },
+      }),
+      this.prisma.refreshToken.updateMany({
+        where: { user_id: staffId, is_revoked: false },
+        data: { is_revoked: true, revoked_at: now },
+      }),
+      this.prisma.securityActivityLog.create({
+        data: {
+          user_id: staffId,
+          activity_type: 'account_deactivated',
+          activity_description: reason ? `Deactivated by agency: ${reason}` : 'Deactivated by agency',
+          metadata: { deactivated_by: user.user_id, agency_id: agency.id },
+        },
+      }),
+    ]);
+    await this.syncTopics(staffId);
+    return this.get(user, agency.id, staffId);
+  }
+
+  /**
+   * Bring a deactivated staff member back with the portfolio they had
+   */
+  async reactivate(user: JWTClaims, agencyId: string | undefined, staffId: string) {
+    const agency = await this.agencyFor(user, agencyId);
+    const member = await this.memberOf(agency.id, staffId);
+    if (member.status !== 'inactive') {
+      throw new Error('only inactive staff can be reactivated');
+    }
+
+    const now = new Date();
+    await this.prisma.$transaction([
+      this.prisma.user.update({
+        where: { id: staffId },
+        data: { status: 'active', terminated_at: null, updated_at: now },
+      }),
+      this.prisma.staffPropertyAssignment.updateMany({
+        where: { staff_id: staffId, status: 'inactive' },
+        data: { status: 'active' },
+      }),
+      this.prisma.securityActivityLog.create({
+        data: {
+          user_id: staffId,
+          activity_type: 'account_reactivated',
+          activity_description: 'Reactivated by agency',
+          metadata: { reactivated_by: user.user_id, agency_id: agency.id },
+        },
+      }),
+    ]);
+    await this.syncTopics(staffId);
+    return this.get(user, agency.id, staffId);
+  }
+
+  /**
+   * What a staff member has been doing: sign-ins, work on their portfolio's units, maintenance
+   * handled, and leases and invoices they raised
+   */
+  async getActivity(user: JWTClaims, agencyId: string | undefined, staffId: string, days = DEFAULT_ACTIVITY_DAYS) {
+    const agency = await this.agencyFor(user, agencyId);
+    const member = await this.memberOf(agency.id, staffId);
+    const since = new Date(Date.now() - Math.min(365, Math.max(1, days)) * 24 * 60 * 60 * 1000);
+
+    const [signIns, unitActivity, maintenanceAssigned, maintenanceCompleted, leasesCreated, invoicesIssued, recentSecurity, recentUnitActivity] = await Promise.all([
+      this.prisma.securityActivityLog.count({ where: { user_id: staffId, activity_type: 'login', success: true, created_at: { gte: since } } }),
+      this.prisma.unitActivityLog.count({ where: { actor_id: staffId, created_at: { gte: since } } }),
+      this.prisma.maintenanceRequest.count({ where: { assigned_to: staffId, created_at: { gte: since } } }),
+      this.prisma.maintenanceRequest.count({ where: { assigned_to: staffId, status: 'completed', updated_at: { gte: since } } }),
+      this.prisma.lease.count({ where: { created_by: staffId, created_at: { gte: since } } }),
+      this.prisma.invoice.count({ where: { issued_by: staffId, created_at: { gte: since } } }),
+      this.prisma.securityActivityLog.findMany({
+        where: { user_id: staffId, created_at: { gte: since } },
+        orderBy: { created_at: 'desc' },
+        take: 20,
+        select: { id: true, activity_type: true, activity_description: true, device_type: true, success: true, created_at: true },
+      }),
+      this.prisma.unitActivityLog.findMany({
+        where: { actor_id: staffId, created_at: { gte: since } },
+        orderBy: { created_at: 'desc' },
+        take: 20,
+        select: { id: true, unit_id: true, event_type: true, title: true, created_at: true },
+      }),
+    ]);
+
+    return {
+      staff: member,
+      period: { since, days },
+      summary: {
+        sign_ins: signIns,
+        unit_activity: unitActivity,
+        maintenance_assigned: maintenanceAssigned,
+        maintenance_completed: maintenanceCompleted,
+        leases_created: leasesCreated,
+        invoices_issued: invoicesIssued,
+      },
+      recent: {
+        security: recentSecurity,
+        units: recentUnitActivity,
+      },
+    };
+  }
+
+  /**
+   * The agency the caller manages: their own for agency admins, any named one for super admins
+   */
+  private async agencyFor(user: JWTClaims, agencyId?: string) {
+    let id: string | undefined;
+    if (user.role === 'super_admin') {
+      id = agencyId;
+      if (!id) throw new Error('agency_id is required');
+    } else if (user.role === 'agency_admin') {
+      id = user.agency_id;
+      if (!id) throw new Error('your account is not linked to an agency');
+      if (agencyId && agencyId !== id) throw new Error('insufficient permissions to manage another agency');
+    } else {
+      throw new Error('insufficient permissions to manage agency staff');
+    }
+
+    const agency = await this.prisma.agency.findUnique({ where: { id }, select: { id: true, company_id: true, status: true } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    return agency;
+  }
+
+  private async memberOf(agencyId: string, staffId: string) {
+    const member = await this.prisma.user.findFirst({
+      where: { id: staffId, agency_id: agencyId, role: { in: AGENCY_STAFF_ROLES as any } },
+      select: staffSelect,
+    });
+    if (!member) {
+      throw new Error('staff member not found');
+    }
+    return member;
+  }
+
+  private async portfolioOf(staffId: string) {
+    return this.prisma.staffPropertyAssignment.findMany({
+      where: { staff_id: staffId },
+      orderBy: [{ is_primary: 'desc' }, { assigned_at: 'asc' }],
+      select: {
+        property_id: true,
+        is_primary: true,
+        status: true,
+        assigned_at: true,
+        property: { select: { id: true, name: true, street: true, city: true, status: true } },
+      },
+    });
+  }
+
+  /**
+   * Keep the staff member's devices on the push topics of the properties they cover now
+   */
+  private async syncTopics(staffId: string) {
+    const { pushNotificationService } = await import('./push-notification.service.js');
+    await pushNotificationService.syncPropertyTopics(staffId);
+  }
+
+  private async assertAgencyProperties(agencyId: string, propertyIds: string[]) {
+    if (propertyIds.length === 0) return;
+    const found = await this.prisma.property.findMany({
+      where: { id: { in: propertyIds }, agency_id: agencyId },
+      select: { id: true },
+    });
+    const missing = propertyIds.filter(id => !found.some(property => property.id === id));
+    if (missing.length > 0) {
+      throw new Error(`property not found in this agency: ${missing.join(', ')}`);
+    }
+  }
+
+  private assertRole(role: string) {
+    if (!AGENCY_STAFF_ROLES.includes(role as AgencyStaffRole)) {
+      throw new Error(`role must be one of ${AGENCY_STAFF_ROLES.join(', ')}`);
+    }
+  }
+}
+
+export const agencyStaffService = new AgencyStaffService();
@@ -0,0 +1,95 @@
+import * as net from 'net';
+import { env } from '../config/env.js';
+
+export type ScanStatus = 'clean' | 'infected' | 'skipped' | 'error';
+
+export interface ScanResult {
+  status: ScanStatus;
+  scanner: string;
+  signature?: string;
+  error?: string;
+}
+
+/**
+ * Antivirus hook for uploaded files. Implementations must not throw; failures come back as 'error'.
+ */
+export interface AttachmentScanner {
+  readonly name: string;
+  scan(file: Buffer): Promise<ScanResult>;
+}
+
+/**
+ * clamd INSTREAM over TCP: the file is streamed as length-prefixed chunks and clamd answers
+ * "stream: OK" or "stream: <signature> FOUND"
+ */
+export class ClamAvScanner implements AttachmentScanner {
+  readonly name = 'clamav';
+  private static CHUNK_SIZE = 64 * 1024;
+  private static TIMEOUT_MS = 30_000;
+
+  constructor(private host: string = env.attachments.clamavHost, private port: number = env.attachments.clamavPort) {}
+
+  scan(file: Buffer): Promise<ScanResult> {
+    return new Promise(resolve => {
+      const socket = net.createConnection({ host: this.host, port: this.port });
+      let reply = '';
+      let settled = false;
+      const finish = (result: ScanResult) => {
+        if (settled) return;
+        settled = true;
+        socket.destroy();
+        resolve(result);
+      };
+
+      socket.setTimeout(ClamAvScanner.TIMEOUT_MS, () => finish({ status: 'error', scanner: this.name, error: 'clamd timed out' }));
+      socket.on('error', error => finish({ status: 'error', scanner: this.name, error: error.message }));
+      socket.on('data', data => {
+        reply += data.toString('utf8');
+      });
+      socket.on('end', () => {
+        const answer = reply.replace(/\0/g, '').trim();
+        if (/:\s*OK$/.test(answer)) {
+          finish({ status: 'clean', scanner: this.name });
+        } else if (/FOUND$/.test(answer)) {
+          finish({ status: 'infected', scanner: this.name, signature: answer.replace(/^.*?:\s*/, '').replace(/\s*FOUND$/, '') });
+        } else {
+          finish({ status: 'error', scanner: this.name, error: answer || 'empty clamd response' });
+        }
+      });
+
+      socket.on('connect', () => {
+        socket.write('zINSTREAM\0');
+        for (let offset = 0; offset < file.length; offset += ClamAvScanner.CHUNK_SIZE) {
+          const chunk = file.subarray(offset, offset + ClamAvScanner.CHUNK_SIZE);
+          const size = Buffer.alloc(4);
+          size.writeUInt32BE(chunk.length);
+          socket.write(size);
+          socket.write(chunk);
+        }
+        socket.write(Buffer.alloc(4)); // zero-length chunk ends the stream
+      });
+    });
+  }
+}
+
+class NoScanner implements AttachmentScanner {
+  readonly name = 'none';
+
+  async scan(): Promise<ScanResult> {
+    return { status: 'skipped', scanner: this.name };
+  }
+}
+
+const createScanner = (): AttachmentScanner => {
+  switch (env.attachments.scanner) {
+    case 'clamav':
+      return new ClamAvScanner();
+    case '':
+    case 'none':
+      return new NoScanner();
+    default:
+      throw new Error(`Unsupported attachment scanner: ${env.attachments.scanner}`);
+  }
+};
+
+export const attachmentScanner = createScanner();
@@ -0,0 +1,400 @@
+import { getPrisma } from '../config/prisma.js';
+
+export interface BroadcastFilters {
+  company_ids?: string[];
+  agency_ids?: string[];
+  property_ids?: string[];
+}
+
+const ALL_ROLES = [
+  'agency_admin', 'agent', 'landlord', 'tenant', 'caretaker', 'cleaner',
+  'security', 'maintenance', 'receptionist', 'accountant', 'manager',
+];
+
+// target_audience values and the roles they reach
+const AUDIENCE_ROLES: Record<string, string[]> = {
+  all_users: ALL_ROLES,
+  agency_admins: ['agency_admin'],
+  agents: ['agent'],
+  landlords: ['landlord'],
+  tenants: ['tenant'],
+  caretakers: ['caretaker'],
+  staff: ['cleaner'],
+  cleaners: ['cleaner'],
+  security: ['security'],
+  maintenance: ['maintenance'],
+  receptionists: ['receptionist'],
+  accountants: ['accountant'],
+  managers: ['manager'],
+};
+
+// Recipients processed concurrently while fanning out
+const SEND_CONCURRENCY = 20;
+// A 'sending' broadcast whose progress has not moved for this long was interrupted and is resumed
+const SENDING_LEASE = 10 * 60 * 1000;
+// A send that failed part way is retried after this long, skipping recipients already reached
+const RETRY_DELAY = 5 * 60 * 1000;
+
+type Notifications = typeof import('./notifications.service.js').notificationsService;
+type Recipient = Awaited<ReturnType<BroadcastService['resolveAudience']>>[number];
+
+// A broadcast sending right now, as opposed to one left in 'sending' by a run that died
+const staleSending = (now: Date) => ({ status: 'sending', updated_at: { lt: new Date(now.getTime() - SENDING_LEASE) } });
+
+// Replace {{user_name}}-style variables with the recipient's details
+const personalize = (text: string, recipient: { first_name: string; last_name: string; email: string | null; role: string }) => {
+  if (!text) return text;
+  const fullName = `${recipient.first_name} ${recipient.last_name}`.trim();
+  return text
+    .replace(/\{\{(user_name|name)\}\}/gi, fullName)
+    .replace(/\{\{(user_first_name|first_name)\}\}/gi, recipient.first_name || '')
+    .replace(/\{\{(user_last_name|last_name)\}\}/gi, recipient.last_name || '')
+    .replace(/\{\{(user_email|email)\}\}/gi, recipient.email || '')
+    .replace(/\{\{role\}\}/gi, recipient.role || '');
+};
+
+const listOf = (value: unknown): string[] =>
+  Array.isArray(value) ? value.map(String).filter(Boolean) : typeof value === 'string' && value ? value.split(',').map(v => v.trim()).filter(Boolean) : [];
+
+/**
+ * Platform broadcasts: audience resolution by role, company, agency and property, scheduled
+ * sending, fan-out over in-app, push, email and SMS, and per-channel delivery and open stats.
+ * Each recipient gets an in-app notification (related_entity_type 'broadcast') and one
+ * delivery log row per channel attempted.
+ */
+export class BroadcastService {
+  private prisma = getPrisma();
+
+  rolesFor(targetAudience: string | string[] | null | undefined): string[] {
+    const audiences = listOf(targetAudience);
+    return [...new Set((audiences.length ? audiences : ['all_users']).flatMap(a => AUDIENCE_ROLES[a] || []))];
+  }
+
+  parseFilters(filters: any): BroadcastFilters {
+    const parsed: BroadcastFilters = {};
+    for (const key of ['company_ids', 'agency_ids', 'property_ids'] as const) {
+      const values = listOf(filters?.[key]);
+      if (values.length) parsed[key] = values;
+    }
+    return parsed;
+  }
+
+  /**
+   * Active users with a company matching the audience roles and every given filter. A property
+   * filter reaches the owners, tenants on active leases and staff assigned to those properties.
+   */
+  async resolveAudience(targetAudience: string | string[] | null | undefined, targetFilters?: any) {
+    const roles = this.rolesFor(targetAudience);
+    const filters = this.parseFilters(targetFilters);
+    const where: any = {
+      role: { in: roles },
+      status: 'active',
+      company_id: filters.company_ids ? { in: filters.company_ids } : { not: null },
+    };
+    if (filters.agency_ids) {
+      where.agency_id = { in: filters.agency_ids };
+    }
+    if (filters.property_ids) {
+      const [properties, leases, assignments] = await Promise.all([
+        this.prisma.property.findMany({ where: { id: { in: filters.property_ids } }, select: { owner_id: true } }),
+        this.prisma.lease.findMany({ where: { property_id: { in: filters.property_ids }, status: 'active' }, select: { tenant_id: true } }),
+        this.prisma.staffPropertyAssignment.findMany({
+          where: { property_id: { in: filters.property_ids }, status: 'active' },
+          select: { staff_id: true },
+        }),
+      ]);
+      where.id = {
+        in: [...new Set([
+          ...properties.map(p => p.owner_id),
+          ...leases.map(l => l.tenant_id),
+          ...assignments.map(a => a.staff_id),
+        ])],
+      };
+    }
+
+    return this.prisma.user.findMany({
+      where,
+      select: { id: true, email: true, phone_number: true, first_name: true, last_name: true, role: true, company_id: true },
+    });
+  }
+
+  async estimate(targetAudience: string | string[], targetFilters?: any) {
+    const recipients = await this.resolveAudience(targetAudience, targetFilters);
+    return {
+      estimated_count: recipients.length,
+      target_audience: listOf(targetAudience),
+      target_filters: this.parseFilters(targetFilters),
+      roles: this.rolesFor(targetAudience),
+    };
+  }
+
+  async schedule(broadcastId: string, scheduledFor: string | Date) {
+    const when = new Date(scheduledFor);
+    if (isNaN(when.getTime())) {
+      throw new Error('scheduled_for must be a valid date');
+    }
+    if (when.getTime() <= Date.now()) {
+      throw new Error('scheduled_for must be in the future');
+    }
+    const broadcast = await this.prisma.broadcastMessage.findUnique({ where: { id: broadcastId } });
+    if (!broadcast) {
+      throw new Error('Broadcast message not found');
+    }
+    if (!['draft', 'scheduled'].includes(broadcast.status)) {
+      throw new Error(`Broadcast message is already ${broadcast.status}`);
+    }
+    return this.prisma.broadcastMessage.update({
+      where: { id: broadcastId },
+      data: { status: 'scheduled', scheduled_for: when, updated_at: new Date() },
+    });
+  }
+
+  async unschedule(broadcastId: string) {
+    const updated = await this.prisma.broadcastMessage.updateMany({
+      where: { id: broadcastId, status: 'scheduled' },
+      data: { status: 'draft', scheduled_for: null, updated_at: new Date() },
+    });
+    if (!updated.count) {
+      const exists = await this.prisma.broadcastMessage.count({ where: { id: broadcastId } });
+      throw new Error(exists ? 'Only scheduled broadcasts can be unscheduled' : 'Broadcast message not found');
+    }
+    return this.prisma.broadcastMessage.findUniqueOrThrow({ where: { id: broadcastId } });
+  }
+
+  /**
+   * Send a draft or scheduled broadcast now. The status moves to 'sending' first, so a broadcast
+   * picked up by the scheduler and sent by hand at the same time only goes out once.
+   *
+   * Each recipient's notification is their progress record: a send that was interrupted, or that
+   * failed part way and is retried, skips everyone already reached. Progress is saved after every
+   * batch, which also keeps the claim alive; one that stops moving is picked up again.
+   */
+  async send(broadcastId: string, senderId: string | null) {
+    const now = new Date();
+    const claimed = await this.prisma.broadcastMessage.updateMany({
+      where: { id: broadcastId, OR: [{ status: { in: ['draft', 'scheduled'] } }, staleSending(now)] },
+      data: { status: 'sending', updated_at: now },
+    });
+    if (!claimed.count) {
+      const broadcast = await this.prisma.broadcastMessage.findUnique({ where: { id: broadcastId }, select: { status: true } });
+      if (!broadcast) {
+        throw new Error('Broadcast message not found');
+      }
+      throw new Error(`Broadcast message has already been ${broadcast.status === 'sending' ? 'picked up for sending' : broadcast.status}`);
+    }
+
+    const broadcast = await this.prisma.broadcastMessage.findUniqueOrThrow({ where: { id: broadcastId } });
+    const { notificationsService } = await import('./notifications.service.js');
+    try {
+      const [recipients, reached] = await Promise.all([
+        this.resolveAudience(broadcast.target_audience, broadcast.target_filters),
+        this.reachedRecipients(broadcast.id),
+      ]);
+      const pending = recipients.filter(recipient => !reached.has(recipient.id));
+      const alreadyReached = recipients.length - pending.length;
+      console.log(`📢 Sending broadcast ${broadcast.id} to ${pending.length} recipients${alreadyReached ? ` (${alreadyReached} already reached)` : ''}`);
+
+      const totals = { delivered: alreadyReached, notifications: 0, push: 0, email: 0, sms: 0 };
+      await this.saveProgress(broadcast.id, { recipients_count: recipients.length, delivered_count: totals.delivered });
+      for (let i = 0; i < pending.length; i += SEND_CONCURRENCY) {
+        const results = await Promise.all(
+          pending.slice(i, i + SEND_CONCURRENCY).map(recipient => this.deliver(notificationsService, broadcast, recipient, senderId))
+        );
+        for (const channels of results) {
+          if (channels.length) totals.delivered++;
+          if (channels.includes('app')) totals.notifications++;
+          if (channels.includes('push')) totals.push++;
+          if (channels.includes('email')) totals.email++;
+          if (channels.includes('sms')) totals.sms++;
+        }
+        await this.saveProgress(broadcast.id, { delivered_count: totals.delivered });
+      }
+
+      const updated = await this.prisma.broadcastMessage.update({
+        where: { id: broadcast.id },
+        data: {
+          status: 'sent',
+          sent_at: new Date(),
+          recipients_count: recipients.length,
+          delivered_count: totals.delivered,
+          updated_at: new Date(),
+        },
+      });
+      console.log(`✅ Broadcast sent: ${totals.notifications} notifications; queued ${totals.push} push, ${totals.email} emails, ${totals.sms} SMS`);
+      return {
+        id: updated.id,
+        status: updated.status,
+        sent_at: updated.sent_at,
+        recipients_count: recipients.length,
+        delivered_count: totals.delivered,
+        previously_delivered: alreadyReached,
+        notifications_created: totals.notifications,
+        push_queued: totals.push,
+        emails_queued: totals.email,
+        sms_queued: totals.sms,
+      };
+    } catch (error) {
+      // Only a send that reached nobody has failed; otherwise it goes back on the schedule and
+      // the retry carries on from where this one stopped
+      const reached = await this.reachedRecipients(broadcast.id);
+      await this.prisma.broadcastMessage.update({
+        where: { id: broadcast.id },
+        data: reached.size
+          ? { status: 'scheduled', scheduled_for: new Date(Date.now() + RETRY_DELAY), delivered_count: reached.size, updated_at: new Date() }
+          : { status: 'failed', updated_at: new Date() },
+      });
+      throw error;
+    }
+  }
+
+  /**
+   * Users who already have this broadcast's notification
+   */
+  private async reachedRecipients(broadcastId: string) {
+    const notifications = await this.prisma.notification.findMany({
+      where: { related_entity_type: 'broadcast', related_entity_id: broadcastId },
+      select: { recipient_id: true },
+    });
+    return new Set(notifications.map(notification => notification.recipient_id));
+  }
+
+  private async saveProgress(broadcastId: string, progress: { recipients_count?: number; delivered_count: number }) {
+    await this.prisma.broadcastMessage.update({
+      where: { id: broadcastId },
+      data: { ...progress, updated_at: new Date() },
+    });
+  }
+
+  /**
+   * Fan one broadcast out to one recipient: an in-app notification, with push, email and SMS
+   * handed to the delivery queue for the channels they accept. Returns the channels reached or queued.
+   */
+  private async deliver(notificationsService: Notifications, broadcast: any, recipient: Recipient, senderId: string | null) {
+    const title = personalize(broadcast.title, recipient);
+    const message = personalize(broadcast.message, recipient);
+    const priority = broadcast.type === 'alert' ? 'high' : 'medium';
+
+    try {
+      const queued = await notificationsService.resolveChannels(
+        recipient.id,
+        'announcement',
+        [
+          ...(broadcast.send_push ? ['push'] : []),
+          ...(broadcast.send_email && recipient.email ? ['email'] : []),
+          ...(broadcast.send_sms && recipient.phone_number ? ['sms'] : []),
+        ],
+        'property_announcement',
+        priority
+      );
+      const notification = await notificationsService.notify({
+        title,
+        message,
+        notification_type: broadcast.type || 'info',
+        category: broadcast.type || 'general',
+        priority,
+        sender_id: senderId,
+        recipient_id: recipient.id,
+        company_id: recipient.company_id!,
+        related_entity_type: 'broadcast',
+        related_entity_id: broadcast.id,
+        channels: ['app'],
+        metadata: { broadcast_id: broadcast.id },
+      }, queued);
+
+      const now = new Date();
+      await this.prisma.notificationDeliveryLog.create({
+        data: { notification_id: notification.id, user_id: recipient.id, channel: 'app', status: 'delivered', sent_at: now, delivered_at: now },
+      });
+      return ['app', ...queued];
+    } catch (error) {
+      console.error(`Failed to create broadcast notification for user ${recipient.id}:`, error);
+      return [];
+    }
+  }
+
+  /**
+   * Send every scheduled broadcast that has come due, and resume any whose send was interrupted
+   */
+  async processScheduled() {
+    const now = new Date();
+    const due = await this.prisma.broadcastMessage.findMany({
+      where: { OR: [{ status: 'scheduled', scheduled_for: { lte: now } }, staleSending(now)] },
+      select: { id: true, created_by: true },
+      orderBy: { scheduled_for: 'asc' },
+    });
+    let sent = 0;
+    for (const broadcast of due) {
+      try {
+        await this.send(broadcast.id, broadcast.created_by);
+        sent++;
+      } catch (error: any) {
+        console.error(`❌ Failed to send scheduled broadcast ${broadcast.id}:`, error.message);
+      }
+    }
+    return { due: due.length, sent };
+  }
+
+  /**
+   * Recipients, per-channel sent/failed counts, SMS delivery from the gateway's reports and
+   * in-app opens. The stored opened_count is refreshed as a side effect.
+   */
+  async getStats(broadcastId: string) {
+    const broadcast = await this.prisma.broadcastMessage.findUnique({ where: { id: broadcastId } });
+    if (!broadcast) {
+      throw new Error('Broadcast message not found');
+    }
+    const notificationWhere = { related_entity_type: 'broadcast', related_entity_id: broadcastId };
+    const [opened, byChannel, smsLogs] = await Promise.all([
+      this.prisma.notification.count({ where: { ...notificationWhere, is_read: true } }),
+      this.prisma.notificationDeliveryLog.groupBy({
+        by: ['channel', 'status'],
+        where: { notification: notificationWhere },
+        _count: { _all: true },
+      }),
+      this.prisma.notificationDeliveryLog.findMany({
+        where: { notification: notificationWhere, channel: 'sms', status: 'sent' },
+        select: { metadata: true },
+      }),
+    ]);
+
+    // Push, email and SMS go through the delivery queue: still queued, sent, skipped by the
+    // recipient's settings, or dead-lettered once retries ran out
+    const channels: Record<string, { queued: number; sent: number; delivered: number; failed: number }> = {};
+    for (const row of byChannel) {
+      const channel = (channels[row.channel] ||= { queued: 0, sent: 0, delivered: 0, failed: 0 });
+      if (['pending', 'processing', 'retrying'].includes(row.status)) channel.queued += row._count._all;
+      else if (row.status === 'failed' || row.status === 'dead_letter') channel.failed += row._count._all;
+      else if (row.status !== 'skipped') channel.sent += row._count._all;
+      if (row.status === 'delivered') channel.delivered += row._count._all;
+    }
+    const smsIds = smsLogs.map(log => (log.metadata as any)?.sms_message_id).filter(Boolean);
+    if (channels.sms && smsIds.length) {
+      const sms = await this.prisma.smsMessage.groupBy({
+        by: ['status'],
+        where: { id: { in: smsIds } },
+        _count: { _all: true },
+      });
+      channels.sms.delivered = sms.find(s => s.status === 'delivered')?._count._all || 0;
+      const undelivered = sms.filter(s => s.status === 'failed' || s.status === 'rejected').reduce((sum, s) => sum + s._count._all, 0);
+      channels.sms.sent -= undelivered;
+      channels.sms.failed += undelivered;
+    }
+
+    if (opened !== broadcast.opened_count) {
+      await this.prisma.broadcastMessage.update({ where: { id: broadcastId }, data: { opened_count: opened } });
+    }
+    return {
+      id: broadcast.id,
+      status: broadcast.status,
+      scheduled_for: broadcast.scheduled_for,
+      sent_at: broadcast.sent_at,
+      recipients_count: broadcast.recipients_count,
+      delivered_count: broadcast.delivered_count,
+      opened_count: opened,
+      open_rate: broadcast.recipients_count ? Math.round((opened / broadcast.recipients_count) * 1000) / 10 : 0,
+      channels,
+    };
+  }
+}
+
+export const broadcastService = new BroadcastService();
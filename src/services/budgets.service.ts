@@ -0,0 +1,381 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause, formatDataForRole } from '../utils/roleBasedFiltering.js';
+import { EXPENSE_CATEGORIES } from './expenses.service.js';
+
+export const BUDGET_KINDS = ['income', 'expense'];
+// Income is budgeted by payment type; security deposits are held rather than earned
+export const INCOME_CATEGORIES = ['rent', 'utility', 'maintenance', 'late_fee', 'penalty', 'other'];
+
+export interface BudgetLineRequest {
+  kind: string;
+  category: string;
+  amount?: number;
+  monthly_amounts?: number[];
+  notes?: string;
+}
+
+export interface SetBudgetRequest {
+  year: number;
+  lines: BudgetLineRequest[];
+}
+
+export interface BudgetFilters {
+  year?: number;
+  property_id?: string;
+  property_ids?: string[];
+}
+
+// Roles that can set budgets; everyone with budget read access can see variance
+const BUDGET_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const MONTHS = ['Jan', 'Feb', 'Mar', 'Apr', 'May', 'Jun', 'Jul', 'Aug', 'Sep', 'Oct', 'Nov', 'Dec'];
+
+const round = (n: number) => Math.round(n * 100) / 100;
+const yearRange = (year: number) => ({ gte: new Date(Date.UTC(year, 0, 1)), lt: new Date(Date.UTC(year + 1, 0, 1)) });
+const monthKey = (year: number, month: number) => `${year}-${String(month + 1).padStart(2, '0')}`;
+
+/**
+ * Budget for each month of the year: the phased amounts when given, otherwise the annual amount spread evenly
+ */
+export function monthlyBudget(line: { amount: any; monthly_amounts: any }): number[] {
+  const phased = Array.isArray(line.monthly_amounts) ? line.monthly_amounts.map(Number) : [];
+  if (phased.length === 12) return phased;
+  const annual = Number(line.amount);
+  return MONTHS.map(() => annual / 12);
+}
+
+/**
+ * Months of the year that have happened: all of a past year, none of a future one
+ */
+function monthsElapsed(year: number, now: Date): number {
+  const current = now.getUTCFullYear();
+  return year < current ? 12 : year > current ? 0 : now.getUTCMonth() + 1;
+}
+
+/**
+ * Annual income and expense budgets per property, and how actuals compare month by month
+ */
+export class BudgetsService {
+  private prisma = getPrisma();
+
+  async list(user: JWTClaims, filters: BudgetFilters = {}) {
+    const year = Number(filters.year) || new Date().getUTCFullYear();
+    const budgets = await this.prisma.propertyBudget.findMany({
+      where: {
+        year,
+        ...(filters.property_id && { property_id: filters.property_id }),
+        property: buildWhereClause(user),
+      },
+      include: { property: { select: { id: true, name: true } } },
+      orderBy: [{ property_id: 'asc' }, { kind: 'desc' }, { category: 'asc' }],
+    });
+    return {
+      year,
+      budgets: budgets.map(b => ({
+        ...b,
+        amount: Number(b.amount),
+        monthly: monthlyBudget(b).map((amount, i) => ({ month: monthKey(year, i), amount: round(amount) })),
+      })),
+    };
+  }
+
+  /**
+   * Replace a property's budget for a year with the lines given. Lines left out are removed;
+   * lines kept keep their alert history.
+   */
+  async setBudget(propertyId: string, req: SetBudgetRequest, user: JWTClaims) {
+    if (!BUDGET_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to set budgets');
+    }
+    const year = Number(req.year);
+    if (!Number.isInteger(year) || year < 2000 || year > 2100) {
+      throw new Error('year must be a valid year');
+    }
+    if (!Array.isArray(req.lines)) {
+      throw new Error('lines must be a list of budget lines');
+    }
+
+    const property = await this.prisma.property.findFirst({
+      where: { id: propertyId, ...buildWhereClause(user) },
+      select: { id: true, company_id: true },
+    });
+    if (!property) {
+      throw new Error('Property not found');
+    }
+
+    const seen = new Set<string>();
+    const lines = req.lines.map(line => {
+      if (!BUDGET_KINDS.includes(line.kind)) {
+        throw new Error(`kind must be one of: ${BUDGET_KINDS.join(', ')}`);
+      }
+      const categories = line.kind === 'income' ? INCOME_CATEGORIES : EXPENSE_CATEGORIES;
+      if (!categories.includes(line.category)) {
+        throw new Error(`${line.kind} category must be one of: ${categories.join(', ')}`);
+      }
+      const key = `${line.kind}:${line.category}`;
+      if (seen.has(key)) {
+        throw new Error(`${line.kind} category ${line.category} must only appear once`);
+      }
+      seen.add(key);
+
+      let monthly: number[] = [];
+      if (line.monthly_amounts !== undefined && line.monthly_amounts !== null) {
+        monthly = Array.isArray(line.monthly_amounts) ? line.monthly_amounts.map(Number) : [];
+        if (monthly.length !== 12 || monthly.some(n => !Number.isFinite(n) || n < 0)) {
+          throw new Error('monthly_amounts must be 12 amounts of zero or more');
+        }
+      }
+      // Phased budgets total their months; the annual amount is only needed for even spreads
+      const amount = monthly.length ? round(monthly.reduce((sum, n) => sum + n, 0)) : Number(line.amount);
+      if (!Number.isFinite(amount) || amount < 0) {
+        throw new Error('amount must be zero or a positive number');
+      }
+      return { kind: line.kind, category: line.category, amount, monthly_amounts: monthly, notes: line.notes?.trim() || null };
+    });
+
+    await this.prisma.$transaction([
+      this.prisma.propertyBudget.deleteMany({
+        where: {
+          property_id: property.id,
+          year,
+          ...(lines.length && { NOT: lines.map(line => ({ kind: line.kind, category: line.category })) }),
+        },
+      }),
+      ...lines.map(line =>
+        this.prisma.propertyBudget.upsert({
+          where: { property_id_year_kind_category: { property_id: property.id, year, kind: line.kind, category: line.category } },
+          create: { ...line, company_id: property.company_id, property_id: property.id, year, created_by: user.user_id },
+          update: { amount: line.amount, monthly_amounts: line.monthly_amounts, notes: line.notes, updated_at: new Date() },
+        })
+      ),
+    ]);
+
+    return this.list(user, { year, property_id: property.id });
+  }
+
+  async deleteLine(id: string, user: JWTClaims) {
+    if (!BUDGET_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to delete budgets');
+    }
+    const line = await this.prisma.propertyBudget.findFirst({ where: { id, property: buildWhereClause(user) }, select: { id: true } });
+    if (!line) {
+      throw new Error('Budget line not found');
+    }
+    await this.prisma.propertyBudget.delete({ where: { id: line.id } });
+  }
+
+  /**
+   * Budget against actuals for a year, per property and category and month by month. Income
+   * actuals are completed payments by type (less security deposits); expense actuals are
+   * recorded expenses by category. Actuals with no budget line are listed with a zero budget.
+   * Variances are actual minus budget to date, so overspending shows as a positive expense variance.
+   */
+  async getVariance(user: JWTClaims, filters: BudgetFilters = {}, now: Date = new Date()) {
+    const year = Number(filters.year) || now.getUTCFullYear();
+    if (!Number.isInteger(year) || year < 2000 || year > 2100) {
+      throw new Error('year must be a valid year');
+    }
+    const elapsed = monthsElapsed(year, now);
+    const requested = filters.property_ids?.length ? filters.property_ids : filters.property_id ? [filters.property_id] : undefined;
+
+    const properties = await this.prisma.property.findMany({
+      where: { ...buildWhereClause(user), ...(requested && { id: { in: requested } }) },
+      select: { id: true, name: true },
+    });
+    const propertyIds = properties.map(p => p.id);
+    const names = new Map(properties.map(p => [p.id, p.name]));
+
+    const [budgets, payments, expenses] = await Promise.all([
+      this.prisma.propertyBudget.findMany({ where: { property_id: { in: propertyIds }, year } }),
+      this.prisma.payment.findMany({
+        where: {
+          status: { in: ['completed', 'approved'] },
+          payment_type: { not: 'security_deposit' },
+          payment_date: yearRange(year),
+          OR: [{ property_id: { in: propertyIds } }, { property_id: null, unit: { property_id: { in: propertyIds } } }],
+        },
+        select: { amount: true, payment_type: true, payment_date: true, property_id: true, unit: { select: { property_id: true } } },
+      }),
+      this.prisma.expense.findMany({
+        where: {
+          ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+          property_id: { in: propertyIds },
+          expense_date: yearRange(year),
+        },
+        select: { amount: true, category: true, expense_date: true, property_id: true },
+      }),
+    ]);
+
+    type Line = { property_id: string; kind: string; category: string; annual: number; budget: number[]; actual: number[] };
+    const lines = new Map<string, Line>();
+    const line = (propertyId: string, kind: string, category: string) => {
+      const key = `${propertyId}:${kind}:${category}`;
+      if (!lines.has(key)) {
+        lines.set(key, { property_id: propertyId, kind, category, annual: 0, budget: MONTHS.map(() => 0), actual: MONTHS.map(() => 0) });
+      }
+      return lines.get(key)!;
+    };
+    for (const b of budgets) {
+      Object.assign(line(b.property_id, b.kind, b.category), { annual: Number(b.amount), budget: monthlyBudget(b) });
+    }
+    for (const p of payments) {
+      const propertyId = p.property_id || p.unit?.property_id;
+      if (!propertyId) continue;
+      line(propertyId, 'income', p.payment_type).actual[p.payment_date.getUTCMonth()] += Number(p.amount);
+    }
+    for (const e of expenses) {
+      line(e.property_id!, 'expense', e.category).actual[e.expense_date.getUTCMonth()] += Number(e.amount);
+    }
+
+    const toDate = (amounts: number[]) => amounts.slice(0, elapsed).reduce((sum, n) => sum + n, 0);
+    const months = MONTHS.map((label, i) => ({
+      month: monthKey(year, i),
+      label,
+      income_budget: 0,
+      income_actual: 0,
+      expense_budget: 0,
+      expense_actual: 0,
+    }));
+    const rows = [...lines.values()].map(l => {
+      const budgetToDate = toDate(l.budget);
+      const actual = l.actual.reduce((sum, n) => sum + n, 0);
+      const variance = actual - budgetToDate;
+      l.budget.forEach((amount, i) => {
+        months[i][l.kind === 'income' ? 'income_budget' : 'expense_budget'] += amount;
+        months[i][l.kind === 'income' ? 'income_actual' : 'expense_actual'] += l.actual[i];
+      });
+      return {
+        property_id: l.property_id,
+        property_name: names.get(l.property_id) || '',
+        kind: l.kind,
+        category: l.category,
+        annual_budget: round(l.annual),
+        budget_to_date: round(budgetToDate),
+        actual: round(actual),
+        variance: round(variance),
+        variance_pct: budgetToDate > 0 ? round((variance / budgetToDate) * 100) : null,
+        remaining: round(l.annual - actual),
+        favorable: l.kind === 'income' ? variance >= 0 : variance <= 0,
+        over_budget: l.kind === 'expense' && actual > budgetToDate,
+        months: l.budget.map((amount, i) => ({
+          month: monthKey(year, i),
+          budget: round(amount),
+          actual: round(l.actual[i]),
+          variance: round(l.actual[i] - amount),
+        })),
+      };
+    }).sort((a, b) => a.property_name.localeCompare(b.property_name) || b.kind.localeCompare(a.kind) || a.category.localeCompare(b.category));
+
+    const sum = (kind: string, key: 'annual_budget' | 'budget_to_date' | 'actual') =>
+      round(rows.filter(r => r.kind === kind).reduce((total, r) => total + r[key], 0));
+    const incomeBudget = sum('income', 'budget_to_date');
+    const incomeActual = sum('income', 'actual');
+    const expenseBudget = sum('expense', 'budget_to_date');
+    const expenseActual = sum('expense', 'actual');
+
+    return formatDataForRole(user, {
+      year,
+      through_month: elapsed > 0 ? monthKey(year, elapsed - 1) : null,
+      summary: {
+        annualIncomeBudget: sum('income', 'annual_budget'),
+        annualExpenseBudget: sum('expense', 'annual_budget'),
+        incomeBudget,
+        incomeActual,
+        incomeVariance: round(incomeActual - incomeBudget),
+        expenseBudget,
+        expenseActual,
+        expenseVariance: round(expenseActual - expenseBudget),
+        noiBudget: round(incomeBudget - expenseBudget),
+        noiActual: round(incomeActual - expenseActual),
+        linesOverBudget: rows.filter(r => r.over_budget).length,
+      },
+      months: months.map(m => ({
+        month: m.month,
+        label: m.label,
+        income_budget: round(m.income_budget),
+        income_actual: round(m.income_actual),
+        income_variance: round(m.income_actual - m.income_budget),
+        expense_budget: round(m.expense_budget),
+        expense_actual: round(m.expense_actual),
+        expense_variance: round(m.expense_actual - m.expense_budget),
+        noi_budget: round(m.income_budget - m.expense_budget),
+        noi_actual: round(m.income_actual - m.expense_actual),
+      })),
+      lines: rows,
+      alerts: rows.filter(r => r.over_budget).map(r => ({
+        property_id: r.property_id,
+        property_name: r.property_name,
+        category: r.category,
+        budget_to_date: r.budget_to_date,
+        actual: r.actual,
+        overspend: r.variance,
+      })),
+      generatedAt: new Date().toISOString(),
+    });
+  }
+
+  /**
+   * Alert property owners (and whoever set the budget) once a month about expense lines whose
+   * spending so far this year is above budget
+   */
+  async checkOverspend(now: Date = new Date()) {
+    const year = now.getUTCFullYear();
+    const elapsed = monthsElapsed(year, now);
+    const period = monthKey(year, now.getUTCMonth());
+
+    const budgets = await this.prisma.propertyBudget.findMany({
+      where: { year, kind: 'expense', OR: [{ last_alert_period: null }, { last_alert_period: { not: period } }] },
+      include: { property: { select: { name: true, owner_id: true } } },
+    });
+    if (budgets.length === 0) return { alerted: 0 };
+
+    const spent = await this.prisma.expense.groupBy({
+      by: ['property_id', 'category'],
+      where: {
+        property_id: { in: [...new Set(budgets.map(b => b.property_id))] },
+        expense_date: { gte: new Date(Date.UTC(year, 0, 1)), lte: now },
+      },
+      _sum: { amount: true },
+    });
+    const actuals = new Map(spent.map(s => [`${s.property_id}:${s.category}`, Number(s._sum.amount || 0)]));
+
+    const { notificationsService } = await import('./notifications.service.js');
+    let alerted = 0;
+    for (const budget of budgets) {
+      const actual = actuals.get(`${budget.property_id}:${budget.category}`) || 0;
+      const budgetToDate = monthlyBudget(budget).slice(0, elapsed).reduce((sum, n) => sum + n, 0);
+      if (actual <= budgetToDate) continue;
+
+      const category = budget.category.replace(/_/g, ' ');
+      const overspend = round(actual - budgetToDate);
+      const recipients = new Set([budget.property.owner_id, budget.created_by].filter(Boolean) as string[]);
+      try {
+        for (const recipientId of recipients) {
+          const channels = await notificationsService.resolveChannels(recipientId, 'budget_exceeded', ['email'], 'general', 'high');
+          await notificationsService.notify({
+            company_id: budget.company_id,
+            recipient_id: recipientId,
+            title: `Over budget: ${category} at ${budget.property.name}`,
+            message: `${category.replace(/^\w/, c => c.toUpperCase())} spending at ${budget.property.name} is ${round(actual).toLocaleString()} so far in ${year}, ` +
+              `${overspend.toLocaleString()} above the budget of ${round(budgetToDate).toLocaleString()} to date.`,
+            notification_type: 'budget_exceeded',
+            category: 'general',
+            priority: 'high',
+            action_required: true,
+            action_url: `/reports/budget-variance?year=${year}&property_id=${budget.property_id}`,
+            related_entity_type: 'property_budget',
+            related_entity_id: budget.id,
+            metadata: { property_id: budget.property_id, year, category: budget.category, actual: round(actual), budget_to_date: round(budgetToDate) },
+          }, channels);
+        }
+        await this.prisma.propertyBudget.update({ where: { id: budget.id }, data: { last_alert_period: period } });
+        alerted++;
+      } catch (error: any) {
+        console.error('⚠️ Failed to send budget alert:', error.message);
+      }
+    }
+    return { alerted };
+  }
+}
+
+export const budgetsService = new BudgetsService();
@@ -0,0 +1,352 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { staffRosterService } from './staff-roster.service.js';
+
+export interface AssignmentQuery {
+  property_id: string;
+  category?: string;
+  date?: Date;
+  exclude?: string[];
+}
+
+export interface CaretakerCandidate {
+  caretaker: { id: string; first_name: string; last_name: string; email: string | null; phone_number: string | null };
+  score: number;
+  reasons: string[];
+  assigned_to_property: boolean;
+  skill_match: boolean;
+  open_items: number;
+  available: boolean;
+}
+
+export interface MoveEvent {
+  company_id: string;
+  property_id: string;
+  unit_id: string;
+  type: 'move_in' | 'move_out';
+  date: Date;
+  tenant_name?: string;
+}
+
+const OPEN_MAINTENANCE = ['pending', 'in_progress'];
+const OPEN_TASKS = ['pending', 'in_progress', 'overdue'];
+
+// Skills text a caretaker may list for each request category
+const CATEGORY_SKILLS: Record<string, string[]> = {
+  plumbing: ['plumb', 'pipe', 'water'],
+  electrical: ['electric', 'wiring'],
+  hvac: ['hvac', 'air con', 'heating', 'cooling'],
+  appliances: ['appliance'],
+  painting: ['paint'],
+  carpentry: ['carpent', 'wood', 'joinery'],
+  cleaning: ['clean'],
+  security: ['security', 'lock'],
+  pest_control: ['pest', 'fumigat'],
+  landscaping: ['garden', 'landscap'],
+  move_in: ['clean', 'inspect'],
+  move_out: ['inspect', 'clean'],
+};
+
+/**
+ * Scores: +40 assigned to the property (+10 as primary), +30 matching skills,
+ * -5 for every open request or task already on their plate. The property's own caretakers
+ * always rank first. Caretakers who are off duty (leave, off day or not rostered) are listed
+ * for manual overrides but never auto-assigned.
+ */
+export class CaretakerAssignmentService {
+  private prisma = getPrisma();
+
+  async isEnabled(companyId: string): Promise<boolean> {
+    const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+    return ((company?.settings as any) || {}).caretaker_auto_assign !== false;
+  }
+
+  async rankCaretakers(companyId: string, query: AssignmentQuery): Promise<CaretakerCandidate[]> {
+    const caretakers = await this.prisma.user.findMany({
+      where: {
+        company_id: companyId,
+        role: 'caretaker',
+        status: 'active',
+        ...(query.exclude?.length && { id: { notIn: query.exclude } }),
+      },
+      select: {
+        id: true,
+        first_name: true,
+        last_name: true,
+        email: true,
+        phone_number: true,
+        skills: true,
+        property_assignments: {
+          where: { property_id: query.property_id, status: 'active' },
+          select: { is_primary: true },
+        },
+      },
+    });
+    if (caretakers.length === 0) return [];
+
+    const ids = caretakers.map(c => c.id);
+    const date = query.date || new Date();
+    const [requests, tasks, duty] = await Promise.all([
+      this.prisma.maintenanceRequest.groupBy({
+        by: ['assigned_to'],
+        where: { assigned_to: { in: ids }, status: { in: OPEN_MAINTENANCE as any } },
+        _count: { _all: true },
+      }),
+      this.prisma.task.groupBy({
+        by: ['assigned_to'],
+        where: { assigned_to: { in: ids }, status: { in: OPEN_TASKS as any } },
+        _count: { _all: true },
+      }),
+      staffRosterService.getDutyStatus(companyId, ids, date),
+    ]);
+    const workload = new Map<string, number>();
+    for (const row of [...requests, ...tasks]) {
+      workload.set(row.assigned_to!, (workload.get(row.assigned_to!) || 0) + row._count._all);
+    }
+
+    const keywords = query.category
+      ? CATEGORY_SKILLS[query.category.toLowerCase()] || [query.category.toLowerCase().replace(/_/g, ' ')]
+      : [];
+
+    const candidates = caretakers.map(caretaker => {
+      const reasons: string[] = [];
+      let score = 0;
+
+      const assignment = caretaker.property_assignments[0];
+      if (assignment) {
+        score += assignment.is_primary ? 50 : 40;
+        reasons.push(assignment.is_primary ? 'primary caretaker for the property' : 'assigned to the property');
+      }
+
+      const skills = (caretaker.skills || '').toLowerCase();
+      const skillMatch = keywords.some(keyword => skills.includes(keyword));
+      if (skillMatch) {
+        score += 30;
+        reasons.push(`skilled in ${query.category}`);
+      }
+
+      const openItems = workload.get(caretaker.id) || 0;
+      score -= openItems * 5;
+      reasons.push(`${openItems} open item${openItems === 1 ? '' : 's'}`);
+
+      const status = duty.get(caretaker.id);
+      const available = status?.on_duty !== false;
+      if (!available) reasons.push(status!.reason || 'off duty');
+
+      return {
+        caretaker: {
+          id: caretaker.id,
+          first_name: caretaker.first_name,
+          last_name: caretaker.last_name,
+          email: caretaker.email,
+          phone_number: caretaker.phone_number,
+        },
+        score,
+        reasons,
+        assigned_to_property: !!assignment,
+        skill_match: skillMatch,
+        open_items: openItems,
+        available,
+      };
+    });
+
+    return candidates.sort((a, b) =>
+      Number(b.assigned_to_property) - Number(a.assigned_to_property) ||
+      Number(b.available) - Number(a.available) || b.score - a.score || a.open_items - b.open_items);
+  }
+
+  async pickBest(companyId: string, query: AssignmentQuery): Promise<CaretakerCandidate | null> {
+    const candidates = await this.rankCaretakers(companyId, query);
+    return candidates.find(candidate => candidate.available) || null;
+  }
+
+  /**
+   * Ranked candidates with the reasoning behind each score, for staff choosing a manual override
+   */
+  async getSuggestions(query: { property_id?: string; category?: string; date?: string }, user: JWTClaims) {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    if (!query.property_id) {
+      throw new Error('property_id is required');
+    }
+    const property = await this.prisma.property.findFirst({
+      where: { id: query.property_id, company_id: user.company_id },
+      select: { id: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+    const date = query.date ? new Date(query.date) : new Date();
+    if (isNaN(date.getTime())) {
+      throw new Error('date must be a valid date');
+    }
+    return this.rankCaretakers(user.company_id, { property_id: property.id, category: query.category, date });
+  }
+
+  async getSettings(user: JWTClaims) {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    return { enabled: await this.isEnabled(user.company_id) };
+  }
+
+  async updateSettings(req: { enabled?: boolean }, user: JWTClaims) {
+    if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
+      throw new Error('insufficient permissions to change caretaker auto-assignment');
+    }
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    if (typeof req.enabled !== 'boolean') {
+      throw new Error('enabled must be true or false');
+    }
+    const company = await this.prisma.company.findUnique({ where: { id: user.company_id }, select: { settings: true } });
+    await this.prisma.company.update({
+      where: { id: user.company_id },
+      data: { settings: { ...((company?.settings as any) || {}), caretaker_auto_assign: req.enabled }, updated_at: new Date() },
+    });
+    return { enabled: req.enabled };
+  }
+
+  /**
+   * Raise a move-in preparation or move-out walkthrough task for the best caretaker
+   */
+  async createMoveTask(event: MoveEvent, actorId: string): Promise<any | null> {
+    if (!(await this.isEnabled(event.company_id))) return null;
+    const best = await this.pickBest(event.company_id, { property_id: event.property_id, category: event.type, date: event.date });
+    if (!best) return null;
+
+    const unit = await this.prisma.unit.findUnique({
+      where: { id: event.unit_id },
+      select: { unit_number: true, property: { select: { name: true } } },
+    });
+    const location = `${unit?.property.name}, Unit ${unit?.unit_number}`;
+    const title = event.type === 'move_in' ? `Prepare ${location} for move-in` : `Move-out walkthrough: ${location}`;
+    const task = await this.prisma.task.create({
+      data: {
+        company_id: event.company_id,
+        title,
+        description: event.type === 'move_in'
+          ? `Clean and check the unit, test keys, meters and fittings before ${event.tenant_name || 'the tenant'} moves in.`
+          : `Walk through the unit with ${event.tenant_name || 'the tenant'}, collect keys and note any damage for the move-out inspection.`,
+        priority: 'medium',
+        status: 'pending',
+        assigned_to: best.caretaker.id,
+        assigned_by: actorId,
+        property_id: event.property_id,
+        unit_id: event.unit_id,
+        due_date: event.date,
+        source: event.type,
+        auto_assigned: true,
+      },
+    });
+
+    await this.notify(event.company_id, best.caretaker.id, 'New task assigned to you', `${title} (due ${event.date.toLocaleDateString()})`, {
+      property_id: event.property_id,
+      unit_id: event.unit_id,
+      related_entity_type: 'task',
+      related_entity_id: task.id,
+    });
+    return task;
+  }
+
+  /**
+   * Hand a task to another caretaker: the given one (manual override) or the next best pick
+   */
+  async reassignTask(taskId: string, req: { caretaker_id?: string; note?: string }, user: JWTClaims): Promise<any> {
+    if (!['super_admin', 'agency_admin', 'landlord', 'agent'].includes(user.role)) {
+      throw new Error('insufficient permissions to reassign tasks');
+    }
+    const task = await this.prisma.task.findFirst({ where: { id: taskId, company_id: user.company_id! } });
+    if (!task) {
+      throw new Error('task not found');
+    }
+    if (['completed', 'cancelled'].includes(task.status)) {
+      throw new Error(`task is already ${task.status}`);
+    }
+
+    let assigneeId = req.caretaker_id;
+    if (assigneeId) {
+      const assignee = await this.prisma.user.findFirst({
+        where: { id: assigneeId, company_id: task.company_id, status: 'active', role: { not: 'tenant' } },
+        select: { id: true },
+      });
+      if (!assignee) {
+        throw new Error('assignee not found in this company');
+      }
+    } else {
+      if (!task.property_id) {
+        throw new Error('caretaker_id is required for tasks without a property');
+      }
+      const best = await this.pickBest(task.company_id, {
+        property_id: task.property_id,
+        category: task.source || undefined,
+        date: task.due_date || new Date(),
+        exclude: [task.assigned_to],
+      });
+      if (!best) {
+        throw new Error('no other caretaker found for this property');
+      }
+      assigneeId = best.caretaker.id;
+    }
+
+    const updated = await this.prisma.task.update({
+      where: { id: taskId },
+      data: {
+        assigned_to: assigneeId,
+        assigned_by: user.user_id,
+        auto_assigned: !req.caretaker_id,
+        ...(req.note && { notes: [task.notes, `Reassigned: ${req.note}`].filter(Boolean).join('\n') }),
+        updated_at: new Date(),
+      },
+      include: {
+        assignedTo: { select: { id: true, first_name: true, last_name: true, email: true, role: true } },
+        property: { select: { id: true, name: true } },
+        unit: { select: { id: true, unit_number: true } },
+      },
+    });
+
+    if (assigneeId !== task.assigned_to) {
+      await this.notify(task.company_id, assigneeId, 'Task assigned to you', task.title, {
+        property_id: task.property_id,
+        unit_id: task.unit_id,
+        related_entity_type: 'task',
+        related_entity_id: task.id,
+      });
+      await this.notify(task.company_id, task.assigned_to, 'Task reassigned', `${task.title} has been reassigned.`, {
+        property_id: task.property_id,
+        unit_id: task.unit_id,
+        related_entity_type: 'task',
+        related_entity_id: task.id,
+      });
+    }
+    return updated;
+  }
+
+  private async notify(companyId: string, recipientId: string, title: string, message: string, context: {
+    property_id?: string | null;
+    unit_id?: string | null;
+    related_entity_type: string;
+    related_entity_id: string;
+  }) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: companyId,
+        recipient_id: recipientId,
+        title,
+        message,
+        notification_type: 'task',
+        category: 'task',
+        priority: 'medium',
+        action_required: true,
+        ...context,
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to send task notification:', error.message);
+    }
+  }
+}
+
+export const caretakerAssignmentService = new CaretakerAssignmentService();
@@ -0,0 +1,337 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildExcelWorkbook, summarySheet, ExcelColumnType } from '../utils/excel-export.js';
+import { caretakerPerformanceService } from './caretaker-performance.service.js';
+
+export interface PayrollBonusTier {
+  min_score: number;
+  percent: number;
+}
+
+export interface PayrollSettings {
+  currency: string;
+  bonus_tiers: PayrollBonusTier[];
+  // Percentage of base salary withheld when the performance score falls below the threshold
+  low_score_threshold: number | null;
+  low_score_deduction_percent: number;
+  deduct_unpaid_leave: boolean;
+}
+
+export interface PayrollLine {
+  staff_id: string;
+  staff_number: string | null;
+  name: string;
+  role: string;
+  email: string | null;
+  month: string;
+  currency: string;
+  base_salary: number;
+  performance_score: number | null;
+  performance_bonus: number;
+  unpaid_leave_days: number;
+  unpaid_leave_deduction: number;
+  performance_deduction: number;
+  total_deductions: number;
+  net_pay: number;
+}
+
+export const DEFAULT_PAYROLL_SETTINGS: PayrollSettings = {
+  currency: 'KES',
+  bonus_tiers: [
+    { min_score: 90, percent: 10 },
+    { min_score: 75, percent: 5 },
+  ],
+  low_score_threshold: null,
+  low_score_deduction_percent: 0,
+  deduct_unpaid_leave: true,
+};
+
+const PAYROLL_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const PAYROLL_STAFF = ['caretaker', 'cleaner', 'security', 'maintenance', 'receptionist', 'accountant'];
+const DAY = 24 * 60 * 60 * 1000;
+
+const money = (value: number) => Math.round(value * 100) / 100;
+const csvCell = (value: string | number | null) =>
+  value === null ? '' : typeof value === 'number' ? String(value) : `"${value.replace(/"/g, '""')}"`;
+
+const COLUMNS: Array<[keyof PayrollLine, string, ExcelColumnType?]> = [
+  ['staff_number', 'Staff Number'],
+  ['name', 'Name'],
+  ['role', 'Role'],
+  ['month', 'Month'],
+  ['currency', 'Currency'],
+  ['base_salary', 'Base Salary', 'currency'],
+  ['performance_score', 'Performance Score', 'number'],
+  ['performance_bonus', 'Performance Bonus', 'currency'],
+  ['unpaid_leave_days', 'Unpaid Leave Days', 'number'],
+  ['unpaid_leave_deduction', 'Unpaid Leave Deduction', 'currency'],
+  ['performance_deduction', 'Performance Deduction', 'currency'],
+  ['total_deductions', 'Total Deductions', 'currency'],
+  ['net_pay', 'Net Pay', 'currency'],
+];
+
+/**
+ * Monthly payroll for salaried staff: base salary from the staff record, a bonus or deduction
+ * tied to the month's performance score, and a pro-rata deduction for approved unpaid leave
+ */
+export class CaretakerPayrollService {
+  private prisma = getPrisma();
+
+  async getSettings(companyId: string): Promise<PayrollSettings> {
+    const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+    return { ...DEFAULT_PAYROLL_SETTINGS, ...(((company?.settings as any) || {}).payroll || {}) };
+  }
+
+  async getPayrollSettings(user: JWTClaims): Promise<PayrollSettings> {
+    return this.getSettings(this.companyFor(user));
+  }
+
+  async updatePayrollSettings(req: Partial<PayrollSettings>, user: JWTClaims): Promise<PayrollSettings> {
+    if (!PAYROLL_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to change payroll settings');
+    }
+    const companyId = this.companyFor(user);
+    const next = { ...(await this.getSettings(companyId)), ...req };
+
+    if (typeof next.currency !== 'string' || !/^[A-Z]{3}$/.test(next.currency)) {
+      throw new Error('currency must be a 3-letter ISO code');
+    }
+    if (!Array.isArray(next.bonus_tiers)) {
+      throw new Error('bonus_tiers must be a list of { min_score, percent }');
+    }
+    next.bonus_tiers = next.bonus_tiers.map((tier) => {
+      const minScore = Number(tier?.min_score);
+      const percent = Number(tier?.percent);
+      if (!(minScore >= 0 && minScore <= 100) || !(percent >= 0 && percent <= 100)) {
+        throw new Error('bonus tier min_score and percent must be between 0 and 100');
+      }
+      return { min_score: minScore, percent };
+    }).sort((a, b) => b.min_score - a.min_score);
+    next.low_score_threshold = next.low_score_threshold == null ? null : Number(next.low_score_threshold);
+    if (next.low_score_threshold !== null && !(next.low_score_threshold >= 0 && next.low_score_threshold <= 100)) {
+      throw new Error('low_score_threshold must be between 0 and 100');
+    }
+    next.low_score_deduction_percent = Number(next.low_score_deduction_percent) || 0;
+    if (!(next.low_score_deduction_percent >= 0 && next.low_score_deduction_percent <= 100)) {
+      throw new Error('low_score_deduction_percent must be between 0 and 100');
+    }
+    next.deduct_unpaid_leave = next.deduct_unpaid_leave !== false;
+
+    const settings: PayrollSettings = {
+      currency: next.currency,
+      bonus_tiers: next.bonus_tiers,
+      low_score_threshold: next.low_score_threshold,
+      low_score_deduction_percent: next.low_score_deduction_percent,
+      deduct_unpaid_leave: next.deduct_unpaid_leave,
+    };
+    const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+    await this.prisma.company.update({
+      where: { id: companyId },
+      data: { settings: { ...((company?.settings as any) || {}), payroll: settings }, updated_at: new Date() },
+    });
+    return settings;
+  }
+
+  /**
+   * Payroll lines for every active salaried staff member in the company for a YYYY-MM month
+   */
+  async getPayroll(query: { month?: string; role?: string; company_id?: string }, user: JWTClaims) {
+    if (!PAYROLL_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view payroll');
+    }
+    const companyId = this.companyFor(user, query.company_id);
+    const month = this.parseMonth(query.month);
+    if (query.role && !PAYROLL_STAFF.includes(query.role)) {
+      throw new Error(`role must be one of: ${PAYROLL_STAFF.join(', ')}`);
+    }
+
+    const staff = await this.prisma.user.findMany({
+      where: {
+        company_id: companyId,
+        role: (query.role ? query.role : { in: PAYROLL_STAFF }) as any,
+        status: 'active',
+        monthly_salary: { gt: 0 },
+      },
+      select: { id: true, first_name: true, last_name: true, email: true, role: true, staff_number: true, monthly_salary: true },
+      orderBy: [{ role: 'asc' }, { first_name: 'asc' }],
+    });
+    const settings = await this.getSettings(companyId);
+    const lines: PayrollLine[] = [];
+    for (const member of staff) {
+      lines.push(await this.computeLine(member, month, settings));
+    }
+
+    return {
+      month: month.label,
+      currency: settings.currency,
+      lines,
+      totals: {
+        staff: lines.length,
+        base_salary: money(lines.reduce((sum, l) => sum + l.base_salary, 0)),
+        bonuses: money(lines.reduce((sum, l) => sum + l.performance_bonus, 0)),
+        deductions: money(lines.reduce((sum, l) => sum + l.total_deductions, 0)),
+        net_pay: money(lines.reduce((sum, l) => sum + l.net_pay, 0)),
+      },
+    };
+  }
+
+  async exportPayroll(query: { month?: string; role?: string; company_id?: string }, format: string, user: JWTClaims): Promise<string | Buffer> {
+    const payroll = await this.getPayroll(query, user);
+    const rows = payroll.lines.map((line) => COLUMNS.map(([key]) => line[key] as string | number | null));
+
+    if (['xlsx', 'excel'].includes(format)) {
+      return buildExcelWorkbook([
+        summarySheet('Summary', [
+          ['Month', payroll.month],
+          ['Currency', payroll.currency],
+          ['Staff', payroll.totals.staff],
+          ['Base Salary', payroll.totals.base_salary],
+          ['Bonuses', payroll.totals.bonuses],
+          ['Deductions', payroll.totals.deductions],
+          ['Net Pay', payroll.totals.net_pay],
+        ]),
+        { name: `Payroll ${payroll.month}`, columns: COLUMNS.map(([, header, type]) => ({ header, type })), rows },
+      ]);
+    }
+    if (format === 'csv') {
+      return [COLUMNS.map(([, label]) => label).join(','), ...rows.map((row) => row.map(csvCell).join(','))].join('\n') + '\n';
+    }
+    throw new Error('format must be csv or xlsx');
+  }
+
+  /**
+   * A single staff member's payslip as PDF; staff may download their own
+   */
+  async getPayslipPdf(staffId: string, monthParam: string | undefined, user: JWTClaims) {
+    if (!PAYROLL_ROLES.includes(user.role) && staffId !== user.user_id) {
+      throw new Error('insufficient permissions to view this payslip');
+    }
+    const member = await this.prisma.user.findFirst({
+      where: { id: staffId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, company_id: true, first_name: true, last_name: true, email: true, role: true, staff_number: true, monthly_salary: true },
+    });
+    if (!member || !member.company_id) {
+      throw new Error('staff member not found');
+    }
+    if (!member.monthly_salary) {
+      throw new Error('staff member has no monthly salary set');
+    }
+    const month = this.parseMonth(monthParam);
+    const settings = await this.getSettings(member.company_id);
+    const line = await this.computeLine(member, month, settings);
+    const amount = (value: number) => `${line.currency} ${value.toLocaleString()}`;
+
+    const rows = [
+      { item: 'Earnings', description: 'Base salary', amount: amount(line.base_salary) },
+      ...(line.performance_bonus > 0
+        ? [{ item: 'Earnings', description: `Performance bonus (score ${line.performance_score})`, amount: amount(line.performance_bonus) }]
+        : []),
+      ...(line.unpaid_leave_deduction > 0
+        ? [{ item: 'Deduction', description: `Unpaid leave (${line.unpaid_leave_days} days)`, amount: `-${amount(line.unpaid_leave_deduction)}` }]
+        : []),
+      ...(line.performance_deduction > 0
+        ? [{ item: 'Deduction', description: `Performance below target (score ${line.performance_score})`, amount: `-${amount(line.performance_deduction)}` }]
+        : []),
+    ];
+
+    const { documentService } = await import('../modules/documents/document-service.js');
+    return documentService.getReportPdf(
+      'payslip',
+      `Payslip — ${line.name}, ${month.label}`,
+      rows,
+      {
+        staff_number: line.staff_number || '',
+        role: line.role,
+        month: month.label,
+        gross_pay: amount(money(line.base_salary + line.performance_bonus)),
+        total_deductions: amount(line.total_deductions),
+        net_pay: amount(line.net_pay),
+      },
+      { ...user, company_id: member.company_id }
+    );
+  }
+
+  private async computeLine(
+    member: { id: string; first_name: string; last_name: string; email: string | null; role: string; staff_number: string | null; monthly_salary: number | null },
+    month: { label: string; start: Date; end: Date },
+    settings: PayrollSettings
+  ): Promise<PayrollLine> {
+    const base = money(member.monthly_salary || 0);
+    const metrics = await caretakerPerformanceService.getMetrics(member.id, { from: month.start, to: month.end });
+    const score = metrics.score;
+
+    const tier = score === null ? undefined : settings.bonus_tiers.find((t) => score >= t.min_score);
+    const bonus = tier ? money((base * tier.percent) / 100) : 0;
+    const performanceDeduction =
+      score !== null && settings.low_score_threshold !== null && score < settings.low_score_threshold
+        ? money((base * settings.low_score_deduction_percent) / 100)
+        : 0;
+
+    let unpaidDays = 0;
+    if (settings.deduct_unpaid_leave) {
+      const leaves = await this.prisma.staffLeave.findMany({
+        where: { staff_id: member.id, leave_type: 'unpaid', status: 'approved', start_date: { lte: month.end }, end_date: { gte: month.start } },
+        select: { start_date: true, end_date: true },
+      });
+      for (const leave of leaves) {
+        const from = Math.max(leave.start_date.getTime(), month.start.getTime());
+        const to = Math.min(leave.end_date.getTime(), month.end.getTime());
+        unpaidDays += Math.floor((to - from) / DAY) + 1;
+      }
+    }
+    const daysInMonth = Math.round((month.end.getTime() - month.start.getTime()) / DAY);
+    const leaveDeduction = money((base / daysInMonth) * unpaidDays);
+    const totalDeductions = money(Math.min(base + bonus, leaveDeduction + performanceDeduction));
+
+    return {
+      staff_id: member.id,
+      staff_number: member.staff_number,
+      name: `${member.first_name} ${member.last_name}`,
+      role: member.role,
+      email: member.email,
+      month: month.label,
+      currency: settings.currency,
+      base_salary: base,
+      performance_score: score,
+      performance_bonus: bonus,
+      unpaid_leave_days: unpaidDays,
+      unpaid_leave_deduction: leaveDeduction,
+      performance_deduction: performanceDeduction,
+      total_deductions: totalDeductions,
+      net_pay: money(base + bonus - totalDeductions),
+    };
+  }
+
+  /**
+   * YYYY-MM (defaults to the previous month) as a UTC [start, end] range
+   */
+  private parseMonth(value?: string): { label: string; start: Date; end: Date } {
+    let year: number;
+    let monthIndex: number;
+    if (value) {
+      const match = /^(\d{4})-(\d{2})$/.exec(value);
+      if (!match || Number(match[2]) < 1 || Number(match[2]) > 12) {
+        throw new Error('month must be in YYYY-MM format');
+      }
+      year = Number(match[1]);
+      monthIndex = Number(match[2]) - 1;
+    } else {
+      const now = new Date();
+      year = now.getUTCFullYear();
+      monthIndex = now.getUTCMonth() - 1;
+    }
+    const start = new Date(Date.UTC(year, monthIndex, 1));
+    const end = new Date(Date.UTC(year, monthIndex + 1, 1) - 1);
+    return { label: start.toISOString().slice(0, 7), start, end };
+  }
+
+  private companyFor(user: JWTClaims, requested?: string): string {
+    const companyId = user.role === 'super_admin' && requested ? requested : user.company_id;
+    if (!companyId) {
+      throw new Error('User must be associated with a company');
+    }
+    return companyId;
+  }
+}
+
+export const caretakerPayrollService = new CaretakerPayrollService();
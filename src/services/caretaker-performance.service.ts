@@ -0,0 +1,252 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface PerformancePeriodQuery {
+  period?: string;
+  from?: string;
+  to?: string;
+}
+
+export interface PerformanceMetrics {
+  staff_id: string;
+  period: { from: Date; to: Date };
+  tasks: {
+    assigned: number;
+    completed: number;
+    completion_rate: number | null;
+    on_time_rate: number | null;
+    overdue_open: number;
+    avg_completion_hours: number | null;
+  };
+  maintenance: {
+    assigned: number;
+    completed: number;
+    avg_response_minutes: number | null;
+    avg_resolution_hours: number | null;
+    response_sla_compliance: number | null;
+    resolution_sla_compliance: number | null;
+  };
+  satisfaction: {
+    average_rating: number | null;
+    ratings: number;
+    distribution: Record<string, number>;
+  };
+  attendance: {
+    check_ins: number;
+    flagged_locations: number;
+  };
+  score: number | null;
+}
+
+const DAY = 24 * 60 * 60 * 1000;
+const PERIOD_DAYS: Record<string, number> = { week: 7, month: 30, quarter: 91, year: 365 };
+const OPEN_TASKS = ['pending', 'in_progress', 'overdue'];
+const REVIEWER_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+
+const average = (values: number[]): number | null =>
+  values.length ? Math.round((values.reduce((sum, v) => sum + v, 0) / values.length) * 10) / 10 : null;
+const rate = (part: number, total: number): number | null =>
+  total ? Math.round((part / total) * 1000) / 10 : null;
+
+/**
+ * Caretaker performance derived from tasks, maintenance requests (SLA deadlines and
+ * tenant ratings) and check-ins. Rates are percentages; null when there is nothing to measure.
+ */
+export class CaretakerPerformanceService {
+  private prisma = getPrisma();
+
+  resolvePeriod(query: PerformancePeriodQuery): { from: Date; to: Date } {
+    const to = query.to ? new Date(query.to) : new Date();
+    const days = PERIOD_DAYS[query.period || 'month'];
+    if (query.period && !days && !query.from) {
+      throw new Error(`period must be one of: ${Object.keys(PERIOD_DAYS).join(', ')}`);
+    }
+    const from = query.from ? new Date(query.from) : new Date(to.getTime() - (days || 30) * DAY);
+    if (isNaN(from.getTime()) || isNaN(to.getTime())) {
+      throw new Error('from and to must be valid dates');
+    }
+    if (from > to) {
+      throw new Error('from must be before to');
+    }
+    return { from, to };
+  }
+
+  async getMetrics(staffId: string, period: { from: Date; to: Date }): Promise<PerformanceMetrics> {
+    const [metrics] = await this.getMetricsFor([staffId], period);
+    return metrics;
+  }
+
+  /**
+   * Metrics for several staff members from one set of queries across all of them: counts are
+   * grouped in the database, and only the rows needed for timings are loaded
+   */
+  async getMetricsFor(staffIds: string[], period: { from: Date; to: Date }): Promise<PerformanceMetrics[]> {
+    if (!staffIds.length) return [];
+    const { from, to } = period;
+    const inPeriod = { gte: from, lte: to };
+    const staff = { in: staffIds };
+
+    const [tasksAssigned, tasksCompleted, overdueOpen, requestsAssigned, requestsCompleted, ratings, checkIns, flagged] = await Promise.all([
+      this.prisma.task.groupBy({
+        by: ['assigned_to', 'status'],
+        where: { assigned_to: staff, created_at: inPeriod },
+        _count: { _all: true },
+      }),
+      this.prisma.task.findMany({
+        where: { assigned_to: staff, status: 'completed', completed_at: inPeriod },
+        select: { assigned_to: true, started_at: true, completed_at: true, due_date: true, created_at: true },
+      }),
+      this.prisma.task.groupBy({
+        by: ['assigned_to'],
+        where: { assigned_to: staff, status: { in: OPEN_TASKS as any }, due_date: { lt: new Date() } },
+        _count: { _all: true },
+      }),
+      this.prisma.maintenanceRequest.findMany({
+        where: { assigned_to: staff, assigned_at: inPeriod },
+        select: { assigned_to: true, assigned_at: true, first_response_at: true, response_due_at: true },
+      }),
+      this.prisma.maintenanceRequest.findMany({
+        where: { assigned_to: staff, status: 'completed', resolved_at: inPeriod },
+        select: { assigned_to: true, assigned_at: true, created_at: true, resolved_at: true, resolution_due_at: true },
+      }),
+      this.prisma.maintenanceRequest.groupBy({
+        by: ['assigned_to', 'tenant_rating'],
+        where: { assigned_to: staff, tenant_rating: { not: null }, tenant_rated_at: inPeriod },
+        _count: { _all: true },
+      }),
+      this.prisma.taskLocationEvent.groupBy({
+        by: ['user_id'],
+        where: { user_id: staff, event_type: 'check_in', recorded_at: inPeriod },
+        _count: { _all: true },
+      }),
+      this.prisma.taskLocationEvent.groupBy({
+        by: ['user_id'],
+        where: { user_id: staff, flagged: true, recorded_at: inPeriod },
+        _count: { _all: true },
+      }),
+    ]);
+
+    return staffIds.map(staffId => {
+      const assigned = tasksAssigned.filter(g => g.assigned_to === staffId);
+      const completedTasks = tasksCompleted.filter(task => task.assigned_to === staffId);
+      const withDue = completedTasks.filter(task => task.due_date);
+      const onTime = withDue.filter(task => task.completed_at! <= task.due_date!).length;
+      const completionHours = completedTasks
+        .map(task => (task.completed_at!.getTime() - (task.started_at || task.created_at).getTime()) / (60 * 60 * 1000))
+        .filter(hours => hours >= 0);
+      const assignedCount = assigned.reduce((sum, g) => sum + g._count._all, 0);
+      const completedCount = assigned.filter(g => g.status === 'completed').reduce((sum, g) => sum + g._count._all, 0);
+
+      const requests = requestsAssigned.filter(r => r.assigned_to === staffId);
+      const responseMinutes = requests
+        .filter(r => r.assigned_at && r.first_response_at && r.first_response_at >= r.assigned_at)
+        .map(r => (r.first_response_at!.getTime() - r.assigned_at!.getTime()) / 60000);
+      const responseTracked = requests.filter(r => r.response_due_at && r.first_response_at);
+      const responseMet = responseTracked.filter(r => r.first_response_at! <= r.response_due_at!).length;
+
+      const resolved = requestsCompleted.filter(r => r.assigned_to === staffId);
+      const resolutionHours = resolved
+        .map(r => (r.resolved_at!.getTime() - (r.assigned_at || r.created_at).getTime()) / (60 * 60 * 1000))
+        .filter(hours => hours >= 0);
+      const resolutionTracked = resolved.filter(r => r.resolution_due_at);
+      const resolutionMet = resolutionTracked.filter(r => r.resolved_at! <= r.resolution_due_at!).length;
+
+      const distribution: Record<string, number> = { '1': 0, '2': 0, '3': 0, '4': 0, '5': 0 };
+      let ratingCount = 0;
+      let ratingTotal = 0;
+      ratings.filter(g => g.assigned_to === staffId).forEach(g => {
+        distribution[String(g.tenant_rating)] += g._count._all;
+        ratingCount += g._count._all;
+        ratingTotal += g.tenant_rating! * g._count._all;
+      });
+
+      const metrics: PerformanceMetrics = {
+        staff_id: staffId,
+        period,
+        tasks: {
+          assigned: assignedCount,
+          completed: completedTasks.length,
+          completion_rate: rate(completedCount, assignedCount),
+          on_time_rate: rate(onTime, withDue.length),
+          overdue_open: overdueOpen.find(g => g.assigned_to === staffId)?._count._all || 0,
+          avg_completion_hours: average(completionHours),
+        },
+        maintenance: {
+          assigned: requests.length,
+          completed: resolved.length,
+          avg_response_minutes: average(responseMinutes),
+          avg_resolution_hours: average(resolutionHours),
+          response_sla_compliance: rate(responseMet, responseTracked.length),
+          resolution_sla_compliance: rate(resolutionMet, resolutionTracked.length),
+        },
+        satisfaction: {
+          average_rating: ratingCount ? Math.round((ratingTotal / ratingCount) * 10) / 10 : null,
+          ratings: ratingCount,
+          distribution,
+        },
+        attendance: {
+          check_ins: checkIns.find(g => g.user_id === staffId)?._count._all || 0,
+          flagged_locations: flagged.find(g => g.user_id === staffId)?._count._all || 0,
+        },
+        score: null,
+      };
+      metrics.score = this.score(metrics);
+      return metrics;
+    });
+  }
+
+  /**
+   * 0-100 composite: resolution SLA compliance 40%, on-time tasks 30%, tenant rating 30%,
+   * re-weighted over whichever parts have data
+   */
+  score(metrics: PerformanceMetrics): number | null {
+    const parts: [number | null, number][] = [
+      [metrics.maintenance.resolution_sla_compliance, 0.4],
+      [metrics.tasks.on_time_rate, 0.3],
+      [metrics.satisfaction.average_rating !== null ? (metrics.satisfaction.average_rating / 5) * 100 : null, 0.3],
+    ];
+    const present = parts.filter(([value]) => value !== null) as [number, number][];
+    if (!present.length) return null;
+    const weight = present.reduce((sum, [, w]) => sum + w, 0);
+    return Math.round(present.reduce((sum, [value, w]) => sum + value * w, 0) / weight);
+  }
+
+  async getCaretakerPerformance(staffId: string, query: PerformancePeriodQuery, user: JWTClaims) {
+    // Staff may always see their own numbers
+    if (!REVIEWER_ROLES.includes(user.role) && staffId !== user.user_id) {
+      throw new Error('insufficient permissions to view other caretakers\' performance');
+    }
+    const staff = await this.prisma.user.findFirst({
+      where: { id: staffId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }), role: { not: 'tenant' } },
+      select: { id: true },
+    });
+    if (!staff) {
+      throw new Error('caretaker not found');
+    }
+    return this.getMetrics(staff.id, this.resolvePeriod(query));
+  }
+
+  /**
+   * All active caretakers in the company ranked by score
+   */
+  async getLeaderboard(query: PerformancePeriodQuery & { property_id?: string }, user: JWTClaims) {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    const period = this.resolvePeriod(query);
+    const caretakers = await this.prisma.user.findMany({
+      where: {
+        company_id: user.company_id,
+        role: 'caretaker',
+        status: 'active',
+        ...(query.property_id && { property_assignments: { some: { property_id: query.property_id, status: 'active' } } }),
+      },
+      select: { id: true, first_name: true, last_name: true },
+    });
+    const metrics = await this.getMetricsFor(caretakers.map(caretaker => caretaker.id), period);
+    const rows = caretakers.map((caretaker, index) => ({ caretaker, ...metrics[index] }));
+    return rows.sort((a, b) => (b.score ?? -1) - (a.score ?? -1));
+  }
+}
+
+export const caretakerPerformanceService = new CaretakerPerformanceService();
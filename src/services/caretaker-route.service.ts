@@ -0,0 +1,302 @@
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { distanceInMeters } from './task-location.service.js';
+
+export interface DailyRouteQuery {
+  staff_id?: string;
+  date?: string;
+  start_latitude?: string;
+  start_longitude?: string;
+  start_time?: string;
+  use_distance_matrix?: string;
+}
+
+interface RouteJob {
+  type: 'task' | 'maintenance';
+  id: string;
+  title: string;
+  priority: string;
+  status: string;
+  due_at: Date | null;
+  unit_number: string | null;
+  service_minutes: number;
+}
+
+interface RouteStop {
+  property: { id: string; name: string; address: string; latitude: number | null; longitude: number | null };
+  jobs: RouteJob[];
+  priority: string;
+}
+
+const PLANNER_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+const PRIORITY_RANK: Record<string, number> = { urgent: 3, high: 2, medium: 1, low: 0 };
+// Nearest-neighbour distances are divided by these, so higher priority wins over a slightly closer stop
+const PRIORITY_WEIGHT: Record<string, number> = { urgent: 1, high: 1.5, medium: 1, low: 0.75 };
+const DEFAULT_TASK_MINUTES = 30;
+const MAINTENANCE_MINUTES = 60;
+// Straight-line estimates: urban average speed and a factor for roads not being straight
+const AVERAGE_SPEED_KMH = 25;
+const ROAD_FACTOR = 1.3;
+
+const addMinutes = (date: Date, minutes: number) => new Date(date.getTime() + minutes * 60000);
+const highest = (priorities: string[]) => priorities.reduce((a, b) => ((PRIORITY_RANK[b] ?? 0) > (PRIORITY_RANK[a] ?? 0) ? b : a), 'low');
+
+/**
+ * Daily route for field staff across their properties: open tasks and maintenance jobs grouped
+ * into one stop per property, urgent stops first, then nearest-neighbour weighted by priority,
+ * with travel and arrival estimates
+ */
+export class CaretakerRouteService {
+  private prisma = getPrisma();
+
+  async getDailyRoute(query: DailyRouteQuery, user: JWTClaims) {
+    const staffId = query.staff_id || user.user_id;
+    if (staffId !== user.user_id && !PLANNER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view other staff routes');
+    }
+    const staff = await this.prisma.user.findFirst({
+      where: { id: staffId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, first_name: true, last_name: true },
+    });
+    if (!staff) {
+      throw new Error('staff member not found');
+    }
+
+    const day = query.date ? new Date(`${query.date}T00:00:00Z`) : new Date(new Date().setUTCHours(0, 0, 0, 0));
+    if (isNaN(day.getTime())) {
+      throw new Error('date must be a valid date (YYYY-MM-DD)');
+    }
+    const dayEnd = addMinutes(day, 24 * 60);
+    const isToday = Date.now() >= day.getTime() && Date.now() < dayEnd.getTime();
+    const startTime = query.start_time ? new Date(query.start_time) : isToday ? new Date() : addMinutes(day, 8 * 60);
+    if (isNaN(startTime.getTime())) {
+      throw new Error('start_time must be a valid date-time');
+    }
+
+    const stops = await this.collectStops(staff.id, dayEnd);
+    const start = await this.startingPoint(staff.id, query, day);
+
+    const located = stops.filter(stop => stop.property.latitude !== null && stop.property.longitude !== null);
+    const unlocated = stops.filter(stop => stop.property.latitude === null || stop.property.longitude === null);
+    const ordered = this.order(located, start);
+
+    const useMatrix = query.use_distance_matrix === 'true' && !!env.maps.apiKey;
+    const legs = await this.legs(start, ordered, useMatrix);
+
+    let clock = startTime;
+    let totalKm = 0;
+    let totalTravel = 0;
+    const route = [...ordered, ...unlocated].map((stop, index) => {
+      const leg = legs[index];
+      if (leg) {
+        totalKm += leg.distance_km;
+        totalTravel += leg.travel_minutes;
+        clock = addMinutes(clock, leg.travel_minutes);
+      }
+      const arrival = clock;
+      const serviceMinutes = stop.jobs.reduce((sum, job) => sum + job.service_minutes, 0);
+      clock = addMinutes(clock, serviceMinutes);
+      return {
+        sequence: index + 1,
+        property: stop.property,
+        priority: stop.priority,
+        distance_km: leg ? leg.distance_km : null,
+        travel_minutes: leg ? leg.travel_minutes : null,
+        eta: leg || index === 0 ? arrival : null,
+        departure: leg || index === 0 ? clock : null,
+        service_minutes: serviceMinutes,
+        late_jobs: stop.jobs.filter(job => job.due_at && job.due_at < arrival).map(job => job.id),
+        jobs: stop.jobs,
+      };
+    });
+
+    return {
+      staff,
+      date: day.toISOString().slice(0, 10),
+      start: { ...start, time: startTime },
+      travel_estimate: useMatrix ? 'distance_matrix' : 'straight_line',
+      stops: route,
+      unlocated_properties: unlocated.map(stop => stop.property.id),
+      totals: {
+        stops: route.length,
+        jobs: route.reduce((sum, stop) => sum + stop.jobs.length, 0),
+        distance_km: Math.round(totalKm * 10) / 10,
+        travel_minutes: Math.round(totalTravel),
+        service_minutes: route.reduce((sum, stop) => sum + stop.service_minutes, 0),
+        finish_eta: clock,
+      },
+    };
+  }
+
+  /**
+   * Open work due by the end of the day (or undated), one stop per property
+   */
+  private async collectStops(staffId: string, dayEnd: Date): Promise<RouteStop[]> {
+    const [tasks, requests] = await Promise.all([
+      this.prisma.task.findMany({
+        where: {
+          assigned_to: staffId,
+          status: { in: ['pending', 'in_progress', 'overdue'] },
+          property_id: { not: null },
+          AND: [
+            { OR: [{ due_date: null }, { due_date: { lt: dayEnd } }] },
+            { OR: [{ scheduled_start: null }, { scheduled_start: { lt: dayEnd } }] },
+          ],
+        },
+        select: {
+          id: true, title: true, priority: true, status: true, due_date: true, estimated_hours: true, property_id: true,
+          unit: { select: { unit_number: true } },
+        },
+      }),
+      this.prisma.maintenanceRequest.findMany({
+        where: {
+          assigned_to: staffId,
+          status: { in: ['pending', 'in_progress'] },
+          OR: [{ scheduled_date: null }, { scheduled_date: { lt: dayEnd } }],
+        },
+        select: {
+          id: true, title: true, priority: true, status: true, resolution_due_at: true, property_id: true,
+          unit: { select: { unit_number: true } },
+        },
+      }),
+    ]);
+
+    const jobs: Array<RouteJob & { property_id: string }> = [
+      ...tasks.map(task => ({
+        type: 'task' as const,
+        id: task.id,
+        title: task.title,
+        priority: task.priority,
+        status: task.status,
+        due_at: task.due_date,
+        unit_number: task.unit?.unit_number ?? null,
+        service_minutes: task.estimated_hours ? Math.round(task.estimated_hours * 60) : DEFAULT_TASK_MINUTES,
+        property_id: task.property_id!,
+      })),
+      ...requests.map(request => ({
+        type: 'maintenance' as const,
+        id: request.id,
+        title: request.title,
+        priority: request.priority,
+        status: request.status,
+        due_at: request.resolution_due_at,
+        unit_number: request.unit?.unit_number ?? null,
+        service_minutes: MAINTENANCE_MINUTES,
+        property_id: request.property_id,
+      })),
+    ];
+    if (!jobs.length) return [];
+
+    const properties = await this.prisma.property.findMany({
+      where: { id: { in: [...new Set(jobs.map(job => job.property_id))] } },
+      select: { id: true, name: true, street: true, city: true, latitude: true, longitude: true },
+    });
+    return properties.map(property => {
+      const propertyJobs = jobs
+        .filter(job => job.property_id === property.id)
+        .map(({ property_id, ...job }) => job)
+        .sort((a, b) => (PRIORITY_RANK[b.priority] ?? 0) - (PRIORITY_RANK[a.priority] ?? 0) ||
+          (a.due_at?.getTime() ?? Infinity) - (b.due_at?.getTime() ?? Infinity));
+      return {
+        property: {
+          id: property.id,
+          name: property.name,
+          address: [property.street, property.city].filter(Boolean).join(', '),
+          latitude: property.latitude !== null ? Number(property.latitude) : null,
+          longitude: property.longitude !== null ? Number(property.longitude) : null,
+        },
+        jobs: propertyJobs,
+        priority: highest(propertyJobs.map(job => job.priority)),
+      };
+    });
+  }
+
+  /**
+   * Explicit coordinates, else the staff member's last recorded position that day, else the first stop
+   */
+  private async startingPoint(staffId: string, query: DailyRouteQuery, day: Date) {
+    if (query.start_latitude && query.start_longitude) {
+      const latitude = Number(query.start_latitude);
+      const longitude = Number(query.start_longitude);
+      if (isNaN(latitude) || isNaN(longitude) || Math.abs(latitude) > 90 || Math.abs(longitude) > 180) {
+        throw new Error('start_latitude and start_longitude must be valid coordinates');
+      }
+      return { latitude, longitude, source: 'provided' };
+    }
+    const last = await this.prisma.taskLocationEvent.findFirst({
+      where: { user_id: staffId, recorded_at: { gte: day } },
+      orderBy: { recorded_at: 'desc' },
+      select: { latitude: true, longitude: true },
+    });
+    if (last) {
+      return { latitude: Number(last.latitude), longitude: Number(last.longitude), source: 'last_check_in' };
+    }
+    return { latitude: null, longitude: null, source: 'first_stop' };
+  }
+
+  private order(stops: RouteStop[], start: { latitude: number | null; longitude: number | null }): RouteStop[] {
+    const remaining = [...stops];
+    const ordered: RouteStop[] = [];
+    let position = start.latitude !== null && start.longitude !== null ? { latitude: start.latitude, longitude: start.longitude } : null;
+
+    while (remaining.length) {
+      const urgent = remaining.filter(stop => stop.priority === 'urgent');
+      const pool = urgent.length ? urgent : remaining;
+      let best = pool[0];
+      if (position) {
+        const from = position;
+        const cost = (stop: RouteStop) =>
+          distanceInMeters(from.latitude, from.longitude, stop.property.latitude!, stop.property.longitude!) / (PRIORITY_WEIGHT[stop.priority] ?? 1);
+        best = pool.reduce((a, b) => (cost(b) < cost(a) ? b : a));
+      } else {
+        best = pool.reduce((a, b) => ((PRIORITY_RANK[b.priority] ?? 0) > (PRIORITY_RANK[a.priority] ?? 0) ? b : a));
+      }
+      ordered.push(best);
+      remaining.splice(remaining.indexOf(best), 1);
+      position = { latitude: best.property.latitude!, longitude: best.property.longitude! };
+    }
+    return ordered;
+  }
+
+  /**
+   * Travel to each located stop from the previous point; the first leg is empty without a start point
+   */
+  private async legs(
+    start: { latitude: number | null; longitude: number | null },
+    stops: RouteStop[],
+    useMatrix: boolean
+  ): Promise<Array<{ distance_km: number; travel_minutes: number } | null>> {
+    const points = stops.map(stop => ({ latitude: stop.property.latitude!, longitude: stop.property.longitude! }));
+    const origins = [start.latitude !== null && start.longitude !== null ? { latitude: start.latitude, longitude: start.longitude } : null, ...points.slice(0, -1)];
+
+    const estimates = points.map((to, i) => {
+      const from = origins[i];
+      if (!from) return null;
+      const km = (distanceInMeters(from.latitude, from.longitude, to.latitude, to.longitude) / 1000) * ROAD_FACTOR;
+      return { distance_km: Math.round(km * 10) / 10, travel_minutes: Math.round((km / AVERAGE_SPEED_KMH) * 60) };
+    });
+    if (!useMatrix || !points.length) return estimates;
+
+    // One request per leg keeps within the matrix element limits; any failure keeps the estimate
+    return Promise.all(points.map(async (to, i) => {
+      const from = origins[i];
+      if (!from) return null;
+      try {
+        const url = `${env.maps.distanceMatrixUrl}?origins=${from.latitude},${from.longitude}` +
+          `&destinations=${to.latitude},${to.longitude}&departure_time=now&key=${env.maps.apiKey}`;
+        const response = await fetch(url);
+        const body: any = await response.json();
+        const element = body?.rows?.[0]?.elements?.[0];
+        if (element?.status !== 'OK') return estimates[i];
+        const seconds = element.duration_in_traffic?.value ?? element.duration.value;
+        return { distance_km: Math.round(element.distance.value / 100) / 10, travel_minutes: Math.round(seconds / 60) };
+      } catch (error: any) {
+        console.error('⚠️ Distance matrix lookup failed, using straight-line estimate:', error.message);
+        return estimates[i];
+      }
+    }));
+  }
+}
+
+export const caretakerRouteService = new CaretakerRouteService();
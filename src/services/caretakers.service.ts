@@ -388,81 +388,17 @@ export const careteakersService = {
 
     // Send invitation email with setup link
     try {
-      const { emailService } = await import('./email.service.js');
-      
-      const invitationHtml = `
-        <!DOCTYPE html>
-        <html>
-        <head>
-          <meta charset="utf-8">
-          <meta name="viewport" content="width=device-width, initial-scale=1.0">
-          <title>LetRents - Caretaker Invitation</title>
-          <style>
-            body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-            .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-            .header { background: #2563eb; color: white; padding: 20px; text-align: center; }
-            .content { padding: 30px 20px; }
-            .button { display: inline-block; background: #2563eb; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; margin: 20px 0; }
-            .footer { background: #f8f9fa; padding: 20px; text-align: center; font-size: 14px; color: #666; }
-            .info { background: #e7f3ff; border: 1px solid #b3d9ff; padding: 15px; border-radius: 5px; margin: 20px 0; }
-          </style>
-        </head>
-        <body>
-          <div class="container">
-            <div class="header">
-              <h1>Welcome to LetRents</h1>
-              <p>Caretaker Account Invitation</p>
-            </div>
-            <div class="content">
-              <h2>You've been invited as a Caretaker</h2>
-              <p>Hello ${caretaker.first_name} ${caretaker.last_name},</p>
-              <p>You have been invited to join LetRents as a caretaker. Your account has been created and you can now set up your account to access the platform.</p>
-              
-              <div class="info">
-                <strong>Account Setup Required:</strong>
-                <p>Click the button below to complete your account setup and create your secure password.</p>
-              </div>
-
-              <div style="text-align: center;">
-                <a href="${invitationLink}" class="button">Complete Account Setup</a>
-              </div>
-
-              <h3>What's Next?</h3>
-              <ol>
-                <li>Click the "Complete Account Setup" button above</li>
-                <li>Create your secure password</li>
-                <li>Complete your profile setup</li>
-                <li>Start managing properties!</li>
-              </ol>
-
-              <p>If you have any questions or need assistance, please don't hesitate to contact our support team.</p>
-              
-              <p>Welcome to the LetRents family!</p>
-              <p>Best regards,<br>The LetRents Team</p>
-            </div>
-            <div class="footer">
-              <p>&copy; ${new Date().getFullYear()} LetRents. All rights reserved.</p>
-              <p>This is an automated invitation email. Please do not reply to this email.</p>
-            </div>
-          </div>
-        </body>
-        </html>
-      `;
-
-      const emailResult = await emailService.sendEmail({
+      const { emailTemplatesService } = await import('./email-templates.service.js');
+      const emailResult = await emailTemplatesService.send('staff_invitation', {
         to: caretaker.email,
-        subject: `Welcome to LetRents - Complete Your Caretaker Account Setup`,
-        html: invitationHtml,
-        text: `Welcome to LetRents!
-
-You've been invited as a caretaker. Please complete your account setup:
-
-Setup Link: ${invitationLink}
-
-Click the link above to create your password and activate your account.
-
-Best regards,
-The LetRents Team`,
+        recipientId: caretakerId,
+        companyId: caretaker.company_id,
+        agencyId: caretaker.agency_id,
+        variables: {
+          staff_name: `${caretaker.first_name || ''} ${caretaker.last_name || ''}`.trim(),
+          role_name: 'Caretaker',
+          setup_url: invitationLink,
+        },
       });
 
       if (!emailResult.success) {
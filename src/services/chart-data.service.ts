@@ -0,0 +1,200 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+import { ChartPeriod, bucketSeries } from '../utils/chart-period.js';
+import { platformAnalyticsService } from './platform-analytics.service.js';
+
+export const CHART_TYPES = ['revenue', 'occupancy', 'tenants', 'maintenance'] as const;
+export type ChartType = typeof CHART_TYPES[number];
+
+const CHART_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+
+interface ChartSeries {
+  key: string;
+  label: string;
+  data: number[];
+}
+
+/**
+ * Chart series over a validated period, one value per bucket, scoped to the properties the user
+ * can see. Super admins see the platform, including subscription revenue.
+ */
+export class ChartDataService {
+  private prisma = getPrisma();
+
+  async getChart(user: JWTClaims, chartType: string, period: ChartPeriod) {
+    if (!CHART_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view charts');
+    }
+    if (!CHART_TYPES.includes(chartType as ChartType)) {
+      throw new Error(`chart type must be one of: ${CHART_TYPES.join(', ')}`);
+    }
+
+    const propertyScope = await this.propertyScope(user);
+    let series: ChartSeries[];
+    switch (chartType as ChartType) {
+      case 'revenue':
+        series = await this.revenue(user, period, propertyScope);
+        break;
+      case 'occupancy':
+        series = await this.occupancy(user, period, propertyScope);
+        break;
+      case 'tenants':
+        series = await this.tenants(user, period);
+        break;
+      case 'maintenance':
+        series = await this.maintenance(period, propertyScope);
+        break;
+    }
+
+    return {
+      chart: chartType,
+      period: {
+        name: period.period,
+        interval: period.interval,
+        start: period.start.toISOString(),
+        end: period.end.toISOString(),
+      },
+      labels: period.buckets.map(bucket => bucket.key),
+      buckets: period.buckets,
+      series,
+      // The first series, for charts that draw a single line
+      data: series[0].data,
+    };
+  }
+
+  /**
+   * SQL condition on a property id column; super admins are not limited
+   */
+  private async propertyScope(user: JWTClaims) {
+    if (user.role === 'super_admin') {
+      return (_column: string) => Prisma.empty;
+    }
+    const properties = await this.prisma.property.findMany({ where: buildWhereClause(user), select: { id: true } });
+    const ids = properties.map(p => p.id);
+    return (column: string) => Prisma.sql`AND ${Prisma.raw(column)} = ANY(${ids}::uuid[])`;
+  }
+
+  private async revenue(user: JWTClaims, period: ChartPeriod, scope: (column: string) => Prisma.Sql): Promise<ChartSeries[]> {
+    if (user.role === 'super_admin') {
+      const daily = await platformAnalyticsService.getRevenueSeries(period);
+      return [
+        { key: 'total', label: 'Total revenue', data: bucketSeries(period, daily, p => p.total) },
+        { key: 'rental', label: 'Rent collected', data: bucketSeries(period, daily, p => p.rental) },
+        { key: 'subscription', label: 'Subscriptions', data: bucketSeries(period, daily, p => p.subscription) },
+      ];
+    }
+    const rows = await this.prisma.$queryRaw<Array<{ day: Date; total: number; rent: number }>>`
+      SELECT DATE(p.payment_date) AS day,
+        SUM(p.amount)::float AS total,
+        COALESCE(SUM(p.amount) FILTER (WHERE p.payment_type = 'rent'::payment_type), 0)::float AS rent
+      FROM payments p
+      LEFT JOIN units u ON u.id = p.unit_id
+      WHERE p.status IN ('approved'::payment_status, 'completed'::payment_status)
+        AND p.payment_type <> 'security_deposit'::payment_type
+        AND p.payment_date >= ${period.start} AND p.payment_date <= ${period.end}
+        ${scope('COALESCE(p.property_id, u.property_id)')}
+      GROUP BY 1
+      ORDER BY 1
+    `;
+    const daily = rows.map(row => ({ date: new Date(row.day).toISOString().split('T')[0], total: Number(row.total), rent: Number(row.rent) }));
+    return [
+      { key: 'total', label: 'Collected', data: bucketSeries(period, daily, p => p.total) },
+      { key: 'rent', label: 'Rent collected', data: bucketSeries(period, daily, p => p.rent) },
+    ];
+  }
+
+  /**
+   * Occupancy rate at the end of each bucket, from the leases that covered each day
+   */
+  private async occupancy(user: JWTClaims, period: ChartPeriod, scope: (column: string) => Prisma.Sql): Promise<ChartSeries[]> {
+    const daily = user.role === 'super_admin'
+      ? await platformAnalyticsService.getOccupancySeries(period)
+      : (await this.prisma.$queryRaw<Array<{ day: Date; total: number; occupied: number }>>`
+          SELECT d.day::date AS day,
+            (SELECT COUNT(*) FROM units u WHERE u.created_at < d.day + INTERVAL '1 day' ${scope('u.property_id')})::int AS total,
+            (SELECT COUNT(DISTINCT l.unit_id) FROM leases l
+              JOIN units u ON u.id = l.unit_id
+              WHERE l.status IN ('active'::lease_status, 'expired'::lease_status, 'terminated'::lease_status, 'renewed'::lease_status)
+                AND l.start_date <= d.day::date
+                AND (l.move_out_date IS NULL OR l.move_out_date > d.day::date)
+                AND (l.terminated_at IS NULL OR l.terminated_at >= d.day + INTERVAL '1 day')
+                AND (l.end_date >= d.day::date OR l.status = 'active'::lease_status)
+                ${scope('u.property_id')})::int AS occupied
+          FROM generate_series(${period.start}::date, ${period.end}::date, '1 day'::interval) AS d(day)
+          ORDER BY d.day
+        `).map(row => {
+          const total = Number(row.total || 0);
+          const occupied = Number(row.occupied || 0);
+          return {
+            date: new Date(row.day).toISOString().split('T')[0],
+            total_units: total,
+            occupied_units: occupied,
+            occupancy_rate: total > 0 ? Math.round((occupied / total) * 10000) / 100 : 0,
+          };
+        });
+    return [
+      { key: 'occupancy_rate', label: 'Occupancy rate (%)', data: bucketSeries(period, daily, p => p.occupancy_rate, 'last') },
+      { key: 'occupied_units', label: 'Occupied units', data: bucketSeries(period, daily, p => p.occupied_units, 'last') },
+      { key: 'total_units', label: 'Units', data: bucketSeries(period, daily, p => p.total_units, 'last') },
+    ];
+  }
+
+  /**
+   * Tenant accounts: new sign-ups per bucket and the running total at the end of each
+   */
+  private async tenants(user: JWTClaims, period: ChartPeriod): Promise<ChartSeries[]> {
+    const scope = user.role === 'super_admin'
+      ? Prisma.empty
+      : user.role === 'landlord'
+        ? Prisma.sql`AND company_id = ${user.company_id}::uuid AND landlord_id = ${user.user_id}::uuid`
+        : Prisma.sql`AND company_id = ${user.company_id}::uuid`;
+    const [rows, before] = await Promise.all([
+      this.prisma.$queryRaw<Array<{ day: Date; count: number }>>`
+        SELECT DATE(created_at) AS day, COUNT(*)::int AS count
+        FROM users
+        WHERE role = 'tenant'::user_role AND created_at >= ${period.start} AND created_at <= ${period.end} ${scope}
+        GROUP BY 1
+        ORDER BY 1
+      `,
+      this.prisma.$queryRaw<Array<{ count: number }>>`
+        SELECT COUNT(*)::int AS count FROM users WHERE role = 'tenant'::user_role AND created_at < ${period.start} ${scope}
+      `,
+    ]);
+    const added = bucketSeries(period, rows.map(row => ({ date: new Date(row.day).toISOString().split('T')[0], count: Number(row.count) })), p => p.count);
+    let running = Number(before[0]?.count || 0);
+    return [
+      { key: 'total', label: 'Tenants', data: added.map(count => (running += count)) },
+      { key: 'new', label: 'New tenants', data: added },
+    ];
+  }
+
+  private async maintenance(period: ChartPeriod, scope: (column: string) => Prisma.Sql): Promise<ChartSeries[]> {
+    const [opened, completed] = await Promise.all([
+      this.prisma.$queryRaw<Array<{ day: Date; count: number }>>`
+        SELECT DATE(m.created_at) AS day, COUNT(*)::int AS count
+        FROM maintenance_requests m
+        WHERE m.created_at >= ${period.start} AND m.created_at <= ${period.end} ${scope('m.property_id')}
+        GROUP BY 1
+        ORDER BY 1
+      `,
+      this.prisma.$queryRaw<Array<{ day: Date; count: number; cost: number }>>`
+        SELECT DATE(m.completed_date) AS day, COUNT(*)::int AS count, SUM(COALESCE(m.actual_cost, m.estimated_cost, 0))::float AS cost
+        FROM maintenance_requests m
+        WHERE m.status = 'completed'::maintenance_status
+          AND m.completed_date >= ${period.start} AND m.completed_date <= ${period.end} ${scope('m.property_id')}
+        GROUP BY 1
+        ORDER BY 1
+      `,
+    ]);
+    const daily = <T extends { day: Date }>(rows: T[]) => rows.map(row => ({ ...row, date: new Date(row.day).toISOString().split('T')[0] }));
+    return [
+      { key: 'opened', label: 'Requests opened', data: bucketSeries(period, daily(opened), p => p.count) },
+      { key: 'completed', label: 'Requests completed', data: bucketSeries(period, daily(completed), p => p.count) },
+      { key: 'cost', label: 'Cost of completed work', data: bucketSeries(period, daily(completed), p => p.cost) },
+    ];
+  }
+}
+
+export const chartDataService = new ChartDataService();
@@ -2,9 +2,13 @@
 // Checklist & Inspection Service
 // ============================================================================
 
+import crypto from 'crypto';
 import { InspectionType, InspectionStatus, ItemCondition, ChecklistScope } from '@prisma/client';
 import { JWTClaims } from '../types/index.js';
 import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { emailTemplatesService } from './email-templates.service.js';
+import { imagekitService } from './imagekit.service.js';
 
 const prisma = getPrisma();
 
@@ -12,12 +16,22 @@ const prisma = getPrisma();
 // INTERFACES
 // ============================================================================
 
+export interface ConditionScaleEntry {
+  value: ItemCondition;
+  label: string;
+  score: number | null; // null keeps the rating out of the inspection score (e.g. not applicable)
+  is_issue: boolean;
+  is_critical?: boolean;
+}
+
 export interface CreateTemplateRequest {
   name: string;
   description?: string;
   inspection_type: InspectionType;
   scope?: ChecklistScope;
   property_id?: string;
+  is_default?: boolean;
+  condition_scale?: ConditionScaleEntry[];
   categories: Array<{
     name: string;
     description?: string;
@@ -38,7 +52,7 @@ export interface UpdateTemplateRequest extends Partial<CreateTemplateRequest> {
 }
 
 export interface CreateInspectionRequest {
-  template_id: string;
+  template_id?: string; // Falls back to the company's default template for the inspection type
   inspection_type: InspectionType;
   property_id: string;
   unit_id: string;
@@ -58,14 +72,130 @@ export interface UpdateInspectionRequest {
 }
 
 export interface RecordInspectionItemRequest {
-  checklist_item_id: string;
+  checklist_item_id?: string;
   condition?: ItemCondition;
   notes?: string;
   has_issue?: boolean;
   is_critical?: boolean;
   photo_urls?: string[];
+  deduction_amount?: number; // Repair cost charged against the deposit (move-out inspections)
+}
+
+export interface ShareInspectionReportRequest {
+  recipients?: Array<'tenant' | 'landlord'>;
+  emails?: string[];
+  expires_in_days?: number;
 }
 
+const REPORT_LINK_DAYS = 14;
+const MAX_REPORT_LINK_DAYS = 90;
+const REPORT_DOWNLOAD_SECONDS = 60 * 60;
+
+const hashShareToken = (token: string) => crypto.createHash('sha256').update(token).digest('hex');
+
+/**
+ * Stored report PDFs are private; readers get a signed link that works for an hour
+ */
+export const inspectionReportLink = (url: string | null) => {
+  const link = url ? imagekitService.signedDownload(url, REPORT_DOWNLOAD_SECONDS) : null;
+  return { report_url: link?.url ?? null, report_url_expires_at: link?.expires_at ?? null };
+};
+
+// Used by templates that don't define their own condition_scale
+export const DEFAULT_CONDITION_SCALE: ConditionScaleEntry[] = [
+  { value: 'excellent', label: 'Excellent', score: 5, is_issue: false },
+  { value: 'good', label: 'Good', score: 4, is_issue: false },
+  { value: 'fair', label: 'Fair', score: 3, is_issue: false },
+  { value: 'poor', label: 'Poor', score: 2, is_issue: true },
+  { value: 'damaged', label: 'Damaged', score: 1, is_issue: true, is_critical: true },
+  { value: 'missing', label: 'Missing', score: 0, is_issue: true, is_critical: true },
+  { value: 'not_applicable', label: 'N/A', score: null, is_issue: false },
+];
+
+const ITEM_CONDITIONS = Object.values(ItemCondition) as string[];
+
+export const conditionScaleOf = (template: { condition_scale?: any }): ConditionScaleEntry[] =>
+  Array.isArray(template?.condition_scale) && template.condition_scale.length > 0
+    ? (template.condition_scale as ConditionScaleEntry[])
+    : DEFAULT_CONDITION_SCALE;
+
+const validateConditionScale = (scale: ConditionScaleEntry[]): ConditionScaleEntry[] => {
+  if (!Array.isArray(scale) || scale.length < 2) {
+    throw new Error('condition_scale must have at least two ratings');
+  }
+  const seen = new Set<string>();
+  return scale.map(entry => {
+    if (!ITEM_CONDITIONS.includes(entry?.value)) {
+      throw new Error(`condition_scale values must be one of: ${ITEM_CONDITIONS.join(', ')}`);
+    }
+    if (seen.has(entry.value)) {
+      throw new Error(`condition_scale lists ${entry.value} more than once`);
+    }
+    seen.add(entry.value);
+    const score = entry.score === null || entry.score === undefined ? null : Number(entry.score);
+    if (score !== null && (isNaN(score) || score < 0)) {
+      throw new Error(`condition_scale score for ${entry.value} must be a non-negative number`);
+    }
+    return {
+      value: entry.value,
+      label: entry.label?.trim() || entry.value,
+      score,
+      is_issue: !!entry.is_issue,
+      is_critical: !!entry.is_critical,
+    };
+  });
+};
+
+const validateCategories = (categories: CreateTemplateRequest['categories']) => {
+  if (!Array.isArray(categories) || categories.length === 0) {
+    throw new Error('At least one room or category is required');
+  }
+  for (const category of categories) {
+    if (!category.name?.trim()) {
+      throw new Error('Every room or category must have a name');
+    }
+    if (!Array.isArray(category.items) || category.items.length === 0) {
+      throw new Error(`${category.name} must have at least one item`);
+    }
+    if (category.items.some(item => !item.name?.trim())) {
+      throw new Error(`Every item in ${category.name} must have a name`);
+    }
+  }
+};
+
+const categoriesCreate = (categories: CreateTemplateRequest['categories']) => ({
+  create: categories.map((category, catIndex) => ({
+    name: category.name,
+    description: category.description,
+    display_order: category.display_order ?? catIndex + 1,
+    items: {
+      create: category.items.map((item, itemIndex) => ({
+        name: item.name,
+        description: item.description,
+        display_order: item.display_order ?? itemIndex + 1,
+        is_required: item.is_required ?? false,
+        requires_photo: item.requires_photo ?? false,
+        requires_notes: item.requires_notes ?? false,
+      })),
+    },
+  })),
+});
+
+const templateInclude = {
+  categories: {
+    include: {
+      items: {
+        orderBy: {
+          display_order: 'asc' as const,
+        },
+      },
+    },
+    orderBy: {
+      display_order: 'asc' as const,
+    },
+  },
+};
+
 export class ChecklistsService {
   // ============================================================================
   // TEMPLATE MANAGEMENT
@@ -79,6 +209,18 @@ export class ChecklistsService {
     if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
       throw new Error('Insufficient permissions to create templates');
     }
+    if (!req.name?.trim()) {
+      throw new Error('Template name is required');
+    }
+    if (!req.inspection_type) {
+      throw new Error('Inspection type is required');
+    }
+    validateCategories(req.categories);
+    const conditionScale = req.condition_scale ? validateConditionScale(req.condition_scale) : undefined;
+
+    if (req.is_default) {
+      await this.clearDefault(user.company_id!, req.inspection_type, req.property_id);
+    }
 
     const template = await prisma.checklistTemplate.create({
       data: {
@@ -86,37 +228,14 @@ export class ChecklistsService {
         name: req.name,
         description: req.description,
         inspection_type: req.inspection_type,
-        scope: req.scope || 'company',
+        scope: req.scope || (req.property_id ? 'property' : 'company'),
         property_id: req.property_id,
+        is_default: req.is_default ?? false,
+        condition_scale: conditionScale as any,
         created_by: user.user_id,
-        categories: {
-          create: req.categories.map((category, catIndex) => ({
-            name: category.name,
-            description: category.description,
-            display_order: category.display_order ?? catIndex + 1,
-            items: {
-              create: category.items.map((item, itemIndex) => ({
-                name: item.name,
-                description: item.description,
-                display_order: item.display_order ?? itemIndex + 1,
-                is_required: item.is_required ?? false,
-                requires_photo: item.requires_photo ?? false,
-                requires_notes: item.requires_notes ?? false,
-              })),
-            },
-          })),
-        },
-      },
-      include: {
-        categories: {
-          include: {
-            items: true,
-          },
-          orderBy: {
-            display_order: 'asc',
-          },
-        },
+        categories: categoriesCreate(req.categories),
       },
+      include: templateInclude,
     });
 
     console.log(`✅ Created checklist template: ${template.name} (${template.inspection_type})`);
@@ -248,7 +367,7 @@ export class ChecklistsService {
       throw new Error('Template not found');
     }
 
-    return template;
+    return { ...template, condition_scale: conditionScaleOf(template) };
   }
 
   /**
@@ -271,28 +390,92 @@ export class ChecklistsService {
       throw new Error('Template not found');
     }
 
-    const updated = await prisma.checklistTemplate.update({
-      where: { id: templateId },
-      data: {
-        name: req.name,
-        description: req.description,
-        inspection_type: req.inspection_type,
-        is_active: req.is_active,
-        property_id: req.property_id,
-      },
-      include: {
-        categories: {
-          include: {
-            items: true,
-          },
+    const conditionScale = req.condition_scale ? validateConditionScale(req.condition_scale) : undefined;
+    if (req.categories) {
+      validateCategories(req.categories);
+      // Recorded results point at the template's items, so a template in use keeps its structure
+      const used = await prisma.inspection.count({ where: { template_id: templateId } });
+      if (used > 0) {
+        throw new Error('Template is already used by inspections; duplicate it to change its rooms or items');
+      }
+    }
+    if (req.is_default) {
+      await this.clearDefault(
+        template.company_id,
+        req.inspection_type || template.inspection_type,
+        req.property_id !== undefined ? req.property_id : template.property_id
+      );
+    }
+
+    const updated = await prisma.$transaction(async (tx) => {
+      if (req.categories) {
+        await tx.checklistCategory.deleteMany({ where: { template_id: templateId } });
+      }
+      return tx.checklistTemplate.update({
+        where: { id: templateId },
+        data: {
+          name: req.name,
+          description: req.description,
+          inspection_type: req.inspection_type,
+          is_active: req.is_active,
+          is_default: req.is_default,
+          property_id: req.property_id,
+          ...(conditionScale && { condition_scale: conditionScale as any }),
+          ...(req.categories && { categories: categoriesCreate(req.categories) }),
+          updated_at: new Date(),
         },
-      },
+        include: templateInclude,
+      });
     });
 
     console.log(`✅ Updated template: ${updated.name}`);
     return updated;
   }
 
+  /**
+   * Copy a template (rooms, items and condition scale) so it can be adapted without
+   * touching inspections already recorded against the original
+   */
+  async duplicateTemplate(templateId: string, req: { name?: string; property_id?: string }, user: JWTClaims): Promise<any> {
+    if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
+      throw new Error('Insufficient permissions to create templates');
+    }
+
+    const source = await this.getTemplate(templateId, user);
+    const template = await prisma.checklistTemplate.create({
+      data: {
+        company_id: source.company_id,
+        name: req.name?.trim() || `${source.name} (copy)`,
+        description: source.description,
+        inspection_type: source.inspection_type,
+        scope: req.property_id ? 'property' : source.scope,
+        property_id: req.property_id ?? source.property_id,
+        condition_scale: source.condition_scale as any,
+        created_by: user.user_id,
+        categories: categoriesCreate(source.categories as any),
+      },
+      include: templateInclude,
+    });
+
+    console.log(`✅ Duplicated template ${source.name} as ${template.name}`);
+    return template;
+  }
+
+  /**
+   * Only one default template per inspection type at company level, and one per property
+   */
+  private async clearDefault(companyId: string, inspectionType: InspectionType, propertyId?: string | null) {
+    await prisma.checklistTemplate.updateMany({
+      where: {
+        company_id: companyId,
+        inspection_type: inspectionType,
+        property_id: propertyId || null,
+        is_default: true,
+      },
+      data: { is_default: false },
+    });
+  }
+
   /**
    * Delete a template
    */
@@ -334,9 +517,6 @@ export class ChecklistsService {
     }
 
     // Validate required fields
-    if (!req.template_id) {
-      throw new Error('Template ID is required');
-    }
     if (!req.property_id) {
       throw new Error('Property ID is required');
     }
@@ -350,23 +530,38 @@ export class ChecklistsService {
     console.log('🔍 Creating inspection with data:', JSON.stringify(req, null, 2));
     console.log('👤 User:', { user_id: user.user_id, company_id: user.company_id, role: user.role });
 
-    // Verify template exists and belongs to company
-    const template = await prisma.checklistTemplate.findFirst({
-      where: {
-        id: req.template_id,
-        company_id: user.company_id!,
-      },
-      include: {
-        categories: {
-          include: {
-            items: true,
+    // Verify template exists and belongs to company; without one, use the default for this
+    // inspection type, preferring a property-specific default over the company-wide one
+    const template = req.template_id
+      ? await prisma.checklistTemplate.findFirst({
+          where: {
+            id: req.template_id,
+            company_id: user.company_id!,
           },
-        },
-      },
-    });
+          include: templateInclude,
+        })
+      : await prisma.checklistTemplate.findFirst({
+          where: {
+            company_id: user.company_id!,
+            inspection_type: req.inspection_type,
+            is_active: true,
+            is_default: true,
+            OR: [{ property_id: req.property_id }, { property_id: null }],
+          },
+          include: templateInclude,
+          orderBy: { property_id: { sort: 'asc', nulls: 'last' } },
+        });
 
     if (!template) {
-      throw new Error('Template not found or does not belong to your company');
+      throw new Error(req.template_id
+        ? 'Template not found or does not belong to your company'
+        : `No default template found for ${req.inspection_type} inspections; choose a template`);
+    }
+    if (!template.is_active) {
+      throw new Error('Template is inactive');
+    }
+    if (template.property_id && template.property_id !== req.property_id) {
+      throw new Error('Template belongs to a different property');
     }
 
     console.log('✅ Template found:', template.name);
@@ -389,7 +584,7 @@ export class ChecklistsService {
     const inspection = await prisma.inspection.create({
       data: {
         company_id: user.company_id!,
-        template_id: req.template_id,
+        template_id: template.id,
         inspection_type: req.inspection_type,
         property_id: req.property_id,
         unit_id: req.unit_id,
@@ -453,7 +648,7 @@ export class ChecklistsService {
     });
 
     console.log(`✅ Created inspection for unit ${unit.unit_number} - Type: ${inspection.inspection_type}`);
-    return inspection;
+    return { ...inspection, condition_scale: conditionScaleOf(template) };
   }
 
   /**
@@ -655,7 +850,23 @@ export class ChecklistsService {
       throw new Error('Inspection not found');
     }
 
-    return inspection;
+    // Results grouped by room in template order
+    const resultsByItem = new Map(inspection.items.map(item => [item.checklist_item_id, item]));
+    const sections = inspection.template.categories.map(category => ({
+      id: category.id,
+      name: category.name,
+      items: category.items.map(item => ({
+        ...item,
+        result: resultsByItem.get(item.id) || null,
+      })),
+    }));
+
+    return {
+      ...inspection,
+      ...inspectionReportLink(inspection.report_url),
+      condition_scale: conditionScaleOf(inspection.template),
+      sections,
+    };
   }
 
   /**
@@ -678,28 +889,79 @@ export class ChecklistsService {
       throw new Error('Insufficient permissions to update this inspection');
     }
 
-    const updated = await prisma.inspection.update({
-      where: { id: inspectionId },
-      data: {
-        status: req.status,
-        scheduled_date: req.scheduled_date,
-        started_at: req.started_at,
-        completed_at: req.completed_at,
-        overall_condition: req.overall_condition,
-        overall_notes: req.overall_notes,
-        inspector_signature: req.inspector_signature,
-        tenant_signature: req.tenant_signature,
-      },
-      include: {
-        template: true,
-        property: true,
-        unit: true,
-        tenant: true,
-        inspector: true,
-      },
+    const completing = req.status === 'completed' && inspection.status !== 'completed';
+    const summary = completing ? await this.summarizeResults(inspectionId) : undefined;
+    if (summary) {
+      if (summary.incomplete.length > 0) {
+        throw new Error(`Inspection cannot be completed until all required items are recorded: ${summary.incomplete.slice(0, 5).join('; ')}${summary.incomplete.length > 5 ? ` and ${summary.incomplete.length - 5} more` : ''}`);
+      }
+    }
+
+    // Every completion, and any change to a completed inspection, is kept as an immutable version
+    // written with the change itself
+    const { inspectionVersionsService } = await import('./inspection-versions.service.js');
+    const updated = await prisma.$transaction(async tx => {
+      const changed = await tx.inspection.update({
+        where: { id: inspectionId },
+        data: {
+          status: req.status,
+          scheduled_date: req.scheduled_date,
+          // A moved inspection gets a fresh reminder
+          ...(req.scheduled_date && { reminder_sent_at: null }),
+          started_at: req.started_at,
+          completed_at: req.completed_at ?? (completing ? new Date() : undefined),
+          ...(summary && {
+            total_issues: summary.total_issues,
+            critical_issues: summary.critical_issues,
+            score: summary.score,
+          }),
+          overall_condition: req.overall_condition ?? summary?.overall_condition ?? undefined,
+          overall_notes: req.overall_notes,
+          inspector_signature: req.inspector_signature,
+          tenant_signature: req.tenant_signature,
+        },
+        include: {
+          template: true,
+          property: true,
+          unit: true,
+          tenant: true,
+          inspector: true,
+        },
+      });
+      if (changed.status === 'completed') {
+        await inspectionVersionsService.recordVersion(inspectionId, completing ? 'completed' : 'amended', user.user_id, tx);
+      }
+      return changed;
     });
 
     console.log(`✅ Updated inspection ${inspectionId} - Status: ${updated.status}`);
+
+    // Completed inspections get a PDF report filed with the tenant's documents and sent to both parties
+    if (completing) {
+      try {
+        await this.generateReport(inspectionId, user);
+        await this.shareReport(inspectionId, { recipients: ['tenant', 'landlord'] }, user);
+      } catch (error: any) {
+        console.error(`⚠️ Failed to produce report for inspection ${inspectionId}:`, error.message);
+      }
+    }
+
+    // Completing a move-out inspection feeds its deductions into the tenant's deposit settlement
+    if (updated.inspection_type === 'move_out' && updated.status === 'completed' && inspection.status !== 'completed') {
+      const lease = await prisma.lease.findFirst({
+        where: {
+          unit_id: updated.unit_id,
+          ...(updated.tenant_id && { tenant_id: updated.tenant_id }),
+          status: { in: ['active', 'terminated', 'expired'] },
+        },
+        orderBy: { start_date: 'desc' },
+      });
+      if (lease) {
+        const { DepositSettlementService } = await import('./deposit-settlement.service.js');
+        await new DepositSettlementService().autoCalculate(lease.id, user);
+      }
+    }
+
     return updated;
   }
 
@@ -722,13 +984,21 @@ export class ChecklistsService {
     if (!inspection) {
       throw new Error('Inspection not found');
     }
+    if (['completed', 'cancelled'].includes(inspection.status)) {
+      throw new Error(`Inspection is already ${inspection.status}`);
+    }
 
     // Verify inspection item exists
     const inspectionItem = await prisma.inspectionItem.findFirst({
       where: {
         id: itemId,
         inspection_id: inspectionId,
-        checklist_item_id: req.checklist_item_id,
+        ...(req.checklist_item_id && { checklist_item_id: req.checklist_item_id }),
+      },
+      include: {
+        inspection: {
+          select: { template: { select: { condition_scale: true } } },
+        },
       },
     });
 
@@ -736,35 +1006,107 @@ export class ChecklistsService {
       throw new Error('Inspection item not found');
     }
 
+    // The template's condition scale decides which ratings are allowed and what counts as an issue
+    let rating: ConditionScaleEntry | undefined;
+    if (req.condition) {
+      rating = conditionScaleOf(inspectionItem.inspection.template).find(entry => entry.value === req.condition);
+      if (!rating) {
+        throw new Error(`condition must be one of: ${conditionScaleOf(inspectionItem.inspection.template).map(e => e.value).join(', ')}`);
+      }
+    }
+    if (req.photo_urls !== undefined && !Array.isArray(req.photo_urls)) {
+      throw new Error('photo_urls must be an array');
+    }
+
     const updated = await prisma.inspectionItem.update({
       where: { id: itemId },
       data: {
         condition: req.condition,
         notes: req.notes,
-        has_issue: req.has_issue,
-        is_critical: req.is_critical,
+        has_issue: req.has_issue ?? rating?.is_issue,
+        is_critical: req.is_critical ?? rating?.is_critical,
         photo_urls: req.photo_urls,
+        ...(req.deduction_amount !== undefined && { deduction_amount: req.deduction_amount }),
+        updated_at: new Date(),
       },
       include: {
         checklist_item: true,
       },
     });
 
-    // Update inspection counters
-    if (req.has_issue) {
-      await prisma.inspection.update({
-        where: { id: inspectionId },
-        data: {
-          total_issues: { increment: 1 },
-          critical_issues: req.is_critical ? { increment: 1 } : undefined,
-        },
-      });
-    }
+    // Keep the inspection counters in step with the recorded results
+    const summary = await this.summarizeResults(inspectionId);
+    await prisma.inspection.update({
+      where: { id: inspectionId },
+      data: {
+        total_issues: summary.total_issues,
+        critical_issues: summary.critical_issues,
+        score: summary.score,
+        ...(inspection.status === 'scheduled' && { status: 'in_progress', started_at: inspection.started_at ?? new Date() }),
+      },
+    });
 
     console.log(`✅ Recorded inspection item: ${updated.checklist_item.name}`);
     return updated;
   }
 
+  /**
+   * Issue counts, score (percentage of the best rating on the template's scale, ignoring
+   * unscored ratings) and the required items still missing a condition, photo or notes
+   */
+  private async summarizeResults(inspectionId: string) {
+    const inspection = await prisma.inspection.findUniqueOrThrow({
+      where: { id: inspectionId },
+      include: {
+        template: { select: { condition_scale: true } },
+        items: {
+          include: {
+            checklist_item: { include: { category: { select: { name: true } } } },
+          },
+        },
+      },
+    });
+    const scale = conditionScaleOf(inspection.template);
+    const maxScore = Math.max(...scale.map(entry => entry.score ?? 0));
+
+    const incomplete: string[] = [];
+    const scores: number[] = [];
+    for (const item of inspection.items) {
+      const { checklist_item: checklistItem } = item;
+      const label = `${checklistItem.category.name} - ${checklistItem.name}`;
+      const photos = Array.isArray(item.photo_urls) ? item.photo_urls : [];
+      if (checklistItem.is_required && !item.condition) {
+        incomplete.push(`${label} needs a condition`);
+      }
+      if (checklistItem.requires_photo && item.condition !== 'not_applicable' && photos.length === 0) {
+        incomplete.push(`${label} needs a photo`);
+      }
+      if (checklistItem.requires_notes && item.condition !== 'not_applicable' && !item.notes?.trim()) {
+        incomplete.push(`${label} needs notes`);
+      }
+      const score = scale.find(entry => entry.value === item.condition)?.score;
+      if (score !== null && score !== undefined) scores.push(score);
+    }
+
+    const score = scores.length > 0 && maxScore > 0
+      ? Math.round((scores.reduce((sum, v) => sum + v, 0) / scores.length / maxScore) * 10000) / 100
+      : null;
+    // Overall condition is the scale rating closest to the average score
+    const average = scores.length > 0 ? scores.reduce((sum, v) => sum + v, 0) / scores.length : null;
+    const overall = average === null ? null : scale
+      .filter(entry => entry.score !== null)
+      .reduce<ConditionScaleEntry | null>((best, entry) =>
+        !best || Math.abs(entry.score! - average) < Math.abs(best.score! - average) ? entry : best, null);
+
+    return {
+      total_issues: inspection.items.filter(item => item.has_issue).length,
+      critical_issues: inspection.items.filter(item => item.is_critical).length,
+      score,
+      overall_condition: overall?.label ?? null,
+      incomplete,
+    };
+  }
+
   /**
    * Upload photo for an inspection
    */
@@ -817,6 +1159,250 @@ export class ChecklistsService {
     return photo;
   }
 
+  // ============================================================================
+  // INSPECTION REPORTS
+  // ============================================================================
+
+  /**
+   * Render the inspection report PDF, store it and file a copy in the tenant's document vault.
+   * Regenerating replaces the stored report.
+   */
+  async generateReport(inspectionId: string, user: JWTClaims): Promise<any> {
+    const inspection = await prisma.inspection.findFirst({
+      where: { id: inspectionId, company_id: user.company_id! },
+      include: { unit: { select: { unit_number: true } } },
+    });
+    if (!inspection) {
+      throw new Error('Inspection not found');
+    }
+    if (inspection.status !== 'completed') {
+      throw new Error('Report is only available once the inspection is completed');
+    }
+
+    const { documentService } = await import('../modules/documents/document-service.js');
+    const pdf = await documentService.getInspectionReportPdf(inspectionId);
+    const fileName = `inspection-${inspection.inspection_type}-${inspection.unit.unit_number}-${inspectionId.slice(0, 8)}.pdf`;
+    const upload = await imagekitService.uploadFile(pdf, fileName, `inspections/${inspectionId}/reports`, { isPrivate: true });
+
+    const updated = await prisma.inspection.update({
+      where: { id: inspectionId },
+      data: { report_url: upload.url, report_generated_at: new Date() },
+    });
+
+    if (inspection.tenant_id) {
+      const existing = await prisma.tenantDocument.findFirst({
+        where: { tenant_id: inspection.tenant_id, category: 'inspection_report', tags: { has: inspectionId } },
+      });
+      const document = {
+        name: fileName,
+        type: 'application/pdf',
+        size: pdf.length,
+        url: upload.url,
+        description: `${inspection.inspection_type.replace('_', '-')} inspection report for unit ${inspection.unit.unit_number}`,
+      };
+      if (existing) {
+        await prisma.tenantDocument.update({ where: { id: existing.id }, data: { ...document, updated_at: new Date() } });
+      } else {
+        await prisma.tenantDocument.create({
+          data: {
+            ...document,
+            tenant_id: inspection.tenant_id,
+            company_id: inspection.company_id,
+            category: 'inspection_report',
+            tags: ['inspection', inspectionId],
+            status: 'approved',
+            uploaded_by: user.user_id,
+          },
+        });
+      }
+    }
+
+    console.log(`✅ Generated report for inspection ${inspectionId}`);
+    return { ...inspectionReportLink(updated.report_url), report_generated_at: updated.report_generated_at };
+  }
+
+  /**
+   * Report PDF for in-app download; tenants can only fetch their own inspections
+   */
+  async getReportPdf(inspectionId: string, user: JWTClaims): Promise<{ pdf: Buffer; filename: string }> {
+    const inspection = await prisma.inspection.findFirst({
+      where: {
+        id: inspectionId,
+        company_id: user.company_id!,
+        ...(user.role === 'tenant' && { tenant_id: user.user_id }),
+      },
+    });
+    if (!inspection) {
+      throw new Error('Inspection not found');
+    }
+    if (inspection.status !== 'completed') {
+      throw new Error('Report is only available once the inspection is completed');
+    }
+
+    const { documentService } = await import('../modules/documents/document-service.js');
+    return {
+      pdf: await documentService.getInspectionReportPdf(inspectionId),
+      filename: `Inspection-${inspectionId.slice(0, 8)}.pdf`,
+    };
+  }
+
+  /**
+   * Email expiring report links to the tenant, the property owner and/or other addresses.
+   * Each recipient gets their own link so access can be tracked and revoked individually.
+   */
+  async shareReport(inspectionId: string, req: ShareInspectionReportRequest, user: JWTClaims): Promise<any[]> {
+    if (user.role === 'tenant') {
+      throw new Error('Insufficient permissions to share inspection reports');
+    }
+    const inspection = await prisma.inspection.findFirst({
+      where: { id: inspectionId, company_id: user.company_id! },
+      include: {
+        property: { select: { name: true, owner: { select: { id: true, email: true, first_name: true, last_name: true } } } },
+        unit: { select: { unit_number: true } },
+        tenant: { select: { id: true, email: true, first_name: true, last_name: true } },
+      },
+    });
+    if (!inspection) {
+      throw new Error('Inspection not found');
+    }
+    if (inspection.status !== 'completed') {
+      throw new Error('Report is only available once the inspection is completed');
+    }
+
+    const days = req.expires_in_days ?? REPORT_LINK_DAYS;
+    if (!Number.isInteger(days) || days < 1 || days > MAX_REPORT_LINK_DAYS) {
+      throw new Error(`expires_in_days must be a whole number between 1 and ${MAX_REPORT_LINK_DAYS}`);
+    }
+
+    const recipients: Array<{ type: string; email: string; name?: string; user_id?: string }> = [];
+    for (const type of req.recipients || []) {
+      const person = type === 'tenant' ? inspection.tenant : type === 'landlord' ? inspection.property.owner : undefined;
+      if (person === undefined) {
+        throw new Error('recipients must be tenant or landlord');
+      }
+      if (person?.email) {
+        recipients.push({ type, email: person.email, name: `${person.first_name} ${person.last_name}`, user_id: person.id });
+      }
+    }
+    for (const email of req.emails || []) {
+      if (typeof email !== 'string' || !/^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(email)) {
+        throw new Error(`${email} must be a valid email address`);
+      }
+      recipients.push({ type: 'other', email });
+    }
+    if (recipients.length === 0) {
+      throw new Error('At least one recipient with an email address is required');
+    }
+
+    const expiresAt = new Date(Date.now() + days * 24 * 60 * 60 * 1000);
+    const location = `${inspection.property.name}, Unit ${inspection.unit.unit_number}`;
+    const shares = [];
+    for (const recipient of recipients) {
+      const token = crypto.randomBytes(32).toString('hex');
+      const share = await prisma.inspectionReportShare.create({
+        data: {
+          inspection_id: inspectionId,
+          token_hash: hashShareToken(token),
+          recipient_type: recipient.type,
+          recipient_email: recipient.email,
+          recipient_name: recipient.name,
+          expires_at: expiresAt,
+          created_by: user.user_id,
+        },
+      });
+
+      try {
+        await emailTemplatesService.send('inspection_report_shared', {
+          to: recipient.email,
+          recipientId: recipient.user_id,
+          companyId: inspection.company_id,
+          variables: {
+            recipient_name: recipient.name,
+            inspection_type: inspection.inspection_type.replace('_', '-'),
+            location,
+            report_url: `${env.apiUrl}/api/v1/inspection-reports/${token}`,
+            expires_at: expiresAt,
+          },
+        });
+      } catch (error: any) {
+        console.error(`⚠️ Failed to email inspection report to ${recipient.email}:`, error.message);
+      }
+      shares.push(share);
+    }
+
+    console.log(`✅ Shared report for inspection ${inspectionId} with ${shares.length} recipient(s)`);
+    return shares.map(({ token_hash, ...share }) => share);
+  }
+
+  async getReportShares(inspectionId: string, user: JWTClaims): Promise<any[]> {
+    const inspection = await prisma.inspection.findFirst({
+      where: { id: inspectionId, company_id: user.company_id! },
+      select: { id: true },
+    });
+    if (!inspection || user.role === 'tenant') {
+      throw new Error('Inspection not found');
+    }
+
+    const shares = await prisma.inspectionReportShare.findMany({
+      where: { inspection_id: inspectionId },
+      orderBy: { created_at: 'desc' },
+    });
+    const now = new Date();
+    return shares.map(({ token_hash, ...share }) => ({
+      ...share,
+      is_active: !share.revoked_at && share.expires_at > now,
+    }));
+  }
+
+  async revokeReportShare(inspectionId: string, shareId: string, user: JWTClaims): Promise<void> {
+    if (user.role === 'tenant') {
+      throw new Error('Insufficient permissions to revoke report links');
+    }
+    const share = await prisma.inspectionReportShare.findFirst({
+      where: { id: shareId, inspection_id: inspectionId, inspection: { company_id: user.company_id! } },
+    });
+    if (!share) {
+      throw new Error('Report link not found');
+    }
+
+    await prisma.inspectionReportShare.update({
+      where: { id: shareId },
+      data: { revoked_at: share.revoked_at ?? new Date() },
+    });
+  }
+
+  /**
+   * Public access through a shared link (no login; the token identifies the report). The stored
+   * report is handed out as a short signed link; inspections without one are rendered on the fly.
+   */
+  async getSharedReport(token: string): Promise<{ download_url: string } | { pdf: Buffer; filename: string }> {
+    const share = await prisma.inspectionReportShare.findUnique({
+      where: { token_hash: hashShareToken(token) },
+      include: { inspection: { select: { status: true, report_url: true } } },
+    });
+    if (!share || share.revoked_at || share.inspection.status !== 'completed') {
+      throw new Error('Report link not found');
+    }
+    if (share.expires_at < new Date()) {
+      throw new Error('Report link has expired');
+    }
+
+    await prisma.inspectionReportShare.update({
+      where: { id: share.id },
+      data: { access_count: { increment: 1 }, last_accessed_at: new Date() },
+    });
+
+    if (share.inspection.report_url) {
+      const link = imagekitService.signedDownload(share.inspection.report_url, REPORT_DOWNLOAD_SECONDS, share.expires_at);
+      if (link) return { download_url: link.url };
+    }
+    const { documentService } = await import('../modules/documents/document-service.js');
+    return {
+      pdf: await documentService.getInspectionReportPdf(share.inspection_id),
+      filename: `Inspection-${share.inspection_id.slice(0, 8)}.pdf`,
+    };
+  }
+
   /**
    * Delete an inspection
    */
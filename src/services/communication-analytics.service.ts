@@ -0,0 +1,291 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface CommunicationAnalyticsQuery {
+  period?: string;
+  from?: string;
+  to?: string;
+  timezone?: string;
+}
+
+const DAY = 24 * 60 * 60 * 1000;
+const PERIODS: Record<string, number> = { '7d': 7, '30d': 30, '90d': 90, '12m': 365 };
+// Roles that see every conversation in their company; everyone else sees the ones they are in
+const COMPANY_WIDE_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+// Replies later than this are not counted as a response to the turn they follow
+const RESPONSE_WINDOW_DAYS = 14;
+
+const round = (value: number | null) => (value === null ? null : Math.round(value * 10) / 10);
+
+const validTimezone = (timezone: string) => {
+  try {
+    new Intl.DateTimeFormat('en', { timeZone: timezone });
+    return true;
+  } catch {
+    return false;
+  }
+};
+
+/**
+ * Communication analytics from the messages themselves: volumes over time, response times,
+ * the channels messages arrive and go out on, and the busiest hours of the week
+ */
+export class CommunicationAnalyticsService {
+  private prisma = getPrisma();
+
+  async getAnalytics(user: JWTClaims, query: CommunicationAnalyticsQuery = {}) {
+    const { from, to, bucket } = this.range(query);
+    const timezone = query.timezone || 'Africa/Nairobi';
+    if (!validTimezone(timezone)) {
+      throw new Error('timezone must be an IANA time zone such as Africa/Nairobi');
+    }
+    const scope = this.scope(user);
+
+    const [totals, volume, responses, sources, deliveries, hours] = await Promise.all([
+      this.totals(user, scope, from, to),
+      this.volume(scope, from, to, bucket, timezone),
+      this.responseTimes(scope, from, to),
+      this.sources(scope, from, to),
+      this.deliveries(user, from, to),
+      this.busiestHours(scope, from, to, timezone),
+    ]);
+
+    return {
+      period: { from, to, bucket, timezone },
+      totals,
+      volume,
+      first_response: responses,
+      channels: { messages: sources, deliveries },
+      busiest_hours: hours,
+    };
+  }
+
+  /**
+   * The overview card: message counts for the last 30 days and the user's unread messages
+   */
+  async getOverview(user: JWTClaims) {
+    const to = new Date();
+    const from = new Date(to.getTime() - 30 * DAY);
+    const [totals, responses] = await Promise.all([
+      this.totals(user, this.scope(user), from, to),
+      this.responseTimes(this.scope(user), from, to),
+    ]);
+    const unread = await this.prisma.messageRecipient.count({
+      where: { recipient_id: user.user_id, is_read: false, message: { status: { not: 'draft' } } },
+    });
+    return {
+      total_messages: totals.messages,
+      unread_messages: unread,
+      sent_messages: totals.sent_by_you,
+      received_messages: totals.messages - totals.sent_by_you,
+      active_conversations: totals.conversations,
+      median_first_response_minutes: responses.median_minutes,
+      period: { from, to },
+    };
+  }
+
+  private range(query: CommunicationAnalyticsQuery) {
+    let to = new Date();
+    let from: Date;
+    if (query.from || query.to) {
+      from = query.from ? new Date(query.from) : new Date(NaN);
+      to = query.to ? new Date(query.to) : to;
+      if (isNaN(from.getTime()) || isNaN(to.getTime())) {
+        throw new Error('from and to must be valid dates');
+      }
+      if (from >= to) {
+        throw new Error('from must be before to');
+      }
+      if (to.getTime() - from.getTime() > 2 * 365 * DAY) {
+        throw new Error('Date range must be at most two years');
+      }
+    } else {
+      const period = query.period || '30d';
+      if (!PERIODS[period]) {
+        throw new Error(`period must be one of: ${Object.keys(PERIODS).join(', ')}`);
+      }
+      from = new Date(to.getTime() - PERIODS[period] * DAY);
+    }
+    const days = (to.getTime() - from.getTime()) / DAY;
+    return { from, to, bucket: days <= 31 ? 'day' : days <= 120 ? 'week' : 'month' };
+  }
+
+  // Sent, non-system conversation messages the user may see
+  private scope(user: JWTClaims) {
+    const visible = COMPANY_WIDE_ROLES.includes(user.role)
+      ? user.role === 'super_admin' ? Prisma.empty : Prisma.sql`AND m.company_id = ${user.company_id}::uuid`
+      : Prisma.sql`AND m.conversation_id IN (
+          SELECT conversation_id FROM conversation_participants WHERE user_id = ${user.user_id}::uuid
+        )`;
+    return Prisma.sql`
+      FROM messages m
+      JOIN users s ON s.id = m.sender_id
+      WHERE m.conversation_id IS NOT NULL
+        AND m.sent_at IS NOT NULL
+        AND m.message_type <> 'system'
+        ${visible}
+    `;
+  }
+
+  private async totals(user: JWTClaims, scope: Prisma.Sql, from: Date, to: Date) {
+    const [row] = await this.prisma.$queryRaw<Array<{ messages: number; conversations: number; senders: number; sent_by_you: number }>>`
+      SELECT COUNT(*)::int AS messages,
+             COUNT(DISTINCT m.conversation_id)::int AS conversations,
+             COUNT(DISTINCT m.sender_id)::int AS senders,
+             COUNT(*) FILTER (WHERE m.sender_id = ${user.user_id}::uuid)::int AS sent_by_you
+      ${scope}
+        AND m.sent_at >= ${from} AND m.sent_at < ${to}
+    `;
+    const byRole = await this.prisma.$queryRaw<Array<{ role: string; count: number }>>`
+      SELECT s.role::text AS role, COUNT(*)::int AS count
+      ${scope}
+        AND m.sent_at >= ${from} AND m.sent_at < ${to}
+      GROUP BY s.role
+      ORDER BY count DESC
+    `;
+    return { ...row, by_sender_role: byRole };
+  }
+
+  private async volume(scope: Prisma.Sql, from: Date, to: Date, bucket: string, timezone: string) {
+    const rows = await this.prisma.$queryRaw<Array<{ bucket: Date; messages: number; conversations: number }>>`
+      SELECT date_trunc(${bucket}, m.sent_at AT TIME ZONE ${timezone}) AS bucket,
+             COUNT(*)::int AS messages,
+             COUNT(DISTINCT m.conversation_id)::int AS conversations
+      ${scope}
+        AND m.sent_at >= ${from} AND m.sent_at < ${to}
+      GROUP BY 1
+      ORDER BY 1
+    `;
+    return rows.map(row => ({
+      bucket: row.bucket.toISOString().slice(0, 10),
+      messages: row.messages,
+      conversations: row.conversations,
+    }));
+  }
+
+  /**
+   * Time to first response: a turn starts when someone writes after another person (or opens the
+   * conversation); it is answered by the first later message from anyone else
+   */
+  private async responseTimes(scope: Prisma.Sql, from: Date, to: Date) {
+    const rows = await this.prisma.$queryRaw<Array<{
+      role: string;
+      turns: number;
+      answered: number;
+      median_minutes: number | null;
+      p90_minutes: number | null;
+      within_hour: number;
+    }>>`
+      WITH scoped AS (
+        SELECT m.id, m.conversation_id, m.sender_id, m.sent_at, s.role::text AS role
+        ${scope}
+          AND m.sent_at >= ${new Date(from.getTime() - RESPONSE_WINDOW_DAYS * DAY)}
+          AND m.sent_at < ${new Date(to.getTime() + RESPONSE_WINDOW_DAYS * DAY)}
+      ),
+      turns AS (
+        SELECT t.*, (
+          SELECT MIN(r.sent_at) FROM scoped r
+          WHERE r.conversation_id = t.conversation_id
+            AND r.sent_at > t.sent_at
+            AND r.sender_id <> t.sender_id
+            AND r.sent_at <= t.sent_at + ${RESPONSE_WINDOW_DAYS}::int * interval '1 day'
+        ) AS replied_at
+        FROM (
+          SELECT scoped.*, LAG(sender_id) OVER (PARTITION BY conversation_id ORDER BY sent_at) AS previous_sender
+          FROM scoped
+        ) t
+        WHERE (t.previous_sender IS NULL OR t.previous_sender <> t.sender_id)
+          AND t.sent_at >= ${from} AND t.sent_at < ${to}
+      )
+      SELECT COALESCE(role, 'all') AS role,
+             COUNT(*)::int AS turns,
+             COUNT(replied_at)::int AS answered,
+             (percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM replied_at - sent_at)) / 60)::float8 AS median_minutes,
+             (percentile_cont(0.9) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM replied_at - sent_at)) / 60)::float8 AS p90_minutes,
+             COUNT(*) FILTER (WHERE replied_at <= sent_at + interval '1 hour')::int AS within_hour
+      FROM turns
+      GROUP BY ROLLUP(role)
+    `;
+
+    const summarize = (row: (typeof rows)[number]) => ({
+      turns: row.turns,
+      answered: row.answered,
+      median_minutes: round(row.median_minutes),
+      p90_minutes: round(row.p90_minutes),
+      answered_within_hour_rate: row.turns ? round((row.within_hour / row.turns) * 100) : null,
+    });
+    const overall = rows.find(row => row.role === 'all');
+    return {
+      ...(overall ? summarize(overall) : { turns: 0, answered: 0, median_minutes: null, p90_minutes: null, answered_within_hour_rate: null }),
+      // Keyed by the role that started the turn: how long tenants wait, how long staff wait
+      by_sender_role: Object.fromEntries(rows.filter(row => row.role !== 'all').map(row => [row.role, summarize(row)])),
+    };
+  }
+
+  // Where messages were written: in the app, or as email replies posted into the thread
+  private async sources(scope: Prisma.Sql, from: Date, to: Date) {
+    return this.prisma.$queryRaw<Array<{ source: string; count: number }>>`
+      SELECT COALESCE(m.metadata->>'source', 'app') AS source, COUNT(*)::int AS count
+      ${scope}
+        AND m.sent_at >= ${from} AND m.sent_at < ${to}
+      GROUP BY 1
+      ORDER BY count DESC
+    `;
+  }
+
+  // Outbound push, email and SMS deliveries (notifications and broadcasts) by channel and outcome
+  private async deliveries(user: JWTClaims, from: Date, to: Date) {
+    const logs = await this.prisma.notificationDeliveryLog.groupBy({
+      by: ['channel', 'status'],
+      where: {
+        created_at: { gte: from, lt: to },
+        ...(COMPANY_WIDE_ROLES.includes(user.role)
+          ? user.role === 'super_admin' ? {} : { notification: { company_id: user.company_id! } }
+          : { user_id: user.user_id }),
+      },
+      _count: { _all: true },
+    });
+
+    const channels = new Map<string, { channel: string; total: number; sent: number; failed: number; pending: number }>();
+    for (const log of logs) {
+      const row = channels.get(log.channel) || { channel: log.channel, total: 0, sent: 0, failed: 0, pending: 0 };
+      const count = log._count._all;
+      row.total += count;
+      if (['sent', 'delivered', 'read'].includes(log.status)) row.sent += count;
+      else if (['failed', 'dead_letter'].includes(log.status)) row.failed += count;
+      else if (log.status !== 'skipped') row.pending += count;
+      channels.set(log.channel, row);
+    }
+    return [...channels.values()].sort((a, b) => b.total - a.total);
+  }
+
+  /**
+   * Messages by hour of day (local time), overall and per weekday, with the top hours first
+   */
+  private async busiestHours(scope: Prisma.Sql, from: Date, to: Date, timezone: string) {
+    const rows = await this.prisma.$queryRaw<Array<{ dow: number; hour: number; count: number }>>`
+      SELECT EXTRACT(ISODOW FROM m.sent_at AT TIME ZONE ${timezone})::int AS dow,
+             EXTRACT(HOUR FROM m.sent_at AT TIME ZONE ${timezone})::int AS hour,
+             COUNT(*)::int AS count
+      ${scope}
+        AND m.sent_at >= ${from} AND m.sent_at < ${to}
+      GROUP BY 1, 2
+    `;
+
+    const byHour = Array.from({ length: 24 }, (_, hour) => ({ hour, count: 0 }));
+    const weekdays = ['monday', 'tuesday', 'wednesday', 'thursday', 'friday', 'saturday', 'sunday'];
+    const heatmap = weekdays.map(day => ({ day, hours: new Array(24).fill(0) as number[] }));
+    for (const row of rows) {
+      byHour[row.hour].count += row.count;
+      heatmap[row.dow - 1].hours[row.hour] += row.count;
+    }
+    return {
+      by_hour: byHour,
+      top: [...byHour].filter(h => h.count > 0).sort((a, b) => b.count - a.count).slice(0, 3),
+      by_weekday: heatmap,
+    };
+  }
+}
+
+export const communicationAnalyticsService = new CommunicationAnalyticsService();
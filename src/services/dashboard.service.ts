@@ -32,196 +32,330 @@ export interface OnboardingStatus {
   };
 }
 
+interface DashboardWidget {
+  id: string;
+  type: 'stat' | 'chart' | 'feed' | 'quick_action';
+  title: string;
+  // Stat widgets: the figures they show
+  fields?: Array<keyof DashboardStats>;
+}
+
+export const DASHBOARD_WIDGETS: DashboardWidget[] = [
+  { id: 'portfolio', type: 'stat', title: 'Portfolio', fields: ['total_properties', 'total_units', 'occupied_units', 'vacant_units', 'occupancy_rate'] },
+  { id: 'tenants', type: 'stat', title: 'Tenants', fields: ['total_tenants', 'active_tenants'] },
+  { id: 'revenue', type: 'stat', title: 'Rent roll', fields: ['monthly_revenue', 'annual_revenue'] },
+  { id: 'collection_rate', type: 'stat', title: 'Collection rate', fields: ['collection_rate'] },
+  { id: 'maintenance', type: 'stat', title: 'Maintenance', fields: ['pending_maintenance', 'urgent_maintenance'] },
+  { id: 'overdue_payments', type: 'stat', title: 'Overdue invoices', fields: ['overdue_payments'] },
+  { id: 'expiring_leases', type: 'stat', title: 'Leases expiring soon', fields: ['expiring_leases'] },
+  { id: 'inspections', type: 'stat', title: 'Pending inspections', fields: ['pending_inspections'] },
+  { id: 'revenue_chart', type: 'chart', title: 'Collections, last 6 months' },
+  { id: 'occupancy_chart', type: 'chart', title: 'Occupancy, last 12 months' },
+  { id: 'maintenance_chart', type: 'chart', title: 'Open maintenance by priority' },
+  { id: 'kpi_alerts', type: 'feed', title: 'Alerts' },
+  { id: 'quick_actions', type: 'quick_action', title: 'Quick actions' },
+];
+
+const WIDGETS_BY_ID = new Map(DASHBOARD_WIDGETS.map(widget => [widget.id, widget]));
+// Users who have not chosen see every stat, as before widgets were configurable, their alerts and the quick actions
+const DEFAULT_WIDGETS = [...DASHBOARD_WIDGETS.filter(w => w.type === 'stat').map(w => w.id), 'kpi_alerts', 'quick_actions'];
+const STAT_FIELDS = DASHBOARD_WIDGETS.flatMap(w => w.fields || []);
+const EXPIRING_LEASE_DAYS = 60;
+
+const QUICK_ACTIONS = [
+  { id: 'add_property', label: 'Add property', path: '/properties/new', roles: ['super_admin', 'agency_admin', 'landlord'] },
+  { id: 'add_tenant', label: 'Add tenant', path: '/tenants/new', roles: ['super_admin', 'agency_admin', 'landlord', 'agent', 'manager'] },
+  { id: 'record_payment', label: 'Record payment', path: '/payments/new', roles: ['super_admin', 'agency_admin', 'landlord', 'agent', 'manager', 'accountant', 'finance'] },
+  { id: 'create_invoice', label: 'Create invoice', path: '/invoices/new', roles: ['super_admin', 'agency_admin', 'landlord', 'agent', 'manager', 'accountant', 'finance'] },
+  { id: 'log_maintenance', label: 'Log maintenance request', path: '/maintenance/new', roles: ['super_admin', 'agency_admin', 'landlord', 'agent', 'manager', 'caretaker'] },
+  { id: 'record_expense', label: 'Record expense', path: '/expenses/new', roles: ['super_admin', 'agency_admin', 'landlord', 'accountant', 'finance'] },
+];
+
+const quickActionsFor = (user: JWTClaims) =>
+  QUICK_ACTIONS.filter(action => action.roles.includes(user.role)).map(({ roles, ...action }) => action);
+
 export class DashboardService {
   private prisma = getPrisma();
 
-  async getDashboardStats(user: JWTClaims, ownerId?: string): Promise<DashboardStats> {
-    // Initialize default stats
-    let stats: DashboardStats = {
-      total_properties: 0,
-      total_units: 0,
-      occupied_units: 0,
-      vacant_units: 0,
-      occupancy_rate: 0,
-      total_tenants: 0,
-      active_tenants: 0,
-      monthly_revenue: 0,
-      annual_revenue: 0,
-      pending_maintenance: 0,
-      urgent_maintenance: 0,
-      pending_inspections: 0,
-      overdue_payments: 0,
-      expiring_leases: 0,
-    };
-
-    try {
-      // Build where clause based on user role and company
-      const whereClause: any = {};
-      
-      if (user.role !== 'super_admin') {
-        if (user.company_id) {
-          whereClause.company_id = user.company_id;
-        }
-        
-        // For landlords, only show their own properties
-        if (user.role === 'landlord') {
-          whereClause.owner_id = user.user_id;
-        }
-      } else {
-        // For super_admin, filter by owner_id if provided
-        if (ownerId) {
-          whereClause.owner_id = ownerId;
-        }
-      }
+  /**
+   * Widgets the user can put on their dashboard
+   */
+  getAvailableWidgets(user: JWTClaims) {
+    return DASHBOARD_WIDGETS.map(({ fields, ...widget }) => ({
+      ...widget,
+      default: DEFAULT_WIDGETS.includes(widget.id),
+      ...(widget.id === 'quick_actions' && { actions: quickActionsFor(user) }),
+    }));
+  }
 
-      // Count properties
-      const totalProperties = await this.prisma.property.count({
-        where: whereClause,
-      });
+  async getWidgetPreferences(user: JWTClaims) {
+    const preferences = await this.prisma.userPreferences.findUnique({
+      where: { user_id: user.user_id },
+      select: { dashboard_widgets: true },
+    });
+    const saved = (preferences?.dashboard_widgets || []).filter(id => WIDGETS_BY_ID.has(id));
+    return {
+      selected: saved.length ? saved : DEFAULT_WIDGETS,
+      is_default: saved.length === 0,
+      available: this.getAvailableWidgets(user),
+    };
+  }
 
-      // Count units and calculate occupancy
-      const unitsStats = await this.prisma.unit.aggregate({
-        where: {
-          property: whereClause,
-        },
-        _count: {
-          id: true,
-        },
-        _sum: {
-          rent_amount: true,
-        },
-      });
+  /**
+   * Save the widgets to show, in display order; an empty list goes back to the defaults
+   */
+  async updateWidgetPreferences(user: JWTClaims, widgets: string[]) {
+    if (!Array.isArray(widgets)) {
+      throw new Error('widgets must be a list of widget ids');
+    }
+    const unknown = widgets.find(id => !WIDGETS_BY_ID.has(id));
+    if (unknown) {
+      throw new Error(`widgets must be from: ${DASHBOARD_WIDGETS.map(w => w.id).join(', ')}; ${unknown} is not one`);
+    }
+    const ordered = [...new Set(widgets)];
+    await this.prisma.userPreferences.upsert({
+      where: { user_id: user.user_id },
+      create: { user_id: user.user_id, dashboard_widgets: ordered },
+      update: { dashboard_widgets: ordered, updated_at: new Date() },
+    });
+    return this.getWidgetPreferences(user);
+  }
 
-      const occupiedUnitsCount = await this.prisma.unit.count({
-        where: {
-          property: whereClause,
-          status: 'occupied',
-        },
-      });
+  /**
+   * Dashboard with only the widgets the user picked (or asked for in this request), in their order.
+   * Stat figures stay at the top level as in the full stats; charts and quick actions come with
+   * their data in `widgets`. Nothing is queried for widgets that are not shown.
+   */
+  async getDashboardOverview(user: JWTClaims, ownerId?: string, requested?: string[]) {
+    const selected = requested?.length
+      ? requested.filter(id => WIDGETS_BY_ID.has(id))
+      : (await this.getWidgetPreferences(user)).selected;
+    const statFields = selected.flatMap(id => WIDGETS_BY_ID.get(id)!.fields || []);
+    const [stats, ...charts] = await Promise.all([
+      statFields.length ? this.computeStats(user, ownerId, new Set(statFields)) : Promise.resolve({} as Partial<DashboardStats>),
+      ...selected.map(id => this.widgetData(id, user, ownerId)),
+    ]);
 
-      const occupiedUnitsRevenue = await this.prisma.unit.aggregate({
-        where: {
-          property: whereClause,
-          status: 'occupied',
-        },
-        _sum: {
-          rent_amount: true,
-        },
-      });
+    return {
+      ...stats,
+      widgets: selected.map((id, index) => {
+        const { fields, ...widget } = WIDGETS_BY_ID.get(id)!;
+        return {
+          ...widget,
+          position: index,
+          data: fields ? Object.fromEntries(fields.map(field => [field, stats[field] ?? 0])) : charts[index],
+        };
+      }),
+    };
+  }
 
-      // Count active tenants
-      const activeTenants = await this.prisma.unit.count({
-        where: {
-          property: whereClause,
-          current_tenant_id: { not: null },
-        },
-      });
+  async getDashboardStats(user: JWTClaims, ownerId?: string): Promise<DashboardStats> {
+    return (await this.computeStats(user, ownerId, new Set(STAT_FIELDS))) as DashboardStats;
+  }
 
-      // Count pending maintenance requests
-      // Filter by properties that match the whereClause and status is pending or in_progress
-      const maintenanceWhereClause: any = {
-        status: { in: ['pending', 'in_progress'] },
-      };
-      
-      // Filter by company_id if available (for agent/agency-admin)
+  /**
+   * Properties in view: the company's, a landlord's own, or for super admins optionally one owner's
+   */
+  private propertyScope(user: JWTClaims, ownerId?: string) {
+    const whereClause: any = {};
+    if (user.role !== 'super_admin') {
       if (user.company_id) {
-        maintenanceWhereClause.company_id = user.company_id;
+        whereClause.company_id = user.company_id;
       }
-      
-      // Filter by properties that match the whereClause
-      // This ensures we only count maintenance for properties the user has access to
-      if (Object.keys(whereClause).length > 0) {
-        maintenanceWhereClause.property = whereClause;
+      // For landlords, only show their own properties
+      if (user.role === 'landlord') {
+        whereClause.owner_id = user.user_id;
       }
+    } else if (ownerId) {
+      // For super_admin, filter by owner_id if provided
+      whereClause.owner_id = ownerId;
+    }
+    return whereClause;
+  }
 
-      const pendingMaintenance = await this.prisma.maintenanceRequest.count({
-        where: maintenanceWhereClause,
-      });
-
-      // Count urgent maintenance requests (high or urgent priority, pending or in_progress)
-      const urgentMaintenanceWhereClause: any = {
-        ...maintenanceWhereClause,
-        priority: { in: ['high', 'urgent'] },
-      };
+  /**
+   * Only the figures asked for are queried
+   */
+  private async computeStats(user: JWTClaims, ownerId: string | undefined, fields: Set<keyof DashboardStats>): Promise<Partial<DashboardStats>> {
+    const wants = (...names: Array<keyof DashboardStats>) => names.some(name => fields.has(name));
+    const stats: Partial<DashboardStats> = {};
 
-      const urgentMaintenance = await this.prisma.maintenanceRequest.count({
-        where: urgentMaintenanceWhereClause,
-      });
+    try {
+      const whereClause = this.propertyScope(user, ownerId);
+      const scoped = Object.keys(whereClause).length > 0;
 
-      // Calculate collection rate (based on invoices)
-      let collectionRate = 0;
-      try {
-        const invoiceWhereClause: any = {};
-        if (user.company_id) {
-          invoiceWhereClause.company_id = user.company_id;
-        }
-        if (Object.keys(whereClause).length > 0) {
-          invoiceWhereClause.unit = {
-            property: whereClause,
-          };
-        }
+      const maintenanceWhereClause: any = {
+        status: { in: ['pending', 'in_progress'] },
+        // Filter by company_id if available (for agent/agency-admin)
+        ...(user.company_id && { company_id: user.company_id }),
+        // Only maintenance for properties the user has access to
+        ...(scoped && { property: whereClause }),
+      };
+      const invoiceWhereClause: any = {
+        ...(user.company_id && { company_id: user.company_id }),
+        ...(scoped && { unit: { property: whereClause } }),
+      };
+      const now = new Date();
 
-        const [totalInvoiced, totalPaid] = await Promise.all([
-          this.prisma.invoice.aggregate({
-            where: invoiceWhereClause,
-            _sum: {
-              total_amount: true,
-            },
-          }),
-          this.prisma.invoice.aggregate({
+      const [totalProperties, unitSummary, activeTenants, pendingMaintenance, urgentMaintenance, collectionRate, overduePayments, expiringLeases, pendingInspections] = await Promise.all([
+        wants('total_properties') ? this.prisma.property.count({ where: whereClause }) : null,
+        wants('total_units', 'occupied_units', 'vacant_units', 'occupancy_rate', 'monthly_revenue', 'annual_revenue')
+          ? this.prisma.unit.groupBy({
+            by: ['status'],
+            where: { property: whereClause },
+            _count: { _all: true },
+            _sum: { rent_amount: true },
+          })
+          : null,
+        wants('total_tenants', 'active_tenants')
+          ? this.prisma.unit.count({ where: { property: whereClause, current_tenant_id: { not: null } } })
+          : null,
+        wants('pending_maintenance') ? this.prisma.maintenanceRequest.count({ where: maintenanceWhereClause }) : null,
+        // High or urgent priority, pending or in progress
+        wants('urgent_maintenance')
+          ? this.prisma.maintenanceRequest.count({ where: { ...maintenanceWhereClause, priority: { in: ['high', 'urgent'] } } })
+          : null,
+        wants('collection_rate') ? this.collectionRate(invoiceWhereClause) : null,
+        wants('overdue_payments')
+          ? this.prisma.invoice.count({
+            where: { ...invoiceWhereClause, OR: [{ status: 'overdue' }, { status: 'sent', due_date: { lt: now } }] },
+          })
+          : null,
+        wants('expiring_leases')
+          ? this.prisma.lease.count({
             where: {
-              ...invoiceWhereClause,
-              status: 'paid',
+              ...(user.company_id && { company_id: user.company_id }),
+              ...(scoped && { property: whereClause }),
+              status: 'active',
+              end_date: { gte: now, lte: new Date(now.getTime() + EXPIRING_LEASE_DAYS * 24 * 60 * 60 * 1000) },
             },
-            _sum: {
-              total_amount: true,
+          })
+          : null,
+        wants('pending_inspections')
+          ? this.prisma.inspection.count({
+            where: {
+              ...(user.company_id && { company_id: user.company_id }),
+              ...(scoped && { property: whereClause }),
+              status: { in: ['scheduled', 'pending_review'] },
             },
-          }),
-        ]);
+          })
+          : null,
+      ]);
 
-        const totalInvoicedAmount = Number(totalInvoiced._sum.total_amount || 0);
-        const totalPaidAmount = Number(totalPaid._sum.total_amount || 0);
-        
-        if (totalInvoicedAmount > 0) {
-          collectionRate = (totalPaidAmount / totalInvoicedAmount) * 100;
-        }
-      } catch (error) {
-        console.error('Error calculating collection rate:', error);
-        // Default to 0 if calculation fails
+      if (totalProperties !== null) stats.total_properties = totalProperties;
+      if (unitSummary) {
+        const totalUnits = unitSummary.reduce((sum, group) => sum + group._count._all, 0);
+        const occupied = unitSummary.find(group => group.status === 'occupied');
+        const occupiedUnits = occupied?._count._all || 0;
+        const monthlyRevenue = Number(occupied?._sum.rent_amount || 0);
+        Object.assign(stats, {
+          total_units: totalUnits,
+          occupied_units: occupiedUnits,
+          vacant_units: totalUnits - occupiedUnits,
+          occupancy_rate: totalUnits > 0 ? Math.round((occupiedUnits / totalUnits) * 10000) / 100 : 0, // Round to 2 decimal places
+          monthly_revenue: monthlyRevenue,
+          annual_revenue: monthlyRevenue * 12,
+        });
       }
-
-      // Calculate stats
-      const totalUnits = unitsStats._count?.id || 0;
-      const occupiedUnits = occupiedUnitsCount || 0;
-      const vacantUnits = totalUnits - occupiedUnits;
-      const occupancyRate = totalUnits > 0 ? (occupiedUnits / totalUnits) * 100 : 0;
-      const monthlyRevenue = Number(occupiedUnitsRevenue._sum.rent_amount || 0);
-      const annualRevenue = monthlyRevenue * 12;
-
-      stats = {
-        total_properties: totalProperties,
-        total_units: totalUnits,
-        occupied_units: occupiedUnits,
-        vacant_units: vacantUnits,
-        occupancy_rate: Math.round(occupancyRate * 100) / 100, // Round to 2 decimal places
-        total_tenants: activeTenants,
-        active_tenants: activeTenants,
-        monthly_revenue: monthlyRevenue,
-        annual_revenue: annualRevenue,
-        pending_maintenance: pendingMaintenance,
-        urgent_maintenance: urgentMaintenance,
-        pending_inspections: 0, // TODO: Implement when inspections table exists
-        overdue_payments: 0, // TODO: Implement when payments table exists
-        expiring_leases: 0, // TODO: Implement lease expiration logic
-        collection_rate: Math.round(collectionRate * 100) / 100, // Round to 2 decimal places
-      };
-
+      if (activeTenants !== null) Object.assign(stats, { total_tenants: activeTenants, active_tenants: activeTenants });
+      if (pendingMaintenance !== null) stats.pending_maintenance = pendingMaintenance;
+      if (urgentMaintenance !== null) stats.urgent_maintenance = urgentMaintenance;
+      if (collectionRate !== null) stats.collection_rate = collectionRate;
+      if (overduePayments !== null) stats.overdue_payments = overduePayments;
+      if (expiringLeases !== null) stats.expiring_leases = expiringLeases;
+      if (pendingInspections !== null) stats.pending_inspections = pendingInspections;
     } catch (error) {
       console.error('Error calculating dashboard stats:', error);
       // Return default stats on error
     }
 
-    return stats;
+    // Figures that could not be calculated show as zero
+    return Object.fromEntries([...fields].map(field => [field, stats[field] ?? 0])) as Partial<DashboardStats>;
+  }
+
+  /**
+   * Share of invoiced amounts that has been paid
+   */
+  private async collectionRate(invoiceWhereClause: any): Promise<number> {
+    try {
+      const [totalInvoiced, totalPaid] = await Promise.all([
+        this.prisma.invoice.aggregate({ where: invoiceWhereClause, _sum: { total_amount: true } }),
+        this.prisma.invoice.aggregate({ where: { ...invoiceWhereClause, status: 'paid' }, _sum: { total_amount: true } }),
+      ]);
+      const totalInvoicedAmount = Number(totalInvoiced._sum.total_amount || 0);
+      const totalPaidAmount = Number(totalPaid._sum.total_amount || 0);
+      return totalInvoicedAmount > 0 ? Math.round((totalPaidAmount / totalInvoicedAmount) * 10000) / 100 : 0;
+    } catch (error) {
+      console.error('Error calculating collection rate:', error);
+      // Default to 0 if calculation fails
+      return 0;
+    }
+  }
+
+  /**
+   * Data for chart, feed and quick action widgets; stat widgets are filled from the stats
+   */
+  private async widgetData(id: string, user: JWTClaims, ownerId?: string): Promise<any> {
+    const whereClause = this.propertyScope(user, ownerId);
+    const scoped = Object.keys(whereClause).length > 0;
+    try {
+      switch (id) {
+        case 'revenue_chart': {
+          const now = new Date();
+          const start = new Date(now.getFullYear(), now.getMonth() - 5, 1);
+          const payments = await this.prisma.payment.findMany({
+            where: {
+              ...(user.company_id && { company_id: user.company_id }),
+              ...(scoped && { property: whereClause }),
+              status: { in: ['completed', 'approved'] },
+              payment_date: { gte: start },
+            },
+            select: { amount: true, payment_date: true },
+          });
+          const months = Array.from({ length: 6 }, (_, i) => {
+            const date = new Date(start.getFullYear(), start.getMonth() + i, 1);
+            return { month: `${date.getFullYear()}-${String(date.getMonth() + 1).padStart(2, '0')}`, amount: 0 };
+          });
+          for (const payment of payments) {
+            const key = `${payment.payment_date.getFullYear()}-${String(payment.payment_date.getMonth() + 1).padStart(2, '0')}`;
+            const month = months.find(m => m.month === key);
+            if (month) month.amount += Number(payment.amount);
+          }
+          return months.map(m => ({ ...m, amount: Math.round(m.amount * 100) / 100 }));
+        }
+        case 'occupancy_chart': {
+          const { occupancyHistoryService } = await import('./occupancy-history.service.js');
+          const trend = await occupancyHistoryService.getTrend(user, { months: 12 });
+          return trend.months.map((m: any) => ({ month: m.month, occupancy_rate: m.occupancy_rate }));
+        }
+        case 'maintenance_chart': {
+          const groups = await this.prisma.maintenanceRequest.groupBy({
+            by: ['priority'],
+            where: {
+              status: { in: ['pending', 'in_progress'] },
+              ...(user.company_id && { company_id: user.company_id }),
+              ...(scoped && { property: whereClause }),
+            },
+            _count: { _all: true },
+          });
+          return ['urgent', 'high', 'medium', 'low'].map(priority => ({
+            priority,
+            count: groups.find(g => g.priority === priority)?._count._all || 0,
+          }));
+        }
+        case 'kpi_alerts': {
+          const { kpiAlertsService } = await import('./kpi-alerts.service.js');
+          return kpiAlertsService.getFeed(user, { status: 'open', limit: 10 });
+        }
+        case 'quick_actions':
+          return quickActionsFor(user);
+        default:
+          return null;
+      }
+    } catch (error) {
+      console.error(`Error loading dashboard widget ${id}:`, error);
+      return null;
+    }
   }
 
   async getOnboardingStatus(user: JWTClaims): Promise<OnboardingStatus> {
@@ -0,0 +1,388 @@
+import crypto from 'crypto';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { systemLogsService } from './system-logs.service.js';
+import { imagekitService } from './imagekit.service.js';
+
+export type ErasureMode = 'anonymize' | 'erase';
+
+const MODES: ErasureMode[] = ['anonymize', 'erase'];
+const REQUESTER_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+// A tenant with one of these leases is still a tenant, not a former one
+const OPEN_LEASE_STATUSES = ['draft', 'active'];
+const UUID_PATTERN = /^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/i;
+const REDACTED = '[redacted]';
+// Enough of a phone number to reconcile a payment against the bank statement
+const maskPhone = (phone: string) => (phone.length > 3 ? `${'*'.repeat(phone.length - 3)}${phone.slice(-3)}` : '***');
+const escapeRegExp = (value: string) => value.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+
+/**
+ * Anonymization and erasure of a former tenant's personal data under the Kenya Data Protection
+ * Act and GDPR. Landlords and agency admins raise a request, a different super admin approves it,
+ * and only then is it carried out. Leases, invoices and payments are kept with their amounts and
+ * dates for the books, linked to the pseudonymised user; personal details are stripped from them.
+ */
+export class DataErasureService {
+  private prisma = getPrisma();
+
+  async request(user: JWTClaims, input: { subject_id?: string; mode?: string; reason?: string }) {
+    if (!REQUESTER_ROLES.includes(user.role)) {
+      throw new Error('You do not have permission to request data erasure');
+    }
+    if (!input.subject_id || !UUID_PATTERN.test(input.subject_id)) {
+      throw new Error('subject_id is required');
+    }
+    const mode = (input.mode || 'anonymize') as ErasureMode;
+    if (!MODES.includes(mode)) {
+      throw new Error(`mode must be one of: ${MODES.join(', ')}`);
+    }
+    const reason = input.reason?.trim();
+    if (!reason) {
+      throw new Error('reason is required');
+    }
+
+    const subject = await this.findSubject(user, input.subject_id);
+    await this.assertFormerTenant(subject.id);
+    const open = await this.prisma.dataErasureRequest.findFirst({
+      where: { subject_id: subject.id, status: { in: ['pending', 'approved'] } },
+    });
+    if (open) {
+      throw new Error('An erasure request for this tenant is already pending');
+    }
+    const completed = await this.prisma.dataErasureRequest.findFirst({ where: { subject_id: subject.id, status: 'completed' } });
+    if (completed) {
+      throw new Error("This tenant's data has already been erased");
+    }
+
+    const request = await this.prisma.dataErasureRequest.create({
+      data: { subject_id: subject.id, company_id: subject.company_id, mode, reason, requested_by: user.user_id },
+    });
+    await this.notifySuperAdmins(subject.company_id, `A ${mode} request for ${subject.first_name} ${subject.last_name} is waiting for review.`, request.id);
+    return request;
+  }
+
+  async list(user: JWTClaims, filters: { status?: string; subject_id?: string; page?: number; limit?: number } = {}) {
+    const where: any = {};
+    if (user.role !== 'super_admin') {
+      if (!REQUESTER_ROLES.includes(user.role)) {
+        throw new Error('You do not have permission to view erasure requests');
+      }
+      where.company_id = user.company_id;
+    }
+    if (filters.status) where.status = filters.status;
+    if (filters.subject_id) where.subject_id = filters.subject_id;
+    const page = Math.max(filters.page || 1, 1);
+    const limit = Math.min(Math.max(filters.limit || 50, 1), 200);
+    const [requests, total] = await Promise.all([
+      this.prisma.dataErasureRequest.findMany({ where, orderBy: { requested_at: 'desc' }, take: limit, skip: (page - 1) * limit }),
+      this.prisma.dataErasureRequest.count({ where }),
+    ]);
+    return { requests, total, page, limit, pages: Math.ceil(total / limit) };
+  }
+
+  async get(user: JWTClaims, id: string) {
+    const request = await this.prisma.dataErasureRequest.findUnique({ where: { id } });
+    if (!request || (user.role !== 'super_admin' && (!REQUESTER_ROLES.includes(user.role) || request.company_id !== user.company_id))) {
+      throw new Error('erasure request not found');
+    }
+    return request;
+  }
+
+  /**
+   * Withdraw a request before it is reviewed
+   */
+  async cancel(user: JWTClaims, id: string) {
+    const request = await this.get(user, id);
+    if (request.status !== 'pending') {
+      throw new Error(`Only pending requests can be cancelled; this one is ${request.status}`);
+    }
+    return this.prisma.dataErasureRequest.update({
+      where: { id },
+      data: { status: 'rejected', reviewed_by: user.user_id, reviewed_at: new Date(), review_note: 'Cancelled by requester', updated_at: new Date() },
+    });
+  }
+
+  /**
+   * Approve and carry out, or reject, a pending request. The reviewer must be a super admin who
+   * did not raise it.
+   */
+  async review(user: JWTClaims, id: string, input: { decision?: string; note?: string }) {
+    if (user.role !== 'super_admin') {
+      throw new Error('Only super admins can review erasure requests');
+    }
+    if (input.decision !== 'approve' && input.decision !== 'reject') {
+      throw new Error('decision must be approve or reject');
+    }
+    const request = await this.get(user, id);
+    if (request.status !== 'pending') {
+      throw new Error(`Only pending requests can be reviewed; this one is ${request.status}`);
+    }
+    if (request.requested_by === user.user_id) {
+      throw new Error('A request must be reviewed by someone other than the requester');
+    }
+
+    const reviewed = { reviewed_by: user.user_id, reviewed_at: new Date(), review_note: input.note?.trim() || null, updated_at: new Date() };
+    if (input.decision === 'reject') {
+      if (!reviewed.review_note) {
+        throw new Error('note is required when rejecting a request');
+      }
+      return this.prisma.dataErasureRequest.update({ where: { id }, data: { ...reviewed, status: 'rejected' } });
+    }
+
+    // Claim the request so a second approval cannot run it twice
+    const { count } = await this.prisma.dataErasureRequest.updateMany({ where: { id, status: 'pending' }, data: { ...reviewed, status: 'approved' } });
+    if (count === 0) {
+      throw new Error('This request has already been reviewed');
+    }
+    return this.execute(request.id, user);
+  }
+
+  private async execute(id: string, reviewer: JWTClaims) {
+    const request = await this.prisma.dataErasureRequest.findUniqueOrThrow({ where: { id } });
+    try {
+      // The lease may have been renewed while the request waited
+      await this.assertFormerTenant(request.subject_id);
+      const subject = await this.prisma.user.findUniqueOrThrow({ where: { id: request.subject_id }, select: { id: true, email: true } });
+      // Stored files go first: if one cannot be deleted the request fails with the records still
+      // in place, instead of being certified with the file left behind
+      const storedFiles = await this.deleteStoredFiles(subject.id);
+      const counts = await this.prisma.$transaction(
+        tx => this.apply(tx, subject.id, subject.email, request.mode as ErasureMode),
+        { timeout: 60_000 },
+      );
+      counts.deleted.stored_files = storedFiles;
+      const certificate = {
+        request_id: request.id,
+        subject_id: request.subject_id,
+        company_id: request.company_id,
+        mode: request.mode,
+        reason: request.reason,
+        requested_by: request.requested_by,
+        requested_at: request.requested_at.toISOString(),
+        approved_by: reviewer.user_id,
+        completed_at: new Date().toISOString(),
+        ...counts,
+      };
+      const hash = crypto.createHash('sha256').update(JSON.stringify(certificate)).digest('hex');
+      const completed = await this.prisma.dataErasureRequest.update({
+        where: { id },
+        data: { status: 'completed', completed_at: new Date(certificate.completed_at), certificate, certificate_hash: hash, error: null, updated_at: new Date() },
+      });
+      await systemLogsService.record({
+        level: 'info',
+        service: 'data-erasure',
+        event: 'data_erasure',
+        message: `Certificate of ${request.mode === 'erase' ? 'erasure' : 'anonymization'} for erasure request ${request.id}`,
+        user: reviewer,
+        metadata: { certificate, certificate_hash: hash },
+      });
+      return completed;
+    } catch (error: any) {
+      await this.prisma.dataErasureRequest.update({ where: { id }, data: { status: 'failed', error: error.message, updated_at: new Date() } });
+      throw new Error(`Erasure failed: ${error.message}`);
+    }
+  }
+
+  /**
+   * Delete the subject's uploaded documents, profile picture and message attachments from
+   * storage. Inspection reports filed against them belong to the inspection and are kept.
+   */
+  private async deleteStoredFiles(subjectId: string) {
+    const [documents, profile, messages] = await Promise.all([
+      this.prisma.tenantDocument.findMany({ where: { tenant_id: subjectId, category: { not: 'inspection_report' } }, select: { url: true } }),
+      this.prisma.tenantProfile.findUnique({ where: { user_id: subjectId }, select: { profile_picture: true } }),
+      this.prisma.message.findMany({ where: { sender_id: subjectId }, select: { attachments: true } }),
+    ]);
+
+    let deleted = 0;
+    for (const url of [...documents.map(document => document.url), ...(profile?.profile_picture ? [profile.profile_picture] : [])]) {
+      if (await imagekitService.deleteFileByUrl(url)) deleted++;
+    }
+    const attachments = messages.flatMap(message => (Array.isArray(message.attachments) ? message.attachments : []) as any[]);
+    for (const attachment of attachments.filter(item => item?.file_id)) {
+      await imagekitService.deleteFile(attachment.file_id);
+      deleted++;
+    }
+    return deleted;
+  }
+
+  /**
+   * Strip the subject's personal data. Both modes pseudonymise the user, redact what they wrote
+   * in messages and delete what only serves to identify or contact them; erase also deletes
+   * their flags, applications, waiting-list places, SMS history and log entries rather than
+   * keeping them anonymized.
+   */
+  private async apply(tx: any, subjectId: string, email: string | null, mode: ErasureMode) {
+    const anonymized: Record<string, number> = {};
+    const deleted: Record<string, number> = {};
+    const erase = mode === 'erase';
+    // Applications, waiting-list places and failed sign-ins can predate the account, so they are
+    // matched by email as well
+    const byEmail = (field: string) => (email ? [{ [field]: { equals: email, mode: 'insensitive' } }] : []);
+    const applications = { OR: [{ applicant_id: subjectId }, { tenant_id: subjectId }, ...byEmail('email')] };
+    const waitlist = { OR: [{ applicant_id: subjectId }, ...byEmail('email')] };
+    const logs = {
+      event: { not: 'data_erasure' },
+      OR: [{ user_id: subjectId }, ...byEmail('user_email'), ...(email ? [{ message: { contains: email, mode: 'insensitive' } }] : [])],
+    };
+
+    await tx.user.update({
+      where: { id: subjectId },
+      data: {
+        first_name: 'Former',
+        last_name: 'Tenant',
+        email: null,
+        phone_number: null,
+        password_hash: null,
+        status: 'inactive',
+        emergency_contact_name: null,
+        emergency_contact_phone: null,
+        emergency_contact_email: null,
+        emergency_relationship: null,
+        id_number: null,
+        nationality: null,
+        languages: null,
+        calendar_feed_token: null,
+        fcm_token: null,
+        updated_at: new Date(),
+      },
+    });
+    anonymized.users = 1;
+    anonymized.tenant_profiles = (await tx.tenantProfile.updateMany({
+      where: { user_id: subjectId },
+      data: {
+        id_number: null,
+        date_of_birth: null,
+        nationality: null,
+        emergency_contact_name: null,
+        emergency_contact_phone: null,
+        emergency_contact_relationship: null,
+        updated_at: new Date(),
+      },
+    })).count;
+    anonymized.tenant_preferences = (await tx.tenantPreferences.updateMany({ where: { user_id: subjectId }, data: { whatsapp_number: null } })).count;
+    await tx.tenantProfile.updateMany({ where: { user_id: subjectId }, data: { profile_picture: null } });
+    // Other people's replies hang off their messages, so what they wrote is redacted rather than deleted
+    anonymized.messages = (await tx.message.updateMany({
+      where: { sender_id: subjectId },
+      data: { subject: null, content: REDACTED, attachments: [], updated_at: new Date() },
+    })).count;
+
+    // Financial records stay for the books; only the details naming the payer go
+    anonymized.payments = (await tx.payment.updateMany({ where: { tenant_id: subjectId, received_from: { not: null } }, data: { received_from: 'Former tenant' } })).count;
+    const mpesa: Array<{ id: string; msisdn: string }> = await tx.mpesaTransaction.findMany({ where: { tenant_id: subjectId }, select: { id: true, msisdn: true } });
+    for (const transaction of mpesa) {
+      await tx.mpesaTransaction.update({ where: { id: transaction.id }, data: { msisdn: maskPhone(transaction.msisdn) } });
+    }
+    anonymized.mpesa_transactions = mpesa.length;
+
+    // Inspection reports stay with their files, as deleteStoredFiles leaves them
+    deleted.tenant_documents = (await tx.tenantDocument.deleteMany({ where: { tenant_id: subjectId, category: { not: 'inspection_report' } } })).count;
+    deleted.emergency_contacts = (await tx.userEmergencyContact.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.landlord_notes = (await tx.landlordTenantNotes.deleteMany({ where: { tenant_id: subjectId } })).count;
+    deleted.notifications = (await tx.notification.deleteMany({ where: { recipient_id: subjectId } })).count;
+    deleted.refresh_tokens = (await tx.refreshToken.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.user_sessions = (await tx.userSession.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.security_sessions = (await tx.securitySession.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.push_tokens = (await tx.pushNotificationToken.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.password_reset_tokens = (await tx.passwordResetToken.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.email_verification_tokens = (await tx.emailVerificationToken.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.two_factor_auth = (await tx.twoFactorAuth.deleteMany({ where: { user_id: subjectId } })).count;
+    deleted.security_activity = (await tx.securityActivityLog.deleteMany({ where: { user_id: subjectId } })).count;
+
+    if (erase) {
+      deleted.tenant_flags = (await tx.tenantFlag.deleteMany({ where: { tenant_id: subjectId } })).count;
+      deleted.sms_messages = (await tx.smsMessage.deleteMany({ where: { recipient_id: subjectId } })).count;
+      deleted.unit_applications = (await tx.unitApplication.deleteMany({ where: applications })).count;
+      deleted.waitlist_entries = (await tx.propertyWaitlistEntry.deleteMany({ where: waitlist })).count;
+      deleted.system_logs = (await tx.systemLog.deleteMany({ where: logs })).count;
+    } else {
+      anonymized.tenant_flags = (await tx.tenantFlag.updateMany({
+        where: { tenant_id: subjectId },
+        data: { tenant_name: 'Former tenant', tenant_email: null, tenant_phone: null, tenant_id_number: null },
+      })).count;
+      const sms: Array<{ id: string; phone: string }> = await tx.smsMessage.findMany({ where: { recipient_id: subjectId }, select: { id: true, phone: true } });
+      for (const message of sms) {
+        await tx.smsMessage.update({ where: { id: message.id }, data: { phone: maskPhone(message.phone), body: REDACTED } });
+      }
+      anonymized.sms_messages = sms.length;
+      const applicant = { first_name: 'Former', last_name: 'Tenant', email: REDACTED, phone_number: REDACTED, manage_token_hash: null, updated_at: new Date() };
+      anonymized.unit_applications = (await tx.unitApplication.updateMany({
+        where: applications,
+        data: { ...applicant, id_number: null, occupation: null, employer: null, monthly_income: null, message: null },
+      })).count;
+      anonymized.waitlist_entries = (await tx.propertyWaitlistEntry.updateMany({ where: waitlist, data: { ...applicant, notes: null } })).count;
+
+      anonymized.system_logs = (await tx.systemLog.updateMany({
+        where: logs,
+        data: { user_id: null, user_email: null, ip_address: null, metadata: {} },
+      })).count;
+      // Sign-in entries carry the email in the message too ("<email> signed in")
+      const written: Array<{ id: string; message: string }> = email
+        ? await tx.systemLog.findMany({ where: { event: { not: 'data_erasure' }, message: { contains: email, mode: 'insensitive' } }, select: { id: true, message: true } })
+        : [];
+      for (const log of written) {
+        await tx.systemLog.update({ where: { id: log.id }, data: { message: log.message.replace(new RegExp(escapeRegExp(email!), 'gi'), REDACTED) } });
+      }
+    }
+
+    const [leases, invoices, payments] = await Promise.all([
+      tx.lease.count({ where: { tenant_id: subjectId } }),
+      tx.invoice.count({ where: { issued_to: subjectId } }),
+      tx.payment.count({ where: { tenant_id: subjectId } }),
+    ]);
+    return { anonymized, deleted, retained: { leases, invoices, payments, mpesa_transactions: mpesa.length } };
+  }
+
+  private async findSubject(user: JWTClaims, subjectId: string) {
+    const subject = await this.prisma.user.findUnique({
+      where: { id: subjectId },
+      select: { id: true, role: true, company_id: true, first_name: true, last_name: true },
+    });
+    if (!subject || subject.role !== 'tenant' || (user.role !== 'super_admin' && subject.company_id !== user.company_id)) {
+      throw new Error('tenant not found');
+    }
+    return subject;
+  }
+
+  private async assertFormerTenant(subjectId: string) {
+    const open = await this.prisma.lease.count({ where: { tenant_id: subjectId, status: { in: OPEN_LEASE_STATUSES as any } } });
+    if (open > 0) {
+      throw new Error('Only former tenants can be erased; this tenant still has an active or draft lease');
+    }
+  }
+
+  private async notifySuperAdmins(companyId: string | null, message: string, requestId: string) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      const admins = await this.prisma.user.findMany({
+        where: { role: 'super_admin', status: 'active' },
+        select: { id: true, company_id: true },
+      });
+      for (const admin of admins) {
+        // Notifications belong to a company; a super admin without one sees it under the tenant's
+        const notificationCompany = admin.company_id || companyId;
+        if (!notificationCompany) continue;
+        const channels = await notificationsService.resolveChannels(admin.id, 'data_erasure', ['email'], 'general', 'high');
+        await notificationsService.notify({
+          company_id: notificationCompany,
+          recipient_id: admin.id,
+          title: 'Data erasure request awaiting review',
+          message,
+          notification_type: 'data_erasure',
+          category: 'general',
+          priority: 'high',
+          action_required: true,
+          action_url: '/super-admin/data-erasure',
+          related_entity_type: 'data_erasure_request',
+          related_entity_id: requestId,
+          metadata: { data_erasure_request_id: requestId },
+        }, channels);
+      }
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify super admins of erasure request:', error.message);
+    }
+  }
+}
+
+export const dataErasureService = new DataErasureService();
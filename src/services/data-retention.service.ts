@@ -0,0 +1,284 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+// Rows are changed in batches so a large backlog does not hold one long transaction
+const BATCH_SIZE = 1000;
+const MIN_RETENTION_DAYS = 1;
+const MAX_RETENTION_DAYS = 3650;
+
+interface RetentionTarget {
+  label: string;
+  action: 'delete' | 'anonymize';
+  default_days: number;
+  // Prisma delegate holding the rows and the column their age is measured by
+  model: string;
+  date_field: string;
+  // Rows past the cutoff this policy still has work to do on; anonymized rows drop out of it
+  where: (cutoff: Date) => Record<string, any>;
+  anonymize?: Record<string, any>;
+}
+
+const SIGN_IN_EVENTS = ['login', 'login_failed'];
+// Certificates of data erasure are the audit trail for the erasure itself and are never purged
+const KEPT_EVENTS = ['data_erasure'];
+
+/**
+ * What can be cleaned up and how. Retention days and on/off are configurable per key; the rules
+ * themselves are fixed here.
+ */
+export const RETENTION_TARGETS: Record<string, RetentionTarget> = {
+  security_sessions: {
+    label: 'Device sessions not active since the cutoff',
+    action: 'delete',
+    default_days: 30,
+    model: 'securitySession',
+    date_field: 'last_active',
+    where: cutoff => ({ last_active: { lt: cutoff } }),
+  },
+  user_sessions: {
+    label: 'Ended or expired user sessions',
+    action: 'delete',
+    default_days: 30,
+    model: 'userSession',
+    date_field: 'last_activity',
+    where: cutoff => ({ last_activity: { lt: cutoff }, OR: [{ is_active: false }, { expires_at: { lt: cutoff } }] }),
+  },
+  refresh_tokens: {
+    label: 'Refresh tokens expired before the cutoff',
+    action: 'delete',
+    default_days: 30,
+    model: 'refreshToken',
+    date_field: 'expires_at',
+    where: cutoff => ({ expires_at: { lt: cutoff } }),
+  },
+  sign_in_logs: {
+    label: 'Sign-in and failed sign-in log entries (kept anonymized for trend counts)',
+    action: 'anonymize',
+    default_days: 365,
+    model: 'systemLog',
+    date_field: 'created_at',
+    where: cutoff => ({
+      event: { in: SIGN_IN_EVENTS },
+      created_at: { lt: cutoff },
+      OR: [{ user_id: { not: null } }, { user_email: { not: null } }, { ip_address: { not: null } }],
+    }),
+    anonymize: { user_id: null, user_email: null, ip_address: null, company_id: null, metadata: {}, message: 'Sign-in (anonymized)' },
+  },
+  security_activity: {
+    label: 'Security activity device and location details',
+    action: 'anonymize',
+    default_days: 365,
+    model: 'securityActivityLog',
+    date_field: 'created_at',
+    where: cutoff => ({
+      created_at: { lt: cutoff },
+      OR: [{ ip_address: { not: null } }, { location: { not: null } }, { user_agent: { not: null } }, { device_name: { not: null } }],
+    }),
+    anonymize: { ip_address: null, location: null, user_agent: null, device_name: null, metadata: {} },
+  },
+  archived_notifications: {
+    label: 'Notifications archived before the cutoff',
+    action: 'delete',
+    default_days: 90,
+    model: 'notification',
+    date_field: 'updated_at',
+    where: cutoff => ({ status: 'archived', updated_at: { lt: cutoff } }),
+  },
+  deleted_notifications: {
+    label: 'Messages and notifications deleted for everyone, or by every participant, before the cutoff',
+    action: 'delete',
+    default_days: 90,
+    model: 'notification',
+    date_field: 'deleted_at',
+    where: cutoff => ({ deleted_at: { lt: cutoff } }),
+  },
+  notification_delivery_logs: {
+    label: 'Finished notification delivery attempts',
+    action: 'delete',
+    default_days: 180,
+    model: 'notificationDeliveryLog',
+    date_field: 'created_at',
+    where: cutoff => ({ status: { in: ['sent', 'skipped', 'dead_letter'] }, created_at: { lt: cutoff } }),
+  },
+  system_logs: {
+    label: 'Request error, slow request and admin action log entries',
+    action: 'delete',
+    default_days: 30,
+    model: 'systemLog',
+    date_field: 'created_at',
+    // Sign-in entries are anonymized by their own policy instead
+    where: cutoff => ({ event: { notIn: [...SIGN_IN_EVENTS, ...KEPT_EVENTS] }, created_at: { lt: cutoff } }),
+  },
+};
+
+export interface RetentionRunOptions {
+  dryRun?: boolean;
+  keys?: string[];
+  user?: JWTClaims | null;
+}
+
+/**
+ * Scheduled deletion and anonymization of old operational data. Every run, dry or not, is
+ * recorded with how many rows it touched (or would touch) and the oldest one.
+ */
+export class DataRetentionService {
+  private prisma = getPrisma();
+
+  async listPolicies() {
+    const rows = await this.prisma.retentionPolicy.findMany();
+    return Object.entries(RETENTION_TARGETS).map(([key, target]) => {
+      const row = rows.find(policy => policy.key === key);
+      return {
+        key,
+        label: target.label,
+        action: target.action,
+        retention_days: row?.retention_days ?? target.default_days,
+        default_days: target.default_days,
+        is_enabled: row?.is_enabled ?? true,
+        last_run_at: row?.last_run_at || null,
+        last_affected: row?.last_affected ?? null,
+        updated_at: row?.updated_at || null,
+      };
+    });
+  }
+
+  async updatePolicy(user: JWTClaims, key: string, input: { retention_days?: number; is_enabled?: boolean }) {
+    const target = RETENTION_TARGETS[key];
+    if (!target) {
+      throw new Error('retention policy not found');
+    }
+    const data: { retention_days?: number; is_enabled?: boolean } = {};
+    if (input.retention_days !== undefined) {
+      const days = Number(input.retention_days);
+      if (!Number.isInteger(days) || days < MIN_RETENTION_DAYS || days > MAX_RETENTION_DAYS) {
+        throw new Error(`retention_days must be a whole number from ${MIN_RETENTION_DAYS} to ${MAX_RETENTION_DAYS}`);
+      }
+      data.retention_days = days;
+    }
+    if (input.is_enabled !== undefined) {
+      if (typeof input.is_enabled !== 'boolean') {
+        throw new Error('is_enabled must be true or false');
+      }
+      data.is_enabled = input.is_enabled;
+    }
+    if (Object.keys(data).length === 0) {
+      throw new Error('retention_days or is_enabled is required');
+    }
+
+    await this.prisma.retentionPolicy.upsert({
+      where: { key },
+      create: { key, retention_days: target.default_days, ...data, updated_by: user.user_id },
+      update: { ...data, updated_by: user.user_id, updated_at: new Date() },
+    });
+    return (await this.listPolicies()).find(policy => policy.key === key)!;
+  }
+
+  /**
+   * Apply the policies (all of them, or the keys given). A dry run only counts what would be
+   * deleted or anonymized; a real run skips disabled policies.
+   */
+  async run(options: RetentionRunOptions = {}, now: Date = new Date()) {
+    const dryRun = options.dryRun ?? false;
+    const unknown = (options.keys || []).filter(key => !RETENTION_TARGETS[key]);
+    if (unknown.length) {
+      throw new Error(`unknown retention policies: ${unknown.join(', ')}`);
+    }
+    const policies = (await this.listPolicies()).filter(policy => !options.keys?.length || options.keys.includes(policy.key));
+
+    const results = [];
+    for (const policy of policies) {
+      const target = RETENTION_TARGETS[policy.key];
+      const cutoff = new Date(now.getTime() - policy.retention_days * DAY_MS);
+      if (!dryRun && !policy.is_enabled) {
+        results.push({ key: policy.key, action: target.action, retention_days: policy.retention_days, cutoff, skipped: true, affected: 0, oldest_at: null, error: null });
+        continue;
+      }
+
+      const run = await this.prisma.retentionRun.create({
+        data: {
+          policy_key: policy.key,
+          action: target.action,
+          dry_run: dryRun,
+          retention_days: policy.retention_days,
+          cutoff,
+          triggered_by: options.user?.user_id || null,
+        },
+      });
+      let affected = 0;
+      let oldestAt: Date | null = null;
+      let error: string | null = null;
+      try {
+        oldestAt = await this.oldest(target, cutoff);
+        affected = dryRun ? await this.delegate(target).count({ where: target.where(cutoff) }) : await this.apply(target, cutoff);
+      } catch (err: any) {
+        error = err.message;
+        console.error(`❌ Retention policy ${policy.key} failed:`, err.message);
+      }
+
+      await this.prisma.retentionRun.update({
+        where: { id: run.id },
+        data: { affected, oldest_at: oldestAt, error, finished_at: new Date() },
+      });
+      if (!dryRun) {
+        await this.prisma.retentionPolicy.upsert({
+          where: { key: policy.key },
+          create: { key: policy.key, retention_days: policy.retention_days, last_run_at: now, last_affected: affected },
+          update: { last_run_at: now, last_affected: affected },
+        });
+      }
+      results.push({ key: policy.key, action: target.action, retention_days: policy.retention_days, cutoff, skipped: false, affected, oldest_at: oldestAt, error });
+    }
+
+    return {
+      dry_run: dryRun,
+      run_at: now,
+      total_affected: results.reduce((sum, result) => sum + result.affected, 0),
+      policies: results,
+    };
+  }
+
+  async listRuns(filters: { policy_key?: string; dry_run?: string; page?: number; limit?: number } = {}) {
+    const where: any = {};
+    if (filters.policy_key) where.policy_key = filters.policy_key;
+    if (filters.dry_run === 'true' || filters.dry_run === 'false') where.dry_run = filters.dry_run === 'true';
+    const page = Math.max(filters.page || 1, 1);
+    const limit = Math.min(Math.max(filters.limit || 50, 1), 200);
+    const [runs, total] = await Promise.all([
+      this.prisma.retentionRun.findMany({ where, orderBy: { started_at: 'desc' }, take: limit, skip: (page - 1) * limit }),
+      this.prisma.retentionRun.count({ where }),
+    ]);
+    return { runs, total, page, limit, pages: Math.ceil(total / limit) };
+  }
+
+  private async apply(target: RetentionTarget, cutoff: Date) {
+    const delegate = this.delegate(target);
+    let affected = 0;
+    for (;;) {
+      const batch: Array<{ id: string }> = await delegate.findMany({ where: target.where(cutoff), select: { id: true }, take: BATCH_SIZE });
+      if (batch.length === 0) break;
+      const ids = { id: { in: batch.map(row => row.id) } };
+      const { count } = target.action === 'delete'
+        ? await delegate.deleteMany({ where: ids })
+        : await delegate.updateMany({ where: ids, data: target.anonymize });
+      affected += count;
+      if (batch.length < BATCH_SIZE) break;
+    }
+    return affected;
+  }
+
+  private async oldest(target: RetentionTarget, cutoff: Date): Promise<Date | null> {
+    const row = await this.delegate(target).findFirst({
+      where: target.where(cutoff),
+      orderBy: { [target.date_field]: 'asc' },
+      select: { [target.date_field]: true },
+    });
+    return row ? row[target.date_field] : null;
+  }
+
+  private delegate(target: RetentionTarget) {
+    return (this.prisma as any)[target.model];
+  }
+}
+
+export const dataRetentionService = new DataRetentionService();
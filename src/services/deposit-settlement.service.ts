@@ -0,0 +1,516 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { generatePropertyCode, getNextInvoiceNumber, getNextReceiptNumber } from '../utils/invoice-number-generator.js';
+
+export interface SettlementDeduction {
+  description: string;
+  amount: number;
+}
+
+export interface CalculateSettlementRequest {
+  move_out_date?: string;
+  other_deductions?: SettlementDeduction[];
+  notes?: string;
+}
+
+export interface RecordRefundRequest {
+  payment_method: string;
+  reference_number?: string;
+  notes?: string;
+}
+
+interface SettlementLineItem {
+  type: 'outstanding_invoice' | 'prorated_rent' | 'inspection_deduction' | 'other_deduction';
+  description: string;
+  amount: number;
+  invoice_id?: string;
+  inspection_item_id?: string;
+}
+
+const RENT_INVOICE_TYPES = ['rent', 'monthly_rent'];
+const round = (n: number) => Math.round(n * 100) / 100;
+
+/**
+ * Deposit settlement at the end of a tenancy.
+ *
+ * final balance = outstanding invoices + prorated rent adjustment + inspection deductions + other deductions
+ * refund        = deposit held - final balance (when positive), otherwise the tenant owes the difference
+ */
+export class DepositSettlementService {
+  private prisma = getPrisma();
+
+  private async getAccessibleLease(leaseId: string, user: JWTClaims) {
+    const lease = await this.prisma.lease.findUnique({
+      where: { id: leaseId },
+      include: {
+        tenant: { select: { id: true, first_name: true, last_name: true, email: true } },
+        unit: { select: { id: true, unit_number: true } },
+        property: { select: { id: true, name: true } },
+      },
+    });
+
+    if (!lease) {
+      throw new Error('lease not found');
+    }
+
+    if (user.role === 'tenant') {
+      if (lease.tenant_id !== user.user_id) {
+        throw new Error('insufficient permissions to view this settlement');
+      }
+    } else if (user.role !== 'super_admin' && lease.company_id !== user.company_id) {
+      throw new Error('insufficient permissions to access this lease');
+    }
+
+    return lease;
+  }
+
+  private assertCanManage(user: JWTClaims) {
+    if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
+      throw new Error('insufficient permissions to manage deposit settlements');
+    }
+  }
+
+  async getSettlement(leaseId: string, user: JWTClaims): Promise<any> {
+    await this.getAccessibleLease(leaseId, user);
+
+    const settlement = await this.prisma.depositSettlement.findUnique({ where: { lease_id: leaseId } });
+    if (!settlement) {
+      throw new Error('settlement not found');
+    }
+    return settlement;
+  }
+
+  /**
+   * Compute (or recompute) the draft settlement for a lease. Invoices captured by an earlier
+   * calculation stay on the statement even if tenant termination has since cancelled them,
+   * unless they have been paid.
+   */
+  async calculateSettlement(leaseId: string, req: CalculateSettlementRequest, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const lease = await this.getAccessibleLease(leaseId, user);
+
+    if (lease.status === 'active' && !req.move_out_date && !lease.move_out_date) {
+      throw new Error('move_out_date is required to settle an active lease');
+    }
+
+    const existing = await this.prisma.depositSettlement.findUnique({ where: { lease_id: leaseId } });
+    if (existing && existing.status !== 'draft') {
+      throw new Error('settlement has already been approved');
+    }
+
+    const moveOutDate = new Date(req.move_out_date || lease.move_out_date || lease.end_date);
+    const lineItems: SettlementLineItem[] = [];
+
+    // 1. Deposit actually held: completed deposit payments, falling back to paid deposit invoices
+    const depositPayments = await this.prisma.payment.aggregate({
+      where: {
+        tenant_id: lease.tenant_id,
+        payment_type: 'security_deposit',
+        status: { in: ['completed', 'approved'] },
+        OR: [{ lease_id: lease.id }, { lease_id: null, unit_id: lease.unit_id }],
+      },
+      _sum: { amount: true },
+    });
+    let depositHeld = Number(depositPayments._sum.amount || 0);
+    if (depositHeld === 0) {
+      const paidDepositInvoices = await this.prisma.invoice.aggregate({
+        where: { issued_to: lease.tenant_id, unit_id: lease.unit_id, invoice_type: 'deposit', status: 'paid' },
+        _sum: { total_amount: true },
+      });
+      depositHeld = Number(paidDepositInvoices._sum.total_amount || 0);
+    }
+
+    // 2. Outstanding invoices (net of partial payments); unpaid deposit invoices are not arrears
+    const previouslyCaptured = ((existing?.line_items as any[]) || [])
+      .filter((item) => item.type === 'outstanding_invoice' && item.invoice_id)
+      .map((item) => item.invoice_id as string);
+
+    const openInvoices = await this.prisma.invoice.findMany({
+      where: {
+        issued_to: lease.tenant_id,
+        invoice_type: { not: 'deposit' },
+        OR: [
+          { unit_id: lease.unit_id, status: { in: ['draft', 'sent', 'overdue'] } },
+          { id: { in: previouslyCaptured }, status: { not: 'paid' } },
+        ],
+      },
+      orderBy: { due_date: 'asc' },
+    });
+
+    const paidAgainst = openInvoices.length > 0
+      ? await this.prisma.payment.groupBy({
+          by: ['invoice_id'],
+          where: { invoice_id: { in: openInvoices.map((i) => i.id) }, status: { in: ['completed', 'approved'] } },
+          _sum: { amount: true },
+        })
+      : [];
+    const paidByInvoice = new Map(paidAgainst.map((p) => [p.invoice_id, Number(p._sum.amount || 0)]));
+
+    for (const invoice of openInvoices) {
+      const balance = round(Number(invoice.total_amount) - (paidByInvoice.get(invoice.id) || 0));
+      if (balance <= 0) continue;
+      lineItems.push({
+        type: 'outstanding_invoice',
+        description: `${invoice.invoice_number} - ${invoice.title}`,
+        amount: balance,
+        invoice_id: invoice.id,
+      });
+    }
+
+    // 3. Prorated rent for the move-out month: charge the occupied days, crediting any rent
+    //    already invoiced for that month
+    const rentAmount = Number(lease.rent_amount || 0);
+    if (lease.lease_type !== 'short_stay' && rentAmount > 0) {
+      const monthStart = new Date(moveOutDate.getFullYear(), moveOutDate.getMonth(), 1);
+      const nextMonthStart = new Date(moveOutDate.getFullYear(), moveOutDate.getMonth() + 1, 1);
+      const daysInMonth = new Date(moveOutDate.getFullYear(), moveOutDate.getMonth() + 1, 0).getDate();
+      const occupiedDays = Math.min(moveOutDate.getDate(), daysInMonth);
+      const proratedRent = round(rentAmount * (occupiedDays / daysInMonth));
+
+      const invoicedForMonth = await this.prisma.invoice.aggregate({
+        where: {
+          issued_to: lease.tenant_id,
+          unit_id: lease.unit_id,
+          invoice_type: { in: RENT_INVOICE_TYPES },
+          status: { in: ['draft', 'sent', 'overdue', 'paid'] },
+          due_date: { gte: monthStart, lt: nextMonthStart },
+        },
+        _sum: { total_amount: true },
+      });
+      const adjustment = round(proratedRent - Number(invoicedForMonth._sum.total_amount || 0));
+
+      if (adjustment !== 0) {
+        lineItems.push({
+          type: 'prorated_rent',
+          description: adjustment > 0
+            ? `Prorated rent: ${occupiedDays}/${daysInMonth} days`
+            : `Credit for unused rent: ${daysInMonth - occupiedDays}/${daysInMonth} days`,
+          amount: adjustment,
+        });
+      }
+    }
+
+    // 4. Damage deductions from the latest completed move-out inspection
+    const inspection = await this.prisma.inspection.findFirst({
+      where: {
+        unit_id: lease.unit_id,
+        inspection_type: 'move_out',
+        status: 'completed',
+        OR: [{ tenant_id: lease.tenant_id }, { tenant_id: null }],
+        completed_at: { gte: lease.start_date },
+      },
+      include: {
+        items: {
+          where: { has_issue: true, deduction_amount: { gt: 0 } },
+          include: { checklist_item: { select: { name: true } } },
+        },
+      },
+      orderBy: { completed_at: 'desc' },
+    });
+
+    for (const item of inspection?.items || []) {
+      lineItems.push({
+        type: 'inspection_deduction',
+        description: `${item.checklist_item.name}${item.notes ? ` - ${item.notes}` : ''}`,
+        amount: round(Number(item.deduction_amount)),
+        inspection_item_id: item.id,
+      });
+    }
+
+    // 5. Manual deductions (cleaning, keys, etc.)
+    for (const deduction of req.other_deductions || []) {
+      if (!deduction.description || !(Number(deduction.amount) > 0)) {
+        throw new Error('each deduction requires a description and a positive amount');
+      }
+      lineItems.push({ type: 'other_deduction', description: deduction.description, amount: round(Number(deduction.amount)) });
+    }
+    // Keep earlier manual deductions when recalculating without new ones
+    if (!req.other_deductions && existing) {
+      lineItems.push(...((existing.line_items as any[]) || []).filter((item) => item.type === 'other_deduction'));
+    }
+
+    const sumOf = (type: SettlementLineItem['type']) =>
+      round(lineItems.filter((i) => i.type === type).reduce((sum, i) => sum + i.amount, 0));
+
+    const outstandingTotal = sumOf('outstanding_invoice');
+    const proratedAdjustment = sumOf('prorated_rent');
+    const inspectionTotal = sumOf('inspection_deduction');
+    const otherTotal = sumOf('other_deduction');
+    const finalBalance = round(outstandingTotal + proratedAdjustment + inspectionTotal + otherTotal);
+    const net = round(depositHeld - finalBalance);
+
+    const data = {
+      company_id: lease.company_id,
+      tenant_id: lease.tenant_id,
+      unit_id: lease.unit_id,
+      property_id: lease.property_id,
+      inspection_id: inspection?.id || null,
+      move_out_date: moveOutDate,
+      currency: lease.currency,
+      deposit_held: depositHeld,
+      outstanding_invoices_total: outstandingTotal,
+      prorated_rent_adjustment: proratedAdjustment,
+      inspection_deductions_total: inspectionTotal,
+      other_deductions_total: otherTotal,
+      refund_amount: net > 0 ? net : 0,
+      balance_due: net < 0 ? -net : 0,
+      line_items: lineItems as any,
+      notes: req.notes ?? existing?.notes ?? null,
+      calculated_at: new Date(),
+      updated_at: new Date(),
+    };
+
+    return this.prisma.depositSettlement.upsert({
+      where: { lease_id: leaseId },
+      create: { lease_id: leaseId, ...data },
+      update: data,
+    });
+  }
+
+  /**
+   * Best-effort recalculation used by move-out hooks (lease/tenant termination, move-out inspection)
+   */
+  async autoCalculate(leaseId: string, user: JWTClaims): Promise<void> {
+    try {
+      const existing = await this.prisma.depositSettlement.findUnique({ where: { lease_id: leaseId } });
+      if (existing && existing.status !== 'draft') return;
+
+      await this.calculateSettlement(leaseId, {}, user);
+      console.log(`✅ Calculated deposit settlement for lease ${leaseId}`);
+    } catch (error: any) {
+      console.error(`⚠️ Failed to calculate deposit settlement for lease ${leaseId}:`, error.message);
+    }
+  }
+
+  /**
+   * Approve the draft settlement and start the payout/collection workflow:
+   * - deposit covers everything: captured invoices are closed as offset against the deposit and the refund is pending
+   * - tenant owes a balance: captured invoices are rolled into one final settlement invoice
+   */
+  async approveSettlement(leaseId: string, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const lease = await this.getAccessibleLease(leaseId, user);
+
+    const settlement = await this.prisma.depositSettlement.findUnique({ where: { lease_id: leaseId } });
+    if (!settlement) {
+      throw new Error('settlement not found');
+    }
+    if (settlement.status !== 'draft') {
+      throw new Error('settlement has already been approved');
+    }
+
+    const captured = ((settlement.line_items as any[]) || [])
+      .filter((item) => item.type === 'outstanding_invoice' && item.invoice_id) as SettlementLineItem[];
+    const capturedInvoiceIds = captured.map((item) => item.invoice_id as string);
+    const balanceDue = Number(settlement.balance_due);
+    const refundAmount = Number(settlement.refund_amount);
+
+    // Same property-coded numbering as invoices raised through InvoicesService
+    const property = await this.prisma.property.findUnique({ where: { id: lease.property_id }, select: { name: true } });
+    const propertyCode = property ? generatePropertyCode(property.name) : undefined;
+
+    const now = new Date();
+    await this.prisma.$transaction(async (tx) => {
+      // Claim the draft first so two approvals cannot both raise an invoice or offset the deposit
+      const claimed = await tx.depositSettlement.updateMany({
+        where: { id: settlement.id, status: 'draft' },
+        data: {
+          status: refundAmount > 0 ? 'refund_pending' : balanceDue > 0 ? 'awaiting_payment' : 'completed',
+          approved_by: user.user_id,
+          approved_at: now,
+          ...(refundAmount === 0 && balanceDue === 0 && { completed_at: now }),
+          updated_at: now,
+        },
+      });
+      if (claimed.count === 0) {
+        throw new Error('settlement has already been approved');
+      }
+
+      if (balanceDue > 0) {
+        // The captured invoices are rolled into the final settlement invoice
+        if (capturedInvoiceIds.length > 0) {
+          await tx.invoice.updateMany({
+            where: { id: { in: capturedInvoiceIds }, status: { not: 'paid' } },
+            data: { status: 'cancelled', updated_at: now },
+          });
+        }
+        const invoice = await tx.invoice.create({
+          data: {
+            company_id: settlement.company_id,
+            invoice_number: await getNextInvoiceNumber(tx, settlement.company_id, propertyCode),
+            title: 'Final Tenancy Settlement',
+            description: `Balance due after applying the security deposit for ${lease.property.name} - Unit ${lease.unit.unit_number}`,
+            invoice_type: 'final_settlement',
+            issued_by: user.user_id,
+            issued_to: lease.tenant_id,
+            property_id: lease.property_id,
+            unit_id: lease.unit_id,
+            subtotal: balanceDue,
+            tax_amount: 0,
+            discount_amount: 0,
+            total_amount: balanceDue,
+            currency: settlement.currency,
+            due_date: new Date(now.getTime() + 14 * 24 * 60 * 60 * 1000),
+            status: 'sent',
+            metadata: { created_via: 'deposit_settlement', lease_id: lease.id, settlement_id: settlement.id },
+          },
+        });
+        await tx.depositSettlement.update({ where: { id: settlement.id }, data: { settlement_invoice_id: invoice.id } });
+      } else {
+        // The deposit covers the captured invoices: each is settled by a deposit-offset payment so
+        // the ledger and arrears reports see what paid it
+        const open = await tx.invoice.findMany({
+          where: { id: { in: capturedInvoiceIds }, status: { not: 'paid' } },
+          select: { id: true, invoice_number: true, invoice_type: true },
+        });
+        for (const invoice of open) {
+          const item = captured.find((line) => line.invoice_id === invoice.id)!;
+          await tx.payment.create({
+            data: {
+              company_id: settlement.company_id,
+              tenant_id: settlement.tenant_id,
+              unit_id: settlement.unit_id,
+              property_id: settlement.property_id,
+              lease_id: settlement.lease_id,
+              invoice_id: invoice.id,
+              amount: item.amount,
+              currency: settlement.currency,
+              payment_method: 'deposit_offset',
+              payment_type: RENT_INVOICE_TYPES.includes(invoice.invoice_type) ? 'rent' : 'other',
+              status: 'completed',
+              payment_date: now,
+              receipt_number: await getNextReceiptNumber(tx, settlement.company_id),
+              received_from: `${lease.tenant.first_name} ${lease.tenant.last_name}`.trim(),
+              processed_by: user.user_id,
+              processed_at: now,
+              notes: `Offset against the security deposit for lease ${lease.lease_number} (${invoice.invoice_number})`,
+              created_by: user.user_id,
+            },
+          });
+          await tx.invoice.update({
+            where: { id: invoice.id },
+            data: { status: 'paid', paid_date: now, payment_method: 'deposit_offset', updated_at: now },
+          });
+        }
+      }
+    });
+
+    await this.notifyTenant(lease, settlement, user);
+
+    return this.prisma.depositSettlement.findUnique({ where: { id: settlement.id } });
+  }
+
+  /**
+   * Record that the deposit refund has been paid out to the tenant
+   */
+  async recordRefund(leaseId: string, req: RecordRefundRequest, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const lease = await this.getAccessibleLease(leaseId, user);
+
+    const settlement = await this.prisma.depositSettlement.findUnique({ where: { lease_id: leaseId } });
+    if (!settlement) {
+      throw new Error('settlement not found');
+    }
+    if (settlement.status !== 'refund_pending') {
+      throw new Error('settlement has no pending refund');
+    }
+    if (!req.payment_method) {
+      throw new Error('payment_method is required');
+    }
+
+    const receiptNumber = await getNextReceiptNumber(this.prisma, settlement.company_id);
+
+    // Refunds are recorded as refunded deposit payments so the refund receipt PDF applies
+    const refund = await this.prisma.payment.create({
+      data: {
+        company_id: settlement.company_id,
+        tenant_id: settlement.tenant_id,
+        unit_id: settlement.unit_id,
+        property_id: settlement.property_id,
+        lease_id: settlement.lease_id,
+        amount: settlement.refund_amount,
+        currency: settlement.currency,
+        payment_method: req.payment_method as any,
+        payment_type: 'security_deposit',
+        status: 'refunded',
+        payment_date: new Date(),
+        receipt_number: receiptNumber,
+        reference_number: req.reference_number || null,
+        received_from: `${lease.tenant.first_name} ${lease.tenant.last_name}`.trim(),
+        processed_by: user.user_id,
+        processed_at: new Date(),
+        notes: req.notes || `Security deposit refund for lease ${lease.lease_number}`,
+        created_by: user.user_id,
+      },
+    });
+
+    return this.prisma.depositSettlement.update({
+      where: { id: settlement.id },
+      data: {
+        status: 'completed',
+        refund_payment_id: refund.id,
+        completed_at: new Date(),
+        updated_at: new Date(),
+      },
+    });
+  }
+
+  /**
+   * Itemised settlement statement as PDF
+   */
+  async getStatementPdf(leaseId: string, user: JWTClaims) {
+    const lease = await this.getAccessibleLease(leaseId, user);
+    const settlement = await this.getSettlement(leaseId, user);
+    const { documentService } = await import('../modules/documents/document-service.js');
+
+    const rows = ((settlement.line_items as any[]) || []).map((item) => ({
+      item: item.type.replaceAll('_', ' '),
+      description: item.description,
+      amount: `${settlement.currency} ${Number(item.amount).toLocaleString()}`,
+    }));
+
+    return documentService.getReportPdf(
+      'deposit_settlement',
+      `Deposit Settlement — ${lease.tenant.first_name} ${lease.tenant.last_name}, ${lease.property.name} Unit ${lease.unit.unit_number}`,
+      rows,
+      {
+        lease_number: lease.lease_number,
+        move_out_date: settlement.move_out_date.toISOString().split('T')[0],
+        deposit_held: Number(settlement.deposit_held),
+        outstanding_invoices: Number(settlement.outstanding_invoices_total),
+        prorated_rent_adjustment: Number(settlement.prorated_rent_adjustment),
+        inspection_deductions: Number(settlement.inspection_deductions_total),
+        other_deductions: Number(settlement.other_deductions_total),
+        refund_amount: Number(settlement.refund_amount),
+        balance_due: Number(settlement.balance_due),
+        status: settlement.status,
+      },
+      user
+    );
+  }
+
+  private async notifyTenant(lease: any, settlement: any, user: JWTClaims): Promise<void> {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      const refund = Number(settlement.refund_amount);
+      const due = Number(settlement.balance_due);
+      await notificationsService.createNotification(user, {
+        recipient_id: lease.tenant_id,
+        title: 'Your deposit settlement is ready',
+        message: refund > 0
+          ? `Your final statement for ${lease.property.name} is ready. A deposit refund of ${settlement.currency} ${refund.toLocaleString()} will be processed.`
+          : due > 0
+            ? `Your final statement for ${lease.property.name} is ready. A balance of ${settlement.currency} ${due.toLocaleString()} is due.`
+            : `Your final statement for ${lease.property.name} is ready. Your account is fully settled.`,
+        notification_type: 'payment',
+        category: 'payment',
+        priority: 'high',
+        property_id: lease.property_id,
+        unit_id: lease.unit_id,
+        metadata: { lease_id: lease.id, settlement_id: settlement.id },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify tenant about deposit settlement:', error.message);
+    }
+  }
+}
@@ -0,0 +1,423 @@
+import crypto from 'crypto';
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import type { EmailSection } from './email-templates.service.js';
+
+export const DIGEST_FREQUENCIES = ['off', 'daily', 'weekly'];
+
+// Roles that get a digest; staff see their portfolio, tenants their own tenancy
+const DIGEST_ROLES = ['agency_admin', 'landlord', 'agent', 'caretaker', 'tenant'];
+// Agents and caretakers see only the properties they are assigned to
+const ASSIGNED_ROLES = ['agent', 'caretaker'];
+// Each section lists at most this many items; the counts cover everything
+const SECTION_LIMIT = 5;
+// Recipients processed concurrently by the scheduled run
+const SEND_CONCURRENCY = 20;
+
+const HOUR = 60 * 60 * 1000;
+const DAY = 24 * HOUR;
+
+// Period covered by each frequency, and how far ahead upcoming inspections are listed
+const PERIODS: Record<string, { lookback: number; lookahead: number; label: string }> = {
+  daily: { lookback: DAY, lookahead: 2 * DAY, label: 'Daily' },
+  weekly: { lookback: 7 * DAY, lookahead: 7 * DAY, label: 'Weekly' },
+};
+
+// Weekly digests go out on Mondays
+const WEEKLY_DAY = 1;
+
+const formatDate = (date: Date) =>
+  date.toLocaleDateString('en-KE', { weekday: 'short', day: 'numeric', month: 'short' });
+
+const formatAmount = (amount: number, currency = 'KES') =>
+  `${currency} ${amount.toLocaleString('en-KE', { minimumFractionDigits: 2, maximumFractionDigits: 2 })}`;
+
+interface DigestRecipient {
+  id: string;
+  email: string;
+  first_name: string;
+  role: string;
+  company_id: string | null;
+  agency_id: string | null;
+}
+
+export interface DigestSummary {
+  frequency: string;
+  period_start: Date;
+  period_end: Date;
+  unread_messages: { total: number; conversations: Array<{ subject: string; unread: number }> };
+  maintenance_requests: { total: number; items: Array<{ title: string; property: string; unit: string | null; priority: string; status: string }> };
+  payments_received: { total: number; amounts: Array<{ currency: string; amount: number }>; items: Array<{ receipt_number: string; tenant: string; amount: number; currency: string; payment_date: Date }> };
+  upcoming_inspections: { total: number; items: Array<{ type: string; property: string; unit: string; scheduled_date: Date }> };
+}
+
+/**
+ * Daily and weekly email digests: unread messages, new maintenance requests, payments received and
+ * upcoming inspections, scoped the way each role sees them elsewhere. Every email carries a
+ * one-click unsubscribe link tied to a per-user token.
+ */
+export class DigestService {
+  private prisma = getPrisma();
+
+  async getSettings(user: JWTClaims) {
+    const preferences = await this.prisma.userPreferences.findUnique({
+      where: { user_id: user.user_id },
+      select: { email_digest_frequency: true, email_digest_sent_at: true },
+    });
+    return {
+      frequency: preferences?.email_digest_frequency || 'off',
+      last_sent_at: preferences?.email_digest_sent_at || null,
+      frequencies: DIGEST_FREQUENCIES,
+      available: DIGEST_ROLES.includes(user.role),
+    };
+  }
+
+  async updateSettings(user: JWTClaims, frequency: string) {
+    if (!DIGEST_FREQUENCIES.includes(frequency)) {
+      throw new Error(`frequency must be one of: ${DIGEST_FREQUENCIES.join(', ')}`);
+    }
+    if (frequency !== 'off' && !DIGEST_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions: email digests are not available for your role');
+    }
+    await this.setFrequency(user.user_id, frequency);
+    return this.getSettings(user);
+  }
+
+  /**
+   * Store the frequency, keeping the tenant notification settings' copy in step
+   */
+  async setFrequency(userId: string, frequency: string) {
+    await this.prisma.userPreferences.upsert({
+      where: { user_id: userId },
+      update: { email_digest_frequency: frequency, updated_at: new Date() },
+      create: { user_id: userId, email_digest_frequency: frequency },
+    });
+    await this.prisma.tenantNotificationSettings.updateMany({
+      where: { user_id: userId },
+      data: { email_digest_frequency: frequency === 'off' ? 'instant' : frequency, updated_at: new Date() },
+    });
+  }
+
+  /**
+   * What the user's next digest would contain, for the settings screen
+   */
+  async preview(user: JWTClaims, frequency?: string) {
+    const chosen = frequency || (await this.getSettings(user)).frequency;
+    if (!PERIODS[chosen]) {
+      throw new Error('frequency must be daily or weekly');
+    }
+    const recipient = await this.findRecipient(user.user_id);
+    if (!recipient || !DIGEST_ROLES.includes(recipient.role)) {
+      throw new Error('insufficient permissions: email digests are not available for your role');
+    }
+    return this.buildSummary(recipient, chosen, new Date(Date.now() - PERIODS[chosen].lookback));
+  }
+
+  /**
+   * Scheduled run: send every daily digest that is due, and weekly ones on Mondays
+   */
+  async sendDue(now = new Date()) {
+    const frequencies = ['daily', ...(now.getDay() === WEEKLY_DAY ? ['weekly'] : [])];
+    const due = await this.prisma.userPreferences.findMany({
+      where: {
+        email_digest_frequency: { in: frequencies },
+        // A little under a period, so a run that starts a few minutes late does not skip a day
+        OR: [
+          { email_digest_sent_at: null },
+          { email_digest_frequency: 'daily', email_digest_sent_at: { lt: new Date(now.getTime() - DAY + 2 * HOUR) } },
+          { email_digest_frequency: 'weekly', email_digest_sent_at: { lt: new Date(now.getTime() - 7 * DAY + 2 * HOUR) } },
+        ],
+        user: { status: 'active', role: { in: DIGEST_ROLES as any } },
+      },
+      select: {
+        email_digest_frequency: true,
+        email_digest_sent_at: true,
+        user: { select: { id: true, email: true, first_name: true, role: true, company_id: true, agency_id: true } },
+      },
+    });
+
+    let sent = 0;
+    let skipped = 0;
+    for (let i = 0; i < due.length; i += SEND_CONCURRENCY) {
+      const batch = due.slice(i, i + SEND_CONCURRENCY);
+      const results = await Promise.allSettled(batch.map(row => {
+        const period = PERIODS[row.email_digest_frequency];
+        const lookbackStart = new Date(now.getTime() - period.lookback);
+        // Pick up where the last digest stopped if it was sent within the period
+        const since = row.email_digest_sent_at && row.email_digest_sent_at > lookbackStart ? row.email_digest_sent_at : lookbackStart;
+        return this.sendDigest(row.user as DigestRecipient, row.email_digest_frequency, since, now);
+      }));
+      results.forEach((result, index) => {
+        if (result.status === 'fulfilled' && result.value) {
+          sent++;
+        } else {
+          skipped++;
+          if (result.status === 'rejected') {
+            console.error(`❌ Failed to send digest to ${batch[index].user.id}:`, result.reason);
+          }
+        }
+      });
+    }
+    return { sent, skipped };
+  }
+
+  /**
+   * Whether an unsubscribe token belongs to someone, without changing anything; for the
+   * confirmation page
+   */
+  async checkUnsubscribeToken(token: string) {
+    const preferences = await this.prisma.userPreferences.findUnique({
+      where: { email_digest_token: token },
+      select: { email_digest_frequency: true },
+    });
+    if (!preferences) {
+      throw new Error('unsubscribe link not found');
+    }
+    return { subscribed: preferences.email_digest_frequency !== 'off' };
+  }
+
+  /**
+   * Turn digests off for the owner of an unsubscribe token
+   */
+  async unsubscribe(token: string) {
+    const preferences = await this.prisma.userPreferences.findUnique({
+      where: { email_digest_token: token },
+      select: { user_id: true, email_digest_frequency: true },
+    });
+    if (!preferences) {
+      throw new Error('unsubscribe link not found');
+    }
+    if (preferences.email_digest_frequency !== 'off') {
+      await this.setFrequency(preferences.user_id, 'off');
+    }
+    return { unsubscribed: true };
+  }
+
+  private async sendDigest(recipient: DigestRecipient, frequency: string, since: Date, now: Date) {
+    if (!recipient.email) return false;
+    const summary = await this.buildSummary(recipient, frequency, since, now);
+    const empty = !summary.unread_messages.total && !summary.maintenance_requests.total
+      && !summary.payments_received.total && !summary.upcoming_inspections.total;
+    if (empty) {
+      // Nothing to report; still move the window so the next digest does not repeat this period
+      await this.markSent(recipient.id, now);
+      return false;
+    }
+
+    const unsubscribeUrl = `${env.apiUrl}/api/v1/digest/unsubscribe/${await this.unsubscribeToken(recipient.id)}`;
+    const { emailTemplatesService } = await import('./email-templates.service.js');
+    const result = await emailTemplatesService.send('email_digest', {
+      to: recipient.email,
+      recipientId: recipient.id,
+      companyId: recipient.company_id,
+      agencyId: recipient.agency_id,
+      variables: {
+        recipient_name: recipient.first_name,
+        period: PERIODS[frequency].label.toLowerCase(),
+        since: summary.period_start,
+        sections: this.sections(recipient, summary),
+        app_url: env.appUrl,
+        unsubscribe_url: unsubscribeUrl,
+      },
+      headers: {
+        'List-Unsubscribe': `<${unsubscribeUrl}>`,
+        'List-Unsubscribe-Post': 'List-Unsubscribe=One-Click',
+      },
+    });
+    if (!result.success) {
+      throw new Error(result.error || 'email provider rejected the digest');
+    }
+    await this.markSent(recipient.id, now);
+    return true;
+  }
+
+  private async markSent(userId: string, at: Date) {
+    await this.prisma.userPreferences.update({ where: { user_id: userId }, data: { email_digest_sent_at: at } });
+  }
+
+  /**
+   * The user's unsubscribe token, created on first use and reused afterwards
+   */
+  private async unsubscribeToken(userId: string) {
+    const preferences = await this.prisma.userPreferences.findUnique({
+      where: { user_id: userId },
+      select: { email_digest_token: true },
+    });
+    if (preferences?.email_digest_token) return preferences.email_digest_token;
+    const token = crypto.randomBytes(24).toString('hex');
+    await this.prisma.userPreferences.update({ where: { user_id: userId }, data: { email_digest_token: token } });
+    return token;
+  }
+
+  private async buildSummary(recipient: DigestRecipient, frequency: string, since: Date, now = new Date()): Promise<DigestSummary> {
+    const { messagingService } = await import('./messaging.service.js');
+    const horizon = new Date(now.getTime() + PERIODS[frequency].lookahead);
+    const isTenant = recipient.role === 'tenant';
+    const propertyWhere = isTenant ? null : await this.propertyScope(recipient);
+
+    const maintenanceWhere: any = isTenant
+      // Tenants hear about their own requests that moved during the period
+      ? { requested_by: recipient.id, updated_at: { gte: since } }
+      : {
+        created_at: { gte: since },
+        OR: [
+          { property: propertyWhere },
+          ...(recipient.role === 'caretaker' ? [{ assigned_to: recipient.id }] : []),
+        ],
+      };
+    const paymentWhere: any = {
+      status: { in: ['approved', 'completed'] },
+      payment_date: { gte: since, lte: now },
+      ...(isTenant ? { tenant_id: recipient.id } : { property: propertyWhere }),
+    };
+    const inspectionWhere: any = {
+      status: 'scheduled',
+      scheduled_date: { gte: now, lte: horizon },
+      ...(isTenant
+        ? { tenant_id: recipient.id }
+        : { OR: [{ property: propertyWhere }, { inspector_id: recipient.id }] }),
+    };
+
+    const [unread, maintenanceTotal, maintenance, paymentTotals, payments, inspectionTotal, inspections] = await Promise.all([
+      messagingService.getUnreadCounts({ user_id: recipient.id, role: recipient.role } as JWTClaims),
+      this.prisma.maintenanceRequest.count({ where: maintenanceWhere }),
+      this.prisma.maintenanceRequest.findMany({
+        where: maintenanceWhere,
+        select: {
+          title: true,
+          priority: true,
+          status: true,
+          property: { select: { name: true } },
+          unit: { select: { unit_number: true } },
+        },
+        orderBy: [{ priority: 'desc' }, { created_at: 'desc' }],
+        take: SECTION_LIMIT,
+      }),
+      this.prisma.payment.groupBy({
+        by: ['currency'],
+        where: paymentWhere,
+        _sum: { amount: true },
+        _count: { _all: true },
+      }),
+      this.prisma.payment.findMany({
+        where: paymentWhere,
+        select: {
+          receipt_number: true,
+          amount: true,
+          currency: true,
+          payment_date: true,
+          tenant: { select: { first_name: true, last_name: true } },
+        },
+        orderBy: { payment_date: 'desc' },
+        take: SECTION_LIMIT,
+      }),
+      this.prisma.inspection.count({ where: inspectionWhere }),
+      this.prisma.inspection.findMany({
+        where: inspectionWhere,
+        select: {
+          inspection_type: true,
+          scheduled_date: true,
+          property: { select: { name: true } },
+          unit: { select: { unit_number: true } },
+        },
+        orderBy: { scheduled_date: 'asc' },
+        take: SECTION_LIMIT,
+      }),
+    ]);
+
+    return {
+      frequency,
+      period_start: since,
+      period_end: now,
+      unread_messages: {
+        total: unread.total,
+        conversations: unread.byConversation.slice(0, SECTION_LIMIT).map(c => ({ subject: c.subject, unread: c.unread })),
+      },
+      maintenance_requests: {
+        total: maintenanceTotal,
+        items: maintenance.map(request => ({
+          title: request.title,
+          property: request.property.name,
+          unit: request.unit?.unit_number || null,
+          priority: request.priority,
+          status: request.status,
+        })),
+      },
+      payments_received: {
+        total: paymentTotals.reduce((sum, row) => sum + row._count._all, 0),
+        amounts: paymentTotals.map(row => ({ currency: row.currency, amount: Number(row._sum.amount || 0) })),
+        items: payments.map(payment => ({
+          receipt_number: payment.receipt_number,
+          tenant: `${payment.tenant.first_name} ${payment.tenant.last_name}`.trim(),
+          amount: Number(payment.amount),
+          currency: payment.currency,
+          payment_date: payment.payment_date,
+        })),
+      },
+      upcoming_inspections: {
+        total: inspectionTotal,
+        items: inspections.map(inspection => ({
+          type: inspection.inspection_type,
+          property: inspection.property.name,
+          unit: inspection.unit.unit_number,
+          scheduled_date: inspection.scheduled_date!,
+        })),
+      },
+    };
+  }
+
+  /**
+   * Properties a staff member's digest covers
+   */
+  private async propertyScope(recipient: DigestRecipient): Promise<any> {
+    if (ASSIGNED_ROLES.includes(recipient.role)) {
+      const assignments = await this.prisma.staffPropertyAssignment.findMany({
+        where: { staff_id: recipient.id, status: 'active' },
+        select: { property_id: true },
+      });
+      return { id: { in: assignments.map(a => a.property_id) } };
+    }
+    if (recipient.role === 'landlord') {
+      return { owner_id: recipient.id };
+    }
+    return recipient.agency_id ? { agency_id: recipient.agency_id } : { company_id: recipient.company_id! };
+  }
+
+  private async findRecipient(userId: string): Promise<DigestRecipient | null> {
+    return this.prisma.user.findUnique({
+      where: { id: userId },
+      select: { id: true, email: true, first_name: true, role: true, company_id: true, agency_id: true },
+    }) as Promise<DigestRecipient | null>;
+  }
+
+  private sections(recipient: DigestRecipient, summary: DigestSummary) {
+    const isTenant = recipient.role === 'tenant';
+    const { unread_messages: unread, maintenance_requests: maintenance, payments_received: payments, upcoming_inspections: inspections } = summary;
+    return [
+      unread.total && {
+        title: `${unread.total} unread message${unread.total === 1 ? '' : 's'}`,
+        lines: unread.conversations.map(c => `${c.subject || 'Conversation'}: ${c.unread} unread`),
+      },
+      maintenance.total && {
+        title: isTenant
+          ? `${maintenance.total} update${maintenance.total === 1 ? '' : 's'} on your maintenance requests`
+          : `${maintenance.total} new maintenance request${maintenance.total === 1 ? '' : 's'}`,
+        lines: maintenance.items.map(r =>
+          `${r.title} (${r.property}${r.unit ? `, unit ${r.unit}` : ''}): ${isTenant ? r.status.replace(/_/g, ' ') : `${r.priority} priority`}`),
+      },
+      payments.total && {
+        title: `${payments.total} payment${payments.total === 1 ? '' : 's'} received: ${payments.amounts.map(a => formatAmount(a.amount, a.currency)).join(' + ')}`,
+        lines: payments.items.map(p =>
+          `${formatAmount(p.amount, p.currency)}${isTenant ? '' : ` from ${p.tenant}`} on ${formatDate(p.payment_date)} (receipt ${p.receipt_number})`),
+      },
+      inspections.total && {
+        title: `${inspections.total} upcoming inspection${inspections.total === 1 ? '' : 's'}`,
+        lines: inspections.items.map(i =>
+          `${formatDate(i.scheduled_date)}: ${i.type.replace(/_/g, ' ')} inspection, ${i.property} unit ${i.unit}`),
+      },
+    ].filter(Boolean) as EmailSection[];
+  }
+}
+
+export const digestService = new DigestService();
@@ -0,0 +1,290 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface DocumentExportRequest {
+  document_type?: string;
+  report_type?: string;
+  invoice_id?: string;
+  filters?: Record<string, any>;
+}
+
+export const EXPORT_REPORT_TYPES = ['property', 'financial', 'occupancy', 'rent-collection', 'maintenance', 'arrears-aging', 'rent-roll', 'profit-loss', 'budget-variance', 'tax-summary', 'agency-rollup', 'custom'];
+const DOCUMENT_TYPES = ['report', 'invoice'];
+const MAX_ATTEMPTS = 3;
+// A render still "processing" after this long died with its server and is picked up again
+const PROCESSING_TIMEOUT_MS = 10 * 60 * 1000;
+const BATCH_SIZE = 10;
+// Files are deleted from storage once they expire
+const RETENTION_DAYS = 7;
+// Signed download links last an hour unless a longer one is asked for, up to a day
+export const LINK_TTL_SECONDS = 60 * 60;
+export const MAX_LINK_TTL_SECONDS = 24 * 60 * 60;
+const DAY = 24 * 60 * 60 * 1000;
+
+/**
+ * Background PDF generation: an export is queued, rendered by the document engine, uploaded to
+ * private storage and then served through short-lived signed download links until it expires.
+ * Requests are started immediately; the scheduler retries failures and anything interrupted by a
+ * restart, and deletes expired files.
+ */
+/**
+ * Signed link to a generated file that has not expired. Shared with scheduled report runs and
+ * account exports.
+ */
+export async function signedLink(
+  row: { status: string; file_url: string | null; expires_at: Date | null },
+  expiresIn?: number,
+  maxSeconds: number = MAX_LINK_TTL_SECONDS
+) {
+  if (row.status === 'expired' || (row.expires_at && row.expires_at <= new Date())) {
+    throw new Error('This file has expired; generate it again');
+  }
+  if (!row.file_url) {
+    throw new Error('The file is not ready yet');
+  }
+  const ttl = expiresIn === undefined ? Math.min(LINK_TTL_SECONDS, maxSeconds) : Number(expiresIn);
+  if (!Number.isInteger(ttl) || ttl < 60 || ttl > maxSeconds) {
+    throw new Error(`expires_in must be between 60 and ${maxSeconds} seconds`);
+  }
+  const { imagekitService } = await import('./imagekit.service.js');
+  const link = imagekitService.signedDownload(row.file_url, ttl, row.expires_at);
+  if (!link) {
+    throw new Error('This file has expired; generate it again');
+  }
+  return { download_url: link.url, download_url_expires_at: link.expires_at };
+}
+
+export class DocumentExportsService {
+  private prisma = getPrisma();
+
+  async request(req: DocumentExportRequest, user: JWTClaims) {
+    const documentType = req.document_type || 'report';
+    if (!DOCUMENT_TYPES.includes(documentType)) {
+      throw new Error(`document_type must be one of: ${DOCUMENT_TYPES.join(', ')}`);
+    }
+    if (documentType === 'report' && !EXPORT_REPORT_TYPES.includes(req.report_type || '')) {
+      throw new Error(`report_type must be one of: ${EXPORT_REPORT_TYPES.join(', ')}`);
+    }
+    if (documentType === 'invoice') {
+      if (!req.invoice_id) {
+        throw new Error('invoice_id is required');
+      }
+      const invoice = await this.prisma.invoice.findUnique({ where: { id: req.invoice_id }, select: { company_id: true } });
+      if (!invoice) {
+        throw new Error('Invoice not found');
+      }
+      if (user.role !== 'super_admin' && invoice.company_id !== user.company_id) {
+        throw new Error('insufficient permissions to export this invoice');
+      }
+    }
+
+    const exportRow = await this.prisma.documentExport.create({
+      data: {
+        company_id: user.company_id || null,
+        requested_by: user.user_id,
+        document_type: documentType,
+        report_type: documentType === 'report' ? req.report_type : null,
+        entity_id: documentType === 'invoice' ? req.invoice_id : null,
+        filters: req.filters && typeof req.filters === 'object' ? req.filters : {},
+      },
+    });
+
+    this.process(exportRow.id).catch(error => {
+      console.error(`❌ Document export ${exportRow.id} failed to start:`, error.message);
+    });
+    return this.present(exportRow);
+  }
+
+  async get(exportId: string, user: JWTClaims) {
+    return this.present(await this.getOwn(exportId, user));
+  }
+
+  private async getOwn(exportId: string, user: JWTClaims) {
+    const exportRow = await this.prisma.documentExport.findFirst({
+      where: { id: exportId, requested_by: user.user_id },
+    });
+    if (!exportRow) {
+      throw new Error('Export not found');
+    }
+    return exportRow;
+  }
+
+  /**
+   * A fresh signed link, for when the last one has run out; `expiresIn` is in seconds
+   */
+  async issueLink(exportId: string, user: JWTClaims, expiresIn?: number) {
+    const exportRow = await this.getOwn(exportId, user);
+    return signedLink(exportRow, expiresIn);
+  }
+
+  async list(user: JWTClaims, limit: number = 20) {
+    const exports = await this.prisma.documentExport.findMany({
+      where: { requested_by: user.user_id },
+      orderBy: { created_at: 'desc' },
+      take: Math.min(Math.max(limit, 1), 100),
+    });
+    return Promise.all(exports.map(exportRow => this.present(exportRow)));
+  }
+
+  /**
+   * Scheduled run: queued exports, failures with attempts left and renders that stalled
+   */
+  async processPending(now = new Date()) {
+    const due = await this.prisma.documentExport.findMany({
+      where: {
+        attempts: { lt: MAX_ATTEMPTS },
+        OR: [
+          { status: 'queued' },
+          { status: 'processing', started_at: { lt: new Date(now.getTime() - PROCESSING_TIMEOUT_MS) } },
+        ],
+      },
+      orderBy: { created_at: 'asc' },
+      take: BATCH_SIZE,
+      select: { id: true },
+    });
+    let ready = 0;
+    for (const { id } of due) {
+      if ((await this.process(id)) === 'ready') ready++;
+    }
+    return { processed: due.length, ready };
+  }
+
+  /**
+   * Render one export; the status update doubles as a claim so it is only rendered once at a time
+   */
+  async process(exportId: string) {
+    const now = new Date();
+    const claimed = await this.prisma.documentExport.updateMany({
+      where: {
+        id: exportId,
+        attempts: { lt: MAX_ATTEMPTS },
+        OR: [
+          { status: 'queued' },
+          { status: 'processing', started_at: { lt: new Date(now.getTime() - PROCESSING_TIMEOUT_MS) } },
+        ],
+      },
+      data: { status: 'processing', started_at: now, attempts: { increment: 1 } },
+    });
+    if (!claimed.count) return null;
+
+    const exportRow = await this.prisma.documentExport.findUniqueOrThrow({
+      where: { id: exportId },
+      include: {
+        requester: { select: { id: true, email: true, phone_number: true, role: true, company_id: true, agency_id: true, landlord_id: true, status: true } },
+      },
+    });
+
+    try {
+      if (exportRow.requester.status !== 'active') {
+        throw new Error('Requesting user is no longer active');
+      }
+      // Rendered with the requester's current access, not what they had when they asked
+      const user = {
+        user_id: exportRow.requester.id,
+        email: exportRow.requester.email || '',
+        phone_number: exportRow.requester.phone_number || '',
+        role: exportRow.requester.role,
+        company_id: exportRow.requester.company_id || undefined,
+        agency_id: exportRow.requester.agency_id || undefined,
+        landlord_id: exportRow.requester.landlord_id || undefined,
+      } as JWTClaims;
+
+      const { pdf, fileName } = await this.render(exportRow, user);
+      const { imagekitService } = await import('./imagekit.service.js');
+      const upload = await imagekitService.uploadFile(pdf, fileName, `exports/${exportRow.company_id || 'system'}`, { isPrivate: true });
+      const completed = new Date();
+
+      await this.prisma.documentExport.update({
+        where: { id: exportId },
+        data: {
+          status: 'ready',
+          file_name: fileName,
+          file_size: pdf.length,
+          file_url: upload.url,
+          file_id: upload.fileId,
+          error: null,
+          completed_at: completed,
+          expires_at: new Date(completed.getTime() + RETENTION_DAYS * DAY),
+        },
+      });
+      return 'ready';
+    } catch (error: any) {
+      // Retried by the scheduler until the attempts run out
+      const final = exportRow.attempts >= MAX_ATTEMPTS;
+      await this.prisma.documentExport.update({
+        where: { id: exportId },
+        data: {
+          status: final ? 'failed' : 'queued',
+          error: error.message || 'Unknown error',
+          ...(final && { completed_at: new Date() }),
+        },
+      });
+      return final ? 'failed' : 'queued';
+    }
+  }
+
+  /**
+   * Delete files past their expiry from storage; the export stays as history
+   */
+  async purgeExpired(now = new Date()) {
+    const expired = await this.prisma.documentExport.findMany({
+      where: { status: 'ready', expires_at: { lte: now } },
+      select: { id: true, file_id: true },
+      take: 50,
+    });
+    const { imagekitService } = await import('./imagekit.service.js');
+    for (const exportRow of expired) {
+      try {
+        if (exportRow.file_id) await imagekitService.deleteFile(exportRow.file_id);
+      } catch (error: any) {
+        console.error(`⚠️ Failed to delete expired document export ${exportRow.id}:`, error.message);
+        continue;
+      }
+      await this.prisma.documentExport.update({
+        where: { id: exportRow.id },
+        data: { status: 'expired', file_url: null, file_id: null },
+      });
+    }
+    return { expired: expired.length };
+  }
+
+  private async render(exportRow: any, user: JWTClaims) {
+    const { documentService } = await import('../modules/documents/document-service.js');
+    const date = new Date().toISOString().split('T')[0];
+
+    if (exportRow.document_type === 'invoice') {
+      const invoice = await this.prisma.invoice.findUnique({ where: { id: exportRow.entity_id }, select: { invoice_number: true } });
+      const pdf = await documentService.getInvoicePdf(exportRow.entity_id, user, 1);
+      return { pdf, fileName: `Invoice-${invoice?.invoice_number || exportRow.entity_id}.pdf` };
+    }
+
+    const { reportsService } = await import('./reports.service.js');
+    const report = await reportsService.getReportDocument(user, exportRow.report_type, exportRow.filters || {});
+    const pdf = await documentService.getReportPdf(exportRow.report_type, report.title, report.rows, report.summary, user, 1, report.charts);
+    return { pdf, fileName: `${exportRow.report_type}_report_${date}.pdf` };
+  }
+
+  private async present(exportRow: any) {
+    const expired = exportRow.status === 'expired' || (exportRow.status === 'ready' && exportRow.expires_at && exportRow.expires_at <= new Date());
+    const link = exportRow.status === 'ready' && !expired ? await signedLink(exportRow).catch(() => null) : null;
+    return {
+      id: exportRow.id,
+      document_type: exportRow.document_type,
+      report_type: exportRow.report_type,
+      entity_id: exportRow.entity_id,
+      filters: exportRow.filters,
+      status: expired ? 'expired' : exportRow.status,
+      file_name: exportRow.file_name,
+      file_size: exportRow.file_size,
+      download_url: link?.download_url || null,
+      download_url_expires_at: link?.download_url_expires_at || null,
+      error: exportRow.status === 'failed' ? exportRow.error : null,
+      attempts: exportRow.attempts,
+      created_at: exportRow.created_at,
+      completed_at: exportRow.completed_at,
+      expires_at: exportRow.expires_at,
+    };
+  }
+}
+
+export const documentExportsService = new DocumentExportsService();
@@ -0,0 +1,1060 @@
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { emailService, EmailResult, EmailAttachment } from './email.service.js';
+import { agencyBrandingService } from './agency-branding.service.js';
+import { escapeHtml, escapeHtmlLines } from '../utils/html.js';
+
+export const EMAIL_LOCALES = ['en', 'sw'] as const;
+export type EmailLocale = (typeof EMAIL_LOCALES)[number];
+
+const BRANDING_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+
+/**
+ * Per-company look of outgoing email, stored under company settings.email_branding. An agency's
+ * own branding, where it has set one, takes precedence.
+ */
+export interface EmailBranding {
+  company_name: string;
+  sender_name: string;
+  logo_url: string | null;
+  primary_color: string;
+  footer_text: string | null;
+  support_email: string | null;
+  support_phone: string | null;
+  reply_to?: string | null;
+}
+
+interface EmailTemplateContent {
+  // Line shown above the header, e.g. the reply marker on conversation emails
+  preheader?: string;
+  subject: string;
+  heading: string;
+  paragraphs: string[];
+  details?: Array<{ label: string; value: string }>;
+  // Variable holding Array<{ title, lines }>, each shown as a boxed list after the paragraphs
+  sections?: string;
+  cta?: { label: string; url: string };
+  // Small print under the message, e.g. how to withdraw or unsubscribe
+  footnote?: { text: string; link?: { label: string; url: string } };
+}
+
+interface EmailTemplateDefinition {
+  description: string;
+  variables: string[];
+  // Variables that may be left out; any paragraph, detail or link using one that is empty is dropped
+  optional?: string[];
+  sample: Record<string, any>;
+  content: Record<EmailLocale, EmailTemplateContent>;
+}
+
+export interface EmailSection {
+  title: string;
+  lines: string[];
+}
+
+export interface RenderedEmail {
+  template: string;
+  locale: EmailLocale;
+  subject: string;
+  html: string;
+  text: string;
+  missing_variables: string[];
+}
+
+const DEFAULT_PRIMARY_COLOR = '#2563eb';
+
+// Fixed wording around every template, per locale
+const LAYOUT_TEXT: Record<EmailLocale, { signOff: string; automated: string; contact: string; linkHint: string }> = {
+  en: {
+    signOff: 'Best regards,',
+    automated: 'This is an automated message, please do not reply to this email.',
+    contact: 'Questions? Contact us at',
+    linkHint: "If the button doesn't work, copy and paste this link into your browser:",
+  },
+  sw: {
+    signOff: 'Kwa heshima,',
+    automated: 'Huu ni ujumbe wa kiotomatiki, tafadhali usijibu barua pepe hii.',
+    contact: 'Una maswali? Wasiliana nasi kupitia',
+    linkHint: 'Ikiwa kitufe hakifanyi kazi, nakili kiungo hiki na ukibandike kwenye kivinjari chako:',
+  },
+};
+
+const TEMPLATES: Record<string, EmailTemplateDefinition> = {
+  rent_reminder: {
+    description: 'Upcoming rent due reminder sent to tenants',
+    variables: ['tenant_name', 'days', 'amount', 'currency', 'due_date', 'invoice_number', 'property_name', 'unit_number', 'payment_url'],
+    sample: {
+      tenant_name: 'Jane Wanjiku', days: 3, amount: 25000, currency: 'KES', due_date: new Date(),
+      invoice_number: 'INV-2026-0001', property_name: 'Sunrise Apartments', unit_number: 'A4', payment_url: `${env.appUrl}/tenant/payments`,
+    },
+    content: {
+      en: {
+        subject: 'Rent Payment Reminder - Due in {{days}} days',
+        heading: 'Rent Payment Reminder',
+        paragraphs: [
+          'Dear {{tenant_name}},',
+          'This is a friendly reminder that your rent payment of {{currency}} {{amount}} is due on {{due_date}}.',
+          'Please ensure payment is made before the due date to avoid late fees.',
+        ],
+        details: [
+          { label: 'Invoice', value: '{{invoice_number}}' },
+          { label: 'Amount', value: '{{currency}} {{amount}}' },
+          { label: 'Due date', value: '{{due_date}}' },
+          { label: 'Property', value: '{{property_name}}' },
+          { label: 'Unit', value: '{{unit_number}}' },
+        ],
+        cta: { label: 'Pay Now', url: '{{payment_url}}' },
+      },
+      sw: {
+        subject: 'Kikumbusho cha Malipo ya Kodi - Inadaiwa baada ya siku {{days}}',
+        heading: 'Kikumbusho cha Malipo ya Kodi',
+        paragraphs: [
+          'Mpendwa {{tenant_name}},',
+          'Huu ni ukumbusho kwamba malipo yako ya kodi ya {{currency}} {{amount}} yanadaiwa tarehe {{due_date}}.',
+          'Tafadhali hakikisha malipo yanafanywa kabla ya tarehe ya mwisho ili kuepuka ada za kuchelewa.',
+        ],
+        details: [
+          { label: 'Ankara', value: '{{invoice_number}}' },
+          { label: 'Kiasi', value: '{{currency}} {{amount}}' },
+          { label: 'Tarehe ya mwisho', value: '{{due_date}}' },
+          { label: 'Jengo', value: '{{property_name}}' },
+          { label: 'Nyumba', value: '{{unit_number}}' },
+        ],
+        cta: { label: 'Lipa Sasa', url: '{{payment_url}}' },
+      },
+    },
+  },
+  late_rent_reminder: {
+    description: 'Overdue rent reminder sent to tenants',
+    variables: ['tenant_name', 'amount', 'currency', 'due_date', 'invoice_number', 'property_name', 'unit_number', 'payment_url'],
+    sample: {
+      tenant_name: 'Jane Wanjiku', amount: 25000, currency: 'KES', due_date: new Date(),
+      invoice_number: 'INV-2026-0001', property_name: 'Sunrise Apartments', unit_number: 'A4', payment_url: `${env.appUrl}/tenant/payments`,
+    },
+    content: {
+      en: {
+        subject: 'Late Rent Reminder - Invoice {{invoice_number}}',
+        heading: 'Your Rent Is Overdue',
+        paragraphs: [
+          'Dear {{tenant_name}},',
+          'Our records show that your rent of {{currency}} {{amount}}, due on {{due_date}}, has not been paid.',
+          'Please make the payment as soon as possible, or contact us if you have already paid.',
+        ],
+        details: [
+          { label: 'Invoice', value: '{{invoice_number}}' },
+          { label: 'Amount due', value: '{{currency}} {{amount}}' },
+          { label: 'Due date', value: '{{due_date}}' },
+          { label: 'Property', value: '{{property_name}}' },
+          { label: 'Unit', value: '{{unit_number}}' },
+        ],
+        cta: { label: 'Pay Now', url: '{{payment_url}}' },
+      },
+      sw: {
+        subject: 'Kikumbusho cha Kodi Iliyochelewa - Ankara {{invoice_number}}',
+        heading: 'Kodi Yako Imechelewa',
+        paragraphs: [
+          'Mpendwa {{tenant_name}},',
+          'Kumbukumbu zetu zinaonyesha kwamba kodi yako ya {{currency}} {{amount}}, iliyopaswa kulipwa tarehe {{due_date}}, bado haijalipwa.',
+          'Tafadhali fanya malipo haraka iwezekanavyo, au wasiliana nasi ikiwa tayari umelipa.',
+        ],
+        details: [
+          { label: 'Ankara', value: '{{invoice_number}}' },
+          { label: 'Kiasi kinachodaiwa', value: '{{currency}} {{amount}}' },
+          { label: 'Tarehe ya mwisho', value: '{{due_date}}' },
+          { label: 'Jengo', value: '{{property_name}}' },
+          { label: 'Nyumba', value: '{{unit_number}}' },
+        ],
+        cta: { label: 'Lipa Sasa', url: '{{payment_url}}' },
+      },
+    },
+  },
+  lease_expiring_tenant: {
+    description: 'Lease expiry notice sent to the tenant',
+    variables: ['tenant_name', 'days', 'end_date', 'property_name', 'unit_number', 'monthly_rent', 'currency'],
+    sample: {
+      tenant_name: 'Jane Wanjiku', days: 30, end_date: new Date(), property_name: 'Sunrise Apartments',
+      unit_number: 'A4', monthly_rent: 25000, currency: 'KES',
+    },
+    content: {
+      en: {
+        subject: 'Your lease expires in {{days}} days',
+        heading: 'Lease Expiration Notice',
+        paragraphs: [
+          'Dear {{tenant_name}},',
+          'Your lease for {{property_name}}, unit {{unit_number}}, ends on {{end_date}}.',
+          'Please contact your landlord to discuss renewal or moving arrangements.',
+        ],
+        details: [
+          { label: 'Property', value: '{{property_name}}' },
+          { label: 'Unit', value: '{{unit_number}}' },
+          { label: 'Expiration date', value: '{{end_date}}' },
+          { label: 'Monthly rent', value: '{{currency}} {{monthly_rent}}' },
+        ],
+      },
+      sw: {
+        subject: 'Mkataba wako wa upangaji unaisha baada ya siku {{days}}',
+        heading: 'Taarifa ya Kuisha kwa Mkataba',
+        paragraphs: [
+          'Mpendwa {{tenant_name}},',
+          'Mkataba wako wa upangaji wa {{property_name}}, nyumba {{unit_number}}, unaisha tarehe {{end_date}}.',
+          'Tafadhali wasiliana na mwenye nyumba wako kujadili kuongeza mkataba au mipango ya kuhama.',
+        ],
+        details: [
+          { label: 'Jengo', value: '{{property_name}}' },
+          { label: 'Nyumba', value: '{{unit_number}}' },
+          { label: 'Tarehe ya kuisha', value: '{{end_date}}' },
+          { label: 'Kodi ya mwezi', value: '{{currency}} {{monthly_rent}}' },
+        ],
+      },
+    },
+  },
+  lease_expiring_landlord: {
+    description: 'Lease expiry alert sent to the property owner',
+    variables: ['landlord_name', 'tenant_name', 'days', 'end_date', 'property_name', 'unit_number', 'monthly_rent', 'currency'],
+    sample: {
+      landlord_name: 'John Otieno', tenant_name: 'Jane Wanjiku', days: 30, end_date: new Date(),
+      property_name: 'Sunrise Apartments', unit_number: 'A4', monthly_rent: 25000, currency: 'KES',
+    },
+    content: {
+      en: {
+        subject: 'Lease Expiration Alert - {{days}} days remaining',
+        heading: 'Lease Expiration Alert',
+        paragraphs: [
+          'Dear {{landlord_name}},',
+          'The lease for {{tenant_name}} at {{property_name}}, unit {{unit_number}}, ends on {{end_date}}.',
+          'Please contact your tenant to discuss lease renewal options.',
+        ],
+        details: [
+          { label: 'Tenant', value: '{{tenant_name}}' },
+          { label: 'Property', value: '{{property_name}}' },
+          { label: 'Unit', value: '{{unit_number}}' },
+          { label: 'Expiration date', value: '{{end_date}}' },
+          { label: 'Monthly rent', value: '{{currency}} {{monthly_rent}}' },
+        ],
+      },
+      sw: {
+        subject: 'Tahadhari ya Kuisha kwa Mkataba - Zimebaki siku {{days}}',
+        heading: 'Tahadhari ya Kuisha kwa Mkataba',
+        paragraphs: [
+          'Mpendwa {{landlord_name}},',
+          'Mkataba wa {{tenant_name}} katika {{property_name}}, nyumba {{unit_number}}, unaisha tarehe {{end_date}}.',
+          'Tafadhali wasiliana na mpangaji wako kujadili chaguo za kuongeza mkataba.',
+        ],
+        details: [
+          { label: 'Mpangaji', value: '{{tenant_name}}' },
+          { label: 'Jengo', value: '{{property_name}}' },
+          { label: 'Nyumba', value: '{{unit_number}}' },
+          { label: 'Tarehe ya kuisha', value: '{{end_date}}' },
+          { label: 'Kodi ya mwezi', value: '{{currency}} {{monthly_rent}}' },
+        ],
+      },
+    },
+  },
+  agency_admin_invitation: {
+    description: 'Invitation for the first administrator of a newly onboarded agency',
+    variables: ['admin_name', 'agency_name', 'setup_url'],
+    sample: { admin_name: 'Grace Njeri', agency_name: 'Nyumba Bora Agency', setup_url: `${env.appUrl}/account/setup` },
+    content: {
+      en: {
+        subject: 'You have been invited to manage {{agency_name}}',
+        heading: 'Welcome to {{agency_name}}',
+        paragraphs: [
+          'Dear {{admin_name}},',
+          'You have been added as the administrator of {{agency_name}}. Set a password to finish setting up your account.',
+          'Once you sign in you can add properties, landlords and your team.',
+        ],
+        cta: { label: 'Set Up Your Account', url: '{{setup_url}}' },
+      },
+      sw: {
+        subject: 'Umealikwa kusimamia {{agency_name}}',
+        heading: 'Karibu {{agency_name}}',
+        paragraphs: [
+          'Mpendwa {{admin_name}},',
+          'Umeongezwa kama msimamizi wa {{agency_name}}. Weka nenosiri ili kukamilisha akaunti yako.',
+          'Ukishaingia unaweza kuongeza majengo, wamiliki na timu yako.',
+        ],
+        cta: { label: 'Weka Akaunti Yako', url: '{{setup_url}}' },
+      },
+    },
+  },
+  staff_invitation: {
+    description: 'Invitation for a new staff member or caretaker to set a password',
+    variables: ['staff_name', 'role_name', 'setup_url'],
+    sample: { staff_name: 'Peter Kamau', role_name: 'Caretaker', setup_url: `${env.appUrl}/account/setup` },
+    content: {
+      en: {
+        subject: 'Complete your {{role_name}} account setup',
+        heading: 'You have been invited as a {{role_name}}',
+        paragraphs: [
+          'Dear {{staff_name}},',
+          'Your {{role_name}} account has been created. Set a password to finish setting up your account and get started.',
+        ],
+        cta: { label: 'Complete Account Setup', url: '{{setup_url}}' },
+      },
+      sw: {
+        subject: 'Kamilisha akaunti yako ({{role_name}})',
+        heading: 'Umealikwa kama {{role_name}}',
+        paragraphs: [
+          'Mpendwa {{staff_name}},',
+          'Akaunti yako ya {{role_name}} imefunguliwa. Weka nenosiri ili kukamilisha akaunti yako na kuanza kazi.',
+        ],
+        cta: { label: 'Kamilisha Akaunti', url: '{{setup_url}}' },
+      },
+    },
+  },
+  tenant_invitation: {
+    description: 'Invitation for a tenant to set up their tenant portal account',
+    variables: ['tenant_name', 'setup_url'],
+    sample: { tenant_name: 'Jane Wanjiku', setup_url: `${env.appUrl}/tenant-register` },
+    content: {
+      en: {
+        subject: 'Complete your tenant account setup',
+        heading: 'Welcome to your tenant portal',
+        paragraphs: [
+          'Dear {{tenant_name}},',
+          'You have been invited to the tenant portal. Set up your account to view your lease, pay rent, see your payment history and report maintenance issues.',
+        ],
+        cta: { label: 'Complete Account Setup', url: '{{setup_url}}' },
+      },
+      sw: {
+        subject: 'Kamilisha akaunti yako ya mpangaji',
+        heading: 'Karibu kwenye lango la wapangaji',
+        paragraphs: [
+          'Mpendwa {{tenant_name}},',
+          'Umealikwa kwenye lango la wapangaji. Fungua akaunti yako ili kuona mkataba wako, kulipa kodi, kuona historia ya malipo na kuripoti matatizo ya matengenezo.',
+        ],
+        cta: { label: 'Kamilisha Akaunti', url: '{{setup_url}}' },
+      },
+    },
+  },
+  vendor_work_order: {
+    description: 'Work order link sent to an external vendor',
+    variables: ['vendor_name', 'title', 'description', 'location', 'scheduled_date', 'note', 'link_days', 'work_order_url'],
+    optional: ['scheduled_date', 'note'],
+    sample: {
+      vendor_name: 'Baraka Plumbers', title: 'Leaking kitchen sink', description: 'Water is dripping under the sink.',
+      location: 'Sunrise Apartments, Unit A4', scheduled_date: new Date(), note: 'Call the caretaker on arrival.',
+      link_days: 30, work_order_url: `${env.appUrl}/vendor/work-orders/sample`,
+    },
+    content: {
+      en: {
+        subject: 'New work order: {{title}}',
+        heading: 'New Work Order',
+        paragraphs: [
+          'Hello {{vendor_name}},',
+          'You have been assigned a work order at {{location}}.',
+          '{{description}}',
+          'Note: {{note}}',
+          'Use the link below to view the job and post progress updates. No login is required; the link expires in {{link_days}} days.',
+        ],
+        details: [
+          { label: 'Job', value: '{{title}}' },
+          { label: 'Location', value: '{{location}}' },
+          { label: 'Scheduled for', value: '{{scheduled_date}}' },
+        ],
+        cta: { label: 'View Work Order', url: '{{work_order_url}}' },
+      },
+      sw: {
+        subject: 'Kazi mpya: {{title}}',
+        heading: 'Kazi Mpya ya Matengenezo',
+        paragraphs: [
+          'Habari {{vendor_name}},',
+          'Umepewa kazi ya matengenezo katika {{location}}.',
+          '{{description}}',
+          'Maelezo: {{note}}',
+          'Tumia kiungo kilicho hapa chini kuona kazi na kutuma taarifa za maendeleo. Huhitaji kuingia; kiungo kinaisha baada ya siku {{link_days}}.',
+        ],
+        details: [
+          { label: 'Kazi', value: '{{title}}' },
+          { label: 'Mahali', value: '{{location}}' },
+          { label: 'Tarehe iliyopangwa', value: '{{scheduled_date}}' },
+        ],
+        cta: { label: 'Angalia Kazi', url: '{{work_order_url}}' },
+      },
+    },
+  },
+  inspection_assigned: {
+    description: 'Inspection booking sent to the assigned inspector',
+    variables: ['inspector_name', 'inspection_type', 'location', 'when', 'duration_minutes'],
+    sample: {
+      inspector_name: 'Peter Kamau', inspection_type: 'move-in', location: 'Sunrise Apartments, Unit A4',
+      when: new Date().toLocaleString(), duration_minutes: 60,
+    },
+    content: {
+      en: {
+        subject: 'Inspection assigned: {{location}}',
+        heading: 'Inspection Assigned',
+        paragraphs: [
+          'Hello {{inspector_name}},',
+          'You are scheduled to carry out the {{inspection_type}} inspection at {{location}} on {{when}} ({{duration_minutes}} minutes).',
+          'Subscribe to your inspection calendar from the app to see all of your bookings in Google or Outlook.',
+        ],
+      },
+      sw: {
+        subject: 'Ukaguzi umepangiwa: {{location}}',
+        heading: 'Umepangiwa Ukaguzi',
+        paragraphs: [
+          'Habari {{inspector_name}},',
+          'Umepangiwa kufanya ukaguzi wa {{inspection_type}} katika {{location}} tarehe {{when}} (dakika {{duration_minutes}}).',
+          'Jiunge na kalenda yako ya ukaguzi kutoka kwenye programu ili kuona ukaguzi wako wote kwenye Google au Outlook.',
+        ],
+      },
+    },
+  },
+  inspection_reminder_inspector: {
+    description: 'Reminder to the inspector the day before an inspection',
+    variables: ['inspector_name', 'inspection_type', 'location', 'when'],
+    sample: { inspector_name: 'Peter Kamau', inspection_type: 'routine', location: 'Sunrise Apartments, Unit A4', when: new Date().toLocaleString() },
+    content: {
+      en: {
+        subject: 'Reminder: inspection at {{location}}',
+        heading: 'Upcoming Inspection',
+        paragraphs: [
+          'Hello {{inspector_name}},',
+          'This is a reminder of the {{inspection_type}} inspection at {{location}} on {{when}}.',
+        ],
+      },
+      sw: {
+        subject: 'Kikumbusho: ukaguzi katika {{location}}',
+        heading: 'Ukaguzi Unaokuja',
+        paragraphs: [
+          'Habari {{inspector_name}},',
+          'Hiki ni kikumbusho cha ukaguzi wa {{inspection_type}} katika {{location}} tarehe {{when}}.',
+        ],
+      },
+    },
+  },
+  inspection_reminder_tenant: {
+    description: 'Reminder to the tenant the day before their unit is inspected',
+    variables: ['tenant_name', 'inspection_type', 'location', 'when'],
+    sample: { tenant_name: 'Jane Wanjiku', inspection_type: 'routine', location: 'Sunrise Apartments, Unit A4', when: new Date().toLocaleString() },
+    content: {
+      en: {
+        subject: 'Upcoming inspection of your unit',
+        heading: 'Upcoming Inspection',
+        paragraphs: [
+          'Hello {{tenant_name}},',
+          'A {{inspection_type}} inspection of {{location}} is scheduled for {{when}}. Please ensure access to the unit.',
+        ],
+      },
+      sw: {
+        subject: 'Ukaguzi wa nyumba yako unakuja',
+        heading: 'Ukaguzi Unaokuja',
+        paragraphs: [
+          'Habari {{tenant_name}},',
+          'Ukaguzi wa {{inspection_type}} wa {{location}} umepangwa tarehe {{when}}. Tafadhali hakikisha nyumba inafikika.',
+        ],
+      },
+    },
+  },
+  inspection_report_shared: {
+    description: 'Expiring download link to a completed inspection report',
+    variables: ['recipient_name', 'inspection_type', 'location', 'report_url', 'expires_at'],
+    optional: ['recipient_name'],
+    sample: {
+      recipient_name: 'John Otieno', inspection_type: 'move-out', location: 'Sunrise Apartments, Unit A4',
+      report_url: `${env.apiUrl}/api/v1/inspection-reports/sample`, expires_at: new Date(),
+    },
+    content: {
+      en: {
+        subject: 'Inspection report: {{location}}',
+        heading: 'Inspection Report',
+        paragraphs: [
+          'Hello {{recipient_name}},',
+          'The {{inspection_type}} inspection for {{location}} has been completed.',
+          'This link expires on {{expires_at}}.',
+        ],
+        cta: { label: 'Download the Report (PDF)', url: '{{report_url}}' },
+      },
+      sw: {
+        subject: 'Ripoti ya ukaguzi: {{location}}',
+        heading: 'Ripoti ya Ukaguzi',
+        paragraphs: [
+          'Habari {{recipient_name}},',
+          'Ukaguzi wa {{inspection_type}} wa {{location}} umekamilika.',
+          'Kiungo hiki kinaisha tarehe {{expires_at}}.',
+        ],
+        cta: { label: 'Pakua Ripoti (PDF)', url: '{{report_url}}' },
+      },
+    },
+  },
+  application_received: {
+    description: 'Confirmation to an applicant that their unit application arrived',
+    variables: ['applicant_name', 'property_name', 'unit_number', 'reference', 'withdraw_url'],
+    sample: {
+      applicant_name: 'Jane Wanjiku', property_name: 'Sunrise Apartments', unit_number: 'A4',
+      reference: '3f2b9c1e-0000-4000-8000-000000000000', withdraw_url: `${env.appUrl}/applications/sample/withdraw`,
+    },
+    content: {
+      en: {
+        subject: 'Application received - {{property_name}}, Unit {{unit_number}}',
+        heading: 'Application Received',
+        paragraphs: [
+          'Dear {{applicant_name}},',
+          'We have received your application for Unit {{unit_number}} at {{property_name}}.',
+          'The property manager will review it and get back to you. Your application reference is {{reference}}.',
+        ],
+        footnote: { text: 'If your plans change you can withdraw your application.', link: { label: 'Withdraw application', url: '{{withdraw_url}}' } },
+      },
+      sw: {
+        subject: 'Ombi limepokelewa - {{property_name}}, Nyumba {{unit_number}}',
+        heading: 'Ombi Limepokelewa',
+        paragraphs: [
+          'Mpendwa {{applicant_name}},',
+          'Tumepokea ombi lako la nyumba {{unit_number}} katika {{property_name}}.',
+          'Msimamizi wa jengo atalipitia na kukujibu. Nambari ya kumbukumbu ya ombi lako ni {{reference}}.',
+        ],
+        footnote: { text: 'Mipango yako ikibadilika unaweza kuondoa ombi lako.', link: { label: 'Ondoa ombi', url: '{{withdraw_url}}' } },
+      },
+    },
+  },
+  application_unsuccessful: {
+    description: 'Notice to an applicant whose application was turned down',
+    variables: ['applicant_name', 'property_name', 'unit_number'],
+    sample: { applicant_name: 'Jane Wanjiku', property_name: 'Sunrise Apartments', unit_number: 'A4' },
+    content: {
+      en: {
+        subject: 'Update on your application - {{property_name}}',
+        heading: 'Application Update',
+        paragraphs: [
+          'Dear {{applicant_name}},',
+          'Thank you for applying for Unit {{unit_number}} at {{property_name}}. Unfortunately your application was not successful this time.',
+          "You can join the property's waiting list to be notified when another unit becomes available.",
+        ],
+      },
+      sw: {
+        subject: 'Taarifa kuhusu ombi lako - {{property_name}}',
+        heading: 'Taarifa ya Ombi',
+        paragraphs: [
+          'Mpendwa {{applicant_name}},',
+          'Asante kwa kuomba nyumba {{unit_number}} katika {{property_name}}. Kwa bahati mbaya ombi lako halikufanikiwa wakati huu.',
+          'Unaweza kujiunga na orodha ya kusubiri ya jengo ili ujulishwe nyumba nyingine ikipatikana.',
+        ],
+      },
+    },
+  },
+  application_unit_let: {
+    description: 'Notice to other applicants once the unit they applied for has been let',
+    variables: ['applicant_name', 'property_name', 'unit_number'],
+    sample: { applicant_name: 'Jane Wanjiku', property_name: 'Sunrise Apartments', unit_number: 'A4' },
+    content: {
+      en: {
+        subject: 'Update on your application - {{property_name}}',
+        heading: 'Application Update',
+        paragraphs: [
+          'Dear {{applicant_name}},',
+          "Unit {{unit_number}} at {{property_name}} has now been let. You can join the property's waiting list to be notified when another unit becomes available.",
+        ],
+      },
+      sw: {
+        subject: 'Taarifa kuhusu ombi lako - {{property_name}}',
+        heading: 'Taarifa ya Ombi',
+        paragraphs: [
+          'Mpendwa {{applicant_name}},',
+          'Nyumba {{unit_number}} katika {{property_name}} imeshapangishwa. Unaweza kujiunga na orodha ya kusubiri ya jengo ili ujulishwe nyumba nyingine ikipatikana.',
+        ],
+      },
+    },
+  },
+  waitlist_joined: {
+    description: 'Confirmation of a place on a property waiting list',
+    variables: ['applicant_name', 'property_name', 'position', 'leave_url'],
+    sample: { applicant_name: 'Jane Wanjiku', property_name: 'Sunrise Apartments', position: 3, leave_url: `${env.appUrl}/waitlist/sample/leave` },
+    content: {
+      en: {
+        subject: 'You are on the waiting list - {{property_name}}',
+        heading: 'You Are on the Waiting List',
+        paragraphs: [
+          'Dear {{applicant_name}},',
+          'You have joined the waiting list for {{property_name}} and are number {{position}} in the queue. We will email you as soon as a matching unit becomes available.',
+        ],
+        footnote: { text: 'If you no longer need a unit you can leave the waiting list.', link: { label: 'Leave the waiting list', url: '{{leave_url}}' } },
+      },
+      sw: {
+        subject: 'Uko kwenye orodha ya kusubiri - {{property_name}}',
+        heading: 'Uko kwenye Orodha ya Kusubiri',
+        paragraphs: [
+          'Mpendwa {{applicant_name}},',
+          'Umejiunga na orodha ya kusubiri ya {{property_name}} na wewe ni nambari {{position}} kwenye foleni. Tutakutumia barua pepe mara nyumba inayokufaa itakapopatikana.',
+        ],
+        footnote: { text: 'Ikiwa huhitaji tena nyumba unaweza kutoka kwenye orodha ya kusubiri.', link: { label: 'Toka kwenye orodha', url: '{{leave_url}}' } },
+      },
+    },
+  },
+  waitlist_offer: {
+    description: 'Offer of a vacant unit to the next person on the waiting list',
+    variables: ['applicant_name', 'property_name', 'unit_number', 'currency', 'rent', 'expires_at', 'apply_url'],
+    sample: {
+      applicant_name: 'Jane Wanjiku', property_name: 'Sunrise Apartments', unit_number: 'A4', currency: 'KES', rent: 25000,
+      expires_at: new Date().toLocaleString(), apply_url: `${env.appUrl}/apply/sample`,
+    },
+    content: {
+      en: {
+        subject: 'A unit is now available at {{property_name}}',
+        heading: 'A Unit Is Available',
+        paragraphs: [
+          'Dear {{applicant_name}},',
+          'Good news! Unit {{unit_number}} at {{property_name}} is now available (rent {{currency}} {{rent}} per month) and you are next on the waiting list.',
+          'Apply before {{expires_at}} to keep your place; after that the unit will be offered to the next person.',
+        ],
+        cta: { label: 'Apply Now', url: '{{apply_url}}' },
+      },
+      sw: {
+        subject: 'Nyumba sasa inapatikana katika {{property_name}}',
+        heading: 'Nyumba Inapatikana',
+        paragraphs: [
+          'Mpendwa {{applicant_name}},',
+          'Habari njema! Nyumba {{unit_number}} katika {{property_name}} sasa inapatikana (kodi {{currency}} {{rent}} kwa mwezi) na wewe ndiye unayefuata kwenye orodha ya kusubiri.',
+          'Omba kabla ya {{expires_at}} ili kushika nafasi yako; baada ya hapo nyumba itapewa mtu anayefuata.',
+        ],
+        cta: { label: 'Omba Sasa', url: '{{apply_url}}' },
+      },
+    },
+  },
+  platform_announcement: {
+    description: 'Platform-wide announcement from the LetRents team, e.g. planned maintenance',
+    variables: ['recipient_name', 'title', 'message', 'starts_at', 'ends_at'],
+    optional: ['starts_at', 'ends_at'],
+    sample: {
+      recipient_name: 'Grace Njeri', title: 'Scheduled maintenance', message: 'The platform will be briefly unavailable while we upgrade our servers.',
+      starts_at: new Date().toUTCString(), ends_at: new Date().toUTCString(),
+    },
+    content: {
+      en: {
+        subject: '{{title}}',
+        heading: '{{title}}',
+        paragraphs: ['Hi {{recipient_name}},', '{{message}}'],
+        details: [
+          { label: 'Starts', value: '{{starts_at}}' },
+          { label: 'Ends', value: '{{ends_at}}' },
+        ],
+      },
+      sw: {
+        subject: '{{title}}',
+        heading: '{{title}}',
+        paragraphs: ['Habari {{recipient_name}},', '{{message}}'],
+        details: [
+          { label: 'Inaanza', value: '{{starts_at}}' },
+          { label: 'Inaisha', value: '{{ends_at}}' },
+        ],
+      },
+    },
+  },
+  notification: {
+    description: 'Email copy of an in-app notification',
+    variables: ['recipient_name', 'title', 'message', 'action_url'],
+    optional: ['action_url'],
+    sample: { recipient_name: 'Jane Wanjiku', title: 'Payment received', message: 'Your payment of KES 25,000 has been received.', action_url: `${env.appUrl}/payments` },
+    content: {
+      en: {
+        subject: '{{title}}',
+        heading: '{{title}}',
+        paragraphs: ['Hello {{recipient_name}},', '{{message}}'],
+        cta: { label: 'View Details', url: '{{action_url}}' },
+      },
+      sw: {
+        subject: '{{title}}',
+        heading: '{{title}}',
+        paragraphs: ['Habari {{recipient_name}},', '{{message}}'],
+        cta: { label: 'Angalia Maelezo', url: '{{action_url}}' },
+      },
+    },
+  },
+  conversation_message: {
+    description: 'New conversation message, answerable by replying to the email',
+    variables: ['reply_marker', 'subject', 'sender_name', 'message', 'attachments'],
+    optional: ['reply_marker', 'attachments'],
+    sample: {
+      reply_marker: '##- Please type your reply above this line -##', subject: 'Re: Water outage', sender_name: 'John Otieno',
+      message: 'Water will be back by 4pm today.', attachments: [{ title: 'Attachments', lines: ['notice.pdf: https://example.com/notice.pdf'] }],
+    },
+    content: {
+      en: {
+        preheader: '{{reply_marker}}',
+        subject: '{{subject}}',
+        heading: 'New message from {{sender_name}}',
+        paragraphs: ['{{sender_name}} sent you a message:', '{{message}}'],
+        sections: 'attachments',
+        footnote: { text: 'Open the app to see the full conversation.' },
+      },
+      sw: {
+        preheader: '{{reply_marker}}',
+        subject: '{{subject}}',
+        heading: 'Ujumbe mpya kutoka kwa {{sender_name}}',
+        paragraphs: ['{{sender_name}} amekutumia ujumbe:', '{{message}}'],
+        sections: 'attachments',
+        footnote: { text: 'Fungua programu kuona mazungumzo yote.' },
+      },
+    },
+  },
+  scheduled_report: {
+    description: 'Scheduled report delivery with the file attached',
+    variables: ['report_title', 'report_name', 'frequency', 'download_url', 'link_expires_at'],
+    sample: {
+      report_title: 'Rent Roll', report_name: 'Monthly rent roll', frequency: 'monthly',
+      download_url: `${env.appUrl}/reports/sample`, link_expires_at: new Date(),
+    },
+    content: {
+      en: {
+        subject: '{{report_name}}: {{report_title}}',
+        heading: '{{report_title}}',
+        paragraphs: [
+          'The latest "{{report_name}}" report ({{frequency}}) is attached to this email.',
+          'The download link is valid until {{link_expires_at}}.',
+        ],
+        cta: { label: 'Download the Report', url: '{{download_url}}' },
+        footnote: { text: 'You are receiving this because you were added to a scheduled report.' },
+      },
+      sw: {
+        subject: '{{report_name}}: {{report_title}}',
+        heading: '{{report_title}}',
+        paragraphs: [
+          'Ripoti ya karibuni ya "{{report_name}}" ({{frequency}}) imeambatishwa kwenye barua pepe hii.',
+          'Kiungo cha kupakua kinatumika hadi {{link_expires_at}}.',
+        ],
+        cta: { label: 'Pakua Ripoti', url: '{{download_url}}' },
+        footnote: { text: 'Unapokea hii kwa sababu uliongezwa kwenye ripoti iliyopangwa.' },
+      },
+    },
+  },
+  email_digest: {
+    description: 'Daily or weekly summary of unread messages, maintenance, payments and inspections',
+    variables: ['recipient_name', 'period', 'since', 'sections', 'app_url', 'unsubscribe_url'],
+    sample: {
+      recipient_name: 'Grace Njeri', period: 'daily', since: new Date(), app_url: env.appUrl,
+      unsubscribe_url: `${env.apiUrl}/api/v1/digest/unsubscribe/sample`,
+      sections: [{ title: '2 unread messages', lines: ['Water outage: 1 unread', 'Lease renewal: 1 unread'] }],
+    },
+    content: {
+      en: {
+        subject: 'Your {{period}} summary',
+        heading: 'Your {{period}} summary',
+        paragraphs: ['Hi {{recipient_name}},', 'Here is what happened since {{since}}:'],
+        sections: 'sections',
+        cta: { label: 'Open the App', url: '{{app_url}}' },
+        footnote: {
+          text: 'You get this {{period}} summary because you asked for it in your settings.',
+          link: { label: 'Unsubscribe', url: '{{unsubscribe_url}}' },
+        },
+      },
+      sw: {
+        subject: 'Muhtasari wa shughuli zako',
+        heading: 'Muhtasari wa shughuli zako',
+        paragraphs: ['Habari {{recipient_name}},', 'Haya ndiyo yaliyotokea tangu {{since}}:'],
+        sections: 'sections',
+        cta: { label: 'Fungua Programu', url: '{{app_url}}' },
+        footnote: {
+          text: 'Unapokea muhtasari huu kwa sababu uliuomba kwenye mipangilio yako.',
+          link: { label: 'Jiondoe', url: '{{unsubscribe_url}}' },
+        },
+      },
+    },
+  },
+};
+
+const isLocale = (value: unknown): value is EmailLocale => EMAIL_LOCALES.includes(value as EmailLocale);
+
+/**
+ * Built-in transactional email templates with {{variable}} substitution, English and Swahili
+ * wording and a shared layout carrying each company's branding
+ */
+export class EmailTemplatesService {
+  private prisma = getPrisma();
+
+  listTemplates() {
+    return Object.entries(TEMPLATES).map(([key, template]) => ({
+      key,
+      description: template.description,
+      variables: template.variables,
+      locales: EMAIL_LOCALES,
+    }));
+  }
+
+  async getBranding(companyId?: string | null, agencyId?: string | null): Promise<EmailBranding> {
+    const company = companyId
+      ? await this.prisma.company.findUnique({
+          where: { id: companyId },
+          select: { name: true, email: true, phone_number: true, settings: true },
+        })
+      : null;
+    const custom = ((company?.settings as any) || {}).email_branding || {};
+    const agency = await agencyBrandingService.resolve({ agencyId, companyId });
+    const companyName = agency?.agency_name || company?.name || env.email.fromName;
+    return {
+      company_name: companyName,
+      sender_name: agency?.sender_name || custom.sender_name || companyName,
+      logo_url: agency?.logo_url || custom.logo_url || null,
+      primary_color: agency?.primary_color || custom.primary_color || DEFAULT_PRIMARY_COLOR,
+      footer_text: custom.footer_text || null,
+      support_email: agency?.sender_email || custom.support_email || company?.email || null,
+      support_phone: custom.support_phone || company?.phone_number || null,
+      reply_to: agency?.sender_email || null,
+    };
+  }
+
+  async getCompanyBranding(user: JWTClaims, companyId?: string) {
+    return this.getBranding(this.companyFor(user, companyId));
+  }
+
+  async updateBranding(req: Partial<EmailBranding> & { company_id?: string }, user: JWTClaims): Promise<EmailBranding> {
+    if (!BRANDING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to change email branding');
+    }
+    const companyId = this.companyFor(user, req.company_id);
+    const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+    const current = ((company?.settings as any) || {}).email_branding || {};
+    const next = { ...current };
+
+    for (const field of ['sender_name', 'logo_url', 'primary_color', 'footer_text', 'support_email', 'support_phone'] as const) {
+      if (req[field] === undefined) continue;
+      const value = req[field] === null ? null : String(req[field]).trim() || null;
+      next[field] = value;
+    }
+    if (next.logo_url && !/^https:\/\//i.test(next.logo_url)) {
+      throw new Error('logo_url must be an https URL');
+    }
+    if (next.primary_color && !/^#[0-9a-f]{6}$/i.test(next.primary_color)) {
+      throw new Error('primary_color must be a hex colour such as #2563eb');
+    }
+    if (next.sender_name && next.sender_name.length > 100) {
+      throw new Error('sender_name must be at most 100 characters');
+    }
+    if (next.footer_text && next.footer_text.length > 500) {
+      throw new Error('footer_text must be at most 500 characters');
+    }
+
+    await this.prisma.company.update({
+      where: { id: companyId },
+      data: { settings: { ...((company?.settings as any) || {}), email_branding: next }, updated_at: new Date() },
+    });
+    return this.getBranding(companyId);
+  }
+
+  /**
+   * The recipient's preferred language where they have set one, otherwise English
+   */
+  async localeFor(userId?: string | null): Promise<EmailLocale> {
+    if (!userId) return 'en';
+    const prefs = await this.prisma.tenantPreferences.findUnique({ where: { user_id: userId }, select: { language: true } });
+    const language = prefs?.language?.toLowerCase().slice(0, 2);
+    return isLocale(language) ? language : 'en';
+  }
+
+  async render(
+    key: string,
+    variables: Record<string, any>,
+    options: { locale?: EmailLocale; companyId?: string | null; branding?: EmailBranding } = {}
+  ): Promise<RenderedEmail> {
+    const template = TEMPLATES[key];
+    if (!template) {
+      throw new Error(`Email template not found: ${key}`);
+    }
+    const locale = options.locale && isLocale(options.locale) ? options.locale : 'en';
+    const content = template.content[locale];
+    const branding = options.branding || (await this.getBranding(options.companyId));
+    const layout = LAYOUT_TEXT[locale];
+    const dateLocale = locale === 'sw' ? 'sw-KE' : 'en-KE';
+    const optional = new Set(template.optional || []);
+    const missing = new Set<string>();
+
+    const isBlank = (value: unknown) =>
+      value === undefined || value === null || value === '' || (Array.isArray(value) && value.length === 0);
+    const valueOf = (name: string) => {
+      const value = variables[name];
+      if (isBlank(value)) {
+        if (!optional.has(name)) missing.add(name);
+        return '';
+      }
+      if (value instanceof Date) {
+        return value.toLocaleDateString(dateLocale, { year: 'numeric', month: 'long', day: 'numeric' });
+      }
+      if (typeof value === 'number') {
+        return value.toLocaleString(dateLocale, { maximumFractionDigits: 2 });
+      }
+      return String(value);
+    };
+    const fill = (text: string, escape: boolean) =>
+      text.replace(/\{\{\s*(\w+)\s*\}\}/g, (_, name: string) => (escape ? escapeHtmlLines(valueOf(name)) : valueOf(name)));
+    // False when the text uses an optional variable that was left empty
+    const present = (text: string) =>
+      ![...text.matchAll(/\{\{\s*(\w+)\s*\}\}/g)].some(([, name]) => optional.has(name) && isBlank(variables[name]));
+
+    const subject = fill(content.subject, false);
+    const paragraphs = content.paragraphs.filter(present);
+    const ctaUrl = content.cta && present(content.cta.url) ? fill(content.cta.url, false) : '';
+    const color = branding.primary_color;
+    const contact = [branding.support_email, branding.support_phone].filter(Boolean).join(' | ');
+    const details = (content.details || [])
+      .filter(row => present(row.value))
+      .map(row => ({ label: row.label, value: fill(row.value, false).trim() }))
+      .filter(row => row.value);
+    const sections: EmailSection[] = content.sections ? variables[content.sections] || [] : [];
+    if (content.sections && !sections.length && !optional.has(content.sections)) {
+      missing.add(content.sections);
+    }
+    const preheader = content.preheader && present(content.preheader) ? fill(content.preheader, false) : '';
+    const footnote = content.footnote && present(content.footnote.text) ? content.footnote : null;
+    const footnoteUrl = footnote?.link && present(footnote.link.url) ? fill(footnote.link.url, false) : '';
+
+    const html = `<!DOCTYPE html>
+<html lang="${locale}">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <title>${escapeHtml(subject)}</title>
+</head>
+<body style="margin:0;padding:0;background:#f3f4f6;font-family:Arial,sans-serif;line-height:1.6;color:#1f2937;">
+  <div style="max-width:600px;margin:0 auto;padding:24px 12px;">
+    ${preheader ? `<p style="margin:0 0 12px;font-size:12px;color:#9ca3af;">${escapeHtml(preheader)}</p>` : ''}
+    <div style="background:${color};color:#ffffff;padding:24px;text-align:center;border-radius:8px 8px 0 0;">
+      ${branding.logo_url
+        ? `<img src="${escapeHtml(branding.logo_url)}" alt="${escapeHtml(branding.company_name)}" style="max-height:48px;max-width:200px;">`
+        : `<div style="font-size:20px;font-weight:bold;">${escapeHtml(branding.company_name)}</div>`}
+    </div>
+    <div style="background:#ffffff;padding:30px 24px;">
+      <h2 style="margin-top:0;color:${color};">${fill(content.heading, true)}</h2>
+      ${paragraphs.map(p => `<p>${fill(p, true)}</p>`).join('\n      ')}
+      ${sections
+        .map(section => `<div style="background:#f9fafb;padding:16px 20px;border-radius:8px;margin:16px 0;"><p style="margin:0 0 8px;font-weight:bold;">${escapeHtml(section.title)}</p><ul style="margin:0;padding-left:20px;">${section.lines.map(line => `<li>${escapeHtml(line)}</li>`).join('')}</ul></div>`)
+        .join('\n      ')}
+      ${details.length
+        ? `<table style="width:100%;border-collapse:collapse;margin:20px 0;">${details
+            .map(row => `<tr><td style="padding:8px;border-bottom:1px solid #e5e7eb;color:#6b7280;">${escapeHtml(row.label)}</td><td style="padding:8px;border-bottom:1px solid #e5e7eb;font-weight:bold;">${escapeHtml(row.value)}</td></tr>`)
+            .join('')}</table>`
+        : ''}
+      ${content.cta && ctaUrl
+        ? `<div style="text-align:center;margin:24px 0;"><a href="${escapeHtml(ctaUrl)}" style="display:inline-block;background:${color};color:#ffffff;padding:12px 30px;text-decoration:none;border-radius:5px;">${escapeHtml(content.cta.label)}</a></div>
+      <p style="font-size:13px;color:#6b7280;">${layout.linkHint}<br><span style="word-break:break-all;">${escapeHtml(ctaUrl)}</span></p>`
+        : ''}
+      ${footnote
+        ? `<p style="font-size:13px;color:#6b7280;">${fill(footnote.text, true)}${footnote.link && footnoteUrl ? ` <a href="${escapeHtml(footnoteUrl)}" style="color:#6b7280;">${escapeHtml(footnote.link.label)}</a>` : ''}</p>`
+        : ''}
+      <p>${layout.signOff}<br>${escapeHtml(branding.company_name)}</p>
+    </div>
+    <div style="background:#f8f9fa;padding:20px;text-align:center;font-size:13px;color:#6b7280;border-radius:0 0 8px 8px;">
+      ${branding.footer_text ? `<p>${escapeHtml(branding.footer_text)}</p>` : ''}
+      ${contact ? `<p>${layout.contact} ${escapeHtml(contact)}</p>` : ''}
+      <p>&copy; ${new Date().getFullYear()} ${escapeHtml(branding.company_name)}</p>
+      <p>${layout.automated}</p>
+    </div>
+  </div>
+</body>
+</html>`;
+
+    const text = [
+      ...(preheader ? [preheader, ''] : []),
+      fill(content.heading, false),
+      '',
+      ...paragraphs.map(p => fill(p, false)),
+      ...sections.flatMap(section => ['', section.title, ...section.lines.map(line => `- ${line}`)]),
+      ...(details.length ? ['', ...details.map(row => `${row.label}: ${row.value}`)] : []),
+      ...(content.cta && ctaUrl ? ['', `${content.cta.label}: ${ctaUrl}`] : []),
+      ...(footnote ? ['', `${fill(footnote.text, false)}${footnote.link && footnoteUrl ? ` ${footnote.link.label}: ${footnoteUrl}` : ''}`] : []),
+      '',
+      layout.signOff,
+      branding.company_name,
+      ...(branding.footer_text ? ['', branding.footer_text] : []),
+      ...(contact ? [`${layout.contact} ${contact}`] : []),
+    ].join('\n');
+
+    return { template: key, locale, subject, html, text, missing_variables: [...missing] };
+  }
+
+  /**
+   * Render a template in the recipient's language with their company's branding and send it
+   */
+  async send(
+    key: string,
+    options: {
+      to: string | string[];
+      variables: Record<string, any>;
+      recipientId?: string | null;
+      companyId?: string | null;
+      agencyId?: string | null;
+      locale?: EmailLocale;
+      subjectPrefix?: string;
+      // Overrides the agency's reply address, e.g. a conversation's reply-by-email address
+      replyTo?: { email: string; name: string };
+      headers?: Record<string, string>;
+      attachments?: EmailAttachment[];
+      // Tracking type when it differs from the template, e.g. the notification type
+      type?: string;
+    }
+  ): Promise<EmailResult> {
+    const branding = await this.getBranding(options.companyId, options.agencyId);
+    const locale = options.locale || (await this.localeFor(options.recipientId));
+    const rendered = await this.render(key, options.variables, { locale, branding });
+    if (rendered.missing_variables.length) {
+      console.warn(`⚠️ Email template ${key} rendered without: ${rendered.missing_variables.join(', ')}`);
+    }
+    return emailService.sendEmail({
+      to: options.to,
+      from: { email: env.email.fromAddress, name: branding.sender_name },
+      // Mail goes out from the platform address; replies reach the agency
+      ...(branding.reply_to && { replyTo: { email: branding.reply_to, name: branding.sender_name } }),
+      ...(options.replyTo && { replyTo: options.replyTo }),
+      subject: `${options.subjectPrefix || ''}${rendered.subject}`,
+      html: rendered.html,
+      text: rendered.text,
+      ...(options.headers && { headers: options.headers }),
+      ...(options.attachments && { attachments: options.attachments }),
+      type: options.type || key,
+    });
+  }
+
+  /**
+   * Render with the template's sample values, overridden by any supplied
+   */
+  async preview(key: string, req: { locale?: string; variables?: Record<string, any>; company_id?: string }, user: JWTClaims) {
+    const template = TEMPLATES[key];
+    if (!template) {
+      throw new Error(`Email template not found: ${key}`);
+    }
+    if (req.locale && !isLocale(req.locale)) {
+      throw new Error(`locale must be one of: ${EMAIL_LOCALES.join(', ')}`);
+    }
+    return this.render(key, { ...template.sample, ...(req.variables || {}) }, {
+      locale: req.locale as EmailLocale | undefined,
+      companyId: user.role === 'super_admin' ? req.company_id || user.company_id : user.company_id,
+    });
+  }
+
+  async testSend(key: string, req: { to?: string; locale?: string; variables?: Record<string, any>; company_id?: string }, user: JWTClaims) {
+    if (!BRANDING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to send test emails');
+    }
+    const template = TEMPLATES[key];
+    if (!template) {
+      throw new Error(`Email template not found: ${key}`);
+    }
+    if (req.locale && !isLocale(req.locale)) {
+      throw new Error(`locale must be one of: ${EMAIL_LOCALES.join(', ')}`);
+    }
+    const to = req.to || user.email;
+    if (!to) {
+      throw new Error('to is required');
+    }
+    const result = await this.send(key, {
+      to,
+      variables: { ...template.sample, ...(req.variables || {}) },
+      companyId: this.companyFor(user, req.company_id),
+      locale: (req.locale as EmailLocale | undefined) || 'en',
+      subjectPrefix: '[TEST] ',
+    });
+    if (!result.success) {
+      throw new Error(result.error || 'Failed to send email');
+    }
+    return { to, template: key, message_id: result.messageId };
+  }
+
+  private companyFor(user: JWTClaims, requested?: string): string {
+    const companyId = user.role === 'super_admin' && requested ? requested : user.company_id;
+    if (!companyId) {
+      throw new Error('User must be associated with a company');
+    }
+    return companyId;
+  }
+}
+
+export const emailTemplatesService = new EmailTemplatesService();
@@ -16,6 +16,11 @@ export interface EmailOptions {
   html?: string;
   text?: string;
   attachments?: EmailAttachment[];
+  replyTo?: {
+    email: string;
+    name?: string;
+  };
+  headers?: Record<string, string>; // Extra headers, e.g. List-Unsubscribe
   type?: string; // Email type for tracking/categorization
 }
 
@@ -906,6 +911,14 @@ export class BrevoProvider implements EmailProvider {
         };
       }
 
+      if (options.replyTo) {
+        sendSmtpEmail.replyTo = options.replyTo;
+      }
+
+      if (options.headers) {
+        sendSmtpEmail.headers = options.headers;
+      }
+
       // Set content
       sendSmtpEmail.subject = options.subject;
       if (options.html) {
@@ -0,0 +1,513 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { distanceInMeters } from './task-location.service.js';
+
+export interface ReportEmergencyRequest {
+  property_id?: string;
+  unit_id?: string;
+  emergency_type: string;
+  description: string;
+  latitude?: number;
+  longitude?: number;
+  maintenance_request_id?: string;
+}
+
+export interface EmergencySettings {
+  ack_minutes: number;
+  nearby_radius_km: number;
+}
+
+interface Recipient {
+  user_id?: string;
+  contact_id?: string;
+  name?: string | null;
+  phone?: string | null;
+  reason: string;
+}
+
+export const EMERGENCY_TYPES = ['fire', 'flood', 'gas_leak', 'electrical', 'security', 'medical', 'structural', 'other'];
+const MAX_ESCALATION_LEVEL = 2;
+const STAFF_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent', 'caretaker', 'security', 'maintenance'];
+const MANAGER_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+// A caretaker counts as nearby when their last task location in this window was close to the property
+const NEARBY_WINDOW_HOURS = 2;
+
+// Used until a company saves its own values under settings.emergency_escalation
+export const DEFAULT_EMERGENCY_SETTINGS: EmergencySettings = {
+  ack_minutes: 10,
+  nearby_radius_km: 5,
+};
+
+/**
+ * Emergency reports and their escalation: level 0 alerts the landlord, agency admins and the
+ * property's own and nearby caretakers; if nobody acknowledges within ack_minutes it goes to
+ * all field staff (level 1) and then to the company's external emergency contacts (level 2).
+ */
+export class EmergencyService {
+  private prisma = getPrisma();
+
+  async getSettings(companyId: string): Promise<EmergencySettings> {
+    const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+    return { ...DEFAULT_EMERGENCY_SETTINGS, ...(((company?.settings as any) || {}).emergency_escalation || {}) };
+  }
+
+  async getEscalationSettings(user: JWTClaims): Promise<EmergencySettings> {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    return this.getSettings(user.company_id);
+  }
+
+  async updateEscalationSettings(req: Partial<EmergencySettings>, user: JWTClaims): Promise<EmergencySettings> {
+    if (!MANAGER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to change emergency escalation settings');
+    }
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    const current = await this.getSettings(user.company_id);
+    const next = { ...current, ...req };
+    next.ack_minutes = Number(next.ack_minutes);
+    next.nearby_radius_km = Number(next.nearby_radius_km);
+    if (!(next.ack_minutes >= 1 && next.ack_minutes <= 120)) {
+      throw new Error('ack_minutes must be between 1 and 120');
+    }
+    if (!(next.nearby_radius_km > 0 && next.nearby_radius_km <= 50)) {
+      throw new Error('nearby_radius_km must be between 0 and 50');
+    }
+
+    const company = await this.prisma.company.findUnique({ where: { id: user.company_id }, select: { settings: true } });
+    await this.prisma.company.update({
+      where: { id: user.company_id },
+      data: {
+        settings: {
+          ...((company?.settings as any) || {}),
+          emergency_escalation: { ack_minutes: next.ack_minutes, nearby_radius_km: next.nearby_radius_km },
+        },
+        updated_at: new Date(),
+      },
+    });
+    return { ack_minutes: next.ack_minutes, nearby_radius_km: next.nearby_radius_km };
+  }
+
+  /**
+   * Store an emergency and alert the first responders straight away. Tenants report for
+   * the unit they live in; staff for any property in their company.
+   */
+  async reportEmergency(req: ReportEmergencyRequest, user: JWTClaims) {
+    if (!req.emergency_type || !req.description) {
+      throw new Error('emergency_type and description are required');
+    }
+    if (!EMERGENCY_TYPES.includes(req.emergency_type)) {
+      throw new Error(`emergency_type must be one of: ${EMERGENCY_TYPES.join(', ')}`);
+    }
+
+    let propertyId = req.property_id;
+    let unitId = req.unit_id;
+    if (user.role === 'tenant') {
+      const profile = await this.prisma.tenantProfile.findUnique({
+        where: { user_id: user.user_id },
+        select: { current_property_id: true, current_unit_id: true },
+      });
+      if (!profile?.current_property_id) {
+        throw new Error('no active tenancy found to report an emergency for');
+      }
+      propertyId = profile.current_property_id;
+      unitId = profile.current_unit_id || undefined;
+    } else if (!STAFF_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to report emergencies');
+    }
+    if (!propertyId) {
+      throw new Error('property_id is required');
+    }
+
+    const property = await this.prisma.property.findFirst({
+      where: { id: propertyId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, company_id: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+    if (unitId) {
+      const unit = await this.prisma.unit.findFirst({ where: { id: unitId, property_id: property.id }, select: { id: true } });
+      if (!unit) {
+        throw new Error('unit not found in this property');
+      }
+    }
+    if (req.maintenance_request_id) {
+      const request = await this.prisma.maintenanceRequest.findFirst({
+        where: { id: req.maintenance_request_id, company_id: property.company_id, ...(user.role === 'tenant' && { requested_by: user.user_id }) },
+        select: { id: true },
+      });
+      if (!request) {
+        throw new Error('maintenance request not found');
+      }
+    }
+
+    const alert = await this.prisma.emergencyAlert.create({
+      data: {
+        company_id: property.company_id,
+        property_id: property.id,
+        unit_id: unitId || null,
+        reported_by: user.user_id,
+        emergency_type: req.emergency_type,
+        description: req.description,
+        latitude: req.latitude ?? null,
+        longitude: req.longitude ?? null,
+        maintenance_request_id: req.maintenance_request_id || null,
+      },
+    });
+
+    const notified = await this.sendEmergencyNotifications(alert.id, 0);
+    return { ...alert, last_notified_at: new Date(), recipients_notified: notified };
+  }
+
+  /**
+   * Alert everyone due at the given escalation level over in-app, push and SMS, recording
+   * each recipient so acknowledgements can be tracked. Returns how many were notified.
+   */
+  async sendEmergencyNotifications(alertId: string, level: number): Promise<number> {
+    const alert = await this.prisma.emergencyAlert.findUnique({
+      where: { id: alertId },
+      include: { recipients: { select: { user_id: true, contact_id: true } } },
+    });
+    if (!alert) {
+      throw new Error('emergency not found');
+    }
+
+    const [property, unit, reporter] = await Promise.all([
+      this.prisma.property.findUnique({
+        where: { id: alert.property_id },
+        select: { name: true, owner_id: true, latitude: true, longitude: true },
+      }),
+      alert.unit_id
+        ? this.prisma.unit.findUnique({ where: { id: alert.unit_id }, select: { unit_number: true } })
+        : Promise.resolve(null),
+      this.prisma.user.findUnique({ where: { id: alert.reported_by }, select: { first_name: true, last_name: true, phone_number: true } }),
+    ]);
+    const location = `${property?.name || 'property'}${unit ? `, Unit ${unit.unit_number}` : ''}`;
+    const type = alert.emergency_type.replace(/_/g, ' ');
+
+    const recipients = await this.recipientsFor(alert, level, property);
+    const already = new Set(alert.recipients.map(r => r.user_id || r.contact_id));
+    // Escalations re-alert earlier recipients who have not acknowledged, but never the reporter
+    const targets = recipients.filter(r => (r.user_id || r.contact_id) !== alert.reported_by
+      && (level > 0 || !already.has(r.user_id || r.contact_id || '')));
+
+    const title = level === 0 ? `🚨 Emergency: ${type} at ${location}` : `🚨 Unacknowledged emergency (level ${level}): ${type} at ${location}`;
+    const message = `${alert.description}${reporter ? ` — reported by ${reporter.first_name} ${reporter.last_name}${reporter.phone_number ? ` (${reporter.phone_number})` : ''}` : ''}`;
+
+    // The property topic reaches every device of its assigned staff at once; direct sends share the tag
+    if (level === 0) {
+      const { pushNotificationService } = await import('./push-notification.service.js');
+      await pushNotificationService.sendToProperty(alert.property_id, {
+        title,
+        body: message,
+        notificationType: 'emergency',
+        category: 'emergency',
+        priority: 'high',
+        data: { emergency_alert_id: alert.id, escalation_level: '0' },
+        actionUrl: `/emergencies/${alert.id}`,
+        tag: `emergency-${alert.id}`,
+      });
+    }
+
+    let notified = 0;
+    for (const recipient of targets) {
+      const channels: string[] = [];
+      try {
+        if (recipient.user_id) {
+          // Push and SMS to users go through the delivery queue, so they are retried and logged
+          const { notificationsService } = await import('./notifications.service.js');
+          const queued = await notificationsService.resolveChannels(
+            recipient.user_id,
+            'emergency',
+            ['push', ...(recipient.phone ? ['sms'] : [])],
+            'emergency',
+            'urgent'
+          );
+          await notificationsService.notify({
+            company_id: alert.company_id,
+            recipient_id: recipient.user_id,
+            title,
+            message,
+            notification_type: 'emergency',
+            category: 'emergency',
+            priority: 'urgent',
+            property_id: alert.property_id,
+            unit_id: alert.unit_id,
+            related_entity_type: 'emergency_alert',
+            related_entity_id: alert.id,
+            action_required: true,
+            action_url: `/emergencies/${alert.id}`,
+            metadata: { emergency_alert_id: alert.id, escalation_level: String(level), reason: recipient.reason },
+          }, queued);
+          channels.push('app', ...queued);
+        } else if (recipient.phone) {
+          // Emergency contacts without an account are texted directly
+          const { smsService } = await import('./sms.service.js');
+          const sms = await smsService.sendSms({
+            to: recipient.phone,
+            body: `${title.replace('🚨 ', '')}. ${message}`,
+            companyId: alert.company_id,
+            recipientId: null,
+            type: 'emergency',
+          });
+          if (sms.success) channels.push('sms');
+        }
+
+        await this.prisma.emergencyAlertRecipient.create({
+          data: {
+            alert_id: alert.id,
+            user_id: recipient.user_id || null,
+            contact_id: recipient.contact_id || null,
+            name: recipient.name || null,
+            phone: recipient.phone || null,
+            reason: recipient.reason,
+            escalation_level: level,
+            channels,
+          },
+        });
+        notified++;
+      } catch (error: any) {
+        console.error(`⚠️ Failed to send emergency alert to ${recipient.user_id || recipient.contact_id}:`, error.message);
+      }
+    }
+
+    await this.prisma.emergencyAlert.update({
+      where: { id: alert.id },
+      data: { escalation_level: level, last_notified_at: new Date(), updated_at: new Date() },
+    });
+    return notified;
+  }
+
+  async acknowledgeEmergency(alertId: string, user: JWTClaims) {
+    const alert = await this.findAlert(alertId, user);
+    if (alert.status === 'resolved') {
+      throw new Error('emergency is already resolved');
+    }
+    const now = new Date();
+    await this.prisma.emergencyAlertRecipient.updateMany({
+      where: { alert_id: alert.id, user_id: user.user_id, acknowledged_at: null },
+      data: { acknowledged_at: now },
+    });
+    if (alert.status === 'acknowledged') {
+      return alert;
+    }
+    const updated = await this.prisma.emergencyAlert.update({
+      where: { id: alert.id },
+      data: { status: 'acknowledged', acknowledged_by: user.user_id, acknowledged_at: now, updated_at: now },
+    });
+
+    const responder = await this.prisma.user.findUnique({ where: { id: user.user_id }, select: { first_name: true, last_name: true } });
+    await this.notifyReporter(alert, 'Your emergency report has been acknowledged',
+      `${responder?.first_name || 'A'} ${responder?.last_name || 'responder'} is handling it.`);
+    return updated;
+  }
+
+  async resolveEmergency(alertId: string, req: { resolution_notes?: string }, user: JWTClaims) {
+    if (!['super_admin', 'agency_admin', 'landlord', 'agent', 'caretaker'].includes(user.role)) {
+      throw new Error('insufficient permissions to resolve emergencies');
+    }
+    const alert = await this.findAlert(alertId, user);
+    if (alert.status === 'resolved') {
+      throw new Error('emergency is already resolved');
+    }
+    const now = new Date();
+    const updated = await this.prisma.emergencyAlert.update({
+      where: { id: alert.id },
+      data: {
+        status: 'resolved',
+        resolved_by: user.user_id,
+        resolved_at: now,
+        resolution_notes: req.resolution_notes || null,
+        ...(!alert.acknowledged_at && { acknowledged_by: user.user_id, acknowledged_at: now }),
+        updated_at: now,
+      },
+    });
+    await this.notifyReporter(alert, 'Emergency resolved', req.resolution_notes || 'The emergency you reported has been marked as resolved.');
+    return updated;
+  }
+
+  async getEmergency(alertId: string, user: JWTClaims) {
+    const alert = await this.findAlert(alertId, user);
+    const recipients = await this.prisma.emergencyAlertRecipient.findMany({
+      where: { alert_id: alert.id },
+      orderBy: [{ escalation_level: 'asc' }, { notified_at: 'asc' }],
+    });
+    return { ...alert, recipients };
+  }
+
+  async listEmergencies(filters: { status?: string; property_id?: string; page?: string; limit?: string }, user: JWTClaims) {
+    const limit = Math.min(parseInt(filters.limit || '20', 10) || 20, 100);
+    const page = Math.max(parseInt(filters.page || '1', 10) || 1, 1);
+    const where: any = {
+      ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+      ...(user.role === 'tenant' && { reported_by: user.user_id }),
+      ...(filters.status && { status: filters.status }),
+      ...(filters.property_id && { property_id: filters.property_id }),
+    };
+    const [alerts, total] = await Promise.all([
+      this.prisma.emergencyAlert.findMany({
+        where,
+        orderBy: { created_at: 'desc' },
+        skip: (page - 1) * limit,
+        take: limit,
+      }),
+      this.prisma.emergencyAlert.count({ where }),
+    ]);
+    return { alerts, total, page, limit };
+  }
+
+  /**
+   * Escalate open emergencies nobody has acknowledged within the company's ack_minutes
+   */
+  async escalateUnacknowledged(): Promise<number> {
+    const open = await this.prisma.emergencyAlert.findMany({
+      where: { status: 'open', escalation_level: { lt: MAX_ESCALATION_LEVEL } },
+      select: { id: true, company_id: true, escalation_level: true, last_notified_at: true, created_at: true },
+    });
+    let escalated = 0;
+    const settingsCache = new Map<string, EmergencySettings>();
+    for (const alert of open) {
+      if (!settingsCache.has(alert.company_id)) {
+        settingsCache.set(alert.company_id, await this.getSettings(alert.company_id));
+      }
+      const { ack_minutes } = settingsCache.get(alert.company_id)!;
+      const since = (alert.last_notified_at || alert.created_at).getTime();
+      if (Date.now() - since < ack_minutes * 60 * 1000) continue;
+      try {
+        await this.sendEmergencyNotifications(alert.id, alert.escalation_level + 1);
+        escalated++;
+      } catch (error: any) {
+        console.error(`⚠️ Failed to escalate emergency ${alert.id}:`, error.message);
+      }
+    }
+    return escalated;
+  }
+
+  private async recipientsFor(
+    alert: { id: string; company_id: string; property_id: string; emergency_type: string },
+    level: number,
+    property: { owner_id: string; latitude: any; longitude: any } | null
+  ): Promise<Recipient[]> {
+    const recipients: Recipient[] = [];
+    const seen = new Set<string>();
+    const add = (recipient: Recipient) => {
+      const key = recipient.user_id || recipient.contact_id!;
+      if (seen.has(key)) return;
+      seen.add(key);
+      recipients.push(recipient);
+    };
+    const userFields = { id: true, first_name: true, last_name: true, phone_number: true } as const;
+    const toRecipient = (u: { id: string; first_name: string; last_name: string; phone_number: string | null }, reason: string) =>
+      ({ user_id: u.id, name: `${u.first_name} ${u.last_name}`, phone: u.phone_number, reason });
+
+    if (property) {
+      const owner = await this.prisma.user.findUnique({ where: { id: property.owner_id }, select: userFields });
+      if (owner) add(toRecipient(owner, 'landlord'));
+    }
+    const admins = await this.prisma.user.findMany({
+      where: { company_id: alert.company_id, role: 'agency_admin' as any, status: 'active' as any },
+      select: userFields,
+    });
+    admins.forEach(admin => add(toRecipient(admin, 'agency_admin')));
+
+    const assigned = await this.prisma.staffPropertyAssignment.findMany({
+      where: { property_id: alert.property_id, status: 'active', staff: { role: 'caretaker' as any, status: 'active' as any } },
+      select: { staff: { select: userFields } },
+    });
+    assigned.forEach(a => add(toRecipient(a.staff, 'property_caretaker')));
+
+    if (property?.latitude != null && property?.longitude != null) {
+      const { nearby_radius_km } = await this.getSettings(alert.company_id);
+      const recent = await this.prisma.taskLocationEvent.findMany({
+        where: { company_id: alert.company_id, recorded_at: { gte: new Date(Date.now() - NEARBY_WINDOW_HOURS * 60 * 60 * 1000) } },
+        orderBy: { recorded_at: 'desc' },
+        select: { user_id: true, latitude: true, longitude: true },
+      });
+      const latest = new Map<string, { latitude: any; longitude: any }>();
+      recent.forEach(event => { if (!latest.has(event.user_id)) latest.set(event.user_id, event); });
+      const nearbyIds = [...latest.entries()]
+        .filter(([, at]) => distanceInMeters(Number(at.latitude), Number(at.longitude), Number(property.latitude), Number(property.longitude)) <= nearby_radius_km * 1000)
+        .map(([userId]) => userId);
+      if (nearbyIds.length) {
+        const nearby = await this.prisma.user.findMany({
+          where: { id: { in: nearbyIds }, role: 'caretaker' as any, status: 'active' as any },
+          select: userFields,
+        });
+        nearby.forEach(caretaker => add(toRecipient(caretaker, 'nearby_caretaker')));
+      }
+    }
+
+    if (level >= 1) {
+      const staff = await this.prisma.user.findMany({
+        where: { company_id: alert.company_id, role: { in: ['caretaker', 'agent', 'security', 'maintenance'] as any }, status: 'active' as any },
+        select: userFields,
+      });
+      staff.forEach(member => add(toRecipient(member, 'staff')));
+    }
+
+    if (level >= 2) {
+      const contacts = await this.prisma.emergencyContact.findMany({
+        where: {
+          company_id: alert.company_id,
+          OR: [{ property_ids: { has: alert.property_id } }, { property_ids: { isEmpty: true } }],
+        },
+      });
+      const type = alert.emergency_type.replace(/_/g, ' ');
+      contacts
+        .filter(c => c.specialties.length === 0 || c.specialties.some(s => s.toLowerCase().includes(type) || type.includes(s.toLowerCase())))
+        .sort((a, b) => Number(b.available24_7) - Number(a.available24_7))
+        .forEach(contact => add({ contact_id: contact.id, name: contact.name, phone: contact.phone, reason: 'emergency_contact' }));
+    }
+
+    // Escalations skip anyone who has already acknowledged
+    if (level > 0) {
+      const acknowledged = await this.prisma.emergencyAlertRecipient.findMany({
+        where: { alert_id: alert.id, acknowledged_at: { not: null } },
+        select: { user_id: true },
+      });
+      const ackIds = new Set(acknowledged.map(a => a.user_id));
+      return recipients.filter(r => !r.user_id || !ackIds.has(r.user_id));
+    }
+    return recipients;
+  }
+
+  private async findAlert(alertId: string, user: JWTClaims) {
+    const alert = await this.prisma.emergencyAlert.findFirst({
+      where: {
+        id: alertId,
+        ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+        ...(user.role === 'tenant' && { reported_by: user.user_id }),
+      },
+    });
+    if (!alert) {
+      throw new Error('emergency not found');
+    }
+    return alert;
+  }
+
+  private async notifyReporter(alert: { id: string; company_id: string; reported_by: string; property_id: string; unit_id: string | null }, title: string, message: string) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: alert.company_id,
+        recipient_id: alert.reported_by,
+        title,
+        message,
+        notification_type: 'emergency',
+        category: 'emergency',
+        priority: 'high',
+        property_id: alert.property_id,
+        unit_id: alert.unit_id,
+        related_entity_type: 'emergency_alert',
+        related_entity_id: alert.id,
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify emergency reporter:', error.message);
+    }
+  }
+}
+
+export const emergencyService = new EmergencyService();
@@ -0,0 +1,357 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+import { advanceDueDate } from './preventive-maintenance.service.js';
+
+export interface ExpenseRequest {
+  property_id?: string | null;
+  vendor_id?: string | null;
+  category?: string;
+  description?: string;
+  amount?: number | string;
+  currency?: string;
+  expense_date?: string;
+  payment_method?: string | null;
+  reference?: string | null;
+  recurrence?: string;
+  recurrence_end_date?: string | null;
+  notes?: string | null;
+}
+
+export interface ExpenseFilters {
+  property_id?: string;
+  property_ids?: string[];
+  vendor_id?: string;
+  category?: string;
+  start_date?: string;
+  end_date?: string;
+  page?: number;
+  limit?: number;
+}
+
+interface UploadedReceipt {
+  buffer: Buffer;
+  originalname: string;
+  mimetype: string;
+}
+
+export const EXPENSE_CATEGORIES = [
+  'maintenance', 'repairs', 'utilities', 'cleaning', 'security', 'insurance', 'property_tax',
+  'management_fee', 'legal', 'marketing', 'landscaping', 'supplies', 'other',
+];
+export const EXPENSE_RECURRENCES = ['none', 'weekly', 'monthly', 'quarterly', 'yearly'];
+const RECEIPT_MIME_PREFIXES = ['image/', 'application/pdf'];
+
+const expenseInclude = {
+  property: { select: { id: true, name: true } },
+  vendor: { select: { id: true, name: true } },
+  creator: { select: { id: true, first_name: true, last_name: true } },
+};
+
+/**
+ * Date of the copy after `from`; quarterly is recorded as every third month
+ */
+const nextOccurrence = (from: Date, recurrence: string) =>
+  recurrence === 'quarterly' ? advanceDueDate(from, 'monthly', 3) : advanceDueDate(from, recurrence, 1);
+
+/**
+ * Operating expenses recorded against a property or the company as a whole. A recurring expense
+ * is recorded once and copied on its schedule; the copies link back to it.
+ */
+export class ExpensesService {
+  private prisma = getPrisma();
+
+  private scopeWhere(user: JWTClaims) {
+    return user.role === 'super_admin' ? {} : { company_id: user.company_id };
+  }
+
+  private async getScoped(id: string, user: JWTClaims) {
+    const expense = await this.prisma.expense.findFirst({ where: { id, ...this.scopeWhere(user) } });
+    if (!expense) {
+      throw new Error('Expense not found');
+    }
+    return expense;
+  }
+
+  /**
+   * Validate the fields that are present and check property and vendor belong to the company
+   */
+  private async buildData(req: ExpenseRequest, companyId: string, user: JWTClaims) {
+    if (req.category !== undefined && !EXPENSE_CATEGORIES.includes(req.category)) {
+      throw new Error(`category must be one of: ${EXPENSE_CATEGORIES.join(', ')}`);
+    }
+    if (req.recurrence !== undefined && !EXPENSE_RECURRENCES.includes(req.recurrence)) {
+      throw new Error(`recurrence must be one of: ${EXPENSE_RECURRENCES.join(', ')}`);
+    }
+    if (req.description !== undefined && !String(req.description).trim()) {
+      throw new Error('description must not be empty');
+    }
+    const amount = req.amount !== undefined ? Number(req.amount) : undefined;
+    if (amount !== undefined && (!Number.isFinite(amount) || amount <= 0)) {
+      throw new Error('amount must be a positive number');
+    }
+    const dates: Record<string, Date | null | undefined> = {};
+    for (const field of ['expense_date', 'recurrence_end_date'] as const) {
+      const value = req[field];
+      if (value === undefined) continue;
+      if (value === null || value === '') {
+        if (field === 'expense_date') throw new Error('expense_date must be a valid date');
+        dates[field] = null;
+        continue;
+      }
+      const date = new Date(value);
+      if (isNaN(date.getTime())) {
+        throw new Error(`${field} must be a valid date`);
+      }
+      dates[field] = date;
+    }
+
+    if (req.property_id) {
+      const property = await this.prisma.property.findFirst({
+        where: { id: req.property_id, company_id: companyId, ...(user.role !== 'super_admin' && buildWhereClause(user)) },
+        select: { id: true },
+      });
+      if (!property) throw new Error('Property not found');
+    }
+    if (req.vendor_id) {
+      const vendor = await this.prisma.vendor.findFirst({ where: { id: req.vendor_id, company_id: companyId }, select: { id: true } });
+      if (!vendor) throw new Error('Vendor not found');
+    }
+
+    return {
+      ...(req.property_id !== undefined && { property_id: req.property_id || null }),
+      ...(req.vendor_id !== undefined && { vendor_id: req.vendor_id || null }),
+      ...(req.category !== undefined && { category: req.category }),
+      ...(req.description !== undefined && { description: String(req.description).trim() }),
+      ...(amount !== undefined && { amount }),
+      ...(req.currency !== undefined && { currency: String(req.currency).toUpperCase() }),
+      ...(dates.expense_date && { expense_date: dates.expense_date }),
+      ...(req.payment_method !== undefined && { payment_method: req.payment_method || null }),
+      ...(req.reference !== undefined && { reference: req.reference || null }),
+      ...(req.recurrence !== undefined && { recurrence: req.recurrence }),
+      ...(dates.recurrence_end_date !== undefined && { recurrence_end_date: dates.recurrence_end_date }),
+      ...(req.notes !== undefined && { notes: req.notes || null }),
+    };
+  }
+
+  async list(filters: ExpenseFilters, user: JWTClaims) {
+    const page = Math.max(Number(filters.page) || 1, 1);
+    const limit = Math.min(Math.max(Number(filters.limit) || 20, 1), 100);
+    const where: any = { ...this.scopeWhere(user), ...this.filterWhere(filters) };
+
+    const [expenses, total, sum] = await Promise.all([
+      this.prisma.expense.findMany({
+        where,
+        include: expenseInclude,
+        orderBy: [{ expense_date: 'desc' }, { created_at: 'desc' }],
+        skip: (page - 1) * limit,
+        take: limit,
+      }),
+      this.prisma.expense.count({ where }),
+      this.prisma.expense.aggregate({ where, _sum: { amount: true } }),
+    ]);
+    return {
+      expenses,
+      total,
+      total_amount: Number(sum._sum.amount || 0),
+      page,
+      limit,
+      totalPages: Math.ceil(total / limit),
+    };
+  }
+
+  async get(id: string, user: JWTClaims) {
+    const expense = await this.prisma.expense.findFirst({
+      where: { id, ...this.scopeWhere(user) },
+      include: { ...expenseInclude, parent_expense: { select: { id: true, description: true, recurrence: true } } },
+    });
+    if (!expense) {
+      throw new Error('Expense not found');
+    }
+    return expense;
+  }
+
+  async create(req: ExpenseRequest, user: JWTClaims, receipt?: UploadedReceipt) {
+    if (!user.company_id) {
+      throw new Error('insufficient permissions: expenses are recorded against a company');
+    }
+    if (!req.category || !req.description || req.amount === undefined || !req.expense_date) {
+      throw new Error('category, description, amount and expense_date are required');
+    }
+    const data = await this.buildData(req, user.company_id, user);
+    const recurrence = data.recurrence || 'none';
+
+    const expense = await this.prisma.expense.create({
+      data: {
+        ...data,
+        category: data.category!,
+        description: data.description!,
+        amount: data.amount!,
+        expense_date: data.expense_date!,
+        recurrence,
+        next_occurrence_date: recurrence !== 'none' ? nextOccurrence(data.expense_date!, recurrence) : null,
+        company_id: user.company_id,
+        created_by: user.user_id,
+      },
+    });
+    if (receipt) {
+      await this.attachReceipt(expense.id, receipt);
+    }
+    return this.get(expense.id, user);
+  }
+
+  async update(id: string, req: ExpenseRequest, user: JWTClaims) {
+    const expense = await this.getScoped(id, user);
+    const data = await this.buildData(req, expense.company_id, user);
+
+    // Changing the schedule restarts it from the expense's own date
+    const recurrence = data.recurrence ?? expense.recurrence;
+    const retime = data.recurrence !== undefined || data.expense_date !== undefined;
+    await this.prisma.expense.update({
+      where: { id },
+      data: {
+        ...data,
+        ...(retime && {
+          next_occurrence_date: recurrence !== 'none' ? this.nextAfterToday(data.expense_date || expense.expense_date, recurrence) : null,
+        }),
+        updated_at: new Date(),
+      },
+    });
+    return this.get(id, user);
+  }
+
+  async delete(id: string, user: JWTClaims) {
+    const expense = await this.getScoped(id, user);
+    await this.prisma.expense.delete({ where: { id } });
+    if (expense.receipt_file_id) {
+      const { imagekitService } = await import('./imagekit.service.js');
+      await imagekitService.deleteFile(expense.receipt_file_id).catch(() => undefined);
+    }
+  }
+
+  async uploadReceipt(id: string, receipt: UploadedReceipt | undefined, user: JWTClaims) {
+    if (!receipt) {
+      throw new Error('receipt file is required');
+    }
+    const expense = await this.getScoped(id, user);
+    await this.attachReceipt(expense.id, receipt, expense.receipt_file_id);
+    return this.get(id, user);
+  }
+
+  /**
+   * Totals for a period by category and by property, shared by the financial overviews
+   */
+  async summarize(user: JWTClaims, filters: ExpenseFilters) {
+    const where: any = { ...this.scopeWhere(user), ...this.filterWhere(filters) };
+    const [byCategory, byProperty] = await Promise.all([
+      this.prisma.expense.groupBy({ by: ['category'], where, _sum: { amount: true }, _count: { _all: true } }),
+      this.prisma.expense.groupBy({ by: ['property_id'], where, _sum: { amount: true } }),
+    ]);
+    const properties = await this.prisma.property.findMany({
+      where: { id: { in: byProperty.map(p => p.property_id).filter((id): id is string => !!id) } },
+      select: { id: true, name: true },
+    });
+    const names = new Map(properties.map(p => [p.id, p.name]));
+
+    return {
+      total: Math.round(byCategory.reduce((sum, c) => sum + Number(c._sum.amount || 0), 0) * 100) / 100,
+      byCategory: byCategory
+        .map(c => ({ category: c.category, count: c._count._all, amount: Number(c._sum.amount || 0) }))
+        .sort((a, b) => b.amount - a.amount),
+      byProperty: byProperty
+        .map(p => ({
+          property_id: p.property_id,
+          property_name: p.property_id ? names.get(p.property_id) || 'Unknown' : 'Company-wide',
+          amount: Number(p._sum.amount || 0),
+        }))
+        .sort((a, b) => b.amount - a.amount),
+    };
+  }
+
+  /**
+   * Scheduled run: record the copies of recurring expenses that have come due
+   */
+  async recordRecurring(today = new Date()) {
+    const due = await this.prisma.expense.findMany({
+      where: { recurrence: { not: 'none' }, next_occurrence_date: { lte: today } },
+      take: 200,
+    });
+    let recorded = 0;
+    for (const template of due) {
+      // Catch up on every occurrence missed while the run was not happening
+      let date = template.next_occurrence_date!;
+      while (date <= today && (!template.recurrence_end_date || date <= template.recurrence_end_date)) {
+        await this.prisma.expense.create({
+          data: {
+            company_id: template.company_id,
+            property_id: template.property_id,
+            vendor_id: template.vendor_id,
+            category: template.category,
+            description: template.description,
+            amount: template.amount,
+            currency: template.currency,
+            expense_date: date,
+            payment_method: template.payment_method,
+            notes: template.notes,
+            parent_expense_id: template.id,
+            created_by: template.created_by,
+          },
+        });
+        recorded++;
+        date = nextOccurrence(date, template.recurrence);
+      }
+      const ended = !!template.recurrence_end_date && date > template.recurrence_end_date;
+      await this.prisma.expense.update({
+        where: { id: template.id },
+        data: { next_occurrence_date: ended ? null : date },
+      });
+    }
+    return { recorded };
+  }
+
+  private filterWhere(filters: ExpenseFilters) {
+    const expenseDate: any = {};
+    if (filters.start_date) expenseDate.gte = new Date(filters.start_date);
+    if (filters.end_date) expenseDate.lte = new Date(filters.end_date);
+    return {
+      ...(filters.property_ids?.length
+        ? { property_id: { in: filters.property_ids } }
+        : filters.property_id && { property_id: filters.property_id }),
+      ...(filters.vendor_id && { vendor_id: filters.vendor_id }),
+      ...(filters.category && { category: filters.category }),
+      ...(Object.keys(expenseDate).length > 0 && { expense_date: expenseDate }),
+    };
+  }
+
+  /**
+   * First occurrence after today, so editing an old recurring expense does not backfill copies
+   */
+  private nextAfterToday(from: Date, recurrence: string) {
+    const today = new Date();
+    let next = nextOccurrence(from, recurrence);
+    while (next <= today) next = nextOccurrence(next, recurrence);
+    return next;
+  }
+
+  private async attachReceipt(expenseId: string, receipt: UploadedReceipt, previousFileId?: string | null) {
+    if (!RECEIPT_MIME_PREFIXES.some(prefix => receipt.mimetype.startsWith(prefix))) {
+      throw new Error('receipt must be an image or PDF');
+    }
+    const { imagekitService } = await import('./imagekit.service.js');
+    const extension = receipt.originalname.includes('.') ? receipt.originalname.split('.').pop() : '';
+    const upload = await imagekitService.uploadFile(
+      receipt.buffer,
+      `expense-${expenseId}-${Date.now()}${extension ? `.${extension}` : ''}`,
+      `expenses/${expenseId}`
+    );
+    await this.prisma.expense.update({
+      where: { id: expenseId },
+      data: { receipt_url: upload.url, receipt_file_id: upload.fileId, updated_at: new Date() },
+    });
+    if (previousFileId) {
+      await imagekitService.deleteFile(previousFileId).catch(() => undefined);
+    }
+  }
+}
+
+export const expensesService = new ExpensesService();
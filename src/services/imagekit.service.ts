@@ -25,10 +25,24 @@ class ImageKitService {
     }
   }
 
+  /**
+   * Resized preview URL using ImageKit transformations; videos get a poster frame, audio has none
+   */
+  thumbnailUrl(url: string, mimeType: string, size: number = 320): string | null {
+    if (mimeType.startsWith('image/')) {
+      return `${url}?tr=w-${size},h-${size},c-at_max`;
+    }
+    if (mimeType.startsWith('video/')) {
+      return `${url}/ik-thumbnail.jpg?tr=w-${size}`;
+    }
+    return null;
+  }
+
   async uploadFile(
     file: Buffer,
     fileName: string,
-    folder: string = 'properties'
+    folder: string = 'properties',
+    options: { isPrivate?: boolean } = {}
   ): Promise<{ url: string; fileId: string; name: string }> {
     // In test mode, return mock response
     if (this.isTestMode && !this.imagekit) {
@@ -50,7 +64,9 @@ class ImageKitService {
         fileName: fileName,
         folder: folder,
         useUniqueFileName: true,
-        tags: ['property', 'letrents'],
+        // Private files can only be fetched through signed URLs
+        ...(options.isPrivate && { isPrivateFile: true }),
+        tags: [folder.split('/')[0] === 'properties' ? 'property' : folder.split('/')[0], 'letrents'],
       });
 
       return {
@@ -64,6 +80,30 @@ class ImageKitService {
     }
   }
 
+  /**
+   * Time-limited URL for a file; the only way to download private files
+   */
+  signedUrl(url: string, expireSeconds: number): string {
+    if (this.isTestMode && !this.imagekit) {
+      return `${url}?ik-s=test&ik-t=${Math.floor(Date.now() / 1000) + expireSeconds}`;
+    }
+    if (!this.imagekit) {
+      throw new Error('ImageKit not initialized');
+    }
+    return this.imagekit.url({ src: url, signed: true, expireSeconds: Math.max(1, Math.floor(expireSeconds)) });
+  }
+
+  /**
+   * Signed link to a stored file for `ttlSeconds`, cut short so it never outlives the file's own
+   * expiry. Null once the file has expired.
+   */
+  signedDownload(url: string, ttlSeconds: number, notAfter?: Date | null): { url: string; expires_at: Date } | null {
+    const remaining = notAfter ? Math.floor((notAfter.getTime() - Date.now()) / 1000) : Infinity;
+    const seconds = Math.min(ttlSeconds, remaining);
+    if (seconds <= 0) return null;
+    return { url: this.signedUrl(url, seconds), expires_at: new Date(Date.now() + seconds * 1000) };
+  }
+
   async deleteFile(fileId: string): Promise<void> {
     // In test mode, return mock response
     if (this.isTestMode && !this.imagekit) {
@@ -83,6 +123,68 @@ class ImageKitService {
     }
   }
 
+  /**
+   * Delete a stored file known only by its URL, for records that never kept the file ID.
+   * URLs outside our endpoint and files already gone are skipped.
+   */
+  async deleteFileByUrl(url: string): Promise<boolean> {
+    // In test mode, return mock response
+    if (this.isTestMode && !this.imagekit) {
+      console.log('📸 [TEST] ImageKit delete by URL would be called:', url);
+      return true;
+    }
+
+    if (!this.imagekit) {
+      throw new Error('ImageKit not initialized');
+    }
+
+    const endpoint = (env.imagekit.endpoint || '').replace(/\/+$/, '');
+    const clean = url.split('?')[0];
+    if (!endpoint || !clean.startsWith(`${endpoint}/`)) {
+      return false;
+    }
+    const filePath = decodeURIComponent(clean.slice(endpoint.length));
+    const folder = filePath.slice(0, filePath.lastIndexOf('/')) || '/';
+    const name = filePath.slice(filePath.lastIndexOf('/') + 1);
+
+    try {
+      const files: any[] = await this.imagekit.listFiles({ path: folder, searchQuery: `name = "${name.replace(/"/g, '\\"')}"` });
+      const matches = files.filter(file => file.fileId && file.filePath === filePath);
+      for (const file of matches) {
+        await this.imagekit.deleteFile(file.fileId);
+      }
+      return matches.length > 0;
+    } catch (error) {
+      console.error('ImageKit delete by URL error:', error);
+      throw new Error('Failed to delete image from ImageKit');
+    }
+  }
+
+  /**
+   * A stored file's path and URL, or null when no file has that ID
+   */
+  async getFileDetails(fileId: string): Promise<{ fileId: string; filePath: string; url: string; size: number } | null> {
+    if (this.isTestMode && !this.imagekit) {
+      console.log('📸 [TEST] ImageKit getFileDetails would be called:', fileId);
+      return null;
+    }
+
+    if (!this.imagekit) {
+      throw new Error('ImageKit not initialized');
+    }
+
+    try {
+      const file: any = await this.imagekit.getFileDetails(fileId);
+      return { fileId: file.fileId, filePath: file.filePath, url: file.url, size: file.size };
+    } catch (error: any) {
+      if (error?.$ResponseMetadata?.statusCode === 404 || error?.statusCode === 404) {
+        return null;
+      }
+      console.error('ImageKit file details error:', error);
+      throw new Error('Failed to look up file in ImageKit');
+    }
+  }
+
   async listFiles(folder: string = 'properties'): Promise<any[]> {
     // In test mode, return mock response
     if (this.isTestMode && !this.imagekit) {
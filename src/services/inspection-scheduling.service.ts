@@ -0,0 +1,423 @@
+import crypto from 'crypto';
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { emailTemplatesService } from './email-templates.service.js';
+
+export interface ScheduleInspectionRequest {
+  inspector_id?: string;
+  scheduled_date: string;
+  duration_minutes?: number;
+  force?: boolean; // Book despite conflicts
+}
+
+export interface ScheduleConflict {
+  type: 'inspector_busy' | 'unit_busy' | 'off_day';
+  message: string;
+  inspection_id?: string;
+}
+
+const MINUTE = 60 * 1000;
+const REMINDER_HOURS = 24;
+const SCHEDULER_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+const INSPECTOR_ROLES = ['agency_admin', 'landlord', 'agent', 'caretaker'];
+const ACTIVE_STATUSES = ['scheduled', 'in_progress'];
+const WEEKDAYS = ['sunday', 'monday', 'tuesday', 'wednesday', 'thursday', 'friday', 'saturday'];
+
+// Only the hash of a feed token is stored; the URL carries the token itself
+const hashFeedToken = (token: string) => crypto.createHash('sha256').update(token).digest('hex');
+const icsDate = (d: Date) => d.toISOString().replace(/[-:]/g, '').split('.')[0] + 'Z';
+const icsText = (value: string) =>
+  value.replace(/\\/g, '\\\\').replace(/;/g, '\\;').replace(/,/g, '\\,').replace(/\r?\n/g, '\\n');
+
+export class InspectionSchedulingService {
+  private prisma = getPrisma();
+
+  /**
+   * Assign an inspector (staff member or caretaker) and a time slot to an inspection.
+   * Double bookings are rejected unless `force` is set.
+   */
+  async scheduleInspection(inspectionId: string, req: ScheduleInspectionRequest, user: JWTClaims): Promise<any> {
+    if (!SCHEDULER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to schedule inspections');
+    }
+    const inspection = await this.prisma.inspection.findFirst({
+      where: { id: inspectionId, company_id: user.company_id! },
+    });
+    if (!inspection) {
+      throw new Error('inspection not found');
+    }
+    if (!ACTIVE_STATUSES.includes(inspection.status)) {
+      throw new Error(`inspection is already ${inspection.status}`);
+    }
+
+    const start = new Date(req.scheduled_date);
+    if (!req.scheduled_date || isNaN(start.getTime())) {
+      throw new Error('scheduled_date must be a valid date and time');
+    }
+    const duration = req.duration_minutes ?? inspection.duration_minutes;
+    if (!Number.isInteger(duration) || duration < 15 || duration > 8 * 60) {
+      throw new Error('duration_minutes must be between 15 and 480');
+    }
+
+    const inspectorId = req.inspector_id || inspection.inspector_id;
+    const inspector = await this.getInspector(inspectorId, user);
+
+    const conflicts = await this.findConflicts({
+      inspector_id: inspector.id,
+      unit_id: inspection.unit_id,
+      start,
+      duration_minutes: duration,
+      exclude_id: inspectionId,
+    }, inspector.off_days);
+    if (conflicts.length > 0 && !req.force) {
+      throw new Error(`scheduling conflict: ${conflicts.map(c => c.message).join('; ')}`);
+    }
+
+    const rescheduled = inspection.scheduled_date?.getTime() !== start.getTime() || inspection.inspector_id !== inspector.id;
+    const updated = await this.prisma.inspection.update({
+      where: { id: inspectionId },
+      data: {
+        inspector_id: inspector.id,
+        scheduled_date: start,
+        duration_minutes: duration,
+        ...(rescheduled && { reminder_sent_at: null }),
+        updated_at: new Date(),
+      },
+      include: {
+        property: { select: { name: true } },
+        unit: { select: { unit_number: true } },
+        inspector: { select: { id: true, first_name: true, last_name: true, role: true } },
+        tenant: { select: { id: true, first_name: true, last_name: true, email: true } },
+      },
+    });
+
+    if (rescheduled) {
+      const when = start.toLocaleString();
+      const location = `${updated.property.name}, Unit ${updated.unit.unit_number}`;
+      await this.notify(updated, inspector.id, 'Inspection assigned',
+        `You are scheduled to carry out the ${updated.inspection_type.replace('_', '-')} inspection at ${location} on ${when}.`);
+      if (inspector.email && inspector.id !== user.user_id) {
+        await this.email('inspection_assigned', updated, inspector, {
+          inspector_name: inspector.first_name,
+          inspection_type: updated.inspection_type.replace('_', '-'),
+          location,
+          when,
+          duration_minutes: duration,
+        });
+      }
+      if (updated.tenant) {
+        await this.notify(updated, updated.tenant.id, 'Inspection scheduled',
+          `A ${updated.inspection_type.replace('_', '-')} inspection of your unit is scheduled for ${when}.`);
+      }
+    }
+
+    return { ...updated, conflicts };
+  }
+
+  /**
+   * Overlapping bookings for the inspector or the unit, and bookings on the inspector's off days
+   */
+  async findConflicts(
+    slot: { inspector_id?: string; unit_id?: string; start: Date; duration_minutes: number; exclude_id?: string },
+    offDays?: string | null
+  ): Promise<ScheduleConflict[]> {
+    const end = new Date(slot.start.getTime() + slot.duration_minutes * MINUTE);
+    // Longest bookable inspection is 8 hours, so anything starting earlier than that can't overlap
+    const candidates = await this.prisma.inspection.findMany({
+      where: {
+        ...(slot.exclude_id && { id: { not: slot.exclude_id } }),
+        status: { in: ACTIVE_STATUSES as any },
+        scheduled_date: { gt: new Date(slot.start.getTime() - 8 * 60 * MINUTE), lt: end },
+        OR: [
+          ...(slot.inspector_id ? [{ inspector_id: slot.inspector_id }] : []),
+          ...(slot.unit_id ? [{ unit_id: slot.unit_id }] : []),
+        ],
+      },
+      include: {
+        property: { select: { name: true } },
+        unit: { select: { unit_number: true } },
+      },
+    });
+
+    const conflicts: ScheduleConflict[] = [];
+    for (const other of candidates) {
+      const otherEnd = other.scheduled_date!.getTime() + other.duration_minutes * MINUTE;
+      if (otherEnd <= slot.start.getTime()) continue;
+      const at = `${other.property.name}, Unit ${other.unit.unit_number} at ${other.scheduled_date!.toLocaleString()}`;
+      if (slot.inspector_id && other.inspector_id === slot.inspector_id) {
+        conflicts.push({ type: 'inspector_busy', inspection_id: other.id, message: `inspector is already booked for ${at}` });
+      } else {
+        conflicts.push({ type: 'unit_busy', inspection_id: other.id, message: `unit already has an inspection at ${other.scheduled_date!.toLocaleString()}` });
+      }
+    }
+
+    const weekday = WEEKDAYS[slot.start.getDay()];
+    if (offDays && offDays.toLowerCase().split(/[\s,;/]+/).some(day => day && weekday.startsWith(day.slice(0, 3)))) {
+      conflicts.push({ type: 'off_day', message: `${weekday.replace(/^./, c => c.toUpperCase())} is the inspector's off day` });
+    }
+    return conflicts;
+  }
+
+  async checkConflicts(
+    query: { inspector_id?: string; unit_id?: string; scheduled_date?: string; duration_minutes?: string; exclude_id?: string },
+    user: JWTClaims
+  ): Promise<ScheduleConflict[]> {
+    const start = new Date(query.scheduled_date || '');
+    if (isNaN(start.getTime())) {
+      throw new Error('scheduled_date must be a valid date and time');
+    }
+    if (!query.inspector_id && !query.unit_id) {
+      throw new Error('inspector_id or unit_id is required');
+    }
+    if (query.unit_id) {
+      const unit = await this.prisma.unit.findFirst({
+        where: { id: query.unit_id, company_id: user.company_id! },
+        select: { id: true },
+      });
+      if (!unit) {
+        throw new Error('unit not found');
+      }
+    }
+    const inspector = query.inspector_id ? await this.getInspector(query.inspector_id, user) : null;
+    return this.findConflicts({
+      inspector_id: inspector?.id,
+      unit_id: query.unit_id,
+      start,
+      duration_minutes: Number(query.duration_minutes) || 60,
+      exclude_id: query.exclude_id,
+    }, inspector?.off_days);
+  }
+
+  /**
+   * Scheduled inspections in a date range for a calendar view; inspectors only see their own
+   */
+  async getSchedule(filters: { from?: string; to?: string; inspector_id?: string; property_id?: string }, user: JWTClaims) {
+    const from = filters.from ? new Date(filters.from) : new Date();
+    const to = filters.to ? new Date(filters.to) : new Date(from.getTime() + 30 * 24 * 60 * MINUTE);
+    if (isNaN(from.getTime()) || isNaN(to.getTime()) || from > to) {
+      throw new Error('from and to must be valid dates with from before to');
+    }
+
+    const inspections = await this.prisma.inspection.findMany({
+      where: {
+        company_id: user.company_id!,
+        scheduled_date: { gte: from, lte: to },
+        status: { not: 'cancelled' },
+        ...(user.role === 'caretaker'
+          ? { inspector_id: user.user_id }
+          : user.role === 'tenant'
+            ? { tenant_id: user.user_id }
+            : filters.inspector_id && { inspector_id: filters.inspector_id }),
+        ...(filters.property_id && { property_id: filters.property_id }),
+      },
+      include: {
+        property: { select: { id: true, name: true } },
+        unit: { select: { id: true, unit_number: true } },
+        inspector: { select: { id: true, first_name: true, last_name: true, role: true } },
+        tenant: { select: { id: true, first_name: true, last_name: true } },
+      },
+      orderBy: { scheduled_date: 'asc' },
+    });
+
+    return inspections.map(inspection => ({
+      ...inspection,
+      ends_at: new Date(inspection.scheduled_date!.getTime() + inspection.duration_minutes * MINUTE),
+    }));
+  }
+
+  /**
+   * Remind inspectors and tenants about inspections starting within the next day (used by the scheduler)
+   */
+  async sendReminders(): Promise<{ reminded: number }> {
+    const now = new Date();
+    const upcoming = await this.prisma.inspection.findMany({
+      where: {
+        status: 'scheduled',
+        reminder_sent_at: null,
+        scheduled_date: { gte: now, lte: new Date(now.getTime() + REMINDER_HOURS * 60 * MINUTE) },
+      },
+      include: {
+        property: { select: { name: true } },
+        unit: { select: { unit_number: true } },
+        inspector: { select: { id: true, email: true, first_name: true } },
+        tenant: { select: { id: true, email: true, first_name: true } },
+      },
+    });
+
+    for (const inspection of upcoming) {
+      const when = inspection.scheduled_date!.toLocaleString();
+      const location = `${inspection.property.name}, Unit ${inspection.unit.unit_number}`;
+      const type = inspection.inspection_type.replace('_', '-');
+      await this.notify(inspection, inspection.inspector.id, 'Upcoming inspection',
+        `Reminder: ${type} inspection at ${location} on ${when}.`);
+      if (inspection.inspector.email) {
+        await this.email('inspection_reminder_inspector', inspection, inspection.inspector, {
+          inspector_name: inspection.inspector.first_name,
+          inspection_type: type,
+          location,
+          when,
+        });
+      }
+      if (inspection.tenant) {
+        await this.notify(inspection, inspection.tenant.id, 'Upcoming inspection',
+          `Reminder: a ${type} inspection of your unit is scheduled for ${when}.`);
+        if (inspection.tenant.email) {
+          await this.email('inspection_reminder_tenant', inspection, inspection.tenant, {
+            tenant_name: inspection.tenant.first_name,
+            inspection_type: type,
+            location,
+            when,
+          });
+        }
+      }
+      await this.prisma.inspection.update({ where: { id: inspection.id }, data: { reminder_sent_at: now } });
+    }
+
+    return { reminded: upcoming.length };
+  }
+
+  // ============================================================================
+  // CALENDAR FEEDS
+  // ============================================================================
+
+  /**
+   * Personal iCal subscription URL. Only a hash of the token is kept, so the URL is shown when the
+   * feed is first set up or reset; afterwards `url` is null and the existing subscription keeps working.
+   */
+  async getFeedUrl(user: JWTClaims, rotate = false): Promise<{ active: boolean; url: string | null; webcal_url: string | null }> {
+    const current = await this.prisma.user.findUnique({
+      where: { id: user.user_id },
+      select: { calendar_feed_token: true },
+    });
+    if (current?.calendar_feed_token && !rotate) {
+      return { active: true, url: null, webcal_url: null };
+    }
+
+    const token = crypto.randomBytes(24).toString('hex');
+    await this.prisma.user.update({ where: { id: user.user_id }, data: { calendar_feed_token: hashFeedToken(token) } });
+
+    const url = `${env.apiUrl}/api/v1/calendar-feeds/${token}/inspections.ics`;
+    return { active: true, url, webcal_url: url.replace(/^https?:/, 'webcal:') };
+  }
+
+  /**
+   * iCalendar feed of the feed owner's inspections: ones they inspect, or for tenants ones of their unit
+   */
+  async exportFeed(token: string): Promise<string> {
+    const owner = await this.prisma.user.findUnique({
+      where: { calendar_feed_token: hashFeedToken(token) },
+      select: { id: true, role: true, status: true, first_name: true },
+    });
+    if (!owner || owner.status !== 'active') {
+      throw new Error('calendar feed not found');
+    }
+
+    const inspections = await this.prisma.inspection.findMany({
+      where: {
+        ...(owner.role === 'tenant' ? { tenant_id: owner.id } : { inspector_id: owner.id }),
+        scheduled_date: { gte: new Date(Date.now() - 30 * 24 * 60 * MINUTE) },
+      },
+      include: {
+        property: { select: { name: true, street: true, city: true } },
+        unit: { select: { unit_number: true } },
+        tenant: { select: { first_name: true, last_name: true, phone_number: true } },
+      },
+      orderBy: { scheduled_date: 'asc' },
+    });
+
+    const stamp = icsDate(new Date());
+    const lines = [
+      'BEGIN:VCALENDAR',
+      'VERSION:2.0',
+      'PRODID:-//LetRents//Inspections//EN',
+      'CALSCALE:GREGORIAN',
+      'METHOD:PUBLISH',
+      `X-WR-CALNAME:${icsText(`LetRents inspections - ${owner.first_name}`)}`,
+      'REFRESH-INTERVAL;VALUE=DURATION:PT1H',
+    ];
+    for (const inspection of inspections) {
+      const start = inspection.scheduled_date!;
+      const end = new Date(start.getTime() + inspection.duration_minutes * MINUTE);
+      const type = inspection.inspection_type.replace('_', '-');
+      const description = [
+        `${type.replace(/^./, c => c.toUpperCase())} inspection`,
+        owner.role !== 'tenant' && inspection.tenant
+          ? `Tenant: ${inspection.tenant.first_name} ${inspection.tenant.last_name}${inspection.tenant.phone_number ? ` (${inspection.tenant.phone_number})` : ''}`
+          : null,
+        `${env.appUrl}/inspections/${inspection.id}`,
+      ].filter(Boolean).join('\n');
+      lines.push(
+        'BEGIN:VEVENT',
+        `UID:inspection-${inspection.id}@letrents`,
+        `DTSTAMP:${stamp}`,
+        `DTSTART:${icsDate(start)}`,
+        `DTEND:${icsDate(end)}`,
+        `SUMMARY:${icsText(`${type.replace(/^./, c => c.toUpperCase())} inspection - ${inspection.property.name} Unit ${inspection.unit.unit_number}`)}`,
+        `LOCATION:${icsText([inspection.property.name, inspection.property.street, inspection.property.city].filter(Boolean).join(', '))}`,
+        `DESCRIPTION:${icsText(description)}`,
+        `STATUS:${inspection.status === 'cancelled' ? 'CANCELLED' : 'CONFIRMED'}`,
+        'END:VEVENT'
+      );
+    }
+    lines.push('END:VCALENDAR');
+
+    return lines.join('\r\n');
+  }
+
+  private async getInspector(inspectorId: string, user: JWTClaims) {
+    const inspector = await this.prisma.user.findFirst({
+      where: { id: inspectorId, company_id: user.company_id!, status: 'active' },
+      select: { id: true, email: true, first_name: true, last_name: true, role: true, off_days: true },
+    });
+    if (!inspector) {
+      throw new Error('inspector not found');
+    }
+    if (!INSPECTOR_ROLES.includes(inspector.role)) {
+      throw new Error(`inspector must be one of: ${INSPECTOR_ROLES.join(', ')}`);
+    }
+    return inspector;
+  }
+
+  private async notify(inspection: any, recipientId: string, title: string, message: string) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: inspection.company_id,
+        recipient_id: recipientId,
+        title,
+        message,
+        notification_type: 'inspection',
+        category: 'inspection',
+        priority: 'medium',
+        property_id: inspection.property_id,
+        unit_id: inspection.unit_id,
+        related_entity_type: 'inspection',
+        related_entity_id: inspection.id,
+        metadata: { inspection_id: inspection.id, scheduled_date: inspection.scheduled_date },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to send inspection notification:', error.message);
+    }
+  }
+
+  private async email(
+    template: string,
+    inspection: { company_id: string },
+    recipient: { id: string; email: string | null },
+    variables: Record<string, any>
+  ) {
+    try {
+      await emailTemplatesService.send(template, {
+        to: recipient.email!,
+        recipientId: recipient.id,
+        companyId: inspection.company_id,
+        variables,
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to send inspection email:', error.message);
+    }
+  }
+}
+
+export const inspectionSchedulingService = new InspectionSchedulingService();
@@ -0,0 +1,330 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { ConditionScaleEntry, conditionScaleOf } from './checklists.service.js';
+
+export interface CompareInspectionsQuery {
+  base_id?: string;
+  target_id?: string;
+  base_version?: string;
+  target_version?: string;
+}
+
+interface SnapshotItem {
+  checklist_item_id: string;
+  area: string;
+  item: string;
+  condition: string | null;
+  notes: string | null;
+  has_issue: boolean;
+  is_critical: boolean;
+  deduction_amount: number | null;
+  photo_urls: string[];
+}
+
+interface InspectionSnapshot {
+  inspection_id: string;
+  inspection_type: string;
+  status: string;
+  unit_id: string;
+  property_id: string;
+  tenant_id: string | null;
+  inspector_id: string;
+  completed_at: Date | null;
+  overall_condition: string | null;
+  overall_notes: string | null;
+  score: number | null;
+  total_issues: number;
+  critical_issues: number;
+  condition_scale: ConditionScaleEntry[];
+  items: SnapshotItem[];
+  photos: Array<{ url: string; caption: string | null; category: string | null }>;
+}
+
+type Change = 'unchanged' | 'improved' | 'deteriorated' | 'not_comparable' | 'added' | 'removed';
+
+const BACKFILL_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+
+const itemKey = (item: SnapshotItem) => `${item.area.trim().toLowerCase()}::${item.item.trim().toLowerCase()}`;
+
+/**
+ * Immutable snapshots of completed inspections (the unit condition report) and per-area,
+ * per-item diffs between two of them, typically move-in against move-out
+ */
+export class InspectionVersionsService {
+  private prisma = getPrisma();
+
+  private async getCompanyInspection(inspectionId: string, user: JWTClaims) {
+    const inspection = await this.prisma.inspection.findFirst({
+      where: { id: inspectionId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, status: true, unit_id: true },
+    });
+    if (!inspection) {
+      throw new Error('Inspection not found');
+    }
+    return inspection;
+  }
+
+  private async buildSnapshot(inspectionId: string, db: Prisma.TransactionClient = this.prisma): Promise<InspectionSnapshot> {
+    const inspection = await db.inspection.findUniqueOrThrow({
+      where: { id: inspectionId },
+      include: {
+        template: { select: { condition_scale: true } },
+        items: { include: { checklist_item: { include: { category: { select: { name: true, display_order: true } } } } } },
+        photos: { orderBy: { created_at: 'asc' } },
+      },
+    });
+    const items = [...inspection.items].sort((a, b) =>
+      a.checklist_item.category.display_order - b.checklist_item.category.display_order ||
+      a.checklist_item.display_order - b.checklist_item.display_order
+    );
+
+    return {
+      inspection_id: inspection.id,
+      inspection_type: inspection.inspection_type,
+      status: inspection.status,
+      unit_id: inspection.unit_id,
+      property_id: inspection.property_id,
+      tenant_id: inspection.tenant_id,
+      inspector_id: inspection.inspector_id,
+      completed_at: inspection.completed_at,
+      overall_condition: inspection.overall_condition,
+      overall_notes: inspection.overall_notes,
+      score: inspection.score != null ? Number(inspection.score) : null,
+      total_issues: inspection.total_issues,
+      critical_issues: inspection.critical_issues,
+      condition_scale: conditionScaleOf(inspection.template),
+      items: items.map(item => ({
+        checklist_item_id: item.checklist_item_id,
+        area: item.checklist_item.category.name,
+        item: item.checklist_item.name,
+        condition: item.condition,
+        notes: item.notes,
+        has_issue: item.has_issue,
+        is_critical: item.is_critical,
+        deduction_amount: item.deduction_amount != null ? Number(item.deduction_amount) : null,
+        photo_urls: Array.isArray(item.photo_urls) ? (item.photo_urls as string[]) : [],
+      })),
+      photos: inspection.photos.map(photo => ({ url: photo.photo_url, caption: photo.caption, category: photo.category })),
+    };
+  }
+
+  /**
+   * Write the next version for a completed inspection. Versions are only ever inserted; pass the
+   * transaction that changed the inspection so the version cannot be lost.
+   */
+  async recordVersion(
+    inspectionId: string,
+    reason: 'completed' | 'amended' | 'backfill',
+    userId: string | null,
+    db: Prisma.TransactionClient = this.prisma
+  ) {
+    const snapshot = await this.buildSnapshot(inspectionId, db);
+    const latest = await db.inspectionVersion.findFirst({
+      where: { inspection_id: inspectionId },
+      orderBy: { version: 'desc' },
+      select: { version: true },
+    });
+    return db.inspectionVersion.create({
+      data: {
+        inspection_id: inspectionId,
+        version: (latest?.version ?? 0) + 1,
+        reason,
+        snapshot: JSON.parse(JSON.stringify(snapshot)),
+        created_by: userId,
+      },
+    });
+  }
+
+  /**
+   * Versions of an inspection, oldest first. Inspections completed before versioning have none
+   * until `backfill` is run.
+   */
+  async listVersions(inspectionId: string, user: JWTClaims) {
+    const inspection = await this.getCompanyInspection(inspectionId, user);
+    return this.prisma.inspectionVersion.findMany({
+      where: { inspection_id: inspection.id },
+      orderBy: { version: 'asc' },
+      select: { id: true, version: true, reason: true, created_by: true, created_at: true },
+    });
+  }
+
+  /**
+   * Record a first version for completed inspections that predate versioning
+   */
+  async backfill(user: JWTClaims) {
+    if (!BACKFILL_ROLES.includes(user.role)) {
+      throw new Error('Insufficient permissions to backfill inspection versions');
+    }
+    const inspections = await this.prisma.inspection.findMany({
+      where: {
+        status: 'completed',
+        versions: { none: {} },
+        ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+      },
+      select: { id: true },
+    });
+    for (const inspection of inspections) {
+      await this.prisma.$transaction(tx => this.recordVersion(inspection.id, 'backfill', null, tx));
+    }
+    return { backfilled: inspections.length };
+  }
+
+  async getVersion(inspectionId: string, version: number, user: JWTClaims) {
+    const inspection = await this.getCompanyInspection(inspectionId, user);
+    if (!Number.isInteger(version) || version < 1) {
+      throw new Error('version must be a positive whole number');
+    }
+    const row = await this.prisma.inspectionVersion.findUnique({
+      where: { inspection_id_version: { inspection_id: inspection.id, version } },
+    });
+    if (!row) {
+      throw new Error('inspection version not found');
+    }
+    return row;
+  }
+
+  /**
+   * A given version, else the latest version, else the inspection as currently recorded
+   */
+  private async resolveSnapshot(inspectionId: string, version: string | undefined, user: JWTClaims) {
+    if (version) {
+      const row = await this.getVersion(inspectionId, parseInt(version, 10), user);
+      return { version: row.version, snapshot: row.snapshot as unknown as InspectionSnapshot };
+    }
+    const latest = await this.prisma.inspectionVersion.findFirst({
+      where: { inspection_id: inspectionId },
+      orderBy: { version: 'desc' },
+    });
+    if (latest) {
+      return { version: latest.version, snapshot: latest.snapshot as unknown as InspectionSnapshot };
+    }
+    return { version: null, snapshot: JSON.parse(JSON.stringify(await this.buildSnapshot(inspectionId))) as InspectionSnapshot };
+  }
+
+  async compare(query: CompareInspectionsQuery, user: JWTClaims) {
+    if (!query.base_id || !query.target_id) {
+      throw new Error('base_id and target_id are required');
+    }
+    const [baseInspection, targetInspection] = await Promise.all([
+      this.getCompanyInspection(query.base_id, user),
+      this.getCompanyInspection(query.target_id, user),
+    ]);
+    if (baseInspection.unit_id !== targetInspection.unit_id) {
+      throw new Error('inspections must be for the same unit');
+    }
+    const base = await this.resolveSnapshot(baseInspection.id, query.base_version, user);
+    const target = await this.resolveSnapshot(targetInspection.id, query.target_version, user);
+    return this.diff(base, target);
+  }
+
+  /**
+   * Latest completed move-in against latest move-out for a unit, the basis for deposit deductions
+   */
+  async compareMoveInOut(unitId: string, user: JWTClaims) {
+    const where = { unit_id: unitId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) };
+    const [moveIn, moveOut] = await Promise.all([
+      this.prisma.inspection.findFirst({
+        where: { ...where, inspection_type: 'move_in', status: 'completed' },
+        orderBy: { completed_at: 'desc' },
+        select: { id: true },
+      }),
+      this.prisma.inspection.findFirst({
+        where: { ...where, inspection_type: 'move_out', status: { not: 'cancelled' } },
+        orderBy: { created_at: 'desc' },
+        select: { id: true },
+      }),
+    ]);
+    if (!moveIn) {
+      throw new Error('completed move-in inspection not found for this unit');
+    }
+    if (!moveOut) {
+      throw new Error('move-out inspection not found for this unit');
+    }
+    return this.compare({ base_id: moveIn.id, target_id: moveOut.id }, user);
+  }
+
+  private diff(
+    base: { version: number | null; snapshot: InspectionSnapshot },
+    target: { version: number | null; snapshot: InspectionSnapshot }
+  ) {
+    const scoreOf = (scale: ConditionScaleEntry[], condition: string | null) =>
+      condition ? scale.find(entry => entry.value === condition)?.score ?? null : null;
+    const baseItems = new Map(base.snapshot.items.map(item => [itemKey(item), item]));
+    const targetItems = new Map(target.snapshot.items.map(item => [itemKey(item), item]));
+    const keys = [...new Set([...baseItems.keys(), ...targetItems.keys()])];
+
+    const areas = new Map<string, any[]>();
+    const counts: Record<Change, number> = { unchanged: 0, improved: 0, deteriorated: 0, not_comparable: 0, added: 0, removed: 0 };
+    let suggestedDeductions = 0;
+
+    for (const key of keys) {
+      const before = baseItems.get(key);
+      const after = targetItems.get(key);
+      let change: Change;
+      if (!before) {
+        change = 'added';
+      } else if (!after) {
+        change = 'removed';
+      } else {
+        const beforeScore = scoreOf(base.snapshot.condition_scale, before.condition);
+        const afterScore = scoreOf(target.snapshot.condition_scale, after.condition);
+        change = beforeScore === null || afterScore === null
+          ? (before.condition === after.condition ? 'unchanged' : 'not_comparable')
+          : afterScore < beforeScore ? 'deteriorated' : afterScore > beforeScore ? 'improved' : 'unchanged';
+      }
+      counts[change]++;
+
+      const newIssue = !!after?.has_issue && !before?.has_issue;
+      // Only damage that appeared since the earlier report counts towards deductions
+      if ((change === 'deteriorated' || newIssue) && after?.deduction_amount) {
+        suggestedDeductions += after.deduction_amount;
+      }
+
+      const area = (after || before)!.area;
+      areas.set(area, [
+        ...(areas.get(area) || []),
+        {
+          item: (after || before)!.item,
+          change,
+          new_issue: newIssue,
+          before: before ? { condition: before.condition, notes: before.notes, has_issue: before.has_issue, photo_urls: before.photo_urls } : null,
+          after: after
+            ? { condition: after.condition, notes: after.notes, has_issue: after.has_issue, deduction_amount: after.deduction_amount, photo_urls: after.photo_urls }
+            : null,
+        },
+      ]);
+    }
+
+    const header = (side: { version: number | null; snapshot: InspectionSnapshot }) => ({
+      inspection_id: side.snapshot.inspection_id,
+      inspection_type: side.snapshot.inspection_type,
+      version: side.version,
+      status: side.snapshot.status,
+      completed_at: side.snapshot.completed_at,
+      overall_condition: side.snapshot.overall_condition,
+      score: side.snapshot.score,
+    });
+
+    return {
+      unit_id: target.snapshot.unit_id,
+      base: header(base),
+      target: header(target),
+      summary: {
+        ...counts,
+        new_issues: [...areas.values()].flat().filter(item => item.new_issue).length,
+        score_change: base.snapshot.score !== null && target.snapshot.score !== null
+          ? Math.round((target.snapshot.score - base.snapshot.score) * 100) / 100
+          : null,
+        suggested_deductions: Math.round(suggestedDeductions * 100) / 100,
+      },
+      areas: [...areas.entries()].map(([area, items]) => ({
+        area,
+        changed: items.filter(item => item.change !== 'unchanged').length,
+        items,
+      })),
+    };
+  }
+}
+
+export const inspectionVersionsService = new InspectionVersionsService();
@@ -0,0 +1,525 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface InventoryItemRequest {
+  name?: string;
+  sku?: string | null;
+  category?: string;
+  unit?: string;
+  property_id?: string | null;
+  quantity?: number;
+  reorder_level?: number;
+  unit_cost?: number;
+  location?: string | null;
+}
+
+export interface InventoryItemFilters {
+  property_id?: string;
+  category?: string;
+  search?: string;
+  low_stock?: string;
+  include_inactive?: string;
+}
+
+export interface StockChangeRequest {
+  quantity: number;
+  unit_cost?: number;
+  notes?: string;
+}
+
+export interface ConsumeItemsRequest {
+  items: Array<{ item_id: string; quantity: number }>;
+  notes?: string;
+}
+
+export const INVENTORY_CATEGORIES = ['electrical', 'plumbing', 'locks', 'paint', 'cleaning', 'hardware', 'other'];
+const STOCK_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+const CONSUMER_ROLES = [...STOCK_ROLES, 'caretaker', 'maintenance'];
+
+const toNumber = (value: any) => Number(value ?? 0);
+const round = (value: number) => Math.round(value * 100) / 100;
+const toItem = (item: any) => ({
+  ...item,
+  quantity: toNumber(item.quantity),
+  reorder_level: toNumber(item.reorder_level),
+  unit_cost: toNumber(item.unit_cost),
+  stock_value: round(toNumber(item.quantity) * toNumber(item.unit_cost)),
+  low_stock: toNumber(item.quantity) <= toNumber(item.reorder_level),
+});
+
+/**
+ * Spare parts and consumables held per property store (or a central company store), with a
+ * movement ledger. Work orders draw stock down and carry the material cost into cost reports.
+ */
+export class InventoryService {
+  private prisma = getPrisma();
+
+  private companyId(user: JWTClaims): string {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    return user.company_id;
+  }
+
+  private async getCompanyItem(itemId: string, user: JWTClaims) {
+    const item = await this.prisma.inventoryItem.findFirst({
+      where: { id: itemId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+    });
+    if (!item) {
+      throw new Error('inventory item not found');
+    }
+    return item;
+  }
+
+  private async assertProperty(propertyId: string, companyId: string) {
+    const property = await this.prisma.property.findFirst({ where: { id: propertyId, company_id: companyId }, select: { id: true } });
+    if (!property) {
+      throw new Error('property not found');
+    }
+  }
+
+  async listItems(filters: InventoryItemFilters, user: JWTClaims) {
+    if (!CONSUMER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view inventory');
+    }
+    const items = await this.prisma.inventoryItem.findMany({
+      where: {
+        company_id: this.companyId(user),
+        ...(filters.include_inactive !== 'true' && { is_active: true }),
+        // A property's view includes the central store it can draw from
+        ...(filters.property_id && { OR: [{ property_id: filters.property_id }, { property_id: null }] }),
+        ...(filters.category && { category: filters.category }),
+        ...(filters.search && {
+          AND: [{ OR: [
+            { name: { contains: filters.search, mode: 'insensitive' as const } },
+            { sku: { contains: filters.search, mode: 'insensitive' as const } },
+          ] }],
+        }),
+      },
+      orderBy: [{ category: 'asc' }, { name: 'asc' }],
+    });
+    const rows = items.map(toItem);
+    return filters.low_stock === 'true' ? rows.filter(item => item.low_stock) : rows;
+  }
+
+  async getItem(itemId: string, user: JWTClaims) {
+    if (!CONSUMER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view inventory');
+    }
+    const item = await this.getCompanyItem(itemId, user);
+    const movements = await this.prisma.inventoryMovement.findMany({
+      where: { item_id: item.id },
+      orderBy: { created_at: 'desc' },
+      take: 50,
+    });
+    return {
+      ...toItem(item),
+      movements: movements.map(m => ({ ...m, quantity: toNumber(m.quantity), unit_cost: toNumber(m.unit_cost), quantity_after: toNumber(m.quantity_after) })),
+    };
+  }
+
+  async createItem(req: InventoryItemRequest, user: JWTClaims) {
+    if (!STOCK_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage inventory');
+    }
+    const companyId = this.companyId(user);
+    if (!req.name?.trim()) {
+      throw new Error('name is required');
+    }
+    this.validateItem(req);
+    if (req.property_id) {
+      await this.assertProperty(req.property_id, companyId);
+    }
+
+    const quantity = req.quantity ?? 0;
+    const unitCost = req.unit_cost ?? 0;
+    const item = await this.prisma.inventoryItem.create({
+      data: {
+        company_id: companyId,
+        property_id: req.property_id || null,
+        name: req.name.trim(),
+        sku: req.sku?.trim() || null,
+        category: req.category || 'other',
+        unit: req.unit?.trim() || 'pcs',
+        quantity,
+        reorder_level: req.reorder_level ?? 0,
+        unit_cost: unitCost,
+        location: req.location?.trim() || null,
+        created_by: user.user_id,
+      },
+    });
+    if (quantity > 0) {
+      await this.prisma.inventoryMovement.create({
+        data: {
+          item_id: item.id,
+          company_id: companyId,
+          movement_type: 'restock',
+          quantity,
+          unit_cost: unitCost,
+          quantity_after: quantity,
+          notes: 'Opening stock',
+          performed_by: user.user_id,
+        },
+      });
+    }
+    return toItem(item);
+  }
+
+  /**
+   * Details only; stock levels change through restock, adjust and consume so the ledger stays whole
+   */
+  async updateItem(itemId: string, req: InventoryItemRequest, user: JWTClaims) {
+    if (!STOCK_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage inventory');
+    }
+    const item = await this.getCompanyItem(itemId, user);
+    if (req.quantity !== undefined) {
+      throw new Error('quantity must be changed through a restock or stock adjustment');
+    }
+    if (req.name !== undefined && !req.name.trim()) {
+      throw new Error('name is required');
+    }
+    this.validateItem(req);
+    if (req.property_id) {
+      await this.assertProperty(req.property_id, item.company_id);
+    }
+
+    const updated = await this.prisma.inventoryItem.update({
+      where: { id: item.id },
+      data: {
+        ...(req.name !== undefined && { name: req.name.trim() }),
+        ...(req.sku !== undefined && { sku: req.sku?.trim() || null }),
+        ...(req.category !== undefined && { category: req.category }),
+        ...(req.unit !== undefined && { unit: req.unit.trim() || 'pcs' }),
+        ...(req.property_id !== undefined && { property_id: req.property_id || null }),
+        ...(req.reorder_level !== undefined && { reorder_level: req.reorder_level }),
+        ...(req.unit_cost !== undefined && { unit_cost: req.unit_cost }),
+        ...(req.location !== undefined && { location: req.location?.trim() || null }),
+        updated_at: new Date(),
+      },
+    });
+    return toItem(updated);
+  }
+
+  async deactivateItem(itemId: string, user: JWTClaims) {
+    if (!STOCK_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage inventory');
+    }
+    const item = await this.getCompanyItem(itemId, user);
+    await this.prisma.inventoryItem.update({ where: { id: item.id }, data: { is_active: false, updated_at: new Date() } });
+  }
+
+  /**
+   * Receive stock; a new unit cost becomes the weighted average of old and new stock
+   */
+  async restock(itemId: string, req: StockChangeRequest, user: JWTClaims) {
+    if (!STOCK_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage inventory');
+    }
+    if (typeof req.quantity !== 'number' || req.quantity <= 0) {
+      throw new Error('quantity must be a positive number');
+    }
+    if (req.unit_cost !== undefined && (typeof req.unit_cost !== 'number' || req.unit_cost < 0)) {
+      throw new Error('unit_cost must be a positive number');
+    }
+    const item = await this.getCompanyItem(itemId, user);
+    const current = Math.max(toNumber(item.quantity), 0);
+    const quantityAfter = round(toNumber(item.quantity) + req.quantity);
+    const unitCost = req.unit_cost !== undefined && quantityAfter > 0
+      ? round((current * toNumber(item.unit_cost) + req.quantity * req.unit_cost) / (current + req.quantity))
+      : toNumber(item.unit_cost);
+
+    const [updated] = await this.prisma.$transaction([
+      this.prisma.inventoryItem.update({
+        where: { id: item.id },
+        data: {
+          quantity: { increment: req.quantity },
+          unit_cost: unitCost,
+          ...(quantityAfter > toNumber(item.reorder_level) && { low_stock_alerted_at: null }),
+          updated_at: new Date(),
+        },
+      }),
+      this.prisma.inventoryMovement.create({
+        data: {
+          item_id: item.id,
+          company_id: item.company_id,
+          movement_type: 'restock',
+          quantity: req.quantity,
+          unit_cost: req.unit_cost ?? toNumber(item.unit_cost),
+          quantity_after: quantityAfter,
+          notes: req.notes?.trim() || null,
+          performed_by: user.user_id,
+        },
+      }),
+    ]);
+    return toItem(updated);
+  }
+
+  /**
+   * Stock-take correction: `quantity` is the counted quantity on hand
+   */
+  async adjust(itemId: string, req: StockChangeRequest, user: JWTClaims) {
+    if (!STOCK_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage inventory');
+    }
+    if (typeof req.quantity !== 'number' || req.quantity < 0) {
+      throw new Error('quantity must be zero or more');
+    }
+    if (!req.notes?.trim()) {
+      throw new Error('notes are required for a stock adjustment');
+    }
+    const item = await this.getCompanyItem(itemId, user);
+    const delta = round(req.quantity - toNumber(item.quantity));
+    if (delta === 0) {
+      return toItem(item);
+    }
+
+    const [updated] = await this.prisma.$transaction([
+      this.prisma.inventoryItem.update({
+        where: { id: item.id },
+        data: {
+          quantity: req.quantity,
+          ...(req.quantity > toNumber(item.reorder_level) && { low_stock_alerted_at: null }),
+          updated_at: new Date(),
+        },
+      }),
+      this.prisma.inventoryMovement.create({
+        data: {
+          item_id: item.id,
+          company_id: item.company_id,
+          movement_type: 'adjust',
+          quantity: delta,
+          unit_cost: item.unit_cost,
+          quantity_after: req.quantity,
+          notes: req.notes.trim(),
+          performed_by: user.user_id,
+        },
+      }),
+    ]);
+    await this.alertIfLow(updated);
+    return toItem(updated);
+  }
+
+  /**
+   * Draw items from stock for a work order. Items must belong to the request's property store
+   * or the central store, and all lines fail together if any is short.
+   */
+  async consumeForRequest(requestId: string, req: ConsumeItemsRequest, user: JWTClaims) {
+    if (!CONSUMER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to use inventory');
+    }
+    if (!Array.isArray(req.items) || req.items.length === 0) {
+      throw new Error('items are required');
+    }
+    if (req.items.some(line => !line.item_id || typeof line.quantity !== 'number' || line.quantity <= 0)) {
+      throw new Error('each item must have an item_id and a positive quantity');
+    }
+    const request = await this.prisma.maintenanceRequest.findFirst({
+      where: { id: requestId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, company_id: true, property_id: true, status: true, title: true },
+    });
+    if (!request) {
+      throw new Error('Maintenance request not found');
+    }
+    if (request.status === 'cancelled') {
+      throw new Error('maintenance request is already cancelled');
+    }
+
+    const items = await this.prisma.inventoryItem.findMany({
+      where: {
+        id: { in: req.items.map(line => line.item_id) },
+        company_id: request.company_id,
+        is_active: true,
+        OR: [{ property_id: request.property_id }, { property_id: null }],
+      },
+    });
+    const byId = new Map(items.map(item => [item.id, item]));
+    const missing = req.items.find(line => !byId.has(line.item_id));
+    if (missing) {
+      throw new Error(`inventory item ${missing.item_id} not found in this property's store`);
+    }
+
+    const updatedItems = await this.prisma.$transaction(async (tx) => {
+      const results = [];
+      let materialCost = 0;
+      for (const line of req.items) {
+        const item = byId.get(line.item_id)!;
+        const { count } = await tx.inventoryItem.updateMany({
+          where: { id: item.id, quantity: { gte: line.quantity } },
+          data: { quantity: { decrement: line.quantity }, updated_at: new Date() },
+        });
+        if (count === 0) {
+          throw new Error(`insufficient stock: ${item.name} must be restocked before ${line.quantity} ${item.unit} can be used`);
+        }
+        const after = await tx.inventoryItem.findUniqueOrThrow({ where: { id: item.id } });
+        await tx.inventoryMovement.create({
+          data: {
+            item_id: item.id,
+            company_id: item.company_id,
+            movement_type: 'consume',
+            quantity: -line.quantity,
+            unit_cost: item.unit_cost,
+            quantity_after: after.quantity,
+            maintenance_request_id: request.id,
+            notes: req.notes?.trim() || null,
+            performed_by: user.user_id,
+          },
+        });
+        materialCost += line.quantity * toNumber(item.unit_cost);
+        results.push(after);
+      }
+      await tx.maintenanceRequest.update({
+        where: { id: request.id },
+        data: { material_cost: { increment: round(materialCost) }, updated_at: new Date() },
+      });
+      return results;
+    });
+
+    for (const item of updatedItems) {
+      await this.alertIfLow(item);
+    }
+    return this.getRequestMaterials(request.id, user);
+  }
+
+  /**
+   * Put unused stock back from a work order, reversing its material cost
+   */
+  async returnToStock(requestId: string, movementId: string, user: JWTClaims) {
+    if (!CONSUMER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to use inventory');
+    }
+    const movement = await this.prisma.inventoryMovement.findFirst({
+      where: {
+        id: movementId,
+        maintenance_request_id: requestId,
+        movement_type: 'consume',
+        ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+      },
+    });
+    if (!movement) {
+      throw new Error('material usage not found');
+    }
+    const returned = await this.prisma.inventoryMovement.findUnique({ where: { source_movement_id: movement.id }, select: { id: true } });
+    if (returned) {
+      throw new Error('material usage already returned');
+    }
+
+    const quantity = -toNumber(movement.quantity);
+    await this.prisma.$transaction(async (tx) => {
+      const item = await tx.inventoryItem.update({
+        where: { id: movement.item_id },
+        data: { quantity: { increment: quantity }, updated_at: new Date() },
+      });
+      await tx.inventoryMovement.create({
+        data: {
+          item_id: movement.item_id,
+          company_id: movement.company_id,
+          movement_type: 'return',
+          quantity,
+          unit_cost: movement.unit_cost,
+          quantity_after: item.quantity,
+          maintenance_request_id: requestId,
+          source_movement_id: movement.id,
+          performed_by: user.user_id,
+        },
+      });
+      await tx.maintenanceRequest.update({
+        where: { id: requestId },
+        data: { material_cost: { decrement: round(quantity * toNumber(movement.unit_cost)) }, updated_at: new Date() },
+      });
+    });
+    return this.getRequestMaterials(requestId, user);
+  }
+
+  /**
+   * Materials drawn for a work order, net of returns
+   */
+  async getRequestMaterials(requestId: string, user: JWTClaims) {
+    const request = await this.prisma.maintenanceRequest.findFirst({
+      where: { id: requestId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, material_cost: true },
+    });
+    if (!request) {
+      throw new Error('Maintenance request not found');
+    }
+    const movements = await this.prisma.inventoryMovement.findMany({
+      where: { maintenance_request_id: request.id },
+      include: { item: { select: { id: true, name: true, sku: true, unit: true } } },
+      orderBy: { created_at: 'asc' },
+    });
+    const returnedIds = new Set(movements.map(m => m.source_movement_id).filter(Boolean));
+
+    return {
+      maintenance_request_id: request.id,
+      material_cost: toNumber(request.material_cost),
+      items: movements
+        .filter(m => m.movement_type === 'consume')
+        .map(m => ({
+          movement_id: m.id,
+          item: m.item,
+          quantity: -toNumber(m.quantity),
+          unit_cost: toNumber(m.unit_cost),
+          total_cost: round(-toNumber(m.quantity) * toNumber(m.unit_cost)),
+          returned: returnedIds.has(m.id),
+          used_at: m.created_at,
+          used_by: m.performed_by,
+        })),
+    };
+  }
+
+  private validateItem(req: InventoryItemRequest) {
+    if (req.category !== undefined && !INVENTORY_CATEGORIES.includes(req.category)) {
+      throw new Error(`category must be one of: ${INVENTORY_CATEGORIES.join(', ')}`);
+    }
+    for (const field of ['quantity', 'reorder_level', 'unit_cost'] as const) {
+      const value = req[field];
+      if (value !== undefined && (typeof value !== 'number' || value < 0)) {
+        throw new Error(`${field} must be zero or more`);
+      }
+    }
+  }
+
+  /**
+   * Alert the property owner and agency admins once when an item reaches its reorder level
+   */
+  private async alertIfLow(item: any) {
+    if (toNumber(item.quantity) > toNumber(item.reorder_level) || item.low_stock_alerted_at) return;
+    try {
+      await this.prisma.inventoryItem.update({ where: { id: item.id }, data: { low_stock_alerted_at: new Date() } });
+
+      const [property, admins] = await Promise.all([
+        item.property_id
+          ? this.prisma.property.findUnique({ where: { id: item.property_id }, select: { name: true, owner_id: true } })
+          : null,
+        this.prisma.user.findMany({
+          where: { company_id: item.company_id, role: { in: ['agency_admin', 'landlord'] }, status: 'active' },
+          select: { id: true },
+        }),
+      ]);
+      const recipients = new Set([property?.owner_id, ...admins.map(a => a.id)].filter(Boolean) as string[]);
+      const store = property ? `${property.name} store` : 'the central store';
+
+      for (const recipientId of recipients) {
+        const { notificationsService } = await import('./notifications.service.js');
+        await notificationsService.notify({
+          company_id: item.company_id,
+          recipient_id: recipientId,
+          title: `Low stock: ${item.name}`,
+          message: `${item.name} in ${store} is down to ${toNumber(item.quantity)} ${item.unit} (reorder level ${toNumber(item.reorder_level)}).`,
+          notification_type: 'maintenance',
+          category: 'maintenance',
+          priority: toNumber(item.quantity) <= 0 ? 'high' : 'medium',
+          property_id: item.property_id,
+          related_entity_type: 'inventory_item',
+          related_entity_id: item.id,
+          action_required: true,
+          metadata: { inventory_item_id: item.id, quantity: toNumber(item.quantity) },
+        });
+      }
+    } catch (error: any) {
+      console.error('⚠️ Failed to send low stock alert:', error.message);
+    }
+  }
+}
+
+export const inventoryService = new InventoryService();
@@ -2,6 +2,7 @@ import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import { getNextInvoiceNumber, generatePropertyCode } from '../utils/invoice-number-generator.js';
 import { UsersService } from './users.service.js';
+import { propertyDelegationsService, DelegationAction } from './property-delegations.service.js';
 
 export interface InvoiceFilters {
   tenant_id?: string;
@@ -31,6 +32,7 @@ export interface CreateInvoiceRequest {
   utility_bills?: UtilityBill[];
   items?: InvoiceItem[];
   currency?: string;
+  lease_id?: string; // lease the charge belongs to, kept in metadata (short-stay invoices)
 }
 
 export interface UtilityBill {
@@ -207,6 +209,7 @@ export class InvoicesService {
             amount: bill.amount.toString() // Convert amount to string
           })),
           created_via: 'manual',
+          ...(req.lease_id && { lease_id: req.lease_id }),
         })),
       },
       include: {
@@ -721,7 +724,7 @@ export class InvoicesService {
         hasPermission = true;
       }
       // Company admin can delete invoices from their company
-      else if (user.role === 'agency_admin' && user.company_id === invoice.company_id) {
+      else if (user.role === 'agency_admin' && await this.agencyMayActOn(user, invoice, 'manage')) {
         hasPermission = true;
       }
       // Landlord can delete invoices they created or from their company
@@ -797,7 +800,7 @@ export class InvoicesService {
       let hasPermission = false;
       if (user.role === 'super_admin') {
         hasPermission = true;
-      } else if (user.role === 'agency_admin' && user.company_id === invoice.company_id) {
+      } else if (user.role === 'agency_admin' && await this.agencyMayActOn(user, invoice, 'collect')) {
         hasPermission = true;
       } else if (user.role === 'landlord' && 
                  (invoice.issued_by === user.user_id || user.company_id === invoice.company_id)) {
@@ -886,19 +889,23 @@ export class InvoicesService {
         },
       });
 
-      // TODO: Implement actual email/SMS sending logic here
-      // For now, just log the action
+      // The tenant is notified in-app; push and the requested email/SMS go through the delivery
+      // queue for whichever channels they accept
       const sendMethod = sendOptions?.method || 'email';
-      console.log(`📧 Invoice ${invoice.invoice_number} sent via ${sendMethod} to ${invoice.recipient?.email || 'unknown recipient'}`);
+      const requestedChannels = sendMethod === 'both' ? ['email', 'sms'] : [sendMethod];
+      const { notificationsService } = await import('./notifications.service.js');
+      const acceptedChannels = updatedInvoice.recipient?.id
+        ? await notificationsService.resolveChannels(updatedInvoice.recipient.id, 'invoice', ['push', ...requestedChannels], 'payment_due', 'high')
+        : [];
+      const deliveryChannels = acceptedChannels.filter(channel => requestedChannels.includes(channel));
+      console.log(`📧 Invoice ${invoice.invoice_number} sent via ${deliveryChannels.join(', ') || 'app only'} to ${invoice.recipient?.email || 'unknown recipient'}`);
 
-      // Create notification and send push notification to tenant
       if (updatedInvoice.recipient?.id) {
         try {
-          const { notificationsService } = await import('./notifications.service.js');
-          const tenantName = invoice.recipient ? `${invoice.recipient.first_name} ${invoice.recipient.last_name}`.trim() : 'Tenant';
-          
-          await notificationsService.createNotification(user, {
-            recipientId: updatedInvoice.recipient.id,
+          await notificationsService.notify({
+            company_id: updatedInvoice.company_id,
+            sender_id: user.user_id,
+            recipient_id: updatedInvoice.recipient.id,
             title: `New Invoice: ${updatedInvoice.invoice_number}`,
             message: `You have a new invoice for ${updatedInvoice.currency || 'KES'} ${Number(updatedInvoice.total_amount).toLocaleString()}. Due date: ${new Date(updatedInvoice.due_date).toLocaleDateString()}`,
             notification_type: 'invoice',
@@ -908,16 +915,14 @@ export class InvoicesService {
             unit_id: updatedInvoice.unit_id,
             action_url: `/tenant/invoices/${updatedInvoice.id}`,
             action_required: true,
-            channels: ['app', 'push'], // Include push in channels array
+            channels: ['app'],
             metadata: {
               invoice_id: updatedInvoice.id,
               invoice_number: updatedInvoice.invoice_number,
-              amount: updatedInvoice.total_amount,
+              amount: Number(updatedInvoice.total_amount),
               due_date: updatedInvoice.due_date,
             },
-          });
-          
-          console.log(`✅ Push notification sent for invoice ${updatedInvoice.invoice_number} to tenant ${updatedInvoice.recipient.id}`);
+          }, acceptedChannels);
         } catch (notificationError) {
           console.error('❌ Error sending notification for invoice:', notificationError);
           // Don't fail invoice sending if notification fails
@@ -965,7 +970,7 @@ export class InvoicesService {
           amount: Number(item.unit_price),
           type: (item.metadata as any)?.type || 'item',
         })),
-        sent_via: [sendMethod], // Track how it was sent
+        sent_via: deliveryChannels, // Track how it was sent (after recipient preferences)
         reminder_count: 0,
         last_reminder_date: null,
         created_by: updatedInvoice.issued_by,
@@ -1008,7 +1013,7 @@ export class InvoicesService {
       let hasPermission = false;
       if (user.role === 'super_admin') {
         hasPermission = true;
-      } else if (user.role === 'agency_admin' && user.company_id === invoice.company_id) {
+      } else if (user.role === 'agency_admin' && await this.agencyMayActOn(user, invoice, 'collect')) {
         hasPermission = true;
       } else if (user.role === 'landlord' && 
                  (invoice.issued_by === user.user_id || user.company_id === invoice.company_id)) {
@@ -1235,7 +1240,7 @@ export class InvoicesService {
       let hasPermission = false;
       if (user.role === 'super_admin') {
         hasPermission = true;
-      } else if (user.role === 'agency_admin' && user.company_id === invoice.company_id) {
+      } else if (user.role === 'agency_admin' && await this.agencyMayActOn(user, invoice, 'collect')) {
         hasPermission = true;
       } else if (user.role === 'landlord' && 
                  (invoice.issued_by === user.user_id || user.company_id === invoice.company_id)) {
@@ -1404,6 +1409,15 @@ export class InvoicesService {
     }
   }
 
+  /**
+   * Agency admins act on their own agency's property invoices, and on a delegated property's invoices
+   * as far as the delegation's scope allows (rent collection may send and settle, not delete)
+   */
+  private async agencyMayActOn(user: JWTClaims, invoice: { company_id: string; property_id: string | null }, action: DelegationAction) {
+    if (!invoice.property_id) return user.company_id === invoice.company_id;
+    return propertyDelegationsService.agencyCan(user, { id: invoice.property_id }, action);
+  }
+
   private hasTenantAccess(tenant: any, user: JWTClaims): boolean {
     // Super admin has access to all tenants
     if (user.role === 'super_admin') return true;
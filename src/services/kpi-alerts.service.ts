@@ -0,0 +1,380 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+
+export const KPI_METRICS: Record<string, { label: string; unit: 'percent' | 'amount'; default_operator: string }> = {
+  occupancy_rate: { label: 'Occupancy rate', unit: 'percent', default_operator: 'below' },
+  collection_rate: { label: 'Collection rate', unit: 'percent', default_operator: 'below' },
+  arrears_amount: { label: 'Arrears', unit: 'amount', default_operator: 'above' },
+};
+export const KPI_OPERATORS = ['below', 'above'];
+
+const RULE_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+// Collection rate looks at invoices that fell due over this many days
+const COLLECTION_WINDOW_DAYS = 30;
+const MAX_FEED = 100;
+
+type Measures = Record<string, number | null>;
+
+interface KpiAlertRuleRequest {
+  name?: string;
+  metric?: string;
+  operator?: string;
+  threshold?: number;
+  property_id?: string | null;
+  is_active?: boolean;
+}
+
+const round = (n: number) => Math.round(n * 100) / 100;
+
+const formatValue = (metric: string, value: number) =>
+  KPI_METRICS[metric]?.unit === 'percent' ? `${round(value)}%` : round(value).toLocaleString();
+
+/**
+ * Landlord-defined thresholds on portfolio KPIs. The scheduler evaluates active rules; a rule that
+ * crosses its threshold opens an alert in the dashboard feed and notifies its creator, and the
+ * alert resolves once the figure is back on the right side.
+ */
+export class KpiAlertsService {
+  private prisma = getPrisma();
+
+  private scopeWhere(user: JWTClaims) {
+    if (user.role === 'super_admin') return {};
+    if (RULE_ROLES.includes(user.role)) return { company_id: user.company_id };
+    return { company_id: user.company_id, created_by: user.user_id };
+  }
+
+  private async getEditable(id: string, user: JWTClaims) {
+    const rule = await this.prisma.kpiAlertRule.findFirst({ where: { id, ...this.scopeWhere(user) } });
+    if (!rule) {
+      throw new Error('Alert rule not found');
+    }
+    if (!RULE_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to change alert rules');
+    }
+    return rule;
+  }
+
+  getOptions() {
+    return {
+      metrics: Object.entries(KPI_METRICS).map(([metric, definition]) => ({ metric, ...definition })),
+      operators: KPI_OPERATORS,
+      collection_window_days: COLLECTION_WINDOW_DAYS,
+    };
+  }
+
+  async listRules(user: JWTClaims) {
+    const rules = await this.prisma.kpiAlertRule.findMany({
+      where: this.scopeWhere(user),
+      include: { property: { select: { id: true, name: true } } },
+      orderBy: { created_at: 'desc' },
+    });
+    return rules.map(rule => ({
+      ...rule,
+      threshold: Number(rule.threshold),
+      last_value: rule.last_value === null ? null : Number(rule.last_value),
+    }));
+  }
+
+  private async buildData(req: KpiAlertRuleRequest, user: JWTClaims, existing?: { metric: string; operator: string }) {
+    const data: Record<string, any> = {};
+    if (req.name !== undefined) {
+      if (!String(req.name).trim()) {
+        throw new Error('name is required');
+      }
+      data.name = String(req.name).trim();
+    }
+    if (req.metric !== undefined) {
+      if (!KPI_METRICS[req.metric]) {
+        throw new Error(`metric must be one of: ${Object.keys(KPI_METRICS).join(', ')}`);
+      }
+      data.metric = req.metric;
+    }
+    const metric = data.metric || existing?.metric;
+    if (req.operator !== undefined) {
+      if (!KPI_OPERATORS.includes(req.operator)) {
+        throw new Error(`operator must be one of: ${KPI_OPERATORS.join(', ')}`);
+      }
+      data.operator = req.operator;
+    } else if (!existing) {
+      data.operator = KPI_METRICS[metric].default_operator;
+    }
+    if (req.threshold !== undefined) {
+      const threshold = Number(req.threshold);
+      if (!Number.isFinite(threshold) || threshold < 0) {
+        throw new Error('threshold must be a number of zero or more');
+      }
+      if (KPI_METRICS[metric].unit === 'percent' && threshold > 100) {
+        throw new Error('threshold must be a percentage between 0 and 100');
+      }
+      data.threshold = threshold;
+    }
+    if (req.property_id !== undefined) {
+      if (req.property_id) {
+        const property = await this.prisma.property.findFirst({
+          where: { id: req.property_id, ...buildWhereClause(user) },
+          select: { id: true },
+        });
+        if (!property) {
+          throw new Error('Property not found');
+        }
+      }
+      data.property_id = req.property_id || null;
+    }
+    if (req.is_active !== undefined) data.is_active = Boolean(req.is_active);
+    return data;
+  }
+
+  async createRule(req: KpiAlertRuleRequest, user: JWTClaims) {
+    if (!RULE_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to create alert rules');
+    }
+    if (!req.name || !req.metric || req.threshold === undefined || req.threshold === null) {
+      throw new Error('name, metric and threshold are required');
+    }
+    const data = await this.buildData(req, user);
+    const rule = await this.prisma.kpiAlertRule.create({
+      data: {
+        name: data.name,
+        metric: data.metric,
+        operator: data.operator,
+        threshold: data.threshold,
+        property_id: data.property_id || null,
+        is_active: data.is_active ?? true,
+        company_id: user.company_id || null,
+        created_by: user.user_id,
+      },
+    });
+    // Show where it stands straight away rather than at the next scheduled check
+    return this.evaluate(rule, user, await this.measure(user, rule.property_id));
+  }
+
+  async updateRule(id: string, req: KpiAlertRuleRequest, user: JWTClaims) {
+    const existing = await this.getEditable(id, user);
+    const data = await this.buildData(req, user, existing);
+    const changed = ['metric', 'operator', 'threshold', 'property_id'].some(key => key in data);
+    const rule = await this.prisma.kpiAlertRule.update({
+      where: { id },
+      data: {
+        ...data,
+        // A changed condition starts over: the next evaluation decides whether it is breached
+        ...(changed && { is_breached: false }),
+        updated_at: new Date(),
+      },
+    });
+    if (changed) {
+      await this.prisma.kpiAlert.updateMany({
+        where: { rule_id: id, status: 'open' },
+        data: { status: 'resolved', resolved_at: new Date() },
+      });
+    }
+    if (!rule.is_active) return rule;
+    return this.evaluate(rule, user, await this.measure(user, rule.property_id));
+  }
+
+  async deleteRule(id: string, user: JWTClaims) {
+    await this.getEditable(id, user);
+    await this.prisma.kpiAlertRule.delete({ where: { id } });
+  }
+
+  /**
+   * Alerts for the rules the user can see, newest first
+   */
+  async getFeed(user: JWTClaims, filters: { status?: string; limit?: number; offset?: number } = {}) {
+    const limit = Math.min(Number(filters.limit) || 20, MAX_FEED);
+    const where: any = {
+      rule: this.scopeWhere(user),
+      ...(filters.status && { status: filters.status }),
+    };
+    const [alerts, total, open] = await Promise.all([
+      this.prisma.kpiAlert.findMany({
+        where,
+        include: { rule: { select: { id: true, name: true, property: { select: { id: true, name: true } } } } },
+        orderBy: { triggered_at: 'desc' },
+        take: limit,
+        skip: Number(filters.offset) || 0,
+      }),
+      this.prisma.kpiAlert.count({ where }),
+      this.prisma.kpiAlert.count({ where: { rule: this.scopeWhere(user), status: 'open' } }),
+    ]);
+    return {
+      alerts: alerts.map(alert => ({
+        ...alert,
+        threshold: Number(alert.threshold),
+        value: Number(alert.value),
+        resolved_value: alert.resolved_value === null ? null : Number(alert.resolved_value),
+      })),
+      total,
+      open,
+    };
+  }
+
+  async acknowledge(id: string, user: JWTClaims) {
+    const alert = await this.prisma.kpiAlert.findFirst({ where: { id, rule: this.scopeWhere(user) } });
+    if (!alert) {
+      throw new Error('Alert not found');
+    }
+    return this.prisma.kpiAlert.update({
+      where: { id },
+      data: { acknowledged_at: new Date(), acknowledged_by: user.user_id },
+    });
+  }
+
+  /**
+   * Evaluate every active rule with its creator's current access. Rules watching the same
+   * properties for the same user share one set of figures.
+   */
+  async evaluateAll(now: Date = new Date()) {
+    const rules = await this.prisma.kpiAlertRule.findMany({
+      where: { is_active: true },
+      include: {
+        creator: {
+          select: { id: true, email: true, phone_number: true, role: true, company_id: true, agency_id: true, landlord_id: true, status: true },
+        },
+      },
+    });
+    const measured = new Map<string, Measures>();
+    let triggered = 0;
+    let resolved = 0;
+
+    for (const { creator, ...rule } of rules) {
+      if (creator.status !== 'active') continue;
+      try {
+        const user = {
+          user_id: creator.id,
+          email: creator.email || '',
+          phone_number: creator.phone_number || '',
+          role: creator.role,
+          company_id: creator.company_id || undefined,
+          agency_id: creator.agency_id || undefined,
+          landlord_id: creator.landlord_id || undefined,
+        } as JWTClaims;
+        const key = `${creator.id}:${rule.property_id || ''}`;
+        if (!measured.has(key)) measured.set(key, await this.measure(user, rule.property_id, now));
+
+        const wasBreached = rule.is_breached;
+        const updated = await this.evaluate(rule, user, measured.get(key)!, now);
+        if (updated.is_breached && !wasBreached) triggered++;
+        if (!updated.is_breached && wasBreached) resolved++;
+      } catch (error: any) {
+        console.error(`⚠️ Failed to evaluate alert rule ${rule.id}:`, error.message);
+      }
+    }
+    return { evaluated: rules.length, triggered, resolved };
+  }
+
+  /**
+   * Current KPI figures for the properties the user can see (or one of them). Figures with
+   * nothing to measure, like a collection rate with no invoices due, are null.
+   */
+  private async measure(user: JWTClaims, propertyId: string | null, now: Date = new Date()): Promise<Measures> {
+    const propertyWhere = { ...buildWhereClause(user), ...(propertyId && { id: propertyId }) };
+    const invoiceWhere = { OR: [{ property: propertyWhere }, { unit: { property: propertyWhere } }] };
+    const since = new Date(now.getTime() - COLLECTION_WINDOW_DAYS * 24 * 60 * 60 * 1000);
+    const dueWhere = { AND: [invoiceWhere, { due_date: { gte: since, lte: now } }] };
+
+    const [units, due, paid, arrears] = await Promise.all([
+      this.prisma.unit.groupBy({ by: ['status'], where: { property: propertyWhere }, _count: { _all: true } }),
+      this.prisma.invoice.aggregate({
+        where: { ...dueWhere, status: { in: ['sent', 'paid', 'overdue'] } },
+        _sum: { total_amount: true },
+      }),
+      this.prisma.invoice.aggregate({ where: { ...dueWhere, status: 'paid' }, _sum: { total_amount: true } }),
+      this.prisma.invoice.aggregate({
+        where: { AND: [invoiceWhere, { OR: [{ status: 'overdue' }, { status: 'sent', due_date: { lt: now } }] }] },
+        _sum: { total_amount: true },
+      }),
+    ]);
+
+    const totalUnits = units.reduce((sum, group) => sum + group._count._all, 0);
+    const occupied = units.find(group => group.status === 'occupied')?._count._all || 0;
+    const dueAmount = Number(due._sum.total_amount || 0);
+    return {
+      occupancy_rate: totalUnits > 0 ? round((occupied / totalUnits) * 100) : null,
+      collection_rate: dueAmount > 0 ? round((Number(paid._sum.total_amount || 0) / dueAmount) * 100) : null,
+      arrears_amount: round(Number(arrears._sum.total_amount || 0)),
+    };
+  }
+
+  /**
+   * Record the rule's current figure; open an alert when it newly crosses the threshold and
+   * resolve open ones when it is back
+   */
+  private async evaluate(rule: any, user: JWTClaims, measures: Measures, now: Date = new Date()) {
+    const value = measures[rule.metric];
+    if (value === null || value === undefined) {
+      return this.prisma.kpiAlertRule.update({ where: { id: rule.id }, data: { last_evaluated_at: now } });
+    }
+    const threshold = Number(rule.threshold);
+    const breached = rule.operator === 'below' ? value < threshold : value > threshold;
+
+    if (breached && !rule.is_breached) {
+      await this.trigger(rule, user, value, now);
+    } else if (!breached && rule.is_breached) {
+      await this.prisma.kpiAlert.updateMany({
+        where: { rule_id: rule.id, status: 'open' },
+        data: { status: 'resolved', resolved_at: now, resolved_value: value },
+      });
+    }
+
+    return this.prisma.kpiAlertRule.update({
+      where: { id: rule.id },
+      data: {
+        is_breached: breached,
+        last_value: value,
+        last_evaluated_at: now,
+        ...(breached && !rule.is_breached && { last_triggered_at: now }),
+      },
+    });
+  }
+
+  private async trigger(rule: any, user: JWTClaims, value: number, now: Date) {
+    const definition = KPI_METRICS[rule.metric];
+    const property = rule.property_id
+      ? await this.prisma.property.findUnique({ where: { id: rule.property_id }, select: { name: true } })
+      : null;
+    const scope = property ? `at ${property.name}` : 'across your portfolio';
+    const message = `${definition.label} ${scope} is ${formatValue(rule.metric, value)}, ` +
+      `${rule.operator} your alert threshold of ${formatValue(rule.metric, Number(rule.threshold))}.`;
+
+    const alert = await this.prisma.kpiAlert.create({
+      data: {
+        rule_id: rule.id,
+        company_id: rule.company_id,
+        property_id: rule.property_id,
+        metric: rule.metric,
+        operator: rule.operator,
+        threshold: rule.threshold,
+        value,
+        message,
+        triggered_at: now,
+      },
+    });
+
+    // Notifications belong to a company; rules without one only show in the feed
+    if (!rule.company_id) return alert;
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      const channels = await notificationsService.resolveChannels(user.user_id, 'kpi_alert', ['email'], 'general', 'high');
+      await notificationsService.notify({
+        company_id: rule.company_id,
+        recipient_id: user.user_id,
+        title: `Alert: ${rule.name}`,
+        message,
+        notification_type: 'kpi_alert',
+        category: 'general',
+        priority: 'high',
+        action_required: true,
+        action_url: '/dashboard',
+        related_entity_type: 'kpi_alert',
+        related_entity_id: alert.id,
+        metadata: { rule_id: rule.id, metric: rule.metric, value, threshold: Number(rule.threshold), property_id: rule.property_id },
+      }, channels);
+    } catch (error: any) {
+      console.error('⚠️ Failed to send KPI alert notification:', error.message);
+    }
+    return alert;
+  }
+}
+
+export const kpiAlertsService = new KpiAlertsService();
@@ -0,0 +1,233 @@
+import axios from 'axios';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { ocrService, IdDocumentFields } from './ocr.service.js';
+import { TenantsService } from './tenants.service.js';
+
+export const ID_DOCUMENT_CATEGORIES = ['national_id', 'passport', 'id_document', 'identification'];
+
+export interface KycMismatch {
+  field: 'name' | 'id_number' | 'date_of_birth';
+  entered: string;
+  extracted: string;
+}
+
+export interface ReviewKycRequest {
+  decision: 'approve' | 'reject';
+  notes?: string;
+  apply_extracted?: boolean; // overwrite entered ID number / DOB with the values read from the document
+}
+
+const normalizeId = (value: string) => value.replace(/[^a-z0-9]/gi, '').toUpperCase();
+const nameTokens = (value: string) =>
+  value.toLowerCase().normalize('NFD').replace(/[\u0300-\u036f]/g, '').split(/[^a-z]+/).filter(t => t.length > 1);
+const isoDate = (value: Date | null | undefined) => (value ? value.toISOString().split('T')[0] : null);
+
+export class KycService {
+  private prisma = getPrisma();
+  private tenantsService = new TenantsService();
+
+  isIdDocument(category?: string | null, mimeType?: string | null): boolean {
+    return !!category && ID_DOCUMENT_CATEGORIES.includes(category) && !!mimeType?.startsWith('image/');
+  }
+
+  /**
+   * Read an uploaded ID document, pre-fill empty profile fields and flag mismatches for review.
+   * The image buffer can be passed straight from the upload; otherwise it is downloaded from storage.
+   */
+  async processDocument(documentId: string, user: JWTClaims, image?: { buffer: Buffer; mimeType: string }): Promise<any> {
+    const document = await this.prisma.tenantDocument.findUnique({ where: { id: documentId } });
+    if (!document) {
+      throw new Error('document not found');
+    }
+    await this.tenantsService.getTenant(document.tenant_id, user);
+
+    const verification = await this.prisma.kycVerification.create({
+      data: {
+        company_id: document.company_id,
+        tenant_id: document.tenant_id,
+        document_id: document.id,
+        status: 'processing',
+      },
+    });
+
+    try {
+      let buffer = image?.buffer;
+      let mimeType = image?.mimeType || document.type;
+      if (!buffer) {
+        const download = await axios.get(document.url, { responseType: 'arraybuffer', timeout: 30000 });
+        buffer = Buffer.from(download.data);
+        mimeType = download.headers['content-type'] || mimeType;
+      }
+
+      const fields = await ocrService.extractIdDocument(buffer, mimeType);
+      const { mismatches, prefilled } = await this.compareAndPrefill(document.tenant_id, fields);
+      const status = mismatches.length > 0 ? 'needs_review' : 'auto_verified';
+
+      if (status === 'needs_review') {
+        await this.prisma.tenantDocument.update({
+          where: { id: document.id },
+          data: { status: 'needs_review', updated_at: new Date() },
+        });
+      }
+
+      console.log(`🪪 KYC ${status} for tenant ${document.tenant_id} (${mismatches.length} mismatch(es), prefilled: ${prefilled.join(', ') || 'none'})`);
+
+      return this.prisma.kycVerification.update({
+        where: { id: verification.id },
+        data: {
+          status,
+          document_type: fields.document_type,
+          extracted_name: fields.full_name || [fields.first_name, fields.last_name].filter(Boolean).join(' ') || null,
+          extracted_id_number: fields.id_number,
+          extracted_dob: fields.date_of_birth ? new Date(fields.date_of_birth) : null,
+          extracted_data: fields as any,
+          mismatches: mismatches as any,
+          prefilled_fields: prefilled,
+          updated_at: new Date(),
+        },
+      });
+    } catch (error: any) {
+      console.error(`❌ KYC extraction failed for document ${documentId}:`, error.message);
+      return this.prisma.kycVerification.update({
+        where: { id: verification.id },
+        data: { status: 'failed', error_message: error.message, updated_at: new Date() },
+      });
+    }
+  }
+
+  /**
+   * Compare extracted fields with what the landlord/tenant entered. Empty profile fields are
+   * pre-filled from the document; existing values are never overwritten here.
+   */
+  private async compareAndPrefill(tenantId: string, fields: IdDocumentFields) {
+    const tenant = await this.prisma.user.findUnique({
+      where: { id: tenantId },
+      include: { tenant_profile: true },
+    });
+    if (!tenant) {
+      throw new Error('tenant not found');
+    }
+
+    const mismatches: KycMismatch[] = [];
+    const prefilled: string[] = [];
+    const profile = (tenant as any).tenant_profile;
+
+    // Name: every entered name part must appear on the document
+    const extractedName = fields.full_name || [fields.first_name, fields.last_name].filter(Boolean).join(' ');
+    if (extractedName) {
+      const enteredName = `${tenant.first_name} ${tenant.last_name}`.trim();
+      const documentTokens = new Set(nameTokens(extractedName));
+      const missing = nameTokens(enteredName).filter(t => !documentTokens.has(t));
+      if (missing.length > 0) {
+        mismatches.push({ field: 'name', entered: enteredName, extracted: extractedName });
+      }
+    }
+
+    const enteredId = profile?.id_number || tenant.id_number;
+    if (fields.id_number) {
+      if (enteredId && normalizeId(enteredId) !== normalizeId(fields.id_number)) {
+        mismatches.push({ field: 'id_number', entered: enteredId, extracted: fields.id_number });
+      }
+    }
+
+    const enteredDob = isoDate(profile?.date_of_birth);
+    if (fields.date_of_birth && enteredDob && enteredDob !== fields.date_of_birth) {
+      mismatches.push({ field: 'date_of_birth', entered: enteredDob, extracted: fields.date_of_birth });
+    }
+
+    if (fields.id_number && !tenant.id_number) {
+      await this.prisma.user.update({ where: { id: tenantId }, data: { id_number: fields.id_number.slice(0, 50) } });
+      prefilled.push('user.id_number');
+    }
+    if (profile) {
+      const profileData: any = {};
+      if (fields.id_number && !profile.id_number) profileData.id_number = fields.id_number.slice(0, 50);
+      if (fields.date_of_birth && !profile.date_of_birth) profileData.date_of_birth = new Date(fields.date_of_birth);
+      if (fields.nationality && !profile.nationality) profileData.nationality = fields.nationality.slice(0, 100);
+      if (Object.keys(profileData).length > 0) {
+        await this.prisma.tenantProfile.update({ where: { id: profile.id }, data: { ...profileData, updated_at: new Date() } });
+        prefilled.push(...Object.keys(profileData).map(k => `tenant_profile.${k}`));
+      }
+    }
+
+    return { mismatches, prefilled };
+  }
+
+  async getVerifications(tenantId: string, user: JWTClaims): Promise<any[]> {
+    await this.tenantsService.getTenant(tenantId, user);
+
+    return this.prisma.kycVerification.findMany({
+      where: { tenant_id: tenantId },
+      include: { document: { select: { id: true, name: true, category: true, url: true, status: true } } },
+      orderBy: { created_at: 'desc' },
+    });
+  }
+
+  /**
+   * Re-run OCR on an existing document (e.g. after OCR was unavailable at upload time)
+   */
+  async reprocessDocument(tenantId: string, documentId: string, user: JWTClaims): Promise<any> {
+    const document = await this.prisma.tenantDocument.findFirst({ where: { id: documentId, tenant_id: tenantId } });
+    if (!document) {
+      throw new Error('document not found');
+    }
+    return this.processDocument(document.id, user);
+  }
+
+  /**
+   * Manual review of a flagged verification
+   */
+  async reviewVerification(tenantId: string, verificationId: string, req: ReviewKycRequest, user: JWTClaims): Promise<any> {
+    if (!['super_admin', 'agency_admin', 'landlord', 'agent'].includes(user.role)) {
+      throw new Error('insufficient permissions to review KYC verifications');
+    }
+    if (!['approve', 'reject'].includes(req.decision)) {
+      throw new Error("decision must be 'approve' or 'reject'");
+    }
+    await this.tenantsService.getTenant(tenantId, user);
+
+    const verification = await this.prisma.kycVerification.findFirst({
+      where: { id: verificationId, tenant_id: tenantId },
+    });
+    if (!verification) {
+      throw new Error('verification not found');
+    }
+    if (['approved', 'rejected', 'processing'].includes(verification.status)) {
+      throw new Error(`verification cannot be reviewed while ${verification.status}`);
+    }
+
+    if (req.decision === 'approve' && req.apply_extracted) {
+      if (verification.extracted_id_number) {
+        await this.prisma.user.update({
+          where: { id: tenantId },
+          data: { id_number: verification.extracted_id_number },
+        });
+      }
+      await this.prisma.tenantProfile.updateMany({
+        where: { user_id: tenantId },
+        data: {
+          ...(verification.extracted_id_number && { id_number: verification.extracted_id_number }),
+          ...(verification.extracted_dob && { date_of_birth: verification.extracted_dob }),
+          updated_at: new Date(),
+        },
+      });
+    }
+
+    await this.prisma.tenantDocument.update({
+      where: { id: verification.document_id },
+      data: { status: req.decision === 'approve' ? 'approved' : 'rejected', updated_at: new Date() },
+    });
+
+    return this.prisma.kycVerification.update({
+      where: { id: verificationId },
+      data: {
+        status: req.decision === 'approve' ? 'approved' : 'rejected',
+        reviewed_by: user.user_id,
+        reviewed_at: new Date(),
+        review_notes: req.notes || null,
+        updated_at: new Date(),
+      },
+    });
+  }
+}
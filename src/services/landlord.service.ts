@@ -1,16 +1,34 @@
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
+import { reportsService } from './reports.service.js';
+import { getUnitStatsByProperty } from './properties.service.js';
 
 const prisma = getPrisma();
 
+// Unit counts and occupied rent for a scope, from one grouped query
+const summarizeUnits = async (where: any) => {
+  const groups = await prisma.unit.groupBy({
+    by: ['status'],
+    where,
+    _count: { _all: true },
+    _sum: { rent_amount: true },
+  });
+  const occupied = groups.find(g => g.status === 'occupied');
+  return {
+    total: groups.reduce((acc, g) => acc + g._count._all, 0),
+    occupied: occupied?._count._all || 0,
+    occupiedRent: Number(occupied?._sum.rent_amount || 0),
+  };
+};
+
 export const landlordService = {
   // Dashboard services
   getDashboard: async (user: JWTClaims) => {
     const whereClause = user.company_id ? { company_id: user.company_id } : {};
 
-    const [properties, units, tenants, maintenanceRequests] = await Promise.all([
+    const [properties, unitSummary, tenants, maintenanceRequests] = await Promise.all([
       prisma.property.count({ where: whereClause }),
-      prisma.unit.count({ where: whereClause }),
+      summarizeUnits(whereClause),
       prisma.user.count({ 
         where: { 
           ...whereClause,
@@ -25,28 +43,13 @@ export const landlordService = {
       }),
     ]);
 
-    const occupiedUnits = await prisma.unit.count({
-      where: { 
-        ...whereClause,
-        status: 'occupied' 
-      }
-    });
-
+    const units = unitSummary.total;
+    const occupiedUnits = unitSummary.occupied;
     const vacantUnits = units - occupiedUnits;
     const occupancyRate = units > 0 ? (occupiedUnits / units) * 100 : 0;
 
-    // Calculate monthly revenue from occupied units only
-    const monthlyRevenue = await prisma.unit.aggregate({
-      where: { 
-        ...whereClause,
-        status: 'occupied' 
-      },
-      _sum: {
-        rent_amount: true
-      }
-    });
-
-    const monthlyRevenueAmount = Number(monthlyRevenue._sum.rent_amount || 0);
+    // Monthly revenue from occupied units only
+    const monthlyRevenueAmount = unitSummary.occupiedRent;
 
     return {
       total_properties: properties,
@@ -128,42 +131,15 @@ export const landlordService = {
     });
 
     // Transform properties to match frontend expectations with proper calculations
-    const transformedProperties = await Promise.all(properties.map(async (property: any) => {
-      // Get accurate unit counts using separate queries to ensure consistency
-      const [totalUnits, occupiedUnits, vacantUnits] = await Promise.all([
-        prisma.unit.count({
-          where: { property_id: property.id }
-        }),
-        prisma.unit.count({
-          where: { property_id: property.id, status: 'occupied' }
-        }),
-        prisma.unit.count({
-          where: { property_id: property.id, status: 'vacant' }
-        })
-      ]);
-
-      // Calculate monthly revenue from occupied units
-      const revenueResult = await prisma.unit.aggregate({
-        where: { 
-          property_id: property.id, 
-          status: 'occupied' 
-        },
-        _sum: {
-          rent_amount: true
-        }
-      });
-
-      const monthlyRevenue = Number(revenueResult._sum.rent_amount || 0);
-
+    const unitStats = await getUnitStatsByProperty(properties.map((property: any) => property.id));
+    const transformedProperties = properties.map((property: any) => {
+      const stats = unitStats.get(property.id) || { total_units: 0, occupied_units: 0, vacant_units: 0, monthly_revenue: 0 };
       return {
         ...property,
-        total_units: totalUnits,
-        occupied_units: occupiedUnits,
-        vacant_units: vacantUnits,
-        monthly_revenue: monthlyRevenue,
-        occupancy_rate: totalUnits > 0 ? Math.round((occupiedUnits / totalUnits) * 100) : 0,
+        ...stats,
+        occupancy_rate: stats.total_units > 0 ? Math.round((stats.occupied_units / stats.total_units) * 100) : 0,
       };
-    }));
+    });
 
     return {
       properties: transformedProperties,
@@ -230,72 +206,32 @@ export const landlordService = {
   getTenants: async (user: JWTClaims, filters: any) => {
     console.log('🔍 landlordService.getTenants - User:', { role: user.role, user_id: user.user_id });
 
-    // 🔒 CRITICAL: Landlord must ONLY see tenants from THEIR OWN properties
-    const landlordProperties = await prisma.property.findMany({
-      where: { owner_id: user.user_id },
-      select: { 
-        id: true,
-        name: true,
-        units: { select: { id: true, unit_number: true, current_tenant_id: true } },
-      },
-    });
-    
-    console.log(`📊 Found ${landlordProperties.length} properties for landlord:`, landlordProperties.map(p => ({ id: p.id, name: p.name, units: p.units.length })));
-    
-    const propertyIds = landlordProperties.map(p => p.id);
-    const directTenantIds = landlordProperties.flatMap(p => p.units.map(u => u.current_tenant_id)).filter(id => id !== null);
-    
-    console.log(`👥 Units with tenants:`, landlordProperties.flatMap(p => p.units.filter(u => u.current_tenant_id).map(u => ({ unit: u.unit_number, tenant_id: u.current_tenant_id }))));
-    
-    if (propertyIds.length === 0) {
-      console.log('⚠️ Landlord has no properties - returning empty result');
-      return { tenants: [], total: 0 };
-    }
-    
-    // ✅ SIMPLIFIED: Just filter by tenant IDs found in units + leases
-    let allTenantIds: string[] = [];
-    
-    if (directTenantIds.length === 0 && propertyIds.length > 0) {
-      // Check if there are any leases for these properties
-      const leases = await prisma.lease.findMany({
-        where: { property_id: { in: propertyIds } },
-        select: { tenant_id: true },
-      });
-      const leaseTenantIds = [...new Set(leases.map((l: any) => l.tenant_id))];
-      
-      if (leaseTenantIds.length === 0) {
-        console.log('⚠️ Landlord has no tenants (no units occupied, no leases) - returning empty result');
-        return { tenants: [], total: 0 };
-      }
-      
-      allTenantIds = leaseTenantIds;
-      console.log('✅ Landlord filter applied (leases only) - tenant_ids:', leaseTenantIds.length);
-    } else {
-      // Get additional tenant IDs from leases
-      const leases = await prisma.lease.findMany({
-        where: { property_id: { in: propertyIds } },
-        select: { tenant_id: true },
-      });
-      const leaseTenantIds = leases.map((l: any) => l.tenant_id);
-      allTenantIds = [...new Set([...directTenantIds, ...leaseTenantIds])];
-      
-      console.log('✅ Landlord filter applied - tenant_ids:', allTenantIds.length, '(from units:', directTenantIds.length, ', from leases:', leaseTenantIds.length, ')');
-    }
-    
+    // 🔒 CRITICAL: Landlord must ONLY see tenants from THEIR OWN properties:
+    // anyone living in one of their units or holding a lease on one of their properties
+    const ownedProperty = { property: { owner_id: user.user_id } };
     const whereClause: any = {
       role: 'tenant',
-      id: { in: allTenantIds },
+      AND: [
+        {
+          OR: [
+            { assigned_units: { some: ownedProperty } },
+            { tenant_leases: { some: ownedProperty } },
+          ],
+        },
+      ],
     };
 
     if (filters.status) {
       whereClause.status = filters.status;
     }
     if (filters.search_query) {
-      whereClause.OR = [
-        { first_name: { contains: filters.search_query, mode: 'insensitive' } },
-        { last_name: { contains: filters.search_query, mode: 'insensitive' } },
-        { email: { contains: filters.search_query, mode: 'insensitive' } },
-      ];
+      whereClause.AND.push({
+        OR: [
+          { first_name: { contains: filters.search_query, mode: 'insensitive' } },
+          { last_name: { contains: filters.search_query, mode: 'insensitive' } },
+          { email: { contains: filters.search_query, mode: 'insensitive' } },
+        ],
+      });
     }
 
     const tenants = await prisma.user.findMany({
@@ -329,32 +265,38 @@ export const landlordService = {
   getFinancialOverview: async (user: JWTClaims) => {
     const whereClause = user.company_id ? { company_id: user.company_id } : {};
 
-    const totalRevenue = await prisma.unit.aggregate({
-      where: { 
-        ...whereClause,
-        status: 'occupied' 
-      },
-      _sum: {
-        rent_amount: true
-      }
-    });
+    const unitSummary = await summarizeUnits(whereClause);
+    const totalUnits = unitSummary.total;
+    const occupiedUnits = unitSummary.occupied;
 
-    const totalUnits = await prisma.unit.count({ where: whereClause });
-    const occupiedUnits = await prisma.unit.count({
-      where: { 
-        ...whereClause,
-        status: 'occupied' 
-      }
+    const arrears = await reportsService.getArrearsAgingReport(user);
+
+    // Expenses this month against the month's rent roll
+    const now = new Date();
+    const { expensesService } = await import('./expenses.service.js');
+    const expenses = await expensesService.summarize(user, {
+      start_date: new Date(now.getFullYear(), now.getMonth(), 1).toISOString(),
+      end_date: now.toISOString(),
     });
+    const monthlyRevenue = unitSummary.occupiedRent;
+
+    // Month-by-month occupancy from stored snapshots, with lease-derived figures for the gaps
+    const { occupancyHistoryService } = await import('./occupancy-history.service.js');
+    const occupancyTrend = await occupancyHistoryService.getTrend(user, { months: 12 });
 
     return {
-      monthly_revenue: Number(totalRevenue._sum.rent_amount || 0),
-      annual_revenue: Number(totalRevenue._sum.rent_amount || 0) * 12,
+      monthly_revenue: monthlyRevenue,
+      annual_revenue: monthlyRevenue * 12,
       total_units: totalUnits,
       occupied_units: occupiedUnits,
       occupancy_rate: totalUnits > 0 ? (occupiedUnits / totalUnits) * 100 : 0,
       collection_rate: 95, // TODO: Calculate from actual payments
-      outstanding_amount: 0, // TODO: Calculate from invoices
+      outstanding_amount: arrears.summary.total,
+      arrears_aging: arrears.summary,
+      monthly_expenses: expenses.total,
+      expenses_by_category: expenses.byCategory,
+      net_operating_income: Math.round((monthlyRevenue - expenses.total) * 100) / 100,
+      occupancy_trend: occupancyTrend.months,
     };
   },
 
@@ -487,14 +429,10 @@ export const landlordService = {
     };
   },
 
-  // Communication services (placeholder)
+  // Communication services
   getCommunicationOverview: async (user: JWTClaims) => {
-    return {
-      total_messages: 0,
-      unread_messages: 0,
-      sent_messages: 0,
-      received_messages: 0,
-    };
+    const { communicationAnalyticsService } = await import('./communication-analytics.service.js');
+    return communicationAnalyticsService.getOverview(user);
   },
 
   getMessages: async (user: JWTClaims, filters: any) => {
@@ -508,9 +446,10 @@ export const landlordService = {
   getReports: async (user: JWTClaims, reportType?: string, period: string = 'monthly') => {
     const whereClause = user.company_id ? { company_id: user.company_id } : {};
 
-    const [properties, units, tenants] = await Promise.all([
+    const [properties, units, occupiedUnits, tenants] = await Promise.all([
       prisma.property.count({ where: whereClause }),
       prisma.unit.count({ where: whereClause }),
+      prisma.unit.count({ where: { ...whereClause, status: 'occupied' } }),
       prisma.user.count({ 
         where: { 
           ...whereClause,
@@ -526,7 +465,7 @@ export const landlordService = {
         properties,
         units,
         tenants,
-        occupancy_rate: 85, // TODO: Calculate actual rate
+        occupancy_rate: units > 0 ? Math.round((occupiedUnits / units) * 10000) / 100 : 0,
         revenue: 0, // TODO: Calculate from payments
       },
       generated_at: new Date().toISOString(),
@@ -534,15 +473,18 @@ export const landlordService = {
   },
 
   generatePropertyReport: async (user: JWTClaims, params: any) => {
-    return await landlordService.getReports(user, 'property', params.period);
+    const { reportsService } = await import('./reports.service.js');
+    return await reportsService.getPropertyReport(user, params || {});
   },
 
   generateFinancialReport: async (user: JWTClaims, params: any) => {
-    return await landlordService.getReports(user, 'financial', params.period);
+    const { reportsService } = await import('./reports.service.js');
+    return await reportsService.getFinancialReport(user, params?.type || 'revenue', params?.period || 'monthly');
   },
 
   generateOccupancyReport: async (user: JWTClaims, period: string) => {
-    return await landlordService.getReports(user, 'occupancy', period);
+    const { reportsService } = await import('./reports.service.js');
+    return await reportsService.getOccupancyReport(user, period || 'monthly');
   },
 
   getRentCollectionDetails: async (user: JWTClaims, filters: any) => {
@@ -1,6 +1,8 @@
+import { Prisma } from '@prisma/client';
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import { UsersService } from './users.service.js';
+import { ShortStayService, calculateStayPrice, countNights } from './short-stay.service.js';
 
 export interface LeaseFilters {
   tenant_id?: string;
@@ -41,6 +43,11 @@ export interface CreateLeaseRequest {
   notes?: string;
   currency?: string;
   late_fee_grace_days?: number;
+  // Short-stay leases (lease_type = 'short_stay'); default to the unit's short-stay rates
+  nightly_rate?: number;
+  weekly_rate?: number;
+  cleaning_fee?: number;
+  guest_count?: number;
 }
 
 export interface UpdateLeaseRequest {
@@ -62,11 +69,13 @@ export interface UpdateLeaseRequest {
   special_terms?: string;
   notes?: string;
   status?: string;
+  guest_count?: number;
 }
 
 export class LeasesService {
   private prisma = getPrisma();
   private usersService = new UsersService();
+  private shortStayService = new ShortStayService();
 
 
   // FULL IMPLEMENTATION - PRISMA MIGRATION COMPLETE
@@ -169,7 +178,11 @@ export class LeasesService {
       throw new Error('unit not found');
     }
 
-    if (unit.status !== 'vacant') {
+    const isShortStay = req.lease_type === 'short_stay';
+    const shortStay = isShortStay ? await this.prepareShortStay(req, unit) : null;
+
+    // Short stays are checked against the booking calendar instead of the unit's occupancy status
+    if (!isShortStay && unit.status !== 'vacant') {
       throw new Error('unit is not available for lease');
     }
 
@@ -188,7 +201,7 @@ export class LeasesService {
       const leaseNumber = await this.generateLeaseNumber(companyId, retryCount);
 
       // Create lease
-      const lease = await this.prisma.lease.create({
+      const insertLease = (db: Prisma.TransactionClient) => db.lease.create({
         data: {
           lease_number: leaseNumber,
           tenant_id: req.tenant_id,
@@ -199,11 +212,17 @@ export class LeasesService {
           start_date: new Date(req.start_date),
           end_date: req.end_date ? new Date(req.end_date) : new Date(new Date(req.start_date).getTime() + 365 * 24 * 60 * 60 * 1000), // Default to 1 year from start
           move_in_date: req.move_in_date ? new Date(req.move_in_date) : null,
-          rent_amount: req.rent_amount,
+          rent_amount: shortStay ? shortStay.quote.total_amount : req.rent_amount,
           deposit_amount: req.deposit_amount,
           currency: defaultCurrency,
-          payment_frequency: req.payment_frequency as any || 'monthly',
+          payment_frequency: shortStay ? shortStay.paymentFrequency : (req.payment_frequency as any || 'monthly'),
           payment_day: preferredPaymentDay,
+          ...(shortStay && {
+            nightly_rate: shortStay.quote.nightly_rate,
+            weekly_rate: shortStay.quote.weekly_rate,
+            cleaning_fee: shortStay.quote.cleaning_fee,
+            guest_count: req.guest_count ?? null,
+          }),
           late_fee_grace_days: gracePeriod,
           notice_period_days: req.notice_period_days || 30,
           renewable: req.renewable ?? true,
@@ -241,19 +260,30 @@ export class LeasesService {
         }
       });
 
-      // Update unit status to occupied and assign tenant
-      await this.prisma.unit.update({
-        where: { id: req.unit_id },
-        data: {
-          status: 'occupied' as any,
-          current_tenant_id: req.tenant_id,
-          lease_start_date: new Date(req.start_date),
-          lease_end_date: req.end_date ? new Date(req.end_date) : null,
-          lease_type: req.lease_type as any,
-        }
-      });
+      // A short stay's lease and calendar entry are written together with the availability check
+      const lease = shortStay
+        ? await this.shortStayService.reserveDates(req.unit_id, shortStay.checkIn, shortStay.checkOut, async (tx) => {
+          const created = await insertLease(tx);
+          await this.shortStayService.createLeaseBooking(created, `${created.tenant.first_name} ${created.tenant.last_name}`, tx);
+          return created;
+        })
+        : await insertLease(this.prisma);
+
+      if (!shortStay) {
+        // Update unit status to occupied and assign tenant
+        await this.prisma.unit.update({
+          where: { id: req.unit_id },
+          data: {
+            status: 'occupied' as any,
+            current_tenant_id: req.tenant_id,
+            lease_start_date: new Date(req.start_date),
+            lease_end_date: req.end_date ? new Date(req.end_date) : null,
+            lease_type: req.lease_type as any,
+          }
+        });
+      }
 
-      // Auto-generate invoices for deposit and first month's rent
+      // Auto-generate invoices for deposit and first month's rent (or the stay charges for short stays)
       if (preferences?.auto_rent_invoices !== false) {
         try {
           const { InvoicesService } = await import('./invoices.service.js');
@@ -290,8 +320,10 @@ export class LeasesService {
             console.log(`✅ Auto-generated DEPOSIT invoice ${depositInvoice.invoice_number} for ${defaultCurrency} ${req.deposit_amount}`);
           }
 
-          // 2. Create FIRST MONTH RENT invoice
-          if (req.rent_amount && req.rent_amount > 0) {
+          // 2. Short stays are billed for the stay itself rather than monthly rent
+          if (shortStay) {
+            await this.generateShortStayInvoices(lease, shortStay.quote, shortStay.paymentFrequency, defaultCurrency, invoicesService, user);
+          } else if (req.rent_amount && req.rent_amount > 0) {
             const rentInvoice = await invoicesService.createInvoice({
               tenant_id: req.tenant_id,
               property_id: req.property_id,
@@ -314,6 +346,14 @@ export class LeasesService {
         }
       }
 
+      // 💬 Tenancy group chat for tenant, landlord and property staff
+      try {
+        const { tenancyChatsService } = await import('./tenancy-chats.service.js');
+        await tenancyChatsService.openForLease(lease.id);
+      } catch (chatError: any) {
+        console.error('⚠️ Failed to open tenancy chat:', chatError.message);
+      }
+
       // 📄 Record lease snapshot at creation (new revision)
       try {
         const { documentService } = await import('../modules/documents/document-service.js');
@@ -348,6 +388,32 @@ export class LeasesService {
       throw new Error('insufficient permissions to update leases');
     }
 
+    // Moving a short stay must not collide with other bookings on the unit, and re-prices it
+    let stayQuote: ReturnType<typeof calculateStayPrice> | null = null;
+    if (existingLease.lease_type === 'short_stay' && (req.start_date || req.end_date)) {
+      const checkIn = new Date(req.start_date || existingLease.start_date);
+      const checkOut = new Date(req.end_date || existingLease.end_date);
+      const nights = countNights(checkIn, checkOut);
+      if (nights < 1) {
+        throw new Error('end_date must be after start_date');
+      }
+      const unit = await this.prisma.unit.findUnique({ where: { id: existingLease.unit_id }, select: { min_stay_nights: true } });
+      if (unit && nights < unit.min_stay_nights) {
+        throw new Error(`minimum stay for this unit is ${unit.min_stay_nights} nights`);
+      }
+      stayQuote = calculateStayPrice(
+        nights,
+        Number(existingLease.nightly_rate || 0),
+        existingLease.weekly_rate ? Number(existingLease.weekly_rate) : null,
+        existingLease.cleaning_fee ? Number(existingLease.cleaning_fee) : null
+      );
+      await this.assertStayInvoicesSettled(existingLease);
+      await this.shortStayService.reserveDates(existingLease.unit_id, checkIn, checkOut, (tx) => tx.unitBooking.updateMany({
+        where: { lease_id: id, status: { not: 'cancelled' } },
+        data: { check_in: checkIn, check_out: checkOut, updated_at: new Date() },
+      }), { leaseId: id });
+    }
+
     const lease = await this.prisma.lease.update({
       where: { id },
       data: {
@@ -363,6 +429,10 @@ export class LeasesService {
         ...(req.rent_amount !== undefined && { rent_amount: req.rent_amount }),
         ...(req.deposit_amount !== undefined && { deposit_amount: req.deposit_amount }),
         ...(req.payment_frequency && { payment_frequency: req.payment_frequency }),
+        ...(stayQuote && {
+          rent_amount: stayQuote.total_amount,
+          payment_frequency: existingLease.payment_frequency === 'weekly' && stayQuote.nights > 7 ? 'weekly' : 'per_stay',
+        }),
         ...(req.payment_day !== undefined && { payment_day: req.payment_day }),
         ...(req.notice_period_days !== undefined && { notice_period_days: req.notice_period_days }),
         ...(req.renewable !== undefined && { renewable: req.renewable }),
@@ -373,6 +443,7 @@ export class LeasesService {
         ...(req.special_terms !== undefined && { special_terms: req.special_terms }),
         ...(req.notes !== undefined && { notes: req.notes }),
         ...(req.status && { status: req.status as any }),
+        ...(req.guest_count !== undefined && { guest_count: req.guest_count }),
         updated_at: new Date(),
       },
       include: {
@@ -400,6 +471,11 @@ export class LeasesService {
       },
     });
 
+    if (stayQuote) {
+      const stay_repricing = await this.reissueShortStayInvoices(lease, existingLease, stayQuote, user);
+      return { ...lease, stay_repricing };
+    }
+
     return lease;
   }
 
@@ -529,15 +605,53 @@ export class LeasesService {
       },
     });
 
-    // Update unit status to vacant
-    await this.prisma.unit.update({
-      where: { id: existingLease.unit_id },
-      data: {
-        status: 'vacant',
-        current_tenant_id: null,
-        updated_at: new Date(),
-      },
-    });
+    if (existingLease.lease_type === 'short_stay') {
+      // Short stays never marked the unit occupied; just free the calendar dates
+      await this.shortStayService.releaseLeaseBookings(id);
+    } else {
+      // Update unit status to vacant
+      await this.prisma.unit.update({
+        where: { id: existingLease.unit_id },
+        data: {
+          status: 'vacant',
+          current_tenant_id: null,
+          updated_at: new Date(),
+        },
+      });
+
+      // Offer the freed unit to the next person on the property's waiting list
+      const { UnitApplicationsService } = await import('./unit-applications.service.js');
+      await new UnitApplicationsService().notifyUnitVacated(existingLease.unit_id);
+
+      // Caretaker gets a move-out walkthrough task
+      try {
+        const { caretakerAssignmentService } = await import('./caretaker-assignment.service.js');
+        await caretakerAssignmentService.createMoveTask({
+          company_id: existingLease.company_id,
+          property_id: existingLease.property_id,
+          unit_id: existingLease.unit_id,
+          type: 'move_out',
+          date: new Date(),
+          tenant_name: existingLease.tenant ? `${existingLease.tenant.first_name} ${existingLease.tenant.last_name}` : undefined,
+        }, user.user_id);
+      } catch (taskError: any) {
+        console.error('⚠️ Failed to create move-out task:', taskError.message);
+      }
+    }
+
+    // Draft the deposit settlement so the final account is ready for review
+    if (existingLease.lease_type !== 'short_stay') {
+      const { DepositSettlementService } = await import('./deposit-settlement.service.js');
+      await new DepositSettlementService().autoCalculate(id, user);
+    }
+
+    // 💬 Tenancy chat becomes read-only history
+    try {
+      const { tenancyChatsService } = await import('./tenancy-chats.service.js');
+      await tenancyChatsService.archiveForLease(id);
+    } catch (chatError: any) {
+      console.error('⚠️ Failed to archive tenancy chat:', chatError.message);
+    }
 
     // 📄 Record lease snapshot at termination (new revision)
     try {
@@ -591,6 +705,187 @@ export class LeasesService {
     return newLease;
   }
 
+  /**
+   * Validate a short-stay lease against the unit's short-stay settings and booking calendar,
+   * and price the stay. Short stays are billed per stay, or weekly when requested.
+   */
+  private async prepareShortStay(req: CreateLeaseRequest, unit: any) {
+    if (!unit.short_stay_enabled) {
+      throw new Error('unit is not configured for short stays');
+    }
+    if (!req.end_date) {
+      throw new Error('end_date is required for short-stay leases');
+    }
+
+    const checkIn = new Date(req.start_date);
+    const checkOut = new Date(req.end_date);
+    const nights = countNights(checkIn, checkOut);
+    if (nights < 1) {
+      throw new Error('end_date must be after start_date');
+    }
+    if (nights < unit.min_stay_nights) {
+      throw new Error(`minimum stay for this unit is ${unit.min_stay_nights} nights`);
+    }
+
+    const nightlyRate = Number(req.nightly_rate ?? unit.nightly_rate ?? 0);
+    if (nightlyRate <= 0) {
+      throw new Error('nightly_rate is required for short-stay leases');
+    }
+
+    const conflicts = await this.shortStayService.findConflicts(req.unit_id, checkIn, checkOut);
+    if (conflicts.length > 0) {
+      throw new Error('unit is already booked for the selected dates');
+    }
+
+    const quote = calculateStayPrice(
+      nights,
+      nightlyRate,
+      req.weekly_rate ?? (unit.weekly_rate ? Number(unit.weekly_rate) : null),
+      req.cleaning_fee ?? (unit.cleaning_fee ? Number(unit.cleaning_fee) : null)
+    );
+    const paymentFrequency = req.payment_frequency === 'weekly' && nights > 7 ? 'weekly' : 'per_stay';
+
+    return { quote, paymentFrequency, checkIn, checkOut };
+  }
+
+  /**
+   * A short stay's live stay invoices. Invoices raised before they carried the lease are found by
+   * tenant, unit and the stay's dates.
+   */
+  private async findStayInvoices(lease: { id: string; start_date: Date; end_date: Date; tenant_id: string; unit_id: string }) {
+    return this.prisma.invoice.findMany({
+      where: {
+        invoice_type: 'short_stay',
+        status: { not: 'cancelled' },
+        OR: [
+          { metadata: { path: ['lease_id'], equals: lease.id } },
+          {
+            issued_to: lease.tenant_id,
+            unit_id: lease.unit_id,
+            due_date: { gte: new Date(lease.start_date), lt: new Date(lease.end_date) },
+          },
+        ],
+      },
+      select: { id: true, invoice_number: true, status: true, total_amount: true },
+    });
+  }
+
+  /**
+   * Re-pricing cancels unpaid stay invoices, which would strand a part payment; those have to be
+   * settled or refunded before the dates can move
+   */
+  private async assertStayInvoicesSettled(lease: { id: string; start_date: Date; end_date: Date; tenant_id: string; unit_id: string }) {
+    const open = (await this.findStayInvoices(lease)).filter(invoice => invoice.status !== 'paid');
+    if (open.length === 0) return;
+    const payments = await this.prisma.payment.groupBy({
+      by: ['invoice_id'],
+      where: { invoice_id: { in: open.map(invoice => invoice.id) }, status: { in: ['approved', 'completed'] } },
+      _sum: { amount: true },
+    });
+    const partlyPaid = open.filter(invoice => payments.some(p => p.invoice_id === invoice.id && Number(p._sum.amount || 0) > 0));
+    if (partlyPaid.length > 0) {
+      throw new Error(`stay invoice ${partlyPaid.map(invoice => invoice.invoice_number).join(', ')} is partly paid; settle or refund it before changing the stay dates`);
+    }
+  }
+
+  /**
+   * After a short stay's dates change, cancel its unpaid stay invoices and bill the new price: in
+   * full when nothing was paid yet, otherwise the balance on top of what was paid. A stay that was
+   * never invoiced is left that way. An overpayment is reported for the manager to refund.
+   */
+  private async reissueShortStayInvoices(
+    lease: any,
+    previous: { start_date: Date; end_date: Date; tenant_id: string; unit_id: string },
+    quote: ReturnType<typeof calculateStayPrice>,
+    user: JWTClaims
+  ) {
+    const invoices = await this.findStayInvoices({ ...previous, id: lease.id });
+    if (invoices.length === 0) {
+      return { total_amount: quote.total_amount, paid: 0, balance: quote.total_amount, cancelled: 0, reissued: 0 };
+    }
+
+    const paid = invoices.filter(invoice => invoice.status === 'paid').reduce((sum, invoice) => sum + Number(invoice.total_amount), 0);
+    const unpaid = invoices.filter(invoice => invoice.status !== 'paid').map(invoice => invoice.id);
+    if (unpaid.length > 0) {
+      await this.prisma.invoice.updateMany({ where: { id: { in: unpaid } }, data: { status: 'cancelled', updated_at: new Date() } });
+    }
+
+    const { InvoicesService } = await import('./invoices.service.js');
+    const invoicesService = new InvoicesService();
+    const balance = Math.round((quote.total_amount - paid) * 100) / 100;
+    let reissued = 0;
+    if (paid === 0) {
+      reissued = await this.generateShortStayInvoices(lease, quote, lease.payment_frequency, lease.currency, invoicesService, user);
+    } else if (balance > 0) {
+      await invoicesService.createInvoice({
+        tenant_id: lease.tenant_id,
+        property_id: lease.property_id,
+        unit_id: lease.unit_id,
+        title: 'Short Stay - Balance',
+        description: `Balance for ${quote.nights} night(s) at ${lease.property.name} - Unit ${lease.unit.unit_number} after the stay dates changed`,
+        invoice_type: 'short_stay',
+        rent_amount: balance,
+        total_amount: balance,
+        due_date: new Date(lease.start_date).toISOString().split('T')[0],
+        utility_bills: [],
+        currency: lease.currency,
+        lease_id: lease.id,
+      }, user);
+      reissued = 1;
+    }
+
+    console.log(`✅ Re-priced short stay ${lease.lease_number}: ${lease.currency} ${quote.total_amount}, ${unpaid.length} invoice(s) cancelled, ${reissued} issued`);
+    return { total_amount: quote.total_amount, paid, balance, cancelled: unpaid.length, reissued };
+  }
+
+  /**
+   * Raise the stay invoices for a short-stay lease: a single invoice due at check-in, or one
+   * invoice per week of the stay (cleaning fee on the first) for weekly billing.
+   */
+  private async generateShortStayInvoices(
+    lease: any,
+    quote: ReturnType<typeof calculateStayPrice>,
+    paymentFrequency: string,
+    currency: string,
+    invoicesService: any,
+    user: JWTClaims
+  ): Promise<number> {
+    const checkIn = new Date(lease.start_date);
+    const unitLabel = `${lease.property.name} - Unit ${lease.unit.unit_number}`;
+    const periods: Array<{ start: Date; nights: number; amount: number }> = [];
+
+    if (paymentFrequency === 'weekly') {
+      for (let offset = 0; offset < quote.nights; offset += 7) {
+        const nights = Math.min(7, quote.nights - offset);
+        const start = new Date(checkIn.getTime() + offset * 24 * 60 * 60 * 1000);
+        const amount = calculateStayPrice(nights, quote.nightly_rate, quote.weekly_rate).accommodation_total;
+        periods.push({ start, nights, amount: offset === 0 ? amount + quote.cleaning_fee : amount });
+      }
+    } else {
+      periods.push({ start: checkIn, nights: quote.nights, amount: quote.total_amount });
+    }
+
+    for (const [index, period] of periods.entries()) {
+      const invoice = await invoicesService.createInvoice({
+        tenant_id: lease.tenant_id,
+        property_id: lease.property_id,
+        unit_id: lease.unit_id,
+        title: periods.length > 1 ? `Short Stay - Week ${index + 1}` : 'Short Stay',
+        description: `${period.nights} night(s) at ${unitLabel} from ${period.start.toISOString().split('T')[0]}`,
+        invoice_type: 'short_stay',
+        rent_amount: period.amount,
+        total_amount: period.amount,
+        due_date: period.start.toISOString().split('T')[0],
+        utility_bills: [],
+        currency,
+        lease_id: lease.id,
+      }, user);
+
+      console.log(`✅ Auto-generated SHORT STAY invoice ${invoice.invoice_number} for ${currency} ${period.amount}`);
+    }
+    return periods.length;
+  }
+
   private async generateLeaseNumber(companyId: string, attempt: number = 0): Promise<string> {
     const now = new Date();
     const year = now.getFullYear();
@@ -895,6 +1190,14 @@ export class LeasesService {
     });
 
     // Don't update unit status since the tenant is already there and unit is already occupied
+
+    // 💬 Tenancy group chat for tenant, landlord and property staff
+    try {
+      const { tenancyChatsService } = await import('./tenancy-chats.service.js');
+      await tenancyChatsService.openForLease(lease.id);
+    } catch (chatError: any) {
+      console.error('⚠️ Failed to open tenancy chat:', chatError.message);
+    }
     
     // 📄 Record lease snapshot at creation (new revision)
     try {
@@ -0,0 +1,193 @@
+import { getPrisma } from '../config/prisma.js';
+
+export interface MaintenanceAnalyticsQuery {
+  months?: string;
+  property_id?: string;
+  repeat_window_days?: string;
+}
+
+const DAY = 24 * 60 * 60 * 1000;
+// Properties spending this multiple of the portfolio's cost per unit are flagged
+const COST_OUTLIER_FACTOR = 1.5;
+
+const round = (value: number) => Math.round(value * 10) / 10;
+const money = (value: number) => Math.round(value * 100) / 100;
+const monthKey = (date: Date) => date.toISOString().slice(0, 7);
+
+/**
+ * Trend analytics behind the maintenance overview: time to resolution, category and property
+ * trends by month, units with recurring problems and cost per unit against the portfolio
+ */
+export class MaintenanceAnalyticsService {
+  private prisma = getPrisma();
+
+  async getAnalytics(where: any, query: MaintenanceAnalyticsQuery = {}) {
+    const months = Math.min(Math.max(parseInt(query.months || '6', 10) || 6, 1), 24);
+    const repeatWindowDays = Math.min(Math.max(parseInt(query.repeat_window_days || '90', 10) || 90, 7), 365);
+    const since = new Date();
+    since.setUTCDate(1);
+    since.setUTCHours(0, 0, 0, 0);
+    since.setUTCMonth(since.getUTCMonth() - (months - 1));
+
+    const scope = { ...where, ...(query.property_id && { property_id: query.property_id }) };
+    const requests = await this.prisma.maintenanceRequest.findMany({
+      where: { ...scope, created_at: { gte: since } },
+      select: {
+        id: true,
+        title: true,
+        property_id: true,
+        unit_id: true,
+        category: true,
+        priority: true,
+        status: true,
+        created_at: true,
+        resolved_at: true,
+        completed_date: true,
+        actual_cost: true,
+        material_cost: true,
+        property: { select: { id: true, name: true } },
+        unit: { select: { id: true, unit_number: true } },
+      },
+      orderBy: { created_at: 'asc' },
+    });
+
+    const monthKeys: string[] = [];
+    for (let i = 0; i < months; i++) {
+      const d = new Date(since);
+      d.setUTCMonth(since.getUTCMonth() + i);
+      monthKeys.push(monthKey(d));
+    }
+
+    return {
+      period: { from: since, months },
+      mttr: this.meanTimeToResolution(requests, monthKeys),
+      category_trends: this.trend(requests, monthKeys, r => r.category),
+      property_trends: this.trend(requests, monthKeys, r => r.property_id, r => r.property?.name),
+      repeat_issues: this.repeatIssues(requests, repeatWindowDays),
+      cost_per_unit: await this.costPerUnit(requests),
+    };
+  }
+
+  /**
+   * Hours from report to resolution for completed work, overall, by priority and by month resolved
+   */
+  private meanTimeToResolution(requests: any[], monthKeys: string[]) {
+    const resolved = requests
+      .filter(r => r.status === 'completed' && (r.resolved_at || r.completed_date))
+      .map(r => ({ ...r, hours: ((r.resolved_at || r.completed_date).getTime() - r.created_at.getTime()) / (60 * 60 * 1000) }))
+      .filter(r => r.hours >= 0);
+    const mean = (rows: any[]) => (rows.length ? round(rows.reduce((sum, r) => sum + r.hours, 0) / rows.length) : null);
+
+    const byPriority: Record<string, number | null> = {};
+    for (const priority of ['urgent', 'high', 'medium', 'low']) {
+      byPriority[priority] = mean(resolved.filter(r => r.priority === priority));
+    }
+    return {
+      hours: mean(resolved),
+      resolved_count: resolved.length,
+      by_priority: byPriority,
+      by_month: monthKeys.map(month => {
+        const rows = resolved.filter(r => monthKey(r.resolved_at || r.completed_date) === month);
+        return { month, hours: mean(rows), resolved: rows.length };
+      }),
+    };
+  }
+
+  private trend(requests: any[], monthKeys: string[], keyOf: (r: any) => string, labelOf?: (r: any) => string | undefined) {
+    const groups = new Map<string, { key: string; label?: string; total: number; cost: number; months: Record<string, number> }>();
+    for (const r of requests) {
+      const key = keyOf(r) || 'other';
+      if (!groups.has(key)) {
+        groups.set(key, { key, label: labelOf?.(r), total: 0, cost: 0, months: Object.fromEntries(monthKeys.map(m => [m, 0])) });
+      }
+      const group = groups.get(key)!;
+      group.total++;
+      group.cost += Number(r.actual_cost || 0) + Number(r.material_cost || 0);
+      const month = monthKey(r.created_at);
+      if (month in group.months) group.months[month]++;
+    }
+    return [...groups.values()]
+      .sort((a, b) => b.total - a.total)
+      .map(group => ({
+        key: group.key,
+        ...(labelOf && { name: group.label || null }),
+        total: group.total,
+        cost: money(group.cost),
+        by_month: monthKeys.map(month => ({ month, count: group.months[month] })),
+      }));
+  }
+
+  /**
+   * The same unit reporting the same category again within the window
+   */
+  private repeatIssues(requests: any[], windowDays: number) {
+    const byUnitCategory = new Map<string, any[]>();
+    for (const r of requests) {
+      if (!r.unit_id) continue;
+      const key = `${r.unit_id}:${r.category}`;
+      byUnitCategory.set(key, [...(byUnitCategory.get(key) || []), r]);
+    }
+
+    const issues = [];
+    for (const rows of byUnitCategory.values()) {
+      if (rows.length < 2) continue;
+      const repeats = rows.filter((r, i) => i > 0 && r.created_at.getTime() - rows[i - 1].created_at.getTime() <= windowDays * DAY);
+      if (!repeats.length) continue;
+      const last = rows[rows.length - 1];
+      issues.push({
+        unit: last.unit,
+        property: last.property,
+        category: last.category,
+        occurrences: rows.length,
+        repeats_within_window: repeats.length,
+        last_reported_at: last.created_at,
+        total_cost: money(rows.reduce((sum, r) => sum + Number(r.actual_cost || 0) + Number(r.material_cost || 0), 0)),
+        requests: rows.map(r => ({ id: r.id, title: r.title, status: r.status, created_at: r.created_at })),
+      });
+    }
+    return issues.sort((a, b) => b.occurrences - a.occurrences);
+  }
+
+  /**
+   * Completed-work spend (labour plus materials) per unit for each property against the portfolio
+   */
+  private async costPerUnit(requests: any[]) {
+    const propertyIds = [...new Set(requests.map(r => r.property_id))];
+    if (!propertyIds.length) {
+      return { portfolio_cost_per_unit: null, properties: [] };
+    }
+    const unitCounts = await this.prisma.unit.groupBy({
+      by: ['property_id'],
+      where: { property_id: { in: propertyIds } },
+      _count: { _all: true },
+    });
+
+    const rows = propertyIds.map(propertyId => {
+      const completed = requests.filter(r => r.property_id === propertyId && r.status === 'completed');
+      const cost = completed.reduce((sum, r) => sum + Number(r.actual_cost || 0) + Number(r.material_cost || 0), 0);
+      const units = unitCounts.find(u => u.property_id === propertyId)?._count._all || 0;
+      return {
+        property: requests.find(r => r.property_id === propertyId)!.property,
+        units,
+        completed_requests: completed.length,
+        total_cost: money(cost),
+        cost_per_unit: units ? money(cost / units) : null,
+      };
+    });
+
+    const totalUnits = rows.reduce((sum, r) => sum + r.units, 0);
+    const portfolio = totalUnits ? money(rows.reduce((sum, r) => sum + r.total_cost, 0) / totalUnits) : null;
+    return {
+      portfolio_cost_per_unit: portfolio,
+      properties: rows
+        .map(r => ({
+          ...r,
+          vs_portfolio: portfolio && r.cost_per_unit !== null ? round((r.cost_per_unit / portfolio) * 100) : null,
+          above_benchmark: !!portfolio && r.cost_per_unit !== null && r.cost_per_unit > portfolio * COST_OUTLIER_FACTOR,
+        }))
+        .sort((a, b) => (b.cost_per_unit ?? -1) - (a.cost_per_unit ?? -1)),
+    };
+  }
+}
+
+export const maintenanceAnalyticsService = new MaintenanceAnalyticsService();
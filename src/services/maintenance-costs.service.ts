@@ -0,0 +1,478 @@
+import crypto from 'crypto';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface CostDecisionRequest {
+  decision: 'approve' | 'reject';
+  notes?: string;
+}
+
+export interface CostApprovalRequest {
+  estimated_cost: number;
+  notes?: string;
+}
+
+export interface AddReceiptRequest {
+  url: string;
+  name?: string;
+  amount?: number;
+}
+
+export interface UpsertBudgetRequest {
+  amount: number;
+  notes?: string;
+}
+
+// Roles that can approve spend; estimates they enter are approved automatically
+const APPROVER_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const MANAGING_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent', 'manager', 'admin'];
+const DEFAULT_APPROVAL_THRESHOLD = 10000;
+const MONTHS = ['Jan', 'Feb', 'Mar', 'Apr', 'May', 'Jun', 'Jul', 'Aug', 'Sep', 'Oct', 'Nov', 'Dec'];
+
+const yearRange = (year: number) => ({ gte: new Date(Date.UTC(year, 0, 1)), lt: new Date(Date.UTC(year + 1, 0, 1)) });
+
+export class MaintenanceCostsService {
+  private prisma = getPrisma();
+
+  async getApprovalThreshold(companyId: string): Promise<number> {
+    const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+    const threshold = ((company?.settings as any) || {}).maintenance_cost_approval_threshold;
+    return threshold != null ? Number(threshold) : DEFAULT_APPROVAL_THRESHOLD;
+  }
+
+  async getCostSettings(user: JWTClaims): Promise<any> {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    return { approval_threshold: await this.getApprovalThreshold(user.company_id) };
+  }
+
+  async updateCostSettings(approvalThreshold: number, user: JWTClaims): Promise<any> {
+    if (!APPROVER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to change maintenance cost settings');
+    }
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    if (typeof approvalThreshold !== 'number' || approvalThreshold < 0) {
+      throw new Error('approval_threshold must be a positive number');
+    }
+
+    const company = await this.prisma.company.findUnique({ where: { id: user.company_id }, select: { settings: true } });
+    await this.prisma.company.update({
+      where: { id: user.company_id },
+      data: {
+        settings: { ...((company?.settings as any) || {}), maintenance_cost_approval_threshold: approvalThreshold },
+        updated_at: new Date(),
+      },
+    });
+    return { approval_threshold: approvalThreshold };
+  }
+
+  /**
+   * Approval fields to store when an estimate is entered or changed. Estimates above the
+   * company threshold need an approver unless an approver entered them.
+   */
+  async approvalFor(companyId: string, estimatedCost: number | null, user: JWTClaims): Promise<any> {
+    if (estimatedCost == null) {
+      return { cost_approval_status: null, cost_approved_by: null, cost_approved_at: null };
+    }
+    const threshold = await this.getApprovalThreshold(companyId);
+    if (estimatedCost <= threshold) {
+      return { cost_approval_status: null, cost_approved_by: null, cost_approved_at: null };
+    }
+    if (APPROVER_ROLES.includes(user.role)) {
+      return { cost_approval_status: 'approved', cost_approved_by: user.user_id, cost_approved_at: new Date() };
+    }
+    return { cost_approval_status: 'pending_approval', cost_approved_by: null, cost_approved_at: null };
+  }
+
+  /**
+   * Why work on a request cannot move forward because of its estimate, or null if it can
+   */
+  workBlockedReason(costApprovalStatus: string | null): string | null {
+    if (costApprovalStatus === 'pending_approval') {
+      return 'estimated cost is awaiting approval; work cannot start yet';
+    }
+    if (costApprovalStatus === 'rejected') {
+      return 'estimated cost was rejected; submit a revised estimate before work continues';
+    }
+    return null;
+  }
+
+  /**
+   * Submit (or resubmit after a rejection) an estimate for approval. Estimates within the
+   * threshold or entered by an approver go through straight away.
+   */
+  async requestApproval(requestId: string, req: CostApprovalRequest, user: JWTClaims): Promise<any> {
+    if (user.role === 'tenant') {
+      throw new Error('insufficient permissions to submit maintenance costs');
+    }
+    if (typeof req.estimated_cost !== 'number' || req.estimated_cost < 0) {
+      throw new Error('estimated_cost must be a positive number');
+    }
+    const request = await this.prisma.maintenanceRequest.findFirst({
+      where: { id: requestId, ...(user.role !== 'super_admin' && { company_id: user.company_id }) },
+    });
+    if (!request) {
+      throw new Error('Maintenance request not found');
+    }
+    if (['completed', 'cancelled'].includes(request.status)) {
+      throw new Error(`maintenance request is already ${request.status}`);
+    }
+
+    const approval = await this.approvalFor(request.company_id, req.estimated_cost, user);
+    const updated = await this.prisma.maintenanceRequest.update({
+      where: { id: request.id },
+      data: { estimated_cost: req.estimated_cost, ...approval, cost_approval_notes: null, updated_at: new Date() },
+    });
+
+    await this.prisma.maintenanceComment.create({
+      data: {
+        request_id: request.id,
+        author_id: user.user_id,
+        comment_type: 'comment',
+        comment: `Estimated cost of ${req.estimated_cost.toLocaleString()} submitted` +
+          (approval.cost_approval_status === 'pending_approval' ? ' for approval' : '') +
+          (req.notes?.trim() ? `: ${req.notes.trim()}` : ''),
+        is_internal: true,
+      },
+    });
+
+    if (approval.cost_approval_status === 'pending_approval') {
+      await this.notifyApprovers(updated, user, req.notes?.trim());
+    }
+    return { ...updated, estimated_cost: Number(updated.estimated_cost), approval_required: approval.cost_approval_status === 'pending_approval' };
+  }
+
+  /**
+   * Tell the property owner and the company's agency admins that an estimate needs a decision
+   */
+  async notifyApprovers(request: any, user: JWTClaims, notes?: string): Promise<void> {
+    try {
+      const [property, admins] = await Promise.all([
+        this.prisma.property.findUnique({ where: { id: request.property_id }, select: { owner_id: true, name: true } }),
+        this.prisma.user.findMany({
+          where: { company_id: request.company_id, role: 'agency_admin', status: 'active' },
+          select: { id: true },
+        }),
+      ]);
+      const recipients = new Set([property?.owner_id, ...admins.map(a => a.id)].filter(Boolean) as string[]);
+      recipients.delete(user.user_id);
+
+      const { notificationsService } = await import('./notifications.service.js');
+      for (const recipientId of recipients) {
+        await notificationsService.createNotification(user, {
+          recipient_id: recipientId,
+          title: 'Maintenance cost needs approval',
+          message: `An estimate of ${Number(request.estimated_cost).toLocaleString()} for "${request.title}" at ${property?.name || 'your property'} ` +
+            `is above the approval threshold.${notes ? ` Note: ${notes}` : ''}`,
+          notification_type: 'maintenance',
+          category: 'maintenance',
+          priority: 'high',
+          property_id: request.property_id,
+          unit_id: request.unit_id,
+          action_required: true,
+          action_url: `/maintenance/${request.id}`,
+          metadata: { maintenance_request_id: request.id, estimated_cost: Number(request.estimated_cost) },
+        });
+      }
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify cost approvers:', error.message);
+    }
+  }
+
+  /**
+   * Approve or reject an estimate that is waiting for approval
+   */
+  async decideCost(requestId: string, req: CostDecisionRequest, user: JWTClaims): Promise<any> {
+    if (!APPROVER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to approve maintenance costs');
+    }
+    if (!['approve', 'reject'].includes(req.decision)) {
+      throw new Error("decision must be 'approve' or 'reject'");
+    }
+    const request = await this.prisma.maintenanceRequest.findFirst({
+      where: { id: requestId, ...(user.role !== 'super_admin' && { company_id: user.company_id }) },
+    });
+    if (!request) {
+      throw new Error('Maintenance request not found');
+    }
+    if (request.cost_approval_status !== 'pending_approval') {
+      throw new Error('maintenance request has no cost awaiting approval');
+    }
+    if (req.decision === 'reject' && !req.notes?.trim()) {
+      throw new Error('notes are required when rejecting a cost');
+    }
+
+    const updated = await this.prisma.maintenanceRequest.update({
+      where: { id: request.id },
+      data: {
+        cost_approval_status: req.decision === 'approve' ? 'approved' : 'rejected',
+        cost_approved_by: user.user_id,
+        cost_approved_at: new Date(),
+        cost_approval_notes: req.notes?.trim() || null,
+        updated_at: new Date(),
+      },
+    });
+
+    await this.prisma.maintenanceComment.create({
+      data: {
+        request_id: request.id,
+        author_id: user.user_id,
+        comment_type: 'comment',
+        comment: `Estimated cost of ${Number(request.estimated_cost).toLocaleString()} ${req.decision === 'approve' ? 'approved' : 'rejected'}` +
+          (req.notes?.trim() ? `: ${req.notes.trim()}` : ''),
+        is_internal: true,
+      },
+    });
+
+    const recipient = request.assigned_to;
+    if (recipient) {
+      try {
+        const { notificationsService } = await import('./notifications.service.js');
+        await notificationsService.createNotification(user, {
+          recipient_id: recipient,
+          title: req.decision === 'approve' ? 'Maintenance cost approved' : 'Maintenance cost rejected',
+          message: `The estimate for "${request.title}" was ${req.decision === 'approve' ? 'approved; work can go ahead' : 'rejected'}.`,
+          notification_type: 'maintenance',
+          category: 'maintenance',
+          priority: 'medium',
+          property_id: request.property_id,
+          metadata: { maintenance_request_id: request.id },
+        });
+      } catch (error: any) {
+        console.error('⚠️ Failed to send cost decision notification:', error.message);
+      }
+    }
+
+    return updated;
+  }
+
+  /**
+   * Requests whose estimates are waiting for an approver
+   */
+  async listPendingApprovals(user: JWTClaims): Promise<any[]> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view maintenance cost approvals');
+    }
+    const requests = await this.prisma.maintenanceRequest.findMany({
+      where: {
+        cost_approval_status: 'pending_approval',
+        ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+      },
+      include: {
+        property: { select: { id: true, name: true } },
+        unit: { select: { id: true, unit_number: true } },
+        vendor: { select: { id: true, name: true } },
+      },
+      orderBy: { updated_at: 'asc' },
+    });
+    return requests.map(r => ({ ...r, vendor_token_hash: undefined, estimated_cost: Number(r.estimated_cost) }));
+  }
+
+  async addReceipt(requestId: string, req: AddReceiptRequest, user: JWTClaims): Promise<any[]> {
+    if (user.role === 'tenant') {
+      throw new Error('insufficient permissions to add receipts');
+    }
+    if (!req.url?.trim()) {
+      throw new Error('url is required');
+    }
+    if (req.amount !== undefined && (typeof req.amount !== 'number' || req.amount < 0)) {
+      throw new Error('amount must be a positive number');
+    }
+    // Same visibility as the request itself, so field staff only add receipts to their own jobs
+    const { MaintenanceService } = await import('./maintenance.service.js');
+    const request = await new MaintenanceService().getAccessibleRequest(requestId, user);
+
+    const receipts = [
+      ...((request.receipts as any[]) || []),
+      {
+        id: crypto.randomUUID(),
+        url: req.url.trim(),
+        name: req.name?.trim() || null,
+        amount: req.amount ?? null,
+        uploaded_by: user.user_id,
+        uploaded_at: new Date().toISOString(),
+      },
+    ];
+    await this.prisma.maintenanceRequest.update({ where: { id: request.id }, data: { receipts, updated_at: new Date() } });
+    return receipts;
+  }
+
+  async removeReceipt(requestId: string, receiptId: string, user: JWTClaims): Promise<any[]> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to remove receipts');
+    }
+    const request = await this.prisma.maintenanceRequest.findFirst({
+      where: { id: requestId, ...(user.role !== 'super_admin' && { company_id: user.company_id }) },
+      select: { id: true, receipts: true },
+    });
+    if (!request) {
+      throw new Error('Maintenance request not found');
+    }
+    const existing = (request.receipts as any[]) || [];
+    const receipts = existing.filter(r => r.id !== receiptId);
+    if (receipts.length === existing.length) {
+      throw new Error('receipt not found');
+    }
+    await this.prisma.maintenanceRequest.update({ where: { id: request.id }, data: { receipts, updated_at: new Date() } });
+    return receipts;
+  }
+
+  private async getCompanyProperty(propertyId: string, user: JWTClaims) {
+    const property = await this.prisma.property.findFirst({
+      where: { id: propertyId, ...(user.role !== 'super_admin' && { company_id: user.company_id }) },
+      select: { id: true, name: true, company_id: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+    return property;
+  }
+
+  async upsertBudget(propertyId: string, year: number, req: UpsertBudgetRequest, user: JWTClaims): Promise<any> {
+    if (!APPROVER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to set maintenance budgets');
+    }
+    if (!Number.isInteger(year) || year < 2000 || year > 2100) {
+      throw new Error('year must be a valid year');
+    }
+    if (typeof req.amount !== 'number' || req.amount < 0) {
+      throw new Error('amount must be a positive number');
+    }
+    const property = await this.getCompanyProperty(propertyId, user);
+
+    return this.prisma.propertyMaintenanceBudget.upsert({
+      where: { property_id_year: { property_id: property.id, year } },
+      create: {
+        company_id: property.company_id,
+        property_id: property.id,
+        year,
+        amount: req.amount,
+        notes: req.notes || null,
+        created_by: user.user_id,
+      },
+      update: { amount: req.amount, notes: req.notes ?? undefined, updated_at: new Date() },
+    });
+  }
+
+  /**
+   * Budget vs spend per property for a year. Spend is the actual cost of completed work plus
+   * materials drawn from inventory; committed is approved or under-threshold estimates on work still open.
+   */
+  async listBudgets(year: number, user: JWTClaims): Promise<any[]> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view maintenance budgets');
+    }
+    const companyFilter = user.role !== 'super_admin' ? { company_id: user.company_id } : {};
+
+    const [budgets, spend, committed] = await Promise.all([
+      this.prisma.propertyMaintenanceBudget.findMany({
+        where: { ...companyFilter, year },
+        include: { property: { select: { id: true, name: true } } },
+      }),
+      this.prisma.maintenanceRequest.groupBy({
+        by: ['property_id'],
+        where: { ...companyFilter, status: 'completed', completed_date: yearRange(year) },
+        _sum: { actual_cost: true, material_cost: true },
+        _count: { _all: true },
+      }),
+      this.prisma.maintenanceRequest.groupBy({
+        by: ['property_id'],
+        where: {
+          ...companyFilter,
+          status: { in: ['pending', 'in_progress'] },
+          created_at: yearRange(year),
+          OR: [{ cost_approval_status: null }, { cost_approval_status: 'approved' }],
+        },
+        _sum: { estimated_cost: true },
+      }),
+    ]);
+
+    return budgets.map(budget => {
+      const sums = spend.find(s => s.property_id === budget.property_id)?._sum;
+      const materials = Number(sums?.material_cost || 0);
+      const spent = Number(sums?.actual_cost || 0) + materials;
+      const open = Number(committed.find(c => c.property_id === budget.property_id)?._sum.estimated_cost || 0);
+      const amount = Number(budget.amount);
+      return {
+        ...budget,
+        amount,
+        spent,
+        materials,
+        committed: open,
+        remaining: Math.round((amount - spent - open) * 100) / 100,
+        utilization: amount > 0 ? Math.round((spent / amount) * 1000) / 10 : null,
+        over_budget: spent + open > amount,
+      };
+    });
+  }
+
+  /**
+   * Month-by-month burn-down of a property's maintenance budget with a straight-line projection
+   */
+  async getBurnDown(propertyId: string, year: number, user: JWTClaims): Promise<any> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view maintenance budgets');
+    }
+    const property = await this.getCompanyProperty(propertyId, user);
+    const budget = await this.prisma.propertyMaintenanceBudget.findUnique({
+      where: { property_id_year: { property_id: property.id, year } },
+    });
+    if (!budget) {
+      throw new Error('maintenance budget not found for this year');
+    }
+
+    const completed = await this.prisma.maintenanceRequest.findMany({
+      where: { property_id: property.id, status: 'completed', completed_date: yearRange(year) },
+      select: { id: true, title: true, category: true, actual_cost: true, material_cost: true, estimated_cost: true, completed_date: true },
+      orderBy: { completed_date: 'asc' },
+    });
+
+    const amount = Number(budget.amount);
+    const monthlySpend = new Array(12).fill(0);
+    const byCategory: Record<string, number> = {};
+    let varianceTotal = 0;
+    let materialsTotal = 0;
+    for (const request of completed) {
+      const cost = Number(request.actual_cost || 0) + Number(request.material_cost || 0);
+      materialsTotal += Number(request.material_cost || 0);
+      monthlySpend[request.completed_date!.getUTCMonth()] += cost;
+      byCategory[request.category] = (byCategory[request.category] || 0) + cost;
+      if (request.estimated_cost != null) varianceTotal += cost - Number(request.estimated_cost);
+    }
+
+    const now = new Date();
+    const monthsElapsed = now.getUTCFullYear() > year ? 12 : now.getUTCFullYear() < year ? 0 : now.getUTCMonth() + 1;
+    let cumulative = 0;
+    const months = MONTHS.map((label, index) => {
+      cumulative += monthlySpend[index];
+      return {
+        month: label,
+        spent: Math.round(monthlySpend[index] * 100) / 100,
+        cumulative_spent: Math.round(cumulative * 100) / 100,
+        remaining: Math.round((amount - cumulative) * 100) / 100,
+        planned_remaining: Math.round(amount * (1 - (index + 1) / 12) * 100) / 100,
+      };
+    });
+    const spent = cumulative;
+    const projected = monthsElapsed > 0 ? (spent / monthsElapsed) * 12 : 0;
+
+    return {
+      property,
+      year,
+      budget: amount,
+      spent: Math.round(spent * 100) / 100,
+      materials: Math.round(materialsTotal * 100) / 100,
+      remaining: Math.round((amount - spent) * 100) / 100,
+      projected_year_end: Math.round(projected * 100) / 100,
+      projected_over_budget: projected > amount,
+      estimate_variance: Math.round(varianceTotal * 100) / 100, // actual minus estimate across completed work
+      by_category: byCategory,
+      months,
+    };
+  }
+}
+
+export const maintenanceCostsService = new MaintenanceCostsService();
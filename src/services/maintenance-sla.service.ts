@@ -0,0 +1,248 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface SlaTarget {
+  response_hours: number;
+  resolution_hours: number;
+}
+
+export type SlaPolicy = Record<'urgent' | 'high' | 'medium' | 'low', SlaTarget>;
+
+export interface SlaReportFilters {
+  from?: string;
+  to?: string;
+  property_id?: string;
+}
+
+const HOUR = 60 * 60 * 1000;
+const PRIORITIES = ['urgent', 'high', 'medium', 'low'] as const;
+
+// Used until a company saves its own targets under settings.maintenance_sla
+export const DEFAULT_SLA_POLICY: SlaPolicy = {
+  urgent: { response_hours: 1, resolution_hours: 4 },
+  high: { response_hours: 4, resolution_hours: 24 },
+  medium: { response_hours: 24, resolution_hours: 72 },
+  low: { response_hours: 48, resolution_hours: 168 },
+};
+
+/**
+ * SLA state of a request for display: met/breached once closed, otherwise on_track, at_risk
+ * (less than a quarter of the resolution window left) or breached
+ */
+export const slaStatus = (request: any): string | null => {
+  if (!request.resolution_due_at) return null;
+  const due = new Date(request.resolution_due_at).getTime();
+  if (request.status === 'completed') {
+    return request.resolved_at && new Date(request.resolved_at).getTime() <= due ? 'met' : 'breached';
+  }
+  if (request.status === 'cancelled') return null;
+  const now = Date.now();
+  if (request.resolution_breached || now > due) return 'breached';
+  const window = due - new Date(request.created_at).getTime();
+  return due - now < window / 4 ? 'at_risk' : 'on_track';
+};
+
+export class MaintenanceSlaService {
+  private prisma = getPrisma();
+
+  async getPolicy(companyId: string): Promise<SlaPolicy> {
+    const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+    const saved = ((company?.settings as any) || {}).maintenance_sla || {};
+    const policy = { ...DEFAULT_SLA_POLICY };
+    for (const priority of PRIORITIES) {
+      if (saved[priority]) policy[priority] = { ...DEFAULT_SLA_POLICY[priority], ...saved[priority] };
+    }
+    return policy;
+  }
+
+  /**
+   * Response and resolution deadlines for a request raised at `from`
+   */
+  async computeDueDates(companyId: string, priority: string, from: Date) {
+    const policy = await this.getPolicy(companyId);
+    const target = policy[priority as keyof SlaPolicy] || policy.medium;
+    return {
+      response_due_at: new Date(from.getTime() + target.response_hours * HOUR),
+      resolution_due_at: new Date(from.getTime() + target.resolution_hours * HOUR),
+    };
+  }
+
+  async getSlaPolicy(user: JWTClaims): Promise<SlaPolicy> {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    return this.getPolicy(user.company_id);
+  }
+
+  async updateSlaPolicy(req: Partial<SlaPolicy>, user: JWTClaims): Promise<SlaPolicy> {
+    if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
+      throw new Error('insufficient permissions to change maintenance SLA targets');
+    }
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+
+    const current = await this.getPolicy(user.company_id);
+    for (const [priority, target] of Object.entries(req || {})) {
+      if (!PRIORITIES.includes(priority as any)) {
+        throw new Error(`priority must be one of: ${PRIORITIES.join(', ')}`);
+      }
+      const merged = { ...current[priority as keyof SlaPolicy], ...(target as Partial<SlaTarget>) };
+      const response = Number(merged.response_hours);
+      const resolution = Number(merged.resolution_hours);
+      if (!(response > 0) || !(resolution > 0)) {
+        throw new Error(`${priority}: response_hours and resolution_hours must be positive numbers`);
+      }
+      if (response > resolution) {
+        throw new Error(`${priority}: response_hours cannot exceed resolution_hours`);
+      }
+      current[priority as keyof SlaPolicy] = { response_hours: response, resolution_hours: resolution };
+    }
+
+    const company = await this.prisma.company.findUnique({ where: { id: user.company_id }, select: { settings: true } });
+    await this.prisma.company.update({
+      where: { id: user.company_id },
+      data: { settings: { ...((company?.settings as any) || {}), maintenance_sla: current }, updated_at: new Date() },
+    });
+
+    return current;
+  }
+
+  /**
+   * Flag open requests that have missed their deadlines and escalate them: a missed response
+   * alerts the property owner, a missed resolution also alerts the company's agency admins.
+   */
+  async checkBreaches(): Promise<{ response_breaches: number; resolution_breaches: number }> {
+    const now = new Date();
+    const open = { status: { in: ['pending', 'in_progress'] as any } };
+
+    const responseBreaches = await this.prisma.maintenanceRequest.findMany({
+      where: { ...open, first_response_at: null, response_breached: false, response_due_at: { lt: now } },
+      include: { property: { select: { name: true, owner_id: true } }, unit: { select: { unit_number: true } } },
+    });
+    for (const request of responseBreaches) {
+      await this.prisma.maintenanceRequest.update({
+        where: { id: request.id },
+        data: {
+          response_breached: true,
+          escalation_level: Math.max(request.escalation_level, 1),
+          escalated_at: now,
+        },
+      });
+      await this.escalate(request, [request.property.owner_id], 'Maintenance request not responded to in time',
+        `"${request.title}" at ${this.location(request)} has had no response within its ${request.priority} priority SLA.`);
+    }
+
+    const resolutionBreaches = await this.prisma.maintenanceRequest.findMany({
+      where: { ...open, resolution_breached: false, resolution_due_at: { lt: now } },
+      include: { property: { select: { name: true, owner_id: true } }, unit: { select: { unit_number: true } } },
+    });
+    for (const request of resolutionBreaches) {
+      await this.prisma.maintenanceRequest.update({
+        where: { id: request.id },
+        data: { resolution_breached: true, escalation_level: 2, escalated_at: now },
+      });
+      const admins = await this.prisma.user.findMany({
+        where: { company_id: request.company_id, role: 'agency_admin' as any, status: 'active' as any },
+        select: { id: true },
+      });
+      await this.escalate(request, [request.property.owner_id, ...admins.map(a => a.id)], 'Maintenance SLA breached',
+        `"${request.title}" at ${this.location(request)} was due to be resolved by ${request.resolution_due_at!.toLocaleString()} and is still ${request.status.replace('_', ' ')}.`);
+    }
+
+    return { response_breaches: responseBreaches.length, resolution_breaches: resolutionBreaches.length };
+  }
+
+  private location(request: any) {
+    return `${request.property?.name}${request.unit ? `, Unit ${request.unit.unit_number}` : ''}`;
+  }
+
+  private async escalate(request: any, recipientIds: string[], title: string, message: string) {
+    for (const recipientId of new Set(recipientIds.filter(Boolean))) {
+      try {
+        const { notificationsService } = await import('./notifications.service.js');
+        await notificationsService.notify({
+          company_id: request.company_id,
+          recipient_id: recipientId,
+          title,
+          message,
+          notification_type: 'maintenance',
+          category: 'maintenance',
+          priority: 'high',
+          action_required: true,
+          property_id: request.property_id,
+          unit_id: request.unit_id,
+          related_entity_type: 'maintenance_request',
+          related_entity_id: request.id,
+          metadata: { maintenance_request_id: request.id, escalation: true },
+        });
+      } catch (error: any) {
+        console.error('⚠️ Failed to send SLA escalation:', error.message);
+      }
+    }
+  }
+
+  /**
+   * SLA compliance for requests raised in the period, overall and per priority
+   */
+  async getComplianceReport(filters: SlaReportFilters, user: JWTClaims): Promise<any> {
+    if (!['super_admin', 'agency_admin', 'landlord', 'agent', 'manager', 'admin'].includes(user.role)) {
+      throw new Error('insufficient permissions to view SLA reports');
+    }
+    const to = filters.to ? new Date(filters.to) : new Date();
+    const from = filters.from ? new Date(filters.from) : new Date(to.getTime() - 30 * 24 * HOUR);
+    if (isNaN(from.getTime()) || isNaN(to.getTime()) || from > to) {
+      throw new Error('from and to must be valid dates with from before to');
+    }
+
+    const requests = await this.prisma.maintenanceRequest.findMany({
+      where: {
+        ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+        ...(filters.property_id && { property_id: filters.property_id }),
+        created_at: { gte: from, lte: to },
+        resolution_due_at: { not: null },
+        status: { not: 'cancelled' as any },
+      },
+      select: {
+        priority: true,
+        status: true,
+        created_at: true,
+        first_response_at: true,
+        response_due_at: true,
+        resolution_due_at: true,
+        resolved_at: true,
+        response_breached: true,
+        resolution_breached: true,
+        escalation_level: true,
+      },
+    });
+
+    const now = Date.now();
+    const summarize = (items: typeof requests) => {
+      const responded = items.filter(r => r.first_response_at);
+      const resolved = items.filter(r => r.status === 'completed' && r.resolved_at);
+      const responseMet = responded.filter(r => r.first_response_at! <= r.response_due_at!).length;
+      const resolutionMet = resolved.filter(r => r.resolved_at! <= r.resolution_due_at!).length;
+      const avgHours = (values: number[]) =>
+        values.length > 0 ? Math.round((values.reduce((sum, v) => sum + v, 0) / values.length / HOUR) * 10) / 10 : null;
+      return {
+        total: items.length,
+        response_compliance: responded.length > 0 ? Math.round((responseMet / responded.length) * 1000) / 10 : null,
+        resolution_compliance: resolved.length > 0 ? Math.round((resolutionMet / resolved.length) * 1000) / 10 : null,
+        average_response_hours: avgHours(responded.map(r => r.first_response_at!.getTime() - r.created_at.getTime())),
+        average_resolution_hours: avgHours(resolved.map(r => r.resolved_at!.getTime() - r.created_at.getTime())),
+        open_breached: items.filter(r => r.status !== 'completed' && r.resolution_due_at!.getTime() < now).length,
+        escalated: items.filter(r => r.escalation_level > 0).length,
+      };
+    };
+
+    return {
+      period: { from, to },
+      policy: user.company_id ? await this.getPolicy(user.company_id) : DEFAULT_SLA_POLICY,
+      overall: summarize(requests),
+      by_priority: Object.fromEntries(PRIORITIES.map(p => [p, summarize(requests.filter(r => r.priority === p))])),
+    };
+  }
+}
+
+export const maintenanceSlaService = new MaintenanceSlaService();
@@ -1,11 +1,21 @@
+import crypto from 'crypto';
 import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
 import { JWTClaims } from '../types/index.js';
+import { emailTemplatesService } from './email-templates.service.js';
+import { imagekitService } from './imagekit.service.js';
+import { maintenanceSlaService, slaStatus } from './maintenance-sla.service.js';
+import { maintenanceCostsService } from './maintenance-costs.service.js';
+import { caretakerAssignmentService } from './caretaker-assignment.service.js';
+import { maintenanceAnalyticsService, MaintenanceAnalyticsQuery } from './maintenance-analytics.service.js';
 
 export interface MaintenanceFilters {
   property_id?: string;
   property_ids?: string[]; // For filtering by multiple property IDs (super-admin)
   unit_id?: string;
   tenant_id?: string;
+  assigned_to?: string; // user id or 'unassigned'
+  vendor_id?: string;
   category?: string;
   priority?: string;
   status?: string;
@@ -24,6 +34,8 @@ export interface CreateMaintenanceRequest {
   description: string;
   category?: string;
   priority?: string;
+  images?: string[];
+  scheduled_date?: string;
 }
 
 export interface UpdateMaintenanceRequest {
@@ -41,105 +53,367 @@ export interface UpdateMaintenanceRequest {
   actual_cost?: number;
 }
 
-export interface MaintenanceRecord {
-  id: string;
-  property_id?: string;
-  unit_id?: string;
-  tenant_id?: string;
-  title: string;
-  description: string;
-  category: string;
-  priority: string;
-  status: string;
-  created_by: string;
-  created_at: Date;
-  updated_at: Date;
+export interface AssignMaintenanceRequest {
+  assigned_to?: string | null;
+  vendor_id?: string | null; // external contractor; receives a magic link instead of a login
+  scheduled_date?: string;
+  note?: string;
+}
+
+export interface CreateMaintenanceComment {
+  comment: string;
+  is_internal?: boolean;
+  attachments?: any[];
+}
+
+export interface UploadedAttachment {
+  buffer: Buffer;
+  originalname: string;
+  mimetype: string;
+  size: number;
 }
 
+export interface VendorStatusUpdate {
+  status?: 'in_progress' | 'completed';
+  note?: string;
+  actual_cost?: number;
+  attachments?: string[];
+}
+
+const VENDOR_LINK_DAYS = 30;
+
+// Allowed status transitions; completed/cancelled requests can be reopened
+const STATUS_TRANSITIONS: Record<string, string[]> = {
+  pending: ['in_progress', 'cancelled'],
+  in_progress: ['pending', 'completed', 'cancelled'],
+  completed: ['in_progress'],
+  cancelled: ['pending'],
+};
+
+const MANAGING_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent', 'manager', 'admin'];
+const FIELD_ROLES = ['caretaker', 'maintenance', 'staff', 'team_lead'];
+
+const personSelect = {
+  id: true,
+  first_name: true,
+  last_name: true,
+  email: true,
+  phone_number: true,
+  role: true,
+};
+
+const requestInclude = {
+  property: true,
+  unit: true,
+  requester: { select: personSelect },
+  assignee: { select: personSelect },
+  vendor: { select: { id: true, name: true, category: true, phone: true, email: true, rating: true } },
+};
+
+const commentInclude = {
+  author: { select: { id: true, first_name: true, last_name: true, role: true } },
+  vendor: { select: { id: true, name: true } },
+};
+
+export const ATTACHMENT_MIME_PREFIXES = ['image/', 'video/', 'audio/'];
+
+const mediaKind = (mimeType: string) => mimeType.split('/')[0] as 'image' | 'video' | 'audio';
+
+// Legacy requests store bare image URLs; expose everything with a thumbnail for the apps
+const toMedia = (items: any) => (Array.isArray(items) ? items : []).map((item: any) =>
+  typeof item === 'string'
+    ? { url: item, kind: 'image', mime_type: 'image/*', thumbnail_url: imagekitService.thumbnailUrl(item, 'image/') }
+    : item
+);
+
+const hashVendorToken = (token: string) => crypto.createHash('sha256').update(token).digest('hex');
+
+// Flatten relations for the frontend; tenants never see internal notes
+const toResponse = (request: any, user?: JWTClaims) => ({
+  ...request,
+  vendor_token_hash: undefined,
+  ...(user?.role === 'tenant' && { internal_notes: undefined }),
+  property_name: request.property?.name,
+  unit_number: request.unit?.unit_number,
+  tenant_name: request.requester ? `${request.requester.first_name} ${request.requester.last_name}` : 'Unknown Tenant',
+  tenant_id: request.requester?.id,
+  assignee_name: request.assignee ? `${request.assignee.first_name} ${request.assignee.last_name}` : null,
+  vendor_name: request.vendor?.name ?? null,
+  sla_status: slaStatus(request),
+  images: toMedia(request.images).map((m: any) => m.url),
+  media: toMedia(request.images),
+});
+
 export class MaintenanceService {
   private prisma = getPrisma();
 
-  async createMaintenanceRequest(req: CreateMaintenanceRequest, user: JWTClaims): Promise<MaintenanceRecord> {
+  /**
+   * Load a request and check the caller may see it: same company, and tenants only their own,
+   * field staff only what is assigned to them or on their properties.
+   */
+  async getAccessibleRequest(id: string, user: JWTClaims) {
+    const request = await this.prisma.maintenanceRequest.findUnique({ where: { id } });
+    if (!request) {
+      throw new Error('Maintenance request not found');
+    }
+
+    if (user.role === 'super_admin') {
+      return request;
+    }
+    if (user.company_id && request.company_id !== user.company_id) {
+      throw new Error('You do not have permission to view this maintenance request');
+    }
+    if (user.role === 'tenant' && request.requested_by !== user.user_id) {
+      throw new Error('You do not have permission to view this maintenance request');
+    }
+    if (FIELD_ROLES.includes(user.role) && request.assigned_to !== user.user_id) {
+      const propertyIds = await this.getStaffPropertyIds(user.user_id);
+      if (!propertyIds.includes(request.property_id)) {
+        throw new Error('You do not have permission to view this maintenance request');
+      }
+    }
+    return request;
+  }
+
+  private async getStaffPropertyIds(staffId: string): Promise<string[]> {
+    const assignments = await this.prisma.staffPropertyAssignment.findMany({
+      where: { staff_id: staffId, status: 'active' },
+      select: { property_id: true },
+    });
+    return assignments.map(a => a.property_id);
+  }
+
+  private assertTransition(from: string, to: string) {
+    if (from === to) return;
+    if (!STATUS_TRANSITIONS[from]?.includes(to)) {
+      throw new Error(`invalid status transition from ${from} to ${to}`);
+    }
+  }
+
+  /**
+   * Assignees must be active staff of the request's company
+   */
+  private async validateAssignee(assigneeId: string, companyId: string) {
+    const assignee = await this.prisma.user.findFirst({
+      where: { id: assigneeId, company_id: companyId, status: 'active' as any },
+      select: { id: true, first_name: true, last_name: true, role: true },
+    });
+    if (!assignee || assignee.role === 'tenant') {
+      throw new Error('assignee not found in this company');
+    }
+    return assignee;
+  }
+
+  private async recordHistory(requestId: string, authorId: string, data: {
+    comment_type: 'status_change' | 'assignment';
+    comment: string;
+    from_status?: string;
+    to_status?: string;
+    is_internal?: boolean;
+  }) {
+    await this.prisma.maintenanceComment.create({
+      data: {
+        request_id: requestId,
+        author_id: authorId,
+        comment_type: data.comment_type,
+        comment: data.comment,
+        from_status: data.from_status || null,
+        to_status: data.to_status || null,
+        is_internal: data.is_internal || false,
+      },
+    });
+  }
+
+  private async notify(user: JWTClaims, recipientId: string, request: any, title: string, message: string) {
+    if (!recipientId || recipientId === user.user_id) return;
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.createNotification(user, {
+        recipient_id: recipientId,
+        title,
+        message,
+        notification_type: 'maintenance',
+        category: 'maintenance',
+        priority: request.priority === 'urgent' || request.priority === 'high' ? 'high' : 'medium',
+        property_id: request.property_id,
+        unit_id: request.unit_id,
+        metadata: { maintenance_request_id: request.id },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to send maintenance notification:', error.message);
+    }
+  }
+
+  /**
+   * Tell the reporting tenant about progress on their request over the channels they accept:
+   * in-app always, plus push/email (and SMS for urgent work) according to their preferences.
+   * `user` is absent when the update comes from a vendor magic link.
+   */
+  private async notifyTenant(request: any, title: string, message: string, user?: JWTClaims) {
+    const tenantId = request.requested_by;
+    if (!tenantId || tenantId === user?.user_id) return;
+
+    try {
+      const tenant = await this.prisma.user.findUnique({
+        where: { id: tenantId },
+        select: { role: true },
+      });
+      if (!tenant || tenant.role !== 'tenant') return;
+
+      const { notificationsService } = await import('./notifications.service.js');
+      const urgent = request.priority === 'urgent' || request.priority === 'high';
+      const [emailAndPush, sms] = await Promise.all([
+        notificationsService.resolveChannels(tenantId, 'maintenance', ['email', 'push'], 'maintenance_update', urgent ? 'high' : 'medium'),
+        urgent ? notificationsService.resolveChannels(tenantId, 'maintenance', ['sms'], 'urgent_maintenance', 'high') : Promise.resolve([]),
+      ]);
+      const channels = ['app', ...emailAndPush, ...sms];
+
+      // Push, email and SMS go out through the delivery queue
+      await notificationsService.notify({
+        company_id: request.company_id,
+        sender_id: user?.user_id || null,
+        recipient_id: tenantId,
+        title,
+        message,
+        notification_type: 'maintenance',
+        category: 'maintenance',
+        priority: urgent ? 'high' : 'medium',
+        property_id: request.property_id,
+        unit_id: request.unit_id,
+        action_url: `/tenant/maintenance/${request.id}`,
+        metadata: { maintenance_request_id: request.id, status: request.status, channels },
+      }, channels);
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify tenant about maintenance update:', error.message);
+    }
+  }
+
+  async createMaintenanceRequest(req: CreateMaintenanceRequest, user: JWTClaims, files: UploadedAttachment[] = []): Promise<any> {
     // Validate required fields
     if (!req.title || !req.description) {
       throw new Error('title and description are required');
     }
+    this.assertAttachmentTypes(files);
 
-    // Set defaults
-    const category = req.category || 'general';
-    const priority = req.priority || 'medium';
-
-    // For now, we'll create a mock maintenance record since there's no maintenance table in Prisma schema
-    // In a real implementation, this would save to a maintenance_requests table
-    const maintenanceRecord: MaintenanceRecord = {
-      id: `maint-${Date.now()}`,
-      property_id: req.property_id,
-      unit_id: req.unit_id,
-      tenant_id: req.tenant_id,
-      title: req.title,
-      description: req.description,
-      category,
-      priority,
-      status: 'pending',
-      created_by: user.user_id,
-      created_at: new Date(),
-      updated_at: new Date(),
-    };
+    let propertyId = req.property_id;
+    let unitId = req.unit_id;
+    let requesterId = user.user_id;
+
+    if (user.role === 'tenant') {
+      // Tenants always raise requests against their own unit
+      const profile = await this.prisma.tenantProfile.findUnique({
+        where: { user_id: user.user_id },
+        select: { current_property_id: true, current_unit_id: true },
+      });
+      propertyId = propertyId || profile?.current_property_id || undefined;
+      unitId = unitId || profile?.current_unit_id || undefined;
+    } else if (req.tenant_id) {
+      // Staff logging a request on behalf of a tenant
+      const tenant = await this.prisma.user.findFirst({
+        where: {
+          id: req.tenant_id,
+          role: 'tenant' as any,
+          ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+        },
+        include: { tenant_profile: { select: { current_property_id: true, current_unit_id: true } } },
+      });
+      if (!tenant) {
+        throw new Error('tenant not found');
+      }
+      requesterId = tenant.id;
+      propertyId = propertyId || tenant.tenant_profile?.current_property_id || undefined;
+      unitId = unitId || tenant.tenant_profile?.current_unit_id || undefined;
+    }
+
+    if (unitId && !propertyId) {
+      const unit = await this.prisma.unit.findUnique({ where: { id: unitId }, select: { property_id: true } });
+      propertyId = unit?.property_id;
+    }
+    if (!propertyId) {
+      throw new Error('property_id is required');
+    }
+
+    const property = await this.prisma.property.findUnique({
+      where: { id: propertyId },
+      select: { id: true, name: true, company_id: true, owner_id: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+    if (user.role !== 'super_admin' && property.company_id !== user.company_id) {
+      throw new Error('insufficient permissions to create maintenance requests for this property');
+    }
+    if (unitId) {
+      const unit = await this.prisma.unit.findFirst({ where: { id: unitId, property_id: propertyId }, select: { id: true } });
+      if (!unit) {
+        throw new Error('unit not found');
+      }
+    }
+
+    const requestedAt = new Date();
+    const priority = req.priority?.toLowerCase() || 'medium';
+    const dueDates = await maintenanceSlaService.computeDueDates(property.company_id, priority, requestedAt);
+
+    const request = await this.prisma.maintenanceRequest.create({
+      data: {
+        company_id: property.company_id,
+        property_id: property.id,
+        unit_id: unitId || null,
+        title: req.title,
+        description: req.description,
+        category: req.category || 'general',
+        priority: priority as any,
+        status: 'pending',
+        requested_by: requesterId,
+        requested_date: requestedAt,
+        ...dueDates,
+        scheduled_date: req.scheduled_date ? new Date(req.scheduled_date) : null,
+        images: req.images || [],
+      },
+      include: requestInclude,
+    });
 
-    // TODO: Save to actual maintenance_requests table when it exists
-    // await this.prisma.maintenanceRequest.create({ data: maintenanceRecord });
+    if (files.length > 0) {
+      // Evidence uploaded with the report goes on the timeline, as from the tenant portal,
+      // so it can be removed like any other attachment
+      await this.addAttachments(request.id, files, 'Attached when reporting the issue', user);
+    }
+
+    await this.notify(
+      user,
+      property.owner_id,
+      request,
+      'New maintenance request',
+      `${request.title} - ${property.name}${request.unit ? `, Unit ${request.unit.unit_number}` : ''}`
+    );
+
+    let assigned = null;
+    try {
+      assigned = await this.autoAssignMaintenanceRequest(request.id, user);
+    } catch (error: any) {
+      console.error('⚠️ Caretaker auto-assignment failed:', error.message);
+    }
 
-    return maintenanceRecord;
+    return toResponse(assigned || request, user);
   }
 
   async getMaintenanceRequest(id: string, user: JWTClaims): Promise<any> {
+    await this.getAccessibleRequest(id, user);
+
     // Fetch the maintenance request from database with all relations
     const request = await this.prisma.maintenanceRequest.findUnique({
       where: { id },
       include: {
-        property: true,
-        unit: true,
-        requester: {
-          select: {
-            id: true,
-            first_name: true,
-            last_name: true,
-            email: true,
-            phone_number: true,
-            role: true,
-          }
+        ...requestInclude,
+        comments: {
+          where: user.role === 'tenant' ? { is_internal: false } : {},
+          include: commentInclude,
+          orderBy: { created_at: 'asc' },
         },
-        assignee: {
-          select: {
-            id: true,
-            first_name: true,
-            last_name: true,
-            email: true,
-            phone_number: true,
-            role: true,
-          }
-        }
-      }
+      },
     });
 
-    if (!request) {
-      throw new Error('Maintenance request not found');
-    }
-
-    // Check if user has permission to view this request
-    if (user.company_id && request.company_id !== user.company_id) {
-      throw new Error('You do not have permission to view this maintenance request');
-    }
-
-    // Transform data to include flat fields for easier frontend consumption
-    return {
-      ...request,
-      property_name: request.property?.name,
-      unit_number: request.unit?.unit_number,
-      tenant_name: request.requester ? `${request.requester.first_name} ${request.requester.last_name}` : 'Unknown Tenant',
-      tenant_id: request.requester?.id,
-      assignee_name: request.assignee ? `${request.assignee.first_name} ${request.assignee.last_name}` : null,
-    };
+    return toResponse(request, user);
   }
 
   async listMaintenanceRequests(filters: MaintenanceFilters, user: JWTClaims): Promise<any> {
@@ -153,6 +427,13 @@ export class MaintenanceService {
     if (user.company_id) {
       where.company_id = user.company_id;
     }
+    if (user.role === 'tenant') {
+      where.requested_by = user.user_id;
+    } else if (FIELD_ROLES.includes(user.role)) {
+      // Field staff see work assigned to them plus requests on the properties they cover
+      const propertyIds = await this.getStaffPropertyIds(user.user_id);
+      where.AND = [{ OR: [{ assigned_to: user.user_id }, { property_id: { in: propertyIds } }] }];
+    }
 
     // Handle property_ids (for super-admin) or property_id (single)
     if (filters.property_ids && filters.property_ids.length > 0) {
@@ -165,10 +446,18 @@ export class MaintenanceService {
       where.unit_id = filters.unit_id;
     }
 
-    if (filters.tenant_id) {
+    if (filters.tenant_id && user.role !== 'tenant') {
       where.requested_by = filters.tenant_id;
     }
 
+    if (filters.assigned_to) {
+      where.assigned_to = filters.assigned_to === 'unassigned' ? null : filters.assigned_to;
+    }
+
+    if (filters.vendor_id) {
+      where.vendor_id = filters.vendor_id;
+    }
+
     if (filters.category) {
       where.category = filters.category;
     }
@@ -192,30 +481,7 @@ export class MaintenanceService {
     const [requests, total] = await Promise.all([
       this.prisma.maintenanceRequest.findMany({
         where,
-        include: {
-          property: true,
-          unit: true,
-          requester: {
-            select: {
-              id: true,
-              first_name: true,
-              last_name: true,
-              email: true,
-              phone_number: true,
-              role: true,
-            }
-          },
-          assignee: {
-            select: {
-              id: true,
-              first_name: true,
-              last_name: true,
-              email: true,
-              phone_number: true,
-              role: true,
-            }
-          }
-        },
+        include: requestInclude,
         orderBy: filters.sort_by ? { [filters.sort_by]: filters.sort_order || 'desc' } : { created_at: 'desc' },
         take: limit,
         skip: offset,
@@ -224,14 +490,7 @@ export class MaintenanceService {
     ]);
 
     // Transform data to include flat fields for easier frontend consumption
-    const transformedRequests = requests.map(req => ({
-      ...req,
-      property_name: req.property?.name,
-      unit_number: req.unit?.unit_number,
-      tenant_name: req.requester ? `${req.requester.first_name} ${req.requester.last_name}` : 'Unknown Tenant',
-      tenant_id: req.requester?.id,
-      assignee_name: req.assignee ? `${req.assignee.first_name} ${req.assignee.last_name}` : null,
-    }));
+    const transformedRequests = requests.map(request => toResponse(request, user));
 
     const totalPages = Math.ceil(total / limit);
     const currentPage = Math.floor(offset / limit) + 1;
@@ -247,17 +506,38 @@ export class MaintenanceService {
 
   async updateMaintenanceRequest(id: string, req: UpdateMaintenanceRequest, user: JWTClaims): Promise<any> {
     // First, check if the request exists and user has permission
-    const existingRequest = await this.prisma.maintenanceRequest.findUnique({
-      where: { id }
-    });
+    const existingRequest = await this.getAccessibleRequest(id, user);
 
-    if (!existingRequest) {
-      throw new Error('Maintenance request not found');
+    if (user.role === 'tenant') {
+      // Tenants can edit the description of an open request or cancel it, nothing else
+      const allowed = ['title', 'description', 'category', 'status', 'notes'];
+      if (Object.keys(req).some(key => !allowed.includes(key))) {
+        throw new Error('insufficient permissions to update these fields');
+      }
+      if (existingRequest.status !== 'pending') {
+        throw new Error('insufficient permissions: only pending requests can be edited by tenants');
+      }
+      if (req.status !== undefined && req.status !== 'cancelled' && req.status !== existingRequest.status) {
+        throw new Error('insufficient permissions: tenants can only cancel requests');
+      }
+    } else if (FIELD_ROLES.includes(user.role)) {
+      if (req.assigned_to !== undefined && req.assigned_to !== existingRequest.assigned_to) {
+        throw new Error('insufficient permissions to reassign maintenance requests');
+      }
     }
 
-    // Check permissions
-    if (user.company_id && existingRequest.company_id !== user.company_id) {
-      throw new Error('You do not have permission to update this maintenance request');
+    if (req.status !== undefined) {
+      this.assertTransition(existingRequest.status, req.status);
+    }
+    const costChanged = req.estimated_cost !== undefined &&
+      Number(req.estimated_cost ?? -1) !== Number(existingRequest.estimated_cost ?? -1);
+    const blockedReason = maintenanceCostsService.workBlockedReason(existingRequest.cost_approval_status);
+    if ((req.status === 'in_progress' || req.status === 'completed') && req.status !== existingRequest.status &&
+        !costChanged && blockedReason) {
+      throw new Error(blockedReason);
+    }
+    if (req.assigned_to) {
+      await this.validateAssignee(req.assigned_to, existingRequest.company_id);
     }
 
     // Build update data object, only including fields that are provided
@@ -272,72 +552,666 @@ export class MaintenanceService {
     if (req.status !== undefined) updateData.status = req.status;
     if (req.notes !== undefined) updateData.notes = req.notes;
     if (req.internal_notes !== undefined) updateData.internal_notes = req.internal_notes;
-    if (req.assigned_to !== undefined) updateData.assigned_to = req.assigned_to;
+    if (req.assigned_to !== undefined) {
+      updateData.assigned_to = req.assigned_to || null;
+      if (req.assigned_to !== existingRequest.assigned_to) updateData.assigned_at = req.assigned_to ? new Date() : null;
+    }
+    // Handing the job to staff, or reopening it, takes it off the vendor and revokes their link
+    const reopened = req.status !== undefined && req.status !== existingRequest.status &&
+      ['completed', 'cancelled'].includes(existingRequest.status);
+    if (existingRequest.vendor_id && ((req.assigned_to && req.assigned_to !== existingRequest.assigned_to) || reopened)) {
+      Object.assign(updateData, { vendor_id: null, vendor_token_hash: null, vendor_token_expires_at: null });
+    }
     if (req.scheduled_date !== undefined) updateData.scheduled_date = req.scheduled_date;
     if (req.completed_date !== undefined) updateData.completed_date = req.completed_date;
     if (req.estimated_cost !== undefined) updateData.estimated_cost = req.estimated_cost;
+    if (costChanged) {
+      Object.assign(updateData, await maintenanceCostsService.approvalFor(
+        existingRequest.company_id, req.estimated_cost ?? null, user
+      ));
+      if (updateData.cost_approval_status === 'pending_approval' && (req.status === 'in_progress' || req.status === 'completed') &&
+          req.status !== existingRequest.status) {
+        throw new Error(maintenanceCostsService.workBlockedReason('pending_approval')!);
+      }
+    }
     if (req.actual_cost !== undefined) updateData.actual_cost = req.actual_cost;
 
+    const statusChanged = req.status !== undefined && req.status !== existingRequest.status;
+    if (req.priority !== undefined && req.priority !== existingRequest.priority) {
+      // Deadlines follow the new priority, still measured from when the request was raised. Breaches
+      // are judged again against them; open requests past a deadline are re-flagged by the SLA check.
+      const dueDates = await maintenanceSlaService.computeDueDates(
+        existingRequest.company_id, req.priority, existingRequest.created_at
+      );
+      Object.assign(updateData, dueDates, {
+        response_breached: !!existingRequest.first_response_at && existingRequest.first_response_at > dueDates.response_due_at,
+        resolution_breached: !!existingRequest.resolved_at && existingRequest.resolved_at > dueDates.resolution_due_at,
+      });
+    }
+    if (!existingRequest.first_response_at && user.role !== 'tenant' &&
+        (statusChanged || (req.assigned_to && req.assigned_to !== existingRequest.assigned_to))) {
+      updateData.first_response_at = new Date();
+    }
+    if (statusChanged && req.status === 'completed') {
+      updateData.resolved_at = new Date();
+      if (req.completed_date === undefined) updateData.completed_date = new Date();
+    }
+    if (statusChanged && existingRequest.status === 'completed') {
+      updateData.completed_date = null; // reopened
+      updateData.resolved_at = null;
+    }
+
     // Update the request
     const updatedRequest = await this.prisma.maintenanceRequest.update({
       where: { id },
       data: updateData,
-      include: {
-        property: true,
-        unit: true,
-        requester: {
-          select: {
-            id: true,
-            first_name: true,
-            last_name: true,
-            email: true,
-            phone_number: true,
-            role: true,
-          }
+      include: requestInclude,
+    });
+
+    if (updateData.cost_approval_status === 'pending_approval') {
+      await maintenanceCostsService.notifyApprovers(updatedRequest, user);
+    }
+    if (statusChanged) {
+      await this.recordHistory(id, user.user_id, {
+        comment_type: 'status_change',
+        comment: `Status changed from ${existingRequest.status} to ${req.status}`,
+        from_status: existingRequest.status,
+        to_status: req.status,
+      });
+      await this.notifyTenant(
+        updatedRequest,
+        'Maintenance request updated',
+        `Your request "${updatedRequest.title}" is now ${req.status!.replace('_', ' ')}.`,
+        user
+      );
+    }
+    if (req.assigned_to !== undefined && (req.assigned_to || null) !== existingRequest.assigned_to) {
+      await this.recordAssignment(updatedRequest, user);
+    }
+
+    // Transform data to include flat fields
+    return toResponse(updatedRequest, user);
+  }
+
+  /**
+   * Assign (or unassign) a request to a caretaker/technician or an external vendor,
+   * optionally scheduling the visit. Vendors get a magic link to post status updates.
+   */
+  async assignMaintenanceRequest(id: string, req: AssignMaintenanceRequest, user: JWTClaims): Promise<any> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to assign maintenance requests');
+    }
+    if (req.assigned_to && req.vendor_id) {
+      throw new Error('assign either a staff member or a vendor, not both');
+    }
+    const existingRequest = await this.getAccessibleRequest(id, user);
+    if (['completed', 'cancelled'].includes(existingRequest.status)) {
+      throw new Error(`cannot assign a ${existingRequest.status} maintenance request`);
+    }
+    if (req.assigned_to) {
+      await this.validateAssignee(req.assigned_to, existingRequest.company_id);
+    }
+    const vendor = req.vendor_id ? await this.validateVendor(req.vendor_id, existingRequest.company_id) : null;
+
+    // A fresh link is issued on every vendor assignment; re-assigning revokes the old one
+    const vendorToken = vendor ? crypto.randomBytes(32).toString('hex') : null;
+
+    const updatedRequest = await this.prisma.maintenanceRequest.update({
+      where: { id },
+      data: {
+        assigned_to: req.assigned_to || null,
+        assigned_at: req.assigned_to || vendor ? new Date() : null,
+        auto_assigned: false,
+        vendor_id: vendor?.id || null,
+        vendor_token_hash: vendorToken ? hashVendorToken(vendorToken) : null,
+        vendor_token_expires_at: vendorToken ? new Date(Date.now() + VENDOR_LINK_DAYS * 24 * 60 * 60 * 1000) : null,
+        ...(!existingRequest.first_response_at && (req.assigned_to || vendor) && { first_response_at: new Date() }),
+        ...(req.scheduled_date && { scheduled_date: new Date(req.scheduled_date) }),
+        updated_at: new Date(),
+      },
+      include: requestInclude,
+    });
+
+    await this.recordAssignment(updatedRequest, user, req.note);
+    if (vendor && vendorToken) {
+      await this.sendVendorLink(vendor, updatedRequest, vendorToken, req.note);
+    }
+    return toResponse(updatedRequest);
+  }
+
+  /**
+   * Vendors must belong to the request's company, be active and have valid insurance on file
+   */
+  private async validateVendor(vendorId: string, companyId: string) {
+    const vendor = await this.prisma.vendor.findFirst({ where: { id: vendorId, company_id: companyId } });
+    if (!vendor) {
+      throw new Error('vendor not found in this company');
+    }
+    if (vendor.status !== 'active') {
+      throw new Error(`vendor is ${vendor.status} and cannot be assigned work`);
+    }
+    if (vendor.insurance_expiry && vendor.insurance_expiry < new Date()) {
+      throw new Error('vendor insurance has expired; update their insurance details before assigning work');
+    }
+    return vendor;
+  }
+
+  private async sendVendorLink(vendor: any, request: any, token: string, note?: string) {
+    if (!vendor.email) {
+      console.warn(`⚠️ Vendor ${vendor.id} has no email; share the work order link manually`);
+      return;
+    }
+    try {
+      await emailTemplatesService.send('vendor_work_order', {
+        to: vendor.email,
+        companyId: request.company_id,
+        variables: {
+          vendor_name: vendor.contact_person || vendor.name,
+          title: request.title,
+          description: request.description,
+          location: `${request.property?.name || ''}${request.unit ? `, Unit ${request.unit.unit_number}` : ''}`,
+          scheduled_date: request.scheduled_date ? new Date(request.scheduled_date) : null,
+          note,
+          link_days: VENDOR_LINK_DAYS,
+          work_order_url: `${env.appUrl}/vendor/work-orders/${token}`,
         },
-        assignee: {
-          select: {
-            id: true,
-            first_name: true,
-            last_name: true,
-            email: true,
-            phone_number: true,
-            role: true,
-          }
-        }
+      });
+    } catch (error: any) {
+      console.error(`⚠️ Failed to send work order link to vendor ${vendor.id}:`, error.message);
+    }
+  }
+
+  /**
+   * Give an unassigned request to the best available caretaker. With `reassign` staff can ask the
+   * engine for the next best pick instead of the current assignee; otherwise requests that already
+   * have someone, or companies that switched auto-assignment off, are left alone.
+   */
+  async autoAssignMaintenanceRequest(id: string, user: JWTClaims, options: { reassign?: boolean; note?: string } = {}): Promise<any> {
+    const request = options.reassign
+      ? await this.getAccessibleRequest(id, user)
+      : await this.prisma.maintenanceRequest.findUniqueOrThrow({ where: { id } });
+    if (options.reassign) {
+      if (!MANAGING_ROLES.includes(user.role)) {
+        throw new Error('insufficient permissions to assign maintenance requests');
       }
+      if (['completed', 'cancelled'].includes(request.status)) {
+        throw new Error(`cannot assign a ${request.status} maintenance request`);
+      }
+    } else if (request.assigned_to || request.vendor_id || !(await caretakerAssignmentService.isEnabled(request.company_id))) {
+      return null;
+    }
+
+    const best = await caretakerAssignmentService.pickBest(request.company_id, {
+      property_id: request.property_id,
+      category: request.category,
+      date: request.scheduled_date || new Date(),
+      exclude: request.assigned_to ? [request.assigned_to] : [],
     });
+    if (!best) {
+      if (options.reassign) throw new Error('no other caretaker found for this property');
+      return null;
+    }
+
+    const updatedRequest = await this.prisma.maintenanceRequest.update({
+      where: { id },
+      data: {
+        assigned_to: best.caretaker.id,
+        assigned_at: new Date(),
+        auto_assigned: true,
+        vendor_id: null,
+        vendor_token_hash: null,
+        vendor_token_expires_at: null,
+        // Assignment by the engine at creation is not a human response for SLA purposes
+        ...(options.reassign && !request.first_response_at && { first_response_at: new Date() }),
+        updated_at: new Date(),
+      },
+      include: requestInclude,
+    });
+
+    await this.recordAssignment(updatedRequest, user, options.note || `auto-assigned (${best.reasons.join(', ')})`);
+    return updatedRequest;
+  }
+
+  private async recordAssignment(request: any, user: JWTClaims, note?: string) {
+    const assigneeName = request.assignee
+      ? `${request.assignee.first_name} ${request.assignee.last_name}`
+      : request.vendor ? `${request.vendor.name} (vendor)` : null;
+    await this.recordHistory(request.id, user.user_id, {
+      comment_type: 'assignment',
+      comment: (assigneeName ? `Assigned to ${assigneeName}` : 'Unassigned') + (note ? `: ${note}` : ''),
+      is_internal: true,
+    });
+    if (request.assigned_to) {
+      await this.notify(
+        user,
+        request.assigned_to,
+        request,
+        'Maintenance request assigned to you',
+        `${request.title} - ${request.property?.name}${request.unit ? `, Unit ${request.unit.unit_number}` : ''}` +
+          (request.scheduled_date ? ` (scheduled ${new Date(request.scheduled_date).toLocaleDateString()})` : '')
+      );
+    }
+    if (request.assigned_to || request.vendor_id) {
+      await this.notifyTenant(
+        request,
+        'A technician has been assigned',
+        `Someone has been assigned to "${request.title}"` +
+          (request.scheduled_date ? ` and a visit is scheduled for ${new Date(request.scheduled_date).toLocaleDateString()}.` : '.'),
+        user
+      );
+    }
+  }
+
+  async getComments(id: string, user: JWTClaims): Promise<any[]> {
+    await this.getAccessibleRequest(id, user);
+
+    return this.prisma.maintenanceComment.findMany({
+      where: { request_id: id, ...(user.role === 'tenant' && { is_internal: false }) },
+      include: commentInclude,
+      orderBy: { created_at: 'asc' },
+    });
+  }
+
+  async addComment(id: string, req: CreateMaintenanceComment, user: JWTClaims, loaded?: any): Promise<any> {
+    if (!req.comment?.trim()) {
+      throw new Error('comment is required');
+    }
+    const request = loaded || await this.getAccessibleRequest(id, user);
+    const isInternal = user.role !== 'tenant' && !!req.is_internal;
+
+    const comment = await this.prisma.maintenanceComment.create({
+      data: {
+        request_id: id,
+        author_id: user.user_id,
+        comment: req.comment.trim(),
+        is_internal: isInternal,
+        attachments: req.attachments || [],
+      },
+      include: commentInclude,
+    });
+
+    // A staff reply the tenant can see counts as the first response for SLA purposes
+    await this.prisma.maintenanceRequest.update({
+      where: { id },
+      data: {
+        ...(!request.first_response_at && user.role !== 'tenant' && !isInternal && { first_response_at: new Date() }),
+        updated_at: new Date(),
+      },
+    });
+
+    // Tenant comments go to the assignee; staff replies go to the tenant (unless internal)
+    if (user.role === 'tenant') {
+      if (request.assigned_to) {
+        await this.notify(user, request.assigned_to, request, 'New comment on maintenance request', `${request.title}: ${comment.comment}`);
+      }
+    } else if (!isInternal) {
+      await this.notifyTenant(request, 'New update on your maintenance request', `${request.title}: ${comment.comment}`, user);
+    }
+
+    return comment;
+  }
+
+  /**
+   * Chronological view of a request as the tenant sees it: reported, assigned, public comments,
+   * status changes and attachments. Internal notes and staff-only history are left out.
+   */
+  async getTimeline(id: string, user: JWTClaims): Promise<any> {
+    await this.getAccessibleRequest(id, user);
+    const request = await this.prisma.maintenanceRequest.findUnique({
+      where: { id },
+      include: {
+        ...requestInclude,
+        comments: {
+          where: { is_internal: false },
+          include: commentInclude,
+          orderBy: { created_at: 'asc' },
+        },
+      },
+    });
+    if (!request) {
+      throw new Error('Maintenance request not found');
+    }
+
+    const actorName = (comment: any) =>
+      comment.vendor?.name ||
+      (comment.author ? (comment.author.role === 'tenant' ? 'You' : `${comment.author.first_name} (${comment.author.role.replace('_', ' ')})`) : null);
+
+    const events: any[] = [
+      { type: 'reported', at: request.created_at, title: 'Request submitted', status: 'pending', media: toMedia(request.images) },
+    ];
+    if (request.assigned_at && (request.assignee || request.vendor)) {
+      events.push({
+        type: 'assigned',
+        at: request.assigned_at,
+        title: request.vendor ? `Assigned to ${request.vendor.name}` : `Assigned to ${request.assignee!.first_name}`,
+        scheduled_date: request.scheduled_date,
+      });
+    }
+    for (const comment of request.comments) {
+      events.push({
+        type: comment.comment_type === 'status_change' ? 'status_change' : (comment.attachments as any[])?.length ? 'attachment' : 'comment',
+        at: comment.created_at,
+        title: comment.comment_type === 'status_change' ? `Status changed to ${comment.to_status?.replace('_', ' ')}` : null,
+        message: comment.comment,
+        from_status: comment.from_status,
+        to_status: comment.to_status,
+        author: actorName(comment),
+        media: comment.attachments,
+      });
+    }
+    events.sort((a, b) => new Date(a.at).getTime() - new Date(b.at).getTime());
 
-    // Transform data to include flat fields
     return {
-      ...updatedRequest,
-      property_name: updatedRequest.property?.name,
-      unit_number: updatedRequest.unit?.unit_number,
-      tenant_name: updatedRequest.requester ? `${updatedRequest.requester.first_name} ${updatedRequest.requester.last_name}` : 'Unknown Tenant',
-      tenant_id: updatedRequest.requester?.id,
-      assignee_name: updatedRequest.assignee ? `${updatedRequest.assignee.first_name} ${updatedRequest.assignee.last_name}` : null,
+      id: request.id,
+      title: request.title,
+      status: request.status,
+      priority: request.priority,
+      property_name: request.property?.name,
+      unit_number: request.unit?.unit_number,
+      scheduled_date: request.scheduled_date,
+      completed_date: request.completed_date,
+      sla_status: slaStatus(request),
+      events,
     };
   }
 
-  async deleteMaintenanceRequest(id: string, user: JWTClaims): Promise<void> {
-    if (!id) {
-      throw new Error('Maintenance request ID is required');
+  /**
+   * Rate the vendor's work on a completed request; feeds the vendor's running average
+   */
+  async rateVendor(id: string, rating: number, user: JWTClaims): Promise<any> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to rate vendors');
+    }
+    if (!Number.isInteger(rating) || rating < 1 || rating > 5) {
+      throw new Error('rating must be a whole number from 1 to 5');
+    }
+    const request = await this.getAccessibleRequest(id, user);
+    if (!request.vendor_id) {
+      throw new Error('maintenance request has no vendor to rate');
+    }
+    if (request.status !== 'completed') {
+      throw new Error('only completed work orders can be rated');
+    }
+    if (request.vendor_rating) {
+      throw new Error('vendor work on this request has already been rated');
     }
 
-    // First, check if the request exists and user has permission
-    const existingRequest = await this.prisma.maintenanceRequest.findUnique({
-      where: { id }
+    const vendor = await this.prisma.vendor.findUnique({ where: { id: request.vendor_id } });
+    const count = vendor?.rating_count || 0;
+    const average = ((Number(vendor?.rating || 0) * count) + rating) / (count + 1);
+
+    await this.prisma.$transaction([
+      this.prisma.maintenanceRequest.update({ where: { id }, data: { vendor_rating: rating, updated_at: new Date() } }),
+      this.prisma.vendor.update({
+        where: { id: request.vendor_id },
+        data: { rating: Math.round(average * 100) / 100, rating_count: count + 1, updated_at: new Date() },
+      }),
+    ]);
+
+    return this.getMaintenanceRequest(id, user);
+  }
+
+  /**
+   * The requesting tenant's satisfaction rating for completed work; feeds caretaker performance
+   */
+  async rateService(id: string, req: { rating: number; feedback?: string }, user: JWTClaims): Promise<any> {
+    const rating = Number(req.rating);
+    if (!Number.isInteger(rating) || rating < 1 || rating > 5) {
+      throw new Error('rating must be a whole number from 1 to 5');
+    }
+    const request = await this.getAccessibleRequest(id, user);
+    if (request.requested_by !== user.user_id) {
+      throw new Error('only the tenant who raised the request can rate it');
+    }
+    if (request.status !== 'completed') {
+      throw new Error('only completed requests can be rated');
+    }
+    if (request.tenant_rating) {
+      throw new Error('this request has already been rated');
+    }
+
+    await this.prisma.maintenanceRequest.update({
+      where: { id },
+      data: { tenant_rating: rating, tenant_feedback: req.feedback || null, tenant_rated_at: new Date(), updated_at: new Date() },
     });
+    return this.getMaintenanceRequest(id, user);
+  }
 
-    if (!existingRequest) {
-      throw new Error('Maintenance request not found');
+  /**
+   * Resolve a vendor magic-link token to its work order
+   */
+  private async getVendorWorkOrder(token: string) {
+    const request = await this.prisma.maintenanceRequest.findFirst({
+      where: { vendor_token_hash: hashVendorToken(token) },
+      include: requestInclude,
+    });
+    if (!request || !request.vendor_id) {
+      throw new Error('work order not found');
+    }
+    if (!request.vendor_token_expires_at || request.vendor_token_expires_at < new Date()) {
+      throw new Error('work order link has expired');
+    }
+    return request;
+  }
+
+  /**
+   * Work order as shown to the vendor: the job, location and public history only
+   */
+  async getVendorView(token: string): Promise<any> {
+    const request = await this.getVendorWorkOrder(token);
+    const comments = await this.prisma.maintenanceComment.findMany({
+      where: { request_id: request.id, is_internal: false },
+      include: commentInclude,
+      orderBy: { created_at: 'asc' },
+    });
+
+    return {
+      id: request.id,
+      title: request.title,
+      description: request.description,
+      category: request.category,
+      priority: request.priority,
+      status: request.status,
+      images: request.images,
+      scheduled_date: request.scheduled_date,
+      completed_date: request.completed_date,
+      property_name: request.property?.name,
+      property_address: [request.property?.street, request.property?.city].filter(Boolean).join(', '),
+      unit_number: request.unit?.unit_number,
+      vendor: request.vendor,
+      can_update: !['completed', 'cancelled'].includes(request.status),
+      comments: comments.map(c => ({
+        id: c.id,
+        comment: c.comment,
+        comment_type: c.comment_type,
+        to_status: c.to_status,
+        attachments: c.attachments,
+        author_name: c.vendor?.name || (c.author ? `${c.author.first_name} ${c.author.last_name}` : null),
+        created_at: c.created_at,
+      })),
+    };
+  }
+
+  /**
+   * Status update or progress note posted by the vendor through their link
+   */
+  async vendorUpdate(token: string, req: VendorStatusUpdate): Promise<any> {
+    const request = await this.getVendorWorkOrder(token);
+    if (['completed', 'cancelled'].includes(request.status)) {
+      throw new Error(`work order is already ${request.status}`);
+    }
+    if (req.status && !['in_progress', 'completed'].includes(req.status)) {
+      throw new Error("status must be 'in_progress' or 'completed'");
+    }
+    if (!req.status && !req.note?.trim()) {
+      throw new Error('status or note is required');
+    }
+    if (req.actual_cost !== undefined && (typeof req.actual_cost !== 'number' || req.actual_cost < 0)) {
+      throw new Error('actual_cost must be a positive number');
+    }
+    if (req.status) {
+      this.assertTransition(request.status, req.status);
+      const blockedReason = maintenanceCostsService.workBlockedReason(request.cost_approval_status);
+      if (req.status !== request.status && blockedReason) {
+        throw new Error(blockedReason);
+      }
+    }
+
+    const statusChanged = !!req.status && req.status !== request.status;
+    if (statusChanged || req.actual_cost !== undefined || !request.first_response_at) {
+      await this.prisma.maintenanceRequest.update({
+        where: { id: request.id },
+        data: {
+          ...(statusChanged && { status: req.status as any }),
+          ...(req.status === 'completed' && { completed_date: new Date(), resolved_at: new Date() }),
+          ...(req.actual_cost !== undefined && { actual_cost: req.actual_cost }),
+          ...(!request.first_response_at && { first_response_at: new Date() }),
+          updated_at: new Date(),
+        },
+      });
     }
 
-    // Check permissions
-    if (user.company_id && existingRequest.company_id !== user.company_id) {
-      throw new Error('You do not have permission to delete this maintenance request');
+    const note = req.note?.trim();
+    await this.prisma.maintenanceComment.create({
+      data: {
+        request_id: request.id,
+        vendor_id: request.vendor_id,
+        comment_type: statusChanged ? 'status_change' : 'comment',
+        comment: statusChanged
+          ? `Status changed from ${request.status} to ${req.status}${note ? `: ${note}` : ''}`
+          : note!,
+        from_status: statusChanged ? request.status : null,
+        to_status: statusChanged ? req.status : null,
+        attachments: req.attachments || [],
+      },
+    });
+
+    // Notify the owner and whoever assigned the vendor; there is no signed-in user, so write directly
+    const assignment = await this.prisma.maintenanceComment.findFirst({
+      where: { request_id: request.id, comment_type: 'assignment', author_id: { not: null } },
+      orderBy: { created_at: 'desc' },
+      select: { author_id: true },
+    });
+    const recipients = new Set([request.property?.owner_id, assignment?.author_id].filter(Boolean) as string[]);
+    const message = statusChanged
+      ? `${request.vendor?.name} marked "${request.title}" as ${req.status!.replace('_', ' ')}.`
+      : `${request.vendor?.name} commented on "${request.title}": ${note}`;
+    await this.notifyTenant(
+      { ...request, status: statusChanged ? req.status : request.status },
+      statusChanged ? 'Maintenance request updated' : 'New update on your maintenance request',
+      statusChanged
+        ? `Your request "${request.title}" is now ${req.status!.replace('_', ' ')}.`
+        : `${request.title}: ${note}`
+    );
+    for (const recipientId of recipients) {
+      try {
+        const { notificationsService } = await import('./notifications.service.js');
+        await notificationsService.notify({
+          company_id: request.company_id,
+          recipient_id: recipientId,
+          title: statusChanged ? 'Vendor updated work order' : 'Vendor commented on work order',
+          message,
+          notification_type: 'maintenance',
+          category: 'maintenance',
+          priority: 'medium',
+          property_id: request.property_id,
+          unit_id: request.unit_id,
+          related_entity_type: 'maintenance_request',
+          related_entity_id: request.id,
+          metadata: { maintenance_request_id: request.id, vendor_id: request.vendor_id },
+        });
+      } catch (error: any) {
+        console.error('⚠️ Failed to notify about vendor update:', error.message);
+      }
     }
 
+    return this.getVendorView(token);
+  }
+
+  private assertAttachmentTypes(files: UploadedAttachment[]) {
+    for (const file of files) {
+      if (!ATTACHMENT_MIME_PREFIXES.some(prefix => file.mimetype.startsWith(prefix))) {
+        throw new Error('attachments must be photos, audio or video');
+      }
+    }
+  }
+
+  private async uploadAttachments(requestId: string, files: UploadedAttachment[], user: JWTClaims) {
+    this.assertAttachmentTypes(files);
+    return Promise.all(files.map(async (file, index) => {
+      const extension = file.originalname.includes('.') ? file.originalname.split('.').pop() : '';
+      const upload = await imagekitService.uploadFile(
+        file.buffer,
+        `maintenance-${requestId}-${Date.now()}-${index}${extension ? `.${extension}` : ''}`,
+        `maintenance/${requestId}`
+      );
+      return {
+        url: upload.url,
+        file_id: upload.fileId,
+        name: file.originalname,
+        mime_type: file.mimetype,
+        kind: mediaKind(file.mimetype),
+        size: file.size,
+        thumbnail_url: imagekitService.thumbnailUrl(upload.url, file.mimetype),
+        uploaded_by: user.user_id,
+        uploaded_at: new Date().toISOString(),
+      };
+    }));
+  }
+
+  /**
+   * Upload photos, voice notes or video to a request; they appear on the timeline as a comment
+   */
+  async addAttachments(id: string, files: UploadedAttachment[], note: string | undefined, user: JWTClaims): Promise<any> {
+    if (files.length === 0) {
+      throw new Error('at least one file is required');
+    }
+    const request = await this.getAccessibleRequest(id, user);
+    const media = await this.uploadAttachments(id, files, user);
+    const kinds = [...new Set(media.map(m => m.kind))].join('/');
+
+    return this.addComment(id, {
+      comment: note?.trim() || `Added ${media.length} ${kinds} attachment${media.length === 1 ? '' : 's'}`,
+      attachments: media as any,
+    }, user, request);
+  }
+
+  /**
+   * Remove an attachment from the timeline (uploader or managers only)
+   */
+  async removeAttachment(id: string, fileId: string, user: JWTClaims): Promise<void> {
+    await this.getAccessibleRequest(id, user);
+    const comments = await this.prisma.maintenanceComment.findMany({
+      where: { request_id: id, attachments: { array_contains: [{ file_id: fileId }] } },
+    });
+    const comment = comments[0];
+    if (!comment) {
+      throw new Error('attachment not found');
+    }
+    const attachment = (comment.attachments as any[]).find(a => a.file_id === fileId);
+    if (attachment.uploaded_by !== user.user_id && !MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to remove this attachment');
+    }
+
+    await this.prisma.maintenanceComment.update({
+      where: { id: comment.id },
+      data: { attachments: (comment.attachments as any[]).filter(a => a.file_id !== fileId) },
+    });
+    try {
+      await imagekitService.deleteFile(fileId);
+    } catch (error: any) {
+      console.error(`⚠️ Failed to delete maintenance attachment ${fileId} from storage:`, error.message);
+    }
+  }
+
+  async deleteMaintenanceRequest(id: string, user: JWTClaims): Promise<void> {
+    if (!id) {
+      throw new Error('Maintenance request ID is required');
+    }
+
+    // First, check if the request exists and user has permission
+    await this.getAccessibleRequest(id, user);
+
     // Check role permissions (only admins can delete)
     if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
       throw new Error('Insufficient permissions to delete maintenance requests');
@@ -349,18 +1223,57 @@ export class MaintenanceService {
     });
   }
 
-  async getMaintenanceOverview(user: JWTClaims): Promise<any> {
-    // For now, return mock overview data
-    // TODO: Implement actual database queries
+  async getMaintenanceOverview(user: JWTClaims, query: MaintenanceAnalyticsQuery = {}): Promise<any> {
+    const where: any = user.role === 'super_admin' ? {} : { company_id: user.company_id };
+    if (FIELD_ROLES.includes(user.role)) {
+      const propertyIds = await this.getStaffPropertyIds(user.user_id);
+      where.OR = [{ assigned_to: user.user_id }, { property_id: { in: propertyIds } }];
+    }
+    const open = { status: { in: ['pending', 'in_progress'] as any } };
+    const today = new Date();
+    today.setHours(0, 0, 0, 0);
+
+    const [total, pending, inProgress, completed, overdue, highPriority, completedRequests, recent] = await Promise.all([
+      this.prisma.maintenanceRequest.count({ where }),
+      this.prisma.maintenanceRequest.count({ where: { ...where, status: 'pending' } }),
+      this.prisma.maintenanceRequest.count({ where: { ...where, status: 'in_progress' } }),
+      this.prisma.maintenanceRequest.count({ where: { ...where, status: 'completed' } }),
+      this.prisma.maintenanceRequest.count({ where: { ...where, ...open, scheduled_date: { lt: today } } }),
+      this.prisma.maintenanceRequest.count({ where: { ...where, ...open, priority: { in: ['high', 'urgent'] as any } } }),
+      this.prisma.maintenanceRequest.findMany({
+        where: { ...where, status: 'completed', completed_date: { not: null } },
+        select: { requested_date: true, completed_date: true },
+        orderBy: { completed_date: 'desc' },
+        take: 200,
+      }),
+      this.prisma.maintenanceRequest.findMany({
+        where,
+        include: requestInclude,
+        orderBy: { created_at: 'desc' },
+        take: 5,
+      }),
+    ]);
+
+    // Average days from request to completion over the most recent completed requests
+    const completionDays = completedRequests.map(r =>
+      (r.completed_date!.getTime() - r.requested_date.getTime()) / (24 * 60 * 60 * 1000)
+    );
+    const averageCompletion = completionDays.length > 0
+      ? Math.round((completionDays.reduce((sum, d) => sum + d, 0) / completionDays.length) * 10) / 10
+      : 0;
+
+    const analytics = await maintenanceAnalyticsService.getAnalytics(where, query);
+
     return {
-      total_requests: 0,
-      pending_requests: 0,
-      in_progress_requests: 0,
-      completed_requests: 0,
-      overdue_requests: 0,
-      high_priority_requests: 0,
-      average_completion_time: 0,
-      recent_requests: []
+      total_requests: total,
+      pending_requests: pending,
+      in_progress_requests: inProgress,
+      completed_requests: completed,
+      overdue_requests: overdue,
+      high_priority_requests: highPriority,
+      average_completion_time: averageCompletion,
+      recent_requests: recent.map(r => toResponse(r, user)),
+      analytics,
     };
   }
 }
@@ -0,0 +1,194 @@
+import { randomUUID } from 'crypto';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { imagekitService } from './imagekit.service.js';
+import { attachmentScanner } from './attachment-scanner.service.js';
+import { readMediaMetadata } from '../utils/media-metadata.js';
+
+export interface UploadedMessageFile {
+  buffer: Buffer;
+  originalname: string;
+  mimetype: string;
+  size: number;
+}
+
+type AttachmentKind = 'image' | 'audio' | 'video' | 'document';
+
+const MB = 1024 * 1024;
+
+// Where /messaging/attachments stores a file; one uploaded before its conversation existed sits in drafts
+const attachmentFolder = (companyId: string | null | undefined, conversationId?: string | null) =>
+  `messages/${companyId || 'system'}/${conversationId || 'drafts'}`;
+
+// Accepted types and the size ceiling for each kind of chat attachment
+export const ATTACHMENT_LIMITS: Record<AttachmentKind, { maxBytes: number; mimeTypes: string[] }> = {
+  image: {
+    maxBytes: 10 * MB,
+    mimeTypes: ['image/jpeg', 'image/png', 'image/gif', 'image/webp', 'image/heic', 'image/heif'],
+  },
+  audio: {
+    maxBytes: 20 * MB,
+    mimeTypes: ['audio/mpeg', 'audio/mp3', 'audio/mp4', 'audio/x-m4a', 'audio/aac', 'audio/ogg', 'audio/opus', 'audio/wav', 'audio/x-wav', 'audio/webm', 'audio/3gpp', 'audio/amr'],
+  },
+  video: {
+    maxBytes: 50 * MB,
+    mimeTypes: ['video/mp4', 'video/quicktime', 'video/webm', 'video/3gpp'],
+  },
+  document: {
+    maxBytes: 20 * MB,
+    mimeTypes: [
+      'application/pdf',
+      'application/msword',
+      'application/vnd.openxmlformats-officedocument.wordprocessingml.document',
+      'application/vnd.ms-excel',
+      'application/vnd.openxmlformats-officedocument.spreadsheetml.sheet',
+      'text/plain',
+      'text/csv',
+    ],
+  },
+};
+
+// Hard cap for the upload middleware; the per-kind limits above are checked in the service
+export const MAX_ATTACHMENT_BYTES = Math.max(...Object.values(ATTACHMENT_LIMITS).map(limit => limit.maxBytes));
+export const MAX_ATTACHMENTS_PER_MESSAGE = 10;
+
+const HEIF_TYPES = ['image/heic', 'image/heif'];
+
+// Phones often send HEIC photos as octet-stream; trust the extension only for those
+const mimeTypeOf = (file: UploadedMessageFile) => {
+  const extension = file.originalname.split('.').pop()?.toLowerCase();
+  if (file.mimetype === 'application/octet-stream' && (extension === 'heic' || extension === 'heif')) {
+    return `image/${extension}`;
+  }
+  return file.mimetype.toLowerCase();
+};
+
+const kindOf = (mimeType: string): AttachmentKind | null =>
+  (Object.keys(ATTACHMENT_LIMITS) as AttachmentKind[]).find(kind => ATTACHMENT_LIMITS[kind].mimeTypes.includes(mimeType)) || null;
+
+/**
+ * Kinds a file's leading bytes are consistent with, or null when the signature isn't one we know
+ */
+const sniffKinds = (buffer: Buffer): AttachmentKind[] | null => {
+  if (buffer.length < 12) return null;
+  const head = buffer.toString('latin1', 0, 12);
+  if (head.startsWith('%PDF')) return ['document'];
+  if (buffer[0] === 0x89 && head.slice(1, 4) === 'PNG') return ['image'];
+  if (buffer[0] === 0xff && buffer[1] === 0xd8) return ['image'];
+  if (head.startsWith('GIF8')) return ['image'];
+  if (head.startsWith('RIFF')) return head.slice(8, 12) === 'WEBP' ? ['image'] : ['audio', 'video'];
+  if (head.slice(4, 8) === 'ftyp') return ['image', 'audio', 'video'];
+  if (head.startsWith('OggS') || head.startsWith('ID3') || head.startsWith('#!AMR')) return ['audio'];
+  if (buffer.readUInt32BE(0) === 0x1a45dfa3) return ['audio', 'video']; // Matroska/WebM
+  if (head.startsWith('MZ') || head.startsWith('\x7fELF')) return []; // executables are never attachments
+  return null;
+};
+
+/**
+ * Chat attachment uploads: per-kind type and size limits, antivirus scanning, HEIC delivered as
+ * JPEG, and the dimensions/duration clients need to render a placeholder before downloading
+ */
+export class MessageAttachmentsService {
+  async upload(files: UploadedMessageFile[], user: JWTClaims, conversationId?: string) {
+    if (files.length === 0) {
+      throw new Error('at least one file is required');
+    }
+    if (files.length > MAX_ATTACHMENTS_PER_MESSAGE) {
+      throw new Error(`attachments must be at most ${MAX_ATTACHMENTS_PER_MESSAGE} files per upload`);
+    }
+    if (conversationId) {
+      const { messagingService, WRITER_ROLES } = await import('./messaging.service.js');
+      await messagingService.requireParticipant(user, conversationId, WRITER_ROLES);
+    }
+
+    const checked = files.map(file => {
+      const mimeType = mimeTypeOf(file);
+      const kind = kindOf(mimeType);
+      if (!kind) {
+        throw new Error(`${file.originalname} must be a photo, audio, video, PDF, Office or text file`);
+      }
+      const { maxBytes } = ATTACHMENT_LIMITS[kind];
+      if (file.size > maxBytes) {
+        throw new Error(`${file.originalname} must be at most ${maxBytes / MB}MB for ${kind} attachments`);
+      }
+      const sniffed = sniffKinds(file.buffer);
+      if (sniffed && !sniffed.includes(kind)) {
+        throw new Error(`${file.originalname} was rejected: its content does not match ${mimeType}`);
+      }
+      return { file, mimeType, kind };
+    });
+
+    const scans = await Promise.all(checked.map(({ file }) => attachmentScanner.scan(file.buffer)));
+    scans.forEach((scan, index) => {
+      const name = checked[index].file.originalname;
+      if (scan.status === 'infected') {
+        console.warn(`🦠 Blocked message attachment ${name} from user ${user.user_id}: ${scan.signature}`);
+        throw new Error(`${name} was rejected: malware detected (${scan.signature})`);
+      }
+      if (scan.status === 'error') {
+        console.error(`⚠️ Attachment scan failed for ${name}:`, scan.error);
+        if (env.attachments.failClosed) {
+          throw new Error('attachment scanning is unavailable, please try again later');
+        }
+      }
+    });
+
+    return Promise.all(checked.map(async ({ file, mimeType, kind }, index) => {
+      const extension = file.originalname.includes('.') ? file.originalname.split('.').pop()!.toLowerCase() : '';
+      const upload = await imagekitService.uploadFile(
+        file.buffer,
+        `message-${randomUUID()}${extension ? `.${extension}` : ''}`,
+        attachmentFolder(user.company_id, conversationId)
+      );
+      // Browsers and Android can't show HEIC; ImageKit converts it to JPEG on delivery
+      const converted = HEIF_TYPES.includes(mimeType);
+      const url = converted ? `${upload.url}?tr=f-jpg` : upload.url;
+
+      return {
+        file_id: upload.fileId,
+        url,
+        ...(converted ? { original_url: upload.url, converted_from: mimeType } : {}),
+        name: file.originalname,
+        mime_type: converted ? 'image/jpeg' : mimeType,
+        kind,
+        size: file.size,
+        ...readMediaMetadata(file.buffer, mimeType),
+        thumbnail_url: converted
+          ? `${upload.url}?tr=f-jpg,w-320,h-320,c-at_max`
+          : imagekitService.thumbnailUrl(upload.url, mimeType),
+        scan_status: scans[index].status,
+        uploaded_by: user.user_id,
+        uploaded_at: new Date().toISOString(),
+      };
+    }));
+  }
+
+  /**
+   * Attachments on a new message must be files /messaging/attachments stored for this company and
+   * conversation (or as drafts before it existed): the file ID is looked up in storage and the URL
+   * must be that file's. Anything else, such as an external link dressed up as a clean upload,
+   * skipped the size, type and malware checks and is refused.
+   */
+  async assertValidAttachments(attachments: unknown, user: JWTClaims, conversationId: string) {
+    if (attachments === undefined || attachments === null) return;
+    if (!Array.isArray(attachments)) {
+      throw new Error('attachments must be an array');
+    }
+    if (attachments.length > MAX_ATTACHMENTS_PER_MESSAGE) {
+      throw new Error(`attachments must be at most ${MAX_ATTACHMENTS_PER_MESSAGE} per message`);
+    }
+    const folders = [attachmentFolder(user.company_id, conversationId), attachmentFolder(user.company_id)].map(folder => `/${folder}/`);
+    for (const attachment of attachments) {
+      if (!attachment || typeof attachment !== 'object' || typeof attachment.url !== 'string' || typeof attachment.file_id !== 'string') {
+        throw new Error('attachments must be file descriptors as returned by /messaging/attachments');
+      }
+      const stored = await imagekitService.getFileDetails(attachment.file_id);
+      const ownUrl = stored && [stored.url, `${stored.url}?tr=f-jpg`].includes(attachment.url);
+      if (!stored || !folders.some(folder => stored.filePath.startsWith(folder)) || !ownUrl) {
+        throw new Error(`${attachment.name || 'attachment'} was not uploaded through /messaging/attachments for this conversation`);
+      }
+    }
+  }
+}
+
+export const messageAttachmentsService = new MessageAttachmentsService();
@@ -0,0 +1,334 @@
+import axios from 'axios';
+import crypto from 'crypto';
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { parseMime, emailAddressOf } from '../utils/mime.js';
+import { stripQuotedReply, htmlToText, REPLY_ABOVE_MARKER } from '../utils/email-reply.js';
+import type { UploadedMessageFile } from './message-attachments.service.js';
+
+export interface InboundEmail {
+  provider: 'mailgun' | 'ses';
+  recipients: string[];
+  from: string | null;
+  subject: string | null;
+  messageId: string | null;
+  text: string | null;
+  // Reply already separated from the quoted thread by the provider (Mailgun's stripped-text)
+  strippedText?: string | null;
+  html: string | null;
+  attachments: UploadedMessageFile[];
+}
+
+export interface InboundEmailResult {
+  status: 'created' | 'duplicate' | 'ignored' | 'rejected';
+  reason?: string;
+  message_id?: string;
+}
+
+// Mailgun signs webhooks with a timestamp; older ones are treated as replays
+const MAILGUN_MAX_AGE_SECONDS = 15 * 60;
+
+// Fields SNS signs, in signing order, per message type
+const SNS_SIGNED_FIELDS: Record<string, string[]> = {
+  Notification: ['Message', 'MessageId', 'Subject', 'Timestamp', 'TopicArn', 'Type'],
+  SubscriptionConfirmation: ['Message', 'MessageId', 'SubscribeURL', 'Timestamp', 'Token', 'TopicArn', 'Type'],
+  UnsubscribeConfirmation: ['Message', 'MessageId', 'SubscribeURL', 'Timestamp', 'Token', 'TopicArn', 'Type'],
+};
+const SNS_CERT_HOST = /^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$/;
+
+const safeEqual = (a: string, b: string) =>
+  a.length === b.length && crypto.timingSafeEqual(Buffer.from(a), Buffer.from(b));
+
+/**
+ * Reply-by-email for conversations. Every participant gets a private reply address
+ * (reply+<token>@INBOUND_EMAIL_DOMAIN) used as Reply-To on message emails; replies arrive from
+ * Mailgun routes or SES receipt rules (via SNS), are matched to the participant, stripped of the
+ * quoted thread and posted into the conversation as that participant.
+ */
+export class MessageEmailService {
+  private prisma = getPrisma();
+  private snsCertificates = new Map<string, string>();
+
+  isEnabled() {
+    return !!env.inboundEmail.domain;
+  }
+
+  /**
+   * The participant's reply address for a conversation, issuing the token on first use
+   */
+  async replyAddress(conversationId: string, userId: string) {
+    if (!this.isEnabled()) return null;
+    const participant = await this.prisma.conversationParticipant.findUnique({
+      where: { conversation_id_user_id: { conversation_id: conversationId, user_id: userId } },
+      select: { id: true, reply_token: true },
+    });
+    if (!participant) return null;
+
+    let token = participant.reply_token;
+    if (!token) {
+      // Lowercase only: some mail servers lowercase the local part
+      token = crypto.randomBytes(12).toString('hex');
+      await this.prisma.conversationParticipant.update({ where: { id: participant.id }, data: { reply_token: token } });
+    }
+    return `reply+${token}@${env.inboundEmail.domain}`;
+  }
+
+  /**
+   * Email a new message to the participants who route chat messages to email, with their reply
+   * address as Reply-To so answering from the inbox lands back in the thread
+   */
+  async sendMessageEmails(messageId: string) {
+    const message = await this.prisma.message.findUnique({
+      where: { id: messageId },
+      include: {
+        sender: { select: { id: true, first_name: true, last_name: true } },
+        conversation: {
+          select: {
+            id: true,
+            company_id: true,
+            subject: true,
+            participants: {
+              where: { left_at: null },
+              select: { user: { select: { id: true, email: true, first_name: true } } },
+            },
+          },
+        },
+      },
+    });
+    if (!message?.conversation || message.message_type === 'system') return 0;
+
+    const { notificationsService } = await import('./notifications.service.js');
+    const { emailTemplatesService } = await import('./email-templates.service.js');
+    const senderName = `${message.sender.first_name} ${message.sender.last_name}`.trim();
+    const subject = `Re: ${message.conversation.subject || `Message from ${senderName}`}`;
+    const files = (Array.isArray(message.attachments) ? (message.attachments as any[]) : [])
+      .filter(a => a && typeof a.url === 'string')
+      .map(a => `${a.name || 'attachment'}: ${a.url}`);
+
+    let sent = 0;
+    for (const { user: recipient } of message.conversation.participants) {
+      if (recipient.id === message.sender_id || !recipient.email) continue;
+      const allowed = await notificationsService.resolveChannels(recipient.id, 'message', ['email'], 'message', message.priority);
+      if (!allowed.includes('email')) continue;
+
+      const replyTo = await this.replyAddress(message.conversation.id, recipient.id);
+      const result = await emailTemplatesService.send('conversation_message', {
+        to: recipient.email,
+        recipientId: recipient.id,
+        companyId: message.conversation.company_id,
+        ...(replyTo && { replyTo: { email: replyTo, name: 'LetRents Messages' } }),
+        variables: {
+          // Replies are cut at the marker, so it goes first in the email
+          reply_marker: replyTo ? REPLY_ABOVE_MARKER : null,
+          subject,
+          sender_name: senderName,
+          message: message.content,
+          attachments: files.length ? [{ title: 'Attachments', lines: files }] : [],
+        },
+      });
+      if (result.success) sent++;
+    }
+    return sent;
+  }
+
+  /**
+   * Mailgun route forwarding (store-and-notify or forward()) posting the parsed message
+   */
+  async handleMailgun(body: Record<string, any>, files: Array<{ buffer: Buffer; originalname: string; mimetype: string; size: number }> = []) {
+    if (!env.inboundEmail.mailgunSigningKey) {
+      throw new Error('Mailgun inbound email is not configured');
+    }
+    const { timestamp, token, signature } = body;
+    const expected = crypto
+      .createHmac('sha256', env.inboundEmail.mailgunSigningKey)
+      .update(`${timestamp}${token}`)
+      .digest('hex');
+    if (!timestamp || !token || !signature || !safeEqual(expected, String(signature))) {
+      throw new Error('Invalid Mailgun webhook signature');
+    }
+    if (Math.abs(Date.now() / 1000 - Number(timestamp)) > MAILGUN_MAX_AGE_SECONDS) {
+      throw new Error('Invalid Mailgun webhook signature: timestamp too old');
+    }
+
+    return this.ingest({
+      provider: 'mailgun',
+      recipients: String(body.recipient || body.To || '').split(',').map(emailAddressOf).filter((a): a is string => !!a),
+      from: body.sender || body.from || body.From || null,
+      subject: body.subject || body.Subject || null,
+      messageId: (body['Message-Id'] || body['message-id'] || '').replace(/^<|>$/g, '') || null,
+      text: body['body-plain'] || null,
+      strippedText: body['stripped-text'] || null,
+      html: body['body-html'] || null,
+      attachments: files,
+    });
+  }
+
+  /**
+   * SES receipt rule → SNS topic (raw content included). Handles the topic's subscription
+   * confirmation as well as the received-mail notifications.
+   */
+  async handleSes(rawBody: string) {
+    let notification: any;
+    try {
+      notification = JSON.parse(rawBody);
+    } catch {
+      throw new Error('SES notification is missing or malformed');
+    }
+    if (!env.inboundEmail.sesTopicArn || notification.TopicArn !== env.inboundEmail.sesTopicArn) {
+      throw new Error('Invalid SNS topic for inbound email');
+    }
+    await this.verifySnsSignature(notification);
+
+    if (notification.Type === 'SubscriptionConfirmation') {
+      await axios.get(notification.SubscribeURL, { timeout: 10000 });
+      console.log(`📬 Confirmed SNS subscription to ${notification.TopicArn}`);
+      return { status: 'ignored', reason: 'subscription confirmed' } as InboundEmailResult;
+    }
+    if (notification.Type !== 'Notification') {
+      return { status: 'ignored', reason: `unhandled SNS message type ${notification.Type}` } as InboundEmailResult;
+    }
+
+    const received = JSON.parse(notification.Message || '{}');
+    if (received.notificationType !== 'Received' || !received.content) {
+      return { status: 'ignored', reason: 'no email content in notification' } as InboundEmailResult;
+    }
+    const verdicts = received.receipt || {};
+    if (verdicts.virusVerdict?.status === 'FAIL' || verdicts.spamVerdict?.status === 'FAIL') {
+      return { status: 'rejected', reason: 'flagged as spam or virus' } as InboundEmailResult;
+    }
+    // Sender identity has to be vouched for by SPF or DKIM before we post as a participant
+    if (verdicts.spfVerdict?.status !== 'PASS' && verdicts.dkimVerdict?.status !== 'PASS') {
+      return { status: 'rejected', reason: 'sender failed SPF and DKIM' } as InboundEmailResult;
+    }
+
+    // The SNS action sends raw MIME as UTF-8 text or, with BASE64 encoding, base64
+    const content: string = received.content;
+    const raw = /^[A-Za-z0-9+/=\r\n]+$/.test(content.slice(0, 2000)) ? Buffer.from(content, 'base64') : Buffer.from(content, 'utf8');
+    const email = parseMime(raw);
+    return this.ingest({
+      provider: 'ses',
+      recipients: [...(received.receipt?.recipients || []), ...email.to].map(emailAddressOf).filter((a): a is string => !!a),
+      from: email.from,
+      subject: email.subject,
+      messageId: email.messageId || received.mail?.messageId || null,
+      text: email.text,
+      html: email.html,
+      attachments: email.attachments.map(a => ({ buffer: a.content, originalname: a.filename, mimetype: a.contentType, size: a.content.length })),
+    });
+  }
+
+  /**
+   * Post an inbound reply into its conversation as the participant it was addressed to
+   */
+  async ingest(email: InboundEmail): Promise<InboundEmailResult> {
+    if (!this.isEnabled()) {
+      return { status: 'ignored', reason: 'inbound email is disabled' };
+    }
+    const domain = env.inboundEmail.domain.toLowerCase();
+    const token = email.recipients
+      .map(address => new RegExp(`^reply\\+([a-f0-9]+)@${domain.replace(/\./g, '\\.')}$`).exec(address)?.[1])
+      .find(Boolean);
+    if (!token) {
+      return { status: 'ignored', reason: 'no conversation reply address among recipients' };
+    }
+
+    const participant = await this.prisma.conversationParticipant.findUnique({
+      where: { reply_token: token },
+      include: {
+        user: { select: { id: true, email: true, phone_number: true, role: true, company_id: true, agency_id: true, status: true } },
+      },
+    });
+    if (!participant || participant.left_at || participant.user.status !== 'active') {
+      return { status: 'rejected', reason: 'reply address is no longer valid' };
+    }
+    const from = emailAddressOf(email.from);
+    if (!from || from !== participant.user.email?.toLowerCase()) {
+      console.warn(`⚠️ Inbound email for conversation ${participant.conversation_id} from ${from} does not match the participant`);
+      return { status: 'rejected', reason: 'sender does not match the reply address' };
+    }
+
+    if (email.messageId) {
+      const existing = await this.prisma.message.findFirst({
+        where: { conversation_id: participant.conversation_id, metadata: { path: ['email_message_id'], equals: email.messageId } },
+        select: { id: true },
+      });
+      if (existing) {
+        return { status: 'duplicate', message_id: existing.id };
+      }
+    }
+
+    const user = {
+      user_id: participant.user.id,
+      email: participant.user.email,
+      phone_number: participant.user.phone_number || '',
+      role: participant.user.role,
+      company_id: participant.user.company_id || undefined,
+      agency_id: participant.user.agency_id || undefined,
+    } as JWTClaims;
+
+    let attachments: any[] = [];
+    if (email.attachments.length) {
+      try {
+        const { messageAttachmentsService } = await import('./message-attachments.service.js');
+        attachments = await messageAttachmentsService.upload(email.attachments, user, participant.conversation_id);
+      } catch (error: any) {
+        console.error(`⚠️ Dropped attachments of inbound email ${email.messageId}:`, error.message);
+      }
+    }
+
+    const content = (email.strippedText?.trim() || stripQuotedReply(email.text || htmlToText(email.html || ''))).trim();
+    if (!content && !attachments.length) {
+      return { status: 'ignored', reason: 'empty reply' };
+    }
+
+    try {
+      const { messagingService } = await import('./messaging.service.js');
+      const message = await messagingService.createMessage(user, {
+        conversationId: participant.conversation_id,
+        recipientIds: [],
+        content: content || attachments.map(a => `📎 ${a.name}`).join('\n'),
+        attachments,
+        metadata: { source: 'email', email_provider: email.provider, email_message_id: email.messageId },
+      });
+      console.log(`📨 Posted email reply ${email.messageId} into conversation ${participant.conversation_id}`);
+      return { status: 'created', message_id: message.id };
+    } catch (error: any) {
+      // Archived conversations and observers can't post; the mail is dropped rather than retried
+      console.warn(`⚠️ Inbound email reply not posted to ${participant.conversation_id}:`, error.message);
+      return { status: 'rejected', reason: error.message };
+    }
+  }
+
+  private async verifySnsSignature(notification: Record<string, any>) {
+    const fields = SNS_SIGNED_FIELDS[notification.Type];
+    let certUrl: URL;
+    try {
+      certUrl = new URL(notification.SigningCertURL);
+    } catch {
+      throw new Error('Invalid SNS signature: bad certificate URL');
+    }
+    if (!fields || certUrl.protocol !== 'https:' || !SNS_CERT_HOST.test(certUrl.hostname)) {
+      throw new Error('Invalid SNS signature: untrusted certificate URL');
+    }
+
+    let certificate = this.snsCertificates.get(certUrl.href);
+    if (!certificate) {
+      const response = await axios.get(certUrl.href, { responseType: 'text', timeout: 10000 });
+      certificate = String(response.data);
+      this.snsCertificates.set(certUrl.href, certificate);
+    }
+
+    const signed = fields
+      .filter(field => notification[field] !== undefined)
+      .map(field => `${field}\n${notification[field]}\n`)
+      .join('');
+    const verifier = crypto.createVerify(notification.SignatureVersion === '2' ? 'RSA-SHA256' : 'RSA-SHA1');
+    verifier.update(signed, 'utf8');
+    if (!verifier.verify(certificate, notification.Signature || '', 'base64')) {
+      throw new Error('Invalid SNS signature');
+    }
+  }
+}
+
+export const messageEmailService = new MessageEmailService();
@@ -0,0 +1,377 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface EscalationRuleRequest {
+  name?: string;
+  priorities?: string[];
+  sender_role?: string;
+  unanswered_minutes?: number;
+  target?: string;
+  channels?: string[];
+  is_active?: boolean;
+}
+
+// Who gets alerted when a rule fires
+export const ESCALATION_TARGETS: Record<string, string> = {
+  agency_admin: "The company's agency admins",
+  landlord: 'The owner of the property the conversation is about',
+  property_staff: 'Agents and caretakers assigned to that property',
+  conversation_staff: 'Everyone in the conversation outside the sender role',
+};
+
+const MESSAGE_PRIORITIES = ['low', 'medium', 'high', 'urgent'];
+const SENDER_ROLES = ['tenant', 'caretaker', 'agent', 'landlord'];
+const ESCALATION_CHANNELS = ['app', 'push', 'email', 'sms'];
+const MANAGER_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+
+// Shortest wait a rule may use; the evaluator runs every five minutes
+const MIN_UNANSWERED_MINUTES = 5;
+const MAX_UNANSWERED_MINUTES = 7 * 24 * 60;
+// Messages older than this past their deadline are history, not something to escalate now
+const LOOKBACK_MS = 24 * 60 * 60 * 1000;
+// Conversations escalated per rule in one run
+const BATCH_SIZE = 200;
+
+const formatWait = (minutes: number) =>
+  minutes < 60 ? `${minutes} min` : minutes % 60 ? `${Math.floor(minutes / 60)}h ${minutes % 60}min` : `${minutes / 60}h`;
+
+interface UnansweredMessage {
+  id: string;
+  conversation_id: string;
+  sender_id: string;
+  sent_at: Date;
+  content: string;
+  subject: string;
+  lease_id: string | null;
+}
+
+/**
+ * Escalation rules for messages nobody has answered: a background evaluator finds conversations
+ * where the latest messages from the watched role have waited past the rule's limit without a
+ * reply from anyone else, alerts the rule's target over its channels and records each alert.
+ * A conversation is escalated once per unanswered stretch; the next reply starts a new one.
+ */
+export class MessageEscalationService {
+  private prisma = getPrisma();
+
+  async listRules(user: JWTClaims) {
+    this.requireManager(user);
+    const rules = await this.prisma.messageEscalationRule.findMany({
+      where: this.ruleScope(user),
+      orderBy: [{ is_active: 'desc' }, { unanswered_minutes: 'asc' }],
+    });
+    return { rules, targets: ESCALATION_TARGETS };
+  }
+
+  async createRule(req: EscalationRuleRequest, user: JWTClaims) {
+    this.requireManager(user);
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    const data = this.validate(req);
+    return this.prisma.messageEscalationRule.create({
+      data: {
+        ...data,
+        company_id: user.company_id,
+        agency_id: user.agency_id || null,
+        created_by: user.user_id,
+      },
+    });
+  }
+
+  async updateRule(ruleId: string, req: EscalationRuleRequest, user: JWTClaims) {
+    const rule = await this.findRule(ruleId, user);
+    const data = this.validate({
+      name: req.name ?? rule.name,
+      priorities: req.priorities ?? rule.priorities,
+      sender_role: req.sender_role ?? rule.sender_role,
+      unanswered_minutes: req.unanswered_minutes ?? rule.unanswered_minutes,
+      target: req.target ?? rule.target,
+      channels: req.channels ?? (rule.channels as string[]),
+      is_active: req.is_active ?? rule.is_active,
+    });
+    return this.prisma.messageEscalationRule.update({
+      where: { id: rule.id },
+      data: { ...data, updated_at: new Date() },
+    });
+  }
+
+  async deleteRule(ruleId: string, user: JWTClaims) {
+    const rule = await this.findRule(ruleId, user);
+    await this.prisma.messageEscalationRule.delete({ where: { id: rule.id } });
+  }
+
+  /**
+   * Audit trail of escalations, newest first
+   */
+  async listEscalations(user: JWTClaims, filters: { rule_id?: string; conversation_id?: string; limit?: number; offset?: number } = {}) {
+    this.requireManager(user);
+    const where: any = {
+      ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+      ...(user.role === 'agency_admin' && user.agency_id && { rule: { agency_id: user.agency_id } }),
+      ...(filters.rule_id && { rule_id: filters.rule_id }),
+      ...(filters.conversation_id && { conversation_id: filters.conversation_id }),
+    };
+    const limit = Math.min(filters.limit || 50, 200);
+    const [escalations, total] = await Promise.all([
+      this.prisma.messageEscalation.findMany({
+        where,
+        include: { rule: { select: { id: true, name: true, target: true } } },
+        orderBy: { escalated_at: 'desc' },
+        skip: filters.offset || 0,
+        take: limit,
+      }),
+      this.prisma.messageEscalation.count({ where }),
+    ]);
+
+    const userIds = [...new Set(escalations.map(e => e.target_user_id).filter(Boolean) as string[])];
+    const targets = userIds.length
+      ? await this.prisma.user.findMany({ where: { id: { in: userIds } }, select: { id: true, first_name: true, last_name: true, role: true } })
+      : [];
+    const byId = new Map(targets.map(t => [t.id, t]));
+    return {
+      escalations: escalations.map(e => ({ ...e, target_user: e.target_user_id ? byId.get(e.target_user_id) || null : null })),
+      total,
+      limit,
+      offset: filters.offset || 0,
+    };
+  }
+
+  /**
+   * Scheduled run: evaluate every active rule
+   */
+  async evaluate(now = new Date()) {
+    const rules = await this.prisma.messageEscalationRule.findMany({ where: { is_active: true } });
+    let escalated = 0;
+    for (const rule of rules) {
+      try {
+        escalated += await this.evaluateRule(rule, now);
+      } catch (error: any) {
+        console.error(`❌ Failed to evaluate message escalation rule ${rule.id}:`, error.message);
+      }
+    }
+    return { rules: rules.length, escalated };
+  }
+
+  private async evaluateRule(rule: any, now: Date) {
+    const cutoff = new Date(now.getTime() - rule.unanswered_minutes * 60 * 1000);
+    // Nothing from before the rule existed, and nothing that is long past its deadline
+    const since = new Date(Math.max(rule.created_at.getTime(), cutoff.getTime() - LOOKBACK_MS));
+
+    // The first message of each unanswered stretch: sent by the watched role, no later reply from
+    // anyone outside that role, and no escalation by this rule since the last such reply
+    const messages = await this.prisma.$queryRaw<UnansweredMessage[]>`
+      SELECT DISTINCT ON (m.conversation_id)
+        m.id, m.conversation_id, m.sender_id, m.sent_at, m.content, c.subject, c.lease_id
+      FROM messages m
+      JOIN conversations c ON c.id = m.conversation_id
+      JOIN users s ON s.id = m.sender_id
+      WHERE m.company_id = ${rule.company_id}::uuid
+        AND m.sent_at IS NOT NULL
+        AND m.message_type <> 'system'
+        AND m.priority::text = ANY(${rule.priorities}::text[])
+        AND s.role::text = ${rule.sender_role}
+        AND c.archived_at IS NULL
+        AND m.sent_at <= ${cutoff}
+        AND m.sent_at >= ${since}
+        AND NOT EXISTS (
+          SELECT 1 FROM messages r
+          JOIN users ru ON ru.id = r.sender_id
+          WHERE r.conversation_id = m.conversation_id
+            AND r.sent_at > m.sent_at
+            AND r.message_type <> 'system'
+            AND ru.role::text <> ${rule.sender_role}
+        )
+        AND NOT EXISTS (
+          SELECT 1 FROM message_escalations e
+          WHERE e.rule_id = ${rule.id}::uuid
+            AND e.conversation_id = m.conversation_id
+            AND e.escalated_at > COALESCE((
+              SELECT MAX(r.sent_at) FROM messages r
+              JOIN users ru ON ru.id = r.sender_id
+              WHERE r.conversation_id = m.conversation_id
+                AND r.message_type <> 'system'
+                AND ru.role::text <> ${rule.sender_role}
+            ), 'epoch'::timestamptz)
+        )
+      ORDER BY m.conversation_id, m.sent_at ASC
+      LIMIT ${BATCH_SIZE}
+    `;
+
+    for (const message of messages) {
+      await this.escalate(rule, message, now);
+    }
+    return messages.length;
+  }
+
+  private async escalate(rule: any, message: UnansweredMessage, now: Date) {
+    const waited = Math.round((now.getTime() - new Date(message.sent_at).getTime()) / 60000);
+    const base = {
+      rule_id: rule.id,
+      company_id: rule.company_id,
+      conversation_id: message.conversation_id,
+      message_id: message.id,
+      waited_minutes: waited,
+    };
+
+    const targetIds = (await this.targetsFor(rule, message)).filter(id => id !== message.sender_id);
+    if (!targetIds.length) {
+      await this.prisma.messageEscalation.create({ data: { ...base, status: 'no_recipient' } });
+      return;
+    }
+
+    const { notificationsService } = await import('./notifications.service.js');
+    const sender = await this.prisma.user.findUnique({
+      where: { id: message.sender_id },
+      select: { first_name: true, last_name: true },
+    });
+    const senderName = sender ? `${sender.first_name} ${sender.last_name}`.trim() : 'A user';
+    const excerpt = message.content.length > 120 ? `${message.content.slice(0, 117)}...` : message.content;
+    const title = `Unanswered message from ${senderName}`;
+    const body = `${senderName} has waited ${formatWait(waited)} for a reply in "${message.subject}": "${excerpt}"`;
+    const requested = (rule.channels as string[]).filter(channel => channel !== 'app');
+
+    for (const targetId of targetIds) {
+      try {
+        const channels = await notificationsService.resolveChannels(targetId, 'message_escalation', requested, 'message', 'urgent');
+        const notification = await notificationsService.notify({
+          company_id: rule.company_id,
+          recipient_id: targetId,
+          title,
+          message: body,
+          notification_type: 'message_escalation',
+          category: 'message',
+          priority: 'urgent',
+          action_required: true,
+          action_url: `/messages/${message.conversation_id}`,
+          related_entity_type: 'message',
+          related_entity_id: message.id,
+          metadata: { conversation_id: message.conversation_id, message_id: message.id, escalation_rule_id: rule.id },
+        }, channels);
+        await this.prisma.messageEscalation.create({
+          data: { ...base, target_user_id: targetId, notification_id: notification.id, channels: ['app', ...channels], status: 'notified' },
+        });
+      } catch (error: any) {
+        await this.prisma.messageEscalation.create({
+          data: { ...base, target_user_id: targetId, status: 'failed', error: error.message || 'Unknown error' },
+        });
+      }
+    }
+  }
+
+  /**
+   * The people a rule alerts about a message
+   */
+  private async targetsFor(rule: any, message: UnansweredMessage): Promise<string[]> {
+    switch (rule.target) {
+      case 'agency_admin': {
+        const admins = await this.prisma.user.findMany({
+          where: {
+            company_id: rule.company_id,
+            role: 'agency_admin',
+            status: 'active',
+            ...(rule.agency_id && { agency_id: rule.agency_id }),
+          },
+          select: { id: true },
+        });
+        return admins.map(a => a.id);
+      }
+      case 'conversation_staff': {
+        const participants = await this.prisma.conversationParticipant.findMany({
+          where: { conversation_id: message.conversation_id, left_at: null, user: { role: { not: rule.sender_role }, status: 'active' } },
+          select: { user_id: true },
+        });
+        return participants.map(p => p.user_id);
+      }
+      case 'landlord':
+      case 'property_staff': {
+        const property = await this.propertyFor(message);
+        if (!property) return [];
+        if (rule.target === 'landlord') return [property.owner_id];
+        const assignments = await this.prisma.staffPropertyAssignment.findMany({
+          where: { property_id: property.id, status: 'active', staff: { status: 'active' } },
+          select: { staff_id: true },
+        });
+        return assignments.map(a => a.staff_id);
+      }
+      default:
+        return [];
+    }
+  }
+
+  /**
+   * The property a conversation is about: its tenancy's, else the sender's current lease
+   */
+  private async propertyFor(message: UnansweredMessage) {
+    const lease = message.lease_id
+      ? await this.prisma.lease.findUnique({ where: { id: message.lease_id }, select: { property: { select: { id: true, owner_id: true } } } })
+      : await this.prisma.lease.findFirst({
+        where: { tenant_id: message.sender_id, status: 'active' },
+        orderBy: { start_date: 'desc' },
+        select: { property: { select: { id: true, owner_id: true } } },
+      });
+    return lease?.property || null;
+  }
+
+  private validate(req: EscalationRuleRequest) {
+    if (!req.name?.trim()) {
+      throw new Error('name is required');
+    }
+    const minutes = Number(req.unanswered_minutes);
+    if (!Number.isInteger(minutes) || minutes < MIN_UNANSWERED_MINUTES || minutes > MAX_UNANSWERED_MINUTES) {
+      throw new Error(`unanswered_minutes must be a whole number between ${MIN_UNANSWERED_MINUTES} and ${MAX_UNANSWERED_MINUTES}`);
+    }
+    if (!req.target || !ESCALATION_TARGETS[req.target]) {
+      throw new Error(`target must be one of: ${Object.keys(ESCALATION_TARGETS).join(', ')}`);
+    }
+    const priorities = req.priorities?.length ? [...new Set(req.priorities)] : ['urgent'];
+    if (priorities.some(priority => !MESSAGE_PRIORITIES.includes(priority))) {
+      throw new Error(`priorities must be drawn from: ${MESSAGE_PRIORITIES.join(', ')}`);
+    }
+    const senderRole = req.sender_role || 'tenant';
+    if (!SENDER_ROLES.includes(senderRole)) {
+      throw new Error(`sender_role must be one of: ${SENDER_ROLES.join(', ')}`);
+    }
+    const channels = req.channels?.length ? [...new Set(['app', ...req.channels])] : ['app', 'sms'];
+    if (channels.some(channel => !ESCALATION_CHANNELS.includes(channel))) {
+      throw new Error(`channels must be drawn from: ${ESCALATION_CHANNELS.join(', ')}`);
+    }
+    return {
+      name: req.name.trim().slice(0, 100),
+      priorities,
+      sender_role: senderRole,
+      unanswered_minutes: minutes,
+      target: req.target,
+      channels,
+      is_active: req.is_active !== false,
+    };
+  }
+
+  private requireManager(user: JWTClaims) {
+    if (!MANAGER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage message escalation rules');
+    }
+  }
+
+  // Agency admins see their agency's rules; landlords their company's
+  private ruleScope(user: JWTClaims): any {
+    if (user.role === 'super_admin') return {};
+    return {
+      company_id: user.company_id!,
+      ...(user.role === 'agency_admin' && user.agency_id && { agency_id: user.agency_id }),
+    };
+  }
+
+  private async findRule(ruleId: string, user: JWTClaims) {
+    this.requireManager(user);
+    const rule = await this.prisma.messageEscalationRule.findFirst({
+      where: { id: ruleId, ...this.ruleScope(user) },
+    });
+    if (!rule) {
+      throw new Error('Escalation rule not found');
+    }
+    return rule;
+  }
+}
+
+export const messageEscalationService = new MessageEscalationService();
@@ -0,0 +1,292 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface MessageTemplateRequest {
+  name?: string;
+  subject?: string | null;
+  content?: string;
+  template_type?: string;
+  agency_only?: boolean;
+  is_global?: boolean;
+}
+
+export const TEMPLATE_CATEGORIES = ['rent_reminder', 'payment_receipt', 'maintenance', 'lease', 'welcome', 'move_out', 'general'];
+
+/**
+ * Placeholders the server can fill in at send time; {{amount_due}}-style markers in a template's
+ * subject or content
+ */
+export const TEMPLATE_VARIABLES: Record<string, string> = {
+  tenant_name: "Recipient's full name",
+  tenant_first_name: "Recipient's first name",
+  unit_number: "Unit on the recipient's active lease",
+  property_name: "Property on the recipient's active lease",
+  rent_amount: 'Monthly rent on the active lease',
+  amount_due: 'Total of unpaid sent and overdue invoices',
+  due_date: 'Earliest due date among unpaid invoices',
+  sender_name: "Sender's full name",
+  company_name: "Sender's company",
+  today: "Today's date",
+};
+
+const MANAGER_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const PLACEHOLDER = /\{\{\s*([a-z_]+)\s*\}\}/gi;
+
+const placeholdersIn = (...texts: Array<string | null | undefined>) =>
+  [...new Set(texts.flatMap(text => [...(text || '').matchAll(PLACEHOLDER)].map(match => match[1].toLowerCase())))];
+
+const formatDate = (date: Date) =>
+  date.toLocaleDateString('en-KE', { day: 'numeric', month: 'long', year: 'numeric' });
+
+const formatAmount = (amount: number, currency = 'KES') =>
+  `${currency} ${amount.toLocaleString('en-KE', { minimumFractionDigits: 2, maximumFractionDigits: 2 })}`;
+
+/**
+ * Message templates for the composer: company-wide or agency-only, global ones published by
+ * super admins, and server-side placeholder substitution for the recipient of each message
+ */
+export class MessageTemplatesService {
+  private prisma = getPrisma();
+
+  /**
+   * Templates the user may use: global ones, their company's shared ones and their agency's own
+   */
+  private visibleWhere(user: JWTClaims): any {
+    if (user.role === 'super_admin') return {};
+    return {
+      OR: [
+        { is_global: true },
+        {
+          company_id: user.company_id!,
+          OR: [{ agency_id: null }, ...(user.agency_id ? [{ agency_id: user.agency_id }] : [])],
+        },
+      ],
+    };
+  }
+
+  async listTemplates(user: JWTClaims, filters: { category?: string; search?: string } = {}) {
+    const templates = await this.prisma.messageTemplate.findMany({
+      where: {
+        AND: [
+          this.visibleWhere(user),
+          ...(filters.category ? [{ template_type: filters.category }] : []),
+          ...(filters.search ? [{
+            OR: [
+              { name: { contains: filters.search, mode: 'insensitive' as const } },
+              { content: { contains: filters.search, mode: 'insensitive' as const } },
+            ],
+          }] : []),
+        ],
+      },
+      orderBy: [{ usage_count: 'desc' }, { name: 'asc' }],
+    });
+    return { templates, categories: TEMPLATE_CATEGORIES, variables: TEMPLATE_VARIABLES };
+  }
+
+  async getTemplate(templateId: string, user: JWTClaims) {
+    const template = await this.prisma.messageTemplate.findFirst({
+      where: { AND: [{ id: templateId }, this.visibleWhere(user)] },
+    });
+    if (!template) {
+      throw new Error('Template not found');
+    }
+    return template;
+  }
+
+  async createTemplate(req: MessageTemplateRequest, user: JWTClaims) {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    const data = this.validate(req, user);
+    return this.prisma.messageTemplate.create({
+      data: {
+        company_id: user.company_id,
+        name: data.name,
+        subject: data.subject,
+        content: data.content,
+        template_type: data.template_type,
+        variables: placeholdersIn(data.subject, data.content),
+        is_global: data.is_global,
+        agency_id: data.agency_id,
+        created_by: user.user_id,
+      },
+    });
+  }
+
+  async updateTemplate(templateId: string, req: MessageTemplateRequest, user: JWTClaims) {
+    const template = await this.findEditable(templateId, user);
+    const data = this.validate({
+      name: req.name ?? template.name,
+      subject: req.subject !== undefined ? req.subject : template.subject,
+      content: req.content ?? template.content,
+      template_type: req.template_type ?? template.template_type,
+      agency_only: req.agency_only ?? !!template.agency_id,
+      is_global: req.is_global ?? template.is_global,
+    }, user);
+    return this.prisma.messageTemplate.update({
+      where: { id: template.id },
+      data: {
+        name: data.name,
+        subject: data.subject,
+        content: data.content,
+        template_type: data.template_type,
+        variables: placeholdersIn(data.subject, data.content),
+        is_global: data.is_global,
+        agency_id: data.agency_id,
+        updated_at: new Date(),
+      },
+    });
+  }
+
+  async deleteTemplate(templateId: string, user: JWTClaims) {
+    const template = await this.findEditable(templateId, user);
+    await this.prisma.messageTemplate.delete({ where: { id: template.id } });
+  }
+
+  /**
+   * Fill a template's placeholders for one recipient. Values given by the sender win over the
+   * ones looked up on the server; any placeholder left without a value is an error.
+   */
+  async render(templateId: string, user: JWTClaims, recipientId?: string | null, overrides: Record<string, any> = {}) {
+    const template = await this.getTemplate(templateId, user);
+    const placeholders = placeholdersIn(template.subject, template.content);
+    const values: Record<string, string> = {
+      ...(await this.variablesFor(user, recipientId, placeholders)),
+      ...Object.fromEntries(
+        Object.entries(overrides || {})
+          .filter(([, value]) => value !== undefined && value !== null && value !== '')
+          .map(([key, value]) => [key.toLowerCase(), String(value)])
+      ),
+    };
+
+    const missing = placeholders.filter(name => values[name] === undefined);
+    if (missing.length) {
+      throw new Error(`template variables required: ${missing.join(', ')}`);
+    }
+    const fill = (text: string) => text.replace(PLACEHOLDER, (_, name: string) => values[name.toLowerCase()]);
+    return {
+      template_id: template.id,
+      subject: template.subject ? fill(template.subject) : null,
+      content: fill(template.content),
+      variables: Object.fromEntries(placeholders.map(name => [name, values[name]])),
+    };
+  }
+
+  async recordUsage(templateId: string) {
+    await this.prisma.messageTemplate.update({
+      where: { id: templateId },
+      data: { usage_count: { increment: 1 }, last_used_at: new Date() },
+    });
+  }
+
+  /**
+   * Look up only the values the template actually uses
+   */
+  private async variablesFor(user: JWTClaims, recipientId: string | null | undefined, placeholders: string[]) {
+    const values: Record<string, string> = {};
+    const wants = (...names: string[]) => names.some(name => placeholders.includes(name));
+
+    values.today = formatDate(new Date());
+    if (wants('sender_name', 'company_name')) {
+      const sender = await this.prisma.user.findUnique({
+        where: { id: user.user_id },
+        select: { first_name: true, last_name: true, company: { select: { name: true } } },
+      });
+      if (sender) {
+        values.sender_name = `${sender.first_name} ${sender.last_name}`.trim();
+        if (sender.company?.name) values.company_name = sender.company.name;
+      }
+    }
+    if (!recipientId) return values;
+
+    if (wants('tenant_name', 'tenant_first_name')) {
+      const recipient = await this.prisma.user.findFirst({
+        where: { id: recipientId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+        select: { first_name: true, last_name: true },
+      });
+      if (recipient) {
+        values.tenant_name = `${recipient.first_name} ${recipient.last_name}`.trim();
+        values.tenant_first_name = recipient.first_name;
+      }
+    }
+    if (wants('unit_number', 'property_name', 'rent_amount')) {
+      const lease = await this.prisma.lease.findFirst({
+        where: { tenant_id: recipientId, status: 'active', ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+        orderBy: { start_date: 'desc' },
+        select: { rent_amount: true, unit: { select: { unit_number: true } }, property: { select: { name: true } } },
+      });
+      if (lease) {
+        values.unit_number = lease.unit.unit_number;
+        values.property_name = lease.property.name;
+        values.rent_amount = formatAmount(Number(lease.rent_amount));
+      }
+    }
+    if (wants('amount_due', 'due_date')) {
+      const unpaid = await this.prisma.invoice.findMany({
+        where: {
+          issued_to: recipientId,
+          status: { in: ['sent', 'overdue'] },
+          ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+        },
+        select: { total_amount: true, currency: true, due_date: true },
+        orderBy: { due_date: 'asc' },
+      });
+      values.amount_due = formatAmount(
+        unpaid.reduce((sum, invoice) => sum + Number(invoice.total_amount), 0),
+        unpaid[0]?.currency || 'KES'
+      );
+      if (unpaid.length) values.due_date = formatDate(unpaid[0].due_date);
+    }
+    return values;
+  }
+
+  private validate(req: MessageTemplateRequest, user: JWTClaims) {
+    if (user.role === 'tenant') {
+      throw new Error('Only staff can manage message templates');
+    }
+    if (!req.name?.trim() || !req.content?.trim()) {
+      throw new Error('name and content are required');
+    }
+    if (req.name.length > 100) {
+      throw new Error('name must be at most 100 characters');
+    }
+    const category = req.template_type || 'general';
+    if (!TEMPLATE_CATEGORIES.includes(category)) {
+      throw new Error(`template_type must be one of: ${TEMPLATE_CATEGORIES.join(', ')}`);
+    }
+    const unknown = placeholdersIn(req.subject, req.content).filter(name => !TEMPLATE_VARIABLES[name]);
+    if (unknown.length) {
+      throw new Error(`template variables must be one of: ${Object.keys(TEMPLATE_VARIABLES).join(', ')} (got ${unknown.join(', ')})`);
+    }
+    if (req.is_global && user.role !== 'super_admin') {
+      throw new Error('Only super admins can publish global templates');
+    }
+    if (req.agency_only && !user.agency_id) {
+      throw new Error('agency_only templates must be created by agency staff');
+    }
+    return {
+      name: req.name.trim(),
+      subject: req.subject?.trim() || null,
+      content: req.content,
+      template_type: category,
+      is_global: !!req.is_global,
+      agency_id: req.agency_only ? user.agency_id! : null,
+    };
+  }
+
+  /**
+   * Authors edit their own templates; landlords and agency admins any of their company's
+   */
+  private async findEditable(templateId: string, user: JWTClaims) {
+    const template = await this.getTemplate(templateId, user);
+    if (template.is_global && user.role !== 'super_admin') {
+      throw new Error('Only super admins can change global templates');
+    }
+    if (template.created_by !== user.user_id && !MANAGER_ROLES.includes(user.role)) {
+      throw new Error('Only the author or a company admin can change this template');
+    }
+    return template;
+  }
+}
+
+export const messageTemplatesService = new MessageTemplatesService();
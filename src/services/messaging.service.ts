@@ -1,9 +1,42 @@
+import { Prisma } from '@prisma/client';
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import { supabaseRealtimeService } from './supabase-realtime.service.js';
 
 const prisma = getPrisma();
 
+// ts_headline markers: control characters can't occur in typed text, so they survive HTML escaping intact
+const HEADLINE_OPTIONS = 'StartSel="\u0002", StopSel="\u0003", MaxFragments=2, MaxWords=24, MinWords=8, FragmentDelimiter=" … "';
+
+/**
+ * Search-as-you-type query: every word must match, the last one as a prefix
+ */
+const toPrefixTsQuery = (query: string) => {
+  const words = query.toLowerCase().match(/[\p{L}\p{N}]+/gu) || [];
+  return words.slice(0, 12).map((word, index, all) => `'${word}'${index === all.length - 1 ? ':*' : ''}`).join(' & ');
+};
+
+const translationSelect = {
+  language: true,
+  source_language: true,
+  subject: true,
+  content: true,
+  provider: true,
+  created_at: true,
+} as const;
+
+// Translations are always machine output; clients label them and offer the original
+const markMachineTranslated = <T extends object>(translation: T) => ({ ...translation, machine_translated: true as const });
+
+const markHighlight = (headline: string) =>
+  headline
+    .replace(/&/g, '&amp;')
+    .replace(/</g, '&lt;')
+    .replace(/>/g, '&gt;')
+    .replace(/"/g, '&quot;')
+    .replace(/\u0002/g, '<mark>')
+    .replace(/\u0003/g, '</mark>');
+
 interface CreateMessageData {
   conversationId?: string;
   recipientIds: string[];
@@ -14,6 +47,8 @@ interface CreateMessageData {
   replyToMessageId?: string;
   attachments?: any[];
   metadata?: any;
+  templateId?: string;
+  templateVariables?: Record<string, any>;
 }
 
 interface UpdateMessageData {
@@ -25,11 +60,161 @@ interface MessageReactionData {
   reactionType: string;
 }
 
+// admin manages participants and the title, participant reads and writes, observer only reads
+export const CONVERSATION_ROLES = ['admin', 'participant', 'observer'];
+export const WRITER_ROLES = ['admin', 'participant'];
+
+// Typing and presence are ephemeral: relayed over realtime channels and never written to the database.
+// Presence lives in memory, kept in step across API instances over the realtime backplane, and
+// lapses when a client stops sending heartbeats.
+export const PRESENCE_STATUSES = ['online', 'away', 'offline'];
+const PRESENCE_TTL_MS = 2 * 60 * 1000;
+// Clients drop a typing indicator that is not refreshed within this window
+const TYPING_TTL_MS = 6 * 1000;
+const presence = new Map<string, { status: string; message?: string; updatedAt: number }>();
+
+interface PresenceEvent {
+  userId: string;
+  status: string;
+  message?: string;
+  updatedAt: number;
+}
+
+// A user's current presence; anyone without a recent heartbeat is offline
+const presenceOf = (userId: string, now = Date.now()) => {
+  const entry = presence.get(userId);
+  if (!entry || entry.status === 'offline' || now - entry.updatedAt > PRESENCE_TTL_MS) {
+    if (entry && now - entry.updatedAt > PRESENCE_TTL_MS) presence.delete(userId);
+    return { status: 'offline' };
+  }
+  return { status: entry.status, message: entry.message, updatedAt: new Date(entry.updatedAt) };
+};
+
+const applyPresence = (event: PresenceEvent) => {
+  const current = presence.get(event.userId);
+  // Events can arrive out of order across instances; the newest heartbeat wins
+  if (current && current.updatedAt > event.updatedAt) return;
+  presence.set(event.userId, { status: event.status, message: event.message, updatedAt: event.updatedAt });
+};
+
+if (!supabaseRealtimeService.subscribeBackplane('presence', applyPresence)) {
+  console.warn('⚠️ Realtime backplane unavailable - presence is tracked per instance only');
+}
+
+/**
+ * Overall state of a sent message: read once every recipient has read it, delivered once every
+ * recipient's device has it
+ */
+const receiptStatus = (recipients: Array<{ delivered_at: Date | null; read_at: Date | null; is_read: boolean }>) =>
+  recipients.length && recipients.every(r => r.is_read) ? 'read' :
+  recipients.length && recipients.every(r => r.delivered_at || r.is_read) ? 'delivered' : 'sent';
+
 /**
  * Enhanced Messaging Service
  * Handles all messaging operations with presence, typing, reactions, etc.
  */
 export const messagingService = {
+  /**
+   * The user's active membership in a conversation, optionally requiring one of the given roles.
+   * Every conversation and message operation goes through this.
+   */
+  async requireParticipant(user: JWTClaims, conversationId: string, roles?: string[]) {
+    const participant = await prisma.conversationParticipant.findFirst({
+      where: {
+        conversation_id: conversationId,
+        user_id: user.user_id,
+        left_at: null,
+      },
+    });
+
+    if (!participant) {
+      throw new Error('Not a participant in this conversation');
+    }
+    if (roles && !roles.includes(participant.role)) {
+      throw new Error(`Insufficient permissions: requires conversation role ${roles.join(' or ')}`);
+    }
+    return participant;
+  },
+
+  /**
+   * Check a message exists and the user is an active member of its conversation
+   */
+  async requireMessageAccess(user: JWTClaims, messageId: string) {
+    const message = await prisma.message.findUnique({
+      where: { id: messageId },
+    });
+
+    if (!message) {
+      throw new Error('Message not found');
+    }
+    if (message.conversation_id) {
+      await this.requireParticipant(user, message.conversation_id);
+    } else if (message.sender_id !== user.user_id) {
+      throw new Error('Message not found');
+    }
+    return message;
+  },
+
+  /**
+   * Record a membership or title change as a system message in the thread and tell active participants
+   */
+  async recordConversationEvent(
+    user: JWTClaims,
+    conversationId: string,
+    event: 'joined' | 'left' | 'removed' | 'role_changed' | 'renamed',
+    content: string,
+    data: Record<string, any> = {}
+  ) {
+    const message = await prisma.message.create({
+      data: {
+        company_id: user.company_id!,
+        conversation_id: conversationId,
+        sender_id: user.user_id,
+        content,
+        message_type: 'system',
+        status: 'sent',
+        sent_at: new Date(),
+        metadata: { event, ...data },
+      },
+    });
+
+    await prisma.conversation.update({
+      where: { id: conversationId },
+      data: { updated_at: new Date() },
+    });
+
+    const participants = await prisma.conversationParticipant.findMany({
+      where: { conversation_id: conversationId, left_at: null },
+      select: { user_id: true },
+    });
+    const notify = [...new Set([...participants.map(p => p.user_id), ...(data.user_id ? [data.user_id] : [])])];
+    try {
+      await supabaseRealtimeService.publishConversationUpdate(conversationId, notify, {
+        event,
+        message,
+        ...data,
+      });
+    } catch (error) {
+      console.debug('Error publishing conversation event:', error);
+    }
+
+    return message;
+  },
+
+  /**
+   * Check every user belongs to the caller's company
+   */
+  async validateCompanyUsers(user: JWTClaims, userIds: string[]) {
+    const users = await prisma.user.findMany({
+      where: { id: { in: userIds }, company_id: user.company_id },
+      select: { id: true, first_name: true, last_name: true, role: true },
+    });
+    if (users.length !== new Set(userIds).size) {
+      throw new Error('One or more participants not found');
+    }
+    return users;
+  },
+
   /**
    * Get or create a conversation between users
    */
@@ -48,6 +233,8 @@ export const messagingService = {
       throw new Error('At least 2 participants required for a conversation');
     }
 
+    await this.validateCompanyUsers(user, allParticipants);
+
     // For direct messages (2 participants), check if conversation exists
     if (!isGroup && allParticipants.length === 2) {
       const existingConversation = await prisma.conversation.findFirst({
@@ -72,6 +259,13 @@ export const messagingService = {
         );
 
         if (participantCount === allParticipants.length && matchesAll) {
+          // Someone who left a direct chat rejoins it rather than starting a second one
+          if (existingConversation.participants.some(p => p.left_at)) {
+            await prisma.conversationParticipant.updateMany({
+              where: { conversation_id: existingConversation.id, left_at: { not: null } },
+              data: { left_at: null, joined_at: new Date() },
+            });
+          }
           return existingConversation;
         }
       }
@@ -148,8 +342,16 @@ export const messagingService = {
   async createMessage(user: JWTClaims, data: CreateMessageData) {
     let conversationId = data.conversationId;
 
-    // Create conversation if not provided
-    if (!conversationId) {
+    if (conversationId) {
+      await this.requireParticipant(user, conversationId, WRITER_ROLES);
+      const conversation = await prisma.conversation.findUnique({
+        where: { id: conversationId },
+        select: { archived_at: true },
+      });
+      if (conversation?.archived_at) {
+        throw new Error('Only active conversations accept new messages; this tenancy chat was archived at move-out');
+      }
+    } else {
       if (!data.recipientIds || data.recipientIds.length === 0) {
         throw new Error('Either conversationId or recipientIds must be provided');
       }
@@ -170,21 +372,48 @@ export const messagingService = {
       throw new Error('User must have a company_id to create messages');
     }
 
+    const { messageAttachmentsService } = await import('./message-attachments.service.js');
+    await messageAttachmentsService.assertValidAttachments(data.attachments, user, conversationId);
+
+    // Templates are filled in server-side, so amounts and dates come from the recipient's own records
+    let content = data.content;
+    let subject = data.subject;
+    let metadata = data.metadata && typeof data.metadata === 'object' ? data.metadata : {};
+    if (data.templateId) {
+      const others = await prisma.conversationParticipant.findMany({
+        where: { conversation_id: conversationId, left_at: null, user_id: { not: user.user_id } },
+        select: { user_id: true },
+      });
+      const { messageTemplatesService } = await import('./message-templates.service.js');
+      const rendered = await messageTemplatesService.render(
+        data.templateId,
+        user,
+        others.length === 1 ? others[0].user_id : null,
+        data.templateVariables
+      );
+      content = rendered.content;
+      subject = subject || rendered.subject || undefined;
+      metadata = { ...metadata, template_id: rendered.template_id };
+    }
+    if (!content || !content.trim()) {
+      throw new Error('Message content is required');
+    }
+
     // Create message
     const message = await prisma.message.create({
       data: {
         company_id: user.company_id,
         conversation_id: conversationId,
         sender_id: user.user_id,
-        content: data.content,
-        subject: data.subject,
+        content,
+        subject,
         message_type: data.messageType || 'text',
         priority: (data.priority as any) || 'medium',
         status: 'sent',
         sent_at: new Date(),
         parent_message_id: data.replyToMessageId, // Use parent_message_id instead of reply_to_message_id
         attachments: data.attachments || [],
-        metadata: data.metadata || {},
+        metadata,
       },
       include: {
         sender: {
@@ -198,6 +427,7 @@ export const messagingService = {
         conversation: {
           include: {
             participants: {
+              where: { left_at: null },
               include: {
                 user: {
                   select: {
@@ -214,6 +444,13 @@ export const messagingService = {
       },
     });
 
+    if (data.templateId) {
+      const { messageTemplatesService } = await import('./message-templates.service.js');
+      await messageTemplatesService.recordUsage(data.templateId).catch((error: any) => {
+        console.error('⚠️ Failed to record template usage:', error.message);
+      });
+    }
+
     // Get recipients from conversation participants (exclude sender)
     if (!message.conversation) {
       throw new Error('Conversation not found in message');
@@ -230,11 +467,18 @@ export const messagingService = {
           message_id: message.id,
           recipient_id: recipientId,
           is_read: false,
-          delivered_at: new Date(),
         })),
       });
     }
 
+    // A new message brings an archived conversation back into the recipients' lists
+    if (recipients.length > 0) {
+      await prisma.conversationParticipant.updateMany({
+        where: { conversation_id: conversationId, user_id: { in: recipients }, archived_at: { not: null } },
+        data: { archived_at: null },
+      });
+    }
+
     // Update conversation last message (using raw SQL since last_message_id may not exist in Prisma schema)
     await prisma.$executeRaw`
       UPDATE conversations
@@ -261,6 +505,11 @@ export const messagingService = {
       console.debug('Supabase not available for message publish:', error);
     }
 
+    // Participants who take chat messages by email get a copy they can answer from their inbox
+    import('./message-email.service.js')
+      .then(({ messageEmailService }) => messageEmailService.sendMessageEmails(message.id))
+      .catch((error: any) => console.error('⚠️ Failed to email message to participants:', error.message));
+
     return message;
   },
 
@@ -274,17 +523,7 @@ export const messagingService = {
     offset: number = 0,
     before?: Date
   ) {
-    // Verify user is participant
-    const participant = await prisma.conversationParticipant.findFirst({
-      where: {
-        conversation_id: conversationId,
-        user_id: user.user_id,
-      },
-    });
-
-    if (!participant) {
-      throw new Error('Not a participant in this conversation');
-    }
+    await this.requireParticipant(user, conversationId);
 
     // Note: deleted_for_everyone may not exist in Prisma schema
     // Use raw SQL or filter after query if needed
@@ -312,10 +551,11 @@ export const messagingService = {
             },
           },
           recipients: {
-            where: { recipient_id: user.user_id },
             select: {
+              recipient_id: true,
               is_read: true,
               read_at: true,
+              delivered_at: true,
               is_starred: true,
             },
           },
@@ -332,60 +572,216 @@ export const messagingService = {
               },
             },
           },
+          translations: { select: translationSelect },
         },
       }),
       prisma.message.count({ where: whereClause }),
     ]);
 
-    // Mark messages as read
+    // Fetching a page counts as reading it
     const unreadMessageIds = messages
-      .filter(m => {
-        const recipient = m.recipients?.[0];
-        return recipient && !recipient.is_read;
-      })
+      .filter(m => m.recipients.some(r => r.recipient_id === user.user_id && !r.is_read))
       .map(m => m.id);
+    await this.applyReadReceipts(user, conversationId, unreadMessageIds);
 
-    if (unreadMessageIds.length > 0) {
-      await prisma.messageRecipient.updateMany({
-        where: {
-          message_id: { in: unreadMessageIds },
-          recipient_id: user.user_id,
-        },
-        data: {
-          is_read: true,
-          read_at: new Date(),
-        },
-      });
+    return {
+      // Recipients see only their own receipt; senders get everyone's
+      messages: messages.reverse().map(m => {
+        const own = m.recipients.filter(r => r.recipient_id === user.user_id);
+        return {
+          ...m,
+          recipients: own,
+          translations: m.translations.map(markMachineTranslated),
+          ...(m.sender_id === user.user_id && m.message_type !== 'system' && {
+            receipts: m.recipients,
+            receiptStatus: receiptStatus(m.recipients),
+          }),
+        };
+      }),
+      total,
+      hasMore: offset + messages.length < total,
+    };
+  },
 
-      // Publish read receipts
-      for (const message of messages.filter(m => unreadMessageIds.includes(m.id))) {
-        try {
-          await supabaseRealtimeService.publishReadStatus(
-            message.sender_id,
-            message.id,
-            user.user_id,
-            new Date()
-          );
-        } catch (error) {
-          console.debug('Error publishing read receipt:', error);
-        }
+  /**
+   * Mark messages read for the user (also delivered if the ack never arrived), tell each sender
+   * and bring the conversation's unread count down
+   */
+  async applyReadReceipts(user: JWTClaims, conversationId: string, messageIds: string[]) {
+    if (messageIds.length === 0) return 0;
+
+    const rows = await prisma.messageRecipient.findMany({
+      where: { message_id: { in: messageIds }, recipient_id: user.user_id, is_read: false },
+      select: { message_id: true, delivered_at: true, message: { select: { sender_id: true } } },
+    });
+    if (rows.length === 0) return 0;
+
+    const readAt = new Date();
+    await prisma.messageRecipient.updateMany({
+      where: { message_id: { in: rows.map(r => r.message_id) }, recipient_id: user.user_id, delivered_at: null },
+      data: { delivered_at: readAt },
+    });
+    await prisma.messageRecipient.updateMany({
+      where: { message_id: { in: rows.map(r => r.message_id) }, recipient_id: user.user_id },
+      data: { is_read: true, read_at: readAt },
+    });
+
+    // Publish read receipts
+    for (const row of rows) {
+      try {
+        await supabaseRealtimeService.publishReadStatus(row.message.sender_id, row.message_id, user.user_id, readAt);
+      } catch (error) {
+        console.debug('Error publishing read receipt:', error);
       }
+    }
 
-      // Update conversation metadata
-      await prisma.$executeRaw`
-        UPDATE conversation_metadata
-        SET unread_count = GREATEST(0, unread_count - ${unreadMessageIds.length}),
-            last_read_at = NOW(),
-            updated_at = NOW()
-        WHERE conversation_id = ${conversationId}::uuid
-          AND user_id = ${user.user_id}::uuid
-      `;
+    // Update conversation metadata
+    await prisma.$executeRaw`
+      UPDATE conversation_metadata
+      SET unread_count = GREATEST(0, unread_count - ${rows.length}),
+          last_read_at = NOW(),
+          updated_at = NOW()
+      WHERE conversation_id = ${conversationId}::uuid
+        AND user_id = ${user.user_id}::uuid
+    `;
+    return rows.length;
+  },
+
+  /**
+   * Acknowledge that messages reached one of the user's devices
+   */
+  async markDelivered(user: JWTClaims, messageIds: string[]) {
+    if (!Array.isArray(messageIds) || messageIds.length === 0) {
+      throw new Error('messageIds array is required');
+    }
+
+    const rows = await prisma.messageRecipient.findMany({
+      where: { message_id: { in: messageIds }, recipient_id: user.user_id, delivered_at: null },
+      select: { message_id: true, message: { select: { sender_id: true } } },
+    });
+    if (rows.length === 0) {
+      return { delivered: 0 };
+    }
+
+    const deliveredAt = new Date();
+    await prisma.messageRecipient.updateMany({
+      where: { message_id: { in: rows.map(r => r.message_id) }, recipient_id: user.user_id, delivered_at: null },
+      data: { delivered_at: deliveredAt },
+    });
+
+    const bySender = new Map<string, string[]>();
+    for (const row of rows) {
+      bySender.set(row.message.sender_id, [...(bySender.get(row.message.sender_id) || []), row.message_id]);
     }
+    for (const [senderId, ids] of bySender) {
+      try {
+        await supabaseRealtimeService.publishDeliveryStatus(senderId, ids, user.user_id, deliveredAt);
+      } catch (error) {
+        console.debug('Error publishing delivery receipt:', error);
+      }
+    }
+
+    return { delivered: rows.length };
+  },
+
+  /**
+   * Mark a conversation read without fetching it, up to and including a given message if provided
+   */
+  async markConversationRead(user: JWTClaims, conversationId: string, upToMessageId?: string) {
+    await this.requireParticipant(user, conversationId);
+
+    let upTo: Date | undefined;
+    if (upToMessageId) {
+      const message = await prisma.message.findFirst({
+        where: { id: upToMessageId, conversation_id: conversationId },
+        select: { created_at: true },
+      });
+      if (!message) {
+        throw new Error('Message not found in this conversation');
+      }
+      upTo = message.created_at;
+    }
+
+    const unread = await prisma.messageRecipient.findMany({
+      where: {
+        recipient_id: user.user_id,
+        is_read: false,
+        message: { conversation_id: conversationId, ...(upTo && { created_at: { lte: upTo } }) },
+      },
+      select: { message_id: true },
+    });
+    const read = await this.applyReadReceipts(user, conversationId, unread.map(r => r.message_id));
+    return { read };
+  },
+
+  /**
+   * Per-recipient delivered and read times for a message
+   */
+  async getMessageReceipts(user: JWTClaims, messageId: string) {
+    const message = await this.requireMessageAccess(user, messageId);
+
+    const recipients = await prisma.messageRecipient.findMany({
+      where: { message_id: message.id },
+      select: {
+        recipient_id: true,
+        delivered_at: true,
+        is_read: true,
+        read_at: true,
+        recipient: {
+          select: {
+            id: true,
+            first_name: true,
+            last_name: true,
+            role: true,
+          },
+        },
+      },
+    });
 
     return {
-      messages: messages.reverse(), // Reverse to show oldest first
-      total,
-      hasMore: offset + messages.length < total,
+      messageId: message.id,
+      sentAt: message.sent_at,
+      status: receiptStatus(recipients),
+      recipients: recipients.map(r => ({
+        user: r.recipient,
+        deliveredAt: r.delivered_at,
+        readAt: r.read_at,
+        status: r.is_read ? 'read' : r.delivered_at ? 'delivered' : 'sent',
+      })),
+    };
+  },
+
+  /**
+   * Unread messages for the user, in total, per conversation and by the sender's role
+   */
+  async getUnreadCounts(user: JWTClaims) {
+    const rows = await prisma.$queryRaw<Array<{ conversation_id: string; subject: string; sender_role: string; unread: number }>>`
+      SELECT m.conversation_id, c.subject, u.role::text AS sender_role, COUNT(*)::int AS unread
+      FROM message_recipients mr
+      JOIN messages m ON m.id = mr.message_id
+      JOIN conversations c ON c.id = m.conversation_id
+      JOIN conversation_participants cp
+        ON cp.conversation_id = m.conversation_id AND cp.user_id = mr.recipient_id AND cp.left_at IS NULL
+      JOIN users u ON u.id = m.sender_id
+      WHERE mr.recipient_id = ${user.user_id}::uuid
+        AND mr.is_read = false
+        AND mr.is_archived = false
+      GROUP BY m.conversation_id, c.subject, u.role
+    `;
+
+    const byConversation = new Map<string, { conversationId: string; subject: string; unread: number }>();
+    const byRole: Record<string, number> = {};
+    for (const row of rows) {
+      const entry = byConversation.get(row.conversation_id) || { conversationId: row.conversation_id, subject: row.subject, unread: 0 };
+      entry.unread += row.unread;
+      byConversation.set(row.conversation_id, entry);
+      byRole[row.sender_role] = (byRole[row.sender_role] || 0) + row.unread;
+    }
+
+    return {
+      total: rows.reduce((sum, row) => sum + row.unread, 0),
+      byConversation: [...byConversation.values()].sort((a, b) => b.unread - a.unread),
+      byRole,
     };
   },
 
@@ -397,17 +793,14 @@ export const messagingService = {
     messageId: string,
     data: UpdateMessageData
   ) {
-    const message = await prisma.message.findUnique({
-      where: { id: messageId },
-    });
-
-    if (!message) {
-      throw new Error('Message not found');
-    }
+    const message = await this.requireMessageAccess(user, messageId);
 
     if (message.sender_id !== user.user_id) {
       throw new Error('Only the sender can edit a message');
     }
+    if (message.message_type === 'system') {
+      throw new Error('Only user messages can be edited');
+    }
 
     // Check 15-minute time limit
     const messageTime = new Date(message.created_at).getTime();
@@ -435,6 +828,9 @@ export const messagingService = {
       WHERE id = ${messageId}::uuid
     `;
     
+    // Translations of the old wording no longer apply
+    await prisma.messageTranslation.deleteMany({ where: { message_id: messageId } });
+
     const updatedMessage = await prisma.message.update({
       where: { id: messageId },
       data: {
@@ -467,6 +863,58 @@ export const messagingService = {
     return updatedMessage;
   },
 
+  /**
+   * Translate a message into English or Swahili on request. The first request per language calls
+   * the translation provider and stores the result; later ones are served from storage.
+   */
+  async translateMessage(user: JWTClaims, messageId: string, targetLanguage: string) {
+    const language = (targetLanguage || '').trim().toLowerCase();
+    const { translator, TRANSLATION_LANGUAGES } = await import('./translation.service.js');
+    if (!TRANSLATION_LANGUAGES[language]) {
+      throw new Error(`target_language must be one of: ${Object.keys(TRANSLATION_LANGUAGES).join(', ')}`);
+    }
+    const message = await this.requireMessageAccess(user, messageId);
+
+    const stored = await prisma.messageTranslation.findUnique({
+      where: { message_id_language: { message_id: message.id, language } },
+      select: translationSelect,
+    });
+    if (stored) {
+      return { message_id: message.id, ...markMachineTranslated(stored), cached: true };
+    }
+    if (!translator) {
+      throw new Error('Message translation is unavailable: no translation provider is configured');
+    }
+
+    const texts = message.subject ? [message.content, message.subject] : [message.content];
+    let result;
+    try {
+      result = await translator.translate(texts, language);
+    } catch (error: any) {
+      console.error(`⚠️ Translation of message ${message.id} failed:`, error.message);
+      throw new Error('Message translation is temporarily unavailable, please try again later');
+    }
+
+    // Already in the requested language: hand back the original rather than a paraphrase
+    const alreadyTarget = result.source_language === language;
+    const translation = await prisma.messageTranslation.upsert({
+      where: { message_id_language: { message_id: message.id, language } },
+      create: {
+        message_id: message.id,
+        language,
+        source_language: result.source_language,
+        content: alreadyTarget ? message.content : result.texts[0],
+        subject: message.subject ? (alreadyTarget ? message.subject : result.texts[1]) : null,
+        provider: translator.name,
+        model: translator.model,
+        requested_by: user.user_id,
+      },
+      update: {},
+      select: translationSelect,
+    });
+    return { message_id: message.id, ...markMachineTranslated(translation), cached: false };
+  },
+
   /**
    * Delete message
    */
@@ -475,6 +923,7 @@ export const messagingService = {
     messageId: string,
     deleteForEveryone: boolean = false
   ) {
+    await this.requireMessageAccess(user, messageId);
     const message = await prisma.message.findUnique({
       where: { id: messageId },
       include: {
@@ -559,13 +1008,7 @@ export const messagingService = {
    * Add reaction to message
    */
   async addReaction(user: JWTClaims, messageId: string, reactionType: string) {
-    const message = await prisma.message.findUnique({
-      where: { id: messageId },
-    });
-
-    if (!message) {
-      throw new Error('Message not found');
-    }
+    await this.requireMessageAccess(user, messageId);
 
     // Add or update reaction
     await prisma.$executeRaw`
@@ -596,6 +1039,8 @@ export const messagingService = {
    * Remove reaction from message
    */
   async removeReaction(user: JWTClaims, messageId: string, reactionType: string) {
+    await this.requireMessageAccess(user, messageId);
+
     await prisma.$executeRaw`
       DELETE FROM message_reactions
       WHERE message_id = ${messageId}::uuid
@@ -630,16 +1075,13 @@ export const messagingService = {
     messageId: string,
     note?: string
   ) {
-    // Verify user is participant
-    const participant = await prisma.conversationParticipant.findFirst({
-      where: {
-        conversation_id: conversationId,
-        user_id: user.user_id,
-      },
+    await this.requireParticipant(user, conversationId, WRITER_ROLES);
+    const message = await prisma.message.findFirst({
+      where: { id: messageId, conversation_id: conversationId },
+      select: { id: true },
     });
-
-    if (!participant) {
-      throw new Error('Not a participant in this conversation');
+    if (!message) {
+      throw new Error('Message not found in this conversation');
     }
 
     await prisma.$executeRaw`
@@ -659,6 +1101,8 @@ export const messagingService = {
     conversationId: string,
     messageId: string
   ) {
+    await this.requireParticipant(user, conversationId, WRITER_ROLES);
+
     await prisma.$executeRaw`
       DELETE FROM pinned_messages
       WHERE conversation_id = ${conversationId}::uuid
@@ -671,12 +1115,16 @@ export const messagingService = {
   /**
    * Get conversations for user
    */
-  async getConversations(user: JWTClaims, limit: number = 50, offset: number = 0) {
+  async getConversations(user: JWTClaims, limit: number = 50, offset: number = 0, archived: boolean = false) {
     const conversations = await prisma.conversation.findMany({
       where: {
         company_id: user.company_id,
         participants: {
-          some: { user_id: user.user_id },
+          some: {
+            user_id: user.user_id,
+            left_at: null,
+            archived_at: archived ? { not: null } : null,
+          },
         },
       },
       take: limit,
@@ -684,7 +1132,7 @@ export const messagingService = {
       orderBy: { updated_at: 'desc' },
       include: {
         participants: {
-          where: { user_id: { not: user.user_id } },
+          where: { user_id: { not: user.user_id }, left_at: null },
           include: {
             user: {
               select: {
@@ -736,112 +1184,389 @@ export const messagingService = {
 
   /**
    * Delete (leave) a conversation for the current user.
-   * Removes the user's participation so the conversation no longer appears in their list.
+   * Ends the user's participation so the conversation no longer appears in their list.
    */
   async deleteConversation(user: JWTClaims, conversationId: string) {
-    const deleted = await prisma.conversationParticipant.deleteMany({
-      where: {
-        conversation_id: conversationId,
-        user_id: user.user_id,
-      },
+    const participant = await prisma.conversationParticipant.findFirst({
+      where: { conversation_id: conversationId, user_id: user.user_id, left_at: null },
     });
-    if (deleted.count === 0) {
+    if (!participant) {
       throw new Error('Conversation not found or you are not a participant');
     }
+    await this.removeParticipant(user, conversationId, user.user_id);
     return { success: true };
   },
 
   /**
-   * Search messages
+   * Rename a conversation (admins only)
+   */
+  async updateConversation(user: JWTClaims, conversationId: string, title: string) {
+    await this.requireParticipant(user, conversationId, ['admin']);
+    if (!title || !title.trim()) {
+      throw new Error('title is required');
+    }
+
+    const conversation = await prisma.conversation.update({
+      where: { id: conversationId },
+      data: { subject: title.trim().slice(0, 255), updated_at: new Date() },
+    });
+    await this.recordConversationEvent(user, conversationId, 'renamed', `Conversation renamed to "${conversation.subject}"`, {
+      title: conversation.subject,
+    });
+    return conversation;
+  },
+
+  /**
+   * Add people to a conversation, or bring back people who left. A direct chat becomes a group.
+   */
+  async addParticipants(user: JWTClaims, conversationId: string, userIds: string[], role: string = 'participant') {
+    await this.requireParticipant(user, conversationId, ['admin']);
+    if (!Array.isArray(userIds) || userIds.length === 0) {
+      throw new Error('userIds array is required');
+    }
+    if (!CONVERSATION_ROLES.includes(role)) {
+      throw new Error(`role must be one of: ${CONVERSATION_ROLES.join(', ')}`);
+    }
+
+    const users = await this.validateCompanyUsers(user, userIds);
+    const existing = await prisma.conversationParticipant.findMany({
+      where: { conversation_id: conversationId, user_id: { in: userIds } },
+    });
+
+    const added = [];
+    for (const member of users) {
+      const current = existing.find(p => p.user_id === member.id);
+      if (current && !current.left_at) continue;
+
+      if (current) {
+        await prisma.conversationParticipant.update({
+          where: { id: current.id },
+          data: { left_at: null, archived_at: null, joined_at: new Date(), role },
+        });
+      } else {
+        await prisma.conversationParticipant.create({
+          data: { conversation_id: conversationId, user_id: member.id, role },
+        });
+      }
+      await prisma.$executeRaw`
+        INSERT INTO conversation_metadata (conversation_id, user_id, unread_count, updated_at)
+        VALUES (${conversationId}::uuid, ${member.id}::uuid, 0, NOW())
+        ON CONFLICT (conversation_id, user_id) DO NOTHING
+      `;
+      await this.recordConversationEvent(user, conversationId, 'joined', `${member.first_name} ${member.last_name} joined the conversation`, {
+        user_id: member.id,
+        role,
+      });
+      added.push(member);
+    }
+
+    if (added.length > 0) {
+      await prisma.conversation.updateMany({
+        where: { id: conversationId, type: 'direct' },
+        data: { type: 'group' },
+      });
+    }
+
+    return { added };
+  },
+
+  /**
+   * Change a participant's role (admins only); a conversation always keeps at least one admin
+   */
+  async updateParticipantRole(user: JWTClaims, conversationId: string, userId: string, role: string) {
+    await this.requireParticipant(user, conversationId, ['admin']);
+    if (!CONVERSATION_ROLES.includes(role)) {
+      throw new Error(`role must be one of: ${CONVERSATION_ROLES.join(', ')}`);
+    }
+
+    const participant = await prisma.conversationParticipant.findFirst({
+      where: { conversation_id: conversationId, user_id: userId, left_at: null },
+      include: { user: { select: { first_name: true, last_name: true } } },
+    });
+    if (!participant) {
+      throw new Error('Participant not found');
+    }
+    if (participant.role === 'admin' && role !== 'admin') {
+      const admins = await prisma.conversationParticipant.count({
+        where: { conversation_id: conversationId, role: 'admin', left_at: null },
+      });
+      if (admins <= 1) {
+        throw new Error('A conversation must keep at least one admin');
+      }
+    }
+
+    const updated = await prisma.conversationParticipant.update({
+      where: { id: participant.id },
+      data: { role },
+    });
+    await this.recordConversationEvent(
+      user,
+      conversationId,
+      'role_changed',
+      `${participant.user.first_name} ${participant.user.last_name} is now ${role === 'admin' ? 'an admin' : `a ${role}`}`,
+      { user_id: userId, role }
+    );
+    return updated;
+  },
+
+  /**
+   * Leave a conversation, or remove someone else from it (admins only). History is kept; the
+   * longest-standing remaining member is promoted if the last admin goes.
+   */
+  async removeParticipant(user: JWTClaims, conversationId: string, userId: string) {
+    const self = userId === user.user_id;
+    await this.requireParticipant(user, conversationId, self ? undefined : ['admin']);
+
+    const participant = await prisma.conversationParticipant.findFirst({
+      where: { conversation_id: conversationId, user_id: userId, left_at: null },
+      include: { user: { select: { first_name: true, last_name: true } } },
+    });
+    if (!participant) {
+      throw new Error('Participant not found');
+    }
+
+    await prisma.conversationParticipant.update({
+      where: { id: participant.id },
+      data: { left_at: new Date() },
+    });
+
+    if (participant.role === 'admin') {
+      const admins = await prisma.conversationParticipant.count({
+        where: { conversation_id: conversationId, role: 'admin', left_at: null },
+      });
+      if (admins === 0) {
+        const successor = await prisma.conversationParticipant.findFirst({
+          where: { conversation_id: conversationId, left_at: null, role: { not: 'observer' } },
+          orderBy: { joined_at: 'asc' },
+        });
+        if (successor) {
+          await prisma.conversationParticipant.update({ where: { id: successor.id }, data: { role: 'admin' } });
+        }
+      }
+    }
+
+    const name = `${participant.user.first_name} ${participant.user.last_name}`;
+    await this.recordConversationEvent(
+      user,
+      conversationId,
+      self ? 'left' : 'removed',
+      self ? `${name} left the conversation` : `${name} was removed from the conversation`,
+      { user_id: userId }
+    );
+    return { success: true };
+  },
+
+  /**
+   * Archive or unarchive a conversation for the current user only
+   */
+  async setArchived(user: JWTClaims, conversationId: string, archived: boolean) {
+    const participant = await this.requireParticipant(user, conversationId);
+    await prisma.conversationParticipant.update({
+      where: { id: participant.id },
+      data: { archived_at: archived ? new Date() : null },
+    });
+    return { success: true, archived };
+  },
+
+  /**
+   * Full-text search over messages in the user's active conversations, ranked by relevance (or
+   * newest first) with the matching fragments wrapped in <mark>
    */
   async searchMessages(
     user: JWTClaims,
     query: string,
-    conversationId?: string,
-    limit: number = 50
+    options: { conversationId?: string; limit?: number; offset?: number; sort?: string } = {}
   ) {
-    const whereClause: any = {
-      company_id: user.company_id,
-      content: { contains: query, mode: 'insensitive' },
-      // Filter deleted messages in application logic
-    };
-
-    if (conversationId) {
-      whereClause.conversation_id = conversationId;
-    } else {
-      // Only search in conversations user is part of
-      const userConversations = await prisma.conversationParticipant.findMany({
-        where: { user_id: user.user_id },
-        select: { conversation_id: true },
-      });
-      whereClause.conversation_id = {
-        in: userConversations.map(c => c.conversation_id),
-      };
+    const limit = Math.min(Math.max(options.limit || 20, 1), 100);
+    const offset = Math.max(options.offset || 0, 0);
+    const tsquery = toPrefixTsQuery(query);
+    if (!tsquery) {
+      throw new Error('Search query must contain at least one letter or number');
+    }
+    if (options.conversationId) {
+      await this.requireParticipant(user, options.conversationId);
     }
 
-    const messages = await prisma.message.findMany({
-      where: whereClause,
-      take: limit,
-      orderBy: { created_at: 'desc' },
-      include: {
-        sender: {
-          select: {
-            id: true,
-            first_name: true,
-            last_name: true,
-            role: true,
-          },
-        },
-        conversation: {
-          select: {
-            id: true,
-            subject: true,
-          },
-        },
-      },
-    });
+    const scope = Prisma.sql`
+      FROM messages m
+      JOIN conversation_participants cp
+        ON cp.conversation_id = m.conversation_id AND cp.user_id = ${user.user_id}::uuid AND cp.left_at IS NULL
+      LEFT JOIN message_recipients mr
+        ON mr.message_id = m.id AND mr.recipient_id = ${user.user_id}::uuid
+      WHERE m.search_vector @@ to_tsquery('simple', ${tsquery})
+        AND COALESCE(m.deleted_for_everyone, false) = false
+        AND COALESCE(mr.is_archived, false) = false
+        ${options.conversationId ? Prisma.sql`AND m.conversation_id = ${options.conversationId}::uuid` : Prisma.empty}
+    `;
+    const order = options.sort === 'recent'
+      ? Prisma.sql`m.created_at DESC`
+      : Prisma.sql`rank DESC, m.created_at DESC`;
+
+    const [rows, totals] = await Promise.all([
+      prisma.$queryRaw<Array<{
+        id: string;
+        conversation_id: string;
+        conversation_subject: string | null;
+        sender_id: string;
+        sender_first_name: string;
+        sender_last_name: string;
+        sender_role: string;
+        subject: string | null;
+        content: string;
+        message_type: string;
+        attachments: any;
+        created_at: Date;
+        rank: number;
+        highlight: string;
+      }>>`
+        SELECT m.id, m.conversation_id, c.subject AS conversation_subject,
+               u.id AS sender_id, u.first_name AS sender_first_name, u.last_name AS sender_last_name, u.role::text AS sender_role,
+               m.subject, m.content, m.message_type, m.attachments, m.created_at,
+               ts_rank(m.search_vector, to_tsquery('simple', ${tsquery}))::float8 AS rank,
+               ts_headline('simple', m.content, to_tsquery('simple', ${tsquery}), ${HEADLINE_OPTIONS}) AS highlight
+        ${scope}
+        ORDER BY ${order}
+        LIMIT ${limit} OFFSET ${offset}
+      `,
+      prisma.$queryRaw<Array<{ total: number }>>`SELECT COUNT(*)::int AS total ${scope}`,
+    ]);
+    const total = totals[0]?.total || 0;
 
-    return messages;
+    return {
+      query,
+      messages: rows.map(row => ({
+        id: row.id,
+        conversationId: row.conversation_id,
+        conversation: { id: row.conversation_id, subject: row.conversation_subject },
+        sender: { id: row.sender_id, first_name: row.sender_first_name, last_name: row.sender_last_name, role: row.sender_role },
+        subject: row.subject,
+        content: row.content,
+        message_type: row.message_type,
+        attachments: row.attachments,
+        created_at: row.created_at,
+        rank: Math.round(row.rank * 10000) / 10000,
+        highlight: markHighlight(row.highlight),
+      })),
+      total,
+      limit,
+      offset,
+      hasMore: offset + rows.length < total,
+    };
   },
 
   /**
-   * Update presence status
+   * Update presence status and relay it to the user's presence channel and active conversations
    */
   async updatePresence(user: JWTClaims, status: string, message?: string) {
-    // Use raw SQL for presence fields that may not exist in Prisma schema
-    await prisma.$executeRaw`
-      UPDATE users
-      SET presence_status = ${status},
-          presence_message = ${message || null},
-          last_seen_at = ${status === 'offline' ? new Date() : null}
-      WHERE id = ${user.user_id}::uuid
-    `;
-    
-    // Also update user_presence table if it exists
-    await prisma.$executeRaw`
-      INSERT INTO user_presence (user_id, status, message, last_seen_at, updated_at)
-      VALUES (${user.user_id}::uuid, ${status}, ${message || null}, ${status === 'offline' ? new Date() : null}, NOW())
-      ON CONFLICT (user_id)
-      DO UPDATE SET
-        status = ${status},
-        message = ${message || null},
-        last_seen_at = ${status === 'offline' ? new Date() : null},
-        updated_at = NOW()
-    `;
+    if (!PRESENCE_STATUSES.includes(status)) {
+      throw new Error(`status must be one of: ${PRESENCE_STATUSES.join(', ')}`);
+    }
+
+    const event: PresenceEvent = { userId: user.user_id, status, message, updatedAt: Date.now() };
+    applyPresence(event);
+    await supabaseRealtimeService.publishBackplane('presence', event);
+
+    const conversations = await prisma.conversationParticipant.findMany({
+      where: { user_id: user.user_id, left_at: null },
+      select: { conversation_id: true },
+    });
 
     // Publish presence update
     try {
-      await supabaseRealtimeService.publishMessage({
-        event: 'presence_updated',
-        userId: user.user_id,
-        status,
-        message,
-      });
+      await supabaseRealtimeService.publishPresenceUpdate(user.user_id, status, message, conversations.map(c => c.conversation_id));
     } catch (error) {
       console.debug('Error publishing presence update:', error);
     }
 
-    return { success: true };
+    return { success: true, status, expiresInMs: status === 'offline' ? null : PRESENCE_TTL_MS };
+  },
+
+  /**
+   * Current presence of users in the caller's company; anyone without a recent heartbeat is offline
+   */
+  async getPresence(user: JWTClaims, userIds: string[]) {
+    const users = await prisma.user.findMany({
+      where: { id: { in: userIds }, company_id: user.company_id },
+      select: { id: true },
+    });
+
+    const now = Date.now();
+    return users.map(({ id }) => ({ userId: id, ...presenceOf(id, now) }));
+  },
+
+  /**
+   * Who is reachable right now among the members of a conversation, or the people at a
+   * property: its owner, staff assigned to it and tenants on an active lease
+   */
+  async getOnlinePresence(user: JWTClaims, scope: { conversationId?: string; propertyId?: string }) {
+    let memberIds: string[];
+    if (scope.conversationId) {
+      await this.requireParticipant(user, scope.conversationId);
+      const participants = await prisma.conversationParticipant.findMany({
+        where: { conversation_id: scope.conversationId, left_at: null },
+        select: { user_id: true },
+      });
+      memberIds = participants.map(p => p.user_id);
+    } else if (scope.propertyId) {
+      memberIds = await this.propertyMemberIds(user, scope.propertyId);
+    } else {
+      throw new Error('conversation_id or property_id is required');
+    }
+
+    const now = Date.now();
+    const online = memberIds
+      .filter(id => id !== user.user_id)
+      .map(id => ({ userId: id, ...presenceOf(id, now) }))
+      .filter(entry => entry.status !== 'offline');
+    const users = online.length
+      ? await prisma.user.findMany({
+        where: { id: { in: online.map(entry => entry.userId) } },
+        select: { id: true, first_name: true, last_name: true, role: true },
+      })
+      : [];
+    const byId = new Map(users.map(u => [u.id, u]));
+
+    return {
+      ...(scope.conversationId ? { conversationId: scope.conversationId } : { propertyId: scope.propertyId }),
+      members: memberIds.length,
+      online: online
+        .filter(entry => byId.has(entry.userId))
+        .map(entry => ({ ...entry, user: byId.get(entry.userId) })),
+    };
+  },
+
+  /**
+   * Everyone attached to a property the caller belongs to
+   */
+  async propertyMemberIds(user: JWTClaims, propertyId: string) {
+    const property = await prisma.property.findFirst({
+      where: { id: propertyId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, owner_id: true },
+    });
+    if (!property) {
+      throw new Error('Property not found');
+    }
+    const [assignments, leases] = await Promise.all([
+      prisma.staffPropertyAssignment.findMany({
+        where: { property_id: property.id, status: 'active' },
+        select: { staff_id: true },
+      }),
+      prisma.lease.findMany({
+        where: { property_id: property.id, status: 'active' },
+        select: { tenant_id: true },
+      }),
+    ]);
+    const staffIds = assignments.map(a => a.staff_id);
+    const tenantIds = leases.map(l => l.tenant_id);
+
+    // Tenants and assigned staff only see the properties they belong to
+    const belongs = user.role === 'tenant' ? tenantIds.includes(user.user_id)
+      : ['agent', 'caretaker'].includes(user.role) ? staffIds.includes(user.user_id)
+      : true;
+    if (!belongs) {
+      throw new Error('Only members of this property can see who is online');
+    }
+    return [...new Set([property.owner_id, ...staffIds, ...tenantIds])];
   },
 
   /**
@@ -852,53 +1577,27 @@ export const messagingService = {
     conversationId: string,
     isTyping: boolean
   ) {
-    // Verify user is participant
-    const participant = await prisma.conversationParticipant.findFirst({
-      where: {
-        conversation_id: conversationId,
-        user_id: user.user_id,
-      },
-    });
-
-    if (!participant) {
-      throw new Error('Not a participant in this conversation');
-    }
-
-    if (isTyping) {
-      await prisma.$executeRaw`
-        INSERT INTO typing_indicators (conversation_id, user_id, is_typing, started_at, updated_at)
-        VALUES (${conversationId}::uuid, ${user.user_id}::uuid, true, NOW(), NOW())
-        ON CONFLICT (conversation_id, user_id)
-        DO UPDATE SET is_typing = true, updated_at = NOW()
-      `;
-    } else {
-      await prisma.$executeRaw`
-        UPDATE typing_indicators
-        SET is_typing = false, updated_at = NOW()
-        WHERE conversation_id = ${conversationId}::uuid
-          AND user_id = ${user.user_id}::uuid
-      `;
-    }
+    await this.requireParticipant(user, conversationId, WRITER_ROLES);
 
     // Get other participants
     const otherParticipants = await prisma.conversationParticipant.findMany({
       where: {
         conversation_id: conversationId,
         user_id: { not: user.user_id },
+        left_at: null,
       },
       select: { user_id: true },
     });
 
     // Publish typing indicator
     try {
-      for (const participant of otherParticipants) {
-        await supabaseRealtimeService.publishMessage({
-          event: 'typing',
-          conversationId,
-          userId: user.user_id,
-          isTyping,
-        });
-      }
+      await supabaseRealtimeService.publishTypingIndicator(
+        conversationId,
+        user.user_id,
+        otherParticipants.map(p => p.user_id),
+        isTyping,
+        TYPING_TTL_MS
+      );
     } catch (error) {
       console.debug('Error publishing typing indicator:', error);
     }
@@ -0,0 +1,383 @@
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+
+// Channels the queue delivers; 'app' is the notification row itself
+export const QUEUED_CHANNELS = ['push', 'email', 'sms'];
+
+const QUEUED_STATUSES = ['pending', 'retrying'];
+const ADMIN_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+
+/**
+ * Retries per channel: attempts in total, and the delay before the first retry, doubling after
+ * each failure up to MAX_RETRY_DELAY. SMS costs money per attempt, so it gives up soonest.
+ */
+const RETRY_POLICIES: Record<string, { maxAttempts: number; baseDelay: number }> = {
+  push: { maxAttempts: 5, baseDelay: 30 * 1000 },
+  email: { maxAttempts: 6, baseDelay: 60 * 1000 },
+  sms: { maxAttempts: 4, baseDelay: 2 * 60 * 1000 },
+};
+const MAX_RETRY_DELAY = 6 * 60 * 60 * 1000;
+// A claimed delivery whose worker died is picked up again after this long
+const PROCESSING_LEASE = 5 * 60 * 1000;
+// Deliveries sent concurrently by one run
+const SEND_CONCURRENCY = 20;
+
+/**
+ * A failure that retrying cannot fix (no gateway, invalid number); goes straight to the dead-letter list
+ */
+class PermanentDeliveryError extends Error {}
+
+interface DeliveryOutcome {
+  status: 'sent' | 'skipped';
+  reason?: string;
+  metadata?: Record<string, any>;
+}
+
+const backoff = (attempts: number, baseDelay: number) => {
+  const delay = Math.min(baseDelay * 2 ** (attempts - 1), MAX_RETRY_DELAY);
+  // Up to 10% jitter so a batch that failed together does not retry together
+  return Math.round(delay * (1 + Math.random() * 0.1));
+};
+
+// Due queued deliveries, plus claimed ones whose lease ran out
+const dueWhere = (now: Date) => ({
+  OR: [
+    { status: { in: QUEUED_STATUSES }, next_attempt_at: { lte: now } },
+    { status: 'processing', next_attempt_at: { lt: now } },
+  ],
+});
+
+/**
+ * Persistent delivery queue for notification channels. Each channel of a notification is one
+ * notification_delivery_log row that moves pending → processing → sent/skipped, or back to
+ * retrying with exponential backoff until its attempts run out and it is dead-lettered.
+ */
+export class NotificationDeliveryService {
+  private prisma = getPrisma();
+
+  /**
+   * Queue the given, already resolved, channels of a notification and start sending right away;
+   * the scheduler picks up whatever fails or is left over
+   */
+  async enqueue(notificationId: string, recipientId: string, channels: string[]) {
+    const queued = [...new Set(channels)].filter(channel => QUEUED_CHANNELS.includes(channel));
+    if (!queued.length) return 0;
+
+    const now = new Date();
+    await this.prisma.notificationDeliveryLog.createMany({
+      data: queued.map(channel => ({
+        notification_id: notificationId,
+        user_id: recipientId,
+        channel,
+        status: 'pending',
+        max_attempts: RETRY_POLICIES[channel].maxAttempts,
+        next_attempt_at: now,
+      })),
+    });
+    this.processNotification(notificationId).catch(error =>
+      console.error(`❌ Failed to dispatch notification ${notificationId}:`, error));
+    return queued.length;
+  }
+
+  /**
+   * Scheduled run: attempt every delivery that is due
+   */
+  async processDue(limit = 500) {
+    const due = await this.prisma.notificationDeliveryLog.findMany({
+      where: dueWhere(new Date()),
+      select: { id: true },
+      orderBy: { next_attempt_at: 'asc' },
+      take: limit,
+    });
+    return this.attemptAll(due.map(row => row.id));
+  }
+
+  async processNotification(notificationId: string) {
+    const due = await this.prisma.notificationDeliveryLog.findMany({
+      where: { notification_id: notificationId, ...dueWhere(new Date()) },
+      select: { id: true },
+    });
+    return this.attemptAll(due.map(row => row.id));
+  }
+
+  /**
+   * Delivery status of each channel of a notification the user can see
+   */
+  async getDeliveryStatus(notificationId: string, user: JWTClaims) {
+    const notification = await this.prisma.notification.findFirst({
+      where: {
+        id: notificationId,
+        ...(user.role !== 'super_admin' && {
+          company_id: user.company_id!,
+          ...(!ADMIN_ROLES.includes(user.role) && { OR: [{ recipient_id: user.user_id }, { sender_id: user.user_id }] }),
+        }),
+      },
+      select: { id: true, channels: true, created_at: true },
+    });
+    if (!notification) {
+      throw new Error('Notification not found');
+    }
+    const deliveries = await this.prisma.notificationDeliveryLog.findMany({
+      where: { notification_id: notification.id },
+      select: {
+        id: true,
+        channel: true,
+        status: true,
+        attempts: true,
+        max_attempts: true,
+        next_attempt_at: true,
+        last_attempt_at: true,
+        sent_at: true,
+        delivered_at: true,
+        failed_at: true,
+        failure_reason: true,
+        created_at: true,
+      },
+      orderBy: { created_at: 'asc' },
+    });
+    return { notification_id: notification.id, channels: notification.channels, deliveries };
+  }
+
+  /**
+   * Deliveries that ran out of attempts, newest first
+   */
+  async listDeadLetters(user: JWTClaims, filters: { channel?: string; limit?: number; offset?: number } = {}) {
+    this.requireAdmin(user);
+    const where: any = {
+      status: 'dead_letter',
+      ...(filters.channel && { channel: filters.channel }),
+      ...(user.role !== 'super_admin' && { notification: { company_id: user.company_id! } }),
+    };
+    const limit = Math.min(filters.limit || 50, 200);
+    const [deliveries, total] = await Promise.all([
+      this.prisma.notificationDeliveryLog.findMany({
+        where,
+        include: {
+          notification: { select: { id: true, title: true, notification_type: true, priority: true, created_at: true } },
+          user: { select: { id: true, first_name: true, last_name: true, email: true, phone_number: true } },
+        },
+        orderBy: { failed_at: 'desc' },
+        skip: filters.offset || 0,
+        take: limit,
+      }),
+      this.prisma.notificationDeliveryLog.count({ where }),
+    ]);
+    return { deliveries, total, limit, offset: filters.offset || 0 };
+  }
+
+  /**
+   * Put one dead-lettered delivery back on the queue with a fresh set of attempts
+   */
+  async requeue(deliveryId: string, user: JWTClaims) {
+    this.requireAdmin(user);
+    const delivery = await this.prisma.notificationDeliveryLog.findFirst({
+      where: {
+        id: deliveryId,
+        ...(user.role !== 'super_admin' && { notification: { company_id: user.company_id! } }),
+      },
+      select: { id: true, status: true, notification_id: true },
+    });
+    if (!delivery) {
+      throw new Error('Delivery not found');
+    }
+    if (delivery.status !== 'dead_letter') {
+      throw new Error('Only dead-lettered deliveries can be requeued');
+    }
+    await this.prisma.notificationDeliveryLog.update({
+      where: { id: delivery.id },
+      data: { status: 'pending', attempts: 0, next_attempt_at: new Date(), failed_at: null },
+    });
+    await this.processNotification(delivery.notification_id);
+    return this.prisma.notificationDeliveryLog.findUnique({ where: { id: delivery.id } });
+  }
+
+  /**
+   * Requeue every dead letter the user can see, optionally for one channel, e.g. after a gateway outage
+   */
+  async requeueDeadLetters(user: JWTClaims, channel?: string) {
+    this.requireAdmin(user);
+    const { count } = await this.prisma.notificationDeliveryLog.updateMany({
+      where: {
+        status: 'dead_letter',
+        ...(channel && { channel }),
+        ...(user.role !== 'super_admin' && { notification: { company_id: user.company_id! } }),
+      },
+      data: { status: 'pending', attempts: 0, next_attempt_at: new Date(), failed_at: null },
+    });
+    return { requeued: count };
+  }
+
+  private requireAdmin(user: JWTClaims) {
+    if (!ADMIN_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage notification deliveries');
+    }
+  }
+
+  private async attemptAll(ids: string[]) {
+    const counts = { attempted: 0, sent: 0, retrying: 0, dead_lettered: 0 };
+    for (let i = 0; i < ids.length; i += SEND_CONCURRENCY) {
+      const results = await Promise.allSettled(ids.slice(i, i + SEND_CONCURRENCY).map(id => this.attempt(id)));
+      for (const result of results) {
+        if (result.status === 'rejected') {
+          console.error('❌ Notification delivery attempt failed:', result.reason);
+          continue;
+        }
+        if (!result.value) continue;
+        counts.attempted++;
+        if (result.value === 'sent') counts.sent++;
+        if (result.value === 'retrying') counts.retrying++;
+        if (result.value === 'dead_letter') counts.dead_lettered++;
+      }
+    }
+    return counts;
+  }
+
+  /**
+   * Claim one delivery and send it; returns its new status, or null if another worker has it
+   */
+  private async attempt(deliveryId: string) {
+    const now = new Date();
+    const claimed = await this.prisma.notificationDeliveryLog.updateMany({
+      where: { id: deliveryId, ...dueWhere(now) },
+      data: { status: 'processing', next_attempt_at: new Date(now.getTime() + PROCESSING_LEASE) },
+    });
+    if (!claimed.count) return null;
+
+    const delivery = await this.prisma.notificationDeliveryLog.findUniqueOrThrow({
+      where: { id: deliveryId },
+      include: {
+        notification: true,
+        user: { select: { id: true, email: true, phone_number: true, first_name: true } },
+      },
+    });
+    const attempts = delivery.attempts + 1;
+
+    try {
+      const outcome = await this.send(delivery.channel, delivery.notification, delivery.user);
+      await this.prisma.notificationDeliveryLog.update({
+        where: { id: delivery.id },
+        data: {
+          status: outcome.status,
+          attempts,
+          last_attempt_at: now,
+          next_attempt_at: null,
+          sent_at: outcome.status === 'sent' ? new Date() : null,
+          failure_reason: outcome.reason || null,
+          ...(outcome.metadata && { metadata: outcome.metadata }),
+        },
+      });
+      return outcome.status;
+    } catch (error: any) {
+      const reason = error?.message || 'Unknown error';
+      const exhausted = error instanceof PermanentDeliveryError || attempts >= delivery.max_attempts;
+      const policy = RETRY_POLICIES[delivery.channel] || RETRY_POLICIES.push;
+      await this.prisma.notificationDeliveryLog.update({
+        where: { id: delivery.id },
+        data: {
+          status: exhausted ? 'dead_letter' : 'retrying',
+          attempts,
+          last_attempt_at: now,
+          next_attempt_at: exhausted ? null : new Date(Date.now() + backoff(attempts, policy.baseDelay)),
+          failed_at: exhausted ? new Date() : null,
+          failure_reason: reason,
+        },
+      });
+      if (exhausted) {
+        console.error(`❌ ${delivery.channel} delivery of notification ${delivery.notification_id} dead-lettered after ${attempts} attempt(s): ${reason}`);
+      }
+      return exhausted ? 'dead_letter' : 'retrying';
+    }
+  }
+
+  private async send(
+    channel: string,
+    notification: { id: string; company_id: string; sender_id: string | null; recipient_id: string; title: string; message: string; notification_type: string; category: string | null; priority: string; action_url: string | null; metadata: any },
+    recipient: { id: string; email: string | null; phone_number: string | null; first_name: string }
+  ): Promise<DeliveryOutcome> {
+    switch (channel) {
+      case 'push': {
+        const { pushNotificationService } = await import('./push-notification.service.js');
+        const metadata = (typeof notification.metadata === 'object' && notification.metadata) ? notification.metadata as Record<string, unknown> : {};
+        const result = await pushNotificationService.sendToUser(recipient.id, {
+          title: notification.title,
+          body: notification.message,
+          notificationType: notification.notification_type,
+          category: notification.category || 'general',
+          priority: notification.priority === 'urgent' || notification.priority === 'high' ? 'high' : 'normal',
+          actionUrl: notification.action_url || undefined,
+          data: {
+            notificationId: notification.id,
+            id: notification.id,
+            type: notification.notification_type,
+            sender_id: notification.sender_id || '',
+            recipient_id: notification.recipient_id,
+            category: notification.category,
+            actionUrl: notification.action_url,
+            ...metadata, // payment_id, invoice_id, maintenance_request_id, etc. for deep linking
+          },
+        });
+        if (result.success) {
+          return { status: 'sent', metadata: { sent: result.sent, failed: result.failed } };
+        }
+        if (!result.failed) {
+          // Switched off for this category, or nothing to send to
+          return { status: 'skipped', reason: 'push disabled or no active devices' };
+        }
+        throw new Error(result.errors?.join('; ') || 'push delivery failed');
+      }
+
+      case 'email': {
+        if (!recipient.email) {
+          return { status: 'skipped', reason: 'recipient has no email address' };
+        }
+        const { emailTemplatesService } = await import('./email-templates.service.js');
+        const result = await emailTemplatesService.send('notification', {
+          to: recipient.email,
+          recipientId: recipient.id,
+          companyId: notification.company_id,
+          variables: {
+            recipient_name: recipient.first_name,
+            title: notification.title,
+            message: notification.message,
+            action_url: notification.action_url
+              ? `${env.appUrl}${notification.action_url.startsWith('/') ? '' : '/'}${notification.action_url}`
+              : null,
+          },
+          type: notification.notification_type,
+        });
+        if (!result.success) {
+          throw new Error(result.error || 'email delivery failed');
+        }
+        return { status: 'sent', metadata: { message_id: result.messageId } };
+      }
+
+      case 'sms': {
+        if (!recipient.phone_number) {
+          return { status: 'skipped', reason: 'recipient has no phone number' };
+        }
+        const { smsService } = await import('./sms.service.js');
+        const result = await smsService.sendSms({
+          to: recipient.phone_number,
+          body: `${notification.title}. ${notification.message}`,
+          companyId: notification.company_id,
+          recipientId: recipient.id,
+          type: notification.notification_type,
+        });
+        if (result.success) {
+          return { status: 'sent', metadata: { sms_message_id: result.id } };
+        }
+        // The gateway refusing the number, or no gateway at all, will not change on a retry
+        if (!result.id || result.status === 'rejected') {
+          throw new PermanentDeliveryError(result.error || 'SMS rejected');
+        }
+        throw new Error(result.error || 'SMS delivery failed');
+      }
+
+      default:
+        throw new PermanentDeliveryError(`unsupported channel: ${channel}`);
+    }
+  }
+}
+
+export const notificationDeliveryService = new NotificationDeliveryService();
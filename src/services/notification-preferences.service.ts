@@ -0,0 +1,188 @@
+import { getPrisma } from '../config/prisma.js';
+
+export const NOTIFICATION_CHANNELS = ['app', 'push', 'email', 'sms'] as const;
+export type NotificationChannel = (typeof NOTIFICATION_CHANNELS)[number];
+
+interface EventTypeDefinition {
+  label: string;
+  defaults: NotificationChannel[];
+  // Channels the user cannot switch off for this event type
+  locked?: NotificationChannel[];
+}
+
+/**
+ * Event types users can route to channels, with the channels used until they say otherwise.
+ * In-app ('app') is always on: the inbox is the record of every notification.
+ */
+export const NOTIFICATION_EVENT_TYPES: Record<string, EventTypeDefinition> = {
+  invoice: { label: 'Invoices and rent reminders', defaults: ['app', 'email', 'sms'] },
+  payment: { label: 'Payments and receipts', defaults: ['app', 'push', 'email'] },
+  message: { label: 'Chat messages', defaults: ['app', 'push'] },
+  maintenance: { label: 'Maintenance requests', defaults: ['app', 'push', 'email'] },
+  lease: { label: 'Leases and renewals', defaults: ['app', 'email'] },
+  announcement: { label: 'Announcements and broadcasts', defaults: ['app', 'push', 'email'] },
+  task: { label: 'Tasks and schedules', defaults: ['app', 'push'] },
+  inspection: { label: 'Inspections', defaults: ['app', 'push', 'email'] },
+  application: { label: 'Unit applications', defaults: ['app', 'email'] },
+  emergency: { label: 'Emergencies', defaults: ['app', 'push', 'sms'], locked: ['app', 'push', 'sms'] },
+  escalation: { label: 'Unanswered message escalations', defaults: ['app', 'push', 'email', 'sms'] },
+  general: { label: 'Everything else', defaults: ['app', 'push'] },
+};
+
+// notification_type values used across the services, mapped to the event type that governs them
+const EVENT_TYPE_ALIASES: Record<string, string> = {
+  rent_reminder: 'invoice',
+  payment_reminder: 'invoice',
+  payment_due: 'invoice',
+  payment_receipt: 'payment',
+  chat: 'message',
+  maintenance_update: 'maintenance',
+  lease_update: 'lease',
+  lease_expiry: 'lease',
+  info: 'announcement',
+  alert: 'announcement',
+  broadcast: 'announcement',
+  property_announcement: 'announcement',
+  staff_leave: 'task',
+  preventive_maintenance: 'maintenance',
+  message_escalation: 'escalation',
+};
+
+export interface NotificationPreferenceUpdate {
+  notification_type?: string;
+  channels?: string[];
+  is_enabled?: boolean;
+}
+
+export const eventTypeFor = (notificationType?: string | null) => {
+  const type = (notificationType || '').trim().toLowerCase();
+  if (NOTIFICATION_EVENT_TYPES[type]) return type;
+  return EVENT_TYPE_ALIASES[type] || 'general';
+};
+
+/**
+ * Per-user matrix of event type → delivery channels, stored one row per customised
+ * event type in notification_preferences
+ */
+export class NotificationPreferencesService {
+  private prisma = getPrisma();
+
+  async getMatrix(userId: string) {
+    const rows = await this.prisma.notificationPreference.findMany({ where: { user_id: userId } });
+    const saved = new Map(rows.map(row => [row.notification_type, row]));
+
+    return {
+      channels: NOTIFICATION_CHANNELS,
+      preferences: Object.entries(NOTIFICATION_EVENT_TYPES).map(([type, definition]) => {
+        const row = saved.get(type);
+        return {
+          notification_type: type,
+          label: definition.label,
+          channels: row ? this.withLocked(type, row.channels as string[]) : definition.defaults,
+          is_enabled: row ? row.is_enabled || !!definition.locked : true,
+          locked_channels: definition.locked || ['app'],
+          customized: !!row,
+        };
+      }),
+    };
+  }
+
+  async updateMatrix(userId: string, updates: NotificationPreferenceUpdate[]) {
+    if (!Array.isArray(updates) || !updates.length) {
+      throw new Error('preferences must be a non-empty array');
+    }
+
+    const validated = updates.map(update => {
+      const type = update.notification_type;
+      if (!type || !NOTIFICATION_EVENT_TYPES[type]) {
+        throw new Error(`notification_type must be one of: ${Object.keys(NOTIFICATION_EVENT_TYPES).join(', ')}`);
+      }
+      const definition = NOTIFICATION_EVENT_TYPES[type];
+      if (update.channels !== undefined) {
+        if (!Array.isArray(update.channels)) {
+          throw new Error('channels must be an array');
+        }
+        const unknown = update.channels.filter(channel => !NOTIFICATION_CHANNELS.includes(channel as NotificationChannel));
+        if (unknown.length) {
+          throw new Error(`unknown channels: ${unknown.join(', ')}`);
+        }
+      }
+      if (definition.locked && update.is_enabled === false) {
+        throw new Error(`${type} notifications cannot be turned off`);
+      }
+      return { type, channels: update.channels, is_enabled: update.is_enabled };
+    });
+
+    const existing = await this.prisma.notificationPreference.findMany({
+      where: { user_id: userId, notification_type: { in: validated.map(update => update.type) } },
+    });
+    const current = new Map(existing.map(row => [row.notification_type, row]));
+
+    await this.prisma.$transaction(
+      validated.map(update => {
+        const row = current.get(update.type);
+        const channels = this.withLocked(
+          update.type,
+          update.channels ?? (row?.channels as string[] | undefined) ?? NOTIFICATION_EVENT_TYPES[update.type].defaults
+        );
+        const isEnabled = update.is_enabled ?? row?.is_enabled ?? true;
+        return this.prisma.notificationPreference.upsert({
+          where: { user_id_notification_type: { user_id: userId, notification_type: update.type } },
+          create: { user_id: userId, notification_type: update.type, channels, is_enabled: isEnabled },
+          update: { channels, is_enabled: isEnabled, updated_at: new Date() },
+        });
+      })
+    );
+
+    return this.getMatrix(userId);
+  }
+
+  /**
+   * Drop a customisation so the event type falls back to its default channels
+   */
+  async resetPreference(userId: string, notificationType: string) {
+    if (!NOTIFICATION_EVENT_TYPES[notificationType]) {
+      throw new Error('notification type not found');
+    }
+    await this.prisma.notificationPreference.deleteMany({
+      where: { user_id: userId, notification_type: notificationType },
+    });
+    return this.getMatrix(userId);
+  }
+
+  /**
+   * The channels a user wants for a notification type
+   */
+  async channelsFor(userId: string, notificationType?: string | null): Promise<string[]> {
+    const type = eventTypeFor(notificationType);
+    const definition = NOTIFICATION_EVENT_TYPES[type];
+    try {
+      const row = await this.prisma.notificationPreference.findUnique({
+        where: { user_id_notification_type: { user_id: userId, notification_type: type } },
+      });
+      if (!row) return definition.defaults;
+      if (!row.is_enabled && !definition.locked) return ['app'];
+      return this.withLocked(type, row.channels as string[]);
+    } catch (error) {
+      console.error(`Error loading notification preferences for user ${userId}:`, error);
+      return definition.defaults;
+    }
+  }
+
+  /**
+   * Narrow the channels a sender asked for to those the recipient accepts for this type
+   */
+  async filterChannels(userId: string, notificationType: string | null | undefined, requested: string[]) {
+    const wanted = await this.channelsFor(userId, notificationType);
+    return [...new Set(requested)].filter(channel =>
+      channel === 'app' || !NOTIFICATION_CHANNELS.includes(channel as NotificationChannel) || wanted.includes(channel)
+    );
+  }
+
+  private withLocked(type: string, channels: string[]) {
+    const locked = NOTIFICATION_EVENT_TYPES[type].locked || [];
+    return [...new Set(['app', ...locked, ...(Array.isArray(channels) ? channels : [])])];
+  }
+}
+
+export const notificationPreferencesService = new NotificationPreferencesService();
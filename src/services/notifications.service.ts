@@ -1,12 +1,90 @@
+import { Prisma } from '@prisma/client';
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import { buildWhereClause, formatDataForRole } from '../utils/roleBasedFiltering.js';
 import { supabaseRealtimeService } from './supabase-realtime.service.js';
 import { pushNotificationService } from './push-notification.service.js';
+import { TenantSettingsService } from './tenant-settings.service.js';
+import { notificationPreferencesService } from './notification-preferences.service.js';
+import { notificationDeliveryService, QUEUED_CHANNELS } from './notification-delivery.service.js';
 
 const prisma = getPrisma();
+const tenantSettingsService = new TenantSettingsService();
+
+/**
+ * When a notification is gone for everyone in it: deleted for everyone, or deleted by its sender
+ * (if any) and its recipient. Retention purges from this moment.
+ */
+export const deletedAtFor = (
+  notification: { sender_id: string | null; recipient_id: string; deleted_for_everyone?: boolean },
+  deletedByUsers: string[]
+): Date | null => {
+  if (notification.deleted_for_everyone) return new Date();
+  const participants = [notification.sender_id, notification.recipient_id].filter((id): id is string => !!id);
+  return participants.every(id => deletedByUsers.includes(id)) ? new Date() : null;
+};
+
+// A user's own inbox: notifications addressed to them that are neither archived nor deleted for everyone
+const inboxWhere = (userId: string): Prisma.NotificationWhereInput => ({
+  recipient_id: userId,
+  status: { not: 'archived' },
+  deleted_for_everyone: false,
+});
 
 export const notificationsService = {
+  /**
+   * Create a system-generated notification (no acting user) and push it to the recipient's
+   * realtime channel. Services raising notifications for any role go through here.
+   * `deliver` lists channels the caller already passed through resolveChannels; they are sent
+   * by the delivery queue.
+   */
+  async notify(data: Prisma.NotificationUncheckedCreateInput, deliver: string[] = []) {
+    const queued = deliver.filter(channel => QUEUED_CHANNELS.includes(channel));
+    const notification = await prisma.notification.create({
+      data: queued.length ? { ...data, channels: [...new Set(['app', ...queued])] } : data,
+    });
+    await this.publishCreated(notification);
+    if (queued.length) {
+      await notificationDeliveryService.enqueue(notification.id, notification.recipient_id, queued);
+    }
+    return notification;
+  },
+
+  /**
+   * Realtime new_notification event plus the recipient's refreshed unread count
+   */
+  async publishCreated(notification: { recipient_id: string } & Record<string, any>) {
+    try {
+      await supabaseRealtimeService.publishNotification(notification);
+      await supabaseRealtimeService.publishNotificationCount(
+        notification.recipient_id,
+        await prisma.notification.count({ where: { ...inboxWhere(notification.recipient_id), is_read: false } })
+      );
+    } catch (error) {
+      // Silently fail if Supabase is not available
+      console.debug('Supabase Realtime not available:', error);
+    }
+  },
+
+  /**
+   * The single gate every sender passes before dispatching: narrows the requested channels to
+   * the recipient's per-type preference matrix, then to their channel switches and quiet hours.
+   */
+  async resolveChannels(
+    recipientId: string,
+    notificationType: string,
+    requested: string[],
+    category: string = notificationType,
+    priority: string = 'medium'
+  ): Promise<string[]> {
+    const wanted = await notificationPreferencesService.filterChannels(recipientId, notificationType, requested);
+    return tenantSettingsService.resolveChannels(recipientId, wanted, category, priority);
+  },
+
+  async accepts(recipientId: string, notificationType: string, channel: string, category?: string, priority?: string) {
+    return (await this.resolveChannels(recipientId, notificationType, [channel], category, priority)).includes(channel);
+  },
+
   async getNotifications(user: JWTClaims, limit: number = 10, offset: number = 0, filters: any = {}) {
     // Extract property_ids from filters if provided
     const propertyIds = filters?.property_ids;
@@ -15,7 +93,7 @@ export const notificationsService = {
     // Build role-based where clause for notifications
     // Include both sent and received notifications
     // Handle special case for message filtering (notification_type='message' OR category='message')
-    const { notification_type, category, ...restFilters } = filters;
+    const { notification_type, notification_types, unread_only, category, ...restFilters } = filters;
     
     // Build AND conditions array
     const andConditions: any[] = [];
@@ -39,6 +117,17 @@ export const notificationsService = {
           { category: 'message' }
         ]
       });
+    } else if (notification_type) {
+      andConditions.push({ notification_type });
+    }
+
+    // Notification center type tabs (several types at once)
+    if (notification_types?.length) {
+      andConditions.push({ notification_type: { in: notification_types } });
+    }
+
+    if (unread_only) {
+      andConditions.push({ recipient_id: user.user_id, is_read: false });
     }
     
     // Add category filter to AND conditions to ensure it works with sender/recipient OR condition
@@ -250,12 +339,7 @@ export const notificationsService = {
     });
 
     // Publish to Supabase Realtime for real-time delivery
-    try {
-      await supabaseRealtimeService.publishNotification(notification);
-    } catch (error) {
-      // Silently fail if Supabase is not available
-      console.debug('Supabase Realtime not available:', error);
-    }
+    await this.publishCreated(notification);
 
     // Check if push notifications should be sent
     const channels = Array.isArray(createData.channels)
@@ -273,72 +357,27 @@ export const notificationsService = {
       }
     }
 
-    // Send push notification for messages and important notifications
-    // Always send push for messages, and for other notifications if 'push' is in channels
-    const shouldSendPush = allChannels.includes('push') || 
-                          notification.notification_type === 'message' ||
-                          notification.category === 'message' ||
-                          notification.priority === 'urgent' ||
-                          notification.priority === 'high';
-
-    if (shouldSendPush) {
-      // Check user preferences
-      const shouldSend = await pushNotificationService.shouldSendNotification(
-        notification.recipient_id,
-        createData.category || 'general',
-        createData.priority || 'medium'
-      );
-
-      if (shouldSend) {
-        // Send push notification
-        try {
-          // Build push data: base fields + metadata (payment_id, invoice_id, maintenance_id, etc.) for deep linking
-          const metadata = (typeof notification.metadata === 'object' && notification.metadata)
-            ? notification.metadata as Record<string, unknown>
-            : {};
-          const pushResult = await pushNotificationService.sendToUser(
-            notification.recipient_id,
-            {
-              title: notification.title,
-              body: notification.message,
-              notificationType: notification.notification_type,
-              category: notification.category || 'general',
-              priority: notification.priority === 'urgent' ? 'high' : 'normal',
-              data: {
-                notificationId: notification.id,
-                id: notification.id, // Also include as 'id' for easier access
-                type: notification.notification_type,
-                sender_id: notification.sender_id || '',
-                recipient_id: notification.recipient_id || '',
-                category: notification.category,
-                actionUrl: notification.action_url,
-                ...metadata, // payment_id, invoice_id, maintenance_id, request_id, etc.
-              },
-            }
-          );
-
-          // Log delivery
-          if (pushResult.sent > 0) {
-            await pushNotificationService.logDelivery(
-              notification.id,
-              notification.recipient_id,
-              'push',
-              'sent',
-              { sent: pushResult.sent, failed: pushResult.failed }
-            );
-          }
-        } catch (error) {
-          console.error('Error sending push notification:', error);
-          await pushNotificationService.logDelivery(
-            notification.id,
-            notification.recipient_id,
-            'push',
-            'failed',
-            { error: (error as Error).message }
-          );
-        }
-      }
-    }
+    // Push goes out for messages and important notifications even when not asked for
+    const wantsPush = allChannels.includes('push') ||
+                      notification.notification_type === 'message' ||
+                      notification.category === 'message' ||
+                      notification.priority === 'urgent' ||
+                      notification.priority === 'high';
+    const requested = [
+      ...(wantsPush ? ['push'] : []),
+      ...allChannels.filter((channel: string) => channel === 'email' || channel === 'sms'),
+    ];
+
+    // Respect the recipient's preference matrix, channel switches and quiet hours, then hand the
+    // sending to the delivery queue
+    const accepted = await this.resolveChannels(
+      notification.recipient_id,
+      notification.notification_type,
+      requested,
+      createData.category || 'general',
+      createData.priority || 'medium'
+    );
+    await notificationDeliveryService.enqueue(notification.id, notification.recipient_id, accepted);
 
     return notification;
   },
@@ -519,6 +558,7 @@ export const notificationsService = {
         where: { id: notificationId },
         data: {
           deleted_for_everyone: true,
+          deleted_at: new Date(),
           message: 'This message was deleted',
           updated_at: new Date(),
         }
@@ -546,6 +586,7 @@ export const notificationsService = {
       where: { id: notificationId },
       data: {
         deleted_by_users: deletedByUsers,
+        deleted_at: deletedAtFor(existingNotification, deletedByUsers),
         updated_at: new Date(),
       }
     });
@@ -604,29 +645,22 @@ export const notificationsService = {
       console.debug('Failed to publish notification read to Supabase:', error);
     }
 
+    if (updatedNotification.recipient_id === user.user_id) {
+      try {
+        await supabaseRealtimeService.publishNotificationCount(user.user_id, await this.getUnreadCount(user));
+      } catch (error) {
+        console.debug('Failed to publish notification count to Supabase:', error);
+      }
+    }
+
     return updatedNotification;
   },
 
   async getUnreadCount(user: JWTClaims) {
     try {
-      // Simplified approach using actual schema fields
-      const whereClause: any = {
-        is_read: false,
-        recipient_id: user.user_id,
-        company_id: user.company_id
-      };
-
-      // Super admin can see all notifications
-      if (user.role === 'super_admin') {
-        delete whereClause.company_id;
-        delete whereClause.recipient_id;
-      }
-
-      const count = await prisma.notification.count({
-        where: whereClause
+      return await prisma.notification.count({
+        where: { ...inboxWhere(user.user_id), is_read: false },
       });
-
-      return count;
     } catch (error) {
       console.error('Error getting unread notification count:', error);
       // Return 0 if there's an error (e.g., table doesn't exist)
@@ -634,32 +668,46 @@ export const notificationsService = {
     }
   },
 
-  async markAllAsRead(user: JWTClaims) {
-    // Build where clause for user's notifications
-    let whereClause: any = { is_read: false };
-
-    if (user.role === 'super_admin') {
-      // super_admin sees all unread
-      whereClause = { is_read: false };
-    } else {
-      whereClause = {
-        is_read: false,
-        company_id: user.company_id,
-        OR: [
-          { recipient_id: user.user_id },
-          { sender_id: user.user_id }
-        ]
-      };
-    }
+  /**
+   * Unread notifications for the notification center badge, broken down by type and category
+   */
+  async getUnreadCounts(user: JWTClaims) {
+    const where = { ...inboxWhere(user.user_id), is_read: false };
+    const [byType, byCategory] = await Promise.all([
+      prisma.notification.groupBy({ by: ['notification_type'], where, _count: { _all: true } }),
+      prisma.notification.groupBy({ by: ['category'], where, _count: { _all: true } }),
+    ]);
+    return {
+      unreadCount: byType.reduce((sum, row) => sum + row._count._all, 0),
+      by_type: Object.fromEntries(byType.map(row => [row.notification_type, row._count._all])),
+      by_category: Object.fromEntries(byCategory.map(row => [row.category || 'general', row._count._all])),
+    };
+  },
 
+  /**
+   * Mark the caller's own unread notifications as read, optionally only one type or category
+   */
+  async markAllAsRead(user: JWTClaims, filters: { notification_type?: string; category?: string } = {}) {
     const result = await prisma.notification.updateMany({
-      where: whereClause,
+      where: {
+        ...inboxWhere(user.user_id),
+        is_read: false,
+        ...(filters.notification_type && { notification_type: filters.notification_type }),
+        ...(filters.category && { category: filters.category }),
+      },
       data: {
         is_read: true,
+        status: 'read',
         read_at: new Date(),
       }
     });
 
+    try {
+      await supabaseRealtimeService.publishNotificationCount(user.user_id, await this.getUnreadCount(user));
+    } catch (error) {
+      console.debug('Failed to publish notification count to Supabase:', error);
+    }
+
     return {
       updatedCount: result.count,
       message: `${result.count} notifications marked as read`
@@ -757,4 +805,64 @@ export const notificationsService = {
       action
     };
   },
+
+  /**
+   * Announce something to the staff covering a property: an in-app notification for each assigned
+   * staff member plus a single push to the property's topic
+   */
+  async createPropertyAnnouncement(user: JWTClaims, propertyId: string, data: { title?: string; message?: string; priority?: string }) {
+    if (!['landlord', 'agency_admin', 'super_admin', 'agent'].includes(user.role)) {
+      throw new Error('Insufficient permissions to announce to property staff');
+    }
+    if (!data.title || !data.message) {
+      throw new Error('title and message are required');
+    }
+    const priority = data.priority || 'medium';
+    if (!['low', 'medium', 'high', 'urgent'].includes(priority)) {
+      throw new Error('priority must be one of: low, medium, high, urgent');
+    }
+
+    const property = await prisma.property.findFirst({
+      where: { id: propertyId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, name: true, company_id: true },
+    });
+    if (!property) {
+      throw new Error('Property not found');
+    }
+
+    const assignments = await prisma.staffPropertyAssignment.findMany({
+      where: { property_id: property.id, status: 'active', staff: { status: 'active' } },
+      select: { staff_id: true },
+    });
+    const recipients = assignments.map(a => a.staff_id).filter(id => id !== user.user_id);
+
+    const created = await prisma.notification.createManyAndReturn({
+      data: recipients.map(recipientId => ({
+        company_id: property.company_id,
+        sender_id: user.user_id,
+        recipient_id: recipientId,
+        title: data.title!,
+        message: data.message!,
+        notification_type: 'announcement',
+        category: 'announcement',
+        priority: priority as 'low' | 'medium' | 'high' | 'urgent',
+        property_id: property.id,
+        channels: ['app', 'push'],
+      })),
+    });
+
+    const pushed = await pushNotificationService.sendToProperty(property.id, {
+      title: `${property.name}: ${data.title}`,
+      body: data.message,
+      notificationType: 'announcement',
+      category: 'announcement',
+      priority: priority === 'high' || priority === 'urgent' ? 'high' : 'normal',
+      data: { property_id: property.id },
+      actionUrl: '/notifications',
+    });
+
+    await Promise.all(created.map(notification => this.publishCreated(notification)));
+
+    return { property_id: property.id, recipients: created.length, pushed };
+  },
 };
@@ -0,0 +1,252 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+
+// Lease statuses that mean the unit was let for the lease's dates
+const LET_STATUSES = ['active', 'expired', 'terminated', 'renewed'];
+const MAX_MONTHS = 60;
+// Roles that can rebuild history; everyone else reads it
+const BACKFILL_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+
+interface MonthFigures {
+  company_id: string;
+  property_id: string;
+  month: Date;
+  total_units: number;
+  occupied_units: number;
+  leased_rent: number;
+}
+
+const monthStart = (date: Date) => new Date(Date.UTC(date.getUTCFullYear(), date.getUTCMonth(), 1));
+// Last day of the month; lease dates are stored as dates, so this compares like-for-like
+const monthEnd = (month: Date) => new Date(Date.UTC(month.getUTCFullYear(), month.getUTCMonth() + 1, 0));
+const monthKey = (month: Date) => month.toISOString().slice(0, 7);
+const round = (n: number) => Math.round(n * 100) / 100;
+const rate = (occupied: number, total: number) => (total > 0 ? round((occupied / total) * 100) : 0);
+
+/**
+ * Month-by-month occupancy per property. The current month is captured live from unit statuses
+ * each day, so the stored row ends up as the month-end figure; earlier months without a snapshot
+ * are derived from lease dates, and can be stored with a backfill.
+ */
+export class OccupancyHistoryService {
+  private prisma = getPrisma();
+
+  /**
+   * Occupancy for the last `months` months (current month included), overall and per property
+   */
+  async getTrend(user: JWTClaims, filters: { months?: number; property_ids?: string[] } = {}) {
+    const count = Math.min(Math.max(Number(filters.months) || 12, 1), MAX_MONTHS);
+    const current = monthStart(new Date());
+    const months = Array.from({ length: count }, (_, i) => new Date(Date.UTC(current.getUTCFullYear(), current.getUTCMonth() - (count - 1 - i), 1)));
+
+    const propertyWhereClause: any = buildWhereClause(user);
+    if (filters.property_ids?.length) {
+      propertyWhereClause.id = { in: filters.property_ids };
+    }
+    const properties = await this.prisma.property.findMany({
+      where: propertyWhereClause,
+      select: { id: true, name: true },
+    });
+    const propertyIds = properties.map(p => p.id);
+
+    const snapshots = propertyIds.length
+      ? await this.prisma.occupancySnapshot.findMany({
+        where: { property_id: { in: propertyIds }, month: { gte: months[0], lt: current } },
+      })
+      : [];
+    const figures = new Map<string, MonthFigures & { source: string }>();
+    for (const s of snapshots) {
+      figures.set(`${s.property_id}|${monthKey(s.month)}`, {
+        company_id: s.company_id,
+        property_id: s.property_id,
+        month: s.month,
+        total_units: s.total_units,
+        occupied_units: s.occupied_units,
+        leased_rent: Number(s.leased_rent),
+        source: s.source,
+      });
+    }
+
+    // Past months nobody captured come from lease dates; this month is live
+    const missing = months.slice(0, -1).filter(month => propertyIds.some(id => !figures.has(`${id}|${monthKey(month)}`)));
+    if (missing.length) {
+      for (const derived of await this.derive({ id: { in: propertyIds } }, missing)) {
+        const key = `${derived.property_id}|${monthKey(derived.month)}`;
+        if (!figures.has(key)) figures.set(key, { ...derived, source: 'derived' });
+      }
+    }
+    for (const live of await this.live({ id: { in: propertyIds } }, current)) {
+      figures.set(`${live.property_id}|${monthKey(current)}`, { ...live, source: 'live' });
+    }
+
+    const sum = (rows: MonthFigures[]) => {
+      const total = rows.reduce((acc, r) => acc + r.total_units, 0);
+      const occupied = rows.reduce((acc, r) => acc + r.occupied_units, 0);
+      return {
+        total_units: total,
+        occupied_units: occupied,
+        vacant_units: total - occupied,
+        occupancy_rate: rate(occupied, total),
+        leased_rent: round(rows.reduce((acc, r) => acc + r.leased_rent, 0)),
+      };
+    };
+    const forMonth = (month: Date, ids: string[]) =>
+      ids.map(id => figures.get(`${id}|${monthKey(month)}`)).filter((f): f is MonthFigures & { source: string } => !!f);
+
+    return {
+      months: months.map(month => ({ month: monthKey(month), ...sum(forMonth(month, propertyIds)) })),
+      byProperty: properties.map(property => ({
+        property_id: property.id,
+        property_name: property.name,
+        months: months.map(month => {
+          const row = figures.get(`${property.id}|${monthKey(month)}`);
+          return {
+            month: monthKey(month),
+            total_units: row?.total_units || 0,
+            occupied_units: row?.occupied_units || 0,
+            occupancy_rate: row ? rate(row.occupied_units, row.total_units) : 0,
+            source: row?.source || null,
+          };
+        }),
+      })),
+    };
+  }
+
+  /**
+   * Scheduled run: store this month's figures for every property, overwriting earlier captures
+   */
+  async captureCurrentMonth(now = new Date()) {
+    const month = monthStart(now);
+    const rows = await this.live({}, month);
+    for (const row of rows) {
+      const data = {
+        total_units: row.total_units,
+        occupied_units: row.occupied_units,
+        occupancy_rate: rate(row.occupied_units, row.total_units),
+        leased_rent: row.leased_rent,
+        source: 'snapshot',
+        updated_at: new Date(),
+      };
+      await this.prisma.occupancySnapshot.upsert({
+        where: { property_id_month: { property_id: row.property_id, month } },
+        update: data,
+        create: { ...data, company_id: row.company_id, property_id: row.property_id, month },
+      });
+    }
+    return { captured: rows.length };
+  }
+
+  /**
+   * Store lease-derived figures for past months that have no snapshot; captured months are kept
+   */
+  async backfill(user: JWTClaims, months: number = 24) {
+    if (!BACKFILL_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to rebuild occupancy history');
+    }
+    const count = Math.min(Math.max(Number(months) || 24, 1), MAX_MONTHS);
+    const current = monthStart(new Date());
+    const past = Array.from({ length: count }, (_, i) => new Date(Date.UTC(current.getUTCFullYear(), current.getUTCMonth() - count + i, 1)));
+
+    const rows = await this.derive(buildWhereClause(user), past);
+    const result = await this.prisma.occupancySnapshot.createMany({
+      data: rows.map(row => ({
+        ...row,
+        occupancy_rate: rate(row.occupied_units, row.total_units),
+        source: 'backfill',
+      })),
+      skipDuplicates: true,
+    });
+    return { months: count, properties: new Set(rows.map(r => r.property_id)).size, created: result.count };
+  }
+
+  /**
+   * Current figures from unit statuses and the rent on active leases
+   */
+  private async live(propertyWhere: any, month: Date): Promise<MonthFigures[]> {
+    const [units, leases] = await Promise.all([
+      this.prisma.unit.groupBy({
+        by: ['property_id', 'status'],
+        where: { property: propertyWhere },
+        _count: { _all: true },
+      }),
+      this.prisma.lease.groupBy({
+        by: ['property_id'],
+        where: { status: 'active', property: propertyWhere },
+        _sum: { rent_amount: true },
+      }),
+    ]);
+    const properties = await this.prisma.property.findMany({
+      where: { id: { in: [...new Set(units.map(u => u.property_id))] } },
+      select: { id: true, company_id: true },
+    });
+    const rent = new Map(leases.map(l => [l.property_id, Number(l._sum.rent_amount || 0)]));
+
+    return properties.map(property => {
+      const statuses = units.filter(u => u.property_id === property.id);
+      return {
+        company_id: property.company_id,
+        property_id: property.id,
+        month,
+        total_units: statuses.reduce((acc, u) => acc + u._count._all, 0),
+        occupied_units: statuses.filter(u => u.status === 'occupied').reduce((acc, u) => acc + u._count._all, 0),
+        leased_rent: round(rent.get(property.id) || 0),
+      };
+    });
+  }
+
+  /**
+   * Month-end figures from lease dates: a unit counts once it exists, and is occupied when a lease
+   * had started and had not ended, been moved out of or terminated by the last day of the month
+   */
+  private async derive(propertyWhere: any, months: Date[]): Promise<MonthFigures[]> {
+    if (!months.length) return [];
+    const lastDay = monthEnd(months[months.length - 1]);
+    const units = await this.prisma.unit.findMany({
+      where: { property: propertyWhere, created_at: { lte: new Date(lastDay.getTime() + 24 * 60 * 60 * 1000) } },
+      select: { id: true, property_id: true, created_at: true, property: { select: { company_id: true } } },
+    });
+    const leases = units.length
+      ? await this.prisma.lease.findMany({
+        where: { unit_id: { in: units.map(u => u.id) }, status: { in: LET_STATUSES as any }, start_date: { lte: lastDay } },
+        select: { unit_id: true, status: true, start_date: true, end_date: true, move_out_date: true, terminated_at: true, rent_amount: true },
+      })
+      : [];
+    const leasesByUnit = new Map<string, typeof leases>();
+    for (const lease of leases) {
+      leasesByUnit.set(lease.unit_id, [...(leasesByUnit.get(lease.unit_id) || []), lease]);
+    }
+
+    const rows = new Map<string, MonthFigures>();
+    for (const month of months) {
+      const end = monthEnd(month);
+      for (const unit of units) {
+        if (monthStart(unit.created_at) > month) continue;
+        const key = `${unit.property_id}|${monthKey(month)}`;
+        const row = rows.get(key) || {
+          company_id: unit.property.company_id,
+          property_id: unit.property_id,
+          month,
+          total_units: 0,
+          occupied_units: 0,
+          leased_rent: 0,
+        };
+        row.total_units++;
+        const lease = (leasesByUnit.get(unit.id) || []).find(l =>
+          l.start_date <= end
+          && (!l.move_out_date || l.move_out_date > end)
+          && (!l.terminated_at || l.terminated_at > end)
+          // Leases still active past their end date are running month-to-month
+          && (l.end_date >= end || l.status === 'active'));
+        if (lease) {
+          row.occupied_units++;
+          row.leased_rent += Number(lease.rent_amount);
+        }
+        rows.set(key, row);
+      }
+    }
+    return [...rows.values()].map(row => ({ ...row, leased_rent: round(row.leased_rent) }));
+  }
+}
+
+export const occupancyHistoryService = new OccupancyHistoryService();
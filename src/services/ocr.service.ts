@@ -0,0 +1,89 @@
+import axios from 'axios';
+import { env } from '../config/env.js';
+
+export interface IdDocumentFields {
+  document_type: 'national_id' | 'passport' | 'other' | null;
+  full_name: string | null;
+  first_name: string | null;
+  last_name: string | null;
+  id_number: string | null;
+  date_of_birth: string | null; // YYYY-MM-DD
+  nationality: string | null;
+  expiry_date: string | null; // YYYY-MM-DD
+}
+
+const ID_EXTRACTION_PROMPT = `You are reading a photo of a government identity document (national ID card or passport).
+Return ONLY a JSON object with these keys: document_type ("national_id", "passport" or "other"), full_name, first_name,
+last_name, id_number (the national ID or passport number), date_of_birth (YYYY-MM-DD), nationality, expiry_date (YYYY-MM-DD).
+Use null for anything you cannot read with confidence. Do not guess.`;
+
+/**
+ * OCR for uploaded documents, backed by an OpenAI-compatible vision model (OCR_API_URL / OCR_API_KEY / OCR_MODEL)
+ */
+export class OcrService {
+  isConfigured(): boolean {
+    return !!env.ocr.apiKey;
+  }
+
+  /**
+   * Extract identity fields from an ID card or passport image
+   */
+  async extractIdDocument(image: Buffer, mimeType: string): Promise<IdDocumentFields> {
+    if (!this.isConfigured()) {
+      throw new Error('OCR service is not configured');
+    }
+    if (!mimeType.startsWith('image/')) {
+      throw new Error('only image documents can be read by OCR');
+    }
+
+    const response = await axios.post(
+      env.ocr.apiUrl,
+      {
+        model: env.ocr.model,
+        temperature: 0,
+        response_format: { type: 'json_object' },
+        messages: [
+          {
+            role: 'user',
+            content: [
+              { type: 'text', text: ID_EXTRACTION_PROMPT },
+              { type: 'image_url', image_url: { url: `data:${mimeType};base64,${image.toString('base64')}` } },
+            ],
+          },
+        ],
+      },
+      {
+        headers: { Authorization: `Bearer ${env.ocr.apiKey}`, 'Content-Type': 'application/json' },
+        timeout: 60000,
+      }
+    );
+
+    const content = response.data?.choices?.[0]?.message?.content;
+    if (!content) {
+      throw new Error('OCR service returned an empty response');
+    }
+
+    let parsed: any;
+    try {
+      parsed = JSON.parse(content);
+    } catch {
+      throw new Error('OCR service returned an unreadable response');
+    }
+
+    const text = (value: any) => (typeof value === 'string' && value.trim() ? value.trim() : null);
+    const date = (value: any) => (typeof value === 'string' && /^\d{4}-\d{2}-\d{2}$/.test(value.trim()) ? value.trim() : null);
+
+    return {
+      document_type: ['national_id', 'passport', 'other'].includes(parsed.document_type) ? parsed.document_type : null,
+      full_name: text(parsed.full_name),
+      first_name: text(parsed.first_name),
+      last_name: text(parsed.last_name),
+      id_number: text(parsed.id_number),
+      date_of_birth: date(parsed.date_of_birth),
+      nationality: text(parsed.nationality),
+      expiry_date: date(parsed.expiry_date),
+    };
+  }
+}
+
+export const ocrService = new OcrService();
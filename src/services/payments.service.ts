@@ -4,6 +4,11 @@ import { buildWhereClause } from '../utils/roleBasedFiltering.js';
 import { UnitActivityService } from './unit-activity.service.js';
 import { UsersService } from './users.service.js';
 import { getNextReceiptNumber } from '../utils/invoice-number-generator.js';
+import { buildExcelWorkbook, sheetToCsv, summarySheet, ExcelSheet } from '../utils/excel-export.js';
+
+// Exports page through the list query and stop here
+const EXPORT_PAGE_SIZE = 500;
+const EXPORT_MAX_ROWS = 10000;
 
 export interface CreatePaymentRequest {
   tenant_id: string;
@@ -12,6 +17,8 @@ export interface CreatePaymentRequest {
   lease_id?: string;
   invoice_id?: string;
   amount: number;
+  withholding_tax?: number;
+  withholding_certificate?: string;
   currency?: string;
   payment_method: 'cash' | 'mpesa' | 'bank_transfer' | 'cheque' | 'mobile_money' | 'card' | 'online';
   payment_type: 'rent' | 'security_deposit' | 'utility' | 'maintenance' | 'late_fee' | 'penalty' | 'other';
@@ -29,6 +36,8 @@ export interface CreatePaymentRequest {
 
 export interface UpdatePaymentRequest {
   amount?: number;
+  withholding_tax?: number;
+  withholding_certificate?: string;
   payment_method?: 'cash' | 'mpesa' | 'bank_transfer' | 'cheque' | 'mobile_money' | 'card' | 'online';
   payment_type?: 'rent' | 'security_deposit' | 'utility' | 'maintenance' | 'late_fee' | 'penalty' | 'other';
   payment_date?: string;
@@ -299,6 +308,10 @@ export class PaymentsService {
       throw new Error('insufficient permissions to create payment for this tenant');
     }
 
+    if (data.withholding_tax !== undefined && (!Number.isFinite(Number(data.withholding_tax)) || Number(data.withholding_tax) < 0)) {
+      throw new Error('withholding_tax must be an amount of zero or more');
+    }
+
     const preferences = await this.usersService.getCurrentUserPreferences(user);
     const defaultCurrency = preferences?.default_currency || 'KES';
 
@@ -317,6 +330,8 @@ export class PaymentsService {
         lease_id: data.lease_id,
         invoice_id: data.invoice_id,
         amount: data.amount,
+        withholding_tax: data.withholding_tax || 0,
+        withholding_certificate: data.withholding_certificate,
         currency: data.currency || defaultCurrency,
         payment_method: data.payment_method as any,
         payment_type: data.payment_type as any,
@@ -421,6 +436,9 @@ export class PaymentsService {
     if (!['super_admin', 'agency_admin', 'landlord', 'agent'].includes(user.role)) {
       throw new Error('insufficient permissions to update payments');
     }
+    if (data.withholding_tax !== undefined && (!Number.isFinite(Number(data.withholding_tax)) || Number(data.withholding_tax) < 0)) {
+      throw new Error('withholding_tax must be an amount of zero or more');
+    }
 
     // Update payment
     const payment = await this.prisma.payment.update({
@@ -830,6 +848,70 @@ export class PaymentsService {
     });
   }
 
+  /**
+   * Payments matching the list filters as CSV, or as an Excel workbook with a summary sheet
+   */
+  async exportPayments(filters: PaymentFilters, user: JWTClaims, format: string): Promise<string | Buffer> {
+    if (!['csv', 'xlsx', 'excel'].includes(format)) {
+      throw new Error('format must be csv or xlsx');
+    }
+    const payments: any[] = [];
+    for (let page = 1; payments.length < EXPORT_MAX_ROWS; page++) {
+      const result = await this.listPayments(filters, user, page, EXPORT_PAGE_SIZE);
+      payments.push(...result.payments);
+      if (page >= result.totalPages) break;
+    }
+
+    const details: ExcelSheet = {
+      name: 'Payments',
+      columns: [
+        'Receipt Number', { header: 'Payment Date', type: 'date' }, 'Tenant', 'Tenant Email', 'Property', 'Unit',
+        { header: 'Amount', type: 'currency' }, 'Currency', 'Method', 'Type', 'Status', 'Reference', 'Lease',
+      ],
+      rows: payments.map(p => [
+        p.receipt_number,
+        p.payment_date,
+        p.tenant ? `${p.tenant.first_name} ${p.tenant.last_name}`.trim() : '',
+        p.tenant?.email || '',
+        p.property?.name || p.unit?.property?.name || '',
+        p.unit?.unit_number || '',
+        Number(p.amount),
+        p.currency,
+        p.payment_method,
+        p.payment_type,
+        p.status,
+        p.reference_number || '',
+        p.lease?.lease_number || '',
+      ]),
+    };
+    if (format === 'csv') {
+      return sheetToCsv(details);
+    }
+
+    const totals = (key: 'status' | 'payment_method') => {
+      const groups = new Map<string, { count: number; amount: number }>();
+      for (const p of payments) {
+        const group = groups.get(p[key]) || { count: 0, amount: 0 };
+        group.count++;
+        group.amount += Number(p.amount);
+        groups.set(p[key], group);
+      }
+      return [...groups.entries()].map(([label, g]) => [label, g.count, Math.round(g.amount * 100) / 100]);
+    };
+    return buildExcelWorkbook([
+      summarySheet('Summary', [
+        ['Payments', payments.length],
+        ['Total Amount', Math.round(payments.reduce((sum, p) => sum + Number(p.amount), 0) * 100) / 100],
+        ['From', filters.start_date || ''],
+        ['To', filters.end_date || ''],
+        ['Generated', new Date()],
+      ]),
+      { name: 'By Status', columns: ['Status', { header: 'Payments', type: 'integer' }, { header: 'Amount', type: 'currency' }], rows: totals('status') },
+      { name: 'By Method', columns: ['Method', { header: 'Payments', type: 'integer' }, { header: 'Amount', type: 'currency' }], rows: totals('payment_method') },
+      details,
+    ]);
+  }
+
   private hasPaymentAccess(payment: any, user: JWTClaims): boolean {
     // Super admin has access to all payments
     if (user.role === 'super_admin') return true;
@@ -471,6 +471,81 @@ export class PaystackService {
     }
   }
 
+  /**
+   * Verify a charge made to add a payment method and return the authorization it left on file
+   */
+  async verifyPaymentMethod(reference: string) {
+    const response = await this.makeRequest('GET', `/transaction/verify/${reference}`);
+    const transaction = response.data;
+    if (!response.status || !transaction || transaction.status !== 'success') {
+      throw new Error('payment method verification failed');
+    }
+    if (!transaction.authorization?.reusable) {
+      throw new Error('payment method cannot be charged again; use a card or mobile money account');
+    }
+    return {
+      channel: transaction.authorization.channel || transaction.channel || null,
+      brand: transaction.authorization.brand || null,
+      last4: transaction.authorization.last4 || null,
+      reference: transaction.reference,
+      authorization_code: transaction.authorization.authorization_code || null,
+      email: transaction.customer?.email || null,
+    };
+  }
+
+  /**
+   * Where a platform invoice charge stands with Paystack: success, failed, abandoned, or still
+   * waiting on the customer (pending, ongoing, send_otp)
+   */
+  async verifyCharge(reference: string) {
+    const response = await this.makeRequest('GET', `/transaction/verify/${encodeURIComponent(reference)}`);
+    return {
+      status: (response.data?.status as string) || 'pending',
+      reference: (response.data?.reference as string) || reference,
+      paid_at: (response.data?.paid_at as string) || null,
+    };
+  }
+
+  /**
+   * Charge a saved authorization (card or reusable mobile money) for a platform invoice. Amounts
+   * are in KES; Paystack takes the smallest unit.
+   */
+  async chargeAuthorization(request: { email: string; authorization_code: string; amount: number; reference: string; metadata?: Record<string, any> }) {
+    const response = await this.makeRequest('POST', '/transaction/charge_authorization', {
+      email: request.email,
+      authorization_code: request.authorization_code,
+      amount: Math.round(request.amount * 100),
+      currency: 'KES',
+      reference: request.reference,
+      metadata: request.metadata,
+    });
+    return {
+      status: response.data?.status as string,
+      reference: (response.data?.reference as string) || request.reference,
+      message: (response.data?.gateway_response as string) || response.message,
+    };
+  }
+
+  /**
+   * Prompt an M-Pesa number to pay a platform invoice. The customer approves on the phone, so
+   * the result arrives later as a charge.success webhook.
+   */
+  async chargeMobileMoney(request: { email: string; phone: string; amount: number; reference: string; metadata?: Record<string, any> }) {
+    const response = await this.makeRequest('POST', '/charge', {
+      email: request.email,
+      amount: Math.round(request.amount * 100),
+      currency: 'KES',
+      reference: request.reference,
+      mobile_money: { phone: request.phone, provider: 'mpesa' },
+      metadata: request.metadata,
+    });
+    return {
+      status: response.data?.status as string,
+      reference: (response.data?.reference as string) || request.reference,
+      message: (response.data?.display_text as string) || (response.data?.gateway_response as string) || response.message,
+    };
+  }
+
   /**
    * Handle Paystack webhook
    */
@@ -494,6 +569,17 @@ export class PaystackService {
         case 'invoice.update':
           await this.handleInvoiceUpdated(event.data);
           break;
+        case 'charge.success':
+          // Platform invoices we charged ourselves carry their id in the metadata
+          if (event.data?.metadata?.billing_invoice_id) {
+            const { subscriptionBillingService } = await import('./subscription-billing.service.js');
+            await subscriptionBillingService.recordPayment(event.data.metadata.billing_invoice_id, {
+              reference: event.data.reference,
+              paid_at: event.data.paid_at,
+              channel: event.data.channel,
+            });
+          }
+          break;
         default:
           console.log('🔄 Unhandled webhook event:', event.event);
       }
@@ -523,6 +609,18 @@ export class PaystackService {
           },
         },
       });
+
+      if (data.authorization?.reusable) {
+        const { trialsService } = await import('./trials.service.js');
+        await trialsService.recordPaymentMethod(subscription.company_id, {
+          channel: data.authorization.channel,
+          brand: data.authorization.brand,
+          last4: data.authorization.last4,
+          reference: data.subscription_code,
+          authorization_code: data.authorization.authorization_code,
+          email: data.customer?.email,
+        });
+      }
     }
   }
 
@@ -0,0 +1,143 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export const PLAN_RESOURCES = ['properties', 'units', 'users'] as const;
+export type PlanResource = typeof PLAN_RESOURCES[number];
+
+interface PlanDefinition {
+  name: string;
+  monthly_price: number;
+  // null is unlimited
+  limits: Record<PlanResource, number | null>;
+}
+
+/**
+ * What each plan allows. Users are a company's staff (admins, agents, caretakers and the like);
+ * tenants and landlords don't count against the plan.
+ */
+export const PLANS: Record<string, PlanDefinition> = {
+  starter: { name: 'Starter', monthly_price: 2500, limits: { properties: 5, units: 50, users: 5 } },
+  professional: { name: 'Professional', monthly_price: 5000, limits: { properties: 20, units: 200, users: 25 } },
+  enterprise: { name: 'Enterprise', monthly_price: 12000, limits: { properties: null, units: null, users: null } },
+};
+const PLAN_ORDER = ['starter', 'professional', 'enterprise'];
+const UNCOUNTED_ROLES = ['tenant', 'landlord', 'super_admin'];
+const USAGE_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+
+/**
+ * Raised when a create would take a company past its plan; carries what the client needs to offer
+ * an upgrade
+ */
+export class PlanLimitError extends Error {
+  constructor(
+    public resource: PlanResource,
+    public plan: string,
+    public limit: number,
+    public usage: number,
+    public requested: number,
+    public upgrade: { plan: string; name: string; monthly_price: number; limit: number | null } | null,
+  ) {
+    super(`plan limit reached: the ${PLANS[plan].name} plan allows ${limit} ${resource}`);
+  }
+}
+
+export class PlanLimitsService {
+  private prisma = getPrisma();
+
+  /**
+   * The plan in force: the latest active or trial subscription's, then the plan recorded on the
+   * company, then Starter
+   */
+  async planFor(companyId: string) {
+    const [subscription, company] = await Promise.all([
+      this.prisma.subscription.findFirst({
+        where: { company_id: companyId, status: { in: ['active', 'trial'] } },
+        orderBy: { created_at: 'desc' },
+        select: { plan: true, status: true },
+      }),
+      this.prisma.company.findUnique({ where: { id: companyId }, select: { subscription_plan: true } }),
+    ]);
+    const plan = subscription?.plan || (company?.subscription_plan && PLANS[company.subscription_plan] ? company.subscription_plan : 'starter');
+    return { plan, subscription_status: subscription?.status || null };
+  }
+
+  async countUsage(companyId: string): Promise<Record<PlanResource, number>> {
+    const [properties, units, users] = await Promise.all([
+      // Archived properties (inactive) free their slot
+      this.prisma.property.count({ where: { company_id: companyId, status: { not: 'inactive' } } }),
+      this.prisma.unit.count({ where: { property: { company_id: companyId, status: { not: 'inactive' } } } }),
+      this.prisma.user.count({
+        where: { company_id: companyId, role: { notIn: UNCOUNTED_ROLES as any }, status: { notIn: ['inactive', 'suspended'] } },
+      }),
+    ]);
+    return { properties, units, users };
+  }
+
+  async getUsage(companyId: string) {
+    const [{ plan, subscription_status }, usage] = await Promise.all([this.planFor(companyId), this.countUsage(companyId)]);
+    const limits = PLANS[plan].limits;
+    return {
+      company_id: companyId,
+      plan,
+      plan_name: PLANS[plan].name,
+      subscription_status,
+      resources: PLAN_RESOURCES.map(resource => ({
+        resource,
+        usage: usage[resource],
+        limit: limits[resource],
+        remaining: limits[resource] === null ? null : Math.max(0, limits[resource]! - usage[resource]),
+        at_limit: limits[resource] !== null && usage[resource] >= limits[resource]!,
+      })),
+      upgrade: this.upgradeFrom(plan),
+    };
+  }
+
+  /**
+   * Usage against limits for the caller's company, or for any agency's (or company's) as a super admin
+   */
+  async getUsageFor(user: JWTClaims, target: { agency_id?: string; company_id?: string } = {}) {
+    if (!USAGE_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view plan usage');
+    }
+    let companyId = user.company_id;
+    if (user.role === 'super_admin' && target.agency_id) {
+      const agency = await this.prisma.agency.findUnique({ where: { id: target.agency_id }, select: { company_id: true } });
+      if (!agency) throw new Error('agency not found');
+      companyId = agency.company_id;
+    } else if (user.role === 'super_admin' && target.company_id) {
+      companyId = target.company_id;
+    }
+    if (!companyId) {
+      throw new Error('company_id is required');
+    }
+    return this.getUsage(companyId);
+  }
+
+  /**
+   * Throw a PlanLimitError if adding `count` of a resource would go past the company's plan
+   */
+  async check(companyId: string, resource: PlanResource, count = 1) {
+    const { plan } = await this.planFor(companyId);
+    const limit = PLANS[plan].limits[resource];
+    if (limit === null || count <= 0) return;
+    const usage = (await this.countUsage(companyId))[resource];
+    if (usage + count > limit) {
+      const upgrade = this.upgradeFrom(plan);
+      throw new PlanLimitError(
+        resource,
+        plan,
+        limit,
+        usage,
+        count,
+        upgrade && { plan: upgrade.plan, name: upgrade.name, monthly_price: upgrade.monthly_price, limit: upgrade.limits[resource] },
+      );
+    }
+  }
+
+  private upgradeFrom(plan: string) {
+    const next = PLAN_ORDER[PLAN_ORDER.indexOf(plan) + 1];
+    return next ? { plan: next, ...PLANS[next] } : null;
+  }
+}
+
+export const planLimitsService = new PlanLimitsService();
@@ -0,0 +1,348 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface PlatformAnnouncementInput {
+  title?: string;
+  message?: string;
+  type?: string;
+  severity?: string;
+  target_plans?: string[];
+  target_roles?: string[];
+  target_regions?: string[];
+  dismissible?: boolean;
+  send_email?: boolean;
+  action_url?: string | null;
+  starts_at?: string | null;
+  ends_at?: string | null;
+}
+
+const TYPES = ['release_notes', 'maintenance', 'policy_update'];
+const SEVERITIES = ['info', 'warning', 'critical'];
+const PLANS = ['starter', 'professional', 'enterprise'];
+// Platform announcements are for the people running agencies and landlord accounts, not tenants
+export const AUDIENCE_ROLES = ['agency_admin', 'landlord', 'agent', 'caretaker', 'accountant', 'manager'];
+// A company's plan is that of its current subscription
+const CURRENT_SUBSCRIPTION_STATUSES = ['active', 'trial'];
+// Recipients emailed concurrently on publish
+const SEND_CONCURRENCY = 20;
+
+const parseDate = (value: string | null | undefined, field: string) => {
+  if (!value) return null;
+  const date = new Date(value);
+  if (isNaN(date.getTime())) {
+    throw new Error(`${field} must be a valid date`);
+  }
+  return date;
+};
+
+const parseList = (value: unknown, field: string, allowed?: string[]) => {
+  if (value === undefined || value === null) return [];
+  if (!Array.isArray(value) || value.some(item => typeof item !== 'string')) {
+    throw new Error(`${field} must be a list`);
+  }
+  const items = [...new Set(value.map(item => item.trim()).filter(Boolean))];
+  const unknown = allowed ? items.filter(item => !allowed.includes(item)) : [];
+  if (unknown.length) {
+    throw new Error(`${field} must only contain: ${allowed!.join(', ')}`);
+  }
+  return items;
+};
+
+type Announcement = Awaited<ReturnType<PlatformAnnouncementsService['findAnnouncement']>>;
+
+/**
+ * Announcements from the platform to agencies and landlords: release notes, maintenance windows
+ * and policy updates. Super admins draft and publish them targeted by plan, role and region;
+ * matching users see them as banners until they end or the user dismisses them, and can be
+ * emailed once on publish.
+ */
+export class PlatformAnnouncementsService {
+  private prisma = getPrisma();
+
+  async create(input: PlatformAnnouncementInput, user: JWTClaims) {
+    if (!input.title?.trim() || !input.message?.trim()) {
+      throw new Error('title and message are required');
+    }
+    const data = this.validate(input);
+    return this.prisma.platformAnnouncement.create({
+      data: {
+        title: input.title.trim(),
+        message: input.message.trim(),
+        type: data.type || 'release_notes',
+        severity: data.severity || 'info',
+        target_plans: data.target_plans || [],
+        target_roles: data.target_roles || [],
+        target_regions: data.target_regions || [],
+        dismissible: data.dismissible ?? true,
+        send_email: data.send_email ?? false,
+        action_url: data.action_url ?? null,
+        starts_at: data.starts_at ?? null,
+        ends_at: data.ends_at ?? null,
+        created_by: user.user_id,
+      },
+    });
+  }
+
+  /**
+   * Edit a draft or a published announcement. Retargeting a published one changes who sees the
+   * banner but does not email anyone again.
+   */
+  async update(id: string, input: PlatformAnnouncementInput, user: JWTClaims) {
+    const announcement = await this.findAnnouncement(id);
+    if (announcement.status === 'archived') {
+      throw new Error('archived announcements cannot be edited');
+    }
+    if (input.title !== undefined && !input.title.trim()) {
+      throw new Error('title must not be empty');
+    }
+    if (input.message !== undefined && !input.message.trim()) {
+      throw new Error('message must not be empty');
+    }
+    const data = this.validate(input, announcement);
+    return this.prisma.platformAnnouncement.update({
+      where: { id },
+      data: {
+        ...data,
+        ...(input.title !== undefined && { title: input.title.trim() }),
+        ...(input.message !== undefined && { message: input.message.trim() }),
+        updated_by: user.user_id,
+        updated_at: new Date(),
+      },
+    });
+  }
+
+  /**
+   * Put a draft live. Its banner shows from starts_at (or now); if send_email is set every
+   * matching user is emailed once.
+   */
+  async publish(id: string, user: JWTClaims) {
+    const announcement = await this.findAnnouncement(id);
+    if (announcement.status !== 'draft') {
+      throw new Error(`only draft announcements can be published; this one is ${announcement.status}`);
+    }
+    const now = new Date();
+    const published = await this.prisma.platformAnnouncement.update({
+      where: { id },
+      data: { status: 'published', published_at: now, updated_by: user.user_id, updated_at: now },
+    });
+    if (!published.send_email) {
+      return { ...published, emailed: 0 };
+    }
+
+    const emailed = await this.email(published);
+    const updated = await this.prisma.platformAnnouncement.update({
+      where: { id },
+      data: { emailed_at: new Date(), emailed_count: emailed },
+    });
+    console.log(`📣 Platform announcement ${id} published and emailed to ${emailed} users`);
+    return { ...updated, emailed };
+  }
+
+  /**
+   * Take an announcement down; its banner stops showing at once
+   */
+  async archive(id: string, user: JWTClaims) {
+    const announcement = await this.findAnnouncement(id);
+    if (announcement.status === 'archived') {
+      throw new Error('announcement is already archived');
+    }
+    return this.prisma.platformAnnouncement.update({
+      where: { id },
+      data: { status: 'archived', updated_by: user.user_id, updated_at: new Date() },
+    });
+  }
+
+  async list(filters: { status?: string; type?: string; page?: number; limit?: number } = {}) {
+    const where: any = {};
+    if (filters.status) where.status = filters.status;
+    if (filters.type) where.type = filters.type;
+    const page = Math.max(filters.page || 1, 1);
+    const limit = Math.min(Math.max(filters.limit || 50, 1), 200);
+    const [announcements, total] = await Promise.all([
+      this.prisma.platformAnnouncement.findMany({
+        where,
+        include: { _count: { select: { dismissals: true } } },
+        orderBy: { created_at: 'desc' },
+        take: limit,
+        skip: (page - 1) * limit,
+      }),
+      this.prisma.platformAnnouncement.count({ where }),
+    ]);
+    return {
+      announcements: announcements.map(({ _count, ...announcement }) => ({ ...announcement, dismissed_count: _count.dismissals })),
+      total,
+      page,
+      limit,
+      pages: Math.ceil(total / limit),
+    };
+  }
+
+  async get(id: string) {
+    const announcement = await this.findAnnouncement(id);
+    const [dismissed, audience] = await Promise.all([
+      this.prisma.platformAnnouncementDismissal.count({ where: { announcement_id: id } }),
+      this.prisma.user.count({ where: this.audienceWhere(announcement) }),
+    ]);
+    return { ...announcement, dismissed_count: dismissed, audience_count: audience };
+  }
+
+  /**
+   * The banners to show a user now: published, inside their window, aimed at the user's role,
+   * plan and region, and not dismissed. Critical ones first.
+   */
+  async activeFor(user: JWTClaims) {
+    if (!AUDIENCE_ROLES.includes(user.role) || !user.company_id) {
+      return [];
+    }
+    const now = new Date();
+    const [announcements, company, subscription] = await Promise.all([
+      this.prisma.platformAnnouncement.findMany({
+        where: {
+          status: 'published',
+          AND: [
+            { OR: [{ starts_at: null }, { starts_at: { lte: now } }] },
+            { OR: [{ ends_at: null }, { ends_at: { gt: now } }] },
+          ],
+          NOT: { dismissals: { some: { user_id: user.user_id } } },
+        },
+        orderBy: { published_at: 'desc' },
+      }),
+      this.prisma.company.findUnique({ where: { id: user.company_id }, select: { region: true } }),
+      this.prisma.subscription.findFirst({
+        where: { company_id: user.company_id, status: { in: CURRENT_SUBSCRIPTION_STATUSES as any } },
+        orderBy: { created_at: 'desc' },
+        select: { plan: true },
+      }),
+    ]);
+
+    const region = company?.region?.trim().toLowerCase() || null;
+    const plan = subscription?.plan || null;
+    return announcements
+      .filter(announcement =>
+        (announcement.target_roles.length === 0 || announcement.target_roles.includes(user.role)) &&
+        (announcement.target_plans.length === 0 || (!!plan && announcement.target_plans.includes(plan))) &&
+        (announcement.target_regions.length === 0 || (!!region && announcement.target_regions.some(target => target.toLowerCase() === region))))
+      .sort((a, b) => SEVERITIES.indexOf(b.severity) - SEVERITIES.indexOf(a.severity))
+      .map(({ created_by, updated_by, send_email, emailed_at, emailed_count, target_plans, target_roles, target_regions, ...banner }) => banner);
+  }
+
+  async dismiss(id: string, user: JWTClaims) {
+    const announcement = await this.findAnnouncement(id);
+    if (announcement.status !== 'published') {
+      throw new Error('announcement not found');
+    }
+    if (!announcement.dismissible) {
+      throw new Error('this announcement cannot be dismissed');
+    }
+    return this.prisma.platformAnnouncementDismissal.upsert({
+      where: { announcement_id_user_id: { announcement_id: id, user_id: user.user_id } },
+      create: { announcement_id: id, user_id: user.user_id },
+      update: {},
+    });
+  }
+
+  private validate(input: PlatformAnnouncementInput, existing?: Announcement) {
+    const data: Record<string, any> = {};
+    if (input.type !== undefined) {
+      if (!TYPES.includes(input.type)) {
+        throw new Error(`type must be one of: ${TYPES.join(', ')}`);
+      }
+      data.type = input.type;
+    }
+    if (input.severity !== undefined) {
+      if (!SEVERITIES.includes(input.severity)) {
+        throw new Error(`severity must be one of: ${SEVERITIES.join(', ')}`);
+      }
+      data.severity = input.severity;
+    }
+    if (input.target_plans !== undefined) data.target_plans = parseList(input.target_plans, 'target_plans', PLANS);
+    if (input.target_roles !== undefined) data.target_roles = parseList(input.target_roles, 'target_roles', AUDIENCE_ROLES);
+    if (input.target_regions !== undefined) data.target_regions = parseList(input.target_regions, 'target_regions');
+    if (input.dismissible !== undefined) data.dismissible = !!input.dismissible;
+    if (input.send_email !== undefined) data.send_email = !!input.send_email;
+    if (input.action_url !== undefined) data.action_url = input.action_url?.trim() || null;
+    if (input.starts_at !== undefined) data.starts_at = parseDate(input.starts_at, 'starts_at');
+    if (input.ends_at !== undefined) data.ends_at = parseDate(input.ends_at, 'ends_at');
+
+    const startsAt = data.starts_at !== undefined ? data.starts_at : existing?.starts_at ?? null;
+    const endsAt = data.ends_at !== undefined ? data.ends_at : existing?.ends_at ?? null;
+    if (startsAt && endsAt && endsAt <= startsAt) {
+      throw new Error('ends_at must be after starts_at');
+    }
+    return data;
+  }
+
+  /**
+   * Active users the announcement is aimed at, as a user filter
+   */
+  private audienceWhere(announcement: Announcement) {
+    const company: any = {};
+    if (announcement.target_regions.length) {
+      company.OR = announcement.target_regions.map(region => ({ region: { equals: region, mode: 'insensitive' } }));
+    }
+    if (announcement.target_plans.length) {
+      company.subscriptions = {
+        some: { plan: { in: announcement.target_plans as any }, status: { in: CURRENT_SUBSCRIPTION_STATUSES as any } },
+      };
+    }
+    return {
+      role: { in: (announcement.target_roles.length ? announcement.target_roles : AUDIENCE_ROLES) as any },
+      status: 'active' as const,
+      company_id: { not: null },
+      ...(Object.keys(company).length && { company }),
+    };
+  }
+
+  /**
+   * Email every matching user who accepts email for platform announcements; returns how many
+   * were sent
+   */
+  private async email(announcement: Announcement) {
+    const recipients = await this.prisma.user.findMany({
+      where: { ...this.audienceWhere(announcement), email: { not: null } },
+      select: { id: true, email: true, first_name: true },
+    });
+    const { notificationsService } = await import('./notifications.service.js');
+    const { emailTemplatesService } = await import('./email-templates.service.js');
+    const priority = announcement.severity === 'critical' ? 'urgent' : announcement.severity === 'warning' ? 'high' : 'medium';
+    // Planned maintenance shows when the platform will be unavailable
+    const window = announcement.type === 'maintenance' && announcement.starts_at ? announcement : null;
+
+    let sent = 0;
+    for (let i = 0; i < recipients.length; i += SEND_CONCURRENCY) {
+      const results = await Promise.all(recipients.slice(i, i + SEND_CONCURRENCY).map(async recipient => {
+        try {
+          const channels = await notificationsService.resolveChannels(recipient.id, 'platform_announcement', ['email'], 'general', priority);
+          if (!channels.includes('email')) return false;
+          const result = await emailTemplatesService.send('platform_announcement', {
+            to: recipient.email!,
+            recipientId: recipient.id,
+            variables: {
+              recipient_name: recipient.first_name,
+              title: announcement.title,
+              message: announcement.message,
+              starts_at: window?.starts_at?.toUTCString(),
+              ends_at: window?.ends_at?.toUTCString(),
+            },
+          });
+          return result.success;
+        } catch (error: any) {
+          console.error(`⚠️ Failed to email platform announcement ${announcement.id} to ${recipient.id}:`, error.message);
+          return false;
+        }
+      }));
+      sent += results.filter(Boolean).length;
+    }
+    return sent;
+  }
+
+  private async findAnnouncement(id: string) {
+    const announcement = await this.prisma.platformAnnouncement.findUnique({ where: { id } });
+    if (!announcement) {
+      throw new Error('announcement not found');
+    }
+    return announcement;
+  }
+}
+
+export const platformAnnouncementsService = new PlatformAnnouncementsService();
@@ -0,0 +1,176 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+
+type MetricKey = 'occupancy_rate' | 'rent_per_sqm' | 'arrears_rate' | 'maintenance_cost_per_unit';
+
+interface PropertyFigures {
+  property_id: string;
+  company_id: string;
+  units: number;
+  occupied: number;
+  sized_rent: number;
+  square_meters: number;
+  invoiced: number;
+  in_arrears: number;
+  maintenance_cost: number;
+}
+
+// Which way is better for each metric
+const HIGHER_IS_BETTER: Record<MetricKey, boolean> = {
+  occupancy_rate: true,
+  rent_per_sqm: true,
+  arrears_rate: false,
+  maintenance_cost_per_unit: false,
+};
+const METRICS = Object.keys(HIGHER_IS_BETTER) as MetricKey[];
+// Platform figures are only shown when they pool enough companies that none can be singled out
+const PLATFORM_MIN_COMPANIES = 5;
+const WINDOW_MONTHS = 12;
+
+const round = (n: number) => Math.round(n * 100) / 100;
+
+/**
+ * Pooled metrics for a set of properties: rates are weighted by units and amounts, not averaged per property.
+ * - occupancy_rate: occupied units as a share of all units
+ * - rent_per_sqm: monthly rent of units with a recorded size, per square meter
+ * - arrears_rate: invoiced amounts due in the window that are unpaid and past due, as a share of all due
+ * - maintenance_cost_per_unit: cost of maintenance completed in the window per unit
+ */
+function pooled(rows: PropertyFigures[]): Record<MetricKey, number | null> {
+  const sum = (key: keyof PropertyFigures) => rows.reduce((total, row) => total + Number(row[key]), 0);
+  const units = sum('units');
+  const squareMeters = sum('square_meters');
+  const invoiced = sum('invoiced');
+  return {
+    occupancy_rate: units > 0 ? round((sum('occupied') / units) * 100) : null,
+    rent_per_sqm: squareMeters > 0 ? round(sum('sized_rent') / squareMeters) : null,
+    arrears_rate: invoiced > 0 ? round((sum('in_arrears') / invoiced) * 100) : null,
+    maintenance_cost_per_unit: units > 0 ? round(sum('maintenance_cost') / units) : null,
+  };
+}
+
+/**
+ * Share of platform properties this value beats (0-100), with "beats" following the metric's direction
+ */
+function percentile(value: number | null, population: Array<number | null>, higherIsBetter: boolean): number | null {
+  const values = population.filter((v): v is number => v !== null);
+  if (value === null || values.length === 0) return null;
+  const beaten = values.filter(v => (higherIsBetter ? v < value : v > value)).length;
+  const tied = values.filter(v => v === value).length;
+  return round(((beaten + tied / 2) / values.length) * 100);
+}
+
+/**
+ * Each property against the owner's portfolio and the (anonymized) platform
+ */
+export class PortfolioBenchmarksService {
+  private prisma = getPrisma();
+
+  async getBenchmarks(user: JWTClaims, filters: { property_ids?: string[] } = {}, now: Date = new Date()) {
+    const start = new Date(now.getFullYear(), now.getMonth() - WINDOW_MONTHS, now.getDate());
+
+    const properties = await this.prisma.property.findMany({
+      where: { ...buildWhereClause(user), ...(filters.property_ids?.length && { id: { in: filters.property_ids } }) },
+      select: { id: true, name: true, type: true, city: true },
+      orderBy: { name: 'asc' },
+    });
+    const figures = await this.collect(start, now);
+    const byId = new Map(figures.map(row => [row.property_id, row]));
+    const mine = properties.map(p => byId.get(p.id)).filter((row): row is PropertyFigures => !!row && row.units > 0);
+
+    const portfolio = pooled(mine);
+    const companies = new Set(figures.map(row => row.company_id)).size;
+    const platformShown = companies >= PLATFORM_MIN_COMPANIES;
+    const platform = platformShown ? pooled(figures) : null;
+    const platformByProperty = platformShown ? figures.map(row => pooled([row])) : [];
+
+    return {
+      period: { start: start.toISOString(), end: now.toISOString() },
+      portfolio: { properties: mine.length, units: mine.reduce((sum, row) => sum + row.units, 0), ...portfolio },
+      platform: platform && { properties: figures.length, companies, ...platform },
+      properties: properties.map(property => {
+        const row = byId.get(property.id);
+        const own = row && row.units > 0 ? pooled([row]) : null;
+        return {
+          property_id: property.id,
+          property_name: property.name,
+          property_type: property.type,
+          city: property.city,
+          units: row?.units || 0,
+          metrics: Object.fromEntries(METRICS.map(metric => {
+            const value = own ? own[metric] : null;
+            const compare = (benchmark: number | null) => (value !== null && benchmark !== null ? round(value - benchmark) : null);
+            const better = (benchmark: number | null) =>
+              value === null || benchmark === null || value === benchmark ? null : (value > benchmark) === HIGHER_IS_BETTER[metric];
+            return [metric, {
+              value,
+              portfolio: portfolio[metric],
+              vs_portfolio: compare(portfolio[metric]),
+              better_than_portfolio: better(portfolio[metric]),
+              platform: platform ? platform[metric] : null,
+              vs_platform: platform ? compare(platform[metric]) : null,
+              better_than_platform: platform ? better(platform[metric]) : null,
+              platform_percentile: platformShown ? percentile(value, platformByProperty.map(p => p[metric]), HIGHER_IS_BETTER[metric]) : null,
+            }];
+          })),
+        };
+      }),
+      generatedAt: new Date().toISOString(),
+    };
+  }
+
+  /**
+   * Raw figures for every property on the platform in one grouped query
+   */
+  private async collect(start: Date, end: Date): Promise<PropertyFigures[]> {
+    const rows = await this.prisma.$queryRaw<PropertyFigures[]>`
+      SELECT p.id::text AS property_id, p.company_id::text AS company_id,
+        us.units::int AS units,
+        us.occupied::int AS occupied,
+        COALESCE(us.sized_rent, 0)::float AS sized_rent,
+        COALESCE(us.square_meters, 0)::float AS square_meters,
+        COALESCE(inv.invoiced, 0)::float AS invoiced,
+        COALESCE(inv.in_arrears, 0)::float AS in_arrears,
+        COALESCE(mr.cost, 0)::float AS maintenance_cost
+      FROM properties p
+      JOIN (
+        SELECT property_id, COUNT(*) AS units,
+          COUNT(*) FILTER (WHERE status = 'occupied'::unit_status) AS occupied,
+          SUM(rent_amount) FILTER (WHERE size_square_meters > 0) AS sized_rent,
+          SUM(size_square_meters) FILTER (WHERE size_square_meters > 0) AS square_meters
+        FROM units GROUP BY property_id
+      ) us ON us.property_id = p.id
+      LEFT JOIN (
+        SELECT COALESCE(i.property_id, u.property_id) AS property_id,
+          SUM(i.total_amount) AS invoiced,
+          SUM(i.total_amount) FILTER (WHERE i.status = 'overdue'::invoice_status
+            OR (i.status = 'sent'::invoice_status AND i.due_date < CURRENT_DATE)) AS in_arrears
+        FROM invoices i
+        LEFT JOIN units u ON u.id = i.unit_id
+        WHERE i.status IN ('sent'::invoice_status, 'paid'::invoice_status, 'overdue'::invoice_status)
+          AND i.due_date >= ${start}::date AND i.due_date <= ${end}::date
+        GROUP BY 1
+      ) inv ON inv.property_id = p.id
+      LEFT JOIN (
+        SELECT property_id, SUM(COALESCE(actual_cost, estimated_cost, 0)) AS cost
+        FROM maintenance_requests
+        WHERE status = 'completed'::maintenance_status
+          AND completed_date >= ${start} AND completed_date <= ${end}
+        GROUP BY property_id
+      ) mr ON mr.property_id = p.id
+    `;
+    return rows.map(row => ({
+      ...row,
+      units: Number(row.units),
+      occupied: Number(row.occupied),
+      sized_rent: Number(row.sized_rent),
+      square_meters: Number(row.square_meters),
+      invoiced: Number(row.invoiced),
+      in_arrears: Number(row.in_arrears),
+      maintenance_cost: Number(row.maintenance_cost),
+    }));
+  }
+}
+
+export const portfolioBenchmarksService = new PortfolioBenchmarksService();
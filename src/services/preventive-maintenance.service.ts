@@ -0,0 +1,467 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { maintenanceSlaService } from './maintenance-sla.service.js';
+import { maintenanceCostsService } from './maintenance-costs.service.js';
+
+export interface PreventiveScheduleRequest {
+  property_id: string;
+  unit_id?: string | null;
+  title: string;
+  description?: string;
+  category?: string;
+  priority?: string;
+  frequency: 'weekly' | 'monthly' | 'yearly';
+  interval_count?: number;
+  next_due_date: string;
+  lead_days?: number;
+  reminder_days?: number;
+  output_type?: 'task' | 'work_order';
+  assigned_to?: string | null;
+  vendor_id?: string | null;
+  estimated_cost?: number | null;
+  is_active?: boolean;
+}
+
+const FREQUENCIES = ['weekly', 'monthly', 'yearly'];
+const PRIORITIES = ['low', 'medium', 'high', 'urgent'];
+const MANAGING_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent', 'manager', 'admin'];
+const DAY = 24 * 60 * 60 * 1000;
+
+const scheduleInclude = {
+  property: { select: { id: true, name: true } },
+  unit: { select: { id: true, unit_number: true } },
+};
+
+/**
+ * Next occurrence after `from`, e.g. monthly x3 for a quarterly water tank clean. Days past the
+ * end of a shorter month land on its last day (31 January + 1 month = 28/29 February).
+ */
+export const advanceDueDate = (from: Date, frequency: string, interval: number): Date => {
+  const next = new Date(from);
+  if (frequency === 'weekly') {
+    next.setUTCDate(next.getUTCDate() + 7 * interval);
+    return next;
+  }
+  const months = frequency === 'yearly' ? 12 * interval : interval;
+  const lastDay = new Date(Date.UTC(from.getUTCFullYear(), from.getUTCMonth() + months + 1, 0)).getUTCDate();
+  next.setUTCDate(1);
+  next.setUTCMonth(next.getUTCMonth() + months);
+  next.setUTCDate(Math.min(from.getUTCDate(), lastDay));
+  return next;
+};
+
+export class PreventiveMaintenanceService {
+  private prisma = getPrisma();
+
+  private assertCanManage(user: JWTClaims) {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage preventive maintenance');
+    }
+  }
+
+  private async getCompanySchedule(id: string, user: JWTClaims) {
+    const schedule = await this.prisma.preventiveMaintenanceSchedule.findFirst({
+      where: { id, ...(user.role !== 'super_admin' && { company_id: user.company_id }) },
+    });
+    if (!schedule) {
+      throw new Error('preventive maintenance schedule not found');
+    }
+    return schedule;
+  }
+
+  /**
+   * Validate the fields that are present and resolve company-scoped references
+   */
+  private async buildData(req: Partial<PreventiveScheduleRequest>, companyId: string, propertyId: string) {
+    if (req.frequency !== undefined && !FREQUENCIES.includes(req.frequency)) {
+      throw new Error(`frequency must be one of: ${FREQUENCIES.join(', ')}`);
+    }
+    if (req.priority !== undefined && !PRIORITIES.includes(req.priority)) {
+      throw new Error(`priority must be one of: ${PRIORITIES.join(', ')}`);
+    }
+    if (req.output_type !== undefined && !['task', 'work_order'].includes(req.output_type)) {
+      throw new Error("output_type must be 'task' or 'work_order'");
+    }
+    for (const field of ['interval_count', 'lead_days', 'reminder_days'] as const) {
+      const value = req[field];
+      if (value !== undefined && (!Number.isInteger(value) || value < (field === 'interval_count' ? 1 : 0))) {
+        throw new Error(`${field} must be a whole number${field === 'interval_count' ? ' of at least 1' : ''}`);
+      }
+    }
+    const nextDue = req.next_due_date !== undefined ? new Date(req.next_due_date) : undefined;
+    if (nextDue && isNaN(nextDue.getTime())) {
+      throw new Error('next_due_date must be a valid date');
+    }
+    if (req.unit_id) {
+      const unit = await this.prisma.unit.findFirst({ where: { id: req.unit_id, property_id: propertyId }, select: { id: true } });
+      if (!unit) throw new Error('unit not found on this property');
+    }
+    if (req.assigned_to) {
+      const assignee = await this.prisma.user.findFirst({
+        where: { id: req.assigned_to, company_id: companyId, status: 'active' as any },
+        select: { role: true },
+      });
+      if (!assignee || assignee.role === 'tenant') throw new Error('assignee not found in this company');
+    }
+    if (req.vendor_id) {
+      const vendor = await this.prisma.vendor.findFirst({ where: { id: req.vendor_id, company_id: companyId }, select: { id: true } });
+      if (!vendor) throw new Error('vendor not found in this company');
+    }
+
+    return {
+      ...(req.unit_id !== undefined && { unit_id: req.unit_id || null }),
+      ...(req.title !== undefined && { title: req.title.trim() }),
+      ...(req.description !== undefined && { description: req.description || null }),
+      ...(req.category !== undefined && { category: req.category || 'general' }),
+      ...(req.priority !== undefined && { priority: req.priority }),
+      ...(req.frequency !== undefined && { frequency: req.frequency }),
+      ...(req.interval_count !== undefined && { interval_count: req.interval_count }),
+      ...(nextDue && { next_due_date: nextDue }),
+      ...(req.lead_days !== undefined && { lead_days: req.lead_days }),
+      ...(req.reminder_days !== undefined && { reminder_days: req.reminder_days }),
+      ...(req.output_type !== undefined && { output_type: req.output_type }),
+      ...(req.assigned_to !== undefined && { assigned_to: req.assigned_to || null }),
+      ...(req.vendor_id !== undefined && { vendor_id: req.vendor_id || null }),
+      ...(req.estimated_cost !== undefined && { estimated_cost: req.estimated_cost }),
+      ...(req.is_active !== undefined && { is_active: !!req.is_active }),
+    };
+  }
+
+  async createSchedule(req: PreventiveScheduleRequest, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    if (!req.title?.trim() || !req.property_id || !req.frequency || !req.next_due_date) {
+      throw new Error('title, property_id, frequency and next_due_date are required');
+    }
+    const property = await this.prisma.property.findFirst({
+      where: { id: req.property_id, ...(user.role !== 'super_admin' && { company_id: user.company_id }) },
+      select: { id: true, company_id: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+    if ((req.output_type || 'task') === 'task' && !req.assigned_to) {
+      throw new Error('assigned_to is required for schedules that create tasks');
+    }
+
+    const data = await this.buildData(req, property.company_id, property.id);
+    return this.prisma.preventiveMaintenanceSchedule.create({
+      data: {
+        ...data,
+        title: req.title.trim(),
+        frequency: req.frequency,
+        next_due_date: data.next_due_date!,
+        company_id: property.company_id,
+        property_id: property.id,
+        created_by: user.user_id,
+      },
+      include: scheduleInclude,
+    });
+  }
+
+  async listSchedules(filters: { property_id?: string; is_active?: string }, user: JWTClaims): Promise<any[]> {
+    this.assertCanManage(user);
+    return this.prisma.preventiveMaintenanceSchedule.findMany({
+      where: {
+        ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+        ...(filters.property_id && { property_id: filters.property_id }),
+        ...(filters.is_active !== undefined && { is_active: filters.is_active === 'true' }),
+      },
+      include: scheduleInclude,
+      orderBy: { next_due_date: 'asc' },
+    });
+  }
+
+  async updateSchedule(id: string, req: Partial<PreventiveScheduleRequest>, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const schedule = await this.getCompanySchedule(id, user);
+    const data = await this.buildData(req, schedule.company_id, schedule.property_id);
+    const outputType = data.output_type || schedule.output_type;
+    const assignee = data.assigned_to !== undefined ? data.assigned_to : schedule.assigned_to;
+    if (outputType === 'task' && !assignee) {
+      throw new Error('assigned_to is required for schedules that create tasks');
+    }
+
+    return this.prisma.preventiveMaintenanceSchedule.update({
+      where: { id: schedule.id },
+      data: { ...data, updated_at: new Date() },
+      include: scheduleInclude,
+    });
+  }
+
+  async deleteSchedule(id: string, user: JWTClaims): Promise<void> {
+    this.assertCanManage(user);
+    const schedule = await this.getCompanySchedule(id, user);
+    // Generated tasks and work orders are kept; their schedule link is cleared
+    await this.prisma.preventiveMaintenanceSchedule.delete({ where: { id: schedule.id } });
+  }
+
+  /**
+   * Everything a schedule has generated, newest first, with on-time completion stats
+   */
+  async getHistory(id: string, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const schedule = await this.getCompanySchedule(id, user);
+
+    const [tasks, workOrders] = await Promise.all([
+      this.prisma.task.findMany({
+        where: { preventive_schedule_id: schedule.id },
+        select: {
+          id: true, title: true, status: true, due_date: true, completed_at: true, completion_notes: true,
+          assignedTo: { select: { id: true, first_name: true, last_name: true } },
+        },
+        orderBy: { due_date: 'desc' },
+      }),
+      this.prisma.maintenanceRequest.findMany({
+        where: { preventive_schedule_id: schedule.id },
+        select: {
+          id: true, title: true, status: true, scheduled_date: true, resolved_at: true, actual_cost: true,
+          vendor: { select: { id: true, name: true } },
+        },
+        orderBy: { scheduled_date: 'desc' },
+      }),
+    ]);
+
+    const occurrences = [
+      ...tasks.map(t => ({
+        type: 'task', id: t.id, title: t.title, status: t.status, due_date: t.due_date, completed_at: t.completed_at,
+        notes: t.completion_notes,
+        assignee: t.assignedTo ? `${t.assignedTo.first_name} ${t.assignedTo.last_name}` : null,
+      })),
+      ...workOrders.map(w => ({
+        type: 'work_order', id: w.id, title: w.title, status: w.status, due_date: w.scheduled_date, completed_at: w.resolved_at,
+        actual_cost: w.actual_cost != null ? Number(w.actual_cost) : null, assignee: w.vendor?.name || null,
+      })),
+    ].sort((a, b) => (b.due_date?.getTime() || 0) - (a.due_date?.getTime() || 0));
+
+    const completed = occurrences.filter(o => o.status === 'completed');
+    // Due dates are stored at midnight, so anything finished on the due day counts as on time
+    const onTime = completed.filter(o => o.completed_at && o.due_date && o.completed_at.getTime() < o.due_date.getTime() + DAY);
+
+    return {
+      schedule,
+      total: occurrences.length,
+      completed: completed.length,
+      on_time: onTime.length,
+      missed: occurrences.filter(o => o.status !== 'completed' && o.status !== 'cancelled' && o.due_date && o.due_date.getTime() + DAY < Date.now()).length,
+      occurrences,
+    };
+  }
+
+  /**
+   * Create the next occurrence of one schedule immediately, regardless of its lead time
+   */
+  async runNow(id: string, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const schedule = await this.getCompanySchedule(id, user);
+    if (!schedule.is_active) {
+      throw new Error('schedule is paused; activate it before generating work');
+    }
+    return this.generateOccurrence(schedule);
+  }
+
+  /**
+   * Scheduler entry point: create tasks/work orders for schedules entering their lead window,
+   * then remind assignees about generated work that is coming due
+   */
+  async processDueSchedules(): Promise<{ generated: number; reminders: number }> {
+    const today = new Date();
+    today.setUTCHours(0, 0, 0, 0);
+
+    // Widest lead window we support; the per-schedule lead time is checked below
+    const candidates = await this.prisma.preventiveMaintenanceSchedule.findMany({
+      where: { is_active: true, next_due_date: { lte: new Date(today.getTime() + 60 * DAY) } },
+    });
+
+    let generated = 0;
+    for (const schedule of candidates) {
+      if (schedule.next_due_date.getTime() - schedule.lead_days * DAY > today.getTime()) continue;
+      try {
+        await this.generateOccurrence(schedule);
+        generated++;
+      } catch (error: any) {
+        console.error(`❌ Failed to generate preventive maintenance for schedule ${schedule.id}:`, error.message);
+      }
+    }
+
+    const reminders = await this.sendReminders(today);
+    return { generated, reminders };
+  }
+
+  private async generateOccurrence(schedule: any): Promise<any> {
+    // Periods missed while the schedule was paused or the scheduler was down are skipped: when a
+    // later occurrence is already due, work is only created for the latest one
+    const today = new Date();
+    today.setUTCHours(0, 0, 0, 0);
+    let dueDate: Date = schedule.next_due_date;
+    let skipped = 0;
+    for (
+      let next = advanceDueDate(dueDate, schedule.frequency, schedule.interval_count);
+      next.getTime() <= today.getTime();
+      next = advanceDueDate(next, schedule.frequency, schedule.interval_count)
+    ) {
+      dueDate = next;
+      skipped++;
+    }
+    if (skipped) {
+      console.warn(`⚠️ Preventive maintenance schedule ${schedule.id} skipped ${skipped} missed occurrence(s)`);
+    }
+    const title = `${schedule.title} (due ${dueDate.toISOString().split('T')[0]})`;
+    let created: any;
+    let creator: JWTClaims | null = null;
+
+    if (schedule.output_type === 'task' && schedule.assigned_to) {
+      created = await this.prisma.task.create({
+        data: {
+          company_id: schedule.company_id,
+          title,
+          description: schedule.description,
+          priority: schedule.priority as any,
+          status: 'pending',
+          assigned_to: schedule.assigned_to,
+          assigned_by: schedule.created_by,
+          property_id: schedule.property_id,
+          unit_id: schedule.unit_id,
+          due_date: dueDate,
+          notes: 'Generated from a preventive maintenance schedule',
+          preventive_schedule_id: schedule.id,
+        },
+      });
+      await this.notify(schedule, schedule.assigned_to, 'Preventive maintenance task assigned',
+        `${title} has been added to your tasks.`);
+    } else {
+      const now = new Date();
+      const dueDates = await maintenanceSlaService.computeDueDates(schedule.company_id, schedule.priority, now);
+      // Planned estimates above the company threshold need sign-off like any other work order,
+      // unless the schedule was set up by an approver who is still active
+      creator = await this.creatorClaims(schedule);
+      const actor = creator || ({ user_id: schedule.created_by, role: 'staff', company_id: schedule.company_id } as JWTClaims);
+      const approval = await maintenanceCostsService.approvalFor(
+        schedule.company_id,
+        schedule.estimated_cost != null ? Number(schedule.estimated_cost) : null,
+        actor
+      );
+      created = await this.prisma.maintenanceRequest.create({
+        data: {
+          company_id: schedule.company_id,
+          property_id: schedule.property_id,
+          unit_id: schedule.unit_id,
+          title,
+          description: schedule.description || schedule.title,
+          category: schedule.category,
+          priority: schedule.priority as any,
+          status: 'pending',
+          requested_by: schedule.created_by,
+          requested_date: now,
+          scheduled_date: dueDate,
+          assigned_to: schedule.assigned_to,
+          assigned_at: schedule.assigned_to ? now : null,
+          estimated_cost: schedule.estimated_cost,
+          ...approval,
+          preventive_schedule_id: schedule.id,
+          // Planned work is not a tenant-reported fault, so the resolution target is the due date
+          response_due_at: dueDates.response_due_at,
+          resolution_due_at: new Date(Math.max(dueDates.resolution_due_at.getTime(), dueDate.getTime() + DAY)),
+        },
+      });
+      if (schedule.assigned_to) {
+        await this.notify(schedule, schedule.assigned_to, 'Preventive maintenance work order',
+          `${title} has been assigned to you.`);
+      }
+      if (approval.cost_approval_status === 'pending_approval') {
+        await maintenanceCostsService.notifyApprovers(created, actor);
+      }
+    }
+
+    await this.prisma.preventiveMaintenanceSchedule.update({
+      where: { id: schedule.id },
+      data: {
+        next_due_date: advanceDueDate(dueDate, schedule.frequency, schedule.interval_count),
+        last_generated_at: new Date(),
+        updated_at: new Date(),
+      },
+    });
+
+    // Vendor work orders go through the normal assignment flow so the vendor gets their link
+    if (created && schedule.output_type === 'work_order' && schedule.vendor_id && !schedule.assigned_to) {
+      try {
+        const { MaintenanceService } = await import('./maintenance.service.js');
+        if (creator) {
+          await new MaintenanceService().assignMaintenanceRequest(created.id, { vendor_id: schedule.vendor_id }, creator);
+        }
+      } catch (error: any) {
+        console.error(`⚠️ Could not assign vendor for preventive work order ${created.id}:`, error.message);
+      }
+    }
+
+    return { type: schedule.output_type === 'task' && schedule.assigned_to ? 'task' : 'work_order', ...created };
+  }
+
+  /**
+   * The schedule's creator as the user acting for generated work; null once they have left
+   */
+  private async creatorClaims(schedule: any): Promise<JWTClaims | null> {
+    const creator = await this.prisma.user.findUnique({
+      where: { id: schedule.created_by },
+      select: { id: true, email: true, role: true, status: true, company_id: true },
+    });
+    if (!creator || creator.status !== 'active') return null;
+    return { user_id: creator.id, email: creator.email, role: creator.role as any, company_id: creator.company_id || undefined } as JWTClaims;
+  }
+
+  /**
+   * Remind assignees of generated tasks and work orders, once, on the day that is exactly
+   * reminder_days before the due date
+   */
+  private async sendReminders(today: Date): Promise<number> {
+    const schedules = await this.prisma.preventiveMaintenanceSchedule.findMany({
+      where: { is_active: true, reminder_days: { gt: 0 } },
+      select: { id: true, company_id: true, property_id: true, reminder_days: true },
+    });
+    let sent = 0;
+    for (const schedule of schedules) {
+      const target = new Date(today.getTime() + schedule.reminder_days * DAY);
+      const window = { gte: target, lt: new Date(target.getTime() + DAY) };
+      const [tasks, workOrders] = await Promise.all([
+        this.prisma.task.findMany({
+          where: { preventive_schedule_id: schedule.id, status: { in: ['pending', 'in_progress'] }, due_date: window },
+          select: { title: true, assigned_to: true },
+        }),
+        this.prisma.maintenanceRequest.findMany({
+          where: {
+            preventive_schedule_id: schedule.id,
+            status: { in: ['pending', 'in_progress'] },
+            assigned_to: { not: null },
+            scheduled_date: window,
+          },
+          select: { title: true, assigned_to: true },
+        }),
+      ]);
+      for (const item of [...tasks, ...workOrders]) {
+        await this.notify(schedule, item.assigned_to!, 'Preventive maintenance due soon', `${item.title} is due soon.`);
+        sent++;
+      }
+    }
+    return sent;
+  }
+
+  private async notify(schedule: any, recipientId: string, title: string, message: string) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: schedule.company_id,
+        recipient_id: recipientId,
+        title,
+        message,
+        notification_type: 'maintenance',
+        category: 'maintenance',
+        priority: 'medium',
+        property_id: schedule.property_id,
+        metadata: { preventive_schedule_id: schedule.id },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to send preventive maintenance notification:', error.message);
+    }
+  }
+}
+
+export const preventiveMaintenanceService = new PreventiveMaintenanceService();
@@ -1,5 +1,7 @@
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
+import { normalizeCounty } from '../utils/counties.js';
+import { propertyDelegationsService } from './property-delegations.service.js';
 
 export interface PropertyFilters {
   owner_id?: string;
@@ -9,6 +11,7 @@ export interface PropertyFilters {
   status?: string;
   city?: string;
   region?: string;
+  county?: string;
   country?: string;
   min_units?: number;
   max_units?: number;
@@ -29,10 +32,12 @@ export interface CreatePropertyRequest {
   street: string;
   city: string;
   region: string;
+  county?: string;
   country: string;
   postal_code?: string;
   latitude?: number;
   longitude?: number;
+  geofence_radius_meters?: number;
   ownership_type: string;
   owner_id: string;
   agency_id?: string;
@@ -41,6 +46,7 @@ export interface CreatePropertyRequest {
   number_of_floors?: number;
   service_charge_rate?: number;
   service_charge_type?: string;
+  commission_rate?: number | null;
   amenities?: string[];
   access_control?: string;
   maintenance_schedule?: string;
@@ -55,14 +61,17 @@ export interface UpdatePropertyRequest {
   street?: string;
   city?: string;
   region?: string;
+  county?: string;
   country?: string;
   postal_code?: string;
   latitude?: number;
   longitude?: number;
+  geofence_radius_meters?: number;
   number_of_blocks?: number;
   number_of_floors?: number;
   service_charge_rate?: number;
   service_charge_type?: string;
+  commission_rate?: number | null;
   amenities?: string[];
   access_control?: string;
   maintenance_schedule?: string;
@@ -71,6 +80,46 @@ export interface UpdatePropertyRequest {
   images?: any[];
 }
 
+export interface PropertyUnitStats {
+  total_units: number;
+  occupied_units: number;
+  vacant_units: number;
+  monthly_revenue: number;
+}
+
+/**
+ * Unit counts and occupied rent for many properties in one grouped query
+ */
+export async function getUnitStatsByProperty(propertyIds: string[]): Promise<Map<string, PropertyUnitStats>> {
+  const stats = new Map<string, PropertyUnitStats>();
+  if (propertyIds.length === 0) return stats;
+
+  const groups = await getPrisma().unit.groupBy({
+    by: ['property_id', 'status'],
+    where: { property_id: { in: propertyIds } },
+    _count: { _all: true },
+    _sum: { rent_amount: true },
+  });
+  for (const group of groups) {
+    const entry = stats.get(group.property_id) || { total_units: 0, occupied_units: 0, vacant_units: 0, monthly_revenue: 0 };
+    entry.total_units += group._count._all;
+    if (group.status === 'occupied') {
+      entry.occupied_units += group._count._all;
+      entry.monthly_revenue += Number(group._sum.rent_amount || 0);
+    } else if (group.status === 'vacant') {
+      entry.vacant_units += group._count._all;
+    }
+    stats.set(group.property_id, entry);
+  }
+  return stats;
+}
+
+function validateCommissionRate(rate: number | null | undefined) {
+  if (rate !== undefined && rate !== null && (!Number.isFinite(Number(rate)) || Number(rate) < 0 || Number(rate) > 100)) {
+    throw new Error('commission_rate must be a percentage between 0 and 100');
+  }
+}
+
 export class PropertiesService {
   private prisma = getPrisma();
 
@@ -79,6 +128,7 @@ export class PropertiesService {
     if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
       throw new Error('insufficient permissions to create properties');
     }
+    validateCommissionRate(req.commission_rate);
 
     // For non-super-admin users, ensure company scoping
     let companyId = user.company_id;
@@ -133,10 +183,13 @@ export class PropertiesService {
         street: req.street,
         city: req.city,
         region: req.region,
+        // Canonical county from what was entered, falling back to the city or region
+        county: normalizeCounty(req.county) || normalizeCounty(req.city) || normalizeCounty(req.region) || req.county || null,
         country: req.country,
         postal_code: req.postal_code,
         latitude: req.latitude,
         longitude: req.longitude,
+        geofence_radius_meters: req.geofence_radius_meters,
         ownership_type: req.ownership_type as any,
         owner_id: req.owner_id,
         agency_id: agencyId, // Use the agency_id (from JWT for agency_admin, or from request for others)
@@ -146,6 +199,7 @@ export class PropertiesService {
         number_of_floors: req.number_of_floors,
         service_charge_rate: req.service_charge_rate,
         service_charge_type: req.service_charge_type,
+        commission_rate: req.commission_rate,
         amenities: req.amenities || [],
         access_control: req.access_control,
         maintenance_schedule: req.maintenance_schedule,
@@ -217,10 +271,13 @@ export class PropertiesService {
       throw new Error('insufficient permissions to update properties');
     }
 
-    // For non-super-admin, ensure they can only update their own company's properties
-    if (user.role !== 'super_admin' && existingProperty.company_id !== user.company_id) {
+    // Agency admins go by the property's delegation; everyone else by company
+    if (user.role === 'agency_admin') {
+      await propertyDelegationsService.assertAgencyCan(user, existingProperty, 'manage');
+    } else if (user.role !== 'super_admin' && existingProperty.company_id !== user.company_id) {
       throw new Error('cannot update properties from other companies');
     }
+    validateCommissionRate(req.commission_rate);
 
     const property = await this.prisma.property.update({
       where: { id },
@@ -231,14 +288,20 @@ export class PropertiesService {
         ...(req.street && { street: req.street }),
         ...(req.city && { city: req.city }),
         ...(req.region && { region: req.region }),
+        ...(req.county !== undefined && { county: normalizeCounty(req.county) || req.county || null }),
+        ...(req.county === undefined && (req.city || req.region) && !existingProperty.county && {
+          county: normalizeCounty(req.city) || normalizeCounty(req.region) || null,
+        }),
         ...(req.country && { country: req.country }),
         ...(req.postal_code !== undefined && { postal_code: req.postal_code }),
         ...(req.latitude !== undefined && { latitude: req.latitude }),
         ...(req.longitude !== undefined && { longitude: req.longitude }),
+        ...(req.geofence_radius_meters !== undefined && { geofence_radius_meters: req.geofence_radius_meters }),
         ...(req.number_of_blocks !== undefined && { number_of_blocks: req.number_of_blocks }),
         ...(req.number_of_floors !== undefined && { number_of_floors: req.number_of_floors }),
         ...(req.service_charge_rate !== undefined && { service_charge_rate: req.service_charge_rate }),
         ...(req.service_charge_type !== undefined && { service_charge_type: req.service_charge_type }),
+        ...(req.commission_rate !== undefined && { commission_rate: req.commission_rate }),
         ...(req.amenities && { amenities: req.amenities }),
         ...(req.access_control !== undefined && { access_control: req.access_control }),
         ...(req.maintenance_schedule !== undefined && { maintenance_schedule: req.maintenance_schedule }),
@@ -289,6 +352,11 @@ export class PropertiesService {
       throw new Error('cannot delete properties from other companies');
     }
 
+    // A delegated property stays the landlord's to remove, whatever the agency's scope
+    if (user.role === 'agency_admin' && await propertyDelegationsService.isDelegated(id)) {
+      throw new Error('insufficient permissions: delegated properties can only be deleted by their landlord');
+    }
+
     // STRICT CHECK: Property must be inactive before deletion (unless force delete)
     if (!force && existingProperty.status !== 'inactive') {
       throw new Error(`cannot delete property with status '${existingProperty.status}'. Property must be set to inactive before deletion.`);
@@ -469,6 +537,7 @@ export class PropertiesService {
     if (filters.status) where.status = filters.status;
     if (filters.city) where.city = { contains: filters.city, mode: 'insensitive' };
     if (filters.region) where.region = { contains: filters.region, mode: 'insensitive' };
+    if (filters.county) where.county = { equals: normalizeCounty(filters.county) || filters.county, mode: 'insensitive' };
     if (filters.country) where.country = { contains: filters.country, mode: 'insensitive' };
     
     if (filters.min_units || filters.max_units) {
@@ -547,42 +616,15 @@ export class PropertiesService {
     ]);
 
     // Transform properties to include unit statistics for frontend compatibility
-    const transformedProperties = await Promise.all(properties.map(async (property: any) => {
-      // Get accurate unit counts using separate queries to ensure consistency
-      const [totalUnits, occupiedUnits, vacantUnits] = await Promise.all([
-        this.prisma.unit.count({
-          where: { property_id: property.id }
-        }),
-        this.prisma.unit.count({
-          where: { property_id: property.id, status: 'occupied' }
-        }),
-        this.prisma.unit.count({
-          where: { property_id: property.id, status: 'vacant' }
-        })
-      ]);
-
-      // Calculate monthly revenue from occupied units
-      const revenueResult = await this.prisma.unit.aggregate({
-        where: { 
-          property_id: property.id, 
-          status: 'occupied' 
-        },
-        _sum: {
-          rent_amount: true
-        }
-      });
-
-      const monthlyRevenue = Number(revenueResult._sum.rent_amount || 0);
-
+    const unitStats = await getUnitStatsByProperty(properties.map((property: any) => property.id));
+    const transformedProperties = properties.map((property: any) => {
+      const stats = unitStats.get(property.id) || { total_units: 0, occupied_units: 0, vacant_units: 0, monthly_revenue: 0 };
       return {
         ...property,
-        total_units: totalUnits,
-        occupied_units: occupiedUnits,
-        vacant_units: vacantUnits,
-        monthly_revenue: monthlyRevenue,
-        occupancy_rate: totalUnits > 0 ? Math.round((occupiedUnits / totalUnits) * 100) : 0,
+        ...stats,
+        occupancy_rate: stats.total_units > 0 ? Math.round((stats.occupied_units / stats.total_units) * 100) : 0,
       };
-    }));
+    });
 
     const totalPages = Math.ceil(total / limit);
     const currentPage = Math.floor(offset / limit) + 1;
@@ -700,6 +742,7 @@ export class PropertiesService {
         street: originalProperty.street,
         city: originalProperty.city,
         region: originalProperty.region,
+        county: originalProperty.county,
         country: originalProperty.country,
         postal_code: originalProperty.postal_code,
         latitude: originalProperty.latitude,
@@ -713,6 +756,7 @@ export class PropertiesService {
         number_of_floors: originalProperty.number_of_floors,
         service_charge_rate: originalProperty.service_charge_rate,
         service_charge_type: originalProperty.service_charge_type,
+        commission_rate: originalProperty.commission_rate,
         amenities: originalProperty.amenities || [],
         access_control: originalProperty.access_control,
         maintenance_schedule: originalProperty.maintenance_schedule,
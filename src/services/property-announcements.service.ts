@@ -0,0 +1,411 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface CreatePropertyAnnouncementRequest {
+  property_id?: string;
+  title?: string;
+  message?: string;
+  category?: string;
+  priority?: string;
+  requires_acknowledgement?: boolean;
+  starts_at?: string;
+  ends_at?: string;
+}
+
+export const ANNOUNCEMENT_CATEGORIES = ['water_shutoff', 'power_outage', 'fumigation', 'maintenance', 'security', 'event', 'general'];
+const PRIORITIES = ['low', 'medium', 'high', 'urgent'];
+const AUTHOR_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent', 'caretaker'];
+// Agents and caretakers post only to the properties they are assigned to
+const ASSIGNED_ROLES = ['agent', 'caretaker'];
+// Tenants processed concurrently while fanning out
+const SEND_CONCURRENCY = 20;
+
+const parseDate = (value: string | undefined, field: string) => {
+  if (!value) return null;
+  const date = new Date(value);
+  if (isNaN(date.getTime())) {
+    throw new Error(`${field} must be a valid date`);
+  }
+  return date;
+};
+
+/**
+ * Property notice board: landlords and property staff post notices that reach every tenant on an
+ * active lease at the property over the channels each tenant prefers for announcements. One
+ * recipient row per tenant records the channels used and when they read and acknowledged it.
+ */
+export class PropertyAnnouncementsService {
+  private prisma = getPrisma();
+
+  async createAnnouncement(req: CreatePropertyAnnouncementRequest, user: JWTClaims) {
+    if (!AUTHOR_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to post property announcements');
+    }
+    if (!req.property_id || !req.title || !req.message) {
+      throw new Error('property_id, title and message are required');
+    }
+    const category = req.category || 'general';
+    if (!ANNOUNCEMENT_CATEGORIES.includes(category)) {
+      throw new Error(`category must be one of: ${ANNOUNCEMENT_CATEGORIES.join(', ')}`);
+    }
+    const priority = req.priority || 'medium';
+    if (!PRIORITIES.includes(priority)) {
+      throw new Error(`priority must be one of: ${PRIORITIES.join(', ')}`);
+    }
+    const startsAt = parseDate(req.starts_at, 'starts_at');
+    const endsAt = parseDate(req.ends_at, 'ends_at');
+    if (startsAt && endsAt && endsAt < startsAt) {
+      throw new Error('ends_at must be after starts_at');
+    }
+
+    const property = await this.findProperty(req.property_id, user);
+    const tenants = await this.tenantsOf(property.id);
+
+    const announcement = await this.prisma.propertyAnnouncement.create({
+      data: {
+        company_id: property.company_id,
+        property_id: property.id,
+        created_by: user.user_id,
+        title: req.title,
+        message: req.message,
+        category,
+        priority,
+        requires_acknowledgement: req.requires_acknowledgement ?? true,
+        starts_at: startsAt,
+        ends_at: endsAt,
+        recipients_count: tenants.length,
+      },
+    });
+
+    const totals = { notified: 0, push: 0, email: 0, sms: 0 };
+    for (let i = 0; i < tenants.length; i += SEND_CONCURRENCY) {
+      const results = await Promise.all(
+        tenants.slice(i, i + SEND_CONCURRENCY).map(tenant => this.deliver(announcement, property.name, tenant))
+      );
+      for (const channels of results) {
+        if (channels.includes('app')) totals.notified++;
+        if (channels.includes('push')) totals.push++;
+        if (channels.includes('email')) totals.email++;
+        if (channels.includes('sms')) totals.sms++;
+      }
+    }
+    console.log(`📌 Property announcement ${announcement.id} sent to ${totals.notified}/${tenants.length} tenants of ${property.name}`);
+
+    return { ...announcement, delivery: totals };
+  }
+
+  /**
+   * Tenants see the notices they received with their own read/acknowledged state; staff see the
+   * company's notices with acknowledgement counts
+   */
+  async listAnnouncements(filters: { property_id?: string; status?: string; category?: string; page?: string; limit?: string }, user: JWTClaims) {
+    const limit = Math.min(parseInt(filters.limit || '20', 10) || 20, 100);
+    const page = Math.max(parseInt(filters.page || '1', 10) || 1, 1);
+
+    if (user.role === 'tenant') {
+      const where = {
+        user_id: user.user_id,
+        announcement: {
+          status: 'published',
+          ...(filters.property_id && { property_id: filters.property_id }),
+          ...(filters.category && { category: filters.category }),
+        },
+      };
+      const [receipts, total] = await Promise.all([
+        this.prisma.propertyAnnouncementRecipient.findMany({
+          where,
+          include: { announcement: true },
+          orderBy: { notified_at: 'desc' },
+          skip: (page - 1) * limit,
+          take: limit,
+        }),
+        this.prisma.propertyAnnouncementRecipient.count({ where }),
+      ]);
+      return {
+        announcements: receipts.map(({ announcement, read_at, acknowledged_at }) => ({ ...announcement, read_at, acknowledged_at })),
+        total,
+        page,
+        limit,
+      };
+    }
+
+    const where: any = {
+      ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+      status: filters.status || 'published',
+      ...(filters.property_id && { property_id: filters.property_id }),
+      ...(filters.category && { category: filters.category }),
+    };
+    if (ASSIGNED_ROLES.includes(user.role)) {
+      const propertyIds = await this.assignedPropertyIds(user.user_id);
+      where.property_id = filters.property_id && propertyIds.includes(filters.property_id) ? filters.property_id : { in: propertyIds };
+    }
+    const [announcements, total] = await Promise.all([
+      this.prisma.propertyAnnouncement.findMany({
+        where,
+        orderBy: { created_at: 'desc' },
+        skip: (page - 1) * limit,
+        take: limit,
+      }),
+      this.prisma.propertyAnnouncement.count({ where }),
+    ]);
+    const acknowledged = announcements.length
+      ? await this.prisma.propertyAnnouncementRecipient.groupBy({
+        by: ['announcement_id'],
+        where: { announcement_id: { in: announcements.map(a => a.id) }, acknowledged_at: { not: null } },
+        _count: { _all: true },
+      })
+      : [];
+    const ackCounts = new Map(acknowledged.map(row => [row.announcement_id, row._count._all]));
+    return {
+      announcements: announcements.map(announcement => ({
+        ...announcement,
+        acknowledged_count: ackCounts.get(announcement.id) || 0,
+      })),
+      total,
+      page,
+      limit,
+    };
+  }
+
+  /**
+   * A tenant opening a notice marks it read; staff get the acknowledgement summary
+   */
+  async getAnnouncement(announcementId: string, user: JWTClaims) {
+    const announcement = await this.findAnnouncement(announcementId, user);
+    if (user.role === 'tenant') {
+      const receipt = await this.prisma.propertyAnnouncementRecipient.findUniqueOrThrow({
+        where: { announcement_id_user_id: { announcement_id: announcement.id, user_id: user.user_id } },
+      });
+      const readAt = receipt.read_at || new Date();
+      if (!receipt.read_at) {
+        await this.prisma.propertyAnnouncementRecipient.update({ where: { id: receipt.id }, data: { read_at: readAt } });
+      }
+      return { ...announcement, read_at: readAt, acknowledged_at: receipt.acknowledged_at };
+    }
+    const summary = await this.acknowledgementSummary(announcement.id);
+    return { ...announcement, ...summary };
+  }
+
+  async acknowledgeAnnouncement(announcementId: string, user: JWTClaims) {
+    const announcement = await this.findAnnouncement(announcementId, user);
+    const receipt = await this.prisma.propertyAnnouncementRecipient.findUnique({
+      where: { announcement_id_user_id: { announcement_id: announcement.id, user_id: user.user_id } },
+    });
+    if (!receipt) {
+      throw new Error('announcement not found');
+    }
+    if (receipt.acknowledged_at) {
+      return receipt;
+    }
+
+    const now = new Date();
+    const updated = await this.prisma.propertyAnnouncementRecipient.update({
+      where: { id: receipt.id },
+      data: { acknowledged_at: now, read_at: receipt.read_at || now },
+    });
+    // The acknowledgement settles the matching inbox notification too
+    await this.prisma.notification.updateMany({
+      where: {
+        recipient_id: user.user_id,
+        related_entity_type: 'property_announcement',
+        related_entity_id: announcement.id,
+        is_read: false,
+      },
+      data: { is_read: true, read_at: now, status: 'read', updated_at: now },
+    });
+    return updated;
+  }
+
+  /**
+   * Who has and hasn't acknowledged a notice, by unit, so staff can follow up door to door
+   */
+  async getAcknowledgements(announcementId: string, user: JWTClaims) {
+    if (user.role === 'tenant') {
+      throw new Error('insufficient permissions to view acknowledgements');
+    }
+    const announcement = await this.findAnnouncement(announcementId, user);
+    const recipients = await this.prisma.propertyAnnouncementRecipient.findMany({
+      where: { announcement_id: announcement.id },
+      orderBy: { notified_at: 'asc' },
+    });
+    const [users, units] = await Promise.all([
+      this.prisma.user.findMany({
+        where: { id: { in: recipients.map(r => r.user_id) } },
+        select: { id: true, first_name: true, last_name: true, phone_number: true },
+      }),
+      this.prisma.unit.findMany({
+        where: { id: { in: recipients.map(r => r.unit_id).filter((id): id is string => !!id) } },
+        select: { id: true, unit_number: true },
+      }),
+    ]);
+    const userById = new Map(users.map(u => [u.id, u]));
+    const unitById = new Map(units.map(u => [u.id, u]));
+
+    const rows = recipients.map(recipient => {
+      const tenant = userById.get(recipient.user_id);
+      return {
+        user_id: recipient.user_id,
+        name: tenant ? `${tenant.first_name} ${tenant.last_name}`.trim() : null,
+        phone: tenant?.phone_number || null,
+        unit_id: recipient.unit_id,
+        unit_number: recipient.unit_id ? unitById.get(recipient.unit_id)?.unit_number || null : null,
+        channels: recipient.channels,
+        notified_at: recipient.notified_at,
+        read_at: recipient.read_at,
+        acknowledged_at: recipient.acknowledged_at,
+      };
+    });
+    return {
+      announcement_id: announcement.id,
+      ...(await this.acknowledgementSummary(announcement.id)),
+      acknowledged: rows.filter(row => row.acknowledged_at),
+      pending: rows.filter(row => !row.acknowledged_at),
+    };
+  }
+
+  /**
+   * Take a notice off the board (posted in error, shutoff cancelled); tenants stop seeing it
+   */
+  async withdrawAnnouncement(announcementId: string, user: JWTClaims) {
+    if (!AUTHOR_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to withdraw property announcements');
+    }
+    const announcement = await this.findAnnouncement(announcementId, user);
+    if (ASSIGNED_ROLES.includes(user.role) && announcement.created_by !== user.user_id) {
+      throw new Error('insufficient permissions: only the author or a landlord can withdraw this announcement');
+    }
+    if (announcement.status === 'withdrawn') {
+      throw new Error('announcement is already withdrawn');
+    }
+    const now = new Date();
+    return this.prisma.propertyAnnouncement.update({
+      where: { id: announcement.id },
+      data: { status: 'withdrawn', withdrawn_at: now, updated_at: now },
+    });
+  }
+
+  private async acknowledgementSummary(announcementId: string) {
+    const [recipients, read, acknowledged] = await Promise.all([
+      this.prisma.propertyAnnouncementRecipient.count({ where: { announcement_id: announcementId } }),
+      this.prisma.propertyAnnouncementRecipient.count({ where: { announcement_id: announcementId, read_at: { not: null } } }),
+      this.prisma.propertyAnnouncementRecipient.count({ where: { announcement_id: announcementId, acknowledged_at: { not: null } } }),
+    ]);
+    return {
+      recipients_count: recipients,
+      read_count: read,
+      acknowledged_count: acknowledged,
+      acknowledgement_rate: recipients ? Math.round((acknowledged / recipients) * 1000) / 10 : 0,
+    };
+  }
+
+  /**
+   * Notify one tenant in-app, handing push, email and SMS to the delivery queue for whichever
+   * they accept for announcements; returns the channels reached or queued
+   */
+  private async deliver(
+    announcement: { id: string; company_id: string; property_id: string; title: string; message: string; category: string; priority: string; requires_acknowledgement: boolean },
+    propertyName: string,
+    tenant: Awaited<ReturnType<PropertyAnnouncementsService['tenantsOf']>>[number]
+  ) {
+    const channels: string[] = [];
+    const title = `${propertyName}: ${announcement.title}`;
+    const priority = announcement.priority as 'low' | 'medium' | 'high' | 'urgent';
+
+    const { notificationsService } = await import('./notifications.service.js');
+    try {
+      const queued = await notificationsService.resolveChannels(
+        tenant.id,
+        'announcement',
+        ['push', ...(tenant.email ? ['email'] : []), ...(tenant.phone_number ? ['sms'] : [])],
+        'property_announcement',
+        priority
+      );
+      await notificationsService.notify({
+        company_id: announcement.company_id,
+        recipient_id: tenant.id,
+        title,
+        message: announcement.message,
+        notification_type: 'announcement',
+        category: 'property_announcement',
+        priority,
+        property_id: announcement.property_id,
+        unit_id: tenant.unit_id,
+        related_entity_type: 'property_announcement',
+        related_entity_id: announcement.id,
+        action_required: announcement.requires_acknowledgement,
+        action_url: `/announcements/${announcement.id}`,
+        channels: ['app'],
+        metadata: { announcement_category: announcement.category, property_announcement_id: announcement.id },
+      }, queued);
+      channels.push('app', ...queued);
+    } catch (error: any) {
+      console.error(`⚠️ Failed to notify tenant ${tenant.id} of announcement ${announcement.id}:`, error.message);
+    }
+
+    await this.prisma.propertyAnnouncementRecipient.create({
+      data: { announcement_id: announcement.id, user_id: tenant.id, unit_id: tenant.unit_id, channels },
+    });
+    return channels;
+  }
+
+  /**
+   * Active tenants on the property's active leases, with the unit each lives in
+   */
+  private async tenantsOf(propertyId: string) {
+    const leases = await this.prisma.lease.findMany({
+      where: { property_id: propertyId, status: 'active', tenant: { status: 'active' } },
+      select: {
+        unit_id: true,
+        tenant: { select: { id: true, email: true, phone_number: true } },
+      },
+    });
+    const byTenant = new Map<string, { id: string; email: string | null; phone_number: string | null; unit_id: string | null }>();
+    for (const lease of leases) {
+      if (!byTenant.has(lease.tenant.id)) {
+        byTenant.set(lease.tenant.id, { ...lease.tenant, unit_id: lease.unit_id });
+      }
+    }
+    return [...byTenant.values()];
+  }
+
+  private async assignedPropertyIds(staffId: string) {
+    const assignments = await this.prisma.staffPropertyAssignment.findMany({
+      where: { staff_id: staffId, status: 'active' },
+      select: { property_id: true },
+    });
+    return assignments.map(a => a.property_id);
+  }
+
+  private async findProperty(propertyId: string, user: JWTClaims) {
+    const property = await this.prisma.property.findFirst({
+      where: { id: propertyId, ...(user.role !== 'super_admin' && { company_id: user.company_id! }) },
+      select: { id: true, name: true, company_id: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+    if (ASSIGNED_ROLES.includes(user.role) && !(await this.assignedPropertyIds(user.user_id)).includes(property.id)) {
+      throw new Error('insufficient permissions: you are not assigned to this property');
+    }
+    return property;
+  }
+
+  private async findAnnouncement(announcementId: string, user: JWTClaims) {
+    const announcement = await this.prisma.propertyAnnouncement.findFirst({
+      where: {
+        id: announcementId,
+        ...(user.role !== 'super_admin' && { company_id: user.company_id! }),
+        ...(user.role === 'tenant' && { status: 'published', recipients: { some: { user_id: user.user_id } } }),
+      },
+    });
+    if (!announcement) {
+      throw new Error('announcement not found');
+    }
+    if (ASSIGNED_ROLES.includes(user.role) && !(await this.assignedPropertyIds(user.user_id)).includes(announcement.property_id)) {
+      throw new Error('announcement not found');
+    }
+    return announcement;
+  }
+}
+
+export const propertyAnnouncementsService = new PropertyAnnouncementsService();
@@ -0,0 +1,330 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { runAsSystem } from '../utils/request-context.js';
+
+export const DELEGATION_SCOPES = ['full_management', 'rent_collection'] as const;
+export type DelegationScope = typeof DELEGATION_SCOPES[number];
+
+/**
+ * What an agency may do on a delegated property. view: see it and its units and tenants;
+ * manage: edit or remove it; collect: issue, send and settle invoices; operations: occupancy,
+ * maintenance and property reports.
+ */
+export type DelegationAction = 'view' | 'manage' | 'collect' | 'operations';
+
+const SCOPE_ACTIONS: Record<DelegationScope, DelegationAction[]> = {
+  full_management: ['view', 'manage', 'collect', 'operations'],
+  rent_collection: ['view', 'collect'],
+};
+// Delegations that hold the property now or will
+const OPEN_STATUSES = ['scheduled', 'active'];
+
+const today = () => new Date(new Date().toISOString().split('T')[0]);
+const parseDate = (value: string, field: string) => {
+  const date = new Date(value);
+  if (isNaN(date.getTime())) throw new Error(`${field} must be a valid date`);
+  return new Date(date.toISOString().split('T')[0]);
+};
+
+const delegationInclude = {
+  property: { select: { id: true, name: true, street: true, city: true } },
+  agency: { select: { id: true, name: true, email: true, phone_number: true } },
+  landlord: { select: { id: true, first_name: true, last_name: true, email: true } },
+} as const;
+
+/**
+ * Landlords delegating properties to agencies. An active delegation puts the agency's agency_id on
+ * the property, which is what the agency's property, unit, invoice and report queries already
+ * scope by; the delegation's scope then narrows what the agency may do there.
+ */
+export class PropertyDelegationsService {
+  private prisma = getPrisma();
+
+  async list(user: JWTClaims, filters: { status?: string; property_id?: string; agency_id?: string; landlord_id?: string } = {}) {
+    const where: any = {};
+    if (user.role === 'landlord') {
+      where.landlord_id = user.user_id;
+    } else if (user.role === 'agency_admin') {
+      if (!user.agency_id) throw new Error('your account is not linked to an agency');
+      where.agency_id = user.agency_id;
+    } else if (user.role === 'super_admin') {
+      if (filters.agency_id) where.agency_id = filters.agency_id;
+      if (filters.landlord_id) where.landlord_id = filters.landlord_id;
+    } else {
+      throw new Error('insufficient permissions to view property delegations');
+    }
+    if (filters.status) where.status = filters.status;
+    if (filters.property_id) where.property_id = filters.property_id;
+
+    return this.prisma.propertyDelegation.findMany({
+      where,
+      orderBy: [{ status: 'asc' }, { start_date: 'desc' }],
+      include: delegationInclude,
+    });
+  }
+
+  async get(user: JWTClaims, id: string) {
+    const delegation = await this.prisma.propertyDelegation.findUnique({ where: { id }, include: delegationInclude });
+    if (!delegation || !this.canSee(user, delegation)) {
+      throw new Error('delegation not found');
+    }
+    return delegation;
+  }
+
+  /**
+   * Delegate one or more of the landlord's properties to an agency. A delegation starting today or
+   * earlier takes effect at once; a later one is scheduled and the nightly run starts it.
+   */
+  async create(user: JWTClaims, data: any) {
+    if (!['landlord', 'super_admin'].includes(user.role)) {
+      throw new Error('insufficient permissions: only the landlord can delegate a property');
+    }
+    const propertyIds: string[] = Array.isArray(data.property_ids) ? data.property_ids : data.property_id ? [data.property_id] : [];
+    if (propertyIds.length === 0 || !data.agency_id) {
+      throw new Error('property_ids and agency_id are required');
+    }
+    const scope = (data.scope || 'full_management') as DelegationScope;
+    if (!DELEGATION_SCOPES.includes(scope)) {
+      throw new Error(`scope must be one of ${DELEGATION_SCOPES.join(', ')}`);
+    }
+    const startDate = data.start_date ? parseDate(data.start_date, 'start_date') : today();
+    const endDate = data.end_date ? parseDate(data.end_date, 'end_date') : null;
+    if (endDate && endDate < startDate) {
+      throw new Error('end_date must be on or after start_date');
+    }
+
+    const agency = await this.prisma.agency.findUnique({ where: { id: data.agency_id }, select: { id: true, status: true } });
+    if (!agency) throw new Error('agency not found');
+    if (agency.status !== 'active') throw new Error('agency must be active to take on properties');
+
+    const properties = await this.prisma.property.findMany({
+      where: { id: { in: propertyIds } },
+      select: { id: true, name: true, owner_id: true, agency_id: true },
+    });
+    for (const propertyId of propertyIds) {
+      const property = properties.find(p => p.id === propertyId);
+      if (!property || (user.role === 'landlord' && property.owner_id !== user.user_id)) {
+        throw new Error(`property not found: ${propertyId}`);
+      }
+      const overlapping = await this.prisma.propertyDelegation.findFirst({
+        where: {
+          property_id: propertyId,
+          status: { in: OPEN_STATUSES },
+          ...(endDate && { start_date: { lte: endDate } }),
+          OR: [{ end_date: null }, { end_date: { gte: startDate } }],
+        },
+        select: { id: true },
+      });
+      if (overlapping) {
+        throw new Error(`property ${property.name} is already delegated for that period`);
+      }
+      // An agency's own listings carry its agency_id without a delegation; those aren't the landlord's to hand over
+      if (property.agency_id && property.agency_id !== agency.id) {
+        const delegated = await this.prisma.propertyDelegation.count({ where: { property_id: propertyId, agency_id: property.agency_id, status: 'active' } });
+        if (delegated === 0) throw new Error(`property ${property.name} is already managed by another agency`);
+      }
+    }
+
+    const startsNow = startDate <= today();
+    const created = await this.prisma.$transaction(async (tx) => {
+      const delegations = [];
+      for (const property of properties) {
+        delegations.push(await tx.propertyDelegation.create({
+          data: {
+            property_id: property.id,
+            landlord_id: property.owner_id,
+            agency_id: agency.id,
+            scope,
+            status: startsNow ? 'active' : 'scheduled',
+            start_date: startDate,
+            end_date: endDate,
+            terms: data.terms || null,
+            created_by: user.user_id,
+          },
+          include: delegationInclude,
+        }));
+        // Ownership was checked above; a landlord's own scope never lets them write agency_id
+        if (startsNow) {
+          await runAsSystem(async () => tx.property.update({ where: { id: property.id }, data: { agency_id: agency.id, updated_at: new Date() } }));
+        }
+      }
+      return delegations;
+    });
+    return created;
+  }
+
+  /**
+   * Change a delegation's scope, end date or terms; only the landlord can
+   */
+  async update(user: JWTClaims, id: string, data: { scope?: string; end_date?: string | null; terms?: string }) {
+    const delegation = await this.get(user, id);
+    if (user.role !== 'super_admin' && delegation.landlord_id !== user.user_id) {
+      throw new Error('insufficient permissions: only the landlord can change a delegation');
+    }
+    if (delegation.status === 'ended') {
+      throw new Error('delegation has already ended');
+    }
+    if (data.scope !== undefined && !DELEGATION_SCOPES.includes(data.scope as DelegationScope)) {
+      throw new Error(`scope must be one of ${DELEGATION_SCOPES.join(', ')}`);
+    }
+    const endDate = data.end_date ? parseDate(data.end_date, 'end_date') : data.end_date === null ? null : undefined;
+    if (endDate && endDate < delegation.start_date) {
+      throw new Error('end_date must be on or after start_date');
+    }
+
+    await this.prisma.propertyDelegation.update({
+      where: { id },
+      data: {
+        ...(data.scope !== undefined && { scope: data.scope }),
+        ...(endDate !== undefined && { end_date: endDate }),
+        ...(data.terms !== undefined && { terms: data.terms }),
+        updated_at: new Date(),
+      },
+    });
+    // An end date moved into the past ends the delegation now
+    if (endDate && endDate < today()) {
+      return this.end(user, id, 'end date reached');
+    }
+    return this.get(user, id);
+  }
+
+  /**
+   * End a delegation early; either side can. The property goes back to the landlord.
+   */
+  async end(user: JWTClaims, id: string, reason?: string) {
+    const delegation = await this.get(user, id);
+    const isParty = user.role === 'super_admin' ||
+      delegation.landlord_id === user.user_id ||
+      (user.role === 'agency_admin' && delegation.agency_id === user.agency_id);
+    if (!isParty) {
+      throw new Error('insufficient permissions to end this delegation');
+    }
+    if (delegation.status === 'ended') {
+      throw new Error('delegation has already ended');
+    }
+    await this.close(delegation, { ended_by: user.user_id, end_reason: reason || null });
+    return this.get(user, id);
+  }
+
+  /**
+   * Start scheduled delegations whose day has come and end those past their end date; run nightly
+   */
+  async processDue() {
+    const now = today();
+    let ended = 0;
+    const expired = await this.prisma.propertyDelegation.findMany({
+      where: { status: { in: OPEN_STATUSES }, end_date: { lt: now } },
+      select: { id: true, property_id: true, agency_id: true, status: true },
+    });
+    for (const delegation of expired) {
+      await this.close(delegation, { ended_by: null, end_reason: 'end date reached' });
+      ended++;
+    }
+
+    let started = 0;
+    const due = await this.prisma.propertyDelegation.findMany({
+      where: { status: 'scheduled', start_date: { lte: now } },
+      select: { id: true, property_id: true, agency_id: true },
+    });
+    for (const delegation of due) {
+      await runAsSystem(async () => this.prisma.$transaction([
+        this.prisma.propertyDelegation.update({ where: { id: delegation.id }, data: { status: 'active', updated_at: new Date() } }),
+        this.prisma.property.update({ where: { id: delegation.property_id }, data: { agency_id: delegation.agency_id, updated_at: new Date() } }),
+      ]));
+      started++;
+    }
+    return { started, ended };
+  }
+
+  /**
+   * Whether an agency admin may take an action on a property. A property delegated to their agency
+   * allows what its scope allows; without a delegation only their agency's own property does.
+   * Everyone else is left to the caller's own checks.
+   */
+  async agencyCan(user: JWTClaims, property: { id: string; agency_id?: string | null }, action: DelegationAction) {
+    if (user.role !== 'agency_admin') return true;
+    if (!user.agency_id) return false;
+    const delegation = await this.prisma.propertyDelegation.findFirst({
+      where: { property_id: property.id, agency_id: user.agency_id, status: 'active' },
+      select: { scope: true },
+    });
+    if (delegation) {
+      return SCOPE_ACTIONS[delegation.scope as DelegationScope]?.includes(action) ?? false;
+    }
+    const agencyId = property.agency_id !== undefined
+      ? property.agency_id
+      : (await this.prisma.property.findUnique({ where: { id: property.id }, select: { agency_id: true } }))?.agency_id;
+    return !!agencyId && agencyId === user.agency_id;
+  }
+
+  async assertAgencyCan(user: JWTClaims, property: { id: string; agency_id?: string | null }, action: DelegationAction) {
+    if (!(await this.agencyCan(user, property, action))) {
+      throw new Error(action === 'manage' || action === 'operations'
+        ? 'insufficient permissions: this property is delegated to your agency for rent collection only'
+        : 'insufficient permissions for this property');
+    }
+  }
+
+  async isDelegated(propertyId: string) {
+    return (await this.prisma.propertyDelegation.count({ where: { property_id: propertyId, status: 'active' } })) > 0;
+  }
+
+  /**
+   * Narrow an agency admin's report query to leave out properties they only collect rent for;
+   * `key` is the field holding the property id in the queried model
+   */
+  async withoutCollectionOnly(user: JWTClaims, where: any, key: 'id' | 'property_id') {
+    if (user.role !== 'agency_admin' || !user.agency_id) return where;
+    const collectionOnly = await this.prisma.propertyDelegation.findMany({
+      where: { agency_id: user.agency_id, status: 'active', scope: 'rent_collection' },
+      select: { property_id: true },
+    });
+    if (collectionOnly.length === 0) return where;
+    return { AND: [where, { [key]: { notIn: collectionOnly.map(d => d.property_id) } }] };
+  }
+
+  private async close(delegation: { id: string; property_id: string; agency_id: string; status: string }, details: { ended_by: string | null; end_reason: string | null }) {
+    const affectedStaff = delegation.status === 'active'
+      ? await this.prisma.staffPropertyAssignment.findMany({
+        where: { property_id: delegation.property_id, status: 'active', staff: { agency_id: delegation.agency_id } },
+        select: { staff_id: true },
+      })
+      : [];
+    // Taking the agency back off the property is outside an agency admin's own scope; end() has
+    // already checked they are a party to the delegation
+    await runAsSystem(async () => this.prisma.$transaction([
+      this.prisma.propertyDelegation.update({
+        where: { id: delegation.id },
+        data: { status: 'ended', ended_at: new Date(), ended_by: details.ended_by, end_reason: details.end_reason, updated_at: new Date() },
+      }),
+      // Only an active delegation put the agency on the property
+      ...(delegation.status === 'active' ? [
+        this.prisma.property.updateMany({
+          where: { id: delegation.property_id, agency_id: delegation.agency_id },
+          data: { agency_id: null, updated_at: new Date() },
+        }),
+        // The agency's staff lose the property with it
+        this.prisma.staffPropertyAssignment.updateMany({
+          where: { property_id: delegation.property_id, status: 'active', staff: { agency_id: delegation.agency_id } },
+          data: { status: 'inactive' },
+        }),
+      ] : []),
+    ]));
+
+    // Their devices leave the property's push topic too
+    if (affectedStaff.length) {
+      const { pushNotificationService } = await import('./push-notification.service.js');
+      for (const { staff_id } of affectedStaff) {
+        await pushNotificationService.syncPropertyTopics(staff_id);
+      }
+    }
+  }
+
+  private canSee(user: JWTClaims, delegation: { landlord_id: string; agency_id: string }) {
+    return user.role === 'super_admin' ||
+      delegation.landlord_id === user.user_id ||
+      (user.role === 'agency_admin' && delegation.agency_id === user.agency_id);
+  }
+}
+
+export const propertyDelegationsService = new PropertyDelegationsService();
@@ -1,12 +1,63 @@
 import { getPrisma } from '../config/prisma.js';
 import { supabaseRealtimeService } from './supabase-realtime.service.js';
 import admin from 'firebase-admin';
+import { Prisma } from '@prisma/client';
 import * as path from 'path';
 import { fileURLToPath } from 'url';
 import { readFileSync } from 'fs';
 
 const prisma = getPrisma();
 
+// Token hygiene: tokens the app hasn't refreshed in this long are treated as abandoned installs
+const STALE_TOKEN_DAYS = 60;
+// Deactivate a token after this many consecutive transient send failures
+const MAX_TOKEN_FAILURES = 5;
+// Inactive tokens are kept this long for troubleshooting, then deleted
+const INACTIVE_TOKEN_RETENTION_DAYS = 90;
+
+// FCM errors that mean the token will never work again
+const INVALID_TOKEN_ERRORS = [
+  'messaging/invalid-registration-token',
+  'messaging/registration-token-not-registered',
+];
+// FCM errors that are about this token but may not be final (e.g. a malformed token); they count
+// towards the failure limit
+const TOKEN_ERRORS = ['messaging/invalid-argument'];
+// FCM errors about our sender configuration rather than the token; they would fail every device
+const SENDER_ERRORS = ['messaging/mismatched-credential', 'messaging/third-party-auth-error'];
+
+// FCM accepts up to this many tokens per multicast call
+const FCM_BATCH_SIZE = 500;
+
+/**
+ * Delivery settings per notification type: Android channel and sound, how long FCM/APNs keep
+ * trying an offline device, and how iOS groups and surfaces the notification
+ */
+interface PushTemplate {
+  channelId: string;
+  sound: string;
+  priority?: 'high' | 'normal';
+  ttlSeconds: number;
+  // data key whose value groups notifications into one iOS thread
+  threadKey?: string;
+  interruptionLevel?: 'passive' | 'active' | 'time-sensitive';
+}
+
+const DEFAULT_PUSH_TEMPLATE: PushTemplate = { channelId: 'default', sound: 'default', ttlSeconds: 7 * 24 * 3600 };
+
+const PUSH_TEMPLATES: Record<string, PushTemplate> = {
+  emergency: { channelId: 'emergency', sound: 'emergency', priority: 'high', ttlSeconds: 3600, interruptionLevel: 'time-sensitive' },
+  message: { channelId: 'messages', sound: 'default', priority: 'high', ttlSeconds: 24 * 3600, threadKey: 'conversation_id' },
+  task: { channelId: 'tasks', sound: 'default', ttlSeconds: 24 * 3600, threadKey: 'task_id' },
+  maintenance: { channelId: 'maintenance', sound: 'default', ttlSeconds: 3 * 24 * 3600, threadKey: 'maintenance_id' },
+  payment: { channelId: 'payments', sound: 'default', ttlSeconds: 3 * 24 * 3600 },
+  invoice: { channelId: 'payments', sound: 'default', ttlSeconds: 3 * 24 * 3600 },
+  announcement: { channelId: 'announcements', sound: 'default', ttlSeconds: 3 * 24 * 3600, threadKey: 'property_id', interruptionLevel: 'passive' },
+};
+
+const templateFor = (notification: { notificationType?: string; category?: string }) =>
+  PUSH_TEMPLATES[notification.notificationType || ''] || PUSH_TEMPLATES[notification.category || ''] || DEFAULT_PUSH_TEMPLATE;
+
 // Initialize Firebase Admin SDK with service account
 let firebaseAdminInitialized = false;
 
@@ -128,128 +179,171 @@ interface PushNotificationData {
   sound?: string;
   badge?: number;
   actionUrl?: string;
+  // Devices show one notification per tag, so a topic send and a direct send of the same alert don't double up
+  tag?: string;
 }
 
 /**
- * Send FCM push notification to a single device token
- * Uses FCM V1 API with Firebase Admin SDK (requires service account JSON)
+ * FCM topic every device of staff assigned to the property is subscribed to
  */
-async function sendFCMNotification(
-  token: string,
-  platform: string,
-  notification: PushNotificationData
-): Promise<boolean> {
-  try {
-    // Initialize Firebase Admin SDK if not already initialized
-    initializeFirebaseAdmin();
-    
-    // Check if Firebase Admin is initialized
-    if (!admin.apps || admin.apps.length === 0) {
-      console.warn('⚠️ Firebase Admin SDK not initialized - skipping FCM push notification');
-      console.warn('   This usually means the service account JSON file was not found or is invalid');
-      return false;
-    }
-    
-    console.log(`📤 Attempting to send FCM notification to ${platform} device...`);
-    console.log(`   Token prefix: ${token.substring(0, 30)}...`);
-
-    // Prepare data payload (all values must be strings for FCM)
-    const dataPayload: Record<string, string> = {
-      notification_type: notification.notificationType || 'push',
-      category: notification.category || 'general',
-      action_url: notification.actionUrl || '',
-    };
-
-    // Add any additional data (convert all values to strings)
-    if (notification.data) {
-      Object.keys(notification.data).forEach(key => {
-        const value = notification.data![key];
-        dataPayload[key] = typeof value === 'string' ? value : JSON.stringify(value);
-      });
-    }
-    
-    // Ensure we include notification ID if available
-    if (notification.data?.notificationId) {
-      dataPayload['id'] = notification.data.notificationId;
-    }
-    
-    // Ensure we include sender_id and recipient_id for messages
-    if (notification.data?.sender_id) {
-      dataPayload['sender_id'] = notification.data.sender_id;
-    }
-    if (notification.data?.recipient_id) {
-      dataPayload['recipient_id'] = notification.data.recipient_id;
-    }
+export const propertyTopic = (propertyId: string) => `property-${propertyId}`;
 
-    // Build FCM V1 message
-    const message: admin.messaging.Message = {
-      token: token,
+/**
+ * FCM V1 payload shared by device and topic sends
+ */
+function buildFCMMessage(notification: PushNotificationData): Omit<admin.messaging.TokenMessage, 'token'> {
+  // Prepare data payload (all values must be strings for FCM)
+  const dataPayload: Record<string, string> = {
+    notification_type: notification.notificationType || 'push',
+    category: notification.category || 'general',
+    action_url: notification.actionUrl || '',
+  };
+
+  // Add any additional data (convert all values to strings)
+  if (notification.data) {
+    Object.keys(notification.data).forEach(key => {
+      const value = notification.data![key];
+      dataPayload[key] = typeof value === 'string' ? value : JSON.stringify(value);
+    });
+  }
+  
+  // Ensure we include notification ID if available
+  if (notification.data?.notificationId) {
+    dataPayload['id'] = notification.data.notificationId;
+  }
+  
+  // Ensure we include sender_id and recipient_id for messages
+  if (notification.data?.sender_id) {
+    dataPayload['sender_id'] = notification.data.sender_id;
+  }
+  if (notification.data?.recipient_id) {
+    dataPayload['recipient_id'] = notification.data.recipient_id;
+  }
+
+  const template = templateFor(notification);
+  const high = notification.priority === 'high' || template.priority === 'high';
+  const sound = notification.sound || template.sound;
+  const threadId = template.threadKey ? dataPayload[template.threadKey] : undefined;
+
+  // Build FCM V1 message
+  return {
+    notification: {
+      title: notification.title,
+      body: notification.body,
+    },
+    data: dataPayload,
+    android: {
+      priority: high ? 'high' : 'normal',
+      ttl: template.ttlSeconds * 1000,
       notification: {
-        title: notification.title,
-        body: notification.body,
+        sound,
+        channelId: template.channelId,
+        priority: high ? 'high' : 'default',
+        ...(notification.tag && { tag: notification.tag }),
       },
-      data: dataPayload,
-      android: {
-        priority: notification.priority === 'high' ? 'high' : 'normal',
-        notification: {
-          sound: notification.sound || 'default',
-          channelId: 'default', // You may want to create a custom channel
-          priority: notification.priority === 'high' ? 'high' : 'default',
-        },
+    },
+    apns: {
+      headers: {
+        'apns-priority': high ? '10' : '5',
+        'apns-expiration': String(Math.floor(Date.now() / 1000) + template.ttlSeconds),
+        ...(notification.tag && { 'apns-collapse-id': notification.tag }),
       },
-      apns: {
-        headers: {
-          'apns-priority': notification.priority === 'high' ? '10' : '5',
-        },
-        payload: {
-          aps: {
-            alert: {
-              title: notification.title,
-              body: notification.body,
-            },
-            sound: notification.sound || 'default',
-            badge: notification.badge,
-            contentAvailable: true,
+      payload: {
+        aps: {
+          alert: {
+            title: notification.title,
+            body: notification.body,
           },
+          sound: sound === 'default' ? 'default' : `${sound}.caf`,
+          badge: notification.badge,
+          contentAvailable: true,
+          ...(threadId ? { threadId } : {}),
+          ...(template.interruptionLevel && { 'interruption-level': template.interruptionLevel }),
         },
       },
-      webpush: {
-        notification: {
-          title: notification.title,
-          body: notification.body,
-          icon: notification.imageUrl || '/icon-192x192.png',
-          badge: '/badge-72x72.png',
-        },
+    },
+    webpush: {
+      notification: {
+        title: notification.title,
+        body: notification.body,
+        icon: notification.imageUrl || '/icon-192x192.png',
+        badge: '/badge-72x72.png',
+        ...(notification.tag && { tag: notification.tag }),
       },
-    };
+    },
+  };
+}
 
-    // Send using FCM V1 API
-    const response = await admin.messaging().send(message);
-    
-    console.log(`✅ FCM V1 notification sent successfully to ${platform} device: ${response}`);
-    return true;
-  } catch (error: any) {
-    console.error(`❌ Error sending FCM V1 notification:`, error);
-    console.error(`   Error code: ${error.code || 'unknown'}`);
-    console.error(`   Error message: ${error.message || 'unknown'}`);
-    console.error(`   Platform: ${platform}`);
-    console.error(`   Token prefix: ${token.substring(0, 30)}...`);
-    
-    // Handle specific FCM errors
-    if (error.code === 'messaging/invalid-registration-token' || 
-        error.code === 'messaging/registration-token-not-registered') {
-      console.warn(`⚠️ Invalid or unregistered token: ${token.substring(0, 20)}...`);
-      // You might want to mark this token as invalid in the database
-    } else if (error.code === 'messaging/invalid-argument') {
-      console.error(`⚠️ Invalid argument in FCM message. Check notification payload.`);
-    } else if (error.code === 'app/invalid-credential') {
-      console.error(`⚠️ Firebase Admin SDK credential is invalid. Check service account JSON.`);
-    } else if (error.code === 'app/no-app') {
-      console.error(`⚠️ Firebase Admin SDK not initialized.`);
+/**
+ * Send FCM push notification to a single device token
+ * Uses FCM V1 API with Firebase Admin SDK (requires service account JSON)
+ */
+interface FCMSendResult {
+  sent: boolean;
+  invalidToken?: boolean;
+  // FCM rejected this token in particular; false when the whole SDK or batch failed, which says
+  // nothing about the token and must not count against it
+  tokenError?: boolean;
+  error?: string;
+}
+
+/**
+ * Send one notification to many device tokens, in multicast batches. Results line up with the tokens.
+ */
+async function sendFCMBatch(
+  tokens: Array<{ token: string; platform: string }>,
+  notification: PushNotificationData
+): Promise<FCMSendResult[]> {
+  // Initialize Firebase Admin SDK if not already initialized
+  initializeFirebaseAdmin();
+
+  // Check if Firebase Admin is initialized
+  if (!admin.apps || admin.apps.length === 0) {
+    console.warn('⚠️ Firebase Admin SDK not initialized - skipping FCM push notification');
+    console.warn('   This usually means the service account JSON file was not found or is invalid');
+    return tokens.map(() => ({ sent: false, error: 'Firebase Admin SDK not initialized' }));
+  }
+
+  const payload = buildFCMMessage(notification);
+  const results: FCMSendResult[] = [];
+
+  for (let i = 0; i < tokens.length; i += FCM_BATCH_SIZE) {
+    const batch = tokens.slice(i, i + FCM_BATCH_SIZE);
+    try {
+      // Send using FCM V1 API
+      const response = await admin.messaging().sendEachForMulticast({ ...payload, tokens: batch.map(t => t.token) });
+      response.responses.forEach((r, index) => {
+        if (r.success) {
+          results.push({ sent: true });
+          return;
+        }
+        const code = r.error?.code || 'unknown';
+        if (INVALID_TOKEN_ERRORS.includes(code)) {
+          console.warn(`⚠️ Invalid or unregistered ${batch[index].platform} token: ${batch[index].token.substring(0, 20)}...`);
+          results.push({ sent: false, invalidToken: true, tokenError: true, error: code });
+        } else if (TOKEN_ERRORS.includes(code)) {
+          results.push({ sent: false, tokenError: true, error: `${code}: ${r.error?.message || 'unknown'}` });
+        } else {
+          // Sender misconfiguration and transient FCM trouble (unavailable, quota, internal) say nothing about the token
+          if (SENDER_ERRORS.includes(code)) {
+            console.error(`⚠️ FCM rejected our sender credentials (${code}); check the Firebase and APNs configuration`);
+          }
+          results.push({ sent: false, error: `${code}: ${r.error?.message || 'unknown'}` });
+        }
+      });
+      console.log(`✅ FCM V1 batch: ${response.successCount} sent, ${response.failureCount} failed`);
+    } catch (error: any) {
+      // The whole call failed (credentials, network): every token in the batch is a transient failure
+      console.error(`❌ Error sending FCM V1 batch:`, error.code || 'unknown', error.message || 'unknown');
+      if (error.code === 'app/invalid-credential') {
+        console.error(`⚠️ Firebase Admin SDK credential is invalid. Check service account JSON.`);
+      }
+      const message = error.code ? `${error.code}: ${error.message}` : error.message;
+      batch.forEach(() => results.push({ sent: false, error: message }));
     }
-    
-    return false;
   }
+
+  return results;
 }
 
 /**
@@ -269,15 +363,36 @@ export const pushNotificationService = {
    * - web: Web Push subscription JSON (for browser Push API)
    * - ios: APNs token (handled by client when listening to Supabase channels)
    * - android: Push token (handled by client when listening to Supabase channels)
+   * Apps re-register on every token refresh, so the push preference is only switched on when
+   * the user explicitly opts in (`optIn`), never by registration alone.
    */
   async registerToken(
     userId: string,
     token: string,
     platform: 'web' | 'ios' | 'android',
     deviceId?: string,
-    deviceInfo?: any
+    deviceInfo?: any,
+    options: { optIn?: boolean } = {}
   ): Promise<boolean> {
     try {
+      // A device token belongs to whoever is signed in on it now; drop it from previous accounts
+      await this.releaseTopics({ token, user_id: { not: userId }, is_active: true });
+      await prisma.$executeRaw`
+        UPDATE push_notification_tokens
+        SET is_active = false, deactivated_reason = 'replaced', updated_at = NOW()
+        WHERE token = ${token} AND user_id <> ${userId}::uuid AND is_active = true
+      `;
+
+      // FCM/APNs rotate tokens; keep only the latest token per device
+      if (deviceId) {
+        await this.releaseTopics({ user_id: userId, device_id: deviceId, token: { not: token }, is_active: true });
+        await prisma.$executeRaw`
+          UPDATE push_notification_tokens
+          SET is_active = false, deactivated_reason = 'replaced', updated_at = NOW()
+          WHERE user_id = ${userId}::uuid AND device_id = ${deviceId} AND token <> ${token} AND is_active = true
+        `;
+      }
+
       await prisma.$executeRaw`
         INSERT INTO push_notification_tokens (
           user_id, token, platform, device_id, device_info, is_active, last_used_at, updated_at
@@ -297,9 +412,20 @@ export const pushNotificationService = {
             device_id = COALESCE(${deviceId || null}, push_notification_tokens.device_id),
             device_info = COALESCE(${deviceInfo ? JSON.stringify(deviceInfo) : null}::jsonb, push_notification_tokens.device_info),
             is_active = true,
+            failure_count = 0,
+            last_error = NULL,
+            deactivated_reason = NULL,
             last_used_at = NOW(),
             updated_at = NOW()
       `;
+      if (options.optIn) {
+        await prisma.$executeRaw`
+          UPDATE tenant_preferences
+          SET enable_push_notifications = true, updated_at = NOW()
+          WHERE user_id = ${userId}::uuid AND enable_push_notifications = false
+        `;
+      }
+      await this.syncPropertyTopics(userId);
       console.log(`✅ Push token registered for user ${userId} (${platform}) via Supabase`);
       return true;
     } catch (error) {
@@ -313,17 +439,18 @@ export const pushNotificationService = {
    */
   async unregisterToken(userId: string, token?: string): Promise<boolean> {
     try {
+      await this.releaseTopics(token ? { user_id: userId, token } : { user_id: userId });
       if (token) {
         await prisma.$executeRaw`
           UPDATE push_notification_tokens
-          SET is_active = false, updated_at = NOW()
+          SET is_active = false, deactivated_reason = 'unregistered', updated_at = NOW()
           WHERE user_id = ${userId}::uuid AND token = ${token}
         `;
       } else {
         await prisma.$executeRaw`
           UPDATE push_notification_tokens
-          SET is_active = false, updated_at = NOW()
-          WHERE user_id = ${userId}::uuid
+          SET is_active = false, deactivated_reason = 'unregistered', updated_at = NOW()
+          WHERE user_id = ${userId}::uuid AND is_active = true
         `;
       }
       console.log(`✅ Push token unregistered for user ${userId}`);
@@ -334,6 +461,203 @@ export const pushNotificationService = {
     }
   },
 
+  /**
+   * List a user's registered devices (tokens are masked)
+   */
+  async getUserDevices(userId: string): Promise<any[]> {
+    const devices = await prisma.pushNotificationToken.findMany({
+      where: { user_id: userId, is_active: true },
+      select: {
+        id: true,
+        token: true,
+        platform: true,
+        device_id: true,
+        device_info: true,
+        last_used_at: true,
+        failure_count: true,
+        created_at: true,
+      },
+      orderBy: { last_used_at: 'desc' },
+    });
+
+    return devices.map(device => ({
+      ...device,
+      token: `${device.token.substring(0, 12)}...`,
+    }));
+  },
+
+  /**
+   * Unregister one of the user's devices by id (e.g. "sign out of this phone" from another device)
+   */
+  async unregisterDevice(userId: string, deviceTokenId: string): Promise<void> {
+    await this.releaseTopics({ id: deviceTokenId, user_id: userId });
+    const result = await prisma.pushNotificationToken.updateMany({
+      where: { id: deviceTokenId, user_id: userId, is_active: true },
+      data: { is_active: false, deactivated_reason: 'unregistered', updated_at: new Date() },
+    });
+
+    if (result.count === 0) {
+      throw new Error('Device not found');
+    }
+  },
+
+  /**
+   * Subscribe the user's devices to the topics of the properties they are assigned to and drop
+   * the rest. Called whenever a device registers or the user's property assignments change.
+   */
+  async syncPropertyTopics(userId: string): Promise<void> {
+    try {
+      initializeFirebaseAdmin();
+      if (!admin.apps || admin.apps.length === 0) {
+        return;
+      }
+      const [assignments, tokens] = await Promise.all([
+        prisma.staffPropertyAssignment.findMany({
+          where: { staff_id: userId, status: 'active' },
+          select: { property_id: true },
+        }),
+        prisma.pushNotificationToken.findMany({
+          where: { user_id: userId, is_active: true },
+          select: { id: true, token: true, topics: true },
+        }),
+      ]);
+      const wanted = assignments.map(a => propertyTopic(a.property_id));
+      const topics = new Map(tokens.map(t => [t.token, new Set(t.topics)]));
+
+      for (const topic of new Set([...wanted, ...tokens.flatMap(t => t.topics)])) {
+        const subscribe = wanted.includes(topic);
+        const pending = tokens.filter(t => t.topics.includes(topic) !== subscribe).map(t => t.token);
+        if (!pending.length) continue;
+        const response = subscribe
+          ? await admin.messaging().subscribeToTopic(pending, topic)
+          : await admin.messaging().unsubscribeFromTopic(pending, topic);
+        const failed = new Set(response.errors.map(e => e.index));
+        pending.forEach((token, index) => {
+          if (failed.has(index)) return;
+          if (subscribe) topics.get(token)!.add(topic);
+          else topics.get(token)!.delete(topic);
+        });
+        if (response.failureCount > 0) {
+          console.warn(`⚠️ ${response.failureCount} device(s) failed to ${subscribe ? 'subscribe to' : 'unsubscribe from'} ${topic}`);
+        }
+      }
+
+      for (const t of tokens) {
+        const next = [...topics.get(t.token)!];
+        if (next.length !== t.topics.length || next.some(topic => !t.topics.includes(topic))) {
+          await prisma.pushNotificationToken.update({ where: { id: t.id }, data: { topics: next, updated_at: new Date() } });
+        }
+      }
+    } catch (error) {
+      console.error(`Error syncing property topics for user ${userId}:`, error);
+    }
+  },
+
+  /**
+   * Unsubscribe matching tokens from every topic, before they are deactivated or handed to another account
+   */
+  async releaseTopics(where: Prisma.PushNotificationTokenWhereInput): Promise<void> {
+    try {
+      const tokens = await prisma.pushNotificationToken.findMany({
+        where: { ...where, topics: { isEmpty: false } },
+        select: { id: true, token: true, topics: true },
+      });
+      if (!tokens.length) return;
+
+      initializeFirebaseAdmin();
+      if (admin.apps && admin.apps.length > 0) {
+        for (const topic of new Set(tokens.flatMap(t => t.topics))) {
+          await admin.messaging().unsubscribeFromTopic(tokens.filter(t => t.topics.includes(topic)).map(t => t.token), topic);
+        }
+      }
+      await prisma.pushNotificationToken.updateMany({
+        where: { id: { in: tokens.map(t => t.id) } },
+        data: { topics: [], updated_at: new Date() },
+      });
+    } catch (error) {
+      console.error('Error releasing push topics:', error);
+    }
+  },
+
+  /**
+   * Push to every device subscribed to a property's topic in one FCM call. Topic sends skip
+   * per-user preferences, so they are reserved for urgent work, emergencies and announcements.
+   */
+  async sendToProperty(propertyId: string, notification: PushNotificationData): Promise<boolean> {
+    try {
+      initializeFirebaseAdmin();
+      if (!admin.apps || admin.apps.length === 0) {
+        console.warn('⚠️ Firebase Admin SDK not initialized - skipping property topic push');
+        return false;
+      }
+      const response = await admin.messaging().send({ ...buildFCMMessage(notification), topic: propertyTopic(propertyId) });
+      console.log(`✅ FCM topic notification sent to property ${propertyId}: ${response}`);
+      return true;
+    } catch (error: any) {
+      console.error(`❌ Error sending FCM topic notification to property ${propertyId}:`, error.code || error.message);
+      return false;
+    }
+  },
+
+  /**
+   * Record the outcome of a send so dead tokens stop being retried. Failures of the whole SDK or
+   * batch (no credentials, network) are not the token's fault and leave it alone.
+   */
+  async recordTokenResult(userId: string, token: string, result: FCMSendResult): Promise<void> {
+    if (!result.sent && !result.tokenError) {
+      return;
+    }
+    try {
+      if (result.sent) {
+        await prisma.$executeRaw`
+          UPDATE push_notification_tokens
+          SET failure_count = 0, last_error = NULL
+          WHERE user_id = ${userId}::uuid AND token = ${token} AND failure_count > 0
+        `;
+      } else if (result.invalidToken) {
+        await prisma.$executeRaw`
+          UPDATE push_notification_tokens
+          SET is_active = false, deactivated_reason = 'invalid_token', last_error = ${result.error || null}, updated_at = NOW()
+          WHERE token = ${token}
+        `;
+        console.log(`🧹 Deactivated invalid push token for user ${userId}`);
+      } else {
+        await prisma.$executeRaw`
+          UPDATE push_notification_tokens
+          SET failure_count = failure_count + 1,
+              last_error = ${result.error || null},
+              is_active = CASE WHEN failure_count + 1 >= ${MAX_TOKEN_FAILURES} THEN false ELSE is_active END,
+              deactivated_reason = CASE WHEN failure_count + 1 >= ${MAX_TOKEN_FAILURES} THEN 'too_many_failures' ELSE deactivated_reason END,
+              updated_at = NOW()
+          WHERE user_id = ${userId}::uuid AND token = ${token}
+        `;
+      }
+    } catch (error) {
+      console.error(`Error recording push token result for user ${userId}:`, error);
+    }
+  },
+
+  /**
+   * Deactivate tokens the app hasn't refreshed recently and purge long-inactive ones
+   */
+  async cleanupStaleTokens(): Promise<{ deactivated: number; deleted: number }> {
+    const staleBefore = new Date();
+    staleBefore.setDate(staleBefore.getDate() - STALE_TOKEN_DAYS);
+    const purgeBefore = new Date();
+    purgeBefore.setDate(purgeBefore.getDate() - INACTIVE_TOKEN_RETENTION_DAYS);
+
+    const deactivated = await prisma.pushNotificationToken.updateMany({
+      where: { is_active: true, last_used_at: { lt: staleBefore } },
+      data: { is_active: false, deactivated_reason: 'stale', updated_at: new Date() },
+    });
+
+    const deleted = await prisma.pushNotificationToken.deleteMany({
+      where: { is_active: false, updated_at: { lt: purgeBefore } },
+    });
+
+    return { deactivated: deactivated.count, deleted: deleted.count };
+  },
+
   /**
    * Get all active tokens for a user
    */
@@ -385,22 +709,15 @@ export const pushNotificationService = {
       
       // Send FCM push notifications to all registered tokens
       if (tokens.length > 0) {
-        for (const tokenInfo of tokens) {
-          try {
-            const sent = await sendFCMNotification(tokenInfo.token, tokenInfo.platform, notification);
-            if (sent) {
-              sentCount++;
-            } else {
-              failedCount++;
-              errors.push(`Failed to send to ${tokenInfo.platform} device (check backend logs for details)`);
-            }
-          } catch (error: any) {
-            console.error(`❌ Error sending FCM to token ${tokenInfo.token.substring(0, 30)}...:`, error);
-            console.error(`   Error code: ${error.code || 'unknown'}`);
-            console.error(`   Error message: ${error.message || 'unknown'}`);
+        const results = await sendFCMBatch(tokens, notification);
+        for (const [index, result] of results.entries()) {
+          const tokenInfo = tokens[index];
+          await this.recordTokenResult(userId, tokenInfo.token, result);
+          if (result.sent) {
+            sentCount++;
+          } else {
             failedCount++;
-            const errorMsg = error.code ? `${error.code}: ${error.message}` : error.message || 'Unknown error';
-            errors.push(`Error sending to ${tokenInfo.platform}: ${errorMsg}`);
+            errors.push(`Failed to send to ${tokenInfo.platform} device: ${result.error || 'unknown error'}`);
           }
         }
         console.log(`📱 FCM: Sent ${sentCount}, Failed ${failedCount} for user ${userId}`);
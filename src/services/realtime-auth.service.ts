@@ -0,0 +1,73 @@
+import jwt from 'jsonwebtoken';
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+
+const prisma = getPrisma();
+
+// Created by migrations/20261017_realtime_channel_authorization.sql
+const REALTIME_ROLE = 'letrents_realtime';
+const REALTIME_AUDIENCE = 'letrents-realtime';
+
+/**
+ * Realtime tokens for clients connecting to Supabase Realtime. Each token names the channels
+ * (topics) its user may join, and the realtime.messages policy checks joins against that list.
+ * Tokens never outlive the API session, and Realtime closes channels when they expire, so
+ * clients refresh before expires_at and after joining or leaving a conversation.
+ */
+export const realtimeAuthService = {
+  /**
+   * The user's own channels, their active conversation rooms and their co-participants' presence
+   */
+  async allowedTopics(user: JWTClaims): Promise<string[]> {
+    const participations = await prisma.conversationParticipant.findMany({
+      where: { user_id: user.user_id, left_at: null },
+      select: { conversation_id: true },
+    });
+    const conversationIds = participations.map(p => p.conversation_id);
+    const contacts = conversationIds.length
+      ? await prisma.conversationParticipant.findMany({
+          where: { conversation_id: { in: conversationIds }, left_at: null, user_id: { not: user.user_id } },
+          select: { user_id: true },
+          distinct: ['user_id'],
+        })
+      : [];
+
+    return [
+      ...['messages', 'read_status', 'typing', 'notifications', 'conversations', 'presence'].map(prefix => `${prefix}:${user.user_id}`),
+      ...conversationIds.map(id => `conversation:${id}`),
+      ...contacts.map(c => `presence:${c.user_id}`),
+    ];
+  },
+
+  async issueToken(user: JWTClaims) {
+    if (!env.realtime.jwtSecret) {
+      throw new Error('Realtime authentication is not configured');
+    }
+
+    const now = Math.floor(Date.now() / 1000);
+    const exp = Math.min(now + env.realtime.tokenTtlMinutes * 60, user.exp || Infinity);
+    if (exp <= now) {
+      throw new Error('Session expired');
+    }
+
+    const topics = await this.allowedTopics(user);
+    const token = jwt.sign(
+      {
+        sub: user.user_id,
+        // A role of its own that only the realtime.messages policy grants anything to, so the
+        // token is no use against PostgREST or Storage
+        role: REALTIME_ROLE,
+        aud: REALTIME_AUDIENCE,
+        session_id: user.session_id,
+        realtime_topics: topics,
+        iat: now,
+        exp,
+      },
+      env.realtime.jwtSecret,
+      { algorithm: 'HS256' }
+    );
+
+    return { token, expires_at: new Date(exp * 1000).toISOString(), topics, private_channels: env.realtime.privateChannels };
+  },
+};
@@ -0,0 +1,137 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export const REPORT_AUDIT_ACTIONS = ['view', 'export', 'download_link', 'scheduled'];
+
+export interface ReportAccessEntry {
+  user: Pick<JWTClaims, 'user_id' | 'email' | 'role' | 'company_id'>;
+  action: string;
+  report_type: string;
+  format?: string | null;
+  parameters?: Record<string, any>;
+  resource_type?: string | null;
+  resource_id?: string | null;
+  ip_address?: string | null;
+  user_agent?: string | null;
+}
+
+interface ReportAuditFilters {
+  company_id?: string;
+  user_id?: string;
+  report_type?: string;
+  action?: string;
+  start_date?: string;
+  end_date?: string;
+  page?: number;
+  limit?: number;
+}
+
+const AUDIT_ROLES = ['super_admin', 'agency_admin'];
+const MAX_LIMIT = 200;
+const UUID_PATTERN = /^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/i;
+// Parameters are for accountability, not a copy of the request: long values are cut
+const MAX_PARAMETER_LENGTH = 500;
+
+const compact = (value: any): any => {
+  if (value === null || value === undefined) return value;
+  if (typeof value === 'string') return value.length > MAX_PARAMETER_LENGTH ? `${value.slice(0, MAX_PARAMETER_LENGTH)}…` : value;
+  if (Array.isArray(value)) return value.slice(0, 50).map(compact);
+  if (typeof value === 'object') return Object.fromEntries(Object.entries(value).map(([k, v]) => [k, compact(v)]));
+  return value;
+};
+
+/**
+ * Who generated, exported or fetched a download link for which report, with what parameters and
+ * when. Recording never gets in the way of the report itself.
+ */
+export class ReportAuditService {
+  private prisma = getPrisma();
+
+  async record(entry: ReportAccessEntry) {
+    try {
+      await this.prisma.reportAccessLog.create({
+        data: {
+          company_id: entry.user.company_id || null,
+          user_id: entry.user.user_id,
+          user_email: entry.user.email || null,
+          user_role: entry.user.role,
+          action: entry.action,
+          report_type: entry.report_type,
+          format: entry.format || null,
+          parameters: compact(entry.parameters || {}),
+          resource_type: entry.resource_type || null,
+          resource_id: entry.resource_id && UUID_PATTERN.test(entry.resource_id) ? entry.resource_id : null,
+          ip_address: entry.ip_address ? entry.ip_address.slice(0, 45) : null,
+          user_agent: entry.user_agent || null,
+        },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to record report access:', error.message);
+    }
+  }
+
+  /**
+   * The company's report access history for agency admins; super admins see every company or one
+   */
+  async list(user: JWTClaims, filters: ReportAuditFilters = {}) {
+    if (!AUDIT_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view the report audit trail');
+    }
+    if (filters.action && !REPORT_AUDIT_ACTIONS.includes(filters.action)) {
+      throw new Error(`action must be one of: ${REPORT_AUDIT_ACTIONS.join(', ')}`);
+    }
+    const start = filters.start_date ? new Date(filters.start_date) : undefined;
+    const end = filters.end_date ? new Date(filters.end_date) : undefined;
+    if ((start && isNaN(start.getTime())) || (end && isNaN(end.getTime()))) {
+      throw new Error('start_date and end_date must be valid dates');
+    }
+    // End dates given as a day include the whole day
+    if (end && !String(filters.end_date).includes('T')) {
+      end.setHours(23, 59, 59, 999);
+    }
+
+    const where: any = {
+      ...(user.role === 'super_admin'
+        ? filters.company_id && { company_id: filters.company_id }
+        : { company_id: user.company_id }),
+      ...(filters.user_id && { user_id: filters.user_id }),
+      ...(filters.report_type && { report_type: filters.report_type }),
+      ...(filters.action && { action: filters.action }),
+      ...((start || end) && { created_at: { ...(start && { gte: start }), ...(end && { lte: end }) } }),
+    };
+    const limit = Math.min(Math.max(Number(filters.limit) || 50, 1), MAX_LIMIT);
+    const page = Math.max(Number(filters.page) || 1, 1);
+
+    const [entries, total, byReport, byUser] = await Promise.all([
+      this.prisma.reportAccessLog.findMany({
+        where,
+        include: { user: { select: { id: true, first_name: true, last_name: true } } },
+        orderBy: { created_at: 'desc' },
+        take: limit,
+        skip: (page - 1) * limit,
+      }),
+      this.prisma.reportAccessLog.count({ where }),
+      this.prisma.reportAccessLog.groupBy({ by: ['report_type'], where, _count: { _all: true } }),
+      this.prisma.reportAccessLog.groupBy({ by: ['user_id', 'user_email'], where, _count: { _all: true } }),
+    ]);
+
+    return {
+      entries: entries.map(({ user: actor, ...entry }) => ({
+        ...entry,
+        user_name: actor ? `${actor.first_name} ${actor.last_name}`.trim() : null,
+      })),
+      summary: {
+        total,
+        by_report_type: byReport
+          .map(r => ({ report_type: r.report_type, count: r._count._all }))
+          .sort((a, b) => b.count - a.count),
+        by_user: byUser
+          .map(u => ({ user_id: u.user_id, user_email: u.user_email, count: u._count._all }))
+          .sort((a, b) => b.count - a.count),
+      },
+      pagination: { page, limit, total, pages: Math.ceil(total / limit) },
+    };
+  }
+}
+
+export const reportAuditService = new ReportAuditService();
@@ -0,0 +1,451 @@
+import { MaintenanceStatus, PaymentMethod, PaymentStatus, PaymentType, PriorityLevel, UnitStatus, UnitType } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { ExcelColumnType } from '../utils/excel-export.js';
+import { buildWhereClause } from '../utils/roleBasedFiltering.js';
+
+export interface ReportTemplateRequest {
+  name?: string;
+  description?: string | null;
+  entity?: string;
+  columns?: string[];
+  filters?: Record<string, any>;
+  group_by?: string | null;
+  sort_by?: string | null;
+  sort_direction?: string;
+  is_shared?: boolean;
+}
+
+interface ColumnDef {
+  label: string;
+  type: ExcelColumnType;
+  select: Record<string, any>;
+  get: (row: any) => any;
+}
+
+interface FilterDef {
+  label: string;
+  // Allowed values for list filters; comma-separated values match any of them
+  values?: string[];
+  kind: 'list' | 'id' | 'date_from' | 'date_to' | 'min' | 'max';
+  where: (value: any) => Record<string, any>;
+}
+
+interface EntityDef {
+  label: string;
+  model: 'unit' | 'payment' | 'maintenanceRequest';
+  scope: (user: JWTClaims) => Record<string, any>;
+  defaultColumns: string[];
+  columns: Record<string, ColumnDef>;
+  filters: Record<string, FilterDef>;
+}
+
+// Roles that see every template in their company; everyone else sees their own and shared ones
+const COMPANY_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const MAX_ROWS = 5000;
+const MAX_COLUMNS = 20;
+
+const field = (label: string, type: ExcelColumnType, key: string): ColumnDef => ({
+  label,
+  type,
+  select: { [key]: true },
+  get: row => {
+    const value = row[key];
+    if (value == null) return null;
+    if (type === 'currency' || type === 'number') return Number(value);
+    if (type === 'date') return (value as Date).toISOString().split('T')[0];
+    return value;
+  },
+});
+const person = (label: string, relation: string): ColumnDef => ({
+  label,
+  type: 'string',
+  select: { [relation]: { select: { first_name: true, last_name: true } } },
+  get: row => (row[relation] ? `${row[relation].first_name} ${row[relation].last_name}`.trim() : null),
+});
+const yesNo = (label: string, key: string): ColumnDef => ({
+  label,
+  type: 'string',
+  select: { [key]: true },
+  get: row => (row[key] ? 'Yes' : 'No'),
+});
+const split = (value: any) => String(value).split(',').map(v => v.trim()).filter(Boolean);
+const dayStart = (value: any) => new Date(`${String(value).split('T')[0]}T00:00:00.000Z`);
+const dayEnd = (value: any) => new Date(`${String(value).split('T')[0]}T23:59:59.999Z`);
+
+const listFilter = (label: string, key: string, values?: string[]): FilterDef => ({
+  label,
+  values,
+  kind: 'list',
+  where: value => ({ [key]: { in: split(value) } }),
+});
+const dateFilters = (key: string, label: string): Record<string, FilterDef> => ({
+  start_date: { label: `${label} from`, kind: 'date_from', where: value => ({ [key]: { gte: dayStart(value) } }) },
+  end_date: { label: `${label} to`, kind: 'date_to', where: value => ({ [key]: { lte: dayEnd(value) } }) },
+});
+const amountFilters = (key: string, label: string): Record<string, FilterDef> => ({
+  [`min_${key}`]: { label: `Minimum ${label}`, kind: 'min', where: value => ({ [key]: { gte: Number(value) } }) },
+  [`max_${key}`]: { label: `Maximum ${label}`, kind: 'max', where: value => ({ [key]: { lte: Number(value) } }) },
+});
+
+/**
+ * What a custom report can be built from: the columns users can pick, the filters they can set,
+ * and how rows are scoped to the user's access
+ */
+export const REPORT_ENTITIES: Record<string, EntityDef> = {
+  units: {
+    label: 'Units',
+    model: 'unit',
+    scope: user => ({ property: buildWhereClause(user) }),
+    defaultColumns: ['property', 'unit_number', 'unit_type', 'status', 'rent_amount', 'tenant'],
+    columns: {
+      property: { label: 'Property', type: 'string', select: { property: { select: { name: true } } }, get: row => row.property?.name ?? null },
+      unit_number: field('Unit', 'string', 'unit_number'),
+      unit_type: field('Unit Type', 'string', 'unit_type'),
+      status: field('Status', 'string', 'status'),
+      condition: field('Condition', 'string', 'condition'),
+      furnishing_type: field('Furnishing', 'string', 'furnishing_type'),
+      number_of_bedrooms: field('Bedrooms', 'integer', 'number_of_bedrooms'),
+      number_of_bathrooms: field('Bathrooms', 'integer', 'number_of_bathrooms'),
+      rent_amount: field('Rent', 'currency', 'rent_amount'),
+      deposit_amount: field('Deposit', 'currency', 'deposit_amount'),
+      currency: field('Currency', 'string', 'currency'),
+      tenant: person('Tenant', 'current_tenant'),
+      lease_start_date: field('Lease Start', 'date', 'lease_start_date'),
+      lease_end_date: field('Lease End', 'date', 'lease_end_date'),
+      created_at: field('Created', 'date', 'created_at'),
+    },
+    filters: {
+      property_id: { label: 'Property', kind: 'id', where: value => ({ property_id: { in: split(value) } }) },
+      status: listFilter('Status', 'status', Object.values(UnitStatus)),
+      unit_type: listFilter('Unit type', 'unit_type', Object.values(UnitType)),
+      ...amountFilters('rent_amount', 'rent'),
+    },
+  },
+  payments: {
+    label: 'Payments',
+    model: 'payment',
+    scope: user => buildWhereClause(user, {}, 'payment'),
+    defaultColumns: ['payment_date', 'receipt_number', 'tenant', 'property', 'unit', 'payment_type', 'amount', 'status'],
+    columns: {
+      payment_date: field('Payment Date', 'date', 'payment_date'),
+      receipt_number: field('Receipt', 'string', 'receipt_number'),
+      tenant: person('Tenant', 'tenant'),
+      property: {
+        label: 'Property',
+        type: 'string',
+        select: { property: { select: { name: true } }, unit: { select: { property: { select: { name: true } } } } },
+        get: row => row.property?.name ?? row.unit?.property?.name ?? null,
+      },
+      unit: { label: 'Unit', type: 'string', select: { unit: { select: { unit_number: true } } }, get: row => row.unit?.unit_number ?? null },
+      payment_type: field('Type', 'string', 'payment_type'),
+      payment_method: field('Method', 'string', 'payment_method'),
+      payment_period: field('Period', 'string', 'payment_period'),
+      amount: field('Amount', 'currency', 'amount'),
+      currency: field('Currency', 'string', 'currency'),
+      status: field('Status', 'string', 'status'),
+      reference_number: field('Reference', 'string', 'reference_number'),
+    },
+    filters: {
+      property_id: {
+        label: 'Property',
+        kind: 'id',
+        where: value => ({ OR: [{ property_id: { in: split(value) } }, { property_id: null, unit: { property_id: { in: split(value) } } }] }),
+      },
+      status: listFilter('Status', 'status', Object.values(PaymentStatus)),
+      payment_type: listFilter('Type', 'payment_type', Object.values(PaymentType)),
+      payment_method: listFilter('Method', 'payment_method', Object.values(PaymentMethod)),
+      ...dateFilters('payment_date', 'Paid'),
+      ...amountFilters('amount', 'amount'),
+    },
+  },
+  maintenance: {
+    label: 'Maintenance requests',
+    model: 'maintenanceRequest',
+    scope: user => ({ property: buildWhereClause(user) }),
+    defaultColumns: ['requested_date', 'property', 'unit', 'title', 'category', 'priority', 'status', 'actual_cost'],
+    columns: {
+      requested_date: field('Requested', 'date', 'requested_date'),
+      property: { label: 'Property', type: 'string', select: { property: { select: { name: true } } }, get: row => row.property?.name ?? null },
+      unit: { label: 'Unit', type: 'string', select: { unit: { select: { unit_number: true } } }, get: row => row.unit?.unit_number ?? null },
+      title: field('Title', 'string', 'title'),
+      category: field('Category', 'string', 'category'),
+      priority: field('Priority', 'string', 'priority'),
+      status: field('Status', 'string', 'status'),
+      requester: person('Requested By', 'requester'),
+      assignee: person('Assigned To', 'assignee'),
+      vendor: { label: 'Vendor', type: 'string', select: { vendor: { select: { name: true } } }, get: row => row.vendor?.name ?? null },
+      estimated_cost: field('Estimated Cost', 'currency', 'estimated_cost'),
+      actual_cost: field('Actual Cost', 'currency', 'actual_cost'),
+      completed_date: field('Completed', 'date', 'completed_date'),
+      tenant_rating: field('Tenant Rating', 'integer', 'tenant_rating'),
+      resolution_breached: yesNo('SLA Breached', 'resolution_breached'),
+    },
+    filters: {
+      property_id: { label: 'Property', kind: 'id', where: value => ({ property_id: { in: split(value) } }) },
+      status: listFilter('Status', 'status', Object.values(MaintenanceStatus)),
+      priority: listFilter('Priority', 'priority', Object.values(PriorityLevel)),
+      category: listFilter('Category', 'category'),
+      ...dateFilters('requested_date', 'Requested'),
+    },
+  },
+};
+
+/**
+ * Merge nested Prisma select objects so columns sharing a relation select it once
+ */
+const mergeSelect = (target: Record<string, any>, source: Record<string, any>) => {
+  for (const [key, value] of Object.entries(source)) {
+    if (value && typeof value === 'object' && target[key] && typeof target[key] === 'object') {
+      mergeSelect(target[key], value);
+    } else if (!(key in target)) {
+      target[key] = typeof value === 'object' ? structuredClone(value) : value;
+    }
+  }
+  return target;
+};
+
+/**
+ * Saved custom report definitions (an entity, columns, filters, grouping and sort) that users run
+ * on demand, export, or attach to a scheduled report as report type "custom"
+ */
+export class ReportBuilderService {
+  private prisma = getPrisma();
+
+  private scopeWhere(user: JWTClaims) {
+    if (user.role === 'super_admin') return {};
+    if (COMPANY_ROLES.includes(user.role)) return { company_id: user.company_id };
+    return { company_id: user.company_id, OR: [{ created_by: user.user_id }, { is_shared: true }] };
+  }
+
+  private async getScoped(id: string, user: JWTClaims) {
+    const template = await this.prisma.reportTemplate.findFirst({ where: { id, ...this.scopeWhere(user) } });
+    if (!template) {
+      throw new Error('Report template not found');
+    }
+    return template;
+  }
+
+  /**
+   * Shared templates can be run by anyone in the company but only changed by their owner or a company admin
+   */
+  private async getEditable(id: string, user: JWTClaims) {
+    const template = await this.getScoped(id, user);
+    if (template.created_by !== user.user_id && !COMPANY_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to change this report template');
+    }
+    return template;
+  }
+
+  /**
+   * Entities with their columns and filters, for building the report form
+   */
+  getOptions() {
+    return Object.entries(REPORT_ENTITIES).map(([key, entity]) => ({
+      entity: key,
+      label: entity.label,
+      default_columns: entity.defaultColumns,
+      columns: Object.entries(entity.columns).map(([column, def]) => ({ key: column, label: def.label, type: def.type })),
+      filters: Object.entries(entity.filters).map(([filter, def]) => ({ key: filter, label: def.label, kind: def.kind, ...(def.values && { values: def.values }) })),
+    }));
+  }
+
+  /**
+   * Validate a definition; fields not given are taken from the stored template
+   */
+  private buildData(req: ReportTemplateRequest, existing?: { entity: string; columns: string[]; group_by: string | null; sort_by: string | null }) {
+    if (req.name !== undefined && !String(req.name).trim()) {
+      throw new Error('name must not be empty');
+    }
+    const entityKey = req.entity ?? existing?.entity;
+    const entity = entityKey ? REPORT_ENTITIES[entityKey] : undefined;
+    if (!entity) {
+      throw new Error(`entity must be one of: ${Object.keys(REPORT_ENTITIES).join(', ')}`);
+    }
+    // Switching entity drops columns that belonged to the old one
+    const columns = req.columns !== undefined ? req.columns : req.entity !== undefined && req.entity !== existing?.entity ? entity.defaultColumns : existing?.columns;
+    if (!Array.isArray(columns) || columns.length === 0 || columns.length > MAX_COLUMNS) {
+      throw new Error(`columns must list between 1 and ${MAX_COLUMNS} columns`);
+    }
+    const unknown = columns.find(column => !entity.columns[column]);
+    if (unknown) {
+      throw new Error(`columns must be ${entityKey} columns: ${unknown} is not one`);
+    }
+
+    if (req.filters !== undefined) {
+      if (typeof req.filters !== 'object' || Array.isArray(req.filters) || req.filters === null) {
+        throw new Error('filters must be an object');
+      }
+      for (const [key, value] of Object.entries(req.filters)) {
+        const filter = entity.filters[key];
+        if (!filter) {
+          throw new Error(`filters must be ${entityKey} filters: ${key} is not one`);
+        }
+        if (filter.values) {
+          const invalid = split(value).find(v => !filter.values!.includes(v));
+          if (invalid) throw new Error(`${key} filter must be one of: ${filter.values.join(', ')}`);
+        }
+        if ((filter.kind === 'min' || filter.kind === 'max') && !Number.isFinite(Number(value))) {
+          throw new Error(`${key} filter must be a number`);
+        }
+        if ((filter.kind === 'date_from' || filter.kind === 'date_to') && isNaN(dayStart(value).getTime())) {
+          throw new Error(`${key} filter must be a valid date`);
+        }
+      }
+    }
+
+    for (const key of ['group_by', 'sort_by'] as const) {
+      const value = req[key] !== undefined ? req[key] : existing?.[key];
+      if (value && !columns.includes(value)) {
+        throw new Error(`${key} must be one of the report's columns`);
+      }
+    }
+    if (req.sort_direction !== undefined && !['asc', 'desc'].includes(req.sort_direction)) {
+      throw new Error("sort_direction must be 'asc' or 'desc'");
+    }
+
+    return {
+      ...(req.name !== undefined && { name: String(req.name).trim() }),
+      ...(req.description !== undefined && { description: req.description?.trim() || null }),
+      entity: entityKey!,
+      columns,
+      ...(req.filters !== undefined && { filters: req.filters }),
+      ...(req.group_by !== undefined && { group_by: req.group_by || null }),
+      ...(req.sort_by !== undefined && { sort_by: req.sort_by || null }),
+      ...(req.sort_direction !== undefined && { sort_direction: req.sort_direction }),
+      ...(req.is_shared !== undefined && { is_shared: !!req.is_shared }),
+    };
+  }
+
+  async list(user: JWTClaims) {
+    return this.prisma.reportTemplate.findMany({
+      where: this.scopeWhere(user),
+      include: { creator: { select: { id: true, first_name: true, last_name: true } } },
+      orderBy: { created_at: 'desc' },
+    });
+  }
+
+  async get(id: string, user: JWTClaims) {
+    return this.getScoped(id, user);
+  }
+
+  async create(req: ReportTemplateRequest, user: JWTClaims) {
+    if (!req.name || !req.entity) {
+      throw new Error('name and entity are required');
+    }
+    const data = this.buildData({ ...req, columns: req.columns ?? REPORT_ENTITIES[req.entity]?.defaultColumns });
+    return this.prisma.reportTemplate.create({
+      data: {
+        ...data,
+        name: data.name!,
+        company_id: user.company_id || null,
+        created_by: user.user_id,
+      },
+    });
+  }
+
+  async update(id: string, req: ReportTemplateRequest, user: JWTClaims) {
+    const template = await this.getEditable(id, user);
+    const data = this.buildData(req, template);
+    // Filters for another entity no longer apply
+    const resetFilters = data.entity !== template.entity && req.filters === undefined;
+    return this.prisma.reportTemplate.update({
+      where: { id },
+      data: { ...data, ...(resetFilters && { filters: {} }), updated_at: new Date() },
+    });
+  }
+
+  async delete(id: string, user: JWTClaims) {
+    await this.getEditable(id, user);
+    await this.prisma.reportTemplate.delete({ where: { id } });
+  }
+
+  /**
+   * Run a saved template with the user's current access. Filters given here narrow the saved
+   * ones for this run only.
+   */
+  async run(id: string, user: JWTClaims, overrides: Record<string, any> = {}) {
+    const template = await this.getScoped(id, user);
+    const entity = REPORT_ENTITIES[template.entity];
+    if (!entity) {
+      throw new Error(`report template entity ${template.entity} is no longer supported`);
+    }
+    const columns = template.columns.filter(column => entity.columns[column]);
+    const filters: Record<string, any> = { ...((template.filters as Record<string, any>) || {}) };
+    for (const [key, value] of Object.entries(overrides)) {
+      if (entity.filters[key] && value !== undefined && value !== '') filters[key] = value;
+    }
+
+    const where = {
+      ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+      ...entity.scope(user),
+      AND: Object.entries(filters)
+        .filter(([key, value]) => entity.filters[key] && value !== undefined && value !== null && value !== '')
+        .map(([key, value]) => entity.filters[key].where(value)),
+    };
+    const select = columns.reduce((acc, column) => mergeSelect(acc, entity.columns[column].select), { id: true } as Record<string, any>);
+
+    const delegate = this.prisma[entity.model] as any;
+    const [records, total] = await Promise.all([
+      delegate.findMany({ where, select, take: MAX_ROWS, orderBy: { created_at: 'desc' } }),
+      delegate.count({ where }),
+    ]);
+
+    let rows: Array<Record<string, any>> = records.map((record: any) =>
+      Object.fromEntries(columns.map(column => [column, entity.columns[column].get(record)]))
+    );
+    if (template.sort_by && columns.includes(template.sort_by)) {
+      const key = template.sort_by;
+      const direction = template.sort_direction === 'desc' ? -1 : 1;
+      rows = rows.sort((a, b) => {
+        if (a[key] == null) return 1;
+        if (b[key] == null) return -1;
+        return (typeof a[key] === 'number' ? a[key] - b[key] : String(a[key]).localeCompare(String(b[key]))) * direction;
+      });
+    }
+
+    const numeric = columns.filter(column => ['currency', 'number', 'integer'].includes(entity.columns[column].type));
+    const totals = Object.fromEntries(
+      numeric.map(column => [column, Math.round(rows.reduce((sum, row) => sum + (Number(row[column]) || 0), 0) * 100) / 100])
+    );
+
+    await this.prisma.reportTemplate.update({ where: { id: template.id }, data: { last_run_at: new Date() } });
+
+    return {
+      template: { id: template.id, name: template.name, description: template.description, entity: template.entity },
+      report_name: template.name,
+      filters,
+      columns: columns.map(column => ({ key: column, label: entity.columns[column].label, type: entity.columns[column].type })),
+      summary: {
+        rowCount: rows.length,
+        matchingRows: total,
+        truncated: total > rows.length,
+        ...Object.fromEntries(numeric.map(column => [`total_${column}`, totals[column]])),
+      },
+      rows,
+      groups: template.group_by ? this.group(rows, template.group_by, entity.columns[template.group_by], numeric) : [],
+      group_by: template.group_by,
+      generatedAt: new Date().toISOString(),
+    };
+  }
+
+  /**
+   * Row counts and numeric totals per value of a column; date columns group by month
+   */
+  private group(rows: Array<Record<string, any>>, key: string, column: ColumnDef, numeric: string[]) {
+    const groups = new Map<string, Record<string, any>>();
+    for (const row of rows) {
+      const raw = row[key];
+      const label = raw == null || raw === '' ? '(none)' : column.type === 'date' ? String(raw).slice(0, 7) : String(raw);
+      const entry = groups.get(label) || { group: label, count: 0, ...Object.fromEntries(numeric.map(n => [n, 0])) };
+      entry.count++;
+      for (const n of numeric) entry[n] += Number(row[n]) || 0;
+      groups.set(label, entry);
+    }
+    return [...groups.values()]
+      .map(entry => ({ ...entry, ...Object.fromEntries(numeric.map(n => [n, Math.round(entry[n] * 100) / 100])) }))
+      .sort((a, b) => (column.type === 'date' ? a.group.localeCompare(b.group) : b.count - a.count));
+  }
+}
+
+export const reportBuilderService = new ReportBuilderService();
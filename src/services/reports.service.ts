@@ -1,9 +1,40 @@
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import { buildWhereClause, formatDataForRole, getDashboardScope } from '../utils/roleBasedFiltering.js';
+import { buildExcelWorkbook, sheetToCsv, summarySheet, ExcelSheet } from '../utils/excel-export.js';
+import type { ReportChart } from '../modules/documents/charts.js';
+import { propertyDelegationsService } from './property-delegations.service.js';
 
 const prisma = getPrisma();
 
+const AGING_BUCKETS = [
+  { key: 'current', label: '0-30', min: 0, max: 30 },
+  { key: 'days_31_60', label: '31-60', min: 31, max: 60 },
+  { key: 'days_61_90', label: '61-90', min: 61, max: 90 },
+  { key: 'days_over_90', label: '90+', min: 91, max: Infinity },
+] as const;
+
+type AgingBucketKey = typeof AGING_BUCKETS[number]['key'];
+type AgingTotals = Record<AgingBucketKey, number> & { total: number };
+
+const emptyAgingTotals = (): AgingTotals => ({ current: 0, days_31_60: 0, days_61_90: 0, days_over_90: 0, total: 0 });
+
+// The per-tenant arrears sheet, shared by the Excel and CSV exports
+const arrearsByTenantSheet = (data: any): ExcelSheet => ({
+  name: 'By Tenant',
+  columns: [
+    'Tenant Name', 'Email', 'Phone', 'Property', 'Unit',
+    ...AGING_BUCKETS.map(b => ({ header: b.label, type: 'currency' as const })),
+    { header: 'Total Outstanding', type: 'currency' }, { header: 'Oldest Days Overdue', type: 'integer' },
+  ],
+  rows: (data.byTenant || []).map((t: any) => [
+    t.tenant_name, t.email, t.phone_number, t.property_name, t.unit_number,
+    t.current, t.days_31_60, t.days_61_90, t.days_over_90, t.total, t.oldest_days_overdue,
+  ]),
+});
+
+const PL_GROUPINGS = ['monthly', 'quarterly', 'annual'];
+
 export const reportsService = {
   async getReports(user: JWTClaims, reportType?: string, period: string = 'monthly', propertyIds?: string[]) {
     const scope = getDashboardScope(user);
@@ -126,6 +157,9 @@ export const reportsService = {
       }
     }
     
+    // Agencies collecting rent only don't get a landlord's operational reports
+    whereClause = await propertyDelegationsService.withoutCollectionOnly(user, whereClause, 'id');
+
     const properties = await prisma.property.findMany({
       where: whereClause,
       include: {
@@ -327,6 +361,18 @@ export const reportsService = {
 
     const collectionRate = totalInvoiced > 0 ? (totalCollected / totalInvoiced) * 100 : 0;
 
+    // Arrears are cumulative, so they are not limited to the reporting period
+    const arrearsAging = await this.getArrearsAgingReport(user, { property_ids: propertyIds });
+
+    // Operating expenses over the same period; net operating income is what was collected less these
+    const { expensesService } = await import('./expenses.service.js');
+    const expenses = await expensesService.summarize(user, {
+      property_ids: propertyIds,
+      start_date: start_date.toISOString(),
+      end_date: now.toISOString(),
+    });
+    const netOperatingIncome = Math.round((totalCollected - expenses.total) * 100) / 100;
+
     return formatDataForRole(user, {
       period,
       start_date: start_date.toISOString(),
@@ -338,6 +384,9 @@ export const reportsService = {
         totalOutstanding,
         collectionRate: Math.round(collectionRate * 100) / 100,
         occupiedUnits: revenueData.length,
+        totalExpenses: expenses.total,
+        netOperatingIncome,
+        operatingMargin: totalCollected > 0 ? Math.round((netOperatingIncome / totalCollected) * 10000) / 100 : 0,
       },
       revenueByProperty: revenueData.reduce((acc: any, unit) => {
         const propertyId = unit.property.id;
@@ -359,6 +408,9 @@ export const reportsService = {
         pending: invoices.filter(i => i.status === 'sent').length,
         overdue: invoices.filter(i => i.status === 'overdue').length,
       },
+      arrearsAging: arrearsAging.summary,
+      expensesByCategory: expenses.byCategory,
+      expensesByProperty: expenses.byProperty,
       generatedAt: new Date().toISOString(),
     });
   },
@@ -379,9 +431,12 @@ export const reportsService = {
       }
     }
     
+    // Agencies collecting rent only don't get a landlord's operational reports
+    whereClause = await propertyDelegationsService.withoutCollectionOnly(user, whereClause, 'id');
+
     // Build unit where clause - if propertyIds provided, filter by property_id directly
     const unitWhereClause: any = propertyIds && propertyIds.length > 0
-      ? { property_id: { in: propertyIds } }
+      ? await propertyDelegationsService.withoutCollectionOnly(user, { property_id: { in: propertyIds } }, 'property_id')
       : { property: whereClause };
     
     const units = await prisma.unit.findMany({
@@ -486,6 +541,9 @@ export const reportsService = {
       return acc;
     }, {});
 
+    const { occupancyHistoryService } = await import('./occupancy-history.service.js');
+    const trend = await occupancyHistoryService.getTrend(user, { months: 12, property_ids: propertyIds });
+
     return formatDataForRole(user, {
       period,
       summary: {
@@ -498,6 +556,7 @@ export const reportsService = {
       },
       byProperty: Object.values(byProperty),
       byUnitType: Object.values(byUnitType),
+      trend: trend.months,
       unitDetails: units.map(unit => ({
         id: unit.id,
         unit_number: unit.unit_number,
@@ -653,6 +712,428 @@ export const reportsService = {
     });
   },
 
+  /**
+   * Arrears aging: outstanding invoice balances bucketed by days past due (0-30, 31-60, 61-90, 90+),
+   * grouped per tenant and per property, for one owner's properties: the landlord's own, or the
+   * owner_id others ask for. Balances are as they stood on as_of: invoices paid after that date
+   * still count, and only payments made by then reduce them.
+   */
+  async getArrearsAgingReport(user: JWTClaims, filters: any = {}) {
+    const asOf = filters.as_of ? new Date(filters.as_of) : new Date();
+    if (isNaN(asOf.getTime())) {
+      throw new Error('as_of must be a valid date');
+    }
+
+    const invoiceWhereClause: any = {
+      status: { in: ['sent', 'overdue', 'paid'] },
+      due_date: { lte: asOf },
+      OR: [{ paid_date: null }, { paid_date: { gt: asOf } }],
+    };
+    if (user.role !== 'super_admin' && user.company_id) {
+      invoiceWhereClause.company_id = user.company_id;
+    }
+    const ownerId = user.role === 'landlord' ? user.user_id : filters.owner_id;
+    if (ownerId) {
+      invoiceWhereClause.property = { owner_id: ownerId };
+    }
+    if (filters.property_ids && Array.isArray(filters.property_ids) && filters.property_ids.length > 0) {
+      invoiceWhereClause.property_id = { in: filters.property_ids };
+    } else if (filters.property_id) {
+      invoiceWhereClause.property_id = filters.property_id;
+    }
+    if (filters.tenant_id) {
+      invoiceWhereClause.issued_to = filters.tenant_id;
+    }
+
+    const invoices = await prisma.invoice.findMany({
+      where: invoiceWhereClause,
+      select: {
+        id: true,
+        invoice_number: true,
+        total_amount: true,
+        currency: true,
+        due_date: true,
+        status: true,
+        recipient: { select: { id: true, first_name: true, last_name: true, email: true, phone_number: true } },
+        property: { select: { id: true, name: true } },
+        unit: { select: { id: true, unit_number: true } },
+      },
+    });
+
+    // Partial payments recorded against these invoices by the as_of date
+    const payments = invoices.length > 0
+      ? await prisma.payment.groupBy({
+          by: ['invoice_id'],
+          where: { invoice_id: { in: invoices.map(i => i.id) }, status: { in: ['completed', 'approved'] }, payment_date: { lte: asOf } },
+          _sum: { amount: true },
+        })
+      : [];
+    const paidByInvoice = new Map(payments.map(p => [p.invoice_id, Number(p._sum.amount || 0)]));
+
+    const byTenant: Record<string, any> = {};
+    const byProperty: Record<string, any> = {};
+    const summary = emptyAgingTotals();
+
+    for (const invoice of invoices) {
+      const balance = Number(invoice.total_amount || 0) - (paidByInvoice.get(invoice.id) || 0);
+      if (balance <= 0) continue;
+
+      const daysOverdue = Math.max(0, Math.floor((asOf.getTime() - new Date(invoice.due_date).getTime()) / (24 * 60 * 60 * 1000)));
+      const bucket = AGING_BUCKETS.find(b => daysOverdue >= b.min && daysOverdue <= b.max)!.key;
+
+      const tenantId = invoice.recipient.id;
+      if (!byTenant[tenantId]) {
+        byTenant[tenantId] = {
+          tenant_id: tenantId,
+          tenant_name: `${invoice.recipient.first_name || ''} ${invoice.recipient.last_name || ''}`.trim() || 'Unknown',
+          email: invoice.recipient.email,
+          phone_number: invoice.recipient.phone_number,
+          property_name: invoice.property?.name || 'Unknown',
+          unit_number: invoice.unit?.unit_number || 'Unknown',
+          oldest_days_overdue: 0,
+          invoice_count: 0,
+          ...emptyAgingTotals(),
+        };
+      }
+      const propertyId = invoice.property?.id || 'unassigned';
+      if (!byProperty[propertyId]) {
+        byProperty[propertyId] = {
+          property_id: invoice.property?.id || null,
+          property_name: invoice.property?.name || 'Unassigned',
+          tenant_count: 0,
+          tenants: new Set<string>(),
+          ...emptyAgingTotals(),
+        };
+      }
+
+      for (const totals of [byTenant[tenantId], byProperty[propertyId], summary]) {
+        totals[bucket] += balance;
+        totals.total += balance;
+      }
+      byTenant[tenantId].invoice_count += 1;
+      byTenant[tenantId].oldest_days_overdue = Math.max(byTenant[tenantId].oldest_days_overdue, daysOverdue);
+      byProperty[propertyId].tenants.add(tenantId);
+    }
+
+    const round = (n: number) => Math.round(n * 100) / 100;
+    const roundTotals = (t: any) => {
+      for (const key of [...AGING_BUCKETS.map(b => b.key), 'total']) t[key] = round(t[key]);
+      return t;
+    };
+
+    return formatDataForRole(user, {
+      as_of: asOf.toISOString().split('T')[0],
+      buckets: AGING_BUCKETS.map(b => ({ key: b.key, label: b.label })),
+      summary: roundTotals(summary),
+      byTenant: Object.values(byTenant)
+        .map(roundTotals)
+        .sort((a: any, b: any) => b.total - a.total),
+      byProperty: Object.values(byProperty)
+        .map(({ tenants, ...p }: any) => roundTotals({ ...p, tenant_count: tenants.size }))
+        .sort((a: any, b: any) => b.total - a.total),
+      generatedAt: new Date().toISOString(),
+    });
+  },
+
+  /**
+   * Rent roll as of a date: every unit with the lease in effect that day, its tenant, term, rent,
+   * deposit and the balance outstanding on invoices due by then. Units without a lease are vacant.
+   */
+  async getRentRollReport(user: JWTClaims, filters: any = {}) {
+    const asOf = filters.as_of ? new Date(filters.as_of) : new Date();
+    if (isNaN(asOf.getTime())) {
+      throw new Error('as_of must be a valid date');
+    }
+
+    const propertyWhereClause: any = buildWhereClause(user);
+    if (filters.property_ids && Array.isArray(filters.property_ids) && filters.property_ids.length > 0) {
+      propertyWhereClause.id = { in: filters.property_ids };
+    } else if (filters.property_id) {
+      propertyWhereClause.id = filters.property_id;
+    }
+
+    const units = await prisma.unit.findMany({
+      where: { property: propertyWhereClause },
+      select: {
+        id: true,
+        unit_number: true,
+        unit_type: true,
+        rent_amount: true,
+        currency: true,
+        property: { select: { id: true, name: true } },
+      },
+      orderBy: [{ property: { name: 'asc' } }, { unit_number: 'asc' }],
+    });
+    const unitIds = units.map(u => u.id);
+
+    // The lease in effect on the date: started, not moved out or terminated, and either within
+    // its term or still active past its end (month-to-month)
+    const leases = unitIds.length
+      ? await prisma.lease.findMany({
+        where: {
+          unit_id: { in: unitIds },
+          status: { in: ['active', 'expired', 'terminated', 'renewed'] },
+          start_date: { lte: asOf },
+          AND: [
+            { OR: [{ move_out_date: null }, { move_out_date: { gt: asOf } }] },
+            { OR: [{ terminated_at: null }, { terminated_at: { gt: asOf } }] },
+            { OR: [{ end_date: { gte: asOf } }, { status: 'active' }] },
+          ],
+        },
+        select: {
+          id: true,
+          unit_id: true,
+          lease_number: true,
+          status: true,
+          start_date: true,
+          end_date: true,
+          rent_amount: true,
+          deposit_amount: true,
+          currency: true,
+          payment_frequency: true,
+          tenant: { select: { id: true, first_name: true, last_name: true, email: true, phone_number: true } },
+        },
+        orderBy: { start_date: 'desc' },
+      })
+      : [];
+    const leaseByUnit = new Map<string, (typeof leases)[number]>();
+    for (const lease of leases) {
+      if (!leaseByUnit.has(lease.unit_id)) leaseByUnit.set(lease.unit_id, lease);
+    }
+
+    // Balances as of the date: invoices due by then, less what had been paid against them
+    const current = [...leaseByUnit.values()];
+    const invoices = current.length
+      ? await prisma.invoice.findMany({
+        where: {
+          OR: current.map(lease => ({ issued_to: lease.tenant.id, unit_id: lease.unit_id })),
+          status: { in: ['sent', 'overdue', 'paid'] },
+          due_date: { lte: asOf },
+        },
+        select: { id: true, issued_to: true, unit_id: true, total_amount: true, paid_date: true },
+      })
+      : [];
+    const unpaid = invoices.filter(invoice => !invoice.paid_date || invoice.paid_date > asOf);
+    const payments = unpaid.length
+      ? await prisma.payment.groupBy({
+        by: ['invoice_id'],
+        where: { invoice_id: { in: unpaid.map(i => i.id) }, status: { in: ['completed', 'approved'] }, payment_date: { lte: asOf } },
+        _sum: { amount: true },
+      })
+      : [];
+    const paidByInvoice = new Map(payments.map(p => [p.invoice_id, Number(p._sum.amount || 0)]));
+    const balanceByUnit = new Map<string, number>();
+    for (const invoice of unpaid) {
+      const outstanding = Number(invoice.total_amount || 0) - (paidByInvoice.get(invoice.id) || 0);
+      if (outstanding <= 0 || !invoice.unit_id) continue;
+      balanceByUnit.set(invoice.unit_id, (balanceByUnit.get(invoice.unit_id) || 0) + outstanding);
+    }
+
+    const round = (n: number) => Math.round(n * 100) / 100;
+    const day = (date: Date | null | undefined) => (date ? date.toISOString().split('T')[0] : null);
+    const rows = units.map(unit => {
+      const lease = leaseByUnit.get(unit.id);
+      return {
+        property_id: unit.property.id,
+        property_name: unit.property.name,
+        unit_id: unit.id,
+        unit_number: unit.unit_number,
+        unit_type: unit.unit_type,
+        status: lease ? 'occupied' : 'vacant',
+        tenant_name: lease ? `${lease.tenant.first_name || ''} ${lease.tenant.last_name || ''}`.trim() : null,
+        tenant_email: lease?.tenant.email || null,
+        tenant_phone: lease?.tenant.phone_number || null,
+        lease_number: lease?.lease_number || null,
+        lease_status: lease ? (lease.end_date < asOf ? 'month_to_month' : lease.status) : null,
+        lease_start: day(lease?.start_date),
+        lease_end: day(lease?.end_date),
+        payment_frequency: lease?.payment_frequency || null,
+        market_rent: round(Number(unit.rent_amount || 0)),
+        lease_rent: lease ? round(Number(lease.rent_amount)) : 0,
+        deposit: lease ? round(Number(lease.deposit_amount)) : 0,
+        balance: round(balanceByUnit.get(unit.id) || 0),
+        currency: lease?.currency || unit.currency || 'KES',
+      };
+    });
+
+    const totals = (items: typeof rows) => {
+      const occupied = items.filter(r => r.status === 'occupied').length;
+      return {
+        totalUnits: items.length,
+        occupiedUnits: occupied,
+        vacantUnits: items.length - occupied,
+        occupancyRate: items.length ? round((occupied / items.length) * 100) : 0,
+        marketRent: round(items.reduce((sum, r) => sum + r.market_rent, 0)),
+        leaseRent: round(items.reduce((sum, r) => sum + r.lease_rent, 0)),
+        vacancyLoss: round(items.filter(r => r.status === 'vacant').reduce((sum, r) => sum + r.market_rent, 0)),
+        deposits: round(items.reduce((sum, r) => sum + r.deposit, 0)),
+        outstandingBalance: round(items.reduce((sum, r) => sum + r.balance, 0)),
+      };
+    };
+    const byProperty = new Map<string, typeof rows>();
+    for (const row of rows) {
+      byProperty.set(row.property_id, [...(byProperty.get(row.property_id) || []), row]);
+    }
+
+    return formatDataForRole(user, {
+      as_of: day(asOf),
+      summary: totals(rows),
+      byProperty: [...byProperty.values()].map(items => ({
+        property_id: items[0].property_id,
+        property_name: items[0].property_name,
+        ...totals(items),
+      })),
+      rentRoll: rows,
+      generatedAt: new Date().toISOString(),
+    });
+  },
+
+  /**
+   * Profit and loss: income received (payments, less security deposits which are held rather than
+   * earned) against recorded expenses, grouped by month, quarter or year, per property and compared
+   * with the period of the same length just before.
+   */
+  async getProfitLossReport(user: JWTClaims, filters: any = {}) {
+    const groupBy = filters.group_by || 'monthly';
+    if (!PL_GROUPINGS.includes(groupBy)) {
+      throw new Error(`group_by must be one of: ${PL_GROUPINGS.join(', ')}`);
+    }
+    const now = new Date();
+    const start = filters.start_date ? new Date(filters.start_date) : new Date(now.getFullYear(), 0, 1);
+    const end = filters.end_date ? new Date(filters.end_date) : now;
+    if (isNaN(start.getTime()) || isNaN(end.getTime()) || start > end) {
+      throw new Error('start_date and end_date must be valid dates with start_date before end_date');
+    }
+    // End dates given as a day include the whole day
+    if (filters.end_date && !String(filters.end_date).includes('T')) {
+      end.setHours(23, 59, 59, 999);
+    }
+    const priorEnd = new Date(start.getTime() - 1);
+    const priorStart = new Date(start.getTime() - (end.getTime() - start.getTime()) - 1);
+
+    const propertyIds: string[] | undefined = filters.property_ids?.length
+      ? filters.property_ids
+      : filters.property_id ? [filters.property_id] : undefined;
+
+    const paymentWhereClause: any = {
+      ...buildWhereClause(user, {}, 'payment'),
+      status: { in: ['completed', 'approved'] },
+      payment_type: { not: 'security_deposit' },
+      payment_date: { gte: priorStart, lte: end },
+    };
+    if (propertyIds) {
+      paymentWhereClause.OR = [{ property_id: { in: propertyIds } }, { property_id: null, unit: { property_id: { in: propertyIds } } }];
+    }
+    const expenseWhereClause: any = {
+      ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+      expense_date: { gte: priorStart, lte: end },
+      ...(propertyIds && { property_id: { in: propertyIds } }),
+    };
+
+    const [payments, expenses] = await Promise.all([
+      prisma.payment.findMany({
+        where: paymentWhereClause,
+        select: {
+          amount: true,
+          payment_type: true,
+          payment_date: true,
+          property: { select: { id: true, name: true } },
+          unit: { select: { property: { select: { id: true, name: true } } } },
+        },
+      }),
+      prisma.expense.findMany({
+        where: expenseWhereClause,
+        select: { amount: true, category: true, expense_date: true, property: { select: { id: true, name: true } } },
+      }),
+    ]);
+
+    const round = (n: number) => Math.round(n * 100) / 100;
+    const change = (current: number, prior: number) => (prior !== 0 ? round(((current - prior) / Math.abs(prior)) * 100) : null);
+    const periodKey = (date: Date) =>
+      groupBy === 'annual' ? `${date.getFullYear()}`
+        : groupBy === 'quarterly' ? `${date.getFullYear()}-Q${Math.floor(date.getMonth() / 3) + 1}`
+          : `${date.getFullYear()}-${String(date.getMonth() + 1).padStart(2, '0')}`;
+
+    // Every period in the range, so months with no activity still show as zero
+    const periods = new Map<string, { period: string; income: number; expenses: number }>();
+    for (let cursor = new Date(start.getFullYear(), start.getMonth(), 1); cursor <= end; cursor.setMonth(cursor.getMonth() + 1)) {
+      const key = periodKey(cursor);
+      if (!periods.has(key)) periods.set(key, { period: key, income: 0, expenses: 0 });
+    }
+
+    const lines = { income: new Map<string, { current: number; prior: number }>(), expenses: new Map<string, { current: number; prior: number }>() };
+    const byProperty = new Map<string, { property_id: string | null; property_name: string; income: number; expenses: number }>();
+    const add = (kind: 'income' | 'expenses', category: string, date: Date, amount: number, property?: { id: string; name: string } | null) => {
+      const line = lines[kind].get(category) || { current: 0, prior: 0 };
+      if (date < start) {
+        line.prior += amount;
+        lines[kind].set(category, line);
+        return;
+      }
+      line.current += amount;
+      lines[kind].set(category, line);
+      periods.get(periodKey(date))![kind] += amount;
+      const propertyKey = property?.id || 'unassigned';
+      const totals = byProperty.get(propertyKey) || { property_id: property?.id || null, property_name: property?.name || 'Company-wide', income: 0, expenses: 0 };
+      totals[kind] += amount;
+      byProperty.set(propertyKey, totals);
+    };
+    for (const payment of payments) {
+      add('income', payment.payment_type, payment.payment_date, Number(payment.amount), payment.property || payment.unit?.property);
+    }
+    for (const expense of expenses) {
+      add('expenses', expense.category, expense.expense_date, Number(expense.amount), expense.property);
+    }
+
+    const statement = (kind: 'income' | 'expenses') => [...lines[kind].entries()]
+      .map(([category, line]) => ({ category, amount: round(line.current), prior_amount: round(line.prior), change: change(line.current, line.prior) }))
+      .sort((a, b) => b.amount - a.amount);
+    const income = statement('income');
+    const expenseLines = statement('expenses');
+    const total = (items: Array<{ amount: number; prior_amount: number }>, key: 'amount' | 'prior_amount') =>
+      round(items.reduce((sum, item) => sum + item[key], 0));
+    const totalIncome = total(income, 'amount');
+    const totalExpenses = total(expenseLines, 'amount');
+    const priorIncome = total(income, 'prior_amount');
+    const priorExpenses = total(expenseLines, 'prior_amount');
+    const netOperatingIncome = round(totalIncome - totalExpenses);
+    const priorNet = round(priorIncome - priorExpenses);
+
+    return formatDataForRole(user, {
+      group_by: groupBy,
+      start_date: start.toISOString(),
+      end_date: end.toISOString(),
+      summary: {
+        totalIncome,
+        totalExpenses,
+        netOperatingIncome,
+        operatingMargin: totalIncome > 0 ? round((netOperatingIncome / totalIncome) * 100) : 0,
+        priorIncome,
+        priorExpenses,
+        priorNetOperatingIncome: priorNet,
+        incomeChange: change(totalIncome, priorIncome),
+        expensesChange: change(totalExpenses, priorExpenses),
+        netOperatingIncomeChange: change(netOperatingIncome, priorNet),
+      },
+      comparison: {
+        start_date: priorStart.toISOString(),
+        end_date: priorEnd.toISOString(),
+      },
+      income,
+      expenses: expenseLines,
+      periods: [...periods.values()].map(p => ({
+        period: p.period,
+        income: round(p.income),
+        expenses: round(p.expenses),
+        net_operating_income: round(p.income - p.expenses),
+      })),
+      byProperty: [...byProperty.values()]
+        .map(p => ({ ...p, income: round(p.income), expenses: round(p.expenses), net_operating_income: round(p.income - p.expenses) }))
+        .sort((a, b) => b.net_operating_income - a.net_operating_income),
+      generatedAt: new Date().toISOString(),
+    });
+  },
+
   async getMaintenanceReport(user: JWTClaims, period: string = 'monthly', filters: any = {}, propertyIds?: string[]) {
     let whereClause = buildWhereClause(user, {}, 'maintenance'); // ✅ Specify 'maintenance' modelType
     
@@ -669,6 +1150,9 @@ export const reportsService = {
       }
     }
     
+    // Agencies collecting rent only don't get a landlord's operational reports
+    whereClause = await propertyDelegationsService.withoutCollectionOnly(user, whereClause, 'property_id');
+
     const maintenanceRequests = await prisma.maintenanceRequest.findMany({
       where: {
         ...whereClause,
@@ -704,6 +1188,8 @@ export const reportsService = {
     const completedRequests = maintenanceRequests.filter(req => req.status === 'completed').length;
     const pendingRequests = maintenanceRequests.filter(req => ['open', 'in_progress'].includes(req.status)).length;
     const completionRate = totalRequests > 0 ? (completedRequests / totalRequests) * 100 : 0;
+    const labourCost = maintenanceRequests.reduce((sum, req) => sum + Number(req.actual_cost || 0), 0);
+    const materialCost = maintenanceRequests.reduce((sum, req) => sum + Number(req.material_cost || 0), 0);
 
     // Group by status
     const byStatus = maintenanceRequests.reduce((acc: any, request) => {
@@ -751,6 +1237,9 @@ export const reportsService = {
         completedRequests,
         pendingRequests,
         completionRate: Math.round(completionRate * 100) / 100,
+        actualCost: Math.round(labourCost * 100) / 100,
+        materialCost: Math.round(materialCost * 100) / 100,
+        totalCost: Math.round((labourCost + materialCost) * 100) / 100,
       },
       byStatus: Object.values(byStatus),
       byCategory: Object.values(byCategory),
@@ -763,6 +1252,8 @@ export const reportsService = {
         priority: request.priority,
         status: request.status,
         created_at: request.created_at,
+        actual_cost: Number(request.actual_cost || 0),
+        material_cost: Number(request.material_cost || 0),
         propertyName: 'Unknown', // request.property not available in current schema
         unit_number: request.unit?.unit_number || 'N/A',
         tenantName: 'Unknown', // request.tenant not available in current schema
@@ -771,9 +1262,10 @@ export const reportsService = {
     });
   },
 
-  async exportReport(user: JWTClaims, reportType: string, format: string = 'csv', filters: any = {}) {
-    let reportData: any;
-
+  /**
+   * The report behind an export, by type; shared by the CSV/Excel/JSON and PDF exports
+   */
+  async getReportData(user: JWTClaims, reportType: string, filters: any = {}) {
     // Parse property_ids if provided
     let propertyIds: string[] | undefined = undefined;
     if (filters.property_ids) {
@@ -784,28 +1276,238 @@ export const reportsService = {
       }
     }
 
-    // Generate the appropriate report
     switch (reportType) {
       case 'property':
-        reportData = await this.getPropertyReport(user, filters);
+        return this.getPropertyReport(user, filters);
+      case 'financial':
+        return this.getFinancialReport(user, filters.type || 'revenue', filters.period || 'monthly', propertyIds);
+      case 'occupancy':
+        return this.getOccupancyReport(user, filters.period || 'monthly', propertyIds);
+      case 'rent-collection':
+        return this.getRentCollectionReport(user, filters);
+      case 'maintenance':
+        return this.getMaintenanceReport(user, filters.period || 'monthly', filters, propertyIds);
+      case 'arrears-aging':
+        return this.getArrearsAgingReport(user, { ...filters, property_ids: propertyIds });
+      case 'rent-roll':
+        return this.getRentRollReport(user, { ...filters, property_ids: propertyIds });
+      case 'profit-loss':
+        return this.getProfitLossReport(user, { ...filters, property_ids: propertyIds });
+      case 'budget-variance': {
+        const { budgetsService } = await import('./budgets.service.js');
+        return budgetsService.getVariance(user, { year: Number(filters.year) || undefined, property_id: filters.property_id, property_ids: propertyIds });
+      }
+      case 'tax-summary': {
+        const { taxReportsService } = await import('./tax-reports.service.js');
+        return taxReportsService.getTaxSummary(user, {
+          year: Number(filters.year) || undefined,
+          month: filters.month ? Number(filters.month) : undefined,
+          owner_id: filters.owner_id,
+          property_ids: propertyIds || (filters.property_id ? [filters.property_id] : undefined),
+        });
+      }
+      case 'agency-rollup': {
+        const { agencyReportsService } = await import('./agency-reports.service.js');
+        const agencyFilters = { ...filters, property_ids: propertyIds };
+        return filters.owner_id
+          ? agencyReportsService.getLandlordDetail(user, filters.owner_id, agencyFilters)
+          : agencyReportsService.getRollup(user, agencyFilters);
+      }
+      case 'custom': {
+        if (!filters.template_id) {
+          throw new Error('template_id is required for custom reports');
+        }
+        const { template_id, ...overrides } = filters;
+        const { reportBuilderService } = await import('./report-builder.service.js');
+        return reportBuilderService.run(String(template_id), user, overrides);
+      }
+      default:
+        throw new Error('Invalid report type for export');
+    }
+  },
+
+  /**
+   * Title, table rows, summary and charts for a report PDF
+   */
+  async getReportDocument(user: JWTClaims, reportType: string, filters: any = {}) {
+    const data: any = await this.getReportData(user, reportType, filters);
+    const rows =
+      // Custom reports are laid out by their saved columns, or by group when grouped
+      (reportType === 'custom' && (data.groups?.length ? data.groups : data.rows.map((row: any) =>
+        Object.fromEntries(data.columns.map((column: any) => [column.label, row[column.key]]))))) ||
+      // The PDF table fits 12 columns; ids and contact details stay in the Excel/CSV exports
+      data?.rentRoll?.map(({ property_id, unit_id, unit_type, tenant_email, tenant_phone, payment_frequency, currency, ...row }: any) => row) ||
+      data?.lines?.map(({ property_id, months, ...row }: any) => row) ||
+      data?.landlords?.map(({ owner_id, email, annual_return_rent, ...row }: any) => row) ||
+      data?.periods ||
+      data?.properties ||
+      data?.invoices ||
+      data?.requests ||
+      data?.unitDetails ||
+      data?.byTenant ||
+      [];
+    return {
+      title: `LetRents — ${(data?.report_name || reportType.replaceAll('-', ' ')).toUpperCase()} Report`,
+      rows: Array.isArray(rows) ? rows : [],
+      summary: data?.summary || data?.overview || {},
+      charts: this.getReportCharts(reportType, data),
+    };
+  },
+
+  /**
+   * Charts drawn on the PDF for each report type; sections hidden from the user's role are skipped
+   */
+  getReportCharts(reportType: string, data: any): ReportChart[] {
+    const points = (items: any[] | undefined, label: (item: any) => string, value: (item: any) => number) =>
+      (items || []).map(item => ({ label: String(label(item) ?? ''), value: Number(value(item)) || 0 }));
+    const top = (items: any[] | undefined, by: (item: any) => number, n = 10) =>
+      [...(items || [])].sort((a, b) => by(b) - by(a)).slice(0, n);
+    const charts: Array<ReportChart | null> = [];
+
+    switch (reportType) {
+      case 'property':
+        charts.push(
+          { title: 'Occupancy rate by property (%)', kind: 'bar', points: points(top(data.properties, p => p.totalUnits), p => p.name, p => p.occupancyRate) },
+          data.properties?.[0]?.actualRevenue !== undefined
+            ? { title: 'Monthly rent roll by property', kind: 'bar', points: points(top(data.properties, p => p.actualRevenue), p => p.name, p => p.actualRevenue) }
+            : null,
+        );
         break;
       case 'financial':
-        reportData = await this.getFinancialReport(user, 'revenue', filters.period || 'monthly', propertyIds);
+        charts.push(
+          data.invoiceBreakdown
+            ? {
+              title: 'Invoices by status',
+              kind: 'donut',
+              points: [
+                { label: 'Paid', value: data.invoiceBreakdown.paid },
+                { label: 'Pending', value: data.invoiceBreakdown.pending },
+                { label: 'Overdue', value: data.invoiceBreakdown.overdue },
+              ],
+            }
+            : null,
+          data.revenueByProperty
+            ? { title: 'Rent roll by property', kind: 'bar', points: points(top(Object.values(data.revenueByProperty), (p: any) => p.totalRevenue), p => p.propertyName, p => p.totalRevenue) }
+            : null,
+          data.arrearsAging
+            ? { title: 'Arrears by days overdue', kind: 'bar', points: AGING_BUCKETS.map(b => ({ label: b.label, value: Number(data.arrearsAging[b.key]) || 0 })) }
+            : null,
+          data.expensesByCategory
+            ? { title: 'Expenses by category', kind: 'donut', points: points(data.expensesByCategory, c => c.category.replace(/_/g, ' '), c => c.amount) }
+            : null,
+        );
         break;
       case 'occupancy':
-        reportData = await this.getOccupancyReport(user, filters.period || 'monthly', propertyIds);
+        charts.push(
+          {
+            title: 'Units by status',
+            kind: 'donut',
+            points: [
+              { label: 'Occupied', value: data.summary?.occupiedUnits },
+              { label: 'Vacant', value: data.summary?.vacantUnits },
+              { label: 'Maintenance', value: data.summary?.maintenanceUnits },
+              { label: 'Reserved', value: data.summary?.reservedUnits },
+            ].map(p => ({ ...p, value: Number(p.value) || 0 })),
+          },
+          { title: 'Occupancy rate by property (%)', kind: 'bar', points: points(top(data.byProperty, p => p.totalUnits), p => p.propertyName, p => Math.round(p.occupancyRate * 10) / 10) },
+          { title: 'Occupancy rate by month (%)', kind: 'bar', points: points(data.trend, m => m.month, m => m.occupancy_rate) },
+        );
         break;
       case 'rent-collection':
-        reportData = await this.getRentCollectionReport(user, filters);
+        charts.push(
+          { title: 'Invoices by status', kind: 'donut', points: points(data.byStatus, s => s.status, s => s.count) },
+          data.byStatus?.[0]?.totalAmount !== undefined
+            ? { title: 'Invoiced amount by status', kind: 'bar', points: points(data.byStatus, s => s.status, s => s.totalAmount) }
+            : null,
+        );
         break;
       case 'maintenance':
-        reportData = await this.getMaintenanceReport(user, filters.period || 'monthly', filters, propertyIds);
+        charts.push(
+          { title: 'Requests by status', kind: 'donut', points: points(data.byStatus, s => s.status, s => s.count) },
+          { title: 'Requests by category', kind: 'bar', points: points(top(data.byCategory, c => c.count), c => c.category, c => c.count) },
+          { title: 'Requests by priority', kind: 'bar', points: points(data.byPriority, p => p.priority, p => p.count) },
+        );
+        break;
+      case 'arrears-aging':
+        charts.push(
+          { title: 'Arrears by days overdue', kind: 'bar', points: AGING_BUCKETS.map(b => ({ label: b.label, value: Number(data.summary?.[b.key]) || 0 })) },
+          { title: 'Largest arrears by property', kind: 'bar', points: points(top(data.byProperty, p => p.total, 8), p => p.property_name, p => p.total) },
+        );
+        break;
+      case 'profit-loss':
+        charts.push(
+          { title: 'Net operating income by period', kind: 'bar', points: points(data.periods, p => p.period, p => p.net_operating_income) },
+          { title: 'Income by type', kind: 'donut', points: points(data.income, l => l.category.replace(/_/g, ' '), l => l.amount) },
+          { title: 'Expenses by category', kind: 'donut', points: points(data.expenses, l => l.category.replace(/_/g, ' '), l => l.amount) },
+        );
+        break;
+      case 'budget-variance':
+        charts.push(
+          { title: 'Expenses: budget by month', kind: 'bar', points: points(data.months, m => m.label, m => m.expense_budget) },
+          { title: 'Expenses: actual by month', kind: 'bar', points: points(data.months, m => m.label, m => m.expense_actual) },
+          { title: 'Largest overspends', kind: 'bar', points: points(top(data.alerts, a => a.overspend, 8), a => `${a.property_name} ${a.category.replace(/_/g, ' ')}`, a => a.overspend) },
+        );
+        break;
+      case 'tax-summary':
+        charts.push(
+          { title: 'Gross rent by landlord', kind: 'bar', points: points(top(data.landlords, l => l.gross_rent), l => l.landlord_name, l => l.gross_rent) },
+          {
+            title: 'Gross rent by type',
+            kind: 'donut',
+            points: [
+              { label: 'Residential', value: Number(data.summary?.residentialRent) || 0 },
+              { label: 'Commercial', value: Number(data.summary?.commercialRent) || 0 },
+            ],
+          },
+          { title: 'Allowable expenses by category', kind: 'donut', points: points(data.expenses, e => e.category.replace(/_/g, ' '), e => e.amount) },
+        );
+        break;
+      case 'agency-rollup':
+        // A landlord drill-down is charted by property, the roll-up by landlord
+        if (data.landlord) {
+          charts.push(
+            { title: 'Collections by property', kind: 'bar', points: points(top(data.properties, p => p.collected), p => p.property_name, p => p.collected) },
+            { title: 'Collections by month', kind: 'bar', points: points(data.months, m => m.month, m => m.collected) },
+            { title: 'Occupancy rate by property (%)', kind: 'bar', points: points(top(data.properties, p => p.units), p => p.property_name, p => p.occupancy_rate) },
+          );
+        } else {
+          charts.push(
+            { title: 'Collections by landlord', kind: 'bar', points: points(top(data.landlords, l => l.collected), l => l.landlord_name, l => l.collected) },
+            { title: 'Commission by landlord', kind: 'bar', points: points(top(data.landlords, l => l.commission), l => l.landlord_name, l => l.commission) },
+            { title: 'Occupancy rate by landlord (%)', kind: 'bar', points: points(top(data.landlords, l => l.units), l => l.landlord_name, l => l.occupancy_rate) },
+          );
+        }
+        break;
+      case 'custom':
+        if (data.groups?.length) {
+          const groupLabel = data.columns?.find((c: any) => c.key === data.group_by)?.label || 'group';
+          charts.push({ title: `Rows by ${groupLabel.toLowerCase()}`, kind: 'bar', points: points(data.groups.slice(0, 12), g => g.group, g => g.count) });
+        }
+        break;
+      case 'rent-roll':
+        charts.push(
+          {
+            title: 'Units by status',
+            kind: 'donut',
+            points: [
+              { label: 'Occupied', value: Number(data.summary?.occupiedUnits) || 0 },
+              { label: 'Vacant', value: Number(data.summary?.vacantUnits) || 0 },
+            ],
+          },
+          { title: 'Lease rent by property', kind: 'bar', points: points(top(data.byProperty, p => p.leaseRent), p => p.property_name, p => p.leaseRent) },
+          { title: 'Outstanding balance by property', kind: 'bar', points: points(top(data.byProperty, p => p.outstandingBalance, 8), p => p.property_name, p => p.outstandingBalance) },
+        );
         break;
-      default:
-        throw new Error('Invalid report type for export');
     }
+    return charts.filter((chart): chart is ReportChart => !!chart && chart.points.some(p => p.value > 0));
+  },
+
+  async exportReport(user: JWTClaims, reportType: string, format: string = 'csv', filters: any = {}) {
+    const reportData: any = await this.getReportData(user, reportType, filters);
 
-    if (format === 'csv') {
+    if (format === 'xlsx' || format === 'excel') {
+      return this.convertToExcel(reportData, reportType);
+    } else if (format === 'csv') {
       // Convert to CSV format
       return this.convertToCSV(reportData, reportType);
     } else {
@@ -840,16 +1542,409 @@ export const reportsService = {
         break;
         
       case 'maintenance':
-        csvContent = 'Title,Category,Priority,Status,Created Date,Property Name,Unit Number,Tenant Name\n';
+        csvContent = 'Title,Category,Priority,Status,Created Date,Actual Cost,Material Cost,Property Name,Unit Number,Tenant Name\n';
         data.requests.forEach((request: any) => {
-          csvContent += `"${request.title}","${request.category}","${request.priority}","${request.status}","${request.created_at}","${request.propertyName}","${request.unit_number}","${request.tenantName}"\n`;
+          csvContent += `"${request.title}","${request.category}","${request.priority}","${request.status}","${request.created_at}",${request.actual_cost},${request.material_cost},"${request.propertyName}","${request.unit_number}","${request.tenantName}"\n`;
         });
         break;
         
+      case 'arrears-aging':
+        csvContent = sheetToCsv(arrearsByTenantSheet(data));
+        break;
+
+      case 'profit-loss':
+        csvContent = 'Section,Category,Amount,Prior Period,Change %\n';
+        data.income.forEach((line: any) => {
+          csvContent += `"Income","${line.category}",${line.amount},${line.prior_amount},${line.change ?? ''}\n`;
+        });
+        csvContent += `"Income","Total",${data.summary.totalIncome},${data.summary.priorIncome},${data.summary.incomeChange ?? ''}\n`;
+        data.expenses.forEach((line: any) => {
+          csvContent += `"Expenses","${line.category}",${line.amount},${line.prior_amount},${line.change ?? ''}\n`;
+        });
+        csvContent += `"Expenses","Total",${data.summary.totalExpenses},${data.summary.priorExpenses},${data.summary.expensesChange ?? ''}\n`;
+        csvContent += `"Net Operating Income","",${data.summary.netOperatingIncome},${data.summary.priorNetOperatingIncome},${data.summary.netOperatingIncomeChange ?? ''}\n`;
+        break;
+
+      case 'budget-variance':
+        csvContent = 'Property Name,Type,Category,Annual Budget,Budget to Date,Actual,Variance,Variance %,Remaining,Over Budget\n';
+        data.lines.forEach((line: any) => {
+          csvContent += `"${line.property_name}","${line.kind}","${line.category}",${line.annual_budget},${line.budget_to_date},${line.actual},${line.variance},${line.variance_pct ?? ''},${line.remaining},${line.over_budget ? 'Yes' : 'No'}\n`;
+        });
+        break;
+
+      case 'tax-summary':
+        csvContent = 'Landlord,KRA PIN,Gross Rent,Residential Rent,Commercial Rent,Other Income,On MRI,MRI Tax,Allowable Expenses,Net Rental Income,Withholding Credits,Tax Payable\n';
+        data.landlords.forEach((l: any) => {
+          csvContent += `"${l.landlord_name}","${l.tax_pin || ''}",${l.gross_rent},${l.residential_rent},${l.commercial_rent},${l.other_income},${l.mri_eligible ? 'Yes' : 'No'},${l.mri_tax},${l.allowable_expenses},${l.net_rental_income},${l.withholding_credits},${l.tax_payable ?? ''}\n`;
+        });
+        break;
+
+      case 'agency-rollup':
+        if (data.landlord) {
+          csvContent = 'Property,Commission Rate %,Units,Occupied Units,Occupancy %,Invoiced,Collected,Rent Collected,Collection %,Arrears,Commission\n';
+          data.properties.forEach((p: any) => {
+            csvContent += `"${p.property_name}",${p.commission_rate ?? ''},${p.units},${p.occupied_units},${p.occupancy_rate ?? ''},${p.invoiced},${p.collected},${p.rent_collected},${p.collection_rate ?? ''},${p.arrears},${p.commission}\n`;
+          });
+        } else {
+          csvContent = 'Landlord,Email,Properties,Units,Occupied Units,Occupancy %,Invoiced,Collected,Rent Collected,Collection %,Arrears,Commission,Properties Without Commission Rate\n';
+          data.landlords.forEach((l: any) => {
+            csvContent += `"${l.landlord_name}","${l.email || ''}",${l.properties},${l.units},${l.occupied_units},${l.occupancy_rate ?? ''},${l.invoiced},${l.collected},${l.rent_collected},${l.collection_rate ?? ''},${l.arrears},${l.commission},${l.properties_without_commission_rate}\n`;
+          });
+        }
+        break;
+
+      case 'custom': {
+        const cell = (value: any) => (typeof value === 'number' ? String(value) : `"${String(value ?? '').replace(/"/g, '""')}"`);
+        csvContent = data.columns.map((column: any) => cell(column.label)).join(',') + '\n';
+        data.rows.forEach((row: any) => {
+          csvContent += data.columns.map((column: any) => cell(row[column.key])).join(',') + '\n';
+        });
+        break;
+      }
+
+      case 'rent-roll':
+        csvContent = 'Property Name,Unit Number,Unit Type,Status,Tenant Name,Lease Number,Lease Status,Lease Start,Lease End,Market Rent,Lease Rent,Deposit,Balance\n';
+        data.rentRoll.forEach((row: any) => {
+          csvContent += `"${row.property_name}","${row.unit_number}","${row.unit_type}","${row.status}","${row.tenant_name || ''}","${row.lease_number || ''}","${row.lease_status || ''}","${row.lease_start || ''}","${row.lease_end || ''}",${row.market_rent},${row.lease_rent},${row.deposit},${row.balance}\n`;
+        });
+        break;
+
       default:
         csvContent = JSON.stringify(data, null, 2);
     }
 
     return csvContent;
   },
+
+  /**
+   * Excel workbook for a report: a summary sheet followed by typed detail sheets
+   */
+  convertToExcel(data: any, reportType: string): Buffer {
+    const summary = summarySheet(
+      'Summary',
+      Object.entries(data.summary || {})
+        .filter(([, value]) => value === null || typeof value !== 'object')
+        .map(([key, value]) => [key.replace(/_/g, ' ').replace(/([a-z])([A-Z])/g, '$1 $2').replace(/^\w/, c => c.toUpperCase()), value] as [string, any]),
+    );
+
+    switch (reportType) {
+      case 'property':
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'Properties',
+            columns: [
+              'Property Name', 'Type', 'Location',
+              { header: 'Total Units', type: 'integer' }, { header: 'Occupied Units', type: 'integer' }, { header: 'Vacant Units', type: 'integer' },
+              { header: 'Occupancy Rate', type: 'percent' }, { header: 'Potential Revenue', type: 'currency' }, { header: 'Actual Revenue', type: 'currency' },
+              'Owner', 'Agency', { header: 'Created', type: 'date' },
+            ],
+            rows: (data.properties || []).map((p: any) => [
+              p.name, p.type, p.location, p.totalUnits, p.occupiedUnits, p.vacantUnits,
+              p.occupancyRate, p.potentialRevenue, p.actualRevenue, p.owner, p.agency, p.created_at,
+            ]),
+          },
+        ]);
+      case 'financial':
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'Revenue by Property',
+            columns: ['Property', { header: 'Occupied Units', type: 'integer' }, { header: 'Monthly Rent Roll', type: 'currency' }],
+            rows: Object.values(data.revenueByProperty || {}).map((p: any) => [p.propertyName, p.units, p.totalRevenue]),
+          },
+          {
+            name: 'Invoices',
+            columns: ['Status', { header: 'Invoices', type: 'integer' }],
+            rows: Object.entries(data.invoiceBreakdown || {}).map(([status, count]) => [status, count as number]),
+          },
+          {
+            name: 'Arrears Aging',
+            columns: ['Days Overdue', { header: 'Outstanding', type: 'currency' }],
+            rows: data.arrearsAging
+              ? [...AGING_BUCKETS.map(b => [b.label, data.arrearsAging[b.key]]), ['Total', data.arrearsAging.total]]
+              : [],
+          },
+          {
+            name: 'Expenses',
+            columns: ['Category', { header: 'Entries', type: 'integer' }, { header: 'Amount', type: 'currency' }],
+            rows: (data.expensesByCategory || []).map((c: any) => [c.category, c.count, c.amount]),
+          },
+        ]);
+      case 'occupancy':
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'By Property',
+            columns: [
+              'Property', 'Type', { header: 'Total Units', type: 'integer' }, { header: 'Occupied', type: 'integer' }, { header: 'Vacant', type: 'integer' },
+              { header: 'Maintenance', type: 'integer' }, { header: 'Reserved', type: 'integer' }, { header: 'Occupancy Rate', type: 'percent' },
+            ],
+            rows: (data.byProperty || []).map((p: any) => [
+              p.propertyName, p.propertyType, p.totalUnits, p.occupiedUnits, p.vacantUnits, p.maintenanceUnits, p.reservedUnits, p.occupancyRate,
+            ]),
+          },
+          {
+            name: 'Units',
+            columns: ['Unit Number', 'Status', 'Unit Type', { header: 'Rent Amount', type: 'currency' }, 'Property Name', 'Tenant Name'],
+            rows: (data.unitDetails || []).map((u: any) => [u.unit_number, u.status, u.unit_type, u.rent_amount, u.propertyName, u.tenantName || '']),
+          },
+          {
+            name: 'Trend',
+            columns: [
+              'Month', { header: 'Total Units', type: 'integer' }, { header: 'Occupied', type: 'integer' }, { header: 'Vacant', type: 'integer' },
+              { header: 'Occupancy Rate', type: 'percent' }, { header: 'Leased Rent', type: 'currency' },
+            ],
+            rows: (data.trend || []).map((m: any) => [m.month, m.total_units, m.occupied_units, m.vacant_units, m.occupancy_rate, m.leased_rent]),
+          },
+        ]);
+      case 'rent-collection':
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'By Status',
+            columns: ['Status', { header: 'Invoices', type: 'integer' }, { header: 'Amount', type: 'currency' }],
+            rows: (data.byStatus || []).map((s: any) => [s.status, s.count, s.totalAmount]),
+          },
+          {
+            name: 'Invoices',
+            columns: [
+              'Invoice Number', { header: 'Amount', type: 'currency' }, { header: 'Amount Paid', type: 'currency' }, 'Status',
+              { header: 'Due Date', type: 'date' }, { header: 'Issued', type: 'date' }, 'Tenant Name', 'Tenant Email', 'Property Name', 'Unit Number',
+            ],
+            rows: (data.invoices || []).map((i: any) => [
+              i.invoice_number, i.amount, i.amount_paid, i.status, i.due_date, i.created_at, i.tenantName, i.tenant_email, i.propertyName, i.unit_number,
+            ]),
+          },
+        ]);
+      case 'maintenance':
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'By Category',
+            columns: ['Category', { header: 'Requests', type: 'integer' }],
+            rows: (data.byCategory || []).map((c: any) => [c.category, c.count]),
+          },
+          {
+            name: 'Requests',
+            columns: [
+              'Title', 'Category', 'Priority', 'Status', { header: 'Created', type: 'date' },
+              { header: 'Labour Cost', type: 'currency' }, { header: 'Material Cost', type: 'currency' }, 'Unit Number',
+            ],
+            rows: (data.requests || []).map((r: any) => [
+              r.title, r.category, r.priority, r.status, r.created_at, r.actual_cost, r.material_cost, r.unit_number,
+            ]),
+          },
+        ]);
+      case 'arrears-aging': {
+        const aging = AGING_BUCKETS.map(b => ({ header: b.label, type: 'currency' as const }));
+        return buildExcelWorkbook([
+          summary,
+          arrearsByTenantSheet(data),
+          {
+            name: 'By Property',
+            columns: ['Property', { header: 'Tenants in Arrears', type: 'integer' }, ...aging, { header: 'Total Outstanding', type: 'currency' }],
+            rows: (data.byProperty || []).map((p: any) => [
+              p.property_name, p.tenant_count, p.current, p.days_31_60, p.days_61_90, p.days_over_90, p.total,
+            ]),
+          },
+        ]);
+      }
+      case 'profit-loss': {
+        const money = (header: string) => ({ header, type: 'currency' as const });
+        const line = (section: string) => (l: any) => [section, l.category.replace(/_/g, ' '), l.amount, l.prior_amount, l.change];
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'Statement',
+            columns: ['Section', 'Category', money('Amount'), money('Prior Period'), { header: 'Change %', type: 'number' }],
+            rows: [
+              ...(data.income || []).map(line('Income')),
+              ['Income', 'Total', data.summary.totalIncome, data.summary.priorIncome, data.summary.incomeChange],
+              ...(data.expenses || []).map(line('Expenses')),
+              ['Expenses', 'Total', data.summary.totalExpenses, data.summary.priorExpenses, data.summary.expensesChange],
+              ['Net Operating Income', '', data.summary.netOperatingIncome, data.summary.priorNetOperatingIncome, data.summary.netOperatingIncomeChange],
+            ],
+          },
+          {
+            name: 'By Period',
+            columns: ['Period', money('Income'), money('Expenses'), money('Net Operating Income')],
+            rows: (data.periods || []).map((p: any) => [p.period, p.income, p.expenses, p.net_operating_income]),
+          },
+          {
+            name: 'By Property',
+            columns: ['Property', money('Income'), money('Expenses'), money('Net Operating Income')],
+            rows: (data.byProperty || []).map((p: any) => [p.property_name, p.income, p.expenses, p.net_operating_income]),
+          },
+        ]);
+      }
+      case 'custom': {
+        const columns = data.columns || [];
+        const numeric = columns.filter((c: any) => ['currency', 'number', 'integer'].includes(c.type));
+        const groupLabel = columns.find((c: any) => c.key === data.group_by)?.label || 'Group';
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'Results',
+            columns: columns.map((c: any) => ({ header: c.label, type: c.type })),
+            rows: (data.rows || []).map((row: any) => columns.map((c: any) => row[c.key])),
+          },
+          ...(data.groups?.length ? [{
+            name: 'Groups',
+            columns: [groupLabel, { header: 'Rows', type: 'integer' as const }, ...numeric.map((c: any) => ({ header: c.label, type: c.type }))],
+            rows: data.groups.map((g: any) => [g.group, g.count, ...numeric.map((c: any) => g[c.key])]),
+          }] : []),
+        ]);
+      }
+      case 'tax-summary': {
+        const money = (header: string) => ({ header, type: 'currency' as const });
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'Landlords',
+            columns: [
+              'Landlord', 'KRA PIN', 'Email', money('Gross Rent'), money('Residential Rent'), money('Commercial Rent'), money('Other Income'),
+              'On MRI', money('MRI Tax'), money('Annual Return Rent'), money('Allowable Expenses'), money('Net Rental Income'),
+              money('Withholding Credits'), money('Tax Payable'),
+            ],
+            rows: (data.landlords || []).map((l: any) => [
+              l.landlord_name, l.tax_pin || '', l.email || '', l.gross_rent, l.residential_rent, l.commercial_rent, l.other_income,
+              l.mri_eligible ? 'Yes' : 'No', l.mri_tax, l.annual_return_rent, l.allowable_expenses, l.net_rental_income,
+              l.withholding_credits, l.tax_payable,
+            ]),
+          },
+          {
+            name: 'Monthly MRI',
+            columns: [
+              'Landlord', 'KRA PIN', 'Month', money('Residential Rent'), money('MRI Tax'), money('Withholding Credits'),
+              money('Tax Payable'), { header: 'Due Date', type: 'date' },
+            ],
+            rows: (data.months || []).map((m: any) => [
+              m.landlord_name, m.tax_pin || '', m.month, m.residential_rent, m.mri_tax, m.withholding_credits, m.tax_payable, m.due_date,
+            ]),
+          },
+          {
+            name: 'Expenses',
+            columns: ['Landlord', 'Category', money('Amount')],
+            rows: (data.expenses || []).map((e: any) => [e.landlord_name, e.category.replace(/_/g, ' '), e.amount]),
+          },
+          {
+            name: 'By Property',
+            columns: ['Landlord', 'Property', 'Type', money('Gross Rent'), money('Expenses'), money('Withholding Credits')],
+            rows: (data.properties || []).map((p: any) => [
+              p.landlord_name, p.property_name, p.property_type, p.gross_rent, p.expenses, p.withholding_credits,
+            ]),
+          },
+          {
+            name: 'Withholding',
+            columns: [
+              'Landlord', { header: 'Date', type: 'date' }, 'Receipt', 'Tenant', 'Property',
+              money('Gross Rent'), money('Withheld'), 'Certificate',
+            ],
+            rows: (data.withholding || []).map((w: any) => [
+              w.landlord_name, w.payment_date, w.receipt_number, w.tenant_name, w.property_name, w.gross_rent, w.withheld, w.certificate,
+            ]),
+          },
+        ]);
+      }
+      case 'agency-rollup': {
+        const money = (header: string) => ({ header, type: 'currency' as const });
+        const percent = (header: string) => ({ header, type: 'percent' as const });
+        const figures = [
+          { header: 'Units', type: 'integer' as const }, { header: 'Occupied Units', type: 'integer' as const }, percent('Occupancy %'),
+          money('Invoiced'), money('Collected'), money('Rent Collected'), percent('Collection %'), money('Arrears'), money('Commission'),
+        ];
+        const values = (r: any) => [
+          r.units, r.occupied_units, r.occupancy_rate, r.invoiced, r.collected, r.rent_collected, r.collection_rate, r.arrears, r.commission,
+        ];
+        if (!data.landlord) {
+          return buildExcelWorkbook([
+            summary,
+            {
+              name: 'Landlords',
+              columns: ['Landlord', 'Email', { header: 'Properties', type: 'integer' }, ...figures, { header: 'Without Commission Rate', type: 'integer' }],
+              rows: (data.landlords || []).map((l: any) => [l.landlord_name, l.email || '', l.properties, ...values(l), l.properties_without_commission_rate]),
+            },
+          ]);
+        }
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'Properties',
+            columns: ['Property', 'Agency', percent('Commission Rate'), ...figures],
+            rows: (data.properties || []).map((p: any) => [p.property_name, p.agency_name || '', p.commission_rate, ...values(p)]),
+          },
+          {
+            name: 'By Month',
+            columns: ['Month', money('Collected'), money('Rent Collected'), money('Commission')],
+            rows: (data.months || []).map((m: any) => [m.month, m.collected, m.rent_collected, m.commission]),
+          },
+          {
+            name: 'Arrears',
+            columns: ['Invoice', 'Property', 'Unit', 'Tenant', money('Amount'), { header: 'Due Date', type: 'date' }, { header: 'Days Overdue', type: 'integer' }],
+            rows: (data.arrears || []).map((a: any) => [a.invoice_number, a.property_name, a.unit_number || '', a.tenant_name || '', a.amount, a.due_date, a.days_overdue]),
+          },
+        ]);
+      }
+      case 'budget-variance': {
+        const money = (header: string) => ({ header, type: 'currency' as const });
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'By Month',
+            columns: [
+              'Month', money('Income Budget'), money('Income Actual'), money('Income Variance'),
+              money('Expense Budget'), money('Expense Actual'), money('Expense Variance'), money('NOI Budget'), money('NOI Actual'),
+            ],
+            rows: (data.months || []).map((m: any) => [
+              m.month, m.income_budget, m.income_actual, m.income_variance,
+              m.expense_budget, m.expense_actual, m.expense_variance, m.noi_budget, m.noi_actual,
+            ]),
+          },
+          {
+            name: 'Lines',
+            columns: [
+              'Property', 'Type', 'Category', money('Annual Budget'), money('Budget to Date'), money('Actual'),
+              money('Variance'), { header: 'Variance %', type: 'number' }, money('Remaining'), 'Over Budget',
+            ],
+            rows: (data.lines || []).map((l: any) => [
+              l.property_name, l.kind, l.category.replace(/_/g, ' '), l.annual_budget, l.budget_to_date, l.actual,
+              l.variance, l.variance_pct, l.remaining, l.over_budget ? 'Yes' : 'No',
+            ]),
+          },
+        ]);
+      }
+      case 'rent-roll': {
+        const money = (header: string) => ({ header, type: 'currency' as const });
+        return buildExcelWorkbook([
+          summary,
+          {
+            name: 'Rent Roll',
+            columns: [
+              'Property', 'Unit', 'Unit Type', 'Status', 'Tenant', 'Email', 'Phone', 'Lease Number', 'Lease Status',
+              { header: 'Lease Start', type: 'date' }, { header: 'Lease End', type: 'date' },
+              money('Market Rent'), money('Lease Rent'), money('Deposit'), money('Balance'), 'Currency',
+            ],
+            rows: (data.rentRoll || []).map((r: any) => [
+              r.property_name, r.unit_number, r.unit_type, r.status, r.tenant_name, r.tenant_email, r.tenant_phone, r.lease_number, r.lease_status,
+              r.lease_start, r.lease_end, r.market_rent, r.lease_rent, r.deposit, r.balance, r.currency,
+            ]),
+          },
+          {
+            name: 'By Property',
+            columns: [
+              'Property', { header: 'Units', type: 'integer' }, { header: 'Occupied', type: 'integer' }, { header: 'Vacant', type: 'integer' },
+              { header: 'Occupancy Rate', type: 'percent' }, money('Market Rent'), money('Lease Rent'), money('Vacancy Loss'), money('Deposits'), money('Outstanding'),
+            ],
+            rows: (data.byProperty || []).map((p: any) => [
+              p.property_name, p.totalUnits, p.occupiedUnits, p.vacantUnits, p.occupancyRate,
+              p.marketRent, p.leaseRent, p.vacancyLoss, p.deposits, p.outstandingBalance,
+            ]),
+          },
+        ]);
+      }
+      default:
+        throw new Error('Invalid report type for export');
+    }
+  },
 };
@@ -0,0 +1,509 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { EXCEL_CONTENT_TYPE, EXCEL_FILE_EXTENSION } from '../utils/excel-export.js';
+import { EXPORT_REPORT_TYPES, signedLink } from './document-exports.service.js';
+
+export interface ScheduledReportRequest {
+  name?: string;
+  report_type?: string;
+  format?: string;
+  filters?: Record<string, any>;
+  frequency?: string;
+  day_of_week?: number | null;
+  day_of_month?: number | null;
+  hour?: number;
+  timezone?: string;
+  recipients?: string[];
+  is_active?: boolean;
+}
+
+const FORMATS = ['pdf', 'xlsx', 'csv'];
+const FREQUENCIES = ['daily', 'weekly', 'monthly'];
+// Roles that see every schedule in their company; everyone else manages their own
+const COMPANY_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const MAX_RECIPIENTS = 20;
+// A schedule that keeps failing is paused rather than alerting its owner forever
+const MAX_CONSECUTIVE_FAILURES = 5;
+// A run still "running" after this long died with its server
+const RUN_TIMEOUT_MS = 60 * 60 * 1000;
+const BATCH_SIZE = 10;
+const DAY = 24 * 60 * 60 * 1000;
+// Run files are kept this long for the run history, then deleted from storage
+const RUN_RETENTION_DAYS = 30;
+// The link in the email works for a week; after that, issue a new one from the run history
+const EMAIL_LINK_DAYS = 7;
+
+const EMAIL_PATTERN = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
+
+const CONTENT_TYPES: Record<string, string> = {
+  pdf: 'application/pdf',
+  xlsx: EXCEL_CONTENT_TYPE,
+  csv: 'text/csv',
+};
+
+/**
+ * Wall-clock fields of an instant in a time zone
+ */
+const zonedParts = (date: Date, timeZone: string) => {
+  const parts = new Intl.DateTimeFormat('en-US', {
+    timeZone,
+    hourCycle: 'h23',
+    year: 'numeric',
+    month: 'numeric',
+    day: 'numeric',
+    hour: 'numeric',
+    minute: 'numeric',
+    second: 'numeric',
+  }).formatToParts(date);
+  const get = (type: string) => Number(parts.find(p => p.type === type)?.value);
+  return { year: get('year'), month: get('month'), day: get('day'), hour: get('hour'), minute: get('minute'), second: get('second') };
+};
+
+/**
+ * The instant a local date and hour in a time zone refers to
+ */
+const zonedTime = (year: number, month: number, day: number, hour: number, timeZone: string) => {
+  const guess = Date.UTC(year, month - 1, day, hour);
+  const p = zonedParts(new Date(guess), timeZone);
+  const offset = Date.UTC(p.year, p.month - 1, p.day, p.hour, p.minute, p.second) - guess;
+  return new Date(guess - offset);
+};
+
+/**
+ * First run strictly after `after`, at the schedule's local hour on a matching day
+ */
+export const nextRunAt = (
+  schedule: { frequency: string; day_of_week: number | null; day_of_month: number | null; hour: number; timezone: string },
+  after: Date
+): Date => {
+  const today = zonedParts(after, schedule.timezone);
+  // Two months covers every monthly day; the loop always returns well before that
+  for (let i = 0; i <= 62; i++) {
+    const day = new Date(Date.UTC(today.year, today.month - 1, today.day + i));
+    if (schedule.frequency === 'weekly' && day.getUTCDay() !== schedule.day_of_week) continue;
+    if (schedule.frequency === 'monthly' && day.getUTCDate() !== schedule.day_of_month) continue;
+    const candidate = zonedTime(day.getUTCFullYear(), day.getUTCMonth() + 1, day.getUTCDate(), schedule.hour, schedule.timezone);
+    if (candidate > after) return candidate;
+  }
+  return new Date(after.getTime() + DAY);
+};
+
+/**
+ * Reports generated on a schedule: each run renders the report with the owner's current access,
+ * stores the file, emails it to the recipients and is kept as run history. Failed runs alert the
+ * owner, and a schedule that fails repeatedly is paused.
+ */
+export class ScheduledReportsService {
+  private prisma = getPrisma();
+
+  private scopeWhere(user: JWTClaims) {
+    if (user.role === 'super_admin') return {};
+    if (COMPANY_ROLES.includes(user.role)) return { company_id: user.company_id };
+    return { company_id: user.company_id, created_by: user.user_id };
+  }
+
+  private async getScoped(id: string, user: JWTClaims) {
+    const schedule = await this.prisma.scheduledReport.findFirst({ where: { id, ...this.scopeWhere(user) } });
+    if (!schedule) {
+      throw new Error('Scheduled report not found');
+    }
+    return schedule;
+  }
+
+  /**
+   * Validate the fields that are present; the result is merged over the stored schedule
+   */
+  private buildData(req: ScheduledReportRequest) {
+    if (req.name !== undefined && !String(req.name).trim()) {
+      throw new Error('name must not be empty');
+    }
+    if (req.report_type !== undefined && !EXPORT_REPORT_TYPES.includes(req.report_type)) {
+      throw new Error(`report_type must be one of: ${EXPORT_REPORT_TYPES.join(', ')}`);
+    }
+    if (req.format !== undefined && !FORMATS.includes(req.format)) {
+      throw new Error(`format must be one of: ${FORMATS.join(', ')}`);
+    }
+    if (req.frequency !== undefined && !FREQUENCIES.includes(req.frequency)) {
+      throw new Error(`frequency must be one of: ${FREQUENCIES.join(', ')}`);
+    }
+    if (req.hour !== undefined && (!Number.isInteger(req.hour) || req.hour < 0 || req.hour > 23)) {
+      throw new Error('hour must be a whole number between 0 and 23');
+    }
+    if (req.day_of_week != null && (!Number.isInteger(req.day_of_week) || req.day_of_week < 0 || req.day_of_week > 6)) {
+      throw new Error('day_of_week must be a whole number between 0 (Sunday) and 6');
+    }
+    // Capped at 28 so every month has the day
+    if (req.day_of_month != null && (!Number.isInteger(req.day_of_month) || req.day_of_month < 1 || req.day_of_month > 28)) {
+      throw new Error('day_of_month must be a whole number between 1 and 28');
+    }
+    if (req.timezone !== undefined) {
+      try {
+        new Intl.DateTimeFormat('en-US', { timeZone: req.timezone });
+      } catch {
+        throw new Error('timezone must be a valid IANA time zone, e.g. Africa/Nairobi');
+      }
+    }
+    if (req.filters !== undefined && (typeof req.filters !== 'object' || Array.isArray(req.filters) || req.filters === null)) {
+      throw new Error('filters must be an object');
+    }
+
+    let recipients: string[] | undefined;
+    if (req.recipients !== undefined) {
+      if (!Array.isArray(req.recipients)) {
+        throw new Error('recipients must be a list of email addresses');
+      }
+      recipients = [...new Set(req.recipients.map(email => String(email).trim().toLowerCase()).filter(Boolean))];
+      const invalid = recipients.find(email => !EMAIL_PATTERN.test(email));
+      if (invalid) {
+        throw new Error(`recipients must be valid email addresses: ${invalid}`);
+      }
+      if (!recipients.length || recipients.length > MAX_RECIPIENTS) {
+        throw new Error(`recipients must have between 1 and ${MAX_RECIPIENTS} email addresses`);
+      }
+    }
+
+    return {
+      ...(req.name !== undefined && { name: String(req.name).trim() }),
+      ...(req.report_type !== undefined && { report_type: req.report_type }),
+      ...(req.format !== undefined && { format: req.format }),
+      ...(req.filters !== undefined && { filters: req.filters }),
+      ...(req.frequency !== undefined && { frequency: req.frequency }),
+      ...(req.day_of_week !== undefined && { day_of_week: req.day_of_week }),
+      ...(req.day_of_month !== undefined && { day_of_month: req.day_of_month }),
+      ...(req.hour !== undefined && { hour: req.hour }),
+      ...(req.timezone !== undefined && { timezone: req.timezone }),
+      ...(recipients && { recipients }),
+      ...(req.is_active !== undefined && { is_active: !!req.is_active }),
+    };
+  }
+
+  /**
+   * Weekly schedules need a weekday and monthly ones a day of the month
+   */
+  private assertTiming(schedule: { frequency: string; day_of_week: number | null; day_of_month: number | null }) {
+    if (schedule.frequency === 'weekly' && schedule.day_of_week == null) {
+      throw new Error('day_of_week is required for weekly schedules');
+    }
+    if (schedule.frequency === 'monthly' && schedule.day_of_month == null) {
+      throw new Error('day_of_month is required for monthly schedules');
+    }
+  }
+
+  /**
+   * Custom reports run a saved template, which must exist and be visible to the schedule's owner
+   */
+  private async assertTemplate(schedule: { report_type: string; filters: any }, user: JWTClaims) {
+    if (schedule.report_type !== 'custom') return;
+    const templateId = (schedule.filters || {}).template_id;
+    if (!templateId) {
+      throw new Error('filters.template_id is required for custom reports');
+    }
+    const { reportBuilderService } = await import('./report-builder.service.js');
+    await reportBuilderService.get(String(templateId), user);
+  }
+
+  async list(user: JWTClaims) {
+    return this.prisma.scheduledReport.findMany({
+      where: this.scopeWhere(user),
+      include: { creator: { select: { id: true, first_name: true, last_name: true } } },
+      orderBy: { created_at: 'desc' },
+    });
+  }
+
+  async create(req: ScheduledReportRequest, user: JWTClaims) {
+    if (!req.name || !req.report_type || !req.frequency || !req.recipients) {
+      throw new Error('name, report_type, frequency and recipients are required');
+    }
+    const data = this.buildData(req);
+    const timing = {
+      frequency: data.frequency!,
+      day_of_week: data.day_of_week ?? null,
+      day_of_month: data.day_of_month ?? null,
+      hour: data.hour ?? 7,
+      timezone: data.timezone || 'Africa/Nairobi',
+    };
+    this.assertTiming(timing);
+    await this.assertTemplate({ report_type: data.report_type!, filters: data.filters }, user);
+
+    return this.prisma.scheduledReport.create({
+      data: {
+        ...data,
+        ...timing,
+        name: data.name!,
+        report_type: data.report_type!,
+        recipients: data.recipients!,
+        company_id: user.company_id || null,
+        created_by: user.user_id,
+        next_run_at: nextRunAt(timing, new Date()),
+      },
+    });
+  }
+
+  async update(id: string, req: ScheduledReportRequest, user: JWTClaims) {
+    const schedule = await this.getScoped(id, user);
+    const data = this.buildData(req);
+    const merged = { ...schedule, ...data };
+    this.assertTiming(merged);
+    await this.assertTemplate(merged, user);
+
+    // Timing changes and reactivation both start counting from now
+    const retime = ['frequency', 'day_of_week', 'day_of_month', 'hour', 'timezone'].some(field => field in data)
+      || (data.is_active && !schedule.is_active);
+    return this.prisma.scheduledReport.update({
+      where: { id },
+      data: {
+        ...data,
+        ...(retime && { next_run_at: nextRunAt(merged, new Date()) }),
+        ...(data.is_active && !schedule.is_active && { consecutive_failures: 0 }),
+        updated_at: new Date(),
+      },
+    });
+  }
+
+  async delete(id: string, user: JWTClaims) {
+    await this.getScoped(id, user);
+    await this.prisma.scheduledReport.delete({ where: { id } });
+  }
+
+  async listRuns(id: string, user: JWTClaims, limit: number = 20) {
+    await this.getScoped(id, user);
+    const runs = await this.prisma.scheduledReportRun.findMany({
+      where: { schedule_id: id },
+      orderBy: { started_at: 'desc' },
+      take: Math.min(Math.max(limit, 1), 100),
+    });
+    return Promise.all(runs.map(run => this.presentRun(run)));
+  }
+
+  /**
+   * A fresh signed link to a run's file; `expiresIn` is in seconds
+   */
+  async issueRunLink(id: string, runId: string, user: JWTClaims, expiresIn?: number) {
+    await this.getScoped(id, user);
+    const run = await this.prisma.scheduledReportRun.findFirst({ where: { id: runId, schedule_id: id } });
+    if (!run) {
+      throw new Error('Scheduled report run not found');
+    }
+    return signedLink(run, expiresIn);
+  }
+
+  /**
+   * Delete run files past their expiry from storage; the runs stay as history
+   */
+  async purgeExpired(now = new Date()) {
+    const expired = await this.prisma.scheduledReportRun.findMany({
+      where: { expires_at: { lte: now }, file_id: { not: null } },
+      select: { id: true, file_id: true },
+      take: 50,
+    });
+    const { imagekitService } = await import('./imagekit.service.js');
+    for (const run of expired) {
+      try {
+        await imagekitService.deleteFile(run.file_id!);
+      } catch (error: any) {
+        console.error(`⚠️ Failed to delete expired scheduled report file ${run.id}:`, error.message);
+        continue;
+      }
+      await this.prisma.scheduledReportRun.update({ where: { id: run.id }, data: { file_url: null, file_id: null } });
+    }
+    return { expired: expired.length };
+  }
+
+  private async presentRun(run: any) {
+    const { file_url, ...rest } = run;
+    const link = file_url ? await signedLink(run).catch(() => null) : null;
+    return {
+      ...rest,
+      file_expired: !!run.expires_at && run.expires_at <= new Date(),
+      download_url: link?.download_url || null,
+      download_url_expires_at: link?.download_url_expires_at || null,
+    };
+  }
+
+  /**
+   * Generate and send a schedule now, outside its timetable
+   */
+  async runNow(id: string, user: JWTClaims) {
+    const schedule = await this.getScoped(id, user);
+    return this.execute(schedule.id, 'manual');
+  }
+
+  /**
+   * Scheduled run: every active schedule whose time has come
+   */
+  async runDue(now = new Date()) {
+    // Runs interrupted by a restart are closed off; the schedule has already moved on
+    await this.prisma.scheduledReportRun.updateMany({
+      where: { status: 'running', started_at: { lt: new Date(now.getTime() - RUN_TIMEOUT_MS) } },
+      data: { status: 'failed', error: 'Run was interrupted', completed_at: now },
+    });
+
+    const due = await this.prisma.scheduledReport.findMany({
+      where: { is_active: true, next_run_at: { lte: now } },
+      orderBy: { next_run_at: 'asc' },
+      take: BATCH_SIZE,
+    });
+    let succeeded = 0;
+    let failed = 0;
+    for (const schedule of due) {
+      // Moving next_run_at doubles as a claim, so a schedule is run once per slot
+      const claimed = await this.prisma.scheduledReport.updateMany({
+        where: { id: schedule.id, is_active: true, next_run_at: schedule.next_run_at },
+        data: { next_run_at: nextRunAt(schedule, now) },
+      });
+      if (!claimed.count) continue;
+      const run = await this.execute(schedule.id, 'schedule');
+      if (run.status === 'success') succeeded++;
+      else failed++;
+    }
+    return { processed: succeeded + failed, succeeded, failed };
+  }
+
+  private async execute(scheduleId: string, trigger: string) {
+    const schedule = await this.prisma.scheduledReport.findUniqueOrThrow({
+      where: { id: scheduleId },
+      include: {
+        creator: { select: { id: true, email: true, phone_number: true, role: true, company_id: true, agency_id: true, landlord_id: true, status: true } },
+      },
+    });
+    const run = await this.prisma.scheduledReportRun.create({ data: { schedule_id: schedule.id, trigger } });
+
+    try {
+      if (schedule.creator.status !== 'active') {
+        throw new Error('Schedule owner is no longer active');
+      }
+      // Generated with the owner's current access, not what they had when they set it up
+      const user = {
+        user_id: schedule.creator.id,
+        email: schedule.creator.email || '',
+        phone_number: schedule.creator.phone_number || '',
+        role: schedule.creator.role,
+        company_id: schedule.creator.company_id || undefined,
+        agency_id: schedule.creator.agency_id || undefined,
+        landlord_id: schedule.creator.landlord_id || undefined,
+      } as JWTClaims;
+
+      const { file, fileName, title } = await this.generate(schedule, user);
+      const { imagekitService } = await import('./imagekit.service.js');
+      const upload = await imagekitService.uploadFile(file, fileName, `reports/${schedule.company_id || 'system'}`, { isPrivate: true });
+      const expiresAt = new Date(Date.now() + RUN_RETENTION_DAYS * DAY);
+      await this.prisma.scheduledReportRun.update({
+        where: { id: run.id },
+        data: { file_name: fileName, file_size: file.length, file_url: upload.url, file_id: upload.fileId, expires_at: expiresAt },
+      });
+      const link = imagekitService.signedDownload(upload.url, EMAIL_LINK_DAYS * DAY / 1000, expiresAt)!;
+
+      const { emailTemplatesService } = await import('./email-templates.service.js');
+      const result = await emailTemplatesService.send('scheduled_report', {
+        to: schedule.recipients,
+        companyId: schedule.company_id,
+        variables: {
+          report_title: title,
+          report_name: schedule.name,
+          frequency: schedule.frequency,
+          download_url: link.url,
+          link_expires_at: link.expires_at,
+        },
+        attachments: [{ filename: fileName, content: file, type: CONTENT_TYPES[schedule.format] }],
+      });
+      if (!result.success) {
+        throw new Error(`Email delivery failed: ${result.error || 'email provider rejected the report'}`);
+      }
+
+      const completed = new Date();
+      await this.prisma.$transaction([
+        this.prisma.scheduledReportRun.update({
+          where: { id: run.id },
+          data: { status: 'success', recipient_count: schedule.recipients.length, completed_at: completed },
+        }),
+        this.prisma.scheduledReport.update({
+          where: { id: schedule.id },
+          data: { last_run_at: completed, last_status: 'success', consecutive_failures: 0 },
+        }),
+      ]);
+      // Manual runs are recorded by the route; deliveries made by the scheduler are recorded here
+      if (trigger === 'schedule') {
+        const { reportAuditService } = await import('./report-audit.service.js');
+        await reportAuditService.record({
+          user,
+          action: 'scheduled',
+          report_type: schedule.report_type,
+          format: schedule.format,
+          parameters: { filters: schedule.filters, recipients: schedule.recipients, schedule_id: schedule.id },
+          resource_type: 'scheduled_report_run',
+          resource_id: run.id,
+        });
+      }
+    } catch (error: any) {
+      const message = error.message || 'Unknown error';
+      const failures = schedule.consecutive_failures + 1;
+      const paused = failures >= MAX_CONSECUTIVE_FAILURES;
+      const completed = new Date();
+      await this.prisma.$transaction([
+        this.prisma.scheduledReportRun.update({
+          where: { id: run.id },
+          data: { status: 'failed', error: message, completed_at: completed },
+        }),
+        this.prisma.scheduledReport.update({
+          where: { id: schedule.id },
+          data: {
+            last_run_at: completed,
+            last_status: 'failed',
+            consecutive_failures: failures,
+            ...(paused && { is_active: false }),
+          },
+        }),
+      ]);
+      await this.alertFailure(schedule, run.id, message, paused).catch(alertError => {
+        console.error(`❌ Failed to alert about scheduled report ${schedule.id}:`, alertError.message);
+      });
+    }
+
+    return this.presentRun(await this.prisma.scheduledReportRun.findUniqueOrThrow({ where: { id: run.id } }));
+  }
+
+  private async generate(schedule: any, user: JWTClaims) {
+    const { reportsService } = await import('./reports.service.js');
+    const filters = schedule.filters || {};
+    const date = new Date().toISOString().split('T')[0];
+    const baseName = `${schedule.report_type}_report_${date}`;
+
+    if (schedule.format === 'pdf') {
+      const { documentService } = await import('../modules/documents/document-service.js');
+      const report = await reportsService.getReportDocument(user, schedule.report_type, filters);
+      const file = await documentService.getReportPdf(schedule.report_type, report.title, report.rows, report.summary, user, 1, report.charts);
+      return { file, fileName: `${baseName}.pdf`, title: report.title };
+    }
+
+    const data = await reportsService.exportReport(user, schedule.report_type, schedule.format, filters);
+    const extension = schedule.format === 'xlsx' ? EXCEL_FILE_EXTENSION : 'csv';
+    const title = `${schedule.report_type.replace(/-/g, ' ').replace(/\b\w/g, (c: string) => c.toUpperCase())} Report`;
+    return { file: Buffer.isBuffer(data) ? data : Buffer.from(data), fileName: `${baseName}.${extension}`, title };
+  }
+
+  /**
+   * Tell the owner a run failed, and whether the schedule has been paused because of it
+   */
+  private async alertFailure(schedule: any, runId: string, error: string, paused: boolean) {
+    const { notificationsService } = await import('./notifications.service.js');
+    const channels = await notificationsService.resolveChannels(schedule.created_by, 'scheduled_report_failed', ['email'], 'general', 'high');
+    await notificationsService.notify({
+      company_id: schedule.company_id,
+      recipient_id: schedule.created_by,
+      title: paused ? `Scheduled report paused: ${schedule.name}` : `Scheduled report failed: ${schedule.name}`,
+      message: paused
+        ? `"${schedule.name}" failed ${MAX_CONSECUTIVE_FAILURES} times in a row and has been paused. Last error: ${error}`
+        : `"${schedule.name}" could not be generated or sent: ${error}`,
+      notification_type: 'scheduled_report_failed',
+      category: 'general',
+      priority: 'high',
+      action_required: true,
+      action_url: `/reports/schedules/${schedule.id}`,
+      related_entity_type: 'scheduled_report',
+      related_entity_id: schedule.id,
+      metadata: { schedule_id: schedule.id, run_id: runId, paused },
+    }, channels);
+  }
+}
+
+export const scheduledReportsService = new ScheduledReportsService();
@@ -1,10 +1,40 @@
 import * as cron from 'node-cron';
 import { InvoicesService } from './invoices.service.js';
-import { emailService } from './email.service.js';
+import { emailTemplatesService } from './email-templates.service.js';
+import { notificationsService } from './notifications.service.js';
+import { ShortStayService } from './short-stay.service.js';
+import { pushNotificationService } from './push-notification.service.js';
+import { UnitApplicationsService } from './unit-applications.service.js';
+import { maintenanceSlaService } from './maintenance-sla.service.js';
+import { inspectionSchedulingService } from './inspection-scheduling.service.js';
+import { emergencyService } from './emergency.service.js';
+import { preventiveMaintenanceService } from './preventive-maintenance.service.js';
+import { broadcastService } from './broadcast.service.js';
+import { tenancyChatsService } from './tenancy-chats.service.js';
+import { digestService } from './digest.service.js';
+import { notificationDeliveryService } from './notification-delivery.service.js';
+import { messageEscalationService } from './message-escalation.service.js';
+import { documentExportsService } from './document-exports.service.js';
+import { scheduledReportsService } from './scheduled-reports.service.js';
+import { expensesService } from './expenses.service.js';
+import { occupancyHistoryService } from './occupancy-history.service.js';
+import { agencyHealthService } from './agency-health.service.js';
+import { budgetsService } from './budgets.service.js';
+import { accountExportsService } from './account-exports.service.js';
+import { kpiAlertsService } from './kpi-alerts.service.js';
+import { platformAnalyticsService } from './platform-analytics.service.js';
+import { trialsService } from './trials.service.js';
+import { propertyDelegationsService } from './property-delegations.service.js';
+import { subscriptionBillingService } from './subscription-billing.service.js';
+import { usageMeteringService } from './usage-metering.service.js';
+import { dataRetentionService } from './data-retention.service.js';
 import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
 
 const prisma = getPrisma();
 const invoicesService = new InvoicesService();
+const shortStayService = new ShortStayService();
+const unitApplicationsService = new UnitApplicationsService();
 
 export class SchedulerService {
   private static instance: SchedulerService;
@@ -66,6 +96,298 @@ export class SchedulerService {
       }
     });
 
+    // 5. Hourly: Import short-stay bookings from external calendars (Airbnb, Booking.com)
+    this.scheduleTask('short-stay-calendar-sync', '15 * * * *', async () => {
+      try {
+        const result = await shortStayService.syncAllExternalCalendars();
+        console.log(`✅ Synced external calendars for ${result.units} units (${result.failed} failed)`);
+      } catch (error) {
+        console.error('❌ Error syncing external calendars:', error);
+      }
+    });
+
+    // 6. Hourly: Pass unanswered waiting-list offers on to the next applicant
+    this.scheduleTask('waitlist-offer-expiry', '30 * * * *', async () => {
+      try {
+        const result = await unitApplicationsService.expireWaitlistOffers();
+        console.log(`✅ Expired ${result.expired} waiting list offers`);
+      } catch (error) {
+        console.error('❌ Error expiring waiting list offers:', error);
+      }
+    });
+
+    // 7. Every 15 minutes: Flag and escalate maintenance requests that missed their SLA
+    this.scheduleTask('maintenance-sla-escalation', '*/15 * * * *', async () => {
+      try {
+        const result = await maintenanceSlaService.checkBreaches();
+        if (result.response_breaches || result.resolution_breaches) {
+          console.log(`⚠️ Escalated ${result.response_breaches} response and ${result.resolution_breaches} resolution SLA breaches`);
+        }
+      } catch (error) {
+        console.error('❌ Error checking maintenance SLAs:', error);
+      }
+    });
+
+    // 8. Daily: Generate preventive maintenance tasks/work orders and send due reminders (6 AM)
+    this.scheduleTask('preventive-maintenance', '0 6 * * *', async () => {
+      try {
+        const result = await preventiveMaintenanceService.processDueSchedules();
+        console.log(`✅ Generated ${result.generated} preventive maintenance items, sent ${result.reminders} reminders`);
+      } catch (error) {
+        console.error('❌ Error processing preventive maintenance schedules:', error);
+      }
+    });
+
+    // 9. Hourly: Remind inspectors and tenants of inspections in the next 24 hours
+    this.scheduleTask('inspection-reminders', '45 * * * *', async () => {
+      try {
+        const result = await inspectionSchedulingService.sendReminders();
+        if (result.reminded) {
+          console.log(`✅ Sent reminders for ${result.reminded} upcoming inspections`);
+        }
+      } catch (error) {
+        console.error('❌ Error sending inspection reminders:', error);
+      }
+    });
+
+    // 10. Every minute: Escalate emergencies nobody has acknowledged in time
+    this.scheduleTask('emergency-escalation', '* * * * *', async () => {
+      try {
+        const escalated = await emergencyService.escalateUnacknowledged();
+        if (escalated) {
+          console.log(`🚨 Escalated ${escalated} unacknowledged emergencies`);
+        }
+      } catch (error) {
+        console.error('❌ Error escalating emergencies:', error);
+      }
+    });
+
+    // 11. Every minute: Send broadcasts whose scheduled time has come
+    this.scheduleTask('scheduled-broadcasts', '* * * * *', async () => {
+      try {
+        const result = await broadcastService.processScheduled();
+        if (result.due) {
+          console.log(`📢 Sent ${result.sent} of ${result.due} scheduled broadcasts`);
+        }
+      } catch (error) {
+        console.error('❌ Error sending scheduled broadcasts:', error);
+      }
+    });
+
+    // 12. Hourly: Open tenancy chats for leases that started and archive those of ended leases
+    this.scheduleTask('tenancy-chats', '5 * * * *', async () => {
+      try {
+        const result = await tenancyChatsService.sync();
+        if (result.opened || result.archived) {
+          console.log(`💬 Opened ${result.opened} and archived ${result.archived} tenancy chats`);
+        }
+      } catch (error) {
+        console.error('❌ Error syncing tenancy chats:', error);
+      }
+    });
+
+    // 13. Daily: Send daily email digests, and weekly ones on Mondays (7 AM)
+    this.scheduleTask('email-digests', '0 7 * * *', async () => {
+      try {
+        const result = await digestService.sendDue();
+        if (result.sent) {
+          console.log(`📬 Sent ${result.sent} email digests`);
+        }
+      } catch (error) {
+        console.error('❌ Error sending email digests:', error);
+      }
+    });
+
+    // 14. Every minute: Retry due notification deliveries (push, email, SMS)
+    this.scheduleTask('notification-deliveries', '* * * * *', async () => {
+      try {
+        const result = await notificationDeliveryService.processDue();
+        if (result.dead_lettered) {
+          console.warn(`⚠️ Dead-lettered ${result.dead_lettered} notification deliveries`);
+        }
+      } catch (error) {
+        console.error('❌ Error processing notification deliveries:', error);
+      }
+    });
+
+    // 15. Every 5 minutes: Escalate urgent messages left unanswered past an agency rule
+    this.scheduleTask('message-escalations', '*/5 * * * *', async () => {
+      try {
+        const result = await messageEscalationService.evaluate();
+        if (result.escalated) {
+          console.log(`🚨 Escalated ${result.escalated} unanswered conversations`);
+        }
+      } catch (error) {
+        console.error('❌ Error evaluating message escalation rules:', error);
+      }
+    });
+
+    // 16. Every minute: Render queued PDF exports, retry failed ones and delete expired files
+    this.scheduleTask('document-exports', '* * * * *', async () => {
+      try {
+        const result = await documentExportsService.processPending();
+        const purged = await documentExportsService.purgeExpired();
+        if (result.processed || purged.expired) {
+          console.log(`📄 Processed ${result.processed} document exports (${result.ready} ready), expired ${purged.expired}`);
+        }
+      } catch (error) {
+        console.error('❌ Error processing document exports:', error);
+      }
+    });
+
+    // 17. Every 5 minutes: Generate and email scheduled reports that are due, and delete expired run files
+    this.scheduleTask('scheduled-reports', '*/5 * * * *', async () => {
+      try {
+        const result = await scheduledReportsService.runDue();
+        const purged = await scheduledReportsService.purgeExpired();
+        if (result.processed || purged.expired) {
+          console.log(`📊 Ran ${result.processed} scheduled reports (${result.succeeded} sent, ${result.failed} failed), expired ${purged.expired} files`);
+        }
+      } catch (error) {
+        console.error('❌ Error running scheduled reports:', error);
+      }
+    });
+
+    // 18. Daily: Record the copies of recurring expenses that are due (1 AM)
+    this.scheduleTask('recurring-expenses', '0 1 * * *', async () => {
+      try {
+        const result = await expensesService.recordRecurring();
+        if (result.recorded) {
+          console.log(`🧾 Recorded ${result.recorded} recurring expenses`);
+        }
+      } catch (error) {
+        console.error('❌ Error recording recurring expenses:', error);
+      }
+    });
+
+    // 19. Daily: Capture this month's occupancy per property; the last run of the month stands (11:55 PM)
+    this.scheduleTask('occupancy-snapshots', '55 23 * * *', async () => {
+      try {
+        const result = await occupancyHistoryService.captureCurrentMonth();
+        console.log(`🏘️ Captured occupancy for ${result.captured} properties`);
+      } catch (error) {
+        console.error('❌ Error capturing occupancy snapshots:', error);
+      }
+    });
+
+    // 20. Daily: Score agency health over the last 90 days (2:30 AM)
+    this.scheduleTask('agency-health-scores', '30 2 * * *', async () => {
+      try {
+        const result = await agencyHealthService.computeAll();
+        console.log(`🩺 Scored health for ${result.scored} agencies`);
+      } catch (error) {
+        console.error('❌ Error computing agency health scores:', error);
+      }
+    });
+
+    // 21. Daily: Alert owners about expense categories running over budget (7 AM)
+    this.scheduleTask('budget-overspend-alerts', '0 7 * * *', async () => {
+      try {
+        const result = await budgetsService.checkOverspend();
+        if (result.alerted > 0) {
+          console.log(`📊 Sent ${result.alerted} over-budget alerts`);
+        }
+      } catch (error) {
+        console.error('❌ Error checking budget overspend:', error);
+      }
+    });
+
+    // 22. Every 5 minutes: Build queued account data exports and delete expired archives
+    this.scheduleTask('account-exports', '*/5 * * * *', async () => {
+      try {
+        const result = await accountExportsService.processPending();
+        const purged = await accountExportsService.purgeExpired();
+        if (result.processed || purged.expired) {
+          console.log(`🗄️ Processed ${result.processed} account exports (${result.ready} ready), expired ${purged.expired}`);
+        }
+      } catch (error) {
+        console.error('❌ Error processing account exports:', error);
+      }
+    });
+
+    // 23. Hourly: Evaluate landlords' KPI alert rules (quarter past)
+    this.scheduleTask('kpi-alerts', '15 * * * *', async () => {
+      try {
+        const result = await kpiAlertsService.evaluateAll();
+        if (result.triggered || result.resolved) {
+          console.log(`🚨 KPI alerts: ${result.triggered} triggered, ${result.resolved} resolved (${result.evaluated} rules)`);
+        }
+      } catch (error) {
+        console.error('❌ Error evaluating KPI alerts:', error);
+      }
+    });
+
+    // 24. Nightly: Snapshot platform analytics for the super admin's growth history (11:50 PM)
+    this.scheduleTask('platform-analytics-snapshot', '50 23 * * *', async () => {
+      try {
+        const snapshot = await platformAnalyticsService.captureSnapshot();
+        console.log(`📈 Captured platform analytics for ${snapshot.snapshot_date.toISOString().split('T')[0]}`);
+      } catch (error) {
+        console.error('❌ Error capturing platform analytics snapshot:', error);
+      }
+    });
+
+    // 25. Daily: Close out ended trials, then remind trials ending in 7, 3 or 1 days (8:30 AM)
+    this.scheduleTask('trial-lifecycle', '30 8 * * *', async () => {
+      try {
+        const { converted, expired } = await trialsService.expireTrials();
+        const { sent } = await trialsService.sendReminders();
+        if (converted || expired || sent) {
+          console.log(`⏳ Trials: ${converted} converted, ${expired} expired, ${sent} reminders sent`);
+        }
+      } catch (error) {
+        console.error('❌ Error processing trial subscriptions:', error);
+      }
+    });
+
+    // 26. Daily: Start property delegations due today and end those past their end date (12:05 AM)
+    this.scheduleTask('property-delegations', '5 0 * * *', async () => {
+      try {
+        const { started, ended } = await propertyDelegationsService.processDue();
+        if (started || ended) {
+          console.log(`🤝 Property delegations: ${started} started, ${ended} ended`);
+        }
+      } catch (error) {
+        console.error('❌ Error processing property delegations:', error);
+      }
+    });
+
+    // 27. Daily: Invoice subscriptions due for billing and retry failed charges (6:00 AM)
+    this.scheduleTask('subscription-billing', '0 6 * * *', async () => {
+      try {
+        const invoices = await subscriptionBillingService.generateDueInvoices();
+        const dunning = await subscriptionBillingService.runDunning();
+        if (invoices.generated || dunning.retried || dunning.timed_out) {
+          console.log(`🧾 Subscription billing: ${invoices.generated} invoiced, ${invoices.charged} charged, ${dunning.recovered}/${dunning.retried} retries recovered`);
+        }
+      } catch (error) {
+        console.error('❌ Error running subscription billing:', error);
+      }
+    });
+
+    // 28. Daily: Measure each agency's storage for usage metering (11:40 PM)
+    this.scheduleTask('agency-storage-usage', '40 23 * * *', async () => {
+      try {
+        const { measured } = await usageMeteringService.snapshotStorage();
+        console.log(`💾 Measured storage for ${measured} agencies`);
+      } catch (error) {
+        console.error('❌ Error measuring agency storage:', error);
+      }
+    });
+
+    // 29. Daily: Delete and anonymize data past its retention policy (3:30 AM)
+    this.scheduleTask('data-retention', '30 3 * * *', async () => {
+      try {
+        const report = await dataRetentionService.run();
+        if (report.total_affected) {
+          const changed = report.policies.filter(policy => policy.affected).map(policy => `${policy.key} ${policy.affected}`);
+          console.log(`🧹 Data retention: ${changed.join(', ')}`);
+        }
+      } catch (error) {
+        console.error('❌ Error applying data retention policies:', error);
+      }
+    });
+
     console.log(`✅ Initialized ${this.tasks.size} scheduled tasks`);
   }
 
@@ -133,12 +455,15 @@ export class SchedulerService {
             console.warn(`⚠️ No email found for invoice recipient ${invoice.recipient.id}`);
             continue;
           }
+          if (!(await notificationsService.accepts(invoice.recipient.id, 'invoice', 'email', 'payment_reminder'))) {
+            continue;
+          }
 
-          await emailService.sendEmail({
+          await emailTemplatesService.send('rent_reminder', {
             to: invoice.recipient.email,
-            subject: `Rent Payment Reminder - Due in ${days} days`,
-            html: this.generateReminderEmailTemplate(invoice, days),
-            type: 'rent_reminder'
+            recipientId: invoice.recipient.id,
+            companyId: invoice.company_id,
+            variables: { ...this.invoiceEmailVariables(invoice), days },
           });
 
           // TODO: Update reminder tracking in database
@@ -185,13 +510,16 @@ export class SchedulerService {
       }
 
       if (!invoice.recipient.email) continue;
+      if (!(await notificationsService.accepts(invoice.recipient.id, 'invoice', 'email', 'payment_reminder', 'high'))) {
+        continue;
+      }
 
       try {
-        await emailService.sendEmail({
+        await emailTemplatesService.send('late_rent_reminder', {
           to: invoice.recipient.email,
-          subject: `Late Rent Reminder - Invoice ${invoice.invoice_number}`,
-          html: this.generateReminderEmailTemplate(invoice, 0),
-          type: 'late_rent_reminder',
+          recipientId: invoice.recipient.id,
+          companyId: invoice.company_id,
+          variables: this.invoiceEmailVariables(invoice),
         });
       } catch (error) {
         console.error(`❌ Failed to send late reminder for invoice ${invoice.id}:`, error);
@@ -251,25 +579,25 @@ export class SchedulerService {
           }
           // Notify landlord
           if (lease.property.owner.email) {
-            await emailService.sendEmail({
+            await emailTemplatesService.send('lease_expiring_landlord', {
               to: lease.property.owner.email,
-              subject: `Lease Expiration Alert - ${days} days remaining`,
-              html: this.generateLeaseExpirationTemplate(lease, days, 'landlord'),
-              type: 'lease_expiration'
+              recipientId: lease.property.owner.id,
+              companyId: lease.company_id,
+              variables: { ...this.leaseEmailVariables(lease, days), landlord_name: `${lease.property.owner.first_name} ${lease.property.owner.last_name}` },
             });
           } else {
             console.warn(`⚠️ No email found for property owner ${lease.property.owner.id}`);
           }
 
           // Notify tenant
-          if (lease.tenant.email) {
-            await emailService.sendEmail({
+          if (lease.tenant.email && await notificationsService.accepts(lease.tenant.id, 'lease', 'email', 'lease_update')) {
+            await emailTemplatesService.send('lease_expiring_tenant', {
               to: lease.tenant.email,
-              subject: `Your lease expires in ${days} days`,
-              html: this.generateLeaseExpirationTemplate(lease, days, 'tenant'),
-              type: 'lease_expiration'
+              recipientId: lease.tenant.id,
+              companyId: lease.company_id,
+              variables: this.leaseEmailVariables(lease, days),
             });
-          } else {
+          } else if (!lease.tenant.email) {
             console.warn(`⚠️ No email found for tenant ${lease.tenant.id}`);
           }
 
@@ -301,6 +629,10 @@ export class SchedulerService {
 
       console.log(`🧹 Cleaned up ${deletedNotifications.count} old notifications`);
 
+      // Drop push tokens from uninstalled/abandoned app installs
+      const tokenCleanup = await pushNotificationService.cleanupStaleTokens();
+      console.log(`🧹 Deactivated ${tokenCleanup.deactivated} stale push tokens, deleted ${tokenCleanup.deleted} inactive tokens`);
+
       // TODO: Add more cleanup tasks as needed
       // - Clean up expired sessions
       // - Archive old maintenance requests
@@ -312,51 +644,34 @@ export class SchedulerService {
   }
 
   /**
-   * Generate email template for rent reminders
+   * Variables shared by the rent reminder email templates
    */
-  private generateReminderEmailTemplate(invoice: any, days: number): string {
-    return `
-      <h2>Rent Payment Reminder</h2>
-      <p>Dear ${invoice.tenant.first_name} ${invoice.tenant.last_name},</p>
-      <p>This is a friendly reminder that your rent payment is due in <strong>${days} days</strong>.</p>
-      <p><strong>Payment Details:</strong></p>
-      <ul>
-        <li>Amount: KES ${invoice.amount}</li>
-        <li>Due Date: ${invoice.due_date.toLocaleDateString()}</li>
-        <li>Property: ${invoice.lease?.property?.name || 'N/A'}</li>
-        <li>Unit: ${invoice.lease?.unit?.unit_number || 'N/A'}</li>
-      </ul>
-      <p>Please ensure payment is made before the due date to avoid late fees.</p>
-      <p>Thank you,<br>LetRents Property Management</p>
-    `;
+  private invoiceEmailVariables(invoice: any) {
+    return {
+      tenant_name: `${invoice.recipient.first_name} ${invoice.recipient.last_name}`,
+      amount: Number(invoice.total_amount),
+      currency: invoice.currency,
+      due_date: invoice.due_date,
+      invoice_number: invoice.invoice_number,
+      property_name: invoice.property?.name,
+      unit_number: invoice.unit?.unit_number,
+      payment_url: `${env.appUrl}/tenant/payments`,
+    };
   }
 
   /**
-   * Generate email template for lease expiration alerts
+   * Variables shared by the lease expiration email templates
    */
-  private generateLeaseExpirationTemplate(lease: any, days: number, recipientType: 'landlord' | 'tenant'): string {
-    const recipientName = recipientType === 'landlord' 
-      ? `${lease.landlord.first_name} ${lease.landlord.last_name}`
-      : `${lease.tenant.first_name} ${lease.tenant.last_name}`;
-
-    return `
-      <h2>Lease Expiration Notice</h2>
-      <p>Dear ${recipientName},</p>
-      <p>This is to inform you that a lease agreement will expire in <strong>${days} days</strong>.</p>
-      <p><strong>Lease Details:</strong></p>
-      <ul>
-        <li>Property: ${lease.property.name}</li>
-        <li>Unit: ${lease.unit.unit_number}</li>
-        <li>Tenant: ${lease.tenant.first_name} ${lease.tenant.last_name}</li>
-        <li>Expiration Date: ${lease.end_date.toLocaleDateString()}</li>
-        <li>Monthly Rent: KES ${lease.monthly_rent}</li>
-      </ul>
-      <p>${recipientType === 'landlord' 
-        ? 'Please contact your tenant to discuss lease renewal options.'
-        : 'Please contact your landlord to discuss lease renewal or moving arrangements.'
-      }</p>
-      <p>Best regards,<br>LetRents Property Management</p>
-    `;
+  private leaseEmailVariables(lease: any, days: number) {
+    return {
+      tenant_name: `${lease.tenant.first_name} ${lease.tenant.last_name}`,
+      days,
+      end_date: lease.end_date,
+      property_name: lease.property.name,
+      unit_number: lease.unit.unit_number,
+      monthly_rent: Number(lease.rent_amount),
+      currency: lease.currency,
+    };
   }
 
   /**
@@ -0,0 +1,537 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { fetchPublicText } from '../utils/public-fetch.js';
+
+const prisma = getPrisma();
+
+const MS_PER_DAY = 24 * 60 * 60 * 1000;
+const MANAGING_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+
+export interface StayQuote {
+  nights: number;
+  weeks: number;
+  extra_nights: number;
+  nightly_rate: number;
+  weekly_rate: number | null;
+  cleaning_fee: number;
+  accommodation_total: number;
+  total_amount: number;
+  currency: string;
+}
+
+// The lease or booking whose own dates don't count as a conflict when it is moved
+export interface StayExclusion {
+  leaseId?: string;
+  bookingId?: string;
+}
+
+export interface CreateBookingRequest {
+  check_in: string;
+  check_out: string;
+  status?: 'tentative' | 'confirmed' | 'blocked';
+  guest_name?: string;
+  notes?: string;
+}
+
+/**
+ * Number of nights between two dates (check-out day is not charged)
+ */
+export function countNights(checkIn: Date, checkOut: Date): number {
+  const start = Date.UTC(checkIn.getUTCFullYear(), checkIn.getUTCMonth(), checkIn.getUTCDate());
+  const end = Date.UTC(checkOut.getUTCFullYear(), checkOut.getUTCMonth(), checkOut.getUTCDate());
+  return Math.round((end - start) / MS_PER_DAY);
+}
+
+/**
+ * Price a stay: full weeks at the weekly rate (when set), remaining nights at the nightly rate,
+ * plus a one-off cleaning fee.
+ */
+export function calculateStayPrice(
+  nights: number,
+  nightlyRate: number,
+  weeklyRate?: number | null,
+  cleaningFee?: number | null
+): Omit<StayQuote, 'currency'> {
+  const weeks = weeklyRate ? Math.floor(nights / 7) : 0;
+  const extraNights = nights - weeks * 7;
+  const accommodationTotal = weeks * Number(weeklyRate || 0) + extraNights * nightlyRate;
+  const fee = Number(cleaningFee || 0);
+
+  return {
+    nights,
+    weeks,
+    extra_nights: extraNights,
+    nightly_rate: nightlyRate,
+    weekly_rate: weeklyRate ? Number(weeklyRate) : null,
+    cleaning_fee: fee,
+    accommodation_total: Math.round(accommodationTotal * 100) / 100,
+    total_amount: Math.round((accommodationTotal + fee) * 100) / 100,
+  };
+}
+
+export class ShortStayService {
+  private async getAccessibleUnit(unitId: string, user: JWTClaims) {
+    const unit = await prisma.unit.findUnique({
+      where: { id: unitId },
+      include: { property: { select: { id: true, name: true, company_id: true, owner_id: true, agency_id: true } } },
+    });
+
+    if (!unit) {
+      throw new Error('unit not found');
+    }
+
+    const hasAccess =
+      user.role === 'super_admin' ||
+      (user.company_id && unit.company_id === user.company_id) ||
+      unit.property.owner_id === user.user_id ||
+      (user.role === 'agency_admin' && user.agency_id && unit.property.agency_id === user.agency_id);
+
+    if (!hasAccess) {
+      throw new Error('insufficient permissions to access this unit');
+    }
+
+    return unit;
+  }
+
+  private parseStayDates(checkIn: string, checkOut: string) {
+    const start = new Date(checkIn);
+    const end = new Date(checkOut);
+    if (isNaN(start.getTime()) || isNaN(end.getTime())) {
+      throw new Error('check_in and check_out must be valid dates');
+    }
+    const nights = countNights(start, end);
+    if (nights < 1) {
+      throw new Error('check_out must be after check_in');
+    }
+    return { start, end, nights };
+  }
+
+  /**
+   * Price a prospective stay using the unit's short-stay rates
+   */
+  async getQuote(unitId: string, checkIn: string, checkOut: string, user: JWTClaims): Promise<StayQuote> {
+    const unit = await this.getAccessibleUnit(unitId, user);
+    const { nights } = this.parseStayDates(checkIn, checkOut);
+
+    if (!unit.short_stay_enabled || !unit.nightly_rate) {
+      throw new Error('unit is not configured for short stays');
+    }
+    if (nights < unit.min_stay_nights) {
+      throw new Error(`minimum stay for this unit is ${unit.min_stay_nights} nights`);
+    }
+
+    return {
+      ...calculateStayPrice(nights, Number(unit.nightly_rate), unit.weekly_rate ? Number(unit.weekly_rate) : null, unit.cleaning_fee ? Number(unit.cleaning_fee) : null),
+      currency: unit.currency,
+    };
+  }
+
+  /**
+   * Find bookings and long-term leases that overlap the requested dates, leaving out the lease or
+   * booking being moved
+   */
+  async findConflicts(unitId: string, checkIn: Date, checkOut: Date, exclude: StayExclusion = {}, db: Prisma.TransactionClient = prisma): Promise<any[]> {
+    const excludeLeaseId = exclude.leaseId;
+    const [bookings, leases] = await Promise.all([
+      db.unitBooking.findMany({
+        where: {
+          unit_id: unitId,
+          status: { not: 'cancelled' },
+          check_in: { lt: checkOut },
+          check_out: { gt: checkIn },
+          ...(excludeLeaseId && { OR: [{ lease_id: null }, { lease_id: { not: excludeLeaseId } }] }),
+          ...(exclude.bookingId && { id: { not: exclude.bookingId } }),
+        },
+      }),
+      db.lease.findMany({
+        where: {
+          unit_id: unitId,
+          status: 'active',
+          lease_type: { not: 'short_stay' },
+          start_date: { lt: checkOut },
+          end_date: { gt: checkIn },
+          ...(excludeLeaseId && { id: { not: excludeLeaseId } }),
+        },
+        select: { id: true, lease_number: true, start_date: true, end_date: true },
+      }),
+    ]);
+
+    return [
+      ...bookings.map((b) => ({ type: 'booking', id: b.id, check_in: b.check_in, check_out: b.check_out, status: b.status, source: b.source })),
+      ...leases.map((l) => ({ type: 'lease', id: l.id, lease_number: l.lease_number, check_in: l.start_date, check_out: l.end_date })),
+    ];
+  }
+
+  /**
+   * Check the dates are free and make the booking write in one serializable transaction, so two
+   * requests for the same dates cannot both pass the check. Whichever commits second fails.
+   */
+  async reserveDates<T>(
+    unitId: string,
+    checkIn: Date,
+    checkOut: Date,
+    write: (tx: Prisma.TransactionClient) => Promise<T>,
+    exclude: StayExclusion = {}
+  ): Promise<T> {
+    try {
+      return await prisma.$transaction(async (tx) => {
+        const conflicts = await this.findConflicts(unitId, checkIn, checkOut, exclude, tx);
+        if (conflicts.length > 0) {
+          throw new Error('unit is already booked for the selected dates');
+        }
+        return write(tx);
+      }, { isolationLevel: Prisma.TransactionIsolationLevel.Serializable });
+    } catch (error: any) {
+      // Serialization failure: a concurrent booking for overlapping dates committed first
+      if (error.code === 'P2034') {
+        throw new Error('unit is already booked for the selected dates');
+      }
+      throw error;
+    }
+  }
+
+  async checkAvailability(unitId: string, checkIn: string, checkOut: string, user: JWTClaims): Promise<any> {
+    await this.getAccessibleUnit(unitId, user);
+    const { start, end, nights } = this.parseStayDates(checkIn, checkOut);
+    const conflicts = await this.findConflicts(unitId, start, end);
+
+    return { available: conflicts.length === 0, nights, conflicts };
+  }
+
+  /**
+   * Booking calendar for a unit over a date range (defaults to the next 90 days)
+   */
+  async getCalendar(unitId: string, user: JWTClaims, from?: string, to?: string): Promise<any> {
+    const unit = await this.getAccessibleUnit(unitId, user);
+    const rangeStart = from ? new Date(from) : new Date();
+    const rangeEnd = to ? new Date(to) : new Date(rangeStart.getTime() + 90 * MS_PER_DAY);
+
+    const bookings = await prisma.unitBooking.findMany({
+      where: {
+        unit_id: unitId,
+        status: { not: 'cancelled' },
+        check_in: { lt: rangeEnd },
+        check_out: { gt: rangeStart },
+      },
+      include: {
+        lease: { select: { id: true, lease_number: true, tenant_id: true, status: true } },
+      },
+      orderBy: { check_in: 'asc' },
+    });
+
+    return {
+      unit_id: unit.id,
+      unit_number: unit.unit_number,
+      short_stay_enabled: unit.short_stay_enabled,
+      from: rangeStart.toISOString().split('T')[0],
+      to: rangeEnd.toISOString().split('T')[0],
+      bookings,
+    };
+  }
+
+  /**
+   * Manually block dates or record a booking taken outside the platform
+   */
+  async createBooking(unitId: string, req: CreateBookingRequest, user: JWTClaims): Promise<any> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage bookings');
+    }
+
+    const unit = await this.getAccessibleUnit(unitId, user);
+    const { start, end } = this.parseStayDates(req.check_in, req.check_out);
+
+    return this.reserveDates(unitId, start, end, (tx) => tx.unitBooking.create({
+      data: {
+        company_id: unit.company_id,
+        unit_id: unitId,
+        check_in: start,
+        check_out: end,
+        status: req.status || 'blocked',
+        source: 'manual',
+        guest_name: req.guest_name || null,
+        notes: req.notes || null,
+        created_by: user.user_id,
+      },
+    }));
+  }
+
+  /**
+   * Create the calendar entry for a short_stay lease
+   */
+  async createLeaseBooking(lease: any, guestName?: string, db: Prisma.TransactionClient = prisma): Promise<any> {
+    return db.unitBooking.create({
+      data: {
+        company_id: lease.company_id,
+        unit_id: lease.unit_id,
+        lease_id: lease.id,
+        check_in: lease.start_date,
+        check_out: lease.end_date,
+        status: 'confirmed',
+        source: 'lease',
+        guest_name: guestName || null,
+        created_by: lease.created_by,
+      },
+    });
+  }
+
+  /**
+   * Release calendar dates held by a lease (termination/cancellation)
+   */
+  async releaseLeaseBookings(leaseId: string): Promise<void> {
+    await prisma.unitBooking.updateMany({
+      where: { lease_id: leaseId, status: { not: 'cancelled' } },
+      data: { status: 'cancelled', updated_at: new Date() },
+    });
+  }
+
+  async cancelBooking(unitId: string, bookingId: string, user: JWTClaims): Promise<void> {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage bookings');
+    }
+    await this.getAccessibleUnit(unitId, user);
+
+    const booking = await prisma.unitBooking.findFirst({ where: { id: bookingId, unit_id: unitId } });
+    if (!booking) {
+      throw new Error('booking not found');
+    }
+    if (booking.lease_id) {
+      throw new Error('bookings created from a lease must be cancelled by terminating the lease');
+    }
+
+    await prisma.unitBooking.update({
+      where: { id: bookingId },
+      data: { status: 'cancelled', updated_at: new Date() },
+    });
+  }
+
+  /**
+   * Export the unit calendar as iCalendar so it can be imported into Airbnb/Booking.com
+   */
+  async exportICal(unitId: string, user: JWTClaims): Promise<string> {
+    const unit = await this.getAccessibleUnit(unitId, user);
+    const bookings = await prisma.unitBooking.findMany({
+      where: { unit_id: unitId, status: { not: 'cancelled' }, check_out: { gte: new Date() } },
+      orderBy: { check_in: 'asc' },
+    });
+
+    const formatDate = (d: Date) => d.toISOString().split('T')[0].replace(/-/g, '');
+    const stamp = new Date().toISOString().replace(/[-:]/g, '').split('.')[0] + 'Z';
+
+    const lines = [
+      'BEGIN:VCALENDAR',
+      'VERSION:2.0',
+      'PRODID:-//LetRents//Short Stay Calendar//EN',
+      'CALSCALE:GREGORIAN',
+      `X-WR-CALNAME:${unit.property.name} - Unit ${unit.unit_number}`,
+    ];
+    for (const booking of bookings) {
+      lines.push(
+        'BEGIN:VEVENT',
+        `UID:${booking.id}@letrents`,
+        `DTSTAMP:${stamp}`,
+        `DTSTART;VALUE=DATE:${formatDate(booking.check_in)}`,
+        `DTEND;VALUE=DATE:${formatDate(booking.check_out)}`,
+        `SUMMARY:${booking.status === 'blocked' ? 'Blocked' : 'Reserved'}`,
+        'END:VEVENT'
+      );
+    }
+    lines.push('END:VCALENDAR');
+
+    return lines.join('\r\n');
+  }
+
+  /**
+   * Import bookings from the unit's external iCal feed. Events are matched on UID so repeated
+   * syncs update in place, and future imported events that disappear from the feed are cancelled.
+   */
+  async syncExternalCalendar(
+    unitId: string,
+    user?: JWTClaims
+  ): Promise<{ imported: number; updated: number; cancelled: number; conflicts: number }> {
+    const unit = user
+      ? await this.getAccessibleUnit(unitId, user)
+      : await prisma.unit.findUnique({ where: { id: unitId } });
+
+    if (!unit) {
+      throw new Error('unit not found');
+    }
+    if (!unit.ical_import_url) {
+      throw new Error('unit has no external calendar configured');
+    }
+
+    // The feed URL is user supplied, so only public addresses are fetched, briefly and capped
+    const response = await fetchPublicText(unit.ical_import_url, { timeoutMs: 15_000, maxBytes: 2 * 1024 * 1024 })
+      .catch((error: Error) => { throw new Error(`failed to fetch external calendar: ${error.message}`); });
+    if (response.status < 200 || response.status >= 300) {
+      throw new Error(`failed to fetch external calendar: ${response.status}`);
+    }
+    const events = this.parseICalEvents(response.body);
+
+    let imported = 0;
+    let updated = 0;
+    let conflicts = 0;
+    const collisions: typeof events = [];
+    for (const event of events) {
+      const existing = await prisma.unitBooking.findUnique({
+        where: { unit_id_external_uid: { unit_id: unitId, external_uid: event.uid } },
+      });
+      const sameDates = existing && existing.status !== 'cancelled'
+        && existing.check_in.getTime() === event.start.getTime() && existing.check_out.getTime() === event.end.getTime();
+
+      if (existing && sameDates && existing.status === 'confirmed') {
+        await prisma.unitBooking.update({
+          where: { id: existing.id },
+          data: { notes: event.summary, updated_at: new Date() },
+        });
+        updated++;
+        continue;
+      }
+
+      // New or moved events (and ones flagged earlier) take the dates only if they are still free
+      const write = (status: string) => (db: Prisma.TransactionClient) => existing
+        ? db.unitBooking.update({
+          where: { id: existing.id },
+          data: { check_in: event.start, check_out: event.end, status, notes: event.summary, updated_at: new Date() },
+        })
+        : db.unitBooking.create({
+          data: {
+            company_id: unit.company_id,
+            unit_id: unitId,
+            check_in: event.start,
+            check_out: event.end,
+            status,
+            source: 'ical',
+            external_uid: event.uid,
+            notes: event.summary,
+          },
+        });
+      try {
+        await this.reserveDates(unitId, event.start, event.end, write('confirmed'), { bookingId: existing?.id });
+        if (existing) {
+          updated++;
+        } else {
+          imported++;
+        }
+      } catch (error: any) {
+        if (error.message !== 'unit is already booked for the selected dates') {
+          throw error;
+        }
+        // Double-booked across channels: keep the external stay as tentative so the dates stay
+        // blocked, and tell the owner the first time it is seen
+        await write('tentative')(prisma);
+        conflicts++;
+        if (!(sameDates && existing!.status === 'tentative')) {
+          collisions.push(event);
+        }
+      }
+    }
+
+    const removed = await prisma.unitBooking.updateMany({
+      where: {
+        unit_id: unitId,
+        source: 'ical',
+        status: { not: 'cancelled' },
+        check_in: { gte: new Date() },
+        external_uid: { notIn: events.map((e) => e.uid) },
+      },
+      data: { status: 'cancelled', updated_at: new Date() },
+    });
+
+    if (collisions.length > 0) {
+      await this.notifyCalendarCollisions(unit, collisions);
+    }
+
+    return { imported, updated, cancelled: removed.count, conflicts };
+  }
+
+  /**
+   * Tell the property owner that stays from the external calendar overlap bookings made here
+   */
+  private async notifyCalendarCollisions(
+    unit: { id: string; company_id: string; property_id: string; unit_number: string },
+    collisions: Array<{ start: Date; end: Date; summary: string | null }>
+  ) {
+    try {
+      const property = await prisma.property.findUnique({
+        where: { id: unit.property_id },
+        select: { name: true, owner_id: true },
+      });
+      if (!property) {
+        return;
+      }
+      const day = (date: Date) => date.toISOString().split('T')[0];
+      const stays = collisions.map((event) => `${day(event.start)} to ${day(event.end)}${event.summary ? ` (${event.summary})` : ''}`);
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: unit.company_id,
+        recipient_id: property.owner_id,
+        property_id: unit.property_id,
+        unit_id: unit.id,
+        title: 'Double booking from external calendar',
+        message: `Unit ${unit.unit_number} at ${property.name} has external stays that overlap existing bookings: ${stays.join('; ')}. They are held as tentative until resolved.`,
+        notification_type: 'booking',
+        category: 'property',
+        priority: 'high',
+        action_required: true,
+      });
+    } catch (error: any) {
+      console.error(`⚠️ Failed to notify about calendar collisions for unit ${unit.id}:`, error.message);
+    }
+  }
+
+  /**
+   * Sync every unit that has an external calendar configured (used by the scheduler)
+   */
+  async syncAllExternalCalendars(): Promise<{ units: number; failed: number }> {
+    const units = await prisma.unit.findMany({
+      where: { short_stay_enabled: true, ical_import_url: { not: null } },
+      select: { id: true },
+    });
+
+    let failed = 0;
+    for (const unit of units) {
+      try {
+        await this.syncExternalCalendar(unit.id);
+      } catch (error) {
+        failed++;
+        console.error(`❌ Failed to sync external calendar for unit ${unit.id}:`, error);
+      }
+    }
+
+    return { units: units.length, failed };
+  }
+
+  private parseICalEvents(ics: string): Array<{ uid: string; start: Date; end: Date; summary: string | null }> {
+    // Unfold continuation lines (RFC 5545 §3.1)
+    const lines = ics.replace(/\r?\n[ \t]/g, '').split(/\r?\n/);
+    const events: Array<{ uid: string; start: Date; end: Date; summary: string | null }> = [];
+    let current: Record<string, string> | null = null;
+
+    const parseDate = (value: string) => {
+      const m = value.match(/^(\d{4})(\d{2})(\d{2})/);
+      return m ? new Date(Date.UTC(Number(m[1]), Number(m[2]) - 1, Number(m[3]))) : null;
+    };
+
+    for (const line of lines) {
+      if (line === 'BEGIN:VEVENT') {
+        current = {};
+      } else if (line === 'END:VEVENT' && current) {
+        const start = current.DTSTART ? parseDate(current.DTSTART) : null;
+        const end = current.DTEND ? parseDate(current.DTEND) : null;
+        if (current.UID && start && end && end > start) {
+          events.push({ uid: current.UID.slice(0, 255), start, end, summary: current.SUMMARY || null });
+        }
+        current = null;
+      } else if (current) {
+        const idx = line.indexOf(':');
+        if (idx > 0) {
+          const key = line.slice(0, idx).split(';')[0].toUpperCase();
+          current[key] = line.slice(idx + 1).trim();
+        }
+      }
+    }
+
+    return events;
+  }
+}
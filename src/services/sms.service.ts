@@ -0,0 +1,518 @@
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { agencyBrandingService } from './agency-branding.service.js';
+import { usageMeteringService } from './usage-metering.service.js';
+
+export type SmsStatus = 'queued' | 'sent' | 'delivered' | 'failed' | 'rejected';
+
+// SMS gateway interface
+export interface SmsProvider {
+  readonly name: string;
+  sendSms(options: SmsSendOptions): Promise<SmsProviderResult>;
+  // Normalise a delivery report callback body, or null when it isn't one
+  parseDeliveryReport(body: Record<string, any>): SmsDeliveryReport | null;
+  // Some gateways only price a message once it has been handed to the network
+  fetchCost?(providerMessageId: string): Promise<{ cost: number; currency: string } | null>;
+}
+
+export interface SmsSendOptions {
+  to: string;
+  body: string;
+  senderId?: string | null;
+}
+
+export interface SmsProviderResult {
+  status: SmsStatus;
+  providerMessageId?: string;
+  segments?: number;
+  cost?: number;
+  currency?: string;
+  error?: string;
+}
+
+export interface SmsDeliveryReport {
+  providerMessageId: string;
+  status: SmsStatus;
+  failureReason?: string;
+}
+
+export interface SmsOptions {
+  to: string;
+  body: string;
+  companyId?: string | null;
+  recipientId?: string | null;
+  type?: string; // SMS type for tracking/billing
+}
+
+export interface SmsResult {
+  success: boolean;
+  id?: string;
+  status?: SmsStatus;
+  error?: string;
+}
+
+const SMS_ADMIN_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+
+// Characters in the GSM 03.38 default alphabet; anything else forces UCS-2 encoding
+const GSM_CHARS = /^[@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !"#¤%&'()*+,\-./0-9:;<=>?¡A-ZÄÖÑÜ§¿a-zäöñüà^{}\\[~\]|€]*$/;
+
+/**
+ * Billable segments: 160/153 characters for GSM-7, 70/67 for UCS-2 (single/concatenated)
+ */
+export function countSegments(body: string): number {
+  const gsm = GSM_CHARS.test(body);
+  const [single, multi] = gsm ? [160, 153] : [70, 67];
+  const length = gsm ? body.length + (body.match(/[\^{}\\[~\]|€]/g)?.length || 0) : [...body].length;
+  return length <= single ? 1 : Math.ceil(length / multi);
+}
+
+/**
+ * E.164 for a phone number, treating local numbers as Kenyan (07xx / 01xx / 7xx)
+ */
+export function normalizePhone(phone: string): string | null {
+  const digits = phone.replace(/[^\d+]/g, '');
+  if (/^\+\d{9,15}$/.test(digits)) return digits;
+  if (/^254\d{9}$/.test(digits)) return `+${digits}`;
+  if (/^0[17]\d{8}$/.test(digits)) return `+254${digits.slice(1)}`;
+  if (/^[17]\d{8}$/.test(digits)) return `+254${digits}`;
+  return null;
+}
+
+// Africa's Talking Provider Implementation
+export class AfricasTalkingProvider implements SmsProvider {
+  readonly name = 'africastalking';
+  private username: string;
+  private apiKey: string;
+
+  constructor() {
+    this.username = env.sms.africastalking.username;
+    this.apiKey = env.sms.africastalking.apiKey;
+    if (!this.username || !this.apiKey) {
+      throw new Error("AFRICASTALKING_USERNAME and AFRICASTALKING_API_KEY are required for the Africa's Talking SMS provider");
+    }
+  }
+
+  private get baseUrl() {
+    return this.username === 'sandbox' ? 'https://api.sandbox.africastalking.com' : 'https://api.africastalking.com';
+  }
+
+  async sendSms(options: SmsSendOptions): Promise<SmsProviderResult> {
+    const form = new URLSearchParams({ username: this.username, to: options.to, message: options.body });
+    if (options.senderId) {
+      form.set('from', options.senderId);
+    }
+    const response = await fetch(`${this.baseUrl}/version1/messaging`, {
+      method: 'POST',
+      headers: { apiKey: this.apiKey, Accept: 'application/json', 'Content-Type': 'application/x-www-form-urlencoded' },
+      body: form,
+    });
+    if (!response.ok) {
+      return { status: 'failed', error: `Africa's Talking responded ${response.status}: ${await response.text()}` };
+    }
+    const data: any = await response.json();
+    const recipient = data?.SMSMessageData?.Recipients?.[0];
+    if (!recipient) {
+      return { status: 'failed', error: data?.SMSMessageData?.Message || "No recipient in Africa's Talking response" };
+    }
+    // "KES 0.8000"
+    const [currency, amount] = String(recipient.cost || '').split(' ');
+    const accepted = [100, 101, 102].includes(Number(recipient.statusCode));
+    return {
+      status: accepted ? 'sent' : 'rejected',
+      providerMessageId: recipient.messageId && recipient.messageId !== 'None' ? recipient.messageId : undefined,
+      cost: amount ? Number(amount) : undefined,
+      currency: currency || undefined,
+      error: accepted ? undefined : recipient.status,
+    };
+  }
+
+  parseDeliveryReport(body: Record<string, any>): SmsDeliveryReport | null {
+    if (!body.id || !body.status) return null;
+    const statuses: Record<string, SmsStatus> = {
+      Success: 'delivered',
+      Sent: 'sent',
+      Submitted: 'sent',
+      Buffered: 'sent',
+      Rejected: 'rejected',
+      Failed: 'failed',
+      AbsentSubscriber: 'failed',
+      Expired: 'failed',
+    };
+    return {
+      providerMessageId: String(body.id),
+      status: statuses[body.status] || 'sent',
+      failureReason: body.failureReason || undefined,
+    };
+  }
+}
+
+// Twilio Provider Implementation
+export class TwilioProvider implements SmsProvider {
+  readonly name = 'twilio';
+  private accountSid: string;
+  private authToken: string;
+
+  constructor() {
+    this.accountSid = env.sms.twilio.accountSid;
+    this.authToken = env.sms.twilio.authToken;
+    if (!this.accountSid || !this.authToken) {
+      throw new Error('TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required for the Twilio SMS provider');
+    }
+    if (!env.sms.twilio.fromNumber && !env.sms.twilio.messagingServiceSid) {
+      throw new Error('TWILIO_FROM_NUMBER or TWILIO_MESSAGING_SERVICE_SID is required for the Twilio SMS provider');
+    }
+  }
+
+  private get headers() {
+    return {
+      Authorization: `Basic ${Buffer.from(`${this.accountSid}:${this.authToken}`).toString('base64')}`,
+      Accept: 'application/json',
+    };
+  }
+
+  async sendSms(options: SmsSendOptions): Promise<SmsProviderResult> {
+    const form = new URLSearchParams({ To: options.to, Body: options.body });
+    if (options.senderId) {
+      // Alphanumeric sender ID, where the destination network allows it
+      form.set('From', options.senderId);
+    } else if (env.sms.twilio.messagingServiceSid) {
+      form.set('MessagingServiceSid', env.sms.twilio.messagingServiceSid);
+    } else {
+      form.set('From', env.sms.twilio.fromNumber);
+    }
+    if (env.sms.callbackToken) {
+      form.set('StatusCallback', `${env.apiUrl}/api/v1/webhooks/sms/twilio?token=${encodeURIComponent(env.sms.callbackToken)}`);
+    }
+
+    const response = await fetch(`https://api.twilio.com/2010-04-01/Accounts/${this.accountSid}/Messages.json`, {
+      method: 'POST',
+      headers: { ...this.headers, 'Content-Type': 'application/x-www-form-urlencoded' },
+      body: form,
+    });
+    const data: any = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      return { status: 'rejected', error: `Twilio ${data.code || response.status}: ${data.message || response.statusText}` };
+    }
+    return {
+      status: data.status === 'failed' || data.status === 'undelivered' ? 'failed' : 'sent',
+      providerMessageId: data.sid,
+      segments: data.num_segments ? Number(data.num_segments) : undefined,
+      cost: data.price ? Math.abs(Number(data.price)) : undefined,
+      currency: data.price_unit || undefined,
+    };
+  }
+
+  parseDeliveryReport(body: Record<string, any>): SmsDeliveryReport | null {
+    if (!body.MessageSid || !body.MessageStatus) return null;
+    const statuses: Record<string, SmsStatus> = {
+      delivered: 'delivered',
+      read: 'delivered',
+      sent: 'sent',
+      undelivered: 'failed',
+      failed: 'failed',
+    };
+    return {
+      providerMessageId: String(body.MessageSid),
+      status: statuses[body.MessageStatus] || 'queued',
+      failureReason: body.ErrorCode ? `Twilio error ${body.ErrorCode}` : undefined,
+    };
+  }
+
+  async fetchCost(providerMessageId: string) {
+    const response = await fetch(
+      `https://api.twilio.com/2010-04-01/Accounts/${this.accountSid}/Messages/${providerMessageId}.json`,
+      { headers: this.headers }
+    );
+    if (!response.ok) return null;
+    const data: any = await response.json();
+    return data.price ? { cost: Math.abs(Number(data.price)), currency: data.price_unit } : null;
+  }
+}
+
+/**
+ * Outgoing SMS through the configured gateway. Every message is recorded with its delivery
+ * status and cost so usage can be billed back per company.
+ */
+export class SmsService {
+  private prisma = getPrisma();
+  private provider: SmsProvider | null = null;
+
+  constructor() {
+    // Determine which provider to use based on environment configuration
+    switch (env.sms.provider.toLowerCase()) {
+      case '':
+        break;
+      case 'africastalking':
+      case 'africas_talking':
+        this.provider = new AfricasTalkingProvider();
+        break;
+      case 'twilio':
+        this.provider = new TwilioProvider();
+        break;
+      default:
+        throw new Error(`Unsupported SMS provider: ${env.sms.provider}`);
+    }
+  }
+
+  isConfigured(): boolean {
+    return this.provider !== null;
+  }
+
+  private async senderIdFor(companyId?: string | null): Promise<string | null> {
+    if (companyId) {
+      // An agency's registered sender name comes before the company setting
+      const brand = await agencyBrandingService.resolve({ companyId });
+      if (brand?.sms_sender_name) return brand.sms_sender_name;
+      const company = await this.prisma.company.findUnique({ where: { id: companyId }, select: { settings: true } });
+      const senderId = ((company?.settings as any) || {}).sms?.sender_id;
+      if (senderId) return senderId;
+    }
+    return env.sms.defaultSenderId || null;
+  }
+
+  async sendSms(options: SmsOptions): Promise<SmsResult> {
+    if (!this.provider) {
+      console.log(`📱 SMS gateway not configured; not sending ${options.type || 'general'} SMS to ${options.to}`);
+      return { success: false, error: 'SMS gateway not configured' };
+    }
+    const phone = normalizePhone(options.to);
+    if (!phone) {
+      return { success: false, error: `Invalid phone number: ${options.to}` };
+    }
+
+    const senderId = await this.senderIdFor(options.companyId);
+    const message = await this.prisma.smsMessage.create({
+      data: {
+        company_id: options.companyId || null,
+        recipient_id: options.recipientId || null,
+        phone,
+        sender_id: senderId,
+        body: options.body,
+        message_type: options.type || 'general',
+        provider: this.provider.name,
+        segments: countSegments(options.body),
+      },
+    });
+
+    let result: SmsProviderResult;
+    try {
+      result = await this.provider.sendSms({ to: phone, body: options.body, senderId });
+    } catch (error) {
+      result = { status: 'failed', error: error instanceof Error ? error.message : 'Unknown error occurred' };
+    }
+
+    const sent = result.status === 'sent' || result.status === 'delivered';
+    await this.prisma.smsMessage.update({
+      where: { id: message.id },
+      data: {
+        status: result.status,
+        provider_message_id: result.providerMessageId || null,
+        ...(result.segments !== undefined && { segments: result.segments }),
+        ...(result.cost !== undefined && { cost: result.cost, currency: result.currency || null }),
+        failure_reason: result.error || null,
+        sent_at: sent ? new Date() : null,
+        updated_at: new Date(),
+      },
+    });
+
+    if (sent) {
+      usageMeteringService.record({ companyId: options.companyId }, 'sms_sent');
+    } else {
+      console.error(`❌ SMS to ${phone} ${result.status}: ${result.error || 'unknown error'}`);
+    }
+    return { success: sent, id: message.id, status: result.status, error: result.error };
+  }
+
+  /**
+   * Apply a gateway's delivery report callback to the recorded message
+   */
+  async handleDeliveryReport(providerName: string, body: Record<string, any>, token?: string) {
+    if (!env.sms.callbackToken || token !== env.sms.callbackToken) {
+      throw new Error('Invalid SMS callback token');
+    }
+    if (!this.provider || this.provider.name !== providerName) {
+      throw new Error(`SMS provider not found: ${providerName}`);
+    }
+    const report = this.provider.parseDeliveryReport(body);
+    if (!report) {
+      throw new Error('delivery report is missing the message id or status');
+    }
+
+    const message = await this.prisma.smsMessage.findFirst({
+      where: { provider: providerName, provider_message_id: report.providerMessageId },
+    });
+    if (!message) {
+      // Messages sent before tracking, or from another environment sharing the account
+      console.warn(`⚠️ Delivery report for unknown ${providerName} message ${report.providerMessageId}`);
+      return null;
+    }
+    // Reports can arrive out of order; never move a delivered message back
+    if (message.status === 'delivered' && report.status !== 'delivered') {
+      return message;
+    }
+
+    const final = report.status === 'delivered' || report.status === 'failed' || report.status === 'rejected';
+    const pricing = final && message.cost === null && this.provider.fetchCost
+      ? await this.provider.fetchCost(report.providerMessageId).catch(() => null)
+      : null;
+
+    return this.prisma.smsMessage.update({
+      where: { id: message.id },
+      data: {
+        status: report.status,
+        failure_reason: report.failureReason || (report.status === 'delivered' ? null : message.failure_reason),
+        ...(report.status === 'delivered' && { delivered_at: new Date() }),
+        ...(pricing && { cost: pricing.cost, currency: pricing.currency }),
+        updated_at: new Date(),
+      },
+    });
+  }
+
+  async getMessages(
+    query: { status?: string; type?: string; phone?: string; recipient_id?: string; company_id?: string; page?: string; limit?: string },
+    user: JWTClaims
+  ) {
+    const where = this.scopeFor(user, query.company_id);
+    if (query.status) where.status = query.status;
+    if (query.type) where.message_type = query.type;
+    if (query.recipient_id) where.recipient_id = query.recipient_id;
+    if (query.phone) where.phone = normalizePhone(query.phone) || query.phone;
+    const page = Math.max(parseInt(query.page || '1', 10) || 1, 1);
+    const limit = Math.min(Math.max(parseInt(query.limit || '50', 10) || 50, 1), 200);
+
+    const [messages, total] = await Promise.all([
+      this.prisma.smsMessage.findMany({ where, orderBy: { created_at: 'desc' }, skip: (page - 1) * limit, take: limit }),
+      this.prisma.smsMessage.count({ where }),
+    ]);
+    return { messages, total, page, limit };
+  }
+
+  /**
+   * SMS volume and spend per month and message type, for billing
+   */
+  async getUsage(query: { from?: string; to?: string; company_id?: string }, user: JWTClaims) {
+    const where = this.scopeFor(user, query.company_id);
+    const from = query.from ? new Date(query.from) : new Date(new Date().getFullYear(), new Date().getMonth(), 1);
+    const to = query.to ? new Date(query.to) : new Date();
+    if (isNaN(from.getTime()) || isNaN(to.getTime())) {
+      throw new Error('from and to must be valid dates');
+    }
+    where.created_at = { gte: from, lte: to };
+
+    const messages = await this.prisma.smsMessage.findMany({
+      where,
+      select: { company_id: true, message_type: true, status: true, segments: true, cost: true, currency: true, created_at: true },
+    });
+
+    const groups = new Map<string, any>();
+    for (const message of messages) {
+      const month = message.created_at.toISOString().slice(0, 7);
+      const key = `${message.company_id}:${month}:${message.message_type}:${message.currency || ''}`;
+      if (!groups.has(key)) {
+        groups.set(key, {
+          company_id: message.company_id,
+          month,
+          message_type: message.message_type,
+          currency: message.currency,
+          messages: 0,
+          delivered: 0,
+          failed: 0,
+          segments: 0,
+          cost: 0,
+        });
+      }
+      const group = groups.get(key);
+      group.messages++;
+      if (message.status === 'delivered') group.delivered++;
+      if (message.status === 'failed' || message.status === 'rejected') group.failed++;
+      group.segments += message.segments;
+      group.cost += Number(message.cost || 0);
+    }
+
+    const totals = new Map<string, number>();
+    for (const group of groups.values()) {
+      group.cost = Math.round(group.cost * 10000) / 10000;
+      if (group.currency) totals.set(group.currency, (totals.get(group.currency) || 0) + group.cost);
+    }
+    return {
+      period: { from, to },
+      messages: messages.length,
+      segments: messages.reduce((sum, m) => sum + m.segments, 0),
+      cost_by_currency: Object.fromEntries([...totals].map(([currency, cost]) => [currency, Math.round(cost * 10000) / 10000])),
+      breakdown: [...groups.values()].sort((a, b) => a.month.localeCompare(b.month) || b.messages - a.messages),
+    };
+  }
+
+  async getSettings(user: JWTClaims, companyId?: string) {
+    const id = this.companyFor(user, companyId);
+    const company = await this.prisma.company.findUnique({ where: { id }, select: { settings: true } });
+    const settings = ((company?.settings as any) || {}).sms || {};
+    return {
+      provider: this.provider?.name || null,
+      sender_id: settings.sender_id || null,
+      default_sender_id: env.sms.defaultSenderId || null,
+    };
+  }
+
+  async updateSettings(req: { sender_id?: string | null; company_id?: string }, user: JWTClaims) {
+    if (!SMS_ADMIN_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to change SMS settings');
+    }
+    const id = this.companyFor(user, req.company_id);
+    const senderId = req.sender_id ? String(req.sender_id).trim() : null;
+    // Alphanumeric sender IDs are limited to 11 characters; numeric ones are phone numbers
+    if (senderId && !/^[A-Za-z0-9 ]{1,11}$/.test(senderId) && !/^\+?\d{3,15}$/.test(senderId)) {
+      throw new Error('sender_id must be up to 11 letters and digits, or a phone number');
+    }
+    const company = await this.prisma.company.findUnique({ where: { id }, select: { settings: true } });
+    const settings = (company?.settings as any) || {};
+    await this.prisma.company.update({
+      where: { id },
+      data: { settings: { ...settings, sms: { ...(settings.sms || {}), sender_id: senderId } }, updated_at: new Date() },
+    });
+    return this.getSettings(user, id);
+  }
+
+  async sendTestSms(req: { to?: string; message?: string; company_id?: string }, user: JWTClaims) {
+    if (!SMS_ADMIN_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to send test SMS');
+    }
+    const to = req.to || user.phone_number;
+    if (!to) {
+      throw new Error('to is required');
+    }
+    const result = await this.sendSms({
+      to,
+      body: req.message || 'This is a test message from LetRents.',
+      companyId: this.companyFor(user, req.company_id),
+      recipientId: req.to ? null : user.user_id,
+      type: 'test',
+    });
+    if (!result.success) {
+      throw new Error(result.error || 'Failed to send SMS');
+    }
+    return result;
+  }
+
+  private scopeFor(user: JWTClaims, companyId?: string): Record<string, any> {
+    if (!SMS_ADMIN_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view SMS usage');
+    }
+    if (user.role === 'super_admin') {
+      return companyId ? { company_id: companyId } : {};
+    }
+    return { company_id: this.companyFor(user) };
+  }
+
+  private companyFor(user: JWTClaims, requested?: string): string {
+    const companyId = user.role === 'super_admin' && requested ? requested : user.company_id;
+    if (!companyId) {
+      throw new Error('User must be associated with a company');
+    }
+    return companyId;
+  }
+}
+
+// Export singleton instance
+export const smsService = new SmsService();
@@ -0,0 +1,524 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface ShiftRequest {
+  name?: string;
+  start_time?: string;
+  end_time?: string;
+  color?: string;
+  is_active?: boolean;
+}
+
+export interface RosterWeekRequest {
+  property_id: string;
+  week_start: string;
+  entries: { staff_id: string; shift_id: string; date: string; notes?: string }[];
+  force?: boolean;
+}
+
+export interface LeaveRequest {
+  staff_id?: string;
+  leave_type: string;
+  start_date: string;
+  end_date: string;
+  reason?: string;
+}
+
+export interface DutyStatus {
+  on_duty: boolean;
+  reason: string | null;
+  shifts: { id: string; name: string; start_time: string; end_time: string; property_id: string }[];
+}
+
+export const WEEKDAYS = ['sunday', 'monday', 'tuesday', 'wednesday', 'thursday', 'friday', 'saturday'];
+export const LEAVE_TYPES = ['annual', 'sick', 'unpaid', 'compassionate', 'off_day', 'other'];
+const MANAGER_ROLES = ['super_admin', 'agency_admin', 'landlord'];
+const ROSTER_ROLES = [...MANAGER_ROLES, 'agent'];
+const DAY = 24 * 60 * 60 * 1000;
+const TIME_PATTERN = /^([01]\d|2[0-3]):[0-5]\d$/;
+
+const minutesOf = (time: string) => Number(time.slice(0, 2)) * 60 + Number(time.slice(3, 5));
+// Shifts ending at or before their start run past midnight into the next day
+const isOvernight = (shift: { start_time: string; end_time: string }) => minutesOf(shift.end_time) <= minutesOf(shift.start_time);
+
+/**
+ * Weekday names from the free-text off_days captured on staff profiles,
+ * e.g. "Sat, Sun" or "saturday/sunday" -> ['saturday', 'sunday']
+ */
+export const parseOffDays = (value?: string | null): string[] => {
+  const days = (value || '').toLowerCase().split(/[\s,;/]+/).filter(Boolean)
+    .map(part => WEEKDAYS.find(day => day.startsWith(part.slice(0, 3))))
+    .filter((day): day is string => !!day);
+  return [...new Set(days)];
+};
+
+// Date-only values are stored and compared as UTC midnight
+const toDay = (value: string | Date): Date => {
+  const date = typeof value === 'string' ? new Date(value.length === 10 ? `${value}T00:00:00Z` : value) : new Date(value);
+  if (isNaN(date.getTime())) {
+    throw new Error('dates must be valid (YYYY-MM-DD)');
+  }
+  return new Date(Date.UTC(date.getUTCFullYear(), date.getUTCMonth(), date.getUTCDate()));
+};
+const dayKey = (date: Date) => date.toISOString().slice(0, 10);
+
+/**
+ * Shift definitions, weekly per-property rosters and leave. A caretaker is off duty on
+ * approved leave, and on their off days unless rostered; once a caretaker has any roster
+ * entries in a week, days they are not rostered count as off duty too. An overnight shift
+ * keeps them on duty into the next morning until it ends.
+ */
+export class StaffRosterService {
+  private prisma = getPrisma();
+
+  async getDutyStatus(companyId: string, staffIds: string[], at: Date): Promise<Map<string, DutyStatus>> {
+    const day = toDay(at);
+    const previousDay = new Date(day.getTime() - DAY);
+    const weekStart = new Date(day.getTime() - ((day.getUTCDay() + 6) % 7) * DAY);
+    const weekEnd = new Date(weekStart.getTime() + 6 * DAY);
+    const minuteOfDay = at.getUTCHours() * 60 + at.getUTCMinutes();
+
+    const [staff, leaves, roster] = await Promise.all([
+      this.prisma.user.findMany({ where: { id: { in: staffIds } }, select: { id: true, off_days: true } }),
+      this.prisma.staffLeave.findMany({
+        where: { staff_id: { in: staffIds }, status: 'approved', start_date: { lte: day }, end_date: { gte: day } },
+        select: { staff_id: true, leave_type: true },
+      }),
+      this.prisma.staffRosterEntry.findMany({
+        where: { company_id: companyId, staff_id: { in: staffIds }, date: { gte: previousDay < weekStart ? previousDay : weekStart, lte: weekEnd } },
+        include: { shift: { select: { id: true, name: true, start_time: true, end_time: true } } },
+      }),
+    ]);
+
+    const weekday = WEEKDAYS[day.getUTCDay()];
+    const result = new Map<string, DutyStatus>();
+    for (const member of staff) {
+      const leave = leaves.find(l => l.staff_id === member.id);
+      const entries = roster.filter(entry => entry.staff_id === member.id);
+      const week = entries.filter(entry => entry.date >= weekStart);
+      const today = [
+        ...entries.filter(entry => dayKey(entry.date) === dayKey(previousDay) && isOvernight(entry.shift) && minuteOfDay < minutesOf(entry.shift.end_time)),
+        ...entries.filter(entry => dayKey(entry.date) === dayKey(day)),
+      ];
+      const shifts = today.map(entry => ({ ...entry.shift, property_id: entry.property_id }));
+
+      if (leave) {
+        result.set(member.id, { on_duty: false, reason: `on ${leave.leave_type.replace('_', ' ')} leave`, shifts: [] });
+      } else if (today.length > 0) {
+        result.set(member.id, { on_duty: true, reason: null, shifts });
+      } else if (parseOffDays(member.off_days).includes(weekday)) {
+        result.set(member.id, { on_duty: false, reason: `off on ${weekday}`, shifts: [] });
+      } else if (week.length > 0) {
+        result.set(member.id, { on_duty: false, reason: 'not rostered today', shifts: [] });
+      } else {
+        result.set(member.id, { on_duty: true, reason: null, shifts: [] });
+      }
+    }
+    return result;
+  }
+
+  async getAvailability(query: { date?: string; property_id?: string }, user: JWTClaims) {
+    const companyId = this.companyOf(user);
+    const date = query.date ? toDay(query.date) : new Date();
+    const caretakers = await this.prisma.user.findMany({
+      where: {
+        company_id: companyId,
+        role: 'caretaker',
+        status: 'active',
+        ...(query.property_id && { property_assignments: { some: { property_id: query.property_id, status: 'active' } } }),
+      },
+      select: { id: true, first_name: true, last_name: true, phone_number: true, off_days: true },
+      orderBy: { first_name: 'asc' },
+    });
+    const status = await this.getDutyStatus(companyId, caretakers.map(c => c.id), date);
+    return caretakers.map(caretaker => ({
+      ...caretaker,
+      off_days: parseOffDays(caretaker.off_days),
+      ...status.get(caretaker.id)!,
+    }));
+  }
+
+  // Shifts
+
+  async listShifts(user: JWTClaims, includeInactive = false) {
+    return this.prisma.staffShift.findMany({
+      where: { company_id: this.companyOf(user), ...(!includeInactive && { is_active: true }) },
+      orderBy: { start_time: 'asc' },
+    });
+  }
+
+  async createShift(req: ShiftRequest, user: JWTClaims) {
+    this.requireRole(user, MANAGER_ROLES, 'manage shifts');
+    if (!req.name || !req.start_time || !req.end_time) {
+      throw new Error('name, start_time and end_time are required');
+    }
+    this.validateTimes(req.start_time, req.end_time);
+    return this.prisma.staffShift.create({
+      data: {
+        company_id: this.companyOf(user),
+        name: req.name,
+        start_time: req.start_time,
+        end_time: req.end_time,
+        color: req.color || null,
+        created_by: user.user_id,
+      },
+    });
+  }
+
+  async updateShift(shiftId: string, req: ShiftRequest, user: JWTClaims) {
+    this.requireRole(user, MANAGER_ROLES, 'manage shifts');
+    const shift = await this.findShift(shiftId, user);
+    const start = req.start_time ?? shift.start_time;
+    const end = req.end_time ?? shift.end_time;
+    this.validateTimes(start, end);
+    return this.prisma.staffShift.update({
+      where: { id: shift.id },
+      data: {
+        ...(req.name && { name: req.name }),
+        start_time: start,
+        end_time: end,
+        ...(req.color !== undefined && { color: req.color || null }),
+        ...(typeof req.is_active === 'boolean' && { is_active: req.is_active }),
+        updated_at: new Date(),
+      },
+    });
+  }
+
+  /**
+   * Shifts still on future rosters are deactivated instead of deleted
+   */
+  async deleteShift(shiftId: string, user: JWTClaims) {
+    this.requireRole(user, MANAGER_ROLES, 'manage shifts');
+    const shift = await this.findShift(shiftId, user);
+    const upcoming = await this.prisma.staffRosterEntry.count({ where: { shift_id: shift.id, date: { gte: toDay(new Date()) } } });
+    if (upcoming > 0) {
+      await this.prisma.staffShift.update({ where: { id: shift.id }, data: { is_active: false, updated_at: new Date() } });
+      return { deleted: false, deactivated: true, upcoming_entries: upcoming };
+    }
+    await this.prisma.staffShift.delete({ where: { id: shift.id } });
+    return { deleted: true, deactivated: false, upcoming_entries: 0 };
+  }
+
+  // Rosters
+
+  async getRoster(query: { property_id?: string; staff_id?: string; week_start?: string }, user: JWTClaims) {
+    const companyId = this.companyOf(user);
+    const weekStart = this.weekStartOf(query.week_start);
+    const weekEnd = new Date(weekStart.getTime() + 6 * DAY);
+    const staffId = ROSTER_ROLES.includes(user.role) ? query.staff_id : user.user_id;
+
+    const entries = await this.prisma.staffRosterEntry.findMany({
+      where: {
+        company_id: companyId,
+        date: { gte: weekStart, lte: weekEnd },
+        ...(query.property_id && { property_id: query.property_id }),
+        ...(staffId && { staff_id: staffId }),
+      },
+      include: { shift: { select: { id: true, name: true, start_time: true, end_time: true, color: true } } },
+      orderBy: [{ date: 'asc' }, { shift: { start_time: 'asc' } }],
+    });
+    const staff = await this.prisma.user.findMany({
+      where: { id: { in: [...new Set(entries.map(e => e.staff_id))] } },
+      select: { id: true, first_name: true, last_name: true },
+    });
+    const staffById = new Map(staff.map(s => [s.id, s]));
+
+    const days = Array.from({ length: 7 }, (_, i) => {
+      const date = new Date(weekStart.getTime() + i * DAY);
+      return {
+        date: dayKey(date),
+        weekday: WEEKDAYS[date.getUTCDay()],
+        entries: entries
+          .filter(entry => dayKey(entry.date) === dayKey(date))
+          .map(entry => ({ ...entry, staff: staffById.get(entry.staff_id) || null })),
+      };
+    });
+    return { week_start: dayKey(weekStart), week_end: dayKey(weekEnd), property_id: query.property_id || null, days };
+  }
+
+  /**
+   * Replace a property's roster for one week. Entries for staff on leave, on their off day
+   * or already on the same shift at another property are rejected unless `force` is set.
+   */
+  async saveRosterWeek(req: RosterWeekRequest, user: JWTClaims) {
+    this.requireRole(user, ROSTER_ROLES, 'manage rosters');
+    const companyId = this.companyOf(user);
+    if (!req.property_id || !Array.isArray(req.entries)) {
+      throw new Error('property_id and entries are required');
+    }
+    const property = await this.prisma.property.findFirst({ where: { id: req.property_id, company_id: companyId }, select: { id: true } });
+    if (!property) {
+      throw new Error('property not found');
+    }
+    const weekStart = this.weekStartOf(req.week_start);
+    const weekEnd = new Date(weekStart.getTime() + 6 * DAY);
+
+    const staffIds = [...new Set(req.entries.map(e => e.staff_id))];
+    const shiftIds = [...new Set(req.entries.map(e => e.shift_id))];
+    const [staff, shifts, leaves, elsewhere] = await Promise.all([
+      this.prisma.user.findMany({
+        where: { id: { in: staffIds }, company_id: companyId, status: 'active', role: { not: 'tenant' } },
+        select: { id: true, first_name: true, last_name: true, off_days: true },
+      }),
+      this.prisma.staffShift.findMany({ where: { id: { in: shiftIds }, company_id: companyId, is_active: true }, select: { id: true } }),
+      this.prisma.staffLeave.findMany({
+        where: { staff_id: { in: staffIds }, status: 'approved', start_date: { lte: weekEnd }, end_date: { gte: weekStart } },
+      }),
+      this.prisma.staffRosterEntry.findMany({
+        where: { staff_id: { in: staffIds }, property_id: { not: property.id }, date: { gte: weekStart, lte: weekEnd } },
+        select: { staff_id: true, shift_id: true, date: true },
+      }),
+    ]);
+    const staffById = new Map(staff.map(s => [s.id, s]));
+    const shiftSet = new Set(shifts.map(s => s.id));
+
+    const conflicts: { staff_id: string; date: string; reason: string }[] = [];
+    const seen = new Set<string>();
+    const rows = req.entries.map(entry => {
+      const member = staffById.get(entry.staff_id);
+      if (!member) {
+        throw new Error(`staff member ${entry.staff_id} not found in this company`);
+      }
+      if (!shiftSet.has(entry.shift_id)) {
+        throw new Error(`shift ${entry.shift_id} not found or inactive`);
+      }
+      const date = toDay(entry.date);
+      if (date < weekStart || date > weekEnd) {
+        throw new Error(`entry date ${entry.date} must be within the week starting ${dayKey(weekStart)}`);
+      }
+      const key = `${member.id}:${entry.shift_id}:${dayKey(date)}`;
+      if (seen.has(key)) {
+        throw new Error(`${member.first_name} ${member.last_name} must only be rostered once per shift on ${dayKey(date)}`);
+      }
+      seen.add(key);
+      const name = `${member.first_name} ${member.last_name}`;
+      if (leaves.some(l => l.staff_id === member.id && l.start_date <= date && l.end_date >= date)) {
+        conflicts.push({ staff_id: member.id, date: dayKey(date), reason: `${name} is on leave` });
+      } else if (parseOffDays(member.off_days).includes(WEEKDAYS[date.getUTCDay()])) {
+        conflicts.push({ staff_id: member.id, date: dayKey(date), reason: `${name} is off on ${WEEKDAYS[date.getUTCDay()]}` });
+      } else if (elsewhere.some(e => e.staff_id === member.id && e.shift_id === entry.shift_id && dayKey(e.date) === dayKey(date))) {
+        conflicts.push({ staff_id: member.id, date: dayKey(date), reason: `${name} is already on this shift at another property` });
+      }
+      return {
+        company_id: companyId,
+        property_id: property.id,
+        staff_id: member.id,
+        shift_id: entry.shift_id,
+        date,
+        notes: entry.notes || null,
+        created_by: user.user_id,
+      };
+    });
+    if (conflicts.length > 0 && !req.force) {
+      const error: any = new Error(`roster conflicts with leave, off days or other rosters: ${conflicts.map(c => `${c.reason} (${c.date})`).join('; ')}`);
+      error.conflicts = conflicts;
+      throw error;
+    }
+
+    await this.prisma.$transaction([
+      this.prisma.staffRosterEntry.deleteMany({
+        where: { property_id: property.id, date: { gte: weekStart, lte: weekEnd } },
+      }),
+      this.prisma.staffRosterEntry.createMany({ data: rows }),
+    ]);
+    const roster = await this.getRoster({ property_id: property.id, week_start: dayKey(weekStart) }, user);
+    return { ...roster, conflicts };
+  }
+
+  // Leave and off days
+
+  async listLeave(query: { staff_id?: string; status?: string; from?: string; to?: string }, user: JWTClaims) {
+    const companyId = this.companyOf(user);
+    const staffId = ROSTER_ROLES.includes(user.role) ? query.staff_id : user.user_id;
+    return this.prisma.staffLeave.findMany({
+      where: {
+        company_id: companyId,
+        ...(staffId && { staff_id: staffId }),
+        ...(query.status && { status: query.status }),
+        ...(query.from && { end_date: { gte: toDay(query.from) } }),
+        ...(query.to && { start_date: { lte: toDay(query.to) } }),
+      },
+      orderBy: { start_date: 'desc' },
+    });
+  }
+
+  /**
+   * Staff request leave for themselves; leave entered by a manager is approved straight away
+   */
+  async requestLeave(req: LeaveRequest, user: JWTClaims) {
+    const companyId = this.companyOf(user);
+    const isManager = MANAGER_ROLES.includes(user.role);
+    const staffId = req.staff_id && isManager ? req.staff_id : user.user_id;
+    if (!req.leave_type || !req.start_date || !req.end_date) {
+      throw new Error('leave_type, start_date and end_date are required');
+    }
+    if (!LEAVE_TYPES.includes(req.leave_type)) {
+      throw new Error(`leave_type must be one of: ${LEAVE_TYPES.join(', ')}`);
+    }
+    const start = toDay(req.start_date);
+    const end = toDay(req.end_date);
+    if (end < start) {
+      throw new Error('end_date must be on or after start_date');
+    }
+    const member = await this.prisma.user.findFirst({ where: { id: staffId, company_id: companyId }, select: { id: true } });
+    if (!member) {
+      throw new Error('staff member not found');
+    }
+    const overlap = await this.prisma.staffLeave.findFirst({
+      where: { staff_id: staffId, status: { in: ['pending', 'approved'] }, start_date: { lte: end }, end_date: { gte: start } },
+    });
+    if (overlap) {
+      throw new Error('leave already requested for an overlapping period');
+    }
+
+    const leave = await this.prisma.staffLeave.create({
+      data: {
+        company_id: companyId,
+        staff_id: staffId,
+        leave_type: req.leave_type,
+        start_date: start,
+        end_date: end,
+        reason: req.reason || null,
+        requested_by: user.user_id,
+        ...(isManager && { status: 'approved', decided_by: user.user_id, decided_at: new Date() }),
+      },
+    });
+    if (isManager) {
+      const removed = await this.clearRosterForLeave(leave);
+      return { ...leave, roster_entries_removed: removed };
+    }
+    await this.notifyManagers(companyId, 'Leave request', `A staff member has requested ${req.leave_type.replace('_', ' ')} leave from ${dayKey(start)} to ${dayKey(end)}.`, leave.id);
+    return leave;
+  }
+
+  async decideLeave(leaveId: string, req: { status: string; notes?: string }, user: JWTClaims) {
+    this.requireRole(user, MANAGER_ROLES, 'approve leave');
+    if (!['approved', 'rejected'].includes(req.status)) {
+      throw new Error('status must be approved or rejected');
+    }
+    const leave = await this.prisma.staffLeave.findFirst({ where: { id: leaveId, company_id: this.companyOf(user) } });
+    if (!leave) {
+      throw new Error('leave request not found');
+    }
+    if (leave.status !== 'pending') {
+      throw new Error(`leave request is already ${leave.status}`);
+    }
+    const updated = await this.prisma.staffLeave.update({
+      where: { id: leave.id },
+      data: { status: req.status, decided_by: user.user_id, decided_at: new Date(), decision_notes: req.notes || null, updated_at: new Date() },
+    });
+    const removed = req.status === 'approved' ? await this.clearRosterForLeave(updated) : 0;
+
+    await this.notify(leave.company_id, leave.staff_id, `Leave ${req.status}`,
+      `Your leave from ${dayKey(leave.start_date)} to ${dayKey(leave.end_date)} has been ${req.status}.${req.notes ? ` ${req.notes}` : ''}`, leave.id);
+    return { ...updated, roster_entries_removed: removed };
+  }
+
+  async cancelLeave(leaveId: string, user: JWTClaims) {
+    const leave = await this.prisma.staffLeave.findFirst({ where: { id: leaveId, company_id: this.companyOf(user) } });
+    if (!leave) {
+      throw new Error('leave request not found');
+    }
+    if (leave.staff_id !== user.user_id && !MANAGER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to cancel this leave');
+    }
+    if (['cancelled', 'rejected'].includes(leave.status)) {
+      throw new Error(`leave request is already ${leave.status}`);
+    }
+    return this.prisma.staffLeave.update({
+      where: { id: leave.id },
+      data: { status: 'cancelled', updated_at: new Date() },
+    });
+  }
+
+  async updateOffDays(staffId: string, offDays: string[] | string, user: JWTClaims) {
+    this.requireRole(user, ROSTER_ROLES, 'change off days');
+    const days = parseOffDays(Array.isArray(offDays) ? offDays.join(',') : offDays);
+    const requested = Array.isArray(offDays) ? offDays.filter(Boolean).length : (offDays || '').split(/[\s,;/]+/).filter(Boolean).length;
+    if (days.length !== requested) {
+      throw new Error(`off_days must be weekday names (${WEEKDAYS.join(', ')})`);
+    }
+    const member = await this.prisma.user.findFirst({
+      where: { id: staffId, company_id: this.companyOf(user), role: { not: 'tenant' } },
+      select: { id: true },
+    });
+    if (!member) {
+      throw new Error('staff member not found');
+    }
+    await this.prisma.user.update({ where: { id: member.id }, data: { off_days: days.join(',') || null, updated_at: new Date() } });
+    return { staff_id: member.id, off_days: days };
+  }
+
+  private async clearRosterForLeave(leave: { staff_id: string; start_date: Date; end_date: Date }) {
+    const result = await this.prisma.staffRosterEntry.deleteMany({
+      where: { staff_id: leave.staff_id, date: { gte: leave.start_date, lte: leave.end_date } },
+    });
+    return result.count;
+  }
+
+  private weekStartOf(value?: string): Date {
+    const day = toDay(value || new Date());
+    return new Date(day.getTime() - ((day.getUTCDay() + 6) % 7) * DAY);
+  }
+
+  private validateTimes(start: string, end: string) {
+    if (!TIME_PATTERN.test(start) || !TIME_PATTERN.test(end)) {
+      throw new Error('start_time and end_time must be in HH:MM format');
+    }
+    if (start === end) {
+      throw new Error('start_time and end_time must be different');
+    }
+  }
+
+  private async findShift(shiftId: string, user: JWTClaims) {
+    const shift = await this.prisma.staffShift.findFirst({ where: { id: shiftId, company_id: this.companyOf(user) } });
+    if (!shift) {
+      throw new Error('shift not found');
+    }
+    return shift;
+  }
+
+  private companyOf(user: JWTClaims): string {
+    if (!user.company_id) {
+      throw new Error('User must be associated with a company');
+    }
+    return user.company_id;
+  }
+
+  private requireRole(user: JWTClaims, roles: string[], action: string) {
+    if (!roles.includes(user.role)) {
+      throw new Error(`insufficient permissions to ${action}`);
+    }
+  }
+
+  private async notifyManagers(companyId: string, title: string, message: string, leaveId: string) {
+    const managers = await this.prisma.user.findMany({
+      where: { company_id: companyId, role: { in: ['agency_admin', 'landlord'] }, status: 'active' },
+      select: { id: true },
+    });
+    for (const manager of managers) {
+      await this.notify(companyId, manager.id, title, message, leaveId);
+    }
+  }
+
+  private async notify(companyId: string, recipientId: string, title: string, message: string, leaveId: string) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: companyId,
+        recipient_id: recipientId,
+        title,
+        message,
+        notification_type: 'staff',
+        category: 'staff',
+        priority: 'medium',
+        related_entity_type: 'staff_leave',
+        related_entity_id: leaveId,
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to send leave notification:', error.message);
+    }
+  }
+}
+
+export const staffRosterService = new StaffRosterService();
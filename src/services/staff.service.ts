@@ -3,6 +3,7 @@ import { JWTClaims } from '../types/index.js';
 import { buildWhereClause, formatDataForRole } from '../utils/roleBasedFiltering.js';
 import bcrypt from 'bcryptjs';
 import crypto from 'crypto';
+import { parseOffDays } from './staff-roster.service.js';
 
 const prisma = getPrisma();
 
@@ -236,7 +237,7 @@ export const staffService = {
       emergency_contact_email: staffData.emergency_contact_email,
       emergency_relationship: staffData.emergency_relationship,
       working_hours: staffData.working_hours,
-      off_days: Array.isArray(staffData.off_days) ? staffData.off_days.join(',') : staffData.off_days,
+      off_days: parseOffDays(Array.isArray(staffData.off_days) ? staffData.off_days.join(',') : staffData.off_days).join(',') || null,
       skills: Array.isArray(staffData.skills) ? staffData.skills.join(',') : staffData.skills,
       languages: Array.isArray(staffData.languages) ? staffData.languages.join(',') : staffData.languages,
     };
@@ -548,9 +549,9 @@ export const staffService = {
       updateFields.working_hours = updateData.working_hours;
     }
     if (updateData.off_days !== undefined) {
-      updateFields.off_days = Array.isArray(updateData.off_days) 
-        ? updateData.off_days.join(',') 
-        : updateData.off_days;
+      updateFields.off_days = parseOffDays(Array.isArray(updateData.off_days)
+        ? updateData.off_days.join(',')
+        : updateData.off_days).join(',') || null;
     }
     if (updateData.skills !== undefined) {
       updateFields.skills = Array.isArray(updateData.skills) 
@@ -629,6 +630,10 @@ export const staffService = {
           });
           console.log('✅ Property assignments updated');
         }
+
+        // Keep the staff member's devices on the push topics of the properties they now cover
+        const { pushNotificationService } = await import('./push-notification.service.js');
+        await pushNotificationService.syncPropertyTopics(staffId);
       }
 
       return updatedStaff;
@@ -700,6 +705,10 @@ export const staffService = {
       throw new Error('Access denied: Insufficient permissions to delete staff member');
     }
 
+    // Token rows cascade with the user, but FCM keeps topic subscriptions until told otherwise
+    const { pushNotificationService } = await import('./push-notification.service.js');
+    await pushNotificationService.releaseTopics({ user_id: staffId });
+
     // Use transaction to handle all related records and avoid foreign key constraint errors
     try {
       await prisma.$transaction(async (tx) => {
@@ -1028,81 +1037,17 @@ export const staffService = {
 
     // Send invitation email with setup link
     try {
-      const { emailService } = await import('./email.service.js');
-      
-      const invitationHtml = `
-        <!DOCTYPE html>
-        <html>
-        <head>
-          <meta charset="utf-8">
-          <meta name="viewport" content="width=device-width, initial-scale=1.0">
-          <title>LetRents - ${roleDisplayName} Invitation</title>
-          <style>
-            body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-            .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-            .header { background: #2563eb; color: white; padding: 20px; text-align: center; }
-            .content { padding: 30px 20px; }
-            .button { display: inline-block; background: #2563eb; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; margin: 20px 0; }
-            .footer { background: #f8f9fa; padding: 20px; text-align: center; font-size: 14px; color: #666; }
-            .info { background: #e7f3ff; border: 1px solid #b3d9ff; padding: 15px; border-radius: 5px; margin: 20px 0; }
-          </style>
-        </head>
-        <body>
-          <div class="container">
-            <div class="header">
-              <h1>Welcome to LetRents</h1>
-              <p>${roleDisplayName} Account Invitation</p>
-            </div>
-            <div class="content">
-              <h2>You've been invited as a ${roleDisplayName}</h2>
-              <p>Hello ${staffMember.first_name} ${staffMember.last_name},</p>
-              <p>You have been invited to join LetRents as a ${roleDisplayName.toLowerCase()}. Your account has been created and you can now set up your account to access the platform.</p>
-              
-              <div class="info">
-                <strong>Account Setup Required:</strong>
-                <p>Click the button below to complete your account setup and create your secure password.</p>
-              </div>
-
-              <div style="text-align: center;">
-                <a href="${invitationLink}" class="button">Complete Account Setup</a>
-              </div>
-
-              <h3>What's Next?</h3>
-              <ol>
-                <li>Click the "Complete Account Setup" button above</li>
-                <li>Create your secure password</li>
-                <li>Complete your profile setup</li>
-                <li>Start working!</li>
-              </ol>
-
-              <p>If you have any questions or need assistance, please don't hesitate to contact our support team.</p>
-              
-              <p>Welcome to the LetRents family!</p>
-              <p>Best regards,<br>The LetRents Team</p>
-            </div>
-            <div class="footer">
-              <p>&copy; ${new Date().getFullYear()} LetRents. All rights reserved.</p>
-              <p>This is an automated invitation email. Please do not reply to this email.</p>
-            </div>
-          </div>
-        </body>
-        </html>
-      `;
-
-      const emailResult = await emailService.sendEmail({
+      const { emailTemplatesService } = await import('./email-templates.service.js');
+      const emailResult = await emailTemplatesService.send('staff_invitation', {
         to: staffMember.email,
-        subject: `Welcome to LetRents - Complete Your ${roleDisplayName} Account Setup`,
-        html: invitationHtml,
-        text: `Welcome to LetRents!
-
-You've been invited as a ${roleDisplayName.toLowerCase()}. Please complete your account setup:
-
-Setup Link: ${invitationLink}
-
-Click the link above to create your password and activate your account.
-
-Best regards,
-The LetRents Team`,
+        recipientId: staffId,
+        companyId: staffMember.company_id,
+        agencyId: staffMember.agency_id,
+        variables: {
+          staff_name: `${staffMember.first_name || ''} ${staffMember.last_name || ''}`.trim(),
+          role_name: roleDisplayName,
+          setup_url: invitationLink,
+        },
       });
 
       if (!emailResult.success) {
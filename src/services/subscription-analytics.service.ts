@@ -0,0 +1,276 @@
+import { getPrisma } from '../config/prisma.js';
+import { PLANS } from './plan-limits.service.js';
+
+const PLAN_ORDER = ['starter', 'professional', 'enterprise'];
+// Statuses a subscription is paying in right now; past_due is still owed and counted until it lapses
+const PAYING_STATUSES = ['active', 'past_due'];
+const ENDED_STATUSES = ['canceled', 'unpaid', 'expired'];
+const DEFAULT_MONTHS = 12;
+const MAX_MONTHS = 36;
+
+interface PayingInterval {
+  company_id: string;
+  plan: string;
+  mrr: number;
+  from: Date;
+  to: Date | null;
+}
+
+interface CompanyState {
+  mrr: number;
+  plan: string | null;
+}
+
+const round = (value: number) => Math.round(value * 100) / 100;
+const rate = (part: number, whole: number) => (whole > 0 ? Math.round((part / whole) * 10000) / 100 : 0);
+const monthStart = (date: Date, offset: number = 0) => new Date(Date.UTC(date.getUTCFullYear(), date.getUTCMonth() + offset, 1));
+const monthKey = (date: Date) => date.toISOString().slice(0, 7);
+// Annual subscriptions count a twelfth of their price each month, as in the daily analytics snapshot
+const monthly = (amount: number, billingCycle: string) => (billingCycle === 'annual' ? amount / 12 : amount);
+
+/**
+ * Subscription revenue analytics for super admins, worked out from the subscription records:
+ * MRR and ARR now, month by month MRR movements (new, expansion, contraction, churn,
+ * reactivation) with upgrades, downgrades and churn rates, and retention by signup cohort.
+ *
+ * Each subscription is turned into the stretch of time it was paying and the MRR it brought in.
+ * Trials that never converted bring in nothing. A plan changed in place (metadata upgraded_from
+ * and upgraded_at) is split at the change, the earlier stretch priced from the plan list.
+ */
+export class SubscriptionAnalyticsService {
+  private prisma = getPrisma();
+
+  async getAnalytics(query: { months?: number | string } = {}, now: Date = new Date()) {
+    const months = query.months === undefined ? DEFAULT_MONTHS : Number(query.months);
+    if (!Number.isInteger(months) || months < 1 || months > MAX_MONTHS) {
+      throw new Error(`months must be a whole number from 1 to ${MAX_MONTHS}`);
+    }
+
+    const [byCompany, trials] = await Promise.all([
+      this.intervalsByCompany(),
+      this.prisma.subscription.count({ where: { status: 'trial' } }),
+    ]);
+
+    return {
+      generated_at: now,
+      current: this.current(byCompany, now, trials),
+      monthly: this.movements(byCompany, months, now),
+      cohorts: this.cohorts(byCompany, months, now),
+    };
+  }
+
+  /**
+   * MRR and ARR at a moment, for the revenue summary and the subscription list
+   */
+  async getRecurringRevenue(at: Date = new Date()) {
+    const byCompany = await this.intervalsByCompany();
+    let mrr = 0;
+    let customers = 0;
+    for (const companyIntervals of byCompany.values()) {
+      const state = this.stateAt(companyIntervals, at);
+      if (state.mrr > 0) {
+        mrr += state.mrr;
+        customers++;
+      }
+    }
+    return { mrr: round(mrr), arr: round(mrr * 12), paying_customers: customers };
+  }
+
+  private current(byCompany: Map<string, PayingInterval[]>, now: Date, trials: number) {
+    const plans = new Map<string, { customers: number; mrr: number }>();
+    let mrr = 0;
+    let customers = 0;
+    for (const companyIntervals of byCompany.values()) {
+      const state = this.stateAt(companyIntervals, now);
+      if (state.mrr <= 0) continue;
+      mrr += state.mrr;
+      customers++;
+      const plan = plans.get(state.plan!) || { customers: 0, mrr: 0 };
+      plans.set(state.plan!, { customers: plan.customers + 1, mrr: plan.mrr + state.mrr });
+    }
+    return {
+      mrr: round(mrr),
+      arr: round(mrr * 12),
+      paying_customers: customers,
+      average_revenue_per_customer: customers ? round(mrr / customers) : 0,
+      trials,
+      by_plan: [...plans.entries()]
+        .sort(([a], [b]) => PLAN_ORDER.indexOf(a) - PLAN_ORDER.indexOf(b))
+        .map(([plan, totals]) => ({ plan, customers: totals.customers, mrr: round(totals.mrr), share: rate(totals.mrr, mrr) })),
+    };
+  }
+
+  /**
+   * What moved MRR in each of the last `months` calendar months (the current one so far),
+   * comparing every company at the start of the month with the end
+   */
+  private movements(byCompany: Map<string, PayingInterval[]>, months: number, now: Date) {
+    const rows = [];
+    for (let offset = -(months - 1); offset <= 0; offset++) {
+      const start = monthStart(now, offset);
+      const end = offset === 0 ? now : monthStart(now, offset + 1);
+      const row = {
+        month: monthKey(start),
+        starting_mrr: 0,
+        ending_mrr: 0,
+        new_mrr: 0,
+        expansion_mrr: 0,
+        contraction_mrr: 0,
+        churned_mrr: 0,
+        reactivation_mrr: 0,
+        starting_customers: 0,
+        ending_customers: 0,
+        new_customers: 0,
+        churned_customers: 0,
+        reactivated_customers: 0,
+        upgrades: 0,
+        downgrades: 0,
+      };
+
+      for (const companyIntervals of byCompany.values()) {
+        const before = this.stateAt(companyIntervals, new Date(start.getTime() - 1));
+        const after = this.stateAt(companyIntervals, end);
+        row.starting_mrr += before.mrr;
+        row.ending_mrr += after.mrr;
+        if (before.mrr > 0) row.starting_customers++;
+        if (after.mrr > 0) row.ending_customers++;
+
+        if (before.mrr === 0 && after.mrr > 0) {
+          const returning = companyIntervals.some(interval => interval.from < start);
+          if (returning) {
+            row.reactivation_mrr += after.mrr;
+            row.reactivated_customers++;
+          } else {
+            row.new_mrr += after.mrr;
+            row.new_customers++;
+          }
+        } else if (before.mrr > 0 && after.mrr === 0) {
+          row.churned_mrr += before.mrr;
+          row.churned_customers++;
+        } else if (before.mrr > 0) {
+          if (after.mrr > before.mrr) row.expansion_mrr += after.mrr - before.mrr;
+          if (after.mrr < before.mrr) row.contraction_mrr += before.mrr - after.mrr;
+          const rank = PLAN_ORDER.indexOf(after.plan!) - PLAN_ORDER.indexOf(before.plan!);
+          if (rank > 0) row.upgrades++;
+          if (rank < 0) row.downgrades++;
+        }
+      }
+
+      rows.push({
+        ...row,
+        starting_mrr: round(row.starting_mrr),
+        ending_mrr: round(row.ending_mrr),
+        new_mrr: round(row.new_mrr),
+        expansion_mrr: round(row.expansion_mrr),
+        contraction_mrr: round(row.contraction_mrr),
+        churned_mrr: round(row.churned_mrr),
+        reactivation_mrr: round(row.reactivation_mrr),
+        net_new_mrr: round(row.new_mrr + row.expansion_mrr + row.reactivation_mrr - row.contraction_mrr - row.churned_mrr),
+        customer_churn_rate: rate(row.churned_customers, row.starting_customers),
+        gross_revenue_churn_rate: rate(row.churned_mrr + row.contraction_mrr, row.starting_mrr),
+        net_revenue_retention: rate(row.starting_mrr - row.churned_mrr - row.contraction_mrr + row.expansion_mrr, row.starting_mrr),
+      });
+    }
+    return rows;
+  }
+
+  /**
+   * Companies grouped by the month they first paid, with the share of each cohort still paying
+   * at the end of every month since (the last figure is as of now)
+   */
+  private cohorts(byCompany: Map<string, PayingInterval[]>, months: number, now: Date) {
+    const firstMonth = monthStart(now, -(months - 1));
+    const cohorts = new Map<string, PayingInterval[][]>();
+    for (const companyIntervals of byCompany.values()) {
+      const firstPaid = companyIntervals.reduce((first, interval) => (interval.from < first ? interval.from : first), companyIntervals[0].from);
+      if (firstPaid < firstMonth || firstPaid > now) continue;
+      const key = monthKey(firstPaid);
+      cohorts.set(key, [...(cohorts.get(key) || []), companyIntervals]);
+    }
+
+    return [...cohorts.entries()]
+      .sort(([a], [b]) => a.localeCompare(b))
+      .map(([key, members]) => {
+        const start = new Date(`${key}-01T00:00:00.000Z`);
+        const retention = [];
+        for (let offset = 0; ; offset++) {
+          const end = monthStart(start, offset + 1);
+          const at = end > now ? now : end;
+          const retained = members.filter(intervals => this.stateAt(intervals, at).mrr > 0).length;
+          retention.push({ month: offset, retained, rate: rate(retained, members.length) });
+          if (end > now) break;
+        }
+        return { cohort: key, customers: members.length, retention };
+      });
+  }
+
+  private stateAt(intervals: PayingInterval[], at: Date): CompanyState {
+    let mrr = 0;
+    let plan: string | null = null;
+    for (const interval of intervals) {
+      if (interval.from > at || (interval.to && interval.to <= at)) continue;
+      mrr += interval.mrr;
+      if (!plan || PLAN_ORDER.indexOf(interval.plan) > PLAN_ORDER.indexOf(plan)) plan = interval.plan;
+    }
+    return { mrr, plan };
+  }
+
+  private async intervalsByCompany() {
+    const byCompany = new Map<string, PayingInterval[]>();
+    for (const interval of await this.payingIntervals()) {
+      byCompany.set(interval.company_id, [...(byCompany.get(interval.company_id) || []), interval]);
+    }
+    return byCompany;
+  }
+
+  /**
+   * Every stretch of time a subscription was paying, with its monthly value
+   */
+  private async payingIntervals() {
+    const subscriptions = await this.prisma.subscription.findMany({
+      select: {
+        company_id: true,
+        plan: true,
+        status: true,
+        amount: true,
+        billing_cycle: true,
+        start_date: true,
+        trial_end_date: true,
+        end_date: true,
+        canceled_at: true,
+        expired_at: true,
+        payment_method_added_at: true,
+        metadata: true,
+        updated_at: true,
+        _count: { select: { billing_invoices: { where: { status: 'paid' } } } },
+      },
+    });
+
+    const intervals: PayingInterval[] = [];
+    for (const subscription of subscriptions) {
+      const metadata = (subscription.metadata || {}) as Record<string, any>;
+      const paid = PAYING_STATUSES.includes(subscription.status) || subscription._count.billing_invoices > 0 ||
+        !!subscription.payment_method_added_at || !!metadata.verified_at || metadata.created_from_payment === true || metadata.created_from_payment === 'true';
+      if (subscription.status === 'trial' || !paid) continue;
+
+      const from = subscription.trial_end_date && subscription.trial_end_date > subscription.start_date ? subscription.trial_end_date : subscription.start_date;
+      const to = ENDED_STATUSES.includes(subscription.status)
+        ? subscription.canceled_at || subscription.expired_at || subscription.end_date || subscription.updated_at
+        : null;
+      if (to && to <= from) continue;
+
+      const mrr = monthly(Number(subscription.amount), subscription.billing_cycle);
+      const changedAt = metadata.upgraded_at ? new Date(metadata.upgraded_at) : null;
+      const previousPlan = metadata.upgraded_from && metadata.upgraded_from !== subscription.plan ? PLANS[metadata.upgraded_from] : null;
+      if (previousPlan && changedAt && !isNaN(changedAt.getTime()) && changedAt > from && (!to || changedAt < to)) {
+        intervals.push({ company_id: subscription.company_id, plan: metadata.upgraded_from, mrr: previousPlan.monthly_price, from, to: changedAt });
+        intervals.push({ company_id: subscription.company_id, plan: subscription.plan, mrr, from: changedAt, to });
+      } else {
+        intervals.push({ company_id: subscription.company_id, plan: subscription.plan, mrr, from, to });
+      }
+    }
+    return intervals;
+  }
+}
+
+export const subscriptionAnalyticsService = new SubscriptionAnalyticsService();
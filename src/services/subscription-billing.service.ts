@@ -0,0 +1,500 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { PaystackService } from './paystack.service.js';
+import { usageMeteringService } from './usage-metering.service.js';
+
+// Days after each failed charge that dunning tries again; once these run out the invoice is
+// written off and the subscription left unpaid
+export const DUNNING_RETRY_DAYS = [1, 3, 7];
+const DAY_MS = 24 * 60 * 60 * 1000;
+const BILLING_ROLES = ['landlord', 'agency_admin'];
+// An M-Pesa prompt nobody approves within this long counts as a failed attempt
+const PROMPT_TIMEOUT_MS = DAY_MS;
+const INVOICE_STATUSES = ['pending', 'processing', 'paid', 'failed', 'uncollectible'];
+
+export interface BillingInvoiceFilters {
+  status?: string;
+  company_id?: string;
+  from?: string;
+  to?: string;
+  limit?: number;
+  offset?: number;
+}
+
+/**
+ * Platform invoices for landlord and agency subscriptions: raised on each billing date, charged
+ * to the payment method saved at sign-up and chased by dunning when the charge fails.
+ * Subscriptions Paystack bills itself (those with a subscription code) are recorded from its
+ * webhooks instead and are not invoiced here.
+ */
+export class SubscriptionBillingService {
+  private prisma = getPrisma();
+  private paystack = new PaystackService();
+
+  /**
+   * Raise an invoice for every self-billed subscription whose billing date has come, move its
+   * billing date on a cycle and charge it
+   */
+  async generateDueInvoices(now: Date = new Date()) {
+    const due = await this.prisma.subscription.findMany({
+      where: {
+        status: { in: ['active', 'past_due'] },
+        next_billing_date: { lte: now },
+        paystack_subscription_code: null,
+      },
+    });
+
+    let generated = 0;
+    const invoiceIds: string[] = [];
+    for (const subscription of due) {
+      try {
+        const periodStart = subscription.next_billing_date!;
+        const periodEnd = this.advance(periodStart, subscription.billing_cycle);
+        // Plans bill ahead, so usage over the allowance is charged for the period just ended
+        const usedFrom = new Date(Math.max(
+          this.advance(periodStart, subscription.billing_cycle, -1).getTime(),
+          (subscription.trial_end_date || subscription.start_date).getTime(),
+        ));
+        const overage = await usageMeteringService.overageFor(subscription.company_id, subscription.plan, subscription.billing_cycle, usedFrom, periodStart);
+        const invoice = await this.prisma.$transaction(async tx => {
+          const created = await tx.billingInvoice.create({
+            data: {
+              company_id: subscription.company_id,
+              subscription_id: subscription.id,
+              invoice_number: `SUB-${periodStart.toISOString().slice(0, 10).replace(/-/g, '')}-${subscription.id.slice(0, 8).toUpperCase()}`,
+              amount: Number(subscription.amount) + overage.total,
+              currency: subscription.currency,
+              gateway: subscription.gateway,
+              billing_period_start: periodStart,
+              billing_period_end: new Date(periodEnd.getTime() - DAY_MS),
+              due_date: periodStart,
+              description: `${subscription.plan} plan, ${subscription.billing_cycle === 'annual' ? 'annual' : 'monthly'} subscription${overage.total ? ' plus usage overage' : ''}`,
+              metadata: {
+                plan_amount: Number(subscription.amount),
+                overage: { from: usedFrom.toISOString(), to: periodStart.toISOString(), ...overage },
+              },
+            },
+          });
+          await tx.subscription.update({
+            where: { id: subscription.id },
+            data: { next_billing_date: periodEnd, updated_at: now },
+          });
+          return created;
+        });
+        invoiceIds.push(invoice.id);
+        generated++;
+      } catch (error: any) {
+        // A rerun for the same period hits the unique invoice number and is skipped
+        if (error.code !== 'P2002') {
+          console.error(`❌ Failed to raise invoice for subscription ${subscription.id}:`, error.message);
+        }
+      }
+    }
+
+    let charged = 0;
+    for (const id of invoiceIds) {
+      const result = await this.charge(id, now);
+      if (result.status === 'paid') charged++;
+    }
+    return { due: due.length, generated, charged };
+  }
+
+  /**
+   * Charge the invoice's subscription payment method. Card authorizations settle at once; an
+   * M-Pesa prompt leaves the invoice processing until the gateway reports back. Failures are
+   * recorded and scheduled for dunning rather than thrown.
+   */
+  async charge(invoiceId: string, now: Date = new Date()) {
+    const invoice = await this.prisma.billingInvoice.findUnique({
+      where: { id: invoiceId },
+      include: { subscription: true, company: { select: { id: true, email: true, phone_number: true } } },
+    });
+    if (!invoice) {
+      throw new Error('invoice not found');
+    }
+    if (['paid', 'processing'].includes(invoice.status)) {
+      throw new Error(`invoice is already ${invoice.status}`);
+    }
+
+    // Claim the attempt before touching the gateway: of dunning and a "pay now" racing on the same
+    // invoice, only the one whose update lands charges it
+    const claimed = await this.prisma.billingInvoice.updateMany({
+      where: { id: invoice.id, status: { in: ['pending', 'failed', 'uncollectible'] }, attempt_count: invoice.attempt_count },
+      data: { status: 'processing', attempt_count: { increment: 1 }, last_attempt_at: now, updated_at: now },
+    });
+    if (claimed.count === 0) {
+      throw new Error('invoice is already processing');
+    }
+    const attempt = invoice.attempt_count + 1;
+
+    const method = (invoice.subscription.metadata as any)?.payment_method || {};
+    const email = method.email || invoice.company.email;
+    const reference = `${invoice.invoice_number}-${attempt}`;
+    const metadata = { billing_invoice_id: invoice.id, subscription_id: invoice.subscription_id, attempt };
+    try {
+      if (!email) {
+        throw new Error('no billing email on file');
+      }
+      let result: { status: string; reference: string; message: string };
+      switch (invoice.gateway) {
+        case 'paystack':
+          if (!method.authorization_code) {
+            throw new Error('no saved card or mobile money authorization');
+          }
+          result = await this.paystack.chargeAuthorization({
+            email,
+            authorization_code: method.authorization_code,
+            amount: Number(invoice.amount),
+            reference,
+            metadata,
+          });
+          break;
+        case 'mpesa': {
+          const phone = method.phone || invoice.company.phone_number;
+          if (!phone) {
+            throw new Error('no M-Pesa number on file');
+          }
+          // M-Pesa subscriptions are collected through Paystack's mobile money channel
+          result = await this.paystack.chargeMobileMoney({ email, phone, amount: Number(invoice.amount), reference, metadata });
+          break;
+        }
+        default:
+          throw new Error(`${invoice.gateway} billing is not configured`);
+      }
+
+      if (result.status === 'success') {
+        await this.recordPayment(invoice.id, { reference: result.reference, paid_at: now, channel: invoice.gateway });
+        return { invoice_id: invoice.id, status: 'paid', message: result.message };
+      }
+      if (['failed', 'abandoned', 'reversed'].includes(result.status)) {
+        throw new Error(result.message || `charge ${result.status}`);
+      }
+      // Waiting on the customer (an M-Pesa prompt or an OTP); the webhook settles it
+      await this.prisma.billingInvoice.update({
+        where: { id: invoice.id },
+        data: { status: 'processing', gateway_reference: result.reference, next_retry_at: null, last_error: null, updated_at: now },
+      });
+      return { invoice_id: invoice.id, status: 'processing', message: result.message };
+    } catch (error: any) {
+      const status = await this.recordFailure(invoice.id, attempt, error.message, now);
+      return { invoice_id: invoice.id, status, message: error.message };
+    }
+  }
+
+  /**
+   * Retry failed invoices whose next attempt is due, and fail M-Pesa prompts that went
+   * unanswered so they join the retry schedule. A prompt is only failed once the gateway says so;
+   * one it still holds open can yet be approved, and prompting again could charge twice.
+   */
+  async runDunning(now: Date = new Date()) {
+    const stale = await this.prisma.billingInvoice.findMany({
+      where: { status: 'processing', last_attempt_at: { lte: new Date(now.getTime() - PROMPT_TIMEOUT_MS) } },
+      select: { id: true, attempt_count: true, gateway_reference: true, gateway: true },
+    });
+    let timedOut = 0;
+    for (const invoice of stale) {
+      if (invoice.gateway_reference) {
+        let charge: { status: string; reference: string; paid_at: string | null };
+        try {
+          charge = await this.paystack.verifyCharge(invoice.gateway_reference);
+        } catch (error: any) {
+          console.error(`❌ Failed to check billing invoice ${invoice.id} with the gateway:`, error.message);
+          continue;
+        }
+        if (charge.status === 'success') {
+          await this.recordPayment(invoice.id, { reference: charge.reference, paid_at: charge.paid_at, channel: invoice.gateway });
+          continue;
+        }
+        if (!['failed', 'abandoned', 'reversed'].includes(charge.status)) {
+          continue;
+        }
+      }
+      await this.recordFailure(invoice.id, invoice.attempt_count, 'payment prompt was not approved', now);
+      timedOut++;
+    }
+
+    const due = await this.prisma.billingInvoice.findMany({
+      where: { status: 'failed', next_retry_at: { lte: now } },
+      select: { id: true },
+    });
+    let recovered = 0;
+    for (const invoice of due) {
+      try {
+        const result = await this.charge(invoice.id, now);
+        if (result.status === 'paid') recovered++;
+      } catch (error: any) {
+        console.error(`❌ Failed to retry billing invoice ${invoice.id}:`, error.message);
+      }
+    }
+    return { retried: due.length, recovered, timed_out: timedOut };
+  }
+
+  /**
+   * Settle an invoice the gateway reports paid and bring its subscription back to active.
+   * Repeated reports for the same invoice are ignored.
+   */
+  async recordPayment(invoiceId: string, payment: { reference?: string | null; paid_at?: Date | string | null; channel?: string | null }) {
+    const invoice = await this.prisma.billingInvoice.findUnique({ where: { id: invoiceId }, include: { subscription: true } });
+    if (!invoice || invoice.status === 'paid') {
+      return invoice;
+    }
+    const now = new Date();
+    const [updated] = await this.prisma.$transaction([
+      this.prisma.billingInvoice.update({
+        where: { id: invoice.id },
+        data: {
+          status: 'paid',
+          paid_at: payment.paid_at ? new Date(payment.paid_at) : now,
+          gateway_reference: payment.reference || invoice.gateway_reference,
+          next_retry_at: null,
+          last_error: null,
+          metadata: { ...((invoice.metadata as object) || {}), channel: payment.channel || null },
+          updated_at: now,
+        },
+      }),
+      ...(['past_due', 'unpaid'].includes(invoice.subscription.status)
+        ? [this.prisma.subscription.update({ where: { id: invoice.subscription_id }, data: { status: 'active', updated_at: now } })]
+        : []),
+    ]);
+
+    if (invoice.attempt_count > 1 || invoice.status === 'uncollectible') {
+      try {
+        await this.notifyAdmins(invoice.company_id, {
+          title: 'Payment received',
+          message: `Invoice ${invoice.invoice_number} for ${invoice.currency} ${Number(invoice.amount).toLocaleString()} has been paid. Thank you.`,
+          priority: 'medium',
+          metadata: { billing_invoice_id: invoice.id, subscription_id: invoice.subscription_id },
+        });
+      } catch (error: any) {
+        console.error(`❌ Failed to send payment notice for billing invoice ${invoice.id}:`, error.message);
+      }
+    }
+    return updated;
+  }
+
+  /**
+   * The caller's company billing: subscription, open balance and recent invoices
+   */
+  async getOverview(user: JWTClaims) {
+    const companyId = this.companyFor(user);
+    const [subscription, open, invoices] = await Promise.all([
+      this.prisma.subscription.findFirst({ where: { company_id: companyId }, orderBy: { created_at: 'desc' } }),
+      this.prisma.billingInvoice.aggregate({
+        where: { company_id: companyId, status: { in: ['pending', 'processing', 'failed', 'uncollectible'] } },
+        _sum: { amount: true },
+        _count: true,
+      }),
+      this.prisma.billingInvoice.findMany({ where: { company_id: companyId }, orderBy: { created_at: 'desc' }, take: 5 }),
+    ]);
+    const method = (subscription?.metadata as any)?.payment_method || null;
+    return {
+      subscription: subscription && {
+        id: subscription.id,
+        plan: subscription.plan,
+        status: subscription.status,
+        amount: Number(subscription.amount),
+        currency: subscription.currency,
+        billing_cycle: subscription.billing_cycle,
+        gateway: subscription.gateway,
+        next_billing_date: subscription.next_billing_date,
+        payment_method: method && { channel: method.channel, brand: method.brand, last4: method.last4 },
+      },
+      outstanding: { count: open._count, amount: Number(open._sum.amount || 0) },
+      recent_invoices: invoices.map(invoice => this.present(invoice)),
+    };
+  }
+
+  async listForCompany(user: JWTClaims, filters: BillingInvoiceFilters = {}) {
+    return this.list({ ...filters, company_id: this.companyFor(user) });
+  }
+
+  async getForCompany(user: JWTClaims, invoiceId: string) {
+    const invoice = await this.prisma.billingInvoice.findFirst({
+      where: { id: invoiceId, company_id: this.companyFor(user) },
+      include: { subscription: { select: { id: true, plan: true, billing_cycle: true, status: true } } },
+    });
+    if (!invoice) {
+      throw new Error('invoice not found');
+    }
+    return { ...this.present(invoice), subscription: invoice.subscription };
+  }
+
+  /**
+   * Pay an open invoice now instead of waiting for the next dunning attempt
+   */
+  async payForCompany(user: JWTClaims, invoiceId: string) {
+    const invoice = await this.prisma.billingInvoice.findFirst({
+      where: { id: invoiceId, company_id: this.companyFor(user) },
+      select: { id: true },
+    });
+    if (!invoice) {
+      throw new Error('invoice not found');
+    }
+    return this.charge(invoice.id);
+  }
+
+  /**
+   * Invoices across the platform for super admins, with totals by status over the same filters
+   */
+  async list(filters: BillingInvoiceFilters = {}) {
+    if (filters.status && filters.status !== 'all' && !INVOICE_STATUSES.includes(filters.status)) {
+      throw new Error(`status must be one of: ${INVOICE_STATUSES.join(', ')}`);
+    }
+    const where: any = {};
+    if (filters.company_id) where.company_id = filters.company_id;
+    if (filters.from || filters.to) {
+      where.created_at = {
+        ...(filters.from && { gte: new Date(filters.from) }),
+        ...(filters.to && { lte: new Date(filters.to) }),
+      };
+    }
+    const limit = Math.min(Math.max(filters.limit || 20, 1), 100);
+    const offset = Math.max(filters.offset || 0, 0);
+    const listWhere = filters.status && filters.status !== 'all' ? { ...where, status: filters.status } : where;
+
+    const [invoices, total, byStatus] = await Promise.all([
+      this.prisma.billingInvoice.findMany({
+        where: listWhere,
+        include: { company: { select: { id: true, name: true, email: true } }, subscription: { select: { plan: true, billing_cycle: true } } },
+        orderBy: { created_at: 'desc' },
+        take: limit,
+        skip: offset,
+      }),
+      this.prisma.billingInvoice.count({ where: listWhere }),
+      this.prisma.billingInvoice.groupBy({ by: ['status'], where, _count: true, _sum: { amount: true } }),
+    ]);
+
+    const summary: Record<string, number> = {};
+    for (const status of INVOICE_STATUSES) {
+      const row = byStatus.find(group => group.status === status);
+      summary[status] = row?._count || 0;
+      summary[`total_${status}`] = Number(row?._sum.amount || 0);
+    }
+    return {
+      invoices: invoices.map(invoice => ({
+        ...this.present(invoice),
+        customer_name: invoice.company.name,
+        customer_email: invoice.company.email,
+        plan_name: invoice.subscription.plan,
+        billing_cycle: invoice.subscription.billing_cycle,
+      })),
+      total,
+      limit,
+      offset,
+      summary,
+    };
+  }
+
+  private async recordFailure(invoiceId: string, attempt: number, reason: string, now: Date) {
+    const invoice = await this.prisma.billingInvoice.findUnique({ where: { id: invoiceId } });
+    if (!invoice || invoice.status === 'paid') {
+      return invoice?.status || 'failed';
+    }
+    const retryDays = DUNNING_RETRY_DAYS[attempt - 1];
+    const exhausted = retryDays === undefined;
+    const nextRetry = exhausted ? null : new Date(now.getTime() + retryDays * DAY_MS);
+    const status = exhausted ? 'uncollectible' : 'failed';
+    await this.prisma.$transaction([
+      this.prisma.billingInvoice.update({
+        where: { id: invoice.id },
+        data: { status, next_retry_at: nextRetry, last_error: reason, updated_at: now },
+      }),
+      this.prisma.subscription.update({
+        where: { id: invoice.subscription_id },
+        data: { status: exhausted ? 'unpaid' : 'past_due', updated_at: now },
+      }),
+    ]);
+
+    try {
+      const amount = `${invoice.currency} ${Number(invoice.amount).toLocaleString()}`;
+      await this.notifyAdmins(invoice.company_id, exhausted
+        ? {
+            title: 'Subscription payment failed',
+            message: `We could not collect ${amount} for invoice ${invoice.invoice_number} after ${attempt} attempts (${reason}). Update your payment method and pay the invoice to keep your subscription.`,
+            priority: 'high',
+            metadata: { billing_invoice_id: invoice.id, subscription_id: invoice.subscription_id, attempt },
+          }
+        : {
+            title: 'We could not collect your subscription payment',
+            message: `The charge of ${amount} for invoice ${invoice.invoice_number} failed (${reason}). We will try again on ${nextRetry!.toLocaleDateString('en-KE', { year: 'numeric', month: 'long', day: 'numeric' })}, or you can pay it now.`,
+            priority: attempt > 1 ? 'high' : 'medium',
+            metadata: { billing_invoice_id: invoice.id, subscription_id: invoice.subscription_id, attempt, next_retry_at: nextRetry!.toISOString() },
+          });
+    } catch (error: any) {
+      console.error(`❌ Failed to send dunning notice for billing invoice ${invoice.id}:`, error.message);
+    }
+    return status;
+  }
+
+  private advance(date: Date, billingCycle: string, cycles: number = 1) {
+    const next = new Date(date);
+    if (billingCycle === 'annual') {
+      next.setFullYear(next.getFullYear() + cycles);
+    } else {
+      next.setMonth(next.getMonth() + cycles);
+    }
+    return next;
+  }
+
+  private present(invoice: any) {
+    return {
+      id: invoice.id,
+      invoice_number: invoice.invoice_number,
+      company_id: invoice.company_id,
+      subscription_id: invoice.subscription_id,
+      amount: Number(invoice.amount),
+      currency: invoice.currency,
+      status: invoice.status,
+      gateway: invoice.gateway,
+      gateway_reference: invoice.gateway_reference,
+      description: invoice.description,
+      overage: (invoice.metadata as any)?.overage?.line_items?.length ? (invoice.metadata as any).overage : null,
+      billing_period_start: invoice.billing_period_start,
+      billing_period_end: invoice.billing_period_end,
+      due_date: invoice.due_date,
+      paid_at: invoice.paid_at,
+      attempt_count: invoice.attempt_count,
+      last_attempt_at: invoice.last_attempt_at,
+      next_retry_at: invoice.next_retry_at,
+      last_error: invoice.last_error,
+      created_at: invoice.created_at,
+    };
+  }
+
+  private companyFor(user: JWTClaims) {
+    if (!BILLING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view billing');
+    }
+    if (!user.company_id) {
+      throw new Error('user must belong to a company');
+    }
+    return user.company_id;
+  }
+
+  private async notifyAdmins(companyId: string, notice: { title: string; message: string; priority: 'medium' | 'high'; metadata: Record<string, any> }) {
+    const { notificationsService } = await import('./notifications.service.js');
+    const admins = await this.prisma.user.findMany({
+      where: { company_id: companyId, role: { in: BILLING_ROLES as any }, status: 'active' },
+      select: { id: true },
+    });
+    for (const admin of admins) {
+      const channels = await notificationsService.resolveChannels(admin.id, 'subscription_billing', ['email'], 'general', notice.priority);
+      await notificationsService.notify({
+        company_id: companyId,
+        recipient_id: admin.id,
+        title: notice.title,
+        message: notice.message,
+        notification_type: 'subscription_billing',
+        category: 'general',
+        priority: notice.priority,
+        action_required: notice.priority === 'high',
+        action_url: '/settings?tab=billing',
+        related_entity_type: 'billing_invoice',
+        related_entity_id: notice.metadata.billing_invoice_id,
+        metadata: notice.metadata,
+      }, channels);
+    }
+  }
+}
+
+export const subscriptionBillingService = new SubscriptionBillingService();
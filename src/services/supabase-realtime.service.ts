@@ -73,6 +73,8 @@ class SupabaseRealtimeService {
       config: {
         broadcast: { self: true },
         presence: { key: '' },
+        // Private channels are subject to the realtime.messages policy for client subscribers
+        private: env.realtime.privateChannels,
       },
     });
 
@@ -104,6 +106,61 @@ class SupabaseRealtimeService {
     }
   }
 
+  // ============================================================================
+  // BACKPLANE METHODS
+  // ============================================================================
+
+  /**
+   * Receive events other API instances publish on a backplane topic. Node-local state (such as
+   * presence) stays consistent across a multi-instance deployment this way. Returns false when
+   * Supabase is not configured, in which case each instance only sees its own events.
+   */
+  subscribeBackplane(topic: string, handler: (payload: any) => void): boolean {
+    if (!this.supabase) return false;
+
+    const channelName = `backplane:${topic}`;
+    if (this.channels.has(channelName)) {
+      this.channels.get(channelName)!.on('broadcast', { event: topic }, ({ payload }) => handler(payload));
+      return true;
+    }
+
+    // Instances apply their own events directly, so they don't need them echoed back
+    const channel = this.supabase.channel(channelName, {
+      config: { broadcast: { self: false }, private: env.realtime.privateChannels },
+    });
+    channel.on('broadcast', { event: topic }, ({ payload }) => handler(payload));
+    channel.subscribe(status => {
+      if (status === 'SUBSCRIBED') {
+        console.log(`✅ Backplane ${topic} subscribed`);
+      } else if (status === 'CHANNEL_ERROR') {
+        console.error(`❌ Backplane ${topic} error - events from other instances will be missed`);
+      }
+    });
+
+    this.channels.set(channelName, channel);
+    return true;
+  }
+
+  /**
+   * Fan an event out to every other API instance subscribed to the topic
+   */
+  async publishBackplane(topic: string, payload: any): Promise<boolean> {
+    if (!this.supabase) return false;
+
+    try {
+      const channel = this.getOrCreateChannel(`backplane:${topic}`);
+      await channel.send({
+        type: 'broadcast',
+        event: topic,
+        payload,
+      });
+      return true;
+    } catch (error) {
+      console.error(`Error publishing to backplane ${topic}:`, error);
+      return false;
+    }
+  }
+
   // ============================================================================
   // MESSAGING METHODS
   // ============================================================================
@@ -233,6 +290,33 @@ class SupabaseRealtimeService {
     }
   }
 
+  /**
+   * Publish delivery receipt for messages that reached a recipient's device
+   */
+  async publishDeliveryStatus(senderId: string, messageIds: string[], deliveredTo: string, deliveredAt: Date): Promise<boolean> {
+    if (!this.supabase) return false;
+
+    try {
+      const channel = this.getOrCreateChannel(`read_status:${senderId}`);
+
+      await channel.send({
+        type: 'broadcast',
+        event: 'message_delivered',
+        payload: {
+          messageIds,
+          deliveredTo,
+          deliveredAt: deliveredAt.toISOString(),
+          timestamp: new Date().toISOString(),
+        },
+      });
+
+      return true;
+    } catch (error) {
+      console.error('Error publishing delivery status:', error);
+      return false;
+    }
+  }
+
   /**
    * Publish message reaction
    */
@@ -267,24 +351,27 @@ class SupabaseRealtimeService {
   /**
    * Publish presence update
    */
-  async publishPresenceUpdate(userId: string, status: string, message?: string): Promise<boolean> {
+  async publishPresenceUpdate(userId: string, status: string, message?: string, conversationIds: string[] = []): Promise<boolean> {
     if (!this.supabase) return false;
 
     try {
-      // Publish to user's presence channel
-      const channel = this.getOrCreateChannel(`presence:${userId}`);
-      
-      await channel.send({
-        type: 'broadcast',
-        event: 'presence_updated',
-        payload: {
-          userId,
-          status,
-          message,
-          lastSeenAt: status === 'offline' ? new Date().toISOString() : null,
-          timestamp: new Date().toISOString(),
-        },
-      });
+      const payload = {
+        userId,
+        status,
+        message,
+        lastSeenAt: status === 'offline' ? new Date().toISOString() : null,
+        timestamp: new Date().toISOString(),
+      };
+
+      // Publish to user's presence channel and the rooms of their conversations
+      for (const name of [`presence:${userId}`, ...conversationIds.map(id => `conversation:${id}`)]) {
+        const channel = this.getOrCreateChannel(name);
+        await channel.send({
+          type: 'broadcast',
+          event: 'presence_updated',
+          payload,
+        });
+      }
 
       return true;
     } catch (error) {
@@ -304,24 +391,27 @@ class SupabaseRealtimeService {
     conversationId: string,
     userId: string,
     recipientIds: string[],
-    isTyping: boolean
+    isTyping: boolean,
+    expiresInMs?: number
   ): Promise<boolean> {
     if (!this.supabase) return false;
 
     try {
-      // Publish to each recipient's typing channel
-      for (const recipientId of recipientIds) {
-        const channel = this.getOrCreateChannel(`typing:${recipientId}`);
-        
+      const payload = {
+        conversationId,
+        userId,
+        isTyping,
+        expiresInMs,
+        timestamp: new Date().toISOString(),
+      };
+
+      // Publish to the conversation room and each recipient's typing channel
+      for (const name of [`conversation:${conversationId}`, ...recipientIds.map(id => `typing:${id}`)]) {
+        const channel = this.getOrCreateChannel(name);
         await channel.send({
           type: 'broadcast',
           event: 'typing',
-          payload: {
-            conversationId,
-            userId,
-            isTyping,
-            timestamp: new Date().toISOString(),
-          },
+          payload,
         });
       }
 
@@ -0,0 +1,220 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export type SystemLogLevel = 'info' | 'warn' | 'error';
+
+export interface SystemLogEntry {
+  level: SystemLogLevel;
+  service: string;
+  event: string;
+  message: string;
+  method?: string | null;
+  path?: string | null;
+  status_code?: number | null;
+  duration_ms?: number | null;
+  user?: Pick<JWTClaims, 'user_id' | 'email' | 'role' | 'company_id'> | null;
+  user_email?: string | null;
+  ip_address?: string | null;
+  metadata?: Record<string, any>;
+}
+
+export interface SystemLogFilters {
+  level?: string;
+  service?: string;
+  event?: string;
+  events?: string[];
+  user_id?: string;
+  status_code?: string | number;
+  search?: string;
+  from?: string;
+  to?: string;
+  page?: number;
+  limit?: number;
+}
+
+const LEVELS: SystemLogLevel[] = ['info', 'warn', 'error'];
+const UUID_PATTERN = /^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/i;
+const HOUR_MS = 60 * 60 * 1000;
+// An hour of failed logins is a spike when it is this many or more and well above the period's norm
+const LOGIN_SPIKE_MIN = 10;
+
+/**
+ * Structured application logs kept in the database for the operations dashboard: failed and
+ * slow requests, logins and super admin actions. Old entries go under the data retention
+ * policies.
+ */
+export class SystemLogsService {
+  private prisma = getPrisma();
+
+  /**
+   * Write an entry. Never throws: logging must not fail the request being logged.
+   */
+  async record(entry: SystemLogEntry) {
+    try {
+      await this.prisma.systemLog.create({
+        data: {
+          level: entry.level,
+          service: entry.service.slice(0, 100),
+          event: entry.event,
+          message: entry.message.slice(0, 2000),
+          method: entry.method || null,
+          path: entry.path ? entry.path.slice(0, 255) : null,
+          status_code: entry.status_code ?? null,
+          duration_ms: entry.duration_ms ?? null,
+          user_id: entry.user?.user_id && UUID_PATTERN.test(entry.user.user_id) ? entry.user.user_id : null,
+          user_email: (entry.user?.email || entry.user_email)?.slice(0, 255) || null,
+          user_role: entry.user?.role || null,
+          company_id: entry.user?.company_id || null,
+          ip_address: entry.ip_address ? entry.ip_address.slice(0, 45) : null,
+          metadata: entry.metadata || {},
+        },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to record system log:', error.message);
+    }
+  }
+
+  /**
+   * Log entries newest first, filtered and paginated
+   */
+  async list(filters: SystemLogFilters = {}) {
+    const where = this.whereFor(filters);
+    const page = Math.max(filters.page || 1, 1);
+    const limit = Math.min(Math.max(filters.limit || 50, 1), 200);
+    const [logs, total] = await Promise.all([
+      this.prisma.systemLog.findMany({ where, orderBy: { created_at: 'desc' }, take: limit, skip: (page - 1) * limit }),
+      this.prisma.systemLog.count({ where }),
+    ]);
+    return { logs, total, page, limit, pages: Math.ceil(total / limit) };
+  }
+
+  /**
+   * What went wrong over a period (the last 24 hours by default): errors by service, hourly
+   * failed logins with the spikes marked, the slowest endpoints and the latest errors
+   */
+  async getOperationsOverview(query: { from?: string; to?: string } = {}) {
+    const to = query.to ? new Date(query.to) : new Date();
+    const from = query.from ? new Date(query.from) : new Date(to.getTime() - 24 * HOUR_MS);
+    if (isNaN(from.getTime()) || isNaN(to.getTime())) {
+      throw new Error('from and to must be valid dates');
+    }
+    if (from >= to) {
+      throw new Error('from must be before to');
+    }
+    const period = { created_at: { gte: from, lte: to } };
+
+    const [byLevel, errorsByService, failedLogins, failedLoginIps, slowEndpoints, recentErrors] = await Promise.all([
+      this.prisma.systemLog.groupBy({ by: ['level'], where: period, _count: true }),
+      this.prisma.systemLog.groupBy({
+        by: ['service'],
+        where: { ...period, level: 'error' },
+        _count: true,
+        orderBy: { _count: { service: 'desc' } },
+        take: 20,
+      }),
+      this.prisma.$queryRaw<Array<{ hour: Date; count: number }>>`
+        SELECT date_trunc('hour', created_at) AS hour, COUNT(*)::int AS count
+        FROM system_logs
+        WHERE event = 'login_failed' AND created_at >= ${from} AND created_at <= ${to}
+        GROUP BY 1
+        ORDER BY 1
+      `,
+      this.prisma.systemLog.groupBy({
+        by: ['ip_address'],
+        where: { ...period, event: 'login_failed' },
+        _count: true,
+        orderBy: { _count: { ip_address: 'desc' } },
+        take: 10,
+      }),
+      this.prisma.systemLog.groupBy({
+        by: ['method', 'path'],
+        where: { ...period, event: 'slow_request' },
+        _count: true,
+        _avg: { duration_ms: true },
+        _max: { duration_ms: true },
+        orderBy: { _count: { path: 'desc' } },
+        take: 20,
+      }),
+      this.prisma.systemLog.findMany({ where: { ...period, level: 'error' }, orderBy: { created_at: 'desc' }, take: 10 }),
+    ]);
+
+    // Hours with no failures count towards the norm too
+    const hours = Math.max(Math.ceil((to.getTime() - from.getTime()) / HOUR_MS), 1);
+    const counts = failedLogins.map(bucket => Number(bucket.count));
+    const mean = counts.reduce((sum, count) => sum + count, 0) / hours;
+    const quietHours = Math.max(hours - counts.length, 0);
+    const variance = (counts.reduce((sum, count) => sum + (count - mean) ** 2, 0) + quietHours * mean ** 2) / hours;
+    const threshold = Math.max(LOGIN_SPIKE_MIN, Math.ceil(mean + 3 * Math.sqrt(variance)));
+
+    return {
+      period: { from, to },
+      totals: Object.fromEntries(LEVELS.map(level => [level, byLevel.find(row => row.level === level)?._count || 0])),
+      errors_by_service: errorsByService.map(row => ({ service: row.service, errors: row._count })),
+      failed_logins: {
+        total: counts.reduce((sum, count) => sum + count, 0),
+        spike_threshold: threshold,
+        hourly: failedLogins.map(bucket => ({ hour: bucket.hour, count: Number(bucket.count), spike: Number(bucket.count) >= threshold })),
+        top_ips: failedLoginIps.map(row => ({ ip_address: row.ip_address, attempts: row._count })),
+      },
+      slow_endpoints: slowEndpoints.map(row => ({
+        method: row.method,
+        path: row.path,
+        count: row._count,
+        avg_duration_ms: Math.round(row._avg.duration_ms || 0),
+        max_duration_ms: row._max.duration_ms || 0,
+      })),
+      recent_errors: recentErrors,
+    };
+  }
+
+  /**
+   * What super admins changed: every write they made through the API
+   */
+  async listAdminActivity(filters: SystemLogFilters = {}) {
+    return this.list({ ...filters, level: undefined, event: 'admin_action', events: undefined });
+  }
+
+  private whereFor(filters: SystemLogFilters) {
+    const where: any = {};
+    if (filters.level && filters.level !== 'all') {
+      if (!LEVELS.includes(filters.level as SystemLogLevel)) {
+        throw new Error(`level must be one of: ${LEVELS.join(', ')}`);
+      }
+      where.level = filters.level;
+    }
+    if (filters.service) where.service = filters.service;
+    if (filters.events?.length) where.event = { in: filters.events };
+    if (filters.event) where.event = filters.event;
+    if (filters.user_id) {
+      if (!UUID_PATTERN.test(filters.user_id)) {
+        throw new Error('user_id must be a valid id');
+      }
+      where.user_id = filters.user_id;
+    }
+    if (filters.status_code) {
+      const statusCode = Number(filters.status_code);
+      if (!Number.isInteger(statusCode)) {
+        throw new Error('status_code must be a number');
+      }
+      where.status_code = statusCode;
+    }
+    if (filters.search) {
+      where.OR = [
+        { message: { contains: filters.search, mode: 'insensitive' } },
+        { path: { contains: filters.search, mode: 'insensitive' } },
+        { user_email: { contains: filters.search, mode: 'insensitive' } },
+      ];
+    }
+    if (filters.from || filters.to) {
+      const from = filters.from ? new Date(filters.from) : null;
+      const to = filters.to ? new Date(filters.to) : null;
+      if ((from && isNaN(from.getTime())) || (to && isNaN(to.getTime()))) {
+        throw new Error('from and to must be valid dates');
+      }
+      where.created_at = { ...(from && { gte: from }), ...(to && { lte: to }) };
+    }
+    return where;
+  }
+}
+
+export const systemLogsService = new SystemLogsService();
@@ -1,17 +1,29 @@
+import { Prisma } from '@prisma/client';
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 
+export type SettingDataType = 'string' | 'number' | 'boolean' | 'json';
+
 export interface SystemSettingData {
   key: string;
   value: string;
-  data_type?: 'string' | 'number' | 'boolean' | 'json';
+  data_type?: SettingDataType;
   category: string;
   description?: string;
   is_public?: boolean;
 }
 
+type SettingRow = Prisma.SystemSettingsGetPayload<{}>;
+
+// The table is small and read on hot paths, so it is cached whole and dropped on every write
+const CACHE_TTL_MS = 5 * 60 * 1000;
+// Secret values are stored but never returned or written to the change history in the clear
+const SECRET_KEY_PATTERN = /(password|secret|api_key|token)/i;
+const MASKED_VALUE = '********';
+
 export class SystemSettingsService {
   private prisma = getPrisma();
+  private cache: { settings: Map<string, SettingRow>; loaded_at: number } | null = null;
 
   /**
    * Get all system settings, optionally filtered by category
@@ -39,15 +51,8 @@ export class SystemSettingsService {
       });
 
       return settings.map(setting => ({
-        id: setting.id,
-        key: setting.key,
-        value: setting.value,
-        data_type: setting.data_type as 'string' | 'number' | 'boolean' | 'json',
-        category: setting.category,
-        description: setting.description || '',
-        is_public: setting.is_public,
-        updated_by: setting.updated_by || '',
-        updated_at: setting.updated_at.toISOString(),
+        ...this.present(setting),
+        updater: setting.updater,
         name: this.getSettingName(setting.key),
         type: setting.data_type
       }));
@@ -81,15 +86,8 @@ export class SystemSettingsService {
       }
 
       return {
-        id: setting.id,
-        key: setting.key,
-        value: setting.value,
-        data_type: setting.data_type as 'string' | 'number' | 'boolean' | 'json',
-        category: setting.category,
-        description: setting.description || '',
-        is_public: setting.is_public,
-        updated_by: setting.updated_by || '',
-        updated_at: setting.updated_at.toISOString(),
+        ...this.present(setting),
+        updater: setting.updater,
         name: this.getSettingName(setting.key),
         type: setting.data_type
       };
@@ -107,39 +105,35 @@ export class SystemSettingsService {
       // Validate value based on data type
       const validatedValue = this.validateValue(data.value, data.data_type || 'string');
 
-      const setting = await this.prisma.systemSettings.upsert({
-        where: { key: data.key },
-        update: {
-          value: validatedValue,
-          data_type: data.data_type || 'string',
-          category: data.category,
-          description: data.description,
-          is_public: data.is_public ?? false,
-          updated_by: user.user_id,
-          updated_at: new Date()
-        },
-        create: {
-          key: data.key,
-          value: validatedValue,
-          data_type: data.data_type || 'string',
-          category: data.category,
-          description: data.description,
-          is_public: data.is_public ?? false,
-          updated_by: user.user_id
-        }
+      const setting = await this.prisma.$transaction(async (tx) => {
+        const existing = await tx.systemSettings.findUnique({ where: { key: data.key } });
+        const saved = await tx.systemSettings.upsert({
+          where: { key: data.key },
+          update: {
+            value: validatedValue,
+            data_type: data.data_type || 'string',
+            category: data.category,
+            description: data.description,
+            is_public: data.is_public ?? false,
+            updated_by: user.user_id,
+            updated_at: new Date()
+          },
+          create: {
+            key: data.key,
+            value: validatedValue,
+            data_type: data.data_type || 'string',
+            category: data.category,
+            description: data.description,
+            is_public: data.is_public ?? false,
+            updated_by: user.user_id
+          }
+        });
+        await this.recordChange(tx, user, saved, existing?.value ?? null);
+        return saved;
       });
+      this.invalidate();
 
-      return {
-        id: setting.id,
-        key: setting.key,
-        value: setting.value,
-        data_type: setting.data_type as 'string' | 'number' | 'boolean' | 'json',
-        category: setting.category,
-        description: setting.description || '',
-        is_public: setting.is_public,
-        updated_by: setting.updated_by || '',
-        updated_at: setting.updated_at.toISOString()
-      };
+      return this.present(setting);
     } catch (error: any) {
       console.error('Error upserting system setting:', error);
       throw new Error(`Failed to save system setting: ${error.message}`);
@@ -151,37 +145,8 @@ export class SystemSettingsService {
    */
   async updateSystemSetting(user: JWTClaims, key: string, value: string) {
     try {
-      const existing = await this.prisma.systemSettings.findUnique({
-        where: { key }
-      });
-
-      if (!existing) {
-        throw new Error(`System setting with key '${key}' not found`);
-      }
-
-      // Validate value based on existing data type
-      const validatedValue = this.validateValue(value, existing.data_type as 'string' | 'number' | 'boolean' | 'json');
-
-      const setting = await this.prisma.systemSettings.update({
-        where: { key },
-        data: {
-          value: validatedValue,
-          updated_by: user.user_id,
-          updated_at: new Date()
-        }
-      });
-
-      return {
-        id: setting.id,
-        key: setting.key,
-        value: setting.value,
-        data_type: setting.data_type as 'string' | 'number' | 'boolean' | 'json',
-        category: setting.category,
-        description: setting.description || '',
-        is_public: setting.is_public,
-        updated_by: setting.updated_by || '',
-        updated_at: setting.updated_at.toISOString()
-      };
+      const [setting] = await this.applyUpdates(user, { [key]: value });
+      return setting;
     } catch (error: any) {
       console.error('Error updating system setting:', error);
       throw new Error(`Failed to update system setting: ${error.message}`);
@@ -189,23 +154,99 @@ export class SystemSettingsService {
   }
 
   /**
-   * Bulk update system settings
+   * Bulk update system settings. Every value is validated before any is written, and the writes
+   * land together or not at all.
    */
   async bulkUpdateSystemSettings(user: JWTClaims, settings: Record<string, string>) {
     try {
-      const updates = await Promise.all(
-        Object.entries(settings).map(([key, value]) =>
-          this.updateSystemSetting(user, key, value)
-        )
-      );
-
-      return updates;
+      return await this.applyUpdates(user, settings);
     } catch (error: any) {
       console.error('Error bulk updating system settings:', error);
       throw new Error(`Failed to bulk update system settings: ${error.message}`);
     }
   }
 
+  /**
+   * Who changed which setting, newest first; optionally for one key
+   */
+  async getChangeHistory(filters: { key?: string; page?: number; limit?: number } = {}) {
+    const page = Math.max(1, filters.page || 1);
+    const limit = Math.min(100, Math.max(1, filters.limit || 50));
+    const where = filters.key ? { key: filters.key } : {};
+
+    const [changes, total] = await Promise.all([
+      this.prisma.systemSettingChange.findMany({
+        where,
+        orderBy: { created_at: 'desc' },
+        skip: (page - 1) * limit,
+        take: limit,
+        include: {
+          changer: {
+            select: {
+              id: true,
+              first_name: true,
+              last_name: true,
+              email: true
+            }
+          }
+        }
+      }),
+      this.prisma.systemSettingChange.count({ where }),
+    ]);
+
+    return {
+      changes,
+      pagination: { page, limit, total, total_pages: Math.ceil(total / limit) },
+    };
+  }
+
+  /**
+   * Public settings as typed values, safe to serve without authentication
+   */
+  async getPublicSettings() {
+    const settings = await this.loadSettings();
+    const publicSettings: Record<string, unknown> = {};
+    for (const setting of settings.values()) {
+      if (setting.is_public && !this.isSecret(setting.key)) {
+        publicSettings[setting.key] = this.parse(setting);
+      }
+    }
+    return publicSettings;
+  }
+
+  async getString(key: string, fallback = ''): Promise<string> {
+    const setting = (await this.loadSettings()).get(key);
+    return setting ? setting.value : fallback;
+  }
+
+  async getNumber(key: string, fallback: number): Promise<number> {
+    const setting = (await this.loadSettings()).get(key);
+    const value = setting ? Number(setting.value) : NaN;
+    return isNaN(value) ? fallback : value;
+  }
+
+  async getBoolean(key: string, fallback: boolean): Promise<boolean> {
+    const setting = (await this.loadSettings()).get(key);
+    return setting ? setting.value === 'true' : fallback;
+  }
+
+  async getJson<T>(key: string, fallback: T): Promise<T> {
+    const setting = (await this.loadSettings()).get(key);
+    if (!setting) return fallback;
+    try {
+      return JSON.parse(setting.value) as T;
+    } catch {
+      return fallback;
+    }
+  }
+
+  /**
+   * Drop the cached settings; the next read goes to the database
+   */
+  invalidate() {
+    this.cache = null;
+  }
+
   /**
    * Initialize default system settings if they don't exist
    */
@@ -367,10 +408,109 @@ export class SystemSettingsService {
     }
   }
 
+  private async applyUpdates(user: JWTClaims, values: Record<string, string>) {
+    const keys = Object.keys(values);
+    const existing = await this.prisma.systemSettings.findMany({ where: { key: { in: keys } } });
+    const byKey = new Map(existing.map(setting => [setting.key, setting]));
+
+    const updates: { setting: SettingRow; value: string }[] = [];
+    for (const key of keys) {
+      const setting = byKey.get(key);
+      if (!setting) {
+        throw new Error(`System setting with key '${key}' not found`);
+      }
+      // A masked secret sent back unchanged from the settings form leaves the stored value alone
+      if (this.isSecret(key) && values[key] === MASKED_VALUE) continue;
+      updates.push({ setting, value: this.validateValue(values[key], setting.data_type as SettingDataType) });
+    }
+
+    const saved = await this.prisma.$transaction(async (tx) => {
+      const results: SettingRow[] = [];
+      for (const { setting, value } of updates) {
+        if (value === setting.value) {
+          results.push(setting);
+          continue;
+        }
+        const updated = await tx.systemSettings.update({
+          where: { id: setting.id },
+          data: {
+            value,
+            updated_by: user.user_id,
+            updated_at: new Date()
+          }
+        });
+        await this.recordChange(tx, user, updated, setting.value);
+        results.push(updated);
+      }
+      return results;
+    });
+    this.invalidate();
+
+    return saved.map(setting => this.present(setting));
+  }
+
+  private async recordChange(tx: Prisma.TransactionClient, user: JWTClaims, setting: SettingRow, oldValue: string | null) {
+    if (oldValue === setting.value) return;
+    const secret = this.isSecret(setting.key);
+    await tx.systemSettingChange.create({
+      data: {
+        setting_id: setting.id,
+        key: setting.key,
+        old_value: oldValue === null ? null : secret ? MASKED_VALUE : oldValue,
+        new_value: secret ? MASKED_VALUE : setting.value,
+        changed_by: user.user_id,
+      },
+    });
+  }
+
+  private async loadSettings() {
+    if (this.cache && Date.now() - this.cache.loaded_at < CACHE_TTL_MS) {
+      return this.cache.settings;
+    }
+    const settings = await this.prisma.systemSettings.findMany();
+    this.cache = { settings: new Map(settings.map(setting => [setting.key, setting])), loaded_at: Date.now() };
+    return this.cache.settings;
+  }
+
+  private present(setting: SettingRow) {
+    return {
+      id: setting.id,
+      key: setting.key,
+      value: this.isSecret(setting.key) && setting.value ? MASKED_VALUE : setting.value,
+      data_type: setting.data_type as SettingDataType,
+      category: setting.category,
+      description: setting.description || '',
+      is_public: setting.is_public,
+      updated_by: setting.updated_by || '',
+      updated_at: setting.updated_at.toISOString()
+    };
+  }
+
+  private parse(setting: SettingRow): unknown {
+    switch (setting.data_type) {
+      case 'number':
+        return Number(setting.value);
+      case 'boolean':
+        return setting.value === 'true';
+      case 'json':
+        try {
+          return JSON.parse(setting.value);
+        } catch {
+          return null;
+        }
+      default:
+        return setting.value;
+    }
+  }
+
+  private isSecret(key: string) {
+    return SECRET_KEY_PATTERN.test(key);
+  }
+
   /**
    * Validate value based on data type
    */
-  private validateValue(value: string, dataType: 'string' | 'number' | 'boolean' | 'json'): string {
+  private validateValue(value: string, dataType: SettingDataType): string {
     switch (dataType) {
       case 'number':
         if (isNaN(Number(value))) {
@@ -406,3 +546,4 @@ export class SystemSettingsService {
   }
 }
 
+export const systemSettingsService = new SystemSettingsService();
@@ -0,0 +1,379 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export interface LocationInput {
+  latitude: number;
+  longitude: number;
+  accuracy?: number;
+  recorded_at?: string;
+}
+
+export interface CheckInRequest {
+  location: LocationInput;
+  reason?: string;
+}
+
+export interface CheckOutRequest extends CheckInRequest {
+  complete?: boolean;
+  completion_notes?: string;
+}
+
+type LocationEventType = 'check_in' | 'check_out' | 'update';
+
+export const DEFAULT_GEOFENCE_METERS = 200;
+// Phones report accuracy in metres; give the benefit of the doubt up to this much
+const MAX_ACCURACY_ALLOWANCE = 100;
+// Gaps longer than this between two visits are not counted as travel
+const MAX_TRAVEL_MINUTES = 4 * 60;
+// Check-ins and check-outs go by server time; a device clock may differ from it by this much
+const MAX_VISIT_CLOCK_SKEW_MS = 5 * 60 * 1000;
+// Location updates from an offline device may sync up to this late
+const MAX_UPDATE_DELAY_MS = 24 * 60 * 60 * 1000;
+const MANAGER_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+
+export const distanceInMeters = (lat1: number, lon1: number, lat2: number, lon2: number): number => {
+  const toRad = (deg: number) => (deg * Math.PI) / 180;
+  const dLat = toRad(lat2 - lat1);
+  const dLon = toRad(lon2 - lon1);
+  const a = Math.sin(dLat / 2) ** 2 + Math.cos(toRad(lat1)) * Math.cos(toRad(lat2)) * Math.sin(dLon / 2) ** 2;
+  return 6371000 * 2 * Math.atan2(Math.sqrt(a), Math.sqrt(1 - a));
+};
+
+/**
+ * Check-in/out events for caretaker tasks, validated against the property's geofence
+ * (latitude/longitude plus geofence_radius_meters). Properties without coordinates
+ * are not validated.
+ */
+export class TaskLocationService {
+  private prisma = getPrisma();
+
+  async checkIn(taskId: string, req: CheckInRequest, user: JWTClaims) {
+    const task = await this.findAssignedTask(taskId, user);
+    if (['completed', 'cancelled'].includes(task.status)) {
+      throw new Error(`task is already ${task.status}`);
+    }
+    const last = await this.lastVisitEvent(task.id);
+    if (last?.event_type === 'check_in') {
+      throw new Error('already checked in to this task');
+    }
+
+    const event = await this.recordEvent(task, 'check_in', req.location, user, req.reason);
+    const updated = await this.prisma.task.update({
+      where: { id: task.id },
+      data: {
+        ...(task.status !== 'in_progress' && { status: 'in_progress' as const }),
+        ...(!task.started_at && { started_at: event.recorded_at }),
+        updated_at: new Date(),
+      },
+    });
+    return { task: updated, event };
+  }
+
+  async checkOut(taskId: string, req: CheckOutRequest, user: JWTClaims) {
+    const task = await this.findAssignedTask(taskId, user);
+    const last = await this.lastVisitEvent(task.id);
+    if (last?.event_type !== 'check_in') {
+      throw new Error('check-in is required before checking out');
+    }
+
+    const event = await this.recordEvent(task, 'check_out', req.location, user, req.reason);
+    const events = await this.prisma.taskLocationEvent.findMany({
+      where: { task_id: task.id, event_type: { in: ['check_in', 'check_out'] } },
+      orderBy: { recorded_at: 'asc' },
+    });
+    const workingMinutes = this.workingMinutes(events);
+    const updated = await this.prisma.task.update({
+      where: { id: task.id },
+      data: {
+        actual_hours: Math.round((workingMinutes / 60) * 100) / 100,
+        ...(req.complete && {
+          status: 'completed' as const,
+          completed_at: event.recorded_at,
+          ...(req.completion_notes && { completion_notes: req.completion_notes }),
+        }),
+        updated_at: new Date(),
+      },
+    });
+    return { task: updated, event, working_minutes: workingMinutes };
+  }
+
+  /**
+   * Location attached to a regular task update; never rejected, only flagged when far away
+   */
+  async recordUpdateLocation(taskId: string, location: LocationInput, user: JWTClaims) {
+    const task = await this.prisma.task.findUnique({ where: { id: taskId } });
+    if (!task) return null;
+    return this.recordEvent(task, 'update', location, user, undefined, false);
+  }
+
+  async getTaskLocationEvents(taskId: string, user: JWTClaims) {
+    const task = await this.prisma.task.findFirst({
+      where: {
+        id: taskId,
+        company_id: user.company_id!,
+        ...(!MANAGER_ROLES.includes(user.role) && { assigned_to: user.user_id }),
+      },
+      select: { id: true },
+    });
+    if (!task) {
+      throw new Error('task not found');
+    }
+    const events = await this.prisma.taskLocationEvent.findMany({
+      where: { task_id: taskId },
+      orderBy: { recorded_at: 'asc' },
+    });
+    const visits = events.filter(event => event.event_type !== 'update');
+    return {
+      events,
+      checked_in: visits[visits.length - 1]?.event_type === 'check_in',
+      working_minutes: this.workingMinutes(visits),
+      flagged_events: events.filter(event => event.flagged).length,
+    };
+  }
+
+  /**
+   * Working time (check-in to check-out) and travel time (check-out to the next task's
+   * check-in on the same day) for one staff member
+   */
+  async getTimeSummary(query: { user_id?: string; from?: string; to?: string }, user: JWTClaims) {
+    const userId = query.user_id || user.user_id;
+    if (userId !== user.user_id && !MANAGER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view other staff time summaries');
+    }
+    const to = query.to ? new Date(query.to) : new Date();
+    const from = query.from ? new Date(query.from) : new Date(to.getTime() - 7 * 24 * 60 * 60 * 1000);
+    if (isNaN(from.getTime()) || isNaN(to.getTime())) {
+      throw new Error('from and to must be valid dates');
+    }
+
+    const events = await this.prisma.taskLocationEvent.findMany({
+      where: { user_id: userId, company_id: user.company_id!, recorded_at: { gte: from, lte: to } },
+      orderBy: { recorded_at: 'asc' },
+    });
+
+    const days = new Map<string, { date: string; working_minutes: number; travel_minutes: number; visits: number; flagged_events: number }>();
+    const dayOf = (date: Date) => {
+      const key = date.toISOString().slice(0, 10);
+      if (!days.has(key)) days.set(key, { date: key, working_minutes: 0, travel_minutes: 0, visits: 0, flagged_events: 0 });
+      return days.get(key)!;
+    };
+
+    const open = new Map<string, Date>();
+    let lastCheckOut: { task_id: string; at: Date } | null = null;
+    for (const event of events) {
+      const day = dayOf(event.recorded_at);
+      if (event.flagged) day.flagged_events++;
+      if (event.event_type === 'check_in') {
+        day.visits++;
+        open.set(event.task_id, event.recorded_at);
+        if (lastCheckOut && lastCheckOut.task_id !== event.task_id
+          && lastCheckOut.at.toISOString().slice(0, 10) === day.date) {
+          const gap = (event.recorded_at.getTime() - lastCheckOut.at.getTime()) / 60000;
+          if (gap <= MAX_TRAVEL_MINUTES) day.travel_minutes += Math.round(gap);
+        }
+      } else if (event.event_type === 'check_out') {
+        const start = open.get(event.task_id);
+        if (start) {
+          day.working_minutes += Math.round((event.recorded_at.getTime() - start.getTime()) / 60000);
+          open.delete(event.task_id);
+        }
+        lastCheckOut = { task_id: event.task_id, at: event.recorded_at };
+      }
+    }
+
+    const daily = [...days.values()];
+    return {
+      user_id: userId,
+      from,
+      to,
+      working_minutes: daily.reduce((sum, day) => sum + day.working_minutes, 0),
+      travel_minutes: daily.reduce((sum, day) => sum + day.travel_minutes, 0),
+      visits: daily.reduce((sum, day) => sum + day.visits, 0),
+      flagged_events: daily.reduce((sum, day) => sum + day.flagged_events, 0),
+      open_check_ins: [...open.keys()],
+      days: daily,
+    };
+  }
+
+  /**
+   * Events recorded outside the property geofence, for managers to review
+   */
+  async getFlaggedEvents(query: { user_id?: string; property_id?: string; from?: string; limit?: string }, user: JWTClaims) {
+    if (!MANAGER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view location flags');
+    }
+    const from = query.from ? new Date(query.from) : undefined;
+    return this.prisma.taskLocationEvent.findMany({
+      where: {
+        company_id: user.company_id!,
+        flagged: true,
+        ...(query.user_id && { user_id: query.user_id }),
+        ...(query.property_id && { task: { property_id: query.property_id } }),
+        ...(from && !isNaN(from.getTime()) && { recorded_at: { gte: from } }),
+      },
+      include: {
+        task: {
+          select: {
+            id: true,
+            title: true,
+            status: true,
+            assignedTo: { select: { id: true, first_name: true, last_name: true } },
+            property: { select: { id: true, name: true } },
+          },
+        },
+      },
+      orderBy: { recorded_at: 'desc' },
+      take: Math.min(parseInt(query.limit || '50', 10) || 50, 200),
+    });
+  }
+
+  private async findAssignedTask(taskId: string, user: JWTClaims) {
+    const task = await this.prisma.task.findFirst({ where: { id: taskId, company_id: user.company_id! } });
+    if (!task) {
+      throw new Error('task not found');
+    }
+    if (task.assigned_to !== user.user_id) {
+      throw new Error('insufficient permissions: only the assigned staff member can check in or out');
+    }
+    return task;
+  }
+
+  private lastVisitEvent(taskId: string) {
+    return this.prisma.taskLocationEvent.findFirst({
+      where: { task_id: taskId, event_type: { in: ['check_in', 'check_out'] } },
+      orderBy: { recorded_at: 'desc' },
+    });
+  }
+
+  private async recordEvent(
+    task: { id: string; company_id: string; property_id: string | null; assigned_by: string; title: string },
+    type: LocationEventType,
+    location: LocationInput | undefined,
+    user: JWTClaims,
+    reason?: string,
+    enforce: boolean = true
+  ) {
+    const latitude = Number(location?.latitude);
+    const longitude = Number(location?.longitude);
+    if (!location || isNaN(latitude) || isNaN(longitude) || Math.abs(latitude) > 90 || Math.abs(longitude) > 180) {
+      throw new Error('a valid location (latitude and longitude) is required');
+    }
+    const recordedAt = await this.recordedAt(task.id, type, location.recorded_at);
+
+    let distance: number | null = null;
+    let withinGeofence: boolean | null = null;
+    let radius = DEFAULT_GEOFENCE_METERS;
+    if (task.property_id) {
+      const property = await this.prisma.property.findUnique({
+        where: { id: task.property_id },
+        select: { latitude: true, longitude: true, geofence_radius_meters: true },
+      });
+      if (property?.latitude != null && property?.longitude != null) {
+        radius = property.geofence_radius_meters || DEFAULT_GEOFENCE_METERS;
+        distance = Math.round(distanceInMeters(latitude, longitude, Number(property.latitude), Number(property.longitude)));
+        const allowance = Math.min(Math.max(Number(location.accuracy) || 0, 0), MAX_ACCURACY_ALLOWANCE);
+        withinGeofence = distance - allowance <= radius;
+      }
+    }
+
+    const flagged = withinGeofence === false;
+    if (flagged && enforce && !reason?.trim()) {
+      throw new Error(`location is ${distance}m from the property (geofence ${radius}m); a reason is required to ${type === 'check_in' ? 'check in' : 'check out'} from here`);
+    }
+
+    const event = await this.prisma.taskLocationEvent.create({
+      data: {
+        task_id: task.id,
+        company_id: task.company_id,
+        user_id: user.user_id,
+        event_type: type,
+        latitude,
+        longitude,
+        accuracy_meters: location.accuracy != null ? Number(location.accuracy) : null,
+        distance_meters: distance,
+        within_geofence: withinGeofence,
+        flagged,
+        reason: reason?.trim() || null,
+        recorded_at: recordedAt,
+      },
+    });
+
+    if (flagged) {
+      await this.prisma.task.update({ where: { id: task.id }, data: { location_flagged: true } });
+      if (task.assigned_by !== user.user_id) {
+        await this.notifyFlag(task, type, distance!, reason);
+      }
+    }
+    return event;
+  }
+
+  /**
+   * When the event happened. Check-ins and check-outs count towards time on site, so they may
+   * only differ from server time by clock skew and must come after the task's last visit event;
+   * plain location updates may arrive late from an offline device.
+   */
+  private async recordedAt(taskId: string, type: LocationEventType, value?: string): Promise<Date> {
+    const now = Date.now();
+    const date = value ? new Date(value) : new Date(now);
+    if (isNaN(date.getTime())) {
+      throw new Error('recorded_at must be a valid date');
+    }
+    if (type === 'update') {
+      if (date.getTime() > now + MAX_VISIT_CLOCK_SKEW_MS || date.getTime() < now - MAX_UPDATE_DELAY_MS) {
+        throw new Error('recorded_at must be within the last 24 hours');
+      }
+      return date;
+    }
+
+    if (Math.abs(date.getTime() - now) > MAX_VISIT_CLOCK_SKEW_MS) {
+      throw new Error(`recorded_at must be within ${MAX_VISIT_CLOCK_SKEW_MS / 60000} minutes of the current time to ${type === 'check_in' ? 'check in' : 'check out'}`);
+    }
+    const last = await this.lastVisitEvent(taskId);
+    if (last && date <= last.recorded_at) {
+      throw new Error(`recorded_at must be after the task's last ${last.event_type === 'check_in' ? 'check-in' : 'check-out'}`);
+    }
+    return date;
+  }
+
+  private workingMinutes(events: { event_type: string; recorded_at: Date }[]): number {
+    let minutes = 0;
+    let start: Date | null = null;
+    for (const event of events) {
+      if (event.event_type === 'check_in') {
+        start = event.recorded_at;
+      } else if (event.event_type === 'check_out' && start) {
+        minutes += (event.recorded_at.getTime() - start.getTime()) / 60000;
+        start = null;
+      }
+    }
+    return Math.round(minutes);
+  }
+
+  private async notifyFlag(
+    task: { id: string; company_id: string; property_id: string | null; assigned_by: string; title: string },
+    type: LocationEventType,
+    distance: number,
+    reason?: string
+  ) {
+    const action = type === 'check_in' ? 'Check-in' : type === 'check_out' ? 'Check-out' : 'Task update';
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.notify({
+        company_id: task.company_id,
+        recipient_id: task.assigned_by,
+        title: `${action} away from the property`,
+        message: `${action} for "${task.title}" was recorded ${distance}m from the property${reason ? `: ${reason}` : ''}.`,
+        notification_type: 'task',
+        category: 'task',
+        priority: 'high',
+        property_id: task.property_id,
+        related_entity_type: 'task',
+        related_entity_id: task.id,
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to send location flag notification:', error.message);
+    }
+  }
+}
+
+export const taskLocationService = new TaskLocationService();
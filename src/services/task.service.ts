@@ -1,5 +1,6 @@
 import { buildWhereClause } from '../utils/roleBasedFiltering.js';
 import { getPrisma } from '../config/prisma.js';
+import { taskLocationService, LocationInput } from './task-location.service.js';
 
 const prisma = getPrisma();
 
@@ -30,6 +31,7 @@ export interface UpdateTaskDto {
   completion_notes?: string;
   started_at?: string;
   completed_at?: string;
+  location?: LocationInput;
 }
 
 /**
@@ -95,6 +97,21 @@ export const createTask = async (
       },
     });
 
+    // Urgent work goes out to everyone covering the property, not just the assignee
+    if (task.priority === 'urgent' && task.property) {
+      const { pushNotificationService } = await import('./push-notification.service.js');
+      await pushNotificationService.sendToProperty(task.property.id, {
+        title: `Urgent task at ${task.property.name}`,
+        body: `${task.title}${task.unit ? ` (Unit ${task.unit.unit_number})` : ''}`,
+        notificationType: 'task',
+        category: 'task',
+        priority: 'high',
+        data: { task_id: task.id, property_id: task.property.id },
+        actionUrl: `/tasks/${task.id}`,
+        tag: `task-${task.id}`,
+      });
+    }
+
     return task;
   } catch (error) {
     console.error('Error creating task:', error);
@@ -316,8 +333,9 @@ export const updateTask = async (
     }
 
     // Prepare update data
+    const { location, ...fields } = updateData;
     const updatePayload: any = {
-      ...updateData,
+      ...fields,
       updated_at: new Date(),
     };
 
@@ -384,6 +402,15 @@ export const updateTask = async (
       },
     });
 
+    // Updates submitted from the field carry the device location; far-away ones get flagged
+    if (location) {
+      try {
+        await taskLocationService.recordUpdateLocation(taskId, location, userClaims as any);
+      } catch (locationError: any) {
+        console.error('⚠️ Failed to record task update location:', locationError.message);
+      }
+    }
+
     return updatedTask;
   } catch (error) {
     console.error('Error updating task:', error);
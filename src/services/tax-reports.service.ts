@@ -0,0 +1,285 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildWhereClause, formatDataForRole } from '../utils/roleBasedFiltering.js';
+
+// Monthly Rental Income tax on residential rent: 7.5% of gross rent from December 2023 (Finance Act 2023), 10% before
+const MRI_RATE = 0.075;
+const MRI_PREVIOUS_RATE = 0.1;
+const MRI_RATE_CHANGE = new Date(2023, 11, 1);
+// Residential landlords whose annual gross rent falls in this range are on MRI; the rest file an annual return
+const MRI_MIN_ANNUAL_RENT = 288000;
+const MRI_MAX_ANNUAL_RENT = 15000000;
+// MRI for a month is filed and paid by the 20th of the next month
+const MRI_DUE_DAY = 20;
+
+interface TaxSummaryFilters {
+  year?: number;
+  month?: number;
+  owner_id?: string;
+  property_ids?: string[];
+}
+
+interface LandlordTotals {
+  owner_id: string;
+  landlord_name: string;
+  email: string | null;
+  tax_pin: string | null;
+  residential_rent: number;
+  commercial_rent: number;
+  other_income: number;
+  allowable_expenses: number;
+  withholding_credits: number;
+  mri_tax: number;
+  months: Map<string, { residential_rent: number; withholding_credits: number; mri_tax: number }>;
+  expenses: Map<string, number>;
+}
+
+const round = (n: number) => Math.round(n * 100) / 100;
+const monthKey = (date: Date) => `${date.getFullYear()}-${String(date.getMonth() + 1).padStart(2, '0')}`;
+const mriRate = (date: Date) => (date < MRI_RATE_CHANGE ? MRI_PREVIOUS_RATE : MRI_RATE);
+
+/**
+ * Rental income tax summaries per landlord for KRA filings: gross rent (residential rent under
+ * Monthly Rental Income tax, other rent under the annual return), allowable expenses, and
+ * withholding tax tenants deducted and remitted, which is credited against the tax due.
+ * Rent is counted when received; a payment's gross is what was received plus what was withheld.
+ */
+export class TaxReportsService {
+  private prisma = getPrisma();
+
+  async getTaxSummary(user: JWTClaims, filters: TaxSummaryFilters = {}) {
+    const year = Number(filters.year) || new Date().getFullYear();
+    const month = filters.month !== undefined && filters.month !== null && String(filters.month) !== '' ? Number(filters.month) : undefined;
+    if (!Number.isInteger(year) || year < 2000 || year > 2100) {
+      throw new Error('year must be a valid year');
+    }
+    if (month !== undefined && (!Number.isInteger(month) || month < 1 || month > 12)) {
+      throw new Error('month must be between 1 and 12');
+    }
+    const start = new Date(year, month ? month - 1 : 0, 1);
+    const end = new Date(year, month ? month : 12, 1, 0, 0, 0, -1);
+    const monthsInPeriod = month ? 1 : 12;
+
+    // Landlords only see their own figures
+    const ownerId = user.role === 'landlord' ? user.user_id : filters.owner_id;
+    const propertyWhere: any = {
+      ...buildWhereClause(user),
+      ...(ownerId && { owner_id: ownerId }),
+      ...(filters.property_ids?.length && { id: { in: filters.property_ids } }),
+    };
+    const properties = await this.prisma.property.findMany({
+      where: propertyWhere,
+      select: {
+        id: true,
+        name: true,
+        type: true,
+        owner: { select: { id: true, first_name: true, last_name: true, email: true, role: true, company: { select: { tax_id: true } } } },
+      },
+    });
+    const propertyIds = properties.map(p => p.id);
+    const propertiesById = new Map(properties.map(p => [p.id, p]));
+
+    const [payments, expenses] = await Promise.all([
+      this.prisma.payment.findMany({
+        where: {
+          status: { in: ['completed', 'approved'] },
+          payment_type: { not: 'security_deposit' },
+          payment_date: { gte: start, lte: end },
+          OR: [{ property_id: { in: propertyIds } }, { property_id: null, unit: { property_id: { in: propertyIds } } }],
+        },
+        select: {
+          amount: true,
+          withholding_tax: true,
+          withholding_certificate: true,
+          payment_type: true,
+          payment_date: true,
+          receipt_number: true,
+          property_id: true,
+          unit: { select: { property_id: true } },
+          tenant: { select: { first_name: true, last_name: true } },
+        },
+        orderBy: { payment_date: 'asc' },
+      }),
+      this.prisma.expense.findMany({
+        where: { property_id: { in: propertyIds }, expense_date: { gte: start, lte: end } },
+        select: { amount: true, category: true, property_id: true },
+      }),
+    ]);
+
+    const landlords = new Map<string, LandlordTotals>();
+    const byProperty = new Map<string, { gross_rent: number; expenses: number; withholding_credits: number }>();
+    const landlordFor = (propertyId: string) => {
+      const { owner } = propertiesById.get(propertyId)!;
+      if (!landlords.has(owner.id)) {
+        landlords.set(owner.id, {
+          owner_id: owner.id,
+          landlord_name: `${owner.first_name} ${owner.last_name}`.trim(),
+          email: owner.email,
+          // A landlord's account company carries their PIN
+          tax_pin: owner.role === 'landlord' ? owner.company?.tax_id || null : null,
+          residential_rent: 0,
+          commercial_rent: 0,
+          other_income: 0,
+          allowable_expenses: 0,
+          withholding_credits: 0,
+          mri_tax: 0,
+          months: new Map(),
+          expenses: new Map(),
+        });
+      }
+      return landlords.get(owner.id)!;
+    };
+    const propertyTotals = (propertyId: string) => {
+      if (!byProperty.has(propertyId)) byProperty.set(propertyId, { gross_rent: 0, expenses: 0, withholding_credits: 0 });
+      return byProperty.get(propertyId)!;
+    };
+
+    const withholding: any[] = [];
+    for (const payment of payments) {
+      const propertyId = payment.property_id || payment.unit?.property_id;
+      if (!propertyId || !propertiesById.has(propertyId)) continue;
+      const property = propertiesById.get(propertyId)!;
+      const landlord = landlordFor(propertyId);
+      const withheld = Number(payment.withholding_tax || 0);
+      const gross = Number(payment.amount) + withheld;
+
+      if (payment.payment_type !== 'rent') {
+        landlord.other_income += gross;
+        continue;
+      }
+      const totals = propertyTotals(propertyId);
+      totals.gross_rent += gross;
+      totals.withholding_credits += withheld;
+      landlord.withholding_credits += withheld;
+      if (property.type === 'residential') {
+        landlord.residential_rent += gross;
+        const key = monthKey(payment.payment_date);
+        const monthTotals = landlord.months.get(key) || { residential_rent: 0, withholding_credits: 0, mri_tax: 0 };
+        monthTotals.residential_rent += gross;
+        monthTotals.withholding_credits += withheld;
+        monthTotals.mri_tax += gross * mriRate(payment.payment_date);
+        landlord.months.set(key, monthTotals);
+      } else {
+        landlord.commercial_rent += gross;
+      }
+      if (withheld > 0) {
+        withholding.push({
+          landlord_name: landlord.landlord_name,
+          payment_date: payment.payment_date.toISOString().split('T')[0],
+          receipt_number: payment.receipt_number,
+          tenant_name: payment.tenant ? `${payment.tenant.first_name} ${payment.tenant.last_name}`.trim() : '',
+          property_name: property.name,
+          gross_rent: round(gross),
+          withheld: round(withheld),
+          certificate: payment.withholding_certificate || '',
+        });
+      }
+    }
+
+    for (const expense of expenses) {
+      if (!expense.property_id) continue;
+      const landlord = landlordFor(expense.property_id);
+      const amount = Number(expense.amount);
+      landlord.allowable_expenses += amount;
+      landlord.expenses.set(expense.category, (landlord.expenses.get(expense.category) || 0) + amount);
+      propertyTotals(expense.property_id).expenses += amount;
+    }
+
+    const rows = [...landlords.values()].map(landlord => {
+      const annualisedRent = (landlord.residential_rent * 12) / monthsInPeriod;
+      const mriEligible = annualisedRent > MRI_MIN_ANNUAL_RENT && annualisedRent <= MRI_MAX_ANNUAL_RENT;
+      const mriTax = mriEligible ? [...landlord.months.values()].reduce((sum, m) => sum + m.mri_tax, 0) : 0;
+      const grossRent = landlord.residential_rent + landlord.commercial_rent;
+      return {
+        ...landlord,
+        gross_rent: grossRent,
+        mri_eligible: mriEligible,
+        mri_tax: mriTax,
+        // MRI is a final tax on gross rent: expenses only reduce rent filed under the annual return
+        annual_return_rent: mriEligible ? landlord.commercial_rent : grossRent,
+      };
+    }).sort((a, b) => a.landlord_name.localeCompare(b.landlord_name));
+
+    const landlordRows = rows.map(l => {
+      const deductible = round(l.allowable_expenses);
+      return {
+        owner_id: l.owner_id,
+        landlord_name: l.landlord_name,
+        email: l.email,
+        tax_pin: l.tax_pin,
+        gross_rent: round(l.gross_rent),
+        residential_rent: round(l.residential_rent),
+        commercial_rent: round(l.commercial_rent),
+        other_income: round(l.other_income),
+        mri_eligible: l.mri_eligible,
+        mri_tax: round(l.mri_tax),
+        annual_return_rent: round(l.annual_return_rent),
+        allowable_expenses: deductible,
+        net_rental_income: round(l.annual_return_rent - deductible),
+        withholding_credits: round(l.withholding_credits),
+        tax_payable: l.mri_eligible ? round(Math.max(0, l.mri_tax - l.withholding_credits)) : null,
+      };
+    });
+    const sum = (key: keyof (typeof landlordRows)[number]) => round(landlordRows.reduce((total, row) => total + (Number(row[key]) || 0), 0));
+
+    return formatDataForRole(user, {
+      period: {
+        year,
+        month: month || null,
+        label: month ? start.toLocaleString('en-GB', { month: 'long', year: 'numeric' }) : String(year),
+        start_date: start.toISOString(),
+        end_date: end.toISOString(),
+      },
+      rates: {
+        mri_rate: round(mriRate(end) * 100),
+        mri_min_annual_rent: MRI_MIN_ANNUAL_RENT,
+        mri_max_annual_rent: MRI_MAX_ANNUAL_RENT,
+      },
+      summary: {
+        landlords: landlordRows.length,
+        grossRent: sum('gross_rent'),
+        residentialRent: sum('residential_rent'),
+        commercialRent: sum('commercial_rent'),
+        otherIncome: sum('other_income'),
+        mriTax: sum('mri_tax'),
+        allowableExpenses: sum('allowable_expenses'),
+        netRentalIncome: sum('net_rental_income'),
+        withholdingCredits: sum('withholding_credits'),
+        taxPayable: sum('tax_payable'),
+      },
+      landlords: landlordRows,
+      // One line per landlord and month, as filed on iTax
+      months: rows.filter(l => l.mri_eligible).flatMap(l => [...l.months.entries()].sort(([a], [b]) => a.localeCompare(b)).map(([key, m]) => {
+        const [y, mo] = key.split('-').map(Number);
+        return {
+          landlord_name: l.landlord_name,
+          tax_pin: l.tax_pin,
+          month: key,
+          residential_rent: round(m.residential_rent),
+          mri_tax: round(m.mri_tax),
+          withholding_credits: round(m.withholding_credits),
+          tax_payable: round(Math.max(0, m.mri_tax - m.withholding_credits)),
+          due_date: new Date(y, mo, MRI_DUE_DAY).toISOString().split('T')[0],
+        };
+      })),
+      expenses: rows.flatMap(l => [...l.expenses.entries()]
+        .sort(([, a], [, b]) => b - a)
+        .map(([category, amount]) => ({ landlord_name: l.landlord_name, category, amount: round(amount) }))),
+      properties: [...byProperty.entries()].map(([propertyId, totals]) => {
+        const property = propertiesById.get(propertyId)!;
+        return {
+          landlord_name: landlords.get(property.owner.id)!.landlord_name,
+          property_name: property.name,
+          property_type: property.type,
+          gross_rent: round(totals.gross_rent),
+          expenses: round(totals.expenses),
+          withholding_credits: round(totals.withholding_credits),
+        };
+      }).sort((a, b) => a.landlord_name.localeCompare(b.landlord_name) || a.property_name.localeCompare(b.property_name)),
+      withholding,
+      generatedAt: new Date().toISOString(),
+    });
+  }
+}
+
+export const taxReportsService = new TaxReportsService();
@@ -0,0 +1,235 @@
+import { getPrisma } from '../config/prisma.js';
+import { supabaseRealtimeService } from './supabase-realtime.service.js';
+
+const leaseInclude = {
+  tenant: { select: { id: true, first_name: true, last_name: true } },
+  unit: { select: { id: true, unit_number: true } },
+  property: { select: { id: true, name: true, owner_id: true } },
+  conversation: { select: { id: true, archived_at: true } },
+} as const;
+
+/**
+ * One group conversation per tenancy: the tenant, the landlord, agents and the assigned caretaker
+ * of the unit's property. Opened when the lease starts, archived (read-only) on move-out.
+ * Short stays are excluded; guests keep using direct messages.
+ */
+export class TenancyChatsService {
+  private prisma = getPrisma();
+
+  /**
+   * Landlord first (conversation admin), then assigned agents and caretakers; a primary caretaker
+   * assignment wins over other caretakers on the property
+   */
+  private async staffFor(propertyId: string, ownerId: string) {
+    const assignments = await this.prisma.staffPropertyAssignment.findMany({
+      where: { property_id: propertyId, status: 'active', staff: { role: { in: ['agent', 'caretaker'] }, status: 'active' } },
+      select: { staff_id: true, is_primary: true, staff: { select: { role: true } } },
+    });
+    const agents = assignments.filter(a => a.staff.role === 'agent').map(a => a.staff_id);
+    const caretakers = assignments.filter(a => a.staff.role === 'caretaker');
+    const primaryCaretakers = caretakers.filter(a => a.is_primary);
+    return [
+      ownerId,
+      ...agents,
+      ...(primaryCaretakers.length ? primaryCaretakers : caretakers).map(a => a.staff_id),
+    ];
+  }
+
+  private async postSystemMessage(conversationId: string, companyId: string, senderId: string, event: string, content: string, data: Record<string, any> = {}) {
+    const message = await this.prisma.message.create({
+      data: {
+        company_id: companyId,
+        conversation_id: conversationId,
+        sender_id: senderId,
+        content,
+        message_type: 'system',
+        status: 'sent',
+        sent_at: new Date(),
+        metadata: { event, ...data },
+      },
+    });
+    const participants = await this.prisma.conversationParticipant.findMany({
+      where: { conversation_id: conversationId },
+      select: { user_id: true },
+    });
+    try {
+      await supabaseRealtimeService.publishConversationUpdate(conversationId, participants.map(p => p.user_id), { event, message, ...data });
+    } catch (error) {
+      console.debug('Error publishing tenancy chat event:', error);
+    }
+    return message;
+  }
+
+  /**
+   * Create the tenancy chat for a lease that has started, or bring an existing one's members up to date.
+   * Returns null for leases that are not (yet) running.
+   */
+  async openForLease(leaseId: string) {
+    const lease = await this.prisma.lease.findUnique({ where: { id: leaseId }, include: leaseInclude });
+    if (!lease || lease.lease_type === 'short_stay' || lease.status !== 'active') {
+      return null;
+    }
+
+    // A renewal carries on the previous lease's chat rather than starting a second one
+    let existing: { id: string; archived_at: Date | null } | null = lease.conversation;
+    if (!existing && lease.parent_lease_id) {
+      const inherited = await this.prisma.conversation.findUnique({
+        where: { lease_id: lease.parent_lease_id },
+        select: { id: true, archived_at: true },
+      });
+      if (inherited && !inherited.archived_at) {
+        existing = await this.prisma.conversation.update({
+          where: { id: inherited.id },
+          data: { lease_id: lease.id, updated_at: new Date() },
+          select: { id: true, archived_at: true },
+        });
+      }
+    }
+    if (!existing && lease.start_date > new Date()) {
+      return null;
+    }
+
+    const members = [...new Set([lease.tenant_id, ...(await this.staffFor(lease.property_id, lease.property.owner_id))])];
+
+    if (existing) {
+      if (existing.archived_at) return existing;
+      const current = await this.prisma.conversationParticipant.findMany({
+        where: { conversation_id: existing.id },
+        select: { user_id: true },
+      });
+      const known = new Set(current.map(p => p.user_id));
+      const added = members.filter(id => !known.has(id));
+      if (added.length) {
+        await this.prisma.conversationParticipant.createMany({
+          data: added.map(userId => ({ conversation_id: existing!.id, user_id: userId, role: 'participant' })),
+          skipDuplicates: true,
+        });
+        await this.prisma.$executeRaw`
+          INSERT INTO conversation_metadata (conversation_id, user_id, unread_count, updated_at)
+          SELECT ${existing.id}::uuid, user_id, 0, NOW()
+          FROM unnest(${added}::uuid[]) AS user_id
+          ON CONFLICT (conversation_id, user_id) DO NOTHING
+        `;
+      }
+      return existing;
+    }
+
+    const conversation = await this.prisma.conversation.create({
+      data: {
+        company_id: lease.company_id,
+        subject: `${lease.property.name} · Unit ${lease.unit.unit_number}`,
+        type: 'tenancy',
+        created_by: lease.property.owner_id,
+        lease_id: lease.id,
+      },
+    });
+    await this.prisma.conversationParticipant.createMany({
+      data: members.map(userId => ({
+        conversation_id: conversation.id,
+        user_id: userId,
+        role: userId === lease.property.owner_id ? 'admin' : 'participant',
+      })),
+      skipDuplicates: true,
+    });
+    await this.prisma.$executeRaw`
+      INSERT INTO conversation_metadata (conversation_id, user_id, unread_count, updated_at)
+      SELECT ${conversation.id}::uuid, user_id, 0, NOW()
+      FROM unnest(${members}::uuid[]) AS user_id
+      ON CONFLICT (conversation_id, user_id) DO NOTHING
+    `;
+
+    const tenantName = `${lease.tenant.first_name} ${lease.tenant.last_name}`.trim();
+    await this.postSystemMessage(
+      conversation.id,
+      lease.company_id,
+      lease.property.owner_id,
+      'tenancy_opened',
+      `Tenancy chat for Unit ${lease.unit.unit_number} at ${lease.property.name}. ${tenantName}, your landlord and property staff can all reach each other here.`,
+      { lease_id: lease.id, unit_id: lease.unit_id }
+    );
+    console.log(`💬 Opened tenancy chat ${conversation.id} for lease ${lease.lease_number}`);
+    return conversation;
+  }
+
+  /**
+   * Archive the tenancy chat once the lease has ended; history stays readable but nobody can post
+   */
+  async archiveForLease(leaseId: string) {
+    const conversation = await this.prisma.conversation.findUnique({
+      where: { lease_id: leaseId },
+      include: { lease: { select: { status: true, property: { select: { owner_id: true } } } } },
+    });
+    if (!conversation || conversation.archived_at || conversation.lease?.status === 'active') {
+      return null;
+    }
+
+    const now = new Date();
+    await this.prisma.conversation.update({ where: { id: conversation.id }, data: { archived_at: now, updated_at: now } });
+    await this.prisma.conversationParticipant.updateMany({
+      where: { conversation_id: conversation.id, archived_at: null },
+      data: { archived_at: now },
+    });
+    await this.postSystemMessage(
+      conversation.id,
+      conversation.company_id,
+      conversation.lease?.property.owner_id || conversation.created_by,
+      'tenancy_archived',
+      'The tenant has moved out. This chat is now archived and read-only.',
+      { lease_id: leaseId }
+    );
+    console.log(`📦 Archived tenancy chat ${conversation.id} for lease ${leaseId}`);
+    return conversation;
+  }
+
+  /**
+   * Archive the chats of a tenant's leases that are no longer active (move-out, transfer)
+   */
+  async archiveEndedForTenant(tenantId: string) {
+    const leases = await this.prisma.lease.findMany({
+      where: { tenant_id: tenantId, status: { not: 'active' }, conversation: { is: { archived_at: null } } },
+      select: { id: true },
+    });
+    for (const lease of leases) {
+      await this.archiveForLease(lease.id);
+    }
+    return leases.length;
+  }
+
+  /**
+   * Scheduler catch-up: open chats for leases whose start date has arrived and archive chats of
+   * leases that ended through any path
+   */
+  async sync() {
+    const [starting, ended] = await Promise.all([
+      this.prisma.lease.findMany({
+        where: { status: 'active', lease_type: { not: 'short_stay' }, start_date: { lte: new Date() }, conversation: { is: null } },
+        select: { id: true },
+        take: 500,
+      }),
+      this.prisma.conversation.findMany({
+        where: { type: 'tenancy', archived_at: null, lease: { is: { status: { not: 'active' } } } },
+        select: { lease_id: true },
+      }),
+    ]);
+
+    let opened = 0;
+    let archived = 0;
+    for (const lease of starting) {
+      try {
+        if (await this.openForLease(lease.id)) opened++;
+      } catch (error: any) {
+        console.error(`⚠️ Failed to open tenancy chat for lease ${lease.id}:`, error.message);
+      }
+    }
+    for (const conversation of ended) {
+      try {
+        if (await this.archiveForLease(conversation.lease_id!)) archived++;
+      } catch (error: any) {
+        console.error(`⚠️ Failed to archive tenancy chat for lease ${conversation.lease_id}:`, error.message);
+      }
+    }
+    return { opened, archived };
+  }
+}
+
+export const tenancyChatsService = new TenancyChatsService();
@@ -0,0 +1,229 @@
+import { Prisma } from '@prisma/client';
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { buildExcelWorkbook, sheetToCsv, summarySheet, ExcelSheet } from '../utils/excel-export.js';
+
+const EXPORT_PAGE_SIZE = 200;
+const EXPORT_MAX_ROWS = 20000;
+// Invoices still owed; anything past due among them is arrears
+const UNSETTLED_STATUSES = ['draft', 'sent', 'overdue'];
+const OPEN_FLAG_STATUSES = ['active', 'disputed'];
+
+const tenantSelect = {
+  id: true,
+  first_name: true,
+  last_name: true,
+  email: true,
+  phone_number: true,
+  status: true,
+  created_at: true,
+  last_login_at: true,
+  company: { select: { id: true, name: true } },
+  tenant_profile: {
+    select: {
+      rent_amount: true,
+      lease_start_date: true,
+      lease_end_date: true,
+      current_property: { select: { id: true, name: true, agency: { select: { id: true, name: true } } } },
+      current_unit: { select: { id: true, unit_number: true } },
+    },
+  },
+} satisfies Prisma.UserSelect;
+
+type DirectoryTenant = Prisma.UserGetPayload<{ select: typeof tenantSelect }>;
+
+export interface TenantDirectoryFilters {
+  agency_id?: string;
+  company_id?: string;
+  property_id?: string;
+  status?: string;
+  in_arrears?: boolean;
+  flagged?: boolean;
+  search?: string;
+  page?: number;
+  limit?: number;
+}
+
+/**
+ * Every tenant on the platform for the super admin: where they live, who manages them, what they
+ * owe and whether anyone has flagged them.
+ */
+export class TenantDirectoryService {
+  private prisma = getPrisma();
+
+  async list(user: JWTClaims, filters: TenantDirectoryFilters = {}) {
+    this.assertSuperAdmin(user);
+    const page = Math.max(1, filters.page || 1);
+    const limit = Math.min(100, Math.max(1, filters.limit || 25));
+    const where = await this.whereFor(filters);
+
+    const [tenants, total] = await Promise.all([
+      this.prisma.user.findMany({
+        where,
+        orderBy: { created_at: 'desc' },
+        skip: (page - 1) * limit,
+        take: limit,
+        select: tenantSelect,
+      }),
+      this.prisma.user.count({ where }),
+    ]);
+
+    return {
+      tenants: await this.present(tenants),
+      pagination: { page, limit, total, total_pages: Math.ceil(total / limit) },
+    };
+  }
+
+  /**
+   * The directory as CSV, or as an Excel workbook with a summary sheet, for the same filters
+   */
+  async export(user: JWTClaims, filters: TenantDirectoryFilters, format: string): Promise<string | Buffer> {
+    this.assertSuperAdmin(user);
+    if (!['csv', 'xlsx', 'excel'].includes(format)) {
+      throw new Error('format must be csv or xlsx');
+    }
+    const where = await this.whereFor(filters);
+
+    const tenants: Awaited<ReturnType<TenantDirectoryService['present']>> = [];
+    for (let skip = 0; skip < EXPORT_MAX_ROWS; skip += EXPORT_PAGE_SIZE) {
+      const batch = await this.prisma.user.findMany({
+        where,
+        orderBy: { created_at: 'desc' },
+        skip,
+        take: EXPORT_PAGE_SIZE,
+        select: tenantSelect,
+      });
+      tenants.push(...(await this.present(batch)));
+      if (batch.length < EXPORT_PAGE_SIZE) break;
+    }
+
+    const details: ExcelSheet = {
+      name: 'Tenants',
+      columns: [
+        'Name', 'Email', 'Phone', 'Status', 'Company', 'Agency', 'Property', 'Unit',
+        { header: 'Rent', type: 'currency' }, { header: 'Lease End', type: 'date' },
+        { header: 'Outstanding', type: 'currency' }, { header: 'Arrears', type: 'currency' },
+        { header: 'Open Flags', type: 'integer' }, { header: 'Joined', type: 'date' },
+      ],
+      rows: tenants.map(t => [
+        t.name,
+        t.email || '',
+        t.phone_number || '',
+        t.status,
+        t.company?.name || '',
+        t.agency?.name || '',
+        t.property?.name || '',
+        t.unit?.unit_number || '',
+        t.rent_amount,
+        t.lease_end_date,
+        t.outstanding_balance,
+        t.arrears,
+        t.open_flags,
+        t.created_at,
+      ]),
+    };
+    if (format === 'csv') {
+      return sheetToCsv(details);
+    }
+
+    const sum = (values: number[]) => Math.round(values.reduce((total, value) => total + value, 0) * 100) / 100;
+    return buildExcelWorkbook([
+      summarySheet('Summary', [
+        ['Tenants', tenants.length],
+        ['Active', tenants.filter(t => t.status === 'active').length],
+        ['In Arrears', tenants.filter(t => t.arrears > 0).length],
+        ['Flagged', tenants.filter(t => t.open_flags > 0).length],
+        ['Outstanding Balance', sum(tenants.map(t => t.outstanding_balance))],
+        ['Arrears', sum(tenants.map(t => t.arrears))],
+        ['Generated', new Date()],
+      ]),
+      details,
+    ]);
+  }
+
+  private async whereFor(filters: TenantDirectoryFilters): Promise<Prisma.UserWhereInput> {
+    const and: Prisma.UserWhereInput[] = [{ role: 'tenant' }];
+    if (filters.status) and.push({ status: filters.status as any });
+    if (filters.company_id) and.push({ company_id: filters.company_id });
+    if (filters.agency_id) and.push({ tenant_profile: { current_property: { agency_id: filters.agency_id } } });
+    if (filters.property_id) and.push({ tenant_profile: { current_property_id: filters.property_id } });
+    if (filters.search) {
+      and.push({
+        OR: [
+          { first_name: { contains: filters.search, mode: 'insensitive' } },
+          { last_name: { contains: filters.search, mode: 'insensitive' } },
+          { email: { contains: filters.search, mode: 'insensitive' } },
+          { phone_number: { contains: filters.search } },
+        ],
+      });
+    }
+    if (filters.in_arrears !== undefined) {
+      const overdue: Prisma.InvoiceListRelationFilter = {
+        some: { status: { in: UNSETTLED_STATUSES as any }, due_date: { lt: new Date() } },
+      };
+      and.push(filters.in_arrears ? { received_invoices: overdue } : { NOT: { received_invoices: overdue } });
+    }
+    if (filters.flagged !== undefined) {
+      // Flags record the tenant's id without a relation, so match on the flagged ids
+      const flagged = await this.prisma.tenantFlag.findMany({
+        where: { tenant_id: { not: null }, status: { in: OPEN_FLAG_STATUSES } },
+        distinct: ['tenant_id'],
+        select: { tenant_id: true },
+      });
+      const ids = flagged.map(flag => flag.tenant_id!);
+      and.push(filters.flagged ? { id: { in: ids } } : { id: { notIn: ids } });
+    }
+    return { AND: and };
+  }
+
+  private async present(tenants: DirectoryTenant[]) {
+    if (tenants.length === 0) return [];
+    const ids = tenants.map(t => t.id);
+    const now = new Date();
+    const [invoices, flags] = await Promise.all([
+      this.prisma.invoice.findMany({
+        where: { issued_to: { in: ids }, status: { in: UNSETTLED_STATUSES as any } },
+        select: { issued_to: true, total_amount: true, due_date: true },
+      }),
+      this.prisma.tenantFlag.groupBy({
+        by: ['tenant_id'],
+        where: { tenant_id: { in: ids }, status: { in: OPEN_FLAG_STATUSES } },
+        _count: { _all: true },
+      }),
+    ]);
+
+    return tenants.map(tenant => {
+      const owed = invoices.filter(invoice => invoice.issued_to === tenant.id);
+      const outstanding = owed.reduce((sum, invoice) => sum + Number(invoice.total_amount), 0);
+      const arrears = owed.filter(invoice => invoice.due_date < now).reduce((sum, invoice) => sum + Number(invoice.total_amount), 0);
+      const profile = tenant.tenant_profile;
+      return {
+        id: tenant.id,
+        name: `${tenant.first_name} ${tenant.last_name}`.trim(),
+        email: tenant.email,
+        phone_number: tenant.phone_number,
+        status: tenant.status,
+        company: tenant.company,
+        agency: profile?.current_property?.agency || null,
+        property: profile?.current_property ? { id: profile.current_property.id, name: profile.current_property.name } : null,
+        unit: profile?.current_unit || null,
+        rent_amount: profile?.rent_amount ? Number(profile.rent_amount) : null,
+        lease_start_date: profile?.lease_start_date || null,
+        lease_end_date: profile?.lease_end_date || null,
+        outstanding_balance: Math.round(outstanding * 100) / 100,
+        arrears: Math.round(arrears * 100) / 100,
+        open_flags: flags.find(flag => flag.tenant_id === tenant.id)?._count._all || 0,
+        last_login_at: tenant.last_login_at,
+        created_at: tenant.created_at,
+      };
+    });
+  }
+
+  private assertSuperAdmin(user: JWTClaims) {
+    if (user.role !== 'super_admin') {
+      throw new Error('insufficient permissions to view the tenant directory');
+    }
+  }
+}
+
+export const tenantDirectoryService = new TenantDirectoryService();
@@ -0,0 +1,355 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { TenantsService } from './tenants.service.js';
+
+const FLAG_CATEGORIES = ['payment_default', 'property_damage', 'lease_violation', 'fraud', 'other'];
+const FLAG_SEVERITIES = ['low', 'medium', 'high', 'critical'];
+const MANAGING_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+
+export interface CreateTenantFlagRequest {
+  category: string;
+  severity?: string;
+  reason: string;
+  expires_at?: string;
+}
+
+export interface ScreenTenantRequest {
+  email?: string;
+  phone?: string;
+  id_number?: string;
+}
+
+export interface ReviewDisputeRequest {
+  decision: 'uphold' | 'overturn';
+  notes?: string;
+}
+
+const digitsOnly = (value?: string | null) => (value ? value.replace(/\D/g, '') : '');
+const normalizeIdNumber = (value?: string | null) => (value ? value.replace(/[^a-z0-9]/gi, '').toUpperCase() : '');
+
+// Flags that still count: active or under dispute, and not past their expiry
+const activeFlagFilter = () => ({
+  status: { in: ['active', 'disputed'] },
+  OR: [{ expires_at: null }, { expires_at: { gt: new Date() } }],
+});
+
+export class TenantFlagsService {
+  private prisma = getPrisma();
+  private tenantsService = new TenantsService();
+
+  private assertCanManage(user: JWTClaims) {
+    if (!MANAGING_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage tenant flags');
+    }
+  }
+
+  /**
+   * Flag a tenant (e.g. after a rent default or damage). Other companies screening the same
+   * person see its category, not its reason.
+   */
+  async flagTenant(tenantId: string, req: CreateTenantFlagRequest, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    if (!req.reason?.trim()) {
+      throw new Error('reason is required');
+    }
+    if (!FLAG_CATEGORIES.includes(req.category)) {
+      throw new Error(`category must be one of: ${FLAG_CATEGORIES.join(', ')}`);
+    }
+    if (req.severity && !FLAG_SEVERITIES.includes(req.severity)) {
+      throw new Error(`severity must be one of: ${FLAG_SEVERITIES.join(', ')}`);
+    }
+    const expiresAt = req.expires_at ? new Date(req.expires_at) : null;
+    if (expiresAt && (isNaN(expiresAt.getTime()) || expiresAt <= new Date())) {
+      throw new Error('expires_at must be a future date');
+    }
+
+    const tenant = await this.tenantsService.getTenant(tenantId, user);
+    const companyId = user.company_id || tenant.company_id;
+    if (!companyId) {
+      throw new Error('tenant is not linked to a company');
+    }
+
+    const flag = await this.prisma.tenantFlag.create({
+      data: {
+        company_id: companyId,
+        tenant_id: tenant.id,
+        tenant_name: `${tenant.first_name} ${tenant.last_name}`.trim(),
+        tenant_email: tenant.email?.toLowerCase() || null,
+        tenant_phone: digitsOnly(tenant.phone_number) || null,
+        tenant_id_number: normalizeIdNumber(tenant.tenant_profile?.id_number || tenant.id_number) || null,
+        category: req.category,
+        severity: req.severity || 'medium',
+        reason: req.reason.trim(),
+        flagged_by: user.user_id,
+        expires_at: expiresAt,
+      },
+    });
+
+    await this.notifyTenant(
+      tenant.id,
+      'A flag has been added to your tenant record',
+      'A property manager has added a flag to your rental record. You can view it and submit a dispute from your tenant portal.',
+      flag.id,
+      user
+    );
+
+    return flag;
+  }
+
+  /**
+   * Flags for a tenant: full detail for the caller's own company, a screening summary for others
+   */
+  async getTenantFlags(tenantId: string, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const tenant = await this.tenantsService.getTenant(tenantId, user);
+
+    const ownFlags = await this.prisma.tenantFlag.findMany({
+      where: user.role === 'super_admin' ? { tenant_id: tenant.id } : { tenant_id: tenant.id, company_id: user.company_id },
+      orderBy: { created_at: 'desc' },
+    });
+
+    const screening = await this.screenProspect(
+      {
+        email: tenant.email,
+        phone: tenant.phone_number,
+        id_number: tenant.tenant_profile?.id_number || tenant.id_number,
+      },
+      user
+    );
+
+    return { flags: ownFlags, screening };
+  }
+
+  /**
+   * Screen a prospective tenant by email, phone and/or ID number across all companies. The
+   * caller's own company's flags come back in full; flags other companies raised are only counted
+   * per category, so their free-text reasons and who raised them stay with them.
+   */
+  async screenProspect(req: ScreenTenantRequest, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+
+    const email = req.email?.trim().toLowerCase();
+    const phone = digitsOnly(req.phone);
+    const idNumber = normalizeIdNumber(req.id_number);
+    const identifiers: any[] = [];
+    if (email) identifiers.push({ tenant_email: email });
+    // Match on the local part so 07xx and 2547xx forms of the same number agree
+    if (phone.length >= 9) identifiers.push({ tenant_phone: { endsWith: phone.slice(-9) } });
+    if (idNumber) identifiers.push({ tenant_id_number: idNumber });
+    if (identifiers.length === 0) {
+      throw new Error('email, phone or id_number is required for screening');
+    }
+
+    const flags = await this.prisma.tenantFlag.findMany({
+      where: { AND: [activeFlagFilter(), { OR: identifiers }] },
+      orderBy: { created_at: 'desc' },
+    });
+
+    const isOwn = (flag: { company_id: string }) => user.role === 'super_admin' || flag.company_id === user.company_id;
+    const ownFlags = flags.filter(isOwn).map(flag => ({
+      id: flag.id,
+      category: flag.category,
+      severity: flag.severity,
+      reason: flag.reason,
+      status: flag.status,
+      disputed: flag.status === 'disputed',
+      flagged_at: flag.created_at,
+      expires_at: flag.expires_at,
+      matched_on: [
+        email && flag.tenant_email === email ? 'email' : null,
+        phone.length >= 9 && flag.tenant_phone?.endsWith(phone.slice(-9)) ? 'phone' : null,
+        idNumber && flag.tenant_id_number === idNumber ? 'id_number' : null,
+      ].filter(Boolean),
+    }));
+
+    const otherCounts = new Map<string, number>();
+    for (const flag of flags.filter(flag => !isOwn(flag))) {
+      otherCounts.set(flag.category, (otherCounts.get(flag.category) || 0) + 1);
+    }
+
+    return {
+      flagged: flags.length > 0,
+      total_flags: flags.length,
+      flags: ownFlags,
+      other_companies: [...otherCounts].map(([category, count]) => ({ category, count })),
+    };
+  }
+
+  /**
+   * Lift a flag raised by the caller's company (e.g. arrears were cleared)
+   */
+  async resolveFlag(tenantId: string, flagId: string, notes: string | undefined, user: JWTClaims): Promise<any> {
+    this.assertCanManage(user);
+    const flag = await this.getCompanyFlag(flagId, user, tenantId);
+    if (!['active', 'disputed'].includes(flag.status)) {
+      throw new Error(`flag is already ${flag.status}`);
+    }
+
+    return this.prisma.tenantFlag.update({
+      where: { id: flag.id },
+      data: {
+        status: 'resolved',
+        resolution_notes: notes || null,
+        resolved_by: user.user_id,
+        resolved_at: new Date(),
+        updated_at: new Date(),
+      },
+    });
+  }
+
+  /**
+   * Flags raised against the signed-in tenant
+   */
+  async getMyFlags(user: JWTClaims): Promise<any[]> {
+    if (user.role !== 'tenant') {
+      throw new Error('insufficient permissions: only tenants can view their own flags');
+    }
+
+    const flags = await this.prisma.tenantFlag.findMany({
+      where: { tenant_id: user.user_id },
+      include: { company: { select: { name: true } } },
+      orderBy: { created_at: 'desc' },
+    });
+
+    return flags.map(({ flagged_by, resolved_by, ...flag }) => flag);
+  }
+
+  /**
+   * Tenant appeal against a flag. The flag stays visible as disputed until reviewed.
+   */
+  async disputeFlag(flagId: string, reason: string, user: JWTClaims): Promise<any> {
+    if (user.role !== 'tenant') {
+      throw new Error('insufficient permissions: only tenants can dispute flags');
+    }
+    if (!reason?.trim()) {
+      throw new Error('reason is required');
+    }
+
+    const flag = await this.prisma.tenantFlag.findFirst({ where: { id: flagId, tenant_id: user.user_id } });
+    if (!flag) {
+      throw new Error('flag not found');
+    }
+    if (flag.status === 'disputed') {
+      throw new Error('flag is already disputed');
+    }
+    if (flag.status !== 'active') {
+      throw new Error(`flag is ${flag.status} and cannot be disputed`);
+    }
+
+    const updated = await this.prisma.tenantFlag.update({
+      where: { id: flag.id },
+      data: {
+        status: 'disputed',
+        dispute_reason: reason.trim(),
+        disputed_at: new Date(),
+        updated_at: new Date(),
+      },
+    });
+
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.createNotification(user, {
+        recipient_id: flag.flagged_by,
+        title: 'Tenant flag disputed',
+        message: `${flag.tenant_name} has disputed a ${flag.category.replace(/_/g, ' ')} flag. Please review the dispute.`,
+        notification_type: 'system',
+        category: 'tenant',
+        priority: 'medium',
+        metadata: { flag_id: flag.id, tenant_id: flag.tenant_id },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify flag owner about dispute:', error.message);
+    }
+
+    return updated;
+  }
+
+  /**
+   * Disputed flags awaiting review (company-scoped, or platform-wide for super admins)
+   */
+  async listDisputes(user: JWTClaims): Promise<any[]> {
+    this.assertCanManage(user);
+
+    return this.prisma.tenantFlag.findMany({
+      where: {
+        status: 'disputed',
+        ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+      },
+      include: { company: { select: { id: true, name: true } } },
+      orderBy: { disputed_at: 'asc' },
+    });
+  }
+
+  /**
+   * Decide a dispute: uphold keeps the flag active, overturn removes it from screening
+   */
+  async reviewDispute(flagId: string, req: ReviewDisputeRequest, user: JWTClaims): Promise<any> {
+    if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
+      throw new Error('insufficient permissions to review flag disputes');
+    }
+    if (!['uphold', 'overturn'].includes(req.decision)) {
+      throw new Error("decision must be 'uphold' or 'overturn'");
+    }
+
+    const flag = await this.getCompanyFlag(flagId, user);
+    if (flag.status !== 'disputed') {
+      throw new Error('flag is not under dispute');
+    }
+
+    const updated = await this.prisma.tenantFlag.update({
+      where: { id: flag.id },
+      data: {
+        status: req.decision === 'uphold' ? 'active' : 'overturned',
+        resolution_notes: req.notes || null,
+        resolved_by: user.user_id,
+        resolved_at: new Date(),
+        updated_at: new Date(),
+      },
+    });
+
+    if (flag.tenant_id) {
+      await this.notifyTenant(
+        flag.tenant_id,
+        req.decision === 'uphold' ? 'Your flag dispute was not upheld' : 'Your flag dispute was successful',
+        req.decision === 'uphold'
+          ? `Your dispute was reviewed and the flag remains on your record.${req.notes ? ` Notes: ${req.notes}` : ''}`
+          : 'Your dispute was reviewed and the flag has been removed from your record.',
+        flag.id,
+        user
+      );
+    }
+
+    return updated;
+  }
+
+  private async getCompanyFlag(flagId: string, user: JWTClaims, tenantId?: string) {
+    const flag = await this.prisma.tenantFlag.findFirst({
+      where: {
+        id: flagId,
+        ...(tenantId && { tenant_id: tenantId }),
+        ...(user.role !== 'super_admin' && { company_id: user.company_id }),
+      },
+    });
+    if (!flag) {
+      throw new Error('flag not found');
+    }
+    return flag;
+  }
+
+  private async notifyTenant(tenantId: string, title: string, message: string, flagId: string, user: JWTClaims) {
+    try {
+      const { notificationsService } = await import('./notifications.service.js');
+      await notificationsService.createNotification(user, {
+        recipient_id: tenantId,
+        title,
+        message,
+        notification_type: 'system',
+        category: 'account',
+        priority: 'high',
+        metadata: { flag_id: flagId },
+      });
+    } catch (error: any) {
+      console.error('⚠️ Failed to notify tenant about flag:', error.message);
+    }
+  }
+}
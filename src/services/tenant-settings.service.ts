@@ -2,6 +2,10 @@ import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
 import bcrypt from 'bcryptjs';
 
+export type CommunicationChannel = 'email' | 'sms' | 'push' | 'whatsapp';
+
+export const COMMUNICATION_CHANNELS: CommunicationChannel[] = ['email', 'sms', 'push', 'whatsapp'];
+
 /**
  * Universal Settings Service for all user roles
  * Works with tenants, landlords, staff, agents, and admins
@@ -157,38 +161,34 @@ export class TenantSettingsService {
    */
   async shouldReceiveNotification(
     userId: string,
-    notificationType: 'email' | 'sms' | 'push',
-    category: string
+    notificationType: CommunicationChannel,
+    category: string,
+    priority: string = 'medium'
   ): Promise<boolean> {
     try {
-      const settings = await this.prisma.tenantNotificationSettings.findUnique({
-        where: { user_id: userId },
-      });
+      const [preferences, settings] = await Promise.all([
+        this.prisma.tenantPreferences.findUnique({ where: { user_id: userId } }),
+        this.prisma.tenantNotificationSettings.findUnique({ where: { user_id: userId } }),
+      ]);
+
+      // Channel master switches from preferences (WhatsApp is opt-in only)
+      if (!this.isChannelEnabled(preferences, notificationType)) {
+        return false;
+      }
 
       // If no settings, allow all notifications (default behavior)
       if (!settings) return true;
 
-      // Check quiet hours
-      if (settings.quiet_hours_start && settings.quiet_hours_end) {
-        const now = new Date();
-        const currentTime = now.getHours() * 60 + now.getMinutes();
-        
-        const startTime = new Date(settings.quiet_hours_start).getHours() * 60 + 
-                         new Date(settings.quiet_hours_start).getMinutes();
-        const endTime = new Date(settings.quiet_hours_end).getHours() * 60 + 
-                       new Date(settings.quiet_hours_end).getMinutes();
-
-        // Check if current time is within quiet hours
-        if (startTime <= endTime) {
-          if (currentTime >= startTime && currentTime <= endTime) {
-            return false; // In quiet hours
-          }
-        } else {
-          // Quiet hours span midnight
-          if (currentTime >= startTime || currentTime <= endTime) {
-            return false;
-          }
-        }
+      // Check quiet hours - urgent notifications always go through
+      if (
+        priority !== 'urgent' &&
+        this.isWithinQuietHours(
+          settings.quiet_hours_start,
+          settings.quiet_hours_end,
+          preferences?.timezone || 'Africa/Nairobi'
+        )
+      ) {
+        return false;
       }
 
       // Check specific notification preferences based on type and category
@@ -213,9 +213,10 @@ export class TenantSettingsService {
         }
       }
 
-      if (notificationType === 'sms') {
+      if (notificationType === 'sms' || notificationType === 'whatsapp') {
         switch (category) {
           case 'payment_due':
+          case 'payment_reminder':
             return settings.sms_payment_due_alerts;
           case 'urgent_maintenance':
             return settings.sms_urgent_maintenance;
@@ -233,6 +234,113 @@ export class TenantSettingsService {
     }
   }
 
+  /**
+   * Resolve which of the requested channels a user accepts for a notification.
+   * In-app delivery ('app') is never filtered.
+   */
+  async resolveChannels(
+    userId: string,
+    requested: string[],
+    category: string,
+    priority: string = 'medium'
+  ): Promise<string[]> {
+    const allowed: string[] = [];
+    for (const channel of [...new Set(requested)]) {
+      if (!COMMUNICATION_CHANNELS.includes(channel as CommunicationChannel)) {
+        allowed.push(channel);
+        continue;
+      }
+      if (await this.shouldReceiveNotification(userId, channel as CommunicationChannel, category, priority)) {
+        allowed.push(channel);
+      }
+    }
+    return allowed;
+  }
+
+  /**
+   * Get a user's communication channel preferences in a compact form
+   */
+  async getChannelPreferences(userId: string) {
+    const [preferences, settings] = await Promise.all([
+      this.prisma.tenantPreferences.findUnique({ where: { user_id: userId } }),
+      this.prisma.tenantNotificationSettings.findUnique({ where: { user_id: userId } }),
+    ]);
+
+    return {
+      user_id: userId,
+      channels: {
+        email: this.isChannelEnabled(preferences, 'email'),
+        sms: this.isChannelEnabled(preferences, 'sms'),
+        push: this.isChannelEnabled(preferences, 'push'),
+        whatsapp: this.isChannelEnabled(preferences, 'whatsapp'),
+      },
+      whatsapp_number: preferences?.whatsapp_number || null,
+      primary_contact_method: preferences?.primary_contact_method || 'email',
+      language: preferences?.language || 'en',
+      timezone: preferences?.timezone || 'Africa/Nairobi',
+      quiet_hours: {
+        start: this.formatTime(settings?.quiet_hours_start),
+        end: this.formatTime(settings?.quiet_hours_end),
+      },
+    };
+  }
+
+  private isChannelEnabled(preferences: any, channel: CommunicationChannel): boolean {
+    if (!preferences) {
+      return channel !== 'whatsapp';
+    }
+    switch (channel) {
+      case 'email':
+        return preferences.enable_email;
+      case 'sms':
+        return preferences.enable_sms;
+      case 'push':
+        return preferences.enable_push_notifications;
+      case 'whatsapp':
+        return preferences.enable_whatsapp;
+      default:
+        return true;
+    }
+  }
+
+  /**
+   * Quiet hours are stored as TIME columns (UTC-normalised by Prisma) and
+   * compared against the current wall-clock time in the user's timezone.
+   */
+  private isWithinQuietHours(start: Date | null, end: Date | null, timezone: string): boolean {
+    if (!start || !end) return false;
+
+    let currentTime: number;
+    try {
+      const parts = new Intl.DateTimeFormat('en-GB', {
+        timeZone: timezone,
+        hour: '2-digit',
+        minute: '2-digit',
+        hour12: false,
+      }).formatToParts(new Date());
+      const hour = Number(parts.find((p) => p.type === 'hour')?.value || 0) % 24;
+      const minute = Number(parts.find((p) => p.type === 'minute')?.value || 0);
+      currentTime = hour * 60 + minute;
+    } catch {
+      const now = new Date();
+      currentTime = now.getHours() * 60 + now.getMinutes();
+    }
+
+    const startTime = start.getUTCHours() * 60 + start.getUTCMinutes();
+    const endTime = end.getUTCHours() * 60 + end.getUTCMinutes();
+
+    if (startTime <= endTime) {
+      return currentTime >= startTime && currentTime <= endTime;
+    }
+    // Quiet hours span midnight
+    return currentTime >= startTime || currentTime <= endTime;
+  }
+
+  private formatTime(value?: Date | null): string | null {
+    if (!value) return null;
+    return `${String(value.getUTCHours()).padStart(2, '0')}:${String(value.getUTCMinutes()).padStart(2, '0')}`;
+  }
+
   /**
    * Get or create tenant preferences
    */
@@ -270,6 +378,8 @@ export class TenantSettingsService {
           enable_email: data.enable_email,
           enable_sms: data.enable_sms,
           enable_push_notifications: data.enable_push_notifications,
+          enable_whatsapp: data.enable_whatsapp,
+          whatsapp_number: data.whatsapp_number,
           primary_contact_method: data.primary_contact_method,
           language: data.language,
           currency: data.currency,
@@ -286,6 +396,8 @@ export class TenantSettingsService {
           enable_email: data.enable_email,
           enable_sms: data.enable_sms,
           enable_push_notifications: data.enable_push_notifications,
+          enable_whatsapp: data.enable_whatsapp,
+          whatsapp_number: data.whatsapp_number,
           primary_contact_method: data.primary_contact_method,
           language: data.language,
           currency: data.currency,
@@ -372,6 +484,16 @@ export class TenantSettingsService {
         },
       });
 
+      // The digest job reads the frequency from the user's preferences
+      if (data.email_digest_frequency !== undefined) {
+        const frequency = ['daily', 'weekly'].includes(data.email_digest_frequency) ? data.email_digest_frequency : 'off';
+        await this.prisma.userPreferences.upsert({
+          where: { user_id: user.user_id },
+          update: { email_digest_frequency: frequency, updated_at: new Date() },
+          create: { user_id: user.user_id, email_digest_frequency: frequency },
+        });
+      }
+
       return settings;
     } catch (error) {
       console.error('Error updating notification settings:', error);
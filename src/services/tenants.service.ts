@@ -5,6 +5,12 @@ import crypto from 'crypto';
 import { LeasesService, CreateLeaseRequest } from './leases.service.js';
 import { UnitActivityService } from './unit-activity.service.js';
 import { UsersService } from './users.service.js';
+import { maintenanceSlaService } from './maintenance-sla.service.js';
+import { buildExcelWorkbook, sheetToCsv, summarySheet, ExcelSheet } from '../utils/excel-export.js';
+
+// Exports page through listTenants, which caps each page at 100
+const EXPORT_PAGE_SIZE = 100;
+const EXPORT_MAX_ROWS = 10000;
 
 export interface TenantFilters {
   property_id?: string;
@@ -260,6 +266,21 @@ This agreement is subject to the laws of Kenya and any disputes shall be resolve
         },
       });
 
+      // Caretaker gets a task to prepare the unit for move-in
+      try {
+        const { caretakerAssignmentService } = await import('./caretaker-assignment.service.js');
+        await caretakerAssignmentService.createMoveTask({
+          company_id: user.company_id!,
+          property_id: unit.property.id,
+          unit_id: req.unit_id,
+          type: 'move_in',
+          date: req.lease_start_date ? new Date(req.lease_start_date) : new Date(),
+          tenant_name: `${tenant.first_name} ${tenant.last_name}`,
+        }, user.user_id);
+      } catch (taskError: any) {
+        console.error('⚠️ Failed to create move-in task:', taskError.message);
+      }
+
       // ✅ CRITICAL: Create tenant profile for maintenance requests and other features
       try {
         // Extract emergency contact data from request (support both object and direct fields)
@@ -1348,6 +1369,60 @@ This agreement is subject to the laws of Kenya and any disputes shall be resolve
     };
   }
 
+  /**
+   * Tenants matching the list filters as CSV, or as an Excel workbook with a summary sheet
+   */
+  async exportTenants(filters: TenantFilters, user: JWTClaims, format: string): Promise<string | Buffer> {
+    if (!['csv', 'xlsx', 'excel'].includes(format)) {
+      throw new Error('format must be csv or xlsx');
+    }
+    const tenants: any[] = [];
+    for (let offset = 0; offset < EXPORT_MAX_ROWS; offset += EXPORT_PAGE_SIZE) {
+      const result = await this.listTenants({ ...filters, limit: EXPORT_PAGE_SIZE, offset }, user);
+      tenants.push(...result.tenants);
+      if (offset + EXPORT_PAGE_SIZE >= result.total) break;
+    }
+
+    const details: ExcelSheet = {
+      name: 'Tenants',
+      columns: [
+        'Name', 'Email', 'Phone', 'Status', 'Property', 'Unit',
+        { header: 'Rent', type: 'currency' }, { header: 'Lease Start', type: 'date' }, { header: 'Lease End', type: 'date' },
+        'Payment Status', { header: 'Balance', type: 'currency' }, { header: 'Created', type: 'date' },
+      ],
+      rows: tenants.map(t => [
+        `${t.first_name || ''} ${t.last_name || ''}`.trim(),
+        t.email || '',
+        t.phone_number || '',
+        t.status,
+        t.property_name,
+        t.unit_number,
+        Number(t.rent_amount || 0),
+        t.lease_start || null,
+        t.lease_end || null,
+        t.paymentStatus,
+        Number(t.balance || 0),
+        t.created_at,
+      ]),
+    };
+    if (format === 'csv') {
+      return sheetToCsv(details);
+    }
+
+    const count = (status: string) => tenants.filter(t => t.paymentStatus === status).length;
+    return buildExcelWorkbook([
+      summarySheet('Summary', [
+        ['Tenants', tenants.length],
+        ['Paid Up', count('paid')],
+        ['Pending', count('pending')],
+        ['Overdue', count('overdue')],
+        ['Outstanding Balance', Math.round(tenants.reduce((sum, t) => sum + Number(t.balance || 0), 0) * 100) / 100],
+        ['Generated', new Date()],
+      ]),
+      details,
+    ]);
+  }
+
   async assignUnit(tenantId: string, req: AssignUnitRequest, user: JWTClaims): Promise<void> {
     // Check permissions
     if (!['super_admin', 'agency_admin', 'landlord'].includes(user.role)) {
@@ -1620,6 +1695,10 @@ This agreement is subject to the laws of Kenya and any disputes shall be resolve
         },
       });
     });
+
+    // Offer the freed unit to the next person on the property's waiting list
+    const { UnitApplicationsService } = await import('./unit-applications.service.js');
+    await new UnitApplicationsService().notifyUnitVacated(currentUnit.id);
   }
 
   async terminateTenant(tenantId: string, user: JWTClaims): Promise<void> {
@@ -1645,6 +1724,23 @@ This agreement is subject to the laws of Kenya and any disputes shall be resolve
       throw new Error('insufficient permissions to manage this tenant');
     }
 
+    // Draft deposit settlements before unpaid invoices are cancelled below, so arrears are captured
+    const activeLeases = await this.prisma.lease.findMany({
+      where: { tenant_id: tenantId, status: 'active', lease_type: { not: 'short_stay' } },
+      select: { id: true },
+    });
+    const { DepositSettlementService } = await import('./deposit-settlement.service.js');
+    const depositSettlementService = new DepositSettlementService();
+    for (const lease of activeLeases) {
+      await this.prisma.lease.update({ where: { id: lease.id }, data: { move_out_date: new Date() } });
+      await depositSettlementService.autoCalculate(lease.id, user);
+    }
+
+    const occupiedUnits = await this.prisma.unit.findMany({
+      where: { current_tenant_id: tenantId },
+      select: { id: true, property_id: true, company_id: true },
+    });
+
     // Use transaction to ensure all termination steps complete together
     await this.prisma.$transaction(async (tx) => {
       // 1. Terminate all active leases for this tenant
@@ -1723,6 +1819,38 @@ This agreement is subject to the laws of Kenya and any disputes shall be resolve
         },
       });
     });
+
+    // Offer the freed units to the next people on the properties' waiting lists
+    const { UnitApplicationsService } = await import('./unit-applications.service.js');
+    const unitApplicationsService = new UnitApplicationsService();
+    for (const unit of occupiedUnits) {
+      await unitApplicationsService.notifyUnitVacated(unit.id);
+    }
+
+    // Caretakers get a move-out walkthrough for each released unit
+    const { caretakerAssignmentService } = await import('./caretaker-assignment.service.js');
+    for (const unit of occupiedUnits) {
+      try {
+        await caretakerAssignmentService.createMoveTask({
+          company_id: unit.company_id,
+          property_id: unit.property_id,
+          unit_id: unit.id,
+          type: 'move_out',
+          date: new Date(),
+          tenant_name: `${tenant.first_name} ${tenant.last_name}`,
+        }, user.user_id);
+      } catch (taskError: any) {
+        console.error('⚠️ Failed to create move-out task:', taskError.message);
+      }
+    }
+
+    // Tenancy chats of the ended leases become read-only history
+    try {
+      const { tenancyChatsService } = await import('./tenancy-chats.service.js');
+      await tenancyChatsService.archiveEndedForTenant(tenantId);
+    } catch (chatError: any) {
+      console.error('⚠️ Failed to archive tenancy chats:', chatError.message);
+    }
   }
 
   /**
@@ -1818,194 +1946,19 @@ This agreement is subject to the laws of Kenya and any disputes shall be resolve
 
     // Send invitation email
     try {
-      const { emailService } = await import('./email.service.js');
+      const { emailTemplatesService } = await import('./email-templates.service.js');
       
       // Generate invitation link using the existing tenant-register route
       const invitationLink = `${process.env.APP_URL || 'http://localhost:3000'}/tenant-register?email=${encodeURIComponent(tenant.email!)}&first_name=${encodeURIComponent(tenant.first_name || '')}&last_name=${encodeURIComponent(tenant.last_name || '')}&token=invitation-${tenant.id}`;
       
-      const emailResult = await emailService.sendEmail({
+      const emailResult = await emailTemplatesService.send('tenant_invitation', {
         to: tenant.email!,
-        subject: '🏠 Welcome to LetRents - Complete Your Tenant Setup',
-        html: `
-          <!DOCTYPE html>
-          <html lang="en">
-          <head>
-            <meta charset="UTF-8">
-            <meta name="viewport" content="width=device-width, initial-scale=1.0">
-            <title>Welcome to LetRents</title>
-          </head>
-          <body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f8fafc; line-height: 1.6;">
-            <table role="presentation" style="width: 100%; border-collapse: collapse; background-color: #f8fafc;">
-              <tr>
-                <td align="center" style="padding: 40px 20px;">
-                  <table role="presentation" style="width: 100%; max-width: 600px; border-collapse: collapse; background-color: #ffffff; border-radius: 16px; box-shadow: 0 4px 6px rgba(0, 0, 0, 0.05); overflow: hidden;">
-                    
-                    <!-- Header with gradient background -->
-                    <tr>
-                      <td style="background: linear-gradient(135deg, #2563eb 0%, #1e40af 100%); padding: 40px 30px; text-align: center;">
-                        <div style="background-color: rgba(255, 255, 255, 0.15); width: 80px; height: 80px; border-radius: 20px; margin: 0 auto 20px; display: flex; align-items: center; justify-content: center; backdrop-filter: blur(10px);">
-                          <span style="font-size: 40px; color: #ffffff;">🏠</span>
-                        </div>
-                        <h1 style="margin: 0; color: #ffffff; font-size: 28px; font-weight: 700; letter-spacing: -0.5px;">Welcome to LetRents!</h1>
-                        <p style="margin: 10px 0 0; color: rgba(255, 255, 255, 0.9); font-size: 16px; font-weight: 400;">Your Modern Property Management Portal</p>
-                      </td>
-                    </tr>
-                    
-                    <!-- Main Content -->
-                    <tr>
-                      <td style="padding: 40px 30px;">
-                        <div style="margin-bottom: 30px;">
-                          <h2 style="margin: 0 0 15px; color: #1e293b; font-size: 20px; font-weight: 600;">Hello ${tenant.first_name} ${tenant.last_name},</h2>
-                          <p style="margin: 0 0 15px; color: #475569; font-size: 16px; line-height: 1.6;">
-                            🎉 Congratulations! You've been invited to join LetRents as a tenant. We're excited to have you on board!
-                          </p>
-                          <p style="margin: 0; color: #475569; font-size: 16px; line-height: 1.6;">
-                            Complete your account setup to unlock access to your personalized tenant portal and enjoy a seamless rental experience.
-                          </p>
-                        </div>
-                        
-                        <!-- Call to Action Button -->
-                        <div style="text-align: center; margin: 35px 0;">
-                          <a href="${invitationLink}" style="display: inline-block; background: linear-gradient(135deg, #2563eb 0%, #1e40af 100%); color: #ffffff; text-decoration: none; padding: 16px 40px; border-radius: 12px; font-weight: 600; font-size: 16px; box-shadow: 0 4px 12px rgba(37, 99, 235, 0.3); transition: transform 0.2s;">
-                            ✨ Complete Account Setup
-                          </a>
-                          <p style="margin: 15px 0 0; color: #94a3b8; font-size: 13px;">
-                            Click the button above to get started
-                          </p>
-                        </div>
-                        
-                        <!-- Features Section -->
-                        <div style="background: linear-gradient(135deg, #f1f5f9 0%, #e2e8f0 100%); padding: 30px; border-radius: 12px; margin: 30px 0;">
-                          <h3 style="margin: 0 0 20px; color: #1e293b; font-size: 18px; font-weight: 600; text-align: center;">
-                            🚀 What You Can Do with Your Portal
-                          </h3>
-                          <table role="presentation" style="width: 100%; border-collapse: collapse;">
-                            <tr>
-                              <td style="padding: 10px 0;">
-                                <div style="display: flex; align-items: flex-start;">
-                                  <span style="font-size: 20px; margin-right: 12px;">📋</span>
-                                  <div>
-                                    <strong style="color: #334155; font-size: 15px; display: block; margin-bottom: 3px;">View Lease Details</strong>
-                                    <span style="color: #64748b; font-size: 14px;">Access your lease agreement and important dates</span>
-                                  </div>
-                                </div>
-                              </td>
-                            </tr>
-                            <tr>
-                              <td style="padding: 10px 0;">
-                                <div style="display: flex; align-items: flex-start;">
-                                  <span style="font-size: 20px; margin-right: 12px;">🔧</span>
-                                  <div>
-                                    <strong style="color: #334155; font-size: 15px; display: block; margin-bottom: 3px;">Submit Maintenance Requests</strong>
-                                    <span style="color: #64748b; font-size: 14px;">Report issues and track repair progress in real-time</span>
-                                  </div>
-                                </div>
-                              </td>
-                            </tr>
-                            <tr>
-                              <td style="padding: 10px 0;">
-                                <div style="display: flex; align-items: flex-start;">
-                                  <span style="font-size: 20px; margin-right: 12px;">💳</span>
-                                  <div>
-                                    <strong style="color: #334155; font-size: 15px; display: block; margin-bottom: 3px;">Make Online Payments</strong>
-                                    <span style="color: #64748b; font-size: 14px;">Pay rent securely via M-Pesa or bank transfer</span>
-                                  </div>
-                                </div>
-                              </td>
-                            </tr>
-                            <tr>
-                              <td style="padding: 10px 0;">
-                                <div style="display: flex; align-items: flex-start;">
-                                  <span style="font-size: 20px; margin-right: 12px;">📊</span>
-                                  <div>
-                                    <strong style="color: #334155; font-size: 15px; display: block; margin-bottom: 3px;">Track Payment History</strong>
-                                    <span style="color: #64748b; font-size: 14px;">View invoices, receipts, and payment records</span>
-                                  </div>
-                                </div>
-                              </td>
-                            </tr>
-                            <tr>
-                              <td style="padding: 10px 0;">
-                                <div style="display: flex; align-items: flex-start;">
-                                  <span style="font-size: 20px; margin-right: 12px;">💬</span>
-                                  <div>
-                                    <strong style="color: #334155; font-size: 15px; display: block; margin-bottom: 3px;">Communicate Easily</strong>
-                                    <span style="color: #64748b; font-size: 14px;">Chat directly with your property management team</span>
-                                  </div>
-                                </div>
-                              </td>
-                            </tr>
-                          </table>
-                        </div>
-                        
-                        <!-- Next Steps -->
-                        <div style="background-color: #fef3c7; border-left: 4px solid #f59e0b; padding: 20px; border-radius: 8px; margin: 25px 0;">
-                          <h4 style="margin: 0 0 10px; color: #92400e; font-size: 16px; font-weight: 600;">📌 Next Steps:</h4>
-                          <ol style="margin: 0; padding-left: 20px; color: #78350f; font-size: 14px; line-height: 1.8;">
-                            <li>Click the "Complete Account Setup" button above</li>
-                            <li>Create your secure password</li>
-                            <li>Verify your email address</li>
-                            <li>Explore your tenant dashboard</li>
-                            <li>Review your lease and payment details</li>
-                          </ol>
-                        </div>
-                        
-                        <!-- Help Section -->
-                        <div style="text-align: center; margin: 30px 0 0; padding-top: 25px; border-top: 2px solid #e2e8f0;">
-                          <p style="margin: 0 0 10px; color: #64748b; font-size: 14px;">
-                            Need help? Have questions?
-                          </p>
-                          <p style="margin: 0; color: #475569; font-size: 15px; font-weight: 500;">
-                            📧 Contact your property management team anytime
-                          </p>
-                        </div>
-                      </td>
-                    </tr>
-                    
-                    <!-- Footer -->
-                    <tr>
-                      <td style="background-color: #f8fafc; padding: 25px 30px; text-align: center; border-top: 1px solid #e2e8f0;">
-                        <p style="margin: 0 0 8px; color: #64748b; font-size: 13px; line-height: 1.5;">
-                          Welcome to hassle-free property management! 🎊
-                        </p>
-                        <p style="margin: 0 0 15px; color: #94a3b8; font-size: 12px;">
-                          This email was sent by LetRents Property Management System
-                        </p>
-                        <div style="margin: 15px 0 0;">
-                          <span style="color: #cbd5e1; font-size: 12px;">© ${new Date().getFullYear()} LetRents. All rights reserved.</span>
-                        </div>
-                      </td>
-                    </tr>
-                  </table>
-                  
-                  <!-- Email client hint -->
-                  <p style="margin: 20px 0 0; color: #94a3b8; font-size: 12px; text-align: center; max-width: 600px;">
-                    💡 <strong>Tip:</strong> Add noreply@letrents.com to your contacts to ensure you receive future updates.
-                  </p>
-                </td>
-              </tr>
-            </table>
-          </body>
-          </html>
-        `,
-        text: `
-Welcome to LetRents!
-
-Hello ${tenant.first_name} ${tenant.last_name},
-
-You've been invited to join LetRents as a tenant. Please complete your account setup to access your tenant portal.
-
-Complete your setup here: ${invitationLink}
-
-What you can do with your tenant portal:
-- View your lease information
-- Submit maintenance requests  
-- Make rent payments online
-- View payment history
-- Communicate with property management
-
-If you have any questions, please contact your property management team.
-        `,
+        recipientId: tenant.id,
+        companyId: tenant.company_id,
+        variables: {
+          tenant_name: `${tenant.first_name || ''} ${tenant.last_name || ''}`.trim(),
+          setup_url: invitationLink,
+        },
       });
 
       if (!emailResult.success) {
@@ -2189,7 +2142,16 @@ If you have any questions, please contact your property management team.
             updated_at: new Date(),
           },
         });
+
+        const { tenancyChatsService } = await import('./tenancy-chats.service.js');
+        await tenancyChatsService.archiveEndedForTenant(tenantId).catch((chatError: any) => {
+          console.error('⚠️ Failed to archive tenancy chat:', chatError.message);
+        });
       }
+
+      // Offer the freed unit to the next person on the property's waiting list
+      const { UnitApplicationsService } = await import('./unit-applications.service.js');
+      await new UnitApplicationsService().notifyUnitVacated(currentUnit.id);
     }
 
     // Assign new unit
@@ -2783,14 +2745,19 @@ If you have any questions, please contact your property management team.
     }
 
     // Create maintenance request
+    const requestedAt = new Date();
+    const priority = maintenanceData.priority?.toLowerCase() || 'medium';
+    const dueDates = await maintenanceSlaService.computeDueDates(user.company_id!, priority, requestedAt);
     const maintenanceRequest = await this.prisma.maintenanceRequest.create({
       data: {
         title: maintenanceData.title,
         description: maintenanceData.description,
         category: maintenanceData.category || 'General',
-        priority: maintenanceData.priority?.toLowerCase() || 'medium',
+        priority,
         status: 'pending',
         requested_by: tenantId,
+        requested_date: requestedAt,
+        ...dueDates,
         unit_id: activeLease.unit_id,
         property_id: activeLease.property_id,
         company_id: user.company_id!,
@@ -0,0 +1,104 @@
+import axios from 'axios';
+import { env } from '../config/env.js';
+
+export const TRANSLATION_LANGUAGES: Record<string, string> = {
+  en: 'English',
+  sw: 'Swahili',
+};
+
+export interface TranslationResult {
+  source_language: string | null;
+  texts: string[];
+}
+
+/**
+ * Machine translation backend. Texts are translated together and come back in the same order.
+ */
+export interface Translator {
+  readonly name: string;
+  readonly model: string | null;
+  translate(texts: string[], targetLanguage: string): Promise<TranslationResult>;
+}
+
+const TRANSLATION_PROMPT = (target: string) => `Translate each string in the JSON array "texts" into ${TRANSLATION_LANGUAGES[target]}.
+These are chat messages between tenants, landlords and property staff in Kenya; keep names, amounts, unit numbers,
+dates, M-Pesa codes and URLs exactly as written and keep the tone. Return ONLY a JSON object:
+{"source_language": "<ISO 639-1 code of the original>", "texts": [<translations, same order and count>]}`;
+
+/**
+ * OpenAI-compatible chat model (TRANSLATION_API_URL / TRANSLATION_API_KEY / TRANSLATION_MODEL)
+ */
+class AiTranslator implements Translator {
+  readonly name = 'ai';
+  readonly model = env.translation.model;
+
+  async translate(texts: string[], targetLanguage: string): Promise<TranslationResult> {
+    const response = await axios.post(
+      env.translation.apiUrl,
+      {
+        model: this.model,
+        temperature: 0,
+        response_format: { type: 'json_object' },
+        messages: [
+          { role: 'system', content: TRANSLATION_PROMPT(targetLanguage) },
+          { role: 'user', content: JSON.stringify({ texts }) },
+        ],
+      },
+      {
+        headers: { Authorization: `Bearer ${env.translation.apiKey}`, 'Content-Type': 'application/json' },
+        timeout: 30000,
+      }
+    );
+
+    let parsed: any;
+    try {
+      parsed = JSON.parse(response.data?.choices?.[0]?.message?.content || '');
+    } catch {
+      throw new Error('translation service returned an unreadable response');
+    }
+    if (!Array.isArray(parsed?.texts) || parsed.texts.length !== texts.length || parsed.texts.some((t: any) => typeof t !== 'string')) {
+      throw new Error('translation service returned an incomplete response');
+    }
+    const source = typeof parsed.source_language === 'string' ? parsed.source_language.trim().toLowerCase().slice(0, 5) : null;
+    return { source_language: source || null, texts: parsed.texts };
+  }
+}
+
+/**
+ * Google Cloud Translation (v2 REST, GOOGLE_TRANSLATE_API_KEY)
+ */
+class GoogleTranslator implements Translator {
+  readonly name = 'google';
+  readonly model = null;
+
+  async translate(texts: string[], targetLanguage: string): Promise<TranslationResult> {
+    const response = await axios.post(
+      'https://translation.googleapis.com/language/translate/v2',
+      { q: texts, target: targetLanguage, format: 'text' },
+      { params: { key: env.translation.googleApiKey }, timeout: 30000 }
+    );
+    const translations: any[] = response.data?.data?.translations || [];
+    if (translations.length !== texts.length) {
+      throw new Error('translation service returned an incomplete response');
+    }
+    return {
+      source_language: translations[0]?.detectedSourceLanguage || null,
+      texts: translations.map(t => String(t.translatedText ?? '')),
+    };
+  }
+}
+
+const createTranslator = (): Translator | null => {
+  switch (env.translation.provider) {
+    case 'ai':
+      return env.translation.apiKey ? new AiTranslator() : null;
+    case 'google':
+      return env.translation.googleApiKey ? new GoogleTranslator() : null;
+    case '':
+      return null;
+    default:
+      throw new Error(`Unsupported translation provider: ${env.translation.provider}`);
+  }
+};
+
+export const translator = createTranslator();
@@ -0,0 +1,235 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+// Days before the trial ends that the company's admins are reminded
+export const TRIAL_REMINDER_DAYS = [7, 3, 1];
+const DAY_MS = 24 * 60 * 60 * 1000;
+const BILLING_ROLES = ['landlord', 'agency_admin'];
+// Read-only checks run on every write, so a company's status is held briefly
+const READ_ONLY_CACHE_MS = 60 * 1000;
+
+export interface PaymentMethodDetails {
+  channel?: string | null;
+  brand?: string | null;
+  last4?: string | null;
+  reference?: string | null;
+  // What platform billing charges: the gateway's reusable authorization and its customer email
+  authorization_code?: string | null;
+  email?: string | null;
+}
+
+/**
+ * Trial subscriptions from reminder to expiry. A trial that ends without a payment method expires
+ * and leaves the company read-only; adding a payment method converts a trial on its end date and
+ * brings an expired subscription back at once.
+ */
+export class TrialsService {
+  private prisma = getPrisma();
+  private readOnlyCache = new Map<string, { readOnly: boolean; at: number }>();
+
+  /**
+   * Remind admins of trials ending in 7, 3 or 1 days that have no payment method yet; each
+   * reminder goes once
+   */
+  async sendReminders(now: Date = new Date()) {
+    const horizon = new Date(now.getTime() + Math.max(...TRIAL_REMINDER_DAYS) * DAY_MS);
+    const trials = await this.prisma.subscription.findMany({
+      where: { status: 'trial', payment_method_added_at: null, trial_end_date: { gt: now, lte: horizon } },
+      include: { company: { select: { id: true, name: true } } },
+    });
+
+    let sent = 0;
+    for (const trial of trials) {
+      const daysLeft = Math.ceil((trial.trial_end_date!.getTime() - now.getTime()) / DAY_MS);
+      const reminded = (trial.trial_reminders_sent as number[]) || [];
+      // The nearest reminder not yet sent; a missed run sends one reminder, not several
+      const due = TRIAL_REMINDER_DAYS.filter(days => days >= daysLeft && !reminded.includes(days)).sort((a, b) => a - b)[0];
+      if (!due) continue;
+
+      try {
+        await this.notifyAdmins(trial.company_id, {
+          title: daysLeft === 1 ? 'Your trial ends tomorrow' : `Your trial ends in ${daysLeft} days`,
+          message: `The free trial of your ${trial.plan} plan ends on ${trial.trial_end_date!.toLocaleDateString('en-KE', { year: 'numeric', month: 'long', day: 'numeric' })}. Add a payment method to keep full access; without one your account becomes read-only.`,
+          priority: daysLeft <= 1 ? 'high' : 'medium',
+          metadata: { subscription_id: trial.id, days_left: daysLeft, trial_end_date: trial.trial_end_date!.toISOString() },
+        });
+        await this.prisma.subscription.update({
+          where: { id: trial.id },
+          // Every reminder at or above the one sent is done
+          data: { trial_reminders_sent: [...new Set([...reminded, ...TRIAL_REMINDER_DAYS.filter(days => days >= due)])], updated_at: now },
+        });
+        sent++;
+      } catch (error: any) {
+        console.error(`❌ Failed to send trial reminder for subscription ${trial.id}:`, error.message);
+      }
+    }
+    return { checked: trials.length, sent };
+  }
+
+  /**
+   * Close out trials past their end date: with a payment method they become active (the gateway
+   * bills from here), without one they expire and the company goes read-only
+   */
+  async expireTrials(now: Date = new Date()) {
+    const ended = await this.prisma.subscription.findMany({
+      where: { status: 'trial', trial_end_date: { lte: now } },
+      select: { id: true, company_id: true, plan: true, payment_method_added_at: true },
+    });
+
+    let converted = 0;
+    let expired = 0;
+    for (const trial of ended) {
+      if (trial.payment_method_added_at) {
+        await this.prisma.subscription.update({
+          where: { id: trial.id },
+          data: { status: 'active', next_billing_date: now, updated_at: now },
+        });
+        converted++;
+        continue;
+      }
+      await this.prisma.subscription.update({
+        where: { id: trial.id },
+        data: { status: 'expired', expired_at: now, next_billing_date: null, updated_at: now },
+      });
+      this.readOnlyCache.delete(trial.company_id);
+      expired++;
+      try {
+        await this.notifyAdmins(trial.company_id, {
+          title: 'Your trial has ended',
+          message: `The free trial of your ${trial.plan} plan has ended and your account is now read-only. Add a payment method to restore full access; your data is kept.`,
+          priority: 'high',
+          metadata: { subscription_id: trial.id },
+        });
+      } catch (error: any) {
+        console.error(`❌ Failed to send trial expiry notice for subscription ${trial.id}:`, error.message);
+      }
+    }
+    return { converted, expired };
+  }
+
+  /**
+   * A payment method was added for the company: record it on its latest subscription and bring
+   * an expired one back
+   */
+  async recordPaymentMethod(companyId: string, details: PaymentMethodDetails = {}) {
+    const subscription = await this.prisma.subscription.findFirst({
+      where: { company_id: companyId, status: { in: ['trial', 'active', 'past_due', 'unpaid', 'expired'] } },
+      orderBy: { created_at: 'desc' },
+    });
+    if (!subscription) {
+      throw new Error('subscription not found');
+    }
+
+    const now = new Date();
+    const reactivated = subscription.status === 'expired';
+    const updated = await this.prisma.subscription.update({
+      where: { id: subscription.id },
+      data: {
+        payment_method_added_at: now,
+        ...(reactivated && { status: 'active', expired_at: null, next_billing_date: now }),
+        metadata: {
+          ...((subscription.metadata as object) || {}),
+          payment_method: {
+            channel: details.channel || null,
+            brand: details.brand || null,
+            last4: details.last4 || null,
+            reference: details.reference || null,
+            authorization_code: details.authorization_code || null,
+            email: details.email || null,
+            added_at: now.toISOString(),
+          },
+          ...(reactivated && { reactivated_at: now.toISOString() }),
+        },
+        updated_at: now,
+      },
+    });
+    this.readOnlyCache.delete(companyId);
+
+    if (reactivated) {
+      try {
+        await this.notifyAdmins(companyId, {
+          title: 'Your account is active again',
+          message: 'Thanks for adding a payment method. Full access to your account has been restored.',
+          priority: 'medium',
+          metadata: { subscription_id: subscription.id },
+        });
+      } catch (error: any) {
+        console.error(`❌ Failed to send reactivation notice for subscription ${subscription.id}:`, error.message);
+      }
+    }
+    return { subscription: updated, reactivated };
+  }
+
+  async getTrialStatus(user: JWTClaims) {
+    if (!user.company_id) {
+      throw new Error('user must belong to a company');
+    }
+    const subscription = await this.prisma.subscription.findFirst({
+      where: { company_id: user.company_id },
+      orderBy: { created_at: 'desc' },
+    });
+    if (!subscription) {
+      throw new Error('subscription not found');
+    }
+    const now = Date.now();
+    const onTrial = subscription.status === 'trial';
+    return {
+      subscription_id: subscription.id,
+      plan: subscription.plan,
+      status: subscription.status,
+      on_trial: onTrial,
+      trial_start_date: subscription.trial_start_date,
+      trial_end_date: subscription.trial_end_date,
+      days_left: onTrial && subscription.trial_end_date ? Math.max(0, Math.ceil((subscription.trial_end_date.getTime() - now) / DAY_MS)) : null,
+      has_payment_method: Boolean(subscription.payment_method_added_at),
+      payment_method: (subscription.metadata as any)?.payment_method || null,
+      read_only: subscription.status === 'expired',
+      expired_at: subscription.expired_at,
+    };
+  }
+
+  /**
+   * Whether the company's latest subscription is an expired trial
+   */
+  async isReadOnly(companyId: string) {
+    const cached = this.readOnlyCache.get(companyId);
+    if (cached && Date.now() - cached.at < READ_ONLY_CACHE_MS) {
+      return cached.readOnly;
+    }
+    const latest = await this.prisma.subscription.findFirst({
+      where: { company_id: companyId },
+      orderBy: { created_at: 'desc' },
+      select: { status: true },
+    });
+    const readOnly = latest?.status === 'expired';
+    this.readOnlyCache.set(companyId, { readOnly, at: Date.now() });
+    return readOnly;
+  }
+
+  private async notifyAdmins(companyId: string, notice: { title: string; message: string; priority: 'medium' | 'high'; metadata: Record<string, any> }) {
+    const { notificationsService } = await import('./notifications.service.js');
+    const admins = await this.prisma.user.findMany({
+      where: { company_id: companyId, role: { in: BILLING_ROLES as any }, status: 'active' },
+      select: { id: true },
+    });
+    for (const admin of admins) {
+      const channels = await notificationsService.resolveChannels(admin.id, 'subscription_trial', ['email'], 'general', notice.priority);
+      await notificationsService.notify({
+        company_id: companyId,
+        recipient_id: admin.id,
+        title: notice.title,
+        message: notice.message,
+        notification_type: 'subscription_trial',
+        category: 'general',
+        priority: notice.priority,
+        action_required: true,
+        action_url: '/settings?tab=subscription',
+        related_entity_type: 'subscription',
+        related_entity_id: notice.metadata.subscription_id,
+        metadata: notice.metadata,
+      }, channels);
+    }
+  }
+}
+
+export const trialsService = new TrialsService();
@@ -0,0 +1,674 @@
+import crypto from 'crypto';
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { emailTemplatesService } from './email-templates.service.js';
+import { TenantsService } from './tenants.service.js';
+import { TenantFlagsService } from './tenant-flags.service.js';
+import { listedPropertyWhere } from './agencies.service.js';
+
+// How long a waiting-list applicant has to apply for an offered unit before it moves to the next person
+const WAITLIST_OFFER_HOURS = 48;
+const REVIEWER_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent'];
+
+export interface SubmitApplicationRequest {
+  first_name: string;
+  last_name: string;
+  email: string;
+  phone_number: string;
+  id_number?: string;
+  occupation?: string;
+  employer?: string;
+  monthly_income?: number;
+  household_size?: number;
+  desired_move_in?: string;
+  message?: string;
+  waitlist_entry_id?: string;
+}
+
+export interface JoinWaitlistRequest {
+  first_name: string;
+  last_name: string;
+  email: string;
+  phone_number: string;
+  unit_type?: string;
+  min_bedrooms?: number;
+  max_rent?: number;
+  notes?: string;
+}
+
+export interface ReviewApplicationRequest {
+  decision: 'under_review' | 'approve' | 'reject';
+  notes?: string;
+  lease_start_date?: string;
+  lease_end_date?: string;
+  lease_type?: string;
+}
+
+export interface ApplicationFilters {
+  status?: string;
+  property_id?: string;
+  unit_id?: string;
+  page?: number;
+  limit?: number;
+}
+
+const isEmail = (value?: string) => !!value && /^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(value);
+
+// Applicants manage their own application or waiting-list place through a link emailed to them;
+// only the hash of its token is stored
+const hashManageToken = (token: string) => crypto.createHash('sha256').update(token).digest('hex');
+const withoutToken = <T extends { manage_token_hash?: string | null }>({ manage_token_hash, ...record }: T) => record;
+
+export class UnitApplicationsService {
+  private prisma = getPrisma();
+  private tenantsService = new TenantsService();
+  private tenantFlagsService = new TenantFlagsService();
+
+  private assertCanReview(user: JWTClaims) {
+    if (!REVIEWER_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to manage applications');
+    }
+  }
+
+  private companyScope(user: JWTClaims) {
+    return user.role === 'super_admin' ? {} : { company_id: user.company_id as string };
+  }
+
+  private validateContact(req: { first_name?: string; last_name?: string; email?: string; phone_number?: string }) {
+    if (!req.first_name?.trim() || !req.last_name?.trim()) {
+      throw new Error('first_name and last_name are required');
+    }
+    if (!isEmail(req.email)) {
+      throw new Error('a valid email is required');
+    }
+    if (!req.phone_number || !/^\+?[0-9\s-]{7,20}$/.test(req.phone_number)) {
+      throw new Error('a valid phone_number is required');
+    }
+  }
+
+  /**
+   * Vacant units of a property that prospective tenants can apply for
+   */
+  async getPublicVacancies(propertyId: string): Promise<any> {
+    const property = await this.prisma.property.findFirst({
+      where: { id: propertyId, status: 'active' as any, ...listedPropertyWhere },
+      select: { id: true, name: true, street: true, city: true, region: true, amenities: true, images: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+
+    const units = await this.prisma.unit.findMany({
+      where: { property_id: propertyId, status: 'vacant' as any },
+      select: {
+        id: true,
+        unit_number: true,
+        unit_type: true,
+        number_of_bedrooms: true,
+        number_of_bathrooms: true,
+        furnishing_type: true,
+        rent_amount: true,
+        deposit_amount: true,
+        currency: true,
+        images: true,
+      },
+      orderBy: { unit_number: 'asc' },
+    });
+
+    return { property, units };
+  }
+
+  /**
+   * Submit an application for a vacant unit. Open to the public; signed-in users are linked.
+   */
+  async submitApplication(unitId: string, req: SubmitApplicationRequest, applicant?: JWTClaims): Promise<any> {
+    this.validateContact(req);
+
+    const unit = await this.prisma.unit.findUnique({
+      where: { id: unitId },
+      include: {
+        property: { select: { id: true, name: true, owner_id: true, status: true, agency: { select: { status: true } } } },
+      },
+    });
+    // Units of a suspended or deactivated agency are off the listings
+    const agencyListed = !unit?.property.agency || !['suspended', 'inactive'].includes(unit.property.agency.status);
+    if (!unit || unit.property.status !== 'active' || !agencyListed) {
+      throw new Error('unit not found');
+    }
+    if (unit.status !== 'vacant') {
+      throw new Error('unit is not available for applications');
+    }
+
+    const email = req.email.trim().toLowerCase();
+    const duplicate = await this.prisma.unitApplication.findFirst({
+      where: { unit_id: unitId, email, status: { in: ['pending', 'under_review'] } },
+    });
+    if (duplicate) {
+      throw new Error('you have already applied for this unit');
+    }
+
+    if (req.waitlist_entry_id) {
+      // An offer is personal: only the person it was made to can apply with it
+      const entry = await this.prisma.propertyWaitlistEntry.findFirst({
+        where: {
+          id: req.waitlist_entry_id,
+          offered_unit_id: unitId,
+          status: 'offered',
+          email: { equals: email, mode: 'insensitive' },
+        },
+      });
+      if (!entry) {
+        throw new Error('waiting list offer not found or has expired');
+      }
+    }
+
+    const manageToken = crypto.randomBytes(32).toString('hex');
+    const application = await this.prisma.unitApplication.create({
+      data: {
+        company_id: unit.company_id,
+        property_id: unit.property_id,
+        unit_id: unit.id,
+        waitlist_entry_id: req.waitlist_entry_id || null,
+        applicant_id: applicant?.user_id || null,
+        first_name: req.first_name.trim(),
+        last_name: req.last_name.trim(),
+        email,
+        phone_number: req.phone_number.trim(),
+        id_number: req.id_number || null,
+        occupation: req.occupation || null,
+        employer: req.employer || null,
+        monthly_income: req.monthly_income ?? null,
+        household_size: req.household_size ?? null,
+        desired_move_in: req.desired_move_in ? new Date(req.desired_move_in) : null,
+        message: req.message || null,
+        manage_token_hash: hashManageToken(manageToken),
+      },
+    });
+
+    if (req.waitlist_entry_id) {
+      await this.prisma.propertyWaitlistEntry.update({
+        where: { id: req.waitlist_entry_id },
+        data: { status: 'applied', updated_at: new Date() },
+      });
+    }
+
+    const { notificationsService } = await import('./notifications.service.js');
+    await notificationsService.notify({
+      company_id: unit.company_id,
+      recipient_id: unit.property.owner_id,
+      property_id: unit.property_id,
+      unit_id: unit.id,
+      title: 'New unit application',
+      message: `${application.first_name} ${application.last_name} applied for unit ${unit.unit_number} at ${unit.property.name}.`,
+      notification_type: 'application',
+      category: 'tenant',
+      action_required: true,
+      related_entity_type: 'unit_application',
+      related_entity_id: application.id,
+    }).catch(error => console.error('⚠️ Failed to notify owner about application:', error.message));
+
+    await this.sendApplicantEmail('application_received', application, {
+      applicant_name: application.first_name,
+      property_name: unit.property.name,
+      unit_number: unit.unit_number,
+      reference: application.id,
+      withdraw_url: `${env.appUrl}/applications/${application.id}/withdraw?token=${manageToken}`,
+    });
+
+    return withoutToken(application);
+  }
+
+  /**
+   * Applicant withdraws their own application with the token from their confirmation email
+   */
+  async withdrawApplication(applicationId: string, token: string): Promise<any> {
+    if (!token) {
+      throw new Error('token is required');
+    }
+    const application = await this.prisma.unitApplication.findFirst({
+      where: { id: applicationId, manage_token_hash: hashManageToken(token) },
+    });
+    if (!application) {
+      throw new Error('application not found');
+    }
+    if (!['pending', 'under_review'].includes(application.status)) {
+      throw new Error(`application is already ${application.status}`);
+    }
+
+    const withdrawn = await this.prisma.unitApplication.update({
+      where: { id: application.id },
+      data: { status: 'withdrawn', updated_at: new Date() },
+    });
+    await this.returnToWaitlist(application);
+    return withoutToken(withdrawn);
+  }
+
+  async listApplications(filters: ApplicationFilters, user: JWTClaims): Promise<any> {
+    this.assertCanReview(user);
+
+    const page = Math.max(1, Number(filters.page) || 1);
+    const limit = Math.min(100, Math.max(1, Number(filters.limit) || 20));
+    const where: any = {
+      ...this.companyScope(user),
+      ...(filters.status && { status: filters.status }),
+      ...(filters.property_id && { property_id: filters.property_id }),
+      ...(filters.unit_id && { unit_id: filters.unit_id }),
+    };
+
+    const [applications, total] = await Promise.all([
+      this.prisma.unitApplication.findMany({
+        where,
+        include: {
+          unit: { select: { id: true, unit_number: true, rent_amount: true, status: true } },
+          property: { select: { id: true, name: true } },
+        },
+        orderBy: { created_at: 'desc' },
+        skip: (page - 1) * limit,
+        take: limit,
+      }),
+      this.prisma.unitApplication.count({ where }),
+    ]);
+
+    return {
+      applications: applications.map(withoutToken),
+      pagination: { page, limit, total, totalPages: Math.ceil(total / limit) },
+    };
+  }
+
+  /**
+   * Application detail with tenant-flag screening for the applicant
+   */
+  async getApplication(applicationId: string, user: JWTClaims): Promise<any> {
+    this.assertCanReview(user);
+
+    const application = await this.prisma.unitApplication.findFirst({
+      where: { id: applicationId, ...this.companyScope(user) },
+      include: {
+        unit: { select: { id: true, unit_number: true, rent_amount: true, deposit_amount: true, status: true } },
+        property: { select: { id: true, name: true } },
+      },
+    });
+    if (!application) {
+      throw new Error('application not found');
+    }
+
+    const screening = await this.tenantFlagsService.screenProspect(
+      { email: application.email, phone: application.phone_number, id_number: application.id_number || undefined },
+      user
+    );
+
+    const income = Number(application.monthly_income || 0);
+    const rent = Number(application.unit.rent_amount);
+    return {
+      ...withoutToken(application),
+      screening,
+      rent_to_income_ratio: income > 0 ? Math.round((rent / income) * 100) / 100 : null,
+    };
+  }
+
+  /**
+   * Move an application forward. Approval creates (or reuses) the tenant account, assigns the
+   * unit and closes the remaining applications for that unit.
+   */
+  async reviewApplication(applicationId: string, req: ReviewApplicationRequest, user: JWTClaims): Promise<any> {
+    this.assertCanReview(user);
+    if (!['under_review', 'approve', 'reject'].includes(req.decision)) {
+      throw new Error("decision must be 'under_review', 'approve' or 'reject'");
+    }
+
+    const application = await this.prisma.unitApplication.findFirst({
+      where: { id: applicationId, ...this.companyScope(user) },
+      include: { unit: true, property: { select: { id: true, name: true } } },
+    });
+    if (!application) {
+      throw new Error('application not found');
+    }
+    if (!['pending', 'under_review'].includes(application.status)) {
+      throw new Error(`application is already ${application.status}`);
+    }
+
+    if (req.decision === 'under_review') {
+      const underReview = await this.prisma.unitApplication.update({
+        where: { id: application.id },
+        data: { status: 'under_review', review_notes: req.notes || application.review_notes, updated_at: new Date() },
+      });
+      return withoutToken(underReview);
+    }
+
+    if (req.decision === 'reject') {
+      const rejected = await this.prisma.unitApplication.update({
+        where: { id: application.id },
+        data: {
+          status: 'rejected',
+          review_notes: req.notes || null,
+          reviewed_by: user.user_id,
+          reviewed_at: new Date(),
+          updated_at: new Date(),
+        },
+      });
+      await this.sendApplicantEmail('application_unsuccessful', application, {
+        applicant_name: application.first_name,
+        property_name: application.property.name,
+        unit_number: application.unit.unit_number,
+      });
+      await this.returnToWaitlist(application);
+      return withoutToken(rejected);
+    }
+
+    if (application.unit.status !== 'vacant') {
+      throw new Error('unit is not available for tenant assignment');
+    }
+
+    const leaseStart = req.lease_start_date
+      || (application.desired_move_in ? application.desired_move_in.toISOString().split('T')[0] : undefined);
+    const existingUser = await this.prisma.user.findUnique({ where: { email: application.email } });
+
+    let tenantId: string;
+    if (existingUser) {
+      if (existingUser.role !== 'tenant') {
+        throw new Error('applicant email belongs to a non-tenant account');
+      }
+      const start = leaseStart || new Date().toISOString().split('T')[0];
+      await this.tenantsService.assignUnit(existingUser.id, {
+        unit_id: application.unit_id,
+        lease_start_date: start,
+        lease_end_date: req.lease_end_date
+          || new Date(new Date(start).getTime() + 365 * 24 * 60 * 60 * 1000).toISOString().split('T')[0],
+        lease_type: req.lease_type || 'fixed_term',
+      }, user);
+      tenantId = existingUser.id;
+    } else {
+      const tenant = await this.tenantsService.createTenant({
+        email: application.email,
+        first_name: application.first_name,
+        last_name: application.last_name,
+        phone_number: application.phone_number,
+        id_number: application.id_number || undefined,
+        unit_id: application.unit_id,
+        property_id: application.property_id,
+        lease_start_date: leaseStart,
+        lease_end_date: req.lease_end_date,
+        lease_type: req.lease_type,
+        send_invitation: true,
+      }, user);
+      tenantId = tenant.id;
+    }
+
+    const approved = await this.prisma.unitApplication.update({
+      where: { id: application.id },
+      data: {
+        status: 'approved',
+        tenant_id: tenantId,
+        review_notes: req.notes || null,
+        reviewed_by: user.user_id,
+        reviewed_at: new Date(),
+        updated_at: new Date(),
+      },
+    });
+
+    await this.closeUnitApplications(application.unit_id, application.id, application.property.name, application.unit.unit_number);
+
+    return withoutToken(approved);
+  }
+
+  /**
+   * Once a unit is let: reject the other open applications and return un-used offers to the queue
+   */
+  private async closeUnitApplications(unitId: string, approvedId: string, propertyName: string, unitNumber: string) {
+    const others = await this.prisma.unitApplication.findMany({
+      where: { unit_id: unitId, id: { not: approvedId }, status: { in: ['pending', 'under_review'] } },
+    });
+
+    if (others.length > 0) {
+      await this.prisma.unitApplication.updateMany({
+        where: { id: { in: others.map(a => a.id) } },
+        data: { status: 'rejected', review_notes: 'Unit has been let to another applicant', updated_at: new Date() },
+      });
+      for (const other of others) {
+        await this.sendApplicantEmail('application_unit_let', other, {
+          applicant_name: other.first_name,
+          property_name: propertyName,
+          unit_number: unitNumber,
+        });
+        await this.returnToWaitlist(other);
+      }
+    }
+
+    await this.prisma.propertyWaitlistEntry.updateMany({
+      where: { offered_unit_id: unitId, status: 'offered' },
+      data: { status: 'waiting', offered_unit_id: null, offered_at: null, offer_expires_at: null, updated_at: new Date() },
+    });
+  }
+
+  /**
+   * An application made from a waiting-list offer came to nothing (rejected, withdrawn or the unit
+   * let to someone else): the person keeps their place in the queue, and a still-vacant unit is
+   * offered to the next in line
+   */
+  private async returnToWaitlist(application: { unit_id: string; waitlist_entry_id: string | null }) {
+    if (!application.waitlist_entry_id) {
+      return;
+    }
+    await this.prisma.propertyWaitlistEntry.updateMany({
+      where: { id: application.waitlist_entry_id, status: 'applied' },
+      data: { status: 'waiting', offered_unit_id: null, offered_at: null, offer_expires_at: null, updated_at: new Date() },
+    });
+    await this.notifyUnitVacated(application.unit_id, application.waitlist_entry_id);
+  }
+
+  /**
+   * Join a property's waiting list. Open to the public.
+   */
+  async joinWaitlist(propertyId: string, req: JoinWaitlistRequest, applicant?: JWTClaims): Promise<any> {
+    this.validateContact(req);
+
+    const property = await this.prisma.property.findFirst({
+      where: { id: propertyId, status: 'active' as any },
+      select: { id: true, name: true, company_id: true },
+    });
+    if (!property) {
+      throw new Error('property not found');
+    }
+
+    const email = req.email.trim().toLowerCase();
+    const existing = await this.prisma.propertyWaitlistEntry.findFirst({
+      where: { property_id: propertyId, email, status: { in: ['waiting', 'offered'] } },
+    });
+    if (existing) {
+      throw new Error('you are already on the waiting list for this property');
+    }
+
+    const manageToken = crypto.randomBytes(32).toString('hex');
+    const entry = await this.prisma.propertyWaitlistEntry.create({
+      data: {
+        company_id: property.company_id,
+        property_id: property.id,
+        applicant_id: applicant?.user_id || null,
+        first_name: req.first_name.trim(),
+        last_name: req.last_name.trim(),
+        email,
+        phone_number: req.phone_number.trim(),
+        unit_type: req.unit_type || null,
+        min_bedrooms: req.min_bedrooms ?? null,
+        max_rent: req.max_rent ?? null,
+        notes: req.notes || null,
+        manage_token_hash: hashManageToken(manageToken),
+      },
+    });
+
+    const position = await this.prisma.propertyWaitlistEntry.count({
+      where: { property_id: propertyId, status: 'waiting', created_at: { lte: entry.created_at } },
+    });
+
+    await this.sendApplicantEmail('waitlist_joined', entry, {
+      applicant_name: entry.first_name,
+      property_name: property.name,
+      position,
+      leave_url: `${env.appUrl}/waitlist/${entry.id}/leave?token=${manageToken}`,
+    });
+
+    return { ...withoutToken(entry), position };
+  }
+
+  /**
+   * Applicant leaves a waiting list with the token from their confirmation email
+   */
+  async leaveWaitlist(entryId: string, token: string): Promise<void> {
+    if (!token) {
+      throw new Error('token is required');
+    }
+    const result = await this.prisma.propertyWaitlistEntry.updateMany({
+      where: { id: entryId, manage_token_hash: hashManageToken(token), status: { in: ['waiting', 'offered'] } },
+      data: { status: 'removed', updated_at: new Date() },
+    });
+    if (result.count === 0) {
+      throw new Error('waiting list entry not found');
+    }
+  }
+
+  async getWaitlist(propertyId: string, user: JWTClaims): Promise<any[]> {
+    this.assertCanReview(user);
+
+    const entries = await this.prisma.propertyWaitlistEntry.findMany({
+      where: { property_id: propertyId, ...this.companyScope(user), status: { in: ['waiting', 'offered'] } },
+      include: { offered_unit: { select: { id: true, unit_number: true } } },
+      orderBy: { created_at: 'asc' },
+    });
+
+    return entries.map((entry, index) => ({ ...withoutToken(entry), position: index + 1 }));
+  }
+
+  async removeWaitlistEntry(entryId: string, user: JWTClaims): Promise<void> {
+    this.assertCanReview(user);
+
+    const result = await this.prisma.propertyWaitlistEntry.updateMany({
+      where: { id: entryId, ...this.companyScope(user), status: { in: ['waiting', 'offered'] } },
+      data: { status: 'removed', updated_at: new Date() },
+    });
+    if (result.count === 0) {
+      throw new Error('waiting list entry not found');
+    }
+  }
+
+  /**
+   * Offer a newly vacant unit to the next matching person on the property's waiting list, passing
+   * over `skipEntryId` (someone whose application for it just fell through).
+   * Called from the lease/tenant flows that free a unit; never throws.
+   */
+  async notifyUnitVacated(unitId: string, skipEntryId?: string): Promise<void> {
+    try {
+      const unit = await this.prisma.unit.findUnique({
+        where: { id: unitId },
+        include: { property: { select: { id: true, name: true } } },
+      });
+      if (!unit || unit.status !== 'vacant') {
+        return;
+      }
+
+      const openOffer = await this.prisma.propertyWaitlistEntry.findFirst({
+        where: { offered_unit_id: unitId, status: 'offered' },
+      });
+      if (openOffer) {
+        return;
+      }
+
+      const rent = Number(unit.rent_amount);
+      const candidates = await this.prisma.propertyWaitlistEntry.findMany({
+        where: { property_id: unit.property_id, status: 'waiting', ...(skipEntryId && { id: { not: skipEntryId } }) },
+        orderBy: { created_at: 'asc' },
+      });
+      const next = candidates.find(entry =>
+        (!entry.unit_type || entry.unit_type === unit.unit_type) &&
+        (entry.min_bedrooms == null || (unit.number_of_bedrooms ?? 0) >= entry.min_bedrooms) &&
+        (entry.max_rent == null || Number(entry.max_rent) >= rent)
+      );
+      if (!next) {
+        return;
+      }
+
+      const expiresAt = new Date(Date.now() + WAITLIST_OFFER_HOURS * 60 * 60 * 1000);
+      await this.prisma.propertyWaitlistEntry.update({
+        where: { id: next.id },
+        data: {
+          status: 'offered',
+          offered_unit_id: unit.id,
+          offered_at: new Date(),
+          offer_expires_at: expiresAt,
+          updated_at: new Date(),
+        },
+      });
+
+      const applyUrl = `${env.appUrl}/apply/${unit.id}?waitlist=${next.id}`;
+      await this.sendApplicantEmail('waitlist_offer', next, {
+        applicant_name: next.first_name,
+        property_name: unit.property.name,
+        unit_number: unit.unit_number,
+        currency: unit.currency,
+        rent,
+        expires_at: expiresAt.toLocaleString(),
+        apply_url: applyUrl,
+      });
+
+      if (next.applicant_id) {
+        const { notificationsService } = await import('./notifications.service.js');
+        await notificationsService.notify({
+          company_id: unit.company_id,
+          recipient_id: next.applicant_id,
+          property_id: unit.property_id,
+          unit_id: unit.id,
+          title: 'A unit you are waiting for is available',
+          message: `Unit ${unit.unit_number} at ${unit.property.name} is available. Apply within ${WAITLIST_OFFER_HOURS} hours to keep your place.`,
+          notification_type: 'waitlist',
+          category: 'tenant',
+          priority: 'high',
+          action_required: true,
+          action_url: applyUrl,
+        });
+      }
+
+      console.log(`📬 Offered unit ${unit.unit_number} to waiting list entry ${next.id}`);
+    } catch (error: any) {
+      console.error(`⚠️ Failed to process waiting list for unit ${unitId}:`, error.message);
+    }
+  }
+
+  /**
+   * Expire unanswered waiting-list offers and pass the units on to the next person
+   */
+  async expireWaitlistOffers(): Promise<{ expired: number }> {
+    const expired = await this.prisma.propertyWaitlistEntry.findMany({
+      where: { status: 'offered', offer_expires_at: { lt: new Date() } },
+      select: { id: true, offered_unit_id: true },
+    });
+
+    for (const entry of expired) {
+      await this.prisma.propertyWaitlistEntry.update({
+        where: { id: entry.id },
+        data: { status: 'expired', updated_at: new Date() },
+      });
+      if (entry.offered_unit_id) {
+        await this.notifyUnitVacated(entry.offered_unit_id);
+      }
+    }
+
+    return { expired: expired.length };
+  }
+
+  private async sendApplicantEmail(
+    template: string,
+    applicant: { email: string; company_id: string; applicant_id: string | null },
+    variables: Record<string, any>
+  ) {
+    try {
+      await emailTemplatesService.send(template, {
+        to: applicant.email,
+        recipientId: applicant.applicant_id,
+        companyId: applicant.company_id,
+        variables,
+      });
+    } catch (error: any) {
+      console.error(`⚠️ Failed to send ${template} email to ${applicant.email}:`, error.message);
+    }
+  }
+}
@@ -0,0 +1,187 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+import { imagekitService } from './imagekit.service.js';
+import { UnitsService } from './units.service.js';
+import { UnitActivityService } from './unit-activity.service.js';
+
+export interface UnitPhotoFile {
+  buffer: Buffer;
+  originalname: string;
+  mimetype: string;
+  size: number;
+}
+
+export interface UnitPhotoInput {
+  caption?: string;
+  category?: string;
+}
+
+/**
+ * unit_photos is the source of truth; Unit.images is kept as a denormalised copy
+ * (url/fileId/name/isPrimary) for the listing and tenant-facing screens that read it.
+ */
+export class UnitPhotosService {
+  private prisma = getPrisma();
+  private unitsService = new UnitsService();
+  private unitActivityService = new UnitActivityService();
+
+  async listPhotos(unitId: string, user: JWTClaims) {
+    await this.unitsService.getUnit(unitId, user);
+    return this.prisma.unitPhoto.findMany({
+      where: { unit_id: unitId },
+      orderBy: [{ is_primary: 'desc' }, { created_at: 'asc' }],
+    });
+  }
+
+  async uploadPhotos(unitId: string, files: UnitPhotoFile[], input: UnitPhotoInput, user: JWTClaims) {
+    const unit = await this.unitsService.getUnit(unitId, user);
+    if (!files || files.length === 0) {
+      throw new Error('at least one image is required');
+    }
+
+    const hasPrimary = (await this.prisma.unitPhoto.count({ where: { unit_id: unitId, is_primary: true } })) > 0;
+    const uploaded: { file: UnitPhotoFile; url: string; fileId: string; name: string }[] = [];
+    try {
+      for (const [index, file] of files.entries()) {
+        const result = await imagekitService.uploadFile(file.buffer, `unit-${unitId}-${Date.now()}-${index}`, `units/${unitId}`);
+        uploaded.push({ file, ...result });
+      }
+    } catch (error) {
+      // Don't leave orphaned files behind when part of the batch fails
+      await Promise.allSettled(uploaded.map(item => imagekitService.deleteFile(item.fileId)));
+      throw error;
+    }
+
+    const photos = await this.prisma.$transaction(uploaded.map((item, index) =>
+      this.prisma.unitPhoto.create({
+        data: {
+          unit_id: unitId,
+          company_id: unit.company_id,
+          file_id: item.fileId,
+          url: item.url,
+          thumbnail_url: imagekitService.thumbnailUrl(item.url, item.file.mimetype),
+          name: item.name,
+          caption: input.caption || null,
+          category: input.category || null,
+          is_primary: !hasPrimary && index === 0,
+          file_size: item.file.size,
+          mime_type: item.file.mimetype,
+          uploaded_by: user.user_id,
+        },
+      })));
+
+    const total = await this.syncUnitImages(unitId);
+    await this.unitActivityService.logActivity({
+      unit_id: unitId,
+      company_id: unit.company_id,
+      actor_id: user.user_id,
+      event_type: 'photos_uploaded',
+      title: 'Photos uploaded',
+      description: `${photos.length} photo${photos.length === 1 ? '' : 's'} added`,
+      metadata: { photo_ids: photos.map(photo => photo.id), category: input.category || null },
+    });
+    return { photos, total };
+  }
+
+  /**
+   * photoId may be the unit_photos id or the ImageKit file id (what Unit.images exposes)
+   */
+  async deletePhoto(unitId: string, photoId: string, user: JWTClaims) {
+    const result = await this.deletePhotos(unitId, [photoId], user);
+    if (result.deleted.length === 0) {
+      throw new Error('photo not found');
+    }
+    return result;
+  }
+
+  async deletePhotos(unitId: string, photoIds: string[], user: JWTClaims) {
+    const unit = await this.unitsService.getUnit(unitId, user);
+    if (!Array.isArray(photoIds) || photoIds.length === 0) {
+      throw new Error('image_ids are required');
+    }
+
+    const uuids = photoIds.filter(id => /^[0-9a-f-]{36}$/i.test(id));
+    const photos = await this.prisma.unitPhoto.findMany({
+      where: {
+        unit_id: unitId,
+        OR: [
+          ...(uuids.length ? [{ id: { in: uuids } }] : []),
+          { file_id: { in: photoIds } },
+        ],
+      },
+    });
+    if (photos.length === 0) {
+      return { deleted: [], remaining: await this.prisma.unitPhoto.count({ where: { unit_id: unitId } }) };
+    }
+
+    for (const photo of photos) {
+      try {
+        await imagekitService.deleteFile(photo.file_id);
+      } catch (error: any) {
+        // The file may already be gone from storage; the record should still go
+        console.error(`⚠️ Failed to delete unit photo ${photo.file_id} from storage:`, error.message);
+      }
+    }
+    await this.prisma.unitPhoto.deleteMany({ where: { id: { in: photos.map(photo => photo.id) } } });
+
+    if (photos.some(photo => photo.is_primary)) {
+      const next = await this.prisma.unitPhoto.findFirst({ where: { unit_id: unitId }, orderBy: { created_at: 'asc' } });
+      if (next) {
+        await this.prisma.unitPhoto.update({ where: { id: next.id }, data: { is_primary: true } });
+      }
+    }
+
+    const remaining = await this.syncUnitImages(unitId);
+    await this.unitActivityService.logActivity({
+      unit_id: unitId,
+      company_id: unit.company_id,
+      actor_id: user.user_id,
+      event_type: 'photos_deleted',
+      title: 'Photos deleted',
+      description: `${photos.length} photo${photos.length === 1 ? '' : 's'} removed`,
+      metadata: { photo_ids: photos.map(photo => photo.id) },
+    });
+    return { deleted: photos.map(photo => photo.id), remaining };
+  }
+
+  async setPrimaryPhoto(unitId: string, photoId: string, user: JWTClaims) {
+    await this.unitsService.getUnit(unitId, user);
+    const photo = await this.prisma.unitPhoto.findFirst({
+      where: { unit_id: unitId, OR: [{ file_id: photoId }, ...(/^[0-9a-f-]{36}$/i.test(photoId) ? [{ id: photoId }] : [])] },
+    });
+    if (!photo) {
+      throw new Error('photo not found');
+    }
+    await this.prisma.$transaction([
+      this.prisma.unitPhoto.updateMany({ where: { unit_id: unitId, is_primary: true }, data: { is_primary: false } }),
+      this.prisma.unitPhoto.update({ where: { id: photo.id }, data: { is_primary: true } }),
+    ]);
+    await this.syncUnitImages(unitId);
+    return { ...photo, is_primary: true };
+  }
+
+  private async syncUnitImages(unitId: string): Promise<number> {
+    const photos = await this.prisma.unitPhoto.findMany({
+      where: { unit_id: unitId },
+      orderBy: [{ is_primary: 'desc' }, { created_at: 'asc' }],
+    });
+    await this.prisma.unit.update({
+      where: { id: unitId },
+      data: {
+        images: photos.map(photo => ({
+          id: photo.id,
+          url: photo.url,
+          thumbnailUrl: photo.thumbnail_url,
+          fileId: photo.file_id,
+          name: photo.name,
+          caption: photo.caption,
+          isPrimary: photo.is_primary,
+        })),
+        updated_at: new Date(),
+      },
+    });
+    return photos.length;
+  }
+}
+
+export const unitPhotosService = new UnitPhotosService();
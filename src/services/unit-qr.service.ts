@@ -0,0 +1,195 @@
+import crypto from 'crypto';
+import { getPrisma } from '../config/prisma.js';
+import { env } from '../config/env.js';
+import { JWTClaims } from '../types/index.js';
+import { UnitsService } from './units.service.js';
+import { verificationService } from './verification.service.js';
+import { distanceInMeters, DEFAULT_GEOFENCE_METERS } from './task-location.service.js';
+
+export interface ProcessUnitQrRequest {
+  code: string;
+  purpose: string;
+  latitude?: number;
+  longitude?: number;
+  accuracy?: number;
+  inspection_id?: string;
+  task_id?: string;
+  notes?: string;
+}
+
+export interface ScanHistoryFilters {
+  purpose?: string;
+  scanned_by?: string;
+  from?: string;
+  to?: string;
+  page?: string;
+  limit?: string;
+}
+
+export const SCAN_PURPOSES = ['inspection', 'cleaning', 'maintenance', 'security_patrol', 'meter_reading', 'other'];
+const SCAN_ROLES = ['super_admin', 'agency_admin', 'landlord', 'agent', 'caretaker', 'cleaner', 'security', 'maintenance'];
+
+/**
+ * Printable unit QR codes and the scan log behind them, used as proof of presence for
+ * inspections, cleaning rounds and patrols
+ */
+export class UnitQrService {
+  private prisma = getPrisma();
+  private unitsService = new UnitsService();
+
+  scanUrl(token: string): string {
+    return `${env.appUrl}/scan/unit/${token}`;
+  }
+
+  /**
+   * The unit's QR code, issuing a token on first use; `rotate` invalidates printed codes
+   */
+  async getUnitQr(unitId: string, user: JWTClaims, rotate = false) {
+    const unit = await this.unitsService.getUnit(unitId, user);
+    let token: string | null = unit.qr_token;
+    if (!token || rotate) {
+      token = crypto.randomBytes(16).toString('hex');
+      await this.prisma.unit.update({ where: { id: unit.id }, data: { qr_token: token, updated_at: new Date() } });
+    }
+    const url = this.scanUrl(token);
+    return {
+      unit_id: unit.id,
+      unit_number: unit.unit_number,
+      property_name: unit.property?.name,
+      url,
+      qr_code: await verificationService.generateQRCodeDataUrl(url),
+      qr_svg: await verificationService.generateQRCodeSvg(url),
+    };
+  }
+
+  /**
+   * Resolve a scanned code to its unit and record who scanned it, when, where and why
+   */
+  async processUnitQr(req: ProcessUnitQrRequest, user: JWTClaims) {
+    if (!SCAN_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to scan unit codes');
+    }
+    if (!req.code || !req.purpose) {
+      throw new Error('code and purpose are required');
+    }
+    if (!SCAN_PURPOSES.includes(req.purpose)) {
+      throw new Error(`purpose must be one of: ${SCAN_PURPOSES.join(', ')}`);
+    }
+
+    // Accept either the full scan URL or the bare token
+    const token = req.code.trim().split('/').pop()!.split('?')[0];
+    const unit = await this.prisma.unit.findUnique({
+      where: { qr_token: token },
+      select: {
+        id: true,
+        company_id: true,
+        unit_number: true,
+        status: true,
+        property_id: true,
+        property: { select: { id: true, name: true, latitude: true, longitude: true, geofence_radius_meters: true } },
+        current_tenant: { select: { id: true, first_name: true, last_name: true } },
+      },
+    });
+    if (!unit || (user.role !== 'super_admin' && unit.company_id !== user.company_id)) {
+      throw new Error('unit code not recognised');
+    }
+
+    if (req.inspection_id) {
+      const inspection = await this.prisma.inspection.findFirst({ where: { id: req.inspection_id, unit_id: unit.id }, select: { id: true } });
+      if (!inspection) {
+        throw new Error('inspection not found for this unit');
+      }
+    }
+    if (req.task_id) {
+      const task = await this.prisma.task.findFirst({
+        where: { id: req.task_id, company_id: unit.company_id, OR: [{ unit_id: unit.id }, { unit_id: null, property_id: unit.property_id }] },
+        select: { id: true },
+      });
+      if (!task) {
+        throw new Error('task not found for this unit');
+      }
+    }
+
+    let latitude: number | null = null;
+    let longitude: number | null = null;
+    let distance: number | null = null;
+    let withinGeofence: boolean | null = null;
+    if (req.latitude != null && req.longitude != null) {
+      latitude = Number(req.latitude);
+      longitude = Number(req.longitude);
+      if (isNaN(latitude) || isNaN(longitude) || Math.abs(latitude) > 90 || Math.abs(longitude) > 180) {
+        throw new Error('latitude and longitude must be valid coordinates');
+      }
+      if (unit.property.latitude != null && unit.property.longitude != null) {
+        distance = Math.round(distanceInMeters(latitude, longitude, Number(unit.property.latitude), Number(unit.property.longitude)));
+        withinGeofence = distance <= (unit.property.geofence_radius_meters || DEFAULT_GEOFENCE_METERS) + Math.min(Number(req.accuracy) || 0, 100);
+      }
+    }
+
+    const scan = await this.prisma.unitQrScan.create({
+      data: {
+        unit_id: unit.id,
+        company_id: unit.company_id,
+        scanned_by: user.user_id,
+        purpose: req.purpose,
+        latitude,
+        longitude,
+        accuracy_meters: req.accuracy != null ? Number(req.accuracy) : null,
+        distance_meters: distance,
+        within_geofence: withinGeofence,
+        inspection_id: req.inspection_id || null,
+        task_id: req.task_id || null,
+        notes: req.notes || null,
+      },
+    });
+
+    return {
+      scan,
+      unit: {
+        id: unit.id,
+        unit_number: unit.unit_number,
+        status: unit.status,
+        property: { id: unit.property.id, name: unit.property.name },
+        current_tenant: unit.current_tenant,
+      },
+    };
+  }
+
+  async getScanHistory(unitId: string, filters: ScanHistoryFilters, user: JWTClaims) {
+    await this.unitsService.getUnit(unitId, user);
+    const limit = Math.min(parseInt(filters.limit || '50', 10) || 50, 200);
+    const page = Math.max(parseInt(filters.page || '1', 10) || 1, 1);
+    const from = filters.from ? new Date(filters.from) : undefined;
+    const to = filters.to ? new Date(filters.to) : undefined;
+    if ((from && isNaN(from.getTime())) || (to && isNaN(to.getTime()))) {
+      throw new Error('from and to must be valid dates');
+    }
+
+    const where: any = {
+      unit_id: unitId,
+      ...(filters.purpose && { purpose: filters.purpose }),
+      ...(filters.scanned_by && { scanned_by: filters.scanned_by }),
+      ...((from || to) && { scanned_at: { ...(from && { gte: from }), ...(to && { lte: to }) } }),
+    };
+    const [scans, total] = await Promise.all([
+      this.prisma.unitQrScan.findMany({ where, orderBy: { scanned_at: 'desc' }, skip: (page - 1) * limit, take: limit }),
+      this.prisma.unitQrScan.count({ where }),
+    ]);
+
+    const scannerIds = [...new Set(scans.map(scan => scan.scanned_by))];
+    const scanners = await this.prisma.user.findMany({
+      where: { id: { in: scannerIds } },
+      select: { id: true, first_name: true, last_name: true, role: true },
+    });
+    const byId = new Map(scanners.map(scanner => [scanner.id, scanner]));
+
+    return {
+      scans: scans.map(scan => ({ ...scan, scanner: byId.get(scan.scanned_by) || null })),
+      total,
+      page,
+      limit,
+    };
+  }
+}
+
+export const unitQrService = new UnitQrService();
@@ -1,7 +1,9 @@
 import { getPrisma } from '../config/prisma.js';
 import { JWTClaims } from '../types/index.js';
+import { parsePublicUrl } from '../utils/public-fetch.js';
 import { LeasesService, CreateLeaseRequest } from './leases.service.js';
 import { UsersService } from './users.service.js';
+import { listedPropertyWhere } from './agencies.service.js';
 
 export interface UnitFilters {
   property_id?: string;
@@ -94,6 +96,12 @@ export interface UpdateUnitRequest {
   in_unit_amenities?: string[];
   appliances?: string[];
   images?: any[];
+  short_stay_enabled?: boolean;
+  nightly_rate?: number | null;
+  weekly_rate?: number | null;
+  cleaning_fee?: number | null;
+  min_stay_nights?: number;
+  ical_import_url?: string | null;
 }
 
 export interface AssignTenantRequest {
@@ -168,6 +176,7 @@ function mapUnitCondition(frontendCondition: string): string {
 
 export class UnitsService {
   private prisma = getPrisma();
+
   private leasesService = new LeasesService();
   private usersService = new UsersService();
 
@@ -312,6 +321,7 @@ export class UnitsService {
         leases: {
           where: {
             status: 'active',
+            lease_type: { not: 'short_stay' },
           },
           select: {
             id: true,
@@ -484,6 +494,24 @@ export class UnitsService {
       }
     }
 
+    // Short stays are only offered on furnished units with a nightly rate
+    const shortStayEnabled = req.short_stay_enabled ?? existingUnit.short_stay_enabled;
+    if (shortStayEnabled) {
+      const furnishing = req.furnishing_type || existingUnit.furnishing_type;
+      if (furnishing === 'unfurnished') {
+        throw new Error('short stays require a furnished or semi-furnished unit');
+      }
+      const nightlyRate = req.nightly_rate !== undefined ? req.nightly_rate : existingUnit.nightly_rate;
+      if (!nightlyRate || Number(nightlyRate) <= 0) {
+        throw new Error('nightly_rate is required to enable short stays');
+      }
+    }
+
+    // Only http(s) feeds are fetched; where they resolve is checked on each sync
+    if (req.ical_import_url) {
+      parsePublicUrl(req.ical_import_url);
+    }
+
     const unit = await this.prisma.unit.update({
       where: { id },
       data: {
@@ -512,6 +540,12 @@ export class UnitsService {
         ...(req.in_unit_amenities && { in_unit_amenities: req.in_unit_amenities }),
         ...(req.appliances && { appliances: req.appliances }),
         ...(req.images !== undefined && { images: req.images }),
+        ...(req.short_stay_enabled !== undefined && { short_stay_enabled: req.short_stay_enabled }),
+        ...(req.nightly_rate !== undefined && { nightly_rate: req.nightly_rate }),
+        ...(req.weekly_rate !== undefined && { weekly_rate: req.weekly_rate }),
+        ...(req.cleaning_fee !== undefined && { cleaning_fee: req.cleaning_fee }),
+        ...(req.min_stay_nights !== undefined && { min_stay_nights: req.min_stay_nights }),
+        ...(req.ical_import_url !== undefined && { ical_import_url: req.ical_import_url }),
         updated_at: new Date(),
       },
       include: {
@@ -709,7 +743,7 @@ export class UnitsService {
 
   async updateUnitStatus(unitId: string, status: string, user: JWTClaims): Promise<void> {
     // First check if unit exists and user has access
-    await this.getUnit(unitId, user);
+    const unit = await this.getUnit(unitId, user);
 
     // Check update permissions
     if (!['super_admin', 'agency_admin', 'landlord', 'caretaker'].includes(user.role)) {
@@ -723,6 +757,12 @@ export class UnitsService {
         updated_at: new Date(),
       },
     });
+
+    // A unit coming back on the market (e.g. after maintenance) goes to the waiting list
+    if (status === 'vacant' && unit.status !== 'vacant') {
+      const { UnitApplicationsService } = await import('./unit-applications.service.js');
+      await new UnitApplicationsService().notifyUnitVacated(unitId);
+    }
   }
 
   async assignTenant(req: AssignTenantRequest, user: JWTClaims): Promise<void> {
@@ -832,6 +872,10 @@ export class UnitsService {
         updated_at: new Date(),
       },
     });
+
+    // Offer the freed unit to the next person on the property's waiting list
+    const { UnitApplicationsService } = await import('./unit-applications.service.js');
+    await new UnitApplicationsService().notifyUnitVacated(unitId);
   }
 
   async searchAvailableUnits(filters: UnitFilters): Promise<any> {
@@ -843,6 +887,8 @@ export class UnitsService {
 
     const where: any = {
       status: { in: ['vacant', 'available'] },
+      // Suspended or deactivated agencies' units are off the listings
+      property: listedPropertyWhere,
     };
 
     // Apply other filters (reuse the same logic from listUnits but simplified)
@@ -862,7 +908,7 @@ export class UnitsService {
     const limit = Math.min(filters.limit || 20, 100);
     const offset = filters.offset || 0;
 
-    const [units, total] = await Promise.all([
+    const [listed, total] = await Promise.all([
       this.prisma.unit.findMany({
         where,
         include: {
@@ -873,6 +919,13 @@ export class UnitsService {
               street: true,
               city: true,
               region: true,
+              agency: {
+                select: {
+                  id: true,
+                  name: true,
+                  branding: { select: { logo_url: true, primary_color: true, secondary_color: true } },
+                },
+              },
             },
           },
         },
@@ -883,6 +936,21 @@ export class UnitsService {
       this.prisma.unit.count({ where }),
     ]);
 
+    // Agency-managed listings carry the agency's name, logo and colours
+    const units = listed.map(({ property: { agency, ...property }, ...unit }) => ({
+      ...unit,
+      property,
+      listed_by: agency
+        ? {
+            agency_id: agency.id,
+            name: agency.name,
+            logo_url: agency.branding?.logo_url || null,
+            primary_color: agency.branding?.primary_color || null,
+            secondary_color: agency.branding?.secondary_color || null,
+          }
+        : null,
+    }));
+
     const totalPages = Math.ceil(total / limit);
     const currentPage = Math.floor(offset / limit) + 1;
 
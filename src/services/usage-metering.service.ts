@@ -0,0 +1,310 @@
+import { getPrisma } from '../config/prisma.js';
+import { JWTClaims } from '../types/index.js';
+
+export type UsageCounter = 'api_calls' | 'sms_sent' | 'documents_generated';
+export type UsageMetric = UsageCounter | 'storage_bytes';
+
+// Who a metered action is for: the agency when the caller knows it, otherwise the company's agency
+export interface UsageOwner {
+  agencyId?: string | null;
+  companyId?: string | null;
+}
+
+const COUNTERS: UsageCounter[] = ['api_calls', 'sms_sent', 'documents_generated'];
+const USAGE_ROLES = ['super_admin', 'agency_admin'];
+const GB = 1024 * 1024 * 1024;
+// Counts are held in memory and written in batches rather than once per request
+const FLUSH_INTERVAL_MS = 60 * 1000;
+const COMPANY_AGENCY_CACHE_MS = 10 * 60 * 1000;
+
+/**
+ * What each plan includes per month; usage above it is billed as overage on the next invoice
+ */
+export const USAGE_ALLOWANCES: Record<string, Record<UsageMetric, number>> = {
+  starter: { api_calls: 50_000, sms_sent: 500, documents_generated: 500, storage_bytes: 2 * GB },
+  professional: { api_calls: 250_000, sms_sent: 2_000, documents_generated: 2_500, storage_bytes: 10 * GB },
+  enterprise: { api_calls: 1_000_000, sms_sent: 10_000, documents_generated: 10_000, storage_bytes: 50 * GB },
+};
+
+// KES charged for each block of usage over the allowance
+export const OVERAGE_RATES: Record<UsageMetric, { per: number; price: number; unit: string }> = {
+  api_calls: { per: 1_000, price: 50, unit: '1,000 API calls' },
+  sms_sent: { per: 1, price: 1, unit: 'SMS' },
+  documents_generated: { per: 1, price: 2, unit: 'document' },
+  storage_bytes: { per: GB, price: 20, unit: 'GB of storage' },
+};
+
+export interface OverageLine {
+  metric: UsageMetric;
+  used: number;
+  included: number;
+  billable_units: number;
+  unit: string;
+  rate: number;
+  amount: number;
+}
+
+/**
+ * Per-agency usage metering: API calls, SMS sent and documents generated are counted as they
+ * happen, storage is measured daily, and usage over the plan's allowance becomes overage on the
+ * agency's subscription invoice
+ */
+export class UsageMeteringService {
+  private prisma = getPrisma();
+  private pending = new Map<string, Record<UsageCounter, number>>();
+  private companyAgencies = new Map<string, { agencyId: string | null; at: number }>();
+  private timer: NodeJS.Timeout | null = null;
+
+  /**
+   * Count usage for an agency. Never throws: metering must not fail the action being metered.
+   */
+  record(owner: UsageOwner, counter: UsageCounter, amount: number = 1) {
+    if (amount <= 0) return;
+    if (owner.agencyId) {
+      this.add(owner.agencyId, counter, amount);
+      return;
+    }
+    if (!owner.companyId) return;
+    this.agencyForCompany(owner.companyId)
+      .then(agencyId => agencyId && this.add(agencyId, counter, amount))
+      .catch(error => console.error('❌ Failed to meter usage:', error.message));
+  }
+
+  /**
+   * Write buffered counts to the daily usage rows
+   */
+  async flush() {
+    const batch = [...this.pending.entries()];
+    this.pending.clear();
+    for (const [key, counts] of batch) {
+      const [agencyId, date] = key.split('|');
+      try {
+        await this.prisma.agencyUsage.upsert({
+          where: { agency_id_usage_date: { agency_id: agencyId, usage_date: new Date(date) } },
+          create: { agency_id: agencyId, usage_date: new Date(date), ...counts },
+          update: {
+            api_calls: { increment: counts.api_calls },
+            sms_sent: { increment: counts.sms_sent },
+            documents_generated: { increment: counts.documents_generated },
+            updated_at: new Date(),
+          },
+        });
+      } catch (error: any) {
+        // A deleted agency's counts are dropped; anything else is kept for the next flush
+        if (error.code === 'P2003') continue;
+        console.error(`❌ Failed to write usage for agency ${agencyId}:`, error.message);
+        for (const counter of COUNTERS) {
+          if (counts[counter]) this.add(agencyId, counter, counts[counter], date);
+        }
+      }
+    }
+    return { written: batch.length };
+  }
+
+  /**
+   * Measure each agency's stored files (unit and inspection photos on its properties) for today
+   */
+  async snapshotStorage(now: Date = new Date()) {
+    const agencies = await this.prisma.agency.findMany({ select: { id: true } });
+    const usageDate = new Date(this.dayOf(now));
+    for (const agency of agencies) {
+      try {
+        const [unitPhotos, inspectionPhotos] = await Promise.all([
+          this.prisma.unitPhoto.aggregate({ where: { unit: { property: { agency_id: agency.id } } }, _sum: { file_size: true } }),
+          this.prisma.inspectionPhoto.aggregate({ where: { inspection: { property: { agency_id: agency.id } } }, _sum: { file_size: true } }),
+        ]);
+        const bytes = BigInt((unitPhotos._sum.file_size || 0) + (inspectionPhotos._sum.file_size || 0));
+        await this.prisma.agencyUsage.upsert({
+          where: { agency_id_usage_date: { agency_id: agency.id, usage_date: usageDate } },
+          create: { agency_id: agency.id, usage_date: usageDate, storage_bytes: bytes },
+          update: { storage_bytes: bytes, updated_at: now },
+        });
+      } catch (error: any) {
+        console.error(`❌ Failed to measure storage for agency ${agency.id}:`, error.message);
+      }
+    }
+    return { measured: agencies.length };
+  }
+
+  /**
+   * An agency's usage dashboard: totals and daily figures for the period (this month by
+   * default), the plan allowance and the overage building up in the current billing period
+   */
+  async getUsage(user: JWTClaims, agencyId: string | undefined, query: { from?: string; to?: string } = {}) {
+    const agency = await this.agencyFor(user, agencyId);
+    await this.flush();
+    const now = new Date();
+    const from = query.from ? new Date(query.from) : new Date(Date.UTC(now.getUTCFullYear(), now.getUTCMonth(), 1));
+    const to = query.to ? new Date(query.to) : now;
+    if (isNaN(from.getTime()) || isNaN(to.getTime())) {
+      throw new Error('from and to must be valid dates');
+    }
+
+    const rows = await this.prisma.agencyUsage.findMany({
+      where: { agency_id: agency.id, usage_date: { gte: new Date(this.dayOf(from)), lte: new Date(this.dayOf(to)) } },
+      orderBy: { usage_date: 'asc' },
+    });
+    const subscription = await this.prisma.subscription.findFirst({
+      where: { company_id: agency.company_id, status: { in: ['trial', 'active', 'past_due', 'unpaid'] } },
+      orderBy: { created_at: 'desc' },
+    });
+
+    let currentPeriod = null;
+    if (subscription?.next_billing_date && subscription.status !== 'trial') {
+      const periodStart = new Date(subscription.next_billing_date);
+      if (subscription.billing_cycle === 'annual') {
+        periodStart.setFullYear(periodStart.getFullYear() - 1);
+      } else {
+        periodStart.setMonth(periodStart.getMonth() - 1);
+      }
+      const overage = await this.overageFor(agency.company_id, subscription.plan, subscription.billing_cycle, periodStart, now);
+      currentPeriod = { from: periodStart, to: subscription.next_billing_date, ...overage };
+    }
+
+    return {
+      agency: { id: agency.id, name: agency.name },
+      period: { from, to },
+      plan: subscription?.plan || null,
+      allowance: subscription ? USAGE_ALLOWANCES[subscription.plan] : null,
+      totals: this.totals(rows),
+      daily: rows.map(row => ({
+        date: row.usage_date.toISOString().slice(0, 10),
+        api_calls: row.api_calls,
+        sms_sent: row.sms_sent,
+        documents_generated: row.documents_generated,
+        storage_bytes: Number(row.storage_bytes),
+      })),
+      current_period: currentPeriod,
+    };
+  }
+
+  /**
+   * Usage of every agency over a period for super admins, heaviest API users first
+   */
+  async getPlatformUsage(query: { from?: string; to?: string } = {}) {
+    await this.flush();
+    const now = new Date();
+    const from = query.from ? new Date(query.from) : new Date(Date.UTC(now.getUTCFullYear(), now.getUTCMonth(), 1));
+    const to = query.to ? new Date(query.to) : now;
+    if (isNaN(from.getTime()) || isNaN(to.getTime())) {
+      throw new Error('from and to must be valid dates');
+    }
+    const rows = await this.prisma.agencyUsage.findMany({
+      where: { usage_date: { gte: new Date(this.dayOf(from)), lte: new Date(this.dayOf(to)) } },
+      include: { agency: { select: { id: true, name: true, company_id: true } } },
+      orderBy: { usage_date: 'asc' },
+    });
+
+    const byAgency = new Map<string, { agency: { id: string; name: string; company_id: string }; rows: typeof rows }>();
+    for (const row of rows) {
+      const entry = byAgency.get(row.agency_id) || { agency: row.agency, rows: [] };
+      entry.rows.push(row);
+      byAgency.set(row.agency_id, entry);
+    }
+    const agencies = [...byAgency.values()]
+      .map(entry => ({ agency: entry.agency, ...this.totals(entry.rows) }))
+      .sort((a, b) => b.api_calls - a.api_calls);
+    return {
+      period: { from, to },
+      agencies,
+      totals: {
+        api_calls: agencies.reduce((sum, a) => sum + a.api_calls, 0),
+        sms_sent: agencies.reduce((sum, a) => sum + a.sms_sent, 0),
+        documents_generated: agencies.reduce((sum, a) => sum + a.documents_generated, 0),
+        storage_bytes: agencies.reduce((sum, a) => sum + a.storage_bytes, 0),
+      },
+    };
+  }
+
+  /**
+   * Overage for a company's agencies over a billing period: counters are summed, storage is the
+   * peak daily measurement, and each is priced above the plan's allowance for the cycle
+   */
+  async overageFor(companyId: string, plan: string, billingCycle: string, from: Date, to: Date) {
+    const allowance = USAGE_ALLOWANCES[plan];
+    if (!allowance || from >= to) {
+      return { line_items: [] as OverageLine[], total: 0 };
+    }
+    await this.flush();
+    const rows = await this.prisma.agencyUsage.findMany({
+      where: { agency: { company_id: companyId }, usage_date: { gte: new Date(this.dayOf(from)), lt: new Date(this.dayOf(to)) } },
+    });
+    if (rows.length === 0) {
+      return { line_items: [] as OverageLine[], total: 0 };
+    }
+
+    const months = billingCycle === 'annual' ? 12 : 1;
+    const used = this.totals(rows);
+    const lines: OverageLine[] = [];
+    for (const metric of Object.keys(OVERAGE_RATES) as UsageMetric[]) {
+      const rate = OVERAGE_RATES[metric];
+      // Storage is held, not consumed, so its allowance does not grow with the cycle
+      const included = metric === 'storage_bytes' ? allowance[metric] : allowance[metric] * months;
+      const over = used[metric] - included;
+      if (over <= 0) continue;
+      const units = Math.ceil(over / rate.per);
+      lines.push({ metric, used: used[metric], included, billable_units: units, unit: rate.unit, rate: rate.price, amount: units * rate.price });
+    }
+    return { line_items: lines, total: lines.reduce((sum, line) => sum + line.amount, 0) };
+  }
+
+  private totals(rows: Array<{ api_calls: number; sms_sent: number; documents_generated: number; storage_bytes: bigint }>) {
+    return {
+      api_calls: rows.reduce((sum, row) => sum + row.api_calls, 0),
+      sms_sent: rows.reduce((sum, row) => sum + row.sms_sent, 0),
+      documents_generated: rows.reduce((sum, row) => sum + row.documents_generated, 0),
+      storage_bytes: rows.reduce((peak, row) => Math.max(peak, Number(row.storage_bytes)), 0),
+    };
+  }
+
+  private add(agencyId: string, counter: UsageCounter, amount: number, date: string = this.dayOf(new Date())) {
+    const key = `${agencyId}|${date}`;
+    const counts = this.pending.get(key) || { api_calls: 0, sms_sent: 0, documents_generated: 0 };
+    counts[counter] += amount;
+    this.pending.set(key, counts);
+    if (!this.timer) {
+      this.timer = setInterval(() => {
+        this.flush().catch(error => console.error('❌ Failed to flush usage:', error.message));
+      }, FLUSH_INTERVAL_MS);
+      this.timer.unref();
+    }
+  }
+
+  private async agencyForCompany(companyId: string) {
+    const cached = this.companyAgencies.get(companyId);
+    if (cached && Date.now() - cached.at < COMPANY_AGENCY_CACHE_MS) {
+      return cached.agencyId;
+    }
+    const agency = await this.prisma.agency.findFirst({
+      where: { company_id: companyId },
+      orderBy: { created_at: 'asc' },
+      select: { id: true },
+    });
+    this.companyAgencies.set(companyId, { agencyId: agency?.id || null, at: Date.now() });
+    return agency?.id || null;
+  }
+
+  private dayOf(date: Date) {
+    return date.toISOString().slice(0, 10);
+  }
+
+  private async agencyFor(user: JWTClaims, agencyId?: string) {
+    if (!USAGE_ROLES.includes(user.role)) {
+      throw new Error('insufficient permissions to view agency usage');
+    }
+    const id = user.role === 'super_admin' ? agencyId : user.agency_id;
+    if (!id) {
+      throw new Error(user.role === 'super_admin' ? 'agency_id is required' : 'user must be associated with an agency');
+    }
+    if (user.role === 'agency_admin' && agencyId && agencyId !== user.agency_id) {
+      throw new Error('insufficient permissions to view another agency\'s usage');
+    }
+    const agency = await this.prisma.agency.findUnique({ where: { id }, select: { id: true, name: true, company_id: true } });
+    if (!agency) {
+      throw new Error('agency not found');
+    }
+    return agency;
+  }
+}
+
+export const usageMeteringService = new UsageMeteringService();
@@ -0,0 +1,260 @@
+import { JWTClaims } from '../types/index.js';
+import { getPrisma } from '../config/prisma.js';
+
+const prisma = getPrisma();
+
+const MAX_CONTACTS_PER_USER = 5;
+const MANAGING_ROLES = ['landlord', 'agency_admin', 'agent', 'admin', 'manager'];
+const READ_ONLY_ROLES = ['caretaker', 'maintenance', 'security', 'support', 'team_lead'];
+
+export interface CreateUserEmergencyContactRequest {
+  name: string;
+  relationship: string;
+  phone: string;
+  alternate_phone?: string;
+  email?: string;
+  address?: string;
+  priority?: number;
+  is_next_of_kin?: boolean;
+  notes?: string;
+}
+
+export interface UpdateUserEmergencyContactRequest extends Partial<CreateUserEmergencyContactRequest> {}
+
+/**
+ * Personal emergency contacts / next-of-kin for tenants, caretakers and other staff.
+ * Company-wide service contacts (plumbers, security firms) live in EmergencyContactsService.
+ */
+export class UserEmergencyContactsService {
+  /**
+   * Resolve whether the requesting user may read or modify another user's contacts
+   */
+  private async assertAccess(user: JWTClaims, targetUserId: string, write: boolean) {
+    const target = await prisma.user.findUnique({
+      where: { id: targetUserId },
+      select: { id: true, company_id: true, role: true },
+    });
+
+    if (!target) {
+      throw new Error('User not found');
+    }
+
+    if (user.role === 'super_admin' || user.user_id === targetUserId) {
+      return target;
+    }
+
+    if (!user.company_id || target.company_id !== user.company_id) {
+      throw new Error('Insufficient permissions to access this user\'s emergency contacts');
+    }
+
+    if (MANAGING_ROLES.includes(user.role)) {
+      return target;
+    }
+
+    // Field staff can look up a tenant's contacts in an emergency but not edit them
+    if (!write && READ_ONLY_ROLES.includes(user.role) && target.role === 'tenant') {
+      return target;
+    }
+
+    throw new Error('Insufficient permissions to access this user\'s emergency contacts');
+  }
+
+  private validate(req: UpdateUserEmergencyContactRequest, partial: boolean) {
+    if (!partial) {
+      if (!req.name?.trim()) throw new Error('name is required');
+      if (!req.relationship?.trim()) throw new Error('relationship is required');
+      if (!req.phone?.trim()) throw new Error('phone is required');
+    }
+    if (req.phone !== undefined && !/^\+?[0-9\s-]{7,20}$/.test(req.phone)) {
+      throw new Error('phone must be a valid phone number');
+    }
+    if (req.email && !/^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(req.email)) {
+      throw new Error('email must be a valid email address');
+    }
+    if (req.priority !== undefined && (!Number.isInteger(req.priority) || req.priority < 1)) {
+      throw new Error('priority must be a positive integer');
+    }
+  }
+
+  /**
+   * Get all emergency contacts for a user, ordered by priority
+   */
+  async getContacts(targetUserId: string, user: JWTClaims): Promise<any[]> {
+    await this.assertAccess(user, targetUserId, false);
+
+    return prisma.userEmergencyContact.findMany({
+      where: { user_id: targetUserId },
+      orderBy: [{ priority: 'asc' }, { created_at: 'asc' }],
+    });
+  }
+
+  /**
+   * Add an emergency contact for a user
+   */
+  async createContact(targetUserId: string, req: CreateUserEmergencyContactRequest, user: JWTClaims): Promise<any> {
+    const target = await this.assertAccess(user, targetUserId, true);
+    this.validate(req, false);
+
+    const existingCount = await prisma.userEmergencyContact.count({ where: { user_id: targetUserId } });
+    if (existingCount >= MAX_CONTACTS_PER_USER) {
+      throw new Error(`A user can have at most ${MAX_CONTACTS_PER_USER} emergency contacts`);
+    }
+
+    const contact = await prisma.$transaction(async (tx) => {
+      if (req.is_next_of_kin) {
+        await tx.userEmergencyContact.updateMany({
+          where: { user_id: targetUserId, is_next_of_kin: true },
+          data: { is_next_of_kin: false, updated_at: new Date() },
+        });
+      }
+
+      return tx.userEmergencyContact.create({
+        data: {
+          user_id: targetUserId,
+          company_id: target.company_id,
+          name: req.name.trim(),
+          relationship: req.relationship.trim(),
+          phone: req.phone.trim(),
+          alternate_phone: req.alternate_phone || null,
+          email: req.email || null,
+          address: req.address || null,
+          priority: req.priority ?? existingCount + 1,
+          is_next_of_kin: req.is_next_of_kin || false,
+          notes: req.notes || null,
+          created_by: user.user_id,
+        },
+      });
+    });
+
+    await this.syncLegacyFields(targetUserId);
+    return contact;
+  }
+
+  /**
+   * Update an emergency contact
+   */
+  async updateContact(
+    targetUserId: string,
+    contactId: string,
+    req: UpdateUserEmergencyContactRequest,
+    user: JWTClaims
+  ): Promise<any> {
+    await this.assertAccess(user, targetUserId, true);
+    this.validate(req, true);
+
+    const existing = await prisma.userEmergencyContact.findFirst({
+      where: { id: contactId, user_id: targetUserId },
+    });
+    if (!existing) {
+      throw new Error('Emergency contact not found');
+    }
+
+    const updateData: any = { updated_at: new Date() };
+    if (req.name !== undefined) updateData.name = req.name.trim();
+    if (req.relationship !== undefined) updateData.relationship = req.relationship.trim();
+    if (req.phone !== undefined) updateData.phone = req.phone.trim();
+    if (req.alternate_phone !== undefined) updateData.alternate_phone = req.alternate_phone || null;
+    if (req.email !== undefined) updateData.email = req.email || null;
+    if (req.address !== undefined) updateData.address = req.address || null;
+    if (req.priority !== undefined) updateData.priority = req.priority;
+    if (req.is_next_of_kin !== undefined) updateData.is_next_of_kin = req.is_next_of_kin;
+    if (req.notes !== undefined) updateData.notes = req.notes || null;
+
+    const contact = await prisma.$transaction(async (tx) => {
+      if (req.is_next_of_kin) {
+        await tx.userEmergencyContact.updateMany({
+          where: { user_id: targetUserId, is_next_of_kin: true, id: { not: contactId } },
+          data: { is_next_of_kin: false, updated_at: new Date() },
+        });
+      }
+
+      return tx.userEmergencyContact.update({
+        where: { id: contactId },
+        data: updateData,
+      });
+    });
+
+    await this.syncLegacyFields(targetUserId);
+    return contact;
+  }
+
+  /**
+   * Reorder contacts; ids are given from highest to lowest priority
+   */
+  async reorderContacts(targetUserId: string, contactIds: string[], user: JWTClaims): Promise<any[]> {
+    await this.assertAccess(user, targetUserId, true);
+
+    if (!Array.isArray(contactIds) || contactIds.length === 0) {
+      throw new Error('contact_ids must be a non-empty array');
+    }
+
+    const owned = await prisma.userEmergencyContact.count({
+      where: { user_id: targetUserId, id: { in: contactIds } },
+    });
+    if (owned !== contactIds.length) {
+      throw new Error('Emergency contact not found');
+    }
+
+    await prisma.$transaction(
+      contactIds.map((id, index) =>
+        prisma.userEmergencyContact.update({
+          where: { id },
+          data: { priority: index + 1, updated_at: new Date() },
+        })
+      )
+    );
+
+    await this.syncLegacyFields(targetUserId);
+    return this.getContacts(targetUserId, user);
+  }
+
+  /**
+   * Delete an emergency contact
+   */
+  async deleteContact(targetUserId: string, contactId: string, user: JWTClaims): Promise<void> {
+    await this.assertAccess(user, targetUserId, true);
+
+    const result = await prisma.userEmergencyContact.deleteMany({
+      where: { id: contactId, user_id: targetUserId },
+    });
+    if (result.count === 0) {
+      throw new Error('Emergency contact not found');
+    }
+
+    await this.syncLegacyFields(targetUserId);
+  }
+
+  /**
+   * Keep the legacy single-contact columns on users/tenant_profiles pointing at the
+   * primary contact so older screens and exports keep working.
+   */
+  private async syncLegacyFields(userId: string): Promise<void> {
+    try {
+      const primary = await prisma.userEmergencyContact.findFirst({
+        where: { user_id: userId },
+        orderBy: [{ priority: 'asc' }, { created_at: 'asc' }],
+      });
+
+      await prisma.user.update({
+        where: { id: userId },
+        data: {
+          emergency_contact_name: primary?.name ?? null,
+          emergency_contact_phone: primary?.phone ?? null,
+          emergency_contact_email: primary?.email ?? null,
+          emergency_relationship: primary?.relationship ?? null,
+        },
+      });
+
+      await prisma.tenantProfile.updateMany({
+        where: { user_id: userId },
+        data: {
+          emergency_contact_name: primary?.name?.slice(0, 100) ?? null,
+          emergency_contact_phone: primary?.phone ?? null,
+          emergency_contact_relationship: primary?.relationship?.slice(0, 50) ?? null,
+        },
+      });
+    } catch (error) {
+      console.error('Error syncing legacy emergency contact fields:', error);
+    }
+  }
+}
@@ -0,0 +1,55 @@
+/**
+ * In-memory cache for analytics responses (dashboard overview, platform analytics, revenue charts).
+ * Entries are tagged with the company they were computed for so writes can drop just that
+ * company's figures; platform-wide entries (no company) are dropped on every write.
+ * Each API instance keeps its own copy, so TTLs stay short.
+ */
+interface AnalyticsCacheEntry {
+  body: unknown;
+  companyId: string | null;
+  expiresAt: number;
+}
+
+const MAX_ENTRIES = 500;
+const entries = new Map<string, AnalyticsCacheEntry>();
+
+// Drop expired entries every 5 minutes
+setInterval(() => {
+  const now = Date.now();
+  for (const [key, entry] of entries) {
+    if (entry.expiresAt <= now) entries.delete(key);
+  }
+}, 5 * 60 * 1000).unref();
+
+export function getCachedAnalytics(key: string): { body: unknown; expiresAt: number } | null {
+  const entry = entries.get(key);
+  if (!entry) return null;
+  if (entry.expiresAt <= Date.now()) {
+    entries.delete(key);
+    return null;
+  }
+  return { body: entry.body, expiresAt: entry.expiresAt };
+}
+
+export function setCachedAnalytics(key: string, body: unknown, ttlMs: number, companyId: string | null): void {
+  // Maps keep insertion order, so the first key is the oldest entry
+  if (entries.size >= MAX_ENTRIES && !entries.has(key)) {
+    const oldest = entries.keys().next().value;
+    if (oldest !== undefined) entries.delete(oldest);
+  }
+  entries.set(key, { body, companyId, expiresAt: Date.now() + ttlMs });
+}
+
+/**
+ * Forget cached analytics after a write. With a company, only that company's entries and
+ * platform-wide entries go; without one, everything goes.
+ */
+export function invalidateAnalyticsCache(companyId?: string | null): void {
+  if (!companyId) {
+    entries.clear();
+    return;
+  }
+  for (const [key, entry] of entries) {
+    if (entry.companyId === companyId || entry.companyId === null) entries.delete(key);
+  }
+}
@@ -0,0 +1,158 @@
+/**
+ * Chart periods and bucketing shared by the chart endpoints.
+ *
+ * A period is a preset (`last_7d`, `last_30d`, `last_90d`, `last_12m`, `mtd`, `ytd`) or `custom`
+ * with `from`/`to` dates. Dates are whole UTC days, like the daily series they are drawn from.
+ * Series are bucketed by day, week (starting Monday) or month; without an `interval` the
+ * bucket size follows the length of the period.
+ */
+
+export const CHART_PERIODS = ['last_7d', 'last_30d', 'last_90d', 'last_12m', 'mtd', 'ytd', 'custom'] as const;
+export type ChartPeriodName = typeof CHART_PERIODS[number];
+export const CHART_INTERVALS = ['day', 'week', 'month'] as const;
+export type ChartInterval = typeof CHART_INTERVALS[number];
+
+// Presets the analytics endpoints accepted before periods were standardised
+const PERIOD_ALIASES: Record<string, ChartPeriodName> = { '7d': 'last_7d', '30d': 'last_30d', '90d': 'last_90d', '1y': 'last_12m' };
+const DAY_MS = 24 * 60 * 60 * 1000;
+const MAX_PERIOD_DAYS = 5 * 366;
+const MAX_POINTS = 366;
+const DATE_PATTERN = /^\d{4}-\d{2}-\d{2}$/;
+
+export interface ChartBucket {
+  key: string;
+  start: string;
+  end: string;
+}
+
+export interface ChartPeriod {
+  period: ChartPeriodName;
+  interval: ChartInterval;
+  start: Date;
+  end: Date;
+  buckets: ChartBucket[];
+}
+
+const isoDay = (date: Date) => date.toISOString().split('T')[0];
+const utcDay = (date: Date) => new Date(Date.UTC(date.getUTCFullYear(), date.getUTCMonth(), date.getUTCDate()));
+
+function parseDay(value: any, name: string): Date {
+  const text = String(value);
+  const date = new Date(`${text}T00:00:00.000Z`);
+  if (!DATE_PATTERN.test(text) || isNaN(date.getTime()) || isoDay(date) !== text) {
+    throw new Error(`${name} must be a date in YYYY-MM-DD format`);
+  }
+  return date;
+}
+
+/**
+ * Start of the bucket a day falls in
+ */
+function bucketStart(day: Date, interval: ChartInterval): Date {
+  if (interval === 'month') return new Date(Date.UTC(day.getUTCFullYear(), day.getUTCMonth(), 1));
+  if (interval === 'week') return new Date(day.getTime() - ((day.getUTCDay() + 6) % 7) * DAY_MS);
+  return day;
+}
+
+function nextBucket(start: Date, interval: ChartInterval): Date {
+  if (interval === 'month') return new Date(Date.UTC(start.getUTCFullYear(), start.getUTCMonth() + 1, 1));
+  return new Date(start.getTime() + (interval === 'week' ? 7 : 1) * DAY_MS);
+}
+
+export function bucketKey(date: Date | string, interval: ChartInterval): string {
+  const day = utcDay(typeof date === 'string' ? new Date(`${date.split('T')[0]}T00:00:00.000Z`) : date);
+  const start = bucketStart(day, interval);
+  return interval === 'month' ? isoDay(start).slice(0, 7) : isoDay(start);
+}
+
+/**
+ * Validated period from `period` (or the older `date_range`/`dateRange`), `from`/`to`
+ * (or `start_date`/`end_date`) and `interval` query parameters
+ */
+export function parseChartPeriod(query: Record<string, any> = {}, now: Date = new Date()): ChartPeriod {
+  const from = query.from ?? query.start_date;
+  const to = query.to ?? query.end_date;
+  const requested = String(query.period ?? query.date_range ?? query.dateRange ?? (from ? 'custom' : 'last_30d'));
+  const period = (PERIOD_ALIASES[requested] || requested) as ChartPeriodName;
+  if (!CHART_PERIODS.includes(period)) {
+    throw new Error(`period must be one of: ${CHART_PERIODS.join(', ')}`);
+  }
+
+  const today = utcDay(now);
+  let start: Date;
+  let end = today;
+  switch (period) {
+    case 'last_7d':
+      start = new Date(today.getTime() - 6 * DAY_MS);
+      break;
+    case 'last_30d':
+      start = new Date(today.getTime() - 29 * DAY_MS);
+      break;
+    case 'last_90d':
+      start = new Date(today.getTime() - 89 * DAY_MS);
+      break;
+    case 'last_12m':
+      start = new Date(Date.UTC(today.getUTCFullYear(), today.getUTCMonth() - 11, 1));
+      break;
+    case 'mtd':
+      start = new Date(Date.UTC(today.getUTCFullYear(), today.getUTCMonth(), 1));
+      break;
+    case 'ytd':
+      start = new Date(Date.UTC(today.getUTCFullYear(), 0, 1));
+      break;
+    case 'custom':
+      if (!from || !to) {
+        throw new Error('from and to are required for a custom period');
+      }
+      start = parseDay(from, 'from');
+      end = parseDay(to, 'to');
+      if (start > end) {
+        throw new Error('from must be on or before to');
+      }
+      break;
+  }
+  const days = Math.round((end.getTime() - start.getTime()) / DAY_MS) + 1;
+  if (days > MAX_PERIOD_DAYS) {
+    throw new Error('period must not be longer than 5 years');
+  }
+
+  const interval = (query.interval ? String(query.interval) : days <= 31 ? 'day' : days <= 180 ? 'week' : 'month') as ChartInterval;
+  if (!CHART_INTERVALS.includes(interval)) {
+    throw new Error(`interval must be one of: ${CHART_INTERVALS.join(', ')}`);
+  }
+
+  const buckets: ChartBucket[] = [];
+  for (let cursor = bucketStart(start, interval); cursor <= end; cursor = nextBucket(cursor, interval)) {
+    const last = new Date(nextBucket(cursor, interval).getTime() - DAY_MS);
+    buckets.push({
+      key: bucketKey(cursor, interval),
+      // The first and last buckets are cut to the period
+      start: isoDay(cursor < start ? start : cursor),
+      end: isoDay(last > end ? end : last),
+    });
+    if (buckets.length > MAX_POINTS) {
+      throw new Error(`interval must give at most ${MAX_POINTS} points; use a longer interval for this period`);
+    }
+  }
+
+  return { period, interval, start, end: new Date(end.getTime() + DAY_MS - 1), buckets };
+}
+
+/**
+ * Roll a daily series up into the period's buckets: amounts and counts are summed, levels
+ * (rates, running totals) take the bucket's last day
+ */
+export function bucketSeries<T extends { date: string }>(
+  period: ChartPeriod,
+  daily: T[],
+  value: (point: T) => number,
+  mode: 'sum' | 'last' = 'sum',
+): number[] {
+  const totals = new Map<string, number>();
+  for (const point of daily) {
+    const key = bucketKey(point.date, period.interval);
+    const amount = Number(value(point)) || 0;
+    totals.set(key, mode === 'sum' ? (totals.get(key) || 0) + amount : amount);
+  }
+  return period.buckets.map(bucket => Math.round((totals.get(bucket.key) || 0) * 100) / 100);
+}
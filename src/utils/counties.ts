@@ -0,0 +1,50 @@
+/**
+ * The 47 counties of Kenya, used to give properties a canonical county for regional analytics
+ */
+export const KENYA_COUNTIES = [
+  'Baringo', 'Bomet', 'Bungoma', 'Busia', 'Elgeyo-Marakwet', 'Embu', 'Garissa', 'Homa Bay', 'Isiolo', 'Kajiado',
+  'Kakamega', 'Kericho', 'Kiambu', 'Kilifi', 'Kirinyaga', 'Kisii', 'Kisumu', 'Kitui', 'Kwale', 'Laikipia',
+  'Lamu', 'Machakos', 'Makueni', 'Mandera', 'Marsabit', 'Meru', 'Migori', 'Mombasa', "Murang'a", 'Nairobi',
+  'Nakuru', 'Nandi', 'Narok', 'Nyamira', 'Nyandarua', 'Nyeri', 'Samburu', 'Siaya', 'Taita-Taveta', 'Tana River',
+  'Tharaka-Nithi', 'Trans Nzoia', 'Turkana', 'Uasin Gishu', 'Vihiga', 'Wajir', 'West Pokot',
+];
+
+// Towns people commonly enter instead of the county they are in
+const TOWN_COUNTIES: Record<string, string> = {
+  eldoret: 'Uasin Gishu',
+  thika: 'Kiambu',
+  ruiru: 'Kiambu',
+  juja: 'Kiambu',
+  kikuyu: 'Kiambu',
+  limuru: 'Kiambu',
+  kitengela: 'Kajiado',
+  ngong: 'Kajiado',
+  rongai: 'Kajiado',
+  athiriver: 'Machakos',
+  syokimau: 'Machakos',
+  mlolongo: 'Machakos',
+  naivasha: 'Nakuru',
+  malindi: 'Kilifi',
+  watamu: 'Kilifi',
+  diani: 'Kwale',
+  ukunda: 'Kwale',
+  nanyuki: 'Laikipia',
+  kitale: 'Trans Nzoia',
+  voi: 'Taita-Taveta',
+};
+
+const key = (value: string) =>
+  value.toLowerCase().replace(/\b(county|city|town)\b/g, '').replace(/[^a-z]/g, '');
+
+const COUNTY_KEYS = new Map(KENYA_COUNTIES.map(county => [key(county), county]));
+
+/**
+ * Canonical county for a county, region or town name ("nairobi city" -> "Nairobi",
+ * "Eldoret" -> "Uasin Gishu"); undefined when it does not name one
+ */
+export function normalizeCounty(value?: string | null): string | undefined {
+  if (!value) return undefined;
+  const k = key(value);
+  if (!k) return undefined;
+  return COUNTY_KEYS.get(k) || TOWN_COUNTIES[k];
+}
@@ -0,0 +1,82 @@
+/**
+ * Reply extraction for emails answered from a mail client: keep what the person typed and drop
+ * the quoted thread, the client's "On ... wrote:" header and their signature.
+ */
+
+// Outgoing message emails start with this line; anything below it in a reply is quoted history
+export const REPLY_ABOVE_MARKER = '##- Please type your reply above this line -##';
+
+// A line that starts the quoted part of a reply
+const QUOTE_HEADERS: RegExp[] = [
+  /^On\b.*\bwrote:\s*$/i, // Gmail, Apple Mail
+  /^.*\baliandika:\s*$/i, // Gmail in Swahili
+  /^-{2,}\s*Original Message\s*-{2,}/i, // Outlook (plain)
+  /^_{10,}\s*$/, // Outlook separator above From:/Sent:
+  /^Sent from my\b/i,
+  /^Get Outlook for\b/i,
+];
+
+/**
+ * Outlook's header block without a separator: "From:" followed within a few lines by "Sent:" or
+ * "Date:". A "From:" line on its own is something the person typed.
+ */
+const isOutlookHeaderBlock = (lines: string[], index: number) =>
+  /^From:\s.+$/i.test(lines[index].trim())
+  && lines.slice(index + 1, index + 4).some(line => /^(Sent|Date):\s/i.test(line.trim()));
+
+/**
+ * "On Mon, 3 Jun 2026 at 10:12, Jane <jane@example.com>" sometimes wraps before "wrote:"
+ */
+const joinWrappedHeader = (lines: string[], index: number) =>
+  index + 1 < lines.length && /^\s*(wrote|aliandika):\s*$/i.test(lines[index + 1]) ? `${lines[index]} ${lines[index + 1].trim()}` : lines[index];
+
+export function stripQuotedReply(text: string) {
+  const normalized = text.replace(/\r\n?/g, '\n');
+  const markerAt = normalized.indexOf(REPLY_ABOVE_MARKER);
+  const lines = (markerAt >= 0 ? normalized.slice(0, markerAt) : normalized).split('\n');
+
+  let end = lines.length;
+  for (let i = 0; i < lines.length; i++) {
+    const line = joinWrappedHeader(lines, i).trim();
+    if (line === '--' || line === '-- ') {
+      end = i; // signature delimiter
+      break;
+    }
+    if (QUOTE_HEADERS.some(pattern => pattern.test(line)) || isOutlookHeaderBlock(lines, i)) {
+      end = i;
+      break;
+    }
+    // A run of ">" lines reaching to the end of the message is the quoted thread
+    if (line.startsWith('>') && lines.slice(i).every(rest => !rest.trim() || rest.trim().startsWith('>'))) {
+      end = i;
+      break;
+    }
+  }
+
+  return lines
+    .slice(0, end)
+    .join('\n')
+    .replace(/\n{3,}/g, '\n\n')
+    .trim();
+}
+
+/**
+ * Plain text from an HTML-only email; Gmail and Outlook wrap the quoted thread in known blocks
+ */
+export function htmlToText(html: string) {
+  return html
+    .replace(/<div[^>]*class="?gmail_quote[\s\S]*$/i, '')
+    .replace(/<blockquote[\s\S]*?<\/blockquote>/gi, '')
+    .replace(/<div[^>]*id="?(divRplyFwdMsg|appendonsend)[\s\S]*$/i, '')
+    .replace(/<(style|script|head)[\s\S]*?<\/\1>/gi, '')
+    .replace(/<br\s*\/?>/gi, '\n')
+    .replace(/<\/(p|div|li|tr|h[1-6])>/gi, '\n')
+    .replace(/<[^>]+>/g, '')
+    .replace(/&nbsp;/gi, ' ')
+    .replace(/&lt;/gi, '<')
+    .replace(/&gt;/gi, '>')
+    .replace(/&quot;/gi, '"')
+    .replace(/&#39;|&#039;/gi, "'")
+    .replace(/&amp;/gi, '&')
+    .replace(/[ \t]+\n/g, '\n');
+}
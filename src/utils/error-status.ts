@@ -0,0 +1,25 @@
+/**
+ * HTTP status for an error a service threw. Services say what went wrong in the message
+ * ("unit not found", "insufficient permissions", "amount must be positive"); every controller maps
+ * those messages with this one table so the same wording gets the same status everywhere.
+ */
+
+// Checked in order; the first rule a message matches decides its status
+const RULES: Array<[pattern: RegExp, status: number]> = [
+  [/not found|not recognised|access denied/i, 404],
+  // "Only the sender …", "Only super admins …" restrict who may act; "Only pending …" is about state
+  [/permission|not a participant|cannot deactivate|\bonly (the|super admins?)\b/i, 403],
+  [/plan limit/i, 402],
+  [/expired/i, 410],
+  [/already|conflict|in progress|not ready|not available|not under dispute|cannot be |insufficient stock|paused|someone other|\bonly (pending|draft|active|inactive|completed|sent)\b|only available once/i, 409],
+  [/was rejected/i, 422],
+  [/unavailable/i, 503],
+  [/failed to fetch/i, 502],
+  [/required|requires|must|invalid|has no|not in |not configured|not linked|belongs to|at most|at least|minimum|\bonly\b/i, 400],
+];
+
+/**
+ * Status for a service error message, or `fallback` when it matches none of the rules
+ */
+export const statusFor = (message: string = '', fallback: number = 500): number =>
+  RULES.find(([pattern]) => pattern.test(message))?.[1] ?? fallback;
@@ -0,0 +1,278 @@
+/**
+ * Excel export as real .xlsx (Office Open XML) workbooks, zipped here with zlib so no
+ * spreadsheet dependency is needed. Columns can be typed so numbers, money, percentages and
+ * dates arrive in Excel as values with a number format rather than as text.
+ */
+import zlib from 'zlib';
+
+export type ExcelColumnType = 'string' | 'integer' | 'number' | 'currency' | 'percent' | 'date';
+
+export interface ExcelColumn {
+  header: string;
+  type?: ExcelColumnType;
+  /** Width in characters; derived from the header and values when omitted */
+  width?: number;
+}
+
+export type ExcelValue = string | number | Date | null | undefined;
+
+export interface ExcelSheet {
+  name: string;
+  /** Plain strings are untyped columns: numbers stay numbers, everything else is text */
+  columns: Array<string | ExcelColumn>;
+  rows: ExcelValue[][];
+}
+
+export const EXCEL_CONTENT_TYPE = 'application/vnd.openxmlformats-officedocument.spreadsheetml.sheet';
+export const EXCEL_FILE_EXTENSION = 'xlsx';
+
+// Index into cellXfs in STYLES below
+const STYLE = { default: 0, header: 1, integer: 2, number: 3, currency: 3, date: 4, percent: 5 } as const;
+
+const STYLES = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill><fill><patternFill patternType="solid"><fgColor rgb="FFE5E7EB"/></patternFill></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="6">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>
+<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="10" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`;
+
+const escapeXml = (value: string): string =>
+  value
+    .replace(/&/g, '&amp;')
+    .replace(/</g, '&lt;')
+    .replace(/>/g, '&gt;')
+    .replace(/"/g, '&quot;')
+    // Control characters other than tab/newline are invalid in XML
+    .replace(/[\u0000-\u0008\u000B\u000C\u000E-\u001F]/g, '');
+
+// 0 -> A, 27 -> AB
+const columnLetter = (index: number): string => {
+  let letters = '';
+  for (let n = index + 1; n > 0; n = Math.floor((n - 1) / 26)) {
+    letters = String.fromCharCode(65 + ((n - 1) % 26)) + letters;
+  }
+  return letters;
+};
+
+// Days since 1899-12-30, Excel's date epoch
+const toExcelDate = (date: Date) => date.getTime() / 86400000 + 25569;
+
+const toDate = (value: ExcelValue): Date | null => {
+  if (value instanceof Date) return isNaN(value.getTime()) ? null : value;
+  if (typeof value === 'string' && /^\d{4}-\d{2}-\d{2}/.test(value)) {
+    const date = new Date(value);
+    return isNaN(date.getTime()) ? null : date;
+  }
+  return null;
+};
+
+const toNumber = (value: ExcelValue): number | null => {
+  if (typeof value === 'number') return Number.isFinite(value) ? value : null;
+  if (typeof value === 'string' && value.trim() !== '' && !isNaN(Number(value))) return Number(value);
+  return null;
+};
+
+const normalizeColumn = (column: string | ExcelColumn): ExcelColumn =>
+  typeof column === 'string' ? { header: column } : column;
+
+function renderCell(value: ExcelValue, ref: string, type: ExcelColumnType | undefined): string {
+  if (value === null || value === undefined || value === '') return '';
+
+  if (type === 'date') {
+    const date = toDate(value);
+    if (date) return `<c r="${ref}" s="${STYLE.date}"><v>${toExcelDate(date)}</v></c>`;
+  } else if (type && type !== 'string') {
+    const number = toNumber(value);
+    if (number !== null) {
+      // Percent columns hold 0-100 values; Excel's percent format expects fractions
+      const stored = type === 'percent' ? number / 100 : number;
+      return `<c r="${ref}" s="${STYLE[type]}"><v>${stored}</v></c>`;
+    }
+  } else if (!type && typeof value === 'number' && Number.isFinite(value)) {
+    return `<c r="${ref}"><v>${value}</v></c>`;
+  }
+
+  const text = value instanceof Date ? value.toISOString() : String(value);
+  return `<c r="${ref}" t="inlineStr"><is><t xml:space="preserve">${escapeXml(text)}</t></is></c>`;
+}
+
+function renderSheet(sheet: ExcelSheet): string {
+  const columns = sheet.columns.map(normalizeColumn);
+  const widths = columns.map((column, index) => {
+    if (column.width) return column.width;
+    const longest = sheet.rows.slice(0, 200).reduce((max, row) => {
+      const value = row[index];
+      const length = value instanceof Date || column.type === 'date' ? 10 : value == null ? 0 : String(value).length;
+      return Math.max(max, length);
+    }, column.header.length);
+    return Math.min(Math.max(longest + 2, 8), 60);
+  });
+
+  const header = `<row r="1">${columns
+    .map((column, i) => `<c r="${columnLetter(i)}1" s="${STYLE.header}" t="inlineStr"><is><t>${escapeXml(column.header)}</t></is></c>`)
+    .join('')}</row>`;
+  const rows = sheet.rows
+    .map((row, r) => `<row r="${r + 2}">${columns.map((column, i) => renderCell(row[i], `${columnLetter(i)}${r + 2}`, column.type)).join('')}</row>`)
+    .join('');
+  const lastRef = `${columnLetter(Math.max(columns.length - 1, 0))}${sheet.rows.length + 1}`;
+
+  return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<cols>${widths.map((width, i) => `<col min="${i + 1}" max="${i + 1}" width="${width}" customWidth="1"/>`).join('')}</cols>
+<sheetData>${header}${rows}</sheetData>
+${columns.length ? `<autoFilter ref="A1:${lastRef}"/>` : ''}
+</worksheet>`;
+}
+
+// Excel limits sheet names to 31 characters, disallows some punctuation and needs them unique
+function sheetNames(sheets: ExcelSheet[]): string[] {
+  const used = new Set<string>();
+  return sheets.map((sheet, index) => {
+    const base = sheet.name.replace(/[\\/?*[\]:]/g, ' ').trim().slice(0, 31) || `Sheet${index + 1}`;
+    let name = base;
+    for (let n = 2; used.has(name.toLowerCase()); n++) {
+      name = `${base.slice(0, 31 - String(n).length - 1)} ${n}`;
+    }
+    used.add(name.toLowerCase());
+    return name;
+  });
+}
+
+export function buildExcelWorkbook(sheets: ExcelSheet[]): Buffer {
+  const names = sheetNames(sheets);
+  const files: Array<[string, string]> = [
+    ['[Content_Types].xml', `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+${sheets.map((_, i) => `<Override PartName="/xl/worksheets/sheet${i + 1}.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`).join('\n')}
+</Types>`],
+    ['_rels/.rels', `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`],
+    ['xl/workbook.xml', `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>${names.map((name, i) => `<sheet name="${escapeXml(name)}" sheetId="${i + 1}" r:id="rId${i + 1}"/>`).join('')}</sheets>
+</workbook>`],
+    ['xl/_rels/workbook.xml.rels', `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+${sheets.map((_, i) => `<Relationship Id="rId${i + 1}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet${i + 1}.xml"/>`).join('\n')}
+<Relationship Id="rId${sheets.length + 1}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`],
+    ['xl/styles.xml', STYLES],
+    ...sheets.map((sheet, i): [string, string] => [`xl/worksheets/sheet${i + 1}.xml`, renderSheet(sheet)]),
+  ];
+  return zip(files.map(([name, content]) => ({ name, data: Buffer.from(content, 'utf-8') })));
+}
+
+/**
+ * Single-column key/value sheet for report summaries
+ */
+export function summarySheet(name: string, rows: Array<[string, ExcelValue]>): ExcelSheet {
+  return { name, columns: ['Metric', 'Value'], rows: rows.map(([label, value]) => [label, value]) };
+}
+
+/**
+ * The same sheet as CSV, for exports that offer both formats
+ */
+export function sheetToCsv(sheet: ExcelSheet): string {
+  const cell = (value: ExcelValue) => {
+    if (value === null || value === undefined) return '';
+    const text = value instanceof Date ? value.toISOString() : String(value);
+    return /[",\n\r]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+  };
+  const header = sheet.columns.map(column => cell(normalizeColumn(column).header)).join(',');
+  return [header, ...sheet.rows.map(row => row.map(cell).join(','))].join('\n') + '\n';
+}
+
+// ---------------------------------------------------------------------------
+// Minimal ZIP writer (deflate, no encryption or zip64), enough for OOXML packages and data exports
+// ---------------------------------------------------------------------------
+
+const CRC_TABLE = (() => {
+  const table = new Uint32Array(256);
+  for (let n = 0; n < 256; n++) {
+    let c = n;
+    for (let k = 0; k < 8; k++) c = c & 1 ? 0xedb88320 ^ (c >>> 1) : c >>> 1;
+    table[n] = c >>> 0;
+  }
+  return table;
+})();
+
+function crc32(data: Buffer): number {
+  let crc = 0xffffffff;
+  for (let i = 0; i < data.length; i++) crc = CRC_TABLE[(crc ^ data[i]) & 0xff] ^ (crc >>> 8);
+  return (crc ^ 0xffffffff) >>> 0;
+}
+
+export function zip(entries: Array<{ name: string; data: Buffer }>): Buffer {
+  const locals: Buffer[] = [];
+  const centrals: Buffer[] = [];
+  let offset = 0;
+
+  // Fixed DOS timestamp (1980-01-01); Excel does not care and it keeps output reproducible
+  const dosTime = 0;
+  const dosDate = (0 << 9) | (1 << 5) | 1;
+
+  for (const entry of entries) {
+    const name = Buffer.from(entry.name, 'utf-8');
+    const compressed = zlib.deflateRawSync(entry.data);
+    const crc = crc32(entry.data);
+
+    const local = Buffer.alloc(30);
+    local.writeUInt32LE(0x04034b50, 0);
+    local.writeUInt16LE(20, 4);
+    local.writeUInt16LE(0x0800, 6); // UTF-8 names
+    local.writeUInt16LE(8, 8); // deflate
+    local.writeUInt16LE(dosTime, 10);
+    local.writeUInt16LE(dosDate, 12);
+    local.writeUInt32LE(crc, 14);
+    local.writeUInt32LE(compressed.length, 18);
+    local.writeUInt32LE(entry.data.length, 22);
+    local.writeUInt16LE(name.length, 26);
+    local.writeUInt16LE(0, 28);
+    locals.push(local, name, compressed);
+
+    const central = Buffer.alloc(46);
+    central.writeUInt32LE(0x02014b50, 0);
+    central.writeUInt16LE(20, 4);
+    central.writeUInt16LE(20, 6);
+    central.writeUInt16LE(0x0800, 8);
+    central.writeUInt16LE(8, 10);
+    central.writeUInt16LE(dosTime, 12);
+    central.writeUInt16LE(dosDate, 14);
+    central.writeUInt32LE(crc, 16);
+    central.writeUInt32LE(compressed.length, 20);
+    central.writeUInt32LE(entry.data.length, 24);
+    central.writeUInt16LE(name.length, 28);
+    central.writeUInt32LE(offset, 42);
+    centrals.push(central, name);
+
+    offset += local.length + name.length + compressed.length;
+  }
+
+  const centralSize = centrals.reduce((sum, b) => sum + b.length, 0);
+  const end = Buffer.alloc(22);
+  end.writeUInt32LE(0x06054b50, 0);
+  end.writeUInt16LE(entries.length, 8);
+  end.writeUInt16LE(entries.length, 10);
+  end.writeUInt32LE(centralSize, 12);
+  end.writeUInt32LE(offset, 16);
+
+  return Buffer.concat([...locals, ...centrals, end]);
+}
@@ -0,0 +1,11 @@
+/**
+ * Escape text for an HTML email body or attribute. Anything a user typed (names, titles,
+ * descriptions, notes) goes through this before it is interpolated into markup.
+ */
+export const escapeHtml = (value: string | number | null | undefined) =>
+  String(value ?? '').replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;').replace(/'/g, '&#039;');
+
+/**
+ * Escaped text with line breaks kept, for multi-line messages
+ */
+export const escapeHtmlLines = (value: string | null | undefined) => escapeHtml(value).replace(/\n/g, '<br>');
@@ -0,0 +1,252 @@
+/**
+ * Header-only readers for the media metadata chat clients need to lay out attachments before
+ * downloading them: pixel dimensions for images/video and playback length for audio/video.
+ * Unknown or truncated files simply yield no metadata.
+ */
+export interface MediaMetadata {
+  width?: number;
+  height?: number;
+  duration_seconds?: number;
+}
+
+const ascii = (buffer: Buffer, offset: number, length: number) =>
+  offset + length <= buffer.length ? buffer.toString('latin1', offset, offset + length) : '';
+
+const roundDuration = (seconds: number) =>
+  Number.isFinite(seconds) && seconds > 0 ? Math.round(seconds * 100) / 100 : undefined;
+
+function pngSize(buffer: Buffer): MediaMetadata | null {
+  if (buffer.length < 24 || buffer.readUInt32BE(0) !== 0x89504e47) return null;
+  return { width: buffer.readUInt32BE(16), height: buffer.readUInt32BE(20) };
+}
+
+function gifSize(buffer: Buffer): MediaMetadata | null {
+  if (ascii(buffer, 0, 4) !== 'GIF8' || buffer.length < 10) return null;
+  return { width: buffer.readUInt16LE(6), height: buffer.readUInt16LE(8) };
+}
+
+function jpegSize(buffer: Buffer): MediaMetadata | null {
+  if (buffer.length < 4 || buffer[0] !== 0xff || buffer[1] !== 0xd8) return null;
+  let offset = 2;
+  while (offset + 9 < buffer.length) {
+    if (buffer[offset] !== 0xff) return null;
+    const marker = buffer[offset + 1];
+    // SOF0-SOF15 carry the frame size; C4 (DHT), C8 (JPG) and CC (DAC) share the range but do not
+    if (marker >= 0xc0 && marker <= 0xcf && ![0xc4, 0xc8, 0xcc].includes(marker)) {
+      return { height: buffer.readUInt16BE(offset + 5), width: buffer.readUInt16BE(offset + 7) };
+    }
+    offset += 2 + buffer.readUInt16BE(offset + 2);
+  }
+  return null;
+}
+
+function webpSize(buffer: Buffer): MediaMetadata | null {
+  if (ascii(buffer, 0, 4) !== 'RIFF' || ascii(buffer, 8, 4) !== 'WEBP' || buffer.length < 30) return null;
+  switch (ascii(buffer, 12, 4)) {
+    case 'VP8 ':
+      return { width: buffer.readUInt16LE(26) & 0x3fff, height: buffer.readUInt16LE(28) & 0x3fff };
+    case 'VP8L': {
+      const [b0, b1, b2, b3] = [buffer[21], buffer[22], buffer[23], buffer[24]];
+      return {
+        width: 1 + (((b1 & 0x3f) << 8) | b0),
+        height: 1 + (((b3 & 0x0f) << 10) | (b2 << 2) | ((b1 & 0xc0) >> 6)),
+      };
+    }
+    case 'VP8X':
+      return { width: 1 + buffer.readUIntLE(24, 3), height: 1 + buffer.readUIntLE(27, 3) };
+    default:
+      return null;
+  }
+}
+
+interface Box {
+  type: string;
+  start: number; // first byte of the payload
+  end: number;
+}
+
+function* boxes(buffer: Buffer, start: number, end: number): Generator<Box> {
+  let offset = start;
+  while (offset + 8 <= end) {
+    let size = buffer.readUInt32BE(offset);
+    let header = 8;
+    if (size === 1) {
+      if (offset + 16 > end) return;
+      size = Number(buffer.readBigUInt64BE(offset + 8));
+      header = 16;
+    } else if (size === 0) {
+      size = end - offset;
+    }
+    if (size < header) return;
+    yield { type: ascii(buffer, offset + 4, 4), start: offset + header, end: Math.min(offset + size, end) };
+    offset += size;
+  }
+}
+
+const findBox = (buffer: Buffer, path: string[], start = 0, end = buffer.length): Box | null => {
+  for (const box of boxes(buffer, start, end)) {
+    if (box.type === path[0]) {
+      return path.length === 1 ? box : findBox(buffer, path.slice(1), box.start, box.end);
+    }
+  }
+  return null;
+};
+
+/**
+ * MP4, MOV, M4A and 3GP: duration from moov/mvhd, frame size from the first visual track header
+ */
+function isoMediaMetadata(buffer: Buffer): MediaMetadata | null {
+  if (ascii(buffer, 4, 4) !== 'ftyp') return null;
+  const moov = findBox(buffer, ['moov']);
+  if (!moov) return null;
+
+  const metadata: MediaMetadata = {};
+  const mvhd = findBox(buffer, ['mvhd'], moov.start, moov.end);
+  if (mvhd && mvhd.end - mvhd.start >= 32) {
+    const version = buffer[mvhd.start];
+    const timescale = buffer.readUInt32BE(mvhd.start + (version === 1 ? 20 : 12));
+    const duration = version === 1
+      ? Number(buffer.readBigUInt64BE(mvhd.start + 24))
+      : buffer.readUInt32BE(mvhd.start + 16);
+    metadata.duration_seconds = timescale ? roundDuration(duration / timescale) : undefined;
+  }
+
+  for (const trak of boxes(buffer, moov.start, moov.end)) {
+    if (trak.type !== 'trak') continue;
+    const tkhd = findBox(buffer, ['tkhd'], trak.start, trak.end);
+    if (!tkhd) continue;
+    const sizeOffset = tkhd.start + (buffer[tkhd.start] === 1 ? 88 : 76);
+    if (sizeOffset + 8 > tkhd.end) continue;
+    // 16.16 fixed point
+    const width = buffer.readUInt32BE(sizeOffset) >>> 16;
+    const height = buffer.readUInt32BE(sizeOffset + 4) >>> 16;
+    if (width && height) {
+      metadata.width = width;
+      metadata.height = height;
+      break;
+    }
+  }
+  return metadata;
+}
+
+/**
+ * HEIC/HEIF stills: the image spatial extents ('ispe') property; the largest one is the primary image
+ */
+function heifSize(buffer: Buffer): MediaMetadata | null {
+  if (ascii(buffer, 4, 4) !== 'ftyp') return null;
+  let best: MediaMetadata | null = null;
+  let offset = buffer.indexOf('ispe', 0, 'latin1');
+  while (offset !== -1 && offset + 16 <= buffer.length) {
+    const width = buffer.readUInt32BE(offset + 8);
+    const height = buffer.readUInt32BE(offset + 12);
+    if (!best || width * height > best.width! * best.height!) {
+      best = { width, height };
+    }
+    offset = buffer.indexOf('ispe', offset + 4, 'latin1');
+  }
+  return best;
+}
+
+function wavDuration(buffer: Buffer): MediaMetadata | null {
+  if (ascii(buffer, 0, 4) !== 'RIFF' || ascii(buffer, 8, 4) !== 'WAVE') return null;
+  let byteRate = 0;
+  let offset = 12;
+  while (offset + 8 <= buffer.length) {
+    const id = ascii(buffer, offset, 4);
+    const size = buffer.readUInt32LE(offset + 4);
+    if (id === 'fmt ' && offset + 16 <= buffer.length) {
+      byteRate = buffer.readUInt32LE(offset + 16);
+    } else if (id === 'data') {
+      return byteRate ? { duration_seconds: roundDuration(size / byteRate) } : null;
+    }
+    offset += 8 + size + (size % 2);
+  }
+  return null;
+}
+
+const MP3_BITRATES: Record<'v1' | 'v2', number[]> = {
+  v1: [0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320],
+  v2: [0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160],
+};
+const MP3_SAMPLE_RATES: Record<number, number[]> = {
+  3: [44100, 48000, 32000], // MPEG-1
+  2: [22050, 24000, 16000], // MPEG-2
+  0: [11025, 12000, 8000], // MPEG-2.5
+};
+
+/**
+ * MPEG layer III: exact length from a Xing/Info header when the encoder wrote one, else estimated as CBR
+ */
+function mp3Duration(buffer: Buffer): MediaMetadata | null {
+  let offset = 0;
+  if (ascii(buffer, 0, 3) === 'ID3' && buffer.length >= 10) {
+    offset = 10 + ((buffer[6] << 21) | (buffer[7] << 14) | (buffer[8] << 7) | buffer[9]);
+  }
+  while (offset + 4 <= buffer.length && !(buffer[offset] === 0xff && (buffer[offset + 1] & 0xe0) === 0xe0)) {
+    offset++;
+  }
+  if (offset + 4 > buffer.length) return null;
+
+  const version = (buffer[offset + 1] >> 3) & 0x03;
+  const layer = (buffer[offset + 1] >> 1) & 0x03;
+  const bitrateIndex = buffer[offset + 2] >> 4;
+  const sampleRateIndex = (buffer[offset + 2] >> 2) & 0x03;
+  const mono = (buffer[offset + 3] >> 6) === 3;
+  if (layer !== 1 || version === 1 || sampleRateIndex === 3) return null;
+
+  const sampleRate = MP3_SAMPLE_RATES[version][sampleRateIndex];
+  const samplesPerFrame = version === 3 ? 1152 : 576;
+  const sideInfo = version === 3 ? (mono ? 17 : 32) : (mono ? 9 : 17);
+  const xing = offset + 4 + sideInfo;
+  const tag = ascii(buffer, xing, 4);
+  if ((tag === 'Xing' || tag === 'Info') && xing + 12 <= buffer.length && buffer.readUInt32BE(xing + 4) & 0x01) {
+    return { duration_seconds: roundDuration((buffer.readUInt32BE(xing + 8) * samplesPerFrame) / sampleRate) };
+  }
+
+  const bitrate = MP3_BITRATES[version === 3 ? 'v1' : 'v2'][bitrateIndex] * 1000;
+  return bitrate ? { duration_seconds: roundDuration(((buffer.length - offset) * 8) / bitrate) } : null;
+}
+
+/**
+ * Ogg Opus and Vorbis (typical voice notes): granule position of the last page over the sample rate
+ */
+function oggDuration(buffer: Buffer): MediaMetadata | null {
+  if (ascii(buffer, 0, 4) !== 'OggS') return null;
+  let rate = 0;
+  let preSkip = 0;
+  const opus = buffer.indexOf('OpusHead', 0, 'latin1');
+  if (opus !== -1 && opus + 12 <= buffer.length) {
+    rate = 48000; // Opus granule positions always count 48 kHz samples
+    preSkip = buffer.readUInt16LE(opus + 10);
+  } else {
+    const vorbis = buffer.indexOf('\x01vorbis', 0, 'latin1');
+    if (vorbis !== -1 && vorbis + 16 <= buffer.length) {
+      rate = buffer.readUInt32LE(vorbis + 12);
+    }
+  }
+  const lastPage = buffer.lastIndexOf('OggS', buffer.length - 1, 'latin1');
+  if (!rate || lastPage === -1 || lastPage + 14 > buffer.length) return null;
+  const granule = Number(buffer.readBigUInt64LE(lastPage + 6));
+  return { duration_seconds: roundDuration((granule - preSkip) / rate) };
+}
+
+export function readMediaMetadata(buffer: Buffer, mimeType: string): MediaMetadata {
+  const readers: Array<(buffer: Buffer) => MediaMetadata | null> =
+    mimeType === 'image/heic' || mimeType === 'image/heif' ? [heifSize]
+      : mimeType.startsWith('image/') ? [pngSize, jpegSize, gifSize, webpSize]
+        : mimeType.startsWith('video/') ? [isoMediaMetadata]
+          : mimeType === 'audio/mpeg' || mimeType === 'audio/mp3' ? [mp3Duration]
+            : mimeType.startsWith('audio/') ? [isoMediaMetadata, oggDuration, wavDuration]
+              : [];
+  for (const read of readers) {
+    try {
+      const metadata = read(buffer);
+      if (metadata) {
+        return Object.fromEntries(Object.entries(metadata).filter(([, value]) => value !== undefined)) as MediaMetadata;
+      }
+    } catch {
+      // Malformed header: try the next reader
+    }
+  }
+  return {};
+}
@@ -0,0 +1,171 @@
+/**
+ * Minimal MIME reader for inbound email: headers, the text and HTML bodies and attachments of
+ * a raw RFC 5322 message. The message is handled as a latin1 string so every byte survives
+ * until a part is decoded with its own transfer encoding and charset.
+ */
+export interface ParsedEmailAttachment {
+  filename: string;
+  contentType: string;
+  content: Buffer;
+}
+
+export interface ParsedEmail {
+  headers: Record<string, string>;
+  from: string | null;
+  to: string[];
+  subject: string | null;
+  messageId: string | null;
+  text: string | null;
+  html: string | null;
+  attachments: ParsedEmailAttachment[];
+}
+
+const MAX_DEPTH = 10;
+
+const splitHead = (raw: string) => {
+  const match = /\r?\n\r?\n/.exec(raw);
+  return match
+    ? { head: raw.slice(0, match.index), body: raw.slice(match.index + match[0].length) }
+    : { head: raw, body: '' };
+};
+
+const parseHeaders = (head: string) => {
+  const headers: Record<string, string> = {};
+  for (const line of head.replace(/\r?\n[ \t]+/g, ' ').split(/\r?\n/)) {
+    const colon = line.indexOf(':');
+    if (colon <= 0) continue;
+    const name = line.slice(0, colon).trim().toLowerCase();
+    // Keep the first occurrence; later Received-style repeats don't matter here
+    if (!(name in headers)) headers[name] = line.slice(colon + 1).trim();
+  }
+  return headers;
+};
+
+/**
+ * "text/plain; charset=utf-8; name=\"a.txt\"" → { value: 'text/plain', params: { charset, name } }
+ */
+const parseHeaderValue = (value = '') => {
+  const [first, ...rest] = value.split(';');
+  const params: Record<string, string> = {};
+  for (const param of rest) {
+    const eq = param.indexOf('=');
+    if (eq <= 0) continue;
+    const key = param.slice(0, eq).trim().toLowerCase().replace(/\*$/, '');
+    let val = param.slice(eq + 1).trim().replace(/^"(.*)"$/, '$1');
+    // RFC 2231 extended value: utf-8''file%20name.pdf
+    const extended = /^([\w-]+)'[\w-]*'(.*)$/.exec(val);
+    if (extended) {
+      try {
+        val = decodeURIComponent(extended[2]);
+      } catch {
+        val = extended[2];
+      }
+    }
+    params[key] = val;
+  }
+  return { value: first.trim().toLowerCase(), params };
+};
+
+const decodeCharset = (bytes: Buffer, charset = 'utf-8') => {
+  try {
+    return new TextDecoder(charset.toLowerCase(), { fatal: false }).decode(bytes);
+  } catch {
+    return bytes.toString('utf8');
+  }
+};
+
+const decodeQuotedPrintable = (text: string) =>
+  Buffer.from(
+    text.replace(/=\r?\n/g, '').replace(/=([0-9A-Fa-f]{2})/g, (_, hex: string) => String.fromCharCode(parseInt(hex, 16))),
+    'latin1'
+  );
+
+const decodeTransfer = (body: string, encoding = '') => {
+  switch (encoding.trim().toLowerCase()) {
+    case 'base64':
+      return Buffer.from(body.replace(/[^A-Za-z0-9+/=]/g, ''), 'base64');
+    case 'quoted-printable':
+      return decodeQuotedPrintable(body);
+    default:
+      return Buffer.from(body, 'latin1');
+  }
+};
+
+/**
+ * RFC 2047 encoded words in headers: =?utf-8?B?...?= and =?utf-8?Q?...?=
+ */
+export const decodeHeaderWords = (value: string) =>
+  value
+    .replace(/(=\?[^?]+\?[BbQq]\?[^?]*\?=)\s+(?==\?)/g, '$1')
+    .replace(/=\?([^?]+)\?([BbQq])\?([^?]*)\?=/g, (_, charset: string, encoding: string, text: string) => {
+      const bytes = encoding.toUpperCase() === 'B'
+        ? Buffer.from(text, 'base64')
+        : decodeQuotedPrintable(text.replace(/_/g, ' '));
+      return decodeCharset(bytes, charset);
+    });
+
+/**
+ * The bare address out of "Jane Doe <jane@example.com>"
+ */
+export const emailAddressOf = (value: string | null | undefined) => {
+  if (!value) return null;
+  const match = /<([^>]+)>/.exec(value) || /([^\s,;<>"]+@[^\s,;<>"]+)/.exec(value);
+  return match ? match[1].trim().toLowerCase() : null;
+};
+
+export function parseMime(raw: Buffer | string): ParsedEmail {
+  const source = Buffer.isBuffer(raw) ? raw.toString('latin1') : raw;
+  const { head, body } = splitHead(source);
+  const headers = parseHeaders(head);
+  const parsed: ParsedEmail = {
+    headers,
+    from: headers.from ? decodeHeaderWords(headers.from) : null,
+    to: [headers.to, headers.cc, headers['delivered-to']]
+      .filter(Boolean)
+      .flatMap(list => list!.split(','))
+      .map(emailAddressOf)
+      .filter((address): address is string => !!address),
+    subject: headers.subject ? decodeHeaderWords(headers.subject) : null,
+    messageId: headers['message-id']?.replace(/^<|>$/g, '') || null,
+    text: null,
+    html: null,
+    attachments: [],
+  };
+
+  const walk = (partHeaders: Record<string, string>, partBody: string, depth: number) => {
+    const type = parseHeaderValue(partHeaders['content-type'] || 'text/plain');
+    const disposition = parseHeaderValue(partHeaders['content-disposition'] || '');
+
+    if (type.value.startsWith('multipart/') && type.params.boundary && depth < MAX_DEPTH) {
+      const delimiter = `--${type.params.boundary}`;
+      const sections = partBody.split(delimiter).slice(1);
+      for (const section of sections) {
+        if (section.startsWith('--')) break; // closing delimiter
+        const { head: childHead, body: childBody } = splitHead(section.replace(/^\r?\n/, ''));
+        walk(parseHeaders(childHead), childBody.replace(/\r?\n$/, ''), depth + 1);
+      }
+      return;
+    }
+    if (type.value === 'message/rfc822') {
+      return; // forwarded messages are not part of the reply
+    }
+
+    const content = decodeTransfer(partBody, partHeaders['content-transfer-encoding']);
+    const filename = disposition.params.filename || type.params.name;
+    const inline = disposition.value !== 'attachment' && !filename;
+    if (inline && type.value === 'text/plain' && parsed.text === null) {
+      parsed.text = decodeCharset(content, type.params.charset);
+    } else if (inline && type.value === 'text/html' && parsed.html === null) {
+      parsed.html = decodeCharset(content, type.params.charset);
+    } else if (!inline || !type.value.startsWith('text/')) {
+      parsed.attachments.push({
+        filename: filename ? decodeHeaderWords(filename) : `attachment-${parsed.attachments.length + 1}`,
+        contentType: type.value,
+        content,
+      });
+    }
+  };
+
+  walk(headers, body, 0);
+  return parsed;
+}
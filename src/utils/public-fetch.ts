@@ -0,0 +1,125 @@
+import dns from 'dns';
+import http from 'http';
+import https from 'https';
+import net from 'net';
+
+const DEFAULT_TIMEOUT_MS = 10_000;
+const DEFAULT_MAX_BYTES = 2 * 1024 * 1024;
+const MAX_REDIRECTS = 3;
+
+// Loopback, private, link-local (cloud metadata), carrier-grade NAT, multicast and reserved ranges
+const BLOCKED = new net.BlockList();
+for (const [network, prefix] of [
+  ['0.0.0.0', 8], ['10.0.0.0', 8], ['100.64.0.0', 10], ['127.0.0.0', 8], ['169.254.0.0', 16],
+  ['172.16.0.0', 12], ['192.0.0.0', 24], ['192.0.2.0', 24], ['192.168.0.0', 16], ['198.18.0.0', 15],
+  ['198.51.100.0', 24], ['203.0.113.0', 24], ['224.0.0.0', 4], ['240.0.0.0', 4],
+] as const) {
+  BLOCKED.addSubnet(network, prefix, 'ipv4');
+}
+for (const [network, prefix] of [
+  ['::', 128], ['::1', 128], ['64:ff9b::', 96], ['100::', 64], ['2001:db8::', 32], ['fc00::', 7], ['fe80::', 10], ['ff00::', 8],
+] as const) {
+  BLOCKED.addSubnet(network, prefix, 'ipv6');
+}
+
+export const isPublicAddress = (address: string): boolean => {
+  const mapped = address.match(/^::ffff:(\d+\.\d+\.\d+\.\d+)$/i);
+  if (mapped) return isPublicAddress(mapped[1]);
+  const family = net.isIP(address);
+  if (family === 0) return false;
+  return !BLOCKED.check(address, family === 4 ? 'ipv4' : 'ipv6');
+};
+
+/**
+ * Parse a URL a user asked us to fetch: http or https, no credentials
+ */
+export const parsePublicUrl = (value: string): URL => {
+  let url: URL;
+  try {
+    url = new URL(value);
+  } catch {
+    throw new Error('URL must be a valid http or https address');
+  }
+  if (!['http:', 'https:'].includes(url.protocol) || url.username || url.password) {
+    throw new Error('URL must be a valid http or https address');
+  }
+  return url;
+};
+
+// Resolve the host and connect only to a public address, so a name cannot be pointed at the
+// internal network between the check and the connection
+const publicLookup: net.LookupFunction = (hostname, options, callback) => {
+  dns.lookup(hostname, { ...options, all: true }, (error, addresses) => {
+    if (error) return (callback as any)(error);
+    const list = addresses as dns.LookupAddress[];
+    const address = list.find(entry => isPublicAddress(entry.address));
+    if (!address || list.some(entry => !isPublicAddress(entry.address))) {
+      return (callback as any)(new Error(`${hostname} does not resolve to a public address`));
+    }
+    if ((options as dns.LookupOptions).all) return (callback as any)(null, [address]);
+    return (callback as any)(null, address.address, address.family);
+  });
+};
+
+/**
+ * GET a user-supplied URL on the public internet and return the body as text. Private, loopback
+ * and metadata addresses are refused (also after redirects), and the request is cut off after
+ * `timeoutMs` or once the body passes `maxBytes`.
+ */
+export async function fetchPublicText(
+  value: string,
+  options: { timeoutMs?: number; maxBytes?: number } = {}
+): Promise<{ status: number; body: string }> {
+  const timeoutMs = options.timeoutMs ?? DEFAULT_TIMEOUT_MS;
+  const maxBytes = options.maxBytes ?? DEFAULT_MAX_BYTES;
+  const deadline = Date.now() + timeoutMs;
+
+  let url = parsePublicUrl(value);
+  for (let redirects = 0; ; redirects++) {
+    const response = await requestOnce(url, Math.max(deadline - Date.now(), 1), maxBytes);
+    if (response.location && response.status >= 300 && response.status < 400) {
+      if (redirects >= MAX_REDIRECTS) {
+        throw new Error('too many redirects');
+      }
+      url = parsePublicUrl(new URL(response.location, url).toString());
+      continue;
+    }
+    return { status: response.status, body: response.body };
+  }
+}
+
+function requestOnce(url: URL, timeoutMs: number, maxBytes: number): Promise<{ status: number; location?: string; body: string }> {
+  if (net.isIP(url.hostname.replace(/^\[|\]$/g, '')) && !isPublicAddress(url.hostname.replace(/^\[|\]$/g, ''))) {
+    return Promise.reject(new Error(`${url.hostname} is not a public address`));
+  }
+  const client = url.protocol === 'https:' ? https : http;
+  return new Promise((resolve, reject) => {
+    const request = client.get(url, { lookup: publicLookup, timeout: timeoutMs }, response => {
+      const status = response.statusCode || 0;
+      if (status >= 300 && status < 400 && response.headers.location) {
+        response.resume();
+        return resolve({ status, location: response.headers.location, body: '' });
+      }
+      if (Number(response.headers['content-length'] || 0) > maxBytes) {
+        request.destroy(new Error(`response is larger than ${maxBytes} bytes`));
+        return;
+      }
+      const chunks: Buffer[] = [];
+      let size = 0;
+      response.on('data', (chunk: Buffer) => {
+        size += chunk.length;
+        if (size > maxBytes) {
+          request.destroy(new Error(`response is larger than ${maxBytes} bytes`));
+          return;
+        }
+        chunks.push(chunk);
+      });
+      response.on('end', () => resolve({ status, body: Buffer.concat(chunks).toString('utf8') }));
+      response.on('error', reject);
+    });
+    const timer = setTimeout(() => request.destroy(new Error('request timed out')), timeoutMs);
+    request.on('timeout', () => request.destroy(new Error('request timed out')));
+    request.on('error', reject);
+    request.on('close', () => clearTimeout(timer));
+  });
+}
@@ -0,0 +1,27 @@
+import { AsyncLocalStorage } from 'async_hooks';
+import type { JWTClaims } from '../types/index.js';
+
+interface RequestContext {
+  user?: JWTClaims;
+  // Set while a service makes writes it has already authorised itself
+  system?: boolean;
+}
+
+const storage = new AsyncLocalStorage<RequestContext>();
+
+/**
+ * Run the rest of a request (or any work done for a user) with the caller on record, so shared
+ * code such as the Prisma client can tell who it is acting for
+ */
+export const runAsUser = <T>(user: JWTClaims, fn: () => T): T => storage.run({ user }, fn);
+
+// The signed-in caller of the request being handled; undefined for public routes and background jobs
+export const currentUser = (): JWTClaims | undefined => storage.getStore()?.user;
+
+/**
+ * Run work a service has already checked the caller may do outside the caller's tenancy scope, such
+ * as a landlord's delegation putting an agency on their property. The caller stays on record.
+ */
+export const runAsSystem = <T>(fn: () => T): T => storage.run({ ...storage.getStore(), system: true }, fn);
+
+export const inSystemScope = (): boolean => storage.getStore()?.system === true;
@@ -1,4 +1,5 @@
 import { Request, Response, NextFunction } from 'express';
+import multer from 'multer';
 
 export const writeSuccess = (res: Response, status: number, message: string, data?: unknown) => {
 	res.status(status).json({ success: true, message, data });
@@ -9,6 +10,13 @@ export const writeError = (res: Response, status: number, message: string, error
 };
 
 export const errorHandler = (err: unknown, _req: Request, res: Response, _next: NextFunction) => {
+	// Upload limits are the client's fault, not ours
+	if (err instanceof multer.MulterError) {
+		writeError(res, err.code === 'LIMIT_FILE_SIZE' ? 413 : 400, err.message, { code: err.code, field: err.field });
+		return;
+	}
+	// Kept for the request log, which records the stack
+	res.locals.error = err;
 	const message = err instanceof Error ? err.message : 'Internal Server Error';
 	writeError(res, 500, message);
 };
@@ -0,0 +1,289 @@
+import { Prisma } from '@prisma/client';
+import { JWTClaims } from '../types/index.js';
+import { currentUser, inSystemScope } from './request-context.js';
+
+/**
+ * Whose rows a caller may touch: everything (super admins), one agency's, or one owner's
+ * (landlords and their own staff, who sit outside any agency)
+ */
+export type TenancyScope =
+  | { kind: 'all' }
+  | { kind: 'agency'; agencyId: string; companyId: string | null }
+  | { kind: 'owner'; ownerId: string | null; companyId: string | null };
+
+type Filter = Record<string, unknown>;
+
+interface ModelScope {
+  agency: (scope: Extract<TenancyScope, { kind: 'agency' }>) => Filter;
+  // Landlords' filter; models without one are agency-only and owners see none of their rows
+  owner?: (scope: Extract<TenancyScope, { kind: 'owner' }>) => Filter;
+  // What writes may touch, where it differs from what reads may see
+  agencyWrite?: (scope: Extract<TenancyScope, { kind: 'agency' }>) => Filter;
+  // Scalar columns a write must not point at another agency or owner
+  agencyColumn?: string;
+  ownerColumn?: string;
+  // Rows with no column of their own belong to the parent named here, which must be in scope
+  parent?: { model: string; field: string };
+}
+
+// Matches no row; what a caller outside a model's scope gets
+const NOTHING: Filter = { id: { in: [] } };
+const inCompany = (scope: { companyId: string | null }): Filter => (scope.companyId ? { company_id: scope.companyId } : NOTHING);
+
+// Rows without an agency belong to the company and are shared with its agencies
+const sharedWithCompany: ModelScope = {
+  agency: scope => ({ OR: [{ agency_id: scope.agencyId }, { agency_id: null, ...(scope.companyId ? { company_id: scope.companyId } : NOTHING) }] }),
+  owner: scope => (scope.companyId ? { agency_id: null, company_id: scope.companyId } : NOTHING),
+  agencyWrite: scope => ({ agency_id: scope.agencyId }),
+  agencyColumn: 'agency_id',
+};
+
+const agencyOnly: ModelScope = {
+  agency: scope => ({ agency_id: scope.agencyId }),
+  agencyColumn: 'agency_id',
+};
+
+// Rows on a property follow it; invoices and payments raised without one belong to the company
+// and are shared with its agencies
+const onProperty = (optional: boolean): ModelScope => ({
+  agency: scope => (optional
+    ? { OR: [{ property: { agency_id: scope.agencyId } }, { property_id: null, ...inCompany(scope) }] }
+    : { property: { agency_id: scope.agencyId } }),
+  owner: scope => (!scope.ownerId ? NOTHING : optional
+    ? { OR: [{ property: { owner_id: scope.ownerId } }, { property_id: null, ...inCompany(scope) }] }
+    : { property: { owner_id: scope.ownerId } }),
+  parent: { model: 'Property', field: 'property_id' },
+});
+
+// Tenants are seen through the property they live in; one between homes stays with the company
+const livingAt = (property: Filter, scope: { companyId: string | null }): Filter => ({
+  OR: [{ current_property: property }, { current_property_id: null, user: inCompany(scope) }],
+});
+
+/**
+ * Agency-scoped models and how each is narrowed to the caller. Units, leases, maintenance,
+ * invoices, payments and tenants carry no agency of their own and follow their property.
+ */
+export const TENANCY_SCOPES: Record<string, ModelScope> = {
+  Property: {
+    agency: scope => ({ agency_id: scope.agencyId }),
+    owner: scope => (scope.ownerId ? { owner_id: scope.ownerId } : NOTHING),
+    agencyColumn: 'agency_id',
+    ownerColumn: 'owner_id',
+  },
+  Unit: {
+    agency: scope => ({ property: { agency_id: scope.agencyId } }),
+    owner: scope => (scope.ownerId ? { property: { owner_id: scope.ownerId } } : NOTHING),
+    parent: { model: 'Property', field: 'property_id' },
+  },
+  Lease: onProperty(false),
+  MaintenanceRequest: onProperty(false),
+  Invoice: onProperty(true),
+  Payment: onProperty(true),
+  TenantProfile: {
+    agency: scope => livingAt({ agency_id: scope.agencyId }, scope),
+    owner: scope => (scope.ownerId ? livingAt({ owner_id: scope.ownerId }, scope) : NOTHING),
+    parent: { model: 'Property', field: 'current_property_id' },
+  },
+  TenantDocument: {
+    agency: scope => ({ tenant: { tenant_profile: livingAt({ agency_id: scope.agencyId }, scope) } }),
+    owner: scope => (scope.ownerId ? { tenant: { tenant_profile: livingAt({ owner_id: scope.ownerId }, scope) } } : NOTHING),
+  },
+  PropertyDelegation: {
+    agency: scope => ({ agency_id: scope.agencyId }),
+    owner: scope => (scope.ownerId ? { landlord_id: scope.ownerId } : NOTHING),
+    agencyColumn: 'agency_id',
+    ownerColumn: 'landlord_id',
+  },
+  AgencyBranding: agencyOnly,
+  AgencyOnboarding: agencyOnly,
+  AgencyHealthScore: agencyOnly,
+  AgencyStatusChange: agencyOnly,
+  AgencyUsage: agencyOnly,
+  MessageTemplate: sharedWithCompany,
+  EmergencyContact: sharedWithCompany,
+  MessageEscalationRule: sharedWithCompany,
+};
+
+const FILTERED_OPERATIONS = [
+  'findUnique', 'findUniqueOrThrow', 'findFirst', 'findFirstOrThrow', 'findMany',
+  'count', 'aggregate', 'groupBy',
+  'update', 'updateMany', 'updateManyAndReturn', 'upsert', 'delete', 'deleteMany',
+];
+const WRITE_OPERATIONS = ['update', 'updateMany', 'updateManyAndReturn', 'upsert', 'delete', 'deleteMany'];
+const CREATE_OPERATIONS = ['create', 'createMany', 'createManyAndReturn', 'upsert'];
+
+export function tenancyScopeFor(user: JWTClaims): TenancyScope {
+  if (user.role === 'super_admin') {
+    return { kind: 'all' };
+  }
+  if (user.agency_id) {
+    return { kind: 'agency', agencyId: user.agency_id, companyId: user.company_id || null };
+  }
+  // A landlord's staff work on the landlord's properties
+  const ownerId = user.role === 'landlord' ? user.user_id : user.landlord_id || null;
+  return { kind: 'owner', ownerId, companyId: user.company_id || null };
+}
+
+/**
+ * The filter a scope puts on a model's rows, or null when the model is not agency-scoped or the
+ * caller sees everything
+ */
+export function tenancyFilter(model: string, scope: TenancyScope, forWrite: boolean = false): Filter | null {
+  const config = TENANCY_SCOPES[model];
+  if (!config || scope.kind === 'all') return null;
+  if (scope.kind === 'agency') {
+    return forWrite && config.agencyWrite ? config.agencyWrite(scope) : config.agency(scope);
+  }
+  return config.owner ? config.owner(scope) : NOTHING;
+}
+
+/**
+ * The query's arguments narrowed to the caller: its where gains the scope filter (alongside any
+ * unique key, so findUnique and update stay valid) and data it creates or changes is checked
+ * against the caller's agency or ownership. Throws rather than write across agencies.
+ */
+export function scopeQuery(model: string, operation: string, args: any, scope: TenancyScope): any {
+  const config = TENANCY_SCOPES[model];
+  if (!config || scope.kind === 'all') return args;
+  const scoped = { ...(args || {}) };
+
+  if (FILTERED_OPERATIONS.includes(operation)) {
+    const filter = tenancyFilter(model, scope, WRITE_OPERATIONS.includes(operation))!;
+    const where = scoped.where || {};
+    const and = where.AND === undefined ? [] : Array.isArray(where.AND) ? where.AND : [where.AND];
+    scoped.where = { ...where, AND: [...and, filter] };
+  }
+
+  if (CREATE_OPERATIONS.includes(operation)) {
+    if (operation === 'upsert') {
+      scoped.create = stampRow(model, config, scoped.create, scope);
+    } else if (Array.isArray(scoped.data)) {
+      scoped.data = scoped.data.map((row: any) => stampRow(model, config, row, scope));
+    } else {
+      scoped.data = stampRow(model, config, scoped.data, scope);
+    }
+  }
+  if (WRITE_OPERATIONS.includes(operation) && operation !== 'delete' && operation !== 'deleteMany') {
+    const changes = operation === 'upsert' ? scoped.update : scoped.data;
+    assertStaysInScope(model, config, changes, scope);
+  }
+  return scoped;
+}
+
+/**
+ * Parent rows a create or re-parenting update points at, which the caller must be able to see:
+ * a unit is only created under one of the caller's properties
+ */
+export function parentReferences(model: string, operation: string, args: any): Array<{ model: string; id: string }> {
+  const parent = TENANCY_SCOPES[model]?.parent;
+  if (!parent || !args) return [];
+  const rows = [
+    ...(CREATE_OPERATIONS.includes(operation)
+      ? operation === 'upsert' ? [args.create] : Array.isArray(args.data) ? args.data : [args.data]
+      : []),
+    ...(WRITE_OPERATIONS.includes(operation) ? [operation === 'upsert' ? args.update : args.data] : []),
+  ];
+  const relation = parent.field.replace(/_id$/, '');
+  const ids = rows
+    .filter(Boolean)
+    .map((row: any) => row[parent.field] ?? row[relation]?.connect?.id)
+    .filter((id: unknown): id is string => typeof id === 'string');
+  return [...new Set(ids)].map(id => ({ model: parent.model, id }));
+}
+
+/**
+ * Run one query narrowed to the scope, after checking the parent rows it writes under are in
+ * scope too. `client` is an unscoped client for those checks.
+ */
+export async function runScoped(client: any, scope: TenancyScope, model: string, operation: string, args: any, query: (args: any) => Promise<any>) {
+  const scoped = scopeQuery(model, operation, args, scope);
+  for (const ref of parentReferences(model, operation, scoped)) {
+    const filter = tenancyFilter(ref.model, scope)!;
+    const delegate = client[ref.model.charAt(0).toLowerCase() + ref.model.slice(1)];
+    if ((await delegate.count({ where: { AND: [{ id: ref.id }, filter] } })) === 0) {
+      throw new Error(`${ref.model.toLowerCase()} not found`);
+    }
+  }
+  return query(scoped);
+}
+
+/**
+ * The scope for the request being handled: agency staff, and landlords with their own staff.
+ * Tenants are held to their own lease by the services, and public routes and background jobs
+ * have no caller.
+ */
+export function requestTenancyScope(user: JWTClaims | undefined): TenancyScope | null {
+  if (!user || user.role === 'tenant') return null;
+  const scope = tenancyScopeFor(user);
+  if (scope.kind === 'all' || (scope.kind === 'owner' && !scope.ownerId)) return null;
+  return scope;
+}
+
+/**
+ * The scope queries are held to right now: the request caller's, or none inside runAsSystem
+ */
+export function currentTenancyScope(): TenancyScope | null {
+  return inSystemScope() ? null : requestTenancyScope(currentUser());
+}
+
+/**
+ * A Prisma client extension applying the caller's scope to every agency-scoped query. Nested
+ * writes and includes are not rewritten; start such queries from a scoped model.
+ */
+export function tenancyExtension(user: JWTClaims) {
+  const scope = tenancyScopeFor(user);
+  return Prisma.defineExtension(client =>
+    client.$extends({
+      name: 'tenancy',
+      query: {
+        $allModels: {
+          async $allOperations({ model, operation, args, query }) {
+            return runScoped(client, scope, model, operation, args, query);
+          },
+        },
+      },
+    })
+  );
+}
+
+function stampRow(model: string, config: ModelScope, row: any, scope: TenancyScope) {
+  if (!row) return row;
+  assertStaysInScope(model, config, row, scope);
+  // Agency callers' new rows are their agency's unless the relation is set another way
+  if (scope.kind === 'agency' && config.agencyColumn && row[config.agencyColumn] === undefined && !row.agency) {
+    return { ...row, [config.agencyColumn]: scope.agencyId };
+  }
+  return row;
+}
+
+function assertStaysInScope(model: string, config: ModelScope, data: any, scope: TenancyScope) {
+  if (!data || scope.kind === 'all') return;
+  const label = model.replace(/([a-z])([A-Z])/g, '$1 $2').toLowerCase();
+  if (scope.kind === 'agency' && config.agencyColumn) {
+    const agencyId = valueOf(data[config.agencyColumn]) ?? data.agency?.connect?.id;
+    if (agencyId !== undefined && agencyId !== scope.agencyId) {
+      throw new Error(`insufficient permissions to assign a ${label} to another agency`);
+    }
+  }
+  if (scope.kind === 'owner') {
+    if (config.agencyColumn) {
+      const agencyId = valueOf(data[config.agencyColumn]) ?? data.agency?.connect?.id;
+      // Owners may hand rows to an agency only through a delegation, never by writing the column
+      if (agencyId && model !== 'PropertyDelegation') {
+        throw new Error(`insufficient permissions to assign a ${label} to an agency`);
+      }
+    }
+    if (config.ownerColumn) {
+      const ownerId = valueOf(data[config.ownerColumn]);
+      if (ownerId !== undefined && ownerId !== scope.ownerId) {
+        throw new Error(`insufficient permissions to assign a ${label} to another owner`);
+      }
+    }
+  }
+}
+
+// A scalar write is the value itself or { set: value }
+function valueOf(value: any) {
+  return value !== null && typeof value === 'object' && 'set' in value ? value.set : value;
+}
@@ -0,0 +1,69 @@
+import { stripQuotedReply, htmlToText, REPLY_ABOVE_MARKER } from '../src/utils/email-reply.js';
+
+describe('stripQuotedReply', () => {
+	it('drops everything below the reply marker', () => {
+		const text = `Thanks, I will pay on Friday.\n\n${REPLY_ABOVE_MARKER}\nYour rent of KES 25,000 is due.`;
+
+		expect(stripQuotedReply(text)).toBe('Thanks, I will pay on Friday.');
+	});
+
+	it('strips a Gmail quote, including a header wrapped before "wrote:"', () => {
+		const text = [
+			'Sawa, asante.',
+			'',
+			'On Mon, 3 Jun 2026 at 10:12, LetRents <notifications@letrents.com>',
+			'wrote:',
+			'> Your maintenance request has been scheduled.',
+		].join('\r\n');
+
+		expect(stripQuotedReply(text)).toBe('Sawa, asante.');
+	});
+
+	it('strips a Gmail quote in Swahili', () => {
+		const text = 'Nitalipa kesho.\n\nTar. 3 Jun 2026 saa 10:12, LetRents <notifications@letrents.com> aliandika:\n> Kodi yako inadaiwa.';
+
+		expect(stripQuotedReply(text)).toBe('Nitalipa kesho.');
+	});
+
+	it('strips an Outlook header block with or without the separator', () => {
+		const withSeparator = 'Noted.\n\n________________________________\nFrom: LetRents <notifications@letrents.com>\nSent: Monday, June 3, 2026 10:12 AM\nTo: Jane\nSubject: Rent reminder';
+		const withoutSeparator = 'Noted.\n\nFrom: LetRents <notifications@letrents.com>\nSent: Monday, June 3, 2026 10:12 AM\nTo: Jane\nSubject: Rent reminder';
+		const originalMessage = 'Noted.\n\n-----Original Message-----\nFrom: LetRents';
+
+		expect(stripQuotedReply(withSeparator)).toBe('Noted.');
+		expect(stripQuotedReply(withoutSeparator)).toBe('Noted.');
+		expect(stripQuotedReply(originalMessage)).toBe('Noted.');
+	});
+
+	it('keeps a "From:" line the person typed', () => {
+		const text = 'The plumber came.\nFrom: 9am until noon there was no water.\nPlease check the tank.';
+
+		expect(stripQuotedReply(text)).toBe(text);
+	});
+
+	it('drops signatures, phone footers and a trailing run of quoted lines', () => {
+		expect(stripQuotedReply('Paid via M-Pesa.\n-- \nJane Wanjiku\n0712 345 678')).toBe('Paid via M-Pesa.');
+		expect(stripQuotedReply('Received, thanks.\n\nSent from my iPhone')).toBe('Received, thanks.');
+		expect(stripQuotedReply('Yes please.\n\n> Should we send the plumber?\n>\n> LetRents')).toBe('Yes please.');
+	});
+
+	it('keeps quoted lines the person answered in between', () => {
+		const text = '> Can you come at 10?\nYes, 10 works.';
+
+		expect(stripQuotedReply(text)).toBe(text);
+	});
+});
+
+describe('htmlToText', () => {
+	it('drops the quoted thread of Gmail and Outlook HTML replies', () => {
+		expect(htmlToText('<div>Paid today</div><div class="gmail_quote">On Mon ... wrote:<blockquote>old</blockquote></div>').trim())
+			.toBe('Paid today');
+		expect(htmlToText('<p>Paid today</p><div id="divRplyFwdMsg">From: LetRents</div><p>old</p>').trim())
+			.toBe('Paid today');
+	});
+
+	it('turns markup into lines and decodes entities', () => {
+		expect(htmlToText('<p>Rent &amp; water</p><p>KES&nbsp;25,000<br>due &lt;Friday&gt;</p>'))
+			.toBe('Rent & water\nKES 25,000\ndue <Friday>\n');
+	});
+});
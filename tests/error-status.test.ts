@@ -0,0 +1,41 @@
+import { statusFor } from '../src/utils/error-status.js';
+
+describe('statusFor', () => {
+	it('maps the common service messages', () => {
+		expect(statusFor('unit not found')).toBe(404);
+		expect(statusFor('Notification not found or access denied')).toBe(404);
+		expect(statusFor('insufficient permissions to access this lease')).toBe(403);
+		expect(statusFor('amount must be positive')).toBe(400);
+		expect(statusFor('tenant_id is required')).toBe(400);
+		expect(statusFor('settlement has already been approved')).toBe(409);
+		expect(statusFor('minimum stay for this unit is 2 nights')).toBe(400);
+		expect(statusFor('failed to fetch external calendar: 503')).toBe(502);
+	});
+
+	it('tells apart the meanings of "only" whatever the case', () => {
+		expect(statusFor('Only the sender can delete a message for everyone')).toBe(403);
+		expect(statusFor('Only super admins can approve erasure requests')).toBe(403);
+		expect(statusFor('Only pending requests can be reviewed; this one is approved')).toBe(409);
+		expect(statusFor('only pending payments can be approved')).toBe(409);
+		expect(statusFor('Only image files are allowed')).toBe(400);
+		expect(statusFor('only image documents can be read by OCR')).toBe(400);
+	});
+
+	it('checks permissions before state', () => {
+		expect(statusFor('insufficient permissions: email digests are not available for your role')).toBe(403);
+		expect(statusFor('unit is not available for applications')).toBe(409);
+	});
+
+	it('maps expiry, scanning and limits', () => {
+		expect(statusFor('This file has expired; generate it again')).toBe(410);
+		expect(statusFor('report.pdf was rejected: malware detected (Eicar)')).toBe(422);
+		expect(statusFor('attachment scanning is unavailable, please try again later')).toBe(503);
+		expect(statusFor('plan limit reached: the Starter plan allows 5 properties')).toBe(402);
+	});
+
+	it('falls back when nothing matches', () => {
+		expect(statusFor('connection reset')).toBe(500);
+		expect(statusFor('connection reset', 400)).toBe(400);
+		expect(statusFor()).toBe(500);
+	});
+});
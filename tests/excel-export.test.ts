@@ -0,0 +1,127 @@
+import zlib from 'zlib';
+import { buildExcelWorkbook, sheetToCsv, summarySheet, zip } from '../src/utils/excel-export.js';
+
+/**
+ * Read a zip back through its central directory, the way Excel does
+ */
+const unzip = (archive: Buffer) => {
+	const end = archive.length - 22;
+	expect(archive.readUInt32LE(end)).toBe(0x06054b50);
+	const count = archive.readUInt16LE(end + 10);
+	let offset = archive.readUInt32LE(end + 16);
+
+	const files: Record<string, string> = {};
+	for (let i = 0; i < count; i++) {
+		expect(archive.readUInt32LE(offset)).toBe(0x02014b50);
+		const compressedSize = archive.readUInt32LE(offset + 20);
+		const size = archive.readUInt32LE(offset + 24);
+		const nameLength = archive.readUInt16LE(offset + 28);
+		const localOffset = archive.readUInt32LE(offset + 42);
+		const name = archive.toString('utf-8', offset + 46, offset + 46 + nameLength);
+
+		expect(archive.readUInt32LE(localOffset)).toBe(0x04034b50);
+		const dataStart = localOffset + 30 + archive.readUInt16LE(localOffset + 26) + archive.readUInt16LE(localOffset + 28);
+		const data = zlib.inflateRawSync(archive.subarray(dataStart, dataStart + compressedSize));
+		expect(data.length).toBe(size);
+		files[name] = data.toString('utf-8');
+		offset += 46 + nameLength;
+	}
+	return files;
+};
+
+const cell = (xml: string, ref: string) => new RegExp(`<c r="${ref}"[^>]*?(/>|>.*?</c>)`).exec(xml)?.[0] || null;
+
+describe('buildExcelWorkbook', () => {
+	const workbook = buildExcelWorkbook([
+		{
+			name: 'Rent Roll',
+			columns: [
+				'Unit',
+				{ header: 'Rent', type: 'currency' },
+				{ header: 'Occupancy', type: 'percent' },
+				{ header: 'Lease End', type: 'date' },
+				{ header: 'Tenants', type: 'integer' },
+				'Notes',
+			],
+			rows: [
+				['A1', 25000, 95, new Date(Date.UTC(2026, 0, 1)), '2', 'Pays via M-Pesa & bank'],
+				['A2', '18500.50', null, '2026-03-15', 1, '<vacant>'],
+			],
+		},
+		summarySheet('Rent Roll', [['Total rent', 43500.5]]),
+	]);
+
+	it('is a zip holding a complete OOXML package', () => {
+		expect(workbook.subarray(0, 2).toString('latin1')).toBe('PK');
+		const files = unzip(workbook);
+
+		expect(Object.keys(files).sort()).toEqual([
+			'[Content_Types].xml',
+			'_rels/.rels',
+			'xl/_rels/workbook.xml.rels',
+			'xl/styles.xml',
+			'xl/workbook.xml',
+			'xl/worksheets/sheet1.xml',
+			'xl/worksheets/sheet2.xml',
+		]);
+		expect(files['[Content_Types].xml']).toContain('/xl/worksheets/sheet2.xml');
+	});
+
+	it('writes typed values rather than text', () => {
+		const sheet = unzip(workbook)['xl/worksheets/sheet1.xml'];
+
+		expect(cell(sheet, 'B2')).toBe('<c r="B2" s="3"><v>25000</v></c>');
+		expect(cell(sheet, 'B3')).toBe('<c r="B3" s="3"><v>18500.5</v></c>');
+		expect(cell(sheet, 'C2')).toBe('<c r="C2" s="5"><v>0.95</v></c>');
+		expect(cell(sheet, 'D2')).toBe('<c r="D2" s="4"><v>46023</v></c>');
+		expect(cell(sheet, 'D3')).toBe('<c r="D3" s="4"><v>46096</v></c>');
+		expect(cell(sheet, 'E2')).toBe('<c r="E2" s="2"><v>2</v></c>');
+		expect(cell(sheet, 'E3')).toBe('<c r="E3" s="2"><v>1</v></c>');
+		expect(cell(sheet, 'C3')).toBeNull();
+	});
+
+	it('escapes text cells and keeps the header styled', () => {
+		const sheet = unzip(workbook)['xl/worksheets/sheet1.xml'];
+
+		expect(cell(sheet, 'A1')).toBe('<c r="A1" s="1" t="inlineStr"><is><t>Unit</t></is></c>');
+		expect(cell(sheet, 'F2')).toContain('Pays via M-Pesa &amp; bank');
+		expect(cell(sheet, 'F3')).toContain('&lt;vacant&gt;');
+		expect(sheet).toContain('<autoFilter ref="A1:F3"/>');
+	});
+
+	it('gives sheets unique names Excel accepts', () => {
+		const named = unzip(buildExcelWorkbook([
+			{ name: 'Arrears: 2026/Q1', columns: ['A'], rows: [] },
+			{ name: 'A very long sheet name that goes past the limit', columns: ['A'], rows: [] },
+			{ name: 'rent roll', columns: ['A'], rows: [] },
+		]))['xl/workbook.xml'];
+
+		expect(named).toContain('name="Arrears  2026 Q1"');
+		expect(named).toContain('name="A very long sheet name that goe"');
+		expect(unzip(workbook)['xl/workbook.xml']).toContain('name="Rent Roll 2"');
+		expect(named).toContain('name="rent roll"');
+	});
+});
+
+describe('zip', () => {
+	it('round-trips arbitrary files', () => {
+		const files = unzip(zip([
+			{ name: 'data/payments.csv', data: Buffer.from('id,amount\n1,2500\n') },
+			{ name: 'empty.txt', data: Buffer.alloc(0) },
+		]));
+
+		expect(files).toEqual({ 'data/payments.csv': 'id,amount\n1,2500\n', 'empty.txt': '' });
+	});
+});
+
+describe('sheetToCsv', () => {
+	it('quotes cells with commas, quotes or line breaks', () => {
+		const csv = sheetToCsv({
+			name: 'Tenants',
+			columns: ['Name', { header: 'Note', type: 'string' }],
+			rows: [['Wanjiku, Jane', 'Said "next week"'], ['Otieno', 'line one\nline two'], ['Achieng', null]],
+		});
+
+		expect(csv).toBe('Name,Note\n"Wanjiku, Jane","Said ""next week"""\nOtieno,"line one\nline two"\nAchieng,\n');
+	});
+});
@@ -0,0 +1,93 @@
+import { readMediaMetadata } from '../src/utils/media-metadata.js';
+
+const u32 = (value: number) => {
+	const buffer = Buffer.alloc(4);
+	buffer.writeUInt32BE(value);
+	return buffer;
+};
+const u32le = (value: number) => {
+	const buffer = Buffer.alloc(4);
+	buffer.writeUInt32LE(value);
+	return buffer;
+};
+const u16le = (value: number) => {
+	const buffer = Buffer.alloc(2);
+	buffer.writeUInt16LE(value);
+	return buffer;
+};
+// ISO base media box: 32-bit size, four-character type, payload
+const box = (type: string, ...payload: Buffer[]) => {
+	const body = Buffer.concat(payload);
+	return Buffer.concat([u32(8 + body.length), Buffer.from(type, 'latin1'), body]);
+};
+
+const png = Buffer.concat([
+	Buffer.from([0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a]),
+	u32(13), Buffer.from('IHDR'), u32(640), u32(480),
+]);
+const gif = Buffer.concat([Buffer.from('GIF89a'), u16le(320), u16le(200)]);
+const jpeg = Buffer.concat([
+	Buffer.from([0xff, 0xd8]),
+	Buffer.from([0xff, 0xe0, 0x00, 0x10]), Buffer.alloc(14), // APP0
+	Buffer.from([0xff, 0xc0, 0x00, 0x11, 0x08, 0x03, 0x00, 0x04, 0x00]), Buffer.alloc(10), // SOF0: 1024x768
+]);
+const wav = Buffer.concat([
+	Buffer.from('RIFF'), u32le(36 + 40000), Buffer.from('WAVE'),
+	Buffer.from('fmt '), u32le(16), u16le(1), u16le(1), u32le(8000), u32le(16000), u16le(2), u16le(16),
+	Buffer.from('data'), u32le(40000),
+]);
+
+const mvhd = Buffer.alloc(100);
+mvhd.writeUInt32BE(1000, 12); // timescale
+mvhd.writeUInt32BE(12500, 16); // duration
+const tkhd = Buffer.alloc(84);
+tkhd.writeUInt32BE(1280 << 16, 76);
+tkhd.writeUInt32BE(720 << 16, 80);
+const mp4 = Buffer.concat([
+	box('ftyp', Buffer.from('isom'), u32(0), Buffer.from('isom')),
+	box('moov', box('mvhd', mvhd), box('trak', box('tkhd', tkhd))),
+]);
+
+describe('readMediaMetadata', () => {
+	it('reads image dimensions', () => {
+		expect(readMediaMetadata(png, 'image/png')).toEqual({ width: 640, height: 480 });
+		expect(readMediaMetadata(gif, 'image/gif')).toEqual({ width: 320, height: 200 });
+		expect(readMediaMetadata(jpeg, 'image/jpeg')).toEqual({ height: 768, width: 1024 });
+	});
+
+	it('reads audio and video length and frame size', () => {
+		expect(readMediaMetadata(wav, 'audio/wav')).toEqual({ duration_seconds: 2.5 });
+		expect(readMediaMetadata(mp4, 'video/mp4')).toEqual({ duration_seconds: 12.5, width: 1280, height: 720 });
+		expect(readMediaMetadata(mp4, 'audio/mp4')).toEqual({ duration_seconds: 12.5, width: 1280, height: 720 });
+	});
+
+	it('returns nothing for documents and unknown content', () => {
+		expect(readMediaMetadata(png, 'application/pdf')).toEqual({});
+		expect(readMediaMetadata(Buffer.from('not really an image'), 'image/png')).toEqual({});
+		expect(readMediaMetadata(Buffer.alloc(0), 'audio/mpeg')).toEqual({});
+	});
+
+	it('never throws on a truncated file', () => {
+		const samples: Array<[Buffer, string]> = [
+			[png, 'image/png'], [gif, 'image/gif'], [jpeg, 'image/jpeg'],
+			[wav, 'audio/wav'], [mp4, 'video/mp4'], [mp4, 'image/heic'],
+		];
+		for (const [file, mimeType] of samples) {
+			for (let length = 0; length < file.length; length++) {
+				expect(() => readMediaMetadata(file.subarray(0, length), mimeType)).not.toThrow();
+			}
+		}
+	});
+
+	it('never throws on malformed headers', () => {
+		const hugeId3 = Buffer.concat([Buffer.from('ID3'), Buffer.from([4, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f]), Buffer.alloc(8)]);
+		const badJpegSegment = Buffer.from([0xff, 0xd8, 0xff, 0xe0, 0xff, 0xff, 0, 0, 0, 0, 0, 0]);
+		const boxPastTheEnd = Buffer.concat([box('ftyp', Buffer.from('isom')), u32(1), Buffer.from('moov'), u32(0xffffffff), u32(0xffffffff)]);
+		const oggWithoutPages = Buffer.concat([Buffer.from('OggS'), Buffer.from('OpusHead'), Buffer.alloc(2)]);
+
+		expect(readMediaMetadata(hugeId3, 'audio/mpeg')).toEqual({});
+		expect(readMediaMetadata(badJpegSegment, 'image/jpeg')).toEqual({});
+		expect(() => readMediaMetadata(boxPastTheEnd, 'video/mp4')).not.toThrow();
+		expect(readMediaMetadata(oggWithoutPages, 'audio/ogg')).toEqual({});
+	});
+});
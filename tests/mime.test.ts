@@ -0,0 +1,109 @@
+import { parseMime, decodeHeaderWords, emailAddressOf } from '../src/utils/mime.js';
+
+const crlf = (lines: string[]) => lines.join('\r\n');
+
+describe('parseMime', () => {
+	it('reads a multipart message with quoted-printable text, base64 HTML and an attachment', () => {
+		const raw = crlf([
+			'From: =?utf-8?B?SmFuZSBXYW5qaWt1?= <Jane@Example.com>',
+			'To: reply+abc@inbound.letrents.com, Office <office@example.com>',
+			'Subject: =?utf-8?Q?Maji_yamekatika_=E2=80=93_unit_4?=',
+			'Message-ID: <msg-1@example.com>',
+			'Content-Type: multipart/mixed; boundary="outer"',
+			'',
+			'--outer',
+			'Content-Type: multipart/alternative; boundary="inner"',
+			'',
+			'--inner',
+			'Content-Type: text/plain; charset=utf-8',
+			'Content-Transfer-Encoding: quoted-printable',
+			'',
+			'The water is off since 6am =E2=80=93 please send someone. This line is lon=',
+			'g enough to be soft-wrapped.',
+			'--inner',
+			'Content-Type: text/html; charset=utf-8',
+			'Content-Transfer-Encoding: base64',
+			'',
+			Buffer.from('<p>The water is off</p>').toString('base64'),
+			'--inner--',
+			'--outer',
+			'Content-Type: application/pdf',
+			"Content-Disposition: attachment; filename*=utf-8''meter%20reading.pdf",
+			'Content-Transfer-Encoding: base64',
+			'',
+			Buffer.from('%PDF-1.4 test').toString('base64'),
+			'--outer--',
+			'',
+		]);
+
+		const parsed = parseMime(Buffer.from(raw, 'latin1'));
+
+		expect(parsed.from).toBe('Jane Wanjiku <Jane@Example.com>');
+		expect(parsed.subject).toBe('Maji yamekatika – unit 4');
+		expect(parsed.messageId).toBe('msg-1@example.com');
+		expect(parsed.to).toEqual(['reply+abc@inbound.letrents.com', 'office@example.com']);
+		expect(parsed.text).toBe('The water is off since 6am – please send someone. This line is long enough to be soft-wrapped.');
+		expect(parsed.html).toBe('<p>The water is off</p>');
+		expect(parsed.attachments).toHaveLength(1);
+		expect(parsed.attachments[0].filename).toBe('meter reading.pdf');
+		expect(parsed.attachments[0].contentType).toBe('application/pdf');
+		expect(parsed.attachments[0].content.toString('latin1')).toBe('%PDF-1.4 test');
+	});
+
+	it('treats a message without a content type as plain text', () => {
+		const parsed = parseMime('From: tenant@example.com\nSubject: Hello\n\nJust text\n');
+
+		expect(parsed.text).toBe('Just text\n');
+		expect(parsed.html).toBeNull();
+		expect(parsed.attachments).toEqual([]);
+	});
+
+	it('decodes the body in its declared charset', () => {
+		const raw = crlf([
+			'Content-Type: text/plain; charset=iso-8859-1',
+			'Content-Transfer-Encoding: quoted-printable',
+			'',
+			'Caf=E9 au lait',
+		]);
+
+		expect(parseMime(raw).text).toBe('Café au lait');
+	});
+
+	it('skips forwarded messages', () => {
+		const raw = crlf([
+			'Content-Type: multipart/mixed; boundary="b"',
+			'',
+			'--b',
+			'Content-Type: text/plain',
+			'',
+			'See below',
+			'--b',
+			'Content-Type: message/rfc822',
+			'',
+			'Subject: old thread',
+			'',
+			'old text',
+			'--b--',
+		]);
+
+		const parsed = parseMime(raw);
+		expect(parsed.text).toBe('See below');
+		expect(parsed.attachments).toEqual([]);
+	});
+});
+
+describe('decodeHeaderWords', () => {
+	it('joins adjacent encoded words and leaves plain text alone', () => {
+		expect(decodeHeaderWords('=?utf-8?Q?Habari?= =?utf-8?Q?_yako?=')).toBe('Habari yako');
+		expect(decodeHeaderWords('Rent receipt')).toBe('Rent receipt');
+	});
+});
+
+describe('emailAddressOf', () => {
+	it('extracts the bare address in lower case', () => {
+		expect(emailAddressOf('Jane Doe <Jane.Doe@Example.com>')).toBe('jane.doe@example.com');
+		expect(emailAddressOf('tenant@example.com')).toBe('tenant@example.com');
+		expect(emailAddressOf('undisclosed-recipients:;')).toBeNull();
+		expect(emailAddressOf(null)).toBeNull();
+	});
+});
@@ -0,0 +1,156 @@
+import { scopeQuery, tenancyScopeFor, tenancyFilter, parentReferences, requestTenancyScope, currentTenancyScope } from '../src/utils/tenancy-scope.js';
+import { runAsSystem, runAsUser } from '../src/utils/request-context.js';
+import { JWTClaims } from '../src/types/index.js';
+
+const claims = (overrides: Partial<JWTClaims>): JWTClaims => ({
+	user_id: 'user-1',
+	email: 'user@example.com',
+	phone_number: '',
+	role: 'agency_admin',
+	session_id: 'session',
+	permissions: [],
+	iat: 0,
+	exp: 0,
+	nbf: 0,
+	iss: 'test',
+	sub: 'user-1',
+	...overrides,
+});
+
+const agencyA = claims({ user_id: 'admin-a', role: 'agency_admin', agency_id: 'agency-a', company_id: 'company-1' });
+const agencyB = claims({ user_id: 'admin-b', role: 'agency_admin', agency_id: 'agency-b', company_id: 'company-1' });
+const landlord = claims({ user_id: 'landlord-1', role: 'landlord', company_id: 'company-1' });
+const superAdmin = claims({ user_id: 'root', role: 'super_admin' });
+
+// Both agencies sit in the same company, so company scoping alone would not separate them
+const properties = [
+	{ id: 'p-a1', agency_id: 'agency-a', owner_id: 'landlord-1', company_id: 'company-1' },
+	{ id: 'p-a2', agency_id: 'agency-a', owner_id: 'landlord-2', company_id: 'company-1' },
+	{ id: 'p-b1', agency_id: 'agency-b', owner_id: 'landlord-1', company_id: 'company-1' },
+	{ id: 'p-own', agency_id: null, owner_id: 'landlord-1', company_id: 'company-1' },
+];
+const units = properties.map(property => ({ id: `u-${property.id}`, property_id: property.id, property }));
+const invoices = [
+	...properties.map(property => ({ id: `i-${property.id}`, property_id: property.id, property, company_id: 'company-1' })),
+	{ id: 'i-company', property_id: null, property: null, company_id: 'company-1' },
+	{ id: 'i-other-company', property_id: null, property: null, company_id: 'company-2' },
+];
+const templates = [
+	{ id: 't-a', agency_id: 'agency-a', company_id: 'company-1' },
+	{ id: 't-b', agency_id: 'agency-b', company_id: 'company-1' },
+	{ id: 't-shared', agency_id: null, company_id: 'company-1' },
+	{ id: 't-other-company', agency_id: null, company_id: 'company-2' },
+];
+
+// Enough of Prisma's where semantics to run the scoped filters over the rows above
+function matches(row: any, where: any): boolean {
+	return Object.entries(where || {}).every(([key, condition]: [string, any]) => {
+		if (key === 'AND') return (Array.isArray(condition) ? condition : [condition]).every(c => matches(row, c));
+		if (key === 'OR') return condition.some((c: any) => matches(row, c));
+		if (condition !== null && typeof condition === 'object') {
+			if ('in' in condition) return condition.in.includes(row[key]);
+			return row[key] != null && matches(row[key], condition);
+		}
+		return row[key] === condition;
+	});
+}
+
+const run = (rows: any[], model: string, args: any, user: JWTClaims) =>
+	rows.filter(row => matches(row, scopeQuery(model, 'findMany', args, tenancyScopeFor(user)).where));
+
+describe('Tenancy scoping', () => {
+	it('resolves who a caller is scoped to', () => {
+		expect(tenancyScopeFor(superAdmin)).toEqual({ kind: 'all' });
+		expect(tenancyScopeFor(agencyA)).toEqual({ kind: 'agency', agencyId: 'agency-a', companyId: 'company-1' });
+		expect(tenancyScopeFor(landlord)).toEqual({ kind: 'owner', ownerId: 'landlord-1', companyId: 'company-1' });
+		expect(tenancyScopeFor(claims({ role: 'caretaker', landlord_id: 'landlord-1' }))).toMatchObject({ kind: 'owner', ownerId: 'landlord-1' });
+	});
+
+	it('only returns the caller agency\'s properties', () => {
+		expect(run(properties, 'Property', {}, agencyA).map(p => p.id)).toEqual(['p-a1', 'p-a2']);
+		expect(run(properties, 'Property', {}, agencyB).map(p => p.id)).toEqual(['p-b1']);
+	});
+
+	it('cannot be widened by asking for another agency or id', () => {
+		expect(run(properties, 'Property', { where: { agency_id: 'agency-b' } }, agencyA)).toEqual([]);
+		expect(run(properties, 'Property', { where: { id: 'p-b1' } }, agencyA)).toEqual([]);
+		expect(run(properties, 'Property', { where: { OR: [{ id: 'p-b1' }, { id: 'p-own' }] } }, agencyA)).toEqual([]);
+		expect(run(properties, 'Property', { where: { AND: [{ company_id: 'company-1' }] } }, agencyA).every(p => p.agency_id === 'agency-a')).toBe(true);
+	});
+
+	it('keeps unique keys at the top level of findUnique and update', () => {
+		const scoped = scopeQuery('Property', 'findUnique', { where: { id: 'p-b1' } }, tenancyScopeFor(agencyA));
+		expect(scoped.where.id).toBe('p-b1');
+		expect(scoped.where.AND).toEqual([{ agency_id: 'agency-a' }]);
+		expect(matches(properties.find(p => p.id === 'p-b1'), scoped.where)).toBe(false);
+
+		const update = scopeQuery('Property', 'update', { where: { id: 'p-b1' }, data: { name: 'Taken' } }, tenancyScopeFor(agencyA));
+		expect(matches(properties.find(p => p.id === 'p-b1'), update.where)).toBe(false);
+	});
+
+	it('scopes units through their property', () => {
+		expect(run(units, 'Unit', {}, agencyA).map(u => u.id)).toEqual(['u-p-a1', 'u-p-a2']);
+		expect(run(units, 'Unit', { where: { property_id: 'p-b1' } }, agencyA)).toEqual([]);
+		expect(parentReferences('Unit', 'create', { data: { property_id: 'p-b1', unit_number: '1' } })).toEqual([{ model: 'Property', id: 'p-b1' }]);
+	});
+
+	it('stamps new rows with the caller agency and refuses other agencies', () => {
+		const created = scopeQuery('Property', 'create', { data: { name: 'New' } }, tenancyScopeFor(agencyA));
+		expect(created.data.agency_id).toBe('agency-a');
+		expect(() => scopeQuery('Property', 'create', { data: { name: 'New', agency_id: 'agency-b' } }, tenancyScopeFor(agencyA))).toThrow('another agency');
+		expect(() => scopeQuery('Property', 'createMany', { data: [{ name: 'Ok' }, { name: 'Bad', agency_id: 'agency-b' }] }, tenancyScopeFor(agencyA))).toThrow('another agency');
+		expect(() => scopeQuery('Property', 'update', { where: { id: 'p-a1' }, data: { agency_id: { set: 'agency-b' } } }, tenancyScopeFor(agencyA))).toThrow('another agency');
+		expect(() => scopeQuery('PropertyDelegation', 'upsert', { where: { id: 'd' }, create: { agency_id: 'agency-b' }, update: {} }, tenancyScopeFor(agencyA))).toThrow('another agency');
+	});
+
+	it('scopes landlords to what they own', () => {
+		expect(run(properties, 'Property', {}, landlord).map(p => p.id)).toEqual(['p-a1', 'p-b1', 'p-own']);
+		expect(() => scopeQuery('Property', 'update', { where: { id: 'p-own' }, data: { owner_id: 'landlord-2' } }, tenancyScopeFor(landlord))).toThrow('another owner');
+		expect(() => scopeQuery('Property', 'update', { where: { id: 'p-own' }, data: { agency_id: 'agency-a' } }, tenancyScopeFor(landlord))).toThrow('to an agency');
+		expect(run([{ id: 'b', agency_id: 'agency-a' }], 'AgencyBranding', {}, landlord)).toEqual([]);
+	});
+
+	it('lets a delegation put the agency on the landlord\'s property', async () => {
+		const handOver = { where: { id: 'p-own' }, data: { agency_id: 'agency-a' } };
+		await runAsUser(landlord, async () => {
+			expect(() => scopeQuery('Property', 'update', handOver, currentTenancyScope()!)).toThrow('to an agency');
+			// What the delegation service runs its property writes under once it has checked ownership
+			expect(await runAsSystem(async () => currentTenancyScope())).toBeNull();
+			expect(currentTenancyScope()).toEqual(tenancyScopeFor(landlord));
+		});
+		// Ending one puts the property back without the agency, which the agency's own scope refuses
+		const handBack = { where: { id: 'p-a1', agency_id: 'agency-a' }, data: { agency_id: null } };
+		runAsUser(agencyA, () => {
+			expect(() => scopeQuery('Property', 'updateMany', handBack, currentTenancyScope()!)).toThrow('another agency');
+			expect(runAsSystem(() => currentTenancyScope())).toBeNull();
+		});
+	});
+
+	it('scopes invoices through their property and shares the company\'s own', () => {
+		expect(run(invoices, 'Invoice', {}, agencyA).map(i => i.id)).toEqual(['i-p-a1', 'i-p-a2', 'i-company']);
+		expect(run(invoices, 'Invoice', {}, landlord).map(i => i.id)).toEqual(['i-p-a1', 'i-p-b1', 'i-p-own', 'i-company']);
+		expect(parentReferences('MaintenanceRequest', 'create', { data: { property_id: 'p-b1' } })).toEqual([{ model: 'Property', id: 'p-b1' }]);
+	});
+
+	it('scopes requests for agency staff and landlords only', () => {
+		expect(requestTenancyScope(undefined)).toBeNull();
+		expect(requestTenancyScope(superAdmin)).toBeNull();
+		expect(requestTenancyScope(claims({ role: 'tenant', company_id: 'company-1' }))).toBeNull();
+		expect(requestTenancyScope(claims({ role: 'caretaker', company_id: 'company-1' }))).toBeNull();
+		expect(requestTenancyScope(agencyA)).toEqual(tenancyScopeFor(agencyA));
+		expect(requestTenancyScope(landlord)).toEqual(tenancyScopeFor(landlord));
+	});
+
+	it('shares company-wide rows with agencies for reading but not writing', () => {
+		expect(run(templates, 'MessageTemplate', {}, agencyA).map(t => t.id)).toEqual(['t-a', 't-shared']);
+		const update = scopeQuery('MessageTemplate', 'updateMany', { where: {}, data: { name: 'x' } }, tenancyScopeFor(agencyA));
+		expect(templates.filter(t => matches(t, update.where)).map(t => t.id)).toEqual(['t-a']);
+	});
+
+	it('leaves super admins and unscoped models alone', () => {
+		const args = { where: { id: 'p-b1' } };
+		expect(scopeQuery('Property', 'findUnique', args, tenancyScopeFor(superAdmin))).toBe(args);
+		expect(scopeQuery('Vendor', 'findMany', args, tenancyScopeFor(agencyA))).toBe(args);
+		expect(tenancyFilter('Vendor', tenancyScopeFor(agencyA))).toBeNull();
+	});
+});